@@ -1,7 +1,13 @@
 package signer_test
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -61,3 +67,150 @@ func createDir(dir string) error {
 	}
 	return nil
 }
+
+// signedData is the part of a CMS SignedData the tests check
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+	}
+	Certificates asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos  []struct {
+		Version            int
+		SID                asn1.RawValue
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+	} `asn1:"set"`
+}
+
+// parseSignedData parses a CAdES signature
+func parseSignedData(t *testing.T, signature []byte) *signedData {
+	t.Helper()
+	var contentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(signature, &contentInfo); err != nil {
+		t.Fatal(err)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	return &sd
+}
+
+func TestCAdESStreaming(t *testing.T) {
+	s, err := signer.NewTestSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple := s.(signer.Simple)
+	key := simple.Public().(ecdsa.PublicKey)
+
+	// a content larger than the read buffers
+	data := bytes.Repeat([]byte("large document "), 1<<16)
+	for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		opts := signer.CAdESOpts{Detached: true, Hash: hash}
+		signature, err := simple.SignReader(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatalf("%v: %v", hash, err)
+		}
+		sd := parseSignedData(t, signature)
+		if len(sd.EncapContentInfo.Content.FullBytes) != 0 {
+			t.Errorf("%v: expected a detached signature without eContent", hash)
+		}
+
+		// the signed attributes hold the digest of the content, and are
+		// signed with the digest algorithm
+		h := hash.New()
+		h.Write(data)
+		digest := h.Sum(nil)
+		si := sd.SignerInfos[0]
+		if !bytes.Contains(si.SignedAttrs.Bytes, digest) {
+			t.Errorf("%v: expected the message digest of the content", hash)
+		}
+		attrs := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+		h = hash.New()
+		h.Write(attrs)
+		if !ecdsa.VerifyASN1(&key, h.Sum(nil), si.Signature) {
+			t.Errorf("%v: invalid signature of the signed attributes", hash)
+		}
+		if !si.DigestAlgorithm.Algorithm.Equal(sd.DigestAlgorithms[0].Algorithm) {
+			t.Errorf("%v: digest algorithms %v and %v differ", hash, si.DigestAlgorithm.Algorithm, sd.DigestAlgorithms[0].Algorithm)
+		}
+
+		// external hashing gives the same digest
+		external, err := signer.DigestReader(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(external, digest) {
+			t.Errorf("%v: unexpected external digest", hash)
+		}
+		if _, err := simple.SignDigest(external, opts); err != nil {
+			t.Errorf("%v: %v", hash, err)
+		}
+	}
+
+	// embedded content from a reader
+	signature, err := simple.SignReader(bytes.NewReader(data[:64]), signer.CAdESOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd := parseSignedData(t, signature); !bytes.Contains(sd.EncapContentInfo.Content.Bytes, data[:64]) {
+		t.Error("expected the content embedded")
+	}
+
+	if _, err := simple.SignDigest(make([]byte, 20), signer.CAdESOpts{}); err == nil {
+		t.Error("expected an error for a digest of another size")
+	}
+	if _, err := simple.SignDigest(make([]byte, 16), signer.CAdESOpts{Hash: crypto.MD5}); err == nil {
+		t.Error("expected an error for an unsupported digest algorithm")
+	}
+}
+
+func TestVerifySigningCertificate(t *testing.T) {
+	s, err := signer.NewTestSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple := s.(signer.Simple)
+	for _, detached := range []bool{false, true} {
+		signature, err := simple.Sign(rand.Reader, []byte("content"), signer.CAdESOpts{Detached: detached})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := signer.VerifySigningCertificate(signature)
+		if err != nil {
+			t.Fatalf("detached %v: %v", detached, err)
+		}
+		if !cert.Equal(simple.PublicKeyCertificate) {
+			t.Errorf("detached %v: unexpected signer certificate", detached)
+		}
+	}
+
+	// the certificate substituted by another of the same size
+	signature, err := simple.Sign(rand.Reader, []byte("content"), signer.CAdESOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var other signer.Simple
+	for {
+		s, err := signer.NewTestSigner()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other = s.(signer.Simple); len(other.PublicKeyCertificate.Raw) == len(simple.PublicKeyCertificate.Raw) {
+			break
+		}
+	}
+	substituted := bytes.Replace(signature, simple.PublicKeyCertificate.Raw, other.PublicKeyCertificate.Raw, 1)
+	if _, err := signer.VerifySigningCertificate(substituted); !errors.Is(err, signer.ErrCertificateMismatch) {
+		t.Fatalf("expected ErrCertificateMismatch for a substituted certificate, got %v", err)
+	}
+}
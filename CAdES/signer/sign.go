@@ -0,0 +1,315 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// digestAlgorithm is a supported digest algorithm and the matching ECDSA
+// signature algorithm
+type digestAlgorithm struct {
+	hash      crypto.Hash
+	oid       asn1.ObjectIdentifier
+	signature asn1.ObjectIdentifier
+}
+
+var digestAlgorithms = map[crypto.Hash]digestAlgorithm{
+	crypto.SHA256: {crypto.SHA256, oidSHA256, oidECDSAWithSHA256},
+	crypto.SHA384: {crypto.SHA384, oidSHA384, oidECDSAWithSHA384},
+	crypto.SHA512: {crypto.SHA512, oidSHA512, oidECDSAWithSHA512},
+}
+
+// lookupDigestAlgorithm returns the digest algorithm of h, SHA-256 when 0
+func lookupDigestAlgorithm(h crypto.Hash) (digestAlgorithm, error) {
+	if h == 0 {
+		h = crypto.SHA256
+	}
+	alg, ok := digestAlgorithms[h]
+	if !ok {
+		return digestAlgorithm{}, fmt.Errorf("unsupported digest algorithm %v", h)
+	}
+	return alg, nil
+}
+
+// DigestReader hashes the content read from r with the digest algorithm of
+// opts, without holding it in memory, for SignDigest
+func DigestReader(r io.Reader, opts CAdESOpts) ([]byte, error) {
+	alg, err := lookupDigestAlgorithm(opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	h := alg.hash.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("hash content: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// SignReader signs the content read from r. With opts.Detached the content is
+// only streamed through the hash, so files of any size are signed in constant
+// memory; an enveloping signature embeds the content, read into memory.
+func SignReader(r io.Reader, privateKey *ecdsa.PrivateKey, cert *x509.Certificate, opts CAdESOpts) ([]byte, error) {
+	if !opts.Detached {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("read content: %w", err)
+		}
+		return sign(data, nil, privateKey, cert, opts)
+	}
+	digest, err := DigestReader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return SignDigest(digest, privateKey, cert, opts)
+}
+
+// SignDigest creates a detached signature of content hashed externally with
+// the digest algorithm of opts (DigestReader), e.g. by the system storing a
+// large document. opts.Detached is implied.
+func SignDigest(digest []byte, privateKey *ecdsa.PrivateKey, cert *x509.Certificate, opts CAdESOpts) ([]byte, error) {
+	opts.Detached = true
+	return sign(nil, digest, privateKey, cert, opts)
+}
+
+// sign creates the CAdES-BES signature of data, or of the digest of external
+// content when data is nil. The content is embedded unless opts.Detached.
+func sign(data, digest []byte, privateKey *ecdsa.PrivateKey, cert *x509.Certificate, opts CAdESOpts) ([]byte, error) {
+	alg, err := lookupDigestAlgorithm(opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if digest == nil {
+		h := alg.hash.New()
+		h.Write(data)
+		digest = h.Sum(nil)
+	} else if len(digest) != alg.hash.Size() {
+		return nil, fmt.Errorf("digest of %d bytes, expected %d for %v", len(digest), alg.hash.Size(), alg.hash)
+	}
+
+	// Create signing certificate v2 attribute (mandatory for CAdES-BES)
+	certHash := sha256.Sum256(cert.Raw)
+
+	essCertID := essCertIDv2{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		CertHash:      certHash[:],
+		IssuerSerial: issuerAndSerial{
+			Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+			SerialNumber: cert.SerialNumber,
+		},
+	}
+
+	signingCertV2 := signingCertificateV2{
+		Certs: []essCertIDv2{essCertID},
+	}
+
+	signingCertV2Bytes, err := asn1.Marshal(signingCertV2)
+	if err != nil {
+		return nil, fmt.Errorf("marshal signing cert v2: %w", err)
+	}
+
+	// Wrap in SET for attribute value
+	signingCertV2Set := append([]byte{0x31}, encodeLength(len(signingCertV2Bytes))...)
+	signingCertV2Set = append(signingCertV2Set, signingCertV2Bytes...)
+
+	// Create signing time (mandatory)
+	signingTime := time.Now().UTC()
+	signingTimeBytes, err := asn1.Marshal(signingTime)
+	if err != nil {
+		return nil, fmt.Errorf("marshal signing time: %w", err)
+	}
+
+	// Wrap in SET
+	signingTimeSet := append([]byte{0x31}, encodeLength(len(signingTimeBytes))...)
+	signingTimeSet = append(signingTimeSet, signingTimeBytes...)
+
+	// Create message digest attribute (mandatory)
+	messageDigestBytes, err := asn1.Marshal(digest)
+	if err != nil {
+		return nil, fmt.Errorf("marshal message digest: %w", err)
+	}
+
+	// Wrap in SET
+	messageDigestSet := append([]byte{0x31}, encodeLength(len(messageDigestBytes))...)
+	messageDigestSet = append(messageDigestSet, messageDigestBytes...)
+
+	// Create content type attribute (mandatory)
+	contentTypeBytes, err := asn1.Marshal(oidData)
+	if err != nil {
+		return nil, fmt.Errorf("marshal content type: %w", err)
+	}
+
+	// Wrap in SET
+	contentTypeSet := append([]byte{0x31}, encodeLength(len(contentTypeBytes))...)
+	contentTypeSet = append(contentTypeSet, contentTypeBytes...)
+
+	// Build signed attributes - MUST be in ascending order by OID
+	attrs := []attribute{
+		{Type: oidContentType, Values: asn1.RawValue{FullBytes: contentTypeSet}},
+		{Type: oidSigningTime, Values: asn1.RawValue{FullBytes: signingTimeSet}},
+		{Type: oidMessageDigest, Values: asn1.RawValue{FullBytes: messageDigestSet}},
+		{Type: oidSigningCertificateV2, Values: asn1.RawValue{FullBytes: signingCertV2Set}},
+	}
+
+	// Sort attributes by OID (ETSI requirement)
+	sort.Slice(attrs, func(i, j int) bool {
+		return oidLess(attrs[i].Type, attrs[j].Type)
+	})
+
+	// Marshal attributes as SET OF
+	signedAttrsSet, err := marshalAttributes(attrs)
+	if err != nil {
+		return nil, fmt.Errorf("marshal signed attrs: %w", err)
+	}
+
+	// Hash the signed attributes for signature, with the digest algorithm
+	h := alg.hash.New()
+	h.Write(signedAttrsSet)
+	attrsHash := h.Sum(nil)
+
+	// Sign with ECDSA
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, attrsHash)
+	if err != nil {
+		return nil, fmt.Errorf("ecdsa sign: %w", err)
+	}
+
+	// Encode ECDSA signature as DER SEQUENCE
+	ecdsaSig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		return nil, fmt.Errorf("marshal ecdsa sig: %w", err)
+	}
+
+	// Build SignerInfo manually to ensure correct structure
+	var signerInfoBytes []byte
+
+	// Version INTEGER
+	versionBytes, _ := asn1.Marshal(1)
+	signerInfoBytes = append(signerInfoBytes, versionBytes...)
+
+	// IssuerAndSerialNumber
+	sidBytes, err := asn1.Marshal(issuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal sid: %w", err)
+	}
+	signerInfoBytes = append(signerInfoBytes, sidBytes...)
+
+	// DigestAlgorithm
+	digestAlgBytes, err := asn1.Marshal(pkix.AlgorithmIdentifier{Algorithm: alg.oid})
+	if err != nil {
+		return nil, fmt.Errorf("marshal digest alg: %w", err)
+	}
+	signerInfoBytes = append(signerInfoBytes, digestAlgBytes...)
+
+	// SignedAttrs [0] IMPLICIT
+	// Change the SET tag (0x31) to context-specific [0] (0xA0)
+	signedAttrsImplicit := make([]byte, len(signedAttrsSet))
+	copy(signedAttrsImplicit, signedAttrsSet)
+	signedAttrsImplicit[0] = 0xA0 // [0] IMPLICIT
+	signerInfoBytes = append(signerInfoBytes, signedAttrsImplicit...)
+
+	// SignatureAlgorithm
+	sigAlgBytes, err := asn1.Marshal(pkix.AlgorithmIdentifier{Algorithm: alg.signature})
+	if err != nil {
+		return nil, fmt.Errorf("marshal sig alg: %w", err)
+	}
+	signerInfoBytes = append(signerInfoBytes, sigAlgBytes...)
+
+	// Signature OCTET STRING
+	sigBytes, err := asn1.Marshal(ecdsaSig)
+	if err != nil {
+		return nil, fmt.Errorf("marshal signature: %w", err)
+	}
+	signerInfoBytes = append(signerInfoBytes, sigBytes...)
+
+	// Wrap SignerInfo in SEQUENCE
+	signerInfoSeq := append([]byte{0x30}, encodeLength(len(signerInfoBytes))...)
+	signerInfoSeq = append(signerInfoSeq, signerInfoBytes...)
+
+	// Wrap SignerInfo in SET OF
+	signerInfosSet := append([]byte{0x31}, encodeLength(len(signerInfoSeq))...)
+	signerInfosSet = append(signerInfosSet, signerInfoSeq...)
+
+	// Build DigestAlgorithms SET
+	digestAlgs := []pkix.AlgorithmIdentifier{{Algorithm: alg.oid}}
+	digestAlgsBytes, err := asn1.Marshal(digestAlgs)
+	if err != nil {
+		return nil, fmt.Errorf("marshal digest algs: %w", err)
+	}
+	digestAlgsBytes[0] = 0x31 // Change to SET
+
+	// Build Certificates [0] IMPLICIT
+	certsImplicit := append([]byte{0xA0}, encodeLength(len(cert.Raw))...)
+	certsImplicit = append(certsImplicit, cert.Raw...)
+
+	// Build EncapContentInfo
+	contentTypeOIDBytes, _ := asn1.Marshal(oidData)
+	var encapContentInfo []byte
+	if opts.Detached {
+		// Without eContent for detached signatures: only contains
+		// contentType, no [0] eContent field
+		encapContentInfo = append([]byte{0x30}, encodeLength(len(contentTypeOIDBytes))...)
+		encapContentInfo = append(encapContentInfo, contentTypeOIDBytes...)
+	} else {
+		// For CAdES-BES, eContent must be an OCTET STRING inside [0] EXPLICIT
+		contentOctetString, err := asn1.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("marshal content: %w", err)
+		}
+
+		// Build eContent [0] EXPLICIT containing OCTET STRING
+		eContentExplicit := append([]byte{0xA0}, encodeLength(len(contentOctetString))...)
+		eContentExplicit = append(eContentExplicit, contentOctetString...)
+
+		encapContentInfo = append([]byte{0x30}, encodeLength(len(contentTypeOIDBytes)+len(eContentExplicit))...)
+		encapContentInfo = append(encapContentInfo, contentTypeOIDBytes...)
+		encapContentInfo = append(encapContentInfo, eContentExplicit...)
+	}
+
+	// Build SignedData SEQUENCE
+	var signedDataBytes []byte
+
+	// Version
+	signedDataBytes = append(signedDataBytes, versionBytes...)
+
+	// DigestAlgorithms
+	signedDataBytes = append(signedDataBytes, digestAlgsBytes...)
+
+	// EncapContentInfo
+	signedDataBytes = append(signedDataBytes, encapContentInfo...)
+
+	// Certificates [0]
+	signedDataBytes = append(signedDataBytes, certsImplicit...)
+
+	// SignerInfos
+	signedDataBytes = append(signedDataBytes, signerInfosSet...)
+
+	// Wrap in SEQUENCE
+	signedDataSeq := append([]byte{0x30}, encodeLength(len(signedDataBytes))...)
+	signedDataSeq = append(signedDataSeq, signedDataBytes...)
+
+	// Build ContentInfo
+	signedDataOIDBytes, _ := asn1.Marshal(oidSignedData)
+
+	// Wrap SignedData in [0] EXPLICIT
+	signedDataExplicit := append([]byte{0xA0}, encodeLength(len(signedDataSeq))...)
+	signedDataExplicit = append(signedDataExplicit, signedDataSeq...)
+
+	// Build final ContentInfo SEQUENCE
+	contentInfo := append([]byte{0x30}, encodeLength(len(signedDataOIDBytes)+len(signedDataExplicit))...)
+	contentInfo = append(contentInfo, signedDataOIDBytes...)
+	contentInfo = append(contentInfo, signedDataExplicit...)
+
+	return contentInfo, nil
+}
@@ -18,29 +18,41 @@ type Simple struct {
 	PublicKeyCertificate *x509.Certificate
 }
 
-// CAdES options; for now only detached true/false
+// CAdES options
 type CAdESOpts struct {
 	Detached bool // default: false
+	// Hash is the digest algorithm of the content and the signed
+	// attributes: crypto.SHA256 (default when 0), SHA384 or SHA512
+	Hash crypto.Hash
 }
 
 func (opts CAdESOpts) HashFunc() crypto.Hash {
-	return crypto.SHA256
+	if opts.Hash == 0 {
+		return crypto.SHA256
+	}
+	return opts.Hash
 }
 
 func (s Simple) Sign(rand io.Reader, data []byte, opts crypto.SignerOpts) (signature []byte, err error) {
 
 	// Default values
-	detached := false
+	var cadesOpts CAdESOpts
 
 	// Type assert to your custom options
-	if cadesOpts, ok := opts.(CAdESOpts); ok {
-		detached = cadesOpts.Detached
+	if o, ok := opts.(CAdESOpts); ok {
+		cadesOpts = o
 	}
+	return sign(data, nil, s.secretKey, s.PublicKeyCertificate, cadesOpts)
+}
 
-	if detached {
-		return CreateDetachedCAdESSignature(data, s.secretKey, s.PublicKeyCertificate)
-	}
-	return SignWithCAdES(data, s.secretKey, s.PublicKeyCertificate)
+// SignReader signs the content read from r, see SignReader
+func (s Simple) SignReader(r io.Reader, opts CAdESOpts) ([]byte, error) {
+	return SignReader(r, s.secretKey, s.PublicKeyCertificate, opts)
+}
+
+// SignDigest signs the digest of external content, see SignDigest
+func (s Simple) SignDigest(digest []byte, opts CAdESOpts) ([]byte, error) {
+	return SignDigest(digest, s.secretKey, s.PublicKeyCertificate, opts)
 }
 
 func (s Simple) Public() crypto.PublicKey {
@@ -0,0 +1,125 @@
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// ErrCertificateMismatch is returned when the signingCertificateV2 attribute
+// of a signature does not identify its signer certificate
+var ErrCertificateMismatch = errors.New("signing certificate mismatch")
+
+// contentInfo is a CMS ContentInfo
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// signedData is a CMS SignedData, the parts the checks read
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// signerInfo is a CMS SignerInfo
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+// VerifySigningCertificate checks that the signingCertificateV2 attribute of
+// the signer of a CAdES signature identifies the certificate of the
+// signature: its certHash is the digest of the certificate and its
+// issuerSerial, when present, the issuer and serial number of the
+// certificate. A mismatch is an ErrCertificateMismatch. It is the off-circuit
+// counterpart of cdl.VerifySigningCertificateV2; the signature itself is not
+// verified.
+func VerifySigningCertificate(signature []byte) (*x509.Certificate, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(signature, &ci); err != nil {
+		return nil, fmt.Errorf("parse content info: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("content type %v is not signed data", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("parse signed data: %w", err)
+	}
+	if len(sd.SignerInfos) != 1 || len(sd.Certificates.Bytes) == 0 {
+		return nil, fmt.Errorf("expected one signer and its certificate")
+	}
+	cert, err := x509.ParseCertificate(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %w", err)
+	}
+
+	// the signed attributes, encoded as the SET OF they are signed as
+	var attrs []attribute
+	signedAttrs := append([]byte{0x31}, sd.SignerInfos[0].SignedAttrs.FullBytes[1:]...)
+	if _, err := asn1.UnmarshalWithParams(signedAttrs, &attrs, "set"); err != nil {
+		return nil, fmt.Errorf("parse signed attributes: %w", err)
+	}
+	var signingCert *signingCertificateV2
+	for _, attr := range attrs {
+		if !attr.Type.Equal(oidSigningCertificateV2) {
+			continue
+		}
+		if signingCert != nil {
+			return nil, fmt.Errorf("%w: several signingCertificateV2 attributes", ErrCertificateMismatch)
+		}
+		signingCert = &signingCertificateV2{}
+		if _, err := asn1.Unmarshal(attr.Values.Bytes, signingCert); err != nil {
+			return nil, fmt.Errorf("parse signingCertificateV2: %w", err)
+		}
+	}
+	if signingCert == nil || len(signingCert.Certs) == 0 {
+		return nil, fmt.Errorf("%w: no signingCertificateV2 attribute", ErrCertificateMismatch)
+	}
+
+	// the first ESSCertIDv2 identifies the signer certificate (RFC 5035)
+	certID := signingCert.Certs[0]
+	hash := crypto.SHA256
+	if len(certID.HashAlgorithm.Algorithm) > 0 {
+		alg, ok := lookupDigestAlgorithmOID(certID.HashAlgorithm.Algorithm)
+		if !ok {
+			return nil, fmt.Errorf("unsupported certHash algorithm %v", certID.HashAlgorithm.Algorithm)
+		}
+		hash = alg.hash
+	}
+	h := hash.New()
+	h.Write(cert.Raw)
+	if !bytes.Equal(certID.CertHash, h.Sum(nil)) {
+		return nil, fmt.Errorf("%w: certHash is not the digest of the certificate", ErrCertificateMismatch)
+	}
+	if certID.IssuerSerial.SerialNumber != nil {
+		// the issuer is the Name of the certificate, or GeneralNames holding
+		// it as directoryName
+		if !bytes.Contains(certID.IssuerSerial.Issuer.FullBytes, cert.RawIssuer) || certID.IssuerSerial.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			return nil, fmt.Errorf("%w: issuerSerial is not the one of the certificate", ErrCertificateMismatch)
+		}
+	}
+	return cert, nil
+}
+
+// lookupDigestAlgorithmOID returns the digest algorithm of an OID
+func lookupDigestAlgorithmOID(oid asn1.ObjectIdentifier) (digestAlgorithm, bool) {
+	for _, alg := range digestAlgorithms {
+		if alg.oid.Equal(oid) {
+			return alg, true
+		}
+	}
+	return digestAlgorithm{}, false
+}
@@ -0,0 +1,332 @@
+// Package admission limits the concurrent proofs per circuit. A single eudi-vc
+// prove can use more than 10GB of memory, so every circuit has a concurrency
+// limit and a memory weight charged against a shared memory budget. Requests
+// that cannot run are queued (FIFO) up to a bounded queue length and wait
+// time, and rejected with ErrSaturated beyond that, so callers can apply
+// backpressure (see Middleware, 503 + Retry-After).
+//
+// Batch proofs (AcquirePriority with Batch, e.g. batch issuance) wait in a
+// queue of their own, behind the interactive requests, and may be held to a
+// part of the memory budget (Config.BatchMemoryBudget) so that they do not
+// starve the interactive requests.
+package admission
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrSaturated is returned when the request cannot be queued or waited longer
+// than Config.MaxWait
+var ErrSaturated = errors.New("prover saturated")
+
+// Priority is the scheduling class of a proof
+type Priority int
+
+const (
+	// Interactive proofs have a user waiting, they are admitted before any
+	// batch proof
+	Interactive Priority = iota
+	// Batch proofs are admitted when no interactive request is waiting and
+	// within Config.BatchMemoryBudget; they wait until the context is done,
+	// MaxQueue and MaxWait do not apply
+	Batch
+)
+
+// Limit is the admission limit of a circuit
+type Limit struct {
+	// Concurrency is the maximum number of concurrent proofs, unlimited when 0
+	Concurrency int
+	// Memory is the memory weight of one proof (bytes) charged against
+	// Config.MemoryBudget
+	Memory int64
+}
+
+// Config configures a Controller
+type Config struct {
+	// MemoryBudget is the memory available to concurrent proofs (bytes)
+	MemoryBudget int64
+	// MaxQueue is the maximum number of waiting requests, requests are
+	// rejected right away when 0
+	MaxQueue int
+	// MaxWait is the maximum wait time in the queue, unlimited when 0 (the
+	// request context still applies)
+	MaxWait time.Duration
+	// RetryAfter is the delay suggested to rejected clients
+	RetryAfter time.Duration
+	// BatchMemoryBudget is the part of MemoryBudget batch proofs may use,
+	// the rest is reserved to interactive proofs; all of it when 0
+	BatchMemoryBudget int64
+	// Limits are the per-circuit limits
+	Limits map[string]Limit
+}
+
+// CircuitStats is the occupancy of a circuit
+type CircuitStats struct {
+	Running  int   `json:"running"`
+	Queued   int   `json:"queued"`
+	Memory   int64 `json:"memory"`
+	Admitted int64 `json:"admitted"`
+	Rejected int64 `json:"rejected"`
+}
+
+// Stats is the occupancy of the controller
+type Stats struct {
+	MemoryBudget int64 `json:"memory_budget"`
+	MemoryInUse  int64 `json:"memory_in_use"`
+	Queued       int   `json:"queued"`
+	// BatchMemoryInUse and BatchQueued are the batch part of MemoryInUse and
+	// the waiting batch proofs, not counted in Queued
+	BatchMemoryInUse int64                   `json:"batch_memory_in_use"`
+	BatchQueued      int                     `json:"batch_queued"`
+	Circuits         map[string]CircuitStats `json:"circuits"`
+}
+
+// waiter is a queued request, ready is closed once admitted
+type waiter struct {
+	circuit  string
+	priority Priority
+	ready    chan struct{}
+}
+
+// Controller admits proofs within the per-circuit and memory limits
+type Controller struct {
+	cfg Config
+
+	mu               sync.Mutex
+	memoryInUse      int64
+	batchMemoryInUse int64
+	circuits         map[string]*CircuitStats
+	queue            *list.List // of *waiter, FIFO
+	batchQueue       *list.List // of *waiter, FIFO, behind queue
+}
+
+// NewController returns a controller, it fails when a circuit cannot run
+// within the memory budget
+func NewController(cfg Config) (*Controller, error) {
+	if cfg.BatchMemoryBudget < 0 || cfg.BatchMemoryBudget > cfg.MemoryBudget {
+		return nil, fmt.Errorf("batch memory budget %d not within the memory budget %d", cfg.BatchMemoryBudget, cfg.MemoryBudget)
+	}
+	if cfg.BatchMemoryBudget == 0 {
+		cfg.BatchMemoryBudget = cfg.MemoryBudget
+	}
+	c := &Controller{cfg: cfg, circuits: map[string]*CircuitStats{}, queue: list.New(), batchQueue: list.New()}
+	for name, limit := range cfg.Limits {
+		if limit.Memory > cfg.MemoryBudget {
+			return nil, fmt.Errorf("circuit %q: memory weight %d exceeds the memory budget %d", name, limit.Memory, cfg.MemoryBudget)
+		}
+		if limit.Concurrency < 0 || limit.Memory < 0 {
+			return nil, fmt.Errorf("circuit %q: invalid limit %+v", name, limit)
+		}
+		c.circuits[name] = &CircuitStats{}
+	}
+	return c, nil
+}
+
+// fits reports whether a proof of the circuit can start now
+func (c *Controller) fits(circuit string, priority Priority) bool {
+	limit := c.cfg.Limits[circuit]
+	stats := c.circuits[circuit]
+	if limit.Concurrency > 0 && stats.Running >= limit.Concurrency {
+		return false
+	}
+	if priority == Batch && c.batchMemoryInUse+limit.Memory > c.cfg.BatchMemoryBudget {
+		return false
+	}
+	return c.memoryInUse+limit.Memory <= c.cfg.MemoryBudget
+}
+
+// admit charges a proof of the circuit, the caller holds the lock
+func (c *Controller) admit(circuit string, priority Priority) {
+	stats := c.circuits[circuit]
+	stats.Running++
+	stats.Memory += c.cfg.Limits[circuit].Memory
+	stats.Admitted++
+	c.memoryInUse += c.cfg.Limits[circuit].Memory
+	if priority == Batch {
+		c.batchMemoryInUse += c.cfg.Limits[circuit].Memory
+	}
+}
+
+// Acquire waits until an interactive proof of the circuit may start and
+// returns the function releasing it. It returns ErrSaturated when the queue
+// is full or the wait exceeds MaxWait, and the context error when ctx is done
+// first.
+func (c *Controller) Acquire(ctx context.Context, circuit string) (release func(), err error) {
+	return c.AcquirePriority(ctx, circuit, Interactive)
+}
+
+// AcquirePriority is Acquire for a proof of the given priority. A batch proof
+// waits until ctx is done.
+func (c *Controller) AcquirePriority(ctx context.Context, circuit string, priority Priority) (release func(), err error) {
+	c.mu.Lock()
+	stats, ok := c.circuits[circuit]
+	if !ok {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("unknown circuit %q", circuit)
+	}
+
+	// the queues are FIFO: nobody overtakes a waiting request of the same
+	// priority, and batch proofs do not overtake interactive requests
+	queue := c.queue
+	if priority == Batch {
+		queue = c.batchQueue
+	}
+	if queue.Len() == 0 && (priority == Interactive || c.queue.Len() == 0) && c.fits(circuit, priority) {
+		c.admit(circuit, priority)
+		c.mu.Unlock()
+		return c.releaseFunc(circuit, priority), nil
+	}
+	if priority == Interactive && c.queue.Len() >= c.cfg.MaxQueue {
+		stats.Rejected++
+		c.mu.Unlock()
+		return nil, ErrSaturated
+	}
+
+	w := &waiter{circuit: circuit, priority: priority, ready: make(chan struct{})}
+	elem := queue.PushBack(w)
+	stats.Queued++
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if c.cfg.MaxWait > 0 && priority == Interactive {
+		timer := time.NewTimer(c.cfg.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-w.ready:
+		return c.releaseFunc(circuit, priority), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrSaturated
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-w.ready:
+		// admitted while giving up: hand the slot over
+		c.release(circuit, priority)
+	default:
+		queue.Remove(elem)
+		stats.Queued--
+		// the removed request may have blocked the ones behind it
+		c.dispatch()
+	}
+	if errors.Is(err, ErrSaturated) {
+		stats.Rejected++
+	}
+	return nil, err
+}
+
+func (c *Controller) releaseFunc(circuit string, priority Priority) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.release(circuit, priority)
+		})
+	}
+}
+
+// release frees a proof of the circuit, the caller holds the lock
+func (c *Controller) release(circuit string, priority Priority) {
+	stats := c.circuits[circuit]
+	stats.Running--
+	stats.Memory -= c.cfg.Limits[circuit].Memory
+	c.memoryInUse -= c.cfg.Limits[circuit].Memory
+	if priority == Batch {
+		c.batchMemoryInUse -= c.cfg.Limits[circuit].Memory
+	}
+	c.dispatch()
+}
+
+// dispatch admits the queued requests in order while the head fits, the
+// batch proofs once no interactive request waits; the caller holds the lock
+func (c *Controller) dispatch() {
+	if c.dispatchQueue(c.queue) {
+		c.dispatchQueue(c.batchQueue)
+	}
+}
+
+// dispatchQueue admits the requests of queue in order while the head fits,
+// it reports whether the queue is empty
+func (c *Controller) dispatchQueue(queue *list.List) bool {
+	for elem := queue.Front(); elem != nil; elem = queue.Front() {
+		w := elem.Value.(*waiter)
+		if !c.fits(w.circuit, w.priority) {
+			return false
+		}
+		queue.Remove(elem)
+		c.circuits[w.circuit].Queued--
+		c.admit(w.circuit, w.priority)
+		close(w.ready)
+	}
+	return true
+}
+
+// Stats returns the current occupancy
+func (c *Controller) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{
+		MemoryBudget:     c.cfg.MemoryBudget,
+		MemoryInUse:      c.memoryInUse,
+		Queued:           c.queue.Len(),
+		BatchMemoryInUse: c.batchMemoryInUse,
+		BatchQueued:      c.batchQueue.Len(),
+		Circuits:         make(map[string]CircuitStats, len(c.circuits)),
+	}
+	for name, s := range c.circuits {
+		stats.Circuits[name] = *s
+	}
+	return stats
+}
+
+// Publish exposes the occupancy as the expvar variable name (served on
+// /debug/vars)
+func (c *Controller) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return c.Stats() }))
+}
+
+// RetryAfterSeconds is the Retry-After delay (seconds, at least 1) suggested
+// to rejected clients
+func (c *Controller) RetryAfterSeconds() int {
+	retryAfter := int((c.cfg.RetryAfter + time.Second - 1) / time.Second)
+	return max(retryAfter, 1)
+}
+
+// Middleware admits the requests of next, circuit returns the circuit a
+// request proves. Saturated requests get 503 Service Unavailable with a
+// Retry-After header.
+func (c *Controller) Middleware(circuit func(r *http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := c.Acquire(r.Context(), circuit(r))
+		switch {
+		case errors.Is(err, ErrSaturated):
+			w.Header().Set("Retry-After", strconv.Itoa(c.RetryAfterSeconds()))
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
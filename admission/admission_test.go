@@ -0,0 +1,228 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const gb = 1 << 30
+
+func newTestController(t *testing.T, maxQueue int, maxWait time.Duration) *Controller {
+	t.Helper()
+	c, err := NewController(Config{
+		MemoryBudget: 16 * gb,
+		MaxQueue:     maxQueue,
+		MaxWait:      maxWait,
+		RetryAfter:   2 * time.Second,
+		Limits: map[string]Limit{
+			"eudi-vc":       {Concurrency: 2, Memory: 12 * gb},
+			"compare-bytes": {Concurrency: 4, Memory: 1 * gb},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestMemoryBudget(t *testing.T) {
+	c := newTestController(t, 0, 0)
+	ctx := context.Background()
+
+	release, err := c.Acquire(ctx, "eudi-vc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second eudi-vc proof exceeds the memory budget
+	if _, err := c.Acquire(ctx, "eudi-vc"); !errors.Is(err, ErrSaturated) {
+		t.Fatalf("expected ErrSaturated, got %v", err)
+	}
+	// small proofs still fit
+	for range 4 {
+		if _, err := c.Acquire(ctx, "compare-bytes"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// concurrency limit of compare-bytes
+	if _, err := c.Acquire(ctx, "compare-bytes"); !errors.Is(err, ErrSaturated) {
+		t.Fatalf("expected ErrSaturated, got %v", err)
+	}
+
+	stats := c.Stats()
+	if stats.MemoryInUse != 16*gb || stats.Circuits["eudi-vc"].Rejected != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	release()
+	release() // releasing twice is a no-op
+	if stats := c.Stats(); stats.MemoryInUse != 4*gb {
+		t.Fatalf("unexpected memory in use %d", stats.MemoryInUse)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	c := newTestController(t, 1, time.Minute)
+	ctx := context.Background()
+
+	release, err := c.Acquire(ctx, "eudi-vc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admitted := make(chan func())
+	go func() {
+		release, err := c.Acquire(ctx, "eudi-vc")
+		if err != nil {
+			t.Error(err)
+		}
+		admitted <- release
+	}()
+
+	// wait for the request to be queued
+	for c.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// queue full
+	if _, err := c.Acquire(ctx, "compare-bytes"); !errors.Is(err, ErrSaturated) {
+		t.Fatalf("expected ErrSaturated, got %v", err)
+	}
+
+	release()
+	(<-admitted)()
+	if stats := c.Stats(); stats.MemoryInUse != 0 || stats.Queued != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	c := newTestController(t, 1, 10*time.Millisecond)
+	ctx := context.Background()
+
+	if _, err := c.Acquire(ctx, "eudi-vc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Acquire(ctx, "eudi-vc"); !errors.Is(err, ErrSaturated) {
+		t.Fatalf("expected ErrSaturated, got %v", err)
+	}
+	if stats := c.Stats(); stats.Queued != 0 {
+		t.Fatalf("timed out request still queued: %+v", stats)
+	}
+}
+
+func TestBatchPriority(t *testing.T) {
+	c, err := NewController(Config{
+		MemoryBudget:      16 * gb,
+		BatchMemoryBudget: 12 * gb,
+		MaxQueue:          1,
+		MaxWait:           time.Minute,
+		Limits: map[string]Limit{
+			"eudi-vc":       {Concurrency: 2, Memory: 12 * gb},
+			"compare-bytes": {Concurrency: 4, Memory: 1 * gb},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	release, err := c.AcquirePriority(ctx, "eudi-vc", Batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a second batch proof exceeds the batch memory budget
+	batch := make(chan func())
+	go func() {
+		release, err := c.AcquirePriority(ctx, "eudi-vc", Batch)
+		if err != nil {
+			t.Error(err)
+		}
+		batch <- release
+	}()
+	for c.Stats().BatchQueued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// interactive proofs fit the memory reserved to them
+	releaseSmall, err := c.Acquire(ctx, "compare-bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseSmall()
+
+	// an interactive request queued after the batch proof is admitted first
+	interactive := make(chan func())
+	go func() {
+		release, err := c.Acquire(ctx, "eudi-vc")
+		if err != nil {
+			t.Error(err)
+		}
+		interactive <- release
+	}()
+	for c.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	release()
+	releaseInteractive := <-interactive
+	if stats := c.Stats(); stats.BatchQueued != 1 || stats.BatchMemoryInUse != 0 {
+		t.Fatalf("batch proof admitted before the interactive request: %+v", stats)
+	}
+
+	releaseInteractive()
+	(<-batch)()
+	if stats := c.Stats(); stats.MemoryInUse != 0 || stats.BatchQueued != 0 || stats.BatchMemoryInUse != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+// TestBatchCancel checks that a canceled batch proof leaves the queue
+func TestBatchCancel(t *testing.T) {
+	c := newTestController(t, 0, 0)
+	if _, err := c.Acquire(context.Background(), "eudi-vc"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.AcquirePriority(ctx, "eudi-vc", Batch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if stats := c.Stats(); stats.BatchQueued != 0 || stats.Circuits["eudi-vc"].Rejected != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	c := newTestController(t, 0, 0)
+	handler := c.Middleware(func(r *http.Request) string { return r.URL.Path[1:] },
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if _, err := c.Acquire(context.Background(), "eudi-vc"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/eudi-vc", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expected 503 with Retry-After 2, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/compare-bytes", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := NewController(Config{MemoryBudget: 8 * gb, Limits: map[string]Limit{"eudi-vc": {Memory: 12 * gb}}})
+	if err == nil {
+		t.Fatal("expected an error for a circuit exceeding the memory budget")
+	}
+	if _, err := NewController(Config{MemoryBudget: 8 * gb, BatchMemoryBudget: 12 * gb}); err == nil {
+		t.Fatal("expected an error for a batch memory budget exceeding the memory budget")
+	}
+}
@@ -0,0 +1,458 @@
+// Package archive is the long-term archival format of the proofs, for
+// qualified signature proofs that must remain evaluable for decades: a CBOR
+// container embedding everything needed to verify the proof again without
+// the verifier deployment that accepted it:
+//
+//	{"version": 1, "created_at": 1782864000, "circuit": "eudi-vc/eudi/v1",
+//	 "algorithms": [{"id": "groth16-bn254", "v": 1}, {"id": "sha-256", "v": 1}, ...],
+//	 "proof": h'...', "public_witness": h'...', "verifying_key": h'...', "vk_hash": h'...',
+//	 "schema": {"circuit": ..., "public_inputs": [{"name", "offset", "size"}]},
+//	 "manifest": h'{"circuits": ...}', "trust_anchors": [{"input": "CAPubKey", "certificate": h'...'}],
+//	 "presentation": h'...', "holder_key": h'...', "holder_pq_key": h'...'}
+//
+// The algorithms name the encodings and verification rules the archive was
+// written with, each with its version: a later reader evaluates the archive
+// with the rules of these versions, or refuses it. Open refuses a format
+// version it does not know (VersionError) without decoding the rest, Verify
+// refuses unknown algorithms (ErrUnsupportedAlgorithm) before evaluating
+// anything.
+//
+// The package only depends on the standalone verifier (package verifier),
+// not on gnark, so the archives stay evaluable when the circuits move on.
+package archive
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// FormatVersion is the version of the archive format written by New
+const FormatVersion = 1
+
+// supportedVersions are the format versions Open reads
+var supportedVersions = []int{1}
+
+// Algorithm identifiers of the archives, the semantics of version 1:
+const (
+	// AlgGroth16BN254: groth16 on BN254, proof, public witness and verifying
+	// key in gnark binary encoding, BSB22 commitments (verifier.Verify)
+	AlgGroth16BN254 = "groth16-bn254"
+	// AlgSHA256: the verifying key hash is the SHA-256 of the compressed key
+	// (verifier.VerifyingKey.Hash)
+	AlgSHA256 = "sha-256"
+	// AlgES256: the holder signature of the presentation, ECDSA P-256 with
+	// SHA-256
+	AlgES256 = "es256"
+	// AlgP256Limbs: a P-256 coordinate is a public input of 4 limbs of 64
+	// bits, least significant first (gnark emulated.P256Fp); the trust
+	// anchors are matched against them
+	AlgP256Limbs = "p256-limbs"
+	// AlgMLDSA65: the post-quantum part of the hybrid holder signature of the
+	// presentation (verifier.AlgES256MLDSA65), ML-DSA-65 (FIPS 204) with the
+	// context of verifier.VerifyPQSignature; the holder key is the FIPS 204
+	// encoding of the public key
+	AlgMLDSA65 = "ml-dsa-65"
+)
+
+// supportedAlgorithms are the algorithm versions Verify evaluates
+var supportedAlgorithms = map[string][]int{
+	AlgGroth16BN254: {1},
+	AlgSHA256:       {1},
+	AlgES256:        {1},
+	AlgP256Limbs:    {1},
+}
+
+func init() {
+	// ML-DSA is evaluated by the builds providing it (Go 1.27)
+	if slices.Contains(verifier.SupportedAlgs(), verifier.AlgES256MLDSA65) {
+		supportedAlgorithms[AlgMLDSA65] = []int{1}
+	}
+}
+
+// p256Limbs are the limbs of a P-256 coordinate (AlgP256Limbs v1)
+const (
+	p256Limbs       = 4
+	p256BitsPerLimb = 64
+)
+
+var (
+	// ErrUnsupportedVersion is wrapped by VersionError
+	ErrUnsupportedVersion = errors.New("unsupported archive version")
+	// ErrUnsupportedAlgorithm: the archive uses an algorithm, or an algorithm
+	// version, this package does not evaluate
+	ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+	// ErrInvalidArchive: the archive is not consistent, e.g. its verifying key
+	// does not have its hash, or its presentation is not of its proof
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrProofFailed: the proof does not verify
+	ErrProofFailed = verifier.ErrProofFailed
+)
+
+// VersionError is the error of an archive of an unknown format version
+type VersionError struct {
+	Version   int
+	Supported []int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%v %d, supported %v", ErrUnsupportedVersion, e.Version, e.Supported)
+}
+
+func (e *VersionError) Unwrap() error {
+	return ErrUnsupportedVersion
+}
+
+// Algorithm is an algorithm identifier with the version of its semantics
+type Algorithm struct {
+	ID      string `cbor:"id"`
+	Version int    `cbor:"v"`
+}
+
+func (a Algorithm) String() string {
+	return fmt.Sprintf("%s/v%d", a.ID, a.Version)
+}
+
+// Schema names the public inputs of the circuit, as the circuit description
+// of zkpi profile --describe
+type Schema struct {
+	Circuit      string        `cbor:"circuit" json:"circuit"`
+	PublicInputs []PublicInput `cbor:"public_inputs" json:"public_inputs"`
+}
+
+// PublicInput is a field of the public witness: the leaves of an array field
+// are one input of Size elements from Offset
+type PublicInput struct {
+	Name   string `cbor:"name" json:"name"`
+	Offset int    `cbor:"offset" json:"offset"`
+	Size   int    `cbor:"size" json:"size"`
+}
+
+// input returns the public input named name
+func (s *Schema) input(name string) (PublicInput, bool) {
+	for _, in := range s.PublicInputs {
+		if in.Name == name {
+			return in, true
+		}
+	}
+	return PublicInput{}, false
+}
+
+// TrustAnchor is a trust anchor the proof was accepted with: the key of the
+// public inputs <Input>X and <Input>Y (e.g. CAPubKey), as a certificate or a
+// public key
+type TrustAnchor struct {
+	Input       string `cbor:"input"`
+	Certificate []byte `cbor:"certificate,omitempty"` // DER
+	PublicKey   []byte `cbor:"public_key,omitempty"`  // SubjectPublicKeyInfo DER, without certificate
+}
+
+// key returns the P-256 key of the anchor
+func (a TrustAnchor) key() (*ecdsa.PublicKey, error) {
+	var key any
+	switch {
+	case a.Certificate != nil:
+		cert, err := x509.ParseCertificate(a.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	case a.PublicKey != nil:
+		var err error
+		if key, err = x509.ParsePKIXPublicKey(a.PublicKey); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("no certificate or public key")
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("not a P-256 key")
+	}
+	return ecKey, nil
+}
+
+// Archive is an archived proof
+type Archive struct {
+	Version   int    `cbor:"version"`
+	CreatedAt int64  `cbor:"created_at"` // unix seconds
+	Circuit   string `cbor:"circuit"`
+	// Algorithms are the algorithms of the archive with the version of their
+	// semantics
+	Algorithms    []Algorithm `cbor:"algorithms"`
+	Proof         []byte      `cbor:"proof"`
+	PublicWitness []byte      `cbor:"public_witness"`
+	VerifyingKey  []byte      `cbor:"verifying_key"`
+	VKHash        []byte      `cbor:"vk_hash"`
+	// Schema names the public inputs, optional: required to check the trust
+	// anchors
+	Schema *Schema `cbor:"schema,omitempty"`
+	// Manifest is the manifest pinning the verifying key, as the verifier
+	// used it ({"circuits": {"<circuit>": {"vk_hash": "<hex>"}}}), optional
+	Manifest []byte `cbor:"manifest,omitempty"`
+	// TrustAnchors are the trust anchors the proof was accepted with
+	TrustAnchors []TrustAnchor `cbor:"trust_anchors,omitempty"`
+	// Presentation is the presentation of the proof (compact serialization or
+	// COSE), with the key of its holder signature (SubjectPublicKeyInfo
+	// DER) and, for a hybrid signature, the ML-DSA-65 key of the holder,
+	// optional
+	Presentation []byte `cbor:"presentation,omitempty"`
+	HolderKey    []byte `cbor:"holder_key,omitempty"`
+	HolderPQKey  []byte `cbor:"holder_pq_key,omitempty"`
+}
+
+// New returns the archive of a proof of the circuit, with the algorithms of
+// the proof and of the verifying key hash; the optional members are set by
+// the caller, AddAlgorithm records the algorithms they use
+func New(circuit string, proof, publicWitness, vk []byte, createdAt time.Time) (*Archive, error) {
+	key, err := verifier.ReadVerifyingKey(vk)
+	if err != nil {
+		return nil, err
+	}
+	vkHash, err := key.Hash()
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{
+		Version:       FormatVersion,
+		CreatedAt:     createdAt.Unix(),
+		Circuit:       circuit,
+		Algorithms:    []Algorithm{{AlgGroth16BN254, 1}, {AlgSHA256, 1}},
+		Proof:         proof,
+		PublicWitness: publicWitness,
+		VerifyingKey:  vk,
+		VKHash:        vkHash[:],
+	}, nil
+}
+
+// AddAlgorithm records an algorithm, once
+func (a *Archive) AddAlgorithm(alg Algorithm) {
+	if !slices.Contains(a.Algorithms, alg) {
+		a.Algorithms = append(a.Algorithms, alg)
+	}
+}
+
+// MarshalBinary encodes the archive in CBOR, core deterministic encoding
+func (a *Archive) MarshalBinary() ([]byte, error) {
+	em, err := cbor.CoreDetEncOptions().EncMode()
+	if err != nil {
+		return nil, err
+	}
+	// encoded as a plain struct, not through MarshalBinary again
+	type archive Archive
+	return em.Marshal((*archive)(a))
+}
+
+// Open decodes an archive. An archive of another format version is refused
+// with a VersionError before the rest is decoded, its layout may differ.
+func Open(data []byte) (*Archive, error) {
+	var header struct {
+		Version int `cbor:"version"`
+	}
+	if err := cbor.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	if !slices.Contains(supportedVersions, header.Version) {
+		return nil, &VersionError{Version: header.Version, Supported: supportedVersions}
+	}
+	a := &Archive{}
+	if err := cbor.Unmarshal(data, a); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	return a, nil
+}
+
+// Result is the evaluation of an archive
+type Result struct {
+	Circuit      string
+	VKHash       string // hex
+	CreatedAt    time.Time
+	PublicInputs []verifier.PublicInput
+	// Anchors are the inputs of the trust anchors checked against the public
+	// inputs
+	Anchors []string
+	// Presentation is the archived presentation, its holder signature
+	// verified when the archive has the holder key
+	Presentation *verifier.Presentation
+	// SignatureVerified is set when the holder signature was verified
+	SignatureVerified bool
+	// PQSignatureVerified is set when the post-quantum part of a hybrid
+	// holder signature was verified
+	PQSignatureVerified bool
+}
+
+// Verify evaluates the archive: its algorithms must be supported, its
+// verifying key must have its hash and be the one pinned by its manifest, the
+// proof must verify against the public witness, the trust anchors must be the
+// keys of their public inputs, and the presentation must carry the archived
+// proof, with a valid holder signature when the holder keys are archived.
+func Verify(a *Archive) (*Result, error) {
+	for _, alg := range a.Algorithms {
+		if !slices.Contains(supportedAlgorithms[alg.ID], alg.Version) {
+			return nil, fmt.Errorf("%w %s", ErrUnsupportedAlgorithm, alg)
+		}
+	}
+	for _, required := range []string{AlgGroth16BN254, AlgSHA256} {
+		if !slices.ContainsFunc(a.Algorithms, func(alg Algorithm) bool { return alg.ID == required }) {
+			return nil, fmt.Errorf("%w: no %s algorithm", ErrInvalidArchive, required)
+		}
+	}
+
+	vk, err := verifier.ReadVerifyingKey(a.VerifyingKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	vkHash, err := vk.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(vkHash[:], a.VKHash) {
+		return nil, fmt.Errorf("%w: verifying key hash %x, archived %x", ErrInvalidArchive, vkHash, a.VKHash)
+	}
+	res := &Result{Circuit: a.Circuit, VKHash: hex.EncodeToString(vkHash[:]), CreatedAt: time.Unix(a.CreatedAt, 0).UTC()}
+
+	if a.Manifest != nil {
+		var manifest struct {
+			Circuits map[string]struct {
+				VKHash string `json:"vk_hash"`
+			} `json:"circuits"`
+		}
+		if err := json.Unmarshal(a.Manifest, &manifest); err != nil {
+			return nil, fmt.Errorf("%w: manifest: %w", ErrInvalidArchive, err)
+		}
+		pinned, ok := manifest.Circuits[a.Circuit]
+		if !ok || !strings.EqualFold(pinned.VKHash, res.VKHash) {
+			return nil, fmt.Errorf("%w: the manifest does not pin verifying key %s for %q", ErrInvalidArchive, res.VKHash, a.Circuit)
+		}
+	}
+
+	proof, err := verifier.ReadProof(a.Proof)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProofFailed, err)
+	}
+	if res.PublicInputs, err = verifier.ReadPublicWitness(a.PublicWitness); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	if err := verifier.Verify(vk, proof, res.PublicInputs); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProofFailed, err)
+	}
+
+	for i, anchor := range a.TrustAnchors {
+		if err := a.checkAnchor(anchor, res.PublicInputs); err != nil {
+			return nil, fmt.Errorf("%w: trust_anchors[%d] %s: %w", ErrInvalidArchive, i, anchor.Input, err)
+		}
+		res.Anchors = append(res.Anchors, anchor.Input)
+	}
+
+	if a.Presentation != nil {
+		if err := a.checkPresentation(res); err != nil {
+			return nil, fmt.Errorf("%w: presentation: %w", ErrInvalidArchive, err)
+		}
+	}
+	return res, nil
+}
+
+// checkAnchor checks that the coordinates of the anchor key are the public
+// inputs <Input>X_Limbs and <Input>Y_Limbs
+func (a *Archive) checkAnchor(anchor TrustAnchor, inputs []verifier.PublicInput) error {
+	if !slices.Contains(a.Algorithms, Algorithm{AlgP256Limbs, 1}) {
+		return fmt.Errorf("no %s algorithm", AlgP256Limbs)
+	}
+	if a.Schema == nil {
+		return fmt.Errorf("no schema")
+	}
+	key, err := anchor.key()
+	if err != nil {
+		return err
+	}
+	for _, c := range []struct {
+		name  string
+		value *big.Int
+	}{{anchor.Input + "X_Limbs", key.X}, {anchor.Input + "Y_Limbs", key.Y}} {
+		in, ok := a.Schema.input(c.name)
+		if !ok || in.Size != p256Limbs || in.Offset+in.Size > len(inputs) {
+			return fmt.Errorf("no public input %s of %d limbs", c.name, p256Limbs)
+		}
+		if limbsValue(inputs[in.Offset:in.Offset+in.Size]).Cmp(c.value) != 0 {
+			return fmt.Errorf("public input %s is not the key of the anchor", c.name)
+		}
+	}
+	return nil
+}
+
+// limbsValue returns the value of the limbs of a coordinate, least
+// significant first
+func limbsValue(limbs []fr.Element) *big.Int {
+	v := new(big.Int)
+	for i := len(limbs) - 1; i >= 0; i-- {
+		v.Lsh(v, p256BitsPerLimb)
+		v.Add(v, limbs[i].BigInt(new(big.Int)))
+	}
+	return v
+}
+
+// checkPresentation checks that the presentation carries the archived proof,
+// and its holder signature when the holder keys are archived
+func (a *Archive) checkPresentation(res *Result) error {
+	var (
+		p   *verifier.Presentation
+		err error
+	)
+	if len(a.Presentation) > 0 && a.Presentation[0]&0xe0 == 0xc0 {
+		// a CBOR tag, COSE_Sign1
+		p, err = verifier.ParsePresentationCOSE(a.Presentation)
+	} else {
+		p, err = verifier.ParsePresentation(string(a.Presentation))
+	}
+	if err != nil {
+		return err
+	}
+	if p.Header.Circuit != a.Circuit || !strings.EqualFold(p.Header.VKHash, res.VKHash) {
+		return fmt.Errorf("of circuit %q with verifying key %s", p.Header.Circuit, p.Header.VKHash)
+	}
+	if !bytes.Equal(p.Proof, a.Proof) || !bytes.Equal(p.Payload.PublicWitness, a.PublicWitness) {
+		return fmt.Errorf("not of the archived proof")
+	}
+	res.Presentation = p
+
+	if a.HolderKey != nil {
+		if !slices.Contains(a.Algorithms, Algorithm{AlgES256, 1}) {
+			return fmt.Errorf("no %s algorithm", AlgES256)
+		}
+		key, err := x509.ParsePKIXPublicKey(a.HolderKey)
+		if err != nil {
+			return fmt.Errorf("holder key: %w", err)
+		}
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("holder key is not an ECDSA key")
+		}
+		if err := p.VerifySignature(ecKey); err != nil {
+			return err
+		}
+		res.SignatureVerified = true
+	}
+	if a.HolderPQKey != nil {
+		if !slices.Contains(a.Algorithms, Algorithm{AlgMLDSA65, 1}) {
+			return fmt.Errorf("no %s algorithm", AlgMLDSA65)
+		}
+		if err := p.VerifyPQSignature(a.HolderPQKey); err != nil {
+			return err
+		}
+		res.PQSignatureVerified = true
+	}
+	return nil
+}
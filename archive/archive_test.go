@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// anchoredCircuit proves knowledge of X with X^3 = Y, for a public CA key
+type anchoredCircuit struct {
+	X         frontend.Variable
+	Y         frontend.Variable                 `gnark:",public"`
+	CAPubKeyX emulated.Element[emulated.P256Fp] `gnark:",public"`
+	CAPubKeyY emulated.Element[emulated.P256Fp] `gnark:",public"`
+}
+
+func (c *anchoredCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+func TestArchive(t *testing.T) {
+	ca, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	holder, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &anchoredCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := frontend.NewWitness(&anchoredCircuit{
+		X:         3,
+		Y:         27,
+		CAPubKeyX: emulated.ValueOf[emulated.P256Fp](ca.X),
+		CAPubKeyY: emulated.ValueOf[emulated.P256Fp](ca.Y),
+	}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, _ := w.Public()
+	witnessBytes, _ := publicWitness.MarshalBinary()
+	var proofBuf, vkBuf bytes.Buffer
+	proof.WriteTo(&proofBuf)
+	vk.WriteTo(&vkBuf)
+
+	a, err := New("anchored/v1", proofBuf.Bytes(), witnessBytes, vkBuf.Bytes(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkHash := a.VKHash
+	presentation, err := verifier.SignPresentation(verifier.PresentationHeader{Circuit: "anchored/v1", VKHash: hex.EncodeToString(vkHash)},
+		verifier.PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: witnessBytes}, a.Proof, holder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Presentation = []byte(presentation)
+	a.HolderKey, _ = x509.MarshalPKIXPublicKey(&holder.PublicKey)
+	a.Manifest, _ = json.Marshal(map[string]any{"circuits": map[string]any{"anchored/v1": map[string]string{"vk_hash": hex.EncodeToString(vkHash)}}})
+	caKey, _ := x509.MarshalPKIXPublicKey(&ca.PublicKey)
+	a.TrustAnchors = []TrustAnchor{{Input: "CAPubKey", PublicKey: caKey}}
+	a.Schema = &Schema{Circuit: "anchored/v1", PublicInputs: []PublicInput{
+		{Name: "Y", Offset: 0, Size: 1},
+		{Name: "CAPubKeyX_Limbs", Offset: 1, Size: 4},
+		{Name: "CAPubKeyY_Limbs", Offset: 5, Size: 4},
+	}}
+	a.AddAlgorithm(Algorithm{AlgES256, 1})
+	a.AddAlgorithm(Algorithm{AlgP256Limbs, 1})
+
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := Open(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Verify(opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Circuit != "anchored/v1" || !res.SignatureVerified || len(res.Anchors) != 1 || len(res.PublicInputs) != 9 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	// an archive of a later format
+	var raw map[string]any
+	cbor.Unmarshal(data, &raw)
+	raw["version"] = 2
+	raw["proof"] = "a member of another layout"
+	later, _ := cbor.Marshal(raw)
+	var verr *VersionError
+	if _, err := Open(later); !errors.As(err, &verr) || verr.Version != 2 || !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+
+	tampered := map[string]struct {
+		modify func(a *Archive)
+		class  error
+	}{
+		"algorithm version": {func(a *Archive) { a.Algorithms[0].Version = 2 }, ErrUnsupportedAlgorithm},
+		"unknown algorithm": {func(a *Archive) { a.AddAlgorithm(Algorithm{"slh-dsa-sha2-128s", 1}) }, ErrUnsupportedAlgorithm},
+		"vk hash":           {func(a *Archive) { a.VKHash = make([]byte, 32) }, ErrInvalidArchive},
+		"manifest":          {func(a *Archive) { a.Manifest = []byte(`{"circuits": {}}`) }, ErrInvalidArchive},
+		"public witness": {func(a *Archive) {
+			a.Presentation = nil
+			a.PublicWitness = bytes.Clone(a.PublicWitness)
+			// the last byte of Y, after the 12 bytes of the witness header
+			a.PublicWitness[12+31]++
+		}, ErrProofFailed},
+		"trust anchor": {func(a *Archive) {
+			other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			a.TrustAnchors[0].PublicKey, _ = x509.MarshalPKIXPublicKey(&other.PublicKey)
+		}, ErrInvalidArchive},
+		"holder key": {func(a *Archive) {
+			other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			a.HolderKey, _ = x509.MarshalPKIXPublicKey(&other.PublicKey)
+		}, ErrInvalidArchive},
+	}
+	for name, c := range tampered {
+		a, err := Open(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.modify(a)
+		if _, err := Verify(a); !errors.Is(err, c.class) {
+			t.Errorf("%s: expected %v, got %v", name, c.class, err)
+		}
+	}
+}
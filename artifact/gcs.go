@@ -0,0 +1,164 @@
+package artifact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultGCSEndpoint is the Google Cloud Storage JSON API endpoint
+const DefaultGCSEndpoint = "https://storage.googleapis.com"
+
+// GCSStore stores artifacts in a Google Cloud Storage bucket through the JSON
+// API. Token returns the OAuth2 access token of the requests (e.g. from
+// golang.org/x/oauth2/google), anonymous requests are sent when nil.
+type GCSStore struct {
+	Endpoint   string
+	Bucket     string
+	Prefix     string // optional object name prefix within the bucket
+	Token      func(ctx context.Context) (string, error)
+	HTTPClient *http.Client
+}
+
+// NewGCSStore returns a store for the bucket
+func NewGCSStore(bucket string, token func(ctx context.Context) (string, error)) *GCSStore {
+	return &GCSStore{Endpoint: DefaultGCSEndpoint, Bucket: bucket, Token: token}
+}
+
+func (s *GCSStore) objectName(key string) string {
+	if s.Prefix == "" {
+		return key
+	}
+	return strings.TrimSuffix(s.Prefix, "/") + "/" + key
+}
+
+func (s *GCSStore) do(ctx context.Context, method, rawURL, key string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.Token != nil {
+		token, err := s.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the GCS access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return doRequest(s.HTTPClient, req, key)
+}
+
+func (s *GCSStore) endpoint() string {
+	if s.Endpoint == "" {
+		return DefaultGCSEndpoint
+	}
+	return strings.TrimSuffix(s.Endpoint, "/")
+}
+
+func (s *GCSStore) objectURL(key string) string {
+	return s.endpoint() + "/storage/v1/b/" + url.PathEscape(s.Bucket) + "/o/" + url.PathEscape(s.objectName(key))
+}
+
+// gcsObject is the object resource of the JSON API
+type gcsObject struct {
+	Name    string    `json:"name"`
+	Size    string    `json:"size"` // int64 encoded as a string
+	Updated time.Time `json:"updated"`
+}
+
+func (o gcsObject) info(key string) Info {
+	size, _ := strconv.ParseInt(o.Size, 10, 64)
+	return Info{Key: key, Size: size, ModTime: o.Updated}
+}
+
+// Get implements Store
+func (s *GCSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	res, err := s.do(ctx, http.MethodGet, s.objectURL(key)+"?alt=media", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Put implements Store (simple media upload)
+func (s *GCSStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	uploadURL := s.endpoint() + "/upload/storage/v1/b/" + url.PathEscape(s.Bucket) + "/o?" +
+		url.Values{"uploadType": {"media"}, "name": {s.objectName(key)}}.Encode()
+
+	res, err := s.do(ctx, http.MethodPost, uploadURL, key, r)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Stat implements Store
+func (s *GCSStore) Stat(ctx context.Context, key string) (Info, error) {
+	if err := validateKey(key); err != nil {
+		return Info{}, err
+	}
+	res, err := s.do(ctx, http.MethodGet, s.objectURL(key), key, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	defer res.Body.Close()
+
+	var obj gcsObject
+	if err := json.NewDecoder(res.Body).Decode(&obj); err != nil {
+		return Info{}, fmt.Errorf("invalid GCS object metadata: %w", err)
+	}
+	return obj.info(key), nil
+}
+
+// List implements Store
+func (s *GCSStore) List(ctx context.Context, prefix string) ([]Info, error) {
+	var infos []Info
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {s.objectName(prefix)}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		listURL := s.endpoint() + "/storage/v1/b/" + url.PathEscape(s.Bucket) + "/o?" + query.Encode()
+
+		res, err := s.do(ctx, http.MethodGet, listURL, prefix, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Items         []gcsObject `json:"items"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid GCS list response: %w", err)
+		}
+
+		for _, obj := range result.Items {
+			key := obj.Name
+			if s.Prefix != "" {
+				key = strings.TrimPrefix(key, strings.TrimSuffix(s.Prefix, "/")+"/")
+			}
+			infos = append(infos, obj.info(key))
+		}
+
+		if result.NextPageToken == "" {
+			return infos, nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
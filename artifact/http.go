@@ -0,0 +1,122 @@
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTPStore reads artifacts from a web server or CDN: BaseURL + "/" + key
+type HTTPStore struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewHTTPStore returns a read-only store serving the artifacts under baseURL
+func NewHTTPStore(baseURL string) *HTTPStore {
+	return &HTTPStore{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (s *HTTPStore) do(ctx context.Context, method, key string) (*http.Response, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.BaseURL+"/"+key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doRequest(s.HTTPClient, req, key)
+}
+
+// Get implements Store
+func (s *HTTPStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, key)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// GetFrom returns the artifact from offset, for resuming an interrupted
+// download, and the offset the body starts at: 0 when the server ignores the
+// range and sends the whole artifact
+func (s *HTTPStore) GetFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, int64, error) {
+	if offset <= 0 {
+		rc, err := s.Get(ctx, key)
+		return rc, 0, err
+	}
+	if err := validateKey(key); err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"/"+key, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	res, err := doRequest(s.HTTPClient, req, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		return res.Body, 0, nil
+	}
+	var start int64
+	if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+		res.Body.Close()
+		return nil, 0, fmt.Errorf("GET %s: unexpected Content-Range %q for offset %d", key, res.Header.Get("Content-Range"), offset)
+	}
+	return res.Body, offset, nil
+}
+
+// Put implements Store, the HTTP store is read-only
+func (s *HTTPStore) Put(ctx context.Context, key string, r io.Reader) error {
+	return ErrReadOnly
+}
+
+// Stat implements Store
+func (s *HTTPStore) Stat(ctx context.Context, key string) (Info, error) {
+	res, err := s.do(ctx, http.MethodHead, key)
+	if err != nil {
+		return Info{}, err
+	}
+	res.Body.Close()
+	return infoFromHeader(key, res.Header, res.ContentLength), nil
+}
+
+// List implements Store, listing is not available over plain HTTP
+func (s *HTTPStore) List(ctx context.Context, prefix string) ([]Info, error) {
+	return nil, ErrNotSupported
+}
+
+// doRequest sends the request and maps the error statuses, the caller closes
+// the body of a successful response
+func doRequest(client *http.Client, req *http.Request, key string) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return nil, fmt.Errorf("%s %s: %s: %s", req.Method, key, res.Status, strings.TrimSpace(string(body)))
+}
+
+func infoFromHeader(key string, h http.Header, size int64) Info {
+	info := Info{Key: key, Size: size}
+	if t, err := http.ParseTime(h.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info
+}
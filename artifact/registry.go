@@ -0,0 +1,100 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// VKRegistryPrefix is the key prefix of the verifying keys of a VKRegistry
+const VKRegistryPrefix = "vks/"
+
+var (
+	// ErrInvalidVK is returned for a malformed hash or verifying key
+	ErrInvalidVK = errors.New("invalid verifying key")
+	// ErrHashMismatch is returned when a stored verifying key does not hash
+	// to its key
+	ErrHashMismatch = errors.New("verifying key does not match its hash")
+)
+
+// VKRegistry is a content-addressed registry of groth16 verifying keys in a
+// store: a key is stored under the hex SHA-256 of its compressed encoding
+// (verifier.VerifyingKey.Hash, the vk_hash of the presentations), so a hash
+// always names the same key. Keys are never overwritten.
+type VKRegistry struct {
+	Store Store
+}
+
+// NewVKRegistry returns a registry of the verifying keys of store, under
+// VKRegistryPrefix
+func NewVKRegistry(store Store) *VKRegistry {
+	return &VKRegistry{Store: store}
+}
+
+// VKKey returns the artifact key of the verifying key with the hex hash
+func VKKey(hash string) string {
+	return VKRegistryPrefix + hash + ".key"
+}
+
+// validateHash rejects anything but a lowercase hex SHA-256
+func validateHash(hash string) error {
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size || hex.EncodeToString(decoded) != hash {
+		return fmt.Errorf("%w: hash %q", ErrInvalidVK, hash)
+	}
+	return nil
+}
+
+// Get returns the compressed encoding of the verifying key with the hex hash,
+// checked against the hash
+func (r *VKRegistry) Get(ctx context.Context, hash string) ([]byte, error) {
+	if err := validateHash(hash); err != nil {
+		return nil, err
+	}
+	rc, err := r.Store.Get(ctx, VKKey(hash))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if digest := sha256.Sum256(data); hex.EncodeToString(digest[:]) != hash {
+		return nil, fmt.Errorf("%s: %w", hash, ErrHashMismatch)
+	}
+	return data, nil
+}
+
+// Put registers a verifying key in gnark binary encoding (compressed or raw)
+// and returns its hex hash. The key is stored in compressed encoding; created
+// is false when the registry already holds it, which is then left untouched.
+func (r *VKRegistry) Put(ctx context.Context, data []byte) (hash string, created bool, err error) {
+	vk, err := verifier.ReadVerifyingKey(data)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: %w", ErrInvalidVK, err)
+	}
+	compressed, err := vk.MarshalBinary()
+	if err != nil {
+		return "", false, err
+	}
+	digest := sha256.Sum256(compressed)
+	hash = hex.EncodeToString(digest[:])
+
+	_, err = r.Store.Stat(ctx, VKKey(hash))
+	switch {
+	case err == nil:
+		return hash, false, nil
+	case !errors.Is(err, ErrNotFound):
+		return "", false, err
+	}
+	if err := r.Store.Put(ctx, VKKey(hash), bytes.NewReader(compressed)); err != nil {
+		return "", false, err
+	}
+	return hash, true, nil
+}
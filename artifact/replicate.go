@@ -0,0 +1,211 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ManifestKey is the default key of the cluster manifest in a store
+const ManifestKey = "manifest.json"
+
+// ErrDigestMismatch is returned when an artifact does not match the digest
+// of the cluster manifest
+var ErrDigestMismatch = errors.New("artifact does not match the manifest")
+
+// Manifest is the cluster manifest: the artifacts every replica serves, with
+// their SHA-256 digests. The leader publishes it next to the artifacts,
+// replicas copy the artifacts it lists (Replicate) and serve only once their
+// store matches it (Manifest.Check).
+type Manifest struct {
+	// Version identifies the manifest, the digest of the listed artifacts
+	// when built by BuildManifest
+	Version string `json:"version"`
+	// HintSet is the solver hint set of the build that compiled the
+	// artifacts (common.HintSetVersion), set by common.BuildManifest; the
+	// provers of another hint set refuse the manifest
+	HintSet   string             `json:"hint_set,omitempty"`
+	Artifacts []ManifestArtifact `json:"artifacts"`
+}
+
+// ManifestArtifact is an artifact of a Manifest
+type ManifestArtifact struct {
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"` // hex
+	// Encoding is the serialization of a proving key (common.KeyEncoding,
+	// "compressed" or "raw"), recorded by the writer so that a loader does
+	// not guess it
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// NewManifest returns the manifest of the artifacts, sorted by key, its
+// Version the digest of the listed artifacts
+func NewManifest(artifacts []ManifestArtifact) *Manifest {
+	m := &Manifest{Artifacts: slices.Clone(artifacts)}
+	slices.SortFunc(m.Artifacts, func(a, b ManifestArtifact) int { return strings.Compare(a.Key, b.Key) })
+
+	h := sha256.New()
+	for _, a := range m.Artifacts {
+		fmt.Fprintf(h, "%s %s\n", a.SHA256, a.Key)
+	}
+	m.Version = "sha256:" + hex.EncodeToString(h.Sum(nil)[:6])
+	return m
+}
+
+// BuildManifest lists the artifacts of the store under prefix, skipping the
+// manifest itself, and digests them
+func BuildManifest(ctx context.Context, store Store, prefix string) (*Manifest, error) {
+	infos, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []ManifestArtifact
+	for _, info := range infos {
+		if info.Key == ManifestKey {
+			continue
+		}
+		digest, size, err := digestArtifact(ctx, store, info.Key)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, ManifestArtifact{Key: info.Key, Size: size, SHA256: digest})
+	}
+	return NewManifest(artifacts), nil
+}
+
+// PutManifest writes the manifest to the store under key
+func PutManifest(ctx context.Context, store Store, key string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, bytes.NewReader(data))
+}
+
+// GetManifest reads the manifest stored under key
+func GetManifest(ctx context.Context, store Store, key string) (*Manifest, error) {
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", key, err)
+	}
+	m, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", key, err)
+	}
+	return m, nil
+}
+
+// ParseManifest parses a manifest and validates its keys and digests
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	for _, a := range m.Artifacts {
+		if err := validateKey(a.Key); err != nil {
+			return nil, err
+		}
+		if decoded, err := hex.DecodeString(a.SHA256); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("%s: invalid digest %q", a.Key, a.SHA256)
+		}
+	}
+	return &m, nil
+}
+
+// Has reports whether the manifest lists the artifact key
+func (m *Manifest) Has(key string) bool {
+	return slices.ContainsFunc(m.Artifacts, func(a ManifestArtifact) bool { return a.Key == key })
+}
+
+// Check verifies that the store holds every artifact of the manifest with its
+// digest, the first mismatch is returned wrapping ErrDigestMismatch or
+// ErrNotFound
+func (m *Manifest) Check(ctx context.Context, store Store) error {
+	for _, a := range m.Artifacts {
+		digest, _, err := digestArtifact(ctx, store, a.Key)
+		if err != nil {
+			return err
+		}
+		if digest != a.SHA256 {
+			return fmt.Errorf("%s: %w", a.Key, ErrDigestMismatch)
+		}
+	}
+	return nil
+}
+
+// Replicate copies the artifacts of the manifest stored under manifestKey in
+// src (a leader or an object store) to dst, and the manifest last. Artifacts
+// dst already holds with the expected digest are not fetched again; fetched
+// artifacts are checked against their digest before they are stored, so dst
+// never holds an artifact of another manifest under its key.
+func Replicate(ctx context.Context, src, dst Store, manifestKey string) (*Manifest, error) {
+	m, err := GetManifest(ctx, src, manifestKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range m.Artifacts {
+		digest, _, err := digestArtifact(ctx, dst, a.Key)
+		switch {
+		case err == nil && digest == a.SHA256:
+			continue
+		case err != nil && !errors.Is(err, ErrNotFound):
+			return nil, err
+		}
+		if err := copyArtifact(ctx, src, dst, a); err != nil {
+			return nil, err
+		}
+	}
+	if err := PutManifest(ctx, dst, manifestKey, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// copyArtifact fetches the artifact from src and stores it in dst when it
+// matches its digest. The artifact is buffered: proving keys are large, but
+// a store must not see a mismatching artifact.
+func copyArtifact(ctx context.Context, src, dst Store, a ManifestArtifact) error {
+	rc, err := src.Get(ctx, a.Key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(&buf, h), rc); err != nil {
+		return fmt.Errorf("%s: %w", a.Key, err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != a.SHA256 {
+		return fmt.Errorf("%s: %w", a.Key, ErrDigestMismatch)
+	}
+	return dst.Put(ctx, a.Key, &buf)
+}
+
+// digestArtifact returns the hex SHA-256 and the size of a stored artifact
+func digestArtifact(ctx context.Context, store Store, key string) (string, int64, error) {
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, rc)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,157 @@
+// Package artifact stores compiled circuit artifacts (constraint system,
+// proving and verifying keys) on a local filesystem, S3/MinIO, GCS or a
+// read-only HTTP server (e.g. a CDN serving verifying keys). Replicas copy
+// the artifacts of a cluster manifest from a leader store with Replicate.
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the artifact does not exist
+	ErrNotFound = errors.New("artifact not found")
+	// ErrReadOnly is returned by Put on read-only stores
+	ErrReadOnly = errors.New("read-only artifact store")
+	// ErrNotSupported is returned when the store does not implement the operation
+	ErrNotSupported = errors.New("operation not supported by the artifact store")
+)
+
+// Info describes a stored artifact
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Store is an artifact storage. Keys are slash separated relative paths,
+// e.g. "eudi-vc/pop-v1/proving.key".
+type Store interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Put(ctx context.Context, key string, r io.Reader) error
+	Stat(ctx context.Context, key string) (Info, error)
+	List(ctx context.Context, prefix string) ([]Info, error)
+}
+
+// validateKey rejects keys escaping the store root
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid artifact key %q", key)
+	}
+	return nil
+}
+
+// FSStore stores artifacts in a local directory
+type FSStore struct {
+	Root string
+}
+
+// NewFSStore returns a store rooted at dir
+func NewFSStore(dir string) *FSStore {
+	return &FSStore{Root: dir}
+}
+
+func (s *FSStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+// Get implements Store
+func (s *FSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return f, err
+}
+
+// Put implements Store. The artifact is written to a temporary file and
+// renamed, so readers never see a partial artifact.
+func (s *FSStore) Put(ctx context.Context, key string, r io.Reader) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".artifact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Stat implements Store
+func (s *FSStore) Stat(ctx context.Context, key string) (Info, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Info{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Key: key, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// List implements Store
+func (s *FSStore) List(ctx context.Context, prefix string) ([]Info, error) {
+	var infos []Info
+	err := filepath.WalkDir(s.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".artifact-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.Root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, Info{Key: key, Size: fi.Size(), ModTime: fi.ModTime()})
+		return nil
+	})
+	return infos, err
+}
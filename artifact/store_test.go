@@ -0,0 +1,361 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStore runs the round trip shared by every writable store
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	artifacts := map[string]string{
+		"pop/circuit.ccs":      "constraint system",
+		"pop/proving.key":      "proving key",
+		"compare/proving.key":  "other proving key",
+		"pop/verification.key": "verifying key",
+	}
+	for key, data := range artifacts {
+		if err := store.Put(ctx, key, strings.NewReader(data)); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	r, err := store.Get(ctx, "pop/proving.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "proving key" {
+		t.Fatalf("unexpected artifact %q (%v)", data, err)
+	}
+
+	info, err := store.Stat(ctx, "pop/verification.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len("verifying key")) {
+		t.Fatalf("unexpected size %d", info.Size)
+	}
+
+	infos, err := store.List(ctx, "pop/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("expected 3 artifacts, got %v", infos)
+	}
+
+	if _, err := store.Get(ctx, "pop/missing.key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.Stat(ctx, "pop/missing.key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestFSStore(t *testing.T) {
+	testStore(t, NewFSStore(t.TempDir()))
+}
+
+func TestInvalidKeys(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	for _, key := range []string{"", "/etc/passwd", "../proving.key", "pop/../../proving.key", "pop//proving.key"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("")); err == nil {
+			t.Errorf("expected an error for key %q", key)
+		}
+	}
+}
+
+func TestHTTPStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/keys/pop/verification.key" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("verifying key"))
+	}))
+	defer server.Close()
+
+	store := NewHTTPStore(server.URL + "/keys/")
+	ctx := context.Background()
+
+	r, err := store.Get(ctx, "pop/verification.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "verifying key" {
+		t.Fatalf("unexpected artifact %q", data)
+	}
+
+	if info, err := store.Stat(ctx, "pop/verification.key"); err != nil || info.Size != 13 {
+		t.Fatalf("unexpected info %v (%v)", info, err)
+	}
+	if _, err := store.Get(ctx, "pop/proving.key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := store.Put(ctx, "pop/proving.key", strings.NewReader("")); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+}
+
+// memoryObjects is the object map of the fake S3 and GCS servers
+type memoryObjects struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memoryObjects) put(name string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.objects == nil {
+		m.objects = map[string][]byte{}
+	}
+	m.objects[name] = data
+}
+
+func (m *memoryObjects) get(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[name]
+	return data, ok
+}
+
+func (m *memoryObjects) list(prefix string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestS3Store(t *testing.T) {
+	var objects memoryObjects
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		name, ok := strings.CutPrefix(r.URL.Path, "/artifacts/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/artifacts":
+			var result struct {
+				XMLName  xml.Name `xml:"ListBucketResult"`
+				Contents []struct {
+					Key  string `xml:"Key"`
+					Size int    `xml:"Size"`
+				} `xml:"Contents"`
+			}
+			for _, name := range objects.list(r.URL.Query().Get("prefix")) {
+				data, _ := objects.get(name)
+				result.Contents = append(result.Contents, struct {
+					Key  string `xml:"Key"`
+					Size int    `xml:"Size"`
+				}{name, len(data)})
+			}
+			xml.NewEncoder(w).Encode(result)
+		case !ok:
+			http.NotFound(w, r)
+		case r.Method == http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objects.put(name, data)
+		default:
+			data, found := objects.get(name)
+			if !found {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			if r.Method == http.MethodGet {
+				w.Write(data)
+			}
+		}
+	}))
+	defer server.Close()
+
+	store := &S3Store{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "artifacts",
+		Prefix:          "circuits",
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio-secret",
+		HTTPClient:      server.Client(),
+	}
+	testStore(t, store)
+
+	if _, ok := objects.get("circuits/pop/proving.key"); !ok {
+		t.Fatal("the key prefix is not applied")
+	}
+}
+
+// TestSignV4 checks the signature against the get-vanilla example of the AWS
+// Signature Version 4 test suite
+func TestSignV4(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signV4(req, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", emptySHA256,
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if auth := req.Header.Get("Authorization"); auth != expected {
+		t.Fatalf("unexpected Authorization header\n%s\nexpected\n%s", auth, expected)
+	}
+}
+
+func TestGCSStore(t *testing.T) {
+	var objects memoryObjects
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/artifacts/o":
+			data, _ := io.ReadAll(r.Body)
+			objects.put(r.URL.Query().Get("name"), data)
+			w.Write([]byte("{}"))
+		case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/artifacts/o":
+			var items []map[string]string
+			for _, name := range objects.list(r.URL.Query().Get("prefix")) {
+				data, _ := objects.get(name)
+				items = append(items, map[string]string{"name": name, "size": strconv.Itoa(len(data))})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"items": items})
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/artifacts/o/"):
+			name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/artifacts/o/")
+			data, found := objects.get(name)
+			if !found {
+				http.NotFound(w, r)
+				return
+			}
+			if r.URL.Query().Get("alt") == "media" {
+				w.Write(data)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"name": name, "size": strconv.Itoa(len(data))})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := NewGCSStore("artifacts", func(ctx context.Context) (string, error) { return "token", nil })
+	store.Endpoint = server.URL
+	store.HTTPClient = server.Client()
+	testStore(t, store)
+
+	if data, _ := objects.get("pop/circuit.ccs"); !bytes.Equal(data, []byte("constraint system")) {
+		t.Fatalf("unexpected object %q", data)
+	}
+}
+
+func TestVKRegistry(t *testing.T) {
+	ctx := context.Background()
+	store := NewFSStore(t.TempDir())
+	r := NewVKRegistry(store)
+
+	if _, _, err := r.Put(ctx, []byte("not a verifying key")); !errors.Is(err, ErrInvalidVK) {
+		t.Fatalf("expected ErrInvalidVK, got %v", err)
+	}
+	for _, hash := range []string{"", "../proving", strings.Repeat("AB", 32), strings.Repeat("ab", 31)} {
+		if _, err := r.Get(ctx, hash); !errors.Is(err, ErrInvalidVK) {
+			t.Errorf("%q: expected ErrInvalidVK, got %v", hash, err)
+		}
+	}
+
+	// a key altered in the store is not served under its hash
+	hash := strings.Repeat("ab", 32)
+	if _, err := r.Get(ctx, hash); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := store.Put(ctx, VKKey(hash), strings.NewReader("tampered")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get(ctx, hash); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("expected ErrHashMismatch, got %v", err)
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	ctx := context.Background()
+	leader, replica := NewFSStore(t.TempDir()), NewFSStore(t.TempDir())
+	for key, data := range map[string]string{
+		"pop/circuit.ccs":  "constraint system",
+		"pop/proving.key":  "proving key",
+		"pop/verifying.vk": "verifying key",
+	} {
+		if err := leader.Put(ctx, key, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := BuildManifest(ctx, leader, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := PutManifest(ctx, leader, ManifestKey, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Artifacts) != 3 || m.Version == "" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	if err := m.Check(ctx, replica); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound before replication, got %v", err)
+	}
+
+	// the leader over HTTP, as served on /artifacts
+	srv := httptest.NewServer(http.StripPrefix("/artifacts", http.FileServer(http.Dir(leader.Root))))
+	defer srv.Close()
+	replicated, err := Replicate(ctx, NewHTTPStore(srv.URL+"/artifacts"), replica, ManifestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicated.Version != m.Version {
+		t.Fatalf("unexpected manifest version %s", replicated.Version)
+	}
+	if err := m.Check(ctx, replica); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetManifest(ctx, replica, ManifestKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// an artifact diverging from the manifest is refused and not stored
+	if err := leader.Put(ctx, "pop/proving.key", strings.NewReader("tampered")); err != nil {
+		t.Fatal(err)
+	}
+	other := NewFSStore(t.TempDir())
+	if _, err := Replicate(ctx, leader, other, ManifestKey); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("expected ErrDigestMismatch, got %v", err)
+	}
+	if _, err := other.Stat(ctx, "pop/proving.key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the mismatching artifact not to be stored, got %v", err)
+	}
+	if err := m.Check(ctx, leader); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("expected ErrDigestMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"fmt"
+)
+
+// OIDAndroidKeyAttestation is the OID of the Android key attestation
+// extension
+var OIDAndroidKeyAttestation = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 1, 17}
+
+// Tags of the AuthorizationList fields read from the hardware-enforced list
+// (context-specific, EXPLICIT)
+const (
+	tagOrigin      = 702
+	tagRootOfTrust = 704
+)
+
+// OriginGenerated is the origin of a key generated in the secure hardware
+const OriginGenerated = 0
+
+// VerifiedBootVerified is the verified boot state of a device booted with
+// the verified boot chain of its vendor
+const VerifiedBootVerified = 0
+
+// RootOfTrust is the verified boot state of the device
+type RootOfTrust struct {
+	VerifiedBootKey   []byte
+	DeviceLocked      bool
+	VerifiedBootState asn1.Enumerated
+	VerifiedBootHash  []byte `asn1:"optional"`
+}
+
+// KeyDescription is the content of the Android key attestation extension.
+// Only the hardware-enforced fields the policy checks are decoded from the
+// authorization lists.
+type KeyDescription struct {
+	AttestationVersion       int
+	AttestationSecurityLevel SecurityLevel
+	KeyMintVersion           int
+	KeyMintSecurityLevel     SecurityLevel
+	AttestationChallenge     []byte
+	UniqueID                 []byte
+	// Origin is the hardware-enforced origin of the key, -1 when absent
+	Origin int
+	// RootOfTrust is the hardware-enforced boot state, nil when absent
+	RootOfTrust *RootOfTrust
+}
+
+// keyDescription is the ASN.1 KeyDescription SEQUENCE
+type keyDescription struct {
+	AttestationVersion       int
+	AttestationSecurityLevel asn1.Enumerated
+	KeyMintVersion           int
+	KeyMintSecurityLevel     asn1.Enumerated
+	AttestationChallenge     []byte
+	UniqueID                 []byte
+	SoftwareEnforced         asn1.RawValue
+	HardwareEnforced         asn1.RawValue
+}
+
+// ParseKeyDescription parses the DER value of the key attestation extension
+func ParseKeyDescription(der []byte) (*KeyDescription, error) {
+	var kd keyDescription
+	rest, err := asn1.Unmarshal(der, &kd)
+	if err != nil {
+		return nil, fmt.Errorf("KeyDescription: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("KeyDescription: trailing data")
+	}
+	d := &KeyDescription{
+		AttestationVersion:       kd.AttestationVersion,
+		AttestationSecurityLevel: SecurityLevel(kd.AttestationSecurityLevel),
+		KeyMintVersion:           kd.KeyMintVersion,
+		KeyMintSecurityLevel:     SecurityLevel(kd.KeyMintSecurityLevel),
+		AttestationChallenge:     kd.AttestationChallenge,
+		UniqueID:                 kd.UniqueID,
+		Origin:                   -1,
+	}
+
+	// hardware-enforced AuthorizationList: a SEQUENCE of tagged optional fields
+	for list := kd.HardwareEnforced.Bytes; len(list) > 0; {
+		var field asn1.RawValue
+		if list, err = asn1.Unmarshal(list, &field); err != nil {
+			return nil, fmt.Errorf("KeyDescription: hardwareEnforced: %w", err)
+		}
+		if field.Class != asn1.ClassContextSpecific {
+			continue
+		}
+		switch field.Tag {
+		case tagOrigin:
+			if _, err := asn1.Unmarshal(field.Bytes, &d.Origin); err != nil {
+				return nil, fmt.Errorf("KeyDescription: origin: %w", err)
+			}
+		case tagRootOfTrust:
+			d.RootOfTrust = &RootOfTrust{}
+			if _, err := asn1.Unmarshal(field.Bytes, d.RootOfTrust); err != nil {
+				return nil, fmt.Errorf("KeyDescription: rootOfTrust: %w", err)
+			}
+		}
+	}
+	return d, nil
+}
+
+// Marshal returns the DER value of the key attestation extension, with the
+// origin and the root of trust in the hardware-enforced list
+func (d *KeyDescription) Marshal() ([]byte, error) {
+	var hardware []byte
+	if d.Origin >= 0 {
+		field, err := asn1.MarshalWithParams(d.Origin, fmt.Sprintf("explicit,tag:%d", tagOrigin))
+		if err != nil {
+			return nil, err
+		}
+		hardware = append(hardware, field...)
+	}
+	if d.RootOfTrust != nil {
+		field, err := asn1.MarshalWithParams(*d.RootOfTrust, fmt.Sprintf("explicit,tag:%d", tagRootOfTrust))
+		if err != nil {
+			return nil, err
+		}
+		hardware = append(hardware, field...)
+	}
+	return asn1.Marshal(keyDescription{
+		AttestationVersion:       d.AttestationVersion,
+		AttestationSecurityLevel: asn1.Enumerated(d.AttestationSecurityLevel),
+		KeyMintVersion:           d.KeyMintVersion,
+		KeyMintSecurityLevel:     asn1.Enumerated(d.KeyMintSecurityLevel),
+		AttestationChallenge:     d.AttestationChallenge,
+		UniqueID:                 d.UniqueID,
+		SoftwareEnforced:         asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true},
+		HardwareEnforced:         asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: hardware},
+	})
+}
+
+// VerifyAndroid verifies an Android key attestation chain (DER, leaf first,
+// as returned by KeyStore.getCertificateChain) against the policy and returns
+// the attested key of the leaf. The security level is the lower of the
+// attestation and KeyMint levels.
+func VerifyAndroid(chain [][]byte, policy *Policy) (*AttestedKey, error) {
+	certs, err := parseChain(chain)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChain(certs, policy); err != nil {
+		return nil, err
+	}
+	leaf := certs[0]
+	key, err := p256Key(leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	var value []byte
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(OIDAndroidKeyAttestation) {
+			value = ext.Value
+			break
+		}
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%w: no key attestation extension", ErrInvalidAttestation)
+	}
+	d, err := ParseKeyDescription(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+
+	level := min(d.AttestationSecurityLevel, d.KeyMintSecurityLevel)
+	if level > SecurityStrongBox {
+		return nil, fmt.Errorf("%w: unknown security level %d", ErrInvalidAttestation, level)
+	}
+	if policy.RequireHardware {
+		if !level.HardwareBacked() {
+			return nil, fmt.Errorf("%w: %s key attested by %s", ErrNotHardwareBacked, d.KeyMintSecurityLevel, d.AttestationSecurityLevel)
+		}
+		if d.Origin != OriginGenerated {
+			return nil, fmt.Errorf("%w: key not generated in the secure hardware", ErrNotHardwareBacked)
+		}
+	}
+	if policy.RequireVerifiedBoot {
+		rot := d.RootOfTrust
+		if rot == nil || !rot.DeviceLocked || rot.VerifiedBootState != VerifiedBootVerified {
+			return nil, fmt.Errorf("%w: device boot state is not verified", ErrUntrustedChain)
+		}
+	}
+
+	return &AttestedKey{
+		Platform:      PlatformAndroid,
+		PublicKey:     key,
+		SecurityLevel: level,
+		Challenge:     d.AttestationChallenge,
+		Chain:         certs,
+	}, nil
+}
+
+// VerifyAndroidIssuer verifies the issuing part of an Android key attestation
+// chain (DER, the attestation key certificate first, without the leaf) and
+// returns the attestation key, the public input of CircuitKeyAttestation. The
+// circuit proves the leaf and its key description without disclosing them.
+func VerifyAndroidIssuer(chain [][]byte, policy *Policy) (*ecdsa.PublicKey, error) {
+	certs, err := parseChain(chain)
+	if err != nil {
+		return nil, err
+	}
+	if !certs[0].IsCA {
+		return nil, fmt.Errorf("%w: attestation key certificate is not a CA", ErrInvalidAttestation)
+	}
+	if err := verifyChain(certs, policy); err != nil {
+		return nil, err
+	}
+	return p256Key(certs[0])
+}
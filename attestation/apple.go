@@ -0,0 +1,151 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// OIDAppleNonce is the OID of the App Attest credential certificate
+// extension holding the nonce
+var OIDAppleNonce = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 2}
+
+// App Attest AAGUIDs of the production and development environments
+var (
+	AAGUIDAppAttest        = [16]byte{'a', 'p', 'p', 'a', 't', 't', 'e', 's', 't'}
+	AAGUIDAppAttestDevelop = [16]byte{'a', 'p', 'p', 'a', 't', 't', 'e', 's', 't', 'd', 'e', 'v', 'e', 'l', 'o', 'p'}
+)
+
+// appleFormat is the fmt of an App Attest attestation object
+const appleFormat = "apple-appattest"
+
+// appleAttestation is the CBOR attestation object of App Attest
+type appleAttestation struct {
+	Fmt     string `cbor:"fmt"`
+	AttStmt struct {
+		X5C     [][]byte `cbor:"x5c"`
+		Receipt []byte   `cbor:"receipt"`
+	} `cbor:"attStmt"`
+	AuthData []byte `cbor:"authData"`
+}
+
+// appleNonce is the value of the nonce extension
+type appleNonce struct {
+	Nonce []byte `asn1:"tag:1,explicit"`
+}
+
+// authenticatorData is the part of the WebAuthn authenticator data App
+// Attest sets
+type authenticatorData struct {
+	rpIDHash     []byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+}
+
+// parseAuthenticatorData parses the authenticator data up to the credential
+// ID, the credential public key is the one of the certificate
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	// rpIdHash (32) flags (1) signCount (4) aaguid (16) credentialIdLength (2)
+	if len(data) < 55 {
+		return nil, fmt.Errorf("authenticator data too short")
+	}
+	a := &authenticatorData{
+		rpIDHash:  data[:32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+		aaguid:    data[37:53],
+	}
+	n := int(binary.BigEndian.Uint16(data[53:55]))
+	if len(data) < 55+n {
+		return nil, fmt.Errorf("authenticator data: credential ID too short")
+	}
+	a.credentialID = data[55 : 55+n]
+	return a, nil
+}
+
+// VerifyApple verifies an App Attest attestation object (attestKey) for the
+// client data hash against the policy and returns the attested key of the
+// credential certificate. Policy.AppID is required.
+func VerifyApple(attestationObject, clientDataHash []byte, policy *Policy) (*AttestedKey, error) {
+	var obj appleAttestation
+	if err := cbor.Unmarshal(attestationObject, &obj); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+	if obj.Fmt != appleFormat {
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidAttestation, obj.Fmt)
+	}
+	if policy.AppID == "" {
+		return nil, fmt.Errorf("no App Attest app ID")
+	}
+
+	certs, err := parseChain(obj.AttStmt.X5C)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChain(certs, policy); err != nil {
+		return nil, err
+	}
+	leaf := certs[0]
+	key, err := p256Key(leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	// the nonce of the credential certificate is SHA-256(authData || clientDataHash)
+	var value []byte
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(OIDAppleNonce) {
+			value = ext.Value
+			break
+		}
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%w: no nonce extension", ErrInvalidAttestation)
+	}
+	var nonce appleNonce
+	if rest, err := asn1.Unmarshal(value, &nonce); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed nonce extension", ErrInvalidAttestation)
+	}
+	expected := sha256.Sum256(append(bytes.Clone(obj.AuthData), clientDataHash...))
+	if !bytes.Equal(nonce.Nonce, expected[:]) {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidAttestation)
+	}
+
+	auth, err := parseAuthenticatorData(obj.AuthData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+	if rpID := sha256.Sum256([]byte(policy.AppID)); !bytes.Equal(auth.rpIDHash, rpID[:]) {
+		return nil, fmt.Errorf("%w: app ID mismatch", ErrInvalidAttestation)
+	}
+	if auth.signCount != 0 {
+		return nil, fmt.Errorf("%w: sign count %d of a new key", ErrInvalidAttestation, auth.signCount)
+	}
+	switch {
+	case bytes.Equal(auth.aaguid, AAGUIDAppAttest[:]):
+	case bytes.Equal(auth.aaguid, AAGUIDAppAttestDevelop[:]) && policy.AllowDevelopment:
+	default:
+		return nil, fmt.Errorf("%w: environment %q", ErrInvalidAttestation, bytes.TrimRight(auth.aaguid, "\x00"))
+	}
+	// the key identifier is the SHA-256 of the uncompressed public key
+	point, err := key.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+	keyID := sha256.Sum256(point.Bytes())
+	if !bytes.Equal(auth.credentialID, keyID[:]) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidAttestation)
+	}
+
+	return &AttestedKey{
+		Platform:      PlatformApple,
+		PublicKey:     key,
+		SecurityLevel: SecuritySecureEnclave,
+		Challenge:     clientDataHash,
+		Chain:         certs,
+	}, nil
+}
@@ -0,0 +1,174 @@
+// Package attestation verifies platform key attestations of holder keys, so
+// that verifiers can require the keys signing the challenges to be held in
+// secure hardware:
+//
+//   - Android Key Attestation: an X.509 chain to the Google attestation roots
+//     whose leaf certifies the key, with the KeyDescription extension
+//     (1.3.6.1.4.1.11129.2.1.17) stating where the key lives (VerifyAndroid)
+//   - Apple App Attest: the attestation object of a Secure Enclave key,
+//     chained to the Apple App Attestation root CA (VerifyApple)
+//
+// The returned AttestedKey binds the attested key to the challenge signature
+// of a presentation (AttestedKey.VerifyChallenge). The circuits prove the
+// same binding without revealing the key: see CircuitKeyAttestation in
+// circuits/eudi-vc, which takes the attestation key checked by
+// VerifyAndroidIssuer as public input.
+//
+// The platform roots are not embedded, the verifier configures them in
+// Policy.Roots.
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Failure classes of the verification, the returned errors wrap them with
+// the details
+var (
+	ErrInvalidAttestation = errors.New("invalid key attestation")
+	ErrUntrustedChain     = errors.New("key attestation chain is not trusted")
+	ErrNotHardwareBacked  = errors.New("attested key is not hardware-backed")
+)
+
+// Platform is the attestation format
+type Platform string
+
+const (
+	PlatformAndroid Platform = "android-key"
+	PlatformApple   Platform = "apple-appattest"
+)
+
+// SecurityLevel is where the attested key lives, the values of the Android
+// SecurityLevel enumeration and SecuritySecureEnclave for App Attest
+type SecurityLevel int
+
+const (
+	SecuritySoftware           SecurityLevel = 0
+	SecurityTrustedEnvironment SecurityLevel = 1
+	SecurityStrongBox          SecurityLevel = 2
+	SecuritySecureEnclave      SecurityLevel = 3
+)
+
+// HardwareBacked reports whether the key is held outside of the operating
+// system (TEE, StrongBox, Secure Enclave)
+func (l SecurityLevel) HardwareBacked() bool {
+	return l != SecuritySoftware
+}
+
+func (l SecurityLevel) String() string {
+	switch l {
+	case SecuritySoftware:
+		return "software"
+	case SecurityTrustedEnvironment:
+		return "trusted-environment"
+	case SecurityStrongBox:
+		return "strongbox"
+	case SecuritySecureEnclave:
+		return "secure-enclave"
+	}
+	return fmt.Sprintf("security-level(%d)", int(l))
+}
+
+// Policy is what the verifier requires of an attestation
+type Policy struct {
+	// Roots are the platform attestation roots (the Google hardware
+	// attestation roots, the Apple App Attestation root CA)
+	Roots *x509.CertPool
+	// RequireHardware rejects the keys that are not hardware-backed
+	RequireHardware bool
+	// RequireVerifiedBoot rejects the Android devices with an unlocked
+	// bootloader or an unverified boot
+	RequireVerifiedBoot bool
+	// AppID is the App Attest app identifier (team id "." bundle id)
+	AppID string
+	// AllowDevelopment accepts App Attest keys of the development environment
+	AllowDevelopment bool
+	// Now is the clock the chains are verified at, time.Now when nil
+	Now func() time.Time
+}
+
+func (p *Policy) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
+
+// AttestedKey is a verified attestation of a P-256 key
+type AttestedKey struct {
+	Platform      Platform
+	PublicKey     *ecdsa.PublicKey
+	SecurityLevel SecurityLevel
+	// Challenge is the challenge the key was attested for: the
+	// attestationChallenge of Android, the clientDataHash of App Attest
+	Challenge []byte
+	// Chain is the verified chain, leaf first
+	Chain []*x509.Certificate
+}
+
+// VerifyChallenge verifies the ES256 signature (r || s) of the challenge by
+// the attested key, binding the attestation to the holder of the key
+func (k *AttestedKey) VerifyChallenge(challenge, signature []byte) error {
+	if len(signature) != 64 {
+		return fmt.Errorf("invalid signature size %d", len(signature))
+	}
+	digest := sha256.Sum256(challenge)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(k.PublicKey, digest[:], r, s) {
+		return fmt.Errorf("challenge signature of the attested key mismatch")
+	}
+	return nil
+}
+
+// parseChain parses a DER chain, leaf first
+func parseChain(chain [][]byte) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: empty certificate chain", ErrInvalidAttestation)
+	}
+	certs := make([]*x509.Certificate, len(chain))
+	for i, der := range chain {
+		var err error
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("%w: certificate %d: %w", ErrInvalidAttestation, i, err)
+		}
+	}
+	return certs, nil
+}
+
+// verifyChain verifies that certs[0] chains to the roots through certs[1:]
+func verifyChain(certs []*x509.Certificate, policy *Policy) error {
+	if policy.Roots == nil {
+		return fmt.Errorf("%w: no attestation roots", ErrUntrustedChain)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         policy.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   policy.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUntrustedChain, err)
+	}
+	return nil
+}
+
+// p256Key returns the P-256 public key of the certificate
+func p256Key(cert *x509.Certificate) (*ecdsa.PublicKey, error) {
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: attested key is not a P-256 key", ErrInvalidAttestation)
+	}
+	return key, nil
+}
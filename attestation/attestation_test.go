@@ -0,0 +1,314 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// testCA is a root and an intermediate of a synthetic attestation chain
+type testCA struct {
+	root, intermediate       *x509.Certificate
+	rootKey, intermediateKey *ecdsa.PrivateKey
+	rootDER, intermediateDER []byte
+	roots                    *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	ca := &testCA{}
+	ca.rootKey = newKey(t)
+	ca.intermediateKey = newKey(t)
+	ca.rootDER, ca.root = issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Attestation Root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, &ca.rootKey.PublicKey, ca.rootKey)
+	ca.intermediateDER, ca.intermediate = issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Attestation Key"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, ca.root, &ca.intermediateKey.PublicKey, ca.rootKey)
+	ca.roots = x509.NewCertPool()
+	ca.roots.AddCert(ca.root)
+	return ca
+}
+
+// leaf issues a certificate of key with the extension by the intermediate
+func (ca *testCA) leaf(t *testing.T, key *ecdsa.PublicKey, id asn1.ObjectIdentifier, value []byte) []byte {
+	t.Helper()
+	der, _ := issue(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(3),
+		Subject:         pkix.Name{CommonName: "Attested Key"},
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: id, Value: value}},
+	}, ca.intermediate, key, ca.intermediateKey)
+	return der
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func issue(t *testing.T, template, parent *x509.Certificate, pub *ecdsa.PublicKey, signer *ecdsa.PrivateKey) ([]byte, *x509.Certificate) {
+	t.Helper()
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, cert
+}
+
+// sign returns the ES256 signature (r || s) of the message
+func sign(t *testing.T, key *ecdsa.PrivateKey, message []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(message)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+}
+
+func testKeyDescription(level SecurityLevel) *KeyDescription {
+	return &KeyDescription{
+		AttestationVersion:       200,
+		AttestationSecurityLevel: level,
+		KeyMintVersion:           200,
+		KeyMintSecurityLevel:     level,
+		AttestationChallenge:     []byte("attestation challenge"),
+		Origin:                   OriginGenerated,
+		RootOfTrust: &RootOfTrust{
+			VerifiedBootKey:   bytes.Repeat([]byte{0x42}, 32),
+			DeviceLocked:      true,
+			VerifiedBootState: VerifiedBootVerified,
+			VerifiedBootHash:  bytes.Repeat([]byte{0x24}, 32),
+		},
+	}
+}
+
+func TestKeyDescription(t *testing.T) {
+	d := testKeyDescription(SecurityStrongBox)
+	der, err := d.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseKeyDescription(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.AttestationSecurityLevel != SecurityStrongBox || parsed.KeyMintSecurityLevel != SecurityStrongBox ||
+		parsed.Origin != OriginGenerated || !bytes.Equal(parsed.AttestationChallenge, d.AttestationChallenge) {
+		t.Fatalf("unexpected key description %+v", parsed)
+	}
+	if rot := parsed.RootOfTrust; rot == nil || !rot.DeviceLocked || !bytes.Equal(rot.VerifiedBootKey, d.RootOfTrust.VerifiedBootKey) {
+		t.Fatalf("unexpected root of trust %+v", rot)
+	}
+
+	// the hardware-enforced fields are optional
+	d.Origin, d.RootOfTrust = -1, nil
+	if der, err = d.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+	if parsed, err = ParseKeyDescription(der); err != nil || parsed.Origin != -1 || parsed.RootOfTrust != nil {
+		t.Fatalf("unexpected key description %+v (%v)", parsed, err)
+	}
+
+	if _, err := ParseKeyDescription(append(der, 0)); err == nil {
+		t.Fatal("expected trailing data to fail")
+	}
+}
+
+func TestVerifyAndroid(t *testing.T) {
+	ca := newTestCA(t)
+	holder := newKey(t)
+	policy := &Policy{Roots: ca.roots, RequireHardware: true, RequireVerifiedBoot: true}
+
+	attest := func(d *KeyDescription) [][]byte {
+		value, err := d.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return [][]byte{ca.leaf(t, &holder.PublicKey, OIDAndroidKeyAttestation, value), ca.intermediateDER, ca.rootDER}
+	}
+
+	key, err := VerifyAndroid(attest(testKeyDescription(SecurityTrustedEnvironment)), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Platform != PlatformAndroid || key.SecurityLevel != SecurityTrustedEnvironment || !key.PublicKey.Equal(&holder.PublicKey) {
+		t.Fatalf("unexpected attested key %+v", key)
+	}
+	if !bytes.Equal(key.Challenge, []byte("attestation challenge")) {
+		t.Fatalf("unexpected challenge %q", key.Challenge)
+	}
+
+	challenge := []byte("presentation challenge")
+	if err := key.VerifyChallenge(challenge, sign(t, holder, challenge)); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.VerifyChallenge(challenge, sign(t, newKey(t), challenge)); err == nil {
+		t.Fatal("expected the signature of another key to fail")
+	}
+
+	// software keys pass only without RequireHardware
+	software := attest(testKeyDescription(SecuritySoftware))
+	if _, err := VerifyAndroid(software, policy); !errors.Is(err, ErrNotHardwareBacked) {
+		t.Fatalf("expected ErrNotHardwareBacked, got %v", err)
+	}
+	if key, err := VerifyAndroid(software, &Policy{Roots: ca.roots}); err != nil || key.SecurityLevel.HardwareBacked() {
+		t.Fatalf("unexpected software key %+v (%v)", key, err)
+	}
+
+	// the lower of the two levels counts
+	mixed := testKeyDescription(SecurityStrongBox)
+	mixed.KeyMintSecurityLevel = SecuritySoftware
+	if _, err := VerifyAndroid(attest(mixed), policy); !errors.Is(err, ErrNotHardwareBacked) {
+		t.Fatalf("expected ErrNotHardwareBacked, got %v", err)
+	}
+
+	imported := testKeyDescription(SecurityStrongBox)
+	imported.Origin = 2
+	if _, err := VerifyAndroid(attest(imported), policy); !errors.Is(err, ErrNotHardwareBacked) {
+		t.Fatalf("expected ErrNotHardwareBacked for an imported key, got %v", err)
+	}
+
+	unlocked := testKeyDescription(SecurityStrongBox)
+	unlocked.RootOfTrust.DeviceLocked = false
+	if _, err := VerifyAndroid(attest(unlocked), policy); !errors.Is(err, ErrUntrustedChain) {
+		t.Fatalf("expected an unlocked device to fail, got %v", err)
+	}
+
+	if _, err := VerifyAndroid(attest(testKeyDescription(SecurityStrongBox)), &Policy{Roots: newTestCA(t).roots}); !errors.Is(err, ErrUntrustedChain) {
+		t.Fatalf("expected ErrUntrustedChain, got %v", err)
+	}
+
+	plain := [][]byte{ca.leaf(t, &holder.PublicKey, asn1.ObjectIdentifier{1, 2, 3}, []byte{0x05, 0x00}), ca.intermediateDER}
+	if _, err := VerifyAndroid(plain, policy); !errors.Is(err, ErrInvalidAttestation) {
+		t.Fatalf("expected ErrInvalidAttestation without the extension, got %v", err)
+	}
+}
+
+func TestVerifyAndroidIssuer(t *testing.T) {
+	ca := newTestCA(t)
+	policy := &Policy{Roots: ca.roots}
+
+	key, err := VerifyAndroidIssuer([][]byte{ca.intermediateDER, ca.rootDER}, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(&ca.intermediateKey.PublicKey) {
+		t.Fatal("unexpected attestation key")
+	}
+
+	leaf := ca.leaf(t, &newKey(t).PublicKey, OIDAndroidKeyAttestation, []byte{0x30, 0x00})
+	if _, err := VerifyAndroidIssuer([][]byte{leaf, ca.intermediateDER}, policy); !errors.Is(err, ErrInvalidAttestation) {
+		t.Fatalf("expected a leaf to be rejected, got %v", err)
+	}
+	if _, err := VerifyAndroidIssuer([][]byte{ca.intermediateDER}, &Policy{Roots: newTestCA(t).roots}); !errors.Is(err, ErrUntrustedChain) {
+		t.Fatalf("expected ErrUntrustedChain, got %v", err)
+	}
+}
+
+// appAttest returns an App Attest attestation object of the key
+func appAttest(t *testing.T, ca *testCA, key *ecdsa.PrivateKey, appID string, aaguid [16]byte, clientDataHash []byte) []byte {
+	t.Helper()
+	point, err := key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := sha256.Sum256(point.Bytes())
+	rpID := sha256.Sum256([]byte(appID))
+
+	authData := append(rpID[:], 0x40)
+	authData = binary.BigEndian.AppendUint32(authData, 0)
+	authData = append(authData, aaguid[:]...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(keyID)))
+	authData = append(authData, keyID[:]...)
+
+	nonce := sha256.Sum256(append(bytes.Clone(authData), clientDataHash...))
+	value, err := asn1.Marshal(appleNonce{Nonce: nonce[:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var obj appleAttestation
+	obj.Fmt = appleFormat
+	obj.AttStmt.X5C = [][]byte{ca.leaf(t, &key.PublicKey, OIDAppleNonce, value), ca.intermediateDER}
+	obj.AuthData = authData
+	data, err := cbor.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestVerifyApple(t *testing.T) {
+	ca := newTestCA(t)
+	holder := newKey(t)
+	clientDataHash := sha256.Sum256([]byte("client data"))
+	policy := &Policy{Roots: ca.roots, RequireHardware: true, AppID: "TEAMID1234.eu.example.wallet"}
+
+	object := appAttest(t, ca, holder, policy.AppID, AAGUIDAppAttest, clientDataHash[:])
+	key, err := VerifyApple(object, clientDataHash[:], policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Platform != PlatformApple || key.SecurityLevel != SecuritySecureEnclave || !key.PublicKey.Equal(&holder.PublicKey) {
+		t.Fatalf("unexpected attested key %+v", key)
+	}
+	challenge := []byte("presentation challenge")
+	if err := key.VerifyChallenge(challenge, sign(t, holder, challenge)); err != nil {
+		t.Fatal(err)
+	}
+
+	other := sha256.Sum256([]byte("other client data"))
+	if _, err := VerifyApple(object, other[:], policy); !errors.Is(err, ErrInvalidAttestation) {
+		t.Fatalf("expected a nonce mismatch, got %v", err)
+	}
+	if _, err := VerifyApple(object, clientDataHash[:], &Policy{Roots: ca.roots, AppID: "TEAMID1234.eu.example.other"}); !errors.Is(err, ErrInvalidAttestation) {
+		t.Fatalf("expected an app ID mismatch, got %v", err)
+	}
+	if _, err := VerifyApple(object, clientDataHash[:], &Policy{Roots: newTestCA(t).roots, AppID: policy.AppID}); !errors.Is(err, ErrUntrustedChain) {
+		t.Fatalf("expected ErrUntrustedChain, got %v", err)
+	}
+
+	develop := appAttest(t, ca, holder, policy.AppID, AAGUIDAppAttestDevelop, clientDataHash[:])
+	if _, err := VerifyApple(develop, clientDataHash[:], policy); !errors.Is(err, ErrInvalidAttestation) {
+		t.Fatalf("expected the development environment to fail, got %v", err)
+	}
+	policy.AllowDevelopment = true
+	if _, err := VerifyApple(develop, clientDataHash[:], policy); err != nil {
+		t.Fatal(err)
+	}
+}
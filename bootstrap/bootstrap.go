@@ -0,0 +1,351 @@
+// Package bootstrap provisions the compiled circuit artifacts of the provers
+// running on the holder device (the gomobile and WASM wallets). The artifacts
+// are downloaded from a CDN with the cluster manifest listing their digests
+// (artifact.Manifest), signed by an operator key like the artifacts
+// themselves (common.SignArtifact, kind ArtifactManifest):
+//
+//	https://cdn.example/zk/manifest.json
+//	https://cdn.example/zk/manifest.json.sig
+//	https://cdn.example/zk/eudi-vc/pop-v1/proving.key
+//	...
+//
+// Sync verifies the signature of the manifest, then downloads the artifacts
+// it lists into an app-private directory. The proving keys weigh hundreds of
+// MB: an interrupted download is kept as <key>.part and resumed with a range
+// request, and an artifact is only moved to its key once it matches its
+// digest. Load checks the manifest signature and the digests of the stored
+// artifacts again before loading them, the storage of a device is not
+// trusted more than the CDN.
+//
+// The WASM builds use the directory of the filesystem of their host (WASI
+// preopened directory, Node.js).
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/mynextid/eudi-zk/artifact"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// ArtifactManifest is the kind of the manifest signatures
+const ArtifactManifest = artifact.ManifestKey
+
+// partSuffix is appended to the key of an artifact being downloaded
+const partSuffix = ".part"
+
+// maxManifestSize bounds the manifest and its signature
+const maxManifestSize = 1 << 20
+
+// Bootstrap downloads the artifacts of a signed manifest to an app-private
+// directory and loads them
+type Bootstrap struct {
+	// Source is the CDN serving the manifest and the artifacts
+	Source *artifact.HTTPStore
+	// Dir is the app-private directory of the artifacts
+	Dir string
+	// ManifestKey is the key of the manifest, artifact.ManifestKey when empty
+	ManifestKey string
+	// Trusted are the keys signing the manifest, by key id
+	Trusted map[string]ed25519.PublicKey
+	// Progress reports the bytes of an artifact stored so far, optional
+	Progress func(key string, done, total int64)
+}
+
+// New returns the bootstrap of the artifacts served under baseURL
+func New(baseURL, dir string, trusted map[string]ed25519.PublicKey) *Bootstrap {
+	return &Bootstrap{Source: artifact.NewHTTPStore(baseURL), Dir: dir, Trusted: trusted}
+}
+
+func (b *Bootstrap) manifestKey() string {
+	if b.ManifestKey == "" {
+		return artifact.ManifestKey
+	}
+	return b.ManifestKey
+}
+
+// path returns the local path of an artifact key, validated by
+// artifact.ParseManifest
+func (b *Bootstrap) path(key string) string {
+	return filepath.Join(b.Dir, filepath.FromSlash(key))
+}
+
+// Sync downloads the signed manifest and the artifacts it lists that the
+// directory does not hold yet, resuming the interrupted downloads, and stores
+// the manifest last. A manifest without a valid signature of a trusted key
+// is refused (common.ErrUntrustedArtifact), and so is a manifest of another
+// solver hint set (common.ErrMissingHints).
+func (b *Bootstrap) Sync(ctx context.Context) (*artifact.Manifest, error) {
+	key := b.manifestKey()
+	data, err := b.download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := b.download(ctx, key+common.ArtifactSignatureSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", common.ErrUntrustedArtifact, key, err)
+	}
+	m, err := b.verifyManifest(data, sig)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Artifacts {
+		if err := b.fetch(ctx, a); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFileAtomic(b.path(key+common.ArtifactSignatureSuffix), sig); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(b.path(key), data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// download reads a small object of the source, the manifest or its signature
+func (b *Bootstrap) download(ctx context.Context, key string) ([]byte, error) {
+	rc, err := b.Source.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("%s: larger than %d bytes", key, maxManifestSize)
+	}
+	return data, nil
+}
+
+// verifyManifest verifies the signature of the manifest and parses it
+func (b *Bootstrap) verifyManifest(data, sig []byte) (*artifact.Manifest, error) {
+	digest := sha256.Sum256(data)
+	if _, err := common.VerifyArtifact(b.Trusted, ArtifactManifest, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.manifestKey(), err)
+	}
+	m, err := artifact.ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", b.manifestKey(), err)
+	}
+	if err := common.CheckManifestHints(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fetch stores an artifact of the manifest, unless the directory already
+// holds it with its digest. The download goes to <key>.part, resumed from
+// its size, and is moved to the key once it matches the digest.
+func (b *Bootstrap) fetch(ctx context.Context, a artifact.ManifestArtifact) error {
+	path := b.path(a.Key)
+	if digest, _, err := fileDigest(path); err == nil && digest == a.SHA256 {
+		b.progress(a.Key, a.Size, a.Size)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	part, err := os.OpenFile(path+partSuffix, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+	h := sha256.New()
+	offset, err := io.Copy(h, part)
+	if err != nil {
+		return err
+	}
+	if offset > a.Size {
+		// of another version of the artifact
+		if offset, err = restart(part, h); err != nil {
+			return err
+		}
+	}
+
+	if offset < a.Size {
+		rc, start, err := b.Source.GetFrom(ctx, a.Key, offset)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if start != offset {
+			// the source ignored the range
+			if offset, err = restart(part, h); err != nil {
+				return err
+			}
+		}
+		w := &progressWriter{key: a.Key, done: offset, total: a.Size, progress: b.progress}
+		// one byte more than expected detects an oversized artifact
+		n, err := io.Copy(io.MultiWriter(part, h, w), io.LimitReader(rc, a.Size-offset+1))
+		if err != nil {
+			return fmt.Errorf("%s: download interrupted at %d of %d bytes: %w", a.Key, offset+n, a.Size, err)
+		}
+		offset += n
+	}
+	if err := part.Sync(); err != nil {
+		return err
+	}
+
+	if offset != a.Size || hex.EncodeToString(h.Sum(nil)) != a.SHA256 {
+		part.Close()
+		os.Remove(path + partSuffix)
+		return fmt.Errorf("%s: %w", a.Key, artifact.ErrDigestMismatch)
+	}
+	if err := part.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+partSuffix, path)
+}
+
+func (b *Bootstrap) progress(key string, done, total int64) {
+	if b.Progress != nil {
+		b.Progress(key, done, total)
+	}
+}
+
+// restart truncates a partial download
+func restart(part *os.File, h hash.Hash) (int64, error) {
+	if err := part.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	h.Reset()
+	return 0, nil
+}
+
+// progressWriter reports the bytes written through it
+type progressWriter struct {
+	key         string
+	done, total int64
+	progress    func(key string, done, total int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.done += int64(len(p))
+	w.progress(w.key, w.done, w.total)
+	return len(p), nil
+}
+
+// Check verifies the stored manifest against its signature and the stored
+// artifacts under prefix against their digest, all of them when prefix is
+// empty. A tampered artifact is reported with artifact.ErrDigestMismatch.
+func (b *Bootstrap) Check(ctx context.Context, prefix string) (*artifact.Manifest, error) {
+	key := b.manifestKey()
+	data, err := os.ReadFile(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w, run Sync first", key, artifact.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sig, err := os.ReadFile(b.path(key + common.ArtifactSignatureSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", common.ErrUntrustedArtifact, key, err)
+	}
+	m, err := b.verifyManifest(data, sig)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range m.Artifacts {
+		if !strings.HasPrefix(a.Key, prefix) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		digest, _, err := fileDigest(b.path(a.Key))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", a.Key, artifact.ErrNotFound)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if digest != a.SHA256 {
+			return nil, fmt.Errorf("%s: %w", a.Key, artifact.ErrDigestMismatch)
+		}
+	}
+	return m, nil
+}
+
+// Load checks the artifacts of the circuit stored under prefix (e.g.
+// "eudi-vc/pop-v1/"), see Check, and loads them
+func (b *Bootstrap) Load(ctx context.Context, prefix string, encoding common.KeyEncoding) (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey, error) {
+	m, err := b.Check(ctx, prefix)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, kind := range []string{common.ArtifactCCS, common.ArtifactProvingKey, common.ArtifactVerifyingKey} {
+		if !m.Has(prefix + kind) {
+			return nil, nil, nil, fmt.Errorf("manifest %s does not list %s: %w", m.Version, prefix+kind, artifact.ErrNotFound)
+		}
+	}
+	return common.LoadSetupFromStore(ctx, artifact.NewFSStore(b.Dir), prefix, encoding)
+}
+
+// PublishManifest signs the manifest and writes it with its signature to the
+// store under key, the signature first: a reader seeing the manifest sees its
+// signature
+func PublishManifest(ctx context.Context, store artifact.Store, key string, m *artifact.Manifest, signer common.ArtifactSigner) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(data)
+	sig, err := common.SignArtifact(signer, ArtifactManifest, digest[:])
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, key+common.ArtifactSignatureSuffix, bytes.NewReader(sig)); err != nil {
+		return err
+	}
+	return store.Put(ctx, key, bytes.NewReader(data))
+}
+
+// fileDigest returns the hex SHA-256 and the size of a file
+func fileDigest(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// writeFileAtomic writes a file through a temporary file renamed over it
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
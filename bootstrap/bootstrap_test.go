@@ -0,0 +1,118 @@
+package bootstrap
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/artifact"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// cubeCircuit proves knowledge of X with X^3 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+func TestBootstrap(t *testing.T) {
+	// the CDN: the artifacts of cube/v1 and the signed manifest
+	cdn := t.TempDir()
+	dir := filepath.Join(cdn, "cube", "v1")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.SetupAndSave(&cubeCircuit{}, filepath.Join(dir, common.ArtifactCCS), filepath.Join(dir, common.ArtifactProvingKey), filepath.Join(dir, common.ArtifactVerifyingKey)); err != nil {
+		t.Fatal(err)
+	}
+	store := artifact.NewFSStore(cdn)
+	m, err := common.BuildManifest(t.Context(), store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	if err := PublishManifest(t.Context(), store, artifact.ManifestKey, m, common.ArtifactSigner{KeyID: "ops", Key: private}); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu     sync.Mutex
+		ranges = map[string]string{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges[r.URL.Path] = r.Header.Get("Range")
+		mu.Unlock()
+		http.FileServer(http.Dir(cdn)).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// an interrupted download of the proving key
+	local := t.TempDir()
+	pk, err := os.ReadFile(filepath.Join(dir, common.ArtifactProvingKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(local, "cube", "v1"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(local, "cube", "v1", common.ArtifactProvingKey+partSuffix), pk[:len(pk)/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(srv.URL, local, map[string]ed25519.PublicKey{"ops": public})
+	var done int64
+	b.Progress = func(key string, n, total int64) {
+		if key == "cube/v1/"+common.ArtifactProvingKey {
+			done = n
+		}
+	}
+	synced, err := b.Sync(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced.Version != m.Version || done != int64(len(pk)) {
+		t.Fatalf("unexpected manifest %s, proving key at %d of %d bytes", synced.Version, done, len(pk))
+	}
+	if got := ranges["/cube/v1/"+common.ArtifactProvingKey]; got == "" {
+		t.Fatal("expected the proving key download to resume with a range request")
+	}
+	if _, _, _, err := b.Load(t.Context(), "cube/v1/", common.KeyEncodingCompressed); err != nil {
+		t.Fatal(err)
+	}
+
+	// a tampered proving key is detected at load, and fetched again by Sync
+	tampered := filepath.Join(local, "cube", "v1", common.ArtifactProvingKey)
+	data, _ := os.ReadFile(tampered)
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(tampered, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := b.Load(t.Context(), "cube/v1/", common.KeyEncodingCompressed); !errors.Is(err, artifact.ErrDigestMismatch) {
+		t.Fatalf("expected ErrDigestMismatch, got %v", err)
+	}
+	if _, err := b.Sync(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Check(t.Context(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// a manifest signed by another key
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	untrusted := New(srv.URL, t.TempDir(), map[string]ed25519.PublicKey{"ops": other})
+	if _, err := untrusted.Sync(t.Context()); !errors.Is(err, common.ErrUntrustedArtifact) {
+		t.Fatalf("expected ErrUntrustedArtifact, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package circuitkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// Artifacts are the raw artifacts the components assign their inputs from,
+// each component reads the ones it verifies
+type Artifacts struct {
+	// JWS is the compact serialization (protected.payload.signature) of the
+	// credential, IssuerKey the key verifying it
+	JWS       string
+	IssuerKey *ecdsa.PublicKey
+	// Chain are the DER certificates from the holder certificate to the last
+	// intermediate, TrustAnchor the key signing the last one
+	Chain       [][]byte
+	TrustAnchor *ecdsa.PublicKey
+	// CRL is the DER CRL checked by WithNotRevoked at Now
+	CRL []byte
+	Now time.Time
+}
+
+// Assignment is the witness of a composed circuit
+type Assignment struct {
+	spec    *Spec
+	circuit *Circuit
+	// openings are the openings of the committed claims
+	openings []models.ClaimOpening
+}
+
+// Assign returns the assignment of the circuit: every component sets its
+// inputs from the artifacts. The components are assigned concurrently, each
+// sets its own inputs; the error of the first failing component and the
+// openings are in the order of the components, so the assignment does not
+// depend on the scheduling.
+func (s *Spec) Assign(artifacts *Artifacts) (*Assignment, error) {
+	a := s.NewAssignment()
+	parts := make([]*Assignment, len(s.components))
+	errs := make([]error, len(s.components))
+	var wg sync.WaitGroup
+	for i, c := range s.components {
+		// the parts share the circuit, the openings are their own
+		parts[i] = &Assignment{spec: s, circuit: a.circuit}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.Assign(parts[i], artifacts)
+		}()
+	}
+	wg.Wait()
+	for i, c := range s.components {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("%s: %w", c.Name(), errs[i])
+		}
+		a.openings = append(a.openings, parts[i].openings...)
+	}
+	return a, nil
+}
+
+// NewAssignment returns an empty assignment, the inputs are set one by one
+func (s *Spec) NewAssignment() *Assignment {
+	return &Assignment{spec: s, circuit: s.Circuit()}
+}
+
+// Circuit returns the assigned circuit, e.g. for frontend.NewWitness
+func (a *Assignment) Circuit() *Circuit {
+	return a.circuit
+}
+
+func (a *Assignment) slot(name string, kind Kind) (slot, error) {
+	s, ok := a.spec.slots[name]
+	if !ok {
+		return slot{}, fmt.Errorf("unknown input %q", name)
+	}
+	if s.input.Kind != kind {
+		return slot{}, fmt.Errorf("input %q is %s, not %s", name, s.input.Kind, kind)
+	}
+	return s, nil
+}
+
+// SetBytes sets a byte string input, padded inputs may be shorter
+func (a *Assignment) SetBytes(name string, b []byte) error {
+	s, err := a.slot(name, KindBytes)
+	if err != nil {
+		return err
+	}
+	if len(b) > s.input.Size || (len(b) < s.input.Size && !s.input.Padded) {
+		return fmt.Errorf("input %q: %d bytes, expected %d", name, len(b), s.input.Size)
+	}
+	padded := make([]byte, s.input.Size)
+	copy(padded, b)
+	if s.constant {
+		return s.matchBytes(padded)
+	}
+	u8 := make([]uints.U8, len(padded))
+	for i, v := range padded {
+		u8[i] = uints.NewU8(v)
+	}
+	if s.public {
+		a.circuit.PublicBytes[s.index] = u8
+	} else {
+		a.circuit.SecretBytes[s.index] = u8
+	}
+	return nil
+}
+
+// SetVariable sets a field element input
+func (a *Assignment) SetVariable(name string, v any) error {
+	s, err := a.slot(name, KindVariable)
+	if err != nil {
+		return err
+	}
+	if s.constant {
+		return s.matchInt(variableInt(v))
+	}
+	if s.public {
+		a.circuit.PublicVariables[s.index] = v
+	} else {
+		a.circuit.SecretVariables[s.index] = v
+	}
+	return nil
+}
+
+// SetFp sets a P-256 base field input
+func (a *Assignment) SetFp(name string, v *big.Int) error {
+	s, err := a.slot(name, KindFp)
+	if err != nil {
+		return err
+	}
+	if s.constant {
+		return s.matchInt(v)
+	}
+	if s.public {
+		a.circuit.PublicFp[s.index] = emulated.ValueOf[curves.Secp256r1Fp](v)
+	} else {
+		a.circuit.SecretFp[s.index] = emulated.ValueOf[curves.Secp256r1Fp](v)
+	}
+	return nil
+}
+
+// SetFr sets a P-256 scalar field input
+func (a *Assignment) SetFr(name string, v *big.Int) error {
+	s, err := a.slot(name, KindFr)
+	if err != nil {
+		return err
+	}
+	if s.constant {
+		return s.matchInt(v)
+	}
+	if s.public {
+		a.circuit.PublicFr[s.index] = emulated.ValueOf[curves.Secp256r1Fr](v)
+	} else {
+		a.circuit.SecretFr[s.index] = emulated.ValueOf[curves.Secp256r1Fr](v)
+	}
+	return nil
+}
+
+// SetCommitment sets a claim commitment input, big-endian
+func (a *Assignment) SetCommitment(name string, commitment []byte) error {
+	s, err := a.slot(name, KindCommitment)
+	if err != nil {
+		return err
+	}
+	a.circuit.Commitments[s.index] = new(big.Int).SetBytes(commitment)
+	return nil
+}
+
+// Openings returns the openings of the claims committed with fresh salts by
+// Assign (WithClaimCommitment), for PresentationPayload.Openings. The holder
+// sends the ones it reveals.
+func (a *Assignment) Openings() []models.ClaimOpening {
+	return a.openings
+}
+
+// setKey sets the coordinates inputs prefix_x and prefix_y
+func (a *Assignment) setKey(prefix string, key *ecdsa.PublicKey) error {
+	if key == nil {
+		return fmt.Errorf("no key for %s", prefix)
+	}
+	if err := a.SetFp(prefix+"_x", key.X); err != nil {
+		return err
+	}
+	return a.SetFp(prefix+"_y", key.Y)
+}
+
+// setSignature sets the inputs prefix_r and prefix_s
+func (a *Assignment) setSignature(prefix string, r, s *big.Int) error {
+	if err := a.SetFr(prefix+"_r", r); err != nil {
+		return err
+	}
+	return a.SetFr(prefix+"_s", s)
+}
+
+// certificateKey returns the P-256 subject key and the ECDSA signature of a
+// certificate
+func certificateKey(der []byte) (*x509.Certificate, *ecdsa.PublicKey, *big.Int, *big.Int, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, nil, nil, nil, fmt.Errorf("certificate key is not ECDSA")
+	}
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(cert.Signature, &sig); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("certificate signature: %w", err)
+	}
+	return cert, key, sig.R, sig.S, nil
+}
@@ -0,0 +1,50 @@
+package circuitkit
+
+import (
+	"fmt"
+
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// Bucketed is implemented by the components with padded public inputs: Bucket
+// rounds their sizes up to the size buckets of the circuit (WithSizeBuckets)
+type Bucketed interface {
+	Bucket(buckets common.SizeBuckets) error
+}
+
+// WithSizeBuckets pads the public byte inputs of the circuit to the size
+// buckets (common.SizeBuckets): Build rounds the sizes of the Bucketed
+// components up to their bucket, and fails for a padded public input of
+// another component whose size is not a bucket. The verifying key and the
+// public witness then tell the bucket of a value, not the credential type
+// its exact size would.
+func (b *Builder) WithSizeBuckets(buckets common.SizeBuckets) *Builder {
+	b.buckets = buckets
+	return b
+}
+
+// Bucket implements Bucketed, the value is padded to a bucket and the segment
+// sized for it
+func (c *ClaimReveal) Bucket(buckets common.SizeBuckets) error {
+	if c.SaltSize != 0 {
+		// committed, the value is secret
+		return nil
+	}
+	maxLen, err := buckets.Bucket(c.MaxLen)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Name(), err)
+	}
+	c.MaxLen = maxLen
+	c.SegmentLen = max(c.SegmentLen, NewClaimReveal(c.Claim, maxLen).SegmentLen)
+	return nil
+}
+
+// Bucket implements Bucketed, the CRL is padded to a bucket
+func (c *NotRevoked) Bucket(buckets common.SizeBuckets) error {
+	crlSize, err := buckets.Bucket(c.CRLSize)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Name(), err)
+	}
+	c.CRLSize = crlSize
+	return nil
+}
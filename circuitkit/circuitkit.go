@@ -0,0 +1,448 @@
+// Package circuitkit composes circuits from the verified building blocks of
+// the repository (JWS signature, certificate chain, cnf key binding, claim
+// reveal, CRL) without writing a Circuit struct by hand:
+//
+//	spec, err := circuitkit.New("pid-nationality/v1").
+//		WithJWS(64, 512).
+//		WithCertChain(420).
+//		WithCnf(108).
+//		WithClaimReveal("nationality", 8).
+//		Build()
+//	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, spec.Circuit())
+//
+// A Spec generates the circuit template, the input schema and, with Register,
+// the registry entry of the composed circuit. Components declare their inputs
+// and share the verified values (payload, holder key) through the Context, in
+// the order they are added.
+package circuitkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// Kind is the type of a circuit input
+type Kind int
+
+const (
+	// KindBytes is a byte string ([]uints.U8) of Input.Size bytes
+	KindBytes Kind = iota
+	// KindVariable is a field element (position, length)
+	KindVariable
+	// KindFp is a P-256 base field element (public key coordinate)
+	KindFp
+	// KindFr is a P-256 scalar field element (signature component)
+	KindFr
+	// KindCommitment is a public salted claim commitment
+	// (common.ClaimCommitment), in the Commitments of the circuit
+	KindCommitment
+)
+
+var kindNames = []string{"bytes", "variable", "fp", "fr", "commitment"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+	return kindNames[k]
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Input is an input of a component
+type Input struct {
+	// Name is unique within the circuit, prefixed by the component, e.g.
+	// "jws.payload"
+	Name   string `json:"name"`
+	Kind   Kind   `json:"kind"`
+	Size   int    `json:"size,omitempty"` // bytes of a KindBytes input
+	Public bool   `json:"public"`
+	// Padded byte strings may be shorter than Size, they are zero padded
+	Padded bool   `json:"padded,omitempty"`
+	Doc    string `json:"doc,omitempty"`
+}
+
+// Component is a verified building block of a composed circuit
+type Component interface {
+	// Name identifies the component in errors, e.g. "jws"
+	Name() string
+	// Requires returns the names of the components that must be added
+	// before this one
+	Requires() []string
+	// Inputs returns the inputs of the component
+	Inputs() []Input
+	// Define adds the constraints of the component
+	Define(api frontend.API, ctx *Context) error
+	// Assign sets the inputs of the component from the artifacts
+	Assign(a *Assignment, artifacts *Artifacts) error
+}
+
+// Parameterized is implemented by the components with compile parameters
+// beyond their input sizes, recorded in the schema (Schema.Params)
+type Parameterized interface {
+	// Params returns the compile parameters, by name
+	Params() map[string]int
+}
+
+// Context holds the inputs of the circuit and the values the components
+// verified for the ones added after them
+type Context struct {
+	circuit *Circuit
+
+	// Protected and Payload are the base64url parts of the verified JWS
+	Protected []uints.U8
+	Payload   []uints.U8
+	// HolderKey is the subject key of the verified certificate chain,
+	// HolderTBS the TBSCertificate of the leaf certificate
+	HolderKey *curves.PublicKey
+	HolderTBS []uints.U8
+}
+
+// Bytes returns the byte string input name
+func (ctx *Context) Bytes(name string) []uints.U8 {
+	s := ctx.circuit.Spec.slots[name]
+	if s.constant {
+		return s.constantBytes()
+	}
+	if s.public {
+		return ctx.circuit.PublicBytes[s.index]
+	}
+	return ctx.circuit.SecretBytes[s.index]
+}
+
+// Variable returns the field element input name
+func (ctx *Context) Variable(name string) frontend.Variable {
+	s := ctx.circuit.Spec.slots[name]
+	if s.constant {
+		return s.constantInt()
+	}
+	if s.public {
+		return ctx.circuit.PublicVariables[s.index]
+	}
+	return ctx.circuit.SecretVariables[s.index]
+}
+
+// Fp returns the P-256 base field input name
+func (ctx *Context) Fp(name string) emulated.Element[curves.Secp256r1Fp] {
+	s := ctx.circuit.Spec.slots[name]
+	if s.constant {
+		return emulated.ValueOf[curves.Secp256r1Fp](s.constantInt())
+	}
+	if s.public {
+		return ctx.circuit.PublicFp[s.index]
+	}
+	return ctx.circuit.SecretFp[s.index]
+}
+
+// Commitment returns the claim commitment input name
+func (ctx *Context) Commitment(name string) frontend.Variable {
+	return ctx.circuit.Commitments[ctx.circuit.Spec.slots[name].index]
+}
+
+// Fr returns the P-256 scalar field input name
+func (ctx *Context) Fr(name string) emulated.Element[curves.Secp256r1Fr] {
+	s := ctx.circuit.Spec.slots[name]
+	if s.constant {
+		return emulated.ValueOf[curves.Secp256r1Fr](s.constantInt())
+	}
+	if s.public {
+		return ctx.circuit.PublicFr[s.index]
+	}
+	return ctx.circuit.SecretFr[s.index]
+}
+
+// slot locates an input in the slices of Circuit, or holds the value of a
+// constant input
+type slot struct {
+	input    Input
+	public   bool
+	index    int
+	constant bool
+	value    []byte
+}
+
+// Builder declares the components of a circuit
+type Builder struct {
+	id         string
+	components []Component
+	constants  []Constant
+	buckets    common.SizeBuckets
+}
+
+// New returns a builder of the circuit id, e.g. "pid-nationality/v1"
+func New(id string) *Builder {
+	return &Builder{id: id}
+}
+
+// With adds a component
+func (b *Builder) With(c Component) *Builder {
+	b.components = append(b.components, c)
+	return b
+}
+
+// Build validates the components (dependencies, unique input names) and
+// returns the spec of the circuit
+func (b *Builder) Build() (*Spec, error) {
+	if b.id == "" {
+		return nil, fmt.Errorf("circuitkit: empty circuit id")
+	}
+	if len(b.components) == 0 {
+		return nil, fmt.Errorf("circuitkit: %s has no components", b.id)
+	}
+
+	if b.buckets != nil {
+		if err := b.buckets.Validate(); err != nil {
+			return nil, fmt.Errorf("circuitkit: %s: %w", b.id, err)
+		}
+		for _, c := range b.components {
+			if bucketed, ok := c.(Bucketed); ok {
+				if err := bucketed.Bucket(b.buckets); err != nil {
+					return nil, fmt.Errorf("circuitkit: %s: %w", b.id, err)
+				}
+			}
+		}
+	}
+
+	spec := &Spec{ID: b.id, components: slices.Clone(b.components), slots: map[string]slot{}, buckets: slices.Clone(b.buckets)}
+	constants := map[string][]byte{}
+	for _, c := range b.constants {
+		if _, dup := constants[c.Name]; dup {
+			return nil, fmt.Errorf("circuitkit: %s: duplicate constant %q", b.id, c.Name)
+		}
+		constants[c.Name] = c.Value
+	}
+	var added []string
+	counts := map[bool][]int{true: make([]int, len(kindNames)), false: make([]int, len(kindNames))}
+	for _, c := range b.components {
+		for _, required := range c.Requires() {
+			if !slices.Contains(added, required) {
+				return nil, fmt.Errorf("circuitkit: %s: %s requires %s before it", b.id, c.Name(), required)
+			}
+		}
+		added = append(added, c.Name())
+
+		for _, in := range c.Inputs() {
+			if _, dup := spec.slots[in.Name]; dup {
+				return nil, fmt.Errorf("circuitkit: %s: duplicate input %q", b.id, in.Name)
+			}
+			if in.Kind < KindBytes || in.Kind > KindCommitment {
+				return nil, fmt.Errorf("circuitkit: %s: input %q of unknown kind %s", b.id, in.Name, in.Kind)
+			}
+			if in.Kind == KindCommitment && !in.Public {
+				return nil, fmt.Errorf("circuitkit: %s: commitment %q is not public", b.id, in.Name)
+			}
+			if in.Kind == KindBytes && in.Size <= 0 {
+				return nil, fmt.Errorf("circuitkit: %s: input %q has no size", b.id, in.Name)
+			}
+			if b.buckets != nil && in.Kind == KindBytes && in.Public && in.Padded && !b.buckets.Contains(in.Size) {
+				return nil, fmt.Errorf("circuitkit: %s: public input %q of %d bytes is not a size bucket", b.id, in.Name, in.Size)
+			}
+			if value, ok := constants[in.Name]; ok {
+				if err := checkConstant(in, value); err != nil {
+					return nil, fmt.Errorf("circuitkit: %s: %w", b.id, err)
+				}
+				spec.slots[in.Name] = slot{input: in, public: in.Public, constant: true, value: value}
+				spec.constants = append(spec.constants, Constant{Name: in.Name, Kind: in.Kind, Value: value})
+				continue
+			}
+			spec.slots[in.Name] = slot{input: in, public: in.Public, index: counts[in.Public][in.Kind]}
+			counts[in.Public][in.Kind]++
+			spec.inputs = append(spec.inputs, in)
+		}
+	}
+	for _, c := range b.constants {
+		if _, ok := spec.slots[c.Name]; !ok {
+			return nil, fmt.Errorf("circuitkit: %s: constant of an unknown input %q", b.id, c.Name)
+		}
+	}
+	return spec, nil
+}
+
+// Spec is a composed circuit
+type Spec struct {
+	ID         string
+	components []Component
+	inputs     []Input // without the constants
+	constants  []Constant
+	slots      map[string]slot
+	buckets    common.SizeBuckets
+}
+
+// Circuit returns the circuit template to compile
+func (s *Spec) Circuit() *Circuit {
+	c := &Circuit{Spec: s}
+	for _, in := range s.inputs {
+		switch in.Kind {
+		case KindBytes:
+			if in.Public {
+				c.PublicBytes = append(c.PublicBytes, make([]uints.U8, in.Size))
+			} else {
+				c.SecretBytes = append(c.SecretBytes, make([]uints.U8, in.Size))
+			}
+		case KindVariable:
+			if in.Public {
+				c.PublicVariables = append(c.PublicVariables, nil)
+			} else {
+				c.SecretVariables = append(c.SecretVariables, nil)
+			}
+		case KindFp:
+			if in.Public {
+				c.PublicFp = append(c.PublicFp, emulated.Element[curves.Secp256r1Fp]{})
+			} else {
+				c.SecretFp = append(c.SecretFp, emulated.Element[curves.Secp256r1Fp]{})
+			}
+		case KindFr:
+			if in.Public {
+				c.PublicFr = append(c.PublicFr, emulated.Element[curves.Secp256r1Fr]{})
+			} else {
+				c.SecretFr = append(c.SecretFr, emulated.Element[curves.Secp256r1Fr]{})
+			}
+		case KindCommitment:
+			c.Commitments = append(c.Commitments, nil)
+		}
+	}
+	return c
+}
+
+// Schema describes the inputs of a composed circuit
+type Schema struct {
+	ID         string   `json:"id"`
+	Components []string `json:"components"`
+	// Inputs are in public witness order: the public inputs first, by kind
+	// (bytes, variables, fp, fr, commitments) and declaration order
+	Inputs []Input `json:"inputs"`
+	// Constants are the inputs baked in the circuit (WithConstant), not in
+	// the witness: the verifying key is only valid for their values
+	Constants []Constant `json:"constants,omitempty"`
+	// SizeBuckets are the sizes the padded public inputs are padded to
+	// (WithSizeBuckets)
+	SizeBuckets common.SizeBuckets `json:"size_buckets,omitempty"`
+	// Params are the compile parameters of the components (Parameterized),
+	// by component name: like Constants, the verifying key is only valid
+	// for them
+	Params map[string]map[string]int `json:"params,omitempty"`
+}
+
+// Schema returns the schema of the circuit
+func (s *Spec) Schema() Schema {
+	schema := Schema{ID: s.ID, Inputs: slices.Clone(s.inputs), Constants: slices.Clone(s.constants), SizeBuckets: slices.Clone(s.buckets)}
+	for _, c := range s.components {
+		schema.Components = append(schema.Components, c.Name())
+		if p, ok := c.(Parameterized); ok {
+			if schema.Params == nil {
+				schema.Params = map[string]map[string]int{}
+			}
+			schema.Params[c.Name()] = p.Params()
+		}
+	}
+	slices.SortStableFunc(schema.Inputs, func(a, b Input) int {
+		if a.Public != b.Public {
+			if a.Public {
+				return -1
+			}
+			return 1
+		}
+		return int(a.Kind) - int(b.Kind)
+	})
+	return schema
+}
+
+// MarshalJSON encodes the schema of the spec
+func (s *Spec) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Schema())
+}
+
+// Circuit is the circuit of a Spec, its inputs are slices of the inputs of
+// each kind and visibility, Spec maps the input names to them. Commitments
+// holds the claim commitments (common.ClaimCommitmentsField), so
+// models.PresentationVerifier.AddCommitments finds them.
+type Circuit struct {
+	Spec *Spec `gnark:"-"`
+
+	PublicBytes     [][]uints.U8                           `gnark:",public"`
+	PublicVariables []frontend.Variable                    `gnark:",public"`
+	PublicFp        []emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	PublicFr        []emulated.Element[curves.Secp256r1Fr] `gnark:",public"`
+	Commitments     []frontend.Variable                    `gnark:",public"`
+	SecretBytes     [][]uints.U8                           `gnark:",secret"`
+	SecretVariables []frontend.Variable                    `gnark:",secret"`
+	SecretFp        []emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SecretFr        []emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+}
+
+// Define implements the gnark Circuit interface
+func (c *Circuit) Define(api frontend.API) error {
+	if c.Spec == nil {
+		return fmt.Errorf("circuitkit: circuit without spec")
+	}
+	ctx := &Context{circuit: c}
+	for _, in := range c.Spec.inputs {
+		if in.Kind != KindBytes {
+			continue
+		}
+		if size := len(ctx.Bytes(in.Name)); size != in.Size {
+			return fmt.Errorf("circuitkit: input %q of %d bytes, expected %d", in.Name, size, in.Size)
+		}
+	}
+
+	for _, component := range c.Spec.components {
+		if err := component.Define(api, ctx); err != nil {
+			return fmt.Errorf("%s: %w", component.Name(), err)
+		}
+	}
+	return nil
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*Spec{}
+)
+
+// Register makes a composed circuit available by id (Lookup). Register panics
+// if the id is registered twice, as database/sql.Register.
+func Register(spec *Spec) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if spec == nil || spec.ID == "" || strings.ContainsAny(spec.ID, " \t\n") {
+		panic("circuitkit: Register of an invalid spec")
+	}
+	if _, dup := registry[spec.ID]; dup {
+		panic(fmt.Sprintf("circuitkit: Register called twice for circuit %q", spec.ID))
+	}
+	registry[spec.ID] = spec
+}
+
+// Lookup returns the registered spec of the circuit id
+func Lookup(id string) (*Spec, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	spec, ok := registry[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown circuit %q", id)
+	}
+	return spec, nil
+}
+
+// Registered returns the sorted ids of the registered circuits
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	ids := make([]string, 0, len(registry))
+	for id := range registry {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,445 @@
+package circuitkit_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/circuitkit"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+func mockKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// mockCert returns a certificate of key signed by parent (self-signed when
+// nil)
+func mockCert(t *testing.T, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, serial int64) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "cert " + big.NewInt(serial).String()},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// mockJWS signs the protected header and the payload with the issuer key
+func mockJWS(t *testing.T, issuerKey *ecdsa.PrivateKey, protected, payload any) string {
+	t.Helper()
+	protectedJSON, _ := json.Marshal(protected)
+	payloadJSON, _ := json.Marshal(payload)
+	signingInput := base64.RawURLEncoding.EncodeToString(protectedJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(append(common.PadTo32Bytes(r.Bytes()), common.PadTo32Bytes(s.Bytes())...))
+}
+
+func partSizes(jws string) (int, int) {
+	parts := strings.Split(jws, ".")
+	return len(parts[0]), len(parts[1])
+}
+
+func TestBuild(t *testing.T) {
+	if _, err := circuitkit.New("cnf/v1").WithCnf(64).Build(); err == nil {
+		t.Fatal("expected an error for a component before its requirements")
+	}
+	if _, err := circuitkit.New("twice/v1").WithJWS(16, 64).WithClaimReveal("given_name", 8).WithClaimReveal("given_name", 8).Build(); err == nil {
+		t.Fatal("expected an error for a duplicate input")
+	}
+
+	spec, err := circuitkit.New("test-reveal/v1").WithJWS(16, 64).WithClaimReveal("given_name", 8).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := spec.Schema()
+	if len(schema.Components) != 2 || !schema.Inputs[0].Public || schema.Inputs[len(schema.Inputs)-1].Public {
+		t.Fatalf("unexpected schema %+v", schema)
+	}
+	data, err := json.Marshal(spec)
+	if err != nil || !strings.Contains(string(data), `"name":"claim.given_name.value","kind":"bytes","size":8,"public":true`) {
+		t.Fatalf("unexpected schema %s: %v", data, err)
+	}
+
+	circuitkit.Register(spec)
+	if found, err := circuitkit.Lookup("test-reveal/v1"); err != nil || found != spec {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if ids := circuitkit.Registered(); len(ids) != 1 || ids[0] != "test-reveal/v1" {
+		t.Fatalf("unexpected registered circuits %v", ids)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic on duplicate registration")
+		}
+	}()
+	circuitkit.Register(spec)
+}
+
+func TestClaimReveal(t *testing.T) {
+	issuerKey := mockKey(t)
+	jws := mockJWS(t, issuerKey, map[string]string{"alg": "ES256"},
+		map[string]string{"given_name": "Erika", "family_name": "Muller", "nationality": "DE"})
+	protectedSize, payloadSize := partSizes(jws)
+
+	spec, err := circuitkit.New("test-reveal-name/v1").
+		WithJWS(protectedSize, payloadSize).
+		WithClaimReveal("family_name", 12).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignment, err := spec.Assign(&circuitkit.Artifacts{JWS: jws, IssuerKey: &issuerKey.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err != nil {
+		t.Fatal(err)
+	}
+
+	// another revealed value
+	if err := assignment.SetBytes("claim.family_name.value", []byte("Mullet")); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err == nil {
+		t.Fatal("expected another value to fail")
+	}
+
+	if err := assignment.SetBytes("jws.payload", []byte("short")); err == nil {
+		t.Fatal("expected an error for a short fixed-size input")
+	}
+	if err := assignment.SetVariable("jws.payload", 1); err == nil {
+		t.Fatal("expected an error for a wrong kind")
+	}
+}
+
+func TestSizeBuckets(t *testing.T) {
+	issuerKey := mockKey(t)
+	jws := mockJWS(t, issuerKey, map[string]string{"alg": "ES256"},
+		map[string]string{"given_name": "Erika", "family_name": "Muller", "nationality": "DE"})
+	protectedSize, payloadSize := partSizes(jws)
+
+	spec, err := circuitkit.New("test-reveal-bucket/v1").
+		WithJWS(protectedSize, payloadSize).
+		WithClaimReveal("family_name", 12).
+		WithSizeBuckets(common.DefaultSizeBuckets).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := spec.Schema()
+	for _, in := range schema.Inputs {
+		if in.Name == "claim.family_name.value" && in.Size != 16 {
+			t.Fatalf("value padded to %d bytes, expected the bucket of 16", in.Size)
+		}
+	}
+	if len(schema.SizeBuckets) != len(common.DefaultSizeBuckets) {
+		t.Fatalf("unexpected schema buckets %v", schema.SizeBuckets)
+	}
+	assignment, err := spec.Assign(&circuitkit.Artifacts{JWS: jws, IssuerKey: &issuerKey.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a component padding outside the buckets
+	custom := &circuitkit.ClaimReveal{Claim: "nationality", MaxLen: 12, SegmentLen: 32}
+	if _, err := circuitkit.New("test-unbucketed/v1").WithJWS(protectedSize, payloadSize).With(unbucketed{custom}).WithSizeBuckets(common.DefaultSizeBuckets).Build(); err == nil {
+		t.Fatal("expected an error for a public input outside the buckets")
+	}
+	if _, err := circuitkit.New("test-buckets/v1").WithJWS(protectedSize, payloadSize).WithSizeBuckets(common.SizeBuckets{64, 32}).Build(); err == nil {
+		t.Fatal("expected an error for decreasing buckets")
+	}
+}
+
+// unbucketed hides the Bucketed implementation of its component
+type unbucketed struct{ *circuitkit.ClaimReveal }
+
+func (u unbucketed) Bucket() {}
+
+func TestClaimCommitment(t *testing.T) {
+	issuerKey := mockKey(t)
+	jws := mockJWS(t, issuerKey, map[string]string{"alg": "ES256"},
+		map[string]string{"given_name": "Erika", "family_name": "Muller", "nationality": "DE"})
+	protectedSize, payloadSize := partSizes(jws)
+
+	spec, err := circuitkit.New("test-commit-name/v1").
+		WithJWS(protectedSize, payloadSize).
+		WithClaimCommitment("family_name", 12).
+		WithDecoys(2).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range spec.Schema().Inputs {
+		if in.Name == "claim.family_name.value" && in.Public {
+			t.Fatal("committed value must be secret")
+		}
+	}
+
+	artifacts := &circuitkit.Artifacts{JWS: jws, IssuerKey: &issuerKey.PublicKey}
+	assignment, err := spec.Assign(artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err != nil {
+		t.Fatal(err)
+	}
+	openings := assignment.Openings()
+	if len(openings) != 1 || openings[0].Name != "family_name" || openings[0].Value != "Muller" {
+		t.Fatalf("unexpected openings %+v", openings)
+	}
+
+	// fresh salts: two presentations do not share commitments
+	other, err := spec.Assign(artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(other.Openings()[0].Commitment()) == string(openings[0].Commitment()) {
+		t.Fatal("expected fresh commitments")
+	}
+
+	// a commitment to another value
+	mallory := openings[0]
+	mallory.Value = "Mullet"
+	if err := assignment.SetCommitment("claim.family_name.commitment", mallory.Commitment()); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err == nil {
+		t.Fatal("expected another commitment to fail")
+	}
+}
+
+func TestCertChainCnf(t *testing.T) {
+	anchorKey, intermediateKey, holderKey, issuerKey := mockKey(t), mockKey(t), mockKey(t), mockKey(t)
+	anchor := mockCert(t, anchorKey, nil, nil, 1)
+	intermediate := mockCert(t, intermediateKey, anchor, anchorKey, 2)
+	holder := mockCert(t, holderKey, intermediate, intermediateKey, 3)
+
+	holderKeyDigest := sha256.Sum256(elliptic.Marshal(elliptic.P256(), holderKey.X, holderKey.Y))
+	jws := mockJWS(t, issuerKey,
+		map[string]any{"alg": "ES256", "cnf": map[string]string{"kid": hex.EncodeToString(holderKeyDigest[:])}},
+		map[string]string{"sub": "1234567890"})
+	protectedSize, payloadSize := partSizes(jws)
+
+	spec, err := circuitkit.New("test-bound/v1").
+		WithJWS(protectedSize, payloadSize).
+		WithCertChain(len(holder.RawTBSCertificate), len(intermediate.RawTBSCertificate)).
+		WithCnf(108).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifacts := &circuitkit.Artifacts{
+		JWS:         jws,
+		IssuerKey:   &issuerKey.PublicKey,
+		Chain:       [][]byte{holder.Raw, intermediate.Raw},
+		TrustAnchor: &anchorKey.PublicKey,
+	}
+	assignment, err := spec.Assign(artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the chain must end at the trust anchor
+	artifacts.TrustAnchor = &intermediateKey.PublicKey
+	if assignment, err = spec.Assign(artifacts); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err == nil {
+		t.Fatal("expected another trust anchor to fail")
+	}
+}
+
+func TestNotRevoked(t *testing.T) {
+	anchorKey, holderKey := mockKey(t), mockKey(t)
+	anchor := mockCert(t, anchorKey, nil, nil, 1)
+	holder := mockCert(t, holderKey, anchor, anchorKey, 12345)
+
+	crl := func(revoked ...int64) []byte {
+		list := &x509.RevocationList{Number: big.NewInt(1), ThisUpdate: time.Now().Add(-time.Hour), NextUpdate: time.Now().Add(time.Hour)}
+		for _, serial := range revoked {
+			list.RevokedCertificateEntries = append(list.RevokedCertificateEntries, x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+		}
+		der, err := x509.CreateRevocationList(rand.Reader, list, anchor, anchorKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+
+	spec, err := circuitkit.New("test-not-revoked/v1").
+		WithCertChain(len(holder.RawTBSCertificate)).
+		WithNotRevoked(512, 2).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params := spec.Schema().Params["crl"]; params["max_entries"] != cdl.DefaultCRLMaxEntries || params["stride"] != cdl.DefaultCRLStride {
+		t.Fatalf("unexpected schema params %v", params)
+	}
+	artifacts := &circuitkit.Artifacts{
+		Chain:       [][]byte{holder.Raw},
+		TrustAnchor: &anchorKey.PublicKey,
+		CRL:         crl(1111, 2222),
+		Now:         time.Now(),
+	}
+	assignment, err := spec.Assign(artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err != nil {
+		t.Fatal(err)
+	}
+
+	artifacts.CRL = crl(1111, 12345)
+	if assignment, err = spec.Assign(artifacts); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err == nil {
+		t.Fatal("expected a revoked certificate to fail")
+	}
+
+	// the status is a public input: the revoked certificate is proven revoked
+	spec, err = circuitkit.New("test-revocation-status/v1").
+		WithCertChain(len(holder.RawTBSCertificate)).
+		WithRevocationStatus(512, 2).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		crl    []byte
+		status int
+	}{
+		{crl(1111, 2222), cdl.CRLStatusNotRevoked},
+		{crl(1111, 12345), cdl.CRLStatusRevoked},
+	} {
+		artifacts.CRL = tc.crl
+		if assignment, err = spec.Assign(artifacts); err != nil {
+			t.Fatal(err)
+		}
+		if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err != nil {
+			t.Fatal(err)
+		}
+		if status := assignment.Circuit().PublicVariables[len(assignment.Circuit().PublicVariables)-1]; status != tc.status {
+			t.Fatalf("unexpected status %v, expected %d", status, tc.status)
+		}
+
+		// the other status does not satisfy the circuit
+		if err := assignment.SetVariable("crl.status", 1-tc.status); err != nil {
+			t.Fatal(err)
+		}
+		if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err == nil {
+			t.Fatalf("expected status %d to fail", 1-tc.status)
+		}
+	}
+}
+
+func TestAssignDeterministic(t *testing.T) {
+	anchorKey, holderKey, issuerKey := mockKey(t), mockKey(t), mockKey(t)
+	anchor := mockCert(t, anchorKey, nil, nil, 1)
+	holder := mockCert(t, holderKey, anchor, anchorKey, 12345)
+	holderKeyDigest := sha256.Sum256(elliptic.Marshal(elliptic.P256(), holderKey.X, holderKey.Y))
+	jws := mockJWS(t, issuerKey,
+		map[string]any{"alg": "ES256", "cnf": map[string]string{"kid": hex.EncodeToString(holderKeyDigest[:])}},
+		map[string]string{"sub": "1234567890"})
+	protectedSize, payloadSize := partSizes(jws)
+	list := &x509.RevocationList{Number: big.NewInt(1), ThisUpdate: time.Now().Add(-time.Hour), NextUpdate: time.Now().Add(time.Hour)}
+	crl, err := x509.CreateRevocationList(rand.Reader, list, anchor, anchorKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := circuitkit.New("test-concurrent/v1").
+		WithJWS(protectedSize, payloadSize).
+		WithCertChain(len(holder.RawTBSCertificate)).
+		WithCnf(108).
+		WithNotRevoked(512, 2).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts := &circuitkit.Artifacts{
+		JWS:         jws,
+		IssuerKey:   &issuerKey.PublicKey,
+		Chain:       [][]byte{holder.Raw},
+		TrustAnchor: &anchorKey.PublicKey,
+		CRL:         crl,
+		Now:         time.Now(),
+	}
+
+	// the components are assigned concurrently, the witness is the same
+	var first []byte
+	for range 8 {
+		assignment, err := spec.Assign(artifacts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := frontend.NewWitness(assignment.Circuit(), ecc.BN254.ScalarField())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := w.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = data
+		} else if !bytes.Equal(data, first) {
+			t.Fatal("witness depends on the scheduling")
+		}
+	}
+
+	// the error is the one of the first failing component
+	for range 8 {
+		_, err := spec.Assign(&circuitkit.Artifacts{JWS: "a.b"})
+		if err == nil || !strings.HasPrefix(err.Error(), "jws: ") {
+			t.Fatalf("expected the error of the jws component, got %v", err)
+		}
+	}
+}
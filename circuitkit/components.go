@@ -0,0 +1,571 @@
+package circuitkit
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/consensys/gnark/frontend"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// WithJWS verifies the ES256 signature of a JWS credential with the issuer
+// key (public input). The protected header and the payload are secret inputs
+// of exactly protectedSize and payloadSize base64url bytes.
+func (b *Builder) WithJWS(protectedSize, payloadSize int) *Builder {
+	return b.With(&JWS{ProtectedSize: protectedSize, PayloadSize: payloadSize})
+}
+
+// WithCertChain verifies a chain of certificates from the holder certificate
+// to a trust anchor (public input), one TBSCertificate size per certificate,
+// holder first. The certificates and the intermediate keys are secret.
+func (b *Builder) WithCertChain(tbsSizes ...int) *Builder {
+	return b.With(&CertChain{TBSSizes: tbsSizes})
+}
+
+// WithCnf binds the JWS to the holder key: the cnf claim of the protected
+// header holds the digest of the key of the certificate chain. size is the
+// length of the base64url segment from the aligned cnf claim, 108 for a cnf
+// holding only the kid.
+func (b *Builder) WithCnf(size int) *Builder {
+	return b.With(&Cnf{Size: size})
+}
+
+// WithClaimReveal reveals the string value of a top-level claim of the JWS
+// payload of at most maxLen bytes as public input. Nested claims are not
+// supported.
+func (b *Builder) WithClaimReveal(claim string, maxLen int) *Builder {
+	return b.With(NewClaimReveal(claim, maxLen))
+}
+
+// WithClaimCommitment commits to the string value of a top-level claim of the
+// JWS payload of at most maxLen bytes with a fresh salt
+// (common.ClaimCommitment), instead of revealing it: the commitment is public,
+// the value and the salt secret. The holder opens it with
+// Assignment.Openings.
+func (b *Builder) WithClaimCommitment(claim string, maxLen int) *Builder {
+	c := NewClaimReveal(claim, maxLen)
+	c.SaltSize = common.MinClaimSaltSize
+	return b.With(c)
+}
+
+// WithDecoys adds n decoy commitments (common.DecoyCommitment) after the claim
+// commitments, so the public witness does not tell how many claims are
+// committed
+func (b *Builder) WithDecoys(n int) *Builder {
+	return b.With(&Decoys{N: n, SaltSize: common.MinClaimSaltSize})
+}
+
+// WithNotRevoked checks that the holder certificate is not in a CRL (public
+// input of at most crlSize bytes, its signature is verified outside the
+// circuit) that is fresh at the verifier time. maxSerialLen is the maximal
+// length of the serial number of the holder certificate, in DER content bytes
+// (with its sign byte, at most 20). The CRL lists at most
+// cdl.DefaultCRLMaxEntries revoked certificates, see NotRevoked for other
+// scan parameters.
+func (b *Builder) WithNotRevoked(crlSize, maxSerialLen int) *Builder {
+	return b.With(&NotRevoked{CRLSize: crlSize, MaxSerialLen: maxSerialLen})
+}
+
+// WithRevocationStatus proves the revocation status of the holder certificate
+// in the CRL as WithNotRevoked, but exposes it as the public input crl.status
+// (cdl.CRLStatusNotRevoked or cdl.CRLStatusRevoked) instead of asserting it
+// is not revoked, so a verifier can request either outcome (e.g. a card
+// reported lost). The status is assigned from the CRL.
+func (b *Builder) WithRevocationStatus(crlSize, maxSerialLen int) *Builder {
+	return b.With(&NotRevoked{CRLSize: crlSize, MaxSerialLen: maxSerialLen, PublicStatus: true})
+}
+
+// JWS is the component of WithJWS
+type JWS struct {
+	ProtectedSize, PayloadSize int
+}
+
+// Name implements Component
+func (c *JWS) Name() string { return "jws" }
+
+// Requires implements Component
+func (c *JWS) Requires() []string { return nil }
+
+// Inputs implements Component
+func (c *JWS) Inputs() []Input {
+	return []Input{
+		{Name: "jws.protected", Kind: KindBytes, Size: c.ProtectedSize, Doc: "base64url protected header"},
+		{Name: "jws.payload", Kind: KindBytes, Size: c.PayloadSize, Doc: "base64url payload"},
+		{Name: "jws.signature_r", Kind: KindFr},
+		{Name: "jws.signature_s", Kind: KindFr},
+		{Name: "jws.issuer_x", Kind: KindFp, Public: true, Doc: "issuer public key"},
+		{Name: "jws.issuer_y", Kind: KindFp, Public: true},
+	}
+}
+
+// Define implements Component
+func (c *JWS) Define(api frontend.API, ctx *Context) error {
+	ctx.Protected, ctx.Payload = ctx.Bytes("jws.protected"), ctx.Bytes("jws.payload")
+	issuer := curves.NewPublicKey(ctx.Fp("jws.issuer_x"), ctx.Fp("jws.issuer_y"))
+	signature := curves.NewSignature(ctx.Fr("jws.signature_r"), ctx.Fr("jws.signature_s"))
+	return common.VerifyJWS(api, ctx.Protected, ctx.Payload, issuer, signature)
+}
+
+// Assign implements Component
+func (c *JWS) Assign(a *Assignment, artifacts *Artifacts) error {
+	parts := strings.Split(artifacts.JWS, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("expected 3 parts, got %d", len(parts))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return fmt.Errorf("invalid ES256 signature")
+	}
+	if err := a.SetBytes("jws.protected", []byte(parts[0])); err != nil {
+		return err
+	}
+	if err := a.SetBytes("jws.payload", []byte(parts[1])); err != nil {
+		return err
+	}
+	if err := a.setSignature("jws.signature", new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])); err != nil {
+		return err
+	}
+	return a.setKey("jws.issuer", artifacts.IssuerKey)
+}
+
+// CertChain is the component of WithCertChain
+type CertChain struct {
+	TBSSizes []int
+}
+
+// Name implements Component
+func (c *CertChain) Name() string { return "cert-chain" }
+
+// Requires implements Component
+func (c *CertChain) Requires() []string { return nil }
+
+func certInput(i int, name string) string {
+	return fmt.Sprintf("cert-chain.%d.%s", i, name)
+}
+
+// Inputs implements Component
+func (c *CertChain) Inputs() []Input {
+	var inputs []Input
+	for i, size := range c.TBSSizes {
+		inputs = append(inputs,
+			Input{Name: certInput(i, "tbs"), Kind: KindBytes, Size: size, Doc: "TBSCertificate"},
+			Input{Name: certInput(i, "signature_r"), Kind: KindFr},
+			Input{Name: certInput(i, "signature_s"), Kind: KindFr},
+			Input{Name: certInput(i, "key_x"), Kind: KindFp, Doc: "subject public key"},
+			Input{Name: certInput(i, "key_y"), Kind: KindFp},
+		)
+	}
+	return append(inputs,
+		Input{Name: "cert-chain.anchor_x", Kind: KindFp, Public: true, Doc: "trust anchor public key"},
+		Input{Name: "cert-chain.anchor_y", Kind: KindFp, Public: true},
+	)
+}
+
+// Define implements Component
+func (c *CertChain) Define(api frontend.API, ctx *Context) error {
+	if len(c.TBSSizes) == 0 {
+		return fmt.Errorf("empty chain")
+	}
+
+	// from the anchor down to the holder certificate
+	signer := curves.NewPublicKey(ctx.Fp("cert-chain.anchor_x"), ctx.Fp("cert-chain.anchor_y"))
+	for i := len(c.TBSSizes) - 1; i >= 0; i-- {
+		key := curves.NewPublicKey(ctx.Fp(certInput(i, "key_x")), ctx.Fp(certInput(i, "key_y")))
+		signature := curves.NewSignature(ctx.Fr(certInput(i, "signature_r")), ctx.Fr(certInput(i, "signature_s")))
+		if err := cdl.VerifyCertifiedKey(api, ctx.Bytes(certInput(i, "tbs")), key, signer, signature); err != nil {
+			return err
+		}
+		signer = key
+	}
+	ctx.HolderKey, ctx.HolderTBS = &signer, ctx.Bytes(certInput(0, "tbs"))
+	return nil
+}
+
+// Assign implements Component
+func (c *CertChain) Assign(a *Assignment, artifacts *Artifacts) error {
+	if len(artifacts.Chain) != len(c.TBSSizes) {
+		return fmt.Errorf("chain of %d certificates, expected %d", len(artifacts.Chain), len(c.TBSSizes))
+	}
+	for i, der := range artifacts.Chain {
+		cert, key, r, s, err := certificateKey(der)
+		if err != nil {
+			return fmt.Errorf("certificate %d: %w", i, err)
+		}
+		if err := a.SetBytes(certInput(i, "tbs"), cert.RawTBSCertificate); err != nil {
+			return err
+		}
+		if err := a.setSignature(certInput(i, "signature"), r, s); err != nil {
+			return err
+		}
+		if err := a.setKey(certInput(i, "key"), key); err != nil {
+			return err
+		}
+	}
+	return a.setKey("cert-chain.anchor", artifacts.TrustAnchor)
+}
+
+// Cnf is the component of WithCnf
+type Cnf struct {
+	Size int
+}
+
+// Name implements Component
+func (c *Cnf) Name() string { return "cnf" }
+
+// Requires implements Component
+func (c *Cnf) Requires() []string { return []string{"jws", "cert-chain"} }
+
+// Inputs implements Component
+func (c *Cnf) Inputs() []Input {
+	return []Input{
+		{Name: "cnf.segment", Kind: KindBytes, Size: c.Size, Doc: "base64url segment of the protected header holding cnf"},
+		{Name: "cnf.segment_position", Kind: KindVariable},
+		{Name: "cnf.key_hex_position", Kind: KindVariable},
+	}
+}
+
+// Define implements Component
+func (c *Cnf) Define(api frontend.API, ctx *Context) error {
+	digest := common.PublicKeyDigest(api, ctx.HolderKey.X, ctx.HolderKey.Y)
+	return common.VerifyCnf(api, ctx.Protected, ctx.Bytes("cnf.segment"),
+		ctx.Variable("cnf.segment_position"), ctx.Variable("cnf.key_hex_position"), digest)
+}
+
+// Assign implements Component
+func (c *Cnf) Assign(a *Assignment, artifacts *Artifacts) error {
+	pos, err := (&common.Preprocessor{}).Process(common.CredentialArtifacts{JWS: artifacts.JWS})
+	if err != nil {
+		return err
+	}
+	if pos.Cnf == nil {
+		return fmt.Errorf("the protected header has no cnf")
+	}
+	// the segment starts at the aligned cnf and spans Size bytes
+	if pos.Cnf.B64Start+c.Size > len(pos.ProtectedB64) || c.Size < len(pos.Cnf.B64) {
+		return fmt.Errorf("segment of %d bytes at %d does not fit the header or the cnf", c.Size, pos.Cnf.B64Start)
+	}
+	if err := a.SetBytes("cnf.segment", []byte(pos.ProtectedB64[pos.Cnf.B64Start:pos.Cnf.B64Start+c.Size])); err != nil {
+		return err
+	}
+	if err := a.SetVariable("cnf.segment_position", pos.Cnf.B64Start); err != nil {
+		return err
+	}
+	return a.SetVariable("cnf.key_hex_position", pos.CnfKeyHexPosition)
+}
+
+// ClaimReveal is the component of WithClaimReveal
+type ClaimReveal struct {
+	Claim      string
+	MaxLen     int // longest value, in bytes
+	SegmentLen int // base64url segment length, multiple of 4
+	// Unescape reveals the value with its JSON escapes decoded
+	// (common.GetEscapedStringValueUpTo), MaxLen then bounds the escaped value
+	Unescape bool
+	// SaltSize commits to the value with a salt of SaltSize bytes instead of
+	// revealing it, when not 0
+	SaltSize int
+}
+
+// NewClaimReveal returns the component revealing claim values of at most
+// maxLen bytes, with a segment long enough for the claim at any base64url
+// alignment
+func NewClaimReveal(claim string, maxLen int) *ClaimReveal {
+	// "claim":"value" and up to 2 bytes of alignment
+	jsonLen := len(claim) + 4 + maxLen + 1 + 2
+	return &ClaimReveal{Claim: claim, MaxLen: maxLen, SegmentLen: 4 * ((jsonLen + 2) / 3)}
+}
+
+// Name implements Component
+func (c *ClaimReveal) Name() string { return "claim." + c.Claim }
+
+// Requires implements Component
+func (c *ClaimReveal) Requires() []string { return []string{"jws"} }
+
+// Inputs implements Component
+func (c *ClaimReveal) Inputs() []Input {
+	public := c.SaltSize == 0
+	inputs := []Input{
+		{Name: c.Name() + ".segment", Kind: KindBytes, Size: c.SegmentLen, Doc: "base64url segment of the payload holding the claim"},
+		{Name: c.Name() + ".segment_position", Kind: KindVariable},
+		{Name: c.Name() + ".value_position", Kind: KindVariable},
+		{Name: c.Name() + ".value", Kind: KindBytes, Size: c.MaxLen, Public: public, Padded: true, Doc: "claim value, zero padded"},
+		{Name: c.Name() + ".length", Kind: KindVariable, Public: public, Doc: "claim value length"},
+	}
+	if !public {
+		inputs = append(inputs,
+			Input{Name: c.Name() + ".salt", Kind: KindBytes, Size: c.SaltSize, Doc: "commitment salt, fresh per presentation"},
+			Input{Name: c.Name() + ".commitment", Kind: KindCommitment, Public: true, Doc: "salted commitment of the claim value"},
+		)
+	}
+	return inputs
+}
+
+// Define implements Component
+func (c *ClaimReveal) Define(api frontend.API, ctx *Context) error {
+	if c.Claim == "" || strings.ContainsAny(c.Claim, `./"`) {
+		return fmt.Errorf("only top-level claims can be revealed, got %q", c.Claim)
+	}
+	if c.SegmentLen%4 != 0 {
+		return fmt.Errorf("segment length %d is not a multiple of 4", c.SegmentLen)
+	}
+
+	// The segment is in the payload and decodes to the same bytes
+	segment, segmentPosition := ctx.Bytes(c.Name()+".segment"), ctx.Variable(c.Name()+".segment_position")
+	if err := common.MustSubset(api, ctx.Payload, segment, segmentPosition); err != nil {
+		return err
+	}
+	if err := common.AssertB64Aligned(api, len(ctx.Payload), len(segment), segmentPosition); err != nil {
+		return err
+	}
+	decoded, err := common.DecodeBase64Url(api, segment)
+	if err != nil {
+		return err
+	}
+
+	// "claim":"value", zero padded
+	getValue := common.GetStringValueUpTo
+	if c.Unescape {
+		getValue = common.GetEscapedStringValueUpTo
+	}
+	value, length := getValue(api, decoded, ctx.Variable(c.Name()+".value_position"), common.ClaimKey(c.Claim), c.MaxLen)
+	common.AssertBytesEqual(api, value, ctx.Bytes(c.Name()+".value"), "%s value", c.Name())
+	common.AssertEqual(api, length, ctx.Variable(c.Name()+".length"), "%s length", c.Name())
+	if c.SaltSize == 0 {
+		return nil
+	}
+
+	commitment, err := common.ClaimCommitment(api, ctx.Bytes(c.Name()+".salt"), c.Claim, value, length)
+	if err != nil {
+		return err
+	}
+	common.AssertEqual(api, commitment, ctx.Commitment(c.Name()+".commitment"), "%s commitment", c.Name())
+	return nil
+}
+
+// Assign implements Component
+func (c *ClaimReveal) Assign(a *Assignment, artifacts *Artifacts) error {
+	parts := strings.Split(artifacts.JWS, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("expected 3 parts, got %d", len(parts))
+	}
+	payloadB64 := parts[1]
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(payloadB64)
+	if err != nil {
+		return fmt.Errorf("payload: %w", err)
+	}
+
+	claim, err := common.FindClaim(payloadJSON, payloadB64, c.Claim)
+	if err != nil {
+		return err
+	}
+	value, rawLen, err := claim.StringValue()
+	if err != nil {
+		return fmt.Errorf("claim %q: %w", c.Claim, err)
+	}
+	// escapes are longer than the bytes they stand for
+	if rawLen > c.MaxLen || (!c.Unescape && rawLen != len(value)) {
+		return fmt.Errorf("claim %q is longer than %d bytes or escaped", c.Claim, c.MaxLen)
+	}
+	if claim.B64Start+c.SegmentLen > len(payloadB64) {
+		return fmt.Errorf("segment of %d bytes at %d exceeds the payload", c.SegmentLen, claim.B64Start)
+	}
+
+	if err := a.SetBytes(c.Name()+".segment", []byte(payloadB64[claim.B64Start:claim.B64Start+c.SegmentLen])); err != nil {
+		return err
+	}
+	if err := a.SetVariable(c.Name()+".segment_position", claim.B64Start); err != nil {
+		return err
+	}
+	if err := a.SetVariable(c.Name()+".value_position", claim.ValuePosition); err != nil {
+		return err
+	}
+	if err := a.SetBytes(c.Name()+".value", []byte(value)); err != nil {
+		return err
+	}
+	if err := a.SetVariable(c.Name()+".length", len(value)); err != nil {
+		return err
+	}
+	if c.SaltSize == 0 {
+		return nil
+	}
+
+	opening, err := models.NewClaimOpening(c.Claim, value, c.SaltSize)
+	if err != nil {
+		return err
+	}
+	if err := a.SetBytes(c.Name()+".salt", opening.Salt); err != nil {
+		return err
+	}
+	if err := a.SetCommitment(c.Name()+".commitment", opening.Commitment()); err != nil {
+		return err
+	}
+	a.openings = append(a.openings, opening)
+	return nil
+}
+
+// Decoys is the component of WithDecoys
+type Decoys struct {
+	N        int
+	SaltSize int
+}
+
+// Name implements Component
+func (c *Decoys) Name() string { return "decoys" }
+
+// Requires implements Component
+func (c *Decoys) Requires() []string { return nil }
+
+// Inputs implements Component
+func (c *Decoys) Inputs() []Input {
+	var inputs []Input
+	for i := range c.N {
+		inputs = append(inputs,
+			Input{Name: fmt.Sprintf("decoys.%d.salt", i), Kind: KindBytes, Size: c.SaltSize},
+			Input{Name: fmt.Sprintf("decoys.%d.commitment", i), Kind: KindCommitment, Public: true},
+		)
+	}
+	return inputs
+}
+
+// Define implements Component
+func (c *Decoys) Define(api frontend.API, ctx *Context) error {
+	if c.N <= 0 {
+		return fmt.Errorf("no decoys")
+	}
+	for i := range c.N {
+		commitment, err := common.DecoyCommitment(api, ctx.Bytes(fmt.Sprintf("decoys.%d.salt", i)))
+		if err != nil {
+			return err
+		}
+		common.AssertEqual(api, commitment, ctx.Commitment(fmt.Sprintf("decoys.%d.commitment", i)), "decoy %d commitment", i)
+	}
+	return nil
+}
+
+// Assign implements Component
+func (c *Decoys) Assign(a *Assignment, artifacts *Artifacts) error {
+	for i := range c.N {
+		salt, commitment, err := models.NewDecoyCommitment(c.SaltSize)
+		if err != nil {
+			return err
+		}
+		if err := a.SetBytes(fmt.Sprintf("decoys.%d.salt", i), salt); err != nil {
+			return err
+		}
+		if err := a.SetCommitment(fmt.Sprintf("decoys.%d.commitment", i), commitment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotRevoked is the component of WithNotRevoked and WithRevocationStatus
+type NotRevoked struct {
+	CRLSize, MaxSerialLen int
+	// MaxEntries and Stride are the scan parameters of the revoked
+	// certificates (cdl.CRLScan), the defaults when 0
+	MaxEntries, Stride int
+	// PublicStatus exposes the revocation status as crl.status instead of
+	// asserting cdl.CRLStatusNotRevoked
+	PublicStatus bool
+}
+
+// Name implements Component
+func (c *NotRevoked) Name() string { return "crl" }
+
+// Requires implements Component
+func (c *NotRevoked) Requires() []string { return []string{"cert-chain"} }
+
+// Params implements Parameterized, with the defaults of the scan parameters
+// set
+func (c *NotRevoked) Params() map[string]int {
+	maxEntries, stride := c.MaxEntries, c.Stride
+	if maxEntries == 0 {
+		maxEntries = cdl.DefaultCRLMaxEntries
+	}
+	if stride == 0 {
+		stride = cdl.DefaultCRLStride
+	}
+	return map[string]int{"max_serial_len": c.MaxSerialLen, "max_entries": maxEntries, "stride": stride}
+}
+
+// Inputs implements Component
+func (c *NotRevoked) Inputs() []Input {
+	inputs := []Input{
+		{Name: "crl.der", Kind: KindBytes, Size: c.CRLSize, Public: true, Padded: true, Doc: "DER CRL, zero padded"},
+		{Name: "crl.now", Kind: KindBytes, Size: cdl.CRLTimeLen, Public: true, Doc: "verifier time, YYYYMMDDHHMMSS (UTC)"},
+	}
+	if c.PublicStatus {
+		inputs = append(inputs, Input{Name: "crl.status", Kind: KindVariable, Public: true, Doc: "revocation status, 0 not revoked, 1 revoked"})
+	}
+	return inputs
+}
+
+// Define implements Component
+func (c *NotRevoked) Define(api frontend.API, ctx *Context) error {
+	crl := ctx.Bytes("crl.der")
+	serial := cdl.ExtractSerialFromTBS(api, ctx.HolderTBS, c.MaxSerialLen)
+	thisUpdate, nextUpdate, revoked := cdl.NavigateToCRLUpdates(api, crl)
+	if err := cdl.AssertCRLFresh(api, crl, thisUpdate, nextUpdate, ctx.Bytes("crl.now")); err != nil {
+		return err
+	}
+	isRevoked, err := cdl.ScanRevokedCertificates(api, crl, revoked, serial, cdl.CRLScan{MaxEntries: c.MaxEntries, Stride: c.Stride})
+	if err != nil {
+		return err
+	}
+	if !c.PublicStatus {
+		common.AssertEqual(api, isRevoked, cdl.CRLStatusNotRevoked, "crl: certificate serial is not revoked")
+		return nil
+	}
+	status := ctx.Variable("crl.status")
+	api.AssertIsBoolean(status)
+	common.AssertEqual(api, isRevoked, status, "crl: certificate revocation status")
+	return nil
+}
+
+// Assign implements Component
+func (c *NotRevoked) Assign(a *Assignment, artifacts *Artifacts) error {
+	if len(artifacts.Chain) == 0 {
+		return fmt.Errorf("no holder certificate")
+	}
+	cert, _, _, _, err := certificateKey(artifacts.Chain[0])
+	if err != nil {
+		return err
+	}
+	// the serials are compared on their DER length, with the sign byte
+	serialLen := len(cert.SerialNumber.Bytes())
+	if serialLen == 0 || cert.SerialNumber.Bytes()[0]&0x80 != 0 {
+		serialLen++
+	}
+	if serialLen > c.MaxSerialLen {
+		return fmt.Errorf("serial number of %d bytes, expected at most %d", serialLen, c.MaxSerialLen)
+	}
+	if err := a.SetBytes("crl.der", artifacts.CRL); err != nil {
+		return err
+	}
+	if err := a.SetBytes("crl.now", cdl.FormatCRLTime(artifacts.Now)); err != nil {
+		return err
+	}
+	if !c.PublicStatus {
+		return nil
+	}
+
+	crl, err := x509.ParseRevocationList(artifacts.CRL)
+	if err != nil {
+		return err
+	}
+	status := cdl.CRLStatusNotRevoked
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			status = cdl.CRLStatusRevoked
+			break
+		}
+	}
+	return a.SetVariable("crl.status", status)
+}
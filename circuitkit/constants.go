@@ -0,0 +1,105 @@
+package circuitkit
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// Constant is an input baked in the circuit at compile time instead of a
+// witness: the expected typ of a credential, a fixed OID, a pinned issuer key.
+// The input is removed from the witness, the components read the constant
+// instead, and the verifying key is specific to the value, which the schema
+// records (Schema.Constants).
+type Constant struct {
+	Name string `json:"name"`
+	// Kind is the kind of the input, set by Build
+	Kind Kind `json:"kind"`
+	// Value are the bytes of a KindBytes input (zero padded to its size when
+	// Padded), the big-endian value of the other kinds
+	Value []byte `json:"value"`
+}
+
+// WithConstant bakes the input name with value at compile time, see Constant
+func (b *Builder) WithConstant(name string, value []byte) *Builder {
+	b.constants = append(b.constants, Constant{Name: name, Value: value})
+	return b
+}
+
+// WithConstants bakes the inputs of the constants, e.g. the constants
+// generated by zkpi constants generate
+func (b *Builder) WithConstants(constants ...Constant) *Builder {
+	for _, c := range constants {
+		b.WithConstant(c.Name, c.Value)
+	}
+	return b
+}
+
+// checkConstant validates the value of the constant of the input
+func checkConstant(in Input, value []byte) error {
+	switch in.Kind {
+	case KindBytes:
+		if len(value) > in.Size || (len(value) < in.Size && !in.Padded) {
+			return fmt.Errorf("constant %q: %d bytes, expected %d", in.Name, len(value), in.Size)
+		}
+	case KindVariable, KindFp, KindFr:
+		if len(value) > 32 {
+			return fmt.Errorf("constant %q: %d bytes, expected at most 32", in.Name, len(value))
+		}
+	default:
+		return fmt.Errorf("constant %q: a %s input cannot be a constant", in.Name, in.Kind)
+	}
+	return nil
+}
+
+// constantBytes returns the bytes of a KindBytes constant, zero padded
+func (s slot) constantBytes() []uints.U8 {
+	u8 := make([]uints.U8, s.input.Size)
+	for i := range u8 {
+		if i < len(s.value) {
+			u8[i] = uints.NewU8(s.value[i])
+		} else {
+			u8[i] = uints.NewU8(0)
+		}
+	}
+	return u8
+}
+
+// constantInt returns the value of a numeric constant
+func (s slot) constantInt() *big.Int {
+	return new(big.Int).SetBytes(s.value)
+}
+
+// matchBytes checks that an assigned byte string is the constant of the slot
+func (s slot) matchBytes(padded []byte) error {
+	if !bytes.Equal(padded, append(bytes.Clone(s.value), make([]byte, s.input.Size-len(s.value))...)) {
+		return fmt.Errorf("input %q is a constant of the circuit, another value is assigned", s.input.Name)
+	}
+	return nil
+}
+
+// matchInt checks that an assigned numeric value is the constant of the slot
+func (s slot) matchInt(v *big.Int) error {
+	if v == nil || v.Cmp(s.constantInt()) != 0 {
+		return fmt.Errorf("input %q is a constant of the circuit, another value is assigned", s.input.Name)
+	}
+	return nil
+}
+
+// variableInt returns the value assigned to a KindVariable input, nil when it
+// is not an integer
+func variableInt(v any) *big.Int {
+	switch v := v.(type) {
+	case *big.Int:
+		return v
+	case int:
+		return big.NewInt(int64(v))
+	case int64:
+		return big.NewInt(v)
+	case uint64:
+		return new(big.Int).SetUint64(v)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package circuitkit_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/circuitkit"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+func TestConstants(t *testing.T) {
+	issuerKey := mockKey(t)
+	jws := mockJWS(t, issuerKey, map[string]string{"alg": "ES256", "typ": "vc+sd-jwt"},
+		map[string]string{"given_name": "Erika", "family_name": "Muller", "nationality": "DE"})
+	protectedSize, payloadSize := partSizes(jws)
+	protected := strings.Split(jws, ".")[0]
+	artifacts := &circuitkit.Artifacts{JWS: jws, IssuerKey: &issuerKey.PublicKey}
+
+	build := func(id string, constants ...circuitkit.Constant) *circuitkit.Spec {
+		t.Helper()
+		spec, err := circuitkit.New(id).
+			WithJWS(protectedSize, payloadSize).
+			WithClaimReveal("family_name", 12).
+			WithConstants(constants...).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return spec
+	}
+	witnessSize := func(spec *circuitkit.Spec) int {
+		t.Helper()
+		assignment, err := spec.Assign(artifacts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := common.CheckWitness(spec.Circuit(), assignment.Circuit()); err != nil {
+			t.Fatal(err)
+		}
+		w, err := frontend.NewWitness(assignment.Circuit(), ecc.BN254.ScalarField())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w.Vector().(interface{ Len() int }).Len()
+	}
+
+	// the expected header and the pinned issuer key
+	constants := []circuitkit.Constant{
+		{Name: "jws.protected", Value: []byte(protected)},
+		{Name: "jws.issuer_x", Value: issuerKey.X.Bytes()},
+		{Name: "jws.issuer_y", Value: issuerKey.Y.Bytes()},
+	}
+	baked := build("test-constants/v1", constants...)
+	full, reduced := witnessSize(build("test-no-constants/v1")), witnessSize(baked)
+	// the header bytes and the 2 x 4 limbs of the key
+	if full-reduced != protectedSize+8 {
+		t.Fatalf("expected %d fewer witness elements, got %d and %d", protectedSize+8, full, reduced)
+	}
+	schema := baked.Schema()
+	if len(schema.Constants) != 3 || schema.Constants[0].Kind != circuitkit.KindBytes {
+		t.Fatalf("unexpected constants %+v", schema.Constants)
+	}
+	for _, in := range schema.Inputs {
+		if in.Name == "jws.protected" || in.Name == "jws.issuer_x" {
+			t.Fatalf("constant %s in the inputs", in.Name)
+		}
+	}
+
+	// a credential of another issuer
+	otherKey := mockKey(t)
+	other := mockJWS(t, otherKey, map[string]string{"alg": "ES256", "typ": "vc+sd-jwt"},
+		map[string]string{"given_name": "Erika", "family_name": "Muller", "nationality": "DE"})
+	if _, err := baked.Assign(&circuitkit.Artifacts{JWS: other, IssuerKey: &otherKey.PublicKey}); err == nil || !strings.Contains(err.Error(), "constant") {
+		t.Fatalf("expected a constant mismatch, got %v", err)
+	}
+
+	invalid := map[string]circuitkit.Constant{
+		"unknown input": {Name: "jws.typ", Value: []byte("vc")},
+		"size":          {Name: "jws.protected", Value: []byte("e30")},
+		"key size":      {Name: "jws.issuer_x", Value: make([]byte, 33)},
+	}
+	for name, c := range invalid {
+		if _, err := circuitkit.New("test-invalid/v1").WithJWS(protectedSize, payloadSize).WithConstants(c).Build(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := circuitkit.New("test-invalid/v1").WithJWS(protectedSize, payloadSize).WithConstants(constants[1], constants[1]).Build(); err == nil {
+		t.Error("expected an error for a duplicate constant")
+	}
+}
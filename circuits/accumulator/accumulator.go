@@ -0,0 +1,156 @@
+package cacc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+)
+
+// ErrRevoked is returned for a witness of a revoked serial
+var ErrRevoked = errors.New("accumulator: serial is revoked")
+
+// Accumulator is the issuer side of the accumulator revocation: a KZG
+// commitment (BN254) to the polynomial
+//
+//	P(X) = (X - r_1)(X - r_2)...(X - r_n)
+//
+// of the revoked serials r_i. A serial s is not revoked iff P(s) != 0, the
+// non-revocation witness of s is the opening proof of P at s: one G1 point and
+// the value P(s), whatever the number of revoked serials.
+//
+// The witnesses change with the accumulator, the issuer hands out the new
+// witnesses with each new Value. The SRS bounds the number of revoked serials
+// (Capacity) and must come from a ceremony: the owner of the SRS secret can
+// forge witnesses.
+type Accumulator struct {
+	srs *kzg.SRS
+	// poly are the coefficients of P, constant term first
+	poly    []fr.Element
+	revoked map[fr.Element]bool
+	value   kzg.Digest
+	// baseCRL and deltaCRL are the CRL numbers of the revocation set of the
+	// value (NewAccumulatorFromSet)
+	baseCRL, deltaCRL *big.Int
+}
+
+// NewAccumulator returns an empty accumulator, P(X) = 1
+func NewAccumulator(srs *kzg.SRS) (*Accumulator, error) {
+	a := &Accumulator{srs: srs, poly: []fr.Element{fr.One()}, revoked: map[fr.Element]bool{}}
+	if err := a.commit(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Capacity is the maximum number of revoked serials
+func (a *Accumulator) Capacity() int {
+	return len(a.srs.Pk.G1) - 1
+}
+
+// Revoke adds serials to the accumulator and updates its value, serials
+// already revoked are ignored
+func (a *Accumulator) Revoke(serials ...[]byte) error {
+	poly := append([]fr.Element(nil), a.poly...)
+	added := map[fr.Element]bool{}
+	for _, serial := range serials {
+		r, err := SerialElement(serial)
+		if err != nil {
+			return err
+		}
+		if a.revoked[r] || added[r] {
+			continue
+		}
+		if len(a.revoked)+len(added) == a.Capacity() {
+			return fmt.Errorf("accumulator: capacity of %d serials exceeded", a.Capacity())
+		}
+		added[r] = true
+
+		// P(X) * (X - r)
+		poly = append(poly, fr.Element{})
+		for i := len(poly) - 1; i >= 0; i-- {
+			var term fr.Element
+			term.Mul(&poly[i], &r)
+			if i > 0 {
+				poly[i].Sub(&poly[i-1], &term)
+			} else {
+				poly[i].Neg(&term)
+			}
+		}
+	}
+
+	prev := a.poly
+	a.poly = poly
+	if err := a.commit(); err != nil {
+		a.poly = prev
+		return err
+	}
+	for r := range added {
+		a.revoked[r] = true
+	}
+	a.baseCRL, a.deltaCRL = nil, nil
+	return nil
+}
+
+func (a *Accumulator) commit() error {
+	value, err := kzg.Commit(a.poly, a.srs.Pk)
+	if err != nil {
+		return fmt.Errorf("accumulator: %w", err)
+	}
+	a.value = value
+	return nil
+}
+
+// Value is the public accumulator value
+func (a *Accumulator) Value() kzg.Digest {
+	return a.value
+}
+
+// VerifyingKey is the public key the witnesses are verified with
+func (a *Accumulator) VerifyingKey() kzg.VerifyingKey {
+	return a.srs.Vk
+}
+
+// IsRevoked reports whether the serial is revoked
+func (a *Accumulator) IsRevoked(serial []byte) bool {
+	r, err := SerialElement(serial)
+	return err == nil && a.revoked[r]
+}
+
+// Witness returns the non-revocation witness of serial for the current value,
+// ErrRevoked when the serial is revoked
+func (a *Accumulator) Witness(serial []byte) (kzg.OpeningProof, error) {
+	s, err := SerialElement(serial)
+	if err != nil {
+		return kzg.OpeningProof{}, err
+	}
+	if a.revoked[s] {
+		return kzg.OpeningProof{}, ErrRevoked
+	}
+	return kzg.Open(a.poly, s, a.srs.Pk)
+}
+
+// SerialElement maps the bytes of a certificate serial (the content of the DER
+// INTEGER) to the accumulated field element, the big-endian integer of the
+// bytes
+func SerialElement(serial []byte) (fr.Element, error) {
+	n := new(big.Int).SetBytes(serial)
+	if len(serial) == 0 || n.Cmp(fr.Modulus()) >= 0 {
+		return fr.Element{}, fmt.Errorf("accumulator: invalid serial of %d bytes", len(serial))
+	}
+	var e fr.Element
+	e.SetBigInt(n)
+	return e, nil
+}
+
+// SerialBytes returns the content of the DER INTEGER of a positive serial
+// number, as read in the certificate
+func SerialBytes(serial *big.Int) []byte {
+	b := serial.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
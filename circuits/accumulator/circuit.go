@@ -0,0 +1,153 @@
+// Package cacc verifies the non-revocation of a certificate against a
+// cryptographic accumulator of the revoked serials: the witness and the
+// public inputs have a constant size, whatever the number of revoked
+// certificates (the CircuitCRL of package cdl grows with the CRL).
+package cacc
+
+import (
+	"crypto/x509"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	kzg_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/std/commitments/kzg"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// Commitment, Witness and VerifyingKey are the circuit values of the
+// accumulator value, of a non-revocation witness and of the SRS verifying key
+type (
+	Commitment   = kzg.Commitment[sw_bn254.G1Affine]
+	Witness      = kzg.OpeningProof[sw_bn254.ScalarField, sw_bn254.G1Affine]
+	VerifyingKey = kzg.VerifyingKey[sw_bn254.G1Affine, sw_bn254.G2Affine]
+)
+
+// CircuitAccumulator defines a ZK circuit that verifies
+// 1. The serial number of the certificate is not in the accumulator: the
+// witness opens the accumulated polynomial at the serial to a non-zero value
+// 2. The accumulator value and its verifying key are the public ones of the
+// issuer, the freshness of the value is checked by the verifier
+// 3. The proof is bound to the CRL numbers of the base and delta CRLs the
+// accumulator was built from (0 when not built from CRLs or without delta),
+// the verifier checks they are the ones of the value
+type CircuitAccumulator struct {
+	// public inputs
+	Accumulator    Commitment        `gnark:",public"`
+	VerifyingKey   VerifyingKey      `gnark:",public"`
+	BaseCRLNumber  frontend.Variable `gnark:",public"`
+	DeltaCRLNumber frontend.Variable `gnark:",public"`
+
+	// private inputs
+	CertBytes []uints.U8 `gnark:",secret"` // The certificate to check
+	Witness   Witness    `gnark:",secret"`
+
+	// Circuit parameters set at compile time
+	MaxSerialLen int `gnark:"-"` // Serial number length in bytes
+}
+
+// Define implements the gnark Circuit interface
+func (c *CircuitAccumulator) Define(api frontend.API) error {
+	// the CRL numbers are only bound, their range keeps them canonical
+	api.ToBinary(c.BaseCRLNumber, maxCRLNumberBits)
+	api.ToBinary(c.DeltaCRLNumber, maxCRLNumberBits)
+
+	// the serial is accumulated on its exact length (SerialBytes)
+	serial := cdl.ExtractSerialFromCert(api, c.CertBytes, c.MaxSerialLen)
+	common.AssertEqual(api, serial.Length, c.MaxSerialLen, "accumulator: serial number length")
+	return AssertNotRevoked(api, serial.Data, c.Accumulator, c.Witness, c.VerifyingKey)
+}
+
+// NewCircuitAccumulator creates a new accumulator revocation circuit for
+// certificates of maxCertSize bytes with serials of serialLen bytes
+func NewCircuitAccumulator(maxCertSize, serialLen int) *CircuitAccumulator {
+	return &CircuitAccumulator{
+		CertBytes:    make([]uints.U8, maxCertSize),
+		MaxSerialLen: serialLen,
+	}
+}
+
+// AssertNotRevoked asserts the serial (big-endian bytes, see SerialElement) is
+// not in the accumulator: the witness is a valid opening of the accumulator
+// at the serial, to a non-zero value
+func AssertNotRevoked(api frontend.API, serial []uints.U8, accumulator Commitment, witness Witness, vk VerifyingKey) error {
+	if len(serial) == 0 || 8*len(serial) >= fr.Bits {
+		return fmt.Errorf("accumulator: invalid serial length %d", len(serial))
+	}
+	scalarAPI, err := emulated.NewField[sw_bn254.ScalarField](api)
+	if err != nil {
+		return err
+	}
+	verifier, err := kzg.NewVerifier[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](api)
+	if err != nil {
+		return err
+	}
+
+	// serial as a field element, little-endian bits
+	bits := make([]frontend.Variable, 0, 8*len(serial))
+	for i := len(serial) - 1; i >= 0; i-- {
+		bits = append(bits, api.ToBinary(serial[i].Val, 8)...)
+	}
+	point := scalarAPI.FromBits(bits...)
+
+	if err := verifier.CheckOpeningProof(accumulator, witness, *point, vk); err != nil {
+		return fmt.Errorf("accumulator: %w", err)
+	}
+	common.AssertEqual(api, scalarAPI.IsZero(&witness.ClaimedValue), 0, "accumulator: certificate serial is not revoked")
+	return nil
+}
+
+// Assign returns the assignment of the circuit for a certificate, with the
+// current value of the accumulator and its CRL numbers. MaxSerialLen is the
+// length of the serial of cert.
+func (a *Accumulator) Assign(cert *x509.Certificate) (*CircuitAccumulator, error) {
+	witness, err := a.Witness(SerialBytes(cert.SerialNumber))
+	if err != nil {
+		return nil, err
+	}
+	accumulator, proof, vk, err := ValueOf(a.Value(), witness, a.VerifyingKey())
+	if err != nil {
+		return nil, err
+	}
+	base, delta := a.CRLNumbers()
+	return &CircuitAccumulator{
+		Accumulator:    accumulator,
+		VerifyingKey:   vk,
+		BaseCRLNumber:  crlNumber(base),
+		DeltaCRLNumber: crlNumber(delta),
+		CertBytes:      common.BytesToU8Array(cert.Raw),
+		Witness:        proof,
+		MaxSerialLen:   len(SerialBytes(cert.SerialNumber)),
+	}, nil
+}
+
+// ValueOf returns the circuit values of the accumulator value, the witness and
+// the verifying key
+func ValueOf(value kzg_bn254.Digest, witness kzg_bn254.OpeningProof, vk kzg_bn254.VerifyingKey) (Commitment, Witness, VerifyingKey, error) {
+	commitment, err := kzg.ValueOfCommitment[sw_bn254.G1Affine](value)
+	if err != nil {
+		return Commitment{}, Witness{}, VerifyingKey{}, err
+	}
+	proof, err := kzg.ValueOfOpeningProof[sw_bn254.ScalarField, sw_bn254.G1Affine](witness)
+	if err != nil {
+		return Commitment{}, Witness{}, VerifyingKey{}, err
+	}
+	key, err := kzg.ValueOfVerifyingKey[sw_bn254.G1Affine, sw_bn254.G2Affine](vk)
+	if err != nil {
+		return Commitment{}, Witness{}, VerifyingKey{}, err
+	}
+	return commitment, proof, key, nil
+}
+
+// crlNumber is the public input of a CRL number, 0 when absent
+func crlNumber(n *big.Int) frontend.Variable {
+	if n == nil {
+		return 0
+	}
+	return n
+}
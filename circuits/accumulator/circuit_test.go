@@ -0,0 +1,107 @@
+package cacc_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+	cacc "github.com/mynextid/eudi-zk/circuits/accumulator"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+func TestAccumulatorNotRevoked(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Certificate Authority"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(12345),
+		Subject:      pkix.Name{CommonName: "Test Certificate"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, caTemplate, &certKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// UNSAFE SRS, for tests only
+	alpha, err := rand.Int(rand.Reader, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs, err := kzg.NewSRS(8, alpha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := cacc.NewAccumulator(srs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := acc.Revoke(big.NewInt(1111).Bytes(), big.NewInt(2222).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	serial := cacc.SerialBytes(cert.SerialNumber)
+	circuit := cacc.NewCircuitAccumulator(len(certDER), len(serial))
+	assignment, err := acc.Assign(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuit, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// the witness of the previous value does not open the new one
+	if err := acc.Revoke(big.NewInt(3333).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	value, _, _, err := cacc.ValueOf(acc.Value(), kzg.OpeningProof{}, acc.VerifyingKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignment.Accumulator = value
+	if err := common.CheckWitness(circuit, assignment); err == nil {
+		t.Fatal("expected a stale witness to fail")
+	}
+
+	// revoked
+	if err := acc.Revoke(serial); err != nil {
+		t.Fatal(err)
+	}
+	if !acc.IsRevoked(serial) {
+		t.Fatal("expected the serial to be revoked")
+	}
+	if _, err := acc.Witness(serial); !errors.Is(err, cacc.ErrRevoked) {
+		t.Fatalf("expected ErrRevoked, got %v", err)
+	}
+	if err := acc.Revoke(big.NewInt(1).Bytes(), big.NewInt(2).Bytes(), big.NewInt(3).Bytes(), big.NewInt(4).Bytes()); err == nil {
+		t.Fatal("expected an error beyond the capacity")
+	}
+}
@@ -0,0 +1,162 @@
+package cacc
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+)
+
+// ErrCRLNumber is returned for a base and a delta CRL whose CRL numbers do
+// not chain
+var ErrCRLNumber = errors.New("crl: CRL numbers do not chain")
+
+// oidDeltaCRLIndicator is the deltaCRLIndicator extension of a delta CRL
+// (RFC 5280 §5.2.4), its value is the CRL number of the base CRL
+var oidDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+
+// reasonRemoveFromCRL is the reason code of a delta CRL entry removing a
+// serial of the base CRL, e.g. a certificate hold released (RFC 5280 §5.3.1)
+const reasonRemoveFromCRL = 8
+
+// maxCRLNumberBits bounds the CRL numbers, at most 20 octets (RFC 5280 §5.2.3)
+const maxCRLNumberBits = 160
+
+// RevocationSet is the canonical set of the revoked serials of an issuer, the
+// set the accumulator is built from (NewAccumulatorFromSet), merged from a
+// base CRL and its delta CRL (MergeCRL)
+type RevocationSet struct {
+	// BaseCRLNumber and DeltaCRLNumber identify the CRLs of the set,
+	// DeltaCRLNumber is nil for a base CRL alone
+	BaseCRLNumber  *big.Int
+	DeltaCRLNumber *big.Int
+	// Serials are the revoked serials, ascending and without duplicates
+	Serials []*big.Int
+}
+
+// MergeCRL merges a base CRL and its delta CRL (DER) into the revocation set
+// of the issuer, delta may be nil. Both CRLs must be signed by issuer and
+// carry a CRL number; the delta must apply to the base: its deltaCRLIndicator
+// is at most the base CRL number, and its own CRL number is past it. The
+// entries of the delta are added to the base, or remove their serial with
+// the removeFromCRL reason.
+func MergeCRL(issuer *x509.Certificate, base, delta []byte) (*RevocationSet, error) {
+	baseCRL, err := parseCRL(issuer, base)
+	if err != nil {
+		return nil, fmt.Errorf("crl: base: %w", err)
+	}
+	if _, ok, err := deltaIndicator(baseCRL); err != nil || ok {
+		return nil, fmt.Errorf("crl: base: is a delta CRL or has an invalid deltaCRLIndicator")
+	}
+
+	revoked := map[string]*big.Int{}
+	for _, entry := range baseCRL.RevokedCertificateEntries {
+		revoked[string(entry.SerialNumber.Bytes())] = entry.SerialNumber
+	}
+	set := &RevocationSet{BaseCRLNumber: baseCRL.Number}
+
+	if delta != nil {
+		deltaCRL, err := parseCRL(issuer, delta)
+		if err != nil {
+			return nil, fmt.Errorf("crl: delta: %w", err)
+		}
+		baseNumber, ok, err := deltaIndicator(deltaCRL)
+		if err != nil {
+			return nil, fmt.Errorf("crl: delta: %w", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("crl: delta: no deltaCRLIndicator")
+		}
+		if !bytes.Equal(deltaCRL.RawIssuer, baseCRL.RawIssuer) {
+			return nil, fmt.Errorf("crl: delta: issuer differs from the base")
+		}
+		if baseNumber.Cmp(baseCRL.Number) > 0 {
+			return nil, fmt.Errorf("%w: the delta applies to base %s, got base %s", ErrCRLNumber, baseNumber, baseCRL.Number)
+		}
+		if deltaCRL.Number.Cmp(baseCRL.Number) <= 0 {
+			return nil, fmt.Errorf("%w: delta %s is not past base %s", ErrCRLNumber, deltaCRL.Number, baseCRL.Number)
+		}
+
+		for _, entry := range deltaCRL.RevokedCertificateEntries {
+			if entry.ReasonCode == reasonRemoveFromCRL {
+				delete(revoked, string(entry.SerialNumber.Bytes()))
+				continue
+			}
+			revoked[string(entry.SerialNumber.Bytes())] = entry.SerialNumber
+		}
+		set.DeltaCRLNumber = deltaCRL.Number
+	}
+
+	for _, serial := range revoked {
+		set.Serials = append(set.Serials, serial)
+	}
+	slices.SortFunc(set.Serials, (*big.Int).Cmp)
+	return set, nil
+}
+
+// parseCRL parses a CRL and checks its signature and CRL number
+func parseCRL(issuer *x509.Certificate, der []byte) (*x509.RevocationList, error) {
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, err
+	}
+	if crl.Number == nil || crl.Number.Sign() < 0 || crl.Number.BitLen() > maxCRLNumberBits {
+		return nil, fmt.Errorf("missing or invalid CRL number")
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid serial %s", entry.SerialNumber)
+		}
+	}
+	return crl, nil
+}
+
+// deltaIndicator returns the base CRL number of a delta CRL, ok is false for
+// a CRL without deltaCRLIndicator
+func deltaIndicator(crl *x509.RevocationList) (*big.Int, bool, error) {
+	for _, ext := range crl.Extensions {
+		if !ext.Id.Equal(oidDeltaCRLIndicator) {
+			continue
+		}
+		number := new(big.Int)
+		rest, err := asn1.Unmarshal(ext.Value, &number)
+		if err != nil || len(rest) != 0 || number.Sign() < 0 || number.BitLen() > maxCRLNumberBits {
+			return nil, false, fmt.Errorf("invalid deltaCRLIndicator")
+		}
+		return number, true, nil
+	}
+	return nil, false, nil
+}
+
+// NewAccumulatorFromSet returns the accumulator of a revocation set, its
+// circuit assignments (Assign) bind the CRL numbers of the set
+func NewAccumulatorFromSet(srs *kzg.SRS, set *RevocationSet) (*Accumulator, error) {
+	acc, err := NewAccumulator(srs)
+	if err != nil {
+		return nil, err
+	}
+	serials := make([][]byte, len(set.Serials))
+	for i, serial := range set.Serials {
+		serials[i] = SerialBytes(serial)
+	}
+	if err := acc.Revoke(serials...); err != nil {
+		return nil, err
+	}
+	acc.baseCRL, acc.deltaCRL = set.BaseCRLNumber, set.DeltaCRLNumber
+	return acc, nil
+}
+
+// CRLNumbers returns the CRL numbers of the set the accumulator was built
+// from, nil for an accumulator not built from CRLs or without delta, and
+// after a Revoke
+func (a *Accumulator) CRLNumbers() (base, delta *big.Int) {
+	return a.baseCRL, a.deltaCRL
+}
@@ -0,0 +1,162 @@
+package cacc_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+	cacc "github.com/mynextid/eudi-zk/circuits/accumulator"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// createCRL returns a CRL of the CA, a delta CRL of the base CRL number base
+// when base is not nil
+func createCRL(t *testing.T, ca *x509.Certificate, key *ecdsa.PrivateKey, number int64, base *big.Int, entries ...x509.RevocationListEntry) []byte {
+	t.Helper()
+	template := &x509.RevocationList{
+		Number:                    big.NewInt(number),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}
+	if base != nil {
+		value, err := asn1.Marshal(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 27}, Critical: true, Value: value}}
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, template, ca, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+func TestMergeCRL(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Certificate Authority"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2222),
+		Subject:      pkix.Name{CommonName: "Test Certificate"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, ca, &certKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2222 is on hold in the base, released by the delta
+	base := createCRL(t, ca, caKey, 10, nil,
+		x509.RevocationListEntry{SerialNumber: big.NewInt(1111), RevocationTime: time.Now()},
+		x509.RevocationListEntry{SerialNumber: big.NewInt(2222), RevocationTime: time.Now(), ReasonCode: 6},
+	)
+	delta := createCRL(t, ca, caKey, 12, big.NewInt(9),
+		x509.RevocationListEntry{SerialNumber: big.NewInt(2222), RevocationTime: time.Now(), ReasonCode: 8},
+		x509.RevocationListEntry{SerialNumber: big.NewInt(3333), RevocationTime: time.Now(), ReasonCode: 1},
+	)
+
+	set, err := cacc.MergeCRL(ca, base, delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(set.Serials, []*big.Int{big.NewInt(1111), big.NewInt(3333)}, func(a, b *big.Int) bool { return a.Cmp(b) == 0 }) {
+		t.Fatalf("unexpected serials %v", set.Serials)
+	}
+	if set.BaseCRLNumber.Int64() != 10 || set.DeltaCRLNumber.Int64() != 12 {
+		t.Fatalf("unexpected CRL numbers %s, %s", set.BaseCRLNumber, set.DeltaCRLNumber)
+	}
+	baseOnly, err := cacc.MergeCRL(ca, base, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(baseOnly.Serials) != 2 || baseOnly.DeltaCRLNumber != nil {
+		t.Fatalf("unexpected base set %+v", baseOnly)
+	}
+
+	// the delta must apply to the base, signed by the issuer
+	if _, err := cacc.MergeCRL(ca, base, createCRL(t, ca, caKey, 12, big.NewInt(11))); !errors.Is(err, cacc.ErrCRLNumber) {
+		t.Fatalf("expected ErrCRLNumber for a newer base, got %v", err)
+	}
+	if _, err := cacc.MergeCRL(ca, base, createCRL(t, ca, caKey, 10, big.NewInt(9))); !errors.Is(err, cacc.ErrCRLNumber) {
+		t.Fatalf("expected ErrCRLNumber for an old delta, got %v", err)
+	}
+	if _, err := cacc.MergeCRL(ca, base, base); err == nil {
+		t.Fatal("expected a delta without deltaCRLIndicator to fail")
+	}
+	if _, err := cacc.MergeCRL(ca, delta, nil); err == nil {
+		t.Fatal("expected a delta as base to fail")
+	}
+	if _, err := cacc.MergeCRL(cert, base, delta); err == nil {
+		t.Fatal("expected a CRL of another issuer to fail")
+	}
+
+	// UNSAFE SRS, for tests only
+	alpha, err := rand.Int(rand.Reader, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs, err := kzg.NewSRS(8, alpha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := cacc.NewAccumulatorFromSet(srs, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acc.IsRevoked(cacc.SerialBytes(big.NewInt(3333))) || acc.IsRevoked(cacc.SerialBytes(cert.SerialNumber)) {
+		t.Fatal("unexpected accumulator of the set")
+	}
+
+	serial := cacc.SerialBytes(cert.SerialNumber)
+	circuit := cacc.NewCircuitAccumulator(len(certDER), len(serial))
+	assignment, err := acc.Assign(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assignment.BaseCRLNumber.(*big.Int).Int64() != 10 || assignment.DeltaCRLNumber.(*big.Int).Int64() != 12 {
+		t.Fatal("expected the CRL numbers in the public inputs")
+	}
+	if err := common.CheckWitness(circuit, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+}
@@ -15,12 +15,9 @@ import (
 	"github.com/consensys/gnark/std/math/uints"
 	ccb "github.com/mynextid/eudi-zk/circuits/compare-bytes"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
-// Define Secp256r1 field parameters
-type Secp256r1Fp = emulated.P256Fp
-type Secp256r1Fr = emulated.P256Fr
-
 func TestCompareB64Url(t *testing.T) {
 	// == Circuit data ==
 	ccsPath := "compiled/cb-circuit-b64url-v1.ccs"
@@ -147,8 +144,8 @@ func TestCompareDigestPubKeys(t *testing.T) {
 
 	// Create witness assignment with actual values
 	assignment := &ccb.CircuitPKDigest{
-		SignerPubKeyX:      emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.X),
-		SignerPubKeyY:      emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.Y),
+		SignerPubKeyX:      emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY:      emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
 		SignerPubKeyBytes:  common.BytesToU8Array(pubKeyBytes),
 		SignerPubKeyDigest: common.BytesToU8Array(pubKeyBytesDigest[:]),
 	}
@@ -194,8 +191,8 @@ func TestComparePublicKeys(t *testing.T) {
 	}
 	// Create witness assignment with actual values
 	assignment := &ccb.CircuitPK{
-		SignerPubKeyX:      emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.X),
-		SignerPubKeyY:      emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.Y),
+		SignerPubKeyX:      emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY:      emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
 		SignerPubKeyXBytes: common.BytesToU8Array(publicKeyXBytes),
 		SignerPubKeyYBytes: common.BytesToU8Array(publicKeyYBytes),
 	}
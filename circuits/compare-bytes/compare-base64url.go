@@ -22,7 +22,7 @@ func (c *CircuitB64Url) Define(api frontend.API) error {
 	decodedBytes, _ := common.DecodeHex(api, decodedBytesHex)
 
 	_ = decodedBytes
-	common.AssertIsEqualBytes(api, c.Bytes, decodedBytes)
+	common.AssertBytesEqual(api, c.Bytes, decodedBytes, "base64url decoded bytes")
 
 	return nil
 }
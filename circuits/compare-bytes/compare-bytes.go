@@ -5,11 +5,12 @@ import (
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 type Circuit struct {
-	SignerPubKeyX emulated.Element[Secp256r1Fp] `gnark:",secret"`
-	SignerPubKeyY emulated.Element[Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
 	// Secret input
 	Bytes []uints.U8 `gnark:",secret"`
 
@@ -20,7 +21,7 @@ type Circuit struct {
 func (c *Circuit) Define(api frontend.API) error {
 
 	// Compare the digests byte by byte using the Val() method to access the underlying variable
-	common.AssertIsEqualBytes(api, c.Bytes, c.PubBytes)
+	common.AssertBytesEqual(api, c.Bytes, c.PubBytes, "bytes")
 
 	return nil
 }
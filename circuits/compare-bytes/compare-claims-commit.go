@@ -0,0 +1,99 @@
+package ccb
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// CircuitClaimCommitments proves the claims of the payload as
+// CircuitClaimsHash does, but exposes each one as a salted commitment
+// (common.ClaimCommitment) instead of a claims hash or an attribute digest.
+// The salts are secret and fresh per presentation, so two presentations of
+// the same claims cannot be linked by their public witness; the holder opens
+// the claims it reveals with their salts (models.ClaimOpening).
+//
+// Decoy slots follow the claim slots: commitments of a random salt only, so
+// circuits with fewer claims keep the public witness of circuits with more,
+// and the slots the holder leaves unopened do not tell claims from decoys.
+type CircuitClaimCommitments struct {
+	// Names of the committed claims, sorted (compile-time)
+	Names []string `gnark:"-"`
+
+	// Secret input
+	Payload          []uints.U8          `gnark:",secret"` // base64url encoded payload
+	ClaimB64         [][]uints.U8        `gnark:",secret"` // base64url encoded claims of the payload
+	ClaimB64Position []frontend.Variable `gnark:",secret"` // ClaimB64 start positions in the payload
+	ClaimPosition    []frontend.Variable `gnark:",secret"` // `"name":"value"` positions within the decoded claims
+	Values           [][]uints.U8        `gnark:",secret"` // claim values
+	Salts            [][]uints.U8        `gnark:",secret"` // commitment salts, claims then decoys
+
+	// Public input
+	Commitments []frontend.Variable `gnark:",public"` // claim commitments, then decoys
+}
+
+// NewCircuitClaimCommitments creates a claim commitments circuit for a
+// payload of payloadSize characters, with decoys decoy slots. claimB64Sizes
+// and valueSizes are the sizes of the aligned base64url claims and of the
+// values, per claim name.
+func NewCircuitClaimCommitments(payloadSize, saltSize int, names []string, claimB64Sizes, valueSizes []int, decoys int) *CircuitClaimCommitments {
+	c := &CircuitClaimCommitments{
+		Names:            names,
+		Payload:          make([]uints.U8, payloadSize),
+		ClaimB64:         make([][]uints.U8, len(names)),
+		ClaimB64Position: make([]frontend.Variable, len(names)),
+		ClaimPosition:    make([]frontend.Variable, len(names)),
+		Values:           make([][]uints.U8, len(names)),
+		Salts:            make([][]uints.U8, len(names)+decoys),
+		Commitments:      make([]frontend.Variable, len(names)+decoys),
+	}
+	for i := range names {
+		c.ClaimB64[i] = make([]uints.U8, claimB64Sizes[i])
+		c.Values[i] = make([]uints.U8, valueSizes[i])
+	}
+	for i := range c.Salts {
+		c.Salts[i] = make([]uints.U8, saltSize)
+	}
+	return c
+}
+
+func (c *CircuitClaimCommitments) Define(api frontend.API) error {
+	if len(c.Salts) != len(c.Commitments) || len(c.Commitments) < len(c.Names) {
+		return fmt.Errorf("%d salts and %d commitments for %d claims", len(c.Salts), len(c.Commitments), len(c.Names))
+	}
+
+	for i, name := range c.Names {
+		if err := common.MustSubset(api, c.Payload, c.ClaimB64[i], c.ClaimB64Position[i]); err != nil {
+			return err
+		}
+		if err := common.AssertB64Aligned(api, len(c.Payload), len(c.ClaimB64[i]), c.ClaimB64Position[i]); err != nil {
+			return err
+		}
+		claim, err := common.DecodeBase64Url(api, c.ClaimB64[i])
+		if err != nil {
+			return err
+		}
+
+		prefix := common.StringToU8Array(`"` + name + `":"`)
+		expected := append(append(prefix, c.Values[i]...), uints.NewU8('"'))
+		extracted := common.GetSubset(api, claim, c.ClaimPosition[i], len(expected))
+		common.AssertBytesEqual(api, extracted, expected, "claim %q", name)
+
+		commitment, err := common.ClaimCommitment(api, c.Salts[i], name, c.Values[i], nil)
+		if err != nil {
+			return err
+		}
+		common.AssertEqual(api, c.Commitments[i], commitment, "claim %q: commitment", name)
+	}
+
+	for i := len(c.Names); i < len(c.Commitments); i++ {
+		commitment, err := common.DecoyCommitment(api, c.Salts[i])
+		if err != nil {
+			return err
+		}
+		common.AssertEqual(api, c.Commitments[i], commitment, "decoy %d: commitment", i-len(c.Names))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package ccb_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	ccb "github.com/mynextid/eudi-zk/circuits/compare-bytes"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// TestCircuitClaimCommitments commits to the claims with fresh salts: two
+// presentations of the same claims have unrelated commitments, and the
+// openings of the holder match them
+func TestCircuitClaimCommitments(t *testing.T) {
+	names := []string{"family_name", "given_name"}
+	circuitTemplate, assignment, openings, err := mockClaimCommitments(names, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// another presentation of the same claims
+	_, other, _, err := mockClaimCommitments(names, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range assignment.Commitments {
+		if assignment.Commitments[i].(*big.Int).Cmp(other.Commitments[i].(*big.Int)) == 0 {
+			t.Fatalf("slot %d: same commitment in two presentations", i)
+		}
+	}
+
+	// a commitment opened as another value
+	forged := openings[0]
+	forged.Value = "Doe"
+	assignment.Commitments[0] = new(big.Int).SetBytes(forged.Commitment())
+	var werr *common.WitnessError
+	if err := common.CheckWitness(circuitTemplate, assignment); !errors.As(err, &werr) || werr.Label != `claim "family_name": commitment` {
+		t.Fatalf("expected the commitment assertion to fail, got %v", err)
+	}
+}
+
+// mockClaimCommitments creates the circuit and assignment committing to the
+// named claims of the demo PID, with decoys, and the openings of the claims
+func mockClaimCommitments(names []string, decoys int) (*ccb.CircuitClaimCommitments, *ccb.CircuitClaimCommitments, []models.ClaimOpening, error) {
+	_, claimsHash, err := mockClaimsHash(names)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	claimB64Sizes, valueSizes := make([]int, len(names)), make([]int, len(names))
+	for i := range names {
+		claimB64Sizes[i], valueSizes[i] = len(claimsHash.ClaimB64[i]), len(claimsHash.Values[i])
+	}
+	saltSize := common.MinClaimSaltSize
+	circuitTemplate := ccb.NewCircuitClaimCommitments(len(claimsHash.Payload), saltSize, names, claimB64Sizes, valueSizes, decoys)
+
+	claims, err := models.GetDemoPID().Claims(names...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	assignment := &ccb.CircuitClaimCommitments{
+		Names:            names,
+		Payload:          claimsHash.Payload,
+		ClaimB64:         claimsHash.ClaimB64,
+		ClaimB64Position: claimsHash.ClaimB64Position,
+		ClaimPosition:    claimsHash.ClaimPosition,
+		Values:           claimsHash.Values,
+		Salts:            make([][]uints.U8, len(names)+decoys),
+		Commitments:      make([]frontend.Variable, len(names)+decoys),
+	}
+	var openings []models.ClaimOpening
+	for i, claim := range claims {
+		opening, err := models.NewClaimOpening(claim.Name, claim.Value, saltSize)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		openings = append(openings, opening)
+		assignment.Salts[i] = common.BytesToU8Array(opening.Salt)
+		assignment.Commitments[i] = new(big.Int).SetBytes(opening.Commitment())
+	}
+	for i := len(names); i < len(names)+decoys; i++ {
+		salt, commitment, err := models.NewDecoyCommitment(saltSize)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		assignment.Salts[i] = common.BytesToU8Array(salt)
+		assignment.Commitments[i] = new(big.Int).SetBytes(commitment)
+	}
+	return circuitTemplate, assignment, openings, nil
+}
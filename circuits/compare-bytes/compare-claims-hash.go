@@ -0,0 +1,110 @@
+package ccb
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// Circuit checks, for every disclosed claim:
+// - whether the base64url encoded claim is in the base64url encoded payload
+// - decodes the claim
+// - extracts `"name":"value"` from the decoded claim and compares the value
+// and then exposes the claims hash of the disclosed claims (see
+// models.ClaimsHash) as a public input, so the disclosed attributes are proven
+// to be in the payload.
+//
+// With attribute slots (Attributes sized, see WithAttributes) the disclosed
+// claims are also exposed as public attributes (common.AssertAttributes), the
+// verifier reads them from the public witness with models.AttributeDecoder.
+// The attribute digests are not salted.
+//
+// Only string claims are supported; the value is compared with the raw JSON
+// string (no unescaping).
+type CircuitClaimsHash struct {
+	// Names of the disclosed claims, sorted (compile-time)
+	Names []string `gnark:"-"`
+
+	// Secret input
+	Payload          []uints.U8          `gnark:",secret"` // base64url encoded payload
+	ClaimB64         [][]uints.U8        `gnark:",secret"` // base64url encoded claims of the payload
+	ClaimB64Position []frontend.Variable `gnark:",secret"` // ClaimB64 start positions in the payload
+	ClaimPosition    []frontend.Variable `gnark:",secret"` // `"name":"value"` positions within the decoded claims
+	Values           [][]uints.U8        `gnark:",secret"` // claim values
+	Salt             []uints.U8          `gnark:",secret"` // claims hash salt
+
+	// Public input
+	ClaimsHash []uints.U8         `gnark:",public"` // claims hash of the disclosed claims
+	Attributes []common.Attribute `gnark:",public"` // disclosed claims, optional
+}
+
+// NewCircuitClaimsHash creates a claims hash circuit for a payload of
+// payloadSize characters. claimB64Sizes and valueSizes are the sizes of the
+// aligned base64url claims and of the values, per claim name.
+func NewCircuitClaimsHash(payloadSize, saltSize int, names []string, claimB64Sizes, valueSizes []int) *CircuitClaimsHash {
+	c := &CircuitClaimsHash{
+		Names:            names,
+		Payload:          make([]uints.U8, payloadSize),
+		ClaimB64:         make([][]uints.U8, len(names)),
+		ClaimB64Position: make([]frontend.Variable, len(names)),
+		ClaimPosition:    make([]frontend.Variable, len(names)),
+		Values:           make([][]uints.U8, len(names)),
+		Salt:             make([]uints.U8, saltSize),
+		ClaimsHash:       make([]uints.U8, 32),
+	}
+	for i := range names {
+		c.ClaimB64[i] = make([]uints.U8, claimB64Sizes[i])
+		c.Values[i] = make([]uints.U8, valueSizes[i])
+	}
+	return c
+}
+
+// WithAttributes adds one attribute slot per disclosed claim
+func (c *CircuitClaimsHash) WithAttributes() *CircuitClaimsHash {
+	c.Attributes = make([]common.Attribute, len(c.Names))
+	return c
+}
+
+func (c *CircuitClaimsHash) Define(api frontend.API) error {
+
+	for i, name := range c.Names {
+		// Verify whether the claim is a subset of the payload
+		err := common.MustSubset(api, c.Payload, c.ClaimB64[i], c.ClaimB64Position[i])
+		if err != nil {
+			return err
+		}
+
+		// The claim must decode to the same bytes as the payload it is taken from
+		err = common.AssertB64Aligned(api, len(c.Payload), len(c.ClaimB64[i]), c.ClaimB64Position[i])
+		if err != nil {
+			return err
+		}
+
+		// Decode the claim
+		claim, err := common.DecodeBase64Url(api, c.ClaimB64[i])
+		if err != nil {
+			return err
+		}
+
+		// Extract "name":"value" and compare it with the claim name and value
+		prefix := common.StringToU8Array(`"` + name + `":"`)
+		expected := append(append(prefix, c.Values[i]...), uints.NewU8('"'))
+
+		extracted := common.GetSubset(api, claim, c.ClaimPosition[i], len(expected))
+		common.AssertBytesEqual(api, extracted, expected, "claim %q", name)
+	}
+
+	// Compute the claims hash of the disclosed claims
+	claimsHash, err := common.ClaimsHash(api, c.Salt, c.Names, c.Values)
+	if err != nil {
+		return err
+	}
+
+	common.AssertBytesEqual(api, claimsHash, c.ClaimsHash, "claims hash")
+
+	if len(c.Attributes) > 0 {
+		return common.AssertAttributes(api, c.Attributes, c.Names, c.Values)
+	}
+
+	return nil
+}
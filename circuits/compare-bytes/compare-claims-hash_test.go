@@ -0,0 +1,198 @@
+package ccb_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	ccb "github.com/mynextid/eudi-zk/circuits/compare-bytes"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+func TestCircuitClaimsHash(t *testing.T) {
+
+	ccsPath := "compiled/circuit-claims-hash-v1.ccs"
+	pkPath := "compiled/proving-claims-hash-v1.key"
+	vkPath := "compiled/verifying-claims-hash-v1.key"
+
+	forceCompile := true
+
+	circuitTemplate, assignment, err := mockClaimsHash([]string{"family_name", "given_name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// == Init the circuit ==
+	fmt.Println("\n--- Init the circuit ---")
+	startCircuit := time.Now()
+
+	ccs, pk, vk, err := common.InitCircuit(ccsPath, pkPath, vkPath, forceCompile, circuitTemplate)
+	if err != nil {
+		t.Fatalf("failed to initialize a circuit: %v", err)
+	}
+
+	circuitTime := time.Since(startCircuit)
+	fmt.Printf("[OK] Circuit created/loaded successfully! (took %v)\n", circuitTime)
+
+	// == Run the circuit ==
+	common.TestCircuitSimple(assignment, ccs, pk, vk)
+}
+
+// TestCircuitClaimsHashTampered checks that a value which is not the one of
+// the payload is rejected even with a matching claims hash
+func TestCircuitClaimsHashTampered(t *testing.T) {
+	circuitTemplate, assignment, err := mockClaimsHash([]string{"given_name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := []models.Claim{{Name: "given_name", Value: "Erikx"}}
+	salt := make([]byte, models.ClaimsSaltSize)
+	claimsHash, err := models.ClaimsHash(salt, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignment.Salt = common.BytesToU8Array(salt)
+	assignment.Values[0] = common.StringToU8Array(claims[0].Value)
+	assignment.ClaimsHash = common.BytesToU8Array(claimsHash)
+
+	var werr *common.WitnessError
+	if err := common.CheckWitness(circuitTemplate, assignment); !errors.As(err, &werr) {
+		t.Fatalf("expected a witness error, got %v", err)
+	}
+	if !strings.HasPrefix(werr.Label, `claim "given_name"`) {
+		t.Fatalf("unexpected label %q", werr.Label)
+	}
+}
+
+// TestCircuitClaimsHashAttributes exposes the disclosed claims as attributes
+// and decodes them from the public witness
+func TestCircuitClaimsHashAttributes(t *testing.T) {
+	names := []string{"family_name", "given_name"}
+	circuitTemplate, assignment, err := mockClaimsHash(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := models.GetDemoPID().Claims(names...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	circuitTemplate.WithAttributes()
+	assignment.Attributes = make([]common.Attribute, len(claims))
+	for i, claim := range claims {
+		tag, err := common.AttributeTag(claim.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := models.NewAttributeDigest(claim.Value)
+		assignment.Attributes[i] = common.Attribute{Tag: tag, Digest: new(big.Int).SetBytes(digest)}
+	}
+
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	w, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, err := w.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := models.NewAttributeDecoder(circuitTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes, err := decoder.Decode(publicWitness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attributes) != 2 || !attributes["family_name"].Matches("Muller") || attributes["given_name"].Matches("Max") {
+		t.Fatalf("unexpected attributes %v", attributes)
+	}
+
+	// the digest of another value
+	assignment.Attributes[0].Digest = new(big.Int).SetBytes(models.NewAttributeDigest("Doe"))
+	var werr *common.WitnessError
+	if err := common.CheckWitness(circuitTemplate, assignment); !errors.As(err, &werr) || werr.Label != "attribute family_name: digest" {
+		t.Fatalf("expected the attribute digest assertion to fail, got %v", err)
+	}
+}
+
+// mockClaimsHash creates a payload from the demo PID and the circuit and
+// assignment disclosing the named claims (sorted)
+func mockClaimsHash(names []string) (*ccb.CircuitClaimsHash, *ccb.CircuitClaimsHash, error) {
+	pid := models.GetDemoPID()
+	payloadJSON, err := json.Marshal(pid)
+	if err != nil {
+		return nil, nil, err
+	}
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+
+	claims, err := pid.Claims(names...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	salt, err := models.NewClaimsSalt()
+	if err != nil {
+		return nil, nil, err
+	}
+	claimsHash, err := models.ClaimsHash(salt, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claimB64Sizes := make([]int, len(claims))
+	valueSizes := make([]int, len(claims))
+	assignment := &ccb.CircuitClaimsHash{
+		Names:            names,
+		Payload:          common.StringToU8Array(payloadB64),
+		ClaimB64:         make([][]uints.U8, len(claims)),
+		ClaimB64Position: make([]frontend.Variable, len(claims)),
+		ClaimPosition:    make([]frontend.Variable, len(claims)),
+		Values:           make([][]uints.U8, len(claims)),
+		Salt:             common.BytesToU8Array(salt),
+		ClaimsHash:       common.BytesToU8Array(claimsHash),
+	}
+
+	for i, claim := range claims {
+		claimStr := fmt.Sprintf("%q:%q", claim.Name, claim.Value)
+		claimStart := strings.Index(string(payloadJSON), claimStr)
+		if claimStart == -1 {
+			return nil, nil, fmt.Errorf("claim %q not found in the payload", claim.Name)
+		}
+
+		a, err := common.AlignClaim(len(payloadJSON), claimStart, claimStart+len(claimStr))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		claimB64 := payloadB64[a.B64Start:a.B64End]
+		claimB64Sizes[i] = len(claimB64)
+		valueSizes[i] = len(claim.Value)
+
+		assignment.ClaimB64[i] = common.StringToU8Array(claimB64)
+		assignment.ClaimB64Position[i] = a.B64Start
+		assignment.ClaimPosition[i] = a.Offset
+		assignment.Values[i] = common.StringToU8Array(claim.Value)
+	}
+
+	circuitTemplate := ccb.NewCircuitClaimsHash(len(payloadB64), len(salt), names, claimB64Sizes, valueSizes)
+
+	return circuitTemplate, assignment, nil
+}
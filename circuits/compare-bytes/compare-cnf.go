@@ -9,7 +9,7 @@ import (
 // Circuit checks:
 // - whether the base64url encoded cnf is in the base64url encoded protected JWS header
 // - decodes the cnf
-// - extracts the hex-encoded public key digest
+// - extracts the hex-encoded public key digest, the kid of the cnf claim
 // - decodes the hex-encoded public key digest
 // - compares the extracted public key digest with the provided public key bytes
 type CircuitCompareCnf struct {
@@ -26,7 +26,13 @@ type CircuitCompareCnf struct {
 func (c *CircuitCompareCnf) Define(api frontend.API) error {
 
 	// Verify whether cnfB64 is a subset of headerB64
-	err := common.IsSubset(api, c.HeaderB64, c.CnfB64, c.CnfB64Position)
+	err := common.MustSubset(api, c.HeaderB64, c.CnfB64, c.CnfB64Position)
+	if err != nil {
+		return err
+	}
+
+	// cnfB64 must decode to the same bytes as the header it is taken from
+	err = common.AssertB64Aligned(api, len(c.HeaderB64), len(c.CnfB64), c.CnfB64Position)
 	if err != nil {
 		return err
 	}
@@ -39,7 +45,7 @@ func (c *CircuitCompareCnf) Define(api frontend.API) error {
 
 	// Extract the hex encoded public key
 	pubKeyHexLength := 64 // size of the hex encoded SHA256 digest
-	publicKeyHex := common.GetSubset(api, cnf, c.PubKeyHexPosition, pubKeyHexLength)
+	publicKeyHex := common.GetStringValue(api, cnf, c.PubKeyHexPosition, common.CnfKidKey, pubKeyHexLength)
 
 	// Decode the hex encoded public key
 	publicKeyDigest, err := common.DecodeHex(api, publicKeyHex)
@@ -48,7 +54,7 @@ func (c *CircuitCompareCnf) Define(api frontend.API) error {
 	}
 
 	// compare the bytes
-	common.AssertIsEqualBytes(api, publicKeyDigest, c.PublicKeyDigest)
+	common.AssertBytesEqual(api, publicKeyDigest, c.PublicKeyDigest, "cnf public key digest")
 
 	return nil
 }
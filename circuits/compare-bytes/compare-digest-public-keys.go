@@ -5,12 +5,13 @@ import (
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 type CircuitPKDigest struct {
 	// Secret inputs
-	SignerPubKeyX emulated.Element[Secp256r1Fp] `gnark:",secret"`
-	SignerPubKeyY emulated.Element[Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
 	// Public inputs
 	SignerPubKeyBytes  []uints.U8 `gnark:",public"`
 	SignerPubKeyDigest []uints.U8 `gnark:",public"`
@@ -31,8 +32,8 @@ func (c *CircuitPKDigest) Define(api frontend.API) error {
 
 	digest, _ := common.SHA256(api, pubKeyBytes)
 
-	common.AssertIsEqualBytes(api, pubKeyBytes, c.SignerPubKeyBytes)
-	common.AssertIsEqualBytes(api, digest, c.SignerPubKeyDigest)
+	common.AssertBytesEqual(api, pubKeyBytes, c.SignerPubKeyBytes, "public key bytes")
+	common.AssertBytesEqual(api, digest, c.SignerPubKeyDigest, "public key digest")
 
 	return nil
 }
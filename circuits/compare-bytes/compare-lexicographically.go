@@ -24,22 +24,22 @@ type CircuitLex struct {
 func (c *CircuitLex) Define(api frontend.API) error {
 
 	r, _ := common.IsSmaller(api, c.StringSmallerBytes, c.StringReferenceBytes)
-	api.AssertIsEqual(r, frontend.Variable(1))
+	common.AssertEqual(api, r, 1, "IsSmaller(StringSmallerBytes, StringReferenceBytes) == 1")
 
 	r, _ = common.IsSmaller(api, c.StringGreaterBytes, c.StringReferenceBytes)
-	api.AssertIsEqual(r, frontend.Variable(0))
+	common.AssertEqual(api, r, 0, "IsSmaller(StringGreaterBytes, StringReferenceBytes) == 0")
 
 	r, _ = common.IsSmaller(api, c.StringEqualBytes, c.StringReferenceBytes)
-	api.AssertIsEqual(r, frontend.Variable(0))
+	common.AssertEqual(api, r, 0, "IsSmaller(StringEqualBytes, StringReferenceBytes) == 0")
 
 	r, _ = common.IsGreater(api, c.StringSmallerBytes, c.StringReferenceBytes)
-	api.AssertIsEqual(r, frontend.Variable(0))
+	common.AssertEqual(api, r, 0, "IsGreater(StringSmallerBytes, StringReferenceBytes) == 0")
 
 	r, _ = common.IsGreater(api, c.StringGreaterBytes, c.StringReferenceBytes)
-	api.AssertIsEqual(r, frontend.Variable(1))
+	common.AssertEqual(api, r, 1, "IsGreater(StringGreaterBytes, StringReferenceBytes) == 1")
 
 	r, _ = common.IsGreater(api, c.StringEqualBytes, c.StringReferenceBytes)
-	api.AssertIsEqual(r, frontend.Variable(0))
+	common.AssertEqual(api, r, 0, "IsGreater(StringEqualBytes, StringReferenceBytes) == 0")
 
 	return nil
 }
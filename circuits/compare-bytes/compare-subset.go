@@ -18,5 +18,5 @@ type CircuitCompareSubset struct {
 
 func (c *CircuitCompareSubset) Define(api frontend.API) error {
 
-	return common.IsSubset(api, c.Bytes, c.Subset, c.PositionStart)
+	return common.MustSubset(api, c.Bytes, c.Subset, c.PositionStart)
 }
@@ -1,6 +1,7 @@
 package ccb_test
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -66,3 +67,42 @@ func TestCircuitCompareSubset(t *testing.T) {
 	common.TestCircuitSimple(assignment, ccs, pk, vk)
 
 }
+
+// TestCircuitCompareSubsetLabel checks that a tampered subset is reported with
+// the label of the failing assertion
+func TestCircuitCompareSubsetLabel(t *testing.T) {
+	byteSize := 64
+	subsetSize := 16
+	position := 7
+
+	randomBytes, err := common.GenerateRandomBytes(byteSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subset := make([]byte, subsetSize)
+	copy(subset, randomBytes[position:position+subsetSize])
+
+	assignment := &ccb.CircuitCompareSubset{
+		Bytes:         common.BytesToU8Array(randomBytes),
+		PositionStart: position,
+		Subset:        common.BytesToU8Array(subset),
+	}
+
+	if err := common.CheckWitness(assignment, assignment); err != nil {
+		t.Fatalf("expected the witness to satisfy the circuit: %v", err)
+	}
+
+	// flip one byte of the subset
+	subset[3] ^= 0xff
+	assignment.Subset = common.BytesToU8Array(subset)
+
+	err = common.CheckWitness(assignment, assignment)
+	var werr *common.WitnessError
+	if !errors.As(err, &werr) {
+		t.Fatalf("expected a witness error, got %v", err)
+	}
+	if want := fmt.Sprintf("subset byte 3 at bytes[%d]", position+3); werr.Label != want {
+		t.Fatalf("expected label %q, got %q", want, werr.Label)
+	}
+}
@@ -19,6 +19,8 @@ import (
 	"github.com/consensys/gnark/std/math/uints"
 	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/models"
 )
 
 func TestPoPCA(t *testing.T) {
@@ -98,10 +100,8 @@ func TestPoPCA(t *testing.T) {
 		t.Fatalf("failed to create a challenge %v", err)
 	}
 
-	c_digest := sha256.Sum256(challenge)
-
-	// Sign the digest of the challenge
-	r, s, err := ecdsa.Sign(rand.Reader, signerKey, c_digest[:])
+	// Sign the challenge with the wallet signer
+	r, s, err := walletSignature(signerKey, false, challenge)
 	if err != nil {
 		t.Fatalf("failed to sign the challenge %v", err)
 	}
@@ -116,16 +116,16 @@ func TestPoPCA(t *testing.T) {
 	assignment := &cdl.CircuitPoPCA{
 		CertBytes:           common.BytesToU8Array(tbsCert),
 		CertLength:          frontend.Variable(len(tbsCert)),
-		CertSigR:            emulated.ValueOf[Secp256r1Fr](certSig.R),
-		CertSigS:            emulated.ValueOf[Secp256r1Fr](certSig.S),
+		CertSigR:            emulated.ValueOf[curves.Secp256r1Fr](certSig.R),
+		CertSigS:            emulated.ValueOf[curves.Secp256r1Fr](certSig.S),
 		SubjectPubKeyPos:    frontend.Variable(pubKeyPosition),
-		SignerPubKeyX:       emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.X),
-		SignerPubKeyY:       emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.Y),
-		ChallengeSignatureR: emulated.ValueOf[Secp256r1Fr](r),
-		ChallengeSignatureS: emulated.ValueOf[Secp256r1Fr](s),
+		SignerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+		ChallengeSignatureR: r,
+		ChallengeSignatureS: s,
 		Challenge:           common.BytesToU8Array(challenge),
-		CAPubKeyX:           emulated.ValueOf[Secp256r1Fp](qtspKey.PublicKey.X),
-		CAPubKeyY:           emulated.ValueOf[Secp256r1Fp](qtspKey.PublicKey.Y),
+		CAPubKeyX:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+		CAPubKeyY:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
 	}
 
 	// == Init the circuit ==
@@ -144,6 +144,48 @@ func TestPoPCA(t *testing.T) {
 	common.TestCircuit(assignment, ccs, pk, vk)
 }
 
+func TestPoPCASigningContext(t *testing.T) {
+	signerKey, qtspKey := mockKey(t), mockKey(t)
+	_, tbsCert, certSigR, certSigS := mockCert(t, &signerKey.PublicKey, qtspKey)
+	pubKeyPosition, err := cdl.FindSubjectPublicKeyPositionInTBS(tbsCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, _ := common.GenerateRandomBytes(32)
+
+	for _, tt := range signingContextCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r, s, err := walletSignature(signerKey, tt.legacySigner, challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			circuit := &cdl.CircuitPoPCA{
+				CertBytes:       make([]uints.U8, len(tbsCert)),
+				Challenge:       make([]uints.U8, len(challenge)),
+				LegacyChallenge: tt.legacyCircuit,
+			}
+			assignment := &cdl.CircuitPoPCA{
+				CertBytes:           common.BytesToU8Array(tbsCert),
+				CertLength:          len(tbsCert),
+				CertSigR:            emulated.ValueOf[curves.Secp256r1Fr](certSigR),
+				CertSigS:            emulated.ValueOf[curves.Secp256r1Fr](certSigS),
+				SubjectPubKeyPos:    pubKeyPosition,
+				SignerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+				SignerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+				ChallengeSignatureR: r,
+				ChallengeSignatureS: s,
+				Challenge:           common.BytesToU8Array(challenge),
+				CAPubKeyX:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+				CAPubKeyY:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
+			}
+			err = common.CheckWitness(circuit, assignment)
+			if tt.valid != (err == nil) {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
 func TestPoP(t *testing.T) {
 	// Set a deadline for this specific test
 	_, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
@@ -221,7 +263,7 @@ func TestPoP(t *testing.T) {
 		t.Fatalf("failed to create a challenge %v", err)
 	}
 
-	c_digest := sha256.Sum256(challenge)
+	c_digest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
 
 	// Sign the digest of the challenge
 	r, s, err := ecdsa.Sign(rand.Reader, signerKey, c_digest[:])
@@ -240,10 +282,10 @@ func TestPoP(t *testing.T) {
 		CertBytes:           common.BytesToU8Array(certDER),
 		CertLength:          frontend.Variable(len(certDER)),
 		SubjectPubKeyPos:    frontend.Variable(pubKeyPosition),
-		SignerPubKeyX:       emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.X),
-		SignerPubKeyY:       emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.Y),
-		ChallengeSignatureR: emulated.ValueOf[Secp256r1Fr](r),
-		ChallengeSignatureS: emulated.ValueOf[Secp256r1Fr](s),
+		SignerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+		ChallengeSignatureR: emulated.ValueOf[curves.Secp256r1Fr](r),
+		ChallengeSignatureS: emulated.ValueOf[curves.Secp256r1Fr](s),
 		Challenge:           common.BytesToU8Array(challenge),
 	}
 
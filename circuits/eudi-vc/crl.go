@@ -1,170 +1,421 @@
 package cdl
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/lookup/logderivlookup"
 	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/dertags"
 )
 
 // CircuitCRL defines a ZK circuit that verifies
-// 1. A certificate's serial number is NOT in a provided CRL
-// 2. The CRL signature is validated externally (assumed valid input)
-// Note: this approach is super inefficient as the CRL grows
-// BitString approach is probably more efficient, but it is encoded as hex+base64 ...
+// 1. A certificate's serial number is in a provided CRL or not, as Status
+// 2. The CRL is fresh: thisUpdate <= Now <= nextUpdate
+// 3. The CRL signature is validated externally (assumed valid input)
+// The revokedCertificates are scanned on MaxEntries entries in strides of
+// Stride entries (CRLScan): the constraints grow with MaxEntries, not with the
+// entries of the CRL, and a CRL with more entries is rejected.
 type CircuitCRL struct {
 	// public inputs
 	CRLBytes []uints.U8 `gnark:",public"` // The full CRL in DER format
+	Now      []uints.U8 `gnark:",public"` // Verifier time, YYYYMMDDHHMMSS (UTC), see FormatCRLTime
+	// Status is the proven revocation status: CRLStatusNotRevoked, or
+	// CRLStatusRevoked e.g. to prove a card was reported lost
+	Status frontend.Variable `gnark:",public"`
 
 	// private inputs
 	CertBytes []uints.U8 `gnark:",secret"` // The certificate to check
 
 	// Circuit parameters set at compile time
 	MaxSerialLen int `gnark:"-"` // Maximum serial number length in bytes
+	MaxEntries   int `gnark:"-"` // Maximum revoked certificates, see CRLScan
+	Stride       int `gnark:"-"` // Entries per stride, see CRLScan
 }
 
+// CRLTimeLen is the length of the normalized CRL times: YYYYMMDDHHMMSS
+const CRLTimeLen = 14
+
+// Revocation statuses of CircuitCRL
+const (
+	// CRLStatusNotRevoked: the serial is not in the CRL
+	CRLStatusNotRevoked = 0
+	// CRLStatusRevoked: the serial is in the CRL
+	CRLStatusRevoked = 1
+)
+
 // Define implements the gnark Circuit interface
 func (c *CircuitCRL) Define(api frontend.API) error {
-	// Verify that the certificate's serial number is NOT in the CRL
-	VerifySerialNotRevoked(api, c.CertBytes, c.CRLBytes, c.MaxSerialLen)
+	if len(c.Now) != CRLTimeLen {
+		return fmt.Errorf("crl: Now must be %d bytes, got %d", CRLTimeLen, len(c.Now))
+	}
+
+	// Extract serial from certificate
+	serialBytes := ExtractSerialFromCert(api, c.CertBytes, c.MaxSerialLen)
+
+	thisUpdate, nextUpdate, revoked := NavigateToCRLUpdates(api, c.CRLBytes)
+
+	// Verify that the CRL is not stale
+	if err := AssertCRLFresh(api, c.CRLBytes, thisUpdate, nextUpdate, c.Now); err != nil {
+		return err
+	}
+
+	// Verify that the certificate's serial number is in the CRL as Status
+	// states: the scan result is proven, not asserted to be 0
+	api.AssertIsBoolean(c.Status)
+	isRevoked, err := ScanRevokedCertificates(api, c.CRLBytes, revoked, serialBytes, CRLScan{MaxEntries: c.MaxEntries, Stride: c.Stride})
+	if err != nil {
+		return err
+	}
+	common.AssertEqual(api, isRevoked, c.Status, "crl: certificate revocation status")
 
 	return nil
 }
 
-// NewCircuitCRL creates a new CRL verification circuit with specified sizes
+// NewCircuitCRL creates a new CRL verification circuit with specified sizes,
+// the revocation status is a public input of the assignment
 func NewCircuitCRL(maxCertSize, maxCRLSize int) *CircuitCRL {
 	return &CircuitCRL{
 		CertBytes: make([]uints.U8, maxCertSize),
 		CRLBytes:  make([]uints.U8, maxCRLSize),
+		Now:       make([]uints.U8, CRLTimeLen),
 	}
 }
 
-// CheckSerialInCRL verifies if a certificate serial number is present in a CRL
+// CheckSerialInCRL verifies if a certificate serial number (ExtractSerialFromCert)
+// is present in a CRL
 // Returns 1 if the serial is found (revoked), 0 if not found (valid)
 func CheckSerialInCRL(
 	api frontend.API,
 	crlBytes []uints.U8,
-	serialBytes []uints.U8,
-	maxSerialLen int,
+	serial common.LengthedBytes,
 ) frontend.Variable {
+	_, _, index := NavigateToCRLUpdates(api, crlBytes)
+	return CheckSerialInRevokedCertificates(api, crlBytes, index, serial)
+}
+
+// NavigateToCRLUpdates navigates the TBSCertList and returns the positions of
+// thisUpdate, of nextUpdate (the position of the element following thisUpdate,
+// nextUpdate is optional) and of the element following the update times
+// (revokedCertificates if present)
+func NavigateToCRLUpdates(
+	api frontend.API,
+
+	crlBytes []uints.U8,
+) (frontend.Variable, frontend.Variable, frontend.Variable) {
 	index := frontend.Variable(0)
 
 	// Skip outer CRL SEQUENCE
 	tag := ReadByteAt(api, crlBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "crl: CertificateList SEQUENCE tag")
 	index = api.Add(index, 1)
 	_, lengthBytes := ReadDERLength(api, crlBytes, index)
 	index = api.Add(index, lengthBytes)
 
 	// Enter TBSCertList SEQUENCE
 	tag = ReadByteAt(api, crlBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "crl: TBSCertList SEQUENCE tag")
 	index = api.Add(index, 1)
 	_, lengthBytes = ReadDERLength(api, crlBytes, index)
 	index = api.Add(index, lengthBytes)
 
 	// Field 1: Version (optional, INTEGER 0x02)
 	tag = ReadByteAt(api, crlBytes, index)
-	hasVersion := api.IsZero(api.Sub(tag.Val, 0x02))
+	hasVersion := api.IsZero(api.Sub(tag.Val, dertags.Integer))
 	skipAmount := api.Select(hasVersion, SkipElement(api, crlBytes, index), 0)
 	index = api.Add(index, skipAmount)
 
 	// Field 2: Signature Algorithm (SEQUENCE 0x30)
 	tag = ReadByteAt(api, crlBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "crl: signature AlgorithmIdentifier tag")
 	skipAmount = SkipElement(api, crlBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 3: Issuer DN (SEQUENCE 0x30)
 	tag = ReadByteAt(api, crlBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "crl: issuer Name tag")
 	skipAmount = SkipElement(api, crlBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 4: thisUpdate (TIME 0x17 or 0x18)
+	thisUpdate := index
 	skipAmount = SkipElement(api, crlBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 5: nextUpdate (optional, TIME 0x17 or 0x18)
+	nextUpdate := index
 	tag = ReadByteAt(api, crlBytes, index)
 	isTime := api.Or(
-		api.IsZero(api.Sub(tag.Val, 0x17)),
-		api.IsZero(api.Sub(tag.Val, 0x18)),
+		api.IsZero(api.Sub(tag.Val, dertags.UTCTime)),
+		api.IsZero(api.Sub(tag.Val, dertags.GeneralizedTime)),
 	)
 	skipAmount = api.Select(isTime, SkipElement(api, crlBytes, index), 0)
 	index = api.Add(index, skipAmount)
 
-	// Field 6: revokedCertificates (optional, SEQUENCE 0x30)
-	// This is where we need to search for our serial number
-	tag = ReadByteAt(api, crlBytes, index)
-	hasRevokedCerts := api.IsZero(api.Sub(tag.Val, 0x30))
+	return thisUpdate, nextUpdate, index
+}
+
+// CheckSerialInRevokedCertificates searches the serial number in the
+// revokedCertificates of a CRL, index is the position returned by
+// NavigateToCRLUpdates, with the default scan parameters (CRLScan)
+// Returns 1 if the serial is found (revoked), 0 if not found (valid)
+func CheckSerialInRevokedCertificates(
+	api frontend.API,
+	crlBytes []uints.U8,
+	index frontend.Variable,
+	serial common.LengthedBytes,
+) frontend.Variable {
+	found, err := ScanRevokedCertificates(api, crlBytes, index, serial, CRLScan{})
+	if err != nil {
+		panic(err)
+	}
+	return found
+}
+
+// Defaults of CRLScan
+const (
+	DefaultCRLMaxEntries = 10
+	DefaultCRLStride     = 5
+)
 
-	// If no revoked certificates, serial is not in CRL
-	found := frontend.Variable(0)
+// CRLScan are the compile parameters of the revokedCertificates scan. The
+// circuit unrolls Entries() entries whatever the CRL, so MaxEntries bounds
+// both the accepted CRLs and the constraints.
+type CRLScan struct {
+	// MaxEntries is the largest number of revoked certificates,
+	// DefaultCRLMaxEntries when 0. A CRL with more entries is rejected.
+	MaxEntries int
+	// Stride is the number of entries scanned together, DefaultCRLStride
+	// when 0: the entry headers of a stride are walked first, then the
+	// serial numbers of the stride are read in one lookup
+	Stride int
+}
 
-	// Only search if there are revoked certificates
-	// We need to iterate through the sequence and check each entry
-	revokedSeqStart := api.Add(index, 1)
-	_, revokedLenBytes := ReadDERLength(api, crlBytes, api.Add(index, 1))
-	revokedSeqDataStart := api.Add(revokedSeqStart, revokedLenBytes)
+// withDefaults returns the parameters with the defaults set
+func (s CRLScan) withDefaults() (CRLScan, error) {
+	if s.MaxEntries == 0 {
+		s.MaxEntries = DefaultCRLMaxEntries
+	}
+	if s.Stride == 0 {
+		s.Stride = DefaultCRLStride
+	}
+	if s.MaxEntries < 0 || s.Stride < 0 {
+		return s, fmt.Errorf("crl: invalid scan parameters %+v", s)
+	}
+	return s, nil
+}
 
-	// Search through revoked certificates
-	// Each entry is a SEQUENCE containing: serialNumber, revocationDate, [extensions]
-	searchIndex := revokedSeqDataStart
+// Entries returns the number of entries the circuit scans, MaxEntries
+// rounded up to a multiple of Stride
+func (s CRLScan) Entries() int {
+	s, err := s.withDefaults()
+	if err != nil {
+		return 0
+	}
+	return (s.MaxEntries + s.Stride - 1) / s.Stride * s.Stride
+}
 
-	// Simplified: just iterate a fixed number of times
-	// The user should set this based on their CRL size
-	maxEntries := 10 // Adjust based on your CRL
+// crlHeaderLen is the tag and up to 3 length bytes of a DER element
+const crlHeaderLen = 4
+
+// ScanRevokedCertificates searches the serial number in the
+// revokedCertificates of a CRL like CheckSerialInRevokedCertificates, with
+// the scan parameters. The CRL is read with one lookup table shared by all
+// the entries, the entries after the last one are inactive (read at 0 and
+// ignored), and the bytes of the scanned entries must add up to the encoded
+// length of revokedCertificates: a CRL with more entries than the circuit
+// scans is rejected instead of being partially searched. An entry matches
+// when its serialNumber has the length and the bytes of the serial
+// (ExtractSerialFromCert), so a serial sharing a prefix with the certificate
+// serial does not match it.
+// Returns 1 if the serial is found (revoked), 0 if not found (valid)
+func ScanRevokedCertificates(
+	api frontend.API,
+	crlBytes []uints.U8,
+	index frontend.Variable,
+	serial common.LengthedBytes,
+	scan CRLScan,
+) (frontend.Variable, error) {
+	scan, err := scan.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if len(serial.Data) == 0 {
+		return nil, fmt.Errorf("crl: empty serial")
+	}
+	r := newCRLReader(api, crlBytes, crlHeaderLen+2+len(serial.Data))
+
+	// The end of the TBSCertList tells revokedCertificates from the
+	// signatureAlgorithm following a CRL without revoked certificates nor
+	// extensions
+	outer := r.read(0, crlHeaderLen)
+	_, outerLenBytes := derLength(api, outer[1:])
+	tbsStart := api.Add(1, outerLenBytes)
+	tbs := r.read(tbsStart, crlHeaderLen)
+	tbsLen, tbsLenBytes := derLength(api, tbs[1:])
+	tbsEnd := api.Add(tbsStart, 1, tbsLenBytes, tbsLen)
 
-	for i := 0; i < maxEntries; i++ {
-		// Always process, but results won't matter if hasRevokedCerts is 0
+	// Field 6: revokedCertificates (optional, SEQUENCE 0x30)
+	revoked := r.read(index, crlHeaderLen)
+	hasRevokedCerts := api.And(
+		api.IsZero(api.Sub(revoked[0], dertags.Sequence)),
+		api.Sub(1, api.IsZero(api.Sub(index, tbsEnd))),
+	)
+	revokedLen, revokedLenBytes := derLength(api, revoked[1:])
 
-		// Read entry SEQUENCE tag
-		entryTag := ReadByteAt(api, crlBytes, searchIndex)
-		_ = api.IsZero(api.Sub(entryTag.Val, 0x30))
+	state := crlScanState{
+		pos:     api.Add(index, 1, revokedLenBytes),
+		end:     api.Mul(hasRevokedCerts, revokedLen),
+		scanned: 0,
+		found:   0,
+	}
+	state.active = api.Sub(1, api.IsZero(state.end))
+	for range scan.Entries() / scan.Stride {
+		state = r.scanStride(state, scan.Stride, serial)
+	}
 
-		// Skip SEQUENCE tag and read length
-		serialIndex := api.Add(searchIndex, 1)
-		entryContentLen, entryLenBytes := ReadDERLength(api, crlBytes, serialIndex)
-		serialIndex = api.Add(serialIndex, entryLenBytes)
+	// the scanned entries are all the entries
+	common.AssertEqual(api, state.scanned, state.end, "crl: revokedCertificates of at most %d entries", scan.Entries())
+	return state.found, nil
+}
 
-		// Now at serial number (INTEGER 0x02)
-		_ = ReadByteAt(api, crlBytes, serialIndex) // Verify it's 0x02 if needed
-		serialIndex = api.Add(serialIndex, 1)
-		_, serialLenBytes := ReadDERLength(api, crlBytes, serialIndex)
-		serialIndex = api.Add(serialIndex, serialLenBytes)
+// crlReader reads the CRL bytes with a lookup table, padded so that the
+// reads of an entry at the end of the CRL stay in the table
+type crlReader struct {
+	api   frontend.API
+	table logderivlookup.Table
+}
 
-		// Compare serial numbers (fixed length comparison)
-		serialMatch := CompareSerialNumbers(api, crlBytes, serialIndex, serialBytes, maxSerialLen)
+func newCRLReader(api frontend.API, crlBytes []uints.U8, padding int) *crlReader {
+	table := logderivlookup.New(api)
+	for i := range crlBytes {
+		table.Insert(crlBytes[i].Val)
+	}
+	for range padding {
+		table.Insert(0)
+	}
+	return &crlReader{api: api, table: table}
+}
 
-		// Update found flag if we have a match and should process
-		matchFound := api.And(hasRevokedCerts, serialMatch)
-		found = api.Select(matchFound, 1, found)
+// read returns the length bytes at index
+func (r *crlReader) read(index frontend.Variable, length int) []frontend.Variable {
+	return r.readAll([]frontend.Variable{index}, length)[0]
+}
 
-		// Move to next entry
-		entrySize := api.Add(api.Add(1, entryLenBytes), entryContentLen)
-		searchIndex = api.Add(searchIndex, entrySize)
+// readAll returns the length bytes at each index, in one lookup
+func (r *crlReader) readAll(indexes []frontend.Variable, length int) [][]frontend.Variable {
+	queries := make([]frontend.Variable, 0, len(indexes)*length)
+	for _, index := range indexes {
+		for i := range length {
+			queries = append(queries, r.api.Add(index, i))
+		}
 	}
+	values := r.table.Lookup(queries...)
+	result := make([][]frontend.Variable, len(indexes))
+	for i := range result {
+		result[i] = values[i*length : (i+1)*length]
+	}
+	return result
+}
 
-	return found
+// crlScanState is the state of the scan between two strides
+type crlScanState struct {
+	pos     frontend.Variable // position of the next entry
+	end     frontend.Variable // length of revokedCertificates, 0 without
+	scanned frontend.Variable // bytes of the scanned entries
+	active  frontend.Variable // 1 until the last entry is scanned
+	found   frontend.Variable // 1 once the serial is found
 }
 
-// CompareSerialNumbers compares a serial number in the CRL with the provided serial
-// Uses fixed-length comparison (maxSerialLen)
+// scanStride scans stride entries: the entry headers first, each entry
+// starting where the previous ends, then their serial numbers in one lookup
+func (r *crlReader) scanStride(s crlScanState, stride int, serial common.LengthedBytes) crlScanState {
+	api := r.api
+	serialStarts := make([]frontend.Variable, stride)
+	actives := make([]frontend.Variable, stride)
+	for i := range stride {
+		// Each entry is a SEQUENCE containing: serialNumber, revocationDate, [extensions]
+		at := api.Mul(s.active, s.pos)
+		entry := r.read(at, crlHeaderLen)
+		common.AssertEqual(api, api.Mul(s.active, api.Sub(entry[0], dertags.Sequence)), 0, "crl: revoked certificate SEQUENCE tag")
+		contentLen, lenBytes := derLength(api, entry[1:])
+		size := api.Add(1, lenBytes, contentLen)
+
+		serialStarts[i], actives[i] = api.Add(at, 1, lenBytes), s.active
+		s.pos = api.Add(s.pos, size)
+		s.scanned = api.Add(s.scanned, api.Mul(s.active, size))
+		// early exit: the entries after the last one are inactive
+		s.active = api.Mul(s.active, api.Sub(1, api.IsZero(api.Sub(s.end, s.scanned))))
+	}
+
+	// serialNumber INTEGER: tag, length octet compared with the serial
+	// length (at most 20 bytes, short form), then the bytes of the serial
+	for i, entry := range r.readAll(serialStarts, 2+len(serial.Data)) {
+		common.AssertEqual(api, api.Mul(actives[i], api.Sub(entry[0], dertags.Integer)), 0, "crl: revoked certificate serialNumber tag")
+		match := serial.Equal(api, common.LengthedBytes{Data: toU8(entry[2:]), Length: entry[1]})
+		s.found = api.Or(s.found, api.And(actives[i], match))
+	}
+	return s
+}
+
+// derLength decodes the DER length of its first up to 3 bytes as
+// ReadDERLength and returns (length_value, bytes_used_for_length)
+func derLength(api frontend.API, b []frontend.Variable) (frontend.Variable, frontend.Variable) {
+	bits := api.ToBinary(b[0], 8)
+	isShortForm := api.IsZero(bits[7])
+
+	numLengthBytes := api.Sub(b[0], dertags.LongFormLength)
+	isOneByte := api.IsZero(api.Sub(numLengthBytes, 1))
+	longLength := api.Select(isOneByte, b[1], api.Add(api.Mul(b[1], 256), b[2]))
+
+	length := api.Select(isShortForm, b[0], longLength)
+	bytesUsed := api.Select(isShortForm, 1, api.Add(numLengthBytes, 1))
+	return length, bytesUsed
+}
+
+// toU8 wraps the bytes read from the CRL table as uints.U8
+func toU8(b []frontend.Variable) []uints.U8 {
+	bytes := make([]uints.U8, len(b))
+	for i := range b {
+		bytes[i] = uints.U8{Val: b[i]}
+	}
+	return bytes
+}
+
+// CompareSerialNumbers compares the serialNumber INTEGER at crlSerialPos in
+// the CRL with the serial: returns 1 if the tag is INTEGER and the length and
+// the bytes are the serial's, 0 otherwise
 func CompareSerialNumbers(
 	api frontend.API,
 	crlBytes []uints.U8,
-	crlSerialStart frontend.Variable,
-	serialBytes []uints.U8,
-	maxSerialLen int,
+	crlSerialPos frontend.Variable,
+	serial common.LengthedBytes,
 ) frontend.Variable {
-	// Compare each byte up to maxSerialLen
-	allMatch := frontend.Variable(1)
-	for i := range maxSerialLen {
-		crlByte := ReadByteAt(api, crlBytes, api.Add(crlSerialStart, i))
-		byteMatch := api.IsZero(api.Sub(crlByte.Val, serialBytes[i].Val))
-		allMatch = api.And(allMatch, byteMatch)
+	tag := ReadByteAt(api, crlBytes, crlSerialPos)
+	length := ReadByteAt(api, crlBytes, api.Add(crlSerialPos, 1))
+	crlSerial := make([]uints.U8, len(serial.Data))
+	for i := range crlSerial {
+		crlSerial[i] = ReadByteAt(api, crlBytes, api.Add(crlSerialPos, 2, i))
 	}
 
-	return allMatch
+	return api.And(
+		api.IsZero(api.Sub(tag.Val, dertags.Integer)),
+		serial.Equal(api, common.LengthedBytes{Data: crlSerial, Length: length.Val}),
+	)
+}
+
+// serialMask returns, for each of the maxSerialLen bytes of a serial, 1 if
+// the byte is before length, 0 otherwise
+func serialMask(api frontend.API, length frontend.Variable, maxSerialLen int) []frontend.Variable {
+	mask := make([]frontend.Variable, maxSerialLen)
+	inSerial := frontend.Variable(1)
+	for i := range mask {
+		inSerial = api.Sub(inSerial, api.IsZero(api.Sub(length, i)))
+		mask[i] = inSerial
+	}
+	return mask
 }
 
 // IsLessThan returns 1 if a < b, 0 otherwise
@@ -176,52 +427,87 @@ func IsLessThan(api frontend.API, a, b frontend.Variable) frontend.Variable {
 	return api.Sub(1, isZero)
 }
 
-// ExtractSerialFromCert extracts the serial number bytes from a certificate
+// ExtractSerialFromCert extracts the serial number bytes from a certificate,
+// see extractSerialAt
 func ExtractSerialFromCert(
 	api frontend.API,
 	certBytes []uints.U8,
 	maxSerialLen int,
-) []uints.U8 {
+) common.LengthedBytes {
 	index := frontend.Variable(0)
 
 	// Skip outer Certificate SEQUENCE
 	tag := ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: Certificate SEQUENCE tag")
 	index = api.Add(index, 1)
 	_, lengthBytes := ReadDERLength(api, certBytes, index)
 	index = api.Add(index, lengthBytes)
 
+	return extractSerialAt(api, certBytes, index, maxSerialLen)
+}
+
+// ExtractSerialFromTBS extracts the serial number bytes from a
+// TBSCertificate, see extractSerialAt
+func ExtractSerialFromTBS(
+	api frontend.API,
+	tbsBytes []uints.U8,
+	maxSerialLen int,
+) common.LengthedBytes {
+	return extractSerialAt(api, tbsBytes, 0, maxSerialLen)
+}
+
+// extractSerialAt extracts the serial number of the TBSCertificate at index:
+// the content bytes of the serialNumber INTEGER (with its sign byte), zero
+// padded to maxSerialLen, and their length. The length is in short form and
+// from 1 to maxSerialLen (at most 20 bytes, RFC 5280), a longer serial is
+// rejected instead of being truncated.
+func extractSerialAt(
+	api frontend.API,
+	certBytes []uints.U8,
+	index frontend.Variable,
+	maxSerialLen int,
+) common.LengthedBytes {
+	if maxSerialLen <= 0 || maxSerialLen >= dertags.LongFormLength {
+		panic(fmt.Sprintf("crl: invalid maximal serial length %d", maxSerialLen))
+	}
+
 	// Enter TBSCertificate SEQUENCE
-	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	tag := ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: TBSCertificate SEQUENCE tag")
 	index = api.Add(index, 1)
-	_, lengthBytes = ReadDERLength(api, certBytes, index)
+	_, lengthBytes := ReadDERLength(api, certBytes, index)
 	index = api.Add(index, lengthBytes)
 
 	// Field 1: Version [0] EXPLICIT (optional)
 	tag = ReadByteAt(api, certBytes, index)
-	hasVersion := api.IsZero(api.Sub(tag.Val, 0xA0))
+	hasVersion := api.IsZero(api.Sub(tag.Val, dertags.Explicit0))
 	skipAmount := api.Select(hasVersion, SkipElement(api, certBytes, index), 0)
 	index = api.Add(index, skipAmount)
 
 	// Field 2: Serial Number (INTEGER 0x02)
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x02)
+	common.AssertEqual(api, tag.Val, dertags.Integer, "cert: serialNumber INTEGER tag")
 	index = api.Add(index, 1)
 
-	// Read serial length
-	_, lengthBytes = ReadDERLength(api, certBytes, index)
-	index = api.Add(index, lengthBytes)
+	// Serial length, short form from 1 to maxSerialLen
+	length := ReadByteAt(api, certBytes, index).Val
+	isLength := frontend.Variable(0)
+	for l := 1; l <= maxSerialLen; l++ {
+		isLength = api.Add(isLength, api.IsZero(api.Sub(length, l)))
+	}
+	common.Assert(api, isLength, "cert: serialNumber length of at most %d bytes", maxSerialLen)
+	index = api.Add(index, 1)
 
-	// Extract serial bytes up to maxSerialLen
+	// Extract the serial bytes, zero past the length
+	inSerial := serialMask(api, length, maxSerialLen)
 	serialBytes := make([]uints.U8, maxSerialLen)
-
 	for i := range maxSerialLen {
-		byte := ReadByteAt(api, certBytes, api.Add(index, i))
-		serialBytes[i] = byte
+		b := ReadByteAt(api, certBytes, api.Add(index, i))
+		serialBytes[i] = uints.NewU8(0)
+		serialBytes[i].Val = api.Mul(inSerial[i], b.Val)
 	}
 
-	return serialBytes
+	return common.LengthedBytes{Data: serialBytes, Length: length}
 }
 
 // VerifySerialNotRevoked is a high-level function that extracts the serial
@@ -236,8 +522,86 @@ func VerifySerialNotRevoked(
 	serialBytes := ExtractSerialFromCert(api, certBytes, maxSerialLen)
 
 	// Check if serial is in CRL
-	isRevoked := CheckSerialInCRL(api, crlBytes, serialBytes, maxSerialLen)
+	isRevoked := CheckSerialInCRL(api, crlBytes, serialBytes)
 
 	// Assert the certificate is NOT revoked
-	api.AssertIsEqual(isRevoked, 0)
+	common.AssertEqual(api, isRevoked, 0, "crl: certificate serial is not revoked")
+}
+
+// AssertCRLFresh asserts thisUpdate <= now <= nextUpdate, thisUpdate and
+// nextUpdate are the positions returned by NavigateToCRLUpdates. A CRL
+// without nextUpdate is rejected.
+func AssertCRLFresh(
+	api frontend.API,
+
+	crlBytes []uints.U8,
+	thisUpdate, nextUpdate frontend.Variable,
+	now []uints.U8,
+) error {
+	thisUpdateTime := ReadCRLTime(api, crlBytes, thisUpdate, "thisUpdate")
+	nextUpdateTime := ReadCRLTime(api, crlBytes, nextUpdate, "nextUpdate")
+
+	// now < thisUpdate: the CRL is not issued yet
+	notYetValid, err := common.IsSmaller(api, now, thisUpdateTime)
+	if err != nil {
+		return err
+	}
+	common.AssertEqual(api, notYetValid, 0, "crl: thisUpdate is not after Now")
+
+	// nextUpdate < now: the CRL is stale
+	stale, err := common.IsSmaller(api, nextUpdateTime, now)
+	if err != nil {
+		return err
+	}
+	common.AssertEqual(api, stale, 0, "crl: nextUpdate is not before Now")
+
+	return nil
+}
+
+// ReadCRLTime reads the UTCTime (YYMMDDHHMMSSZ) or GeneralizedTime
+// (YYYYMMDDHHMMSSZ) at index and returns it as YYYYMMDDHHMMSS, so times of both
+// encodings compare lexicographically. UTCTime years 50-99 are 19YY, 00-49 are
+// 20YY (RFC 5280, section 4.1.2.5.1).
+func ReadCRLTime(
+	api frontend.API,
+
+	data []uints.U8,
+	index frontend.Variable,
+	field string,
+) []uints.U8 {
+	// tag, length and up to 15 bytes of content
+	element := readBytesAt(api, data, index, 2+15)
+
+	tag := element[0].Val
+	isGeneralized := api.IsZero(api.Sub(tag, dertags.GeneralizedTime))
+	isUTC := api.IsZero(api.Sub(tag, dertags.UTCTime))
+	common.Assert(api, api.Or(isGeneralized, isUTC), "crl: %s time tag", field)
+
+	length := api.Select(isGeneralized, 15, 13)
+	common.AssertEqual(api, element[1].Val, length, "crl: %s time length", field)
+
+	zulu := api.Select(isGeneralized, element[16].Val, element[14].Val)
+	common.AssertEqual(api, zulu, 'Z', "crl: %s time zone", field)
+
+	// UTCTime century: YY >= 50 is 19YY
+	is19 := api.Sub(1, api.IsZero(api.Add(api.Cmp(element[2].Val, '5'), 1)))
+	century := []frontend.Variable{api.Select(is19, '1', '2'), api.Select(is19, '9', '0')}
+
+	result := make([]uints.U8, CRLTimeLen)
+	for i := range CRLTimeLen {
+		var utc frontend.Variable
+		if i < 2 {
+			utc = century[i]
+		} else {
+			utc = element[i].Val
+		}
+		result[i] = uints.NewU8(0)
+		result[i].Val = api.Select(isGeneralized, element[2+i].Val, utc)
+	}
+	return result
+}
+
+// FormatCRLTime formats t as the Now input of CircuitCRL
+func FormatCRLTime(t time.Time) []byte {
+	return []byte(t.UTC().Format("20060102150405"))
 }
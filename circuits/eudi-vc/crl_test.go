@@ -7,11 +7,13 @@ import (
 	"crypto/sha1"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"math/big"
 	"testing"
 	"time"
 
+	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/math/uints"
 	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
 	"github.com/mynextid/eudi-zk/common"
@@ -148,6 +150,7 @@ func TestCRLNotRevoked(t *testing.T) {
 	circuitTemplate := &cdl.CircuitCRL{
 		CertBytes:    make([]uints.U8, len(certDER)),
 		CRLBytes:     make([]uints.U8, len(crlDER)),
+		Now:          make([]uints.U8, cdl.CRLTimeLen),
 		MaxSerialLen: maxSerialLen,
 	}
 
@@ -155,6 +158,8 @@ func TestCRLNotRevoked(t *testing.T) {
 	assignment := &cdl.CircuitCRL{
 		CertBytes:    common.BytesToU8Array(certDER),
 		CRLBytes:     common.BytesToU8Array(crlDER),
+		Now:          common.BytesToU8Array(cdl.FormatCRLTime(time.Now())),
+		Status:       cdl.CRLStatusNotRevoked,
 		MaxSerialLen: maxSerialLen,
 	}
 
@@ -181,9 +186,9 @@ func TestCRLNotRevoked(t *testing.T) {
 func TestCRLRevoked(t *testing.T) {
 
 	// == Circuit data ==
-	ccsPath := "compiled/circuit-crl-v1.ccs"
-	pkPath := "compiled/proving-crl-v1.key"
-	vkPath := "compiled/verifying-crl-v1.key"
+	ccsPath := "compiled/circuit-crl-revoked-v1.ccs"
+	pkPath := "compiled/proving-crl-revoked-v1.key"
+	vkPath := "compiled/verifying-crl-revoked-v1.key"
 	// true: recompile, false: load circuit if exists
 	forceCompile := false
 
@@ -309,6 +314,7 @@ func TestCRLRevoked(t *testing.T) {
 	circuitTemplate := &cdl.CircuitCRL{
 		CertBytes:    make([]uints.U8, len(certDER)),
 		CRLBytes:     make([]uints.U8, len(crlDER)),
+		Now:          make([]uints.U8, cdl.CRLTimeLen),
 		MaxSerialLen: maxSerialLen,
 	}
 
@@ -316,9 +322,20 @@ func TestCRLRevoked(t *testing.T) {
 	assignment := &cdl.CircuitCRL{
 		CertBytes:    common.BytesToU8Array(certDER),
 		CRLBytes:     common.BytesToU8Array(crlDER),
+		Now:          common.BytesToU8Array(cdl.FormatCRLTime(time.Now())),
+		Status:       cdl.CRLStatusRevoked,
 		MaxSerialLen: maxSerialLen,
 	}
 
+	// the scan result is proven: the revoked certificate cannot be proven
+	// not revoked
+	notRevoked := *assignment
+	notRevoked.Status = cdl.CRLStatusNotRevoked
+	var werr *common.WitnessError
+	if err := common.CheckWitness(circuitTemplate, &notRevoked); !errors.As(err, &werr) || werr.Label != "crl: certificate revocation status" {
+		t.Fatalf("expected the revocation status assertion to fail, got %v", err)
+	}
+
 	// == Init the circuit ==
 	fmt.Println("\n--- Init the circuit ---")
 	startCircuit := time.Now()
@@ -338,3 +355,262 @@ func TestCRLRevoked(t *testing.T) {
 	fmt.Println("\n[OK] Circuit proof generated and verified successfully!")
 	fmt.Println("[OK] Certificate is proven to be revoked")
 }
+
+func TestCRLFreshness(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		thisUpdate time.Time
+		nextUpdate time.Time
+		now        time.Time
+		fresh      bool
+	}{
+		{"fresh", now.Add(-time.Hour), now.Add(24 * time.Hour), now, true},
+		{"nextUpdate equals now", now.Add(-time.Hour), now, now, true},
+		{"stale", now.Add(-48 * time.Hour), now.Add(-time.Second), now, false},
+		{"not yet issued", now.Add(time.Second), now.Add(24 * time.Hour), now, false},
+		// GeneralizedTime from 2050
+		{"generalized time", now.Add(-time.Hour), time.Date(2051, 1, 1, 0, 0, 0, 0, time.UTC), now, true},
+		{"generalized time stale", now.Add(-time.Hour), time.Date(2051, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2052, 1, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certDER, crlDER := mockCRL(t, tt.thisUpdate, tt.nextUpdate)
+
+			circuitTemplate := cdl.NewCircuitCRL(len(certDER), len(crlDER))
+			circuitTemplate.MaxSerialLen = 20
+			assignment := &cdl.CircuitCRL{
+				CertBytes: common.BytesToU8Array(certDER),
+				CRLBytes:  common.BytesToU8Array(crlDER),
+				Now:       common.BytesToU8Array(cdl.FormatCRLTime(tt.now)),
+				Status:    cdl.CRLStatusNotRevoked,
+			}
+
+			err := common.CheckWitness(circuitTemplate, assignment)
+			if tt.fresh && err != nil {
+				t.Fatalf("witness check failed: %v", err)
+			}
+			if !tt.fresh && err == nil {
+				t.Fatal("expected the witness check to fail for a CRL that is not fresh")
+			}
+		})
+	}
+}
+
+func TestCRLScan(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	serials := func(n int, revoked ...int64) []int64 {
+		var out []int64
+		for i := range n {
+			out = append(out, 1000+int64(i))
+		}
+		return append(out, revoked...)
+	}
+
+	tests := []struct {
+		name    string
+		revoked []int64
+		scan    cdl.CRLScan
+		status  int
+		label   string
+	}{
+		{"revoked in the last stride", serials(6, 12345), cdl.CRLScan{MaxEntries: 8, Stride: 3}, cdl.CRLStatusRevoked, ""},
+		{"not revoked", serials(7), cdl.CRLScan{MaxEntries: 8, Stride: 3}, cdl.CRLStatusNotRevoked, ""},
+		{"one entry per stride", serials(2, 12345), cdl.CRLScan{MaxEntries: 3, Stride: 1}, cdl.CRLStatusRevoked, ""},
+		{"default scan", serials(9, 12345), cdl.CRLScan{}, cdl.CRLStatusRevoked, ""},
+		// the revoked serial is past the scanned entries
+		{"too many entries", serials(11, 12345), cdl.CRLScan{}, cdl.CRLStatusNotRevoked, "crl: revokedCertificates of at most 10 entries"},
+		{"too many entries in the last stride", serials(4), cdl.CRLScan{MaxEntries: 3, Stride: 3}, cdl.CRLStatusNotRevoked, "crl: revokedCertificates of at most 3 entries"},
+		// 12345 is 0x3039: serials of other lengths sharing its bytes
+		{"serials sharing a prefix", []int64{0x30, 0x303901, 0x3039FF00}, cdl.CRLScan{MaxEntries: 3, Stride: 3}, cdl.CRLStatusNotRevoked, ""},
+		{"revoked among serials sharing a prefix", []int64{0x30, 0x303901, 12345}, cdl.CRLScan{MaxEntries: 3, Stride: 3}, cdl.CRLStatusRevoked, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certDER, crlDER := mockCRLWith(t, now.Add(-time.Hour), now.Add(24*time.Hour), tt.revoked)
+
+			circuitTemplate := cdl.NewCircuitCRL(len(certDER), len(crlDER))
+			circuitTemplate.MaxSerialLen = 20
+			circuitTemplate.MaxEntries, circuitTemplate.Stride = tt.scan.MaxEntries, tt.scan.Stride
+			assignment := &cdl.CircuitCRL{
+				CertBytes: common.BytesToU8Array(certDER),
+				CRLBytes:  common.BytesToU8Array(crlDER),
+				Now:       common.BytesToU8Array(cdl.FormatCRLTime(now)),
+				Status:    tt.status,
+			}
+
+			err := common.CheckWitness(circuitTemplate, assignment)
+			if tt.label == "" {
+				if err != nil {
+					t.Fatalf("witness check failed: %v", err)
+				}
+				return
+			}
+			var werr *common.WitnessError
+			if !errors.As(err, &werr) || werr.Label != tt.label {
+				t.Fatalf("expected the assertion %q to fail, got %v", tt.label, err)
+			}
+		})
+	}
+
+	if n := (cdl.CRLScan{MaxEntries: 8, Stride: 3}).Entries(); n != 9 {
+		t.Fatalf("%d scanned entries, expected 9", n)
+	}
+}
+
+type serialCircuit struct {
+	MaxSerialLen int `gnark:"-"`
+	TBS          []uints.U8
+	Serial       []uints.U8
+	Length       frontend.Variable
+}
+
+func (c *serialCircuit) Define(api frontend.API) error {
+	serial := cdl.ExtractSerialFromTBS(api, c.TBS, c.MaxSerialLen)
+	common.AssertBytesEqual(api, serial.Data, c.Serial, "serial")
+	common.AssertEqual(api, serial.Length, c.Length, "serial length")
+	return nil
+}
+
+func TestExtractSerialFromTBS(t *testing.T) {
+	version := []byte{0xA0, 0x03, 0x02, 0x01, 0x02}
+	algorithm := []byte{0x30, 0x03, 0x06, 0x01, 0x00}
+	tbs := func(serial []byte) []byte {
+		content := der(version, serial, algorithm)
+		return der([]byte{0x30, byte(len(content))}, content)
+	}
+
+	tests := []struct {
+		name   string
+		serial []byte // the serialNumber element
+		want   []byte // the 4 bytes of the extracted serial
+		length int
+		valid  bool
+	}{
+		{"short serial", []byte{0x02, 0x02, 0x30, 0x39}, []byte{0x30, 0x39, 0, 0}, 2, true},
+		{"sign byte", []byte{0x02, 0x02, 0x00, 0x80}, []byte{0x00, 0x80, 0, 0}, 2, true},
+		{"maximal length", []byte{0x02, 0x04, 1, 2, 3, 4}, []byte{1, 2, 3, 4}, 4, true},
+		// the bytes following a short serial are not part of it
+		{"trailing bytes", []byte{0x02, 0x02, 0x30, 0x39}, []byte{0x30, 0x39, 0x30, 0x03}, 4, false},
+		{"longer serial", []byte{0x02, 0x05, 1, 2, 3, 4, 5}, []byte{1, 2, 3, 4}, 4, false},
+		{"empty serial", []byte{0x02, 0x00}, []byte{0, 0, 0, 0}, 0, false},
+		{"OCTET STRING", []byte{0x04, 0x02, 0x30, 0x39}, []byte{0x30, 0x39, 0, 0}, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			circuit := &serialCircuit{
+				MaxSerialLen: 4,
+				TBS:          common.BytesToU8Array(tbs(tt.serial)),
+				Serial:       common.BytesToU8Array(tt.want),
+				Length:       tt.length,
+			}
+			err := common.CheckWitness(circuit, circuit)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			var werr *common.WitnessError
+			if !tt.valid && !errors.As(err, &werr) {
+				t.Fatalf("expected a witness error, got %v", err)
+			}
+		})
+	}
+}
+
+type compareSerialCircuit struct {
+	CRL    []uints.U8
+	Serial []uints.U8
+	Length frontend.Variable
+	Match  frontend.Variable
+}
+
+func (c *compareSerialCircuit) Define(api frontend.API) error {
+	match := cdl.CompareSerialNumbers(api, c.CRL, 0, common.LengthedBytes{Data: c.Serial, Length: c.Length})
+	common.AssertEqual(api, match, c.Match, "serial match")
+	return nil
+}
+
+func TestCompareSerialNumbers(t *testing.T) {
+	// the serialNumber of a revoked certificate entry, then its revocationDate
+	crl := []byte{0x02, 0x02, 0x30, 0x39, 0x17, 0x0D, '2', '5'}
+
+	tests := []struct {
+		name   string
+		serial []byte
+		length int
+		match  int
+	}{
+		{"same serial", []byte{0x30, 0x39, 0, 0}, 2, 1},
+		{"prefix", []byte{0x30, 0, 0, 0}, 1, 0},
+		{"serial extending it", []byte{0x30, 0x39, 0x17, 0}, 3, 0},
+		{"other serial", []byte{0x30, 0x3A, 0, 0}, 2, 0},
+		{"length past the serial", []byte{0x30, 0x39, 0, 0}, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			circuit := &compareSerialCircuit{
+				CRL:    common.BytesToU8Array(crl),
+				Serial: common.BytesToU8Array(tt.serial),
+				Length: tt.length,
+				Match:  tt.match,
+			}
+			if err := common.CheckWitness(circuit, circuit); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// mockCRL returns a certificate and a CRL (not revoking it) with the given
+// update times
+func mockCRL(t *testing.T, thisUpdate, nextUpdate time.Time) ([]byte, []byte) {
+	t.Helper()
+	return mockCRLWith(t, thisUpdate, nextUpdate, []int64{1111})
+}
+
+// mockCRLWith returns a certificate of serial 12345 and a CRL with the given
+// update times revoking the serials
+func mockCRLWith(t *testing.T, thisUpdate, nextUpdate time.Time, revoked []int64) ([]byte, []byte) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Certificate Authority"},
+		NotBefore:             thisUpdate.Add(-time.Hour),
+		NotAfter:              nextUpdate.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}
+	certTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(12345),
+		Subject:      pkix.Name{CommonName: "Test Certificate"},
+		NotBefore:    thisUpdate.Add(-time.Hour),
+		NotAfter:     nextUpdate.Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []x509.RevocationListEntry
+	for _, serial := range revoked {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: thisUpdate})
+	}
+	crlDER, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                nextUpdate,
+		RevokedCertificateEntries: entries,
+	}, caTemplate, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certDER, crlDER
+}
@@ -1,11 +1,13 @@
 package cdl
 
 import (
+	"fmt"
+
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
-	"github.com/consensys/gnark/std/signature/ecdsa"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 // CircuitEUDI proves:
@@ -15,6 +17,29 @@ import (
 // 4. VC signature is verified with the public key of the issuer (public input)
 // 5. VC contains the my (subject's) public key
 // 6. Without revealing the certificate or the public key
+//
+// With IssuerCertified the issuer key is not a public input: the prover
+// supplies the issuer certificate privately and proves that it is signed by
+// the trust anchor (public input) and contains the key that verifies the VC.
+//
+// With KeyRotations the VC binds a retired holder key: the prover supplies the
+// chain of rotations from the cnf-bound key to the certified key signing the
+// challenge, see KeyRotations.
+//
+// With Pairwise the holder is presented under a pseudonym per verifier: the
+// public PairwiseID is derived from a private HolderSecret and the verifier
+// id of the session transcript (common.PairwiseID), so it is stable across
+// the presentations to a verifier and unlinkable across verifiers. The VC
+// binds the secret: its protected header commits to it (the hsc claim, see
+// models.HolderSecret.Commit) and the circuit proves the opening with the
+// private HolderSalt, so the holder cannot derive the identifier from
+// another secret. A holder rotating the secret needs a new VC.
+//
+// The holder signs the challenge in the presentation signing context
+// (models.ContextMessage, models.SigningContextChallenge), so a signature of
+// the holder key over an issuer protocol message does not verify as a
+// challenge signature; LegacyChallenge accepts the bare challenge of the
+// wallets signing before the signing contexts.
 type CircuitEUDI struct {
 	// ===== PRIVATE INPUTS (prover's secrets) =====
 
@@ -22,19 +47,19 @@ type CircuitEUDI struct {
 	CertBytes  []uints.U8        `gnark:",secret"`
 	CertLength frontend.Variable `gnark:",secret"`
 	// Certificate signature
-	CertSigR emulated.Element[Secp256r1Fr] `gnark:",secret"`
-	CertSigS emulated.Element[Secp256r1Fr] `gnark:",secret"`
+	CertSigR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	CertSigS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
 
 	// Position of subject public key in certificate (from off-circuit parsing)
 	SubjectPubKeyPos frontend.Variable `gnark:",secret"`
 
 	// The subject public key (secret - must match the subject key in the certificate)
-	SubjectPubKeyX emulated.Element[Secp256r1Fp] `gnark:",secret"`
-	SubjectPubKeyY emulated.Element[Secp256r1Fp] `gnark:",secret"`
+	SubjectPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SubjectPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
 
 	// Signature on the challenge (secret) - by the holder
-	ChallengeSignatureR emulated.Element[Secp256r1Fr] `gnark:",secret"`
-	ChallengeSignatureS emulated.Element[Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
 
 	// VC JWS header
 	JWSProtected []uints.U8 `gnark:",secret"`
@@ -44,88 +69,304 @@ type CircuitEUDI struct {
 	CnfKeyHexPosition frontend.Variable `gnark:",secret"` // public key position within the decoded cnfB64
 
 	// VC Signature
-	JWSR emulated.Element[Secp256r1Fr] `gnark:",secret"`
-	JWSS emulated.Element[Secp256r1Fr] `gnark:",secret"`
+	JWSR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	JWSS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// Issuer certificate (IssuerCertified)
+	IssuerCertBytes   []uints.U8                           `gnark:",secret"` // TBSCertificate of the issuer certificate
+	IssuerCertSigR    emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	IssuerCertSigS    emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	IssuerCertPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	IssuerCertPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+
+	// Retired holder keys (KeyRotations), the cnf-bound key first; each key
+	// signs the rotation statement of the next one, the last the subject key
+	RotatedPubKeysX []emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	RotatedPubKeysY []emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	RotationSigR    []emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	RotationSigS    []emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// Secret of the pairwise identifiers (Pairwise), empty otherwise
+	HolderSecret []uints.U8 `gnark:",secret"`
+	// Opening of the commitment to the secret in the header (Pairwise), the
+	// positions of one element each
+	HolderSalt                  []uints.U8          `gnark:",secret"`
+	HolderCommitmentB64         []uints.U8          `gnark:",secret"` // base64url encoded hsc part of the header
+	HolderCommitmentB64Position []frontend.Variable `gnark:",secret"` // HolderCommitmentB64 start position in the header
+	HolderCommitmentHexPosition []frontend.Variable `gnark:",secret"` // commitment position within the decoded HolderCommitmentB64
 
 	// ===== PUBLIC INPUTS (known to verifier) =====
-	// Verifier's challenge
+	// Verifier's challenge (ChallengeInteractive, ChallengeTimestamped), the
+	// nonce of the transcript (ChallengeTranscript)
 	Challenge []uints.U8 `gnark:",public"`
+	// Verifier-supplied unix time of the signature (ChallengeTimestamped),
+	// one element, see common.TimestampedChallenge
+	ChallengeTimestamp []frontend.Variable `gnark:",public"`
+	// Challenge context (ChallengeDerived), see models.ChallengeContext
+	AudienceDigest    []uints.U8 `gnark:",public"` // SHA-256 of the audience
+	TimeWindow        []uints.U8 `gnark:",public"` // window index, 8 bytes big-endian
+	WindowGranularity []uints.U8 `gnark:",public"` // window size in seconds, 8 bytes big-endian
+	// Session transcript (ChallengeTranscript), see models.SessionTranscript,
+	// each zero padded to its size
+	TranscriptVerifierID  []uints.U8 `gnark:",public"` // client_id of the verifier
+	TranscriptResponseURI []uints.U8 `gnark:",public"` // response_uri of the request
+	TranscriptVPFormats   []uints.U8 `gnark:",public"` // vp_formats of the request
+	// Pseudonym of the holder for the verifier of the transcript (Pairwise),
+	// one element, see common.PairwiseID
+	PairwiseID []frontend.Variable `gnark:",public"`
 	// CA's/QTSP's Public key -- validates the subject's cert signature
-	CAPubKeyX emulated.Element[Secp256r1Fp] `gnark:",public"`
-	CAPubKeyY emulated.Element[Secp256r1Fp] `gnark:",public"`
+	CAPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	CAPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+
+	// VC issuer's public key -- validates the VC signature (IssuerPinned)
+	IssuerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	IssuerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
 
-	// VC issuer's public key -- validates the VC signature
-	IssuerPubKeyX emulated.Element[Secp256r1Fp] `gnark:",public"`
-	IssuerPubKeyY emulated.Element[Secp256r1Fp] `gnark:",public"`
+	// Trust anchor's public key -- validates the issuer certificate signature
+	// (IssuerCertified)
+	TrustAnchorX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	TrustAnchorY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
 
 	// VC Payload
 	JWSPayload []uints.U8 `gnark:",public"`
+	// Variable-length payload (PayloadBlocks), see common.PayloadBlocks.Inputs
+	JWSPayloadLen    []frontend.Variable `gnark:",public"` // payload length
+	JWSPayloadBlocks []frontend.Variable `gnark:",secret"` // number of payload blocks
+
+	// Circuit parameters set at compile time
+	ChallengeMode ChallengeMode        `gnark:"-"`
+	IssuerTrust   IssuerTrust          `gnark:"-"`
+	PayloadBlocks common.PayloadBlocks `gnark:"-"` // zero for a fixed-size payload
+	// KeyRotations is the number of holder key rotations since the VC was
+	// issued, zero when the cnf binds the subject key
+	KeyRotations int `gnark:"-"`
+	// Pairwise exposes the pairwise identifier of the holder, with
+	// ChallengeTranscript
+	Pairwise bool `gnark:"-"`
+	// LegacyChallenge verifies the signature of the bare challenge, for the
+	// wallets signing before the signing contexts; the holder signs the
+	// challenge in common.SigningContextChallenge otherwise
+	LegacyChallenge bool `gnark:"-"`
 }
 
+// ChallengeMode selects how the challenge signed by the holder is obtained
+type ChallengeMode int
+
+const (
+	// ChallengeInteractive: the verifier issues the challenge (nonce)
+	ChallengeInteractive ChallengeMode = iota
+	// ChallengeDerived: the challenge is derived in-circuit from the payload,
+	// the audience and the time window (common.DeriveChallenge), for offline
+	// flows without a nonce exchange
+	ChallengeDerived
+	// ChallengeTimestamped: the holder signs the verifier's challenge and a
+	// verifier-supplied timestamp (common.TimestampedChallenge), a public
+	// input the verifier checks against its clock (models.TimestampPolicy)
+	ChallengeTimestamped
+	// ChallengeTranscript: the holder signs the hash of the session transcript
+	// (common.TranscriptChallenge), the verifier's nonce with its identifier,
+	// response URI and accepted formats, so the signature cannot be replayed
+	// in another presentation context
+	ChallengeTranscript
+)
+
+// IssuerTrust selects how the key verifying the VC signature is trusted
+type IssuerTrust int
+
+const (
+	// IssuerPinned: the verifier trusts the issuer key (public input)
+	IssuerPinned IssuerTrust = iota
+	// IssuerCertified: the verifier trusts an anchor that certified the issuer
+	// key; the issuer certificate and key stay private
+	IssuerCertified
+)
+
 // Define implements the circuit logic
 func (c *CircuitEUDI) Define(api frontend.API) error {
+	payload := common.JWSPart{Bytes: c.JWSPayload}
+	if c.PayloadBlocks.Enabled() {
+		var err error
+		payload, err = c.PayloadBlocks.Part(api, c.JWSPayload, c.JWSPayloadLen, c.JWSPayloadBlocks)
+		if err != nil {
+			return err
+		}
+	}
 
 	// ===== STEP 1: Navigate certificate structure to find SubjectPublicKeyInfo =====
 	// This proves we're at the SUBJECT's public key, not the issuer's or any other key
-	subjectPubKeyPos := NavigateToSubjectPublicKeyInfoInTBS(api, c.CertBytes[:])
+	spkiPos := NavigateToSPKIInTBS(api, c.CertBytes[:])
 
-	// ===== STEP 2: Verify claimed position matches the proven position =====
-	api.AssertIsEqual(subjectPubKeyPos, c.SubjectPubKeyPos)
+	// ===== STEP 2: Extract subject public key from the SubjectPublicKeyInfo =====
+	extractedPubKey, subjectPubKeyPos := ExtractSubjectPublicKeyFromSPKI(api, c.CertBytes[:], spkiPos)
 
-	// ===== STEP 3: Extract subject public key from certificate =====
-	extractedPubKey := ExtractSubjectPublicKeyFromCert(
-		api,
-		c.CertBytes[:],
-		subjectPubKeyPos, // Use the proven position
-	)
+	// ===== STEP 3: Verify claimed position matches the proven position =====
+	common.AssertEqual(api, subjectPubKeyPos, c.SubjectPubKeyPos, "subject public key position")
 
 	// ===== STEP 4: Verify extracted key matches the claimed public key =====
 	// common.CompareBytes(api, extractedPubKey, circuit.SignerPubKeyBytes)
 	common.ComparePublicKeys(api, c.SubjectPubKeyX, c.SubjectPubKeyY, extractedPubKey)
 
 	// ===== STEP 5: Verify signature on challenge =====
-	publicKey := ecdsa.PublicKey[Secp256r1Fp, Secp256r1Fr]{
-		X: c.SubjectPubKeyX,
-		Y: c.SubjectPubKeyY,
-	}
+	publicKey := curves.NewPublicKey(c.SubjectPubKeyX, c.SubjectPubKeyY)
 
-	signature := ecdsa.Signature[Secp256r1Fr]{
-		R: c.ChallengeSignatureR,
-		S: c.ChallengeSignatureS,
+	signature := curves.NewSignature(c.ChallengeSignatureR, c.ChallengeSignatureS)
+
+	challenge := c.Challenge
+	switch c.ChallengeMode {
+	case ChallengeDerived:
+		var err error
+		challenge, err = common.DeriveChallengePart(api, payload, c.AudienceDigest, c.TimeWindow, c.WindowGranularity)
+		if err != nil {
+			return err
+		}
+	case ChallengeTranscript:
+		var err error
+		challenge, err = common.TranscriptChallenge(api, c.Challenge, c.TranscriptVerifierID, c.TranscriptResponseURI, c.TranscriptVPFormats)
+		if err != nil {
+			return err
+		}
+	case ChallengeTimestamped:
+		if len(c.ChallengeTimestamp) != 1 {
+			return fmt.Errorf("timestamped challenge needs one timestamp, got %d", len(c.ChallengeTimestamp))
+		}
+		var err error
+		challenge, err = common.TimestampedChallenge(api, c.Challenge, c.ChallengeTimestamp[0])
+		if err != nil {
+			return err
+		}
 	}
 
-	common.VerifyES256(api, c.Challenge, publicKey, signature)
+	if !c.LegacyChallenge {
+		var err error
+		if challenge, err = common.ContextMessage(api, common.SigningContextChallenge, challenge); err != nil {
+			return err
+		}
+	}
 
-	// ==== STEP 6: Verify the Certificate Signature ====
-	caPublicKey := ecdsa.PublicKey[Secp256r1Fp, Secp256r1Fr]{
-		X: c.CAPubKeyX,
-		Y: c.CAPubKeyY,
+	if err := common.VerifyES256(api, challenge, publicKey, signature); err != nil {
+		return err
 	}
 
-	certSignature := ecdsa.Signature[Secp256r1Fr]{
-		R: c.CertSigR,
-		S: c.CertSigS,
+	// ===== STEP 5b: Derive the pairwise identifier (Pairwise) =====
+	// for the verifier the holder signed the transcript for
+	if c.Pairwise {
+		if c.ChallengeMode != ChallengeTranscript {
+			return fmt.Errorf("pairwise identifier needs a transcript challenge")
+		}
+		if len(c.PairwiseID) != 1 {
+			return fmt.Errorf("pairwise identifier needs one element, got %d", len(c.PairwiseID))
+		}
+		if len(c.HolderCommitmentB64Position) != 1 || len(c.HolderCommitmentHexPosition) != 1 {
+			return fmt.Errorf("holder commitment needs one position each, got %d and %d", len(c.HolderCommitmentB64Position), len(c.HolderCommitmentHexPosition))
+		}
+		// the secret the VC commits to
+		if err := common.VerifyHolderCommitment(api, c.JWSProtected, c.HolderCommitmentB64, c.HolderCommitmentB64Position[0], c.HolderCommitmentHexPosition[0], c.HolderSalt, c.HolderSecret); err != nil {
+			return err
+		}
+		pid, err := common.PairwiseID(api, c.HolderSecret, c.TranscriptVerifierID)
+		if err != nil {
+			return err
+		}
+		common.AssertEqual(api, c.PairwiseID[0], pid, "pairwise identifier")
+	} else if len(c.HolderSecret) != 0 || len(c.HolderSalt) != 0 || len(c.HolderCommitmentB64) != 0 ||
+		len(c.HolderCommitmentB64Position) != 0 || len(c.HolderCommitmentHexPosition) != 0 || len(c.PairwiseID) != 0 {
+		return fmt.Errorf("pairwise inputs without Pairwise")
 	}
 
-	common.VerifyES256(api, c.CertBytes, caPublicKey, certSignature)
+	// ==== STEP 6: Verify the Certificate Signature ====
+	caPublicKey := curves.NewPublicKey(c.CAPubKeyX, c.CAPubKeyY)
 
-	// ===== STEP 7: Verify the VC (JWS) signature =====
-	issuerPublicKey := ecdsa.PublicKey[Secp256r1Fp, Secp256r1Fr]{
-		X: c.IssuerPubKeyX,
-		Y: c.IssuerPubKeyY,
+	certSignature := curves.NewSignature(c.CertSigR, c.CertSigS)
+
+	if err := common.VerifyES256(api, c.CertBytes, caPublicKey, certSignature); err != nil {
+		return err
 	}
 
-	jws := ecdsa.Signature[Secp256r1Fr]{
-		R: c.JWSR,
-		S: c.JWSS,
+	// ===== STEP 7: Verify the VC (JWS) signature =====
+	issuerPublicKey := curves.NewPublicKey(c.IssuerPubKeyX, c.IssuerPubKeyY)
+	if c.IssuerTrust == IssuerCertified {
+		issuerPublicKey = curves.NewPublicKey(c.IssuerCertPubKeyX, c.IssuerCertPubKeyY)
+		trustAnchor := curves.NewPublicKey(c.TrustAnchorX, c.TrustAnchorY)
+		issuerCertSignature := curves.NewSignature(c.IssuerCertSigR, c.IssuerCertSigS)
+		if err := VerifyCertifiedKey(api, c.IssuerCertBytes, issuerPublicKey, trustAnchor, issuerCertSignature); err != nil {
+			return err
+		}
+		assertUnused(api, &c.IssuerPubKeyX, &c.IssuerPubKeyY)
+	} else {
+		assertUnused(api, &c.IssuerCertPubKeyX, &c.IssuerCertPubKeyY, &c.TrustAnchorX, &c.TrustAnchorY)
+		assertUnused(api, &c.IssuerCertSigR, &c.IssuerCertSigS)
 	}
 
-	common.VerifyJWS(api, c.JWSProtected, c.JWSPayload, issuerPublicKey, jws)
+	jws := curves.NewSignature(c.JWSR, c.JWSS)
+
+	input, err := common.BuildSigningInput(api, common.JWSPart{Bytes: c.JWSProtected}, payload)
+	if err != nil {
+		return err
+	}
+	if err := common.VerifySigningInput(api, input, issuerPublicKey, jws); err != nil {
+		return err
+	}
 
 	// ===== STEP 8: Verify that the subject key == confirmation key ==
-	subjectPublicKeyDigest := common.PublicKeyDigest(api, c.SubjectPubKeyX, c.SubjectPubKeyY)
+	// or, after key rotations, that the confirmation key rotated to it
+	cnfKey, err := VerifyKeyRotations(api, publicKey, c.RotatedPubKeysX, c.RotatedPubKeysY, c.RotationSigR, c.RotationSigS, c.KeyRotations)
+	if err != nil {
+		return err
+	}
+	cnfKeyDigest := common.PublicKeyDigest(api, cnfKey.X, cnfKey.Y)
 
-	common.VerifyCnf(api, c.JWSProtected, c.CnfB64, c.CnfB64Position, c.CnfKeyHexPosition, subjectPublicKeyDigest)
+	common.VerifyCnf(api, c.JWSProtected, c.CnfB64, c.CnfB64Position, c.CnfKeyHexPosition, cnfKeyDigest)
 
 	return nil
 }
+
+// VerifyKeyRotations proves the chain of n holder key rotations ending with
+// the current key: the retired key i signed the rotation statement of key
+// i+1 (common.VerifyKeyRotation), the last one that of current. It returns
+// the first retired key, the key the VC binds, or current without rotations.
+func VerifyKeyRotations(
+	api frontend.API,
+	current curves.PublicKey,
+	keysX, keysY []emulated.Element[curves.Secp256r1Fp],
+	sigR, sigS []emulated.Element[curves.Secp256r1Fr],
+	n int,
+) (curves.PublicKey, error) {
+	if len(keysX) != n || len(keysY) != n || len(sigR) != n || len(sigS) != n {
+		return current, fmt.Errorf("%d key rotations need %d retired keys and signatures, got %d/%d keys and %d/%d signatures",
+			n, n, len(keysX), len(keysY), len(sigR), len(sigS))
+	}
+	next := current
+	for i := n - 1; i >= 0; i-- {
+		retired := curves.NewPublicKey(keysX[i], keysY[i])
+		signature := curves.NewSignature(sigR[i], sigS[i])
+		if err := common.VerifyKeyRotation(api, retired, next, signature); err != nil {
+			return current, err
+		}
+		next = retired
+	}
+	return next, nil
+}
+
+// VerifyCertifiedKey proves that the TBSCertificate tbs is signed by the CA
+// key and that its subject public key is key
+func VerifyCertifiedKey(
+	api frontend.API,
+	tbs []uints.U8,
+	key, ca curves.PublicKey,
+	signature curves.Signature,
+) error {
+	extractedPubKey, _ := ExtractSubjectPublicKeyFromSPKI(api, tbs, NavigateToSPKIInTBS(api, tbs))
+	common.ComparePublicKeys(api, key.X, key.Y, extractedPubKey)
+
+	return common.VerifyES256(api, tbs, ca, signature)
+}
+
+// assertUnused pins the emulated inputs of the unselected mode to zero, gnark
+// does not compile unconstrained inputs
+func assertUnused[T emulated.FieldParams](api frontend.API, elements ...*emulated.Element[T]) {
+	for _, e := range elements {
+		for _, limb := range e.Limbs {
+			api.AssertIsEqual(limb, 0)
+		}
+	}
+}
@@ -14,7 +14,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
-	"strings"
 	"testing"
 	"time"
 
@@ -23,12 +22,10 @@ import (
 	"github.com/consensys/gnark/std/math/uints"
 	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/models"
 )
 
-// Define Secp256r1 field parameters
-type Secp256r1Fp = emulated.P256Fp
-type Secp256r1Fr = emulated.P256Fr
-
 func TestEUDI(t *testing.T) {
 	// Set a deadline for this specific test
 	_, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
@@ -73,58 +70,12 @@ func TestEUDI(t *testing.T) {
 		"typ": "JOSE+JSON",
 	}
 
-	// Create JWS header
-	cnf := map[string]any{
-		"cnf": map[string]string{
-			"kid": subPkDigestHex,
-		},
-	}
-
-	cnfJSON, err := json.Marshal(cnf)
-	if err != nil {
-		t.Fatalf("Failed to marshal header: %v", err)
-	}
-
-	cnfStr := strings.TrimPrefix(string(cnfJSON), "{")
-	cnfStr = strings.TrimSuffix(cnfStr, "}")
-
 	protectedJSON, err := json.Marshal(header)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to marshal header: %v", err))
 	}
 	protectedB64 := base64.RawURLEncoding.EncodeToString(protectedJSON)
 
-	// Find where "cnf":" appears
-	cnfStart := strings.Index(string(protectedJSON), cnfStr)
-	if cnfStart == -1 {
-		t.Fatal("cnf field not found in JSON")
-	}
-	// Length of the cnf variable
-	cnfLen := len(cnfStr)
-	cnfEnd := cnfStart + cnfLen
-
-	cnfStartNew, cnfEndNew := common.B64Align(cnfStart, cnfEnd)
-
-	cnfAligned := protectedJSON[cnfStartNew:cnfEndNew]
-	cnfAlignedB64 := base64.RawURLEncoding.EncodeToString([]byte(cnfAligned))
-
-	isSubset := strings.Contains(protectedB64, cnfAlignedB64)
-	if !isSubset {
-		t.Log(protectedB64)
-		t.Log(cnfAlignedB64)
-		t.Fatal("cnf is not a subset")
-	}
-
-	cnfB64Index := strings.Index(protectedB64, cnfAlignedB64)
-	if cnfStart == -1 {
-		t.Fatal("failed to get cnfB64 index")
-	}
-	// get the public key position
-	pubKeyIndex := strings.Index(string(cnfAligned), subPkDigestHex)
-	if cnfStart == -1 {
-		t.Fatal("public key not found in JSON")
-	}
-
 	// Create JWS payload
 	payload := map[string]any{
 		"sub":  "1234567890",
@@ -192,10 +143,13 @@ func TestEUDI(t *testing.T) {
 	// Extract TBS (To-Be-Signed) certificate
 	tbsCert := cert.RawTBSCertificate
 
-	// Find public key position
-	pubKeyPosition, err := cdl.FindSubjectPublicKeyPositionInTBS(tbsCert)
+	// == find the positions of the elements ==
+	pos, err := (&common.Preprocessor{}).Process(common.CredentialArtifacts{
+		Certificate: certDER,
+		JWS:         jwtToken,
+	})
 	if err != nil {
-		t.Errorf("finding subject public key position failed: %v", err)
+		t.Fatalf("preprocessing failed: %v", err)
 	}
 
 	// Extract the signature from the certificate
@@ -218,7 +172,7 @@ func TestEUDI(t *testing.T) {
 		t.Fatalf("failed to create a challenge %v", err)
 	}
 
-	c_digest := sha256.Sum256(challenge)
+	c_digest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
 
 	// Sign the digest of the challenge
 	r, s, err := ecdsa.Sign(rand.Reader, subjectKey, c_digest[:])
@@ -230,7 +184,7 @@ func TestEUDI(t *testing.T) {
 	circuitTemplate := &cdl.CircuitEUDI{
 		CertBytes:    make([]uints.U8, len(tbsCert)),
 		Challenge:    make([]uints.U8, len(challenge)),
-		CnfB64:       make([]uints.U8, len(cnfAlignedB64)),
+		CnfB64:       make([]uints.U8, len(pos.Cnf.B64)),
 		JWSProtected: make([]uints.U8, len(protectedB64)),
 		JWSPayload:   make([]uints.U8, len(payloadB64)),
 	}
@@ -239,24 +193,24 @@ func TestEUDI(t *testing.T) {
 	assignment := &cdl.CircuitEUDI{
 		CertBytes:           common.BytesToU8Array(tbsCert),
 		CertLength:          frontend.Variable(len(tbsCert)),
-		CertSigR:            emulated.ValueOf[Secp256r1Fr](certSig.R),
-		CertSigS:            emulated.ValueOf[Secp256r1Fr](certSig.S),
-		SubjectPubKeyPos:    frontend.Variable(pubKeyPosition),
-		SubjectPubKeyX:      emulated.ValueOf[Secp256r1Fp](subjectKey.PublicKey.X),
-		SubjectPubKeyY:      emulated.ValueOf[Secp256r1Fp](subjectKey.PublicKey.Y),
-		ChallengeSignatureR: emulated.ValueOf[Secp256r1Fr](r),
-		ChallengeSignatureS: emulated.ValueOf[Secp256r1Fr](s),
-		JWSR:                emulated.ValueOf[Secp256r1Fr](jwsR),
-		JWSS:                emulated.ValueOf[Secp256r1Fr](jwsS),
+		CertSigR:            emulated.ValueOf[curves.Secp256r1Fr](certSig.R),
+		CertSigS:            emulated.ValueOf[curves.Secp256r1Fr](certSig.S),
+		SubjectPubKeyPos:    frontend.Variable(pos.SubjectPubKeyPosInTBS),
+		SubjectPubKeyX:      emulated.ValueOf[curves.Secp256r1Fp](subjectKey.PublicKey.X),
+		SubjectPubKeyY:      emulated.ValueOf[curves.Secp256r1Fp](subjectKey.PublicKey.Y),
+		ChallengeSignatureR: emulated.ValueOf[curves.Secp256r1Fr](r),
+		ChallengeSignatureS: emulated.ValueOf[curves.Secp256r1Fr](s),
+		JWSR:                emulated.ValueOf[curves.Secp256r1Fr](jwsR),
+		JWSS:                emulated.ValueOf[curves.Secp256r1Fr](jwsS),
 		JWSProtected:        common.StringToU8Array(protectedB64),
-		CnfB64:              common.StringToU8Array(cnfAlignedB64),
-		CnfB64Position:      cnfB64Index,
-		CnfKeyHexPosition:   pubKeyIndex,
+		CnfB64:              common.StringToU8Array(pos.Cnf.B64),
+		CnfB64Position:      pos.Cnf.B64Start,
+		CnfKeyHexPosition:   pos.CnfKeyHexPosition,
 		Challenge:           common.BytesToU8Array(challenge),
-		CAPubKeyX:           emulated.ValueOf[Secp256r1Fp](qtspKey.PublicKey.X),
-		CAPubKeyY:           emulated.ValueOf[Secp256r1Fp](qtspKey.PublicKey.Y),
-		IssuerPubKeyX:       emulated.ValueOf[Secp256r1Fp](issuerKey.PublicKey.X),
-		IssuerPubKeyY:       emulated.ValueOf[Secp256r1Fp](issuerKey.PublicKey.Y),
+		CAPubKeyX:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+		CAPubKeyY:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
+		IssuerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+		IssuerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
 		JWSPayload:          common.StringToU8Array(payloadB64),
 	}
 
@@ -275,3 +229,422 @@ func TestEUDI(t *testing.T) {
 	// == Run the circuit ==
 	common.TestCircuitSimple(assignment, ccs, pk, vk)
 }
+
+// TestEUDIIssuerCertified checks the witness of the IssuerCertified mode: the
+// VC is signed by an issuer certified by the trust anchor, the issuer key is
+// not a public input
+func TestEUDIIssuerCertified(t *testing.T) {
+	subjectKey, qtspKey, issuerKey, anchorKey := mockKey(t), mockKey(t), mockKey(t), mockKey(t)
+
+	subPubKeyBytes := elliptic.Marshal(elliptic.P256(), subjectKey.PublicKey.X, subjectKey.PublicKey.Y)
+	pkDigest := sha256.Sum256(subPubKeyBytes)
+	protectedJSON, err := json.Marshal(map[string]any{
+		"alg": "ES256",
+		"cnf": map[string]string{"kid": hex.EncodeToString(pkDigest[:])},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString(protectedJSON)
+	payloadB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1234567890"}`))
+	signingInput := protectedB64 + "." + payloadB64
+	hash := sha256.Sum256([]byte(signingInput))
+	jwsR, jwsS, err := ecdsa.Sign(rand.Reader, issuerKey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws := signingInput + "." + base64.RawURLEncoding.EncodeToString(append(common.PadTo32Bytes(jwsR.Bytes()), common.PadTo32Bytes(jwsS.Bytes())...))
+
+	certDER, certTBS, certR, certS := mockCert(t, &subjectKey.PublicKey, qtspKey)
+	_, issuerTBS, issuerR, issuerS := mockCert(t, &issuerKey.PublicKey, anchorKey)
+
+	pos, err := (&common.Preprocessor{}).Process(common.CredentialArtifacts{Certificate: certDER, JWS: jws})
+	if err != nil {
+		t.Fatalf("preprocessing failed: %v", err)
+	}
+
+	challenge := []byte("challenge")
+	challengeDigest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
+	r, s, err := ecdsa.Sign(rand.Reader, subjectKey, challengeDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circuitTemplate := &cdl.CircuitEUDI{
+		CertBytes:       make([]uints.U8, len(certTBS)),
+		Challenge:       make([]uints.U8, len(challenge)),
+		CnfB64:          make([]uints.U8, len(pos.Cnf.B64)),
+		JWSProtected:    make([]uints.U8, len(protectedB64)),
+		JWSPayload:      make([]uints.U8, len(payloadB64)),
+		IssuerCertBytes: make([]uints.U8, len(issuerTBS)),
+		IssuerTrust:     cdl.IssuerCertified,
+	}
+	assignment := &cdl.CircuitEUDI{
+		CertBytes:           common.BytesToU8Array(certTBS),
+		CertLength:          len(certTBS),
+		CertSigR:            emulated.ValueOf[curves.Secp256r1Fr](certR),
+		CertSigS:            emulated.ValueOf[curves.Secp256r1Fr](certS),
+		SubjectPubKeyPos:    pos.SubjectPubKeyPosInTBS,
+		SubjectPubKeyX:      emulated.ValueOf[curves.Secp256r1Fp](subjectKey.PublicKey.X),
+		SubjectPubKeyY:      emulated.ValueOf[curves.Secp256r1Fp](subjectKey.PublicKey.Y),
+		ChallengeSignatureR: emulated.ValueOf[curves.Secp256r1Fr](r),
+		ChallengeSignatureS: emulated.ValueOf[curves.Secp256r1Fr](s),
+		JWSProtected:        common.StringToU8Array(protectedB64),
+		CnfB64:              common.StringToU8Array(pos.Cnf.B64),
+		CnfB64Position:      pos.Cnf.B64Start,
+		CnfKeyHexPosition:   pos.CnfKeyHexPosition,
+		JWSR:                emulated.ValueOf[curves.Secp256r1Fr](jwsR),
+		JWSS:                emulated.ValueOf[curves.Secp256r1Fr](jwsS),
+		IssuerCertBytes:     common.BytesToU8Array(issuerTBS),
+		IssuerCertSigR:      emulated.ValueOf[curves.Secp256r1Fr](issuerR),
+		IssuerCertSigS:      emulated.ValueOf[curves.Secp256r1Fr](issuerS),
+		IssuerCertPubKeyX:   emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+		IssuerCertPubKeyY:   emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+		Challenge:           common.BytesToU8Array(challenge),
+		CAPubKeyX:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+		CAPubKeyY:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
+		TrustAnchorX:        emulated.ValueOf[curves.Secp256r1Fp](anchorKey.PublicKey.X),
+		TrustAnchorY:        emulated.ValueOf[curves.Secp256r1Fp](anchorKey.PublicKey.Y),
+		JWSPayload:          common.StringToU8Array(payloadB64),
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("expected the witness to satisfy the circuit: %v", err)
+	}
+
+	// an issuer certificate signed by another anchor
+	assignment.TrustAnchorX = emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X)
+	assignment.TrustAnchorY = emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y)
+	if err := common.CheckWitness(circuitTemplate, assignment); err == nil {
+		t.Fatal("expected an error for an issuer certificate of another trust anchor")
+	}
+
+	// a VC signed by a key that is not the certified one
+	otherKey := mockKey(t)
+	_, otherTBS, otherR, otherS := mockCert(t, &otherKey.PublicKey, anchorKey)
+	assignment.TrustAnchorX = emulated.ValueOf[curves.Secp256r1Fp](anchorKey.PublicKey.X)
+	assignment.TrustAnchorY = emulated.ValueOf[curves.Secp256r1Fp](anchorKey.PublicKey.Y)
+	assignment.IssuerCertBytes = common.BytesToU8Array(otherTBS)
+	assignment.IssuerCertSigR = emulated.ValueOf[curves.Secp256r1Fr](otherR)
+	assignment.IssuerCertSigS = emulated.ValueOf[curves.Secp256r1Fr](otherS)
+	if err := common.CheckWitness(circuitTemplate, assignment); err == nil {
+		t.Fatal("expected an error for a VC key that is not certified")
+	}
+}
+
+func TestEUDIKeyRotation(t *testing.T) {
+	// the VC binds the first device key, rotated twice since; the certificate
+	// is issued for the current key
+	firstKey, secondKey, subjectKey := mockKey(t), mockKey(t), mockKey(t)
+	qtspKey, issuerKey := mockKey(t), mockKey(t)
+
+	firstPubKeyBytes := elliptic.Marshal(elliptic.P256(), firstKey.PublicKey.X, firstKey.PublicKey.Y)
+	pkDigest := sha256.Sum256(firstPubKeyBytes)
+	protectedJSON, err := json.Marshal(map[string]any{
+		"alg": "ES256",
+		"cnf": map[string]string{"kid": hex.EncodeToString(pkDigest[:])},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString(protectedJSON)
+	payloadB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1234567890"}`))
+	signingInput := protectedB64 + "." + payloadB64
+	hash := sha256.Sum256([]byte(signingInput))
+	jwsR, jwsS, err := ecdsa.Sign(rand.Reader, issuerKey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws := signingInput + "." + base64.RawURLEncoding.EncodeToString(append(common.PadTo32Bytes(jwsR.Bytes()), common.PadTo32Bytes(jwsS.Bytes())...))
+
+	certDER, certTBS, certR, certS := mockCert(t, &subjectKey.PublicKey, qtspKey)
+	pos, err := (&common.Preprocessor{}).Process(common.CredentialArtifacts{Certificate: certDER, JWS: jws})
+	if err != nil {
+		t.Fatalf("preprocessing failed: %v", err)
+	}
+
+	challenge := []byte("challenge")
+	challengeDigest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
+	r, s, err := ecdsa.Sign(rand.Reader, subjectKey, challengeDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotR0, rotS0, err := common.SignKeyRotation(firstKey, &secondKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotR1, rotS1, err := common.SignKeyRotation(secondKey, &subjectKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circuitTemplate := &cdl.CircuitEUDI{
+		CertBytes:       make([]uints.U8, len(certTBS)),
+		Challenge:       make([]uints.U8, len(challenge)),
+		CnfB64:          make([]uints.U8, len(pos.Cnf.B64)),
+		JWSProtected:    make([]uints.U8, len(protectedB64)),
+		JWSPayload:      make([]uints.U8, len(payloadB64)),
+		RotatedPubKeysX: make([]emulated.Element[curves.Secp256r1Fp], 2),
+		RotatedPubKeysY: make([]emulated.Element[curves.Secp256r1Fp], 2),
+		RotationSigR:    make([]emulated.Element[curves.Secp256r1Fr], 2),
+		RotationSigS:    make([]emulated.Element[curves.Secp256r1Fr], 2),
+		KeyRotations:    2,
+	}
+	assignment := &cdl.CircuitEUDI{
+		CertBytes:           common.BytesToU8Array(certTBS),
+		CertLength:          len(certTBS),
+		CertSigR:            emulated.ValueOf[curves.Secp256r1Fr](certR),
+		CertSigS:            emulated.ValueOf[curves.Secp256r1Fr](certS),
+		SubjectPubKeyPos:    pos.SubjectPubKeyPosInTBS,
+		SubjectPubKeyX:      emulated.ValueOf[curves.Secp256r1Fp](subjectKey.PublicKey.X),
+		SubjectPubKeyY:      emulated.ValueOf[curves.Secp256r1Fp](subjectKey.PublicKey.Y),
+		ChallengeSignatureR: emulated.ValueOf[curves.Secp256r1Fr](r),
+		ChallengeSignatureS: emulated.ValueOf[curves.Secp256r1Fr](s),
+		JWSProtected:        common.StringToU8Array(protectedB64),
+		CnfB64:              common.StringToU8Array(pos.Cnf.B64),
+		CnfB64Position:      pos.Cnf.B64Start,
+		CnfKeyHexPosition:   pos.CnfKeyHexPosition,
+		JWSR:                emulated.ValueOf[curves.Secp256r1Fr](jwsR),
+		JWSS:                emulated.ValueOf[curves.Secp256r1Fr](jwsS),
+		IssuerCertSigR:      emulated.ValueOf[curves.Secp256r1Fr](0),
+		IssuerCertSigS:      emulated.ValueOf[curves.Secp256r1Fr](0),
+		IssuerCertPubKeyX:   emulated.ValueOf[curves.Secp256r1Fp](0),
+		IssuerCertPubKeyY:   emulated.ValueOf[curves.Secp256r1Fp](0),
+		TrustAnchorX:        emulated.ValueOf[curves.Secp256r1Fp](0),
+		TrustAnchorY:        emulated.ValueOf[curves.Secp256r1Fp](0),
+		RotatedPubKeysX: []emulated.Element[curves.Secp256r1Fp]{
+			emulated.ValueOf[curves.Secp256r1Fp](firstKey.PublicKey.X),
+			emulated.ValueOf[curves.Secp256r1Fp](secondKey.PublicKey.X),
+		},
+		RotatedPubKeysY: []emulated.Element[curves.Secp256r1Fp]{
+			emulated.ValueOf[curves.Secp256r1Fp](firstKey.PublicKey.Y),
+			emulated.ValueOf[curves.Secp256r1Fp](secondKey.PublicKey.Y),
+		},
+		RotationSigR: []emulated.Element[curves.Secp256r1Fr]{
+			emulated.ValueOf[curves.Secp256r1Fr](rotR0),
+			emulated.ValueOf[curves.Secp256r1Fr](rotR1),
+		},
+		RotationSigS: []emulated.Element[curves.Secp256r1Fr]{
+			emulated.ValueOf[curves.Secp256r1Fr](rotS0),
+			emulated.ValueOf[curves.Secp256r1Fr](rotS1),
+		},
+		Challenge:     common.BytesToU8Array(challenge),
+		CAPubKeyX:     emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+		CAPubKeyY:     emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
+		IssuerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+		IssuerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+		JWSPayload:    common.StringToU8Array(payloadB64),
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("expected the witness to satisfy the circuit: %v", err)
+	}
+
+	// the rotations in the wrong order
+	assignment.RotatedPubKeysX[0], assignment.RotatedPubKeysX[1] = assignment.RotatedPubKeysX[1], assignment.RotatedPubKeysX[0]
+	assignment.RotatedPubKeysY[0], assignment.RotatedPubKeysY[1] = assignment.RotatedPubKeysY[1], assignment.RotatedPubKeysY[0]
+	assignment.RotationSigR[0], assignment.RotationSigR[1] = assignment.RotationSigR[1], assignment.RotationSigR[0]
+	assignment.RotationSigS[0], assignment.RotationSigS[1] = assignment.RotationSigS[1], assignment.RotationSigS[0]
+	if err := common.CheckWitness(circuitTemplate, assignment); err == nil {
+		t.Fatal("expected an error for rotations in the wrong order")
+	}
+
+	// a rotation to the current key signed by a key the VC does not bind
+	otherKey := mockKey(t)
+	otherR, otherS, err := common.SignKeyRotation(otherKey, &subjectKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oneRotation := *circuitTemplate
+	oneRotation.RotatedPubKeysX = oneRotation.RotatedPubKeysX[:1]
+	oneRotation.RotatedPubKeysY = oneRotation.RotatedPubKeysY[:1]
+	oneRotation.RotationSigR = oneRotation.RotationSigR[:1]
+	oneRotation.RotationSigS = oneRotation.RotationSigS[:1]
+	oneRotation.KeyRotations = 1
+	assignment.RotatedPubKeysX = []emulated.Element[curves.Secp256r1Fp]{emulated.ValueOf[curves.Secp256r1Fp](otherKey.PublicKey.X)}
+	assignment.RotatedPubKeysY = []emulated.Element[curves.Secp256r1Fp]{emulated.ValueOf[curves.Secp256r1Fp](otherKey.PublicKey.Y)}
+	assignment.RotationSigR = []emulated.Element[curves.Secp256r1Fr]{emulated.ValueOf[curves.Secp256r1Fr](otherR)}
+	assignment.RotationSigS = []emulated.Element[curves.Secp256r1Fr]{emulated.ValueOf[curves.Secp256r1Fr](otherS)}
+	if err := common.CheckWitness(&oneRotation, assignment); err == nil {
+		t.Fatal("expected an error for a rotation from a key the VC does not bind")
+	}
+}
+
+// TestEUDIPairwise checks the pairwise identifier is derived from the holder
+// secret the VC commits to (the hsc claim of the header), not from a secret
+// of the holder's choosing
+func TestEUDIPairwise(t *testing.T) {
+	subjectKey, qtspKey, issuerKey := mockKey(t), mockKey(t), mockKey(t)
+	secret, err := models.NewHolderSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, commitment, err := secret.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subPubKeyBytes := elliptic.Marshal(elliptic.P256(), subjectKey.PublicKey.X, subjectKey.PublicKey.Y)
+	pkDigest := sha256.Sum256(subPubKeyBytes)
+	protectedJSON, err := json.Marshal(map[string]any{
+		"alg": "ES256",
+		"cnf": map[string]string{"kid": hex.EncodeToString(pkDigest[:])},
+		"hsc": commitment,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString(protectedJSON)
+	payloadB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1234567890"}`))
+	signingInput := protectedB64 + "." + payloadB64
+	hash := sha256.Sum256([]byte(signingInput))
+	jwsR, jwsS, err := ecdsa.Sign(rand.Reader, issuerKey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws := signingInput + "." + base64.RawURLEncoding.EncodeToString(append(common.PadTo32Bytes(jwsR.Bytes()), common.PadTo32Bytes(jwsS.Bytes())...))
+
+	certDER, certTBS, certR, certS := mockCert(t, &subjectKey.PublicKey, qtspKey)
+	pos, err := (&common.Preprocessor{}).Process(common.CredentialArtifacts{Certificate: certDER, JWS: jws})
+	if err != nil {
+		t.Fatalf("preprocessing failed: %v", err)
+	}
+
+	layout := models.TranscriptLayout{Nonce: 16, VerifierID: 32, ResponseURI: 32, VPFormats: 16}
+	transcript := models.SessionTranscript{
+		Nonce:       []byte("0123456789abcdef"),
+		VerifierID:  "verifier.example",
+		ResponseURI: "https://verifier.example/cb",
+		VPFormats:   `{"zk":{}}`,
+	}
+	nonce, verifierID, responseURI, vpFormats, err := transcript.Components(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := transcript.Challenge(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challengeDigest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
+	r, s, err := ecdsa.Sign(rand.Reader, subjectKey, challengeDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circuitTemplate := &cdl.CircuitEUDI{
+		CertBytes:                   make([]uints.U8, len(certTBS)),
+		Challenge:                   make([]uints.U8, layout.Nonce),
+		TranscriptVerifierID:        make([]uints.U8, layout.VerifierID),
+		TranscriptResponseURI:       make([]uints.U8, layout.ResponseURI),
+		TranscriptVPFormats:         make([]uints.U8, layout.VPFormats),
+		CnfB64:                      make([]uints.U8, len(pos.Cnf.B64)),
+		JWSProtected:                make([]uints.U8, len(protectedB64)),
+		JWSPayload:                  make([]uints.U8, len(payloadB64)),
+		HolderSecret:                make([]uints.U8, common.HolderSecretSize),
+		HolderSalt:                  make([]uints.U8, common.HolderSaltSize),
+		HolderCommitmentB64:         make([]uints.U8, len(pos.HolderCommitment.B64)),
+		HolderCommitmentB64Position: make([]frontend.Variable, 1),
+		HolderCommitmentHexPosition: make([]frontend.Variable, 1),
+		PairwiseID:                  make([]frontend.Variable, 1),
+		ChallengeMode:               cdl.ChallengeTranscript,
+		Pairwise:                    true,
+	}
+	assignment := func(secret models.HolderSecret, salt []byte) *cdl.CircuitEUDI {
+		t.Helper()
+		pid, err := secret.PairwiseID(transcript.VerifierID, layout.VerifierID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &cdl.CircuitEUDI{
+			CertBytes:                   common.BytesToU8Array(certTBS),
+			CertLength:                  len(certTBS),
+			CertSigR:                    emulated.ValueOf[curves.Secp256r1Fr](certR),
+			CertSigS:                    emulated.ValueOf[curves.Secp256r1Fr](certS),
+			SubjectPubKeyPos:            pos.SubjectPubKeyPosInTBS,
+			SubjectPubKeyX:              emulated.ValueOf[curves.Secp256r1Fp](subjectKey.PublicKey.X),
+			SubjectPubKeyY:              emulated.ValueOf[curves.Secp256r1Fp](subjectKey.PublicKey.Y),
+			ChallengeSignatureR:         emulated.ValueOf[curves.Secp256r1Fr](r),
+			ChallengeSignatureS:         emulated.ValueOf[curves.Secp256r1Fr](s),
+			JWSProtected:                common.StringToU8Array(protectedB64),
+			CnfB64:                      common.StringToU8Array(pos.Cnf.B64),
+			CnfB64Position:              pos.Cnf.B64Start,
+			CnfKeyHexPosition:           pos.CnfKeyHexPosition,
+			JWSR:                        emulated.ValueOf[curves.Secp256r1Fr](jwsR),
+			JWSS:                        emulated.ValueOf[curves.Secp256r1Fr](jwsS),
+			IssuerCertSigR:              emulated.ValueOf[curves.Secp256r1Fr](0),
+			IssuerCertSigS:              emulated.ValueOf[curves.Secp256r1Fr](0),
+			IssuerCertPubKeyX:           emulated.ValueOf[curves.Secp256r1Fp](0),
+			IssuerCertPubKeyY:           emulated.ValueOf[curves.Secp256r1Fp](0),
+			TrustAnchorX:                emulated.ValueOf[curves.Secp256r1Fp](0),
+			TrustAnchorY:                emulated.ValueOf[curves.Secp256r1Fp](0),
+			HolderSecret:                common.BytesToU8Array(secret[:]),
+			HolderSalt:                  common.BytesToU8Array(salt),
+			HolderCommitmentB64:         common.StringToU8Array(pos.HolderCommitment.B64),
+			HolderCommitmentB64Position: []frontend.Variable{pos.HolderCommitment.B64Start},
+			HolderCommitmentHexPosition: []frontend.Variable{pos.HolderCommitment.ValuePosition},
+			Challenge:                   common.BytesToU8Array(nonce),
+			TranscriptVerifierID:        common.BytesToU8Array(verifierID),
+			TranscriptResponseURI:       common.BytesToU8Array(responseURI),
+			TranscriptVPFormats:         common.BytesToU8Array(vpFormats),
+			PairwiseID:                  []frontend.Variable{new(big.Int).SetBytes(pid)},
+			CAPubKeyX:                   emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+			CAPubKeyY:                   emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
+			IssuerPubKeyX:               emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+			IssuerPubKeyY:               emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+			JWSPayload:                  common.StringToU8Array(payloadB64),
+		}
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment(secret, salt)); err != nil {
+		t.Fatalf("expected the witness to satisfy the circuit: %v", err)
+	}
+
+	// the identifiers of a secret the VC does not commit to
+	otherSecret, err := models.NewHolderSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment(otherSecret, salt)); err == nil {
+		t.Fatal("expected an error for a secret the VC does not commit to")
+	}
+
+	// the committed secret with another salt
+	otherSalt := append([]byte{}, salt...)
+	otherSalt[0] ^= 1
+	if err := common.CheckWitness(circuitTemplate, assignment(secret, otherSalt)); err == nil {
+		t.Fatal("expected an error for another salt")
+	}
+}
+
+func mockKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// mockCert issues a certificate for key signed by ca and returns it with its
+// TBSCertificate and signature
+func mockCert(t *testing.T, key *ecdsa.PublicKey, ca *ecdsa.PrivateKey) ([]byte, []byte, *big.Int, *big.Int) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Certificate"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, key, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(cert.Signature, &sig); err != nil {
+		t.Fatal(err)
+	}
+	return certDER, cert.RawTBSCertificate, sig.R, sig.S
+}
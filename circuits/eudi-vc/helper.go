@@ -3,6 +3,9 @@ package cdl
 import (
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/dertags"
+	"github.com/mynextid/eudi-zk/x509pos"
 )
 
 // ============================================================================
@@ -21,33 +24,35 @@ func VerifyTBSMembership(
 
 	// Skip outer Certificate SEQUENCE
 	tag := ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: Certificate SEQUENCE tag")
 	index = api.Add(index, 1)
 	_, lengthBytes := ReadDERLength(api, certBytes, index)
 	index = api.Add(index, lengthBytes)
 
 	// Now at TBS SEQUENCE - this should be tbsStart
-	api.AssertIsEqual(index, tbsStart)
+	common.AssertEqual(api, index, tbsStart, "cert: TBSCertificate start position")
 
 	// Verify TBS tag
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: TBSCertificate SEQUENCE tag")
 	index = api.Add(index, 1)
 
 	// Verify TBS length matches
 	tbsContentLength, tbsLengthBytes := ReadDERLength(api, certBytes, index)
 	expectedTBSLength := api.Add(api.Add(1, tbsLengthBytes), tbsContentLength)
-	api.AssertIsEqual(expectedTBSLength, tbsLength)
+	common.AssertEqual(api, expectedTBSLength, tbsLength, "cert: TBSCertificate length")
 
 	// CRITICAL: Verify every byte of TBS matches the certificate
 	for i := range tbsBytes {
 		certByte := ReadByteAt(api, certBytes, api.Add(tbsStart, i))
-		api.AssertIsEqual(certByte.Val, tbsBytes[i].Val)
+		common.AssertEqual(api, certByte.Val, tbsBytes[i].Val, "cert: TBSCertificate byte %d", i)
 	}
 }
 
-// NavigateToSubjectPublicKeyInfoInTBS navigates within TBS certificate (not full cert)
-func NavigateToSubjectPublicKeyInfoInTBS(
+// NavigateToSPKIInTBS navigates within TBS certificate (not full cert) like
+// NavigateToSPKI and returns the position of the SubjectPublicKeyInfo
+// SEQUENCE, see ExtractSubjectPublicKeyFromSPKI
+func NavigateToSPKIInTBS(
 	api frontend.API,
 	tbsBytes []uints.U8,
 ) frontend.Variable {
@@ -55,67 +60,59 @@ func NavigateToSubjectPublicKeyInfoInTBS(
 
 	// TBS starts with SEQUENCE tag
 	tag := ReadByteAt(api, tbsBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "tbs: TBSCertificate SEQUENCE tag")
 	index = api.Add(index, 1)
 	_, lengthBytes := ReadDERLength(api, tbsBytes, index)
 	index = api.Add(index, lengthBytes)
 
 	// Field 1: Version [0] EXPLICIT (optional)
 	tag = ReadByteAt(api, tbsBytes, index)
-	hasVersion := api.IsZero(api.Sub(tag.Val, 0xA0))
+	hasVersion := api.IsZero(api.Sub(tag.Val, dertags.Explicit0))
 	skipAmount := api.Select(hasVersion, SkipElement(api, tbsBytes, index), 0)
 	index = api.Add(index, skipAmount)
 
 	// Field 2: Serial Number (0x02)
 	tag = ReadByteAt(api, tbsBytes, index)
-	api.AssertIsEqual(tag.Val, 0x02)
+	common.AssertEqual(api, tag.Val, dertags.Integer, "tbs: serialNumber INTEGER tag")
 	skipAmount = SkipElement(api, tbsBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 3: Signature Algorithm (0x30)
 	tag = ReadByteAt(api, tbsBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "tbs: signature AlgorithmIdentifier tag")
 	skipAmount = SkipElement(api, tbsBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 4: Issuer DN (0x30)
 	tag = ReadByteAt(api, tbsBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "tbs: issuer Name tag")
 	skipAmount = SkipElement(api, tbsBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 5: Validity (0x30)
 	tag = ReadByteAt(api, tbsBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "tbs: validity SEQUENCE tag")
 	skipAmount = SkipElement(api, tbsBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 6: Subject DN (0x30)
 	tag = ReadByteAt(api, tbsBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "tbs: subject Name tag")
 	skipAmount = SkipElement(api, tbsBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 7: SubjectPublicKeyInfo (0x30)
 	tag = ReadByteAt(api, tbsBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "tbs: subjectPublicKeyInfo SEQUENCE tag")
 
-	// Skip SPKI header
-	index = api.Add(index, 1)
-	_, lengthBytes = ReadDERLength(api, tbsBytes, index)
-	index = api.Add(index, lengthBytes)
-
-	// Skip AlgorithmIdentifier
-	skipAmount = SkipElement(api, tbsBytes, index)
-	index = api.Add(index, skipAmount)
-
-	// Now at BIT STRING with public key
 	return index
 }
 
-// NavigateToSubjectPublicKeyInfo proves we correctly navigate to the subject's public key
-// by parsing the certificate structure in the correct order
-func NavigateToSubjectPublicKeyInfo(
+// NavigateToSPKI proves we correctly navigate to the subject's public key by
+// parsing the certificate structure in the correct order, and returns the
+// position of the SubjectPublicKeyInfo SEQUENCE, see
+// ExtractSubjectPublicKeyFromSPKI and ExtractRSAPublicKeyFromSPKI
+func NavigateToSPKI(
 	api frontend.API,
 
 	certBytes []uints.U8,
@@ -124,54 +121,54 @@ func NavigateToSubjectPublicKeyInfo(
 
 	// Verify and skip outer Certificate SEQUENCE (tag 0x30)
 	tag := ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: Certificate SEQUENCE tag")
 	index = api.Add(index, 1)
 	_, lengthBytes := ReadDERLength(api, certBytes, index)
 	index = api.Add(index, lengthBytes)
 
 	// Enter TBSCertificate SEQUENCE (tag 0x30)
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: TBSCertificate SEQUENCE tag")
 	index = api.Add(index, 1)
 	_, lengthBytes = ReadDERLength(api, certBytes, index)
 	index = api.Add(index, lengthBytes)
 
 	// Field 1: Version [0] EXPLICIT (optional, tag 0xA0)
 	tag = ReadByteAt(api, certBytes, index)
-	hasVersion := api.IsZero(api.Sub(tag.Val, 0xA0))
+	hasVersion := api.IsZero(api.Sub(tag.Val, dertags.Explicit0))
 	skipAmount := api.Select(hasVersion, SkipElement(api, certBytes, index), 0)
 	index = api.Add(index, skipAmount)
 
 	// Field 2: Serial Number (tag 0x02 - INTEGER)
 	// IMPORTANT: We verify the tag to ensure we're at the right field
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x02)
+	common.AssertEqual(api, tag.Val, dertags.Integer, "cert: serialNumber INTEGER tag")
 	skipAmount = SkipElement(api, certBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 3: Signature Algorithm (tag 0x30 - SEQUENCE)
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: signature AlgorithmIdentifier tag")
 	skipAmount = SkipElement(api, certBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 4: Issuer DN (tag 0x30 - SEQUENCE)
 	// This is the ISSUER, not what we want!
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: issuer Name tag")
 	skipAmount = SkipElement(api, certBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 5: Validity (tag 0x30 - SEQUENCE)
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: validity SEQUENCE tag")
 	skipAmount = SkipElement(api, certBytes, index)
 	index = api.Add(index, skipAmount)
 
 	// Field 6: Subject DN (tag 0x30 - SEQUENCE)
 	// This is the SUBJECT, but still not the public key
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: subject Name tag")
 	skipAmount = SkipElement(api, certBytes, index)
 	index = api.Add(index, skipAmount)
 
@@ -179,19 +176,8 @@ func NavigateToSubjectPublicKeyInfo(
 	// THIS IS IT! We've proven we're at the 7th field in TBSCertificate
 	// which is by definition the subject's public key
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
-
-	// Skip SEQUENCE header to get to the content
-	index = api.Add(index, 1)
-	_, lengthBytes = ReadDERLength(api, certBytes, index)
-	index = api.Add(index, lengthBytes)
-
-	// Skip AlgorithmIdentifier SEQUENCE
-	skipAmount = SkipElement(api, certBytes, index)
-	index = api.Add(index, skipAmount)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: subjectPublicKeyInfo SEQUENCE tag")
 
-	// Now we're at the BIT STRING containing the subject's public key
-	// We've PROVEN this is the subject's key by navigating the structure correctly
 	return index
 }
 
@@ -213,7 +199,7 @@ func ReadDERLength(
 	shortBytes := frontend.Variable(1)
 
 	// Long form: need to read multiple bytes
-	numLengthBytes := api.Sub(lengthByte.Val, 0x80)
+	numLengthBytes := api.Sub(lengthByte.Val, dertags.LongFormLength)
 
 	// Read up to 2 bytes for length (handles most certificates)
 	byte1 := ReadByteAt(api, data, api.Add(index, 1))
@@ -254,49 +240,6 @@ func SkipElement(
 	return api.Add(api.Add(1, lengthBytes), contentLength)
 }
 
-// ExtractSubjectPublicKeyFromCert extracts the 64-byte EC public key from certificate
-func ExtractSubjectPublicKeyFromCert(
-	api frontend.API,
-
-	certBytes []uints.U8,
-	pubKeyPos frontend.Variable,
-) []uints.U8 {
-	// At pubKeyPos, we expect to find: 03 42 00 04 [64 bytes of key]
-	// Where:
-	// 03 = BIT STRING tag
-	// 42 = length (66 bytes)
-	// 00 = unused bits
-	// 04 = uncompressed point format
-	// [64 bytes] = X coordinate (32 bytes) + Y coordinate (32 bytes)
-
-	// Verify we're at a BIT STRING
-	tag := ReadByteAt(api, certBytes, pubKeyPos)
-	api.AssertIsEqual(tag.Val, 0x03)
-
-	// Verify length is 0x42 (66 bytes)
-	length := ReadByteAt(api, certBytes, api.Add(pubKeyPos, 1))
-	api.AssertIsEqual(length.Val, 0x42)
-
-	// Verify unused bits = 0x00
-	unusedBits := ReadByteAt(api, certBytes, api.Add(pubKeyPos, 2))
-	api.AssertIsEqual(unusedBits.Val, 0x00)
-
-	// Verify format = 0x04 (uncompressed)
-	// format := ReadByteAt(api, certBytes, api.Add(pubKeyPos, 3))
-	// api.AssertIsEqual(format.Val, 0x04)
-
-	// Extract 65 bytes of public key (32 bytes X + 32 bytes Y)
-	keyStart := api.Add(pubKeyPos, 3)
-	publicKey := make([]uints.U8, 65)
-
-	for i := range 65 {
-		idx := api.Add(keyStart, i)
-		publicKey[i] = ReadByteAt(api, certBytes, idx)
-	}
-
-	return publicKey
-}
-
 // ReadByteAt reads a byte at a given index (variable index)
 func ReadByteAt(
 	api frontend.API,
@@ -327,114 +270,45 @@ func BytesToFieldElement(api frontend.API, bytes []uints.U8) frontend.Variable {
 	return result
 }
 
-// FindSubjectPublicKeyPosition locates the subject public key in DER bytes
-func FindSubjectPublicKeyPosition(certDER []byte) (int, error) {
-	// Parse the certificate to find the SubjectPublicKeyInfo position
-	// This is done off-circuit using standard Go parsing
-
-	idx := 0
-
-	// Skip outer Certificate SEQUENCE
-	idx = skipSequence(certDER, idx)
-
-	// Enter TBSCertificate SEQUENCE
-	idx = skipSequence(certDER, idx)
-
-	// Skip version (if present)
-	if certDER[idx] == 0xA0 {
-		idx = skipElement(certDER, idx)
-	}
-
-	// Skip: serialNumber, signature, issuer, validity, subject
-	for i := 0; i < 5; i++ {
-		idx = skipElement(certDER, idx)
-	}
-
-	// Now at SubjectPublicKeyInfo SEQUENCE
-	// spkiStart := idx
-
-	// Skip SEQUENCE header to get to AlgorithmIdentifier
-	idx++ // Skip tag
-	lengthSize, _ := readLength(certDER, idx)
-	idx += lengthSize
-
-	// Skip AlgorithmIdentifier SEQUENCE
-	idx = skipElement(certDER, idx)
-
-	// Now at BIT STRING containing the public key
-	// This is the position we want!
-	return idx, nil
-}
-
 // ============================================================================
-// OFF-CIRCUIT DER PARSING HELPERS
+// OFF-CIRCUIT POSITIONS (see package x509pos)
 // ============================================================================
 
-func skipSequence(data []byte, idx int) int {
-	idx++ // Skip tag
-	lengthSize, _ := readLength(data, idx)
-	return idx + lengthSize
-}
-
-func skipElement(data []byte, idx int) int {
-	idx++ // Skip tag
-	lengthSize, length := readLength(data, idx)
-	return idx + lengthSize + length
+// FindSubjectPublicKeyPosition locates the subject public key BIT STRING in
+// DER bytes, see x509pos.Certificate.PublicKey
+func FindSubjectPublicKeyPosition(certDER []byte) (int, error) {
+	cert, err := x509pos.Parse(certDER)
+	if err != nil {
+		return 0, err
+	}
+	return cert.PublicKey.Start, nil
 }
 
-func readLength(data []byte, idx int) (lengthSize, length int) {
-	firstByte := data[idx]
-	if firstByte < 0x80 {
-		// Short form
-		return 1, int(firstByte)
+// FindSubjectPublicKeyInfoPosition locates the SubjectPublicKeyInfo SEQUENCE
+// in DER bytes, see x509pos.Certificate.SPKI
+func FindSubjectPublicKeyInfoPosition(certDER []byte) (int, error) {
+	cert, err := x509pos.Parse(certDER)
+	if err != nil {
+		return 0, err
 	}
-	// Long form
-	numBytes := int(firstByte & 0x7F)
-	length = 0
-	for i := 0; i < numBytes; i++ {
-		length = (length << 8) | int(data[idx+1+i])
-	}
-	return 1 + numBytes, length
+	return cert.SPKI.Start, nil
 }
 
-// FindTBSStart finds where TBS certificate starts in full certificate
+// FindTBSStart finds where TBS certificate starts in full certificate, 0 for a
+// malformed certificate
 func FindTBSStart(certDER []byte) int {
-	idx := 0
-	// Skip outer Certificate SEQUENCE tag
-	idx++
-	// Skip outer length
-	lengthSize, _ := readLength(certDER, idx)
-	idx += lengthSize
-	// Now at TBS SEQUENCE
-	return idx
+	cert, err := x509pos.Parse(certDER)
+	if err != nil {
+		return 0
+	}
+	return cert.TBS.Start
 }
 
 // FindSubjectPublicKeyPositionInTBS locates the subject public key within TBS bytes
 func FindSubjectPublicKeyPositionInTBS(tbsDER []byte) (int, error) {
-	idx := 0
-
-	// Skip TBS SEQUENCE header
-	idx = skipSequence(tbsDER, idx)
-
-	// Skip version (if present)
-	if tbsDER[idx] == 0xA0 {
-		idx = skipElement(tbsDER, idx)
-	}
-
-	// Skip: serialNumber, signature, issuer, validity, subject
-	for i := 0; i < 5; i++ {
-		idx = skipElement(tbsDER, idx)
+	cert, err := x509pos.ParseTBS(tbsDER)
+	if err != nil {
+		return 0, err
 	}
-
-	// Now at SubjectPublicKeyInfo SEQUENCE
-	// Skip SEQUENCE header
-	idx++
-	lengthSize, _ := readLength(tbsDER, idx)
-	idx += lengthSize
-
-	// Skip AlgorithmIdentifier
-	idx = skipElement(tbsDER, idx)
-
-	// Now at BIT STRING containing the public key
-	return idx, nil
+	return cert.PublicKey.Start, nil
 }
@@ -0,0 +1,157 @@
+package cdl
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/common/dertags"
+	"github.com/mynextid/eudi-zk/x509pos"
+)
+
+// CircuitKeyAttestation proves:
+// 1. I have an Android key attestation certificate signed by the attestation
+// key (public input), which the verifier chains to the Google roots off-circuit
+// (attestation.VerifyAndroidIssuer)
+// 2. The certificate attests my key in a TEE or StrongBox: both security
+// levels of its KeyDescription extension are hardware
+// 3. I can sign the challenge with that key
+// 4. Without revealing the certificate or the key
+type CircuitKeyAttestation struct {
+	// ===== PRIVATE INPUTS (prover's secrets) =====
+
+	// Attestation certificate
+	AttestationCertBytes []uints.U8                           `gnark:",secret"` // TBSCertificate of the attestation certificate
+	AttestationCertSigR  emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	AttestationCertSigS  emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	// Position of the key attestation Extension in the TBSCertificate (see
+	// FindKeyAttestationPosition)
+	ExtensionPos frontend.Variable `gnark:",secret"`
+
+	// Attested key
+	HolderPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	HolderPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+
+	// Signature on the challenge (secret) - by the attested key
+	ChallengeSignatureR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS (known to verifier) =====
+	Challenge []uints.U8 `gnark:",public"` // Verifier's challenge
+	// Attestation key -- signs the attestation certificate
+	AttestationKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	AttestationKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+
+	MaxExtensions int
+}
+
+// NewCircuitKeyAttestation creates a key attestation circuit for the sizes of
+// the attestation TBSCertificate and of the challenge
+func NewCircuitKeyAttestation(tbsSize, challengeSize int) *CircuitKeyAttestation {
+	return &CircuitKeyAttestation{
+		AttestationCertBytes: make([]uints.U8, tbsSize),
+		Challenge:            make([]uints.U8, challengeSize),
+		MaxExtensions:        12,
+	}
+}
+
+// Define implements the circuit logic
+func (c *CircuitKeyAttestation) Define(api frontend.API) error {
+
+	// ===== STEP 1: Verify the attestation certificate of the holder key =====
+	holderKey := curves.NewPublicKey(c.HolderPubKeyX, c.HolderPubKeyY)
+	attestationKey := curves.NewPublicKey(c.AttestationKeyX, c.AttestationKeyY)
+	certSignature := curves.NewSignature(c.AttestationCertSigR, c.AttestationCertSigS)
+	if err := VerifyCertifiedKey(api, c.AttestationCertBytes, holderKey, attestationKey, certSignature); err != nil {
+		return err
+	}
+
+	// ===== STEP 2: Verify the key is hardware-backed =====
+	VerifyKeyAttestation(api, c.AttestationCertBytes, c.ExtensionPos, c.MaxExtensions)
+
+	// ===== STEP 3: Verify signature on challenge =====
+	signature := curves.NewSignature(c.ChallengeSignatureR, c.ChallengeSignatureS)
+	return common.VerifyES256(api, c.Challenge, holderKey, signature)
+}
+
+// VerifyKeyAttestation asserts the Extension at extensionPos of the
+// TBSCertificate is the Android key attestation extension and that its
+// attestationSecurityLevel and keyMintSecurityLevel are TrustedEnvironment (1)
+// or StrongBox (2)
+func VerifyKeyAttestation(
+	api frontend.API,
+
+	tbs []uints.U8,
+	extensionPos frontend.Variable,
+	maxExtensions int,
+) {
+	// The extension is one of the certificate extensions
+	extensionsStart, extensionsEnd := NavigateToExtensionsInTBS(api, tbs)
+	AssertElementInList(api, tbs, extensionsStart, extensionsEnd, extensionPos, maxExtensions,
+		"key attestation: extension is a certificate extension")
+
+	// Extension SEQUENCE
+	index := extensionPos
+	tag := ReadByteAt(api, tbs, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "key attestation: Extension SEQUENCE tag")
+	index = api.Add(index, 1)
+	_, lengthBytes := ReadDERLength(api, tbs, index)
+	index = api.Add(index, lengthBytes)
+
+	// extnID 1.3.6.1.4.1.11129.2.1.17
+	oid := readBytesAt(api, tbs, index, len(dertags.OIDAndroidKeyAttestation))
+	common.AssertOID(api, oid, dertags.OIDAndroidKeyAttestation, "key attestation: extnID")
+	index = api.Add(index, len(dertags.OIDAndroidKeyAttestation))
+
+	// critical BOOLEAN (optional, DEFAULT FALSE)
+	tag = ReadByteAt(api, tbs, index)
+	hasCritical := api.IsZero(api.Sub(tag.Val, dertags.Boolean))
+	index = api.Add(index, api.Select(hasCritical, 3, 0))
+
+	// extnValue OCTET STRING
+	tag = ReadByteAt(api, tbs, index)
+	common.AssertEqual(api, tag.Val, dertags.OctetString, "key attestation: extnValue OCTET STRING tag")
+	index = api.Add(index, 1)
+	_, lengthBytes = ReadDERLength(api, tbs, index)
+	index = api.Add(index, lengthBytes)
+
+	// KeyDescription SEQUENCE
+	tag = ReadByteAt(api, tbs, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "key attestation: KeyDescription SEQUENCE tag")
+	index = api.Add(index, 1)
+	_, lengthBytes = ReadDERLength(api, tbs, index)
+	index = api.Add(index, lengthBytes)
+
+	// attestationVersion INTEGER, attestationSecurityLevel ENUMERATED,
+	// keyMintVersion INTEGER, keyMintSecurityLevel ENUMERATED
+	for _, field := range []string{"attestationSecurityLevel", "keyMintSecurityLevel"} {
+		tag = ReadByteAt(api, tbs, index)
+		common.AssertEqual(api, tag.Val, dertags.Integer, "key attestation: version before %s INTEGER tag", field)
+		index = api.Add(index, SkipElement(api, tbs, index))
+
+		level := readBytesAt(api, tbs, index, 3)
+		common.AssertEqual(api, level[0].Val, dertags.Enumerated, "key attestation: %s ENUMERATED tag", field)
+		common.AssertEqual(api, level[1].Val, 1, "key attestation: %s length", field)
+		// TrustedEnvironment (1) or StrongBox (2), not Software (0)
+		common.AssertEqual(api, api.Mul(api.Sub(level[2].Val, 1), api.Sub(level[2].Val, 2)), 0,
+			"key attestation: %s is hardware", field)
+		index = api.Add(index, 3)
+	}
+}
+
+// FindKeyAttestationPosition locates the Android key attestation Extension in
+// the DER TBSCertificate
+func FindKeyAttestationPosition(tbsDER []byte) (int, error) {
+	tbs, err := x509pos.ParseTBS(tbsDER)
+	if err != nil {
+		return 0, err
+	}
+	ext := tbs.Extension(tbsDER, dertags.OIDAndroidKeyAttestation)
+	if ext == nil {
+		return 0, fmt.Errorf("certificate has no key attestation extension")
+	}
+	return ext.Start, nil
+}
@@ -0,0 +1,125 @@
+package cdl_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/mynextid/eudi-zk/attestation"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+func TestKeyAttestation(t *testing.T) {
+	attestationKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holderKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// == attestation certificate of the holder key, signed by the attestation key ==
+	attestationTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Android Keystore Attestation"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	attest := func(level attestation.SecurityLevel) (*x509.Certificate, *big.Int, *big.Int, int) {
+		description := &attestation.KeyDescription{
+			AttestationVersion:       200,
+			AttestationSecurityLevel: level,
+			KeyMintVersion:           200,
+			KeyMintSecurityLevel:     level,
+			AttestationChallenge:     []byte("attestation challenge"),
+			Origin:                   attestation.OriginGenerated,
+		}
+		value, err := description.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "Android Keystore Key"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtraExtensions: []pkix.Extension{
+				{Id: attestation.OIDAndroidKeyAttestation, Value: value},
+			},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, attestationTemplate, &holderKey.PublicKey, attestationKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(cert.Signature, &sig); err != nil {
+			t.Fatal(err)
+		}
+		extensionPos, err := cdl.FindKeyAttestationPosition(cert.RawTBSCertificate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, sig.R, sig.S, extensionPos
+	}
+
+	// == challenge signed by the attested key ==
+	challenge, err := common.GenerateRandomBytes(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challengeDigest := sha256.Sum256(challenge)
+	r, s, err := ecdsa.Sign(rand.Reader, holderKey, challengeDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assign := func(cert *x509.Certificate, certR, certS *big.Int, extensionPos int) *cdl.CircuitKeyAttestation {
+		return &cdl.CircuitKeyAttestation{
+			AttestationCertBytes: common.BytesToU8Array(cert.RawTBSCertificate),
+			AttestationCertSigR:  emulated.ValueOf[curves.Secp256r1Fr](certR),
+			AttestationCertSigS:  emulated.ValueOf[curves.Secp256r1Fr](certS),
+			ExtensionPos:         extensionPos,
+			HolderPubKeyX:        emulated.ValueOf[curves.Secp256r1Fp](holderKey.PublicKey.X),
+			HolderPubKeyY:        emulated.ValueOf[curves.Secp256r1Fp](holderKey.PublicKey.Y),
+			ChallengeSignatureR:  emulated.ValueOf[curves.Secp256r1Fr](r),
+			ChallengeSignatureS:  emulated.ValueOf[curves.Secp256r1Fr](s),
+			Challenge:            common.BytesToU8Array(challenge),
+			AttestationKeyX:      emulated.ValueOf[curves.Secp256r1Fp](attestationKey.PublicKey.X),
+			AttestationKeyY:      emulated.ValueOf[curves.Secp256r1Fp](attestationKey.PublicKey.Y),
+		}
+	}
+
+	cert, certR, certS, extensionPos := attest(attestation.SecurityStrongBox)
+	circuit := cdl.NewCircuitKeyAttestation(len(cert.RawTBSCertificate), len(challenge))
+	if err := common.CheckWitness(circuit, assign(cert, certR, certS, extensionPos)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// a software key, the TBSCertificate keeps its size
+	cert, certR, certS, extensionPos = attest(attestation.SecuritySoftware)
+	if len(cert.RawTBSCertificate) != len(circuit.AttestationCertBytes) {
+		t.Fatalf("unexpected TBSCertificate size %d", len(cert.RawTBSCertificate))
+	}
+	if err := common.CheckWitness(circuit, assign(cert, certR, certS, extensionPos)); err == nil {
+		t.Fatal("expected a software key to fail")
+	}
+}
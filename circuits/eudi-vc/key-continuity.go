@@ -0,0 +1,101 @@
+package cdl
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// CircuitKeyContinuity proves key continuity across a re-issuance:
+// 1. I have two VCs (JWS), the old one signed by the old issuer (public
+// input) and the renewed one signed by the new issuer (public input)
+// 2. Both VCs bind the same holder key (the cnf digest of their headers)
+// 3. I can sign the challenge with that key, so the proof is fresh
+// 4. Without revealing the VCs or the holder key
+//
+// The old and new issuer keys may be the same key.
+type CircuitKeyContinuity struct {
+	// ===== PRIVATE INPUTS (prover's secrets) =====
+
+	// Old VC
+	OldJWSProtected      []uints.U8                           `gnark:",secret"`
+	OldJWSPayload        []uints.U8                           `gnark:",secret"`
+	OldJWSR              emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	OldJWSS              emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	OldCnfB64            []uints.U8                           `gnark:",secret"` // base64url encoded cnf part of the header
+	OldCnfB64Position    frontend.Variable                    `gnark:",secret"` // cnfB64 start position in the header
+	OldCnfKeyHexPosition frontend.Variable                    `gnark:",secret"` // public key position within the decoded cnfB64
+
+	// Renewed VC
+	NewJWSProtected      []uints.U8                           `gnark:",secret"`
+	NewJWSPayload        []uints.U8                           `gnark:",secret"`
+	NewJWSR              emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	NewJWSS              emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	NewCnfB64            []uints.U8                           `gnark:",secret"`
+	NewCnfB64Position    frontend.Variable                    `gnark:",secret"`
+	NewCnfKeyHexPosition frontend.Variable                    `gnark:",secret"`
+
+	// The holder public key bound by both VCs
+	HolderPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	HolderPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+
+	// Signature on the challenge (secret) - by the holder
+	ChallengeSignatureR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS (known to verifier) =====
+	Challenge []uints.U8 `gnark:",public"` // Verifier's challenge
+	// Old VC issuer's public key
+	OldIssuerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	OldIssuerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	// Renewed VC issuer's public key
+	NewIssuerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	NewIssuerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+}
+
+// NewCircuitKeyContinuity creates a key continuity circuit for the sizes of
+// the base64url JWS parts of the old and renewed VCs and of their cnf
+// segments
+func NewCircuitKeyContinuity(oldProtectedSize, oldPayloadSize, oldCnfSize, newProtectedSize, newPayloadSize, newCnfSize, challengeSize int) *CircuitKeyContinuity {
+	return &CircuitKeyContinuity{
+		OldJWSProtected: make([]uints.U8, oldProtectedSize),
+		OldJWSPayload:   make([]uints.U8, oldPayloadSize),
+		OldCnfB64:       make([]uints.U8, oldCnfSize),
+		NewJWSProtected: make([]uints.U8, newProtectedSize),
+		NewJWSPayload:   make([]uints.U8, newPayloadSize),
+		NewCnfB64:       make([]uints.U8, newCnfSize),
+		Challenge:       make([]uints.U8, challengeSize),
+	}
+}
+
+// Define implements the circuit logic
+func (c *CircuitKeyContinuity) Define(api frontend.API) error {
+	holderKeyDigest := common.PublicKeyDigest(api, c.HolderPubKeyX, c.HolderPubKeyY)
+
+	// ===== STEP 1: Verify the old VC and its binding to the holder key =====
+	oldIssuer := curves.NewPublicKey(c.OldIssuerPubKeyX, c.OldIssuerPubKeyY)
+	oldSignature := curves.NewSignature(c.OldJWSR, c.OldJWSS)
+	if err := common.VerifyJWS(api, c.OldJWSProtected, c.OldJWSPayload, oldIssuer, oldSignature); err != nil {
+		return err
+	}
+	if err := common.VerifyCnf(api, c.OldJWSProtected, c.OldCnfB64, c.OldCnfB64Position, c.OldCnfKeyHexPosition, holderKeyDigest); err != nil {
+		return err
+	}
+
+	// ===== STEP 2: Verify the renewed VC, bound to the same key =====
+	newIssuer := curves.NewPublicKey(c.NewIssuerPubKeyX, c.NewIssuerPubKeyY)
+	newSignature := curves.NewSignature(c.NewJWSR, c.NewJWSS)
+	if err := common.VerifyJWS(api, c.NewJWSProtected, c.NewJWSPayload, newIssuer, newSignature); err != nil {
+		return err
+	}
+	if err := common.VerifyCnf(api, c.NewJWSProtected, c.NewCnfB64, c.NewCnfB64Position, c.NewCnfKeyHexPosition, holderKeyDigest); err != nil {
+		return err
+	}
+
+	// ===== STEP 3: Verify signature on challenge =====
+	holderKey := curves.NewPublicKey(c.HolderPubKeyX, c.HolderPubKeyY)
+	signature := curves.NewSignature(c.ChallengeSignatureR, c.ChallengeSignatureS)
+	return common.VerifyES256(api, c.Challenge, holderKey, signature)
+}
@@ -0,0 +1,118 @@
+package cdl_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark/std/math/emulated"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// keyBoundVC is a VC (JWS) bound to a holder key by the cnf of its header
+type keyBoundVC struct {
+	pos  *common.Positions
+	r, s *big.Int
+}
+
+func issueKeyBoundVC(t *testing.T, issuer *ecdsa.PrivateKey, holder *ecdsa.PublicKey, payload map[string]any) keyBoundVC {
+	t.Helper()
+	digest := sha256.Sum256(elliptic.Marshal(elliptic.P256(), holder.X, holder.Y))
+	b64 := base64.RawURLEncoding.EncodeToString
+	protectedJSON, _ := json.Marshal(map[string]any{"alg": "ES256", "cnf": map[string]string{"kid": hex.EncodeToString(digest[:])}, "typ": "JOSE+JSON"})
+	payloadJSON, _ := json.Marshal(payload)
+	signingInput := b64(protectedJSON) + "." + b64(payloadJSON)
+	hash := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, issuer, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws := signingInput + "." + b64(append(common.PadTo32Bytes(r.Bytes()), common.PadTo32Bytes(s.Bytes())...))
+	pos, err := (&common.Preprocessor{}).Process(common.CredentialArtifacts{JWS: jws})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyBoundVC{pos: pos, r: r, s: s}
+}
+
+func TestKeyContinuity(t *testing.T) {
+	generate := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	oldIssuer, newIssuer, holder, otherHolder := generate(), generate(), generate(), generate()
+
+	oldVC := issueKeyBoundVC(t, oldIssuer, &holder.PublicKey, map[string]any{"sub": "1234567890", "exp": 1700000000})
+	newVC := issueKeyBoundVC(t, newIssuer, &holder.PublicKey, map[string]any{"sub": "1234567890", "exp": 1800000000, "renewed": true})
+	otherVC := issueKeyBoundVC(t, newIssuer, &otherHolder.PublicKey, map[string]any{"sub": "1234567890", "exp": 1800000000, "renewed": true})
+
+	challenge, err := common.GenerateRandomBytes(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challengeDigest := sha256.Sum256(challenge)
+	r, s, err := ecdsa.Sign(rand.Reader, holder, challengeDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circuit := cdl.NewCircuitKeyContinuity(
+		len(oldVC.pos.ProtectedB64), len(oldVC.pos.PayloadB64), len(oldVC.pos.Cnf.B64),
+		len(newVC.pos.ProtectedB64), len(newVC.pos.PayloadB64), len(newVC.pos.Cnf.B64),
+		len(challenge),
+	)
+	assign := func(renewed keyBoundVC) *cdl.CircuitKeyContinuity {
+		return &cdl.CircuitKeyContinuity{
+			OldJWSProtected:      common.StringToU8Array(oldVC.pos.ProtectedB64),
+			OldJWSPayload:        common.StringToU8Array(oldVC.pos.PayloadB64),
+			OldJWSR:              emulated.ValueOf[curves.Secp256r1Fr](oldVC.r),
+			OldJWSS:              emulated.ValueOf[curves.Secp256r1Fr](oldVC.s),
+			OldCnfB64:            common.StringToU8Array(oldVC.pos.Cnf.B64),
+			OldCnfB64Position:    oldVC.pos.Cnf.B64Start,
+			OldCnfKeyHexPosition: oldVC.pos.CnfKeyHexPosition,
+			NewJWSProtected:      common.StringToU8Array(renewed.pos.ProtectedB64),
+			NewJWSPayload:        common.StringToU8Array(renewed.pos.PayloadB64),
+			NewJWSR:              emulated.ValueOf[curves.Secp256r1Fr](renewed.r),
+			NewJWSS:              emulated.ValueOf[curves.Secp256r1Fr](renewed.s),
+			NewCnfB64:            common.StringToU8Array(renewed.pos.Cnf.B64),
+			NewCnfB64Position:    renewed.pos.Cnf.B64Start,
+			NewCnfKeyHexPosition: renewed.pos.CnfKeyHexPosition,
+			HolderPubKeyX:        emulated.ValueOf[curves.Secp256r1Fp](holder.PublicKey.X),
+			HolderPubKeyY:        emulated.ValueOf[curves.Secp256r1Fp](holder.PublicKey.Y),
+			ChallengeSignatureR:  emulated.ValueOf[curves.Secp256r1Fr](r),
+			ChallengeSignatureS:  emulated.ValueOf[curves.Secp256r1Fr](s),
+			Challenge:            common.BytesToU8Array(challenge),
+			OldIssuerPubKeyX:     emulated.ValueOf[curves.Secp256r1Fp](oldIssuer.PublicKey.X),
+			OldIssuerPubKeyY:     emulated.ValueOf[curves.Secp256r1Fp](oldIssuer.PublicKey.Y),
+			NewIssuerPubKeyX:     emulated.ValueOf[curves.Secp256r1Fp](newIssuer.PublicKey.X),
+			NewIssuerPubKeyY:     emulated.ValueOf[curves.Secp256r1Fp](newIssuer.PublicKey.Y),
+		}
+	}
+	if err := common.CheckWitness(circuit, assign(newVC)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// a renewed VC bound to another holder
+	if err := common.CheckWitness(circuit, assign(otherVC)); err == nil {
+		t.Fatal("expected a VC of another holder to fail")
+	}
+
+	// the renewed VC attributed to the old issuer
+	assignment := assign(newVC)
+	assignment.NewIssuerPubKeyX = assignment.OldIssuerPubKeyX
+	assignment.NewIssuerPubKeyY = assignment.OldIssuerPubKeyY
+	if err := common.CheckWitness(circuit, assignment); err == nil {
+		t.Fatal("expected a wrong issuer key to fail")
+	}
+}
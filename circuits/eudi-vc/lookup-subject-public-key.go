@@ -2,15 +2,10 @@ package cdl
 
 import (
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
 	"github.com/mynextid/eudi-zk/common"
 )
 
-// Define Secp256r1 field parameters
-type Secp256r1Fp = emulated.P256Fp
-type Secp256r1Fr = emulated.P256Fr
-
 // CircuitSPK proves:
 // 1. I have a certificate with a subject public key
 // 2. Without revealing the certificate or the public key
@@ -34,20 +29,18 @@ func (c *CircuitSPK) Define(api frontend.API) error {
 
 	// ===== STEP 1: Navigate certificate structure to find SubjectPublicKeyInfo =====
 	// This proves we're at the SUBJECT's public key, not the issuer's or any other key
-	subjectPubKeyPos := NavigateToSubjectPublicKeyInfo(api, c.CertBytes[:])
+	spkiPos := NavigateToSPKI(api, c.CertBytes[:])
 
-	// ===== STEP 2: Verify claimed position matches the proven position =====
-	api.AssertIsEqual(subjectPubKeyPos, c.SubjectPubKeyPos)
+	// ===== STEP 2: Extract subject public key from the SubjectPublicKeyInfo =====
+	// The AlgorithmIdentifier is parsed (id-ecPublicKey, prime256v1) and the
+	// BIT STRING located by structure, whatever the length encodings
+	extractedPubKey, subjectPubKeyPos := ExtractSubjectPublicKeyFromSPKI(api, c.CertBytes[:], spkiPos)
 
-	// ===== STEP 3: Extract subject public key from certificate =====
-	extractedPubKey := ExtractSubjectPublicKeyFromCert(
-		api,
-		c.CertBytes[:],
-		subjectPubKeyPos, // Use the proven position
-	)
+	// ===== STEP 3: Verify claimed position matches the proven position =====
+	common.AssertEqual(api, subjectPubKeyPos, c.SubjectPubKeyPos, "subject public key position")
 
 	// ===== STEP 4: Verify extracted key matches the claimed public key =====
-	common.AssertIsEqualBytes(api, extractedPubKey, c.SignerPubKeyBytes)
+	common.AssertBytesEqual(api, extractedPubKey, c.SignerPubKeyBytes, "subject public key bytes")
 
 	return nil
 }
@@ -0,0 +1,118 @@
+package cdl
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// CircuitPoPBatch proves:
+// 1. I have a certificate with a subject public key
+// 2. Certificate signature is verified with the public key of the CA/QTSP(public input)
+// 3. I can sign each of the K challenges with the private key corresponding to that public key
+// 4. Without revealing the certificate or the public key
+//
+// The certificate part (navigation, extraction and CA signature) is proven
+// once and shared by all K challenges, e.g. when a holder presents to several
+// verifiers in a row.
+//
+// The holder signs every challenge in a signing context
+// (models.ContextMessage), see CircuitPoP.
+type CircuitPoPBatch struct {
+	// ===== PRIVATE INPUTS (prover's secrets) =====
+
+	// The certificate (secret)
+	CertBytes  []uints.U8        `gnark:",secret"`
+	CertLength frontend.Variable `gnark:",secret"`
+
+	// Position of subject public key in certificate (from off-circuit parsing)
+	SubjectPubKeyPos frontend.Variable `gnark:",secret"`
+
+	// The subject public key (secret - must match the subject key in the certificate)
+	SignerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+
+	// One signature per challenge (secret), ChallengeSignaturesR[i] and
+	// ChallengeSignaturesS[i] sign Challenges[i]
+	ChallengeSignaturesR []emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignaturesS []emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// Certificate signature
+	CertSigR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	CertSigS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS (known to verifier) =====
+	Challenges [][]uints.U8                         `gnark:",public"` // Verifiers' challenges
+	CAPubKeyX  emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	CAPubKeyY  emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+
+	// SigningContext is the context the challenges are signed in,
+	// common.SigningContextChallenge when empty, set at compile time
+	SigningContext string `gnark:"-"`
+	// LegacyChallenge verifies the signatures of the bare challenges, without
+	// signing context, set at compile time
+	LegacyChallenge bool `gnark:"-"`
+}
+
+// NewCircuitPoPBatch creates a batch PoP circuit for a TBS certificate of
+// certSize bytes and k challenges of challengeSize bytes each
+func NewCircuitPoPBatch(certSize, challengeSize, k int) *CircuitPoPBatch {
+	challenges := make([][]uints.U8, k)
+	for i := range challenges {
+		challenges[i] = make([]uints.U8, challengeSize)
+	}
+
+	return &CircuitPoPBatch{
+		CertBytes:            make([]uints.U8, certSize),
+		ChallengeSignaturesR: make([]emulated.Element[curves.Secp256r1Fr], k),
+		ChallengeSignaturesS: make([]emulated.Element[curves.Secp256r1Fr], k),
+		Challenges:           challenges,
+	}
+}
+
+// Define implements the circuit logic
+func (c *CircuitPoPBatch) Define(api frontend.API) error {
+	if len(c.ChallengeSignaturesR) != len(c.Challenges) || len(c.ChallengeSignaturesS) != len(c.Challenges) {
+		panic("one signature per challenge is required")
+	}
+
+	// ===== STEP 1: Navigate certificate structure to find SubjectPublicKeyInfo =====
+	spkiPos := NavigateToSPKIInTBS(api, c.CertBytes[:])
+
+	// ===== STEP 2: Extract subject public key from the SubjectPublicKeyInfo =====
+	extractedPubKey, subjectPubKeyPos := ExtractSubjectPublicKeyFromSPKI(api, c.CertBytes[:], spkiPos)
+
+	// ===== STEP 3: Verify claimed position matches the proven position =====
+	common.AssertEqual(api, subjectPubKeyPos, c.SubjectPubKeyPos, "subject public key position")
+
+	// ===== STEP 4: Verify extracted key matches the claimed public key =====
+	common.ComparePublicKeys(api, c.SignerPubKeyX, c.SignerPubKeyY, extractedPubKey)
+
+	// ==== STEP 5: Verify the Certificate Signature ====
+	caPublicKey := curves.NewPublicKey(c.CAPubKeyX, c.CAPubKeyY)
+
+	certSignature := curves.NewSignature(c.CertSigR, c.CertSigS)
+
+	if err := common.VerifyES256(api, c.CertBytes, caPublicKey, certSignature); err != nil {
+		return err
+	}
+
+	// ===== STEP 6: Verify the signature on every challenge =====
+	publicKey := curves.NewPublicKey(c.SignerPubKeyX, c.SignerPubKeyY)
+
+	for i := range c.Challenges {
+		message, err := signedMessage(api, c.SigningContext, c.LegacyChallenge, c.Challenges[i])
+		if err != nil {
+			return err
+		}
+		signature := curves.NewSignature(c.ChallengeSignaturesR[i], c.ChallengeSignaturesS[i])
+
+		if err := common.VerifyES256(api, message, publicKey, signature); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
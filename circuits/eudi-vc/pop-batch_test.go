@@ -0,0 +1,160 @@
+package cdl_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+func TestPoPBatch(t *testing.T) {
+	// == Circuit data ==
+	ccsPath := "compiled/circuit-pop-batch-v1.ccs"
+	pkPath := "compiled/proving-pop-batch-v1.key"
+	vkPath := "compiled/verifying-pop-batch-v1.key"
+	// true: recompile, false: load circuit if exists
+	forceCompile := true
+
+	// number of challenges proven at once
+	k := 2
+	challengeSize := 32
+
+	assignment, err := mockPoPBatchAssignment(k, challengeSize, false)
+	if err != nil {
+		t.Fatalf("failed to create the assignment: %v", err)
+	}
+
+	// == create the circuit and execute it ==
+	circuitTemplate := cdl.NewCircuitPoPBatch(len(assignment.CertBytes), challengeSize, k)
+
+	// == Init the circuit ==
+	fmt.Println("\n--- Init the circuit ---")
+	startCircuit := time.Now()
+
+	ccs, pk, vk, err := common.InitCircuit(ccsPath, pkPath, vkPath, forceCompile, circuitTemplate)
+	if err != nil {
+		t.Fatalf("failed to initialize a circuit: %v", err)
+	}
+
+	circuitTime := time.Since(startCircuit)
+	fmt.Printf("[OK] Circuit created/loaded successfully! (took %v)\n", circuitTime)
+
+	// == Run the circuit ==
+	common.TestCircuit(assignment, ccs, pk, vk)
+}
+
+func TestPoPBatchSigningContext(t *testing.T) {
+	k, challengeSize := 2, 32
+	for _, tt := range signingContextCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assignment, err := mockPoPBatchAssignment(k, challengeSize, tt.legacySigner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			circuit := cdl.NewCircuitPoPBatch(len(assignment.CertBytes), challengeSize, k)
+			circuit.LegacyChallenge = tt.legacyCircuit
+			err = common.CheckWitness(circuit, assignment)
+			if tt.valid != (err == nil) {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+// mockPoPBatchAssignment creates a CA signed certificate and signs k random
+// challenges with the wallet signer of the subject key, the bare challenges
+// with legacy
+func mockPoPBatchAssignment(k, challengeSize int, legacy bool) (*cdl.CircuitPoPBatch, error) {
+	signerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	qtspKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate issuer key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization: []string{"Test Org"},
+			CommonName:   "Test Signer",
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &signerKey.PublicKey, qtspKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	tbsCert := cert.RawTBSCertificate
+
+	pubKeyPosition, err := cdl.FindSubjectPublicKeyPositionInTBS(tbsCert)
+	if err != nil {
+		return nil, fmt.Errorf("finding subject public key position failed: %w", err)
+	}
+
+	var certSig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(cert.Signature, &certSig); err != nil {
+		return nil, fmt.Errorf("failed to parse certificate signature: %w", err)
+	}
+
+	assignment := &cdl.CircuitPoPBatch{
+		CertBytes:            common.BytesToU8Array(tbsCert),
+		CertLength:           frontend.Variable(len(tbsCert)),
+		CertSigR:             emulated.ValueOf[curves.Secp256r1Fr](certSig.R),
+		CertSigS:             emulated.ValueOf[curves.Secp256r1Fr](certSig.S),
+		SubjectPubKeyPos:     frontend.Variable(pubKeyPosition),
+		SignerPubKeyX:        emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY:        emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+		ChallengeSignaturesR: make([]emulated.Element[curves.Secp256r1Fr], k),
+		ChallengeSignaturesS: make([]emulated.Element[curves.Secp256r1Fr], k),
+		Challenges:           make([][]uints.U8, k),
+		CAPubKeyX:            emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+		CAPubKeyY:            emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
+	}
+
+	// == create and sign the challenges ==
+	for i := range k {
+		challenge, err := common.GenerateRandomBytes(challengeSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a challenge: %w", err)
+		}
+
+		r, s, err := walletSignature(signerKey, legacy, challenge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign the challenge: %w", err)
+		}
+
+		assignment.Challenges[i] = common.BytesToU8Array(challenge)
+		assignment.ChallengeSignaturesR[i] = r
+		assignment.ChallengeSignaturesS[i] = s
+	}
+
+	return assignment, nil
+}
@@ -0,0 +1,160 @@
+package cdl
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// CircuitPoPCASet proves:
+// 1. I have a set of up to N certificates (a pinning set: the renewals of a
+// certificate), all with the same subject public key
+// 2. One of them, which one stays private, is signed by the CA/QTSP (public
+// input)
+// 3. I can sign a challenge with the private key corresponding to that public key
+// 4. Without revealing the certificates or the public key
+//
+// A holder presents all its certificates for the key, so a presentation does
+// not fail during a rollover: the prover selects the certificate the CA
+// signature verifies (Selected), e.g. the renewal once the CA key rotated.
+// The certificates are TBSCertificates of different lengths, zero padded to
+// the size of the circuit; a holder with fewer than N certificates repeats
+// one of them in the free slots.
+//
+// The holder signs the challenge in a signing context
+// (models.ContextMessage), see CircuitPoP.
+type CircuitPoPCASet struct {
+	// ===== PRIVATE INPUTS (prover's secrets) =====
+
+	// The TBS certificates, zero padded, and their lengths (secret)
+	CertBytes   [][]uints.U8        `gnark:",secret"`
+	CertLengths []frontend.Variable `gnark:",secret"`
+
+	// Selected is the index of the certificate signed by the CA (secret)
+	Selected frontend.Variable `gnark:",secret"`
+
+	// The subject public key (secret - must match the subject key of every certificate)
+	SignerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+
+	// Signature on the challenge, and the CA signature of the selected
+	// certificate (secret)
+	ChallengeSignatureR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	CertSigR            emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	CertSigS            emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS (known to verifier) =====
+	Challenge []uints.U8                           `gnark:",public"` // Verifier's challenge
+	CAPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	CAPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+
+	// SigningContext is the context the challenge is signed in,
+	// common.SigningContextChallenge when empty, set at compile time
+	SigningContext string `gnark:"-"`
+	// LegacyChallenge verifies the signature of the bare challenge, without
+	// signing context, set at compile time
+	LegacyChallenge bool `gnark:"-"`
+}
+
+// NewCircuitPoPCASet creates a PoP circuit for n TBS certificates of at most
+// maxCertSize bytes and a challenge of challengeSize bytes
+func NewCircuitPoPCASet(maxCertSize, challengeSize, n int) *CircuitPoPCASet {
+	certs := make([][]uints.U8, n)
+	for i := range certs {
+		certs[i] = make([]uints.U8, maxCertSize)
+	}
+	return &CircuitPoPCASet{
+		CertBytes:   certs,
+		CertLengths: make([]frontend.Variable, n),
+		Challenge:   make([]uints.U8, challengeSize),
+	}
+}
+
+// Define implements the circuit logic
+func (c *CircuitPoPCASet) Define(api frontend.API) error {
+	if len(c.CertBytes) == 0 || len(c.CertLengths) != len(c.CertBytes) {
+		return fmt.Errorf("one length per certificate is required")
+	}
+	maxCertSize := len(c.CertBytes[0])
+
+	// ===== STEP 1: Every certificate is a TBSCertificate of the subject key =====
+	// The bytes past the length are zero and the length is the one of the
+	// TBSCertificate SEQUENCE, so the key is in the signed bytes
+	for i, cert := range c.CertBytes {
+		if len(cert) != maxCertSize {
+			return fmt.Errorf("certificate %d: the certificates must have the same maximal size", i)
+		}
+		common.NewLengthedBytes(api, cert, c.CertLengths[i])
+		common.AssertEqual(api, SkipElement(api, cert, 0), c.CertLengths[i], "pinning set: certificate %d TBSCertificate length", i)
+
+		extractedPubKey, _ := ExtractSubjectPublicKeyFromSPKI(api, cert, NavigateToSPKIInTBS(api, cert))
+		common.ComparePublicKeys(api, c.SignerPubKeyX, c.SignerPubKeyY, extractedPubKey)
+	}
+
+	// ===== STEP 2: Select the certificate signed by the CA =====
+	selected := selectCertificate(api, c.CertBytes, c.CertLengths, c.Selected)
+
+	// ===== STEP 3: Verify signature on challenge, in its signing context =====
+	message, err := signedMessage(api, c.SigningContext, c.LegacyChallenge, c.Challenge)
+	if err != nil {
+		return err
+	}
+	publicKey := curves.NewPublicKey(c.SignerPubKeyX, c.SignerPubKeyY)
+	signature := curves.NewSignature(c.ChallengeSignatureR, c.ChallengeSignatureS)
+	if err := common.VerifyES256(api, message, publicKey, signature); err != nil {
+		return err
+	}
+
+	// ==== STEP 4: Verify the CA signature of the selected certificate ====
+	// The selected certificate is of variable length, its digest is computed
+	// over its length only
+	digest, err := selected.SHA256(api)
+	if err != nil {
+		return err
+	}
+	caPublicKey := curves.NewPublicKey(c.CAPubKeyX, c.CAPubKeyY)
+	certSignature := curves.NewSignature(c.CertSigR, c.CertSigS)
+
+	return common.VerifyES256Digest(api, digest, caPublicKey, certSignature)
+}
+
+// selectCertificate returns the certificate at index, which must be one of
+// the certificates
+func selectCertificate(
+	api frontend.API,
+	certs [][]uints.U8,
+	lengths []frontend.Variable,
+	index frontend.Variable,
+) common.LengthedBytes {
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		panic(err)
+	}
+
+	selected := make([]frontend.Variable, len(certs[0]))
+	for j := range selected {
+		selected[j] = 0
+	}
+	length := frontend.Variable(0)
+	matches := frontend.Variable(0)
+	for i, cert := range certs {
+		isSelected := api.IsZero(api.Sub(index, i))
+		matches = api.Add(matches, isSelected)
+		length = api.Add(length, api.Mul(isSelected, lengths[i]))
+		for j := range cert {
+			selected[j] = api.Add(selected[j], api.Mul(isSelected, cert[j].Val))
+		}
+	}
+	common.AssertEqual(api, matches, 1, "pinning set: selected certificate index")
+
+	data := make([]uints.U8, len(selected))
+	for j := range data {
+		data[j] = bytesAPI.ValueOf(selected[j])
+	}
+	return common.LengthedBytes{Data: data, Length: length}
+}
@@ -0,0 +1,127 @@
+package cdl_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// caSetAssignment assigns the TBS certificates of certs, padded to
+// maxCertSize, with the CA signature of the selected one and the signature
+// of the challenge by the wallet signer
+func caSetAssignment(t *testing.T, certs []*x509.Certificate, selected, maxCertSize int, signerKey, caKey *ecdsa.PrivateKey, challenge []byte) *cdl.CircuitPoPCASet {
+	t.Helper()
+	return caSetAssignmentOf(t, certs, selected, maxCertSize, signerKey, caKey, challenge, false)
+}
+
+// caSetAssignmentOf is caSetAssignment, the bare challenge signed with legacy
+func caSetAssignmentOf(t *testing.T, certs []*x509.Certificate, selected, maxCertSize int, signerKey, caKey *ecdsa.PrivateKey, challenge []byte, legacy bool) *cdl.CircuitPoPCASet {
+	t.Helper()
+	var certSig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(certs[selected].Signature, &certSig); err != nil {
+		t.Fatal(err)
+	}
+	r, s, err := walletSignature(signerKey, legacy, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assignment := &cdl.CircuitPoPCASet{
+		CertBytes:           make([][]uints.U8, len(certs)),
+		CertLengths:         make([]frontend.Variable, len(certs)),
+		Selected:            selected,
+		SignerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+		ChallengeSignatureR: r,
+		ChallengeSignatureS: s,
+		CertSigR:            emulated.ValueOf[curves.Secp256r1Fr](certSig.R),
+		CertSigS:            emulated.ValueOf[curves.Secp256r1Fr](certSig.S),
+		Challenge:           common.BytesToU8Array(challenge),
+		CAPubKeyX:           emulated.ValueOf[curves.Secp256r1Fp](caKey.PublicKey.X),
+		CAPubKeyY:           emulated.ValueOf[curves.Secp256r1Fp](caKey.PublicKey.Y),
+	}
+	for i, cert := range certs {
+		tbs, err := common.AssignLengthedBytes(cert.RawTBSCertificate, maxCertSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assignment.CertBytes[i] = tbs.Data
+		assignment.CertLengths[i] = tbs.Length
+	}
+	return assignment
+}
+
+func TestPoPCASet(t *testing.T) {
+	signerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	oldCAKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// the certificate of the retired CA key and its renewal, of another
+	// length, by the current one
+	old := mockSubjectDNCert(t, pkix.Name{CommonName: "Signer"}, signerKey, oldCAKey)
+	renewal := mockSubjectDNCert(t, pkix.Name{CommonName: "Signer (renewed)"}, signerKey, caKey)
+	certs := []*x509.Certificate{old, renewal}
+	maxCertSize := max(len(old.RawTBSCertificate), len(renewal.RawTBSCertificate)) + 16
+	challenge := []byte("rollover challenge")
+
+	circuitTemplate := cdl.NewCircuitPoPCASet(maxCertSize, len(challenge), len(certs))
+	assignment := caSetAssignment(t, certs, 1, maxCertSize, signerKey, caKey, challenge)
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// a holder with a single certificate repeats it
+	single := caSetAssignment(t, []*x509.Certificate{renewal, renewal}, 0, maxCertSize, signerKey, caKey, challenge)
+	if err := common.CheckWitness(circuitTemplate, single); err != nil {
+		t.Fatalf("witness check failed for a repeated certificate: %v", err)
+	}
+
+	// the certificate of the retired CA key selected, a selection out of
+	// the set, and a certificate of another key in the set
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other := mockSubjectDNCert(t, pkix.Name{CommonName: "Other"}, otherKey, caKey)
+	failing := map[string]*cdl.CircuitPoPCASet{
+		"retired CA":  caSetAssignment(t, certs, 0, maxCertSize, signerKey, caKey, challenge),
+		"out of set":  caSetAssignment(t, certs, 1, maxCertSize, signerKey, caKey, challenge),
+		"another key": caSetAssignment(t, []*x509.Certificate{other, renewal}, 1, maxCertSize, signerKey, caKey, challenge),
+	}
+	failing["out of set"].Selected = len(certs)
+	for name, assignment := range failing {
+		if err := common.CheckWitness(circuitTemplate, assignment); err == nil {
+			t.Fatalf("%s: expected the witness check to fail", name)
+		}
+	}
+}
+
+func TestPoPCASetSigningContext(t *testing.T) {
+	signerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := mockSubjectDNCert(t, pkix.Name{CommonName: "Signer"}, signerKey, caKey)
+	certs := []*x509.Certificate{cert, cert}
+	maxCertSize := len(cert.RawTBSCertificate)
+	challenge := []byte("rollover challenge")
+
+	for _, tt := range signingContextCases {
+		t.Run(tt.name, func(t *testing.T) {
+			circuit := cdl.NewCircuitPoPCASet(maxCertSize, len(challenge), len(certs))
+			circuit.LegacyChallenge = tt.legacyCircuit
+			assignment := caSetAssignmentOf(t, certs, 0, maxCertSize, signerKey, caKey, challenge, tt.legacySigner)
+			err := common.CheckWitness(circuit, assignment)
+			if tt.valid != (err == nil) {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
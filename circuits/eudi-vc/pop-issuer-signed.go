@@ -4,8 +4,9 @@ import (
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
-	"github.com/consensys/gnark/std/signature/ecdsa"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/common/dertags"
 )
 
 // CircuitPoPCA proves:
@@ -13,7 +14,18 @@ import (
 // 2. I can sign a challenge with the private key corresponding to that public key
 // 3. Certificate signature is verified with the public key of the CA/QTSP(public input)
 // 4. Without revealing the certificate or the public key
+//
+// With SubjectDNHash, it also proves the subject Name of the certificate hashes
+// to it (ExtractSubjectDNInTBS): the certificate belongs to the organization
+// agreed out-of-band, the DN staying private.
+//
+// The holder signs the challenge in a signing context
+// (models.ContextMessage), see CircuitPoP.
 type CircuitPoPCA struct {
+	// MaxSubjectDNLen is the maximal length of the DER encoded subject Name,
+	// when SubjectDNHash is set
+	MaxSubjectDNLen int `gnark:"-"`
+
 	// ===== PRIVATE INPUTS (prover's secrets) =====
 
 	// The certificate (secret)
@@ -24,19 +36,30 @@ type CircuitPoPCA struct {
 	SubjectPubKeyPos frontend.Variable `gnark:",secret"`
 
 	// The subject public key (secret - must match the subject key in the certificate)
-	SignerPubKeyX emulated.Element[Secp256r1Fp] `gnark:",secret"`
-	SignerPubKeyY emulated.Element[Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
 
 	// Signature on the challenge (secret)
-	ChallengeSignatureR emulated.Element[Secp256r1Fr] `gnark:",secret"`
-	ChallengeSignatureS emulated.Element[Secp256r1Fr] `gnark:",secret"`
-	CertSigR            emulated.Element[Secp256r1Fr] `gnark:",secret"`
-	CertSigS            emulated.Element[Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	CertSigR            emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	CertSigS            emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
 
 	// ===== PUBLIC INPUTS (known to verifier) =====
-	Challenge []uints.U8                    `gnark:",public"` // Verifier's challenge
-	CAPubKeyX emulated.Element[Secp256r1Fp] `gnark:",public"`
-	CAPubKeyY emulated.Element[Secp256r1Fp] `gnark:",public"`
+	Challenge []uints.U8                           `gnark:",public"` // Verifier's challenge
+	CAPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	CAPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+
+	// SHA-256 of the DER encoded subject Name (SubjectDNHash), optional: the
+	// subject is not checked when empty
+	SubjectDNHash []uints.U8 `gnark:",public"`
+
+	// SigningContext is the context the challenge is signed in,
+	// common.SigningContextChallenge when empty, set at compile time
+	SigningContext string `gnark:"-"`
+	// LegacyChallenge verifies the signature of the bare challenge, without
+	// signing context, set at compile time
+	LegacyChallenge bool `gnark:"-"`
 }
 
 // Define implements the circuit logic
@@ -44,47 +67,48 @@ func (c *CircuitPoPCA) Define(api frontend.API) error {
 
 	// ===== STEP 1: Navigate certificate structure to find SubjectPublicKeyInfo =====
 	// This proves we're at the SUBJECT's public key, not the issuer's or any other key
-	subjectPubKeyPos := NavigateToSubjectPublicKeyInfoInTBS(api, c.CertBytes[:])
+	spkiPos := NavigateToSPKIInTBS(api, c.CertBytes[:])
 
-	// ===== STEP 2: Verify claimed position matches the proven position =====
-	api.AssertIsEqual(subjectPubKeyPos, c.SubjectPubKeyPos)
+	// ===== STEP 2: Extract subject public key from the SubjectPublicKeyInfo =====
+	extractedPubKey, subjectPubKeyPos := ExtractSubjectPublicKeyFromSPKI(api, c.CertBytes[:], spkiPos)
 
-	// ===== STEP 3: Extract subject public key from certificate =====
-	extractedPubKey := ExtractSubjectPublicKeyFromCert(
-		api,
-		c.CertBytes[:],
-		subjectPubKeyPos, // Use the proven position
-	)
+	// ===== STEP 3: Verify claimed position matches the proven position =====
+	common.AssertEqual(api, subjectPubKeyPos, c.SubjectPubKeyPos, "subject public key position")
 
 	// ===== STEP 4: Verify extracted key matches the claimed public key =====
 	// common.CompareBytes(api, extractedPubKey, circuit.SignerPubKeyBytes)
 	common.ComparePublicKeys(api, c.SignerPubKeyX, c.SignerPubKeyY, extractedPubKey)
 
-	// ===== STEP 5: Verify signature on challenge =====
-	publicKey := ecdsa.PublicKey[Secp256r1Fp, Secp256r1Fr]{
-		X: c.SignerPubKeyX,
-		Y: c.SignerPubKeyY,
+	// ===== STEP 5: Verify signature on challenge, in its signing context =====
+	message, err := signedMessage(api, c.SigningContext, c.LegacyChallenge, c.Challenge)
+	if err != nil {
+		return err
 	}
 
-	signature := ecdsa.Signature[Secp256r1Fr]{
-		R: c.ChallengeSignatureR,
-		S: c.ChallengeSignatureS,
-	}
+	publicKey := curves.NewPublicKey(c.SignerPubKeyX, c.SignerPubKeyY)
 
-	common.VerifyES256(api, c.Challenge, publicKey, signature)
+	signature := curves.NewSignature(c.ChallengeSignatureR, c.ChallengeSignatureS)
 
-	// ==== STEP 6: Verify the Certificate Signature ====
-	caPublicKey := ecdsa.PublicKey[Secp256r1Fp, Secp256r1Fr]{
-		X: c.CAPubKeyX,
-		Y: c.CAPubKeyY,
+	if err := common.VerifyES256(api, message, publicKey, signature); err != nil {
+		return err
 	}
 
-	certSignature := ecdsa.Signature[Secp256r1Fr]{
-		R: c.CertSigR,
-		S: c.CertSigS,
+	// ==== STEP 6: Verify the Certificate Signature ====
+	caPublicKey := curves.NewPublicKey(c.CAPubKeyX, c.CAPubKeyY)
+
+	certSignature := curves.NewSignature(c.CertSigR, c.CertSigS)
+
+	if err := common.VerifyES256(api, c.CertBytes, caPublicKey, certSignature); err != nil {
+		return err
 	}
 
-	common.VerifyES256(api, c.CertBytes, caPublicKey, certSignature)
+	// ==== STEP 7: Verify the subject DN, when expected ====
+	if len(c.SubjectDNHash) > 0 {
+		dn := ExtractSubjectDNInTBS(api, c.CertBytes, c.MaxSubjectDNLen)
+		if err := AssertSubjectDNHash(api, dn, c.SubjectDNHash); err != nil {
+			return err
+		}
+	}
 
 	// ===== PROOF COMPLETE =====
 	// We've proven:
@@ -110,7 +134,7 @@ func ExtractTBSCertificate(
 
 	// Skip outer Certificate SEQUENCE tag (0x30)
 	tag := ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: Certificate SEQUENCE tag")
 	index = api.Add(index, 1)
 
 	// Skip outer length field
@@ -122,7 +146,7 @@ func ExtractTBSCertificate(
 
 	// Verify it's a SEQUENCE (0x30)
 	tag = ReadByteAt(api, certBytes, index)
-	api.AssertIsEqual(tag.Val, 0x30)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: TBSCertificate SEQUENCE tag")
 	index = api.Add(index, 1)
 
 	// Read TBS content length
@@ -0,0 +1,221 @@
+package cdl
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/lookup/logderivlookup"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/dertags"
+)
+
+// CircuitPoPRSA proves:
+// 1. I have a certificate with an RSA subject public key
+// 2. I can sign a challenge (RSASSA-PKCS1-v1_5, SHA-256) with the private key
+// corresponding to that public key
+// 3. Without revealing the certificate or the public key
+//
+// The holder signs the challenge in a signing context
+// (models.ContextMessage), see CircuitPoP.
+type CircuitPoPRSA struct {
+	// Size of the RSA modulus in bytes (e.g. 256 for RSA-2048), compile-time
+	ModulusSize int `gnark:"-"`
+
+	// ===== PRIVATE INPUTS (prover's secrets) =====
+
+	// The certificate (secret)
+	CertBytes  []uints.U8        `gnark:",secret"`
+	CertLength frontend.Variable `gnark:",secret"`
+
+	// Position of subject public key in certificate (from off-circuit parsing)
+	SubjectPubKeyPos frontend.Variable `gnark:",secret"`
+
+	// Signature on the challenge (secret)
+	ChallengeSignature emulated.Element[common.RSAModulus] `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS (known to verifier) =====
+	Challenge []uints.U8 `gnark:",public"` // Verifier's challenge
+
+	// SigningContext is the context the challenge is signed in,
+	// common.SigningContextChallenge when empty, set at compile time
+	SigningContext string `gnark:"-"`
+	// LegacyChallenge verifies the signature of the bare challenge, without
+	// signing context, set at compile time
+	LegacyChallenge bool `gnark:"-"`
+}
+
+// NewCircuitPoPRSA creates an RSA PoP circuit for a certificate of certSize
+// bytes, a challenge of challengeSize bytes and an RSA key of modulusSize bytes
+func NewCircuitPoPRSA(certSize, challengeSize, modulusSize int) *CircuitPoPRSA {
+	return &CircuitPoPRSA{
+		ModulusSize: modulusSize,
+		CertBytes:   make([]uints.U8, certSize),
+		Challenge:   make([]uints.U8, challengeSize),
+	}
+}
+
+// Define implements the circuit logic
+func (c *CircuitPoPRSA) Define(api frontend.API) error {
+
+	// ===== STEP 1: Navigate certificate structure to find SubjectPublicKeyInfo =====
+	spkiPos := NavigateToSPKI(api, c.CertBytes[:])
+
+	// ===== STEP 2: Extract the RSA subject public key from the parsed SubjectPublicKeyInfo =====
+	modulus, exponent, subjectPubKeyPos := ExtractRSAPublicKeyFromSPKI(
+		api,
+		c.CertBytes[:],
+		spkiPos,
+		c.ModulusSize,
+	)
+
+	// ===== STEP 3: Verify claimed position matches the proven position =====
+	common.AssertEqual(api, subjectPubKeyPos, c.SubjectPubKeyPos, "subject public key position")
+
+	// ===== STEP 4: Verify signature on challenge, in its signing context =====
+	message, err := signedMessage(api, c.SigningContext, c.LegacyChallenge, c.Challenge)
+	if err != nil {
+		return err
+	}
+	return common.VerifyRS256(api, message, modulus, exponent, &c.ChallengeSignature)
+}
+
+// ExtractRSAPublicKeyFromSPKI extracts the modulus (modulusSize bytes,
+// big-endian) and the public exponent of an RSA public key, located by the
+// structure of the SubjectPublicKeyInfo SEQUENCE at spkiPos (NavigateToSPKI):
+//
+//	SEQUENCE {
+//	  SEQUENCE { OID rsaEncryption, NULL }  -- AlgorithmIdentifier
+//	  BIT STRING {                          -- subjectPublicKey
+//	    00
+//	    SEQUENCE {                          -- RSAPublicKey
+//	      INTEGER 00 modulus                -- leading 00, top bit is set
+//	      INTEGER publicExponent            -- 1 to 3 bytes
+//	    }
+//	  }
+//	}
+//
+// The AlgorithmIdentifier must be rsaEncryption with NULL parameters, the BIT
+// STRING follows it and ends the SubjectPublicKeyInfo, the RSAPublicKey ends
+// the BIT STRING and the exponent ends the RSAPublicKey. It returns the
+// modulus, the exponent and the position of the BIT STRING
+// (x509pos.Certificate.PublicKey).
+func ExtractRSAPublicKeyFromSPKI(
+	api frontend.API,
+
+	certBytes []uints.U8,
+	spkiPos frontend.Variable,
+	modulusSize int,
+) ([]uints.U8, frontend.Variable, frontend.Variable) {
+	// SubjectPublicKeyInfo SEQUENCE
+	tag := ReadByteAt(api, certBytes, spkiPos)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "spki: SubjectPublicKeyInfo SEQUENCE tag")
+	spkiLen, spkiLenBytes := ReadDERLength(api, certBytes, api.Add(spkiPos, 1))
+	algPos := api.Add(spkiPos, 1, spkiLenBytes)
+	spkiEnd := api.Add(algPos, spkiLen)
+
+	// AlgorithmIdentifier SEQUENCE: rsaEncryption, then NULL
+	tag = ReadByteAt(api, certBytes, algPos)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "spki: AlgorithmIdentifier SEQUENCE tag")
+	algLen, algLenBytes := ReadDERLength(api, certBytes, api.Add(algPos, 1))
+	algContent := api.Add(algPos, 1, algLenBytes)
+	algorithm := common.GetSubset(api, certBytes, algContent, len(dertags.OIDRSAEncryption))
+	common.AssertOID(api, algorithm, dertags.OIDRSAEncryption, "spki: algorithm rsaEncryption")
+	params := api.Add(algContent, len(dertags.OIDRSAEncryption))
+	common.AssertEqual(api, ReadByteAt(api, certBytes, params).Val, dertags.Null, "spki: rsaEncryption NULL parameters tag")
+	common.AssertEqual(api, ReadByteAt(api, certBytes, api.Add(params, 1)).Val, 0x00, "spki: rsaEncryption NULL parameters length")
+	common.AssertEqual(api, algLen, len(dertags.OIDRSAEncryption)+2, "spki: AlgorithmIdentifier parameters")
+
+	// subjectPublicKey BIT STRING, right after the AlgorithmIdentifier
+	pubKeyPos := api.Add(algContent, algLen)
+	tag = ReadByteAt(api, certBytes, pubKeyPos)
+	common.AssertEqual(api, tag.Val, dertags.BitString, "spki: subjectPublicKey BIT STRING tag")
+	bitStringLen, bitStringLenBytes := ReadDERLength(api, certBytes, api.Add(pubKeyPos, 1))
+	index := api.Add(pubKeyPos, 1, bitStringLenBytes)
+	common.AssertEqual(api, api.Add(index, bitStringLen), spkiEnd, "spki: subjectPublicKey ends the SubjectPublicKeyInfo")
+
+	// Verify unused bits = 0x00
+	unusedBits := ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, unusedBits.Val, 0x00, "spki: subjectPublicKey unused bits")
+	index = api.Add(index, 1)
+
+	// RSAPublicKey SEQUENCE, ending the BIT STRING
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "spki: RSAPublicKey SEQUENCE tag")
+	index = api.Add(index, 1)
+	rsaKeyLen, lengthBytes := ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+	rsaKeyEnd := api.Add(index, rsaKeyLen)
+	common.AssertEqual(api, rsaKeyEnd, spkiEnd, "spki: RSAPublicKey ends the subjectPublicKey")
+
+	// Modulus INTEGER
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Integer, "spki: RSA modulus INTEGER tag")
+	index = api.Add(index, 1)
+	modulusLength, lengthBytes := ReadDERLength(api, certBytes, index)
+	common.AssertEqual(api, modulusLength, modulusSize+1, "spki: RSA modulus length")
+	index = api.Add(index, lengthBytes)
+
+	leadingZero := ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, leadingZero.Val, 0x00, "spki: RSA modulus leading zero")
+	index = api.Add(index, 1)
+
+	// The modulus is read through a lookup table: ReadByteAt costs O(len(certBytes))
+	// per byte, which does not scale to modulusSize bytes
+	modulus := readBytesAt(api, certBytes, index, modulusSize)
+	index = api.Add(index, modulusSize)
+
+	// Exponent INTEGER, short form length of 1 to 3 bytes, ending the RSAPublicKey
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Integer, "spki: RSA exponent INTEGER tag")
+	exponentLength := ReadByteAt(api, certBytes, api.Add(index, 1))
+	index = api.Add(index, 2)
+	common.AssertEqual(api, api.Add(index, exponentLength.Val), rsaKeyEnd, "spki: RSA exponent ends the RSAPublicKey")
+
+	isLength := make([]frontend.Variable, 3)
+	for i := range isLength {
+		isLength[i] = api.IsZero(api.Sub(exponentLength.Val, i+1))
+	}
+	common.Assert(api, api.Add(isLength[0], isLength[1], isLength[2]), "spki: RSA exponent length")
+
+	// exponent = big-endian value of the first exponentLength bytes
+	exponent := frontend.Variable(0)
+	inExponent := frontend.Variable(1)
+	for i := range 3 {
+		b := ReadByteAt(api, certBytes, api.Add(index, i))
+		exponent = api.Select(inExponent, api.Add(api.Mul(exponent, 256), b.Val), exponent)
+		inExponent = api.Sub(inExponent, isLength[i])
+	}
+
+	return modulus, exponent, pubKeyPos
+}
+
+// readBytesAt reads data[index:index+length] with a lookup table
+func readBytesAt(
+	api frontend.API,
+
+	data []uints.U8,
+	index frontend.Variable,
+	length int,
+) []uints.U8 {
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		panic(err)
+	}
+
+	table := logderivlookup.New(api)
+	for i := range data {
+		table.Insert(data[i].Val)
+	}
+
+	indices := make([]frontend.Variable, length)
+	for i := range indices {
+		indices[i] = api.Add(index, i)
+	}
+
+	values := table.Lookup(indices...)
+	result := make([]uints.U8, length)
+	for i := range values {
+		result[i] = bytesAPI.ValueOf(values[i])
+	}
+	return result
+}
@@ -0,0 +1,213 @@
+package cdl_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+func TestPoPRSA(t *testing.T) {
+	// == Circuit data ==
+	ccsPath := "compiled/circuit-pop-rsa-v1.ccs"
+	pkPath := "compiled/proving-pop-rsa-v1.key"
+	vkPath := "compiled/verifying-pop-rsa-v1.key"
+	// true: recompile, false: load circuit if exists
+	forceCompile := true
+
+	challengeSize := 32
+
+	assignment, err := mockPoPRSAAssignment(2048, challengeSize, false)
+	if err != nil {
+		t.Fatalf("failed to create the assignment: %v", err)
+	}
+
+	// == create the circuit and execute it ==
+	circuitTemplate := cdl.NewCircuitPoPRSA(len(assignment.CertBytes), challengeSize, assignment.ModulusSize)
+
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// == Init the circuit ==
+	fmt.Println("\n--- Init the circuit ---")
+	startCircuit := time.Now()
+
+	ccs, pk, vk, err := common.InitCircuit(ccsPath, pkPath, vkPath, forceCompile, circuitTemplate)
+	if err != nil {
+		t.Fatalf("failed to initialize a circuit: %v", err)
+	}
+
+	circuitTime := time.Since(startCircuit)
+	fmt.Printf("[OK] Circuit created/loaded successfully! (took %v)\n", circuitTime)
+
+	// == Run the circuit ==
+	common.TestCircuit(assignment, ccs, pk, vk)
+}
+
+func TestPoPRSASigningContext(t *testing.T) {
+	challengeSize := 32
+	for _, tt := range signingContextCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assignment, err := mockPoPRSAAssignment(2048, challengeSize, tt.legacySigner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			circuit := cdl.NewCircuitPoPRSA(len(assignment.CertBytes), challengeSize, assignment.ModulusSize)
+			circuit.LegacyChallenge = tt.legacyCircuit
+			err = common.CheckWitness(circuit, assignment)
+			if tt.valid != (err == nil) {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+// mockPoPRSAAssignment creates a certificate with an RSA subject key of
+// keyBits bits and signs a random challenge with it (RSASSA-PKCS1-v1_5), the
+// message of the wallet signer (the bare challenge with legacy)
+func mockPoPRSAAssignment(keyBits, challengeSize int, legacy bool) (*cdl.CircuitPoPRSA, error) {
+	signerKey, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization: []string{"Test Org"},
+			CommonName:   "Test Signer",
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &signerKey.PublicKey, signerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	pubKeyPosition, err := cdl.FindSubjectPublicKeyPosition(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("finding subject public key position failed: %w", err)
+	}
+
+	challenge, err := common.GenerateRandomBytes(challengeSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a challenge: %w", err)
+	}
+
+	message, err := walletSigner(nil, legacy).Message(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the signed message: %w", err)
+	}
+	digest := sha256.Sum256(message)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, signerKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the challenge: %w", err)
+	}
+
+	return &cdl.CircuitPoPRSA{
+		ModulusSize:        signerKey.Size(),
+		CertBytes:          common.BytesToU8Array(certDER),
+		CertLength:         frontend.Variable(len(certDER)),
+		SubjectPubKeyPos:   frontend.Variable(pubKeyPosition),
+		ChallengeSignature: emulated.ValueOf[common.RSAModulus](new(big.Int).SetBytes(signature)),
+		Challenge:          common.BytesToU8Array(challenge),
+	}, nil
+}
+
+type rsaSPKICircuit struct {
+	ModulusSize int `gnark:"-"`
+	Bytes       []uints.U8
+	SPKIPos     frontend.Variable
+	PubKeyPos   frontend.Variable
+	Modulus     []uints.U8
+	Exponent    frontend.Variable
+}
+
+func (c *rsaSPKICircuit) Define(api frontend.API) error {
+	modulus, exponent, pubKeyPos := cdl.ExtractRSAPublicKeyFromSPKI(api, c.Bytes, c.SPKIPos, c.ModulusSize)
+	common.AssertEqual(api, pubKeyPos, c.PubKeyPos, "public key position")
+	common.AssertBytesEqual(api, modulus, c.Modulus, "modulus")
+	common.AssertEqual(api, exponent, c.Exponent, "exponent")
+	return nil
+}
+
+func TestExtractRSAPublicKeyFromSPKI(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPublicKey := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	bitString := der([]byte{0x03, 0x81, byte(len(rsaPublicKey) + 1), 0x00}, rsaPublicKey)
+	rsaEncryption := []byte{0x06, 0x09, 0x2A, 0x86, 0x48, 0x86, 0xF7, 0x0D, 0x01, 0x01, 0x01}
+	rsassaPSS := []byte{0x06, 0x09, 0x2A, 0x86, 0x48, 0x86, 0xF7, 0x0D, 0x01, 0x01, 0x0A}
+	null := []byte{0x05, 0x00}
+	spki := func(parts ...[]byte) []byte {
+		content := der(parts...)
+		return der([]byte{0x30, 0x81, byte(len(content))}, content)
+	}
+	prefix := []byte{0xA0, 0x03, 0x02, 0x01, 0x02} // bytes before the SPKI
+
+	// an RSAPublicKey SEQUENCE followed by data inside the BIT STRING
+	padded := der(rsaPublicKey, null)
+	paddedBitString := der([]byte{0x03, 0x81, byte(len(padded) + 1), 0x00}, padded)
+
+	tests := []struct {
+		name      string
+		spki      []byte
+		spkiPos   int
+		pubKeyPos int
+		valid     bool
+	}{
+		{"standard layout", standard, 0, 3 + 15, true},
+		{"RSASSA-PSS algorithm", spki([]byte{0x30, 0x0D}, rsassaPSS, null, bitString), 0, 3 + 15, false},
+		{"no NULL parameters", spki([]byte{0x30, 0x0B}, rsaEncryption, bitString), 0, 3 + 13, false},
+		{"trailing data", spki([]byte{0x30, 0x0D}, rsaEncryption, null, bitString, null), 0, 3 + 15, false},
+		{"trailing data in the BIT STRING", spki([]byte{0x30, 0x0D}, rsaEncryption, null, paddedBitString), 0, 3 + 15, false},
+		{"AlgorithmIdentifier position", standard, 3, 3 + 15, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytes := der(prefix, tt.spki)
+			circuit := &rsaSPKICircuit{
+				ModulusSize: key.Size(),
+				Bytes:       common.BytesToU8Array(bytes),
+				SPKIPos:     len(prefix) + tt.spkiPos,
+				PubKeyPos:   len(prefix) + tt.pubKeyPos,
+				Modulus:     common.BytesToU8Array(key.N.Bytes()),
+				Exponent:    key.E,
+			}
+			err := common.CheckWitness(circuit, circuit)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			var werr *common.WitnessError
+			if !tt.valid && !errors.As(err, &werr) {
+				t.Fatalf("expected a witness error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package cdl
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/common/dertags"
+)
+
+// CircuitPoPSecp256k1 is CircuitPoP for certificates with a secp256k1 subject
+// key, as held by crypto wallets. It proves:
+// 1. I have a certificate with a secp256k1 subject public key
+// 2. I can sign a challenge (ES256K) with the corresponding private key
+// 3. Without revealing the certificate or the public key
+//
+// The subject public key must be uncompressed in the certificate; the
+// algorithm preceding it is checked to be secp256k1, so a key of another
+// curve cannot be read as a secp256k1 key.
+//
+// The holder signs the challenge in a signing context
+// (models.ContextMessage), see CircuitPoP.
+type CircuitPoPSecp256k1 struct {
+	// ===== PRIVATE INPUTS (prover's secrets) =====
+
+	// The certificate (secret)
+	CertBytes  []uints.U8        `gnark:",secret"`
+	CertLength frontend.Variable `gnark:",secret"`
+
+	// Position of subject public key in certificate (from off-circuit parsing)
+	SubjectPubKeyPos frontend.Variable `gnark:",secret"`
+
+	// The subject public key (secret - must match the subject key in the certificate)
+	SignerPubKeyX emulated.Element[curves.Secp256k1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256k1Fp] `gnark:",secret"`
+
+	// Signature on the challenge (secret)
+	ChallengeSignatureR emulated.Element[curves.Secp256k1Fr] `gnark:",secret"`
+	ChallengeSignatureS emulated.Element[curves.Secp256k1Fr] `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS (known to verifier) =====
+	Challenge []uints.U8 `gnark:",public"` // Verifier's challenge
+
+	// SigningContext is the context the challenge is signed in,
+	// common.SigningContextChallenge when empty, set at compile time
+	SigningContext string `gnark:"-"`
+	// LegacyChallenge verifies the signature of the bare challenge, without
+	// signing context, set at compile time
+	LegacyChallenge bool `gnark:"-"`
+}
+
+// Define implements the circuit logic
+func (c *CircuitPoPSecp256k1) Define(api frontend.API) error {
+	// ===== STEP 1: Navigate certificate structure to find SubjectPublicKeyInfo =====
+	spkiPos := NavigateToSPKI(api, c.CertBytes[:])
+
+	// ===== STEP 2: Extract the key, of the secp256k1 curve =====
+	extractedPubKey, subjectPubKeyPos := ExtractECPublicKeyFromSPKI(api, c.CertBytes[:], spkiPos, dertags.OIDSecp256k1)
+	common.AssertEqual(api, subjectPubKeyPos, c.SubjectPubKeyPos, "subject public key position")
+
+	// ===== STEP 3: Compare the key with the claimed key =====
+	common.ComparePublicKeysSecp256k1(api, c.SignerPubKeyX, c.SignerPubKeyY, extractedPubKey)
+
+	// ===== STEP 4: Verify signature on challenge, in its signing context =====
+	message, err := signedMessage(api, c.SigningContext, c.LegacyChallenge, c.Challenge)
+	if err != nil {
+		return err
+	}
+	publicKey := curves.NewSecp256k1PublicKey(c.SignerPubKeyX, c.SignerPubKeyY)
+	signature := curves.NewSecp256k1Signature(c.ChallengeSignatureR, c.ChallengeSignatureS)
+	return common.VerifyES256K(api, message, publicKey, signature)
+}
@@ -0,0 +1,187 @@
+package cdl_test
+
+import (
+	stdecdsa "crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	secp256k1ecdsa "github.com/consensys/gnark-crypto/ecc/secp256k1/ecdsa"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+var (
+	oidPublicKeyECDSA   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSignatureES256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidNamedCurveP256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveSecp2k = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+func TestPoPSecp256k1(t *testing.T) {
+	challengeSize := 32
+
+	tests := []struct {
+		name  string
+		curve asn1.ObjectIdentifier
+		valid bool
+	}{
+		{"secp256k1 subject key", oidNamedCurveSecp2k, true},
+		// the same key bytes declared as a P-256 key
+		{"P-256 algorithm", oidNamedCurveP256, false},
+	}
+	for _, tt := range tests {
+		assignment, err := mockPoPSecp256k1Assignment(tt.curve, challengeSize, false)
+		if err != nil {
+			t.Fatalf("failed to create the assignment: %v", err)
+		}
+		circuit := &cdl.CircuitPoPSecp256k1{
+			CertBytes: make([]uints.U8, len(assignment.CertBytes)),
+			Challenge: make([]uints.U8, challengeSize),
+		}
+		err = common.CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestPoPSecp256k1SigningContext(t *testing.T) {
+	challengeSize := 32
+	for _, tt := range signingContextCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assignment, err := mockPoPSecp256k1Assignment(oidNamedCurveSecp2k, challengeSize, tt.legacySigner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			circuit := &cdl.CircuitPoPSecp256k1{
+				CertBytes:       make([]uints.U8, len(assignment.CertBytes)),
+				Challenge:       make([]uints.U8, challengeSize),
+				LegacyChallenge: tt.legacyCircuit,
+			}
+			err = common.CheckWitness(circuit, assignment)
+			if tt.valid != (err == nil) {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+// mockPoPSecp256k1Assignment creates a certificate with a secp256k1 subject
+// key, declared with the curve OID, and signs a random challenge with it, the
+// message of the wallet signer (the bare challenge with legacy).
+// crypto/x509 does not support secp256k1, the certificate is encoded by hand
+// and signed by a P-256 issuer.
+func mockPoPSecp256k1Assignment(curve asn1.ObjectIdentifier, challengeSize int, legacy bool) (*cdl.CircuitPoPSecp256k1, error) {
+	signerKey, err := secp256k1ecdsa.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	x, y := signerKey.PublicKey.A.X.BigInt(new(big.Int)), signerKey.PublicKey.A.Y.BigInt(new(big.Int))
+
+	issuerKey, err := stdecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate issuer key: %w", err)
+	}
+	certDER, err := createSecp256k1Certificate(common.MarshalSecp256k1PublicKey(x, y), curve, issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	pubKeyPosition, err := cdl.FindSubjectPublicKeyPosition(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("finding subject public key position failed: %w", err)
+	}
+
+	challenge, err := common.GenerateRandomBytes(challengeSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a challenge: %w", err)
+	}
+	message, err := walletSigner(nil, legacy).Message(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the signed message: %w", err)
+	}
+	signature, err := signerKey.Sign(message, sha256.New())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the challenge: %w", err)
+	}
+
+	return &cdl.CircuitPoPSecp256k1{
+		CertBytes:           common.BytesToU8Array(certDER),
+		CertLength:          frontend.Variable(len(certDER)),
+		SubjectPubKeyPos:    frontend.Variable(pubKeyPosition),
+		SignerPubKeyX:       emulated.ValueOf[curves.Secp256k1Fp](x),
+		SignerPubKeyY:       emulated.ValueOf[curves.Secp256k1Fp](y),
+		ChallengeSignatureR: emulated.ValueOf[curves.Secp256k1Fr](new(big.Int).SetBytes(signature[:32])),
+		ChallengeSignatureS: emulated.ValueOf[curves.Secp256k1Fr](new(big.Int).SetBytes(signature[32:])),
+		Challenge:           common.BytesToU8Array(challenge),
+	}, nil
+}
+
+// createSecp256k1Certificate encodes an X.509 v3 certificate of the
+// uncompressed public key, an ecPublicKey of the curve
+func createSecp256k1Certificate(publicKey []byte, curve asn1.ObjectIdentifier, issuerKey *stdecdsa.PrivateKey) ([]byte, error) {
+	type validity struct {
+		NotBefore, NotAfter time.Time
+	}
+	type subjectPublicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	type tbsCertificate struct {
+		Version            int `asn1:"optional,explicit,default:0,tag:0"`
+		SerialNumber       *big.Int
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Issuer             pkix.RDNSequence
+		Validity           validity
+		Subject            pkix.RDNSequence
+		PublicKey          subjectPublicKeyInfo
+	}
+	type certificate struct {
+		TBSCertificate     asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		SignatureValue     asn1.BitString
+	}
+
+	curveParameter, err := asn1.Marshal(curve)
+	if err != nil {
+		return nil, err
+	}
+	signatureAlgorithm := pkix.AlgorithmIdentifier{Algorithm: oidSignatureES256}
+	tbs, err := asn1.Marshal(tbsCertificate{
+		Version:            2,
+		SerialNumber:       big.NewInt(1),
+		SignatureAlgorithm: signatureAlgorithm,
+		Issuer:             pkix.Name{CommonName: "Test Issuer"}.ToRDNSequence(),
+		Validity:           validity{time.Now().UTC().Truncate(time.Second), time.Now().UTC().Add(365 * 24 * time.Hour).Truncate(time.Second)},
+		Subject:            pkix.Name{Organization: []string{"Test Org"}, CommonName: "Test Wallet"}.ToRDNSequence(),
+		PublicKey: subjectPublicKeyInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: curveParameter}},
+			PublicKey: asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(tbs)
+	signature, err := stdecdsa.SignASN1(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(certificate{
+		TBSCertificate:     asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: signatureAlgorithm,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+}
@@ -1,17 +1,41 @@
 package cdl
 
 import (
+	"fmt"
+
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
-	"github.com/consensys/gnark/std/signature/ecdsa"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 // CircuitPoP proves:
 // 1. I have a certificate with a subject public key
 // 2. I can sign a challenge with the private key corresponding to that public key
 // 3. Without revealing the certificate or the public key
+//
+// The certificate is only navigated to its subject public key: nothing ties
+// it to an issuer signature, any DER with an embedded key satisfies the
+// circuit (see CircuitPoPCA for a certificate signed by a public CA key).
+// With BindCert the SHA-256 of the certificate is a public input, the
+// verifier checks it against the certificate it holds out-of-band.
+//
+// With BindPIN the proof needs the key and a PIN (possession and knowledge):
+// the holder signs SHA-256(Challenge || PINDigest) instead of the challenge,
+// and the public PINCommitment is SHA-256(PINSalt || PINDigest), compared by
+// the verifier with the commitment enrolled for the holder
+// (common.PINChallenge, models.PINCommitment). PINDigest is the Argon2id
+// digest of the PIN with the salt (models.PINDigest). The commitment is the
+// same in every proof of the holder and links them; with the salt, it lets the
+// PIN be brute-forced offline, so the salt is kept off the device or sealed by
+// a hardware key.
+//
+// The holder signs the challenge, or its PIN message, in a signing context
+// (models.ContextMessage): common.SigningContextChallenge for the
+// presentations, common.SigningContextIssuance for a key proof sent to an
+// issuer (SigningContext). LegacyChallenge accepts the bare challenge of the
+// wallets signing before the signing contexts.
 type CircuitPoP struct {
 	// ===== PRIVATE INPUTS (prover's secrets) =====
 
@@ -23,15 +47,36 @@ type CircuitPoP struct {
 	SubjectPubKeyPos frontend.Variable `gnark:",secret"`
 
 	// The subject public key (secret - must match the subject key in the certificate)
-	SignerPubKeyX emulated.Element[Secp256r1Fp] `gnark:",secret"`
-	SignerPubKeyY emulated.Element[Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
 
 	// Signature on the challenge (secret)
-	ChallengeSignatureR emulated.Element[Secp256r1Fr] `gnark:",secret"`
-	ChallengeSignatureS emulated.Element[Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// Argon2id digest of the PIN and the salt of its commitment (BindPIN),
+	// empty otherwise
+	PINDigest []uints.U8 `gnark:",secret"`
+	PINSalt   []uints.U8 `gnark:",secret"`
 
 	// ===== PUBLIC INPUTS (known to verifier) =====
 	Challenge []uints.U8 `gnark:",public"` // Verifier's challenge
+	// SHA-256 of the first CertLength bytes of CertBytes (BindCert), the
+	// padding past CertLength is zero; empty otherwise
+	CertDigest []uints.U8 `gnark:",public"`
+	// SHA-256(PINSalt || PINDigest) (BindPIN), empty otherwise
+	PINCommitment []uints.U8 `gnark:",public"`
+
+	// BindCert exposes the digest of the certificate, set at compile time
+	BindCert bool `gnark:"-"`
+	// BindPIN co-binds a PIN to the challenge signature, set at compile time
+	BindPIN bool `gnark:"-"`
+	// SigningContext is the context the challenge is signed in,
+	// common.SigningContextChallenge when empty, set at compile time
+	SigningContext string `gnark:"-"`
+	// LegacyChallenge verifies the signature of the bare challenge, without
+	// signing context, set at compile time
+	LegacyChallenge bool `gnark:"-"`
 }
 
 // Define implements the circuit logic
@@ -39,35 +84,65 @@ func (c *CircuitPoP) Define(api frontend.API) error {
 
 	// ===== STEP 1: Navigate certificate structure to find SubjectPublicKeyInfo =====
 	// This proves we're at the SUBJECT's public key, not the issuer's or any other key
-	subjectPubKeyPos := NavigateToSubjectPublicKeyInfo(api, c.CertBytes[:])
+	spkiPos := NavigateToSPKI(api, c.CertBytes[:])
 
-	// ===== STEP 2: Verify claimed position matches the proven position =====
-	api.AssertIsEqual(subjectPubKeyPos, c.SubjectPubKeyPos)
+	// ===== STEP 2: Extract subject public key from the SubjectPublicKeyInfo =====
+	// The AlgorithmIdentifier is parsed (id-ecPublicKey, prime256v1) and the
+	// BIT STRING located by structure
+	extractedPubKey, subjectPubKeyPos := ExtractSubjectPublicKeyFromSPKI(api, c.CertBytes[:], spkiPos)
 
-	// ===== STEP 3: Extract subject public key from certificate =====
-	extractedPubKey := ExtractSubjectPublicKeyFromCert(
-		api,
-		c.CertBytes[:],
-		subjectPubKeyPos, // Use the proven position
-	)
+	// ===== STEP 3: Verify claimed position matches the proven position =====
+	common.AssertEqual(api, subjectPubKeyPos, c.SubjectPubKeyPos, "subject public key position")
 
 	// ===== STEP 4: Verify extracted key matches the claimed public key =====
 	// common.CompareBytes(api, extractedPubKey, circuit.SignerPubKeyBytes)
 	common.ComparePublicKeys(api, c.SignerPubKeyX, c.SignerPubKeyY, extractedPubKey)
 
-	// ===== STEP 5: Verify signature on challenge =====
+	// ===== STEP 5: Bind the certificate (BindCert) =====
+	if c.BindCert {
+		if len(c.CertDigest) != 32 {
+			return fmt.Errorf("certificate digest of %d bytes, expected 32", len(c.CertDigest))
+		}
+		digest, err := common.SHA256Prefix(api, c.CertBytes, c.CertLength)
+		if err != nil {
+			return err
+		}
+		common.AssertBytesEqual(api, digest, c.CertDigest, "certificate digest")
+	} else if len(c.CertDigest) != 0 {
+		return fmt.Errorf("certificate digest without BindCert")
+	}
 
-	publicKey := ecdsa.PublicKey[Secp256r1Fp, Secp256r1Fr]{
-		X: c.SignerPubKeyX,
-		Y: c.SignerPubKeyY,
+	// ===== STEP 6: Co-bind the PIN (BindPIN) =====
+	message := c.Challenge
+	if c.BindPIN {
+		if len(c.PINCommitment) != common.PINDigestSize {
+			return fmt.Errorf("PIN commitment of %d bytes, expected %d", len(c.PINCommitment), common.PINDigestSize)
+		}
+		pinMessage, commitment, err := common.PINChallenge(api, c.Challenge, c.PINDigest, c.PINSalt)
+		if err != nil {
+			return err
+		}
+		common.AssertBytesEqual(api, commitment, c.PINCommitment, "PIN commitment")
+		message = pinMessage
+	} else if len(c.PINDigest) != 0 || len(c.PINSalt) != 0 || len(c.PINCommitment) != 0 {
+		return fmt.Errorf("PIN inputs without BindPIN")
 	}
 
-	signature := ecdsa.Signature[Secp256r1Fr]{
-		R: c.ChallengeSignatureR,
-		S: c.ChallengeSignatureS,
+	// ===== STEP 7: Separate the signing context =====
+	message, err := signedMessage(api, c.SigningContext, c.LegacyChallenge, message)
+	if err != nil {
+		return err
 	}
 
-	common.VerifyES256(api, c.Challenge, publicKey, signature)
+	// ===== STEP 8: Verify signature on challenge =====
+
+	publicKey := curves.NewPublicKey(c.SignerPubKeyX, c.SignerPubKeyY)
+
+	signature := curves.NewSignature(c.ChallengeSignatureR, c.ChallengeSignatureS)
+
+	if err := common.VerifyES256(api, message, publicKey, signature); err != nil {
+		return err
+	}
 	// ===== PROOF COMPLETE =====
 	// We've proven:
 	// 1. We extracted a public key from a certificate at a claimed position
@@ -76,3 +151,20 @@ func (c *CircuitPoP) Define(api frontend.API) error {
 
 	return nil
 }
+
+// signedMessage returns the message the holder key signs for message: its
+// context message (common.ContextMessage) in signingContext,
+// common.SigningContextChallenge when empty, or the bare message with legacy
+// (SigningContext and LegacyChallenge of the PoP circuits)
+func signedMessage(api frontend.API, signingContext string, legacy bool, message []uints.U8) ([]uints.U8, error) {
+	if legacy {
+		if signingContext != "" {
+			return nil, fmt.Errorf("signing context %q with LegacyChallenge", signingContext)
+		}
+		return message, nil
+	}
+	if signingContext == "" {
+		signingContext = common.SigningContextChallenge
+	}
+	return common.ContextMessage(api, signingContext, message)
+}
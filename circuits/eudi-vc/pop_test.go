@@ -0,0 +1,290 @@
+package cdl_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/wallet"
+)
+
+// walletSigner returns the wallet signer of the presentation challenges with
+// key, signing the bare challenges with legacy
+func walletSigner(key *ecdsa.PrivateKey, legacy bool) wallet.ContextSigner {
+	signer := wallet.NewChallengeSigner(wallet.KeySigner{Key: key})
+	signer.Legacy = legacy
+	return signer
+}
+
+// walletSignature signs the challenge with the wallet signer of key and
+// returns the ChallengeSignatureR/S inputs
+func walletSignature(key *ecdsa.PrivateKey, legacy bool, challenge []byte) (r, s emulated.Element[curves.Secp256r1Fr], err error) {
+	signature, err := walletSigner(key, legacy).SignChallenge(context.Background(), challenge)
+	if err != nil {
+		return r, s, err
+	}
+	r, s = signature.Witness()
+	return r, s, nil
+}
+
+// signingContextCases are the challenge signatures of the wallet signer, in
+// the presentation signing context or of the bare challenge (legacySigner),
+// checked by the circuits compiled with or without LegacyChallenge
+var signingContextCases = []struct {
+	name          string
+	legacyCircuit bool
+	legacySigner  bool
+	valid         bool
+}{
+	{"context signature", false, false, true},
+	{"bare challenge signature", false, true, false},
+	{"legacy circuit", true, true, true},
+	{"context signature in the legacy circuit", true, false, false},
+}
+
+func TestPoPCertBinding(t *testing.T) {
+	signerKey, ca := mockKey(t), mockKey(t)
+	certDER, _, _, _ := mockCert(t, &signerKey.PublicKey, ca)
+	pubKeyPosition, err := cdl.FindSubjectPublicKeyPosition(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, _ := common.GenerateRandomBytes(32)
+	challengeDigest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
+	r, s, err := ecdsa.Sign(rand.Reader, signerKey, challengeDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate in a zero padded buffer
+	maxCertSize := len(certDER) + 16
+	assignment := func(cert []byte, digest [32]byte) *cdl.CircuitPoP {
+		return &cdl.CircuitPoP{
+			CertBytes:           common.BytesToU8Array(padded(cert, maxCertSize)),
+			CertLength:          len(certDER),
+			SubjectPubKeyPos:    frontend.Variable(pubKeyPosition),
+			SignerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+			SignerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+			ChallengeSignatureR: emulated.ValueOf[curves.Secp256r1Fr](r),
+			ChallengeSignatureS: emulated.ValueOf[curves.Secp256r1Fr](s),
+			Challenge:           common.BytesToU8Array(challenge),
+			CertDigest:          common.BytesToU8Array(digest[:]),
+		}
+	}
+	circuit := &cdl.CircuitPoP{
+		CertBytes:  make([]uints.U8, maxCertSize),
+		Challenge:  make([]uints.U8, len(challenge)),
+		CertDigest: make([]uints.U8, 32),
+		BindCert:   true,
+	}
+
+	digest := sha256.Sum256(certDER)
+	if err := common.CheckWitness(circuit, assignment(certDER, digest)); err != nil {
+		t.Fatalf("expected the witness to satisfy the circuit: %v", err)
+	}
+	if err := common.CheckWitness(circuit, assignment(certDER, sha256.Sum256([]byte("another certificate")))); err == nil {
+		t.Error("expected an error for the digest of another certificate")
+	}
+	trailing := append(append([]byte{}, certDER...), 1)
+	if err := common.CheckWitness(circuit, assignment(trailing, digest)); err == nil {
+		t.Error("expected an error for bytes past the certificate length")
+	}
+
+	// without BindCert the digest is not an input
+	circuit.BindCert = false
+	if err := common.CheckWitness(circuit, assignment(certDER, digest)); err == nil {
+		t.Error("expected an error for a digest without BindCert")
+	}
+	circuit.CertDigest = nil
+	unbound := assignment(certDER, digest)
+	unbound.CertDigest = nil
+	if err := common.CheckWitness(circuit, unbound); err != nil {
+		t.Fatalf("expected the unbound witness to satisfy the circuit: %v", err)
+	}
+}
+
+func TestPoPSubjectKeyCurve(t *testing.T) {
+	signerKey, ca := mockKey(t), mockKey(t)
+	point := elliptic.Marshal(elliptic.P256(), signerKey.PublicKey.X, signerKey.PublicKey.Y)
+	challenge, _ := common.GenerateRandomBytes(32)
+	digest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
+	r, s, err := ecdsa.Sign(rand.Reader, signerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		curve asn1.ObjectIdentifier
+		valid bool
+	}{
+		{"P-256 subject key", oidNamedCurveP256, true},
+		// the same key bytes, at the same layout, declared as a secp256k1 key
+		{"secp256k1 algorithm", oidNamedCurveSecp2k, false},
+	}
+	for _, tt := range tests {
+		certDER, err := createSecp256k1Certificate(point, tt.curve, ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKeyPosition, err := cdl.FindSubjectPublicKeyPosition(certDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		circuit := &cdl.CircuitPoP{
+			CertBytes: make([]uints.U8, len(certDER)),
+			Challenge: make([]uints.U8, len(challenge)),
+		}
+		assignment := &cdl.CircuitPoP{
+			CertBytes:           common.BytesToU8Array(certDER),
+			CertLength:          len(certDER),
+			SubjectPubKeyPos:    frontend.Variable(pubKeyPosition),
+			SignerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+			SignerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+			ChallengeSignatureR: emulated.ValueOf[curves.Secp256r1Fr](r),
+			ChallengeSignatureS: emulated.ValueOf[curves.Secp256r1Fr](s),
+			Challenge:           common.BytesToU8Array(challenge),
+		}
+		err = common.CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestPoPPIN(t *testing.T) {
+	signerKey, ca := mockKey(t), mockKey(t)
+	certDER, _, _, _ := mockCert(t, &signerKey.PublicKey, ca)
+	pubKeyPosition, err := cdl.FindSubjectPublicKeyPosition(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, _ := common.GenerateRandomBytes(32)
+	salt, _ := common.GenerateRandomBytes(16)
+	pinDigest, err := models.PINDigest("123456", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrolled := models.PINCommitment(salt, pinDigest)
+
+	// the holder signs message, the challenge co-bound to the PIN
+	assignment := func(pinDigest, message []byte) *cdl.CircuitPoP {
+		digest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, message))
+		r, s, err := ecdsa.Sign(rand.Reader, signerKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &cdl.CircuitPoP{
+			CertBytes:           common.BytesToU8Array(certDER),
+			CertLength:          len(certDER),
+			SubjectPubKeyPos:    frontend.Variable(pubKeyPosition),
+			SignerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+			SignerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+			ChallengeSignatureR: emulated.ValueOf[curves.Secp256r1Fr](r),
+			ChallengeSignatureS: emulated.ValueOf[curves.Secp256r1Fr](s),
+			PINDigest:           common.BytesToU8Array(pinDigest),
+			PINSalt:             common.BytesToU8Array(salt),
+			Challenge:           common.BytesToU8Array(challenge),
+			PINCommitment:       common.BytesToU8Array(enrolled),
+		}
+	}
+	circuit := &cdl.CircuitPoP{
+		CertBytes:     make([]uints.U8, len(certDER)),
+		Challenge:     make([]uints.U8, len(challenge)),
+		PINDigest:     make([]uints.U8, common.PINDigestSize),
+		PINSalt:       make([]uints.U8, len(salt)),
+		PINCommitment: make([]uints.U8, common.PINDigestSize),
+		BindPIN:       true,
+	}
+
+	if err := common.CheckWitness(circuit, assignment(pinDigest, models.PINChallenge(challenge, pinDigest))); err != nil {
+		t.Fatalf("expected the witness to satisfy the circuit: %v", err)
+	}
+	// the key alone: a signature of the bare challenge
+	if err := common.CheckWitness(circuit, assignment(pinDigest, challenge)); err == nil {
+		t.Error("expected an error for a signature without the PIN")
+	}
+	// the key and a wrong PIN
+	wrong, err := models.PINDigest("654321", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuit, assignment(wrong, models.PINChallenge(challenge, wrong))); err == nil {
+		t.Error("expected an error for another PIN than the enrolled one")
+	}
+}
+
+func TestPoPSigningContext(t *testing.T) {
+	signerKey, ca := mockKey(t), mockKey(t)
+	certDER, _, _, _ := mockCert(t, &signerKey.PublicKey, ca)
+	pubKeyPosition, err := cdl.FindSubjectPublicKeyPosition(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, _ := common.GenerateRandomBytes(32)
+
+	// the holder signs message
+	assignment := func(message []byte) *cdl.CircuitPoP {
+		digest := sha256.Sum256(message)
+		r, s, err := ecdsa.Sign(rand.Reader, signerKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &cdl.CircuitPoP{
+			CertBytes:           common.BytesToU8Array(certDER),
+			CertLength:          len(certDER),
+			SubjectPubKeyPos:    frontend.Variable(pubKeyPosition),
+			SignerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+			SignerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+			ChallengeSignatureR: emulated.ValueOf[curves.Secp256r1Fr](r),
+			ChallengeSignatureS: emulated.ValueOf[curves.Secp256r1Fr](s),
+			Challenge:           common.BytesToU8Array(challenge),
+		}
+	}
+	circuit := func(context string, legacy bool) *cdl.CircuitPoP {
+		return &cdl.CircuitPoP{
+			CertBytes:       make([]uints.U8, len(certDER)),
+			Challenge:       make([]uints.U8, len(challenge)),
+			SigningContext:  context,
+			LegacyChallenge: legacy,
+		}
+	}
+	presentation := models.ContextMessage(models.SigningContextChallenge, challenge)
+	issuance := models.ContextMessage(models.SigningContextIssuance, challenge)
+
+	if err := common.CheckWitness(circuit("", false), assignment(presentation)); err != nil {
+		t.Fatalf("expected the presentation signature to satisfy the circuit: %v", err)
+	}
+	if err := common.CheckWitness(circuit(models.SigningContextIssuance, false), assignment(issuance)); err != nil {
+		t.Fatalf("expected the issuance signature to satisfy the issuance circuit: %v", err)
+	}
+	// a signature of another context, or of the bare challenge
+	if err := common.CheckWitness(circuit("", false), assignment(issuance)); err == nil {
+		t.Error("expected an error for an issuance signature presented as a challenge signature")
+	}
+	if err := common.CheckWitness(circuit("", false), assignment(challenge)); err == nil {
+		t.Error("expected an error for a signature of the bare challenge")
+	}
+
+	// the legacy flows sign the bare challenge
+	if err := common.CheckWitness(circuit("", true), assignment(challenge)); err != nil {
+		t.Fatalf("expected the legacy signature to satisfy the legacy circuit: %v", err)
+	}
+	if err := common.CheckWitness(circuit("", true), assignment(presentation)); err == nil {
+		t.Error("expected an error for a context signature in the legacy circuit")
+	}
+	if err := common.CheckWitness(circuit(models.SigningContextIssuance, true), assignment(challenge)); err == nil {
+		t.Error("expected an error for a signing context with LegacyChallenge")
+	}
+}
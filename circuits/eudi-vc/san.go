@@ -0,0 +1,290 @@
+package cdl
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/dertags"
+	"github.com/mynextid/eudi-zk/x509pos"
+)
+
+// GeneralName tags of the SubjectAlternativeName values (context-specific,
+// IMPLICIT IA5String)
+const (
+	GeneralNameEmail = x509pos.GeneralNameEmail
+	GeneralNameURI   = x509pos.GeneralNameURI
+)
+
+// SANDisclosure selects what the verifier learns about the SAN value
+type SANDisclosure int
+
+const (
+	// SANDiscloseHash reveals SHA-256 of the value only
+	SANDiscloseHash SANDisclosure = iota
+	// SANDiscloseEqual proves the value equals a public expected value
+	SANDiscloseEqual
+)
+
+// CircuitSAN proves:
+// 1. The certificate has a SubjectAlternativeName extension (2.5.29.17)
+// 2. The extension contains a GeneralName of the chosen type (email or URI)
+// 3. Its value hashes to the public digest (SANDiscloseHash), or equals the
+// public expected value (SANDiscloseEqual)
+// 4. Without revealing the certificate nor the other names
+type CircuitSAN struct {
+	// Circuit parameters set at compile time
+	GeneralNameTag  int           `gnark:"-"` // GeneralNameEmail or GeneralNameURI
+	Disclosure      SANDisclosure `gnark:"-"`
+	MaxExtensions   int           `gnark:"-"` // extensions walked to find the SAN
+	MaxGeneralNames int           `gnark:"-"` // GeneralNames walked to find the value
+	MaxValueLen     int           `gnark:"-"`
+
+	// ===== PRIVATE INPUTS =====
+	CertBytes []uints.U8 `gnark:",secret"`
+
+	// Position of the SAN Extension SEQUENCE and of the chosen GeneralName
+	// (from off-circuit parsing, see FindSANPositions)
+	SANExtensionPos frontend.Variable `gnark:",secret"`
+	GeneralNamePos  frontend.Variable `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS =====
+	// SHA-256 of the value (SANDiscloseHash) or the value zero padded to
+	// MaxValueLen bytes (SANDiscloseEqual)
+	Disclosed []uints.U8 `gnark:",public"`
+}
+
+// NewCircuitSAN creates a SAN disclosure circuit with the specified sizes
+func NewCircuitSAN(maxCertSize, maxValueLen, generalNameTag int, disclosure SANDisclosure) *CircuitSAN {
+	disclosedLen := 32
+	if disclosure == SANDiscloseEqual {
+		disclosedLen = maxValueLen
+	}
+	return &CircuitSAN{
+		GeneralNameTag:  generalNameTag,
+		Disclosure:      disclosure,
+		MaxExtensions:   12,
+		MaxGeneralNames: 4,
+		MaxValueLen:     maxValueLen,
+		CertBytes:       make([]uints.U8, maxCertSize),
+		Disclosed:       make([]uints.U8, disclosedLen),
+	}
+}
+
+// Define implements the gnark Circuit interface
+func (c *CircuitSAN) Define(api frontend.API) error {
+	value, valueLength := ExtractSANValue(api, c.CertBytes, c.SANExtensionPos, c.GeneralNamePos,
+		c.GeneralNameTag, c.MaxExtensions, c.MaxGeneralNames, c.MaxValueLen)
+
+	switch c.Disclosure {
+	case SANDiscloseHash:
+		digest, err := common.LengthedBytes{Data: value, Length: valueLength}.SHA256(api)
+		if err != nil {
+			return err
+		}
+		common.AssertBytesEqual(api, digest, c.Disclosed, "san: value digest")
+	case SANDiscloseEqual:
+		common.AssertBytesEqual(api, value, c.Disclosed, "san: value")
+	default:
+		return fmt.Errorf("unknown SAN disclosure %d", c.Disclosure)
+	}
+
+	return nil
+}
+
+// NavigateToExtensions navigates to the extensions of the certificate and
+// returns the position of the first Extension and the end of the list
+func NavigateToExtensions(
+	api frontend.API,
+
+	certBytes []uints.U8,
+) (frontend.Variable, frontend.Variable) {
+	index := frontend.Variable(0)
+
+	// Skip outer Certificate SEQUENCE
+	tag := ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: Certificate SEQUENCE tag")
+	index = api.Add(index, 1)
+	_, lengthBytes := ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+
+	return navigateTBSToExtensions(api, certBytes, index)
+}
+
+// NavigateToExtensionsInTBS is NavigateToExtensions for the TBSCertificate
+// bytes, as the circuits verifying the certificate signature take them
+func NavigateToExtensionsInTBS(
+	api frontend.API,
+
+	tbs []uints.U8,
+) (frontend.Variable, frontend.Variable) {
+	return navigateTBSToExtensions(api, tbs, 0)
+}
+
+// navigateTBSToExtensions navigates from the TBSCertificate at index to its
+// extensions
+func navigateTBSToExtensions(
+	api frontend.API,
+
+	certBytes []uints.U8,
+	index frontend.Variable,
+) (frontend.Variable, frontend.Variable) {
+	// Enter TBSCertificate SEQUENCE
+	tag := ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: TBSCertificate SEQUENCE tag")
+	index = api.Add(index, 1)
+	_, lengthBytes := ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+
+	// Field 1: Version [0] EXPLICIT, v3 is required for extensions
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Explicit0, "cert: version tag")
+	index = api.Add(index, SkipElement(api, certBytes, index))
+
+	// Field 2: Serial Number (INTEGER 0x02)
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Integer, "cert: serialNumber INTEGER tag")
+	index = api.Add(index, SkipElement(api, certBytes, index))
+
+	// Fields 3-7: Signature Algorithm, Issuer, Validity, Subject,
+	// SubjectPublicKeyInfo (SEQUENCE 0x30)
+	for _, field := range []string{"signature AlgorithmIdentifier", "issuer Name", "validity", "subject Name", "subjectPublicKeyInfo"} {
+		tag = ReadByteAt(api, certBytes, index)
+		common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: %s tag", field)
+		index = api.Add(index, SkipElement(api, certBytes, index))
+	}
+
+	// Fields 8-9: issuerUniqueID [1] and subjectUniqueID [2] (optional)
+	for _, uniqueIDTag := range []int{dertags.Implicit1, dertags.Implicit2} {
+		tag = ReadByteAt(api, certBytes, index)
+		present := api.IsZero(api.Sub(tag.Val, uniqueIDTag))
+		index = api.Add(index, api.Select(present, SkipElement(api, certBytes, index), 0))
+	}
+
+	// Field 10: extensions [3] EXPLICIT
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Explicit3, "cert: extensions tag")
+	index = api.Add(index, 1)
+	_, lengthBytes = ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+
+	// Extensions SEQUENCE
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: Extensions SEQUENCE tag")
+	index = api.Add(index, 1)
+	length, lengthBytes := ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+
+	return index, api.Add(index, length)
+}
+
+// AssertElementInList asserts pos is the start of one of the first maxElements
+// DER elements of the list data[start:end], so it cannot point inside the
+// value of another element
+func AssertElementInList(
+	api frontend.API,
+
+	data []uints.U8,
+	start, end, pos frontend.Variable,
+	maxElements int,
+	label string,
+) {
+	index := start
+	active := frontend.Variable(1)
+	matches := frontend.Variable(0)
+	for range maxElements {
+		active = api.Mul(active, api.Sub(1, api.IsZero(api.Sub(index, end))))
+		matches = api.Add(matches, api.Mul(active, api.IsZero(api.Sub(index, pos))))
+		index = api.Add(index, api.Select(active, SkipElement(api, data, index), 0))
+	}
+	common.AssertEqual(api, matches, 1, "%s", label)
+}
+
+// ExtractSANValue extracts the value of the GeneralName at generalNamePos of
+// the SubjectAlternativeName extension at sanExtensionPos. It returns the value
+// zero padded to maxValueLen bytes and its length.
+func ExtractSANValue(
+	api frontend.API,
+
+	certBytes []uints.U8,
+	sanExtensionPos, generalNamePos frontend.Variable,
+	generalNameTag, maxExtensions, maxGeneralNames, maxValueLen int,
+) ([]uints.U8, frontend.Variable) {
+	// The extension is one of the certificate extensions
+	extensionsStart, extensionsEnd := NavigateToExtensions(api, certBytes)
+	AssertElementInList(api, certBytes, extensionsStart, extensionsEnd, sanExtensionPos, maxExtensions,
+		"san: extension is a certificate extension")
+
+	// Extension SEQUENCE
+	index := sanExtensionPos
+	tag := ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "san: Extension SEQUENCE tag")
+	index = api.Add(index, 1)
+	_, lengthBytes := ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+
+	// extnID 2.5.29.17
+	oid := readBytesAt(api, certBytes, index, len(dertags.OIDSubjectAltName))
+	common.AssertOID(api, oid, dertags.OIDSubjectAltName, "san: extnID")
+	index = api.Add(index, len(dertags.OIDSubjectAltName))
+
+	// critical BOOLEAN (optional, DEFAULT FALSE)
+	tag = ReadByteAt(api, certBytes, index)
+	hasCritical := api.IsZero(api.Sub(tag.Val, dertags.Boolean))
+	index = api.Add(index, api.Select(hasCritical, 3, 0))
+
+	// extnValue OCTET STRING
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.OctetString, "san: extnValue OCTET STRING tag")
+	index = api.Add(index, 1)
+	_, lengthBytes = ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+
+	// GeneralNames SEQUENCE
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "san: GeneralNames SEQUENCE tag")
+	index = api.Add(index, 1)
+	namesLength, lengthBytes := ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+	AssertElementInList(api, certBytes, index, api.Add(index, namesLength), generalNamePos, maxGeneralNames,
+		"san: GeneralName is in the extension")
+
+	// GeneralName of the chosen type
+	tag = ReadByteAt(api, certBytes, generalNamePos)
+	common.AssertEqual(api, tag.Val, generalNameTag, "san: GeneralName tag")
+	valueLength, lengthBytes := ReadDERLength(api, certBytes, api.Add(generalNamePos, 1))
+	api.AssertIsLessOrEqual(valueLength, maxValueLen)
+	valueStart := api.Add(generalNamePos, 1, lengthBytes)
+
+	// Zero the bytes past the value. IA5String email addresses and URIs have no
+	// NUL byte, so the padded value is unambiguous.
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		panic(err)
+	}
+	raw := readBytesAt(api, certBytes, valueStart, maxValueLen)
+	value := make([]uints.U8, maxValueLen)
+	inValue := frontend.Variable(1)
+	for i := range raw {
+		inValue = api.Sub(inValue, api.IsZero(api.Sub(valueLength, i)))
+		common.AssertEqual(api, api.Mul(inValue, api.IsZero(raw[i].Val)), 0, "san: value byte %d is not NUL", i)
+		value[i] = bytesAPI.ValueOf(api.Mul(inValue, raw[i].Val))
+	}
+
+	return value, valueLength
+}
+
+// FindSANPositions locates the SubjectAlternativeName Extension and its first
+// GeneralName with the given tag in DER bytes
+func FindSANPositions(certDER []byte, generalNameTag byte) (extensionPos, generalNamePos int, err error) {
+	cert, err := x509pos.Parse(certDER)
+	if err != nil {
+		return 0, 0, err
+	}
+	name, err := cert.SANName(generalNameTag)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cert.SAN.Start, name.Start, nil
+}
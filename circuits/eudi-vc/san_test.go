@@ -0,0 +1,159 @@
+package cdl_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+func TestSANHash(t *testing.T) {
+	// == Circuit data ==
+	ccsPath := "compiled/circuit-san-hash-v1.ccs"
+	pkPath := "compiled/proving-san-hash-v1.key"
+	vkPath := "compiled/verifying-san-hash-v1.key"
+	// true: recompile, false: load circuit if exists
+	forceCompile := true
+
+	maxValueLen := 64
+
+	assignment, err := mockSANAssignment(cdl.GeneralNameEmail, cdl.SANDiscloseHash, maxValueLen)
+	if err != nil {
+		t.Fatalf("failed to create the assignment: %v", err)
+	}
+
+	// == create the circuit and execute it ==
+	circuitTemplate := cdl.NewCircuitSAN(len(assignment.CertBytes), maxValueLen, cdl.GeneralNameEmail, cdl.SANDiscloseHash)
+
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// == Init the circuit ==
+	fmt.Println("\n--- Init the circuit ---")
+	startCircuit := time.Now()
+
+	ccs, pk, vk, err := common.InitCircuit(ccsPath, pkPath, vkPath, forceCompile, circuitTemplate)
+	if err != nil {
+		t.Fatalf("failed to initialize a circuit: %v", err)
+	}
+
+	circuitTime := time.Since(startCircuit)
+	fmt.Printf("[OK] Circuit created/loaded successfully! (took %v)\n", circuitTime)
+
+	// == Run the circuit ==
+	common.TestCircuit(assignment, ccs, pk, vk)
+}
+
+func TestSANEqual(t *testing.T) {
+	maxValueLen := 64
+
+	assignment, err := mockSANAssignment(cdl.GeneralNameURI, cdl.SANDiscloseEqual, maxValueLen)
+	if err != nil {
+		t.Fatalf("failed to create the assignment: %v", err)
+	}
+	circuitTemplate := cdl.NewCircuitSAN(len(assignment.CertBytes), maxValueLen, cdl.GeneralNameURI, cdl.SANDiscloseEqual)
+
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// another expected value
+	assignment.Disclosed = common.BytesToU8Array(padded([]byte("https://other.example/alice"), maxValueLen))
+	if err := common.CheckWitness(circuitTemplate, assignment); err == nil {
+		t.Fatal("expected the witness check to fail for another value")
+	}
+}
+
+func TestSANPositionInsideGeneralName(t *testing.T) {
+	maxValueLen := 64
+
+	assignment, err := mockSANAssignment(cdl.GeneralNameEmail, cdl.SANDiscloseHash, maxValueLen)
+	if err != nil {
+		t.Fatalf("failed to create the assignment: %v", err)
+	}
+	circuitTemplate := cdl.NewCircuitSAN(len(assignment.CertBytes), maxValueLen, cdl.GeneralNameEmail, cdl.SANDiscloseHash)
+
+	// the position must be the start of a GeneralName, not inside one
+	assignment.GeneralNamePos = frontend.Variable(assignment.GeneralNamePos.(int) + 2)
+	if err := common.CheckWitness(circuitTemplate, assignment); err == nil {
+		t.Fatal("expected the witness check to fail for a position inside a GeneralName")
+	}
+}
+
+const sanEmail = "alice@example.com"
+
+var sanURI = &url.URL{Scheme: "https", Host: "id.example", Path: "/alice"}
+
+// mockSANAssignment creates a certificate with email and URI
+// SubjectAlternativeNames and discloses the value of the chosen type
+func mockSANAssignment(generalNameTag int, disclosure cdl.SANDisclosure, maxValueLen int) (*cdl.CircuitSAN, error) {
+	signerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization: []string{"Test Org"},
+			CommonName:   "Alice",
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"alice.example"},
+		EmailAddresses:        []string{sanEmail},
+		URIs:                  []*url.URL{sanURI},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &signerKey.PublicKey, signerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	extensionPos, generalNamePos, err := cdl.FindSANPositions(certDER, byte(generalNameTag))
+	if err != nil {
+		return nil, fmt.Errorf("finding the SAN failed: %w", err)
+	}
+
+	value := []byte(sanEmail)
+	if generalNameTag == cdl.GeneralNameURI {
+		value = []byte(sanURI.String())
+	}
+
+	disclosed := padded(value, maxValueLen)
+	if disclosure == cdl.SANDiscloseHash {
+		digest := sha256.Sum256(value)
+		disclosed = digest[:]
+	}
+
+	return &cdl.CircuitSAN{
+		GeneralNameTag:  generalNameTag,
+		Disclosure:      disclosure,
+		MaxExtensions:   12,
+		MaxGeneralNames: 4,
+		MaxValueLen:     maxValueLen,
+		CertBytes:       common.BytesToU8Array(certDER),
+		SANExtensionPos: extensionPos,
+		GeneralNamePos:  generalNamePos,
+		Disclosed:       common.BytesToU8Array(disclosed),
+	}, nil
+}
+
+func padded(value []byte, size int) []byte {
+	return append(value, make([]byte, size-len(value))...)
+}
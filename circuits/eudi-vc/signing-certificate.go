@@ -0,0 +1,109 @@
+package cdl
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/dertags"
+)
+
+// VerifySigningCertificateV2 binds the signer information of a CMS signature
+// (CAdES) to the certificate verified by the circuit: the signingCertificateV2
+// Attribute at attributePos of the signed attributes (the DER SET OF, as
+// signed) must be one of them, and the certHash of its first ESSCertIDv2 must
+// be SHA-256 of the first certLength bytes of cert, zero padded past them
+// (common.SHA256Prefix). Otherwise a signature could be presented with
+// another certificate of the same key. The hashAlgorithm of the ESSCertIDv2,
+// when present, must be SHA-256.
+func VerifySigningCertificateV2(
+	api frontend.API,
+
+	signedAttrs []uints.U8,
+	attributePos frontend.Variable,
+	maxAttributes int,
+	cert []uints.U8,
+	certLength frontend.Variable,
+) error {
+	// The attribute is one of the signed attributes
+	tag := ReadByteAt(api, signedAttrs, 0)
+	common.AssertEqual(api, tag.Val, dertags.Set, "signing certificate: signedAttrs SET tag")
+	attrsLength, lengthBytes := ReadDERLength(api, signedAttrs, 1)
+	attrsStart := api.Add(1, lengthBytes)
+	AssertElementInList(api, signedAttrs, attrsStart, api.Add(attrsStart, attrsLength), attributePos, maxAttributes,
+		"signing certificate: attribute is a signed attribute")
+
+	// Attribute SEQUENCE
+	index := attributePos
+	tag = ReadByteAt(api, signedAttrs, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "signing certificate: Attribute SEQUENCE tag")
+	index = api.Add(index, 1)
+	_, lengthBytes = ReadDERLength(api, signedAttrs, index)
+	index = api.Add(index, lengthBytes)
+
+	// attrType 1.2.840.113549.1.9.16.2.47
+	oid := readBytesAt(api, signedAttrs, index, len(dertags.OIDSigningCertificateV2))
+	common.AssertOID(api, oid, dertags.OIDSigningCertificateV2, "signing certificate: attrType")
+	index = api.Add(index, len(dertags.OIDSigningCertificateV2))
+
+	// attrValues SET, SigningCertificateV2 SEQUENCE, certs SEQUENCE OF and
+	// the first ESSCertIDv2 SEQUENCE
+	for _, header := range []struct {
+		tag  uint8
+		name string
+	}{{dertags.Set, "attrValues SET"}, {dertags.Sequence, "SigningCertificateV2 SEQUENCE"}, {dertags.Sequence, "certs SEQUENCE"}, {dertags.Sequence, "ESSCertIDv2 SEQUENCE"}} {
+		tag = ReadByteAt(api, signedAttrs, index)
+		common.AssertEqual(api, tag.Val, header.tag, "signing certificate: %s tag", header.name)
+		index = api.Add(index, 1)
+		_, lengthBytes = ReadDERLength(api, signedAttrs, index)
+		index = api.Add(index, lengthBytes)
+	}
+
+	// hashAlgorithm AlgorithmIdentifier (optional, DEFAULT SHA-256)
+	tag = ReadByteAt(api, signedAttrs, index)
+	hasAlgorithm := api.IsZero(api.Sub(tag.Val, dertags.Sequence))
+	algorithm := readBytesAt(api, signedAttrs, api.Add(index, 2), len(dertags.OIDSHA256))
+	common.AssertOIDIf(api, hasAlgorithm, algorithm, dertags.OIDSHA256, "signing certificate: hashAlgorithm")
+	index = api.Add(index, api.Select(hasAlgorithm, SkipElement(api, signedAttrs, index), 0))
+
+	// certHash OCTET STRING of 32 bytes
+	certHash := readBytesAt(api, signedAttrs, index, 2+32)
+	common.AssertEqual(api, certHash[0].Val, dertags.OctetString, "signing certificate: certHash OCTET STRING tag")
+	common.AssertEqual(api, certHash[1].Val, 32, "signing certificate: certHash length")
+
+	digest, err := common.SHA256Prefix(api, cert, certLength)
+	if err != nil {
+		return err
+	}
+	common.AssertBytesEqual(api, certHash[2:], digest, "signing certificate: certHash")
+	return nil
+}
+
+// FindSigningCertificateV2Position locates the signingCertificateV2
+// Attribute in the DER signed attributes of a CMS SignerInfo, encoded as the
+// SET OF they are signed as
+func FindSigningCertificateV2Position(signedAttrs []byte) (int, error) {
+	var set asn1.RawValue
+	if rest, err := asn1.Unmarshal(signedAttrs, &set); err != nil {
+		return 0, err
+	} else if len(rest) > 0 || set.Tag != asn1.TagSet {
+		return 0, fmt.Errorf("signed attributes are not a DER SET")
+	}
+	offset := len(set.FullBytes) - len(set.Bytes)
+	for rest := set.Bytes; len(rest) > 0; {
+		var attribute asn1.RawValue
+		next, err := asn1.Unmarshal(rest, &attribute)
+		if err != nil {
+			return 0, err
+		}
+		if attribute.Tag == asn1.TagSequence && bytes.HasPrefix(attribute.Bytes, dertags.OIDSigningCertificateV2) {
+			return offset, nil
+		}
+		offset += len(attribute.FullBytes)
+		rest = next
+	}
+	return 0, fmt.Errorf("signed attributes have no signingCertificateV2 attribute")
+}
@@ -0,0 +1,125 @@
+package cdl_test
+
+import (
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// signingCertificateCircuit binds signed attributes to a certificate
+type signingCertificateCircuit struct {
+	SignedAttrs  []uints.U8
+	AttributePos frontend.Variable
+	Cert         []uints.U8
+	CertLength   frontend.Variable
+}
+
+func (c *signingCertificateCircuit) Define(api frontend.API) error {
+	return cdl.VerifySigningCertificateV2(api, c.SignedAttrs, c.AttributePos, 6, c.Cert, c.CertLength)
+}
+
+// cmsAttribute is a CMS Attribute with one value
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// signedAttributes returns the signed attributes of a CAdES signature of the
+// certificate with certHash, encoded as the SET OF they are signed as
+func signedAttributes(t *testing.T, certHash []byte, withAlgorithm bool) []byte {
+	t.Helper()
+	type essCertIDv2 struct {
+		HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+		CertHash      []byte
+	}
+	certID := essCertIDv2{CertHash: certHash}
+	if withAlgorithm {
+		certID.HashAlgorithm = pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}}
+	}
+	signingCertificate, err := asn1.Marshal(struct{ Certs []essCertIDv2 }{[]essCertIDv2{certID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := func(v any) asn1.RawValue {
+		der, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return asn1.RawValue{FullBytes: append(append([]byte{0x31}, byte(len(der))), der...)}
+	}
+	digest := sha256.Sum256([]byte("content"))
+	attrs := []cmsAttribute{
+		{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}, Values: value(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1})},
+		{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}, Values: value(digest[:])},
+		{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}, Values: value(time.Now().UTC())},
+		{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}, Values: asn1.RawValue{FullBytes: append(append([]byte{0x31}, byte(len(signingCertificate))), signingCertificate...)}},
+	}
+	der, err := asn1.Marshal(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der[0] = 0x31 // SET OF
+	return der
+}
+
+func TestSigningCertificateV2(t *testing.T) {
+	signerKey, ca := mockKey(t), mockKey(t)
+	certDER, _, _, _ := mockCert(t, &signerKey.PublicKey, ca)
+	otherDER, _, _, _ := mockCert(t, &mockKey(t).PublicKey, ca)
+	certHash := sha256.Sum256(certDER)
+
+	maxCertSize := len(certDER) + 16
+	if len(otherDER) > maxCertSize-8 {
+		maxCertSize = len(otherDER) + 8
+	}
+	attrs := signedAttributes(t, certHash[:], true)
+	attrsSize := len(attrs) + 8
+	circuit := &signingCertificateCircuit{
+		SignedAttrs: make([]uints.U8, attrsSize),
+		Cert:        make([]uints.U8, maxCertSize),
+	}
+	assignment := func(attrs, cert []byte, pos int) *signingCertificateCircuit {
+		return &signingCertificateCircuit{
+			SignedAttrs:  common.BytesToU8Array(padded(attrs, attrsSize)),
+			AttributePos: pos,
+			Cert:         common.BytesToU8Array(padded(cert, maxCertSize)),
+			CertLength:   len(cert),
+		}
+	}
+
+	pos, err := cdl.FindSigningCertificateV2Position(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuit, assignment(attrs, certDER, pos)); err != nil {
+		t.Fatalf("expected the witness to satisfy the circuit: %v", err)
+	}
+	// hashAlgorithm is optional, SHA-256 by default
+	attrsDefault := signedAttributes(t, certHash[:], false)
+	posDefault, err := cdl.FindSigningCertificateV2Position(attrsDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuit, assignment(attrsDefault, certDER, posDefault)); err != nil {
+		t.Fatalf("expected the witness without hashAlgorithm to satisfy the circuit: %v", err)
+	}
+
+	// another certificate of the same issuer
+	if err := common.CheckWitness(circuit, assignment(attrs, otherDER, pos)); err == nil {
+		t.Error("expected an error for a substituted certificate")
+	}
+	// another attribute
+	if err := common.CheckWitness(circuit, assignment(attrs, certDER, pos-2)); err == nil {
+		t.Error("expected an error for a position that is not the attribute")
+	}
+	if _, err := cdl.FindSigningCertificateV2Position(attrs[:pos]); err == nil {
+		t.Error("expected an error for signed attributes without signingCertificateV2")
+	}
+}
@@ -0,0 +1,86 @@
+package cdl
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/dertags"
+)
+
+// ecPublicKeyBitStringLen is the length of the subjectPublicKey BIT STRING
+// of an uncompressed point of a 256-bit curve: the unused bits byte, 0x04 and
+// X || Y
+const ecPublicKeyBitStringLen = 1 + 65
+
+// ExtractSubjectPublicKeyFromSPKI extracts the 65-byte uncompressed P-256
+// public key (0x04 || X || Y), located by the structure of the
+// SubjectPublicKeyInfo SEQUENCE at spkiPos (NavigateToSPKI,
+// NavigateToSPKIInTBS) rather than by a fixed layout:
+//
+//	SEQUENCE {
+//	  SEQUENCE { OID id-ecPublicKey, OID prime256v1 }  -- AlgorithmIdentifier
+//	  BIT STRING { 00 04 X Y }                         -- subjectPublicKey
+//	}
+//
+// The lengths of the SEQUENCEs and the BIT STRING are read in short or long
+// form, the AlgorithmIdentifier must be id-ecPublicKey with the namedCurve
+// prime256v1 as its only parameter, the BIT STRING follows it and ends the
+// SubjectPublicKeyInfo. A key of another curve, a compressed point or a
+// position inside another element are rejected. It returns the key and the
+// position of the BIT STRING (x509pos.Certificate.PublicKey).
+func ExtractSubjectPublicKeyFromSPKI(
+	api frontend.API,
+
+	certBytes []uints.U8,
+	spkiPos frontend.Variable,
+) ([]uints.U8, frontend.Variable) {
+	return ExtractECPublicKeyFromSPKI(api, certBytes, spkiPos, dertags.OIDPrime256v1)
+}
+
+// ExtractECPublicKeyFromSPKI is ExtractSubjectPublicKeyFromSPKI for the
+// uncompressed key of another 256-bit namedCurve, e.g. dertags.OIDSecp256k1
+func ExtractECPublicKeyFromSPKI(
+	api frontend.API,
+
+	certBytes []uints.U8,
+	spkiPos frontend.Variable,
+	namedCurve dertags.OID,
+) ([]uints.U8, frontend.Variable) {
+	// SubjectPublicKeyInfo SEQUENCE
+	tag := ReadByteAt(api, certBytes, spkiPos)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "spki: SubjectPublicKeyInfo SEQUENCE tag")
+	spkiLen, spkiLenBytes := ReadDERLength(api, certBytes, api.Add(spkiPos, 1))
+	algPos := api.Add(spkiPos, 1, spkiLenBytes)
+	spkiEnd := api.Add(algPos, spkiLen)
+
+	// AlgorithmIdentifier SEQUENCE: id-ecPublicKey, then the namedCurve
+	tag = ReadByteAt(api, certBytes, algPos)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "spki: AlgorithmIdentifier SEQUENCE tag")
+	algLen, algLenBytes := ReadDERLength(api, certBytes, api.Add(algPos, 1))
+	algContent := api.Add(algPos, 1, algLenBytes)
+	algorithm := common.GetSubset(api, certBytes, algContent, len(dertags.OIDECPublicKey))
+	common.AssertOID(api, algorithm, dertags.OIDECPublicKey, "spki: algorithm id-ecPublicKey")
+	curve := common.GetSubset(api, certBytes, api.Add(algContent, len(dertags.OIDECPublicKey)), len(namedCurve))
+	common.AssertOID(api, curve, namedCurve, "spki: namedCurve %s", namedCurve)
+	common.AssertEqual(api, algLen, len(dertags.OIDECPublicKey)+len(namedCurve), "spki: AlgorithmIdentifier parameters")
+
+	// subjectPublicKey BIT STRING, right after the AlgorithmIdentifier
+	pubKeyPos := api.Add(algContent, algLen)
+	tag = ReadByteAt(api, certBytes, pubKeyPos)
+	common.AssertEqual(api, tag.Val, dertags.BitString, "spki: subjectPublicKey BIT STRING tag")
+	bitStringLen, bitStringLenBytes := ReadDERLength(api, certBytes, api.Add(pubKeyPos, 1))
+	common.AssertEqual(api, bitStringLen, ecPublicKeyBitStringLen, "spki: subjectPublicKey BIT STRING length")
+	content := api.Add(pubKeyPos, 1, bitStringLenBytes)
+	common.AssertEqual(api, api.Add(content, bitStringLen), spkiEnd, "spki: subjectPublicKey ends the SubjectPublicKeyInfo")
+
+	unusedBits := ReadByteAt(api, certBytes, content)
+	common.AssertEqual(api, unusedBits.Val, 0x00, "spki: subjectPublicKey unused bits")
+
+	publicKey := make([]uints.U8, 65)
+	for i := range publicKey {
+		publicKey[i] = ReadByteAt(api, certBytes, api.Add(content, 1+i))
+	}
+	common.AssertEqual(api, publicKey[0].Val, 0x04, "spki: uncompressed point")
+
+	return publicKey, pubKeyPos
+}
@@ -0,0 +1,120 @@
+package cdl_test
+
+import (
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+type spkiCircuit struct {
+	Bytes     []uints.U8
+	SPKIPos   frontend.Variable
+	PubKeyPos frontend.Variable
+	PubKey    []uints.U8
+}
+
+func (c *spkiCircuit) Define(api frontend.API) error {
+	pubKey, pubKeyPos := cdl.ExtractSubjectPublicKeyFromSPKI(api, c.Bytes, c.SPKIPos)
+	common.AssertEqual(api, pubKeyPos, c.PubKeyPos, "public key position")
+	common.AssertBytesEqual(api, pubKey, c.PubKey, "public key")
+	return nil
+}
+
+// der concatenates DER fragments
+func der(parts ...[]byte) []byte {
+	return slices.Concat(parts...)
+}
+
+func TestExtractSubjectPublicKeyFromSPKI(t *testing.T) {
+	signerKey := mockKey(t)
+	point := elliptic.Marshal(elliptic.P256(), signerKey.PublicKey.X, signerKey.PublicKey.Y)
+	standard, err := x509.MarshalPKIXPublicKey(&signerKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecPublicKey := []byte{0x06, 0x07, 0x2A, 0x86, 0x48, 0xCE, 0x3D, 0x02, 0x01}
+	prime256v1 := []byte{0x06, 0x08, 0x2A, 0x86, 0x48, 0xCE, 0x3D, 0x03, 0x01, 0x07}
+	secp256k1 := []byte{0x06, 0x05, 0x2B, 0x81, 0x04, 0x00, 0x0A}
+	bitString := der([]byte{0x03, 0x42, 0x00}, point)
+	prefix := []byte{0xA0, 0x03, 0x02, 0x01, 0x02} // bytes before the SPKI
+
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519SPKI, err := x509.MarshalPKIXPublicKey(x25519.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		spki      []byte
+		spkiPos   int
+		pubKeyPos int
+		valid     bool
+	}{
+		{"standard layout", standard, 0, 2 + 0x15, true},
+		{"long form lengths", der([]byte{0x30, 0x81, 0x5B, 0x30, 0x81, 0x13}, ecPublicKey, prime256v1, []byte{0x03, 0x81, 0x42, 0x00}, point), 0, 3 + 3 + 0x13, true},
+		{"secp256k1 curve", der([]byte{0x30, 0x56, 0x30, 0x10}, ecPublicKey, secp256k1, bitString), 0, 2 + 0x12, false},
+		{"extra parameter", der([]byte{0x30, 0x5B, 0x30, 0x15}, ecPublicKey, prime256v1, []byte{0x05, 0x00}, bitString), 0, 2 + 0x17, false},
+		{"compressed point", der([]byte{0x30, 0x39, 0x30, 0x13}, ecPublicKey, prime256v1, []byte{0x03, 0x22, 0x00}, point[:33]), 0, 2 + 0x15, false},
+		{"X25519 key", x25519SPKI, 0, 2 + 7, false},
+		{"trailing data", der([]byte{0x30, 0x5B, 0x30, 0x13}, ecPublicKey, prime256v1, bitString, []byte{0x05, 0x00}), 0, 2 + 0x15, false},
+		{"AlgorithmIdentifier position", standard, 2, 2 + 0x15, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytes := der(prefix, tt.spki)
+			pubKey := make([]byte, 65)
+			copy(pubKey, point)
+			circuit := &spkiCircuit{
+				Bytes:     common.BytesToU8Array(bytes),
+				SPKIPos:   len(prefix) + tt.spkiPos,
+				PubKeyPos: len(prefix) + tt.pubKeyPos,
+				PubKey:    common.BytesToU8Array(pubKey),
+			}
+			err := common.CheckWitness(circuit, circuit)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			var werr *common.WitnessError
+			if !tt.valid && !errors.As(err, &werr) {
+				t.Fatalf("expected a witness error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFindSubjectPublicKeyInfoPosition(t *testing.T) {
+	signerKey, ca := mockKey(t), mockKey(t)
+	certDER, _, _, _ := mockCert(t, &signerKey.PublicKey, ca)
+	spkiPos, err := cdl.FindSubjectPublicKeyInfoPosition(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyPos, err := cdl.FindSubjectPublicKeyPosition(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := elliptic.Marshal(elliptic.P256(), signerKey.PublicKey.X, signerKey.PublicKey.Y)
+	circuit := &spkiCircuit{
+		Bytes:     common.BytesToU8Array(certDER),
+		SPKIPos:   spkiPos,
+		PubKeyPos: pubKeyPos,
+		PubKey:    common.BytesToU8Array(point),
+	}
+	if err := common.CheckWitness(circuit, circuit); err != nil {
+		t.Fatal(err)
+	}
+}
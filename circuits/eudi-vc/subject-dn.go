@@ -0,0 +1,157 @@
+package cdl
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/dertags"
+)
+
+// CircuitSubjectDN proves:
+// 1. The certificate has a subject Name (the DER encoded Subject DN)
+// 2. SHA-256 of the whole Name, tag and length included, equals the public
+// expected hash, agreed out-of-band with the verifier (SubjectDNHash)
+// 3. Without revealing the certificate nor the DN
+type CircuitSubjectDN struct {
+	// Circuit parameters set at compile time
+	MaxDNLen int `gnark:"-"` // maximal length of the DER encoded Name
+
+	// ===== PRIVATE INPUTS =====
+	CertBytes []uints.U8 `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS =====
+	// SHA-256 of the DER encoded subject Name
+	ExpectedSubjectDNHash []uints.U8 `gnark:",public"`
+}
+
+// NewCircuitSubjectDN creates a subject DN circuit with the specified sizes
+func NewCircuitSubjectDN(maxCertSize, maxDNLen int) *CircuitSubjectDN {
+	return &CircuitSubjectDN{
+		MaxDNLen:              maxDNLen,
+		CertBytes:             make([]uints.U8, maxCertSize),
+		ExpectedSubjectDNHash: make([]uints.U8, 32),
+	}
+}
+
+// Define implements the gnark Circuit interface
+func (c *CircuitSubjectDN) Define(api frontend.API) error {
+	dn := ExtractSubjectDN(api, c.CertBytes, c.MaxDNLen)
+	return AssertSubjectDNHash(api, dn, c.ExpectedSubjectDNHash)
+}
+
+// ExtractSubjectDN navigates to the subject Name of the certificate and
+// returns its DER encoding, tag and length included, zero padded to maxDNLen
+// bytes. A Name longer than maxDNLen is rejected.
+func ExtractSubjectDN(
+	api frontend.API,
+
+	certBytes []uints.U8,
+	maxDNLen int,
+) common.LengthedBytes {
+	index := frontend.Variable(0)
+
+	// Skip outer Certificate SEQUENCE
+	tag := ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: Certificate SEQUENCE tag")
+	index = api.Add(index, 1)
+	_, lengthBytes := ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+
+	return extractSubjectDN(api, certBytes, index, maxDNLen)
+}
+
+// ExtractSubjectDNInTBS is ExtractSubjectDN for the TBSCertificate bytes, as
+// the circuits verifying the certificate signature take them
+func ExtractSubjectDNInTBS(
+	api frontend.API,
+
+	tbs []uints.U8,
+	maxDNLen int,
+) common.LengthedBytes {
+	return extractSubjectDN(api, tbs, 0, maxDNLen)
+}
+
+// extractSubjectDN extracts the subject Name of the TBSCertificate at index
+func extractSubjectDN(
+	api frontend.API,
+
+	certBytes []uints.U8,
+	index frontend.Variable,
+	maxDNLen int,
+) common.LengthedBytes {
+	// Enter TBSCertificate SEQUENCE
+	tag := ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: TBSCertificate SEQUENCE tag")
+	index = api.Add(index, 1)
+	_, lengthBytes := ReadDERLength(api, certBytes, index)
+	index = api.Add(index, lengthBytes)
+
+	// Field 1: Version [0] EXPLICIT (optional)
+	tag = ReadByteAt(api, certBytes, index)
+	hasVersion := api.IsZero(api.Sub(tag.Val, dertags.Explicit0))
+	index = api.Add(index, api.Select(hasVersion, SkipElement(api, certBytes, index), 0))
+
+	// Field 2: Serial Number (INTEGER 0x02)
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Integer, "cert: serialNumber INTEGER tag")
+	index = api.Add(index, SkipElement(api, certBytes, index))
+
+	// Fields 3-5: Signature Algorithm, Issuer, Validity (SEQUENCE 0x30)
+	for _, field := range []string{"signature AlgorithmIdentifier", "issuer Name", "validity"} {
+		tag = ReadByteAt(api, certBytes, index)
+		common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: %s tag", field)
+		index = api.Add(index, SkipElement(api, certBytes, index))
+	}
+
+	// Field 6: Subject Name (SEQUENCE 0x30), the whole element
+	tag = ReadByteAt(api, certBytes, index)
+	common.AssertEqual(api, tag.Val, dertags.Sequence, "cert: subject Name tag")
+	dnLength := SkipElement(api, certBytes, index)
+	api.AssertIsLessOrEqual(dnLength, maxDNLen)
+
+	// the Name may end the bytes (a truncated TBS): read past them as zeros
+	padded := make([]uints.U8, len(certBytes), len(certBytes)+maxDNLen)
+	copy(padded, certBytes)
+	for range maxDNLen {
+		padded = append(padded, uints.NewU8(0))
+	}
+	raw := readBytesAt(api, padded, index, maxDNLen)
+
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		panic(err)
+	}
+	dn := make([]uints.U8, maxDNLen)
+	inDN := frontend.Variable(1)
+	for i := range raw {
+		inDN = api.Sub(inDN, api.IsZero(api.Sub(dnLength, i)))
+		dn[i] = bytesAPI.ValueOf(api.Mul(inDN, raw[i].Val))
+	}
+
+	return common.LengthedBytes{Data: dn, Length: dnLength}
+}
+
+// AssertSubjectDNHash asserts SHA-256 of the subject Name dn
+// (ExtractSubjectDN) is the expected hash
+func AssertSubjectDNHash(api frontend.API, dn common.LengthedBytes, expected []uints.U8) error {
+	digest, err := dn.SHA256(api)
+	if err != nil {
+		return err
+	}
+	common.AssertBytesEqual(api, digest, expected, "subject: Name digest")
+	return nil
+}
+
+// SubjectDNHash returns SHA-256 of the DER encoded subject Name of the
+// certificate, the expected hash of CircuitSubjectDN
+func SubjectDNHash(certDER []byte) ([]byte, error) {
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(cert.RawSubject)
+	return digest[:], nil
+}
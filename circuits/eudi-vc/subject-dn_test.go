@@ -0,0 +1,143 @@
+package cdl_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+var subjectDNOrg = pkix.Name{Country: []string{"SI"}, Organization: []string{"Example d.o.o."}, CommonName: "Example Signing Service"}
+
+// mockSubjectDNCert creates a certificate of subject signed by issuerKey
+func mockSubjectDNCert(t *testing.T, subject pkix.Name, subjectKey, issuerKey *ecdsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      subject,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	issuer := &x509.Certificate{Subject: pkix.Name{CommonName: "Test QTSP"}}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &subjectKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestSubjectDN(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := mockSubjectDNCert(t, subjectDNOrg, key, key)
+	expected, err := cdl.SubjectDNHash(cert.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxDNLen := 128
+	circuitTemplate := cdl.NewCircuitSubjectDN(len(cert.Raw), maxDNLen)
+	assignment := &cdl.CircuitSubjectDN{
+		MaxDNLen:              maxDNLen,
+		CertBytes:             common.BytesToU8Array(cert.Raw),
+		ExpectedSubjectDNHash: common.BytesToU8Array(expected),
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// the DN of another organization, or the issuer DN
+	other := subjectDNOrg
+	other.Organization = []string{"Other d.o.o."}
+	otherDigest := sha256.Sum256(mockSubjectDNCert(t, other, key, key).RawSubject)
+	issuerDigest := sha256.Sum256(cert.RawIssuer)
+	for name, digest := range map[string][]byte{"other organization": otherDigest[:], "issuer": issuerDigest[:]} {
+		assignment.ExpectedSubjectDNHash = common.BytesToU8Array(digest)
+		if err := common.CheckWitness(circuitTemplate, assignment); err == nil {
+			t.Fatalf("%s: expected the witness check to fail", name)
+		}
+	}
+
+	// a DN longer than the maximum
+	assignment.ExpectedSubjectDNHash = common.BytesToU8Array(expected)
+	short := cdl.NewCircuitSubjectDN(len(cert.Raw), len(cert.RawSubject)-1)
+	assignment.MaxDNLen = short.MaxDNLen
+	if err := common.CheckWitness(short, assignment); err == nil {
+		t.Fatal("expected the witness check to fail for a DN longer than the maximum")
+	}
+}
+
+func TestPoPCASubjectDN(t *testing.T) {
+	signerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	qtspKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := mockSubjectDNCert(t, subjectDNOrg, signerKey, qtspKey)
+	tbsCert := cert.RawTBSCertificate
+
+	pubKeyPosition, err := cdl.FindSubjectPublicKeyPositionInTBS(tbsCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certSig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(cert.Signature, &certSig); err != nil {
+		t.Fatal(err)
+	}
+	challenge := []byte("organization challenge")
+	r, s, err := walletSignature(signerKey, false, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := cdl.SubjectDNHash(cert.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxDNLen := 128
+	circuitTemplate := &cdl.CircuitPoPCA{
+		MaxSubjectDNLen: maxDNLen,
+		CertBytes:       make([]uints.U8, len(tbsCert)),
+		Challenge:       make([]uints.U8, len(challenge)),
+		SubjectDNHash:   make([]uints.U8, 32),
+	}
+	assignment := &cdl.CircuitPoPCA{
+		MaxSubjectDNLen:     maxDNLen,
+		CertBytes:           common.BytesToU8Array(tbsCert),
+		CertLength:          len(tbsCert),
+		SubjectPubKeyPos:    frontend.Variable(pubKeyPosition),
+		SignerPubKeyX:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY:       emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+		ChallengeSignatureR: r,
+		ChallengeSignatureS: s,
+		CertSigR:            emulated.ValueOf[curves.Secp256r1Fr](certSig.R),
+		CertSigS:            emulated.ValueOf[curves.Secp256r1Fr](certSig.S),
+		Challenge:           common.BytesToU8Array(challenge),
+		CAPubKeyX:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+		CAPubKeyY:           emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
+		SubjectDNHash:       common.BytesToU8Array(expected),
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	wrong := sha256.Sum256([]byte("another organization"))
+	assignment.SubjectDNHash = common.BytesToU8Array(wrong[:])
+	if err := common.CheckWitness(circuitTemplate, assignment); err == nil {
+		t.Fatal("expected the witness check to fail for another subject")
+	}
+}
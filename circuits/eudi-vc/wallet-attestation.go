@@ -0,0 +1,90 @@
+package cdl
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// CircuitWalletAttestation proves:
+// 1. I have a wallet attestation (JWT) signed by a wallet provider
+// 2. The wallet provider key is certified by the trust anchor (public input)
+// 3. The attestation binds a key (cnf.jwk of the payload, see
+// common.CnfJWKPrefix), the key of the certified WSCD
+// 4. I can sign the challenge with that key
+// 5. Without revealing the attestation, the wallet provider or the key
+type CircuitWalletAttestation struct {
+	// ===== PRIVATE INPUTS (prover's secrets) =====
+
+	// Wallet attestation JWT
+	AttestationProtected []uints.U8                           `gnark:",secret"`
+	AttestationPayload   []uints.U8                           `gnark:",secret"`
+	AttestationR         emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	AttestationS         emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// Wallet provider certificate
+	ProviderCertBytes   []uints.U8                           `gnark:",secret"` // TBSCertificate of the provider certificate
+	ProviderCertSigR    emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ProviderCertSigS    emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ProviderCertPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	ProviderCertPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+
+	// Attested key, cnf.jwk of the attestation payload
+	CnfB64         []uints.U8                           `gnark:",secret"` // base64url segment of the payload holding cnf.jwk
+	CnfB64Position frontend.Variable                    `gnark:",secret"` // CnfB64 start position in the payload
+	CnfPosition    frontend.Variable                    `gnark:",secret"` // cnf position within the decoded CnfB64
+	WalletPubKeyX  emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	WalletPubKeyY  emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+
+	// Signature on the challenge (secret) - by the attested key
+	ChallengeSignatureR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	ChallengeSignatureS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS (known to verifier) =====
+	Challenge []uints.U8 `gnark:",public"` // Verifier's challenge
+	// Trust anchor's public key -- validates the wallet provider certificate
+	TrustAnchorX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	TrustAnchorY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+}
+
+// NewCircuitWalletAttestation creates a wallet attestation circuit for the
+// sizes of the provider TBSCertificate and of the base64url JWT parts
+func NewCircuitWalletAttestation(providerTBSSize, protectedSize, payloadSize, challengeSize int) *CircuitWalletAttestation {
+	return &CircuitWalletAttestation{
+		AttestationProtected: make([]uints.U8, protectedSize),
+		AttestationPayload:   make([]uints.U8, payloadSize),
+		ProviderCertBytes:    make([]uints.U8, providerTBSSize),
+		CnfB64:               make([]uints.U8, common.CnfJWKSegmentLen),
+		Challenge:            make([]uints.U8, challengeSize),
+	}
+}
+
+// Define implements the circuit logic
+func (c *CircuitWalletAttestation) Define(api frontend.API) error {
+
+	// ===== STEP 1: Verify the wallet provider certificate =====
+	providerKey := curves.NewPublicKey(c.ProviderCertPubKeyX, c.ProviderCertPubKeyY)
+	trustAnchor := curves.NewPublicKey(c.TrustAnchorX, c.TrustAnchorY)
+	providerCertSignature := curves.NewSignature(c.ProviderCertSigR, c.ProviderCertSigS)
+	if err := VerifyCertifiedKey(api, c.ProviderCertBytes, providerKey, trustAnchor, providerCertSignature); err != nil {
+		return err
+	}
+
+	// ===== STEP 2: Verify the attestation (JWT) signature =====
+	attestationSignature := curves.NewSignature(c.AttestationR, c.AttestationS)
+	if err := common.VerifyJWS(api, c.AttestationProtected, c.AttestationPayload, providerKey, attestationSignature); err != nil {
+		return err
+	}
+
+	// ===== STEP 3: Verify that the attested key == wallet key =====
+	if err := common.VerifyCnfJWK(api, c.AttestationPayload, c.CnfB64, c.CnfB64Position, c.CnfPosition, c.WalletPubKeyX, c.WalletPubKeyY); err != nil {
+		return err
+	}
+
+	// ===== STEP 4: Verify signature on challenge =====
+	walletKey := curves.NewPublicKey(c.WalletPubKeyX, c.WalletPubKeyY)
+	signature := curves.NewSignature(c.ChallengeSignatureR, c.ChallengeSignatureS)
+	return common.VerifyES256(api, c.Challenge, walletKey, signature)
+}
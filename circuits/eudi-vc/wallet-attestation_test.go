@@ -0,0 +1,148 @@
+package cdl_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/std/math/emulated"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+func TestWalletAttestation(t *testing.T) {
+	anchorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	walletKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// == wallet provider certificate, signed by the trust anchor ==
+	anchorTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Wallet Trust Anchor"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	providerTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Wallet Provider"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	providerDER, err := x509.CreateCertificate(rand.Reader, providerTemplate, anchorTemplate, &providerKey.PublicKey, anchorKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerCert, err := x509.ParseCertificate(providerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var providerCertSig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(providerCert.Signature, &providerCertSig); err != nil {
+		t.Fatal(err)
+	}
+
+	// == wallet attestation, binding the wallet key ==
+	b64 := base64.RawURLEncoding.EncodeToString
+	protectedJSON, _ := json.Marshal(map[string]string{"alg": "ES256", "typ": "oauth-client-attestation+jwt"})
+	payloadJSON, _ := json.Marshal(map[string]any{
+		"iss": "https://wallet-provider.example",
+		"sub": "wallet-app",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"cnf": map[string]any{"jwk": map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   b64(common.PadTo32Bytes(walletKey.PublicKey.X.Bytes())),
+			"y":   b64(common.PadTo32Bytes(walletKey.PublicKey.Y.Bytes())),
+		}},
+		"wallet_name": "Demo Wallet",
+	})
+	protectedB64, payloadB64 := b64(protectedJSON), b64(payloadJSON)
+	digest := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	attR, attS, err := ecdsa.Sign(rand.Reader, providerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf, err := common.FindCnfJWK(payloadJSON, payloadB64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// == challenge signed by the attested key ==
+	challenge, err := common.GenerateRandomBytes(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(key *ecdsa.PrivateKey) (*big.Int, *big.Int) {
+		challengeDigest := sha256.Sum256(challenge)
+		r, s, err := ecdsa.Sign(rand.Reader, key, challengeDigest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r, s
+	}
+	r, s := sign(walletKey)
+
+	circuit := cdl.NewCircuitWalletAttestation(len(providerCert.RawTBSCertificate), len(protectedB64), len(payloadB64), len(challenge))
+	assignment := &cdl.CircuitWalletAttestation{
+		AttestationProtected: common.StringToU8Array(protectedB64),
+		AttestationPayload:   common.StringToU8Array(payloadB64),
+		AttestationR:         emulated.ValueOf[curves.Secp256r1Fr](attR),
+		AttestationS:         emulated.ValueOf[curves.Secp256r1Fr](attS),
+		ProviderCertBytes:    common.BytesToU8Array(providerCert.RawTBSCertificate),
+		ProviderCertSigR:     emulated.ValueOf[curves.Secp256r1Fr](providerCertSig.R),
+		ProviderCertSigS:     emulated.ValueOf[curves.Secp256r1Fr](providerCertSig.S),
+		ProviderCertPubKeyX:  emulated.ValueOf[curves.Secp256r1Fp](providerKey.PublicKey.X),
+		ProviderCertPubKeyY:  emulated.ValueOf[curves.Secp256r1Fp](providerKey.PublicKey.Y),
+		CnfB64:               common.StringToU8Array(cnf.B64),
+		CnfB64Position:       cnf.B64Start,
+		CnfPosition:          cnf.CnfPosition,
+		WalletPubKeyX:        emulated.ValueOf[curves.Secp256r1Fp](walletKey.PublicKey.X),
+		WalletPubKeyY:        emulated.ValueOf[curves.Secp256r1Fp](walletKey.PublicKey.Y),
+		ChallengeSignatureR:  emulated.ValueOf[curves.Secp256r1Fr](r),
+		ChallengeSignatureS:  emulated.ValueOf[curves.Secp256r1Fr](s),
+		Challenge:            common.BytesToU8Array(challenge),
+		TrustAnchorX:         emulated.ValueOf[curves.Secp256r1Fp](anchorKey.PublicKey.X),
+		TrustAnchorY:         emulated.ValueOf[curves.Secp256r1Fp](anchorKey.PublicKey.Y),
+	}
+	if err := common.CheckWitness(circuit, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// a key that is not attested
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s = sign(otherKey)
+	assignment.WalletPubKeyX = emulated.ValueOf[curves.Secp256r1Fp](otherKey.PublicKey.X)
+	assignment.WalletPubKeyY = emulated.ValueOf[curves.Secp256r1Fp](otherKey.PublicKey.Y)
+	assignment.ChallengeSignatureR = emulated.ValueOf[curves.Secp256r1Fr](r)
+	assignment.ChallengeSignatureS = emulated.ValueOf[curves.Secp256r1Fr](s)
+	if err := common.CheckWitness(circuit, assignment); err == nil {
+		t.Fatal("expected a key that is not attested to fail")
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/consensys/gnark/std/math/uints"
 	csv "github.com/mynextid/eudi-zk/circuits/verify-eidas-signature"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 const (
@@ -34,10 +35,6 @@ const (
 	vkPath  = "compiled/verifying.key"
 )
 
-// Define Secp256r1 field parameters
-type Secp256r1Fp = emulated.P256Fp
-type Secp256r1Fr = emulated.P256Fr
-
 func TestCompareHex(t *testing.T) {
 	// == create dummy data ==
 	// 1. Generate ES256 (P-256) key pair
@@ -356,18 +353,18 @@ func TestJWSCircuit(t *testing.T) {
 	assignment := &csv.CircuitJWS{
 		// Private inputs
 		JWSProtected:  common.StringToU8Array(headerB64),
-		JWSSigR:       emulated.ValueOf[Secp256r1Fr](r),
-		JWSSigS:       emulated.ValueOf[Secp256r1Fr](s),
-		SignerPubKeyX: emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.X),
-		SignerPubKeyY: emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.Y),
+		JWSSigR:       emulated.ValueOf[curves.Secp256r1Fr](r),
+		JWSSigS:       emulated.ValueOf[curves.Secp256r1Fr](s),
+		SignerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
 		CertTBSDER:    common.BytesToU8Array(tbsCert),
-		CertSigR:      emulated.ValueOf[Secp256r1Fr](certSig.R),
-		CertSigS:      emulated.ValueOf[Secp256r1Fr](certSig.S),
+		CertSigR:      emulated.ValueOf[curves.Secp256r1Fr](certSig.R),
+		CertSigS:      emulated.ValueOf[curves.Secp256r1Fr](certSig.S),
 
 		// Public input
 		JWSPayload:  common.StringToU8Array(payloadB64),
-		QTSPPubKeyX: emulated.ValueOf[Secp256r1Fp](qtspKey.PublicKey.X),
-		QTSPPubKeyY: emulated.ValueOf[Secp256r1Fp](qtspKey.PublicKey.Y),
+		QTSPPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+		QTSPPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
 	}
 
 	circuitTime := time.Since(startCircuit)
@@ -0,0 +1,37 @@
+package ckb
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// PubKeyHashSecp256k1Circuit binds a secp256k1 wallet key to a credential:
+// the key's digest is the public key digest of the credential and the key
+// signed the verifier's challenge (ES256K)
+type PubKeyHashSecp256k1Circuit struct {
+	// Secret inputs - the public key coordinates and the challenge signature
+	SignerPubKeyX       emulated.Element[curves.Secp256k1Fp] `gnark:",secret"`
+	SignerPubKeyY       emulated.Element[curves.Secp256k1Fp] `gnark:",secret"`
+	ChallengeSignatureR emulated.Element[curves.Secp256k1Fr] `gnark:",secret"`
+	ChallengeSignatureS emulated.Element[curves.Secp256k1Fr] `gnark:",secret"`
+
+	// Public inputs - the expected hash of the public key as ASCII hex
+	// characters and the verifier's challenge
+	PubKeyHex []uints.U8 `gnark:",public"`
+	Challenge []uints.U8 `gnark:",public"`
+}
+
+func (c *PubKeyHashSecp256k1Circuit) Define(api frontend.API) error {
+	digest, err := common.PublicKeyDigestSecp256k1(api, c.SignerPubKeyX, c.SignerPubKeyY)
+	if err != nil {
+		return err
+	}
+	assertDigestHex(api, digest, c.PubKeyHex)
+
+	publicKey := curves.NewSecp256k1PublicKey(c.SignerPubKeyX, c.SignerPubKeyY)
+	signature := curves.NewSecp256k1Signature(c.ChallengeSignatureR, c.ChallengeSignatureS)
+	return common.VerifyES256K(api, c.Challenge, publicKey, signature)
+}
@@ -0,0 +1,61 @@
+package ckb_test
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	secp256k1ecdsa "github.com/consensys/gnark-crypto/ecc/secp256k1/ecdsa"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	ckb "github.com/mynextid/eudi-zk/circuits/key-binding"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+func TestPubKeyHashSecp256k1Circuit(t *testing.T) {
+	signerKey, err := secp256k1ecdsa.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := signerKey.PublicKey.A.X.BigInt(new(big.Int)), signerKey.PublicKey.A.Y.BigInt(new(big.Int))
+	pkDigest := sha256.Sum256(common.MarshalSecp256k1PublicKey(x, y))
+
+	challenge, err := common.GenerateRandomBytes(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := signerKey.Sign(challenge, sha256.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherDigest := sha256.Sum256([]byte("other key"))
+	for _, tt := range []struct {
+		name  string
+		kid   string
+		valid bool
+	}{
+		{"key digest", hex.EncodeToString(pkDigest[:]), true},
+		{"other digest", hex.EncodeToString(otherDigest[:]), false},
+	} {
+		circuit := &ckb.PubKeyHashSecp256k1Circuit{
+			PubKeyHex: make([]uints.U8, 64),
+			Challenge: make([]uints.U8, len(challenge)),
+		}
+		assignment := &ckb.PubKeyHashSecp256k1Circuit{
+			SignerPubKeyX:       emulated.ValueOf[curves.Secp256k1Fp](x),
+			SignerPubKeyY:       emulated.ValueOf[curves.Secp256k1Fp](y),
+			ChallengeSignatureR: emulated.ValueOf[curves.Secp256k1Fr](new(big.Int).SetBytes(signature[:32])),
+			ChallengeSignatureS: emulated.ValueOf[curves.Secp256k1Fr](new(big.Int).SetBytes(signature[32:])),
+			PubKeyHex:           common.StringToU8Array(tt.kid),
+			Challenge:           common.BytesToU8Array(challenge),
+		}
+		err := common.CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
@@ -2,16 +2,16 @@ package ckb
 
 import (
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/std/hash/sha2"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 type PubKeyHashCircuit struct {
 	// Secret inputs - the actual public key coordinates
-	SignerPubKeyX emulated.Element[Secp256r1Fp] `gnark:",secret"`
-	SignerPubKeyY emulated.Element[Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
 
 	// Public input - the expected hash of the public key as ASCII hex characters
 	PubKeyHex []uints.U8 `gnark:",public"`
@@ -36,40 +36,41 @@ func (c *PubKeyHashCircuit) Define(api frontend.API) error {
 	copy(pubKeyBytes[33:65], yBytes)
 
 	// Compute SHA256 hash of the public key bytes
-	sha256API, err := sha2.New(api)
+	sha256API, release, err := common.NewSHA256(api)
 	if err != nil {
 		return err
 	}
+	defer release()
 
 	sha256API.Write(pubKeyBytes)
 
 	// Hash the 65-byte public key
 	digest := sha256API.Sum()
 
-	// Convert digest to hex representation
-	hexDigest := make([]uints.U8, 64)
+	assertDigestHex(api, digest, c.PubKeyHex)
+	return nil
+}
 
+// assertDigestHex asserts that hexDigest is the lowercase hex encoding of the
+// 32 bytes digest
+func assertDigestHex(api frontend.API, digest, hexDigest []uints.U8) {
 	for i := range 32 {
 		// Get the byte value
 		digestByte := digest[i]
 
-		// Split into high and low nibbles using division
-		highNibble := api.Div(digestByte.Val, 16)
-		lowNibble := api.Sub(digestByte.Val, api.Mul(highNibble, 16))
+		// Split into high and low nibbles: api.Div is a field division, the
+		// nibbles are read from the bits
+		bits := api.ToBinary(digestByte.Val, 8)
+		highNibble := api.FromBinary(bits[4:]...)
+		lowNibble := api.FromBinary(bits[:4]...)
 
 		// check each nibble value
 		highChar := nibbleToHex(api, highNibble)
 		lowChar := nibbleToHex(api, lowNibble)
 
-		hexDigest[i*2] = uints.U8{Val: highChar}
-		hexDigest[i*2+1] = uints.U8{Val: lowChar}
-	}
-
-	for i := range 64 {
-		api.AssertIsEqual(hexDigest[i].Val, c.PubKeyHex[i].Val)
+		common.AssertEqual(api, highChar, hexDigest[i*2].Val, "public key digest hex char %d", i*2)
+		common.AssertEqual(api, lowChar, hexDigest[i*2+1].Val, "public key digest hex char %d", i*2+1)
 	}
-
-	return nil
 }
 
 // nibbleToHex converts a nibble (0-15) to its ASCII hex character
@@ -85,8 +85,8 @@ func TestPubKeyHashCircuit_Define(t *testing.T) {
 	// Create witness assignment with actual values
 	assignment := &ckb.PubKeyHashCircuit{
 		// Private inputs
-		SignerPubKeyX: emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.X),
-		SignerPubKeyY: emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.Y),
+		SignerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
 
 		// Public inputs
 		PubKeyHex: common.StringToU8Array(pkDigestHex),
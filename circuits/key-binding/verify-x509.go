@@ -3,18 +3,18 @@ package ckb
 import (
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/algebra/emulated/sw_emulated"
-	"github.com/consensys/gnark/std/hash/sha2"
 	"github.com/consensys/gnark/std/math/emulated"
-	"github.com/consensys/gnark/std/signature/ecdsa"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 func (c *JWSCircuit) VerifyX509(api frontend.API) error {
 	// Initialize SHA256 hasher
-	hasher, err := sha2.New(api)
+	hasher, release, err := common.NewSHA256(api)
 	if err != nil {
 		return err
 	}
+	defer release()
 
 	// Write payload to hasher
 	hasher.Write(c.SignerCertDER)
@@ -28,15 +28,9 @@ func (c *JWSCircuit) VerifyX509(api frontend.API) error {
 	}
 	_ = mHash
 
-	Pub := ecdsa.PublicKey[emulated.P256Fp, emulated.P256Fr]{
-		X: c.QTSPPubKeyX,
-		Y: c.QTSPPubKeyY,
-	}
+	Pub := curves.NewPublicKey(c.QTSPPubKeyX, c.QTSPPubKeyY)
 	_ = Pub
-	Sig := ecdsa.Signature[emulated.P256Fr]{
-		R: c.CertSigR,
-		S: c.CertSigS,
-	}
+	Sig := curves.NewSignature(c.CertSigR, c.CertSigS)
 
 	// // signature verification assertion is done in-circuit
 	Pub.Verify(api, sw_emulated.GetCurveParams[emulated.P256Fp](), mHash, &Sig)
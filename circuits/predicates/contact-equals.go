@@ -0,0 +1,144 @@
+package cpred
+
+import (
+	"strings"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/lookup/logderivlookup"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// Longest email address (RFC 5321 path) and phone number of the contact
+// predicates, in bytes
+const (
+	MaxEmailLen = 254
+	MaxPhoneLen = 32
+)
+
+func init() {
+	Register("email-equals", func() Predicate { return NewEmailEquals("email") })
+	Register("phone-equals", func() Predicate { return NewPhoneEquals("phone_number") })
+}
+
+// NewEmailEquals returns the HashedEquals predicate of an email claim (the
+// PID email): the email is compared case-insensitively, the verifier hashes
+// its address on file with EmailDigest
+func NewEmailEquals(claim string) *HashedEquals {
+	p := NewHashedEquals(claim, MaxEmailLen)
+	p.Normalize = NormalizeLowercase
+	return p
+}
+
+// NewPhoneEquals returns the HashedEquals predicate of a phone number claim
+// (the PID phone_number): the numbers are compared on their digits and '+',
+// whatever the separators of the issuer ("+49-89-12345678" matches
+// "+49 89 1234 5678"), the verifier hashes its number on file with
+// PhoneDigest
+func NewPhoneEquals(claim string) *HashedEquals {
+	p := NewHashedEquals(claim, MaxPhoneLen)
+	p.Normalize = NormalizePhone
+	return p
+}
+
+// EmailDigest returns the public parameter of the email-equals predicate for
+// the email known to the verifier
+func EmailDigest(email string, salt []byte) []byte {
+	return HashValue(NormalizeLowercase.Apply(email), salt)
+}
+
+// PhoneDigest returns the public parameter of the phone-equals predicate for
+// the phone number known to the verifier
+func PhoneDigest(phone string, salt []byte) []byte {
+	return HashValue(NormalizePhone.Apply(phone), salt)
+}
+
+// Normalization is the normalization of the value of a HashedEquals claim
+type Normalization int
+
+const (
+	// NormalizeNone hashes the value as signed
+	NormalizeNone Normalization = iota
+	// NormalizeLowercase maps the ASCII uppercase letters to lowercase
+	NormalizeLowercase
+	// NormalizePhone keeps the digits and '+', dropping the separators
+	NormalizePhone
+)
+
+// Apply returns the normalized value, as the circuit normalizes it
+func (n Normalization) Apply(value string) string {
+	switch n {
+	case NormalizeLowercase:
+		return strings.Map(func(r rune) rune {
+			if r >= 'A' && r <= 'Z' {
+				return r + 'a' - 'A'
+			}
+			return r
+		}, value)
+	case NormalizePhone:
+		return strings.Map(func(r rune) rune {
+			if r == '+' || r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, value)
+	}
+	return value
+}
+
+// define normalizes the zero padded value of length bytes, it returns the
+// zero padded normalized value and its length
+func (n Normalization) define(api frontend.API, value []uints.U8, length frontend.Variable) ([]uints.U8, frontend.Variable) {
+	if n == NormalizeNone || len(value) == 0 {
+		return value, length
+	}
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		panic(err)
+	}
+
+	// the padding is 0, mapped to 0 and dropped
+	table := logderivlookup.New(api)
+	for b := range 256 {
+		switch n {
+		case NormalizeLowercase:
+			table.Insert([]byte(NormalizeLowercase.Apply(string(rune(b))))[0])
+		case NormalizePhone:
+			if b == '+' || b >= '0' && b <= '9' {
+				table.Insert(1)
+			} else {
+				table.Insert(0)
+			}
+		}
+	}
+	chars := make([]frontend.Variable, len(value))
+	for i := range value {
+		chars[i] = value[i].Val
+	}
+	mapped := table.Lookup(chars...)
+
+	if n == NormalizeLowercase {
+		normalized := make([]uints.U8, len(value))
+		for i := range normalized {
+			normalized[i] = bytesAPI.ValueOf(mapped[i])
+		}
+		return normalized, length
+	}
+
+	// the kept bytes are moved to the number of bytes kept before them
+	positions := make([]frontend.Variable, len(value))
+	kept := frontend.Variable(0)
+	for i := range value {
+		positions[i] = kept
+		kept = api.Add(kept, mapped[i])
+	}
+	normalized := make([]uints.U8, len(value))
+	for k := range normalized {
+		b := frontend.Variable(0)
+		for i := k; i < len(value); i++ {
+			at := api.Mul(mapped[i], api.IsZero(api.Sub(positions[i], k)))
+			b = api.Add(b, api.Mul(at, value[i].Val))
+		}
+		normalized[k] = bytesAPI.ValueOf(b)
+	}
+	return normalized, kept
+}
@@ -0,0 +1,157 @@
+package cpred
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// IssuingCountrySetSize is the set size of the issuing-country-in predicate,
+// room for the EU and EEA member states
+const IssuingCountrySetSize = 32
+
+func init() {
+	Register("issuing-country-in", func() Predicate { return NewCountryIn("issuing_country", IssuingCountrySetSize) })
+}
+
+// countryLen is the size of an ISO 3166-1 alpha-2 country code
+const countryLen = 2
+
+// CountryIn checks the country code (ISO 3166-1 alpha-2, e.g. "DE") of a
+// top-level string claim is one of a public set of up to SetSize codes, e.g.
+// the issuing_country of the PID in the countries a verifier accepts. The
+// code is compared to the set by the product of the differences, zero for a
+// member. The claim is matched as `"name":"CC"`, the payload JSON must be
+// compact.
+//
+// Public parameters: the SetSize codes (CountryCode), unused slots are 0.
+// Secret parameters: the position of the claim segment in the payload, the
+// position of the code in the decoded segment and the SegmentLen bytes of the
+// base64url segment.
+type CountryIn struct {
+	Claim      string
+	SetSize    int // largest set, in codes
+	SegmentLen int // base64url segment length, multiple of 4
+}
+
+// NewCountryIn returns the predicate for claim and sets of at most setSize
+// codes, with a segment long enough for the claim at any base64url alignment
+func NewCountryIn(claim string, setSize int) *CountryIn {
+	// "claim":"CC" and up to 2 bytes of alignment
+	jsonLen := len(claim) + 4 + countryLen + 1 + 2
+	return &CountryIn{Claim: claim, SetSize: setSize, SegmentLen: 4 * ((jsonLen + 2) / 3)}
+}
+
+// CountryCode returns the parameter of a country code, its two bytes big
+// endian. Codes are two uppercase letters, so no code is 0.
+func CountryCode(code string) (uint64, error) {
+	if len(code) != countryLen || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return 0, fmt.Errorf("country-in: invalid country code %q", code)
+	}
+	return uint64(code[0])<<8 | uint64(code[1]), nil
+}
+
+// Params implements Predicate
+func (p *CountryIn) Params() (int, int) {
+	return p.SetSize, 2 + p.SegmentLen
+}
+
+// PublicParams returns the public parameters of a set of countries, set by
+// the verifier
+func (p *CountryIn) PublicParams(countries []string) ([]frontend.Variable, error) {
+	if len(countries) == 0 || len(countries) > p.SetSize {
+		return nil, fmt.Errorf("country-in: %d countries, expected 1 to %d", len(countries), p.SetSize)
+	}
+	params := make([]frontend.Variable, p.SetSize)
+	for i := range params {
+		params[i] = 0
+	}
+	for i, country := range countries {
+		code, err := CountryCode(country)
+		if err != nil {
+			return nil, err
+		}
+		params[i] = code
+	}
+	return params, nil
+}
+
+// Define implements Predicate
+func (p *CountryIn) Define(api frontend.API, payload []uints.U8, params Params) error {
+	if p.SegmentLen%4 != 0 {
+		return fmt.Errorf("country-in: segment length %d is not a multiple of 4", p.SegmentLen)
+	}
+	if p.SetSize < 1 {
+		return fmt.Errorf("country-in: set size %d", p.SetSize)
+	}
+
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		return err
+	}
+	segmentPosition, valuePosition := params.Secret[0], params.Secret[1]
+	segment := make([]uints.U8, p.SegmentLen)
+	for i := range segment {
+		segment[i] = bytesAPI.ValueOf(params.Secret[2+i])
+	}
+
+	// The segment is in the payload and decodes to the same bytes
+	if err := common.MustSubset(api, payload, segment, segmentPosition); err != nil {
+		return err
+	}
+	if err := common.AssertB64Aligned(api, len(payload), len(segment), segmentPosition); err != nil {
+		return err
+	}
+	decoded, err := common.DecodeBase64Url(api, segment)
+	if err != nil {
+		return err
+	}
+
+	// "claim":"CC", the closing quote excludes longer values ("DEU")
+	value := common.GetStringValue(api, decoded, valuePosition, common.ClaimKey(p.Claim), countryLen)
+	code := api.Add(api.Mul(value[0].Val, 256), value[1].Val)
+	common.AssertDifferent(api, code, 0, "country-in: %s is not empty", p.Claim)
+
+	// a member zeroes the product, the unused slots (0) match no code
+	product := frontend.Variable(1)
+	for _, member := range params.Public {
+		product = api.Mul(product, api.Sub(code, member))
+	}
+	common.AssertEqual(api, product, 0, "country-in: %s in the public set", p.Claim)
+
+	return nil
+}
+
+// Assign computes the parameters of the predicate for a payload (JSON and its
+// base64url encoding) and the public set of countries. It fails when the
+// claim is not one of the countries.
+func (p *CountryIn) Assign(payloadJSON []byte, payloadB64 string, countries []string) (Params, error) {
+	public, err := p.PublicParams(countries)
+	if err != nil {
+		return Params{}, err
+	}
+
+	claim, err := common.FindClaim(payloadJSON, payloadB64, p.Claim)
+	if err != nil {
+		return Params{}, err
+	}
+	country, _, err := claim.StringValue()
+	if err != nil {
+		return Params{}, fmt.Errorf("country-in: claim %q: %w", p.Claim, err)
+	}
+	if !slices.Contains(countries, country) {
+		return Params{}, fmt.Errorf("country-in: %s %s is not in the set", p.Claim, country)
+	}
+	if claim.B64Start+p.SegmentLen > len(payloadB64) {
+		return Params{}, fmt.Errorf("country-in: segment of %d bytes at %d exceeds the payload", p.SegmentLen, claim.B64Start)
+	}
+
+	params := Params{Public: public, Secret: []frontend.Variable{claim.B64Start, claim.ValuePosition}}
+	for _, b := range []byte(payloadB64[claim.B64Start : claim.B64Start+p.SegmentLen]) {
+		params.Secret = append(params.Secret, b)
+	}
+	return params, nil
+}
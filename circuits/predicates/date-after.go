@@ -0,0 +1,72 @@
+package cpred
+
+import (
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// IssuanceDateClaim is the PID claim holding the date of issuance of the
+// credential
+const IssuanceDateClaim = "date_of_issuance"
+
+func init() {
+	Register("issued-after", func() Predicate { return NewDateAfter(IssuanceDateClaim) })
+	// iat is a NumericDate, seconds since the epoch, up to 10 digits until 2286
+	Register("iat-after", func() Predicate { return NewNumberInRange("iat", 10) })
+}
+
+// DateAfter checks the date (YYYY-MM-DD) of a top-level string claim is on or
+// after a public date, e.g. the date of issuance on or after today - 30 days
+// for a credential issued within the last 30 days. The claim is matched as
+// DateBefore.
+//
+// Public parameters: the date, 10 bytes.
+// Secret parameters: as DateBefore.
+type DateAfter struct {
+	Claim      string
+	SegmentLen int // base64url segment length, multiple of 4
+}
+
+// NewDateAfter returns the predicate for claim, with a segment long enough for
+// the claim at any base64url alignment
+func NewDateAfter(claim string) *DateAfter {
+	return &DateAfter{Claim: claim, SegmentLen: dateSegmentLen(claim)}
+}
+
+// Params implements Predicate
+func (p *DateAfter) Params() (int, int) {
+	return dateLen, 2 + p.SegmentLen
+}
+
+// Define implements Predicate
+func (p *DateAfter) Define(api frontend.API, payload []uints.U8, params Params) error {
+	date, publicDate, err := defineDate(api, "date-after", p.Claim, p.SegmentLen, payload, params)
+	if err != nil {
+		return err
+	}
+	isBefore, err := common.IsSmaller(api, date, publicDate)
+	if err != nil {
+		return err
+	}
+	common.AssertEqual(api, isBefore, 0, "date-after: %s is on or after the public date", p.Claim)
+
+	return nil
+}
+
+// Assign computes the parameters of the predicate for a payload (JSON and its
+// base64url encoding) and the public date
+func (p *DateAfter) Assign(payloadJSON []byte, payloadB64, date string) (Params, error) {
+	return assignDate("date-after", p.Claim, p.SegmentLen, payloadJSON, payloadB64, date)
+}
+
+// IssuedWithin returns the public parameters of a credential issued within the
+// last days before now: the date of the issued-after predicate (DateAfter),
+// in UTC, and the minimum iat of the iat-after predicate (NumberInRange, up
+// to 9999999999)
+func IssuedWithin(now time.Time, days int) (date string, iat int64) {
+	cutoff := now.UTC().AddDate(0, 0, -days)
+	return cutoff.Format(time.DateOnly), cutoff.Unix()
+}
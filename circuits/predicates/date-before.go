@@ -0,0 +1,132 @@
+package cpred
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+func init() {
+	Register("birthdate-before", func() Predicate { return NewDateBefore("birthdate") })
+}
+
+// dateLen is the size of a YYYY-MM-DD date
+const dateLen = 10
+
+// DateBefore checks the date (YYYY-MM-DD) of a top-level string claim is
+// before a public date, e.g. birthdate before today - 18 years. The claim is
+// matched as `"name":"YYYY-MM-DD"`, the payload JSON must be compact.
+//
+// Public parameters: the date, 10 bytes.
+// Secret parameters: the position of the claim segment in the payload, the
+// position of the date in the decoded segment and the SegmentLen bytes of the
+// base64url segment.
+type DateBefore struct {
+	Claim      string
+	SegmentLen int // base64url segment length, multiple of 4
+}
+
+// NewDateBefore returns the predicate for claim, with a segment long enough
+// for the claim at any base64url alignment
+func NewDateBefore(claim string) *DateBefore {
+	return &DateBefore{Claim: claim, SegmentLen: dateSegmentLen(claim)}
+}
+
+// dateSegmentLen returns the length of the base64url segment of a date claim
+// at any alignment
+func dateSegmentLen(claim string) int {
+	// "claim":"YYYY-MM-DD" and up to 2 bytes of alignment
+	jsonLen := len(claim) + 4 + dateLen + 1 + 2
+	return 4 * ((jsonLen + 2) / 3)
+}
+
+// Params implements Predicate
+func (p *DateBefore) Params() (int, int) {
+	return dateLen, 2 + p.SegmentLen
+}
+
+// Define implements Predicate
+func (p *DateBefore) Define(api frontend.API, payload []uints.U8, params Params) error {
+	date, publicDate, err := defineDate(api, "date-before", p.Claim, p.SegmentLen, payload, params)
+	if err != nil {
+		return err
+	}
+	isBefore, err := common.IsSmaller(api, date, publicDate)
+	if err != nil {
+		return err
+	}
+	common.Assert(api, isBefore, "date-before: %s is before the public date", p.Claim)
+
+	return nil
+}
+
+// Assign computes the parameters of the predicate for a payload (JSON and its
+// base64url encoding) and the public date
+func (p *DateBefore) Assign(payloadJSON []byte, payloadB64, date string) (Params, error) {
+	return assignDate("date-before", p.Claim, p.SegmentLen, payloadJSON, payloadB64, date)
+}
+
+// defineDate returns the YYYY-MM-DD value of a date claim, matched as
+// `"claim":"YYYY-MM-DD"` in the segment of the secret parameters, and the
+// public date of the parameters
+func defineDate(api frontend.API, name, claim string, segmentLen int, payload []uints.U8, params Params) (date, publicDate []uints.U8, err error) {
+	if segmentLen%4 != 0 {
+		return nil, nil, fmt.Errorf("%s: segment length %d is not a multiple of 4", name, segmentLen)
+	}
+
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		return nil, nil, err
+	}
+	segmentPosition, datePosition := params.Secret[0], params.Secret[1]
+	segment := make([]uints.U8, segmentLen)
+	for i := range segment {
+		segment[i] = bytesAPI.ValueOf(params.Secret[2+i])
+	}
+	publicDate = make([]uints.U8, dateLen)
+	for i := range publicDate {
+		publicDate[i] = bytesAPI.ValueOf(params.Public[i])
+	}
+
+	// The segment is in the payload and decodes to the same bytes
+	if err := common.MustSubset(api, payload, segment, segmentPosition); err != nil {
+		return nil, nil, err
+	}
+	if err := common.AssertB64Aligned(api, len(payload), len(segment), segmentPosition); err != nil {
+		return nil, nil, err
+	}
+	decoded, err := common.DecodeBase64Url(api, segment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// "claim":"YYYY-MM-DD"
+	date = common.GetStringValue(api, decoded, datePosition, common.ClaimKey(claim), dateLen)
+	return date, publicDate, nil
+}
+
+// assignDate computes the parameters of defineDate
+func assignDate(name, claimName string, segmentLen int, payloadJSON []byte, payloadB64, date string) (Params, error) {
+	if len(date) != dateLen {
+		return Params{}, fmt.Errorf("%s: invalid date %q", name, date)
+	}
+
+	claim, err := common.FindClaim(payloadJSON, payloadB64, claimName)
+	if err != nil {
+		return Params{}, err
+	}
+	if claim.B64Start+segmentLen > len(payloadB64) {
+		return Params{}, fmt.Errorf("%s: segment of %d bytes at %d exceeds the payload", name, segmentLen, claim.B64Start)
+	}
+
+	params := Params{Secret: []frontend.Variable{claim.B64Start, claim.ValuePosition}}
+	for _, b := range []byte(payloadB64[claim.B64Start : claim.B64Start+segmentLen]) {
+		params.Secret = append(params.Secret, b)
+	}
+	for _, b := range []byte(date) {
+		params.Public = append(params.Public, b)
+	}
+	return params, nil
+}
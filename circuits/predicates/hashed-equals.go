@@ -0,0 +1,175 @@
+package cpred
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// SaltLen is the size of the salt of HashedEquals
+const SaltLen = 16
+
+// HashedEquals checks the value of a top-level string claim equals a value
+// known to the verifier (e.g. an IBAN), without the value in the public
+// inputs: the verifier sets SHA-256(value || salt) (HashValue) as public
+// parameter, the holder proves the signed payload holds a value hashing to
+// it with the salt. The verifier learns yes or no; the public inputs alone do
+// not reveal the value, nor its length, as long as the salt is kept private.
+// The claim is matched as `"name":"value"`, the payload JSON must be compact.
+// The value must not contain escapes unless Unescape is set: issuers escaping
+// non-ASCII characters ("M\u00fcller") then match the UTF-8 value.
+//
+// Public parameters: the digest, 32 bytes.
+// Secret parameters: the position of the claim segment in the payload, the
+// position of the value in the decoded segment, the SegmentLen bytes of the
+// base64url segment and the SaltLen bytes of the salt.
+type HashedEquals struct {
+	Claim      string
+	MaxLen     int // longest value, in bytes
+	SegmentLen int // base64url segment length, multiple of 4
+	// Unescape decodes the JSON escapes of the value
+	// (common.GetEscapedStringValueUpTo), MaxLen then bounds the escaped value
+	Unescape bool
+	// Normalize is applied in-circuit to the value before hashing, the
+	// verifier hashes the normalized value (Normalization.Apply)
+	Normalize Normalization
+}
+
+// NewHashedEquals returns the predicate for claim values of at most maxLen
+// bytes, with a segment long enough for the claim at any base64url alignment
+func NewHashedEquals(claim string, maxLen int) *HashedEquals {
+	// "claim":"value" and up to 2 bytes of alignment
+	jsonLen := len(claim) + 4 + maxLen + 1 + 2
+	return &HashedEquals{Claim: claim, MaxLen: maxLen, SegmentLen: 4 * ((jsonLen + 2) / 3)}
+}
+
+// HashValue returns the public parameter of HashedEquals for a candidate
+// value, SHA-256(value || salt)
+func HashValue(value string, salt []byte) []byte {
+	digest := sha256.Sum256(append([]byte(value), salt...))
+	return digest[:]
+}
+
+// Params implements Predicate
+func (p *HashedEquals) Params() (int, int) {
+	return sha256.Size, 2 + p.SegmentLen + SaltLen
+}
+
+// Define implements Predicate
+func (p *HashedEquals) Define(api frontend.API, payload []uints.U8, params Params) error {
+	if p.SegmentLen%4 != 0 {
+		return fmt.Errorf("hashed-equals: segment length %d is not a multiple of 4", p.SegmentLen)
+	}
+
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		return err
+	}
+	segmentPosition, valuePosition := params.Secret[0], params.Secret[1]
+	segment := make([]uints.U8, p.SegmentLen)
+	for i := range segment {
+		segment[i] = bytesAPI.ValueOf(params.Secret[2+i])
+	}
+	salt := make([]uints.U8, SaltLen)
+	for i := range salt {
+		salt[i] = bytesAPI.ValueOf(params.Secret[2+p.SegmentLen+i])
+	}
+	digest := make([]uints.U8, sha256.Size)
+	for i := range digest {
+		digest[i] = bytesAPI.ValueOf(params.Public[i])
+	}
+
+	// The segment is in the payload and decodes to the same bytes
+	if err := common.MustSubset(api, payload, segment, segmentPosition); err != nil {
+		return err
+	}
+	if err := common.AssertB64Aligned(api, len(payload), len(segment), segmentPosition); err != nil {
+		return err
+	}
+	decoded, err := common.DecodeBase64Url(api, segment)
+	if err != nil {
+		return err
+	}
+
+	// "claim":"value"
+	getValue := common.GetStringValueUpTo
+	if p.Unescape {
+		getValue = common.GetEscapedStringValueUpTo
+	}
+	value, length := getValue(api, decoded, valuePosition, common.ClaimKey(p.Claim), p.MaxLen)
+	value, length = p.Normalize.define(api, value, length)
+
+	// value || salt, the salt starts at the variable length of the value
+	preimage := make([]frontend.Variable, p.MaxLen+SaltLen)
+	for i := range preimage {
+		preimage[i] = 0
+		if i < p.MaxLen {
+			preimage[i] = value[i].Val
+		}
+	}
+	for j := range salt {
+		for i := j; i < j+p.MaxLen+1; i++ {
+			atSalt := api.IsZero(api.Sub(i-j, length))
+			preimage[i] = api.Add(preimage[i], api.Mul(atSalt, salt[j].Val))
+		}
+	}
+	message := make([]uints.U8, len(preimage))
+	for i := range message {
+		message[i] = bytesAPI.ValueOf(preimage[i])
+	}
+
+	h, release, err := common.NewSHA256(api)
+	if err != nil {
+		return err
+	}
+	defer release()
+	h.Write(message)
+	common.AssertBytesEqual(api, h.FixedLengthSum(api.Add(length, SaltLen)), digest, "hashed-equals: %s digest", p.Claim)
+
+	return nil
+}
+
+// Assign computes the parameters of the predicate for a payload (JSON and its
+// base64url encoding), the salt and the digest of the verifier. It fails when
+// the value of the claim does not hash to the digest.
+func (p *HashedEquals) Assign(payloadJSON []byte, payloadB64 string, salt, digest []byte) (Params, error) {
+	if len(salt) != SaltLen || len(digest) != sha256.Size {
+		return Params{}, fmt.Errorf("hashed-equals: salt of %d bytes and digest of %d bytes, expected %d and %d",
+			len(salt), len(digest), SaltLen, sha256.Size)
+	}
+
+	claim, err := common.FindClaim(payloadJSON, payloadB64, p.Claim)
+	if err != nil {
+		return Params{}, err
+	}
+	value, rawLen, err := claim.StringValue()
+	if err != nil {
+		return Params{}, fmt.Errorf("hashed-equals: claim %q: %w", p.Claim, err)
+	}
+	// escapes are longer than the bytes they stand for
+	if rawLen > p.MaxLen || (!p.Unescape && rawLen != len(value)) {
+		return Params{}, fmt.Errorf("hashed-equals: claim %q is longer than %d bytes or escaped", p.Claim, p.MaxLen)
+	}
+	if !bytes.Equal(HashValue(p.Normalize.Apply(value), salt), digest) {
+		return Params{}, fmt.Errorf("hashed-equals: claim %q does not match the digest", p.Claim)
+	}
+	if claim.B64Start+p.SegmentLen > len(payloadB64) {
+		return Params{}, fmt.Errorf("hashed-equals: segment of %d bytes at %d exceeds the payload", p.SegmentLen, claim.B64Start)
+	}
+
+	params := Params{Secret: []frontend.Variable{claim.B64Start, claim.ValuePosition}}
+	for _, b := range []byte(payloadB64[claim.B64Start : claim.B64Start+p.SegmentLen]) {
+		params.Secret = append(params.Secret, b)
+	}
+	for _, b := range salt {
+		params.Secret = append(params.Secret, b)
+	}
+	for _, b := range digest {
+		params.Public = append(params.Public, b)
+	}
+	return params, nil
+}
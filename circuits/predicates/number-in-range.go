@@ -0,0 +1,111 @@
+package cpred
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// NumberInRange checks the value of a top-level integer claim (e.g. "age",
+// "sex") is within public bounds, min <= value <= max. The claim is matched
+// as `"name":value` followed by ',' or '}', the payload JSON must be compact.
+// Use 0 or 10^MaxDigits-1 as bound for one-sided comparisons.
+//
+// Public parameters: min and max.
+// Secret parameters: the position of the claim segment in the payload, the
+// position of the number in the decoded segment, its number of digits and the
+// SegmentLen bytes of the base64url segment.
+type NumberInRange struct {
+	Claim      string
+	MaxDigits  int // longest value, in digits
+	SegmentLen int // base64url segment length, multiple of 4
+}
+
+// NewNumberInRange returns the predicate for claim values of at most
+// maxDigits digits, with a segment long enough for the claim at any base64url
+// alignment
+func NewNumberInRange(claim string, maxDigits int) *NumberInRange {
+	// "claim":value, the closing , or } and up to 2 bytes of alignment
+	jsonLen := len(claim) + 3 + maxDigits + 1 + 2
+	return &NumberInRange{Claim: claim, MaxDigits: maxDigits, SegmentLen: 4 * ((jsonLen + 2) / 3)}
+}
+
+// Params implements Predicate
+func (p *NumberInRange) Params() (int, int) {
+	return 2, 3 + p.SegmentLen
+}
+
+// Define implements Predicate
+func (p *NumberInRange) Define(api frontend.API, payload []uints.U8, params Params) error {
+	if p.SegmentLen%4 != 0 {
+		return fmt.Errorf("number-in-range: segment length %d is not a multiple of 4", p.SegmentLen)
+	}
+
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		return err
+	}
+	segmentPosition, valuePosition, digits := params.Secret[0], params.Secret[1], params.Secret[2]
+	segment := make([]uints.U8, p.SegmentLen)
+	for i := range segment {
+		segment[i] = bytesAPI.ValueOf(params.Secret[3+i])
+	}
+	minValue, maxValue := params.Public[0], params.Public[1]
+
+	// The segment is in the payload and decodes to the same bytes
+	if err := common.MustSubset(api, payload, segment, segmentPosition); err != nil {
+		return err
+	}
+	if err := common.AssertB64Aligned(api, len(payload), len(segment), segmentPosition); err != nil {
+		return err
+	}
+	decoded, err := common.DecodeBase64Url(api, segment)
+	if err != nil {
+		return err
+	}
+
+	// "claim":value
+	value := common.GetNumberValue(api, decoded, valuePosition, common.ClaimNumberKey(p.Claim), digits, p.MaxDigits)
+
+	api.AssertIsLessOrEqual(minValue, value)
+	api.AssertIsLessOrEqual(value, maxValue)
+
+	return nil
+}
+
+// Assign computes the parameters of the predicate for a payload (JSON and its
+// base64url encoding) and the public bounds. It fails when the claim is not an
+// integer of at most MaxDigits digits.
+func (p *NumberInRange) Assign(payloadJSON []byte, payloadB64 string, minValue, maxValue uint64) (Params, error) {
+	claim, err := common.FindClaim(payloadJSON, payloadB64, p.Claim)
+	if err != nil {
+		return Params{}, err
+	}
+	if !bytes.HasSuffix(claim.Segment[:claim.ValuePosition], []byte(common.ClaimNumberKey(p.Claim))) {
+		return Params{}, fmt.Errorf("number-in-range: whitespace around the colon of %q is not supported", p.Claim)
+	}
+	var number json.Number
+	if err := json.Unmarshal(claim.Value, &number); err != nil {
+		return Params{}, fmt.Errorf("number-in-range: claim %q is not a number", p.Claim)
+	}
+	if _, err := strconv.ParseUint(number.String(), 10, 64); err != nil || len(number) > p.MaxDigits {
+		return Params{}, fmt.Errorf("number-in-range: claim %q is not an integer of at most %d digits", p.Claim, p.MaxDigits)
+	}
+	if claim.B64Start+p.SegmentLen > len(payloadB64) {
+		return Params{}, fmt.Errorf("number-in-range: segment of %d bytes at %d exceeds the payload", p.SegmentLen, claim.B64Start)
+	}
+
+	params := Params{
+		Public: []frontend.Variable{minValue, maxValue},
+		Secret: []frontend.Variable{claim.B64Start, claim.ValuePosition, len(number)},
+	}
+	for _, b := range []byte(payloadB64[claim.B64Start : claim.B64Start+p.SegmentLen]) {
+		params.Secret = append(params.Secret, b)
+	}
+	return params, nil
+}
@@ -0,0 +1,157 @@
+package cpred
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// Predicate is a claim predicate gadget (e.g. age over 18, postcode in region)
+// run by CircuitPredicates over the verified JWS payload. The parameters of a
+// predicate are circuit inputs: the public ones are set by the verifier (e.g.
+// the threshold date), the secret ones are the hints of the prover (e.g. the
+// claim position).
+type Predicate interface {
+	// Params returns the number of public and secret parameters
+	Params() (public, secret int)
+	// Define adds the constraints of the predicate over the base64url payload
+	Define(api frontend.API, payload []uints.U8, params Params) error
+}
+
+// Params are the parameters of a predicate
+type Params struct {
+	Public []frontend.Variable
+	Secret []frontend.Variable
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func() Predicate{}
+)
+
+// Register makes a predicate selectable by name in NewCircuitPredicates. The
+// factory returns a new instance with its compile-time configuration. Register
+// panics if the name is registered twice, as database/sql.Register.
+func Register(name string, factory func() Predicate) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("predicates: Register factory is nil")
+	}
+	if name == "" || strings.ContainsAny(name, "+/") {
+		panic(fmt.Sprintf("predicates: invalid predicate name %q", name))
+	}
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("predicates: Register called twice for predicate %q", name))
+	}
+	registry[name] = factory
+}
+
+// Lookup returns a new instance of the registered predicate
+func Lookup(name string) (Predicate, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown predicate %q", name)
+	}
+	return factory(), nil
+}
+
+// Registered returns the sorted names of the registered predicates
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// CircuitID returns the id of the circuit variant running the named
+// predicates, e.g. "predicates/date-before+postcode-in"
+func CircuitID(names ...string) string {
+	return "predicates/" + strings.Join(names, "+")
+}
+
+// CircuitPredicates proves:
+// 1. The JWS payload is signed by the issuer (public key is a public input)
+// 2. The payload satisfies every configured predicate
+// 3. Without revealing the payload or the signature
+type CircuitPredicates struct {
+	// Predicates run over the payload, set at compile time
+	Predicates []Predicate `gnark:"-"`
+
+	// ===== PRIVATE INPUTS =====
+	JWSProtected []uints.U8                           `gnark:",secret"` // base64url encoded protected header
+	JWSPayload   []uints.U8                           `gnark:",secret"` // base64url encoded payload
+	JWSR         emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	JWSS         emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	SecretParams [][]frontend.Variable                `gnark:",secret"` // secret parameters of Predicates[i]
+
+	// ===== PUBLIC INPUTS =====
+	IssuerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	IssuerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	PublicParams  [][]frontend.Variable                `gnark:",public"` // public parameters of Predicates[i]
+}
+
+// NewCircuitPredicates creates the circuit variant running the named
+// (registered) predicates, in order
+func NewCircuitPredicates(protectedSize, payloadSize int, names ...string) (*CircuitPredicates, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no predicates")
+	}
+
+	c := &CircuitPredicates{
+		JWSProtected: make([]uints.U8, protectedSize),
+		JWSPayload:   make([]uints.U8, payloadSize),
+	}
+	for _, name := range names {
+		p, err := Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		public, secret := p.Params()
+		c.Predicates = append(c.Predicates, p)
+		c.PublicParams = append(c.PublicParams, make([]frontend.Variable, public))
+		c.SecretParams = append(c.SecretParams, make([]frontend.Variable, secret))
+	}
+	return c, nil
+}
+
+// Define implements the gnark Circuit interface
+func (c *CircuitPredicates) Define(api frontend.API) error {
+	if len(c.PublicParams) != len(c.Predicates) || len(c.SecretParams) != len(c.Predicates) {
+		return fmt.Errorf("parameters of %d predicates for %d predicates", min(len(c.PublicParams), len(c.SecretParams)), len(c.Predicates))
+	}
+
+	// ===== STEP 1: Verify the VC (JWS) signature =====
+	issuerPublicKey := curves.NewPublicKey(c.IssuerPubKeyX, c.IssuerPubKeyY)
+	jws := curves.NewSignature(c.JWSR, c.JWSS)
+	if err := common.VerifyJWS(api, c.JWSProtected, c.JWSPayload, issuerPublicKey, jws); err != nil {
+		return err
+	}
+
+	// ===== STEP 2: Run the predicates over the verified payload =====
+	for i, p := range c.Predicates {
+		public, secret := p.Params()
+		if len(c.PublicParams[i]) != public || len(c.SecretParams[i]) != secret {
+			return fmt.Errorf("predicate %d: expected %d public and %d secret parameters, got %d and %d",
+				i, public, secret, len(c.PublicParams[i]), len(c.SecretParams[i]))
+		}
+		if err := p.Define(api, c.JWSPayload, Params{Public: c.PublicParams[i], Secret: c.SecretParams[i]}); err != nil {
+			return fmt.Errorf("predicate %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,496 @@
+package cpred_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	cpred "github.com/mynextid/eudi-zk/circuits/predicates"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// containsPredicate is a custom predicate: the base64url payload contains the
+// public bytes at a secret position
+type containsPredicate struct {
+	Len int
+}
+
+func (p *containsPredicate) Params() (int, int) {
+	return p.Len, 1
+}
+
+func (p *containsPredicate) Define(api frontend.API, payload []uints.U8, params cpred.Params) error {
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		return err
+	}
+	expected := make([]uints.U8, p.Len)
+	for i := range expected {
+		expected[i] = bytesAPI.ValueOf(params.Public[i])
+	}
+	return common.MustSubset(api, payload, expected, params.Secret[0])
+}
+
+func init() {
+	cpred.Register("test-contains", func() cpred.Predicate { return &containsPredicate{Len: 8} })
+}
+
+func TestPredicates(t *testing.T) {
+	// == issue the credential ==
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadJSON, err := json.Marshal(models.GetDemoPID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JOSE+JSON"}`))
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	r, s, err := ecdsa.Sign(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// == select the circuit variant ==
+	names := []string{"birthdate-before", "test-contains"}
+	if got := cpred.CircuitID(names...); got != "predicates/birthdate-before+test-contains" {
+		t.Fatalf("unexpected circuit id %q", got)
+	}
+	if !slices.Contains(cpred.Registered(), "birthdate-before") {
+		t.Fatalf("built-in predicate not registered: %v", cpred.Registered())
+	}
+	circuitTemplate, err := cpred.NewCircuitPredicates(len(protectedB64), len(payloadB64), names...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// == assign the parameters ==
+	assign := func(minDate string) *cpred.CircuitPredicates {
+		dateParams, err := cpred.NewDateBefore("birthdate").Assign(payloadJSON, payloadB64, minDate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		containsParams := cpred.Params{Secret: []frontend.Variable{12}}
+		for _, b := range []byte(payloadB64[12:20]) {
+			containsParams.Public = append(containsParams.Public, b)
+		}
+
+		return &cpred.CircuitPredicates{
+			JWSProtected:  common.StringToU8Array(protectedB64),
+			JWSPayload:    common.StringToU8Array(payloadB64),
+			JWSR:          emulated.ValueOf[curves.Secp256r1Fr](r),
+			JWSS:          emulated.ValueOf[curves.Secp256r1Fr](s),
+			IssuerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+			IssuerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+			PublicParams:  [][]frontend.Variable{dateParams.Public, containsParams.Public},
+			SecretParams:  [][]frontend.Variable{dateParams.Secret, containsParams.Secret},
+		}
+	}
+
+	// demo PID birthdate: 1985-03-15
+	if err := common.CheckWitness(circuitTemplate, assign("2007-01-01")); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assign("1985-03-15")); err == nil {
+		t.Fatal("expected the witness check to fail for a birthdate not before the public date")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if _, err := cpred.Lookup("unknown"); err == nil {
+		t.Fatal("expected an unknown predicate error")
+	}
+	if _, err := cpred.NewCircuitPredicates(10, 10, "birthdate-before", "unknown"); err == nil {
+		t.Fatal("expected an unknown predicate error")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic on duplicate registration")
+		}
+	}()
+	cpred.Register("birthdate-before", func() cpred.Predicate { return cpred.NewDateBefore("birthdate") })
+}
+
+func TestDateAfter(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadJSON, err := json.Marshal(models.GetDemoPID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JOSE+JSON"}`))
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	r, s, err := ecdsa.Sign(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circuitTemplate, err := cpred.NewCircuitPredicates(len(protectedB64), len(payloadB64), "issued-after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assign := func(cutoff string) *cpred.CircuitPredicates {
+		params, err := cpred.NewDateAfter(cpred.IssuanceDateClaim).Assign(payloadJSON, payloadB64, cutoff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &cpred.CircuitPredicates{
+			JWSProtected:  common.StringToU8Array(protectedB64),
+			JWSPayload:    common.StringToU8Array(payloadB64),
+			JWSR:          emulated.ValueOf[curves.Secp256r1Fr](r),
+			JWSS:          emulated.ValueOf[curves.Secp256r1Fr](s),
+			IssuerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+			IssuerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+			PublicParams:  [][]frontend.Variable{params.Public},
+			SecretParams:  [][]frontend.Variable{params.Secret},
+		}
+	}
+
+	// demo PID date_of_issuance: 2020-01-15, issued within 30 days on
+	// 2020-02-14 and not on 2020-02-15
+	for _, tt := range []struct {
+		now   string
+		valid bool
+	}{
+		{"2020-01-15", true},
+		{"2020-02-14", true},
+		{"2020-02-15", false},
+	} {
+		now, err := time.Parse(time.DateOnly, tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cutoff, _ := cpred.IssuedWithin(now, 30)
+		err = common.CheckWitness(circuitTemplate, assign(cutoff))
+		if tt.valid && err != nil {
+			t.Fatalf("%s: witness check failed: %v", tt.now, err)
+		}
+		if !tt.valid && err == nil {
+			t.Fatalf("%s: expected the witness check to fail for a credential issued before %s", tt.now, cutoff)
+		}
+	}
+}
+
+func TestHashedEquals(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadJSON, err := json.Marshal(models.GetDemoPID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JOSE+JSON"}`))
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	r, s, err := ecdsa.Sign(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predicate := cpred.NewHashedEquals("family_name", 24)
+	cpred.Register("test-family-name-equals", func() cpred.Predicate { return predicate })
+	circuitTemplate, err := cpred.NewCircuitPredicates(len(protectedB64), len(payloadB64), "test-family-name-equals")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt := make([]byte, cpred.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	assign := func(params cpred.Params) *cpred.CircuitPredicates {
+		return &cpred.CircuitPredicates{
+			JWSProtected:  common.StringToU8Array(protectedB64),
+			JWSPayload:    common.StringToU8Array(payloadB64),
+			JWSR:          emulated.ValueOf[curves.Secp256r1Fr](r),
+			JWSS:          emulated.ValueOf[curves.Secp256r1Fr](s),
+			IssuerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+			IssuerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+			PublicParams:  [][]frontend.Variable{params.Public},
+			SecretParams:  [][]frontend.Variable{params.Secret},
+		}
+	}
+
+	// the verifier knows the candidate value, demo PID family_name
+	params, err := predicate.Assign(payloadJSON, payloadB64, salt, cpred.HashValue("Muller", salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assign(params)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// another candidate: the holder cannot assign nor prove it
+	other := cpred.HashValue("Mulle", salt)
+	if _, err := predicate.Assign(payloadJSON, payloadB64, salt, other); err == nil {
+		t.Fatal("expected an error for a value not matching the digest")
+	}
+	for i, b := range other {
+		params.Public[i] = b
+	}
+	if err := common.CheckWitness(circuitTemplate, assign(params)); err == nil {
+		t.Fatal("expected the witness check to fail for another value")
+	}
+}
+
+// TestHashedEqualsEscaped matches a value the issuer escaped, as JSON
+// encoders escaping non-ASCII characters do
+func TestHashedEqualsEscaped(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadJSON := []byte(`{"family_name":"M\u00fcller","given_name":"Erika","nationality":"DE"}`)
+	protectedB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JOSE+JSON"}`))
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	r, s, err := ecdsa.Sign(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predicate := cpred.NewHashedEquals("family_name", 16)
+	predicate.Unescape = true
+	cpred.Register("test-family-name-equals-escaped", func() cpred.Predicate { return predicate })
+	circuitTemplate, err := cpred.NewCircuitPredicates(len(protectedB64), len(payloadB64), "test-family-name-equals-escaped")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt := make([]byte, cpred.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	params, err := predicate.Assign(payloadJSON, payloadB64, salt, cpred.HashValue("Müller", salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignment := &cpred.CircuitPredicates{
+		JWSProtected:  common.StringToU8Array(protectedB64),
+		JWSPayload:    common.StringToU8Array(payloadB64),
+		JWSR:          emulated.ValueOf[curves.Secp256r1Fr](r),
+		JWSS:          emulated.ValueOf[curves.Secp256r1Fr](s),
+		IssuerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+		IssuerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+		PublicParams:  [][]frontend.Variable{params.Public},
+		SecretParams:  [][]frontend.Variable{params.Secret},
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// the escaped form is not the value
+	if _, err := predicate.Assign(payloadJSON, payloadB64, salt, cpred.HashValue(`M\u00fcller`, salt)); err == nil {
+		t.Fatal("expected an error for the escaped form")
+	}
+	// without Unescape the escaped value is refused
+	if _, err := cpred.NewHashedEquals("family_name", 16).Assign(payloadJSON, payloadB64, salt, cpred.HashValue("Müller", salt)); err == nil {
+		t.Fatal("expected an error for an escaped value")
+	}
+}
+
+func TestNumberInRange(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadJSON, err := json.Marshal(models.GetDemoPID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JOSE+JSON"}`))
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	r, s, err := ecdsa.Sign(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predicate := cpred.NewNumberInRange("sex", 1)
+	cpred.Register("test-sex-in-range", func() cpred.Predicate { return predicate })
+	circuitTemplate, err := cpred.NewCircuitPredicates(len(protectedB64), len(payloadB64), "test-sex-in-range")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assign := func(params cpred.Params) *cpred.CircuitPredicates {
+		return &cpred.CircuitPredicates{
+			JWSProtected:  common.StringToU8Array(protectedB64),
+			JWSPayload:    common.StringToU8Array(payloadB64),
+			JWSR:          emulated.ValueOf[curves.Secp256r1Fr](r),
+			JWSS:          emulated.ValueOf[curves.Secp256r1Fr](s),
+			IssuerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+			IssuerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+			PublicParams:  [][]frontend.Variable{params.Public},
+			SecretParams:  [][]frontend.Variable{params.Secret},
+		}
+	}
+
+	// demo PID sex is the JSON number 2
+	params, err := predicate.Assign(payloadJSON, payloadB64, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assign(params)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// out of range
+	if params, err = predicate.Assign(payloadJSON, payloadB64, 3, 9); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assign(params)); err == nil {
+		t.Fatal("expected the witness check to fail for a value out of range")
+	}
+
+	// string claims are not numbers
+	if _, err := cpred.NewNumberInRange("family_name", 4).Assign(payloadJSON, payloadB64, 0, 9999); err == nil {
+		t.Fatal("expected an error for a string claim")
+	}
+}
+
+func TestContactEquals(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// demo PID email erika.muller@example.com, phone_number +49-89-12345678
+	payloadJSON, err := json.Marshal(models.GetDemoPID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JOSE+JSON"}`))
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	r, s, err := ecdsa.Sign(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circuitTemplate, err := cpred.NewCircuitPredicates(len(protectedB64), len(payloadB64), "email-equals", "phone-equals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := make([]byte, cpred.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	assign := func(email, phone cpred.Params) *cpred.CircuitPredicates {
+		return &cpred.CircuitPredicates{
+			JWSProtected:  common.StringToU8Array(protectedB64),
+			JWSPayload:    common.StringToU8Array(payloadB64),
+			JWSR:          emulated.ValueOf[curves.Secp256r1Fr](r),
+			JWSS:          emulated.ValueOf[curves.Secp256r1Fr](s),
+			IssuerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+			IssuerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+			PublicParams:  [][]frontend.Variable{email.Public, phone.Public},
+			SecretParams:  [][]frontend.Variable{email.Secret, phone.Secret},
+		}
+	}
+
+	// the verifier has the contact on file, formatted its own way
+	email, err := cpred.NewEmailEquals("email").Assign(payloadJSON, payloadB64, salt, cpred.EmailDigest("Erika.Muller@Example.com", salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone, err := cpred.NewPhoneEquals("phone_number").Assign(payloadJSON, payloadB64, salt, cpred.PhoneDigest("+49 (89) 1234 5678", salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assign(email, phone)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// another phone number
+	other := cpred.PhoneDigest("+49 89 1234 5679", salt)
+	if _, err := cpred.NewPhoneEquals("phone_number").Assign(payloadJSON, payloadB64, salt, other); err == nil {
+		t.Fatal("expected an error for another phone number")
+	}
+	for i, b := range other {
+		phone.Public[i] = b
+	}
+	if err := common.CheckWitness(circuitTemplate, assign(email, phone)); err == nil {
+		t.Fatal("expected the witness check to fail for another phone number")
+	}
+}
+
+func TestCountryIn(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// demo PID issuing_country DE
+	payloadJSON, err := json.Marshal(models.GetDemoPID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JOSE+JSON"}`))
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	r, s, err := ecdsa.Sign(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circuitTemplate, err := cpred.NewCircuitPredicates(len(protectedB64), len(payloadB64), "issuing-country-in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	predicate := cpred.NewCountryIn("issuing_country", cpred.IssuingCountrySetSize)
+	assign := func(params cpred.Params) *cpred.CircuitPredicates {
+		return &cpred.CircuitPredicates{
+			JWSProtected:  common.StringToU8Array(protectedB64),
+			JWSPayload:    common.StringToU8Array(payloadB64),
+			JWSR:          emulated.ValueOf[curves.Secp256r1Fr](r),
+			JWSS:          emulated.ValueOf[curves.Secp256r1Fr](s),
+			IssuerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.X),
+			IssuerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](issuerKey.PublicKey.Y),
+			PublicParams:  [][]frontend.Variable{params.Public},
+			SecretParams:  [][]frontend.Variable{params.Secret},
+		}
+	}
+
+	params, err := predicate.Assign(payloadJSON, payloadB64, []string{"AT", "DE", "SI"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assign(params)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	// the verifier sets another set
+	if params.Public, err = predicate.PublicParams([]string{"AT", "SI"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assign(params)); err == nil {
+		t.Fatal("expected the witness check to fail for a country out of the set")
+	}
+
+	if _, err := predicate.Assign(payloadJSON, payloadB64, []string{"AT"}); err == nil {
+		t.Fatal("expected an error for a country out of the set")
+	}
+	if _, err := predicate.PublicParams([]string{"de"}); err == nil {
+		t.Fatal("expected an error for an invalid country code")
+	}
+	if _, err := predicate.PublicParams(nil); err == nil {
+		t.Fatal("expected an error for an empty set")
+	}
+}
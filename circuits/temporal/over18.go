@@ -6,10 +6,13 @@ import (
 	"github.com/mynextid/eudi-zk/common"
 )
 
+// BirthdateClaim is the payload claim holding the date of birth
+const BirthdateClaim = "birthdate"
+
 // Circuit functions
-// - check that the VC is of the correct type -> IsSubset
-// - check that the date of birth is part of the VC payload -> IsSubset
-// - extract the date of birth -> Decode
+// - check that the VC is of the correct type -> MustSubset
+// - check that the date of birth is part of the VC payload -> MustSubset
+// - extract the date of birth -> Decode, the value of the birthdate claim
 // - compare the date of birth with the current date
 type Over18 struct {
 	// Secret input
@@ -30,13 +33,19 @@ type Over18 struct {
 func (c *Over18) Define(api frontend.API) error {
 
 	// Verify that the date is member of the payload
-	err := common.IsSubset(api, c.Payload, c.DateB64, c.DateB64Position)
+	err := common.MustSubset(api, c.Payload, c.DateB64, c.DateB64Position)
+	if err != nil {
+		return err
+	}
+
+	// The date segment must decode to the same bytes as the payload
+	err = common.AssertB64Aligned(api, len(c.Payload), len(c.DateB64), c.DateB64Position)
 	if err != nil {
 		return err
 	}
 
 	// Verify that the typ is member of the payload
-	// err = common.IsSubset(api, c.Payload, c.TypB64, c.TypB64Position)
+	// err = common.MustSubset(api, c.Payload, c.TypB64, c.TypB64Position)
 	// if err != nil {
 	// 	return err
 	// }
@@ -47,11 +56,12 @@ func (c *Over18) Define(api frontend.API) error {
 		return err
 	}
 
+	// Extract the date, bound to the birthdate claim
 	size := 10 // size of the date/time element in bytes (YYYY-MM-DD: 10 characters == 10 bytes)
-	dateOfBirth := common.GetSubset(api, dateJSON, c.DatePosition, size)
+	dateOfBirth := common.GetStringValue(api, dateJSON, c.DatePosition, common.ClaimKey(BirthdateClaim), size)
 
 	r, _ := common.IsSmaller(api, dateOfBirth, c.MinDateOfBirth)
-	api.AssertIsEqual(r, frontend.Variable(1))
+	common.Assert(api, r, "date of birth is before MinDateOfBirth")
 
 	return nil
 }
@@ -3,6 +3,7 @@ package ct_test
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -62,137 +63,101 @@ func TestOver18(t *testing.T) {
 	common.TestCircuit(assignment, ccs, pk, vk)
 }
 
-type Over18Payload struct {
-	Payload         []byte
-	DateB64         []byte
-	DateB64Position int
-	DatePosition    int
-	MinDateOfBirth  string
-}
-
-func MockOver18Data(minDateOfBirth string) (*Over18Payload, error) {
-	// Generate ES256 (P-256) key pair
-	// signerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	// if err != nil {
-	// 	panic(fmt.Sprintf("Failed to generate key: %v", err))
-	// }
-
-	// Properly encode the public key in uncompressed format
-	// This ensures X and Y are always 32 bytes each
-	// pubKeyBytes := elliptic.Marshal(elliptic.P256(), signerKey.PublicKey.X, signerKey.PublicKey.Y)
-
-	// pubKeyBytesDigest := sha256.Sum256(pubKeyBytes)
-	// pubKeyBytesDigestHex := hex.EncodeToString(pubKeyBytesDigest[:])
-
-	// Create JWS protected
-	// protected := map[string]any{
-	// 	"alg": "ES256",
-	// 	"typ": "JOSE+JSON",
-	// 	"cnf": map[string]string{
-	// 		"kid": pubKeyBytesDigestHex,
-	// 	},
-	// }
-	// protectedBytes, err := json.Marshal(protected)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// protectedB64 := base64.RawURLEncoding.EncodeToString(protectedBytes)
-
-	payload := models.GetDemoPID()
-	payloadBytes, err := json.Marshal(payload)
+// TestOver18CheckWitness runs the circuit in debug mode with a birthdate that
+// is after the minimum date and expects the failing assertion to be named
+func TestOver18CheckWitness(t *testing.T) {
+	minDateOfBirth := "1980-01-01"
+	data, err := MockOver18Data(minDateOfBirth)
 	if err != nil {
-		return nil, err
+		t.Fatalf("failed to generate data: %v", err)
 	}
-	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadBytes)
-	fmt.Println("payloadB64", payloadB64)
-
-	// signature := fmt.Sprintf("%s.%s", protectedB64, payloadB64)
-
-	// digest := sha256.Sum256([]byte(signature))
-
-	// Sign the digest of the challenge
-	// r, s, err := ecdsa.Sign(rand.Reader, signerKey, digest[:])
-	// if err != nil {
-	// 	return nil, fmt.Errorf("failed to sign the credential %v", err)
-	// }
 
-	// == find the position of the elements ==
-	payloadMap, err := StructToMap(payload)
-	dateIndexStart, dateIndexEnd, err := GetClaimRange(payloadMap, payloadBytes, "birthdate")
-	birthdateB64 := GetClaimB64(payloadBytes, dateIndexStart, dateIndexEnd, "birthdate")
-
-	fmt.Println("birthdateB64", birthdateB64)
-	bd, _ := base64.URLEncoding.DecodeString(birthdateB64)
-	fmt.Println("birthdate decoded", string(bd))
+	assignment := &ct.Over18{
+		Payload:         common.BytesToU8Array(data.Payload),
+		DateB64:         common.BytesToU8Array(data.DateB64),
+		DateB64Position: data.DateB64Position,
+		DatePosition:    data.DatePosition,
+		MinDateOfBirth:  common.StringToU8Array(data.MinDateOfBirth),
+	}
 
-	b64Index := strings.Index(payloadB64, birthdateB64)
-	if b64Index == -1 {
-		return nil, fmt.Errorf("failed to get b64Index index")
+	err = common.CheckWitness(assignment, assignment)
+	var werr *common.WitnessError
+	if !errors.As(err, &werr) {
+		t.Fatalf("expected a witness error, got %v", err)
+	}
+	if werr.Label != "date of birth is before MinDateOfBirth" {
+		t.Fatalf("unexpected assertion label %q (%v)", werr.Label, werr)
 	}
 
-	birthdate, err := base64.RawURLEncoding.DecodeString(birthdateB64)
+	// a valid assignment passes the check
+	data, err = MockOver18Data("2004-01-01")
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode birthdate")
+		t.Fatalf("failed to generate data: %v", err)
 	}
-
-	dateIndex := strings.Index(string(birthdate), payloadMap["birthdate"].(string))
-	if dateIndex == -1 {
-		return nil, fmt.Errorf("failed to get date index")
+	assignment.MinDateOfBirth = common.StringToU8Array(data.MinDateOfBirth)
+	if err := common.CheckWitness(assignment, assignment); err != nil {
+		t.Fatalf("expected the witness to satisfy the circuit: %v", err)
 	}
-
-	return &Over18Payload{
-		Payload:         []byte(payloadB64),
-		DateB64:         []byte(birthdateB64),
-		DateB64Position: b64Index,
-		DatePosition:    dateIndex,
-		MinDateOfBirth:  minDateOfBirth,
-	}, nil
 }
 
-func GetClaimRange(obj map[string]any, objJSON []byte, claim string) (start, end int, err error) {
-
-	element := map[string]any{
-		claim: obj[claim],
+// TestOver18ClaimKey points the date position to the date_of_issuance claim,
+// which is before MinDateOfBirth while the birthdate is not
+func TestOver18ClaimKey(t *testing.T) {
+	payloadBytes, err := json.Marshal(models.GetDemoPIDUnder18())
+	if err != nil {
+		t.Fatal(err)
 	}
-	elementBytes, err := json.Marshal(element)
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadBytes)
+	issuance, err := common.FindClaim(payloadBytes, payloadB64, "date_of_issuance")
 	if err != nil {
-		return 0, 0, err
+		t.Fatal(err)
 	}
-	elementString := string(elementBytes)
-	elementString = strings.TrimPrefix(elementString, "{")
-	elementString = strings.TrimSuffix(elementString, "}")
 
-	// Find where the claim appears
-	indexStart := strings.Index(string(objJSON), elementString)
-	if indexStart == -1 {
-		return 0, 0, fmt.Errorf("element not found in JSON")
+	assignment := &ct.Over18{
+		Payload:         common.StringToU8Array(payloadB64),
+		DateB64:         common.StringToU8Array(issuance.B64),
+		DateB64Position: issuance.B64Start,
+		DatePosition:    issuance.ValuePosition,
+		MinDateOfBirth:  common.StringToU8Array("2021-01-01"),
 	}
-	fmt.Println(elementString)
-	// Length of the cnf variable
-	indexEnd := indexStart + len(elementString)
 
-	start, end = common.B64Align(indexStart, indexEnd)
-	fmt.Println(indexStart, indexEnd)
-	fmt.Println(start, end)
-	return start, end, nil
+	err = common.CheckWitness(assignment, assignment)
+	var werr *common.WitnessError
+	if !errors.As(err, &werr) {
+		t.Fatalf("expected a witness error, got %v", err)
+	}
+	if !strings.HasPrefix(werr.Label, `json key "birthdate":"`) {
+		t.Fatalf("unexpected assertion label %q (%v)", werr.Label, werr)
+	}
 }
 
-func GetClaimB64(objJSON []byte, indexStart, indexEnd int, claim string) string {
-	data := objJSON[indexStart:indexEnd]
-
-	return base64.RawURLEncoding.EncodeToString(data)
+type Over18Payload struct {
+	Payload         []byte
+	DateB64         []byte
+	DateB64Position int
+	DatePosition    int
+	MinDateOfBirth  string
 }
 
-func StructToMap(input any) (map[string]any, error) {
-	var result map[string]any
-	inputBytes, err := json.Marshal(input)
+func MockOver18Data(minDateOfBirth string) (*Over18Payload, error) {
+	payload := models.GetDemoPID()
+	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadBytes)
 
-	err = json.Unmarshal(inputBytes, &result)
+	// == find the position of the elements ==
+	birthdate, err := common.FindClaim(payloadBytes, payloadB64, "birthdate")
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to find the birthdate: %w", err)
 	}
-	return result, nil
+
+	return &Over18Payload{
+		Payload:         []byte(payloadB64),
+		DateB64:         []byte(birthdate.B64),
+		DateB64Position: birthdate.B64Start,
+		DatePosition:    birthdate.ValuePosition,
+		MinDateOfBirth:  minDateOfBirth,
+	}, nil
 }
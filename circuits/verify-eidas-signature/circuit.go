@@ -4,6 +4,8 @@ import (
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 /*
@@ -44,16 +46,16 @@ type CircuitJWS struct {
 	// JWSSigR and JWSSigS are the two components of the ECDSA signature (R, S
 	// values).
 	// For ES256, this is a signature over SHA-256(base64url(protected) || '.'
-	// || base64url(payload)).  Secp256r1Fr indicates these are scalar field
+	// || base64url(payload)).  curves.Secp256r1Fr indicates these are scalar field
 	// elements of the secp256r1 (P-256) curve.
-	JWSSigR emulated.Element[Secp256r1Fr] `gnark:",secret"`
-	JWSSigS emulated.Element[Secp256r1Fr] `gnark:",secret"`
+	JWSSigR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	JWSSigS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
 
 	// SignerPubKeyX and SignerPubKeyY represent the signer's ECDSA public key
 	// as affine coordinates.  This is the public key that corresponds to the
 	// private key used to create the JWS signature.
-	SignerPubKeyX emulated.Element[Secp256r1Fp] `gnark:",secret"`
-	SignerPubKeyY emulated.Element[Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
 
 	// CertTBSDER is the DER-encoded TBSCertificate (To Be Signed Certificate)
 	// portion.
@@ -68,8 +70,8 @@ type CircuitJWS struct {
 	// CertSigR and CertSigS are the ECDSA signature components of the X.509 certificate.
 	// This signature is created by the QTSP over the CertTBSDER data.
 	// Kept private as part of the complete certificate chain privacy.
-	CertSigR emulated.Element[Secp256r1Fr] `gnark:",secret"`
-	CertSigS emulated.Element[Secp256r1Fr] `gnark:",secret"`
+	CertSigR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	CertSigS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
 
 	// ===== PUBLIC INPUTS (Revealed to all verifiers) =====
 
@@ -79,13 +81,35 @@ type CircuitJWS struct {
 	// header.PAYLOAD.signature
 	JWSPayload []uints.U8 `gnark:",public"`
 
+	// JWSPayloadLen and JWSPayloadBlocks are the length (public) and the
+	// number of blocks of a variable-length payload, zero padded to
+	// PayloadBlocks.Size(): one compiled circuit covers every payload up to
+	// that size. Empty for a fixed-size payload, see
+	// common.PayloadBlocks.Inputs
+	JWSPayloadLen    []frontend.Variable `gnark:",public"`
+	JWSPayloadBlocks []frontend.Variable `gnark:",secret"`
+
 	// QTSPPubKeyX and QTSPPubKeyY represent the QTSP's trusted public key as affine coordinates.
 	// This is the root of trust - the public key of the authority that issued
 	// the signer's certificate. Public because verifiers need to know which
 	// trust authority is being relied upon.
 	// The QTSP (Qualified Trust Service Provider) is analogous to a Certificate Authority (CA).
-	QTSPPubKeyX emulated.Element[Secp256r1Fp] `gnark:",public"`
-	QTSPPubKeyY emulated.Element[Secp256r1Fp] `gnark:",public"`
+	QTSPPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	QTSPPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+
+	// JWSAlgPos is the position of the alg member in the decoded protected
+	// header (common.FindHeaderAlg) with HeaderAlg, empty otherwise
+	JWSAlgPos []frontend.Variable `gnark:",secret"`
+
+	// PayloadBlocks is the block layout of a variable-length payload, set at
+	// compile time; zero for a fixed-size payload
+	PayloadBlocks common.PayloadBlocks `gnark:"-"`
+
+	// HeaderAlg is the alg the protected header must declare (e.g.
+	// common.AlgES256), set at compile time; empty leaves the header
+	// unconstrained. Without it, a header declaring another algorithm, or
+	// "none", verifies as long as its ES256 signature does.
+	HeaderAlg string `gnark:"-"`
 }
 
 // The circuit performs three critical verification steps in sequence:
@@ -104,7 +128,9 @@ func (c *CircuitJWS) Define(api frontend.API) error {
 	//
 	// This establishes: "Someone with the private key corresponding to
 	// SignerPubKey created a valid signature over this specific payload."
-	c.VerifyJWS(api)
+	if err := c.VerifyJWS(api); err != nil {
+		return err
+	}
 
 	// Step 2: Verify X.509 Certificate Signature
 	// Proves: The certificate signature (CertSigR, CertSigS) is a valid ECDSA
@@ -113,7 +139,9 @@ func (c *CircuitJWS) Define(api frontend.API) error {
 	//
 	// This establishes: "The QTSP (trusted authority) has certified this
 	// certificate by signing it with their private key."
-	c.VerifyX509Signature(api)
+	if err := c.VerifyX509Signature(api); err != nil {
+		return err
+	}
 
 	// Step 3: Verify Public Key Binding
 	// Proves: The public key embedded in the X.509 certificate (extracted from
@@ -126,5 +154,5 @@ func (c *CircuitJWS) Define(api frontend.API) error {
 	//
 	// This establishes: "The public key certified by the QTSP is the same key
 	// that verified the JWS signature."
-	return c.verifyPubKeyInCertificateSimplified(api)
+	return c.verifyPubKeyInCertificate(api)
 }
@@ -10,15 +10,20 @@ import (
 	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
 	csv "github.com/mynextid/eudi-zk/circuits/verify-eidas-signature"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 const (
@@ -27,10 +32,6 @@ const (
 	vkPath  = "compiled/verifying.key"
 )
 
-// Define Secp256r1 field parameters
-type Secp256r1Fp = emulated.P256Fp
-type Secp256r1Fr = emulated.P256Fr
-
 func TestJWSCircuit(t *testing.T) {
 	// == create dummy data ==
 	// Generate ES256 (P-256) key pair
@@ -142,18 +143,18 @@ func TestJWSCircuit(t *testing.T) {
 	assignment := &csv.CircuitJWS{
 		// Private inputs
 		JWSProtected:  common.StringToU8Array(headerB64),
-		JWSSigR:       emulated.ValueOf[Secp256r1Fr](r),
-		JWSSigS:       emulated.ValueOf[Secp256r1Fr](s),
-		SignerPubKeyX: emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.X),
-		SignerPubKeyY: emulated.ValueOf[Secp256r1Fp](signerKey.PublicKey.Y),
+		JWSSigR:       emulated.ValueOf[curves.Secp256r1Fr](r),
+		JWSSigS:       emulated.ValueOf[curves.Secp256r1Fr](s),
+		SignerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
 		CertTBSDER:    common.BytesToU8Array(tbsCert),
-		CertSigR:      emulated.ValueOf[Secp256r1Fr](certSig.R),
-		CertSigS:      emulated.ValueOf[Secp256r1Fr](certSig.S),
+		CertSigR:      emulated.ValueOf[curves.Secp256r1Fr](certSig.R),
+		CertSigS:      emulated.ValueOf[curves.Secp256r1Fr](certSig.S),
 
 		// Public input
 		JWSPayload:  common.StringToU8Array(payloadB64),
-		QTSPPubKeyX: emulated.ValueOf[Secp256r1Fp](qtspKey.PublicKey.X),
-		QTSPPubKeyY: emulated.ValueOf[Secp256r1Fp](qtspKey.PublicKey.Y),
+		QTSPPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+		QTSPPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
 	}
 
 	// == Init the circuit ==
@@ -173,3 +174,220 @@ func TestJWSCircuit(t *testing.T) {
 	common.TestCircuitSimple(assignment, ccs, pk, vk)
 
 }
+
+// signedJWS returns the assignment of a JWS of the base64url header and
+// payload signed by a key certified by a fresh QTSP
+func signedJWS(t *testing.T, headerB64, payloadB64 string) *csv.CircuitJWS {
+	t.Helper()
+	signerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certifiedJWS(t, headerB64, payloadB64, signerKey, &signerKey.PublicKey, nil)
+}
+
+// certifiedJWS returns the assignment of a JWS of the base64url header and
+// payload signed by signerKey, with a certificate of subjectKey and the
+// extensions issued by a fresh QTSP
+func certifiedJWS(t *testing.T, headerB64, payloadB64 string, signerKey *ecdsa.PrivateKey, subjectKey *ecdsa.PublicKey, extensions []pkix.Extension) *csv.CircuitJWS {
+	t.Helper()
+	qtspKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "Test Signer"},
+		NotBefore:       time.Now(),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: extensions,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, subjectKey, qtspKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certSig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(cert.Signature, &certSig); err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256([]byte(headerB64 + "." + payloadB64))
+	r, s, err := ecdsa.Sign(rand.Reader, signerKey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &csv.CircuitJWS{
+		JWSProtected:  common.StringToU8Array(headerB64),
+		JWSSigR:       emulated.ValueOf[curves.Secp256r1Fr](r),
+		JWSSigS:       emulated.ValueOf[curves.Secp256r1Fr](s),
+		SignerPubKeyX: emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.X),
+		SignerPubKeyY: emulated.ValueOf[curves.Secp256r1Fp](signerKey.PublicKey.Y),
+		CertTBSDER:    common.BytesToU8Array(cert.RawTBSCertificate),
+		CertSigR:      emulated.ValueOf[curves.Secp256r1Fr](certSig.R),
+		CertSigS:      emulated.ValueOf[curves.Secp256r1Fr](certSig.S),
+		JWSPayload:    common.StringToU8Array(payloadB64),
+		QTSPPubKeyX:   emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.X),
+		QTSPPubKeyY:   emulated.ValueOf[curves.Secp256r1Fp](qtspKey.PublicKey.Y),
+	}
+}
+
+// headerAlgAssignment returns the assignment of a JWS of the protected header
+// signed by a key certified by a fresh QTSP, asserting HeaderAlg ES256
+func headerAlgAssignment(t *testing.T, header string, algPos int) *csv.CircuitJWS {
+	t.Helper()
+	headerB64 := base64.RawURLEncoding.EncodeToString([]byte(header))
+	payloadB64 := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1234567890"}`))
+	assignment := signedJWS(t, headerB64, payloadB64)
+	assignment.JWSAlgPos = []frontend.Variable{algPos}
+	assignment.HeaderAlg = common.AlgES256
+	return assignment
+}
+
+func TestJWSCircuitHeaderAlg(t *testing.T) {
+	header := `{"alg":"ES256","typ":"JOSE+JSON"}`
+	pos, err := common.FindHeaderAlg(base64.RawURLEncoding.EncodeToString([]byte(header)), common.AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignment := headerAlgAssignment(t, header, pos)
+	if err := common.CheckWitness(assignment, assignment); err != nil {
+		t.Fatal(err)
+	}
+
+	// a valid ES256 signature over a header declaring "none"
+	assignment = headerAlgAssignment(t, `{"alg":"none","typ":"JOSE+JSON"}`, 1)
+	var werr *common.WitnessError
+	if err := common.CheckWitness(assignment, assignment); !errors.As(err, &werr) {
+		t.Fatalf("expected a witness error, got %v", err)
+	}
+
+	// HeaderAlg without the alg position
+	assignment.JWSAlgPos = nil
+	if err := common.CheckWitness(assignment, assignment); err == nil || !strings.Contains(err.Error(), "alg position") {
+		t.Fatalf("expected an alg position error, got %v", err)
+	}
+}
+
+// documentHeader is the base64url protected header of the document JWS
+var documentHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JOSE+JSON"}`))
+
+// documentAssignment returns the assignment of a JWS of the document signed
+// by a key certified by a fresh QTSP, with the digest of digested
+func documentAssignment(t *testing.T, document, digested []byte) *csv.CircuitDocument {
+	t.Helper()
+	return documentOf(signedJWS(t, documentHeader, base64.RawURLEncoding.EncodeToString(document)), digested)
+}
+
+// documentOf returns the CircuitDocument assignment of a JWS of a document,
+// with the digest of digested
+func documentOf(jws *csv.CircuitJWS, digested []byte) *csv.CircuitDocument {
+	return &csv.CircuitDocument{
+		JWSProtected:   jws.JWSProtected,
+		JWSPayload:     jws.JWSPayload,
+		JWSSigR:        jws.JWSSigR,
+		JWSSigS:        jws.JWSSigS,
+		SignerPubKeyX:  jws.SignerPubKeyX,
+		SignerPubKeyY:  jws.SignerPubKeyY,
+		CertTBSDER:     jws.CertTBSDER,
+		CertSigR:       jws.CertSigR,
+		CertSigS:       jws.CertSigS,
+		DocumentDigest: common.BytesToU8Array(csv.DocumentDigest(digested)),
+		QTSPPubKeyX:    jws.QTSPPubKeyX,
+		QTSPPubKeyY:    jws.QTSPPubKeyY,
+	}
+}
+
+func TestDocumentCircuit(t *testing.T) {
+	document := []byte("%PDF-1.7 contract between Alice and Bob")
+	assignment := documentAssignment(t, document, document)
+	if err := common.CheckWitness(assignment, assignment); err != nil {
+		t.Fatal(err)
+	}
+
+	// the signature of another document
+	assignment = documentAssignment(t, []byte("%PDF-1.7 contract between Alice and Eve"), document)
+	var werr *common.WitnessError
+	if err := common.CheckWitness(assignment, assignment); !errors.As(err, &werr) {
+		t.Fatalf("expected a witness error, got %v", err)
+	}
+
+	// a certificate of another key, embedding the signer key in an extension:
+	// the signer key is not the subject public key
+	signerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subjectKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded := pkix.Extension{
+		Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1},
+		Value: elliptic.Marshal(elliptic.P256(), signerKey.PublicKey.X, signerKey.PublicKey.Y),
+	}
+	jws := certifiedJWS(t, documentHeader, base64.RawURLEncoding.EncodeToString(document), signerKey, &subjectKey.PublicKey, []pkix.Extension{embedded})
+	assignment = documentOf(jws, document)
+	if err := common.CheckWitness(assignment, assignment); !errors.As(err, &werr) {
+		t.Fatalf("expected a witness error for a key embedded outside the SubjectPublicKeyInfo, got %v", err)
+	}
+
+	// the public inputs are the digest and the QTSP key only
+	schema, err := frontend.NewSchema(ecc.BN254.ScalarField(), assignment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.NbPublic != 32+2*4 {
+		t.Fatalf("expected 40 public inputs, got %d", schema.NbPublic)
+	}
+}
+
+// subjectKeyAssignment returns the assignment of a certificate of subjectKey
+// and the first 64 bytes of its uncompressed point after 0x04
+func subjectKeyAssignment(t *testing.T, subjectKey *ecdsa.PublicKey) *csv.X509SubjectPubKeyCircuit {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, subjectKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := elliptic.Marshal(subjectKey.Curve, subjectKey.X, subjectKey.Y)
+	return &csv.X509SubjectPubKeyCircuit{
+		CertBytes:     common.BytesToU8Array(certDER),
+		SubjectPubKey: common.BytesToU8Array(point[1:65]),
+	}
+}
+
+func TestX509SubjectPubKeyCircuit(t *testing.T) {
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignment := subjectKeyAssignment(t, &p256Key.PublicKey)
+	if err := common.CheckWitness(assignment, assignment); err != nil {
+		t.Fatal(err)
+	}
+
+	// a P-384 key: its first 64 bytes are not a P-256 key
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignment = subjectKeyAssignment(t, &p384Key.PublicKey)
+	var werr *common.WitnessError
+	if err := common.CheckWitness(assignment, assignment); !errors.As(err, &werr) {
+		t.Fatalf("expected a witness error, got %v", err)
+	}
+}
@@ -1,9 +0,0 @@
-package csv
-
-import "github.com/consensys/gnark/std/math/emulated"
-
-// common params and constants
-
-// Secp256r1 field parameters
-type Secp256r1Fp = emulated.P256Fp
-type Secp256r1Fr = emulated.P256Fr
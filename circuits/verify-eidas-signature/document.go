@@ -0,0 +1,121 @@
+package csv
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+/*
+CircuitDocument is the document-binding variant of CircuitJWS, for eIDAS
+signatures of documents the verifier already holds (a contract, a PDF): the
+JWS payload is the base64url encoded document and stays private, the verifier
+supplies its SHA-256 digest instead.
+
+Zero-Knowledge Properties:
+The circuit PROVES the following statements:
+ 1. A JWS signature is valid for a payload, with a key certified by the QTSP
+    (the statements of CircuitJWS)
+ 2. The SHA-256 digest of the decoded payload, the document, is DocumentDigest
+
+What is PUBLIC (visible to verifiers):
+  - DocumentDigest, the SHA-256 digest of the document
+  - QTSP's public key
+
+Everything else, including the document itself, is private: the public
+inputs reveal nothing the verifier did not supply.
+*/
+type CircuitDocument struct {
+	// ===== PRIVATE INPUTS =====
+
+	// JWSProtected is the base64url encoded protected header
+	JWSProtected []uints.U8 `gnark:",secret"`
+	// JWSPayload is the base64url encoded document, private unlike the
+	// payload of CircuitJWS. Fixed size: the document length is compiled
+	// into the circuit.
+	JWSPayload []uints.U8 `gnark:",secret"`
+
+	JWSSigR emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	JWSSigS emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	SignerPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+	SignerPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",secret"`
+
+	CertTBSDER []uints.U8                           `gnark:",secret"`
+	CertSigR   emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+	CertSigS   emulated.Element[curves.Secp256r1Fr] `gnark:",secret"`
+
+	// JWSAlgPos is the position of the alg member with HeaderAlg, see
+	// CircuitJWS.JWSAlgPos
+	JWSAlgPos []frontend.Variable `gnark:",secret"`
+
+	// ===== PUBLIC INPUTS =====
+
+	// DocumentDigest is SHA-256 of the document (the decoded payload), 32
+	// bytes computed by the verifier from its copy (DocumentDigest)
+	DocumentDigest []uints.U8 `gnark:",public"`
+
+	QTSPPubKeyX emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+	QTSPPubKeyY emulated.Element[curves.Secp256r1Fp] `gnark:",public"`
+
+	// HeaderAlg is the alg the protected header must declare, see
+	// CircuitJWS.HeaderAlg
+	HeaderAlg string `gnark:"-"`
+}
+
+// DocumentDigest returns the public input of CircuitDocument for a document,
+// its SHA-256 digest
+func DocumentDigest(document []byte) []byte {
+	digest := sha256.Sum256(document)
+	return digest[:]
+}
+
+// jws returns the CircuitJWS over the same variables, with the document as
+// its payload
+func (c *CircuitDocument) jws() *CircuitJWS {
+	return &CircuitJWS{
+		JWSProtected:  c.JWSProtected,
+		JWSSigR:       c.JWSSigR,
+		JWSSigS:       c.JWSSigS,
+		SignerPubKeyX: c.SignerPubKeyX,
+		SignerPubKeyY: c.SignerPubKeyY,
+		CertTBSDER:    c.CertTBSDER,
+		CertSigR:      c.CertSigR,
+		CertSigS:      c.CertSigS,
+		JWSPayload:    c.JWSPayload,
+		QTSPPubKeyX:   c.QTSPPubKeyX,
+		QTSPPubKeyY:   c.QTSPPubKeyY,
+		JWSAlgPos:     c.JWSAlgPos,
+		HeaderAlg:     c.HeaderAlg,
+	}
+}
+
+// Define verifies the signature and the certificate as CircuitJWS, then
+// binds the payload to the public digest
+func (c *CircuitDocument) Define(api frontend.API) error {
+	if len(c.DocumentDigest) != sha256.Size {
+		return fmt.Errorf("document digest of %d bytes, expected %d", len(c.DocumentDigest), sha256.Size)
+	}
+
+	// Steps 1 to 3 of CircuitJWS: QTSP -> Certificate -> Signer -> Payload
+	if err := c.jws().Define(api); err != nil {
+		return err
+	}
+
+	// Step 4: the payload is the document of the verifier
+	document, err := common.DecodeBase64Url(api, c.JWSPayload)
+	if err != nil {
+		return err
+	}
+	digest, err := common.SHA256(api, document)
+	if err != nil {
+		return err
+	}
+	common.AssertBytesEqual(api, digest, c.DocumentDigest, "document digest")
+	return nil
+}
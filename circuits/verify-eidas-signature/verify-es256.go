@@ -1,61 +1,51 @@
 package csv
 
 import (
+	"fmt"
+
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/std/algebra/emulated/sw_emulated"
-	"github.com/consensys/gnark/std/hash/sha2"
-	"github.com/consensys/gnark/std/math/emulated"
-	"github.com/consensys/gnark/std/math/uints"
-	"github.com/consensys/gnark/std/signature/ecdsa"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 // VerifyJWS combines a protected JWS header with the payload and verifies the
 // signature using the provided public keys. Only for ES256
 // Assumptions:
 // - protected header contains all the non-PII metadata and is a private input
-// - payload contains all user info and is a public input
+// - payload contains all user info and is a public input, zero padded to its
+// blocks when PayloadBlocks is set
 // - selective disclosure of the user info is out of scope of this circuit as we'll address it later
+// - the protected header declares the alg HeaderAlg when set, see
+// common.AssertHeaderAlg
 func (c *CircuitJWS) VerifyJWS(api frontend.API) error {
-	// Initialize SHA256 hash
-	hash, err := sha2.New(api)
-	if err != nil {
-		return err
+	// The header declares the verified algorithm (HeaderAlg)
+	if c.HeaderAlg != "" {
+		if len(c.JWSAlgPos) != 1 {
+			return fmt.Errorf("header alg %s needs one alg position, got %d", c.HeaderAlg, len(c.JWSAlgPos))
+		}
+		if err := common.AssertHeaderAlg(api, c.JWSProtected, c.JWSAlgPos[0], c.HeaderAlg); err != nil {
+			return err
+		}
+	} else if len(c.JWSAlgPos) != 0 {
+		return fmt.Errorf("alg position without HeaderAlg")
 	}
 
-	// Concatenate header and payload with a '.' separator (ASCII 46 = 0x2E)
-	// format: base64url(header).base64url(payload)
-	dotSeparator := uints.NewU8(46)
-
-	// Write header to hasher
-	hash.Write(c.JWSProtected)
-
-	// Write dot separator
-	hash.Write([]uints.U8{dotSeparator})
-
-	// Write payload to hasher
-	hash.Write(c.JWSPayload)
+	Pub := curves.NewPublicKey(c.SignerPubKeyX, c.SignerPubKeyY)
+	Sig := curves.NewSignature(c.JWSSigR, c.JWSSigS)
 
-	// Compute SHA256 hash of header.payload
-	messageHash := hash.Sum()
+	payload := common.JWSPart{Bytes: c.JWSPayload}
+	if c.PayloadBlocks.Enabled() {
+		var err error
+		payload, err = c.PayloadBlocks.Part(api, c.JWSPayload, c.JWSPayloadLen, c.JWSPayloadBlocks)
+		if err != nil {
+			return err
+		}
+	}
 
-	// Convert to P256Fr
-	mHash, err := common.Sha256ToP256Fr(api, messageHash)
+	// Verify the signature of header.payload
+	input, err := common.BuildSigningInput(api, common.JWSPart{Bytes: c.JWSProtected}, payload)
 	if err != nil {
 		return err
 	}
-
-	Pub := ecdsa.PublicKey[emulated.P256Fp, emulated.P256Fr]{
-		X: c.SignerPubKeyX,
-		Y: c.SignerPubKeyY,
-	}
-	Sig := ecdsa.Signature[emulated.P256Fr]{
-		R: c.JWSSigR,
-		S: c.JWSSigS,
-	}
-
-	// Verify the signature
-	Pub.Verify(api, sw_emulated.GetCurveParams[emulated.P256Fp](), mHash, &Sig)
-
-	return nil
+	return common.VerifySigningInput(api, input, Pub, Sig)
 }
@@ -4,8 +4,8 @@ import (
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/algebra/emulated/sw_emulated"
 	"github.com/consensys/gnark/std/math/emulated"
-	"github.com/consensys/gnark/std/signature/ecdsa"
 	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
 // VerifyX509Signature verifies a signature of a DER encoded X.509 certificate
@@ -19,15 +19,9 @@ func (c *CircuitJWS) VerifyX509Signature(api frontend.API) error {
 		return err
 	}
 
-	Pub := ecdsa.PublicKey[emulated.P256Fp, emulated.P256Fr]{
-		X: c.QTSPPubKeyX,
-		Y: c.QTSPPubKeyY,
-	}
+	Pub := curves.NewPublicKey(c.QTSPPubKeyX, c.QTSPPubKeyY)
 
-	Sig := ecdsa.Signature[emulated.P256Fr]{
-		R: c.CertSigR,
-		S: c.CertSigS,
-	}
+	Sig := curves.NewSignature(c.CertSigR, c.CertSigS)
 
 	// // signature verification assertion is done in-circuit
 	Pub.Verify(api, sw_emulated.GetCurveParams[emulated.P256Fp](), mHash, &Sig)
@@ -0,0 +1,157 @@
+// Package claims is the taxonomy of the attributes verifiers request
+// (age_over_18, nationality, ...), as named by the EUDI PID rulebook, mapped
+// to the circuits and the predicate parameters proving them:
+//
+//	c, err := claims.Lookup("age_over_18")
+//	// c.Proofs[0]: circuit temporal/over18, params {"min_age": "18"}
+//
+//	plan, err := claims.NewPlan([]string{"age_over_18", "email"}, served)
+//	// plan.Presentations: the circuits to prove, with their claims
+//
+// The default taxonomy (taxonomy.go) is registered at init, deployments add
+// their own claims with Register. It is served by the server (GET /claims)
+// and used by the presentation planner (NewPlan).
+package claims
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// Method is how a proof establishes its claim
+type Method string
+
+const (
+	// MethodCircuit is a dedicated circuit (e.g. temporal/over18)
+	MethodCircuit Method = "circuit"
+	// MethodPredicate is a predicate of the predicates circuit
+	// (circuits/predicates), named by Proof.Predicate
+	MethodPredicate Method = "predicate"
+	// MethodReveal discloses the claim value (circuitkit.ClaimReveal)
+	MethodReveal Method = "reveal"
+)
+
+// Proof is a way to prove a claim
+type Proof struct {
+	// Circuit is the circuit family (the circuit id without its version,
+	// verifier.CircuitFamily) proving the claim
+	Circuit string `json:"circuit"`
+	Method  Method `json:"method"`
+	// Predicate is the registered predicate of MethodPredicate
+	Predicate string `json:"predicate,omitempty"`
+	// Params are the parameters the verifier sets the public inputs from,
+	// e.g. {"min_age": "18"}
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Claim is an attribute of the taxonomy
+type Claim struct {
+	// Name is the attribute identifier requested by the verifiers
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Source is the payload claim the attribute is proven from, e.g. the
+	// birthdate of age_over_18
+	Source string `json:"source"`
+	// Proofs are the ways to prove the claim, in order of preference
+	Proofs []Proof `json:"proofs"`
+}
+
+// validate checks the claim can be registered
+func (c *Claim) validate() error {
+	if c.Name == "" || c.Source == "" {
+		return fmt.Errorf("claim %q without name or source", c.Name)
+	}
+	if len(c.Proofs) == 0 {
+		return fmt.Errorf("claim %q without proofs", c.Name)
+	}
+	for _, p := range c.Proofs {
+		switch {
+		case p.Circuit == "":
+			return fmt.Errorf("claim %q: proof without circuit", c.Name)
+		case p.Method != MethodCircuit && p.Method != MethodPredicate && p.Method != MethodReveal:
+			return fmt.Errorf("claim %q: unknown method %q", c.Name, p.Method)
+		case (p.Method == MethodPredicate) != (p.Predicate != ""):
+			return fmt.Errorf("claim %q: the predicate is set by the predicate method only", c.Name)
+		}
+	}
+	return nil
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Claim{}
+)
+
+// Register adds a claim to the taxonomy. Register panics if the claim is
+// invalid or registered twice, as cpred.Register.
+func Register(c Claim) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if err := c.validate(); err != nil {
+		panic("claims: " + err.Error())
+	}
+	if _, dup := registry[c.Name]; dup {
+		panic(fmt.Sprintf("claims: Register called twice for claim %q", c.Name))
+	}
+	c.Proofs = slices.Clone(c.Proofs)
+	registry[c.Name] = c
+}
+
+// Lookup returns the registered claim
+func Lookup(name string) (*Claim, error) {
+	registryMu.RLock()
+	c, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown claim %q", name)
+	}
+	c.Proofs = slices.Clone(c.Proofs)
+	return &c, nil
+}
+
+// Registered returns the sorted names of the registered claims
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Taxonomy returns the registered claims sorted by name. With served
+// circuit ids (versioned or families) only the proofs of the served
+// circuits are kept, and the claims without such proofs are left out.
+func Taxonomy(served []string) []Claim {
+	claims := []Claim{}
+	for _, name := range Registered() {
+		c, err := Lookup(name)
+		if err != nil {
+			continue
+		}
+		if served != nil {
+			c.Proofs = slices.DeleteFunc(c.Proofs, func(p Proof) bool { return !isServed(p.Circuit, served) })
+			if len(c.Proofs) == 0 {
+				continue
+			}
+		}
+		claims = append(claims, *c)
+	}
+	return claims
+}
+
+// isServed reports whether a circuit family is one of the served circuit
+// ids, nil serving every circuit
+func isServed(family string, served []string) bool {
+	if served == nil {
+		return true
+	}
+	return slices.ContainsFunc(served, func(id string) bool {
+		return id == family || verifier.CircuitFamily(id) == family
+	})
+}
@@ -0,0 +1,127 @@
+package claims
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	cpred "github.com/mynextid/eudi-zk/circuits/predicates"
+)
+
+func TestTaxonomy(t *testing.T) {
+	registered := cpred.Registered()
+	for _, c := range Taxonomy(nil) {
+		for _, p := range c.Proofs {
+			if p.Method == MethodPredicate && !slices.Contains(registered, p.Predicate) {
+				t.Errorf("%s: unknown predicate %q", c.Name, p.Predicate)
+			}
+		}
+	}
+
+	c, err := Lookup("age_over_18")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Source != "birthdate" || c.Proofs[0].Circuit != "temporal/over18" || c.Proofs[0].Params[ParamMinAge] != "18" {
+		t.Fatalf("unexpected claim %+v", c)
+	}
+	if _, err := Lookup("age_over_17"); err == nil {
+		t.Fatal("expected an unknown claim")
+	}
+
+	// the proofs of the served circuits only
+	served := Taxonomy([]string{"temporal/over18/v2", "pid-nationality"})
+	var names []string
+	for _, c := range served {
+		names = append(names, c.Name)
+	}
+	if !slices.Equal(names, []string{"age_over_18", "nationality"}) {
+		t.Fatalf("served claims %v", names)
+	}
+	if len(served[0].Proofs) != 1 {
+		t.Fatalf("expected the over18 proof only, got %+v", served[0].Proofs)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	invalid := []Claim{
+		{Name: "x", Source: "x"},
+		{Name: "x", Source: "x", Proofs: []Proof{{Circuit: "c", Method: "hash"}}},
+		{Name: "x", Source: "x", Proofs: []Proof{{Circuit: "c", Method: MethodPredicate}}},
+		{Name: "age_over_18", Source: "birthdate", Proofs: []Proof{{Circuit: "c", Method: MethodCircuit}}},
+	}
+	for _, c := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected Register to panic for %+v", c)
+				}
+			}()
+			Register(c)
+		}()
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	circuits := func(plan *Plan) [][]string {
+		var out [][]string
+		for _, p := range plan.Presentations {
+			entry := []string{p.Circuit}
+			for _, c := range p.Claims {
+				entry = append(entry, c.Claim)
+			}
+			out = append(out, entry)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		requested []string
+		served    []string
+		want      [][]string
+	}{
+		{
+			"any circuit", []string{"age_over_18", "email", "phone_number", "nationality"}, nil,
+			[][]string{{"temporal/over18", "age_over_18"}, {"pid-nationality", "nationality"}, {"predicates/email-equals+phone-equals", "email", "phone_number"}},
+		},
+		{
+			"repeated predicate", []string{"age_over_21", "age_over_65", "email"}, nil,
+			[][]string{{"predicates/birthdate-before+email-equals", "age_over_21", "email"}, {"predicates/birthdate-before", "age_over_65"}},
+		},
+		{
+			"served predicates circuits", []string{"age_over_18", "email", "age_over_21"},
+			[]string{"predicates/email-equals/v1", "predicates/birthdate-before+birthdate-before+email-equals/v2"},
+			[][]string{{"predicates/birthdate-before+birthdate-before+email-equals", "age_over_18", "email", "age_over_21"}},
+		},
+		{
+			"fallback proof", []string{"age_over_18"}, []string{"predicates/birthdate-before"},
+			[][]string{{"predicates/birthdate-before", "age_over_18"}},
+		},
+		{
+			"issuance freshness", []string{"issued_within_30_days", "age_over_21"}, nil,
+			[][]string{{"predicates/issued-after+birthdate-before", "issued_within_30_days", "age_over_21"}},
+		},
+		{
+			"issuance freshness from iat", []string{"issued_within_90_days"}, []string{"predicates/iat-after/v1"},
+			[][]string{{"predicates/iat-after", "issued_within_90_days"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := NewPlan(tt.requested, tt.served)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := circuits(plan); !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Fatalf("plan %v, expected %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, requested := range [][]string{{"age_over_17"}, {"nationality"}, {"age_over_18", "email"}} {
+		if _, err := NewPlan(requested, []string{"temporal/over18/v1"}); !errors.Is(err, ErrNotProvable) {
+			t.Errorf("%v: expected ErrNotProvable, got %v", requested, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package claims
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	cpred "github.com/mynextid/eudi-zk/circuits/predicates"
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// ErrNotProvable is wrapped by the errors of NewPlan for a requested claim
+// no served circuit proves
+var ErrNotProvable = errors.New("claim not provable")
+
+// PlannedClaim is a requested claim with the proof selected for it
+type PlannedClaim struct {
+	Claim string `json:"claim"`
+	Proof Proof  `json:"proof"`
+}
+
+// Presentation is a presentation of a plan: a proof of the circuit (family)
+// establishing the claims
+type Presentation struct {
+	Circuit string         `json:"circuit"`
+	Claims  []PlannedClaim `json:"claims"`
+}
+
+// Plan are the presentations proving the requested claims
+type Plan struct {
+	Presentations []Presentation `json:"presentations"`
+}
+
+// NewPlan plans the presentations proving the requested claims with the
+// served circuit ids (versioned or families, nil for any circuit). Each claim
+// is proven by its first proof whose circuit is served. The predicate proofs
+// are merged into the predicates circuits: a served predicates circuit runs
+// each of its predicates once, the circuit running the most requested
+// predicates is planned first; without served circuits the distinct
+// predicates share one circuit.
+func NewPlan(requested, served []string) (*Plan, error) {
+	plan := &Plan{}
+	var predicates []PlannedClaim
+	seen := map[string]bool{}
+	for _, name := range requested {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		c, err := Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNotProvable, err)
+		}
+		i := slices.IndexFunc(c.Proofs, func(p Proof) bool { return isServed(p.Circuit, served) || predicateServed(p, served) })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: no served circuit proves %q", ErrNotProvable, name)
+		}
+		planned := PlannedClaim{Claim: name, Proof: c.Proofs[i]}
+		if planned.Proof.Method == MethodPredicate {
+			predicates = append(predicates, planned)
+			continue
+		}
+		plan.Presentations = append(plan.Presentations, Presentation{Circuit: planned.Proof.Circuit, Claims: []PlannedClaim{planned}})
+	}
+
+	for len(predicates) > 0 {
+		candidates := predicatesCircuits(served)
+		if served == nil {
+			var names []string
+			for _, p := range predicates {
+				if !slices.Contains(names, p.Proof.Predicate) {
+					names = append(names, p.Proof.Predicate)
+				}
+			}
+			candidates = []string{cpred.CircuitID(names...)}
+		}
+
+		var best string
+		var bestClaims []int
+		for _, circuit := range candidates {
+			if claims := runPredicates(circuit, predicates); len(claims) > len(bestClaims) {
+				best, bestClaims = circuit, claims
+			}
+		}
+		if len(bestClaims) == 0 {
+			return nil, fmt.Errorf("%w: no served circuit runs %q", ErrNotProvable, predicates[0].Proof.Predicate)
+		}
+
+		p := Presentation{Circuit: best}
+		for _, i := range bestClaims {
+			planned := predicates[i]
+			planned.Proof.Circuit = best
+			p.Claims = append(p.Claims, planned)
+		}
+		plan.Presentations = append(plan.Presentations, p)
+		for _, i := range slices.Backward(bestClaims) {
+			predicates = slices.Delete(predicates, i, i+1)
+		}
+	}
+	return plan, nil
+}
+
+// predicatesCircuits returns the families of the served predicates circuits
+func predicatesCircuits(served []string) []string {
+	var circuits []string
+	for _, id := range served {
+		family := verifier.CircuitFamily(id)
+		if strings.HasPrefix(family, cpred.CircuitID()) && !slices.Contains(circuits, family) {
+			circuits = append(circuits, family)
+		}
+	}
+	return circuits
+}
+
+// predicateServed reports whether a served predicates circuit runs the
+// predicate of the proof
+func predicateServed(p Proof, served []string) bool {
+	if p.Method != MethodPredicate {
+		return false
+	}
+	return slices.ContainsFunc(predicatesCircuits(served), func(circuit string) bool {
+		return len(runPredicates(circuit, []PlannedClaim{{Proof: p}})) == 1
+	})
+}
+
+// runPredicates returns the indexes of the claims the predicates circuit
+// proves, each of its predicates proving one claim
+func runPredicates(circuit string, claims []PlannedClaim) []int {
+	names := strings.Split(strings.TrimPrefix(circuit, cpred.CircuitID()), "+")
+	var indexes []int
+	for i, c := range claims {
+		if j := slices.Index(names, c.Proof.Predicate); j >= 0 {
+			names[j] = "" // each predicate proves one claim
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,90 @@
+package claims
+
+import (
+	"strconv"
+
+	cpred "github.com/mynextid/eudi-zk/circuits/predicates"
+	ct "github.com/mynextid/eudi-zk/circuits/temporal"
+)
+
+// ParamMinAge is the parameter of the age claims, in years: the verifier
+// proves the birthdate before today minus the age
+const ParamMinAge = "min_age"
+
+// ParamMaxDays is the parameter of the issuance freshness claims, in days:
+// the verifier proves the date of issuance, or the iat, on or after today
+// minus the days (cpred.IssuedWithin)
+const ParamMaxDays = "max_days"
+
+// ParamClaim is the parameter of the reveal proofs, the revealed payload
+// claim
+const ParamClaim = "claim"
+
+func init() {
+	for _, age := range []int{16, 18, 21, 65} {
+		Register(ageOver(age))
+	}
+	for _, days := range []int{30, 90, 365} {
+		Register(issuedWithin(days))
+	}
+	Register(Claim{
+		Name:        "nationality",
+		Description: "Nationality of the holder (ISO 3166-1 alpha-2)",
+		Source:      "nationality",
+		Proofs:      []Proof{{Circuit: "pid-nationality", Method: MethodReveal, Params: map[string]string{ParamClaim: "nationality"}}},
+	})
+	Register(Claim{
+		Name:        "issuing_country",
+		Description: "Country of the PID provider (ISO 3166-1 alpha-2)",
+		Source:      "issuing_country",
+		Proofs:      []Proof{{Circuit: "pid-issuing-country", Method: MethodReveal, Params: map[string]string{ParamClaim: "issuing_country"}}},
+	})
+	Register(Claim{
+		Name:        "email",
+		Description: "Email address of the holder equals the address on file",
+		Source:      "email",
+		Proofs:      []Proof{predicate("email-equals", nil)},
+	})
+	Register(Claim{
+		Name:        "phone_number",
+		Description: "Phone number of the holder equals the number on file",
+		Source:      "phone_number",
+		Proofs:      []Proof{predicate("phone-equals", nil)},
+	})
+}
+
+// ageOver returns the age_over_NN claim of the PID rulebook. The over18
+// circuit proves age_over_18 only, the birthdate-before predicate any age.
+func ageOver(age int) Claim {
+	params := map[string]string{ParamMinAge: strconv.Itoa(age)}
+	c := Claim{
+		Name:        "age_over_" + strconv.Itoa(age),
+		Description: "The holder is at least " + strconv.Itoa(age) + " years old",
+		Source:      ct.BirthdateClaim,
+	}
+	if age == 18 {
+		c.Proofs = append(c.Proofs, Proof{Circuit: "temporal/over18", Method: MethodCircuit, Params: params})
+	}
+	c.Proofs = append(c.Proofs, predicate("birthdate-before", params))
+	return c
+}
+
+// issuedWithin returns the issued_within_NN_days claim, for the relying
+// parties requiring a recently issued credential (e.g. proof of current
+// residence). The issued-after predicate proves it from the PID
+// date_of_issuance, the iat-after predicate from the iat of the credential.
+func issuedWithin(days int) Claim {
+	params := map[string]string{ParamMaxDays: strconv.Itoa(days)}
+	return Claim{
+		Name:        "issued_within_" + strconv.Itoa(days) + "_days",
+		Description: "The credential was issued within the last " + strconv.Itoa(days) + " days",
+		Source:      cpred.IssuanceDateClaim,
+		Proofs:      []Proof{predicate("issued-after", params), predicate("iat-after", params)},
+	}
+}
+
+// predicate returns the proof by the predicates circuit running the
+// predicate alone, NewPlan merges the predicates of a presentation
+func predicate(name string, params map[string]string) Proof {
+	return Proof{Circuit: cpred.CircuitID(name), Method: MethodPredicate, Predicate: name, Params: params}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mynextid/eudi-zk/server"
+)
+
+// Circuit is the typed client of one circuit: the disclosed claims of its
+// presentations decode into C, a struct with the JSON tags of the claims
+//
+//	type PoPClaims struct {
+//		AgeOver18 bool `json:"age_over_18"`
+//	}
+//	pop := client.NewCircuit[PoPClaims](c, "eudi-vc/pop/v1")
+//	res, err := pop.VerifyPresentation(ctx, compact) // res.Claims.AgeOver18
+type Circuit[C any] struct {
+	client *Client
+	id     string
+	vkHash string
+}
+
+// NewCircuit returns the typed client of the circuit id
+func NewCircuit[C any](c *Client, id string) *Circuit[C] {
+	return &Circuit[C]{client: c, id: id}
+}
+
+// WithVKHash returns the typed client of the circuit pinned to the verifying
+// key hash (hex, common.VerifyingKeyHash) the proofs are made for: Verify
+// fails with a *VersionMismatchError when the server registered the circuit
+// with another key
+func (c *Circuit[C]) WithVKHash(vkHash string) *Circuit[C] {
+	return &Circuit[C]{client: c.client, id: c.id, vkHash: vkHash}
+}
+
+// ID returns the circuit id
+func (c *Circuit[C]) ID() string {
+	return c.id
+}
+
+// Verify verifies a raw proof of the circuit (gnark binary encoding), see
+// Client.Verify
+func (c *Circuit[C]) Verify(ctx context.Context, proof, publicWitness []byte) (*Result[C], error) {
+	res, err := c.client.Verify(ctx, server.VerifyRequest{Circuit: c.id, Proof: proof, PublicWitness: publicWitness, VKHash: c.vkHash})
+	if err != nil {
+		return nil, err
+	}
+	return c.result(res)
+}
+
+// Result is a verified presentation of a Circuit
+type Result[C any] struct {
+	*server.VerifyResponse
+	// Claims are the disclosed claims of the payload
+	Claims C
+}
+
+// VerifyPresentation verifies a presentation of the circuit, presentations
+// of other circuits are rejected
+func (c *Circuit[C]) VerifyPresentation(ctx context.Context, compact string) (*Result[C], error) {
+	res, err := c.client.VerifyPresentation(ctx, compact)
+	if err != nil {
+		return nil, err
+	}
+	return c.result(res)
+}
+
+// VerifyPresentationCOSE is VerifyPresentation for a COSE presentation
+func (c *Circuit[C]) VerifyPresentationCOSE(ctx context.Context, data []byte) (*Result[C], error) {
+	res, err := c.client.VerifyPresentationCOSE(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return c.result(res)
+}
+
+// Cost returns the cost of a proof of the circuit, see Client.Cost
+func (c *Circuit[C]) Cost(ctx context.Context, inputSizes map[string]int) (*server.CostResponse, error) {
+	return c.client.Cost(ctx, c.id, inputSizes)
+}
+
+func (c *Circuit[C]) result(res *server.VerifyResponse) (*Result[C], error) {
+	if res.Circuit != c.id {
+		return nil, fmt.Errorf("presentation of circuit %q, expected %q", res.Circuit, c.id)
+	}
+	r := &Result[C]{VerifyResponse: res}
+	if res.Payload != nil && res.Payload.Claims != nil {
+		data, err := json.Marshal(res.Payload.Claims)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &r.Claims); err != nil {
+			return nil, fmt.Errorf("circuit %q: invalid claims: %w", c.id, err)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,388 @@
+// Package client is the Go client of the verification API (package server):
+//
+//	c := client.New("https://verifier.example", client.Options{APIKey: key})
+//	res, err := c.VerifyPresentation(ctx, compact)
+//
+// Requests and responses are the types of package server, errors answered by
+// the server are *server.Problem (switch on Type), or *VersionMismatchError
+// when the server does not serve the protocol or circuit version of the
+// request. Requests failing with a
+// transient error (connection error, 502, 503, 504) are retried with
+// exponential backoff, until Options.MaxRetries or the end of the context.
+//
+// Prove requests a proof of a prover farm (package prover); with
+// Options.ProverRoots the proof must carry the attestation of a deployment
+// certified by one of the roots.
+//
+// Capabilities discovers the features of a deployment (backends, presentation
+// algs, limits, circuits) for a client to adapt to it.
+//
+// Challenge requests the nonce of a presentation; with a channel binding it
+// carries the binding material of the connection it was issued on, and the
+// presentation must be verified over the same connection.
+//
+// Circuit gives typed access to the payload claims of one circuit, and
+// WaitForConfig polls /healthz until a configuration is applied (after
+// POST /admin/reload).
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/prover"
+	"github.com/mynextid/eudi-zk/server"
+)
+
+// Options are the settings of a Client
+type Options struct {
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+	// APIKey is sent as Authorization: Bearer <key>
+	APIKey string
+	// MaxRetries is the number of retries of a transient error, 3 when 0,
+	// none when negative
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the delay between retries, which
+	// doubles from MinBackoff (100ms) up to MaxBackoff (5s), with jitter
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// ProverRoots are the roots of the proving services trusted by Prove,
+	// which then requires the proofs to be attested (prover.Attestation)
+	ProverRoots *x509.CertPool
+}
+
+// Client calls the verification API
+type Client struct {
+	baseURL string
+	opts    Options
+}
+
+// New returns a client of the API at baseURL
+func New(baseURL string, opts Options) *Client {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), opts: opts}
+}
+
+// Verify verifies a raw proof (POST /verify)
+func (c *Client) Verify(ctx context.Context, req server.VerifyRequest) (*server.VerifyResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var res server.VerifyResponse
+	if err := c.do(ctx, http.MethodPost, "/verify", "application/json", body, "", &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// VerifyPresentation verifies a presentation in compact serialization, or
+// encrypted to the verifier (models.EncryptPresentation)
+func (c *Client) VerifyPresentation(ctx context.Context, compact string) (*server.VerifyResponse, error) {
+	body, err := json.Marshal(server.PresentationVerifyRequest{Presentation: compact})
+	if err != nil {
+		return nil, err
+	}
+	var res server.VerifyResponse
+	if err := c.do(ctx, http.MethodPost, "/presentations/verify", "application/json", body, "", &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// VerifyPresentationCOSE verifies a COSE encoded presentation
+// (models.SignPresentationCOSE)
+func (c *Client) VerifyPresentationCOSE(ctx context.Context, data []byte) (*server.VerifyResponse, error) {
+	var res server.VerifyResponse
+	if err := c.do(ctx, http.MethodPost, "/presentations/verify", models.PresentationMediaTypeCOSE, data, "", &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Prove proves a witness or the named inputs of a circuit with a prover farm
+// (POST /circuits/{circuit}/prove). With Options.ProverRoots the attestation
+// of the result is verified, else prover.ErrInvalidAttestation.
+func (c *Client) Prove(ctx context.Context, circuit string, req prover.ProveRequest) (*prover.Result, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var res prover.Result
+	if err := c.do(ctx, http.MethodPost, "/circuits/"+url.PathEscape(circuit)+"/prove", "application/json", body, "", &res); err != nil {
+		return nil, err
+	}
+	if c.opts.ProverRoots != nil {
+		if _, err := prover.VerifyAttestation(res.Attestation, circuit, res.Proof, x509.VerifyOptions{Roots: c.opts.ProverRoots}); err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+// Cost returns the cost profile of a circuit and, when inputSizes are given,
+// the estimate for these sizes (GET /circuits/{circuit}/cost)
+func (c *Client) Cost(ctx context.Context, circuit string, inputSizes map[string]int) (*server.CostResponse, error) {
+	path := "/circuits/" + url.PathEscape(circuit) + "/cost"
+	if len(inputSizes) > 0 {
+		query := url.Values{}
+		for name, size := range inputSizes {
+			query.Set(name, strconv.Itoa(size))
+		}
+		path += "?" + query.Encode()
+	}
+	var res server.CostResponse
+	if err := c.do(ctx, http.MethodGet, path, "", nil, "", &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Health returns the status and the applied configuration (GET /healthz)
+func (c *Client) Health(ctx context.Context) (*server.HealthResponse, error) {
+	var res server.HealthResponse
+	if err := c.do(ctx, http.MethodGet, "/healthz", "", nil, "", &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Capabilities returns the features of the server build and configuration
+// (GET /capabilities)
+func (c *Client) Capabilities(ctx context.Context) (*server.CapabilitiesResponse, error) {
+	var res server.CapabilitiesResponse
+	if err := c.do(ctx, http.MethodGet, "/capabilities", "", nil, "", &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Challenge is a nonce of GET /challenge and the channel binding of the
+// connection it was issued on
+type Challenge struct {
+	server.ChallengeResponse
+	// Value is the decoded nonce, the nonce of the session transcript
+	Value []byte `json:"-"`
+	// Binding is the channel binding of the client side of the connection
+	// (models.TLSExporterBinding, models.SessionBinding), nil when the nonce
+	// is not bound
+	Binding []byte `json:"-"`
+}
+
+// bind decodes the nonce and checks it was issued for the connection of resp
+func (c *Challenge) bind(resp *http.Response) error {
+	var err error
+	if c.Value, err = base64.RawURLEncoding.DecodeString(c.Nonce); err != nil {
+		return fmt.Errorf("invalid challenge nonce: %w", err)
+	}
+	switch c.ChannelBinding {
+	case "":
+		return nil
+	case models.ChannelBindingTLSExporter:
+		if c.Binding, err = models.TLSExporterBinding(resp.TLS); err != nil {
+			return err
+		}
+	case models.ChannelBindingSession:
+		cookie, err := resp.Request.Cookie(c.SessionCookie)
+		if err != nil {
+			return fmt.Errorf("session channel binding without %s cookie", c.SessionCookie)
+		}
+		c.Binding = models.SessionBinding(cookie.Value)
+	default:
+		return fmt.Errorf("unsupported channel binding %q", c.ChannelBinding)
+	}
+	return models.CheckChannelNonce(c.Value, c.Binding)
+}
+
+// Challenge requests the nonce of a presentation (GET /challenge). A nonce
+// bound to the channel is checked against the binding of the connection; the
+// holder signs it and verifies the presentation over the same connection,
+// which HTTPClient reuses as long as it is kept alive. The session binding
+// reads the session cookie from the cookie jar of HTTPClient.
+func (c *Client) Challenge(ctx context.Context) (*Challenge, error) {
+	var res Challenge
+	if err := c.do(ctx, http.MethodGet, "/challenge", "", nil, "", &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Reload reloads the configuration of the server with an admin key
+// (POST /admin/reload). A failed reload is not retried.
+func (c *Client) Reload(ctx context.Context, adminKey string) (*server.HealthResponse, error) {
+	var res server.HealthResponse
+	if err := c.do(ctx, http.MethodPost, "/admin/reload", "", nil, adminKey, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// WaitForConfig polls /healthz every interval until ready returns true for
+// the health of the server, e.g. until a new configuration version or
+// circuit is served by every replica behind a load balancer
+func (c *Client) WaitForConfig(ctx context.Context, interval time.Duration, ready func(*server.HealthResponse) bool) (*server.HealthResponse, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		health, err := c.Health(ctx)
+		if err == nil && ready(health) {
+			return health, nil
+		}
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			return nil, fmt.Errorf("configuration not ready: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// HasCircuit is a WaitForConfig condition: the circuit is registered
+func HasCircuit(circuit string) func(*server.HealthResponse) bool {
+	return func(h *server.HealthResponse) bool {
+		return slices.Contains(h.Circuits, circuit)
+	}
+}
+
+// do sends a request, retrying transient errors, and decodes the JSON
+// response into res. bearer overrides the API key.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte, bearer string, res any) error {
+	if bearer == "" {
+		bearer = c.opts.APIKey
+	}
+	backoff := c.opts.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, method, path, contentType, body, bearer, res)
+		if err == nil || !retryable(err) || attempt >= c.opts.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		// full jitter: a random delay up to the backoff
+		delay := time.Duration(rand.Int64N(int64(backoff)) + 1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		backoff = min(2*backoff, c.opts.MaxBackoff)
+	}
+}
+
+// VersionMismatchError is returned when the server does not serve the
+// protocol version of the client or the version of the circuit of the proof,
+// e.g. a wallet proving with the witness layout of v1 against a server
+// upgraded to v2. The problem lists the versions the server serves.
+type VersionMismatchError struct {
+	Problem *server.Problem
+}
+
+func (e *VersionMismatchError) Error() string { return e.Problem.Error() }
+func (e *VersionMismatchError) Unwrap() error { return e.Problem }
+
+// Versions returns the versions of the circuit served by the server
+func (e *VersionMismatchError) Versions() []models.CircuitVersion {
+	return e.Problem.Versions
+}
+
+// ProtocolVersions returns the protocol versions of the server, on a
+// protocol version mismatch
+func (e *VersionMismatchError) ProtocolVersions() []int {
+	return e.Problem.ProtocolVersions
+}
+
+// transientError is a failed attempt worth retrying
+type transientError struct{ err error }
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+func retryable(err error) bool {
+	var t *transientError
+	return errors.As(err, &t)
+}
+
+func (c *Client) send(ctx context.Context, method, path, contentType string, body []byte, bearer string, res any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(server.ProtocolHeader, strconv.Itoa(server.ProtocolVersion))
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return &transientError{err}
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &transientError{err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var p server.Problem
+		if err := json.Unmarshal(data, &p); err != nil || p.Type == "" {
+			p = server.Problem{Title: http.StatusText(resp.StatusCode), Status: resp.StatusCode, Detail: strings.TrimSpace(string(data))}
+		}
+		// the reload of the configuration is not idempotent
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			if path != "/admin/reload" {
+				return &transientError{&p}
+			}
+		}
+		if p.Type == server.ProblemVersionMismatch {
+			return &VersionMismatchError{Problem: &p}
+		}
+		return &p
+	}
+	if err := json.Unmarshal(data, res); err != nil {
+		return fmt.Errorf("invalid %s %s response: %w", method, path, err)
+	}
+	if b, ok := res.(connectionBound); ok {
+		return b.bind(resp)
+	}
+	return nil
+}
+
+// connectionBound is a response bound to the connection it was received on
+type connectionBound interface {
+	bind(resp *http.Response) error
+}
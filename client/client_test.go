@@ -0,0 +1,269 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/prover"
+	"github.com/mynextid/eudi-zk/server"
+)
+
+// cubeCircuit proves knowledge of X with X^3 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+type ageClaims struct {
+	AgeOver18 bool `json:"age_over_18"`
+}
+
+// cubeSetup proves the cube circuit and returns the verifier of the
+// presentations of the holder key
+func cubeSetup(t *testing.T) (proof *bytes.Buffer, publicWitness []byte, vkHash string, holderKey *ecdsa.PrivateKey, verifier *models.PresentationVerifier) {
+	t.Helper()
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := frontend.NewWitness(&cubeCircuit{X: 3, Y: 27}, ecc.BN254.ScalarField())
+	p, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof = &bytes.Buffer{}
+	p.WriteTo(proof)
+	public, _ := w.Public()
+	publicWitness, _ = public.MarshalBinary()
+	hash, _ := common.VerifyingKeyHash(vk)
+
+	holderKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	verifier = models.NewPresentationVerifier(func(models.PresentationHeader) (*ecdsa.PublicKey, error) {
+		return &holderKey.PublicKey, nil
+	})
+	if err := verifier.AddCircuit("cube/v1", vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	return proof, publicWitness, hex.EncodeToString(hash[:]), holderKey, verifier
+}
+
+func TestClient(t *testing.T) {
+	proofBuf, publicWitness, vkHash, holderKey, verifier := cubeSetup(t)
+	srv := httptest.NewServer(server.New(verifier))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := New(srv.URL, Options{})
+
+	res, err := c.Verify(ctx, server.VerifyRequest{Circuit: "cube/v1", Proof: proofBuf.Bytes(), PublicWitness: publicWitness})
+	if err != nil || !res.Valid {
+		t.Fatalf("expected a valid proof, got %+v: %v", res, err)
+	}
+
+	capabilities, err := c.Capabilities(ctx)
+	if err != nil || len(capabilities.Circuits) != 1 || capabilities.Circuits[0].ID != "cube/v1" || capabilities.Limits.MaxBodySize == 0 {
+		t.Fatalf("unexpected capabilities %+v: %v", capabilities, err)
+	}
+
+	// typed claims
+	header := models.PresentationHeader{Circuit: "cube/v1", VKHash: vkHash}
+	payload := models.PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: publicWitness, Claims: map[string]any{"age_over_18": true}}
+	compact, err := models.SignPresentation(header, payload, proofBuf.Bytes(), holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typed, err := NewCircuit[ageClaims](c, "cube/v1").VerifyPresentation(ctx, compact)
+	if err != nil || !typed.Valid || !typed.Claims.AgeOver18 {
+		t.Fatalf("expected a valid presentation with claims, got %+v: %v", typed, err)
+	}
+	if _, err := NewCircuit[ageClaims](c, "other/v1").VerifyPresentation(ctx, compact); err == nil {
+		t.Fatal("expected a presentation of another circuit to be rejected")
+	}
+
+	// problems are returned as such
+	_, err = c.Verify(ctx, server.VerifyRequest{Circuit: "other/v1", Proof: proofBuf.Bytes(), PublicWitness: publicWitness})
+	var p *server.Problem
+	if !errors.As(err, &p) || p.Type != server.ProblemCircuitNotFound {
+		t.Fatalf("expected circuit_not_found, got %v", err)
+	}
+
+	// version mismatches are typed
+	cube := NewCircuit[ageClaims](c, "cube/v1").WithVKHash(vkHash)
+	if res, err := cube.Verify(ctx, proofBuf.Bytes(), publicWitness); err != nil || !res.Valid {
+		t.Fatalf("expected a valid proof of the pinned version, got %+v: %v", res, err)
+	}
+	for name, circuit := range map[string]*Circuit[ageClaims]{
+		"version": NewCircuit[ageClaims](c, "cube/v2"),
+		"vk hash": cube.WithVKHash(strings.Repeat("00", 32)),
+	} {
+		_, err = circuit.Verify(ctx, proofBuf.Bytes(), publicWitness)
+		var versionErr *VersionMismatchError
+		if !errors.As(err, &versionErr) || !errors.As(err, &p) || p.Status != http.StatusConflict {
+			t.Fatalf("%s: expected a version mismatch, got %v", name, err)
+		}
+		if versions := versionErr.Versions(); len(versions) != 1 || versions[0].ID != "cube/v1" || versions[0].VKHash != vkHash {
+			t.Fatalf("%s: expected the served version, got %+v", name, versions)
+		}
+	}
+
+	health, err := c.WaitForConfig(ctx, 10*time.Millisecond, func(h *server.HealthResponse) bool { return h.Status == "ok" })
+	if err != nil || health.Status != "ok" {
+		t.Fatalf("expected a healthy server, got %+v: %v", health, err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.WaitForConfig(waitCtx, 10*time.Millisecond, HasCircuit("other/v1")); err == nil {
+		t.Fatal("expected the wait for an unknown circuit to time out")
+	}
+}
+
+func TestClientChallenge(t *testing.T) {
+	proof, publicWitness, vkHash, holderKey, verifier := cubeSetup(t)
+	api := server.New(verifier)
+	api.ChannelBinding = &server.ChannelBindingConfig{Type: models.ChannelBindingTLSExporter}
+	srv := httptest.NewTLSServer(api)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := New(srv.URL, Options{HTTPClient: srv.Client()})
+	challenge, err := c.Challenge(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge.ChannelBinding != models.ChannelBindingTLSExporter || len(challenge.Binding) != 32 || len(challenge.Value) != models.ChannelNonceSize {
+		t.Fatalf("unexpected challenge %+v", challenge)
+	}
+
+	compact, err := models.SignPresentation(models.PresentationHeader{Circuit: "cube/v1", VKHash: vkHash},
+		models.PresentationPayload{Nonce: challenge.Nonce, IssuedAt: time.Now().Unix(), PublicWitness: publicWitness}, proof.Bytes(), holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the connection of the challenge is kept alive
+	if res, err := c.VerifyPresentation(ctx, compact); err != nil || !res.Valid {
+		t.Fatalf("expected a valid presentation over the same connection, got %+v: %v", res, err)
+	}
+
+	// relayed over another connection
+	relay := New(srv.URL, Options{HTTPClient: &http.Client{Transport: srv.Client().Transport.(*http.Transport).Clone()}})
+	_, err = relay.VerifyPresentation(ctx, compact)
+	var p *server.Problem
+	if !errors.As(err, &p) || p.Type != server.ProblemChannelMismatch {
+		t.Fatalf("expected a channel mismatch, got %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"type":"https://github.com/mynextid/eudi-zk/problems/too_many_requests","title":"Too many requests","status":503}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := New(srv.URL, Options{MinBackoff: time.Millisecond})
+	if health, err := c.Health(ctx); err != nil || health.Status != "ok" || calls.Load() != 3 {
+		t.Fatalf("expected success after 2 retries, got %+v after %d calls: %v", health, calls.Load(), err)
+	}
+
+	calls.Store(0)
+	c = New(srv.URL, Options{MaxRetries: 1, MinBackoff: time.Millisecond})
+	_, err := c.Health(ctx)
+	var p *server.Problem
+	if !errors.As(err, &p) || p.Type != server.ProblemTooManyRequests || calls.Load() != 2 {
+		t.Fatalf("expected too_many_requests after 1 retry, got %v after %d calls", err, calls.Load())
+	}
+
+	// the reload is not retried
+	calls.Store(0)
+	c = New(srv.URL, Options{MinBackoff: time.Millisecond})
+	if _, err := c.Reload(ctx, "admin"); err == nil || calls.Load() != 1 {
+		t.Fatalf("expected the reload to fail once, got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestClientProve(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, _, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	farm := prover.NewFarm(nil)
+	farm.Register("cube/v1", common.NewProver(ccs, pk))
+	srv := httptest.NewServer(farm)
+	defer srv.Close()
+
+	// a self-signed service certificate, its own root
+	serviceKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "prover.example"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &serviceKey.PublicKey, serviceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	w, _ := frontend.NewWitness(&cubeCircuit{X: 3, Y: 27}, ecc.BN254.ScalarField())
+	witness, _ := w.MarshalBinary()
+	ctx := context.Background()
+	c := New(srv.URL, Options{ProverRoots: roots})
+
+	if _, err := c.Prove(ctx, "cube/v1", prover.ProveRequest{Witness: witness}); !errors.Is(err, prover.ErrInvalidAttestation) {
+		t.Fatalf("expected an unattested proof to be rejected, got %v", err)
+	}
+	farm.Attester = &prover.Attester{Key: serviceKey, Chain: []*x509.Certificate{cert}}
+	res, err := c.Prove(ctx, "cube/v1", prover.ProveRequest{Witness: witness})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Attestation == nil || res.Attestation.Circuit != "cube/v1" {
+		t.Fatalf("unexpected attestation %+v", res.Attestation)
+	}
+}
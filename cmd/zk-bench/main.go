@@ -0,0 +1,208 @@
+// Command zk-bench profiles the circuits (constraints, prover time, peak
+// memory, allocations) and writes the samples to a cost manifest (see package cost):
+//
+//	go run ./cmd/zk-bench -out circuits/cost-manifest.json -hardware "16 vCPU, 64GB"
+//
+// An existing manifest is updated, samples with the same input sizes are
+// replaced.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	ct "github.com/mynextid/eudi-zk/circuits/temporal"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/cost"
+	"github.com/mynextid/eudi-zk/datagen"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// fixture returns the circuit template, a satisfying assignment and the input
+// sizes of a sample
+type fixture func(size int) (template, assignment frontend.Circuit, inputSizes map[string]int, err error)
+
+// benchmarks are the profiled circuits; sizes are the sizes passed to the
+// fixture, nil for fixed-size fixtures
+var benchmarks = []struct {
+	circuit string
+	fixture fixture
+	sizes   []int
+}{
+	{"temporal/over18", over18Fixture, []int{0, 512, 1024}},
+	{"eudi-vc/pop", popFixture, []int{0, 2048}},
+}
+
+func main() {
+	out := flag.String("out", "cost-manifest.json", "cost manifest to create or update")
+	hardware := flag.String("hardware", fmt.Sprintf("%s/%s, %d CPU", runtime.GOOS, runtime.GOARCH, runtime.NumCPU()), "reference hardware description")
+	circuits := flag.String("circuits", "", "comma separated circuits to profile (default all)")
+	tasks := flag.Int("tasks", 0, "concurrent solver tasks, bounds the solver buffers (default GOMAXPROCS)")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("zk-bench: ")
+
+	manifest, err := cost.ReadManifest(*out)
+	if errors.Is(err, fs.ErrNotExist) {
+		manifest = &cost.Manifest{}
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	manifest.Hardware = *hardware
+	manifest.GeneratedAt = time.Now().UTC()
+
+	var opts []backend.ProverOption
+	if *tasks > 0 {
+		opts = append(opts, backend.WithSolverOptions(solver.WithNbTasks(*tasks)))
+	}
+
+	selected := map[string]bool{}
+	for _, c := range strings.Split(*circuits, ",") {
+		if c != "" {
+			selected[c] = true
+		}
+	}
+
+	for _, b := range benchmarks {
+		if len(selected) > 0 && !selected[b.circuit] {
+			continue
+		}
+		sizes := b.sizes
+		if sizes == nil {
+			sizes = []int{0}
+		}
+		for _, size := range sizes {
+			sample, err := profile(b.fixture, size, opts...)
+			if err != nil {
+				log.Fatalf("%s: %v", b.circuit, err)
+			}
+			log.Printf("%s %v: %d constraints, prove %v, memory %d MB, allocated %d MB in %d GC cycles", b.circuit, sample.InputSizes, sample.Constraints, sample.ProveTime, sample.Memory>>20, sample.Allocated>>20, sample.GCCycles)
+			manifest.Add(b.circuit, sample)
+		}
+	}
+
+	if err := manifest.WriteFile(*out); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func profile(f fixture, size int, opts ...backend.ProverOption) (cost.Sample, error) {
+	template, assignment, inputSizes, err := f(size)
+	if err != nil {
+		return cost.Sample{}, err
+	}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, template)
+	if err != nil {
+		return cost.Sample{}, err
+	}
+	pk, _, err := groth16.Setup(ccs)
+	if err != nil {
+		return cost.Sample{}, err
+	}
+	return cost.Measure(ccs, pk, assignment, inputSizes, opts...)
+}
+
+// over18Fixture pads the demo PID payload with size bytes
+func over18Fixture(size int) (frontend.Circuit, frontend.Circuit, map[string]int, error) {
+	pid, err := json.Marshal(models.GetDemoPID())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(pid, &payload); err != nil {
+		return nil, nil, nil, err
+	}
+	if size > 0 {
+		payload["_pad"] = strings.Repeat("x", size)
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+
+	birthdate, err := common.FindClaim(payloadJSON, payloadB64, "birthdate")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	minDateOfBirth := "2100-01-01"
+
+	template := &ct.Over18{
+		Payload:        make([]uints.U8, len(payloadB64)),
+		DateB64:        make([]uints.U8, len(birthdate.B64)),
+		MinDateOfBirth: make([]uints.U8, len(minDateOfBirth)),
+	}
+	assignment := &ct.Over18{
+		Payload:         common.StringToU8Array(payloadB64),
+		DateB64:         common.StringToU8Array(birthdate.B64),
+		DateB64Position: birthdate.B64Start,
+		DatePosition:    birthdate.ValuePosition,
+		MinDateOfBirth:  common.StringToU8Array(minDateOfBirth),
+	}
+	return template, assignment, map[string]int{"Payload": len(payloadB64)}, nil
+}
+
+// popFixture issues a certificate of the QTSP profile of at least size bytes
+// and signs a 32 byte challenge
+func popFixture(size int) (frontend.Circuit, frontend.Circuit, map[string]int, error) {
+	gen := datagen.New("zk-bench")
+	ca, err := gen.Certificate("Example QCA", nil, datagen.CertOptions{Profile: datagen.ProfileQTSP, CA: true})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cert, err := gen.Certificate("signer", ca, datagen.CertOptions{Profile: datagen.ProfileQTSP, MinSize: size})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certDER, signerKey := cert.DER, cert.Key
+	pubKeyPos, err := cdl.FindSubjectPublicKeyPosition(certDER)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	challenge, err := common.GenerateRandomBytes(32)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	digest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
+	r, s, err := ecdsa.Sign(rand.Reader, signerKey, digest[:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	circuitTemplate := &cdl.CircuitPoP{
+		CertBytes: make([]uints.U8, len(certDER)),
+		Challenge: make([]uints.U8, len(challenge)),
+	}
+	assignment := &cdl.CircuitPoP{
+		CertBytes:           common.BytesToU8Array(certDER),
+		CertLength:          len(certDER),
+		SubjectPubKeyPos:    pubKeyPos,
+		SignerPubKeyX:       emulated.ValueOf[emulated.P256Fp](signerKey.PublicKey.X),
+		SignerPubKeyY:       emulated.ValueOf[emulated.P256Fp](signerKey.PublicKey.Y),
+		ChallengeSignatureR: emulated.ValueOf[emulated.P256Fr](r),
+		ChallengeSignatureS: emulated.ValueOf[emulated.P256Fr](s),
+		Challenge:           common.BytesToU8Array(challenge),
+	}
+	return circuitTemplate, assignment, map[string]int{"CertBytes": len(certDER), "Challenge": len(challenge)}, nil
+}
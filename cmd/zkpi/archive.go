@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mynextid/eudi-zk/archive"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// anchorFlags are the repeated --anchor INPUT=FILE flags of zkpi archive
+// create: a PEM certificate or public key per trust anchor input
+type anchorFlags []archive.TrustAnchor
+
+func (a *anchorFlags) String() string {
+	var inputs []string
+	for _, anchor := range *a {
+		inputs = append(inputs, anchor.Input)
+	}
+	return strings.Join(inputs, ",")
+}
+
+func (a *anchorFlags) Set(value string) error {
+	input, path, ok := strings.Cut(value, "=")
+	if !ok || input == "" || path == "" {
+		return fmt.Errorf("expected INPUT=FILE, got %q", value)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM block", path)
+	}
+	anchor := archive.TrustAnchor{Input: input}
+	switch block.Type {
+	case "CERTIFICATE":
+		anchor.Certificate = block.Bytes
+	case "PUBLIC KEY":
+		anchor.PublicKey = block.Bytes
+	default:
+		return fmt.Errorf("%s: unexpected PEM block %s", path, block.Type)
+	}
+	*a = append(*a, anchor)
+	return nil
+}
+
+// archiveCreate runs zkpi archive create: the presentation is verified with
+// the pinned keys, then archived with its verifying key, the manifest, the
+// circuit description (--describe), the trust anchors and the holder key.
+func archiveCreate(args []string, w io.Writer) (*archive.Archive, error) {
+	flags := flag.NewFlagSet("zkpi archive create", flag.ContinueOnError)
+	vkDir := flags.String("vk-dir", "keys", "directory of the verifying keys")
+	manifestPath := flags.String("manifest", "", "pinned manifest of the verifying keys (required)")
+	holderKeys := flags.String("holder-keys", "holder-keys", "directory of the holder public keys, <kid>.pem")
+	describe := flags.String("describe", "", "circuit description of zkpi profile --describe, names the public inputs")
+	out := flags.String("out", "", "archive file (default the presentation file with the .zkpa extension)")
+	var anchors anchorFlags
+	flags.Var(&anchors, "anchor", "trust anchor of public inputs, INPUT=FILE.pem with a certificate or a public key (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("expected one presentation file")
+	}
+	if *manifestPath == "" {
+		return nil, fmt.Errorf("--manifest is required")
+	}
+	path := flags.Arg(0)
+	manifestData, err := os.ReadFile(*manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var manifest pinnedManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", *manifestPath, err)
+	}
+	pv, err := pinnedVerifier(manifestData, *vkDir, keyDir(*holderKeys))
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", *manifestPath, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cose := strings.EqualFold(filepath.Ext(path), ".cbor") || strings.EqualFold(filepath.Ext(path), ".cose")
+	var res *models.VerificationResult
+	if cose {
+		res, err = pv.VerifyCOSE(data)
+	} else {
+		data = []byte(strings.TrimSpace(string(data)))
+		res, err = pv.Verify(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var p *models.ZkPresentation
+	if cose {
+		p, err = models.ParsePresentationCOSE(data)
+	} else {
+		p, err = models.ParsePresentation(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	vk, err := os.ReadFile(filepath.Join(*vkDir, manifest.Circuits[res.Circuit].VerifyingKey))
+	if err != nil {
+		return nil, err
+	}
+	a, err := archive.New(res.Circuit, p.Proof, p.Payload.PublicWitness, vk, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	// the manifest is archived with the pinned circuit only
+	pinned, _ := json.Marshal(pinnedManifest{Circuits: map[string]pinnedCircuit{res.Circuit: manifest.Circuits[res.Circuit]}})
+	a.Manifest = pinned
+	a.Presentation = data
+	a.AddAlgorithm(archive.Algorithm{ID: archive.AlgES256, Version: 1})
+	if holderKey, err := keyDir(*holderKeys)(p.Header); err == nil {
+		if a.HolderKey, err = x509.MarshalPKIXPublicKey(holderKey); err != nil {
+			return nil, err
+		}
+	}
+	if *describe != "" {
+		descData, err := os.ReadFile(*describe)
+		if err != nil {
+			return nil, err
+		}
+		a.Schema = &archive.Schema{}
+		if err := json.Unmarshal(descData, a.Schema); err != nil {
+			return nil, fmt.Errorf("%s: %w", *describe, err)
+		}
+	}
+	if len(anchors) > 0 {
+		if a.Schema == nil {
+			return nil, fmt.Errorf("--anchor requires the circuit description (--describe)")
+		}
+		a.TrustAnchors = anchors
+		a.AddAlgorithm(archive.Algorithm{ID: archive.AlgP256Limbs, Version: 1})
+	}
+
+	// an archive that does not verify now will not later
+	if _, err := archive.Verify(a); err != nil {
+		return nil, err
+	}
+	encoded, err := a.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(path, filepath.Ext(path)) + ".zkpa"
+	}
+	if err := os.WriteFile(*out, encoded, 0o644); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(w, "%s: archived %s (%d bytes)\n", *out, a.Circuit, len(encoded))
+	return a, nil
+}
+
+// archiveVerify runs zkpi archive verify: every archive file is evaluated
+// on its own, an archive of an unknown format version or algorithm is
+// reported and the next file evaluated. An error is returned when one of them
+// does not verify.
+func archiveVerify(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("zkpi archive verify", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("no archive file")
+	}
+	failed := 0
+	for _, file := range flags.Args() {
+		res, err := verifyArchiveFile(file)
+		if err != nil {
+			failed++
+			status := "invalid"
+			switch {
+			case errors.Is(err, archive.ErrUnsupportedVersion), errors.Is(err, archive.ErrUnsupportedAlgorithm):
+				status = "unsupported"
+			case errors.Is(err, archive.ErrProofFailed):
+				status = "proof failed"
+			}
+			fmt.Fprintf(w, "%s: %s: %v\n", file, status, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s: valid %s, vk %s, archived %s", file, res.Circuit, res.VKHash, res.CreatedAt.Format(time.RFC3339))
+		if len(res.Anchors) > 0 {
+			fmt.Fprintf(w, ", anchors %s", strings.Join(res.Anchors, ","))
+		}
+		if res.SignatureVerified {
+			fmt.Fprint(w, ", holder signature verified")
+		}
+		fmt.Fprintln(w)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d archives do not verify", failed, flags.NArg())
+	}
+	return nil
+}
+
+func verifyArchiveFile(path string) (*archive.Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	a, err := archive.Open(data)
+	if err != nil {
+		return nil, err
+	}
+	return archive.Verify(a)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+func TestArchiveCommands(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"keys", "holders"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vkBuf bytes.Buffer
+	vk.WriteTo(&vkBuf)
+	os.WriteFile(filepath.Join(root, "keys", "cube.vk"), vkBuf.Bytes(), 0o644)
+	vkHash, _ := common.VerifyingKeyHash(vk)
+	manifest := filepath.Join(root, "pinned.json")
+	data, _ := json.Marshal(pinnedManifest{Circuits: map[string]pinnedCircuit{"cube/v1": {VerifyingKey: "cube.vk", VKHash: hex.EncodeToString(vkHash[:])}}})
+	os.WriteFile(manifest, data, 0o644)
+
+	holderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	holderDER, _ := x509.MarshalPKIXPublicKey(&holderKey.PublicKey)
+	writePEM(t, filepath.Join(root, "holders", "holder-1.pem"), "PUBLIC KEY", holderDER)
+
+	w, _ := frontend.NewWitness(&cubeCircuit{X: 3, Y: 27}, ecc.BN254.ScalarField())
+	proof, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proofBuf bytes.Buffer
+	proof.WriteTo(&proofBuf)
+	public, _ := w.Public()
+	publicWitness, _ := public.MarshalBinary()
+	header := models.PresentationHeader{Kid: "holder-1", Circuit: "cube/v1", VKHash: hex.EncodeToString(vkHash[:])}
+	compact, err := models.SignPresentation(header, models.PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: publicWitness}, proofBuf.Bytes(), holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presentation := filepath.Join(root, "vp.zkp")
+	os.WriteFile(presentation, []byte(compact), 0o644)
+
+	var out strings.Builder
+	a, err := archiveCreate([]string{"--manifest", manifest, "--vk-dir", filepath.Join(root, "keys"), "--holder-keys", filepath.Join(root, "holders"), presentation}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.HolderKey == nil || a.Manifest == nil {
+		t.Fatalf("expected the holder key and the manifest in the archive")
+	}
+	archived := filepath.Join(root, "vp.zkpa")
+
+	// an archive of a later format version is reported, the others evaluated
+	archivedData, _ := os.ReadFile(archived)
+	var raw map[string]any
+	cbor.Unmarshal(archivedData, &raw)
+	raw["version"] = 2
+	later, _ := cbor.Marshal(raw)
+	laterPath := filepath.Join(root, "later.zkpa")
+	os.WriteFile(laterPath, later, 0o644)
+
+	out.Reset()
+	if err := archiveVerify([]string{archived}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "holder signature verified") {
+		t.Fatalf("expected a verified holder signature: %s", out.String())
+	}
+	out.Reset()
+	err = archiveVerify([]string{laterPath, archived}, &out)
+	t.Logf("\n%s", out.String())
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Fatalf("expected the later archive to be refused, got %v", err)
+	}
+	if !strings.Contains(out.String(), "later.zkpa: unsupported") || !strings.Contains(out.String(), "vp.zkpa: valid cube/v1") {
+		t.Fatalf("unexpected report: %s", out.String())
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mynextid/eudi-zk/artifact"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/wallet"
+)
+
+// Audit statuses of a presentation
+const (
+	statusValid   = "valid"
+	statusExpired = "expired"
+	statusInvalid = "invalid"
+)
+
+// pinnedManifest pins the verifying keys of the audited circuits: a key of
+// --vk-dir is only used when its hash is the pinned one
+//
+//	{"circuits": {"eudi-vc/pop/v1": {"verifying_key": "pop.vk", "vk_hash": "9f86..."}}}
+type pinnedManifest struct {
+	Circuits map[string]pinnedCircuit `json:"circuits"`
+}
+
+type pinnedCircuit struct {
+	// VerifyingKey is the file of the key in --vk-dir
+	VerifyingKey string `json:"verifying_key"`
+	// VKHash is the hex SHA-256 of the key (common.VerifyingKeyHash)
+	VKHash string `json:"vk_hash"`
+	// Template is the circuit of zkpi profile the key was set up for, with
+	// the input sizes of Sizes (the zkpi profile defaults when nil), optional:
+	// it locates the trust anchor inputs of a policy
+	Template string        `json:"template,omitempty"`
+	Sizes    *profileSizes `json:"sizes,omitempty"`
+}
+
+// auditRecord is a row of the report
+type auditRecord struct {
+	File     string
+	Circuit  string
+	Kid      string
+	VKHash   string
+	IssuedAt int64
+	Status   string
+	// Class is the failure class, see classify
+	Class  string
+	Detail string
+}
+
+var reportHeader = []string{"file", "circuit", "kid", "vk_hash", "issued_at", "status", "class", "detail"}
+
+func (r auditRecord) row() []string {
+	issuedAt := ""
+	if r.IssuedAt != 0 {
+		issuedAt = time.Unix(r.IssuedAt, 0).UTC().Format(time.RFC3339)
+	}
+	return []string{r.File, r.Circuit, r.Kid, r.VKHash, issuedAt, r.Status, r.Class, r.Detail}
+}
+
+// auditPolicy is the expiration policy of the audit: presentations issued
+// after AsOf, or more than MaxAge before it, are expired
+type auditPolicy struct {
+	AsOf   time.Time
+	MaxAge time.Duration
+}
+
+func (p auditPolicy) check(issuedAt int64) error {
+	iat := time.Unix(issuedAt, 0)
+	if iat.After(p.AsOf) {
+		return fmt.Errorf("issued at %s, after the audit date", iat.UTC().Format(time.RFC3339))
+	}
+	if p.MaxAge > 0 && p.AsOf.Sub(iat) > p.MaxAge {
+		return fmt.Errorf("issued at %s, more than %s before the audit date", iat.UTC().Format(time.RFC3339), p.MaxAge)
+	}
+	return nil
+}
+
+// auditSummary is the signed summary of a report, a compact JWS (ES256)
+type auditSummary struct {
+	AsOf        time.Time `json:"as_of"`
+	MaxAge      string    `json:"max_age,omitempty"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// ManifestSHA256 and ReportSHA256 bind the pinned manifest and the CSV
+	// report, hex SHA-256 of the files
+	ManifestSHA256 string `json:"manifest_sha256"`
+	ReportSHA256   string `json:"report_sha256"`
+	Total          int    `json:"total"`
+	Valid          int    `json:"valid"`
+	Expired        int    `json:"expired"`
+	Invalid        int    `json:"invalid"`
+	// Classes counts the failures per class
+	Classes map[string]int `json:"classes,omitempty"`
+}
+
+// auditVerify runs zkpi audit verify: every presentation of --dir (compact
+// serialization, or COSE for .cbor and .cose files) is verified with the keys
+// of --vk-dir pinned by --manifest and the holder keys of --holder-keys, then
+// checked against the expiration policy as of --as-of. The report lists one
+// presentation per row; the summary, signed with --sign-key, binds the
+// report and the manifest.
+func auditVerify(args []string) (*auditSummary, error) {
+	flags := flag.NewFlagSet("zkpi audit verify", flag.ContinueOnError)
+	dir := flags.String("dir", "presentations", "directory of the presentations")
+	vkDir := flags.String("vk-dir", "keys", "directory of the verifying keys")
+	manifestPath := flags.String("manifest", "", "pinned manifest of the verifying keys (required)")
+	holderKeys := flags.String("holder-keys", "holder-keys", "directory of the holder public keys, <kid>.pem")
+	asOf := flags.String("as-of", "", "audit date, RFC 3339 or YYYY-MM-DD (default now)")
+	maxAge := flags.Duration("max-age", 0, "maximum age of a presentation at the audit date (default no limit)")
+	reportPath := flags.String("report", "report.csv", "CSV report")
+	summaryPath := flags.String("summary", "", "signed summary (default <report>.jws)")
+	signKey := flags.String("sign-key", "", "PEM EC private key signing the summary (required)")
+	workers := flags.Int("workers", runtime.NumCPU(), "parallel verifications")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if *manifestPath == "" || *signKey == "" {
+		return nil, fmt.Errorf("--manifest and --sign-key are required")
+	}
+	if *summaryPath == "" {
+		*summaryPath = *reportPath + ".jws"
+	}
+
+	policy := auditPolicy{AsOf: time.Now(), MaxAge: *maxAge}
+	if *asOf != "" {
+		var err error
+		if policy.AsOf, err = parseDate(*asOf); err != nil {
+			return nil, err
+		}
+	}
+	key, err := readPrivateKey(*signKey)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+
+	manifestData, err := os.ReadFile(*manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := pinnedVerifier(manifestData, *vkDir, keyDir(*holderKeys))
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", *manifestPath, err)
+	}
+
+	files, err := presentationFiles(*dir)
+	if err != nil {
+		return nil, err
+	}
+	records := auditFiles(verifier, policy, *dir, files, *workers)
+
+	report, err := encodeReport(records)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(*reportPath, report, 0o644); err != nil {
+		return nil, err
+	}
+
+	summary := summarize(records, policy)
+	summary.ManifestSHA256 = sha256Hex(manifestData)
+	summary.ReportSHA256 = sha256Hex(report)
+	jws, err := signSummary(summary, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(*summaryPath, []byte(jws+"\n"), 0o644); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// pinnedVerifier registers the verifying keys of the manifest, after checking
+// their hashes
+func pinnedVerifier(manifestData []byte, vkDir string, resolveKey func(models.PresentationHeader) (*ecdsa.PublicKey, error)) (*models.PresentationVerifier, error) {
+	var manifest pinnedManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, err
+	}
+	if len(manifest.Circuits) == 0 {
+		return nil, fmt.Errorf("no pinned circuits")
+	}
+
+	store := artifact.NewFSStore(vkDir)
+	verifier := models.NewPresentationVerifier(resolveKey)
+	for id, c := range manifest.Circuits {
+		vk, err := common.LoadVerifyingKeyFromStore(context.Background(), store, c.VerifyingKey)
+		if err != nil {
+			return nil, fmt.Errorf("circuit %q: %w", id, err)
+		}
+		vkHash, err := common.VerifyingKeyHash(vk)
+		if err != nil {
+			return nil, fmt.Errorf("circuit %q: %w", id, err)
+		}
+		if !strings.EqualFold(hex.EncodeToString(vkHash[:]), c.VKHash) {
+			return nil, fmt.Errorf("circuit %q: verifying key %s does not match the pinned hash", id, c.VerifyingKey)
+		}
+		if err := verifier.AddCircuit(id, vk, nil); err != nil {
+			return nil, fmt.Errorf("circuit %q: %w", id, err)
+		}
+	}
+	return verifier, nil
+}
+
+// presentationFiles lists the files of dir, recursively, without the hidden
+// ones
+func presentationFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	slices.Sort(files)
+	return files, err
+}
+
+// auditFiles verifies the files with workers goroutines, the records are in
+// the order of files
+func auditFiles(verifier *models.PresentationVerifier, policy auditPolicy, dir string, files []string, workers int) []auditRecord {
+	records := make([]auditRecord, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				records[i] = auditFile(verifier, policy, dir, files[i])
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return records
+}
+
+// auditFile verifies a presentation and checks the expiration policy
+func auditFile(verifier *models.PresentationVerifier, policy auditPolicy, dir, file string) auditRecord {
+	record := auditRecord{File: filepath.ToSlash(file), Status: statusInvalid}
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		record.Class, record.Detail = "unreadable", err.Error()
+		return record
+	}
+
+	cose := strings.EqualFold(filepath.Ext(file), ".cbor") || strings.EqualFold(filepath.Ext(file), ".cose")
+	var p *models.ZkPresentation
+	if cose {
+		p, err = models.ParsePresentationCOSE(data)
+	} else {
+		p, err = models.ParsePresentation(string(data))
+	}
+	if err != nil {
+		record.Class, record.Detail = classify(err), err.Error()
+		return record
+	}
+	record.Circuit, record.Kid, record.VKHash, record.IssuedAt = p.Header.Circuit, p.Header.Kid, p.Header.VKHash, p.Payload.IssuedAt
+
+	// the presentation is verified as of its issuance, the audit policy
+	// bounds its age: an archived presentation is past its exp
+	opts := models.VerificationOptions{AsOf: time.Unix(p.Payload.IssuedAt, 0)}
+	if cose {
+		_, err = verifier.VerifyCOSEWithOptions(data, opts)
+	} else {
+		_, err = verifier.VerifyWithOptions(string(data), opts)
+	}
+	if err != nil {
+		record.Class, record.Detail = classify(err), err.Error()
+		return record
+	}
+	if err := policy.check(p.Payload.IssuedAt); err != nil {
+		record.Status, record.Class, record.Detail = statusExpired, "expired", err.Error()
+		return record
+	}
+	record.Status = statusValid
+	return record
+}
+
+// classify returns the failure class of a verification error, the problem
+// types of package server
+func classify(err error) string {
+	var fieldErr *models.FieldError
+	switch {
+	case errors.Is(err, models.ErrUnknownCircuit):
+		return "circuit_not_found"
+	case errors.As(err, &fieldErr), errors.Is(err, models.ErrInvalidWitness):
+		return "witness_invalid"
+	case errors.Is(err, models.ErrProofFailed):
+		return "proof_failed"
+	}
+	return "presentation_invalid"
+}
+
+func encodeReport(records []auditRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(reportHeader)
+	for _, r := range records {
+		w.Write(r.row())
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func summarize(records []auditRecord, policy auditPolicy) *auditSummary {
+	s := &auditSummary{AsOf: policy.AsOf.UTC(), GeneratedAt: time.Now().UTC(), Total: len(records), Classes: map[string]int{}}
+	if policy.MaxAge > 0 {
+		s.MaxAge = policy.MaxAge.String()
+	}
+	for _, r := range records {
+		switch r.Status {
+		case statusValid:
+			s.Valid++
+		case statusExpired:
+			s.Expired++
+		default:
+			s.Invalid++
+		}
+		if r.Class != "" {
+			s.Classes[r.Class]++
+		}
+	}
+	return s
+}
+
+// signSummary returns the summary as a compact JWS signed with ES256
+func signSummary(summary *auditSummary, key wallet.KeyHandle) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "typ": "zkpi-audit+jwt"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := key.SignChallenge(context.Background(), []byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign the summary: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature.Bytes()), nil
+}
+
+// parseDate parses an RFC 3339 time or a date, the end of that day (UTC)
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid audit date %q", value)
+	}
+	return day.Add(24*time.Hour - time.Second), nil
+}
+
+// readPrivateKey reads a PEM EC private key, SEC 1 or PKCS #8, into a key
+// handle the caller destroys; the file contents are wiped
+func readPrivateKey(path string) (*wallet.SoftwareKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(data)
+	key, err := wallet.ParseSoftwareKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// keyDir resolves the holder keys from the PEM files of dir, named after the
+// kid of the presentation header
+func keyDir(dir string) func(header models.PresentationHeader) (*ecdsa.PublicKey, error) {
+	return func(header models.PresentationHeader) (*ecdsa.PublicKey, error) {
+		if header.Kid == "" || header.Kid != filepath.Base(header.Kid) || strings.HasPrefix(header.Kid, ".") {
+			return nil, fmt.Errorf("invalid kid %q", header.Kid)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, header.Kid+".pem"))
+		if err != nil {
+			return nil, fmt.Errorf("unknown holder key %q", header.Kid)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("holder key %q: no PEM block", header.Kid)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("holder key %q: %w", header.Kid, err)
+		}
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("holder key %q is not an ECDSA key", header.Kid)
+		}
+		return ecKey, nil
+	}
+}
+
+func sha256Hex(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
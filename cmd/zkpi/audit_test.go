@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// cubeCircuit proves knowledge of X with X^3 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditVerify(t *testing.T) {
+	root := t.TempDir()
+	dirs := map[string]string{}
+	for _, name := range []string{"presentations", "keys", "holders"} {
+		dirs[name] = filepath.Join(root, name)
+		if err := os.Mkdir(dirs[name], 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// circuit, pinned verifying key
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vkBuf bytes.Buffer
+	vk.WriteTo(&vkBuf)
+	if err := os.WriteFile(filepath.Join(dirs["keys"], "cube.vk"), vkBuf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	vkHash, err := common.VerifyingKeyHash(vk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeManifest := func(hash string) string {
+		path := filepath.Join(root, "pinned.json")
+		data, _ := json.Marshal(pinnedManifest{Circuits: map[string]pinnedCircuit{"cube/v1": {VerifyingKey: "cube.vk", VKHash: hash}}})
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	manifest := writeManifest(hex.EncodeToString(vkHash[:]))
+
+	// holder and auditor keys
+	holderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	holderDER, _ := x509.MarshalPKIXPublicKey(&holderKey.PublicKey)
+	writePEM(t, filepath.Join(dirs["holders"], "holder-1.pem"), "PUBLIC KEY", holderDER)
+	auditorKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	auditorDER, _ := x509.MarshalECPrivateKey(auditorKey)
+	signKey := filepath.Join(root, "auditor.pem")
+	writePEM(t, signKey, "EC PRIVATE KEY", auditorDER)
+
+	// presentations
+	w, err := frontend.NewWitness(&cubeCircuit{X: 3, Y: 27}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proofBuf bytes.Buffer
+	proof.WriteTo(&proofBuf)
+	public, _ := w.Public()
+	publicWitness, _ := public.MarshalBinary()
+
+	asOf := time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)
+	header := models.PresentationHeader{Kid: "holder-1", Circuit: "cube/v1", VKHash: hex.EncodeToString(vkHash[:])}
+	present := func(name string, header models.PresentationHeader, issuedAt time.Time) string {
+		compact, err := models.SignPresentation(header, models.PresentationPayload{IssuedAt: issuedAt.Unix(), PublicWitness: publicWitness}, proofBuf.Bytes(), holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dirs["presentations"], name), []byte(compact), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+	present("a-valid.zkp", header, asOf.Add(-24*time.Hour))
+	present("b-old.zkp", header, asOf.Add(-400*24*time.Hour))
+	present("c-later.zkp", header, asOf.Add(48*time.Hour))
+	other := header
+	other.Circuit = "other/v1"
+	present("d-circuit.zkp", other, asOf.Add(-time.Hour))
+	compact := present("e-tampered.zkp", header, asOf.Add(-time.Hour))
+	parts := strings.Split(compact, ".")
+	parts[3] = parts[3][:len(parts[3])-4] + "AAAA"
+	os.WriteFile(filepath.Join(dirs["presentations"], "e-tampered.zkp"), []byte(strings.Join(parts, ".")), 0o644)
+	os.WriteFile(filepath.Join(dirs["presentations"], ".hidden"), []byte("ignored"), 0o644)
+
+	report := filepath.Join(root, "report.csv")
+	args := []string{
+		"--dir", dirs["presentations"], "--vk-dir", dirs["keys"], "--manifest", manifest,
+		"--holder-keys", dirs["holders"], "--as-of", "2026-06-29", "--max-age", "8760h",
+		"--report", report, "--sign-key", signKey, "--workers", "3",
+	}
+	summary, err := auditVerify(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 5 || summary.Valid != 1 || summary.Expired != 2 || summary.Invalid != 2 || summary.Classes["circuit_not_found"] != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	// report rows in file order
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]string{{"a-valid.zkp", "valid"}, {"b-old.zkp", "expired"}, {"c-later.zkp", "expired"}, {"d-circuit.zkp", "invalid"}, {"e-tampered.zkp", "invalid"}}
+	if len(rows) != len(expected)+1 {
+		t.Fatalf("expected %d rows, got %d", len(expected)+1, len(rows))
+	}
+	for i, e := range expected {
+		if rows[i+1][0] != e[0] || rows[i+1][5] != e[1] {
+			t.Errorf("row %d: expected %v, got %v", i+1, e, rows[i+1])
+		}
+	}
+
+	// signed summary, bound to the report
+	jws, err := os.ReadFile(report + ".jws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwsParts := strings.Split(strings.TrimSpace(string(jws)), ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(jwsParts[2])
+	digest := sha256.Sum256([]byte(jwsParts[0] + "." + jwsParts[1]))
+	if !ecdsa.Verify(&auditorKey.PublicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		t.Fatal("invalid summary signature")
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jwsParts[1])
+	var signed auditSummary
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		t.Fatal(err)
+	}
+	if signed.ReportSHA256 != sha256Hex(data) || signed.Valid != 1 {
+		t.Fatalf("summary does not match the report: %+v", signed)
+	}
+
+	// a verifying key that is not the pinned one
+	writeManifest(strings.Repeat("00", 32))
+	if _, err := auditVerify(args); err == nil || !strings.Contains(err.Error(), "pinned hash") {
+		t.Fatalf("expected a pinned hash mismatch, got %v", err)
+	}
+}
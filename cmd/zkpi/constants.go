@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/mynextid/eudi-zk/circuitkit"
+	"gopkg.in/yaml.v3"
+)
+
+// constantsConfig is the configuration of zkpi constants generate, YAML or
+// JSON; each constant has one value:
+//
+//	circuit: pid-nationality/v1
+//	constants:
+//	  - name: jws.protected
+//	    string: eyJhbGciOiJFUzI1NiIsInR5cCI6InZjK3NkLWp3dCJ9
+//	  - name: jws.issuer        # jws.issuer_x and jws.issuer_y
+//	    key: anchors/issuer.pem
+//	  - name: cert.oid
+//	    hex: 2a8648ce3d030107
+//	  - name: claim.age.threshold
+//	    int: 18
+type constantsConfig struct {
+	Circuit   string           `yaml:"circuit"`
+	Constants []constantConfig `yaml:"constants"`
+}
+
+type constantConfig struct {
+	Name   string  `yaml:"name"`
+	String *string `yaml:"string"`
+	Hex    *string `yaml:"hex"`
+	Int    *string `yaml:"int"` // decimal
+	// Key is a PEM P-256 public key or certificate, relative to the
+	// configuration: the constants <name>_x and <name>_y
+	Key *string `yaml:"key"`
+}
+
+// loadConstants reads the constants of the configuration
+func loadConstants(path string) (*constantsConfig, []circuitkit.Constant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var config constantsConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&config); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var constants []circuitkit.Constant
+	for i, c := range config.Constants {
+		values := 0
+		for _, set := range []bool{c.String != nil, c.Hex != nil, c.Int != nil, c.Key != nil} {
+			if set {
+				values++
+			}
+		}
+		if c.Name == "" || values != 1 {
+			return nil, nil, fmt.Errorf("%s: constants[%d]: expected a name and one of string, hex, int or key", path, i)
+		}
+		switch {
+		case c.String != nil:
+			constants = append(constants, circuitkit.Constant{Name: c.Name, Value: []byte(*c.String)})
+		case c.Hex != nil:
+			value, err := hex.DecodeString(*c.Hex)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: constant %q: %w", path, c.Name, err)
+			}
+			constants = append(constants, circuitkit.Constant{Name: c.Name, Value: value})
+		case c.Int != nil:
+			value, ok := new(big.Int).SetString(*c.Int, 10)
+			if !ok || value.Sign() < 0 {
+				return nil, nil, fmt.Errorf("%s: constant %q: invalid integer %q", path, c.Name, *c.Int)
+			}
+			constants = append(constants, circuitkit.Constant{Name: c.Name, Value: value.Bytes()})
+		case c.Key != nil:
+			keyPath := *c.Key
+			if !filepath.IsAbs(keyPath) {
+				keyPath = filepath.Join(filepath.Dir(path), keyPath)
+			}
+			key, err := readP256Key(keyPath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: constant %q: %w", path, c.Name, err)
+			}
+			constants = append(constants,
+				circuitkit.Constant{Name: c.Name + "_x", Value: key.X.Bytes()},
+				circuitkit.Constant{Name: c.Name + "_y", Value: key.Y.Bytes()})
+		}
+	}
+	return &config, constants, nil
+}
+
+// readP256Key reads a PEM P-256 public key or the key of a PEM certificate
+func readP256Key(path string) (*ecdsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	var key any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	case "PUBLIC KEY":
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s: unexpected PEM block %s", path, block.Type)
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: not a P-256 key", path)
+	}
+	return ecKey, nil
+}
+
+// constantsGenerate runs zkpi constants generate: the constants of --config
+// are emitted as a Go variable for circuitkit.Builder.WithConstants, so the
+// values baked in a circuit are reviewed and versioned with its code.
+func constantsGenerate(args []string, w io.Writer) ([]circuitkit.Constant, error) {
+	flags := flag.NewFlagSet("zkpi constants generate", flag.ContinueOnError)
+	configPath := flags.String("config", "", "constants configuration, YAML or JSON (required)")
+	pkg := flags.String("package", "", "package of the generated file (required)")
+	name := flags.String("var", "Constants", "name of the generated variable")
+	out := flags.String("out", "", "generated Go file (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if *configPath == "" || *pkg == "" {
+		return nil, fmt.Errorf("--config and --package are required")
+	}
+	config, constants, err := loadConstants(*configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by zkpi constants generate from %s; DO NOT EDIT.\n\n", filepath.Base(*configPath))
+	fmt.Fprintf(&src, "package %s\n\nimport \"github.com/mynextid/eudi-zk/circuitkit\"\n\n", *pkg)
+	if config.Circuit != "" {
+		fmt.Fprintf(&src, "// %s are the compile-time constants of %s\n", *name, config.Circuit)
+	} else {
+		fmt.Fprintf(&src, "// %s are compile-time circuit constants\n", *name)
+	}
+	fmt.Fprintf(&src, "var %s = []circuitkit.Constant{\n", *name)
+	for _, c := range constants {
+		fmt.Fprintf(&src, "\t{Name: %q, Value: %#v},\n", c.Name, c.Value)
+	}
+	fmt.Fprintln(&src, "}")
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if *out == "" {
+		_, err = w.Write(formatted)
+		return constants, err
+	}
+	if err := os.WriteFile(*out, formatted, 0o644); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(w, "%s: %d constants\n", *out, len(constants))
+	return constants, nil
+}
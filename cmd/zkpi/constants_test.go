@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConstantsGenerate(t *testing.T) {
+	root := t.TempDir()
+	issuer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&issuer.PublicKey)
+	writePEM(t, filepath.Join(root, "issuer.pem"), "PUBLIC KEY", der)
+	config := filepath.Join(root, "constants.yaml")
+	os.WriteFile(config, []byte(`circuit: pid-nationality/v1
+constants:
+  - name: jws.protected
+    string: eyJhbGciOiJFUzI1NiJ9
+  - name: jws.issuer
+    key: issuer.pem
+  - name: cert.oid
+    hex: 2a8648ce3d030107
+  - name: claim.age.threshold
+    int: 18
+`), 0o644)
+
+	var out strings.Builder
+	constants, err := constantsGenerate([]string{"--config", config, "--package", "pid"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(constants) != 5 || constants[1].Name != "jws.issuer_x" || constants[1].Value[0] != issuer.X.Bytes()[0] || constants[4].Value[0] != 18 {
+		t.Fatalf("unexpected constants %+v", constants)
+	}
+	src := out.String()
+	if _, err := parser.ParseFile(token.NewFileSet(), "constants_gen.go", src, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+	if !strings.Contains(src, "// Constants are the compile-time constants of pid-nationality/v1") || !strings.Contains(src, `Name: "jws.issuer_y"`) {
+		t.Fatalf("unexpected generated code\n%s", src)
+	}
+
+	os.WriteFile(config, []byte("constants:\n  - name: jws.protected\n    string: e30\n    hex: 7b7d\n"), 0o644)
+	if _, err := constantsGenerate([]string{"--config", config, "--package", "pid"}, &out); err == nil {
+		t.Fatal("expected an error for a constant with two values")
+	}
+}
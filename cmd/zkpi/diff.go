@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+	"github.com/mynextid/eudi-zk/artifact"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// descriptionFile is the circuit description written next to the compiled
+// artifacts by zkpi profile --describe
+const descriptionFile = "circuit.json"
+
+// circuitDescription describes what the compiled artifacts do not: the names
+// of the public inputs and the constraints per gadget
+type circuitDescription struct {
+	Circuit      string                    `json:"circuit"`
+	PublicInputs []publicInput             `json:"public_inputs"`
+	Profile      *common.ConstraintProfile `json:"profile,omitempty"`
+}
+
+// publicInput is a field of the public witness: the leaves of an array
+// (Digest_0_Val, Digest_1_Val, ...) are one input of Size elements
+type publicInput struct {
+	Name string `json:"name"`
+	// Offset is the index of the first element in the public witness
+	Offset int `json:"offset"`
+	Size   int `json:"size"`
+}
+
+// arrayLeaf matches the leaves of the elements of an array field
+var arrayLeaf = regexp.MustCompile(`^(.+?)_[0-9]+(_Val)?$`)
+
+// describeCircuit lists the public inputs of the circuit in the order of the
+// public witness and profiles its constraints
+func describeCircuit(name string, circuit frontend.Circuit) (*circuitDescription, error) {
+	d := &circuitDescription{Circuit: name}
+	nbPublic := 0
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		field := leaf.FullName()
+		if m := arrayLeaf.FindStringSubmatch(field); m != nil {
+			field = m[1]
+		}
+		if n := len(d.PublicInputs); n > 0 && d.PublicInputs[n-1].Name == field {
+			d.PublicInputs[n-1].Size++
+		} else {
+			d.PublicInputs = append(d.PublicInputs, publicInput{Name: field, Offset: nbPublic, Size: 1})
+		}
+		nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.Profile, err = common.ProfileConstraints(circuit); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// circuitArtifacts are the artifacts of a circuit version: the compiled/
+// directory of InitCircuit, with the description when there is one
+type circuitArtifacts struct {
+	Dir         string
+	VKHash      string // hex
+	NbPublic    int
+	Constraints int // 0 without circuit.ccs
+	Description *circuitDescription
+}
+
+// loadArtifacts reads the verifying key, the constraint system and the
+// description of dir; only the verifying key is required
+func loadArtifacts(dir string) (*circuitArtifacts, error) {
+	vk, err := common.LoadVerifyingKeyFromStore(context.Background(), artifact.NewFSStore(dir), common.ArtifactVerifyingKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	vkHash, err := common.VerifyingKeyHash(vk)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	a := &circuitArtifacts{Dir: dir, VKHash: hex.EncodeToString(vkHash[:]), NbPublic: vk.NbPublicWitness()}
+
+	if f, err := os.Open(filepath.Join(dir, common.ArtifactCCS)); err == nil {
+		defer f.Close()
+		ccs := groth16.NewCS(ecc.BN254)
+		if _, err := ccs.ReadFrom(f); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		a.Constraints = ccs.GetNbConstraints()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, descriptionFile))
+	switch {
+	case err == nil:
+		a.Description = &circuitDescription{}
+		if err := json.Unmarshal(data, a.Description); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(dir, descriptionFile), err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	return a, nil
+}
+
+// inputChange is a public input present in both versions at another offset
+// or with another size
+type inputChange struct {
+	Name               string
+	OldOffset, OldSize int
+	NewOffset, NewSize int
+}
+
+// gadgetDelta is the change of the constraints of a gadget
+type gadgetDelta struct {
+	Gadget   string
+	Old, New int
+}
+
+// circuitDiff is the report of zkpi circuit diff
+type circuitDiff struct {
+	Old, New *circuitArtifacts
+	// Added, Removed and Changed are only set when both versions have a
+	// description
+	Added, Removed []publicInput
+	Changed        []inputChange
+	Gadgets        []gadgetDelta
+}
+
+// SameKey reports whether the verifying key is unchanged: existing
+// presentations carry the hash of the key that proved them
+func (d *circuitDiff) SameKey() bool {
+	return d.Old.VKHash == d.New.VKHash
+}
+
+// SameInputs reports whether the public witness keeps its layout, so the
+// decoders of the public inputs registered on the verifier still apply
+func (d *circuitDiff) SameInputs() bool {
+	if d.Old.Description == nil || d.New.Description == nil {
+		return d.Old.NbPublic == d.New.NbPublic
+	}
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// diffArtifacts compares two versions of a circuit
+func diffArtifacts(old, new *circuitArtifacts) *circuitDiff {
+	d := &circuitDiff{Old: old, New: new}
+	if old.Description == nil || new.Description == nil {
+		return d
+	}
+
+	oldInputs := map[string]publicInput{}
+	for _, in := range old.Description.PublicInputs {
+		oldInputs[in.Name] = in
+	}
+	newInputs := map[string]publicInput{}
+	for _, in := range new.Description.PublicInputs {
+		newInputs[in.Name] = in
+		o, ok := oldInputs[in.Name]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, in)
+		case o.Offset != in.Offset || o.Size != in.Size:
+			d.Changed = append(d.Changed, inputChange{Name: in.Name, OldOffset: o.Offset, OldSize: o.Size, NewOffset: in.Offset, NewSize: in.Size})
+		}
+	}
+	for _, in := range old.Description.PublicInputs {
+		if _, ok := newInputs[in.Name]; !ok {
+			d.Removed = append(d.Removed, in)
+		}
+	}
+
+	if old.Description.Profile != nil && new.Description.Profile != nil {
+		gadgets := map[string]*gadgetDelta{}
+		delta := func(gadget string) *gadgetDelta {
+			if gadgets[gadget] == nil {
+				gadgets[gadget] = &gadgetDelta{Gadget: gadget}
+			}
+			return gadgets[gadget]
+		}
+		for _, g := range old.Description.Profile.Gadgets {
+			delta(g.Gadget).Old = g.Constraints
+		}
+		for _, g := range new.Description.Profile.Gadgets {
+			delta(g.Gadget).New = g.Constraints
+		}
+		for _, g := range gadgets {
+			d.Gadgets = append(d.Gadgets, *g)
+		}
+		// largest changes first
+		slices.SortFunc(d.Gadgets, func(a, b gadgetDelta) int {
+			da, db := abs(a.New-a.Old), abs(b.New-b.Old)
+			if da != db {
+				return db - da
+			}
+			return strings.Compare(a.Gadget, b.Gadget)
+		})
+	}
+	return d
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// WriteTo writes the report
+func (d *circuitDiff) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "verifying key: %s -> %s\n", d.Old.VKHash, d.New.VKHash)
+	if d.Old.Constraints != 0 && d.New.Constraints != 0 {
+		fmt.Fprintf(&sb, "constraints:   %d -> %d (%+d)\n", d.Old.Constraints, d.New.Constraints, d.New.Constraints-d.Old.Constraints)
+	}
+	fmt.Fprintf(&sb, "public inputs: %d -> %d\n", d.Old.NbPublic, d.New.NbPublic)
+
+	if d.Old.Description == nil || d.New.Description == nil {
+		sb.WriteString("\nno description (zkpi profile --describe) in both versions: public inputs and gadgets not compared\n")
+	} else {
+		for _, in := range d.Added {
+			fmt.Fprintf(&sb, "  + %s[%d] at %d\n", in.Name, in.Size, in.Offset)
+		}
+		for _, in := range d.Removed {
+			fmt.Fprintf(&sb, "  - %s[%d] at %d\n", in.Name, in.Size, in.Offset)
+		}
+		for _, c := range d.Changed {
+			fmt.Fprintf(&sb, "  ~ %s[%d] at %d -> %s[%d] at %d\n", c.Name, c.OldSize, c.OldOffset, c.Name, c.NewSize, c.NewOffset)
+		}
+		if len(d.Gadgets) > 0 {
+			sb.WriteString("\n")
+			tw := tabwriter.NewWriter(&sb, 0, 8, 2, ' ', tabwriter.AlignRight)
+			fmt.Fprintf(tw, "old\tnew\tdelta\t gadget\n")
+			for _, g := range d.Gadgets {
+				fmt.Fprintf(tw, "%d\t%d\t%+d\t %s\n", g.Old, g.New, g.New-g.Old, g.Gadget)
+			}
+			tw.Flush()
+		}
+	}
+
+	sb.WriteString("\n")
+	switch {
+	case d.SameKey():
+		sb.WriteString("existing presentations remain verifiable: same verifying key\n")
+	case d.SameInputs():
+		sb.WriteString("existing presentations are not verifiable with the new key: keep the old version registered until they expire; the public inputs keep their layout\n")
+	default:
+		sb.WriteString("existing presentations are not verifiable with the new key: keep the old version registered until they expire; the public inputs changed, update the decoders of the new version\n")
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// circuitDiffCmd runs zkpi circuit diff: it compares the artifacts of two
+// versions of a circuit (verifying key, constraint system and the description
+// of zkpi profile --describe) and reports the changes of the public inputs,
+// the constraints per gadget and whether existing presentations remain
+// verifiable
+func circuitDiffCmd(args []string, w io.Writer) (*circuitDiff, error) {
+	flags := flag.NewFlagSet("zkpi circuit diff", flag.ContinueOnError)
+	oldDir := flags.String("old", "", "artifacts of the deployed version")
+	newDir := flags.String("new", "", "artifacts of the new version")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if *oldDir == "" || *newDir == "" {
+		return nil, fmt.Errorf("--old and --new are required")
+	}
+	old, err := loadArtifacts(*oldDir)
+	if err != nil {
+		return nil, err
+	}
+	new, err := loadArtifacts(*newDir)
+	if err != nil {
+		return nil, err
+	}
+	d := diffArtifacts(old, new)
+	if _, err := d.WriteTo(w); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
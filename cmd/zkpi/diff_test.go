@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// cubeCircuitV2 is cubeCircuit with a public bound on X, before Y
+type cubeCircuitV2 struct {
+	X     frontend.Variable
+	Bound frontend.Variable `gnark:",public"`
+	Y     frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuitV2) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	api.AssertIsLessOrEqual(c.X, c.Bound)
+	return nil
+}
+
+// writeArtifacts compiles the circuit to dir with its description
+func writeArtifacts(t *testing.T, dir string, circuit frontend.Circuit) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := common.SetupAndSave(circuit, filepath.Join(dir, common.ArtifactCCS), filepath.Join(dir, common.ArtifactProvingKey), filepath.Join(dir, common.ArtifactVerifyingKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := describeCircuit("cube", circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(d)
+	if err := os.WriteFile(filepath.Join(dir, descriptionFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitDiff(t *testing.T) {
+	root := t.TempDir()
+	v1, v1Again, v2 := filepath.Join(root, "v1"), filepath.Join(root, "v1-copy"), filepath.Join(root, "v2")
+	writeArtifacts(t, v1, &cubeCircuit{})
+	writeArtifacts(t, v2, &cubeCircuitV2{})
+
+	var sb strings.Builder
+	d, err := circuitDiffCmd([]string{"--old", v1, "--new", v2}, &sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("\n%s", sb.String())
+	if d.SameKey() || d.SameInputs() {
+		t.Fatal("expected another key and other public inputs")
+	}
+	if len(d.Added) != 1 || d.Added[0].Name != "Bound" || len(d.Removed) != 0 {
+		t.Fatalf("unexpected inputs: added %v, removed %v", d.Added, d.Removed)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Name != "Y" || d.Changed[0].OldOffset != 0 || d.Changed[0].NewOffset != 1 {
+		t.Fatalf("expected Y to move, got %v", d.Changed)
+	}
+	if d.New.Constraints <= d.Old.Constraints || len(d.Gadgets) == 0 {
+		t.Fatalf("expected more constraints, got %d -> %d, gadgets %v", d.Old.Constraints, d.New.Constraints, d.Gadgets)
+	}
+	if !strings.Contains(sb.String(), "update the decoders") {
+		t.Errorf("expected the decoders to be reported")
+	}
+
+	// a new setup of the same circuit: same inputs, another key
+	writeArtifacts(t, v1Again, &cubeCircuit{})
+	d, err = circuitDiffCmd([]string{"--old", v1, "--new", v1Again}, &strings.Builder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.SameKey() || !d.SameInputs() {
+		t.Fatalf("expected another key with the same inputs, got %+v", d)
+	}
+	for _, g := range d.Gadgets {
+		if g.New != g.Old {
+			t.Errorf("unexpected constraint delta %+v", g)
+		}
+	}
+
+	// the same artifacts
+	sb.Reset()
+	if d, err = circuitDiffCmd([]string{"--old", v1, "--new", v1}, &sb); err != nil {
+		t.Fatal(err)
+	}
+	if !d.SameKey() || !strings.Contains(sb.String(), "remain verifiable") {
+		t.Fatalf("expected existing presentations to remain verifiable:\n%s", sb.String())
+	}
+}
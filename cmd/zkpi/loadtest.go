@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mynextid/eudi-zk/loadtest"
+)
+
+// errSaturated is the error of zkpi loadtest --fail-saturated when a stage
+// saturated
+var errSaturated = errors.New("the deployment saturated")
+
+// loadtestCmd runs zkpi loadtest: --holders simulated holders send the
+// proof-of-possession inputs of datagen certificates (loadtest.PoPWorkload)
+// to the prover farm --prover and verify a share --verify-ratio of proofs on
+// the verification server --verifier, a stage per arrival rate of --rate (0
+// for back-to-back requests). The latency percentiles, the error rates and
+// the first saturated stage are written as a table or, with --format json,
+// for capacity dashboards. Interrupting the test reports the stages run.
+func loadtestCmd(args []string, w io.Writer) (*loadtest.Report, error) {
+	flags := flag.NewFlagSet("zkpi loadtest", flag.ContinueOnError)
+	proverURL := flags.String("prover", "", "base URL of the prover farm")
+	verifierURL := flags.String("verifier", "", "base URL of the verification server")
+	circuit := flags.String("circuit", "eudi-vc/pop", "circuit of the prover farm")
+	verifierCircuit := flags.String("verifier-circuit", "", "circuit id of the verification server (default --circuit)")
+	apiKey := flags.String("api-key", os.Getenv("ZKPI_API_KEY"), "API key of the verification server (default $ZKPI_API_KEY)")
+	holders := flags.Int("holders", 8, "number of concurrent holders")
+	rates := flags.String("rate", "0", "comma-separated arrival rates of the stages in requests per second, 0 for back-to-back requests")
+	stageDuration := flags.Duration("stage-duration", time.Minute, "duration of a stage")
+	verifyRatio := flags.Float64("verify-ratio", 0, "share of verify requests, from 0 to 1")
+	seed := flags.String("seed", "zkpi loadtest", "seed of the holder certificates and challenges")
+	certSize := flags.Int("cert-size", 2048, "size of the certificates of the circuit in bytes")
+	maxErrorRate := flags.Float64("max-error-rate", 0.01, "error rate of a saturated stage")
+	maxP99 := flags.Duration("max-p99", 0, "99th percentile latency of a saturated stage (default unbounded)")
+	timeout := flags.Duration("timeout", 2*time.Minute, "timeout of a request")
+	format := flags.String("format", "text", "output format: text or json")
+	failSaturated := flags.Bool("fail-saturated", false, "exit with status 1 when a stage saturated")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if *format != "text" && *format != "json" {
+		return nil, fmt.Errorf("unknown format %q, expected text or json", *format)
+	}
+	var stages []loadtest.Stage
+	for _, field := range strings.Split(*rates, ",") {
+		rate, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate %q", field)
+		}
+		stages = append(stages, loadtest.Stage{Rate: rate, Duration: *stageDuration})
+	}
+	workload, err := loadtest.NewPoPWorkload(*seed, *certSize)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := loadtest.Run(ctx, loadtest.Config{
+		ProverURL:       *proverURL,
+		VerifierURL:     *verifierURL,
+		Circuit:         *circuit,
+		VerifierCircuit: *verifierCircuit,
+		APIKey:          *apiKey,
+		Holders:         *holders,
+		Stages:          stages,
+		VerifyRatio:     *verifyRatio,
+		Workload:        workload,
+		Timeout:         *timeout,
+		MaxErrorRate:    *maxErrorRate,
+		MaxP99:          *maxP99,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if *format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+			return nil, err
+		}
+	} else if _, err := report.WriteTo(w); err != nil {
+		return nil, err
+	}
+	if *failSaturated && report.Saturated {
+		return report, errSaturated
+	}
+	return report, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mynextid/eudi-zk/loadtest"
+	"github.com/mynextid/eudi-zk/prover"
+)
+
+func TestLoadtest(t *testing.T) {
+	farm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req prover.ProveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/circuits/eudi-vc/pop/prove" || len(req.Inputs["CertBytes"]) == 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(prover.Result{Proof: []byte("proof")})
+	}))
+	defer farm.Close()
+
+	var out strings.Builder
+	report, err := loadtestCmd([]string{"--prover", farm.URL, "--holders", "2", "--rate", "0,50", "--stage-duration", "100ms", "--format", "json"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Stages) != 2 || report.Stages[0].Ops[loadtest.OpProve].Requests == 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	var decoded loadtest.Report
+	if err := json.Unmarshal([]byte(out.String()), &decoded); err != nil || len(decoded.Stages) != 2 {
+		t.Fatalf("unexpected output %s: %v", out.String(), err)
+	}
+
+	// every request of an unknown circuit fails
+	_, err = loadtestCmd([]string{"--prover", farm.URL, "--circuit", "eudi-vc/eudi", "--stage-duration", "50ms", "--fail-saturated"}, &out)
+	if !errors.Is(err, errSaturated) {
+		t.Fatalf("expected the deployment to saturate, got %v", err)
+	}
+
+	if _, err := loadtestCmd([]string{"--prover", farm.URL, "--rate", "fast"}, &out); err == nil {
+		t.Fatal("expected an error for an invalid rate")
+	}
+}
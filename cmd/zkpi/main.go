@@ -0,0 +1,132 @@
+// Command zkpi gathers the offline tools of the verifiers and circuit
+// developers:
+//
+//	zkpi audit verify --dir ./presentations --vk-dir ./keys --manifest pinned.json \
+//	    --holder-keys ./holders --as-of 2026-06-30 --report report.csv --sign-key auditor.pem
+//
+// verifies a directory of archived presentations in parallel against pinned
+// verifying keys, as of the audit date, and writes a CSV report with a signed
+// summary (see auditVerify).
+//
+//	zkpi profile --circuit eudi-vc/eudi --payload-size 2048
+//
+// writes the constraints of a circuit per gadget (SHA-256, base64 decoding,
+// ReadByteAt, ECDSA...), see profile; --describe also writes the public inputs
+// and the profile next to the compiled artifacts.
+//
+//	zkpi stats --circuit eudi-vc/eudi --format json --baseline circuits/stats.json
+//
+// writes the constraint and variable counts and the verifying key size of a
+// circuit, and fails when they grew beyond the tolerance of the baseline (see
+// statsCmd).
+//
+//	zkpi circuit diff --old artifacts-v1 --new artifacts-v2
+//
+// compares two versions of a circuit before an upgrade: public inputs added,
+// removed or moved, constraint deltas per gadget and whether existing
+// presentations remain verifiable (see circuitDiffCmd).
+//
+//	zkpi presentation verify --manifest pinned.json --policy policy.yaml --nonce n-1 vp.zkp
+//	zkpi policy test --manifest pinned.json --policy policy.yaml --dir samples --expect expect.yaml
+//
+// verify presentations against a declarative verification policy (package
+// policy), and evaluate a policy on sample presentations before deploying it
+// (see presentationVerify and policyTest).
+//
+//	zkpi archive create --manifest pinned.json --vk-dir ./keys --describe circuit.json \
+//	    --anchor CAPubKey=ca.pem --out vp.zkpa vp.zkp
+//	zkpi archive verify vp.zkpa
+//
+// archive a verified presentation for long-term evaluation (package archive),
+// and evaluate archives again, reporting those of an unknown format version
+// or algorithm (see archiveCreate and archiveVerify).
+//
+//	zkpi constants generate --config constants.yaml --package pid --out constants_gen.go
+//
+// emits the compile-time constants of a composed circuit (typ header, pinned
+// keys, OIDs) as Go code for circuitkit.Builder.WithConstants (see
+// constantsGenerate).
+//
+//	zkpi loadtest --prover https://prover.staging.example --verifier https://verifier.staging.example \
+//	    --holders 64 --rate 1,2,4,8 --stage-duration 5m --verify-ratio 0.5 --max-p99 30s
+//
+// simulates concurrent holders proving and verifying against a deployment at
+// increasing arrival rates, and reports the latency percentiles, the error
+// rates and the first saturated stage (see loadtestCmd).
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+const usage = `usage: zkpi <command> [flags]
+
+commands:
+  audit verify    verify archived presentations and report (zkpi audit verify -h)
+  profile         constraints of a circuit per gadget (zkpi profile -h)
+  stats           circuit sizes checked against a baseline (zkpi stats -h)
+  circuit diff    compare two versions of a circuit (zkpi circuit diff -h)
+  presentation verify
+                  verify presentations against a policy (zkpi presentation verify -h)
+  policy test     evaluate a policy on sample presentations (zkpi policy test -h)
+  archive create  archive a verified presentation (zkpi archive create -h)
+  archive verify  evaluate archives (zkpi archive verify -h)
+  constants generate
+                  emit compile-time circuit constants (zkpi constants generate -h)
+  loadtest        simulate holders against a deployment (zkpi loadtest -h)
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("zkpi: ")
+
+	switch {
+	case len(os.Args) >= 3 && os.Args[1] == "audit" && os.Args[2] == "verify":
+		summary, err := auditVerify(os.Args[3:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%d presentations: %d valid, %d expired, %d invalid", summary.Total, summary.Valid, summary.Expired, summary.Invalid)
+	case len(os.Args) >= 2 && os.Args[1] == "profile":
+		if _, err := profile(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case len(os.Args) >= 2 && os.Args[1] == "stats":
+		if _, err := statsCmd(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case len(os.Args) >= 3 && os.Args[1] == "circuit" && os.Args[2] == "diff":
+		if _, err := circuitDiffCmd(os.Args[3:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case len(os.Args) >= 3 && os.Args[1] == "presentation" && os.Args[2] == "verify":
+		if err := presentationVerify(os.Args[3:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case len(os.Args) >= 3 && os.Args[1] == "policy" && os.Args[2] == "test":
+		if _, err := policyTest(os.Args[3:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case len(os.Args) >= 3 && os.Args[1] == "archive" && os.Args[2] == "create":
+		if _, err := archiveCreate(os.Args[3:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case len(os.Args) >= 3 && os.Args[1] == "archive" && os.Args[2] == "verify":
+		if err := archiveVerify(os.Args[3:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case len(os.Args) >= 3 && os.Args[1] == "constants" && os.Args[2] == "generate":
+		if _, err := constantsGenerate(os.Args[3:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case len(os.Args) >= 2 && os.Args[1] == "loadtest":
+		if _, err := loadtestCmd(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/policy"
+	"gopkg.in/yaml.v3"
+)
+
+// Outcomes of a policy test case: accepted, or rejected by a rule
+// (policy.RuleNonce, ...) or by the verification ("invalid")
+const (
+	outcomeAccept  = "accept"
+	outcomeInvalid = "invalid"
+)
+
+// policyVerifier verifies presentations with pinned verifying keys, then
+// evaluates the policy on them
+type policyVerifier struct {
+	verifier  *models.PresentationVerifier
+	evaluator *policy.Evaluator
+	opts      policy.Options
+}
+
+// policyFlags are the flags of zkpi presentation verify and policy test
+type policyFlags struct {
+	vkDir, manifest, holderKeys, policy, now, nonce *string
+}
+
+func addPolicyFlags(flags *flag.FlagSet) policyFlags {
+	return policyFlags{
+		vkDir:      flags.String("vk-dir", "keys", "directory of the verifying keys"),
+		manifest:   flags.String("manifest", "", "pinned manifest of the verifying keys (required)"),
+		holderKeys: flags.String("holder-keys", "holder-keys", "directory of the holder public keys, <kid>.pem"),
+		policy:     flags.String("policy", "", "verification policy, YAML or JSON"),
+		now:        flags.String("now", "", "evaluation time of the policy, RFC 3339 or YYYY-MM-DD (default now)"),
+		nonce:      flags.String("nonce", "", "nonce issued for the presentation"),
+	}
+}
+
+// load builds the verifier of the flags; without --policy every verified
+// presentation is accepted
+func (f policyFlags) load() (*policyVerifier, error) {
+	if *f.manifest == "" {
+		return nil, fmt.Errorf("--manifest is required")
+	}
+	manifestData, err := os.ReadFile(*f.manifest)
+	if err != nil {
+		return nil, err
+	}
+	v := &policyVerifier{opts: policy.Options{Nonce: *f.nonce}}
+	if v.verifier, err = pinnedVerifier(manifestData, *f.vkDir, keyDir(*f.holderKeys)); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", *f.manifest, err)
+	}
+	if *f.now != "" {
+		if v.opts.Now, err = parseDate(*f.now); err != nil {
+			return nil, err
+		}
+		v.verifier.Now = func() time.Time { return v.opts.Now }
+	}
+	if *f.policy != "" {
+		p, err := policy.Load(*f.policy)
+		if err != nil {
+			return nil, err
+		}
+		templates, err := pinnedTemplates(manifestData)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s: %w", *f.manifest, err)
+		}
+		if v.evaluator, err = policy.NewEvaluator(p, templates); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// pinnedTemplates returns the templates of the pinned circuits that name one
+func pinnedTemplates(manifestData []byte) (map[string]frontend.Circuit, error) {
+	var manifest pinnedManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, err
+	}
+	templates := map[string]frontend.Circuit{}
+	for id, c := range manifest.Circuits {
+		if c.Template == "" {
+			continue
+		}
+		template, ok := profiledCircuits[c.Template]
+		if !ok {
+			return nil, fmt.Errorf("circuit %q: unknown template %q", id, c.Template)
+		}
+		sizes := defaultProfileSizes
+		if c.Sizes != nil {
+			sizes = *c.Sizes
+		}
+		templates[id] = template(sizes)
+	}
+	return templates, nil
+}
+
+// verify verifies the presentation file (compact serialization, or COSE for
+// .cbor and .cose files) and evaluates the policy
+func (v *policyVerifier) verify(path string) (*models.VerificationResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var res *models.VerificationResult
+	if ext := filepath.Ext(path); strings.EqualFold(ext, ".cbor") || strings.EqualFold(ext, ".cose") {
+		res, err = v.verifier.VerifyCOSE(data)
+	} else {
+		res, err = v.verifier.Verify(strings.TrimSpace(string(data)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v.evaluator != nil {
+		if err := v.evaluator.Evaluate(res, v.opts); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// outcome returns the outcome of a verification error
+func outcome(err error) string {
+	var violation *policy.Violation
+	switch {
+	case err == nil:
+		return outcomeAccept
+	case errors.As(err, &violation):
+		return violation.Rule
+	}
+	return outcomeInvalid
+}
+
+// presentationVerify runs zkpi presentation verify: the presentation files
+// are verified with the pinned keys and the policy is evaluated on them. An
+// error is returned when one of them is not accepted.
+func presentationVerify(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("zkpi presentation verify", flag.ContinueOnError)
+	pf := addPolicyFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("no presentation file")
+	}
+	v, err := pf.load()
+	if err != nil {
+		return err
+	}
+	rejected := 0
+	for _, file := range flags.Args() {
+		res, err := v.verify(file)
+		if err != nil {
+			rejected++
+			fmt.Fprintf(w, "%s: %s: %v\n", file, outcome(err), err)
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s %s\n", file, outcomeAccept, res.Circuit)
+	}
+	if rejected > 0 {
+		return fmt.Errorf("%d of %d presentations rejected", rejected, flags.NArg())
+	}
+	return nil
+}
+
+// policyTestResult is the outcome of a sample presentation
+type policyTestResult struct {
+	File     string
+	Outcome  string
+	Expected string // empty without expectation
+	Detail   string
+}
+
+// policyTest runs zkpi policy test: every sample presentation of --dir is
+// verified and evaluated against the policy, and its outcome (accept, the
+// failing rule, or invalid) compared to the expectations of --expect, a YAML
+// or JSON map of the file names to their expected outcome:
+//
+//	valid.zkp: accept
+//	replayed.zkp: nonce
+//
+// An error is returned when an outcome differs from its expectation.
+func policyTest(args []string, w io.Writer) ([]policyTestResult, error) {
+	flags := flag.NewFlagSet("zkpi policy test", flag.ContinueOnError)
+	pf := addPolicyFlags(flags)
+	dir := flags.String("dir", "samples", "directory of the sample presentations")
+	expectPath := flags.String("expect", "", "expected outcomes of the samples, by file name")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if *pf.policy == "" {
+		return nil, fmt.Errorf("--policy is required")
+	}
+	v, err := pf.load()
+	if err != nil {
+		return nil, err
+	}
+	expected := map[string]string{}
+	if *expectPath != "" {
+		data, err := os.ReadFile(*expectPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &expected); err != nil {
+			return nil, fmt.Errorf("%s: %w", *expectPath, err)
+		}
+	}
+
+	files, err := presentationFiles(*dir)
+	if err != nil {
+		return nil, err
+	}
+	var results []policyTestResult
+	failed := 0
+	for _, file := range files {
+		_, err := v.verify(filepath.Join(*dir, file))
+		r := policyTestResult{File: filepath.ToSlash(file), Outcome: outcome(err), Expected: expected[filepath.ToSlash(file)]}
+		if err != nil {
+			r.Detail = err.Error()
+		}
+		status := "ok"
+		if r.Expected != "" && r.Expected != r.Outcome {
+			status = "FAIL expected " + r.Expected
+			failed++
+		}
+		fmt.Fprintf(w, "%-6s %s: %s", status, r.File, r.Outcome)
+		if r.Detail != "" {
+			fmt.Fprintf(w, " (%s)", r.Detail)
+		}
+		fmt.Fprintln(w)
+		results = append(results, r)
+	}
+	for file := range expected {
+		if _, err := os.Stat(filepath.Join(*dir, file)); err != nil {
+			return results, fmt.Errorf("expected outcome of a missing sample %s", file)
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d samples do not match their expected outcome", failed, len(results))
+	}
+	return results, nil
+}
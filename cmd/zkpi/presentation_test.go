@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/policy"
+)
+
+func TestPolicyTest(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"samples", "keys", "holders"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vkBuf bytes.Buffer
+	vk.WriteTo(&vkBuf)
+	os.WriteFile(filepath.Join(root, "keys", "cube.vk"), vkBuf.Bytes(), 0o644)
+	vkHash, _ := common.VerifyingKeyHash(vk)
+	manifest := filepath.Join(root, "pinned.json")
+	data, _ := json.Marshal(pinnedManifest{Circuits: map[string]pinnedCircuit{"cube/v1": {VerifyingKey: "cube.vk", VKHash: hex.EncodeToString(vkHash[:])}}})
+	os.WriteFile(manifest, data, 0o644)
+
+	holderKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	holderDER, _ := x509.MarshalPKIXPublicKey(&holderKey.PublicKey)
+	writePEM(t, filepath.Join(root, "holders", "holder-1.pem"), "PUBLIC KEY", holderDER)
+
+	w, _ := frontend.NewWitness(&cubeCircuit{X: 3, Y: 27}, ecc.BN254.ScalarField())
+	proof, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proofBuf bytes.Buffer
+	proof.WriteTo(&proofBuf)
+	public, _ := w.Public()
+	publicWitness, _ := public.MarshalBinary()
+
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	header := models.PresentationHeader{Kid: "holder-1", Circuit: "cube/v1", VKHash: hex.EncodeToString(vkHash[:])}
+	sample := func(name, nonce string, issuedAt time.Time) string {
+		compact, err := models.SignPresentation(header, models.PresentationPayload{Audience: "https://verifier.example", Nonce: nonce, IssuedAt: issuedAt.Unix(), ExpiresAt: issuedAt.Add(24 * time.Hour).Unix(), PublicWitness: publicWitness}, proofBuf.Bytes(), holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(root, "samples", name)
+		os.WriteFile(path, []byte(compact), 0o644)
+		return path
+	}
+	valid := sample("valid.zkp", "n-1", now.Add(-time.Minute))
+	sample("replayed.zkp", "n-0", now.Add(-time.Minute))
+	sample("old.zkp", "n-1", now.Add(-time.Hour))
+	os.WriteFile(filepath.Join(root, "samples", "garbage.zkp"), []byte("not.a.presentation"), 0o644)
+
+	policyPath := filepath.Join(root, "policy.yaml")
+	os.WriteFile(policyPath, []byte("version: p1\ncircuits: [cube/v1]\nmax_proof_age: 10m\nnonce:\n  required: true\n"), 0o644)
+	expect := filepath.Join(root, "expect.yaml")
+	writeExpect := func(doc string) {
+		os.WriteFile(expect, []byte(doc), 0o644)
+	}
+	writeExpect("valid.zkp: accept\nreplayed.zkp: nonce\nold.zkp: max_proof_age\ngarbage.zkp: invalid\n")
+
+	args := []string{
+		"--manifest", manifest, "--vk-dir", filepath.Join(root, "keys"), "--holder-keys", filepath.Join(root, "holders"),
+		"--policy", policyPath, "--now", now.Format(time.RFC3339), "--nonce", "n-1",
+		"--dir", filepath.Join(root, "samples"), "--expect", expect,
+	}
+	var out strings.Builder
+	results, err := policyTest(args, &out)
+	t.Logf("\n%s", out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 samples, got %d", len(results))
+	}
+
+	// an expectation the policy does not meet
+	writeExpect("valid.zkp: accept\nold.zkp: accept\n")
+	if _, err := policyTest(args, &strings.Builder{}); err == nil || !strings.Contains(err.Error(), "1 of 4") {
+		t.Fatalf("expected a failing sample, got %v", err)
+	}
+
+	// presentation verify
+	verifyArgs := append(slices.Clone(args[:12]), valid)
+	if err := presentationVerify(verifyArgs, &strings.Builder{}); err != nil {
+		t.Fatal(err)
+	}
+	verifyArgs[11] = "n-2"
+	out.Reset()
+	if err := presentationVerify(verifyArgs, &out); err == nil || !strings.Contains(out.String(), policy.RuleNonce) {
+		t.Fatalf("expected a nonce violation, got %v: %s", err, out.String())
+	}
+}
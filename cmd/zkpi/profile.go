@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	cacc "github.com/mynextid/eudi-zk/circuits/accumulator"
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	ct "github.com/mynextid/eudi-zk/circuits/temporal"
+	csv "github.com/mynextid/eudi-zk/circuits/verify-eidas-signature"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// profileSizes are the input sizes of the profiled circuit
+type profileSizes struct {
+	Cert      int `json:"cert"`
+	Protected int `json:"protected"`
+	Payload   int `json:"payload"`
+	Challenge int `json:"challenge"`
+}
+
+// defaultProfileSizes are the default sizes of zkpi profile
+var defaultProfileSizes = profileSizes{Cert: 1024, Protected: 256, Payload: 1024, Challenge: 32}
+
+// profiledCircuits are the circuits of zkpi profile, templates of the given
+// sizes
+var profiledCircuits = map[string]func(s profileSizes) frontend.Circuit{
+	"eudi-vc/pop": func(s profileSizes) frontend.Circuit {
+		return &cdl.CircuitPoP{CertBytes: make([]uints.U8, s.Cert), Challenge: make([]uints.U8, s.Challenge)}
+	},
+	"eudi-vc/eudi": func(s profileSizes) frontend.Circuit {
+		return &cdl.CircuitEUDI{
+			CertBytes:    make([]uints.U8, s.Cert),
+			Challenge:    make([]uints.U8, s.Challenge),
+			CnfB64:       make([]uints.U8, 108),
+			JWSProtected: make([]uints.U8, s.Protected),
+			JWSPayload:   make([]uints.U8, s.Payload),
+		}
+	},
+	"eudi-vc/wallet-attestation": func(s profileSizes) frontend.Circuit {
+		return cdl.NewCircuitWalletAttestation(s.Cert, s.Protected, s.Payload, s.Challenge)
+	},
+	"eudi-vc/pop-ca-set": func(s profileSizes) frontend.Circuit {
+		return cdl.NewCircuitPoPCASet(s.Cert, s.Challenge, 2)
+	},
+	"eudi-vc/pop-rsa": func(s profileSizes) frontend.Circuit {
+		return cdl.NewCircuitPoPRSA(s.Cert, s.Challenge, 256)
+	},
+	"eudi-vc/crl": func(s profileSizes) frontend.Circuit {
+		return cdl.NewCircuitCRL(s.Cert, 4*s.Payload)
+	},
+	"eudi-vc/subject-dn": func(s profileSizes) frontend.Circuit {
+		return cdl.NewCircuitSubjectDN(s.Cert, 256)
+	},
+	"verify-eidas-signature": func(s profileSizes) frontend.Circuit {
+		return &csv.CircuitJWS{
+			JWSProtected: make([]uints.U8, s.Protected),
+			JWSPayload:   make([]uints.U8, s.Payload),
+			CertTBSDER:   make([]uints.U8, s.Cert),
+		}
+	},
+	"temporal/over18": func(s profileSizes) frontend.Circuit {
+		return &ct.Over18{Payload: make([]uints.U8, s.Payload), DateB64: make([]uints.U8, 36), MinDateOfBirth: make([]uints.U8, 10)}
+	},
+	"accumulator": func(s profileSizes) frontend.Circuit {
+		return cacc.NewCircuitAccumulator(s.Cert, 20)
+	},
+}
+
+// sizeFlags registers the input size flags of the profiled circuits
+func sizeFlags(flags *flag.FlagSet) *profileSizes {
+	var sizes profileSizes
+	flags.IntVar(&sizes.Cert, "cert-size", defaultProfileSizes.Cert, "size of the certificate (TBS) in bytes")
+	flags.IntVar(&sizes.Protected, "protected-size", defaultProfileSizes.Protected, "size of the base64url protected header in bytes")
+	flags.IntVar(&sizes.Payload, "payload-size", defaultProfileSizes.Payload, "size of the base64url payload in bytes")
+	flags.IntVar(&sizes.Challenge, "challenge-size", defaultProfileSizes.Challenge, "size of the challenge in bytes")
+	return &sizes
+}
+
+// profiledCircuitNames returns the names of profiledCircuits, sorted
+func profiledCircuitNames() []string {
+	names := make([]string, 0, len(profiledCircuits))
+	for name := range profiledCircuits {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// profile runs zkpi profile: it compiles the circuit --circuit with the
+// profiling API of common.ProfileConstraints and writes its constraints per
+// gadget. With --describe, the public inputs and the profile are also written
+// as the description of the circuit (circuit.json in the compiled/ directory)
+// compared by zkpi circuit diff.
+func profile(args []string, w io.Writer) (*common.ConstraintProfile, error) {
+	names := profiledCircuitNames()
+	flags := flag.NewFlagSet("zkpi profile", flag.ContinueOnError)
+	circuit := flags.String("circuit", "", "circuit to profile: "+strings.Join(names, ", "))
+	sizes := sizeFlags(flags)
+	describe := flags.String("describe", "", "write the description of the circuit to this file")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	template, ok := profiledCircuits[*circuit]
+	if !ok {
+		return nil, fmt.Errorf("unknown circuit %q, expected one of %s", *circuit, strings.Join(names, ", "))
+	}
+
+	d, err := describeCircuit(*circuit, template(*sizes))
+	if err != nil {
+		return nil, fmt.Errorf("circuit %q: %w", *circuit, err)
+	}
+	if *describe != "" {
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(*describe, data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	p := d.Profile
+	if _, err := p.WriteTo(w); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
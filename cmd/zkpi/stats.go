@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// defaultStatsTolerance is the tolerance of a baseline created by zkpi stats
+// --update
+const defaultStatsTolerance = 0.02
+
+// statsReport is the JSON output of zkpi stats
+type statsReport struct {
+	*common.CircuitStats
+	Regressions []common.StatsRegression `json:"regressions,omitempty"`
+}
+
+// statsCmd runs zkpi stats: it compiles the circuit --circuit (see
+// profiledCircuits) and writes its stats (common.CompileStats) as a table or,
+// with --format json, for CI. With --baseline, the stats are checked against
+// the baseline file and a regression beyond its tolerance is an error (exit
+// status 1); --update writes the stats to the baseline instead.
+func statsCmd(args []string, w io.Writer) (*common.CircuitStats, error) {
+	names := profiledCircuitNames()
+	flags := flag.NewFlagSet("zkpi stats", flag.ContinueOnError)
+	circuit := flags.String("circuit", "", "circuit: "+strings.Join(names, ", "))
+	sizes := sizeFlags(flags)
+	format := flags.String("format", "text", "output format: text or json")
+	setup := flags.Bool("setup", true, "run the groth16 setup for the verifying key size")
+	baselinePath := flags.String("baseline", "", "check the stats against this baseline file")
+	update := flags.Bool("update", false, "write the stats to the baseline file instead of checking them")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	template, ok := profiledCircuits[*circuit]
+	if !ok {
+		return nil, fmt.Errorf("unknown circuit %q, expected one of %s", *circuit, strings.Join(names, ", "))
+	}
+	if *format != "text" && *format != "json" {
+		return nil, fmt.Errorf("unknown format %q, expected text or json", *format)
+	}
+	if *update && *baselinePath == "" {
+		return nil, fmt.Errorf("--update needs --baseline")
+	}
+
+	stats, err := common.CompileStats(*circuit, template(*sizes), *setup)
+	if err != nil {
+		return nil, fmt.Errorf("circuit %q: %w", *circuit, err)
+	}
+
+	var checkErr error
+	if *baselinePath != "" {
+		baseline, err := common.ReadStatsBaseline(*baselinePath)
+		if errors.Is(err, fs.ErrNotExist) && *update {
+			baseline, err = &common.StatsBaseline{Tolerance: defaultStatsTolerance}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if *update {
+			baseline.Update(stats)
+			if err := baseline.WriteFile(*baselinePath); err != nil {
+				return nil, err
+			}
+		} else {
+			checkErr = baseline.Check(stats)
+		}
+	}
+	report := statsReport{CircuitStats: stats}
+	var regression *common.StatsRegressionError
+	if errors.As(checkErr, &regression) {
+		report.Regressions = regression.Regressions
+	}
+
+	if *format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := stats.WriteTo(w); err != nil {
+			return nil, err
+		}
+		for _, r := range report.Regressions {
+			fmt.Fprintf(w, "regression: %s\n", r)
+		}
+	}
+	return stats, checkErr
+}
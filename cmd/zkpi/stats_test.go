@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+func TestStats(t *testing.T) {
+	profiledCircuits["cube"] = func(profileSizes) frontend.Circuit { return &cubeCircuit{} }
+	defer delete(profiledCircuits, "cube")
+	baseline := filepath.Join(t.TempDir(), "stats.json")
+
+	stats, err := statsCmd([]string{"--circuit", "cube", "--baseline", baseline, "--update"}, &strings.Builder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Constraints == 0 || stats.PublicVariables != 1 || stats.SecretVariables != 1 || stats.VKSize == 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if _, err := statsCmd([]string{"--circuit", "cube", "--baseline", baseline}, &strings.Builder{}); err != nil {
+		t.Fatalf("expected the stats of the baseline to pass, got %v", err)
+	}
+
+	// a refactor adding constraints and a public input
+	profiledCircuits["cube"] = func(profileSizes) frontend.Circuit { return &cubeCircuitV2{} }
+	var out strings.Builder
+	_, err = statsCmd([]string{"--circuit", "cube", "--baseline", baseline, "--format", "json", "--setup=false"}, &out)
+	if !errors.Is(err, common.ErrStatsRegression) {
+		t.Fatalf("expected a regression, got %v", err)
+	}
+	var report struct {
+		Constraints int                      `json:"constraints"`
+		VKSize      int64                    `json:"vk_size"`
+		Regressions []common.StatsRegression `json:"regressions"`
+	}
+	if err := json.Unmarshal([]byte(out.String()), &report); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]bool{}
+	for _, r := range report.Regressions {
+		metrics[r.Metric] = true
+	}
+	if report.Constraints <= stats.Constraints || report.VKSize != 0 || !metrics["constraints"] || !metrics["public_variables"] || metrics["vk_size"] {
+		t.Fatalf("unexpected report %s", out.String())
+	}
+
+	if _, err := statsCmd([]string{"--circuit", "square"}, &strings.Builder{}); err == nil {
+		t.Fatal("expected an error for an unknown circuit")
+	}
+}
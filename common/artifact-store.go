@@ -0,0 +1,191 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+// Artifact key names below the circuit prefix, the same file names as the
+// compiled/ directory of the circuits
+const (
+	ArtifactCCS          = "circuit.ccs"
+	ArtifactProvingKey   = "proving.key"
+	ArtifactVerifyingKey = "verification.key"
+	// ArtifactManifest lists the artifacts of the circuit with the encoding
+	// of its proving key (artifact.Manifest)
+	ArtifactManifest = "artifacts.json"
+)
+
+// InitCircuitFromStore is InitCircuitWithEncoding with the artifacts stored
+// under prefix in an artifact store (e.g. "eudi-vc/pop-v1/proving.key"), so
+// a server fleet can share one bucket. The circuit is compiled and the
+// artifacts uploaded when they are missing or forceCompile is set, which is
+// ErrSetupDisabled outside of ModeFull; the manifest (ArtifactManifest)
+// records the encoding of the uploaded proving key, the one the loads use.
+func InitCircuitFromStore(ctx context.Context, store artifact.Store, prefix string, forceCompile bool, circuitTemplate frontend.Circuit, encoding KeyEncoding) (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey, error) {
+	if !forceCompile {
+		ccs, pk, vk, err := LoadSetupFromStore(ctx, store, prefix, encoding)
+		if err == nil {
+			return ccs, pk, vk, nil
+		}
+		if !errors.Is(err, artifact.ErrNotFound) {
+			return nil, nil, nil, err
+		}
+	}
+	if err := checkSetup(); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: artifacts missing or recompilation forced: %w", prefix, err)
+	}
+
+	ccs, err := CompileCircuit(ctx, circuitTemplate, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pk, vk, err := SetupCircuit(ctx, ccs, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the verifying key is uploaded last, after the manifest listing it: a
+	// reader seeing it sees all artifacts
+	signer := currentProvenance().Signer
+	var vkBuf, buf bytes.Buffer
+	if _, err := vk.WriteTo(&vkBuf); err != nil {
+		return nil, nil, nil, err
+	}
+	listed := []artifact.ManifestArtifact{manifestArtifact(prefix+ArtifactVerifyingKey, vkBuf.Bytes())}
+	if _, err := ccs.WriteTo(&buf); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := putSignedArtifact(ctx, store, signer, prefix+ArtifactCCS, ArtifactCCS, buf.Bytes()); err != nil {
+		return nil, nil, nil, err
+	}
+	listed = append(listed, manifestArtifact(prefix+ArtifactCCS, buf.Bytes()))
+	buf.Reset()
+	if err := writeProvingKey(&buf, pk, encoding); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := putSignedArtifact(ctx, store, signer, prefix+ArtifactProvingKey, ArtifactProvingKey, buf.Bytes()); err != nil {
+		return nil, nil, nil, err
+	}
+	listed = append(listed, manifestArtifact(prefix+ArtifactProvingKey, buf.Bytes()))
+	if err := artifact.PutManifest(ctx, store, prefix+ArtifactManifest, circuitManifest(listed, prefix+ArtifactProvingKey, encoding)); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := putSignedArtifact(ctx, store, signer, prefix+ArtifactVerifyingKey, ArtifactVerifyingKey, vkBuf.Bytes()); err != nil {
+		return nil, nil, nil, err
+	}
+
+	fmt.Println("[OK] Setup completed and uploaded!")
+	return ccs, pk, vk, nil
+}
+
+// LoadSetupFromStore loads the pre-compiled circuit and keys stored under
+// prefix, the proving key with the encoding recorded in the manifest of the
+// artifacts (ArtifactManifest), encoding for artifacts uploaded without
+// manifest. With trusted keys set by SetArtifactProvenance, artifacts without
+// a valid signature are refused. In ModeVerifyOnly it returns
+// ErrProvingDisabled, see LoadVerifyingKeyFromStore.
+func LoadSetupFromStore(ctx context.Context, store artifact.Store, prefix string, encoding KeyEncoding) (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey, error) {
+	if err := checkProving(); err != nil {
+		return nil, nil, nil, err
+	}
+	// the signatures are verified before parsing the artifacts, at the cost
+	// of reading them twice
+	if trusted := currentProvenance().Trusted; trusted != nil {
+		for _, kind := range []string{ArtifactVerifyingKey, ArtifactCCS, ArtifactProvingKey} {
+			if _, err := VerifyArtifactFromStore(ctx, store, prefix+kind, kind, trusted); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	// Load verification key first, it is uploaded last
+	vk, err := LoadVerifyingKeyFromStore(ctx, store, prefix+ArtifactVerifyingKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Load constraint system
+	ccsReader, err := store.Get(ctx, prefix+ArtifactCCS)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer ccsReader.Close()
+
+	ccs := groth16.NewCS(ecc.BN254)
+	if _, err := ccs.ReadFrom(bufio.NewReaderSize(ccsReader, 1<<20)); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := CheckHints(ccs); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", prefix+ArtifactCCS, err)
+	}
+
+	// Load proving key
+	encoding, err = storeKeyEncoding(ctx, store, prefix, encoding)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pkReader, err := store.Get(ctx, prefix+ArtifactProvingKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer pkReader.Close()
+
+	pk, err := readProvingKey(bufio.NewReaderSize(pkReader, 1<<20), encoding)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fmt.Println("[OK] Loaded pre-compiled setup from the artifact store")
+	return ccs, pk, vk, nil
+}
+
+// storeKeyEncoding returns the encoding of the proving key recorded in the
+// manifest of the artifacts under prefix, encoding when there is no manifest
+func storeKeyEncoding(ctx context.Context, store artifact.Store, prefix string, encoding KeyEncoding) (KeyEncoding, error) {
+	m, err := artifact.GetManifest(ctx, store, prefix+ArtifactManifest)
+	if errors.Is(err, artifact.ErrNotFound) {
+		return encoding, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	info, err := store.Stat(ctx, prefix+ArtifactProvingKey)
+	if err != nil {
+		return 0, err
+	}
+	return manifestKeyEncoding(m, prefix+ArtifactProvingKey, info.Size)
+}
+
+// manifestArtifact returns the manifest entry of the artifact data
+func manifestArtifact(key string, data []byte) artifact.ManifestArtifact {
+	digest := sha256.Sum256(data)
+	return artifact.ManifestArtifact{Key: key, Size: int64(len(data)), SHA256: hex.EncodeToString(digest[:])}
+}
+
+// LoadVerifyingKeyFromStore loads a verifying key, e.g. from a CDN with an
+// artifact.HTTPStore
+func LoadVerifyingKeyFromStore(ctx context.Context, store artifact.Store, key string) (groth16.VerifyingKey, error) {
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	vk := groth16.NewVerifyingKey(ecc.BN254)
+	if _, err := vk.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return vk, nil
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+func TestInitCircuitFromStore(t *testing.T) {
+	ctx := context.Background()
+	store := artifact.NewFSStore(t.TempDir())
+
+	_, _, vk, err := InitCircuitFromStore(ctx, store, "power/", false, &powerCircuit{N: 4}, KeyEncodingRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := store.List(ctx, "power/")
+	if err != nil || len(infos) != 4 {
+		t.Fatalf("expected 3 artifacts and their manifest, got %v (%v)", infos, err)
+	}
+	m, err := artifact.GetManifest(ctx, store, "power/"+ArtifactManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Artifacts) != 3 || !slices.ContainsFunc(m.Artifacts, func(a artifact.ManifestArtifact) bool {
+		return a.Key == "power/"+ArtifactProvingKey && a.Encoding == "raw"
+	}) {
+		t.Fatalf("expected the raw proving key in the manifest, got %+v", m)
+	}
+
+	// the second call loads the uploaded artifacts, with the encoding of the
+	// manifest
+	_, _, loaded, err := InitCircuitFromStore(ctx, store, "power/", false, &powerCircuit{N: 4}, KeyEncodingCompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected, actual bytes.Buffer
+	vk.WriteTo(&expected)
+	loaded.WriteTo(&actual)
+	if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+		t.Fatal("loaded verifying key differs from the uploaded one")
+	}
+}
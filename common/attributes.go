@@ -0,0 +1,88 @@
+package common
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// Structured public output: a circuit proving claims exposes them in a public
+// field named AttributesField of type []Attribute. Each slot holds the tag of
+// a claim and the digest of its value, the slots are ordered by claim name
+// and the unused ones are zero:
+//
+//	tag    = name, big-endian (at most 31 bytes)
+//	digest = SHA-256(value)[:31], big-endian
+//
+// models.NewAttributeDecoder reads the slots back from the public witness.
+
+// AttributesField is the name of the circuit field holding the attributes
+const AttributesField = "Attributes"
+
+// AttributeDigestSize is the size of the value digest of an attribute, the
+// truncated SHA-256 fits in one field element
+const AttributeDigestSize = 31
+
+// Attribute is a public output slot
+type Attribute struct {
+	Tag    frontend.Variable
+	Digest frontend.Variable
+}
+
+// AttributeTag returns the tag of a claim name
+func AttributeTag(name string) (*big.Int, error) {
+	if name == "" || len(name) > AttributeDigestSize {
+		return nil, fmt.Errorf("invalid attribute name %q", name)
+	}
+	return new(big.Int).SetBytes([]byte(name)), nil
+}
+
+// AssertAttributes asserts that the slots expose the claims names[i] =
+// values[i]. The names are compile-time constants, sorted and unique, at most
+// one per slot.
+func AssertAttributes(api frontend.API, slots []Attribute, names []string, values [][]uints.U8) error {
+	if len(names) != len(values) {
+		return fmt.Errorf("%d attribute names for %d values", len(names), len(values))
+	}
+	if len(names) > len(slots) {
+		return fmt.Errorf("%d attributes for %d slots", len(names), len(slots))
+	}
+	if !slices.IsSorted(names) {
+		return fmt.Errorf("attribute names are not sorted: %v", names)
+	}
+
+	for i, slot := range slots {
+		if i >= len(names) {
+			AssertEqual(api, slot.Tag, 0, "attribute slot %d: tag", i)
+			AssertEqual(api, slot.Digest, 0, "attribute slot %d: digest", i)
+			continue
+		}
+		if i > 0 && names[i-1] == names[i] {
+			return fmt.Errorf("duplicate attribute %q", names[i])
+		}
+		tag, err := AttributeTag(names[i])
+		if err != nil {
+			return err
+		}
+		digest, err := SHA256(api, values[i])
+		if err != nil {
+			return err
+		}
+
+		AssertEqual(api, slot.Tag, tag, "attribute %s: tag", names[i])
+		AssertEqual(api, slot.Digest, packBytes(api, digest[:AttributeDigestSize]), "attribute %s: digest", names[i])
+	}
+	return nil
+}
+
+// packBytes returns the big-endian field element of at most 31 bytes
+func packBytes(api frontend.API, bytes []uints.U8) frontend.Variable {
+	result := frontend.Variable(0)
+	for _, b := range bytes {
+		result = api.Add(api.Mul(result, 256), b.Val)
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/consensys/gnark/frontend"
+)
+
+// B64Alignment describes where a claim of the decoded JSON is found in the
+// base64url encoded payload. Base64url maps every 3 bytes to 4 characters, so
+// a claim can only be matched in the encoded payload after extending it to a
+// 3-byte group boundary on both sides.
+type B64Alignment struct {
+	// Claim range in the decoded JSON, [ClaimStart, ClaimEnd)
+	ClaimStart int
+	ClaimEnd   int
+	// Claim range extended to group boundaries in the decoded JSON, [Start, End)
+	Start int
+	End   int
+	// Range of the encoded segment in the base64url payload, [B64Start, B64End)
+	B64Start int
+	B64End   int
+	// Offset of the claim within the decoded segment (ClaimStart - Start)
+	Offset int
+}
+
+// AlignClaim aligns the claim [claimStart, claimEnd) of a decoded JSON of
+// jsonLen bytes to base64url group boundaries. The aligned end is clamped to
+// the end of the JSON, in which case the segment ends with a partial group
+// (raw base64url, no padding).
+func AlignClaim(jsonLen, claimStart, claimEnd int) (*B64Alignment, error) {
+	if claimStart < 0 || claimEnd < claimStart || claimEnd > jsonLen {
+		return nil, fmt.Errorf("invalid claim range [%d, %d) for %d bytes", claimStart, claimEnd, jsonLen)
+	}
+
+	start := claimStart - claimStart%3
+	end := min(claimEnd+(3-claimEnd%3)%3, jsonLen)
+
+	return &B64Alignment{
+		ClaimStart: claimStart,
+		ClaimEnd:   claimEnd,
+		Start:      start,
+		End:        end,
+		B64Start:   start / 3 * 4,
+		B64End:     b64Len(end),
+		Offset:     claimStart - start,
+	}, nil
+}
+
+// b64Len returns the raw (unpadded) base64url length of n bytes
+func b64Len(n int) int {
+	return (n*8 + 5) / 6
+}
+
+// VerifyB64Alignment verifies in-circuit the alignment arithmetic of a claim
+// of claimLen bytes found through a base64url segment of segmentLen characters
+// taken at b64Start from a payload of payloadLen characters:
+//   - b64Start is on a 4-character group boundary, b64Start = 4q
+//   - the claim starts at claimStart = 3q + offset in the decoded JSON
+//   - the claim ends inside the decoded segment, offset + claimLen <= decoded
+//     length; a trailing partial group only decodes to its complete bytes
+//
+// The sizes are compile-time values.
+func VerifyB64Alignment(api frontend.API, payloadLen, segmentLen, claimLen int, claimStart, b64Start, offset frontend.Variable) error {
+	if err := AssertB64Aligned(api, payloadLen, segmentLen, b64Start); err != nil {
+		return err
+	}
+
+	decodedLen := segmentLen * 6 / 8
+	if claimLen > decodedLen {
+		return fmt.Errorf("claim (%d bytes) longer than the decoded segment (%d bytes)", claimLen, decodedLen)
+	}
+
+	// q = b64Start / 4 is an integer (checked by AssertB64Aligned)
+	q := api.Div(b64Start, 4)
+
+	// the claim position in the decoded JSON must match the segment start
+	AssertEqual(api, claimStart, api.Add(api.Mul(q, 3), offset), "b64 alignment: claim start")
+
+	// the claim must end inside the decoded segment
+	api.ToBinary(offset, max(1, bits.Len(uint(decodedLen))))
+	api.AssertIsLessOrEqual(offset, decodedLen-claimLen)
+
+	return nil
+}
+
+// AssertB64Aligned asserts that a base64url segment of segmentLen characters
+// starting at b64Start decodes to the same bytes as the payload it is taken
+// from. Decoding from a position that is not on a 4-character group boundary
+// yields shifted bits, i.e. bytes that are not in the payload.
+func AssertB64Aligned(api frontend.API, payloadLen, segmentLen int, b64Start frontend.Variable) error {
+	if segmentLen%4 == 1 {
+		return fmt.Errorf("invalid base64 segment length %d", segmentLen)
+	}
+	if segmentLen > payloadLen {
+		return fmt.Errorf("base64 segment (%d) longer than the payload (%d)", segmentLen, payloadLen)
+	}
+
+	// b64Start = 4q with q small; a non-multiple of 4 gives q = b64Start * 4^-1
+	// which does not fit in the range check
+	q := api.Div(b64Start, 4)
+	api.ToBinary(q, max(1, bits.Len(uint(payloadLen/4))))
+
+	return nil
+}
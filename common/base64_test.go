@@ -0,0 +1,130 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+)
+
+// TestAlignClaim checks every claim range of every JSON length up to 13 bytes,
+// which covers all the start/end mod-3 cases and the clamping at the end
+func TestAlignClaim(t *testing.T) {
+	for jsonLen := 1; jsonLen <= 13; jsonLen++ {
+		json := make([]byte, jsonLen)
+		for i := range json {
+			json[i] = byte(0x41 + 37*i)
+		}
+		payload := base64.RawURLEncoding.EncodeToString(json)
+
+		for claimStart := 0; claimStart <= jsonLen; claimStart++ {
+			for claimEnd := claimStart; claimEnd <= jsonLen; claimEnd++ {
+				a, err := AlignClaim(jsonLen, claimStart, claimEnd)
+				if err != nil {
+					t.Fatalf("AlignClaim(%d, %d, %d): %v", jsonLen, claimStart, claimEnd, err)
+				}
+
+				if a.Start%3 != 0 || a.B64Start%4 != 0 {
+					t.Fatalf("%+v: start not on a group boundary", a)
+				}
+				if a.End%3 != 0 && a.End != jsonLen {
+					t.Fatalf("%+v: end not on a group boundary", a)
+				}
+				if start, end := B64Align(claimStart, claimEnd); start != a.Start || (end != a.End && a.End != jsonLen) {
+					t.Fatalf("%+v: B64Align returned [%d, %d)", a, start, end)
+				}
+				if a.Start > claimStart || a.End < claimEnd || a.Start+a.Offset != claimStart {
+					t.Fatalf("%+v: claim not covered", a)
+				}
+
+				// the encoded segment is found as is in the payload
+				segment := base64.RawURLEncoding.EncodeToString(json[a.Start:a.End])
+				if payload[a.B64Start:a.B64End] != segment {
+					t.Fatalf("%+v: segment %q != payload %q", a, segment, payload[a.B64Start:a.B64End])
+				}
+
+				// and decodes to the claim at Offset
+				decoded, err := base64.RawURLEncoding.DecodeString(segment)
+				if err != nil {
+					t.Fatalf("%+v: %v", a, err)
+				}
+				if !bytes.Equal(decoded[a.Offset:a.Offset+claimEnd-claimStart], json[claimStart:claimEnd]) {
+					t.Fatalf("%+v: decoded segment does not contain the claim", a)
+				}
+			}
+		}
+	}
+}
+
+func TestAlignClaimInvalid(t *testing.T) {
+	for _, r := range [][3]int{{10, -1, 2}, {10, 5, 4}, {10, 2, 11}} {
+		if _, err := AlignClaim(r[0], r[1], r[2]); err == nil {
+			t.Errorf("AlignClaim(%d, %d, %d): expected an error", r[0], r[1], r[2])
+		}
+	}
+}
+
+type b64AlignmentCircuit struct {
+	PayloadLen int `gnark:"-"`
+	SegmentLen int `gnark:"-"`
+	ClaimLen   int `gnark:"-"`
+
+	ClaimStart frontend.Variable
+	B64Start   frontend.Variable
+	Offset     frontend.Variable
+}
+
+func (c *b64AlignmentCircuit) Define(api frontend.API) error {
+	return VerifyB64Alignment(api, c.PayloadLen, c.SegmentLen, c.ClaimLen, c.ClaimStart, c.B64Start, c.Offset)
+}
+
+func TestVerifyB64Alignment(t *testing.T) {
+	const jsonLen = 13
+	payloadLen := b64Len(jsonLen)
+
+	// every aligned claim is accepted
+	for claimStart := 0; claimStart < jsonLen; claimStart++ {
+		for claimEnd := claimStart + 1; claimEnd <= jsonLen; claimEnd++ {
+			a, _ := AlignClaim(jsonLen, claimStart, claimEnd)
+			circuit := &b64AlignmentCircuit{
+				PayloadLen: payloadLen,
+				SegmentLen: a.B64End - a.B64Start,
+				ClaimLen:   claimEnd - claimStart,
+				ClaimStart: claimStart,
+				B64Start:   a.B64Start,
+				Offset:     a.Offset,
+			}
+			if err := CheckWitness(circuit, circuit); err != nil {
+				t.Fatalf("%+v: %v", a, err)
+			}
+		}
+	}
+
+	// claim [4, 7) → segment [3, 9) → b64 [4, 12), offset 1
+	tests := []struct {
+		name                         string
+		claimStart, b64Start, offset int
+	}{
+		{"b64 start not on a group boundary", 4, 5, 1},
+		{"claim start mismatch", 5, 4, 1},
+		{"claim past the segment", 7, 4, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			circuit := &b64AlignmentCircuit{
+				PayloadLen: payloadLen,
+				SegmentLen: 8,
+				ClaimLen:   3,
+				ClaimStart: tt.claimStart,
+				B64Start:   tt.b64Start,
+				Offset:     tt.offset,
+			}
+			var werr *WitnessError
+			if err := CheckWitness(circuit, circuit); !errors.As(err, &werr) {
+				t.Fatalf("expected a witness error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// PayloadBlocks is the layout of a variable-length JWS part: the part is
+// zero padded to MaxBlocks blocks of BlockSize bytes, with its length and its
+// number of blocks as witnesses, so that one compiled circuit covers every
+// part of up to Size bytes (e.g. SD-JWT payloads of 1 to 8KB) instead of one
+// circuit per size. The zero value is a fixed-size part.
+type PayloadBlocks struct {
+	BlockSize int
+	MaxBlocks int
+}
+
+// Enabled reports whether the part is variable-length
+func (b PayloadBlocks) Enabled() bool {
+	return b.BlockSize > 0 && b.MaxBlocks > 0
+}
+
+// Size is the padded size of the part
+func (b PayloadBlocks) Size() int {
+	return b.BlockSize * b.MaxBlocks
+}
+
+// Count is the number of blocks of a part of n bytes
+func (b PayloadBlocks) Count(n int) int {
+	return (n + b.BlockSize - 1) / b.BlockSize
+}
+
+// Inputs returns the inputs of a circuit template for the part: Size bytes,
+// and one length and one block count
+func (b PayloadBlocks) Inputs() ([]uints.U8, []frontend.Variable, []frontend.Variable) {
+	return make([]uints.U8, b.Size()), make([]frontend.Variable, 1), make([]frontend.Variable, 1)
+}
+
+// Assign returns the assignment of Inputs: the part zero padded to Size, its
+// length and its number of blocks
+func (b PayloadBlocks) Assign(part string) ([]uints.U8, []frontend.Variable, []frontend.Variable, error) {
+	if !b.Enabled() {
+		return nil, nil, nil, fmt.Errorf("payload blocks: no block layout")
+	}
+	if len(part) == 0 || len(part) > b.Size() {
+		return nil, nil, nil, fmt.Errorf("payload blocks: part of %d bytes exceeds %d blocks of %d bytes", len(part), b.MaxBlocks, b.BlockSize)
+	}
+	padded := make([]byte, b.Size())
+	copy(padded, part)
+	return BytesToU8Array(padded), []frontend.Variable{len(part)}, []frontend.Variable{b.Count(len(part))}, nil
+}
+
+// Part returns the JWS part of the padded bytes (the inputs of Inputs), after
+// asserting its block count, 1 <= count <= MaxBlocks and (count-1)*BlockSize
+// < length <= count*BlockSize, and that the bytes past the length are zero: a
+// padded part has a single assignment.
+func (b PayloadBlocks) Part(api frontend.API, bytes []uints.U8, lengths, counts []frontend.Variable) (JWSPart, error) {
+	if !b.Enabled() {
+		return JWSPart{}, fmt.Errorf("payload blocks: no block layout")
+	}
+	if len(bytes) != b.Size() || len(lengths) != 1 || len(counts) != 1 {
+		return JWSPart{}, fmt.Errorf("payload blocks: inputs must be %d bytes, one length and one count", b.Size())
+	}
+	length, count := lengths[0], counts[0]
+
+	api.AssertIsLessOrEqual(1, count)
+	api.AssertIsLessOrEqual(count, b.MaxBlocks)
+	api.AssertIsLessOrEqual(api.Add(api.Mul(api.Sub(count, 1), b.BlockSize), 1), length)
+	api.AssertIsLessOrEqual(length, api.Mul(count, b.BlockSize))
+
+	assertZeroPast(api, bytes, length)
+	return JWSPart{Bytes: bytes, Len: length}, nil
+}
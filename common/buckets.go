@@ -0,0 +1,80 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// ErrNoBucket is returned for a size larger than the largest bucket
+var ErrNoBucket = errors.New("no size bucket")
+
+// SizeBuckets are the sizes, increasing, the public byte inputs of the
+// circuits are padded to. The size of a public input is part of the verifying
+// key and of the public witness: sized to its value (a CRL, a claim of a
+// given credential type), it tells the verifiers which credential is
+// presented. Padded to a bucket, it only tells the bucket, shared by every
+// value up to its size.
+type SizeBuckets []int
+
+// DefaultSizeBuckets are powers of two from 16 bytes to 16KB
+var DefaultSizeBuckets = SizeBuckets{16, 32, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384}
+
+// Validate checks the buckets are positive and increasing
+func (b SizeBuckets) Validate() error {
+	if len(b) == 0 {
+		return fmt.Errorf("size buckets: no bucket")
+	}
+	for i, size := range b {
+		if size <= 0 || i > 0 && size <= b[i-1] {
+			return fmt.Errorf("size buckets: bucket %d of %d bytes is not positive and increasing", i, size)
+		}
+	}
+	return nil
+}
+
+// Bucket returns the smallest bucket of at least n bytes
+func (b SizeBuckets) Bucket(n int) (int, error) {
+	i, _ := slices.BinarySearch(b, n)
+	if i == len(b) {
+		return 0, fmt.Errorf("%w of %d bytes", ErrNoBucket, n)
+	}
+	return b[i], nil
+}
+
+// Contains reports whether size is a bucket
+func (b SizeBuckets) Contains(size int) bool {
+	_, ok := slices.BinarySearch(b, size)
+	return ok
+}
+
+// Pad returns data zero padded to its bucket
+func (b SizeBuckets) Pad(data []byte) ([]byte, error) {
+	size, err := b.Bucket(len(data))
+	if err != nil {
+		return nil, err
+	}
+	padded := make([]byte, size)
+	copy(padded, data)
+	return padded, nil
+}
+
+// AssertZeroPadded asserts the bytes past length are zero and length is at
+// most len(bytes): a padded value then has a single assignment, and its
+// length may stay secret while the padded bytes are public
+func AssertZeroPadded(api frontend.API, bytes []uints.U8, length frontend.Variable) {
+	api.AssertIsLessOrEqual(length, len(bytes))
+	assertZeroPast(api, bytes, length)
+}
+
+// assertZeroPast asserts the bytes past length are zero
+func assertZeroPast(api frontend.API, bytes []uints.U8, length frontend.Variable) {
+	inValue := frontend.Variable(1)
+	for i, v := range bytes {
+		inValue = api.Sub(inValue, api.IsZero(api.Sub(length, i)))
+		api.AssertIsEqual(api.Mul(api.Sub(1, inValue), v.Val), 0)
+	}
+}
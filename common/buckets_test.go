@@ -0,0 +1,54 @@
+package common_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// zeroPaddedCircuit exposes a value padded to its bucket, its length secret
+type zeroPaddedCircuit struct {
+	Length frontend.Variable
+	Value  []uints.U8 `gnark:",public"`
+}
+
+func (c *zeroPaddedCircuit) Define(api frontend.API) error {
+	common.AssertZeroPadded(api, c.Value, c.Length)
+	return nil
+}
+
+func TestSizeBuckets(t *testing.T) {
+	buckets := common.SizeBuckets{16, 32, 64}
+	if err := buckets.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for n, expected := range map[int]int{0: 16, 16: 16, 17: 32, 64: 64} {
+		if size, err := buckets.Bucket(n); err != nil || size != expected {
+			t.Errorf("%d bytes: bucket %d, expected %d: %v", n, size, expected, err)
+		}
+	}
+	if _, err := buckets.Bucket(65); !errors.Is(err, common.ErrNoBucket) {
+		t.Fatalf("expected ErrNoBucket, got %v", err)
+	}
+	if err := (common.SizeBuckets{32, 32}).Validate(); err == nil {
+		t.Fatal("expected an error for a repeated bucket")
+	}
+
+	padded, err := buckets.Pad([]byte("Erika"))
+	if err != nil || len(padded) != 16 {
+		t.Fatalf("unexpected padding %q: %v", padded, err)
+	}
+	circuitTemplate := &zeroPaddedCircuit{Value: make([]uints.U8, 16)}
+	if err := common.CheckWitness(circuitTemplate, &zeroPaddedCircuit{Length: 5, Value: common.BytesToU8Array(padded)}); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+	// a length cutting the value, or past the padding
+	for _, length := range []int{4, 17} {
+		if err := common.CheckWitness(circuitTemplate, &zeroPaddedCircuit{Length: length, Value: common.BytesToU8Array(padded)}); err == nil {
+			t.Errorf("length %d: expected the witness check to fail", length)
+		}
+	}
+}
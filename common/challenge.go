@@ -0,0 +1,196 @@
+package common
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// DeriveChallenge derives in-circuit the non-interactive challenge of
+// models.DeriveChallenge, for flows without a verifier issuing nonces:
+//
+//	SHA-256(SHA-256(payload) || audienceDigest || window (8 bytes) || granularity (8 bytes))
+//
+// audienceDigest is the SHA-256 digest of the audience (verifier identifier),
+// window the big-endian index of the time window (unix time / granularity)
+// and granularity the big-endian window size in seconds. The verifier checks
+// the window against its own clock, the granularity bounds the replay window.
+func DeriveChallenge(api frontend.API, payload, audienceDigest, window, granularity []uints.U8) ([]uints.U8, error) {
+	return DeriveChallengePart(api, JWSPart{Bytes: payload}, audienceDigest, window, granularity)
+}
+
+// DeriveChallengePart is DeriveChallenge for a payload zero padded to its
+// length (see PayloadBlocks): the payload digest covers the first Len bytes
+func DeriveChallengePart(api frontend.API, payload JWSPart, audienceDigest, window, granularity []uints.U8) ([]uints.U8, error) {
+	if len(audienceDigest) != 32 {
+		return nil, fmt.Errorf("audience digest must be 32 bytes, got %d", len(audienceDigest))
+	}
+	if len(window) != 8 || len(granularity) != 8 {
+		return nil, fmt.Errorf("time window and granularity must be 8 bytes, got %d and %d", len(window), len(granularity))
+	}
+
+	var payloadDigest []uints.U8
+	if payload.Len == nil {
+		digest, err := SHA256(api, payload.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		payloadDigest = digest
+	} else {
+		h, release, err := NewSHA256(api)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		h.Write(payload.Bytes)
+		payloadDigest = h.FixedLengthSum(payload.Len)
+	}
+
+	preimage := make([]uints.U8, 0, 32+32+8+8)
+	preimage = append(preimage, payloadDigest...)
+	preimage = append(preimage, audienceDigest...)
+	preimage = append(preimage, window...)
+	preimage = append(preimage, granularity...)
+
+	return SHA256(api, preimage)
+}
+
+// ChallengeTimestampField is the name of the public timestamp input of the
+// circuits with timestamped challenges (TimestampedChallenge), located in the
+// public witness by models.PresentationVerifier.AddTimestamp
+const ChallengeTimestampField = "ChallengeTimestamp"
+
+// TimestampedChallenge returns the message the holder signs for a verifier
+// supplied timestamp, as models.TimestampedChallenge:
+//
+//	challenge || timestamp (8 bytes, big-endian unix seconds)
+//
+// timestamp is a public input the verifier checks against its clock
+// (models.TimestampPolicy): a fresh signature proves the holder key was used
+// recently, not replayed from a stored signature.
+func TimestampedChallenge(api frontend.API, challenge []uints.U8, timestamp frontend.Variable) ([]uints.U8, error) {
+	bf, err := uints.NewBytes(api)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bytes API: %w", err)
+	}
+
+	// the decomposition bounds the timestamp to 64 bits
+	bits := api.ToBinary(timestamp, 64)
+	message := make([]uints.U8, 0, len(challenge)+8)
+	message = append(message, challenge...)
+	for i := 7; i >= 0; i-- {
+		message = append(message, bf.ValueOf(api.FromBinary(bits[8*i:8*i+8]...)))
+	}
+	return message, nil
+}
+
+// Public inputs of the circuits with transcript challenges
+// (TranscriptChallenge), located in the public witness by
+// models.PresentationVerifier.AddTranscript. The nonce is the Challenge input.
+const (
+	TranscriptNonceField       = "Challenge"
+	TranscriptVerifierIDField  = "TranscriptVerifierID"
+	TranscriptResponseURIField = "TranscriptResponseURI"
+	TranscriptVPFormatsField   = "TranscriptVPFormats"
+)
+
+// TranscriptChallenge derives in-circuit the challenge of a session
+// transcript, as models.SessionTranscript.Challenge:
+//
+//	SHA-256(nonce || verifierID || responseURI || vpFormats)
+//
+// The components are public inputs the verifier compares with its own
+// request, each zero padded to its size in the circuit: the fixed boundaries
+// keep the concatenation unambiguous. A signature over the challenge cannot be
+// replayed to another verifier, response endpoint or presentation protocol,
+// even for the same nonce.
+func TranscriptChallenge(api frontend.API, nonce, verifierID, responseURI, vpFormats []uints.U8) ([]uints.U8, error) {
+	if len(nonce) == 0 {
+		return nil, fmt.Errorf("transcript challenge needs a nonce")
+	}
+
+	preimage := make([]uints.U8, 0, len(nonce)+len(verifierID)+len(responseURI)+len(vpFormats))
+	preimage = append(preimage, nonce...)
+	preimage = append(preimage, verifierID...)
+	preimage = append(preimage, responseURI...)
+	preimage = append(preimage, vpFormats...)
+
+	return SHA256(api, preimage)
+}
+
+// PINDigestSize is the size of the PIN digest and of the PIN commitment of
+// PINChallenge
+const PINDigestSize = 32
+
+// PINChallenge returns the message the holder signs with a PIN co-bound to
+// its key, as models.PINChallenge, and the commitment to the PIN:
+//
+//	message    = SHA-256(challenge || pinDigest)
+//	commitment = SHA-256(salt || pinDigest)
+//
+// pinDigest is the Argon2id digest of the PIN (models.PINDigest), salt a
+// random secret of the holder. Both stay private; the verifier compares the
+// public commitment with the one enrolled for the holder, so a proof needs the
+// key and the PIN. The commitment alone does not reveal the PIN, but with the
+// salt it can be brute-forced offline at one Argon2id per guess, so the salt
+// must not be stored in the clear with the key (see models.PINCommitment).
+func PINChallenge(api frontend.API, challenge, pinDigest, salt []uints.U8) (message, commitment []uints.U8, err error) {
+	if len(pinDigest) != PINDigestSize {
+		return nil, nil, fmt.Errorf("PIN digest must be %d bytes, got %d", PINDigestSize, len(pinDigest))
+	}
+	if len(salt) < 16 {
+		return nil, nil, fmt.Errorf("PIN salt must be at least 16 bytes, got %d", len(salt))
+	}
+
+	preimage := make([]uints.U8, 0, len(challenge)+PINDigestSize)
+	preimage = append(preimage, challenge...)
+	preimage = append(preimage, pinDigest...)
+	if message, err = SHA256(api, preimage); err != nil {
+		return nil, nil, err
+	}
+
+	preimage = make([]uints.U8, 0, len(salt)+PINDigestSize)
+	preimage = append(preimage, salt...)
+	preimage = append(preimage, pinDigest...)
+	if commitment, err = SHA256(api, preimage); err != nil {
+		return nil, nil, err
+	}
+	return message, commitment, nil
+}
+
+// Signing contexts of the holder key. The holder key signs the challenges of
+// the verifiers and the messages of the issuer protocols: each message is
+// signed in its context (ContextMessage), so a signature obtained in one
+// protocol, e.g. over a challenge chosen by a malicious verifier, does not
+// verify in another.
+const (
+	// SigningContextChallenge is the context of the verifier challenges of
+	// the presentation circuits
+	SigningContextChallenge = "eudi-zk/v1/presentation-challenge"
+	// SigningContextIssuance is the context of the key proofs sent to an
+	// issuer, e.g. a CircuitPoP proof of the c_nonce of a credential request
+	SigningContextIssuance = "eudi-zk/v1/credential-issuance"
+)
+
+// ContextMessage derives in-circuit the message the holder key signs in a
+// signing context, as models.ContextMessage:
+//
+//	SHA-256(SHA-256(context) || message)
+//
+// The context is a constant of the circuit: the digest has a fixed size, so
+// no context is a prefix of another.
+func ContextMessage(api frontend.API, context string, message []uints.U8) ([]uints.U8, error) {
+	if context == "" {
+		return nil, fmt.Errorf("empty signing context")
+	}
+	contextDigest := sha256.Sum256([]byte(context))
+
+	preimage := make([]uints.U8, 0, len(contextDigest)+len(message))
+	for _, b := range contextDigest {
+		preimage = append(preimage, uints.NewU8(b))
+	}
+	preimage = append(preimage, message...)
+	return SHA256(api, preimage)
+}
@@ -0,0 +1,292 @@
+package common_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+type deriveChallengeCircuit struct {
+	Payload           []uints.U8 `gnark:",public"`
+	AudienceDigest    []uints.U8 `gnark:",public"`
+	TimeWindow        []uints.U8 `gnark:",public"`
+	WindowGranularity []uints.U8 `gnark:",public"`
+	Challenge         []uints.U8 `gnark:",public"`
+}
+
+func (c *deriveChallengeCircuit) Define(api frontend.API) error {
+	challenge, err := common.DeriveChallenge(api, c.Payload, c.AudienceDigest, c.TimeWindow, c.WindowGranularity)
+	if err != nil {
+		return err
+	}
+	common.AssertBytesEqual(api, challenge, c.Challenge, "derived challenge")
+	return nil
+}
+
+// TestDeriveChallenge checks the in-circuit derivation matches
+// models.DeriveChallenge and binds the payload, audience and window
+func TestDeriveChallenge(t *testing.T) {
+	payload := []byte("eyJzdWIiOiIxMjM0NTY3ODkwIn0")
+	ctx, err := models.NewChallengeContext("https://verifier.example", time.Unix(1700000000, 0), 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := models.DeriveChallenge(payload, ctx)
+
+	circuitTemplate := &deriveChallengeCircuit{
+		Payload:           make([]uints.U8, len(payload)),
+		AudienceDigest:    make([]uints.U8, 32),
+		TimeWindow:        make([]uints.U8, 8),
+		WindowGranularity: make([]uints.U8, 8),
+		Challenge:         make([]uints.U8, 32),
+	}
+	assignment := func(ctx models.ChallengeContext, payload []byte) *deriveChallengeCircuit {
+		return &deriveChallengeCircuit{
+			Payload:           common.BytesToU8Array(payload),
+			AudienceDigest:    common.BytesToU8Array(ctx.AudienceDigest()),
+			TimeWindow:        common.BytesToU8Array(ctx.WindowBytes()),
+			WindowGranularity: common.BytesToU8Array(ctx.GranularityBytes()),
+			Challenge:         common.BytesToU8Array(challenge),
+		}
+	}
+
+	if err := common.CheckWitness(circuitTemplate, assignment(ctx, payload)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	otherAudience, otherWindow, otherGranularity := ctx, ctx, ctx
+	otherAudience.Audience = "https://other.example"
+	otherWindow.Window++
+	otherGranularity.Granularity = time.Hour
+	otherPayload := []byte("eyJzdWIiOiIxMjM0NTY3ODkxIn0")
+
+	for name, a := range map[string]*deriveChallengeCircuit{
+		"audience":    assignment(otherAudience, payload),
+		"window":      assignment(otherWindow, payload),
+		"granularity": assignment(otherGranularity, payload),
+		"payload":     assignment(ctx, otherPayload),
+	} {
+		if err := common.CheckWitness(circuitTemplate, a); err == nil {
+			t.Errorf("%s: expected the witness check to fail", name)
+		}
+	}
+}
+
+func TestChallengeWindowPolicy(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	policy := models.ChallengeWindowPolicy{MaxGranularity: 10 * time.Minute, MaxSkew: 1}
+
+	ctx, err := models.NewChallengeContext("aud", now, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Verify(ctx, "aud", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Verify(ctx, "aud", now.Add(5*time.Minute)); err != nil {
+		t.Fatalf("previous window within the skew: %v", err)
+	}
+	if err := policy.Verify(ctx, "aud", now.Add(15*time.Minute)); err == nil {
+		t.Fatal("expected an expired window to be rejected")
+	}
+	if err := policy.Verify(ctx, "other", now); err == nil {
+		t.Fatal("expected another audience to be rejected")
+	}
+
+	coarse, _ := models.NewChallengeContext("aud", now, time.Hour)
+	if err := policy.Verify(coarse, "aud", now); err == nil {
+		t.Fatal("expected a granularity above the policy to be rejected")
+	}
+	if _, err := models.NewChallengeContext("aud", now, 1500*time.Millisecond); err == nil {
+		t.Fatal("expected a granularity that is not whole seconds to be rejected")
+	}
+}
+
+type timestampedChallengeCircuit struct {
+	Challenge          []uints.U8        `gnark:",public"`
+	ChallengeTimestamp frontend.Variable `gnark:",public"`
+	Message            []uints.U8        `gnark:",public"`
+}
+
+func (c *timestampedChallengeCircuit) Define(api frontend.API) error {
+	message, err := common.TimestampedChallenge(api, c.Challenge, c.ChallengeTimestamp)
+	if err != nil {
+		return err
+	}
+	common.AssertBytesEqual(api, message, c.Message, "timestamped challenge")
+	return nil
+}
+
+// TestTimestampedChallenge checks the in-circuit message matches
+// models.TimestampedChallenge and binds the timestamp
+func TestTimestampedChallenge(t *testing.T) {
+	challenge := []byte("verifier-nonce-0123456789abcdef")
+	timestamp := time.Unix(1700000000, 0)
+	message := models.TimestampedChallenge(challenge, timestamp)
+
+	circuitTemplate := &timestampedChallengeCircuit{
+		Challenge: make([]uints.U8, len(challenge)),
+		Message:   make([]uints.U8, len(message)),
+	}
+	assignment := func(timestamp time.Time) *timestampedChallengeCircuit {
+		return &timestampedChallengeCircuit{
+			Challenge:          common.BytesToU8Array(challenge),
+			ChallengeTimestamp: timestamp.Unix(),
+			Message:            common.BytesToU8Array(message),
+		}
+	}
+
+	if err := common.CheckWitness(circuitTemplate, assignment(timestamp)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment(timestamp.Add(time.Second))); err == nil {
+		t.Fatal("expected another timestamp to fail the witness check")
+	}
+}
+
+func TestTimestampPolicy(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	policy := models.TimestampPolicy{MaxSkew: time.Minute}
+
+	if err := policy.Verify(now.Add(-time.Minute), now); err != nil {
+		t.Fatalf("timestamp within the skew: %v", err)
+	}
+	if err := policy.Verify(now.Add(time.Minute+time.Second), now); !errors.Is(err, models.ErrStaleTimestamp) {
+		t.Fatalf("expected a future timestamp to be rejected, got %v", err)
+	}
+	if err := policy.Verify(now.Add(-time.Hour), now); !errors.Is(err, models.ErrStaleTimestamp) {
+		t.Fatalf("expected a replayed timestamp to be rejected, got %v", err)
+	}
+}
+
+type transcriptChallengeCircuit struct {
+	Challenge             []uints.U8 `gnark:",public"`
+	TranscriptVerifierID  []uints.U8 `gnark:",public"`
+	TranscriptResponseURI []uints.U8 `gnark:",public"`
+	TranscriptVPFormats   []uints.U8 `gnark:",public"`
+	Signed                []uints.U8 `gnark:",public"`
+}
+
+func (c *transcriptChallengeCircuit) Define(api frontend.API) error {
+	challenge, err := common.TranscriptChallenge(api, c.Challenge, c.TranscriptVerifierID, c.TranscriptResponseURI, c.TranscriptVPFormats)
+	if err != nil {
+		return err
+	}
+	common.AssertBytesEqual(api, challenge, c.Signed, "transcript challenge")
+	return nil
+}
+
+// TestTranscriptChallenge checks the in-circuit challenge matches
+// models.SessionTranscript.Challenge and binds every component
+func TestTranscriptChallenge(t *testing.T) {
+	layout := models.TranscriptLayout{Nonce: 16, VerifierID: 48, ResponseURI: 64, VPFormats: 32}
+	transcript := models.SessionTranscript{
+		Nonce:       []byte("0123456789abcdef"),
+		VerifierID:  "x509_san_dns:verifier.example",
+		ResponseURI: "https://verifier.example/response",
+		VPFormats:   `{"zk+jwt":{"alg":["ES256"]}}`,
+	}
+	challenge, err := transcript.Challenge(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circuitTemplate := &transcriptChallengeCircuit{
+		Challenge:             make([]uints.U8, layout.Nonce),
+		TranscriptVerifierID:  make([]uints.U8, layout.VerifierID),
+		TranscriptResponseURI: make([]uints.U8, layout.ResponseURI),
+		TranscriptVPFormats:   make([]uints.U8, layout.VPFormats),
+		Signed:                make([]uints.U8, 32),
+	}
+	if got, err := models.NewTranscriptLayout(circuitTemplate); err != nil || got != layout {
+		t.Fatalf("unexpected layout %+v: %v", got, err)
+	}
+	assignment := func(transcript models.SessionTranscript) *transcriptChallengeCircuit {
+		t.Helper()
+		nonce, verifierID, responseURI, vpFormats, err := transcript.Components(layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &transcriptChallengeCircuit{
+			Challenge:             common.BytesToU8Array(nonce),
+			TranscriptVerifierID:  common.BytesToU8Array(verifierID),
+			TranscriptResponseURI: common.BytesToU8Array(responseURI),
+			TranscriptVPFormats:   common.BytesToU8Array(vpFormats),
+			Signed:                common.BytesToU8Array(challenge),
+		}
+	}
+
+	if err := common.CheckWitness(circuitTemplate, assignment(transcript)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+
+	otherNonce, otherVerifier, otherResponse, otherFormats := transcript, transcript, transcript, transcript
+	otherNonce.Nonce = []byte("fedcba9876543210")
+	otherVerifier.VerifierID = "x509_san_dns:attacker.example"
+	otherResponse.ResponseURI = "https://attacker.example/response"
+	otherFormats.VPFormats = `{"mso_mdoc":{}}`
+	for name, a := range map[string]*transcriptChallengeCircuit{
+		"nonce":        assignment(otherNonce),
+		"verifier id":  assignment(otherVerifier),
+		"response uri": assignment(otherResponse),
+		"vp formats":   assignment(otherFormats),
+	} {
+		if err := common.CheckWitness(circuitTemplate, a); err == nil {
+			t.Errorf("%s: expected the witness check to fail", name)
+		}
+	}
+
+	tooLong, zeroByte := transcript, transcript
+	tooLong.ResponseURI = "https://verifier.example/" + strings.Repeat("a", 64)
+	zeroByte.VerifierID = "verifier\x00"
+	for name, transcript := range map[string]models.SessionTranscript{"too long": tooLong, "zero byte": zeroByte} {
+		if _, err := transcript.Challenge(layout); err == nil {
+			t.Errorf("%s: expected the transcript to be rejected", name)
+		}
+	}
+}
+
+type contextMessageCircuit struct {
+	Message        []uints.U8 `gnark:",public"`
+	ContextMessage []uints.U8 `gnark:",public"`
+
+	context string
+}
+
+func (c *contextMessageCircuit) Define(api frontend.API) error {
+	message, err := common.ContextMessage(api, c.context, c.Message)
+	if err != nil {
+		return err
+	}
+	common.AssertBytesEqual(api, message, c.ContextMessage, "context message")
+	return nil
+}
+
+// TestContextMessage checks the in-circuit message matches
+// models.ContextMessage and differs between the signing contexts
+func TestContextMessage(t *testing.T) {
+	challenge := []byte("verifier challenge")
+	template := func(context string) *contextMessageCircuit {
+		return &contextMessageCircuit{Message: make([]uints.U8, len(challenge)), ContextMessage: make([]uints.U8, 32), context: context}
+	}
+	assignment := func(message []byte) *contextMessageCircuit {
+		return &contextMessageCircuit{Message: common.BytesToU8Array(challenge), ContextMessage: common.BytesToU8Array(message)}
+	}
+
+	message := models.ContextMessage(models.SigningContextChallenge, challenge)
+	if err := common.CheckWitness(template(common.SigningContextChallenge), assignment(message)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+	if err := common.CheckWitness(template(common.SigningContextIssuance), assignment(message)); err == nil {
+		t.Error("expected an error for the message of another context")
+	}
+	if err := common.CheckWitness(template(""), assignment(message)); err == nil || !strings.Contains(err.Error(), "empty signing context") {
+		t.Errorf("expected an empty context error, got %v", err)
+	}
+}
@@ -1,70 +1,182 @@
 package common
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/mynextid/eudi-zk/artifact"
 )
 
+// KeyEncoding selects how the proving key is serialized on disk. The
+// encoding is recorded in the manifest of the circuit artifacts
+// (CircuitPaths.Manifest, ArtifactManifest), which the loaders dispatch on.
+type KeyEncoding int
+
+const (
+	// KeyEncodingCompressed stores compressed curve points: the smallest file,
+	// but every point is decompressed and subgroup checked when loading
+	KeyEncodingCompressed KeyEncoding = iota
+	// KeyEncodingRaw stores uncompressed curve points: about twice the size of
+	// the compressed key, loaded without decompression nor subgroup checks.
+	// Only load raw keys from trusted storage.
+	KeyEncodingRaw
+)
+
+func (e KeyEncoding) String() string {
+	switch e {
+	case KeyEncodingCompressed:
+		return "compressed"
+	case KeyEncodingRaw:
+		return "raw"
+	}
+	return fmt.Sprintf("KeyEncoding(%d)", int(e))
+}
+
+// ParseKeyEncoding returns the encoding of its name (KeyEncoding.String)
+func ParseKeyEncoding(name string) (KeyEncoding, error) {
+	for _, e := range []KeyEncoding{KeyEncodingCompressed, KeyEncodingRaw} {
+		if name == e.String() {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown key encoding %q", name)
+}
+
+// circuitManifest returns the manifest of the artifacts of a circuit, the
+// proving key (key pkKey) with its encoding, tagged with the hint set of this
+// binary like BuildManifest
+func circuitManifest(artifacts []artifact.ManifestArtifact, pkKey string, encoding KeyEncoding) *artifact.Manifest {
+	for i := range artifacts {
+		if artifacts[i].Key == pkKey {
+			artifacts[i].Encoding = encoding.String()
+		}
+	}
+	m := artifact.NewManifest(artifacts)
+	m.HintSet = HintSetVersion
+	return m
+}
+
+// manifestKeyEncoding returns the encoding of the proving key recorded in the
+// manifest of a circuit, checking the manifest lists the proving key (key
+// pkKey) with its size: a key replaced without its manifest is refused
+// rather than decoded with another encoding
+func manifestKeyEncoding(m *artifact.Manifest, pkKey string, size int64) (KeyEncoding, error) {
+	for _, a := range m.Artifacts {
+		if a.Key != pkKey {
+			continue
+		}
+		if a.Size != size {
+			return 0, fmt.Errorf("%s: %w: %d bytes, the manifest lists %d", pkKey, artifact.ErrDigestMismatch, size, a.Size)
+		}
+		return ParseKeyEncoding(a.Encoding)
+	}
+	return 0, fmt.Errorf("manifest %s does not list the proving key %s", m.Version, pkKey)
+}
+
+// hashingWriter digests and counts the bytes written to w
+type hashingWriter struct {
+	w    io.Writer
+	h    hash.Hash
+	size int64
+}
+
+func newHashingWriter(w io.Writer) *hashingWriter {
+	return &hashingWriter{w: w, h: sha256.New()}
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	hw.size += int64(n)
+	return n, err
+}
+
+// artifact returns the manifest entry of the written artifact
+func (hw *hashingWriter) artifact(key string) artifact.ManifestArtifact {
+	return artifact.ManifestArtifact{Key: key, Size: hw.size, SHA256: hex.EncodeToString(hw.h.Sum(nil))}
+}
+
 // Save compiled circuit and keys
 func SetupAndSave(circuitTemplate frontend.Circuit, ccsPath, pkPath, vkPath string) error {
-	fmt.Println("\n--- Compiling Circuit ---")
-	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuitTemplate)
+	return SetupAndSaveWithEncoding(circuitTemplate, ccsPath, pkPath, vkPath, KeyEncodingCompressed)
+}
+
+// SetupAndSaveWithEncoding saves the compiled circuit and keys, the proving key
+// with the given encoding
+func SetupAndSaveWithEncoding(circuitTemplate frontend.Circuit, ccsPath, pkPath, vkPath string, encoding KeyEncoding) error {
+	_, err := SetupAndSaveStats(circuitTemplate, ccsPath, pkPath, vkPath, encoding)
+	return err
+}
+
+// SetupAndSaveStats is SetupAndSaveWithEncoding returning the stats of the
+// compiled circuit and of its verifying key
+func SetupAndSaveStats(circuitTemplate frontend.Circuit, ccsPath, pkPath, vkPath string, encoding KeyEncoding) (*CircuitStats, error) {
+	ctx := context.Background()
+	ccs, err := CompileCircuit(ctx, circuitTemplate, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	fmt.Printf("[OK] Circuit compiled: %d constraints\n", ccs.GetNbConstraints())
-
-	// Save compiled circuit
-	ccsFile, err := os.Create(ccsPath)
+	pk, vk, err := SetupCircuit(ctx, ccs, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer ccsFile.Close()
-	if _, err := ccs.WriteTo(ccsFile); err != nil {
-		return err
+	// the paths of SetupAndSave are not confined to the working directory
+	// (SaveCircuit validates them)
+	paths := CircuitPaths{CCS: ccsPath, ProvingKey: pkPath, VerifyingKey: vkPath}
+	if err := reportPhase(ctx, nil, PhaseSave, func() error {
+		return saveCircuit(ctx, paths, ccs, pk, vk, encoding)
+	}); err != nil {
+		return nil, err
 	}
 
-	fmt.Println("\n--- Running Setup ---")
-	pk, vk, err := groth16.Setup(ccs)
+	stats, err := StatsOf("", ccs, vk)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	fmt.Printf("[OK] Setup completed and saved! %s, verifying key of %d bytes\n", stats, stats.VKSize)
+	return stats, nil
+}
 
-	// Save proving key
-	pkFile, err := os.Create(pkPath)
+// Load pre-compiled circuit and keys, the proving key with the encoding
+// recorded in its manifest (compressed without manifest). With trusted keys
+// set by SetArtifactProvenance, artifacts without a valid signature are
+// refused.
+func LoadSetup(ccsPath, pkPath, vkPath string) (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey, error) {
+	encoding, err := CircuitPaths{CCS: ccsPath, ProvingKey: pkPath, VerifyingKey: vkPath}.keyEncoding(KeyEncodingCompressed)
 	if err != nil {
-		return err
-	}
-	defer pkFile.Close()
-	if _, err := pk.WriteTo(pkFile); err != nil {
-		return err
+		return nil, nil, nil, err
 	}
+	return LoadSetupWithEncoding(ccsPath, pkPath, vkPath, encoding)
+}
 
-	// Save verification key
-	vkFile, err := os.Create(vkPath)
-	if err != nil {
-		return err
+// LoadSetupWithEncoding loads the pre-compiled circuit and keys, the proving
+// key being stored with the given encoding, whatever its manifest records.
+// In ModeVerifyOnly it returns ErrProvingDisabled.
+func LoadSetupWithEncoding(ccsPath, pkPath, vkPath string, encoding KeyEncoding) (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey, error) {
+	if err := checkProving(); err != nil {
+		return nil, nil, nil, err
 	}
-	defer vkFile.Close()
-	if _, err := vk.WriteTo(vkFile); err != nil {
-		return err
+	// the signatures are verified before parsing the artifacts
+	if trusted := currentProvenance().Trusted; trusted != nil {
+		for kind, path := range map[string]string{ArtifactCCS: ccsPath, ArtifactProvingKey: pkPath, ArtifactVerifyingKey: vkPath} {
+			if err := verifyArtifactFile(trusted, kind, path); err != nil {
+				return nil, nil, nil, err
+			}
+		}
 	}
 
-	fmt.Println("[OK] Setup completed and saved!")
-	return nil
-}
-
-// Load pre-compiled circuit and keys
-func LoadSetup(ccsPath, pkPath, vkPath string) (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey, error) {
 	// Load constraint system
 	ccsFile, err := os.Open(ccsPath)
 	if err != nil {
@@ -76,6 +188,9 @@ func LoadSetup(ccsPath, pkPath, vkPath string) (constraint.ConstraintSystem, gro
 	if _, err := ccs.ReadFrom(ccsFile); err != nil {
 		return nil, nil, nil, err
 	}
+	if err := CheckHints(ccs); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", ccsPath, err)
+	}
 
 	// Load proving key
 	pkFile, err := os.Open(pkPath)
@@ -84,8 +199,8 @@ func LoadSetup(ccsPath, pkPath, vkPath string) (constraint.ConstraintSystem, gro
 	}
 	defer pkFile.Close()
 
-	pk := groth16.NewProvingKey(ecc.BN254)
-	if _, err := pk.ReadFrom(pkFile); err != nil {
+	pk, err := readProvingKey(bufio.NewReaderSize(pkFile, 1<<20), encoding)
+	if err != nil {
 		return nil, nil, nil, err
 	}
 
@@ -105,6 +220,39 @@ func LoadSetup(ccsPath, pkPath, vkPath string) (constraint.ConstraintSystem, gro
 	return ccs, pk, vk, nil
 }
 
+// writeProvingKey serializes the proving key with the given encoding
+func writeProvingKey(w io.Writer, pk groth16.ProvingKey, encoding KeyEncoding) error {
+	var err error
+	switch encoding {
+	case KeyEncodingCompressed:
+		_, err = pk.WriteTo(w)
+	case KeyEncodingRaw:
+		_, err = pk.WriteRawTo(w)
+	default:
+		err = fmt.Errorf("unknown key encoding %s", encoding)
+	}
+	return err
+}
+
+// readProvingKey deserializes a proving key stored with the given encoding
+func readProvingKey(r io.Reader, encoding KeyEncoding) (groth16.ProvingKey, error) {
+	pk := groth16.NewProvingKey(ecc.BN254)
+
+	var err error
+	switch encoding {
+	case KeyEncodingCompressed:
+		_, err = pk.ReadFrom(r)
+	case KeyEncodingRaw:
+		_, err = pk.UnsafeReadFrom(r)
+	default:
+		err = fmt.Errorf("unknown key encoding %s", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
 func validatePath(path string) error {
 	// Get the current working directory (execution directory)
 	baseDir, err := os.Getwd()
@@ -164,60 +312,3 @@ func fileExists(path string) bool {
 	}
 	return err == nil && !info.IsDir()
 }
-
-// safeRemove removes a file only if it exists and after thorough validation
-func safeRemove(path string) error {
-	// Validate path is within allowed directory
-	if err := validatePath(path); err != nil {
-		return err
-	}
-
-	// Get working directory for joining
-	baseDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get working directory: %w", err)
-	}
-
-	// Create full path
-	fullPath := filepath.Join(baseDir, filepath.Clean(path))
-
-	// Lstat (don't follow symlinks) to check what we're actually removing
-	info, err := os.Lstat(fullPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// File doesn't exist - this is fine, nothing to remove
-			return nil
-		}
-		return fmt.Errorf("failed to stat file: %w", err)
-	}
-
-	// Security check: Ensure it's a regular file, not a symlink or directory
-	if !info.Mode().IsRegular() {
-		if info.Mode()&os.ModeSymlink != 0 {
-			return fmt.Errorf("refusing to remove symlink: %s", path)
-		}
-		if info.Mode().IsDir() {
-			return fmt.Errorf("refusing to remove directory: %s", path)
-		}
-		return fmt.Errorf("refusing to remove special file: %s", path)
-	}
-
-	//Check file ownership/permissions
-	stat, ok := info.Sys().(*syscall.Stat_t)
-	if ok && stat.Uid != uint32(os.Getuid()) {
-		// Only remove files owned by current user
-		return fmt.Errorf("refusing to remove file not owned by process: %s", path)
-	}
-
-	// Final validation right before removal
-	if err := validatePath(path); err != nil {
-		return err
-	}
-
-	// Remove the file
-	if err := os.Remove(fullPath); err != nil {
-		return fmt.Errorf("failed to remove file %s: %w", path, err)
-	}
-
-	return nil
-}
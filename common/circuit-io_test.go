@@ -0,0 +1,94 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+// powerCircuit proves Y = X^(N+1) with N multiplications
+type powerCircuit struct {
+	N int `gnark:"-"`
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *powerCircuit) Define(api frontend.API) error {
+	res := c.X
+	for range c.N {
+		res = api.Mul(res, c.X)
+	}
+	api.AssertIsEqual(res, c.Y)
+	return nil
+}
+
+func setupPowerCircuit(tb testing.TB, n int) groth16.ProvingKey {
+	tb.Helper()
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &powerCircuit{N: n})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pk, _, err := groth16.Setup(ccs)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return pk
+}
+
+func TestProvingKeyEncoding(t *testing.T) {
+	pk := setupPowerCircuit(t, 1<<8)
+
+	sizes := map[KeyEncoding]int{}
+	for _, encoding := range []KeyEncoding{KeyEncodingCompressed, KeyEncodingRaw} {
+		var buf bytes.Buffer
+		if err := writeProvingKey(&buf, pk, encoding); err != nil {
+			t.Fatal(err)
+		}
+		sizes[encoding] = buf.Len()
+
+		read, err := readProvingKey(&buf, encoding)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		var expected, actual bytes.Buffer
+		pk.WriteRawTo(&expected)
+		read.WriteRawTo(&actual)
+		if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+			t.Fatalf("%s: proving key changed after round trip", encoding)
+		}
+	}
+
+	if sizes[KeyEncodingCompressed] >= sizes[KeyEncodingRaw] {
+		t.Fatalf("compressed key (%d bytes) not smaller than raw key (%d bytes)", sizes[KeyEncodingCompressed], sizes[KeyEncodingRaw])
+	}
+}
+
+// BenchmarkReadProvingKey compares the load time and the size of compressed
+// and raw proving keys:
+//
+//	go test -run ^$ -bench ReadProvingKey ./common
+func BenchmarkReadProvingKey(b *testing.B) {
+	pk := setupPowerCircuit(b, 1<<14)
+
+	for _, encoding := range []KeyEncoding{KeyEncodingCompressed, KeyEncodingRaw} {
+		var buf bytes.Buffer
+		if err := writeProvingKey(&buf, pk, encoding); err != nil {
+			b.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		b.Run(fmt.Sprint(encoding), func(b *testing.B) {
+			b.ReportMetric(float64(len(data)), "bytes/key")
+			for b.Loop() {
+				if _, err := readProvingKey(bytes.NewReader(data), encoding); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
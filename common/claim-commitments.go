@@ -0,0 +1,65 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// Salted claim commitments: a circuit committing to claims exposes a public
+// field named ClaimCommitmentsField of type []frontend.Variable, one slot per
+// claim and per decoy:
+//
+//	claim = SHA-256(salt || name || value)[:31], big-endian
+//	decoy = SHA-256(salt)[:31], big-endian
+//
+// The salts are secret and fresh for every presentation, so the same claim
+// gives unrelated commitments in two presentations, unlike the attribute
+// digests (AssertAttributes). The holder opens the claims it reveals with
+// their salt (verifier.ClaimOpening); the decoys cannot be told apart from the
+// unopened claims, nor the number of claims from the number of slots.
+
+// ClaimCommitmentsField is the name of the circuit field holding the claim
+// commitments
+const ClaimCommitmentsField = "Commitments"
+
+// MinClaimSaltSize is the smallest salt of a claim commitment
+const MinClaimSaltSize = 16
+
+// ClaimCommitment returns the salted commitment of the claim name = value.
+// length is the length of a zero padded value, nil for the whole value.
+func ClaimCommitment(api frontend.API, salt []uints.U8, name string, value []uints.U8, length frontend.Variable) (frontend.Variable, error) {
+	if len(salt) < MinClaimSaltSize {
+		return nil, fmt.Errorf("claim %q: salt of %d bytes, at least %d", name, len(salt), MinClaimSaltSize)
+	}
+	h, release, err := NewSHA256(api)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	h.Write(salt)
+	h.Write(StringToU8Array(name))
+	h.Write(value)
+
+	var digest []uints.U8
+	if length == nil {
+		digest = h.Sum()
+	} else {
+		digest = h.FixedLengthSum(api.Add(len(salt)+len(name), length))
+	}
+	return packBytes(api, digest[:AttributeDigestSize]), nil
+}
+
+// DecoyCommitment returns the commitment of a decoy slot, indistinguishable
+// from a claim commitment without the salt
+func DecoyCommitment(api frontend.API, salt []uints.U8) (frontend.Variable, error) {
+	if len(salt) < MinClaimSaltSize {
+		return nil, fmt.Errorf("decoy salt of %d bytes, at least %d", len(salt), MinClaimSaltSize)
+	}
+	digest, err := SHA256(api, salt)
+	if err != nil {
+		return nil, err
+	}
+	return packBytes(api, digest[:AttributeDigestSize]), nil
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// ClaimsHash computes in-circuit the claims hash of models.ClaimsHash:
+//
+//	SHA-256(salt || len(name) || name || len(value) (2 bytes) || value || ...)
+//
+// The claim names are compile-time constants and must be sorted, names[i]
+// names values[i]. The value lengths are the (compile-time) slice lengths.
+func ClaimsHash(api frontend.API, salt []uints.U8, names []string, values [][]uints.U8) ([]uints.U8, error) {
+	if len(names) != len(values) {
+		return nil, fmt.Errorf("%d claim names for %d values", len(names), len(values))
+	}
+	if !slices.IsSorted(names) {
+		return nil, fmt.Errorf("claim names are not sorted: %v", names)
+	}
+
+	preimage := slices.Clone(salt)
+	for i, name := range names {
+		if name == "" || len(name) > 0xff || (i > 0 && names[i-1] == name) {
+			return nil, fmt.Errorf("invalid claim name %q", name)
+		}
+		if len(values[i]) > 0xffff {
+			return nil, fmt.Errorf("claim %q value too long: %d bytes", name, len(values[i]))
+		}
+
+		preimage = append(preimage, uints.NewU8(uint8(len(name))))
+		preimage = append(preimage, StringToU8Array(name)...)
+		preimage = append(preimage, uints.NewU8(uint8(len(values[i])>>8)), uints.NewU8(uint8(len(values[i]))))
+		preimage = append(preimage, values[i]...)
+	}
+
+	return SHA256(api, preimage)
+}
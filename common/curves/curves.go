@@ -0,0 +1,53 @@
+// Package curves holds the emulated field parameters of the curves of the
+// circuits and the circuit types of their ECDSA keys and signatures:
+// secp256r1 (P-256) of the eIDAS certificates and the EUDI credentials, and
+// secp256k1 of the keys held in crypto wallets.
+package curves
+
+import (
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/signature/ecdsa"
+)
+
+// Secp256r1 field parameters
+type Secp256r1Fp = emulated.P256Fp
+type Secp256r1Fr = emulated.P256Fr
+
+// Secp256k1 field parameters
+type Secp256k1Fp = emulated.Secp256k1Fp
+type Secp256k1Fr = emulated.Secp256k1Fr
+
+// PublicKey and Signature are the circuit types of a secp256r1 ECDSA key and
+// signature
+type (
+	PublicKey = ecdsa.PublicKey[Secp256r1Fp, Secp256r1Fr]
+	Signature = ecdsa.Signature[Secp256r1Fr]
+)
+
+// Secp256k1PublicKey and Secp256k1Signature are the circuit types of a
+// secp256k1 ECDSA key and signature
+type (
+	Secp256k1PublicKey = ecdsa.PublicKey[Secp256k1Fp, Secp256k1Fr]
+	Secp256k1Signature = ecdsa.Signature[Secp256k1Fr]
+)
+
+// NewPublicKey returns the secp256r1 public key of coordinates x and y
+func NewPublicKey(x, y emulated.Element[Secp256r1Fp]) PublicKey {
+	return PublicKey{X: x, Y: y}
+}
+
+// NewSignature returns the secp256r1 signature (r, s)
+func NewSignature(r, s emulated.Element[Secp256r1Fr]) Signature {
+	return Signature{R: r, S: s}
+}
+
+// NewSecp256k1PublicKey returns the secp256k1 public key of coordinates x and
+// y
+func NewSecp256k1PublicKey(x, y emulated.Element[Secp256k1Fp]) Secp256k1PublicKey {
+	return Secp256k1PublicKey{X: x, Y: y}
+}
+
+// NewSecp256k1Signature returns the secp256k1 signature (r, s)
+func NewSecp256k1Signature(r, s emulated.Element[Secp256k1Fr]) Secp256k1Signature {
+	return Secp256k1Signature{R: r, S: s}
+}
@@ -0,0 +1,156 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+)
+
+// assertionPrefix marks panics raised by labelled assertions so the label can
+// be recovered from the test engine error message
+const assertionPrefix = "[assert] "
+
+// AssertionError describes a labelled assertion that failed while the circuit
+// was executed with concrete values (test engine)
+type AssertionError struct {
+	Label  string
+	Detail string
+}
+
+func (e *AssertionError) Error() string {
+	return fmt.Sprintf("%s%s: %s", assertionPrefix, e.Label, e.Detail)
+}
+
+// WitnessError is returned by CheckWitness and DryRun when the assignment does
+// not satisfy the circuit. Label is set when the first failing assertion was a
+// labelled one (see Assert), otherwise only Err is available.
+type WitnessError struct {
+	Label  string
+	Detail string
+	Err    error
+}
+
+func (e *WitnessError) Error() string {
+	if e.Label != "" {
+		return fmt.Sprintf("assertion %q failed: %s", e.Label, e.Detail)
+	}
+	return fmt.Sprintf("circuit not satisfied: %s", e.Detail)
+}
+
+func (e *WitnessError) Unwrap() error {
+	return e.Err
+}
+
+// Assert asserts that cond == 1. The label is a format string evaluated only
+// when the assertion fails in debug mode, e.g.
+//
+//	common.Assert(api, isSequence, "tbs tag at %d", i)
+func Assert(api frontend.API, cond frontend.Variable, format string, args ...any) {
+	assertIsEqual(api, cond, 1, format, args...)
+}
+
+// AssertEqual asserts a == b and labels the assertion for debug mode
+func AssertEqual(api frontend.API, a, b frontend.Variable, format string, args ...any) {
+	assertIsEqual(api, a, b, format, args...)
+}
+
+// AssertDifferent asserts a != b and labels the assertion for debug mode
+func AssertDifferent(api frontend.API, a, b frontend.Variable, format string, args ...any) {
+	if va, ok := api.Compiler().ConstantValue(a); ok {
+		if vb, ok := api.Compiler().ConstantValue(b); ok && va.Cmp(vb) == 0 {
+			panic(&AssertionError{
+				Label:  fmt.Sprintf(format, args...),
+				Detail: fmt.Sprintf("%s == %s", va, vb),
+			})
+		}
+	}
+	api.AssertIsDifferent(a, b)
+}
+
+// AssertBytesEqual asserts a[i] == b[i] for every byte. Both slices must have
+// the same (compile-time) length. The failing byte index is appended to the
+// label in debug mode.
+func AssertBytesEqual(api frontend.API, a, b []uints.U8, format string, args ...any) {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("%s: length mismatch %d != %d", fmt.Sprintf(format, args...), len(a), len(b)))
+	}
+
+	byteFormat := format + " (byte %d)"
+	for i := range a {
+		assertIsEqual(api, a[i].Val, b[i].Val, byteFormat, append(args[:len(args):len(args)], i)...)
+	}
+}
+
+// assertIsEqual asserts a == b. When both values are known (test engine in
+// debug mode) a mismatch panics with an AssertionError carrying the label.
+func assertIsEqual(api frontend.API, a, b frontend.Variable, format string, args ...any) {
+	if va, ok := api.Compiler().ConstantValue(a); ok {
+		if vb, ok := api.Compiler().ConstantValue(b); ok && va.Cmp(vb) != 0 {
+			panic(&AssertionError{
+				Label:  fmt.Sprintf(format, args...),
+				Detail: fmt.Sprintf("%s != %s", va, vb),
+			})
+		}
+	}
+	api.AssertIsEqual(a, b)
+}
+
+// CheckWitness executes the circuit with gnark's test engine (no compilation,
+// no setup) and reports the first failing assertion. The circuit must have its
+// slices sized as for compilation; the assignment can be passed as circuit when
+// it carries the same sizes and compile-time parameters.
+func CheckWitness(circuit, assignment frontend.Circuit) error {
+	err := test.IsSolved(circuit, assignment, ecc.BN254.ScalarField(), test.SetAllVariablesAsConstants())
+	if err == nil {
+		return nil
+	}
+	return newWitnessError(err)
+}
+
+// DryRun solves the compiled constraint system for the assignment without
+// generating a proof. When the constraints are not satisfied, the assignment
+// is replayed through CheckWitness to recover the label of the failing
+// assertion.
+func DryRun(ccs constraint.ConstraintSystem, circuit, assignment frontend.Circuit) error {
+	witness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		return fmt.Errorf("witness creation failed: %w", err)
+	}
+
+	solveErr := ccs.IsSolved(witness)
+	if solveErr == nil {
+		return nil
+	}
+
+	var werr *WitnessError
+	if err := CheckWitness(circuit, assignment); errors.As(err, &werr) {
+		return werr
+	}
+	return &WitnessError{Detail: firstLine(solveErr.Error()), Err: solveErr}
+}
+
+// newWitnessError extracts the label of a failed labelled assertion from the
+// test engine error (the engine recovers the panic and formats it as text)
+func newWitnessError(err error) *WitnessError {
+	msg := firstLine(err.Error())
+	werr := &WitnessError{Detail: msg, Err: err}
+
+	if rest, ok := strings.CutPrefix(msg, assertionPrefix); ok {
+		if i := strings.LastIndex(rest, ": "); i >= 0 {
+			werr.Label = rest[:i]
+			werr.Detail = rest[i+2:]
+		}
+	}
+	return werr
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common/dertags"
+)
+
+// AssertOID asserts the DER bytes read by the circuit are the encoded oid,
+// tag and length included. got must have the length of the encoding. The OID
+// is appended to the label in debug mode.
+func AssertOID(api frontend.API, got []uints.U8, oid dertags.OID, format string, args ...any) {
+	if len(got) != len(oid) {
+		panic(fmt.Sprintf("%s: %d bytes for OID %s of %d", fmt.Sprintf(format, args...), len(got), oid, len(oid)))
+	}
+	AssertBytesEqual(api, got, BytesToU8Array(oid), format+" %s", append(args[:len(args):len(args)], oid)...)
+}
+
+// AssertOIDIf asserts the DER bytes are the encoded oid when cond is 1, for an
+// optional element; cond must be boolean
+func AssertOIDIf(api frontend.API, cond frontend.Variable, got []uints.U8, oid dertags.OID, format string, args ...any) {
+	if len(got) != len(oid) {
+		panic(fmt.Sprintf("%s: %d bytes for OID %s of %d", fmt.Sprintf(format, args...), len(got), oid, len(oid)))
+	}
+	byteFormat := format + " %s (byte %d)"
+	for i := range got {
+		assertIsEqual(api, api.Mul(cond, api.Sub(got[i].Val, oid[i])), 0, byteFormat, append(args[:len(args):len(args)], oid, i)...)
+	}
+}
@@ -0,0 +1,108 @@
+// Package dertags names the DER identifier octets (ITU-T X.690) and the
+// object identifiers the certificate, CRL and CMS circuits check, so the
+// gadgets read `dertags.Sequence` and `dertags.OIDSubjectAltName` instead of
+// 0x30 and the encoded arcs of 2.5.29.17. It has no dependency on gnark: the
+// off-circuit parsers (x509pos) and the witness builders share the same
+// constants. The in-circuit comparison of an OID is common.AssertOID.
+package dertags
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+// Universal tags
+const (
+	Boolean         = 0x01
+	Integer         = 0x02
+	BitString       = 0x03
+	OctetString     = 0x04
+	Null            = 0x05
+	ObjectID        = 0x06
+	Enumerated      = 0x0A
+	UTF8String      = 0x0C
+	PrintableString = 0x13
+	IA5String       = 0x16
+	UTCTime         = 0x17
+	GeneralizedTime = 0x18
+	Sequence        = 0x30 // SEQUENCE and SEQUENCE OF, constructed
+	Set             = 0x31 // SET and SET OF, constructed
+)
+
+// Context-specific constructed tags, [n] EXPLICIT, e.g. the version [0] and
+// the extensions [3] of a TBSCertificate
+const (
+	Explicit0 = 0xA0
+	Explicit1 = 0xA1
+	Explicit2 = 0xA2
+	Explicit3 = 0xA3
+)
+
+// Context-specific primitive tags, [n] IMPLICIT of a primitive type, e.g. the
+// issuerUniqueID [1] of a TBSCertificate or the dNSName [2] of a GeneralName
+const (
+	Implicit1 = 0x81
+	Implicit2 = 0x82
+	Implicit6 = 0x86
+	Implicit7 = 0x87
+)
+
+// LongFormLength is the bit of the first length octet of a long form length,
+// the other bits are the number of length octets that follow
+const LongFormLength = 0x80
+
+// OID is a DER encoded OBJECT IDENTIFIER with its tag and length, as it is
+// compared in the DER bytes
+type OID []byte
+
+// NewOID returns the DER encoding of the arcs. It panics on an invalid OID
+// (fewer than two arcs, a first arc above 2), the OIDs are package variables.
+func NewOID(arcs ...int) OID {
+	der, err := asn1.Marshal(asn1.ObjectIdentifier(arcs))
+	if err != nil {
+		panic(fmt.Sprintf("dertags: invalid OID %v: %v", arcs, err))
+	}
+	return der
+}
+
+// String returns the dotted notation of the OID, e.g. 2.5.29.17
+func (o OID) String() string {
+	var id asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(o, &id); err != nil || len(rest) != 0 {
+		return fmt.Sprintf("OID(%X)", []byte(o))
+	}
+	arcs := make([]string, len(id))
+	for i, arc := range id {
+		arcs[i] = fmt.Sprint(arc)
+	}
+	return strings.Join(arcs, ".")
+}
+
+// Algorithms
+var (
+	// OIDECPublicKey is id-ecPublicKey, the algorithm of an EC
+	// SubjectPublicKeyInfo (RFC 5480)
+	OIDECPublicKey = NewOID(1, 2, 840, 10045, 2, 1)
+	// OIDPrime256v1 is the namedCurve of P-256 (RFC 5480)
+	OIDPrime256v1 = NewOID(1, 2, 840, 10045, 3, 1, 7)
+	// OIDSecp256k1 is the namedCurve of secp256k1 (SEC 2)
+	OIDSecp256k1 = NewOID(1, 3, 132, 0, 10)
+	// OIDRSAEncryption is rsaEncryption, the algorithm of an RSA
+	// SubjectPublicKeyInfo (RFC 3279)
+	OIDRSAEncryption = NewOID(1, 2, 840, 113549, 1, 1, 1)
+	// OIDSHA256 is the SHA-256 hash algorithm (RFC 5754)
+	OIDSHA256 = NewOID(2, 16, 840, 1, 101, 3, 4, 2, 1)
+)
+
+// Certificate extensions and attributes
+var (
+	// OIDSubjectAltName is the SubjectAlternativeName extension (RFC 5280)
+	OIDSubjectAltName = NewOID(2, 5, 29, 17)
+	// OIDAndroidKeyAttestation is the Android key attestation extension
+	// (KeyDescription)
+	OIDAndroidKeyAttestation = NewOID(1, 3, 6, 1, 4, 1, 11129, 2, 1, 17)
+	// OIDSigningCertificateV2 is the signingCertificateV2 attribute of a CMS
+	// signature (RFC 5035)
+	OIDSigningCertificateV2 = NewOID(1, 2, 840, 113549, 1, 9, 16, 2, 47)
+)
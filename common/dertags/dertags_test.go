@@ -0,0 +1,39 @@
+package dertags
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestOIDs pins the encodings of the OIDs to the bytes the circuits compared
+// before they were named
+func TestOIDs(t *testing.T) {
+	tests := []struct {
+		oid  OID
+		der  []byte
+		name string
+	}{
+		{OIDECPublicKey, []byte{0x06, 0x07, 0x2A, 0x86, 0x48, 0xCE, 0x3D, 0x02, 0x01}, "1.2.840.10045.2.1"},
+		{OIDPrime256v1, []byte{0x06, 0x08, 0x2A, 0x86, 0x48, 0xCE, 0x3D, 0x03, 0x01, 0x07}, "1.2.840.10045.3.1.7"},
+		{OIDSecp256k1, []byte{0x06, 0x05, 0x2B, 0x81, 0x04, 0x00, 0x0A}, "1.3.132.0.10"},
+		{OIDSHA256, []byte{0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01}, "2.16.840.1.101.3.4.2.1"},
+		{OIDSubjectAltName, []byte{0x06, 0x03, 0x55, 0x1D, 0x11}, "2.5.29.17"},
+		{OIDAndroidKeyAttestation, []byte{0x06, 0x0A, 0x2B, 0x06, 0x01, 0x04, 0x01, 0xD6, 0x79, 0x02, 0x01, 0x11}, "1.3.6.1.4.1.11129.2.1.17"},
+		{OIDSigningCertificateV2, []byte{0x06, 0x0B, 0x2A, 0x86, 0x48, 0x86, 0xF7, 0x0D, 0x01, 0x09, 0x10, 0x02, 0x2F}, "1.2.840.113549.1.9.16.2.47"},
+	}
+	for _, tt := range tests {
+		if !bytes.Equal(tt.oid, tt.der) {
+			t.Errorf("%s: encoded %X, expected %X", tt.name, []byte(tt.oid), tt.der)
+		}
+		if tt.oid.String() != tt.name {
+			t.Errorf("%s: named %s", tt.name, tt.oid)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewOID to panic for an invalid OID")
+		}
+	}()
+	NewOID(3)
+}
@@ -0,0 +1,148 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// DisclosureDigestLen is the size of the base64url SHA-256 digest of a
+// disclosure, as listed in the _sd arrays
+const DisclosureDigestLen = 43
+
+// DisclosureDigestSegmentLen is the size of the base64url segment of the
+// payload holding the quoted digest ("<digest>") at any alignment
+const DisclosureDigestSegmentLen = 64
+
+// DisclosureInput are the inputs of VerifyDisclosure for one disclosure of an
+// SD-JWT, computed by DisclosurePosition.Input
+type DisclosureInput struct {
+	// Encoded is the base64url disclosure zero padded, Len its length and
+	// DecodedLen the length of the decoded disclosure
+	Encoded    []uints.U8
+	Len        frontend.Variable
+	DecodedLen frontend.Variable
+	// DigestB64 is the segment of the encoded payload at DigestB64Position
+	// holding the quoted digest, DigestPosition the position of the digest
+	// (past the quote) in the decoded segment
+	DigestB64         []uints.U8
+	DigestB64Position frontend.Variable
+	DigestPosition    frontend.Variable
+	// NamePosition and ValuePosition locate the quoted claim name and the
+	// string value (past the quote) in the decoded disclosure
+	NamePosition  frontend.Variable
+	ValuePosition frontend.Variable
+}
+
+// NewDisclosureInput returns the template of a DisclosureInput for
+// disclosures of up to maxLen base64url characters
+func NewDisclosureInput(maxLen int) DisclosureInput {
+	return DisclosureInput{
+		Encoded:   make([]uints.U8, 4*((maxLen+3)/4)),
+		DigestB64: make([]uints.U8, DisclosureDigestSegmentLen),
+	}
+}
+
+// VerifyDisclosure returns the string value of the claim name revealed by a
+// disclosure of the base64url payload, zero padded to maxValueLen, and its
+// length. The revealed bytes are a complete disclosure, not a slice of one:
+//   - the digest is the SHA-256 of the Len characters of the disclosure, and
+//     is found quoted in the signed payload
+//   - the decoded disclosure is ["salt", "name", "value"]: it opens the
+//     array, the quoted name follows a comma, and the value closes the array
+//     at DecodedLen
+//
+// so the value cannot be spliced from a prefix, another element or another
+// disclosure. The value must not contain escapes; one space may follow the
+// commas. The digest is not bound to the top-level _sd array.
+func VerifyDisclosure(api frontend.API, payload []uints.U8, d DisclosureInput, name string, maxValueLen int) ([]uints.U8, frontend.Variable, error) {
+	if len(d.DigestB64) != DisclosureDigestSegmentLen {
+		return nil, nil, fmt.Errorf("disclosure %q: digest segment of %d characters, expected %d", name, len(d.DigestB64), DisclosureDigestSegmentLen)
+	}
+
+	// the digest of the whole disclosure, the bytes past Len are zero
+	encoded, length := maskPart(api, JWSPart{Bytes: d.Encoded, Len: d.Len})
+	digest, err := LengthedBytes{Data: encoded, Length: length}.SHA256(api)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the quoted digest is in the payload
+	if err := MustSubset(api, payload, d.DigestB64, d.DigestB64Position); err != nil {
+		return nil, nil, err
+	}
+	if err := AssertB64Aligned(api, len(payload), len(d.DigestB64), d.DigestB64Position); err != nil {
+		return nil, nil, err
+	}
+	segment, err := DecodeBase64Url(api, d.DigestB64)
+	if err != nil {
+		return nil, nil, err
+	}
+	quoted := GetSubset(api, segment, api.Sub(d.DigestPosition, 1), DisclosureDigestLen+2)
+	AssertEqual(api, quoted[0].Val, '"', "disclosure %q: digest opening quote", name)
+	AssertEqual(api, quoted[DisclosureDigestLen+1].Val, '"', "disclosure %q: digest closing quote", name)
+	listed, err := DecodeBase64Url(api, quoted[1:DisclosureDigestLen+1])
+	if err != nil {
+		return nil, nil, err
+	}
+	AssertBytesEqual(api, listed, digest, "disclosure %q: digest", name)
+
+	// 4*DecodedLen <= 3*Len < 4*DecodedLen + 4
+	api.AssertIsLessOrEqual(api.Mul(d.DecodedLen, 4), api.Mul(length, 3))
+	api.AssertIsLessOrEqual(api.Add(api.Mul(length, 3), 1), api.Add(api.Mul(d.DecodedLen, 4), 4))
+	decoded, err := DecodeBase64Url(api, encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	AssertBytesEqual(api, decoded[:2], StringToU8Array(`["`), "disclosure %q: array of the salt", name)
+
+	// , "name",
+	quotedName := `"` + name + `"`
+	claim := GetSubset(api, decoded, api.Sub(d.NamePosition, 2), len(quotedName)+4)
+	before, after := claim[:2], claim[2+len(quotedName):]
+	afterComma := api.Or(
+		api.IsZero(api.Sub(before[1].Val, ',')),
+		api.And(api.IsZero(api.Sub(before[1].Val, ' ')), api.IsZero(api.Sub(before[0].Val, ','))),
+	)
+	AssertEqual(api, afterComma, 1, "disclosure %q: name follows the salt", name)
+	AssertBytesEqual(api, claim[2:2+len(quotedName)], StringToU8Array(quotedName), "disclosure %q: name", name)
+	AssertEqual(api, after[0].Val, ',', "disclosure %q: comma after the name", name)
+	gap := api.Sub(d.ValuePosition, api.Add(d.NamePosition, len(quotedName)+2))
+	api.AssertIsBoolean(gap)
+	AssertEqual(api, api.Mul(gap, api.Sub(after[1].Val, ' ')), 0, "disclosure %q: space after the name", name)
+
+	// "value"] ends the disclosure
+	value, valueLen := GetStringValueUpTo(api, decoded, d.ValuePosition, `"`, maxValueLen)
+	end := api.Add(d.ValuePosition, valueLen)
+	AssertBytesEqual(api, GetSubset(api, decoded, end, 2), StringToU8Array(`"]`), "disclosure %q: value ends the array", name)
+	AssertEqual(api, api.Add(end, 2), d.DecodedLen, "disclosure %q: value ends the disclosure", name)
+
+	return value, valueLen, nil
+}
+
+// Input returns the inputs of VerifyDisclosure for disclosures of up to
+// maxLen characters (NewDisclosureInput), payloadB64 is the encoded payload
+// the position was computed for
+func (p *DisclosurePosition) Input(payloadB64 string, maxLen int) (DisclosureInput, error) {
+	input := NewDisclosureInput(maxLen)
+	encoded := p.Disclosure.Encoded
+	if len(encoded) > len(input.Encoded) {
+		return DisclosureInput{}, fmt.Errorf("disclosure of %d characters exceeds %d", len(encoded), len(input.Encoded))
+	}
+	if p.Digest.B64Start+DisclosureDigestSegmentLen > len(payloadB64) {
+		return DisclosureInput{}, fmt.Errorf("digest segment of %d characters at %d exceeds the payload", DisclosureDigestSegmentLen, p.Digest.B64Start)
+	}
+
+	padded := make([]byte, len(input.Encoded))
+	copy(padded, encoded)
+	input.Encoded = BytesToU8Array(padded)
+	input.Len = len(encoded)
+	input.DecodedLen = len(p.Disclosure.Decoded)
+	input.DigestB64 = StringToU8Array(payloadB64[p.Digest.B64Start : p.Digest.B64Start+DisclosureDigestSegmentLen])
+	input.DigestB64Position = p.Digest.B64Start
+	input.DigestPosition = p.Digest.ValuePosition
+	input.NamePosition = p.NamePosition
+	input.ValuePosition = p.ValuePosition
+	return input, nil
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// disclosureCircuit reveals the string claim Name of a disclosure of Payload
+type disclosureCircuit struct {
+	Name        string `gnark:"-"`
+	MaxValueLen int    `gnark:"-"`
+
+	Payload    []uints.U8
+	Disclosure DisclosureInput
+	Value      []uints.U8 `gnark:",public"`
+	ValueLen   frontend.Variable
+}
+
+func (c *disclosureCircuit) Define(api frontend.API) error {
+	value, length, err := VerifyDisclosure(api, c.Payload, c.Disclosure, c.Name, c.MaxValueLen)
+	if err != nil {
+		return err
+	}
+	AssertBytesEqual(api, value, c.Value, "value")
+	api.AssertIsEqual(length, c.ValueLen)
+	return nil
+}
+
+const disclosureMaxLen = 80
+
+// disclosureAssignment returns the template and the assignment revealing the
+// claim name of the SD-JWT
+func disclosureAssignment(t *testing.T, serialization, name string) (*disclosureCircuit, *disclosureCircuit, *DisclosurePosition, string) {
+	t.Helper()
+	pos, err := (&Preprocessor{Claims: []string{name}}).Process(CredentialArtifacts{SDJWT: serialization})
+	if err != nil {
+		t.Fatal(err)
+	}
+	disclosure := pos.Disclosures[name]
+	input, err := disclosure.Input(pos.PayloadB64, disclosureMaxLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value string
+	json.Unmarshal(disclosure.Disclosure.Value, &value)
+	const maxValueLen = 16
+	padded := make([]byte, maxValueLen)
+	copy(padded, value)
+
+	template := &disclosureCircuit{
+		Name:        name,
+		MaxValueLen: maxValueLen,
+		Payload:     make([]uints.U8, len(pos.PayloadB64)),
+		Disclosure:  NewDisclosureInput(disclosureMaxLen),
+		Value:       make([]uints.U8, maxValueLen),
+	}
+	assignment := &disclosureCircuit{
+		Payload:    StringToU8Array(pos.PayloadB64),
+		Disclosure: input,
+		Value:      BytesToU8Array(padded),
+		ValueLen:   len(value),
+	}
+	return template, assignment, disclosure, pos.PayloadB64
+}
+
+func TestVerifyDisclosure(t *testing.T) {
+	serialization, _ := mockSDJWT(t)
+	template, assignment, _, _ := disclosureAssignment(t, serialization, "birthdate")
+	if err := CheckWitness(template, assignment); err != nil {
+		t.Fatal(err)
+	}
+
+	// one space after the commas, as many issuers serialize
+	spaced := base64.RawURLEncoding.EncodeToString([]byte(`["eluV5Og3gSNII8EYnsxA_A", "given_name", "Alice"]`))
+	d, _ := ParseDisclosure(spaced)
+	payload, _ := json.Marshal(map[string]any{"_sd": []string{d.Digest}, "iss": "https://issuer.example"})
+	jws := "eyJhbGciOiJFUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"
+	template, assignment, _, _ = disclosureAssignment(t, jws+"~"+spaced+"~", "given_name")
+	if err := CheckWitness(template, assignment); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestVerifyDisclosureSplicing checks that only complete disclosures listed
+// by the issuer reveal a value
+func TestVerifyDisclosureSplicing(t *testing.T) {
+	serialization, _ := mockSDJWT(t)
+	template, _, disclosure, payloadB64 := disclosureAssignment(t, serialization, "birthdate")
+
+	mutations := map[string]func(a *disclosureCircuit){
+		// a prefix of the disclosure: the digest does not match
+		"partial disclosure": func(a *disclosureCircuit) {
+			a.Disclosure.Len = len(disclosure.Disclosure.Encoded) - 4
+			a.Disclosure.DecodedLen = len(disclosure.Disclosure.Decoded) - 3
+			padded := make([]byte, len(a.Disclosure.Encoded))
+			copy(padded, disclosure.Disclosure.Encoded[:len(disclosure.Disclosure.Encoded)-4])
+			a.Disclosure.Encoded = BytesToU8Array(padded)
+		},
+		// a prefix of the value
+		"truncated value": func(a *disclosureCircuit) {
+			a.Value = BytesToU8Array(append([]byte("2000-01"), make([]byte, 9)...))
+			a.ValueLen = 7
+		},
+		// the value shifted into the string
+		"shifted value": func(a *disclosureCircuit) {
+			a.Disclosure.ValuePosition = disclosure.ValuePosition + 5
+			a.Value = BytesToU8Array(append([]byte("01-31"), make([]byte, 11)...))
+			a.ValueLen = 5
+		},
+		// a disclosure the issuer did not list
+		"forged disclosure": func(a *disclosureCircuit) {
+			forged := mockDisclosure(t, "2GLC42sKQveCfGfryNRN9w", "birthdate", "1990-01-31")
+			padded := make([]byte, len(a.Disclosure.Encoded))
+			copy(padded, forged)
+			a.Disclosure.Encoded = BytesToU8Array(padded)
+			a.Value = BytesToU8Array(append([]byte("1990-01-31"), make([]byte, 6)...))
+		},
+		// the digest taken from a misaligned segment
+		"digest position": func(a *disclosureCircuit) {
+			a.Disclosure.DigestB64Position = disclosure.Digest.B64Start + 4
+			a.Disclosure.DigestB64 = StringToU8Array(payloadB64[disclosure.Digest.B64Start+4 : disclosure.Digest.B64Start+4+DisclosureDigestSegmentLen])
+		},
+	}
+	for name, mutate := range mutations {
+		_, a, _, _ := disclosureAssignment(t, serialization, "birthdate")
+		mutate(a)
+		if err := CheckWitness(template, a); err == nil {
+			t.Errorf("%s: expected the assignment to be rejected", name)
+		}
+	}
+
+	// the disclosure of another claim
+	_, other, _, _ := disclosureAssignment(t, serialization, "given_name")
+	if err := CheckWitness(template, other); err == nil {
+		t.Error("expected the disclosure of another claim to be rejected")
+	}
+}
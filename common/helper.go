@@ -1,7 +1,7 @@
 package common
 
 import (
-	"crypto/rand"
+	"sync"
 
 	"github.com/consensys/gnark/std/math/uints"
 )
@@ -24,6 +24,34 @@ func BytesToU8Array(s []byte) []uints.U8 {
 	return result
 }
 
+// parallelChunk is the size of the chunks BytesToU8Arrays converts
+// concurrently, smaller inputs are converted in one goroutine
+const parallelChunk = 64 << 10
+
+// BytesToU8Arrays converts independent witness inputs (certificate, payload,
+// CRL) as BytesToU8Array, concurrently: one goroutine per input, and per chunk
+// of the large ones. Result i is the conversion of input i, every goroutine
+// writes its own range, so the witness does not depend on the scheduling.
+func BytesToU8Arrays(inputs ...[]byte) [][]uints.U8 {
+	results := make([][]uints.U8, len(inputs))
+	var wg sync.WaitGroup
+	for i, in := range inputs {
+		results[i] = make([]uints.U8, len(in))
+		for start := 0; start < len(in); start += parallelChunk {
+			end := min(start+parallelChunk, len(in))
+			wg.Add(1)
+			go func(out []uints.U8, in []byte) {
+				defer wg.Done()
+				for j, b := range in {
+					out[j] = uints.NewU8(b)
+				}
+			}(results[i][start:end], in[start:end])
+		}
+	}
+	wg.Wait()
+	return results
+}
+
 // Helper function to pad bytes to 32 bytes (needed for P-256 signature components)
 func PadTo32Bytes(b []byte) []byte {
 	if len(b) >= 32 {
@@ -34,12 +62,8 @@ func PadTo32Bytes(b []byte) []byte {
 	return padded
 }
 
-// GenerateRandomBytes returns cryptographically secure random bytes
+// GenerateRandomBytes returns cryptographically secure random bytes, read
+// from crypto/rand (RandomBytes)
 func GenerateRandomBytes(size int) ([]byte, error) {
-	randomBytes := make([]byte, size)
-	_, err := rand.Read(randomBytes)
-	if err != nil {
-		return nil, err
-	}
-	return randomBytes, nil
+	return RandomBytes(nil, size)
 }
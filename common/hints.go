@@ -0,0 +1,133 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/consensys/gnark/constraint"
+	csbn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/std"
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+// Solver hints: a compiled circuit records the hints its gadgets call (by
+// hint id), and the solver of the prover looks them up in the global registry
+// of gnark. A binary loading a circuit.ccs compiled by another build, with a
+// hint it does not register, only fails when proving. The loaders of this
+// package check the hints of the constraint system up front (CheckHints), and
+// the cluster manifests carry the hint set of the build that published them
+// (artifact.Manifest.HintSet).
+
+// HintSetVersion tags the hints RegisterAllHints registers: the hints of
+// gnark/std of the gnark release of go.mod, and the hints of the gadgets of
+// this module. It changes with the gnark release, and is bumped when a hint
+// of the module is added, removed or changes its outputs.
+const HintSetVersion = "gnark-v0.14.0/1"
+
+// ErrMissingHints is the failure class of a MissingHintsError, and of a
+// manifest published with another hint set
+var ErrMissingHints = errors.New("missing solver hints")
+
+// moduleHints are the solver hints of the gadgets of this module, none yet:
+// the gadgets are built on the hints of gnark/std
+var moduleHints []solver.Hint
+
+var registerHintsOnce sync.Once
+
+// RegisterAllHints registers the hints of HintSetVersion in the solver
+// registry. Importing the gadgets registers their hints, a prover loading
+// compiled circuits without importing their definitions calls it first.
+func RegisterAllHints() {
+	registerHintsOnce.Do(func() {
+		std.RegisterHints()
+		solver.RegisterHint(moduleHints...)
+	})
+}
+
+// MissingHintsError is returned for a constraint system calling hints the
+// binary does not register
+type MissingHintsError struct {
+	// Hints are the names of the missing hints, sorted
+	Hints []string
+}
+
+func (e *MissingHintsError) Error() string {
+	return fmt.Sprintf("%s: the circuit calls %s, which this binary (hint set %s) does not register; rebuild the prover against the gnark release and the gadgets the circuit was compiled with",
+		ErrMissingHints, strings.Join(e.Hints, ", "), HintSetVersion)
+}
+
+// Is matches ErrMissingHints
+func (e *MissingHintsError) Is(target error) bool {
+	return target == ErrMissingHints
+}
+
+// RequiredHints returns the names of the hints the constraint system calls,
+// sorted
+func RequiredHints(ccs constraint.ConstraintSystem) ([]string, error) {
+	deps, err := hintDependencies(ccs)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(deps))
+	for _, name := range deps {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// CheckHints checks that the hints the constraint system calls are
+// registered, after RegisterAllHints; a *MissingHintsError lists the others
+func CheckHints(ccs constraint.ConstraintSystem) error {
+	RegisterAllHints()
+	deps, err := hintDependencies(ccs)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for id, name := range deps {
+		if solver.GetRegisteredHint(id) == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return &MissingHintsError{Hints: missing}
+	}
+	return nil
+}
+
+// hintDependencies returns the hints of a BN254 constraint system by id
+func hintDependencies(ccs constraint.ConstraintSystem) (map[solver.HintID]string, error) {
+	system, ok := ccs.(*csbn254.R1CS)
+	if !ok {
+		return nil, fmt.Errorf("unsupported constraint system %T", ccs)
+	}
+	return system.MHintsDependencies, nil
+}
+
+// BuildManifest is artifact.BuildManifest tagged with the hint set of this
+// binary, for the leaders publishing the artifacts they compiled
+func BuildManifest(ctx context.Context, store artifact.Store, prefix string) (*artifact.Manifest, error) {
+	m, err := artifact.BuildManifest(ctx, store, prefix)
+	if err != nil {
+		return nil, err
+	}
+	m.HintSet = HintSetVersion
+	return m, nil
+}
+
+// CheckManifestHints checks that the artifacts of the manifest were published
+// with the hint set of this binary; a manifest without hint set passes, its
+// constraint systems are checked when loaded (CheckHints)
+func CheckManifestHints(m *artifact.Manifest) error {
+	if m.HintSet != "" && m.HintSet != HintSetVersion {
+		return fmt.Errorf("%w: manifest %s published with hint set %s, this binary provides %s", ErrMissingHints, m.Version, m.HintSet, HintSetVersion)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+// halfHint returns the half of its input, registered by TestCheckHints only
+func halfHint(_ *big.Int, inputs []*big.Int, outputs []*big.Int) error {
+	outputs[0].Rsh(inputs[0], 1)
+	return nil
+}
+
+// halfCircuit proves X = 2 * half(X) with an unregistered hint
+type halfCircuit struct {
+	X frontend.Variable `gnark:",public"`
+}
+
+func (c *halfCircuit) Define(api frontend.API) error {
+	half, err := api.Compiler().NewHint(halfHint, 1, c.X)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(api.Mul(half[0], 2), c.X)
+	return nil
+}
+
+func TestCheckHints(t *testing.T) {
+	dir := t.TempDir()
+	ccsPath, pkPath, vkPath := filepath.Join(dir, ArtifactCCS), filepath.Join(dir, ArtifactProvingKey), filepath.Join(dir, ArtifactVerifyingKey)
+	if err := SetupAndSave(&halfCircuit{}, ccsPath, pkPath, vkPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// the hint of the compiled circuit is not registered by this binary
+	_, _, _, err := LoadSetup(ccsPath, pkPath, vkPath)
+	var missing *MissingHintsError
+	if !errors.As(err, &missing) || !errors.Is(err, ErrMissingHints) || len(missing.Hints) != 1 || missing.Hints[0] != solver.GetHintName(halfHint) {
+		t.Fatalf("expected the missing hint, got %v", err)
+	}
+
+	solver.RegisterHint(halfHint)
+	ccs, _, _, err := LoadSetup(ccsPath, pkPath, vkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	required, err := RequiredHints(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(required, solver.GetHintName(halfHint)) {
+		t.Fatalf("expected the hint in the required hints, got %v", required)
+	}
+}
+
+func TestCheckManifestHints(t *testing.T) {
+	store := artifact.NewFSStore(t.TempDir())
+	m, err := BuildManifest(t.Context(), store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.HintSet != HintSetVersion {
+		t.Fatalf("expected the hint set %s, got %q", HintSetVersion, m.HintSet)
+	}
+	if err := CheckManifestHints(m); err != nil {
+		t.Fatal(err)
+	}
+	m.HintSet = "gnark-v0.13.0/1"
+	if err := CheckManifestHints(m); !errors.Is(err, ErrMissingHints) {
+		t.Fatalf("expected ErrMissingHints for another hint set, got %v", err)
+	}
+	m.HintSet = ""
+	if err := CheckManifestHints(m); err != nil {
+		t.Fatalf("expected a manifest without hint set to pass, got %v", err)
+	}
+}
@@ -0,0 +1,366 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+// Phase is a phase of the initialization of a circuit, see
+// InitCircuitContext
+type Phase string
+
+const (
+	PhaseCompile Phase = "compile"
+	PhaseSetup   Phase = "setup"
+	PhaseSave    Phase = "save"
+	PhaseLoad    Phase = "load"
+)
+
+// ProgressReporter receives the phases of the initialization of a circuit as
+// they start and end, e.g. to stream them to a client. The calls of a phase
+// are made in order, from the goroutine running it.
+type ProgressReporter interface {
+	PhaseStarted(phase Phase)
+	// PhaseDone ends a phase, err is set when it failed or was canceled
+	PhaseDone(phase Phase, elapsed time.Duration, err error)
+}
+
+// ProgressFuncs implements ProgressReporter with functions, nil functions
+// are not called
+type ProgressFuncs struct {
+	Started func(phase Phase)
+	Done    func(phase Phase, elapsed time.Duration, err error)
+}
+
+// PhaseStarted implements ProgressReporter
+func (p ProgressFuncs) PhaseStarted(phase Phase) {
+	if p.Started != nil {
+		p.Started(phase)
+	}
+}
+
+// PhaseDone implements ProgressReporter
+func (p ProgressFuncs) PhaseDone(phase Phase, elapsed time.Duration, err error) {
+	if p.Done != nil {
+		p.Done(phase, elapsed, err)
+	}
+}
+
+// ConsoleProgress prints the phases on the standard output, as the tests and
+// the commands log them; it is the reporter of a nil ProgressReporter
+var ConsoleProgress ProgressReporter = ProgressFuncs{
+	Started: func(phase Phase) {
+		fmt.Printf("\n--- %s ---\n", phase)
+	},
+	Done: func(phase Phase, elapsed time.Duration, err error) {
+		if err == nil {
+			fmt.Printf("[OK] %s done (took %v)\n", phase, elapsed)
+		}
+	},
+}
+
+// CircuitPaths are the files of a compiled circuit and its keys
+type CircuitPaths struct {
+	CCS          string
+	ProvingKey   string
+	VerifyingKey string
+	// Manifest lists the artifacts with the encoding of the proving key
+	// (artifact.Manifest), ProvingKey + ".manifest.json" when empty. It is
+	// written by SaveCircuit; artifacts saved without manifest are loaded
+	// with the encoding of the caller.
+	Manifest string
+}
+
+// manifest returns the path of the manifest
+func (p CircuitPaths) manifest() string {
+	if p.Manifest != "" {
+		return p.Manifest
+	}
+	return p.ProvingKey + ".manifest.json"
+}
+
+// keyEncoding returns the encoding of the proving key recorded in the
+// manifest, encoding when there is no manifest
+func (p CircuitPaths) keyEncoding(encoding KeyEncoding) (KeyEncoding, error) {
+	data, err := os.ReadFile(p.manifest())
+	if os.IsNotExist(err) {
+		return encoding, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	m, err := artifact.ParseManifest(data)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", p.manifest(), err)
+	}
+	info, err := os.Stat(p.ProvingKey)
+	if err != nil {
+		return 0, err
+	}
+	return manifestKeyEncoding(m, filepath.Base(p.ProvingKey), info.Size())
+}
+
+// validate rejects the paths escaping the working directory (validatePath)
+func (p CircuitPaths) validate() error {
+	for name, path := range map[string]string{"ccs": p.CCS, "proving key": p.ProvingKey, "verifying key": p.VerifyingKey, "manifest": p.manifest()} {
+		if err := validatePath(path); err != nil {
+			return fmt.Errorf("invalid %s path: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// reportPhase runs f as the phase, reported to progress, and prefixes its
+// error with the phase
+func reportPhase(ctx context.Context, progress ProgressReporter, phase Phase, f func() error) error {
+	if progress == nil {
+		progress = ConsoleProgress
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	progress.PhaseStarted(phase)
+	start := time.Now()
+	err := f()
+	progress.PhaseDone(phase, time.Since(start), err)
+	if err != nil {
+		return fmt.Errorf("%s: %w", phase, err)
+	}
+	return nil
+}
+
+// runPhase runs f as the phase like reportPhase. gnark compiles and runs the
+// setup without cancellation, so f runs in its own goroutine: when ctx is
+// canceled runPhase returns ctx.Err() at once, f completes in the background
+// and its result is dropped.
+func runPhase[T any](ctx context.Context, progress ProgressReporter, phase Phase, f func() (T, error)) (T, error) {
+	var v T
+	err := reportPhase(ctx, progress, phase, func() error {
+		// the reporter may have canceled ctx as the phase started
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		type result struct {
+			v   T
+			err error
+		}
+		done := make(chan result, 1)
+		go func() {
+			v, err := f()
+			done <- result{v, err}
+		}()
+		select {
+		case r := <-done:
+			v = r.v
+			return r.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// CompileCircuit compiles the circuit to an R1CS on BN254 (PhaseCompile)
+func CompileCircuit(ctx context.Context, circuitTemplate frontend.Circuit, progress ProgressReporter) (constraint.ConstraintSystem, error) {
+	return runPhase(ctx, progress, PhaseCompile, func() (constraint.ConstraintSystem, error) {
+		return frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuitTemplate)
+	})
+}
+
+// provingSetup are the keys of a groth16 setup
+type provingSetup struct {
+	pk groth16.ProvingKey
+	vk groth16.VerifyingKey
+}
+
+// SetupCircuit runs the groth16 setup of the compiled circuit (PhaseSetup),
+// ErrSetupDisabled outside of ModeFull (SetMode)
+func SetupCircuit(ctx context.Context, ccs constraint.ConstraintSystem, progress ProgressReporter) (groth16.ProvingKey, groth16.VerifyingKey, error) {
+	if err := checkSetup(); err != nil {
+		return nil, nil, err
+	}
+	keys, err := runPhase(ctx, progress, PhaseSetup, func() (provingSetup, error) {
+		pk, vk, err := groth16.Setup(ccs)
+		return provingSetup{pk, vk}, err
+	})
+	return keys.pk, keys.vk, err
+}
+
+// SaveCircuit writes the compiled circuit and its keys (PhaseSave), the
+// proving key with the given encoding recorded in the manifest
+// (CircuitPaths.Manifest), and signs them when a signer is set
+// (SetArtifactProvenance). The files are written next to their paths and
+// renamed once all are written, the verifying key last: a canceled or failed
+// save leaves the previous artifacts in place.
+func SaveCircuit(ctx context.Context, paths CircuitPaths, ccs constraint.ConstraintSystem, pk groth16.ProvingKey, vk groth16.VerifyingKey, encoding KeyEncoding, progress ProgressReporter) error {
+	if err := paths.validate(); err != nil {
+		return err
+	}
+	// the save checks ctx itself, between the files, and runs in place so
+	// that a canceled save never renames behind the caller
+	return reportPhase(ctx, progress, PhaseSave, func() error {
+		return saveCircuit(ctx, paths, ccs, pk, vk, encoding)
+	})
+}
+
+// saveCircuit writes the artifacts of SaveCircuit, checking ctx between them
+func saveCircuit(ctx context.Context, paths CircuitPaths, ccs constraint.ConstraintSystem, pk groth16.ProvingKey, vk groth16.VerifyingKey, encoding KeyEncoding) (err error) {
+	if err := ensureDirectories(paths.CCS, paths.ProvingKey, paths.VerifyingKey, paths.manifest()); err != nil {
+		return err
+	}
+	artifacts := []struct {
+		kind, path string
+		write      func(w io.Writer) error
+	}{
+		{ArtifactCCS, paths.CCS, func(w io.Writer) error { _, err := ccs.WriteTo(w); return err }},
+		{ArtifactProvingKey, paths.ProvingKey, func(w io.Writer) error { return writeProvingKey(w, pk, encoding) }},
+		{ArtifactVerifyingKey, paths.VerifyingKey, func(w io.Writer) error { _, err := vk.WriteTo(w); return err }},
+	}
+	var written []string
+	var listed []artifact.ManifestArtifact
+	defer func() {
+		if err != nil {
+			for _, tmp := range written {
+				os.Remove(tmp)
+			}
+		}
+	}()
+	for _, a := range artifacts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tmp := a.path + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		written = append(written, tmp)
+		hw := newHashingWriter(f)
+		w := bufio.NewWriterSize(hw, 1<<20)
+		err = a.write(w)
+		if err == nil {
+			err = w.Flush()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		listed = append(listed, hw.artifact(filepath.Base(a.path)))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	manifest, err := json.MarshalIndent(circuitManifest(listed, filepath.Base(paths.ProvingKey), encoding), "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestTmp := paths.manifest() + ".tmp"
+	if err := os.WriteFile(manifestTmp, manifest, 0o644); err != nil {
+		return err
+	}
+	written = append(written, manifestTmp)
+
+	// the manifest is renamed before the verifying key, last in artifacts and
+	// renamed last
+	renames := [][2]string{{paths.CCS + ".tmp", paths.CCS}, {paths.ProvingKey + ".tmp", paths.ProvingKey}, {manifestTmp, paths.manifest()}, {paths.VerifyingKey + ".tmp", paths.VerifyingKey}}
+	for _, r := range renames {
+		if err := os.Rename(r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	written = nil
+
+	if signer := currentProvenance().Signer; signer != nil {
+		for _, a := range artifacts {
+			if err := signArtifactFile(*signer, a.kind, a.path); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("[OK] Artifacts signed by %q\n", signer.KeyID)
+	}
+	return nil
+}
+
+// loadedCircuit are the artifacts of LoadCircuit
+type loadedCircuit struct {
+	ccs constraint.ConstraintSystem
+	pk  groth16.ProvingKey
+	vk  groth16.VerifyingKey
+}
+
+// LoadCircuit loads the compiled circuit and its keys (PhaseLoad), as
+// LoadSetupWithEncoding with the encoding recorded in the manifest of the
+// artifacts, encoding for artifacts saved without manifest
+func LoadCircuit(ctx context.Context, paths CircuitPaths, encoding KeyEncoding, progress ProgressReporter) (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey, error) {
+	if err := paths.validate(); err != nil {
+		return nil, nil, nil, err
+	}
+	encoding, err := paths.keyEncoding(encoding)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	c, err := runPhase(ctx, progress, PhaseLoad, func() (loadedCircuit, error) {
+		ccs, pk, vk, err := LoadSetupWithEncoding(paths.CCS, paths.ProvingKey, paths.VerifyingKey, encoding)
+		return loadedCircuit{ccs, pk, vk}, err
+	})
+	return c.ccs, c.pk, c.vk, err
+}
+
+// InitCircuitContext initializes a circuit like InitCircuitWithEncoding, in
+// phases reported to progress (ConsoleProgress when nil): the saved artifacts
+// are loaded (PhaseLoad) unless forceCompile is set or one of them is
+// missing, in which case the circuit is compiled (PhaseCompile), set up
+// (PhaseSetup) and saved (PhaseSave); outside of ModeFull a missing artifact
+// is ErrSetupDisabled instead. Canceling ctx interrupts the
+// initialization at once, see runPhase, or the save between two files; the
+// artifacts on disk are then unchanged.
+func InitCircuitContext(ctx context.Context, paths CircuitPaths, forceCompile bool, circuitTemplate frontend.Circuit, encoding KeyEncoding, progress ProgressReporter) (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey, error) {
+	if err := paths.validate(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the test engine needs no artifacts (UseTestEngine)
+	if UseTestEngine() {
+		fmt.Printf("%s set: skipping the compilation and the setup\n", TestEngineEnv)
+		return nil, nil, nil, nil
+	}
+
+	if !forceCompile && fileExists(paths.CCS) && fileExists(paths.ProvingKey) && fileExists(paths.VerifyingKey) {
+		return LoadCircuit(ctx, paths, encoding, progress)
+	}
+	if err := checkSetup(); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: artifacts missing or recompilation forced: %w", paths.VerifyingKey, err)
+	}
+
+	ccs, err := CompileCircuit(ctx, circuitTemplate, progress)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pk, vk, err := SetupCircuit(ctx, ccs, progress)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := SaveCircuit(ctx, paths, ccs, pk, vk, encoding, progress); err != nil {
+		return nil, nil, nil, err
+	}
+	return ccs, pk, vk, nil
+}
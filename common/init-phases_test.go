@@ -0,0 +1,177 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+// phaseRecorder records the reported phases as "started:phase" and
+// "done:phase"
+func phaseRecorder(events *[]string) ProgressReporter {
+	return ProgressFuncs{
+		Started: func(phase Phase) { *events = append(*events, "started:"+string(phase)) },
+		Done: func(phase Phase, elapsed time.Duration, err error) {
+			if err != nil {
+				*events = append(*events, "failed:"+string(phase))
+				return
+			}
+			*events = append(*events, "done:"+string(phase))
+		},
+	}
+}
+
+func TestInitCircuitContext(t *testing.T) {
+	t.Chdir(t.TempDir())
+	paths := CircuitPaths{CCS: "compiled/circuit.ccs", ProvingKey: "compiled/proving.key", VerifyingKey: "compiled/verifying.key"}
+	ctx := context.Background()
+
+	var events []string
+	ccs, pk, vk, err := InitCircuitContext(ctx, paths, false, &powerCircuit{N: 4}, KeyEncodingRaw, phaseRecorder(&events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ccs == nil || pk == nil || vk == nil {
+		t.Fatal("expected the compiled circuit and its keys")
+	}
+	want := []string{"started:compile", "done:compile", "started:setup", "done:setup", "started:save", "done:save"}
+	if !slices.Equal(events, want) {
+		t.Fatalf("phases %v, expected %v", events, want)
+	}
+	if tmps, _ := filepath.Glob("compiled/*.tmp"); len(tmps) != 0 {
+		t.Fatalf("temporary files left: %v", tmps)
+	}
+
+	// the saved artifacts are loaded, with the encoding of their manifest
+	data, err := os.ReadFile("compiled/proving.key.manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := artifact.ParseManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Artifacts) != 3 || m.HintSet != HintSetVersion {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	for _, a := range m.Artifacts {
+		expected := ""
+		if a.Key == "proving.key" {
+			expected = "raw"
+		}
+		if a.Encoding != expected {
+			t.Fatalf("%s: encoding %q, expected %q", a.Key, a.Encoding, expected)
+		}
+	}
+	events = nil
+	if _, _, _, err := InitCircuitContext(ctx, paths, false, &powerCircuit{N: 4}, KeyEncodingCompressed, phaseRecorder(&events)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"started:load", "done:load"}; !slices.Equal(events, want) {
+		t.Fatalf("phases %v, expected %v", events, want)
+	}
+	if _, _, _, err := LoadSetup(paths.CCS, paths.ProvingKey, paths.VerifyingKey); err != nil {
+		t.Fatalf("expected the raw key of the manifest loaded, got %v", err)
+	}
+
+	// a proving key replaced without its manifest is refused
+	if err := writeFile(paths.ProvingKey, func(w io.Writer) error { return writeProvingKey(w, pk, KeyEncodingCompressed) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := LoadCircuit(ctx, paths, KeyEncodingCompressed, ProgressFuncs{}); !errors.Is(err, artifact.ErrDigestMismatch) {
+		t.Fatalf("expected a manifest mismatch, got %v", err)
+	}
+	// artifacts without manifest are loaded with the encoding of the caller
+	if err := os.Remove("compiled/proving.key.manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := LoadCircuit(ctx, paths, KeyEncodingCompressed, ProgressFuncs{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := InitCircuitContext(ctx, CircuitPaths{CCS: "../circuit.ccs", ProvingKey: paths.ProvingKey, VerifyingKey: paths.VerifyingKey}, false, &powerCircuit{N: 4}, KeyEncodingRaw, phaseRecorder(&events)); err == nil {
+		t.Fatal("expected an error for a path outside the working directory")
+	}
+}
+
+func TestInitCircuitContextCanceled(t *testing.T) {
+	t.Chdir(t.TempDir())
+	paths := CircuitPaths{CCS: "compiled/circuit.ccs", ProvingKey: "compiled/proving.key", VerifyingKey: "compiled/verifying.key"}
+
+	// canceled during the setup: the phase ends at once with the cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var events []string
+	progress := ProgressFuncs{
+		Started: func(phase Phase) {
+			events = append(events, "started:"+string(phase))
+			if phase == PhaseSetup {
+				cancel()
+			}
+		},
+		Done: phaseRecorder(&events).PhaseDone,
+	}
+	_, _, _, err := InitCircuitContext(ctx, paths, true, &powerCircuit{N: 4}, KeyEncodingRaw, progress)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation, got %v", err)
+	}
+	want := []string{"started:compile", "done:compile", "started:setup", "failed:setup"}
+	if !slices.Equal(events, want) {
+		t.Fatalf("phases %v, expected %v", events, want)
+	}
+	if _, err := os.Stat("compiled"); !os.IsNotExist(err) {
+		t.Fatal("expected no artifacts")
+	}
+
+	// a canceled save leaves the previous artifacts in place
+	if _, _, _, err := InitCircuitContext(context.Background(), paths, false, &powerCircuit{N: 4}, KeyEncodingRaw, ProgressFuncs{}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(paths.VerifyingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ccs, err := CompileCircuit(context.Background(), &powerCircuit{N: 4}, ProgressFuncs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := SetupCircuit(context.Background(), ccs, ProgressFuncs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := SaveCircuit(ctx, paths, ccs, pk, vk, KeyEncodingRaw, ProgressFuncs{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation, got %v", err)
+	}
+	after, err := os.ReadFile(paths.VerifyingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(before, after) {
+		t.Fatal("the canceled save replaced the verifying key")
+	}
+	if tmps, _ := filepath.Glob("compiled/*.tmp"); len(tmps) != 0 {
+		t.Fatalf("temporary files left: %v", tmps)
+	}
+}
+
+// writeFile writes the file with write
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
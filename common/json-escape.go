@@ -0,0 +1,235 @@
+package common
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// jsonSimpleEscapes are the characters following a backslash and the bytes
+// they stand for, \u excepted. A slice: the circuits iterate it in order.
+var jsonSimpleEscapes = []struct{ char, value byte }{
+	{'"', '"'}, {'\\', '\\'}, {'/', '/'}, {'b', '\b'}, {'f', '\f'}, {'n', '\n'}, {'r', '\r'}, {'t', '\t'},
+}
+
+// jsonSimpleEscape returns the byte the escape \c stands for
+func jsonSimpleEscape(c byte) (byte, bool) {
+	for _, e := range jsonSimpleEscapes {
+		if e.char == c {
+			return e.value, true
+		}
+	}
+	return 0, false
+}
+
+// UnescapeJSONString decodes the escapes of a raw JSON string value (between
+// the quotes) as GetEscapedStringValueUpTo does in-circuit: \uXXXX escapes of
+// the Basic Multilingual Plane are encoded in UTF-8 ("M\u00fcnchen" is
+// "München"), the other bytes are kept as they are. Surrogate escapes are
+// rejected, so a value has a single decoding in and out of the circuit.
+func UnescapeJSONString(raw []byte) (string, error) {
+	value := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '"' {
+			return "", fmt.Errorf("unescaped quote at %d", i)
+		}
+		if raw[i] != '\\' {
+			value = append(value, raw[i])
+			continue
+		}
+		if i+1 == len(raw) {
+			return "", fmt.Errorf("truncated escape at %d", i)
+		}
+		if b, ok := jsonSimpleEscape(raw[i+1]); ok {
+			value = append(value, b)
+			i++
+			continue
+		}
+		if raw[i+1] != 'u' || i+6 > len(raw) {
+			return "", fmt.Errorf("invalid escape at %d", i)
+		}
+		var r rune
+		for _, h := range raw[i+2 : i+6] {
+			d, ok := hexDigitValue(h)
+			if !ok {
+				return "", fmt.Errorf("invalid \\u escape at %d", i)
+			}
+			r = r<<4 | rune(d)
+		}
+		if utf8.RuneLen(r) < 0 {
+			return "", fmt.Errorf("surrogate \\u escape at %d is not supported", i)
+		}
+		value = utf8.AppendRune(value, r)
+		i += 5
+	}
+	return string(value), nil
+}
+
+func hexDigitValue(h byte) (byte, bool) {
+	switch {
+	case '0' <= h && h <= '9':
+		return h - '0', true
+	case 'a' <= h && h <= 'f':
+		return h - 'a' + 10, true
+	case 'A' <= h && h <= 'F':
+		return h - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// GetEscapedStringValueUpTo extracts a JSON string value like
+// GetStringValueUpTo, decoding its escapes as UnescapeJSONString: the value
+// at valuePosition must be preceded by key and ends at the first unescaped
+// quote, within maxLength bytes of escaped JSON. It returns the decoded value
+// zero padded to maxLength bytes and its length. The escapes are parsed from
+// the start of the value, so the decoding is deterministic; invalid and
+// surrogate escapes fail the assertions. json must hold maxLength+1 bytes
+// from valuePosition.
+func GetEscapedStringValueUpTo(api frontend.API, json []uints.U8, valuePosition frontend.Variable, key string, maxLength int) ([]uints.U8, frontend.Variable) {
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		panic(err)
+	}
+
+	claim := GetSubset(api, json, api.Sub(valuePosition, len(key)), len(key)+maxLength+1)
+	AssertBytesEqual(api, claim[:len(key)], StringToU8Array(key), "json key %s", key)
+	raw := claim[len(key):]
+
+	// role of each byte, one-hot: normal, backslash, escaped character,
+	// hex digits of a \u escape
+	var normal, backslash, escaped frontend.Variable = 1, 0, 0
+	hex := [4]frontend.Variable{0, 0, 0, 0}
+	var digits [4]frontend.Variable // values of the last 4 bytes as hex digits
+
+	// bytes each position contributes to the value: out[i] where written[i]
+	written := make([][3]frontend.Variable, maxLength)
+	out := make([][3]frontend.Variable, maxLength)
+
+	ended := frontend.Variable(0)
+	for i, b := range raw {
+		isBackslash := api.IsZero(api.Sub(b.Val, '\\'))
+		if i > 0 {
+			// a backslash starts an escape after a normal byte or a complete escape
+			isU := api.Mul(escaped, api.IsZero(api.Sub(raw[i-1].Val, 'u')))
+			free := api.Add(normal, api.Sub(escaped, isU), hex[3])
+			normal, backslash, escaped = api.Mul(free, api.Sub(1, isBackslash)), api.Mul(free, isBackslash), backslash
+			hex = [4]frontend.Variable{isU, hex[0], hex[1], hex[2]}
+		} else {
+			normal, backslash = api.Sub(1, isBackslash), isBackslash
+		}
+
+		ended = api.Or(ended, api.Mul(normal, api.IsZero(api.Sub(b.Val, '"'))))
+		if i == maxLength {
+			break
+		}
+		inValue := api.Sub(1, ended)
+
+		// escaped character: one of jsonSimpleEscapes or u
+		isU := api.IsZero(api.Sub(b.Val, 'u'))
+		simple, mapped := frontend.Variable(0), frontend.Variable(0)
+		for _, e := range jsonSimpleEscapes {
+			is := api.IsZero(api.Sub(b.Val, e.char))
+			simple = api.Add(simple, is)
+			mapped = api.Add(mapped, api.Mul(is, e.value))
+		}
+		AssertEqual(api, api.Mul(inValue, escaped, api.Sub(1, api.Add(simple, isU))), 0, "json key %s: invalid escape at %d", key, i)
+		isSimple := api.Mul(escaped, simple)
+
+		// hex digit of a \u escape
+		digit, isDigit := hexDigit(api, b.Val)
+		inHex := api.Add(hex[0], hex[1], hex[2], hex[3])
+		AssertEqual(api, api.Mul(inValue, inHex, api.Sub(1, isDigit)), 0, "json key %s: invalid \\u escape at %d", key, i)
+		digits = [4]frontend.Variable{digits[1], digits[2], digits[3], digit}
+
+		// the code point completed by the 4th digit, in UTF-8
+		var codePoint frontend.Variable = 0
+		if i >= 3 {
+			codePoint = api.Add(api.Mul(digits[0], 1<<12), api.Mul(digits[1], 1<<8), api.Mul(digits[2], 1<<4), digits[3])
+		}
+		size, utf := utf8Encode(api, codePoint)
+		AssertEqual(api, api.Mul(inValue, hex[3], size[3]), 0, "json key %s: surrogate \\u escape at %d", key, i)
+
+		// out[i][k] is a byte of the value when written[i][k]
+		written[i] = [3]frontend.Variable{
+			api.Mul(inValue, api.Add(normal, isSimple, hex[3])),
+			api.Mul(inValue, hex[3], api.Add(size[1], size[2])),
+			api.Mul(inValue, hex[3], size[2]),
+		}
+		out[i] = [3]frontend.Variable{
+			api.Add(api.Mul(normal, b.Val), api.Mul(isSimple, mapped), api.Mul(hex[3], utf[0])),
+			api.Mul(hex[3], utf[1]),
+			api.Mul(hex[3], utf[2]),
+		}
+	}
+	AssertEqual(api, ended, 1, "json key %s: closing quote within %d bytes", key, maxLength)
+
+	// place the contributions at their offsets in the value: a position
+	// contributes at most as many bytes as it follows, so offset <= i
+	value := make([]frontend.Variable, maxLength)
+	for j := range value {
+		value[j] = 0
+	}
+	offset := frontend.Variable(0)
+	for i := range written {
+		for k := range 3 {
+			for j := k; j <= i+k && j < maxLength; j++ {
+				at := api.Mul(written[i][k], api.IsZero(api.Sub(offset, j-k)))
+				value[j] = api.Add(value[j], api.Mul(at, out[i][k]))
+			}
+		}
+		offset = api.Add(offset, written[i][0], written[i][1], written[i][2])
+	}
+
+	result := make([]uints.U8, maxLength)
+	for j := range result {
+		result[j] = bytesAPI.ValueOf(value[j])
+	}
+	return result, offset
+}
+
+// hexDigit returns the value of the ASCII hex digit b, and 1 when b is a
+// hex digit (0 and 0 otherwise)
+func hexDigit(api frontend.API, b frontend.Variable) (frontend.Variable, frontend.Variable) {
+	value, is := frontend.Variable(0), frontend.Variable(0)
+	for _, c := range []byte("0123456789abcdefABCDEF") {
+		d, _ := hexDigitValue(c)
+		match := api.IsZero(api.Sub(b, c))
+		is = api.Add(is, match)
+		value = api.Add(value, api.Mul(match, d))
+	}
+	return value, is
+}
+
+// utf8Encode returns the UTF-8 encoding of a 16 bits code point: size is
+// one-hot for 1, 2 and 3 bytes, size[3] is set for surrogates, and utf the
+// encoded bytes
+func utf8Encode(api frontend.API, codePoint frontend.Variable) ([4]frontend.Variable, [3]frontend.Variable) {
+	bits := api.ToBinary(codePoint, 16)
+	from := func(lo, hi int) frontend.Variable {
+		return api.FromBinary(bits[lo:hi]...)
+	}
+
+	below80 := api.IsZero(from(7, 16))
+	below800 := api.IsZero(from(11, 16))
+	one := below80
+	two := api.Sub(below800, below80)
+	three := api.Sub(1, below800)
+	// 0xD800 to 0xDFFF: top bits 11011
+	surrogate := api.IsZero(api.Sub(from(11, 16), 0x1B))
+
+	utf := [3]frontend.Variable{
+		api.Add(
+			api.Mul(one, codePoint),
+			api.Mul(two, api.Add(0xC0, from(6, 11))),
+			api.Mul(three, api.Add(0xE0, from(12, 16))),
+		),
+		api.Add(
+			api.Mul(two, api.Add(0x80, from(0, 6))),
+			api.Mul(three, api.Add(0x80, from(6, 12))),
+		),
+		api.Mul(three, api.Add(0x80, from(0, 6))),
+	}
+	return [4]frontend.Variable{one, two, three, surrogate}, utf
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+func TestUnescapeJSONString(t *testing.T) {
+	tests := []struct {
+		raw   string
+		value string
+		valid bool
+	}{
+		{`M\u00fcnchen`, "München", true},
+		{`M\u00FCnchen`, "München", true},
+		{`München`, "München", true},
+		{`\u20ac 5 \"net\"\/\\`, `€ 5 "net"/\`, true},
+		{`line\nbreak\t`, "line\nbreak\t", true},
+		// surrogate pair of U+1F600
+		{`\ud83d\ude00`, "", false},
+		{`\x41`, "", false},
+		{`\u00f`, "", false},
+		{`\u00fg`, "", false},
+		{`end\`, "", false},
+		{`a"b`, "", false},
+	}
+	for _, tt := range tests {
+		value, err := UnescapeJSONString([]byte(tt.raw))
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v, got %v", tt.raw, tt.valid, err)
+			continue
+		}
+		if !tt.valid {
+			continue
+		}
+		if value != tt.value {
+			t.Errorf("%s: got %q, expected %q", tt.raw, value, tt.value)
+		}
+		// same decoding as encoding/json for the supported escapes
+		var decoded string
+		if err := json.Unmarshal([]byte(`"`+tt.raw+`"`), &decoded); err != nil || decoded != value {
+			t.Errorf("%s: encoding/json decodes %q (%v)", tt.raw, decoded, err)
+		}
+	}
+}
+
+// escapedStringValueCircuit extracts the value of a claim with
+// GetEscapedStringValueUpTo
+type escapedStringValueCircuit struct {
+	JSON     []uints.U8
+	Position frontend.Variable
+	Value    []uints.U8 // zero padded
+	Length   frontend.Variable
+
+	Key string `gnark:"-"`
+}
+
+func (c *escapedStringValueCircuit) Define(api frontend.API) error {
+	value, length := GetEscapedStringValueUpTo(api, c.JSON, c.Position, ClaimKey(c.Key), len(c.Value))
+	AssertBytesEqual(api, value, c.Value, "value")
+	AssertEqual(api, length, c.Length, "length")
+	return nil
+}
+
+func TestGetEscapedStringValueUpTo(t *testing.T) {
+	const maxLength = 20
+	tests := []struct {
+		json  string
+		value string
+		valid bool
+	}{
+		{`{"city":"M\u00fcnchen","x":"yyyyyyyyyyyyyyyyyyyy"}`, "München", true},
+		{`{"city":"\u20ac\"\\\/x","x":"yyyyyyyyyyyyyyyyyyyy"}`, `€"\/x`, true},
+		{`{"city":"Ljubljana","x":"yyyyyyyyyyyyyyyyyyyy"}`, "Ljubljana", true},
+		{`{"city":"","x":"yyyyyyyyyyyyyyyyyyyy"}`, "", true},
+		// the escaped form is not the value
+		{`{"city":"M\u00fcnchen","x":"yyyyyyyyyyyyyyyyyyyy"}`, `M\u00fcnchen`, false},
+		// an escaped quote does not end the value
+		{`{"city":"a\"b","x":"yyyyyyyyyyyyyyyyyyyy"}`, "a", false},
+		// surrogate escape
+		{`{"city":"\ud83d\ude00","x":"yyyyyyyyyyyyyyyyyyyy"}`, "", false},
+		// invalid escapes
+		{`{"city":"\x41","x":"yyyyyyyyyyyyyyyyyyyy"}`, "A", false},
+		{`{"city":"\u00g1","x":"yyyyyyyyyyyyyyyyyyyy"}`, "", false},
+		// longer than maxLength escaped bytes
+		{`{"city":"\u00fc\u00fc\u00fc\u00fc","x":"yyyyyyyyyyyyyyyyyyyy"}`, "üüüü", false},
+	}
+	for _, tt := range tests {
+		circuit := &escapedStringValueCircuit{JSON: make([]uints.U8, len(tt.json)), Value: make([]uints.U8, maxLength), Key: "city"}
+		padded := make([]byte, maxLength)
+		copy(padded, tt.value)
+		assignment := &escapedStringValueCircuit{
+			JSON:     StringToU8Array(tt.json),
+			Position: len(`{"city":"`),
+			Value:    BytesToU8Array(padded),
+			Length:   len(tt.value),
+		}
+		err := CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v, got %v", tt.json, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// AlgES256 is the JWS alg of the ECDSA P-256 SHA-256 signatures verified by
+// the circuits
+const AlgES256 = "ES256"
+
+// headerAlgKey is the quoted name of the alg member. A raw quote cannot occur
+// inside a JSON string, so every occurrence is a member name or the string
+// value "alg".
+const headerAlgKey = `"alg"`
+
+// HeaderAlgMember returns the alg member of a compact JSON protected header:
+// "alg":"ES256" for AlgES256
+func HeaderAlgMember(alg string) string {
+	return headerAlgKey + `:"` + alg + `"`
+}
+
+// FindHeaderAlg returns the position of the alg member (HeaderAlgMember) in
+// the decoded base64url protected header, the witness of AssertHeaderAlg. It
+// fails as AssertHeaderAlg would: the header must be a JSON object without
+// escapes, with a single alg, set to alg, member of the object.
+func FindHeaderAlg(protectedB64, alg string) (int, error) {
+	header, err := base64.RawURLEncoding.DecodeString(protectedB64)
+	if err != nil {
+		return 0, fmt.Errorf("protected header: %w", err)
+	}
+	json := string(header)
+	if !strings.HasPrefix(json, "{") {
+		return 0, fmt.Errorf("protected header is not a JSON object")
+	}
+	if strings.Contains(json, `\`) {
+		return 0, fmt.Errorf("protected header with escapes")
+	}
+	if n := strings.Count(json, headerAlgKey); n != 1 {
+		return 0, fmt.Errorf("protected header with %d alg members, expected 1", n)
+	}
+	member := HeaderAlgMember(alg)
+	pos := strings.Index(json, member)
+	if pos < 1 {
+		return 0, fmt.Errorf("protected header alg is not %s", alg)
+	}
+	end := pos + len(member)
+	if before := json[pos-1]; before != '{' && before != ',' || end == len(json) || json[end] != ',' && json[end] != '}' {
+		return 0, fmt.Errorf("protected header alg is not a member of the object")
+	}
+	return pos, nil
+}
+
+// AssertHeaderAlg asserts that the base64url protected header (not padded)
+// declares the JWS algorithm alg: the decoded header has the member
+// "alg":"<alg>" at algPosition (witness, see FindHeaderAlg), bound to a
+// member name by the '{' or ',' before it and the ',' or '}' after it. A
+// second alg member, nested or escaped (e.g. "alg":"none"), could
+// override it for a downstream parser, so the header must have a single
+// quoted "alg" and no escapes. This excludes "none" and any other algorithm,
+// whichever signature the circuit verifies. The header must be compact JSON,
+// without whitespace around the colon of the alg member.
+func AssertHeaderAlg(api frontend.API, protected []uints.U8, algPosition frontend.Variable, alg string) error {
+	header, err := DecodeBase64Url(api, protected)
+	if err != nil {
+		return err
+	}
+	member := HeaderAlgMember(alg)
+	if len(header) < len(member)+2 {
+		return fmt.Errorf("protected header of %d bytes shorter than %s", len(header), member)
+	}
+
+	AssertEqual(api, header[0].Val, '{', "protected header: JSON object")
+
+	// the member with the bytes around it, algPosition 0 is out of range
+	claim := GetSubset(api, header, api.Sub(algPosition, 1), len(member)+2)
+	before, after := claim[0].Val, claim[len(claim)-1].Val
+	AssertEqual(api, api.Mul(api.Sub(before, '{'), api.Sub(before, ',')), 0, "protected header: alg member name")
+	AssertBytesEqual(api, claim[1:len(claim)-1], StringToU8Array(member), "protected header: %s", member)
+	AssertEqual(api, api.Mul(api.Sub(after, ','), api.Sub(after, '}')), 0, "protected header: alg member end")
+
+	// a single "alg" and no escapes
+	algKey := StringToU8Array(headerAlgKey)
+	count := frontend.Variable(0)
+	for i := range header {
+		AssertDifferent(api, header[i].Val, '\\', "protected header: escape")
+		count = api.Add(count, EqualPrefix(api, header[i:], algKey))
+	}
+	AssertEqual(api, count, 1, "protected header: single alg member")
+
+	return nil
+}
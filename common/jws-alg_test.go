@@ -0,0 +1,75 @@
+package common
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+type headerAlgCircuit struct {
+	Protected   []uints.U8
+	AlgPosition frontend.Variable
+}
+
+func (c *headerAlgCircuit) Define(api frontend.API) error {
+	return AssertHeaderAlg(api, c.Protected, c.AlgPosition, AlgES256)
+}
+
+func TestAssertHeaderAlg(t *testing.T) {
+	valid := []string{
+		`{"alg":"ES256"}`,
+		`{"alg":"ES256","typ":"JWT"}`,
+		`{"typ":"vc+sd-jwt","alg":"ES256","kid":"1"}`,
+	}
+	for _, header := range valid {
+		protected := base64.RawURLEncoding.EncodeToString([]byte(header))
+		pos, err := FindHeaderAlg(protected, AlgES256)
+		if err != nil {
+			t.Fatalf("%s: %v", header, err)
+		}
+		circuit := &headerAlgCircuit{Protected: StringToU8Array(protected), AlgPosition: pos}
+		if err := CheckWitness(circuit, circuit); err != nil {
+			t.Fatalf("%s: %v", header, err)
+		}
+	}
+
+	tests := []struct {
+		name, header string
+		pos          int // position of the witnessed "alg":"ES256", -1 for none
+	}{
+		{"none", `{"alg":"none","typ":"JWT"}`, -1},
+		{"other algorithm", `{"alg":"HS256","typ":"JWT"}`, -1},
+		{"duplicate alg", `{"alg":"ES256","alg":"none"}`, 1},
+		{"nested alg", `{"x":{"alg":"ES256"},"alg":"none"}`, 7},
+		{"escaped alg", `{"alg":"ES256","\u0061lg":"none"}`, 1},
+		{"alg of a longer name", `{"xalg":"ES256","typ":"JWT"}`, -1},
+		{"shorter name", `{"al":"ES256","typ":"JWT"}`, 1},
+		{"alg at the end", `{"alg":"ES256","x":1,"alg"`, 1},
+		{"prefix of a longer value", `{"alg":"ES256K","typ":"JWT"}`, -1},
+		{"not an object", `["alg":"ES256"]`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protected := base64.RawURLEncoding.EncodeToString([]byte(tt.header))
+			if _, err := FindHeaderAlg(protected, AlgES256); err == nil {
+				t.Fatal("expected FindHeaderAlg to fail")
+			}
+
+			// the prover points at the member, or at any position
+			positions := []int{tt.pos}
+			if tt.pos < 0 {
+				positions = []int{0, 1, 2, 5}
+			}
+			for _, pos := range positions {
+				circuit := &headerAlgCircuit{Protected: StringToU8Array(protected), AlgPosition: pos}
+				var werr *WitnessError
+				if err := CheckWitness(circuit, circuit); !errors.As(err, &werr) {
+					t.Fatalf("position %d: expected a witness error, got %v", pos, err)
+				}
+			}
+		})
+	}
+}
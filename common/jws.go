@@ -0,0 +1,134 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_emulated"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// JWSPart is a base64url encoded part of a JWS (protected header or payload).
+// Len is the length of a part zero padded to len(Bytes), for variable-length
+// inputs; nil when the part fills Bytes.
+type JWSPart struct {
+	Bytes []uints.U8
+	Len   frontend.Variable
+}
+
+// SigningInput is the JWS signing input protected || '.' || payload: the
+// first Len bytes of Bytes, the bytes past Len are zero
+type SigningInput struct {
+	Bytes []uints.U8
+	Len   frontend.Variable
+
+	// padded is set when Len is a variable
+	padded bool
+}
+
+// BuildSigningInput concatenates the JWS signing input protected || '.' ||
+// payload. Parts without Len are concatenated as they are; a padded payload
+// is masked past its length, a padded protected header also shifts the
+// separator and the payload to its length, which costs about
+// len(protected.Bytes) * len(payload.Bytes) constraints.
+func BuildSigningInput(api frontend.API, protected, payload JWSPart) (*SigningInput, error) {
+	if len(protected.Bytes) == 0 {
+		return nil, fmt.Errorf("jws: empty protected header")
+	}
+	maxLen := len(protected.Bytes) + 1 + len(payload.Bytes)
+	dot := uints.NewU8('.')
+
+	payloadBytes, payloadLen := payload.Bytes, frontend.Variable(len(payload.Bytes))
+	if payload.Len != nil {
+		payloadBytes, payloadLen = maskPart(api, payload)
+	}
+
+	if protected.Len == nil {
+		input := make([]uints.U8, 0, maxLen)
+		input = append(input, protected.Bytes...)
+		input = append(input, dot)
+		input = append(input, payloadBytes...)
+		return &SigningInput{
+			Bytes:  input,
+			Len:    api.Add(len(protected.Bytes)+1, payloadLen),
+			padded: payload.Len != nil,
+		}, nil
+	}
+
+	// atProtectedLen[k] is 1 when the protected header is k bytes long
+	protectedBytes, protectedLen := maskPart(api, protected)
+	atProtectedLen := make([]frontend.Variable, len(protected.Bytes)+1)
+	for k := range atProtectedLen {
+		atProtectedLen[k] = api.IsZero(api.Sub(protectedLen, k))
+	}
+
+	input := make([]uints.U8, maxLen)
+	for i := range input {
+		value := frontend.Variable(0)
+		if i < len(protectedBytes) {
+			value = protectedBytes[i].Val
+		}
+		if i < len(atProtectedLen) {
+			value = api.Add(value, api.Mul(atProtectedLen[i], '.'))
+		}
+		// payload byte j is at protectedLen + 1 + j
+		for j := max(0, i-len(protected.Bytes)-1); j < min(len(payloadBytes), i); j++ {
+			value = api.Add(value, api.Mul(atProtectedLen[i-1-j], payloadBytes[j].Val))
+		}
+		// at most one term is set, value is a byte
+		input[i] = uints.U8{Val: value}
+	}
+	return &SigningInput{Bytes: input, Len: api.Add(protectedLen, 1, payloadLen), padded: true}, nil
+}
+
+// maskPart asserts the length of a padded part and zeroes its bytes past the
+// length
+func maskPart(api frontend.API, part JWSPart) ([]uints.U8, frontend.Variable) {
+	api.AssertIsLessOrEqual(part.Len, len(part.Bytes))
+	masked := make([]uints.U8, len(part.Bytes))
+	inPart := frontend.Variable(1)
+	for i, b := range part.Bytes {
+		inPart = api.Sub(inPart, api.IsZero(api.Sub(part.Len, i)))
+		masked[i] = uints.U8{Val: api.Mul(inPart, b.Val)}
+	}
+	return masked, part.Len
+}
+
+// Digest returns the SHA-256 digest of the signing input
+func (s *SigningInput) Digest(api frontend.API) ([]uints.U8, error) {
+	h, release, err := NewSHA256(api)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	h.Write(s.Bytes)
+	if s.padded {
+		return h.FixedLengthSum(s.Len), nil
+	}
+	return h.Sum(), nil
+}
+
+// VerifySigningInput verifies the ES256 signature of a JWS signing input
+func VerifySigningInput(api frontend.API, input *SigningInput, publicKey curves.PublicKey, signature curves.Signature) error {
+	digest, err := input.Digest(api)
+	if err != nil {
+		return err
+	}
+	mHash, err := Sha256ToP256Fr(api, digest)
+	if err != nil {
+		return err
+	}
+	publicKey.Verify(api, sw_emulated.GetCurveParams[emulated.P256Fp](), mHash, &signature)
+	return nil
+}
+
+// VerifyJWS verifies a JWS signature where protected header and payload are provided separately. This way we can provide the protected header as a private input and the payload as public or private input. The function adds the . separator, hence the protected header must be only base64url encoded, without the .
+func VerifyJWS(api frontend.API, protected []uints.U8, payload []uints.U8, publicKey curves.PublicKey, signature curves.Signature) error {
+	input, err := BuildSigningInput(api, JWSPart{Bytes: protected}, JWSPart{Bytes: payload})
+	if err != nil {
+		return err
+	}
+	return VerifySigningInput(api, input, publicKey, signature)
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// signingInputCircuit hashes the signing input of padded or full parts
+type signingInputCircuit struct {
+	Protected    []uints.U8
+	ProtectedLen frontend.Variable
+	Payload      []uints.U8
+	PayloadLen   frontend.Variable
+	Digest       []uints.U8 `gnark:",public"`
+
+	// Padded selects which parts are padded: "", "payload" or "both"
+	Padded string `gnark:"-"`
+}
+
+func (c *signingInputCircuit) Define(api frontend.API) error {
+	protected, payload := JWSPart{Bytes: c.Protected}, JWSPart{Bytes: c.Payload}
+	switch c.Padded {
+	case "":
+		// full parts, the lengths are not used
+		AssertEqual(api, c.ProtectedLen, len(c.Protected), "protected length")
+		AssertEqual(api, c.PayloadLen, len(c.Payload), "payload length")
+	case "payload":
+		AssertEqual(api, c.ProtectedLen, len(c.Protected), "protected length")
+		payload.Len = c.PayloadLen
+	case "both":
+		protected.Len, payload.Len = c.ProtectedLen, c.PayloadLen
+	default:
+		return fmt.Errorf("unknown padding %q", c.Padded)
+	}
+
+	input, err := BuildSigningInput(api, protected, payload)
+	if err != nil {
+		return err
+	}
+	digest, err := input.Digest(api)
+	if err != nil {
+		return err
+	}
+	AssertBytesEqual(api, digest, c.Digest, "signing input digest")
+	return nil
+}
+
+func padded(s string, size int) []uints.U8 {
+	b := make([]byte, size)
+	copy(b, s)
+	return BytesToU8Array(b)
+}
+
+func TestBuildSigningInput(t *testing.T) {
+	const protected, payload = "eyJhbGciOiJFUzI1NiJ9", "eyJuYW1lIjoiQWxpY2UifQ"
+	digest := sha256.Sum256([]byte(protected + "." + payload))
+
+	tests := []struct {
+		padded                   string
+		protectedLen, payloadLen int // padded sizes
+		digest                   []byte
+		valid                    bool
+	}{
+		{"", len(protected), len(payload), digest[:], true},
+		{"payload", len(protected), 40, digest[:], true},
+		{"both", 28, 40, digest[:], true},
+		{"both", len(protected), len(payload), digest[:], true},
+		// another signing input
+		{"both", 28, 40, make([]byte, 32), false},
+	}
+	for _, tt := range tests {
+		circuit := &signingInputCircuit{
+			Protected: make([]uints.U8, tt.protectedLen),
+			Payload:   make([]uints.U8, tt.payloadLen),
+			Digest:    make([]uints.U8, 32),
+			Padded:    tt.padded,
+		}
+		assignment := &signingInputCircuit{
+			Protected:    padded(protected, tt.protectedLen),
+			ProtectedLen: len(protected),
+			Payload:      padded(payload, tt.payloadLen),
+			PayloadLen:   len(payload),
+			Digest:       BytesToU8Array(tt.digest),
+		}
+		err := CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%s %d/%d: expected valid=%v, got %v", tt.padded, tt.protectedLen, tt.payloadLen, tt.valid, err)
+		}
+	}
+
+	// the length must fit the padded part
+	circuit := &signingInputCircuit{Protected: make([]uints.U8, 8), Payload: make([]uints.U8, 8), Digest: make([]uints.U8, 32), Padded: "both"}
+	assignment := &signingInputCircuit{Protected: padded("", 8), ProtectedLen: 9, Payload: padded("", 8), PayloadLen: 0, Digest: BytesToU8Array(digest[:])}
+	if err := CheckWitness(circuit, assignment); err == nil {
+		t.Fatal("expected a length beyond the part to fail")
+	}
+}
+
+// blocksCircuit hashes the signing input of a payload padded to its blocks
+type blocksCircuit struct {
+	Protected     []uints.U8
+	Payload       []uints.U8
+	PayloadLen    []frontend.Variable
+	PayloadBlocks []frontend.Variable
+	Digest        []uints.U8 `gnark:",public"`
+
+	Blocks PayloadBlocks `gnark:"-"`
+}
+
+func (c *blocksCircuit) Define(api frontend.API) error {
+	payload, err := c.Blocks.Part(api, c.Payload, c.PayloadLen, c.PayloadBlocks)
+	if err != nil {
+		return err
+	}
+	input, err := BuildSigningInput(api, JWSPart{Bytes: c.Protected}, payload)
+	if err != nil {
+		return err
+	}
+	digest, err := input.Digest(api)
+	if err != nil {
+		return err
+	}
+	AssertBytesEqual(api, digest, c.Digest, "signing input digest")
+	return nil
+}
+
+func TestPayloadBlocks(t *testing.T) {
+	const protected = "eyJhbGciOiJFUzI1NiJ9"
+	blocks := PayloadBlocks{BlockSize: 16, MaxBlocks: 4}
+
+	bytes, lengths, counts := blocks.Inputs()
+	circuit := &blocksCircuit{
+		Protected:     make([]uints.U8, len(protected)),
+		Payload:       bytes,
+		PayloadLen:    lengths,
+		PayloadBlocks: counts,
+		Digest:        make([]uints.U8, 32),
+		Blocks:        blocks,
+	}
+	assign := func(payload string) *blocksCircuit {
+		digest := sha256.Sum256([]byte(protected + "." + payload))
+		bytes, lengths, counts, err := blocks.Assign(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &blocksCircuit{
+			Protected:     StringToU8Array(protected),
+			Payload:       bytes,
+			PayloadLen:    lengths,
+			PayloadBlocks: counts,
+			Digest:        BytesToU8Array(digest[:]),
+		}
+	}
+
+	// one circuit for payloads of 1 to 4 blocks
+	for _, payload := range []string{"eyJhIjoxfQ", "eyJuYW1lIjoiQWxpY2UifQ", "eyJuYW1lIjoiQWxpY2UiLCJhZ2UiOjQyLCJjaXR5IjoiUGFyaXMifQ"} {
+		if err := CheckWitness(circuit, assign(payload)); err != nil {
+			t.Errorf("%d bytes: expected the witness to satisfy the circuit: %v", len(payload), err)
+		}
+	}
+
+	// a wrong block count
+	assignment := assign("eyJuYW1lIjoiQWxpY2UifQ")
+	assignment.PayloadBlocks = []frontend.Variable{1}
+	if err := CheckWitness(circuit, assignment); err == nil {
+		t.Error("expected a wrong block count to fail")
+	}
+
+	// bytes past the length
+	assignment = assign("eyJuYW1lIjoiQWxpY2UifQ")
+	assignment.Payload[40] = uints.NewU8('A')
+	if err := CheckWitness(circuit, assignment); err == nil {
+		t.Error("expected non-zero padding to fail")
+	}
+
+	if _, _, _, err := blocks.Assign(string(make([]byte, 65))); err == nil {
+		t.Error("expected a payload beyond the blocks to be rejected")
+	}
+}
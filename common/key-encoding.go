@@ -0,0 +1,90 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// EmulatedElementToBytes32 returns the 32 big-endian bytes of a P-256 base
+// field element, the encoding of a coordinate in an uncompressed key
+func EmulatedElementToBytes32(api frontend.API, elem emulated.Element[curves.Secp256r1Fp]) []uints.U8 {
+	return ElementToBytes32(api, elem)
+}
+
+// ElementToBytes32 returns the 32 big-endian bytes of an element of a field of
+// at most 256 bits, left padded with zeros (as big.Int.FillBytes).
+//
+// The element is asserted to be canonical, below the modulus. The limbs of an
+// assignment are not checked: limbs of x+p would otherwise give bytes other
+// than those of x, the bytes an off-circuit encoder produces for the point,
+// while the field arithmetic treats them as x. emulated.ValueOf reduces the
+// values mod p, except p itself.
+func ElementToBytes32[T emulated.FieldParams](api frontend.API, elem emulated.Element[T]) []uints.U8 {
+	var fp T
+	if fp.Modulus().BitLen() > 256 {
+		panic(fmt.Sprintf("ElementToBytes32: %d-bit field", fp.Modulus().BitLen()))
+	}
+	field, err := emulated.NewField[T](api)
+	if err != nil {
+		panic(err)
+	}
+
+	// LSB first; the assigned value must be canonical, below the modulus
+	reduced := field.Reduce(&elem)
+	field.AssertIsInRange(reduced)
+	bits := field.ToBits(reduced)
+	if len(bits) > 256 {
+		bits = bits[:256]
+	}
+	padded := make([]frontend.Variable, 256)
+	copy(padded, bits)
+	for i := len(bits); i < 256; i++ {
+		padded[i] = 0
+	}
+
+	// Byte 0 (most significant) holds bits 255..248, byte 31 bits 7..0
+	bytes := make([]uints.U8, 32)
+	for byteIdx := range 32 {
+		byteValue := frontend.Variable(0)
+		for bitIdx := range 8 {
+			bitPosition := (31-byteIdx)*8 + (7 - bitIdx)
+			byteValue = api.Add(api.Mul(byteValue, 2), padded[bitPosition])
+		}
+		bytes[byteIdx] = uints.U8{Val: byteValue}
+	}
+	return bytes
+}
+
+// ============================================================================
+// OFF-CIRCUIT KEY ENCODING
+// ============================================================================
+
+// Bytes32 returns the 32 big-endian bytes of v, left padded with zeros: the
+// bytes ElementToBytes32 returns for an element assigned v. v must be in
+// [0, 2^256).
+func Bytes32(v *big.Int) ([]byte, error) {
+	if v.Sign() < 0 {
+		return nil, fmt.Errorf("bytes32: negative value")
+	}
+	if v.BitLen() > 256 {
+		return nil, fmt.Errorf("bytes32: value of %d bits", v.BitLen())
+	}
+	return v.FillBytes(make([]byte, 32)), nil
+}
+
+// MarshalP256PublicKey returns the uncompressed SEC1 encoding of a P-256
+// public key (0x04 || X || Y), the bytes ComparePublicKeys compares and
+// PublicKeyDigest hashes. The key must be a point of P-256.
+func MarshalP256PublicKey(key *ecdsa.PublicKey) ([]byte, error) {
+	ecdhKey, err := key.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("P-256 public key: %w", err)
+	}
+	return ecdhKey.Bytes(), nil
+}
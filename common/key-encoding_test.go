@@ -0,0 +1,193 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	secp256k1ecdsa "github.com/consensys/gnark-crypto/ecc/secp256k1/ecdsa"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// bytes32Circuit asserts the bytes of an element of the field T
+type bytes32Circuit[T emulated.FieldParams] struct {
+	Elem     emulated.Element[T]
+	Expected []uints.U8
+}
+
+func (c *bytes32Circuit[T]) Define(api frontend.API) error {
+	AssertBytesEqual(api, ElementToBytes32(api, c.Elem), c.Expected, "element bytes")
+	return nil
+}
+
+// checkBytes32 solves the circuit for an element assigned v, with v both a
+// constant and a variable (the constant elements are converted off-circuit)
+func checkBytes32[T emulated.FieldParams](v *big.Int, expected []byte) error {
+	circuit := &bytes32Circuit[T]{Expected: make([]uints.U8, 32)}
+	assignment := &bytes32Circuit[T]{Elem: emulated.ValueOf[T](v), Expected: uints.NewU8Array(expected)}
+	if err := CheckWitness(circuit, assignment); err != nil {
+		return err
+	}
+	return test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+}
+
+// hexInt parses a hex test vector
+func hexInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid test vector %q", s)
+	}
+	return v
+}
+
+func TestElementToBytes32(t *testing.T) {
+	p := elliptic.P256().Params().P
+	pMinus1 := new(big.Int).Sub(p, big.NewInt(1))
+
+	vectors := []struct {
+		name  string
+		value *big.Int
+	}{
+		{"zero", big.NewInt(0)},
+		{"one", big.NewInt(1)},
+		{"one byte", big.NewInt(0xff)},
+		// leading zero bytes, which a minimal encoding drops
+		{"31 bytes", hexInt(t, "00ffeeddccbbaa99887766554433221100ffeeddccbbaa998877665544332211")},
+		{"limb boundary", hexInt(t, "10000000000000000")},
+		{"zero low limb", hexInt(t, "ffffffff00000001000000000000000000000000000000000000000000000000")},
+		// high bit set, the sign bit of a two's complement encoding
+		{"high bit", hexInt(t, "8000000000000000000000000000000000000000000000000000000000000000")},
+		{"p-1", pMinus1},
+	}
+	for _, v := range vectors {
+		expected, err := Bytes32(v.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkBytes32[curves.Secp256r1Fp](v.value, expected); err != nil {
+			t.Errorf("P-256 %s: %v", v.name, err)
+		}
+		if err := checkBytes32[curves.Secp256k1Fp](v.value, expected); err != nil {
+			t.Errorf("secp256k1 %s: %v", v.name, err)
+		}
+	}
+
+	// short values are left padded, not right padded
+	if err := checkBytes32[curves.Secp256r1Fp](big.NewInt(1), append([]byte{1}, make([]byte, 31)...)); err == nil {
+		t.Error("accepted the right padded bytes of 1")
+	}
+	if err := checkBytes32[curves.Secp256r1Fp](big.NewInt(0x0100), append(make([]byte, 31), 0x01)); err == nil {
+		t.Error("accepted the bytes of 1 for 256")
+	}
+}
+
+// TestElementToBytes32ValueOf checks the round-trips of values >= p through
+// emulated.ValueOf, which reduces them mod p, except p itself: its limbs are
+// those of p, a non-canonical zero, which must be rejected
+func TestElementToBytes32ValueOf(t *testing.T) {
+	p := elliptic.P256().Params().P
+	for _, x := range []*big.Int{big.NewInt(1), big.NewInt(0xabcdef), new(big.Int).Sub(p, big.NewInt(1))} {
+		canonical, _ := Bytes32(x)
+		if err := checkBytes32[curves.Secp256r1Fp](new(big.Int).Add(p, x), canonical); err != nil {
+			t.Errorf("p+%s: %v", x, err)
+		}
+	}
+
+	zero, _ := Bytes32(big.NewInt(0))
+	raw, _ := Bytes32(p)
+	for _, expected := range [][]byte{zero, raw} {
+		if err := checkBytes32[curves.Secp256r1Fp](p, expected); err == nil {
+			t.Errorf("p: accepted the non-canonical value as %x", expected)
+		}
+	}
+}
+
+// publicKeyCircuit asserts the uncompressed encoding of a P-256 key
+type publicKeyCircuit struct {
+	X, Y  emulated.Element[curves.Secp256r1Fp]
+	Bytes []uints.U8
+}
+
+func (c *publicKeyCircuit) Define(api frontend.API) error {
+	ComparePublicKeys(api, c.X, c.Y, c.Bytes)
+	return nil
+}
+
+// TestComparePublicKeysMarshal compares the in-circuit encoding of random
+// P-256 keys with crypto/elliptic byte for byte
+func TestComparePublicKeysMarshal(t *testing.T) {
+	for i := range 8 {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		marshaled := elliptic.Marshal(elliptic.P256(), key.X, key.Y) //nolint:staticcheck // reference encoding
+		encoded, err := MarshalP256PublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(encoded) != string(marshaled) {
+			t.Fatalf("key %d: MarshalP256PublicKey differs from elliptic.Marshal", i)
+		}
+
+		circuit := &publicKeyCircuit{Bytes: make([]uints.U8, 65)}
+		assignment := &publicKeyCircuit{
+			X:     emulated.ValueOf[curves.Secp256r1Fp](key.X),
+			Y:     emulated.ValueOf[curves.Secp256r1Fp](key.Y),
+			Bytes: uints.NewU8Array(marshaled),
+		}
+		if err := test.IsSolved(circuit, assignment, ecc.BN254.ScalarField()); err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+	}
+}
+
+// TestMarshalSecp256k1PublicKeyVectors checks the secp256k1 encoding of keys
+// with short coordinates against the SEC1 encoding of gnark-crypto
+func TestMarshalSecp256k1PublicKeyVectors(t *testing.T) {
+	key, err := secp256k1ecdsa.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := key.PublicKey.A.X.BigInt(new(big.Int)), key.PublicKey.A.Y.BigInt(new(big.Int))
+	marshaled := MarshalSecp256k1PublicKey(x, y)
+	if len(marshaled) != 65 || marshaled[0] != 0x04 {
+		t.Fatalf("unexpected encoding %x", marshaled)
+	}
+	xb, _ := Bytes32(x)
+	if string(marshaled[1:33]) != string(xb) {
+		t.Fatal("X bytes differ from Bytes32")
+	}
+	// a coordinate with leading zero bytes keeps its position
+	short := MarshalSecp256k1PublicKey(big.NewInt(1), big.NewInt(2))
+	if short[32] != 1 || short[64] != 2 || strings.Trim(string(short[1:32]), "\x00") != "" {
+		t.Fatalf("short coordinates not left padded: %x", short)
+	}
+}
+
+func TestBytes32(t *testing.T) {
+	if _, err := Bytes32(big.NewInt(-1)); err == nil {
+		t.Error("accepted a negative value")
+	}
+	if _, err := Bytes32(new(big.Int).Lsh(big.NewInt(1), 256)); err == nil {
+		t.Error("accepted a 257-bit value")
+	}
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	b, err := Bytes32(max)
+	if err != nil || len(b) != 32 || strings.Trim(string(b), "\xff") != "" {
+		t.Fatalf("2^256-1: %x, %v", b, err)
+	}
+
+	if _, err := MarshalP256PublicKey(&ecdsa.PublicKey{Curve: elliptic.P256(), X: big.NewInt(1), Y: big.NewInt(1)}); err == nil {
+		t.Error("accepted a point not on the curve")
+	}
+}
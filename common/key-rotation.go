@@ -0,0 +1,62 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+// KeyRotationPrefix separates the key rotation statements from the other
+// messages signed by the holder keys (challenges, transcripts), so a
+// challenge signature cannot be presented as a rotation
+const KeyRotationPrefix = "eudi-zk key rotation v1:"
+
+// KeyRotationStatement returns the message a retired holder key signs to
+// rotate to next:
+//
+//	KeyRotationPrefix || 0x04 || X || Y
+//
+// the uncompressed encoding of next (MarshalP256PublicKey)
+func KeyRotationStatement(next *ecdsa.PublicKey) ([]byte, error) {
+	key, err := MarshalP256PublicKey(next)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(KeyRotationPrefix), key...), nil
+}
+
+// SignKeyRotation signs the key rotation statement of next with the retired
+// key, the signature VerifyKeyRotation verifies
+func SignKeyRotation(retired *ecdsa.PrivateKey, next *ecdsa.PublicKey) (r, s *big.Int, err error) {
+	statement, err := KeyRotationStatement(next)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest := sha256.Sum256(statement)
+	r, s, err = ecdsa.Sign(rand.Reader, retired, digest[:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("sign key rotation: %w", err)
+	}
+	return r, s, nil
+}
+
+// VerifyKeyRotation verifies in-circuit that the key from signed the key
+// rotation statement of the key to (KeyRotationStatement), an ES256
+// signature
+func VerifyKeyRotation(
+	api frontend.API,
+	from, to curves.PublicKey,
+	signature curves.Signature,
+) error {
+	statement := StringToU8Array(KeyRotationPrefix)
+	statement = append(statement, uints.NewU8(4))
+	statement = append(statement, EmulatedElementToBytes32(api, to.X)...)
+	statement = append(statement, EmulatedElementToBytes32(api, to.Y)...)
+	return VerifyES256(api, statement, from, signature)
+}
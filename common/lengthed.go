@@ -0,0 +1,90 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// LengthedBytes is a byte value of variable length: the first Length bytes
+// of Data, zero padded to len(Data), the maximal length compiled in the
+// circuit. Its operations read Length, unlike the gadgets on []uints.U8 which
+// read len(Data).
+//
+// The padding is part of the value: an input is asserted with
+// NewLengthedBytes, the values returned by the gadgets (GetStringValueUpTo,
+// VerifyDisclosure) are zero padded already and can be used as they are.
+type LengthedBytes struct {
+	Data   []uints.U8
+	Length frontend.Variable
+}
+
+// NewLengthedBytes asserts the bytes past length are zero and length is at
+// most len(data), and returns the value
+func NewLengthedBytes(api frontend.API, data []uints.U8, length frontend.Variable) LengthedBytes {
+	AssertZeroPadded(api, data, length)
+	return LengthedBytes{Data: data, Length: length}
+}
+
+// AssignLengthedBytes returns the assignment of a value of at most maxLen
+// bytes
+func AssignLengthedBytes(value []byte, maxLen int) (LengthedBytes, error) {
+	if len(value) > maxLen {
+		return LengthedBytes{}, fmt.Errorf("value of %d bytes exceeds %d", len(value), maxLen)
+	}
+	padded := make([]byte, maxLen)
+	copy(padded, value)
+	return LengthedBytes{Data: BytesToU8Array(padded), Length: len(value)}, nil
+}
+
+// Equal returns 1 if the values have the same length and bytes, 0 otherwise.
+// Values of different maximal lengths are compared on their lengths.
+func (b LengthedBytes) Equal(api frontend.API, other LengthedBytes) frontend.Variable {
+	return api.Mul(api.IsZero(api.Sub(b.Length, other.Length)), EqualUpTo(api, b.Data, other.Data, b.Length))
+}
+
+// SubsetOf returns 1 if the value is bytes[position:position+Length], 0
+// otherwise, like CheckSubset
+func (b LengthedBytes) SubsetOf(api frontend.API, bytes []uints.U8, position frontend.Variable) frontend.Variable {
+	return checkSubset(api, bytes, b.Data, b.Length, position)
+}
+
+// SHA256 returns the SHA-256 digest of the value
+func (b LengthedBytes) SHA256(api frontend.API) ([]uints.U8, error) {
+	h, release, err := NewSHA256(api)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	h.Write(b.Data)
+	return h.FixedLengthSum(b.Length), nil
+}
+
+// DecodeHex decodes the hex characters of the case, as DecodeHexCase. Length
+// must be even; the decoded value is Length/2 bytes zero padded to
+// len(Data)/2.
+func (b LengthedBytes) DecodeHex(api frontend.API, c HexCase) (LengthedBytes, error) {
+	if len(b.Data)%2 != 0 {
+		return LengthedBytes{}, fmt.Errorf("hex string must have an even maximal length")
+	}
+
+	// the padding decodes as '0' characters to zero bytes
+	chars := make([]uints.U8, len(b.Data))
+	inValue := frontend.Variable(1)
+	decodedLen := frontend.Variable(0)
+	for i := range chars {
+		inValue = api.Sub(inValue, api.IsZero(api.Sub(b.Length, i)))
+		chars[i] = uints.U8{Val: api.Select(inValue, b.Data[i].Val, '0')}
+		if i%2 == 0 {
+			decodedLen = api.Add(decodedLen, inValue)
+		}
+	}
+	AssertEqual(api, api.Mul(decodedLen, 2), b.Length, "hex: even length")
+
+	decoded, err := DecodeHexCase(api, chars, c)
+	if err != nil {
+		return LengthedBytes{}, err
+	}
+	return LengthedBytes{Data: decoded, Length: decodedLen}, nil
+}
@@ -0,0 +1,143 @@
+package common
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// lengthedCircuit checks the operations of a LengthedBytes input
+type lengthedCircuit struct {
+	Value  LengthedBytes
+	Other  LengthedBytes
+	Equal  frontend.Variable
+	Bytes  []uints.U8
+	Subset frontend.Variable
+	Digest []uints.U8
+}
+
+func (c *lengthedCircuit) Define(api frontend.API) error {
+	value := NewLengthedBytes(api, c.Value.Data, c.Value.Length)
+	other := NewLengthedBytes(api, c.Other.Data, c.Other.Length)
+	AssertEqual(api, value.Equal(api, other), c.Equal, "equal")
+	AssertEqual(api, value.SubsetOf(api, c.Bytes, 2), c.Subset, "subset")
+	digest, err := value.SHA256(api)
+	if err != nil {
+		return err
+	}
+	AssertBytesEqual(api, digest, c.Digest, "digest")
+	return nil
+}
+
+func TestLengthedBytes(t *testing.T) {
+	tests := []struct {
+		value, other  string
+		equal, subset int
+		valid         bool
+	}{
+		{"abc", "abc", 1, 1, true},
+		{"abc", "abcd", 0, 1, true},
+		{"ab", "abc", 0, 1, true},
+		{"", "", 1, 1, true},
+		{"abd", "abc", 0, 0, true},
+		// past the end of the bytes
+		{"abcdef", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		value, err := AssignLengthedBytes([]byte(tt.value), 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := AssignLengthedBytes([]byte(tt.other), 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha256.Sum256([]byte(tt.value))
+		circuit := &lengthedCircuit{
+			Value:  LengthedBytes{Data: make([]uints.U8, 6)},
+			Other:  LengthedBytes{Data: make([]uints.U8, 5)},
+			Bytes:  make([]uints.U8, 7),
+			Digest: make([]uints.U8, 32),
+		}
+		assignment := &lengthedCircuit{
+			Value:  value,
+			Other:  other,
+			Equal:  tt.equal,
+			Bytes:  StringToU8Array("xxabcde"),
+			Subset: tt.subset,
+			Digest: BytesToU8Array(digest[:]),
+		}
+		if err := CheckWitness(circuit, assignment); err != nil {
+			t.Errorf("%q, %q: %v", tt.value, tt.other, err)
+		}
+	}
+
+	// a non-zero byte past the length
+	circuit := &lengthedCircuit{
+		Value:  LengthedBytes{Data: make([]uints.U8, 3)},
+		Other:  LengthedBytes{Data: make([]uints.U8, 3)},
+		Bytes:  make([]uints.U8, 5),
+		Digest: make([]uints.U8, 32),
+	}
+	digest := sha256.Sum256([]byte("ab"))
+	assignment := &lengthedCircuit{
+		Value:  LengthedBytes{Data: StringToU8Array("abc"), Length: 2},
+		Other:  LengthedBytes{Data: StringToU8Array("ab\x00"), Length: 2},
+		Equal:  1,
+		Bytes:  StringToU8Array("xxab\x00"),
+		Subset: 1,
+		Digest: BytesToU8Array(digest[:]),
+	}
+	if err := CheckWitness(circuit, assignment); err == nil {
+		t.Error("expected a padding error")
+	}
+
+	if _, err := AssignLengthedBytes([]byte("abc"), 2); err == nil {
+		t.Error("expected a length error")
+	}
+}
+
+type lengthedHexCircuit struct {
+	Hex   LengthedBytes
+	Bytes LengthedBytes
+}
+
+func (c *lengthedHexCircuit) Define(api frontend.API) error {
+	decoded, err := NewLengthedBytes(api, c.Hex.Data, c.Hex.Length).DecodeHex(api, HexLower)
+	if err != nil {
+		return err
+	}
+	AssertEqual(api, decoded.Length, c.Bytes.Length, "length")
+	AssertBytesEqual(api, decoded.Data, c.Bytes.Data, "bytes")
+	return nil
+}
+
+func TestLengthedBytesDecodeHex(t *testing.T) {
+	tests := []struct {
+		hex, bytes string
+		valid      bool
+	}{
+		{"00ff7a", "\x00\xff\x7a", true},
+		{"ab", "\xab", true},
+		{"", "", true},
+		{"abc", "\xab", false},
+		{"0g", "\x00", false},
+	}
+	for _, tt := range tests {
+		hexValue, err := AssignLengthedBytes([]byte(tt.hex), 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bytes, err := AssignLengthedBytes([]byte(tt.bytes), 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		circuit := &lengthedHexCircuit{Hex: LengthedBytes{Data: make([]uints.U8, 8)}, Bytes: LengthedBytes{Data: make([]uints.U8, 4)}}
+		err = CheckWitness(circuit, &lengthedHexCircuit{Hex: hexValue, Bytes: bytes})
+		if tt.valid != (err == nil) {
+			t.Errorf("%q: expected valid=%v, got %v", tt.hex, tt.valid, err)
+		}
+	}
+}
@@ -5,29 +5,23 @@ import (
 
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/algebra/emulated/sw_emulated"
-	"github.com/consensys/gnark/std/hash/sha2"
+	"github.com/consensys/gnark/std/lookup/logderivlookup"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
-	"github.com/consensys/gnark/std/signature/ecdsa"
+	"github.com/mynextid/eudi-zk/common/curves"
 )
 
-// Secp256r1 field parameters
-type Secp256r1Fp = emulated.P256Fp
-type Secp256r1Fr = emulated.P256Fr
-
+// AssertIsEqualBytes asserts that a and b are equal byte by byte.
+//
+// Deprecated: use AssertBytesEqual, which labels the assertion.
 func AssertIsEqualBytes(api frontend.API, a, b []uints.U8) {
-	lenA := Len(api, a)
-	lenB := Len(api, b)
-
-	api.AssertIsEqual(lenA, lenB)
-
-	for i := range a {
-		api.AssertIsEqual(a[i].Val, b[i].Val)
-	}
-
+	AssertBytesEqual(api, a, b, "bytes")
 }
 
 // IsEqualBytes compares two byte slices and returns 1 if all bytes match, 0 otherwise. If len(a) != len (b), we iterate over length = min(len(a), len(b))
+//
+// Deprecated: a truncated slice compares equal to its prefix. Use EqualExact,
+// EqualPrefix or EqualUpTo, which handle the lengths explicitly.
 func IsEqualBytes(api frontend.API, a, b []uints.U8) frontend.Variable {
 	// Returns 1 if all bytes match, 0 otherwise
 	allMatch := frontend.Variable(1)
@@ -44,6 +38,54 @@ func IsEqualBytes(api frontend.API, a, b []uints.U8) frontend.Variable {
 	return allMatch
 }
 
+// EqualExact returns 1 if a and b have the same length and all bytes match, 0
+// otherwise. Slices of different (compile-time) lengths are never equal.
+func EqualExact(api frontend.API, a, b []uints.U8) frontend.Variable {
+	if len(a) != len(b) {
+		return 0
+	}
+	return equalBytes(api, a, b)
+}
+
+// EqualPrefix returns 1 if data starts with prefix, 0 otherwise. A prefix
+// longer than data never matches.
+func EqualPrefix(api frontend.API, data, prefix []uints.U8) frontend.Variable {
+	if len(prefix) > len(data) {
+		return 0
+	}
+	return equalBytes(api, data[:len(prefix)], prefix)
+}
+
+// EqualUpTo returns 1 if the first length bytes of a and b match, 0 otherwise.
+// length is a variable; a length larger than one of the slices returns 0.
+func EqualUpTo(api frontend.API, a, b []uints.U8, length frontend.Variable) frontend.Variable {
+	n := min(len(a), len(b))
+
+	allMatch := frontend.Variable(1)
+	inRange := frontend.Variable(1) // i < length
+	validLength := frontend.Variable(0)
+	for i := range n {
+		isEnd := api.IsZero(api.Sub(length, i))
+		validLength = api.Add(validLength, isEnd)
+		inRange = api.Mul(inRange, api.Sub(1, isEnd))
+
+		bytesEqual := api.IsZero(api.Sub(a[i].Val, b[i].Val))
+		allMatch = api.Mul(allMatch, api.Select(inRange, bytesEqual, 1))
+	}
+	// length == n
+	validLength = api.Add(validLength, api.IsZero(api.Sub(length, n)))
+
+	return api.Mul(allMatch, validLength)
+}
+
+func equalBytes(api frontend.API, a, b []uints.U8) frontend.Variable {
+	allMatch := frontend.Variable(1)
+	for i := range a {
+		allMatch = api.Mul(allMatch, api.IsZero(api.Sub(a[i].Val, b[i].Val)))
+	}
+	return allMatch
+}
+
 // IsEqualByte compares two bytes returns 1 if the bytes match, 0 otherwise.
 func IsEqualByte(api frontend.API, a, b uints.U8) frontend.Variable {
 	// Returns 1 if all bytes match, 0 otherwise
@@ -57,21 +99,48 @@ func IsEqualByte(api frontend.API, a, b uints.U8) frontend.Variable {
 	return allMatch
 }
 
-// Len computes the array size
+// Len returns the compile-time size of the array, not the length of its
+// value.
+//
+// Deprecated: use LengthedBytes for a length known at proving time.
 func Len(api frontend.API, bytes []uints.U8) frontend.Variable {
-	length := frontend.Variable(0)
-	for range bytes {
-		length = api.Add(length, 1)
-	}
-	return length
+	return len(bytes)
 }
 
+// HexCase selects the hex digits DecodeHexCase accepts, besides '0'-'9'
+type HexCase int
+
+const (
+	// HexLower accepts 'a'-'f'
+	HexLower HexCase = 1 << iota
+	// HexUpper accepts 'A'-'F', some issuers emit uppercase digests
+	HexUpper
+)
+
+// hexInvalid is the nibble of the characters out of the alphabet: any byte
+// combining it is at least 256 and fails the byte range check
+const hexInvalid = 256
+
 // Convert lowercase hex characters to bytes
 func DecodeHex(api frontend.API, hexChars []uints.U8) ([]uints.U8, error) {
+	return DecodeHexCase(api, hexChars, HexLower)
+}
+
+// DecodeHexCase converts hex characters of the case to bytes. The nibbles are
+// read from a lookup table of the 256 byte values, the characters out of the
+// alphabet map to hexInvalid: the range check of the decoded bytes asserts
+// the alphabet.
+func DecodeHexCase(api frontend.API, hexChars []uints.U8, c HexCase) ([]uints.U8, error) {
 	// Ensure even number of hex characters
 	if len(hexChars)%2 != 0 {
 		return nil, fmt.Errorf("hex string must have even length")
 	}
+	if c&(HexLower|HexUpper) == 0 {
+		return nil, fmt.Errorf("hex case accepts no letter")
+	}
+	if len(hexChars) == 0 {
+		return []uints.U8{}, nil
+	}
 
 	// Initialize Bytes API
 	bf, err := uints.NewBytes(api)
@@ -79,14 +148,20 @@ func DecodeHex(api frontend.API, hexChars []uints.U8) ([]uints.U8, error) {
 		return nil, fmt.Errorf("failed to create bytes API: %w", err)
 	}
 
-	bytes := make([]uints.U8, len(hexChars)/2)
+	table := logderivlookup.New(api)
+	for _, nibble := range hexNibbles(c) {
+		table.Insert(nibble)
+	}
+	chars := make([]frontend.Variable, len(hexChars))
+	for i := range hexChars {
+		chars[i] = hexChars[i].Val
+	}
+	nibbles := table.Lookup(chars...)
 
+	bytes := make([]uints.U8, len(hexChars)/2)
 	for i := range bytes {
-		highNibble := hexCharToNibble(api, hexChars[i*2])
-		lowNibble := hexCharToNibble(api, hexChars[i*2+1])
-
 		// Combine nibbles: (high << 4) | low
-		byteVal := api.Add(api.Mul(highNibble, 16), lowNibble)
+		byteVal := api.Add(api.Mul(nibbles[i*2], 16), nibbles[i*2+1])
 
 		// Use ValueOf to create a constrained U8 from the frontend.Variable
 		bytes[i] = bf.ValueOf(byteVal)
@@ -95,29 +170,25 @@ func DecodeHex(api frontend.API, hexChars []uints.U8) ([]uints.U8, error) {
 	return bytes, nil
 }
 
-// Convert a single lowercase hex character ('0'-'9', 'a'-'f') to its nibble value (0-15)
-func hexCharToNibble(api frontend.API, char uints.U8) frontend.Variable {
-	// '0'-'9' (ASCII 48-57) -> 0-9
-	// 'a'-'f' (ASCII 97-102) -> 10-15
-
-	charVal := char.Val
-
-	// Compute both transformations
-	digitValue := api.Sub(charVal, 48)  // For '0'-'9'
-	letterValue := api.Sub(charVal, 87) // For 'a'-'f'
-
-	// check if charVal - 97 is non-negative
-	// Use comparison: charVal >= 97
-	cmpResult := api.Cmp(charVal, 96) // Compare with 96 (one before 'a')
-	// cmpResult = 1 if charVal > 96 (i.e., >= 97), it's a letter
-	// cmpResult = 0 if charVal == 96 (impossible)
-	// cmpResult = -1 if charVal < 96, it's a digit
-
-	isLetter := api.IsZero(api.Sub(cmpResult, 1)) // 1 if cmpResult == 1, else 0
-
-	result := api.Select(isLetter, letterValue, digitValue)
-
-	return result
+// hexNibbles returns the nibble of each byte value, hexInvalid out of the
+// alphabet of the case
+func hexNibbles(c HexCase) []int {
+	nibbles := make([]int, 256)
+	for i := range nibbles {
+		nibbles[i] = hexInvalid
+	}
+	for i := range 10 {
+		nibbles['0'+i] = i
+	}
+	for i := range 6 {
+		if c&HexLower != 0 {
+			nibbles['a'+i] = 10 + i
+		}
+		if c&HexUpper != 0 {
+			nibbles['A'+i] = 10 + i
+		}
+	}
+	return nibbles
 }
 
 // DecodeBase64Url decodes a base64url encoded string to bytes
@@ -304,28 +375,44 @@ func base64UrlCharToValue(api frontend.API, char uints.U8) frontend.Variable {
 }
 
 // VerifyES256 verifies an ES256 signature of the message. The function computes the digest of the input message, make sure you provide the raw payload.
-func VerifyES256(api frontend.API, message []uints.U8, publicKey ecdsa.PublicKey[emulated.P256Fp, emulated.P256Fr], signature ecdsa.Signature[emulated.P256Fr]) {
-	messageHash, _ := SHA256(api, message)
+func VerifyES256(api frontend.API, message []uints.U8, publicKey curves.PublicKey, signature curves.Signature) error {
+	messageHash, err := SHA256(api, message)
+	if err != nil {
+		return err
+	}
+	return VerifyES256Digest(api, messageHash, publicKey, signature)
+}
 
-	mHash, _ := Sha256ToP256Fr(api, messageHash)
+// VerifyES256Digest verifies an ES256 signature of a message whose SHA256 digest is computed already, e.g. over a variable-length message (LengthedBytes.SHA256)
+func VerifyES256Digest(api frontend.API, digest []uints.U8, publicKey curves.PublicKey, signature curves.Signature) error {
+	mHash, err := Sha256ToP256Fr(api, digest)
+	if err != nil {
+		return err
+	}
 
 	// signature verification assertion is done in-circuit
 	publicKey.Verify(api, sw_emulated.GetCurveParams[emulated.P256Fp](), mHash, &signature)
-
+	return nil
 }
 
 // Sha256ToP256Fr converts SHA256 hash output ([]uints.U8) to P256Fr field element
 func Sha256ToP256Fr(api frontend.API, hash []uints.U8) (*emulated.Element[emulated.P256Fr], error) {
+	return sha256ToScalar[emulated.P256Fr](api, hash)
+}
+
+// sha256ToScalar converts a SHA256 hash to an element of the 256-bit scalar
+// field T, reduced
+func sha256ToScalar[T emulated.FieldParams](api frontend.API, hash []uints.U8) (*emulated.Element[T], error) {
 	if len(hash) != 32 {
 		panic("SHA256 hash must be 32 bytes")
 	}
 
-	field, err := emulated.NewField[emulated.P256Fr](api)
+	field, err := emulated.NewField[T](api)
 	if err != nil {
 		return nil, err
 	}
 
-	// P256Fr uses 4 limbs of 64 bits each (standard for 256-bit fields in gnark)
+	// 256-bit fields use 4 limbs of 64 bits each (standard in gnark)
 	// Limbs are stored in little-endian order
 	const nbLimbs = 4
 	const bytesPerLimb = 8
@@ -359,7 +446,7 @@ func Sha256ToP256Fr(api frontend.API, hash []uints.U8) (*emulated.Element[emulat
 	}
 
 	// Create element with properly structured limbs
-	result := &emulated.Element[emulated.P256Fr]{
+	result := &emulated.Element[T]{
 		Limbs: limbs,
 	}
 
@@ -368,7 +455,7 @@ func Sha256ToP256Fr(api frontend.API, hash []uints.U8) (*emulated.Element[emulat
 }
 
 // ComparePublicKeys compares public keys (emulated element) and an uncompressed EC public key (must have the 0x04 prefix)
-func ComparePublicKeys(api frontend.API, PubKeyX, PubKeyY emulated.Element[Secp256r1Fp], PubKeyBytes []uints.U8) {
+func ComparePublicKeys(api frontend.API, PubKeyX, PubKeyY emulated.Element[curves.Secp256r1Fp], PubKeyBytes []uints.U8) {
 
 	// public key to bytes
 	xBytes := EmulatedElementToBytes32(api, PubKeyX)
@@ -381,11 +468,11 @@ func ComparePublicKeys(api frontend.API, PubKeyX, PubKeyY emulated.Element[Secp2
 	pubKeyBytes := append(xBytes, yBytes...)
 	pubKeyBytes = append([]uints.U8{prefix}, pubKeyBytes...)
 
-	AssertIsEqualBytes(api, pubKeyBytes, PubKeyBytes)
+	AssertBytesEqual(api, pubKeyBytes, PubKeyBytes, "public key bytes")
 }
 
 // PublicKeyDigest returns hash of the public keys
-func PublicKeyDigest(api frontend.API, PubKeyX, PubKeyY emulated.Element[Secp256r1Fp]) (PubKeyDigest []uints.U8) {
+func PublicKeyDigest(api frontend.API, PubKeyX, PubKeyY emulated.Element[curves.Secp256r1Fp]) (PubKeyDigest []uints.U8) {
 
 	// public key to bytes
 	xBytes := EmulatedElementToBytes32(api, PubKeyX)
@@ -403,96 +490,58 @@ func PublicKeyDigest(api frontend.API, PubKeyX, PubKeyY emulated.Element[Secp256
 	return
 }
 
-func EmulatedElementToBytes32(api frontend.API, elem emulated.Element[Secp256r1Fp]) []uints.U8 {
-	field, err := emulated.NewField[Secp256r1Fp](api)
-	if err != nil {
-		panic(err)
-	}
-
-	reduced := field.Reduce(&elem)
-	bits := field.ToBits(reduced)
-
-	// ToBits returns LSB-first (little-endian bit order)
-	// We need 256 bits exactly
-	if len(bits) > 256 {
-		bits = bits[:256]
-	}
-
-	// Pad with zeros at the end if needed (these are high-order bits)
-	if len(bits) < 256 {
-		padded := make([]frontend.Variable, 256)
-		copy(padded, bits)
-		for i := len(bits); i < 256; i++ {
-			padded[i] = 0
-		}
-		bits = padded
-	}
-
-	bytes := make([]uints.U8, 32)
-
-	// Convert LSB-first bits to big-endian bytes
-	// Byte 0 (most significant) contains bits [255:248]
-	// Byte 31 (least significant) contains bits [7:0]
-	for byteIdx := range 32 {
-		byteValue := frontend.Variable(0)
-
-		// Build each byte from 8 bits
-		for bitIdx := range 8 {
-			// For big-endian bytes from LSB-first bits:
-			// Byte 0 needs bits 255,254,253,...,248
-			// Byte 31 needs bits 7,6,5,...,0
-			bitPosition := (31-byteIdx)*8 + (7 - bitIdx)
-
-			// Build byte: MSB first
-			byteValue = api.Add(
-				api.Mul(byteValue, 2),
-				bits[bitPosition],
-			)
-		}
-
-		bytes[byteIdx] = uints.U8{Val: byteValue}
-	}
-
-	return bytes
+// CheckSubset returns 1 if subset is bytes[positionStart:positionStart+len(subset)],
+// 0 otherwise (mismatching byte or subset past the end of bytes). Unlike
+// MustSubset it does not assert, so that circuits can combine memberships
+// (claim A or claim B is present).
+func CheckSubset(api frontend.API, bytes, subset []uints.U8, positionStart frontend.Variable) frontend.Variable {
+	return checkSubset(api, bytes, subset, len(subset), positionStart)
 }
 
-// VerifyJWS verifies a JWS signature where protected header and payload are provided separately. This way we can provide the protected header as a private input and the payload as public or private input. The function adds the . separator, hence the protected header must be only base64url encoded, without the .
-func VerifyJWS(api frontend.API, protected []uints.U8, payload []uints.U8, publicKey ecdsa.PublicKey[emulated.P256Fp, emulated.P256Fr], signature ecdsa.Signature[emulated.P256Fr]) {
-	// Initialize SHA256 hash
-	hash, err := sha2.New(api)
-	if err != nil {
-		return
-	}
-
-	// Concatenate header and payload with a '.' separator (ASCII 46 = 0x2E)
-	// format: base64url(header).base64url(payload)
-	dotSeparator := uints.NewU8(46)
+// checkSubset is CheckSubset for the first length bytes of subset
+func checkSubset(api frontend.API, bytes, subset []uints.U8, length, positionStart frontend.Variable) frontend.Variable {
+	matchedCount := frontend.Variable(0)
+	mismatches := frontend.Variable(0)
 
-	// Write header to hasher
-	hash.Write(protected)
+	// For each position in bytes
+	for byteIndex := range bytes {
+		// Check if current position matches positionStart + matchedCount
+		isAtMatchPosition := api.IsZero(api.Sub(byteIndex, api.Add(positionStart, matchedCount)))
 
-	// Write dot separator
-	hash.Write([]uints.U8{dotSeparator})
+		// Only match if at correct position AND haven't finished matching
+		hasMoreToMatch := api.Sub(1, api.IsZero(api.Sub(matchedCount, length)))
+		isAtMatchPosition = api.Mul(isAtMatchPosition, hasMoreToMatch)
 
-	// Write payload to hasher
-	hash.Write(payload)
+		// The subset byte expected at this position (0 outside the match)
+		expected := frontend.Variable(0)
+		for subsetIndex := range subset {
+			isCorrectSubsetIndex := api.IsZero(api.Sub(matchedCount, subsetIndex))
+			expected = api.Add(expected, api.Mul(api.Mul(isAtMatchPosition, isCorrectSubsetIndex), subset[subsetIndex].Val))
+		}
 
-	// Compute SHA256 hash of header.payload
-	messageHash := hash.Sum()
+		// Count the mismatching bytes in the matching range
+		diff := api.Mul(isAtMatchPosition, api.Sub(bytes[byteIndex].Val, expected))
+		mismatches = api.Add(mismatches, api.Sub(1, api.IsZero(diff)))
 
-	// Convert to P256Fr
-	mHash, err := Sha256ToP256Fr(api, messageHash)
-	if err != nil {
-		return
+		// Increment counter when we're in the matching range
+		matchedCount = api.Add(matchedCount, isAtMatchPosition)
 	}
 
-	// Verify the signature
-	publicKey.Verify(api, sw_emulated.GetCurveParams[emulated.P256Fp](), mHash, &signature)
-
+	// All subset bytes matched, without mismatch
+	fullyMatched := api.IsZero(api.Sub(matchedCount, length))
+	return api.Mul(fullyMatched, api.IsZero(mismatches))
 }
 
-// Verifies if the subset is a subset of bytes
+// IsSubset asserts that subset is a subset of bytes.
+//
+// Deprecated: use MustSubset, or CheckSubset for a flag.
 func IsSubset(api frontend.API, bytes, subset []uints.U8, positionStart frontend.Variable) error {
+	return MustSubset(api, bytes, subset, positionStart)
+}
+
+// MustSubset asserts that subset is bytes[positionStart:positionStart+len(subset)];
+// each byte is a labelled assertion, the failing one is reported in debug mode
+func MustSubset(api frontend.API, bytes, subset []uints.U8, positionStart frontend.Variable) error {
 	bytesAPI, err := uints.NewBytes(api)
 	if err != nil {
 		return err
@@ -524,7 +573,7 @@ func IsSubset(api frontend.API, bytes, subset []uints.U8, positionStart frontend
 
 			// Select which byte to compare
 			selectedByte := bytesAPI.Select(shouldCompare, bytes[byteIndex], subset[subsetIndex])
-			bytesAPI.AssertIsEqual(selectedByte, subset[subsetIndex])
+			AssertEqual(api, selectedByte.Val, subset[subsetIndex].Val, "subset byte %d at bytes[%d]", subsetIndex, byteIndex)
 		}
 
 		// Increment counter when we're in the matching range
@@ -532,7 +581,7 @@ func IsSubset(api frontend.API, bytes, subset []uints.U8, positionStart frontend
 	}
 
 	// Ensure all subset bytes were matched
-	api.AssertIsEqual(matchedCount, len(subset))
+	AssertEqual(api, matchedCount, len(subset), "subset fully matched")
 	return nil
 }
 
@@ -577,11 +626,109 @@ func GetSubset(api frontend.API, bytes []uints.U8, start frontend.Variable, leng
 	}
 
 	// Assert we extracted the correct length
-	api.AssertIsEqual(matchedCount, length)
+	AssertEqual(api, matchedCount, length, "subset of length %d extracted", length)
 
 	return result
 }
 
+// ClaimKey returns the bytes preceding the string value of the claim name in
+// compact JSON: "name":"
+func ClaimKey(name string) string {
+	return `"` + name + `":"`
+}
+
+// GetStringValue extracts the JSON string value of length bytes at
+// valuePosition of the decoded JSON and asserts that it is immediately
+// preceded by key (e.g. ClaimKey("birthdate")) and followed by the closing
+// quote. Without the key the position could point to the value of another
+// claim, without the quote to a prefix of a longer value. The JSON must be
+// compact, without whitespace around the colon.
+func GetStringValue(api frontend.API, json []uints.U8, valuePosition frontend.Variable, key string, length int) []uints.U8 {
+	claim := GetSubset(api, json, api.Sub(valuePosition, len(key)), len(key)+length+1)
+	AssertBytesEqual(api, claim[:len(key)], StringToU8Array(key), "json key %s", key)
+	AssertEqual(api, claim[len(key)+length].Val, '"', "json key %s: closing quote", key)
+	return claim[len(key) : len(key)+length]
+}
+
+// GetStringValueUpTo extracts a JSON string value of at most maxLength bytes
+// like GetStringValue: the value at valuePosition must be preceded by key and
+// ends at the first quote. It returns the value zero padded to maxLength bytes
+// and its length. The value must not contain escapes, an escaped quote would
+// end it early, and json must hold maxLength+1 bytes from valuePosition.
+func GetStringValueUpTo(api frontend.API, json []uints.U8, valuePosition frontend.Variable, key string, maxLength int) ([]uints.U8, frontend.Variable) {
+	bytesAPI, err := uints.NewBytes(api)
+	if err != nil {
+		panic(err)
+	}
+
+	claim := GetSubset(api, json, api.Sub(valuePosition, len(key)), len(key)+maxLength+1)
+	AssertBytesEqual(api, claim[:len(key)], StringToU8Array(key), "json key %s", key)
+
+	value := make([]uints.U8, maxLength)
+	length := frontend.Variable(0)
+	ended := frontend.Variable(0)
+	for i, b := range claim[len(key):] {
+		ended = api.Or(ended, api.IsZero(api.Sub(b.Val, '"')))
+		if i == maxLength {
+			break
+		}
+		inValue := api.Sub(1, ended)
+		AssertEqual(api, api.Mul(inValue, api.IsZero(api.Sub(b.Val, '\\'))), 0, "json key %s: escaped value", key)
+		value[i] = bytesAPI.ValueOf(api.Mul(inValue, b.Val))
+		length = api.Add(length, inValue)
+	}
+	AssertEqual(api, ended, 1, "json key %s: closing quote within %d bytes", key, maxLength)
+
+	return value, length
+}
+
+// ClaimNumberKey returns the bytes preceding the number value of the claim
+// name in compact JSON: "name":
+func ClaimNumberKey(name string) string {
+	return `"` + name + `":`
+}
+
+// GetNumberValue parses the non-negative JSON integer of digits (witness,
+// 1 to maxDigits) ASCII digits at valuePosition of the decoded JSON, preceded
+// by key (e.g. ClaimNumberKey("age")). The number must be followed by ',' or
+// '}', so digits cannot cover a prefix of a longer number, and has no leading
+// zero. Fractions and exponents are not supported. json must hold
+// maxDigits+1 bytes from valuePosition.
+func GetNumberValue(api frontend.API, json []uints.U8, valuePosition frontend.Variable, key string, digits frontend.Variable, maxDigits int) frontend.Variable {
+	claim := GetSubset(api, json, api.Sub(valuePosition, len(key)), len(key)+maxDigits+1)
+	AssertBytesEqual(api, claim[:len(key)], StringToU8Array(key), "json key %s", key)
+
+	AssertDifferent(api, digits, 0, "json key %s: no digits", key)
+	api.AssertIsLessOrEqual(digits, maxDigits)
+
+	number := claim[len(key):]
+	value := frontend.Variable(0)
+	inNumber := frontend.Variable(1)
+	for i, b := range number {
+		atEnd := api.IsZero(api.Sub(digits, i))
+		inNumber = api.Sub(inNumber, atEnd)
+
+		// the byte after the last digit ends the number
+		AssertEqual(api, api.Mul(atEnd, api.Sub(b.Val, ','), api.Sub(b.Val, '}')), 0, "json key %s: number ends with , or }", key)
+		if i == maxDigits {
+			break
+		}
+
+		// a digit in the number: 0 <= b - '0' <= 9
+		digit := api.Mul(inNumber, api.Sub(b.Val, '0'))
+		api.AssertIsLessOrEqual(digit, 9)
+		value = api.Add(api.Mul(value, api.Add(1, api.Mul(inNumber, 9))), digit)
+	}
+
+	// a leading zero only for 0
+	AssertEqual(api, api.Mul(api.IsZero(api.Sub(number[0].Val, '0')), api.Sub(digits, 1)), 0, "json key %s: leading zero", key)
+
+	return value
+}
+
+// B64Align extends [start, end) to 3-byte group boundaries. The end is not
+// clamped to the length of the JSON; use AlignClaim when the claim can be at
+// the end of the payload.
 func B64Align(start, end int) (startNew, endNew int) {
 
 	r := (start * 8) % 6
@@ -607,9 +754,18 @@ func B64Align(start, end int) (startNew, endNew int) {
 	return
 }
 
+// CnfKidKey precedes the hex encoded public key digest in the cnf claim; the
+// kid must be the first member of cnf
+const CnfKidKey = `"cnf":{"kid":"`
+
+// VerifyCnf checks that the cnf claim of the base64url encoded protected
+// header binds the public key digest (the kid of the cnf claim, see CnfKidKey)
 func VerifyCnf(api frontend.API, HeaderB64, CnfB64 []uints.U8, CnfB64Position, PubKeyHexPosition frontend.Variable, PublicKeyDigest []uints.U8) error {
 	// Verify whether cnfB64 is a subset of headerB64
-	err := IsSubset(api, HeaderB64, CnfB64, CnfB64Position)
+	Assert(api, CheckSubset(api, HeaderB64, CnfB64, CnfB64Position), "cnf is a subset of the header")
+
+	// cnfB64 must decode to the same bytes as the header it is taken from
+	err := AssertB64Aligned(api, len(HeaderB64), len(CnfB64), CnfB64Position)
 	if err != nil {
 		return err
 	}
@@ -620,9 +776,9 @@ func VerifyCnf(api frontend.API, HeaderB64, CnfB64 []uints.U8, CnfB64Position, P
 		return err
 	}
 
-	// Extract the hex encoded public key
+	// Extract the hex encoded public key, bound to the kid of the cnf claim
 	pubKeyHexLength := 64 // size of the hex encoded SHA256 digest
-	publicKeyHex := GetSubset(api, cnf, PubKeyHexPosition, pubKeyHexLength)
+	publicKeyHex := GetStringValue(api, cnf, PubKeyHexPosition, CnfKidKey, pubKeyHexLength)
 
 	// Decode the hex encoded public key
 	publicKeyDigest, err := DecodeHex(api, publicKeyHex)
@@ -631,8 +787,69 @@ func VerifyCnf(api frontend.API, HeaderB64, CnfB64 []uints.U8, CnfB64Position, P
 	}
 
 	// compare the bytes
-	AssertIsEqualBytes(api, publicKeyDigest, PublicKeyDigest)
+	AssertBytesEqual(api, publicKeyDigest, PublicKeyDigest, "cnf public key digest")
 
 	return nil
 
 }
+
+// CnfJWKPrefix precedes the base64url x coordinate of a P-256 cnf.jwk claim,
+// the members in lexicographic order as in RFC 7638 thumbprints (and as Go
+// marshals maps): "cnf":{"jwk":{"crv":"P-256","kty":"EC","x":"...","y":"..."}
+const CnfJWKPrefix = `"cnf":{"jwk":{"crv":"P-256","kty":"EC","x":"`
+
+// cnfJWKSeparator separates the x and y coordinates of a cnf.jwk claim,
+// cnfJWKSuffix closes the jwk
+const (
+	cnfJWKSeparator = `","y":"`
+	cnfJWKSuffix    = `"}`
+	cnfJWKCoordLen  = 43 // base64url of a 32-byte coordinate, without padding
+)
+
+// CnfJWKLen is the length of a cnf.jwk claim, from CnfJWKPrefix to the end of
+// the jwk
+const CnfJWKLen = len(CnfJWKPrefix) + cnfJWKCoordLen + len(cnfJWKSeparator) + cnfJWKCoordLen + len(cnfJWKSuffix)
+
+// CnfJWKSegmentLen is the length of the base64url segment holding a cnf.jwk
+// claim at any alignment
+const CnfJWKSegmentLen = 4 * ((CnfJWKLen + 2 + 2) / 3)
+
+// VerifyCnfJWK checks that the cnf.jwk claim of the base64url encoded JSON
+// binds the P-256 public key (X, Y). JWKB64 is the segment of CnfJWKSegmentLen
+// bytes at JWKB64Position, CnfPosition the position of CnfJWKPrefix within the
+// decoded segment (see FindCnfJWK).
+func VerifyCnfJWK(api frontend.API, JSONB64, JWKB64 []uints.U8, JWKB64Position, CnfPosition frontend.Variable, PubKeyX, PubKeyY emulated.Element[curves.Secp256r1Fp]) error {
+	if len(JWKB64) != CnfJWKSegmentLen {
+		return fmt.Errorf("cnf jwk: segment must be %d bytes, got %d", CnfJWKSegmentLen, len(JWKB64))
+	}
+	if err := MustSubset(api, JSONB64, JWKB64, JWKB64Position); err != nil {
+		return err
+	}
+	if err := AssertB64Aligned(api, len(JSONB64), len(JWKB64), JWKB64Position); err != nil {
+		return err
+	}
+	segment, err := DecodeBase64Url(api, JWKB64)
+	if err != nil {
+		return err
+	}
+
+	jwk := GetSubset(api, segment, CnfPosition, CnfJWKLen)
+	xStart := len(CnfJWKPrefix)
+	yStart := xStart + cnfJWKCoordLen + len(cnfJWKSeparator)
+	AssertBytesEqual(api, jwk[:xStart], StringToU8Array(CnfJWKPrefix), "cnf jwk prefix")
+	AssertBytesEqual(api, jwk[xStart+cnfJWKCoordLen:yStart], StringToU8Array(cnfJWKSeparator), "cnf jwk separator")
+	AssertBytesEqual(api, jwk[yStart+cnfJWKCoordLen:], StringToU8Array(cnfJWKSuffix), "cnf jwk suffix")
+
+	x, err := DecodeBase64Url(api, jwk[xStart:xStart+cnfJWKCoordLen])
+	if err != nil {
+		return err
+	}
+	y, err := DecodeBase64Url(api, jwk[yStart:yStart+cnfJWKCoordLen])
+	if err != nil {
+		return err
+	}
+	AssertBytesEqual(api, x, EmulatedElementToBytes32(api, PubKeyX), "cnf jwk x")
+	AssertBytesEqual(api, y, EmulatedElementToBytes32(api, PubKeyY), "cnf jwk y")
+
+	return nil
+}
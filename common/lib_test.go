@@ -0,0 +1,329 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// equalCircuit asserts the result of an equality gadget
+type equalCircuit struct {
+	A        []uints.U8
+	B        []uints.U8
+	Length   frontend.Variable
+	Expected frontend.Variable
+
+	Gadget string `gnark:"-"`
+}
+
+func (c *equalCircuit) Define(api frontend.API) error {
+	var result frontend.Variable
+	switch c.Gadget {
+	case "EqualExact":
+		result = EqualExact(api, c.A, c.B)
+	case "EqualPrefix":
+		result = EqualPrefix(api, c.A, c.B)
+	case "EqualUpTo":
+		result = EqualUpTo(api, c.A, c.B, c.Length)
+	case "IsEqualBytes":
+		result = IsEqualBytes(api, c.A, c.B)
+	}
+	AssertEqual(api, result, c.Expected, "%s", c.Gadget)
+	return nil
+}
+
+func checkEqual(t *testing.T, gadget, a, b string, length int, expected int) {
+	t.Helper()
+	circuit := &equalCircuit{A: make([]uints.U8, len(a)), B: make([]uints.U8, len(b)), Gadget: gadget}
+	assignment := &equalCircuit{A: StringToU8Array(a), B: StringToU8Array(b), Length: length, Expected: expected}
+	if err := CheckWitness(circuit, assignment); err != nil {
+		t.Errorf("%s(%q, %q, %d): expected %d: %v", gadget, a, b, length, expected, err)
+	}
+}
+
+func TestEqualExact(t *testing.T) {
+	checkEqual(t, "EqualExact", "abcd", "abcd", 0, 1)
+	checkEqual(t, "EqualExact", "abcd", "abce", 0, 0)
+	checkEqual(t, "EqualExact", "", "", 0, 1)
+	// truncation: IsEqualBytes accepts these
+	checkEqual(t, "EqualExact", "abcd", "ab", 0, 0)
+	checkEqual(t, "EqualExact", "ab", "abcd", 0, 0)
+	checkEqual(t, "EqualExact", "abcd", "", 0, 0)
+	checkEqual(t, "IsEqualBytes", "abcd", "ab", 0, 1)
+}
+
+func TestEqualPrefix(t *testing.T) {
+	checkEqual(t, "EqualPrefix", "abcd", "ab", 0, 1)
+	checkEqual(t, "EqualPrefix", "abcd", "abcd", 0, 1)
+	checkEqual(t, "EqualPrefix", "abcd", "", 0, 1)
+	checkEqual(t, "EqualPrefix", "abcd", "ac", 0, 0)
+	// a prefix longer than the data
+	checkEqual(t, "EqualPrefix", "ab", "abcd", 0, 0)
+}
+
+func TestEqualUpTo(t *testing.T) {
+	checkEqual(t, "EqualUpTo", "abcd", "abxy", 2, 1)
+	checkEqual(t, "EqualUpTo", "abcd", "abxy", 3, 0)
+	checkEqual(t, "EqualUpTo", "abcd", "xbcd", 0, 1)
+	checkEqual(t, "EqualUpTo", "abcd", "abcd", 4, 1)
+	checkEqual(t, "EqualUpTo", "abcd", "abc", 3, 1)
+	// length beyond one of the slices
+	checkEqual(t, "EqualUpTo", "abcd", "abc", 4, 0)
+	checkEqual(t, "EqualUpTo", "abcd", "abcd", 5, 0)
+	checkEqual(t, "EqualUpTo", "abcd", "abcd", -1, 0)
+}
+
+// subsetCircuit checks that A or B is a subset of Bytes
+type subsetCircuit struct {
+	Bytes     []uints.U8
+	A         []uints.U8
+	APosition frontend.Variable
+	B         []uints.U8
+	BPosition frontend.Variable
+	Expected  frontend.Variable
+}
+
+func (c *subsetCircuit) Define(api frontend.API) error {
+	hasA := CheckSubset(api, c.Bytes, c.A, c.APosition)
+	hasB := CheckSubset(api, c.Bytes, c.B, c.BPosition)
+	AssertEqual(api, api.Or(hasA, hasB), c.Expected, "A or B")
+	return nil
+}
+
+func TestCheckSubset(t *testing.T) {
+	bytes := `{"age_over_18":true,"nationality":"SI"}`
+	for _, tc := range []struct {
+		a, b       string
+		aPos, bPos int
+		expected   int
+	}{
+		{`"age_over_18":true`, `"nationality":"SI"`, 1, 20, 1},
+		// one claim is enough
+		{`"age_over_18":true`, `"nationality":"AT"`, 1, 20, 1},
+		{`"age_over_18":false`, `"nationality":"SI"`, 1, 20, 1},
+		// none
+		{`"age_over_18":false`, `"nationality":"AT"`, 1, 20, 0},
+		// right bytes, wrong positions
+		{`"age_over_18":true`, `"nationality":"SI"`, 2, 19, 0},
+		// past the end of the bytes
+		{`"age_over_18":false`, `"SI"}}`, 1, 34, 0},
+		{`"age_over_18":false`, `"SI"}`, 1, 34, 1},
+	} {
+		circuit := &subsetCircuit{Bytes: make([]uints.U8, len(bytes)), A: make([]uints.U8, len(tc.a)), B: make([]uints.U8, len(tc.b))}
+		assignment := &subsetCircuit{
+			Bytes: StringToU8Array(bytes),
+			A:     StringToU8Array(tc.a), APosition: tc.aPos,
+			B: StringToU8Array(tc.b), BPosition: tc.bPos,
+			Expected: tc.expected,
+		}
+		if err := CheckWitness(circuit, assignment); err != nil {
+			t.Errorf("%q@%d or %q@%d: expected %d: %v", tc.a, tc.aPos, tc.b, tc.bPos, tc.expected, err)
+		}
+	}
+}
+
+// stringValueCircuit extracts the value of a claim with GetStringValue
+type stringValueCircuit struct {
+	JSON     []uints.U8
+	Position frontend.Variable
+	Value    []uints.U8
+
+	Key string `gnark:"-"`
+}
+
+func (c *stringValueCircuit) Define(api frontend.API) error {
+	value := GetStringValue(api, c.JSON, c.Position, ClaimKey(c.Key), len(c.Value))
+	AssertBytesEqual(api, value, c.Value, "value")
+	return nil
+}
+
+func TestGetStringValue(t *testing.T) {
+	json := `{"birthdate":"2010-01-01","issued":"1990-01-01","birthdates":"1980-01-01X"}`
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"2010-01-01", true},
+		// the value of another claim
+		{"1990-01-01", false},
+		// a prefix of a longer value
+		{"1980-01-01", false},
+	}
+	for _, tt := range tests {
+		circuit := &stringValueCircuit{JSON: make([]uints.U8, len(json)), Value: make([]uints.U8, len(tt.value)), Key: "birthdate"}
+		assignment := &stringValueCircuit{
+			JSON:     StringToU8Array(json),
+			Position: strings.Index(json, tt.value),
+			Value:    StringToU8Array(tt.value),
+		}
+		err := CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v, got %v", tt.value, tt.valid, err)
+		}
+	}
+}
+
+// stringValueUpToCircuit extracts the value of a claim with GetStringValueUpTo
+type stringValueUpToCircuit struct {
+	JSON     []uints.U8
+	Position frontend.Variable
+	Value    []uints.U8 // zero padded
+	Length   frontend.Variable
+
+	Key string `gnark:"-"`
+}
+
+func (c *stringValueUpToCircuit) Define(api frontend.API) error {
+	value, length := GetStringValueUpTo(api, c.JSON, c.Position, ClaimKey(c.Key), len(c.Value))
+	AssertBytesEqual(api, value, c.Value, "value")
+	AssertEqual(api, length, c.Length, "length")
+	return nil
+}
+
+func TestGetStringValueUpTo(t *testing.T) {
+	const maxLength = 12
+	tests := []struct {
+		json   string
+		value  string
+		length int
+		valid  bool
+	}{
+		{`{"iban":"SI56123","x":"y"}`, "SI56123", 7, true},
+		{`{"iban":"","name":"Erika"}`, "", 0, true},
+		// a prefix of the value
+		{`{"iban":"SI56123","x":"y"}`, "SI56", 4, false},
+		// longer than maxLength
+		{`{"iban":"SI561234567890123","x":"y"}`, "SI5612345678", 12, false},
+		// escaped value
+		{`{"iban":"SI\"56","x":"y"}`, "SI", 2, false},
+	}
+	for _, tt := range tests {
+		circuit := &stringValueUpToCircuit{JSON: make([]uints.U8, len(tt.json)), Value: make([]uints.U8, maxLength), Key: "iban"}
+		padded := make([]byte, maxLength)
+		copy(padded, tt.value)
+		assignment := &stringValueUpToCircuit{
+			JSON:     StringToU8Array(tt.json),
+			Position: len(`{"iban":"`),
+			Value:    BytesToU8Array(padded),
+			Length:   tt.length,
+		}
+		err := CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v, got %v", tt.json, tt.valid, err)
+		}
+	}
+}
+
+// numberValueCircuit parses the number of a claim with GetNumberValue
+type numberValueCircuit struct {
+	JSON     []uints.U8
+	Position frontend.Variable
+	Digits   frontend.Variable
+	Value    frontend.Variable
+
+	Key       string `gnark:"-"`
+	MaxDigits int    `gnark:"-"`
+}
+
+func (c *numberValueCircuit) Define(api frontend.API) error {
+	value := GetNumberValue(api, c.JSON, c.Position, ClaimNumberKey(c.Key), c.Digits, c.MaxDigits)
+	AssertEqual(api, value, c.Value, "value")
+	return nil
+}
+
+func TestGetNumberValue(t *testing.T) {
+	tests := []struct {
+		json          string
+		digits, value int
+		valid         bool
+	}{
+		{`{"age":42,"sex":2}`, 2, 42, true},
+		{`{"age":7,"name":"Erika"}`, 1, 7, true},
+		{`{"age":0,"name":"Erika"}`, 1, 0, true},
+		{`{"x":1,"age":123}         `, 3, 123, true},
+		// a prefix of the number
+		{`{"age":123,"sex":2}`, 2, 12, false},
+		// more digits than the number
+		{`{"age":4,"sex":2}`, 3, 42, false},
+		// longer than maxDigits
+		{`{"age":1234,"sex":2}`, 4, 1234, false},
+		{`{"age":"42","sex":2}`, 2, 42, false},
+		{`{"age":042,"sex":2}`, 3, 42, false},
+		{`{"age":-4,"sex":2}`, 2, 4, false},
+		{`{"age":4.5,"sex":2}`, 1, 4, false},
+		{`{"age":42,"sex":2}`, 0, 0, false},
+	}
+	for _, tt := range tests {
+		circuit := &numberValueCircuit{JSON: make([]uints.U8, len(tt.json)), Key: "age", MaxDigits: 3}
+		position := strings.Index(tt.json, `"age":`) + len(`"age":`)
+		assignment := &numberValueCircuit{
+			JSON:     StringToU8Array(tt.json),
+			Position: position,
+			Digits:   tt.digits,
+			Value:    tt.value,
+		}
+		err := CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%s (%d digits): expected valid=%v, got %v", tt.json, tt.digits, tt.valid, err)
+		}
+	}
+}
+
+type hexCircuit struct {
+	Hex   []uints.U8
+	Bytes []uints.U8
+
+	Case HexCase `gnark:"-"`
+}
+
+func (c *hexCircuit) Define(api frontend.API) error {
+	bytes, err := DecodeHexCase(api, c.Hex, c.Case)
+	if err != nil {
+		return err
+	}
+	for i := range bytes {
+		api.AssertIsEqual(bytes[i].Val, c.Bytes[i].Val)
+	}
+	return nil
+}
+
+func TestDecodeHexCase(t *testing.T) {
+	tests := []struct {
+		hex   string
+		bytes string
+		c     HexCase
+		valid bool
+	}{
+		{"00ff7a9e", "\x00\xff\x7a\x9e", HexLower, true},
+		{"0123456789abcdef", "\x01\x23\x45\x67\x89\xab\xcd\xef", HexLower, true},
+		{"0123456789ABCDEF", "\x01\x23\x45\x67\x89\xab\xcd\xef", HexUpper, true},
+		{"aBcD", "\xab\xcd", HexLower | HexUpper, true},
+		{"ABCD", "\xab\xcd", HexLower, false},
+		{"abcd", "\xab\xcd", HexUpper, false},
+		// the neighbours of the alphabet
+		{"0g", "\x00", HexLower | HexUpper, false},
+		{"0G", "\x00", HexLower | HexUpper, false},
+		{"0:", "\x0a", HexLower | HexUpper, false},
+		{"0`", "\x09", HexLower | HexUpper, false},
+		{"0@", "\x09", HexLower | HexUpper, false},
+		{"/0", "\x00", HexLower | HexUpper, false},
+	}
+	for _, tt := range tests {
+		circuit := &hexCircuit{Hex: make([]uints.U8, len(tt.hex)), Bytes: make([]uints.U8, len(tt.bytes)), Case: tt.c}
+		assignment := &hexCircuit{Hex: StringToU8Array(tt.hex), Bytes: StringToU8Array(tt.bytes)}
+		err := CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%q (case %d): expected valid=%v, got %v", tt.hex, tt.c, tt.valid, err)
+		}
+	}
+
+	var api frontend.API
+	if _, err := DecodeHexCase(api, make([]uints.U8, 3), HexLower); err == nil {
+		t.Error("expected an odd length error")
+	}
+	if _, err := DecodeHexCase(api, make([]uints.U8, 2), 0); err == nil {
+		t.Error("expected a case error")
+	}
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Mode restricts what the process does with the circuit artifacts. A
+// production server runs in ModeVerifyOnly or ModeProveOnly: it never runs
+// the groth16 setup with local randomness, a missing artifact is an error
+// instead of a freshly compiled circuit with new keys.
+type Mode string
+
+const (
+	// ModeFull compiles and sets up the circuits whose artifacts are missing,
+	// the default for development and the tests
+	ModeFull Mode = "full"
+	// ModeVerifyOnly loads the verifying keys only: no setup, and the proving
+	// keys are refused (ErrProvingDisabled)
+	ModeVerifyOnly Mode = "verify-only"
+	// ModeProveOnly loads the published artifacts, proving keys included, and
+	// never sets up
+	ModeProveOnly Mode = "prove-only"
+)
+
+// ModeEnv is the environment variable setting the mode of a process that
+// does not call SetMode, e.g. ZK_MODE=verify-only
+const ModeEnv = "ZK_MODE"
+
+// ErrSetupDisabled is returned instead of compiling and setting up a circuit
+// outside of ModeFull
+var ErrSetupDisabled = errors.New("circuit setup disabled")
+
+// ErrProvingDisabled is returned for the proving keys in ModeVerifyOnly
+var ErrProvingDisabled = errors.New("proving keys disabled")
+
+// ParseMode parses a mode, ModeFull when s is empty
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return ModeFull, nil
+	case ModeFull, ModeVerifyOnly, ModeProveOnly:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown mode %q, expected %s, %s or %s", s, ModeFull, ModeVerifyOnly, ModeProveOnly)
+}
+
+var mode atomic.Pointer[Mode]
+
+// SetMode sets the mode of the process, overriding ZK_MODE
+func SetMode(m Mode) error {
+	if _, err := ParseMode(string(m)); err != nil {
+		return err
+	}
+	mode.Store(&m)
+	return nil
+}
+
+// CurrentMode returns the mode set by SetMode, else the mode of ZK_MODE. An
+// invalid ZK_MODE is ModeVerifyOnly, the most restricted mode: a typo must
+// not enable the setup on a production server.
+func CurrentMode() Mode {
+	if m := mode.Load(); m != nil {
+		return *m
+	}
+	m, err := ParseMode(os.Getenv(ModeEnv))
+	if err != nil {
+		return ModeVerifyOnly
+	}
+	return m
+}
+
+// checkSetup returns ErrSetupDisabled outside of ModeFull
+func checkSetup() error {
+	if m := CurrentMode(); m != ModeFull {
+		return fmt.Errorf("%w in %s mode", ErrSetupDisabled, m)
+	}
+	return nil
+}
+
+// checkProving returns ErrProvingDisabled in ModeVerifyOnly
+func checkProving() error {
+	if m := CurrentMode(); m == ModeVerifyOnly {
+		return fmt.Errorf("%w in %s mode", ErrProvingDisabled, m)
+	}
+	return nil
+}
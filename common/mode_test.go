@@ -0,0 +1,71 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestMode(t *testing.T) {
+	t.Cleanup(func() { mode.Store(nil) })
+	t.Chdir(t.TempDir())
+	paths := CircuitPaths{CCS: "compiled/circuit.ccs", ProvingKey: "compiled/proving.key", VerifyingKey: "compiled/verifying.key"}
+	ctx := context.Background()
+
+	// ZK_MODE applies until SetMode, an invalid value is the most restricted
+	t.Setenv(ModeEnv, "")
+	if m := CurrentMode(); m != ModeFull {
+		t.Fatalf("default mode %s", m)
+	}
+	t.Setenv(ModeEnv, "prove-only")
+	if m := CurrentMode(); m != ModeProveOnly {
+		t.Fatalf("mode %s from %s", m, ModeEnv)
+	}
+	t.Setenv(ModeEnv, "production")
+	if m := CurrentMode(); m != ModeVerifyOnly {
+		t.Fatalf("mode %s for an invalid %s", m, ModeEnv)
+	}
+	if err := SetMode("production"); err == nil {
+		t.Fatal("expected an invalid mode to be refused")
+	}
+
+	// missing artifacts are an error instead of a setup
+	if err := SetMode(ModeProveOnly); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := InitCircuitContext(ctx, paths, false, &powerCircuit{N: 4}, KeyEncodingRaw, nil); !errors.Is(err, ErrSetupDisabled) {
+		t.Fatalf("expected ErrSetupDisabled, got %v", err)
+	}
+	if _, err := os.Stat(paths.VerifyingKey); !os.IsNotExist(err) {
+		t.Fatalf("expected no artifacts, got %v", err)
+	}
+	if _, err := CompileStats("power", &powerCircuit{N: 4}, true); !errors.Is(err, ErrSetupDisabled) {
+		t.Fatalf("expected ErrSetupDisabled, got %v", err)
+	}
+
+	// the artifacts set up in full mode are loaded, forceCompile is refused
+	if err := SetMode(ModeFull); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := InitCircuitContext(ctx, paths, false, &powerCircuit{N: 4}, KeyEncodingRaw, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMode(ModeProveOnly); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := InitCircuitContext(ctx, paths, false, &powerCircuit{N: 4}, KeyEncodingRaw, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := InitCircuitContext(ctx, paths, true, &powerCircuit{N: 4}, KeyEncodingRaw, nil); !errors.Is(err, ErrSetupDisabled) {
+		t.Fatalf("expected ErrSetupDisabled, got %v", err)
+	}
+
+	// verify-only loads no proving key
+	if err := SetMode(ModeVerifyOnly); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := InitCircuitContext(ctx, paths, false, &powerCircuit{N: 4}, KeyEncodingRaw, nil); !errors.Is(err, ErrProvingDisabled) {
+		t.Fatalf("expected ErrProvingDisabled, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// Pairwise holder identifiers: a circuit presenting the holder under a
+// pseudonym per verifier exposes a public field named PairwiseIDField of type
+// []frontend.Variable (one element), next to the public verifier identifier
+// TranscriptVerifierIDField it is derived for:
+//
+//	pid = SHA-256(secret || verifierID)[:31], big-endian
+//
+// secret is a random secret of the holder (models.HolderSecret), verifierID
+// the zero padded client_id of the verifier. The holder presents the same
+// pid to a verifier in every presentation, and unrelated ones to two
+// verifiers, which cannot link them without the secret.
+//
+// The secret is bound to the credential: the issuer signs a salted commitment
+// to it in the protected header (HolderCommitmentKey),
+//
+//	"hsc":"<hex SHA-256(salt || secret)>"
+//
+// and the circuit proves the opening (VerifyHolderCommitment), so a holder
+// cannot present a credential under the identifiers of another secret.
+
+// PairwiseIDField is the name of the circuit field holding the pairwise
+// identifier
+const PairwiseIDField = "PairwiseID"
+
+// HolderSecretSize is the size of the holder secret
+const HolderSecretSize = 32
+
+// HolderSaltSize is the size of the salt of the holder secret commitment
+const HolderSaltSize = 16
+
+// HolderCommitmentKey precedes the hex encoded commitment to the holder secret
+// in the protected header
+const HolderCommitmentKey = `"hsc":"`
+
+// PairwiseID returns the pairwise identifier of the holder for the verifier
+func PairwiseID(api frontend.API, secret, verifierID []uints.U8) (frontend.Variable, error) {
+	if len(secret) != HolderSecretSize {
+		return nil, fmt.Errorf("holder secret of %d bytes, expected %d", len(secret), HolderSecretSize)
+	}
+	if len(verifierID) == 0 {
+		return nil, fmt.Errorf("pairwise identifier needs a verifier id")
+	}
+	preimage := make([]uints.U8, 0, len(secret)+len(verifierID))
+	preimage = append(preimage, secret...)
+	preimage = append(preimage, verifierID...)
+
+	digest, err := SHA256(api, preimage)
+	if err != nil {
+		return nil, err
+	}
+	return packBytes(api, digest[:AttributeDigestSize]), nil
+}
+
+// VerifyHolderCommitment checks that the hsc claim of the base64url encoded
+// protected header commits to the holder secret: CommitmentB64 is the segment
+// of the header at CommitmentB64Position holding the claim, HexPosition the
+// position of the hex encoded commitment within the decoded segment.
+func VerifyHolderCommitment(api frontend.API, HeaderB64, CommitmentB64 []uints.U8, CommitmentB64Position, HexPosition frontend.Variable, salt, secret []uints.U8) error {
+	if len(salt) != HolderSaltSize {
+		return fmt.Errorf("holder salt of %d bytes, expected %d", len(salt), HolderSaltSize)
+	}
+	if len(secret) != HolderSecretSize {
+		return fmt.Errorf("holder secret of %d bytes, expected %d", len(secret), HolderSecretSize)
+	}
+	if err := MustSubset(api, HeaderB64, CommitmentB64, CommitmentB64Position); err != nil {
+		return err
+	}
+	if err := AssertB64Aligned(api, len(HeaderB64), len(CommitmentB64), CommitmentB64Position); err != nil {
+		return err
+	}
+	segment, err := DecodeBase64Url(api, CommitmentB64)
+	if err != nil {
+		return err
+	}
+	commitmentHexLength := 64 // size of the hex encoded SHA256 digest
+	commitment, err := DecodeHex(api, GetStringValue(api, segment, HexPosition, HolderCommitmentKey, commitmentHexLength))
+	if err != nil {
+		return err
+	}
+
+	preimage := make([]uints.U8, 0, len(salt)+len(secret))
+	preimage = append(preimage, salt...)
+	preimage = append(preimage, secret...)
+	digest, err := SHA256(api, preimage)
+	if err != nil {
+		return err
+	}
+	AssertBytesEqual(api, commitment, digest, "holder secret commitment")
+	return nil
+}
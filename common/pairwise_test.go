@@ -0,0 +1,170 @@
+package common_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+type pairwiseIDCircuit struct {
+	HolderSecret         []uints.U8          `gnark:",secret"`
+	TranscriptVerifierID []uints.U8          `gnark:",public"`
+	PairwiseID           []frontend.Variable `gnark:",public"`
+}
+
+func (c *pairwiseIDCircuit) Define(api frontend.API) error {
+	pid, err := common.PairwiseID(api, c.HolderSecret, c.TranscriptVerifierID)
+	if err != nil {
+		return err
+	}
+	common.AssertEqual(api, c.PairwiseID[0], pid, "pairwise identifier")
+	return nil
+}
+
+// TestPairwiseID checks the in-circuit identifier matches
+// models.HolderSecret.PairwiseID: stable for a verifier, distinct across
+// verifiers and holders
+func TestPairwiseID(t *testing.T) {
+	const size = 48
+	secret, err := models.NewHolderSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	circuitTemplate := &pairwiseIDCircuit{
+		HolderSecret:         make([]uints.U8, common.HolderSecretSize),
+		TranscriptVerifierID: make([]uints.U8, size),
+		PairwiseID:           make([]frontend.Variable, 1),
+	}
+	assignment := func(secret models.HolderSecret, verifierID string, pid []byte) *pairwiseIDCircuit {
+		t.Helper()
+		padded := make([]byte, size)
+		copy(padded, verifierID)
+		return &pairwiseIDCircuit{
+			HolderSecret:         common.BytesToU8Array(secret[:]),
+			TranscriptVerifierID: common.BytesToU8Array(padded),
+			PairwiseID:           []frontend.Variable{new(big.Int).SetBytes(pid)},
+		}
+	}
+	pid := func(secret models.HolderSecret, verifierID string) []byte {
+		t.Helper()
+		id, err := secret.PairwiseID(verifierID, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	const verifier, other = "x509_san_dns:verifier.example", "x509_san_dns:other.example"
+	if err := common.CheckWitness(circuitTemplate, assignment(secret, verifier, pid(secret, verifier))); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+	if string(pid(secret, verifier)) == string(pid(secret, other)) {
+		t.Fatal("same pairwise identifier for two verifiers")
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment(secret, other, pid(secret, verifier))); err == nil {
+		t.Fatal("expected the witness check to fail for the identifier of another verifier")
+	}
+	otherSecret, err := models.NewHolderSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment(otherSecret, verifier, pid(secret, verifier))); err == nil {
+		t.Fatal("expected the witness check to fail for the identifier of another holder")
+	}
+
+	// derived secrets restore the identifiers
+	masterKey := make([]byte, 32)
+	derived, err := models.DeriveHolderSecret(masterKey, "wallet-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := derived.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored models.HolderSecret
+	if err := restored.UnmarshalText(text); err != nil || restored != derived {
+		t.Fatalf("unexpected restored secret: %v", err)
+	}
+	if again, _ := models.DeriveHolderSecret(masterKey, "wallet-2"); again == derived {
+		t.Fatal("same secret for two wallets")
+	}
+}
+
+type holderCommitmentCircuit struct {
+	JWSProtected        []uints.U8        `gnark:",secret"`
+	HolderCommitmentB64 []uints.U8        `gnark:",secret"`
+	B64Position         frontend.Variable `gnark:",secret"`
+	HexPosition         frontend.Variable `gnark:",secret"`
+	HolderSalt          []uints.U8        `gnark:",secret"`
+	HolderSecret        []uints.U8        `gnark:",secret"`
+}
+
+func (c *holderCommitmentCircuit) Define(api frontend.API) error {
+	return common.VerifyHolderCommitment(api, c.JWSProtected, c.HolderCommitmentB64, c.B64Position, c.HexPosition, c.HolderSalt, c.HolderSecret)
+}
+
+// TestVerifyHolderCommitment checks the circuit opens the hsc claim of the
+// header only with the salt and the secret it commits to
+func TestVerifyHolderCommitment(t *testing.T) {
+	secret, err := models.NewHolderSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, commitment, err := secret.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "hsc": commitment})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerB64 := base64.RawURLEncoding.EncodeToString(header)
+	pos, err := (&common.Preprocessor{}).Process(common.CredentialArtifacts{JWS: headerB64 + ".e30.AA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hsc := pos.HolderCommitment
+	if hsc == nil {
+		t.Fatal("hsc claim not found")
+	}
+
+	circuitTemplate := &holderCommitmentCircuit{
+		JWSProtected:        make([]uints.U8, len(headerB64)),
+		HolderCommitmentB64: make([]uints.U8, len(hsc.B64)),
+		HolderSalt:          make([]uints.U8, common.HolderSaltSize),
+		HolderSecret:        make([]uints.U8, common.HolderSecretSize),
+	}
+	assignment := func(salt []byte, secret models.HolderSecret) *holderCommitmentCircuit {
+		return &holderCommitmentCircuit{
+			JWSProtected:        common.StringToU8Array(headerB64),
+			HolderCommitmentB64: common.StringToU8Array(hsc.B64),
+			B64Position:         hsc.B64Start,
+			HexPosition:         hsc.ValuePosition,
+			HolderSalt:          common.BytesToU8Array(salt),
+			HolderSecret:        common.BytesToU8Array(secret[:]),
+		}
+	}
+
+	if err := common.CheckWitness(circuitTemplate, assignment(salt, secret)); err != nil {
+		t.Fatalf("witness check failed: %v", err)
+	}
+	otherSecret, err := models.NewHolderSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.CheckWitness(circuitTemplate, assignment(salt, otherSecret)); err == nil {
+		t.Fatal("expected the witness check to fail for another secret")
+	}
+	otherSalt := append([]byte{}, salt...)
+	otherSalt[0] ^= 1
+	if err := common.CheckWitness(circuitTemplate, assignment(otherSalt, secret)); err == nil {
+		t.Fatal("expected the witness check to fail for another salt")
+	}
+}
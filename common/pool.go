@@ -0,0 +1,56 @@
+package common
+
+import (
+	"bytes"
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBufferSize bounds the buffers kept in the pool: proofs and public
+// witnesses are small, a buffer grown by a proving key or a full witness is
+// left to the GC instead of being retained
+const maxPooledBufferSize = 4 << 20
+
+var (
+	bufferPool = sync.Pool{New: func() any {
+		bufferPoolNew.Add(1)
+		return new(bytes.Buffer)
+	}}
+	bufferPoolGet atomic.Uint64
+	bufferPoolNew atomic.Uint64
+)
+
+// GetBuffer returns an empty buffer from the serialization buffer pool,
+// return it with PutBuffer
+func GetBuffer() *bytes.Buffer {
+	bufferPoolGet.Add(1)
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// PutBuffer returns a buffer to the pool, the buffer must not be used after
+func PutBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// BufferPoolStats counts the buffers taken from the pool and the buffers
+// allocated because the pool was empty
+type BufferPoolStats struct {
+	Gets      uint64 `json:"gets"`
+	Allocated uint64 `json:"allocated"`
+}
+
+// ReadBufferPoolStats returns the buffer pool counters
+func ReadBufferPoolStats() BufferPoolStats {
+	return BufferPoolStats{Gets: bufferPoolGet.Load(), Allocated: bufferPoolNew.Load()}
+}
+
+// PublishBufferPool publishes the buffer pool counters with expvar
+// (/debug/vars) under name
+func PublishBufferPool(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return ReadBufferPoolStats() }))
+}
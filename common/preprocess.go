@@ -0,0 +1,441 @@
+package common
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mynextid/eudi-zk/x509pos"
+)
+
+// CredentialArtifacts are the raw artifacts a presentation is built from,
+// every field is optional
+type CredentialArtifacts struct {
+	// Certificate is the DER X.509 certificate of the holder
+	Certificate []byte
+	// JWS is the compact serialization (protected.payload.signature) of the
+	// credential
+	JWS string
+	// SDJWT is the serialization of an SD-JWT credential (ParseSDJWT), in
+	// place of JWS: the requested claims are taken from the payload or from
+	// the disclosures
+	SDJWT string
+}
+
+// ClaimPosition locates a claim of a JWS part: the claim ("name":value) of
+// the decoded JSON, aligned to base64url groups, and the matching substring
+// of the encoded part
+type ClaimPosition struct {
+	B64Alignment
+	// B64 is the aligned substring of the encoded part, [B64Start, B64End)
+	B64 string
+	// Segment is the decoded aligned substring, [Start, End) of the JSON
+	Segment []byte
+	// ValuePosition is the offset of the value within Segment, past the
+	// opening quote for string values (e.g. the date of a birthdate claim)
+	ValuePosition int
+	// Value is the raw JSON value
+	Value json.RawMessage
+}
+
+// Positions are the off-circuit hints of the circuits: positions and aligned
+// substrings computed by a Preprocessor
+type Positions struct {
+	// Certificate are the positions of all the certificate fields, the
+	// fields below are the ones the circuits take
+	Certificate *x509pos.Certificate
+	// TBS is the TBSCertificate of the certificate, TBSStart its position
+	TBS      []byte
+	TBSStart int
+	// SubjectPubKeyPos is the position of the subject public key BIT STRING in
+	// the certificate (SubjectPubKeyPos), SubjectPubKeyPosInTBS in the TBS
+	SubjectPubKeyPos      int
+	SubjectPubKeyPosInTBS int
+
+	// Encoded and decoded JWS parts
+	ProtectedB64 string
+	PayloadB64   string
+	Protected    []byte
+	Payload      []byte
+	Signature    []byte
+
+	// Cnf is the cnf claim of the protected header (CnfB64, CnfB64Position)
+	// and CnfKeyHexPosition the position of its kid within Cnf.Segment
+	Cnf               *ClaimPosition
+	CnfKeyHexPosition int
+	// HolderCommitment is the hsc claim of the protected header, the
+	// commitment to the holder secret of the pairwise identifiers (see
+	// VerifyHolderCommitment), its ValuePosition the position of the hex
+	// encoded commitment
+	HolderCommitment *ClaimPosition
+
+	// Claims are the requested payload claims by name
+	Claims map[string]*ClaimPosition
+	// Disclosures are the requested claims of an SD-JWT which are not in the
+	// payload, by name
+	Disclosures map[string]*DisclosurePosition
+}
+
+// Preprocessor computes the positions and aligned substrings every circuit
+// takes as hints from the raw credential artifacts, and validates them before
+// the witness is created
+type Preprocessor struct {
+	// Claims are the payload claims to locate, e.g. "birthdate"
+	Claims []string
+}
+
+// Process computes and validates the positions of the artifacts. The
+// certificate and the credential are independent, they are processed
+// concurrently into distinct fields of the positions; the positions, and the
+// error reported when both fail, do not depend on the scheduling.
+func (p *Preprocessor) Process(artifacts CredentialArtifacts) (*Positions, error) {
+	pos := &Positions{Claims: map[string]*ClaimPosition{}}
+
+	var certErr error
+	var wg sync.WaitGroup
+	if artifacts.Certificate != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pos.processCertificate(artifacts.Certificate); err != nil {
+				certErr = fmt.Errorf("certificate: %w", err)
+			}
+		}()
+	}
+	credErr := p.processCredential(pos, artifacts)
+	wg.Wait()
+	if certErr != nil {
+		return nil, certErr
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	if err := pos.Validate(artifacts); err != nil {
+		return nil, err
+	}
+	return pos, nil
+}
+
+// processCredential locates the requested claims in the JWS or SD-JWT of the
+// artifacts
+func (p *Preprocessor) processCredential(pos *Positions, artifacts CredentialArtifacts) error {
+	switch {
+	case artifacts.JWS != "" && artifacts.SDJWT != "":
+		return fmt.Errorf("both a JWS and an SD-JWT given")
+	case artifacts.JWS != "":
+		if err := pos.processJWS(artifacts.JWS, p.Claims); err != nil {
+			return fmt.Errorf("jws: %w", err)
+		}
+	case artifacts.SDJWT != "":
+		return pos.processSDJWT(artifacts.SDJWT, p.Claims)
+	case len(p.Claims) > 0:
+		return fmt.Errorf("claims %v requested without a JWS", p.Claims)
+	}
+	return nil
+}
+
+func (pos *Positions) processCertificate(certDER []byte) error {
+	cert, err := x509pos.Parse(certDER)
+	if err != nil {
+		return err
+	}
+	pos.Certificate = cert
+	pos.TBSStart = cert.TBS.Start
+	pos.TBS = cert.TBS.Raw(certDER)
+	pos.SubjectPubKeyPos = cert.PublicKey.Start
+	pos.SubjectPubKeyPosInTBS = cert.InTBS(cert.PublicKey).Start
+	return nil
+}
+
+func (pos *Positions) processJWS(jws string, claims []string) error {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("expected 3 parts, got %d", len(parts))
+	}
+	pos.ProtectedB64, pos.PayloadB64 = parts[0], parts[1]
+
+	var err error
+	if pos.Protected, err = base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return fmt.Errorf("protected header: %w", err)
+	}
+	if pos.Payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return fmt.Errorf("payload: %w", err)
+	}
+	if pos.Signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+
+	// cnf of the protected header, when the credential is key bound
+	if cnf, err := FindClaim(pos.Protected, pos.ProtectedB64, "cnf"); err == nil {
+		var kid struct {
+			Kid string `json:"kid"`
+		}
+		if err := json.Unmarshal(cnf.Value, &kid); err != nil || kid.Kid == "" {
+			return fmt.Errorf("cnf has no kid")
+		}
+		kidPos := bytes.Index(cnf.Segment[cnf.ValuePosition:], []byte(kid.Kid))
+		if kidPos == -1 {
+			return fmt.Errorf("cnf kid not found")
+		}
+		// the circuits bind the kid to the key preceding it
+		if !bytes.HasSuffix(cnf.Segment[:cnf.ValuePosition+kidPos], []byte(CnfKidKey)) {
+			return fmt.Errorf("cnf kid must be the first member of a compact cnf")
+		}
+		pos.Cnf = cnf
+		pos.CnfKeyHexPosition = cnf.ValuePosition + kidPos
+	}
+
+	// hsc of the protected header, when the credential binds a holder secret
+	if hsc, err := FindClaim(pos.Protected, pos.ProtectedB64, "hsc"); err == nil {
+		// the quoted hex encoded SHA-256 digest
+		if len(hsc.Value) != 2+64 || hsc.Value[0] != '"' {
+			return fmt.Errorf("hsc is not a hex encoded SHA-256 digest")
+		}
+		pos.HolderCommitment = hsc
+	}
+
+	for _, name := range claims {
+		claim, err := FindClaim(pos.Payload, pos.PayloadB64, name)
+		if err != nil {
+			return err
+		}
+		pos.Claims[name] = claim
+	}
+	return nil
+}
+
+// processSDJWT locates the claims signed in clear as processJWS, and the
+// digests and disclosures of the selectively disclosed ones
+func (pos *Positions) processSDJWT(serialization string, claims []string) error {
+	sd, err := ParseSDJWT(serialization)
+	if err != nil {
+		return err
+	}
+	selected, err := sd.Select(claims)
+	if err != nil {
+		return err
+	}
+	var clear []string
+	for _, name := range claims {
+		if selected[name] == nil {
+			clear = append(clear, name)
+		}
+	}
+	if err := pos.processJWS(sd.JWS, clear); err != nil {
+		return fmt.Errorf("sd-jwt: %w", err)
+	}
+
+	pos.Disclosures = map[string]*DisclosurePosition{}
+	for name, d := range selected {
+		if pos.Disclosures[name], err = findDisclosure(pos.Payload, pos.PayloadB64, d); err != nil {
+			return fmt.Errorf("sd-jwt: claim %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// FindClaim locates the top-level claim name of the decoded JSON object and
+// its aligned substring in the base64url encoding b64 of the object
+func FindClaim(object []byte, b64, name string) (*ClaimPosition, error) {
+	dec := json.NewDecoder(bytes.NewReader(object))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		keyEnd := int(dec.InputOffset())
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if key != name {
+			continue
+		}
+
+		// the key token ends with its closing quote
+		encodedKey, _ := json.Marshal(key)
+		keyStart := bytes.LastIndex(object[:keyEnd], encodedKey)
+		if keyStart == -1 {
+			return nil, fmt.Errorf("claim %q: escaped keys are not supported", name)
+		}
+		valueEnd := int(dec.InputOffset())
+		valueStart := valueEnd - len(value)
+
+		a, err := AlignClaim(len(object), keyStart, valueEnd)
+		if err != nil {
+			return nil, err
+		}
+		if a.B64End > len(b64) {
+			return nil, fmt.Errorf("claim %q: base64url encoding too short", name)
+		}
+
+		valuePosition := valueStart - a.Start
+		if value[0] == '"' {
+			valuePosition++
+			// the circuits bind string values to the key preceding them
+			if !bytes.HasSuffix(object[:valueStart+1], []byte(ClaimKey(name))) {
+				return nil, fmt.Errorf("claim %q: whitespace around the colon is not supported", name)
+			}
+		}
+		return &ClaimPosition{
+			B64Alignment:  *a,
+			B64:           b64[a.B64Start:a.B64End],
+			Segment:       object[a.Start:a.End],
+			ValuePosition: valuePosition,
+			Value:         value,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("claim %q not found", name)
+}
+
+// StringValue returns the value of a string claim decoded as the circuits
+// decode it (UnescapeJSONString), and the length of its escaped form in the
+// JSON
+func (c *ClaimPosition) StringValue() (string, int, error) {
+	if len(c.Value) < 2 || c.Value[0] != '"' || c.Value[len(c.Value)-1] != '"' {
+		return "", 0, fmt.Errorf("not a string")
+	}
+	raw := c.Value[1 : len(c.Value)-1]
+	value, err := UnescapeJSONString(raw)
+	if err != nil {
+		return "", 0, err
+	}
+	return value, len(raw), nil
+}
+
+// CnfJWKPosition locates the cnf.jwk claim of a JWS part for VerifyCnfJWK
+type CnfJWKPosition struct {
+	// B64Start is the position of the segment in the encoded part, B64 the
+	// segment of CnfJWKSegmentLen bytes
+	B64Start int
+	B64      string
+	// CnfPosition is the position of CnfJWKPrefix in the decoded segment
+	CnfPosition int
+}
+
+// FindCnfJWK locates the P-256 cnf.jwk claim of a JWS part (decoded JSON and
+// its base64url encoding). The jwk must be serialized as VerifyCnfJWK expects,
+// see CnfJWKPrefix.
+func FindCnfJWK(object []byte, b64 string) (*CnfJWKPosition, error) {
+	claim, err := FindClaim(object, b64, "cnf")
+	if err != nil {
+		return nil, err
+	}
+	cnfPosition := claim.ValuePosition - len(`"cnf":`)
+	jwk := object[claim.Start+cnfPosition:]
+	if !bytes.HasPrefix(jwk, []byte(CnfJWKPrefix)) || len(jwk) < CnfJWKLen ||
+		string(jwk[CnfJWKLen-len(cnfJWKSuffix)-cnfJWKCoordLen-len(cnfJWKSeparator):CnfJWKLen-len(cnfJWKSuffix)-cnfJWKCoordLen]) != cnfJWKSeparator ||
+		string(jwk[CnfJWKLen-len(cnfJWKSuffix):CnfJWKLen]) != cnfJWKSuffix {
+		return nil, fmt.Errorf("cnf: not a compact P-256 jwk with sorted members")
+	}
+	if claim.B64Start+CnfJWKSegmentLen > len(b64) {
+		return nil, fmt.Errorf("cnf: base64url encoding too short")
+	}
+	return &CnfJWKPosition{
+		B64Start:    claim.B64Start,
+		B64:         b64[claim.B64Start : claim.B64Start+CnfJWKSegmentLen],
+		CnfPosition: cnfPosition,
+	}, nil
+}
+
+// Validate checks the positions actually match the artifacts: the subject
+// public key is found at its positions, and the aligned substrings decode to
+// the claims they locate
+func (pos *Positions) Validate(artifacts CredentialArtifacts) error {
+	if artifacts.Certificate != nil {
+		cert, err := x509.ParseCertificate(artifacts.Certificate)
+		if err != nil {
+			return fmt.Errorf("certificate: %w", err)
+		}
+		if !bytes.Equal(pos.TBS, cert.RawTBSCertificate) {
+			return fmt.Errorf("certificate: TBSCertificate at %d does not match", pos.TBSStart)
+		}
+
+		var spki struct {
+			Algorithm asn1.RawValue
+			PublicKey asn1.BitString
+		}
+		if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+			return fmt.Errorf("certificate: %w", err)
+		}
+		bitString, err := derElement(artifacts.Certificate, pos.SubjectPubKeyPos)
+		if err != nil || bitString[0] != 0x03 || !bytes.HasSuffix(bitString, spki.PublicKey.Bytes) {
+			return fmt.Errorf("certificate: subject public key not found at %d", pos.SubjectPubKeyPos)
+		}
+		if pos.TBSStart+pos.SubjectPubKeyPosInTBS != pos.SubjectPubKeyPos {
+			return fmt.Errorf("certificate: subject public key position in TBS does not match")
+		}
+	}
+
+	if pos.Cnf != nil {
+		if err := pos.Cnf.validate(pos.ProtectedB64); err != nil {
+			return fmt.Errorf("cnf: %w", err)
+		}
+	}
+	if pos.HolderCommitment != nil {
+		if err := pos.HolderCommitment.validate(pos.ProtectedB64); err != nil {
+			return fmt.Errorf("hsc: %w", err)
+		}
+	}
+	for name, claim := range pos.Claims {
+		if err := claim.validate(pos.PayloadB64); err != nil {
+			return fmt.Errorf("claim %q: %w", name, err)
+		}
+	}
+	for name, disclosure := range pos.Disclosures {
+		if err := disclosure.validate(pos.PayloadB64); err != nil {
+			return fmt.Errorf("disclosure %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the claim against the encoded part b64
+func (c *ClaimPosition) validate(b64 string) error {
+	if !strings.HasPrefix(b64[c.B64Start:], c.B64) || c.B64Start%4 != 0 {
+		return fmt.Errorf("base64url substring not found at %d", c.B64Start)
+	}
+	segment, err := base64.RawURLEncoding.DecodeString(c.B64)
+	if err != nil || !bytes.Equal(segment, c.Segment) {
+		return fmt.Errorf("base64url substring does not decode to the claim")
+	}
+	value := bytes.Trim(c.Value, `"`)
+	if !bytes.HasPrefix(segment[c.ValuePosition:], value) {
+		return fmt.Errorf("value not found at %d", c.ValuePosition)
+	}
+	return nil
+}
+
+// derElement returns the DER element at idx
+func derElement(data []byte, idx int) ([]byte, error) {
+	end, err := derEnd(data, idx)
+	if err != nil {
+		return nil, err
+	}
+	return data[idx:end], nil
+}
+
+// derEnd returns the position following the DER element at idx
+func derEnd(data []byte, idx int) (int, error) {
+	var raw asn1.RawValue
+	if idx >= len(data) {
+		return 0, fmt.Errorf("no DER element at %d", idx)
+	}
+	if _, err := asn1.Unmarshal(data[idx:], &raw); err != nil {
+		return 0, fmt.Errorf("DER element at %d: %w", idx, err)
+	}
+	return idx + len(raw.FullBytes), nil
+}
@@ -0,0 +1,161 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mockArtifacts(t testing.TB) CredentialArtifacts {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protected, _ := json.Marshal(map[string]any{
+		"alg": "ES256",
+		"cnf": map[string]string{"kid": "5f0c7e3b"},
+		"typ": "JOSE+JSON",
+	})
+	payload := []byte(`{"name": "Alice", "birthdate":"2000-01-31","age_over_18":true}`)
+	jws := base64.RawURLEncoding.EncodeToString(protected) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte("signature"))
+
+	return CredentialArtifacts{Certificate: certDER, JWS: jws}
+}
+
+func TestPreprocessor(t *testing.T) {
+	artifacts := mockArtifacts(t)
+	p := &Preprocessor{Claims: []string{"birthdate", "age_over_18"}}
+
+	pos, err := p.Process(artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// subject public key: BIT STRING, 66 bytes, no unused bits, uncompressed
+	spki := artifacts.Certificate[pos.SubjectPubKeyPos : pos.SubjectPubKeyPos+4]
+	if string(spki) != "\x03\x42\x00\x04" {
+		t.Fatalf("unexpected subject public key header %x", spki)
+	}
+	if pos.TBS[pos.SubjectPubKeyPosInTBS] != 0x03 {
+		t.Fatal("unexpected subject public key position in TBS")
+	}
+
+	// the aligned substrings are found where the circuits expect them
+	if !strings.HasPrefix(pos.ProtectedB64[pos.Cnf.B64Start:], pos.Cnf.B64) {
+		t.Fatal("cnf substring not at CnfB64Position")
+	}
+	if kid := string(pos.Cnf.Segment[pos.CnfKeyHexPosition:]); !strings.HasPrefix(kid, "5f0c7e3b") {
+		t.Fatalf("unexpected kid position: %q", kid)
+	}
+
+	birthdate := pos.Claims["birthdate"]
+	if date := string(birthdate.Segment[birthdate.ValuePosition:]); !strings.HasPrefix(date, "2000-01-31") {
+		t.Fatalf("unexpected birthdate position: %q", date)
+	}
+	if claim := string(birthdate.Segment[birthdate.Offset:]); !strings.HasPrefix(claim, `"birthdate":"2000-01-31"`) {
+		t.Fatalf("unexpected claim position: %q", claim)
+	}
+	if over18 := pos.Claims["age_over_18"]; string(over18.Value) != "true" {
+		t.Fatalf("unexpected age_over_18 value %s", over18.Value)
+	}
+}
+
+func TestPreprocessorMissingClaim(t *testing.T) {
+	p := &Preprocessor{Claims: []string{"family_name"}}
+	if _, err := p.Process(mockArtifacts(t)); err == nil {
+		t.Fatal("expected an error for a missing claim")
+	}
+}
+
+func TestFindClaimWhitespace(t *testing.T) {
+	object := []byte(`{"birthdate": "2010-01-01"}`)
+	if _, err := FindClaim(object, base64.RawURLEncoding.EncodeToString(object), "birthdate"); err == nil {
+		t.Fatal("expected an error for whitespace between the key and the value")
+	}
+}
+
+func TestPositionsValidate(t *testing.T) {
+	artifacts := mockArtifacts(t)
+	pos, err := (&Preprocessor{Claims: []string{"birthdate"}}).Process(artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pos.SubjectPubKeyPos++
+	if err := pos.Validate(artifacts); err == nil {
+		t.Fatal("expected an error for a wrong subject public key position")
+	}
+	pos.SubjectPubKeyPos--
+
+	pos.Claims["birthdate"].ValuePosition++
+	if err := pos.Validate(artifacts); err == nil {
+		t.Fatal("expected an error for a wrong value position")
+	}
+}
+
+func TestBytesToU8Arrays(t *testing.T) {
+	large := make([]byte, 3*parallelChunk+5)
+	rand.Read(large)
+	inputs := [][]byte{[]byte("certificate"), nil, large}
+	for range 3 {
+		converted := BytesToU8Arrays(inputs...)
+		if len(converted) != len(inputs) {
+			t.Fatalf("%d conversions, expected %d", len(converted), len(inputs))
+		}
+		for i, in := range inputs {
+			if !reflect.DeepEqual(converted[i], BytesToU8Array(in)) {
+				t.Fatalf("input %d converted differently", i)
+			}
+		}
+	}
+}
+
+func BenchmarkPreprocess(b *testing.B) {
+	artifacts := mockArtifacts(b)
+	p := &Preprocessor{Claims: []string{"birthdate", "age_over_18"}}
+	for b.Loop() {
+		if _, err := p.Process(artifacts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBytesToU8Arrays(b *testing.B) {
+	cert, payload, crl := make([]byte, 2<<10), make([]byte, 256<<10), make([]byte, 1<<20)
+	b.Run("serial", func(b *testing.B) {
+		for b.Loop() {
+			for _, in := range [][]byte{cert, payload, crl} {
+				BytesToU8Array(in)
+			}
+		}
+	})
+	b.Run("concurrent", func(b *testing.B) {
+		for b.Loop() {
+			BytesToU8Arrays(cert, payload, crl)
+		}
+	})
+}
@@ -0,0 +1,457 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"unsafe"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+// gadgetLabels are the gadget labels of the constraint profile, by function
+// name prefix. A constraint goes to the outermost labelled gadget of its call
+// stack (the SHA-256 of VerifyES256 is "sha256", the uints of SHA-256 are
+// "sha256" too); constraints outside labelled gadgets go to the innermost
+// function of this module.
+var gadgetLabels = []struct{ prefix, label string }{
+	{"github.com/mynextid/eudi-zk/common.SHA256", "sha256"},
+	{"github.com/consensys/gnark/std/hash/sha2.", "sha256"},
+	{"github.com/mynextid/eudi-zk/common.DecodeBase64Url", "base64"},
+	{"github.com/mynextid/eudi-zk/common.DecodeHex", "hex"},
+	{"github.com/mynextid/eudi-zk/circuits/eudi-vc.ReadByteAt", "read_byte_at"},
+	{"github.com/mynextid/eudi-zk/common.GetSubset", "get_subset"},
+	{"github.com/mynextid/eudi-zk/common.MustSubset", "subset"},
+	{"github.com/mynextid/eudi-zk/common.CheckSubset", "subset"},
+	{"github.com/mynextid/eudi-zk/common.IsSubset", "subset"},
+	{"github.com/mynextid/eudi-zk/common.VerifyRS256", "rsa"},
+	{"github.com/consensys/gnark/std/signature/ecdsa.", "ecdsa"},
+	{"github.com/consensys/gnark/std/commitments/kzg.", "kzg"},
+	{"github.com/consensys/gnark/std/algebra/", "curve arithmetic"},
+	{"github.com/consensys/gnark/std/math/emulated.", "emulated field"},
+	{"github.com/consensys/gnark/std/rangecheck.", "range checks"},
+	{"github.com/consensys/gnark/std/lookup/", "lookups"},
+}
+
+// modulePrefix is the prefix of the functions of this module
+const modulePrefix = "github.com/mynextid/eudi-zk/"
+
+// GadgetConstraints is a row of a ConstraintProfile
+type GadgetConstraints struct {
+	Gadget      string
+	Constraints int
+}
+
+// ConstraintProfile is the constraint breakdown of a circuit per gadget, see
+// ProfileConstraints
+type ConstraintProfile struct {
+	// Total is the number of constraints of the compiled circuit
+	Total int
+	// Gadgets are the gadgets by decreasing number of constraints
+	Gadgets []GadgetConstraints
+	// SHA256 are the statistics of the SHA-256 hashers (NewSHA256)
+	SHA256 HasherStats
+}
+
+// WriteTo writes the profile as a table
+func (p *ConstraintProfile) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "constraints\tshare\t gadget\n")
+	for _, g := range p.Gadgets {
+		fmt.Fprintf(tw, "%d\t%.1f%%\t %s\n", g.Constraints, 100*float64(g.Constraints)/float64(max(p.Total, 1)), g.Gadget)
+	}
+	fmt.Fprintf(tw, "%d\t100.0%%\t total\n", p.Total)
+	tw.Flush()
+	if p.SHA256.Digests > 0 {
+		fmt.Fprintf(&sb, "\nsha256: %d digests on %d hasher instances, %d constraints saved by the reuse\n", p.SHA256.Digests, p.SHA256.Instances, p.SHA256.Saved)
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// lookupQueries are the functions queueing lookup queries: the constraints of
+// the lookups are only added by the deferred argument of the table, they are
+// shared among the gadgets in proportion to the values they looked up
+var lookupQueries = []string{
+	"github.com/consensys/gnark/std/internal/logderivprecomp.(*Precomputed).Query",
+	"github.com/consensys/gnark/std/lookup/logderivlookup.(*table[...]).Lookup",
+}
+
+// lookupArgument is the function building the deferred lookup arguments
+const lookupArgument = "github.com/consensys/gnark/std/internal/logderivarg."
+
+// ProfileConstraints compiles the circuit (R1CS, BN254) with a profiling API:
+// every API call of the circuit goes through a counting decorator that
+// attributes the constraints it adds to the gadget of the caller (see
+// gadgetLabels). The deferred lookup arguments are shared among the gadgets
+// that queried the tables; the range checks are a gadget of their own. The
+// compilation is slower than frontend.Compile.
+func ProfileConstraints(circuit frontend.Circuit) (*ConstraintProfile, error) {
+	var b *profilingBuilder
+	newBuilder := func(field *big.Int, config frontend.CompileConfig) (frontend.Builder[constraint.U64], error) {
+		inner, err := r1cs.NewBuilder[constraint.U64](field, config)
+		if err != nil {
+			return nil, err
+		}
+		count, err := constraintCounter(inner)
+		if err != nil {
+			return nil, err
+		}
+		b = &profilingBuilder{Builder: inner, count: count, counts: map[string]int{}, queries: map[string]int{}, frames: map[uintptr]profileFrame{}}
+		return b, nil
+	}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), newBuilder, circuit)
+	if err != nil {
+		return nil, err
+	}
+	b.shareLookups()
+
+	p := &ConstraintProfile{Total: ccs.GetNbConstraints()}
+	if pool, ok := b.GetKeyValue(hasherPoolKey{}).(*hasherPool); ok {
+		p.SHA256 = pool.stats
+		if p.SHA256.Instances < p.SHA256.Digests {
+			unpooled, err := frontend.Compile(ecc.BN254.ScalarField(), newUnpooledBuilder, circuit)
+			if err != nil {
+				return nil, err
+			}
+			p.SHA256.Saved = unpooled.GetNbConstraints() - p.Total
+		}
+	}
+	attributed := 0
+	for gadget, n := range b.counts {
+		if n > 0 {
+			p.Gadgets = append(p.Gadgets, GadgetConstraints{Gadget: gadget, Constraints: n})
+			attributed += n
+		}
+	}
+	if rest := p.Total - attributed; rest > 0 {
+		p.Gadgets = append(p.Gadgets, GadgetConstraints{Gadget: "(compiler)", Constraints: rest})
+	}
+	slices.SortFunc(p.Gadgets, func(a, b GadgetConstraints) int {
+		if a.Constraints != b.Constraints {
+			return b.Constraints - a.Constraints
+		}
+		return strings.Compare(a.Gadget, b.Gadget)
+	})
+	return p, nil
+}
+
+// newUnpooledBuilder is the R1CS builder instantiating a SHA-256 hasher for
+// every digest
+func newUnpooledBuilder(field *big.Int, config frontend.CompileConfig) (frontend.Builder[constraint.U64], error) {
+	b, err := r1cs.NewBuilder[constraint.U64](field, config)
+	if err != nil {
+		return nil, err
+	}
+	kv, ok := b.(keyValueStore)
+	if !ok {
+		return nil, fmt.Errorf("profile: builder %T without key-value store", b)
+	}
+	kv.SetKeyValue(hasherPoolKey{}, &hasherPool{disabled: true})
+	return b, nil
+}
+
+// constraintCounter returns the live number of constraints of a gnark
+// builder. The builders only expose it once compiled, it is read from their
+// constraint system (unexported field cs).
+func constraintCounter(builder any) (func() int, error) {
+	v := reflect.ValueOf(builder)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		if f := v.FieldByName("cs"); f.IsValid() && f.CanAddr() {
+			cs, ok := reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Interface().(interface{ GetNbConstraints() int })
+			if ok {
+				return cs.GetNbConstraints, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("profile: unsupported builder %T", builder)
+}
+
+// Kinds of the frames of a call stack
+const (
+	frameOther = iota
+	// frameGadget is a function of gadgetLabels
+	frameGadget
+	// frameModule is another function of this module
+	frameModule
+	// frameQuery is a function of lookupQueries
+	frameQuery
+	// frameArgument is the lookup argument
+	frameArgument
+	// frameProfiler is ProfileConstraints, the bottom of the circuit stacks
+	frameProfiler
+)
+
+type profileFrame struct {
+	kind  int
+	label string
+}
+
+// profilingBuilder is the counting decorator of ProfileConstraints. Each API
+// call attributes the constraints added since the previous call, and those
+// it adds, to the gadget of its caller. The key-value store and the
+// commitments of the wrapped builder are forwarded, the std gadgets look them
+// up on the API.
+type profilingBuilder struct {
+	frontend.Builder[constraint.U64]
+	count func() int
+	// last is the number of constraints at the last attribution
+	last   int
+	counts map[string]int
+	// queries counts the lookup queries per gadget
+	queries map[string]int
+	// frames caches the frames of the call stacks, by PC
+	frames map[uintptr]profileFrame
+	pcs    [256]uintptr
+}
+
+// enter attributes the constraints added outside the API calls (hints and
+// range checks of the compiler) and returns the gadget of the caller, to
+// pass to exit
+func (b *profilingBuilder) enter() string {
+	gadget, _ := b.gadget()
+	b.exit(gadget)
+	return gadget
+}
+
+// exit attributes the constraints added since the last attribution
+func (b *profilingBuilder) exit(gadget string) {
+	n := b.count()
+	b.counts[gadget] += n - b.last
+	b.last = n
+}
+
+// lookupsLabel is the gadget of the lookup arguments, until shareLookups
+const lookupsLabel = "lookups"
+
+// gadget returns the gadget label of the calling stack: the outermost gadget
+// of gadgetLabels, else the innermost function of this module. query reports
+// a lookup query.
+func (b *profilingBuilder) gadget() (gadget string, query bool) {
+	n := runtime.Callers(3, b.pcs[:])
+	outer, inner := "", ""
+	for _, pc := range b.pcs[:n] {
+		frame, ok := b.frames[pc]
+		if !ok {
+			frame = newProfileFrame(pc)
+			b.frames[pc] = frame
+		}
+		switch frame.kind {
+		case frameGadget:
+			outer = frame.label
+		case frameModule:
+			if inner == "" {
+				inner = frame.label
+			}
+		case frameQuery:
+			query = true
+		case frameArgument:
+			// the lookup arguments are deferred, out of the gadgets
+			return lookupsLabel, false
+		}
+		if frame.kind == frameProfiler {
+			break
+		}
+	}
+	switch {
+	case outer != "":
+		return outer, query
+	case inner != "":
+		return inner, query
+	}
+	return "(other)", query
+}
+
+func newProfileFrame(pc uintptr) profileFrame {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	name := frame.Function
+	for _, g := range gadgetLabels {
+		if strings.HasPrefix(name, g.prefix) {
+			return profileFrame{frameGadget, g.label}
+		}
+	}
+	for _, prefix := range lookupQueries {
+		if strings.HasPrefix(name, prefix) {
+			return profileFrame{kind: frameQuery}
+		}
+	}
+	switch {
+	case strings.HasPrefix(name, lookupArgument):
+		return profileFrame{kind: frameArgument}
+	case strings.HasPrefix(name, modulePrefix+"common.ProfileConstraints"):
+		return profileFrame{kind: frameProfiler}
+	case !strings.HasPrefix(name, modulePrefix), strings.HasPrefix(name, modulePrefix+"common.(*profilingBuilder)"):
+		return profileFrame{}
+	}
+	return profileFrame{frameModule, name[strings.LastIndex(name, "/")+1:]}
+}
+
+// shareLookups shares the constraints of the lookup arguments among the
+// gadgets, in proportion to their queries; the rounding stays in "lookups"
+func (b *profilingBuilder) shareLookups() {
+	total, queries := b.counts[lookupsLabel], 0
+	for _, n := range b.queries {
+		queries += n
+	}
+	if total == 0 || queries == 0 {
+		return
+	}
+	for gadget, n := range b.queries {
+		share := int(int64(total) * int64(n) / int64(queries))
+		b.counts[gadget] += share
+		b.counts[lookupsLabel] -= share
+	}
+}
+
+// NewHint counts the lookup queries, the lookup tables query their hints
+func (b *profilingBuilder) NewHint(f solver.Hint, nbOutputs int, inputs ...frontend.Variable) ([]frontend.Variable, error) {
+	if gadget, query := b.gadget(); query {
+		b.queries[gadget] += nbOutputs
+	}
+	return b.Builder.NewHint(f, nbOutputs, inputs...)
+}
+
+// SetKeyValue forwards the key-value store of the wrapped builder
+func (b *profilingBuilder) SetKeyValue(key, value any) {
+	b.Builder.(interface{ SetKeyValue(key, value any) }).SetKeyValue(key, value)
+}
+
+// GetKeyValue forwards the key-value store of the wrapped builder
+func (b *profilingBuilder) GetKeyValue(key any) any {
+	return b.Builder.(interface{ GetKeyValue(key any) any }).GetKeyValue(key)
+}
+
+// Compiler returns the decorator, the gadgets going through the compiler are
+// profiled too
+func (b *profilingBuilder) Compiler() frontend.Compiler {
+	return b
+}
+
+// Commit implements frontend.Committer
+func (b *profilingBuilder) Commit(toCommit ...frontend.Variable) (frontend.Variable, error) {
+	defer b.exit(b.enter())
+	return b.Builder.(frontend.Committer).Commit(toCommit...)
+}
+
+func (b *profilingBuilder) Add(i1, i2 frontend.Variable, in ...frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Add(i1, i2, in...)
+}
+
+func (b *profilingBuilder) MulAcc(a, c, d frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.MulAcc(a, c, d)
+}
+
+func (b *profilingBuilder) Neg(i1 frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Neg(i1)
+}
+
+func (b *profilingBuilder) Sub(i1, i2 frontend.Variable, in ...frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Sub(i1, i2, in...)
+}
+
+func (b *profilingBuilder) Mul(i1, i2 frontend.Variable, in ...frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Mul(i1, i2, in...)
+}
+
+func (b *profilingBuilder) DivUnchecked(i1, i2 frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.DivUnchecked(i1, i2)
+}
+
+func (b *profilingBuilder) Div(i1, i2 frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Div(i1, i2)
+}
+
+func (b *profilingBuilder) Inverse(i1 frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Inverse(i1)
+}
+
+func (b *profilingBuilder) ToBinary(i1 frontend.Variable, n ...int) []frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.ToBinary(i1, n...)
+}
+
+func (b *profilingBuilder) FromBinary(b1 ...frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.FromBinary(b1...)
+}
+
+func (b *profilingBuilder) Xor(a, c frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Xor(a, c)
+}
+
+func (b *profilingBuilder) Or(a, c frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Or(a, c)
+}
+
+func (b *profilingBuilder) And(a, c frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.And(a, c)
+}
+
+func (b *profilingBuilder) Select(s, i1, i2 frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Select(s, i1, i2)
+}
+
+func (b *profilingBuilder) Lookup2(b0, b1 frontend.Variable, i0, i1, i2, i3 frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Lookup2(b0, b1, i0, i1, i2, i3)
+}
+
+func (b *profilingBuilder) IsZero(i1 frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.IsZero(i1)
+}
+
+func (b *profilingBuilder) Cmp(i1, i2 frontend.Variable) frontend.Variable {
+	defer b.exit(b.enter())
+	return b.Builder.Cmp(i1, i2)
+}
+
+func (b *profilingBuilder) AssertIsEqual(i1, i2 frontend.Variable) {
+	defer b.exit(b.enter())
+	b.Builder.AssertIsEqual(i1, i2)
+}
+
+func (b *profilingBuilder) AssertIsDifferent(i1, i2 frontend.Variable) {
+	defer b.exit(b.enter())
+	b.Builder.AssertIsDifferent(i1, i2)
+}
+
+func (b *profilingBuilder) AssertIsBoolean(i1 frontend.Variable) {
+	defer b.exit(b.enter())
+	b.Builder.AssertIsBoolean(i1)
+}
+
+func (b *profilingBuilder) AssertIsCrumb(i1 frontend.Variable) {
+	defer b.exit(b.enter())
+	b.Builder.AssertIsCrumb(i1)
+}
+
+func (b *profilingBuilder) AssertIsLessOrEqual(v frontend.Variable, bound frontend.Variable) {
+	defer b.exit(b.enter())
+	b.Builder.AssertIsLessOrEqual(v, bound)
+}
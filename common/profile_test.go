@@ -0,0 +1,72 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// profiledCircuit decodes a base64url string and hashes the result
+type profiledCircuit struct {
+	Encoded []uints.U8
+	Digest  []uints.U8 `gnark:",public"`
+}
+
+func (c *profiledCircuit) Define(api frontend.API) error {
+	decoded, err := DecodeBase64Url(api, c.Encoded)
+	if err != nil {
+		return err
+	}
+	digest, err := SHA256(api, decoded)
+	if err != nil {
+		return err
+	}
+	for i := range c.Digest {
+		api.AssertIsEqual(digest[i].Val, c.Digest[i].Val)
+	}
+	return nil
+}
+
+func TestProfileConstraints(t *testing.T) {
+	circuit := &profiledCircuit{Encoded: make([]uints.U8, 64), Digest: make([]uints.U8, 32)}
+	p, err := ProfileConstraints(circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// same constraints as the plain compilation
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Total != ccs.GetNbConstraints() {
+		t.Fatalf("expected %d constraints, got %d", ccs.GetNbConstraints(), p.Total)
+	}
+
+	gadgets := map[string]int{}
+	sum := 0
+	for _, g := range p.Gadgets {
+		gadgets[g.Gadget] = g.Constraints
+		sum += g.Constraints
+	}
+	if sum != p.Total {
+		t.Fatalf("the gadgets sum to %d constraints, expected %d", sum, p.Total)
+	}
+	if gadgets["sha256"] == 0 || gadgets["base64"] == 0 {
+		t.Fatalf("expected sha256 and base64 constraints, got %v", gadgets)
+	}
+	if p.Gadgets[0].Gadget != "sha256" {
+		t.Errorf("expected sha256 to dominate, got %v", p.Gadgets)
+	}
+
+	var sb strings.Builder
+	p.WriteTo(&sb)
+	if !strings.Contains(sb.String(), "sha256") || !strings.Contains(sb.String(), "total") {
+		t.Errorf("unexpected table:\n%s", sb.String())
+	}
+	t.Logf("\n%s", sb.String())
+}
@@ -0,0 +1,209 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+// Provenance signatures of the compiled artifacts: next to each artifact
+// (circuit.ccs, proving.key, verification.key) a .sig file holds the Ed25519
+// signature of an operator key over the kind and the SHA-256 of the artifact,
+// so a tampered or swapped artifact is detected before it is used.
+//
+//	{"signer": "ops-2026", "kind": "verification.key", "sha256": "9f86...", "signature": "base64"}
+
+// ArtifactSignatureSuffix is appended to the path (or store key) of an
+// artifact to get the path of its signature
+const ArtifactSignatureSuffix = ".sig"
+
+// ErrUntrustedArtifact is returned for an artifact without a valid signature
+// of a trusted key
+var ErrUntrustedArtifact = errors.New("artifact provenance check failed")
+
+// artifactSignatureContext separates the artifact signatures from other
+// signatures of the operator keys
+const artifactSignatureContext = "eudi-zk artifact v1\x00"
+
+// ArtifactSignature is the content of a .sig file
+type ArtifactSignature struct {
+	// Signer is the key id of the signing key
+	Signer string `json:"signer"`
+	// Kind is the artifact name (ArtifactCCS, ArtifactProvingKey or
+	// ArtifactVerifyingKey), so that the signature of one artifact does not
+	// cover another one
+	Kind      string `json:"kind"`
+	SHA256    string `json:"sha256"`
+	Signature []byte `json:"signature"`
+}
+
+// ArtifactSigner is an operator key signing the artifacts
+type ArtifactSigner struct {
+	KeyID string
+	Key   ed25519.PrivateKey
+}
+
+// ArtifactProvenance configures the provenance checks of SetupAndSave,
+// LoadSetup and their artifact store variants
+type ArtifactProvenance struct {
+	// Signer signs the saved artifacts, which are not signed when nil
+	Signer *ArtifactSigner
+	// Trusted are the keys accepted when loading, by key id. When set, the
+	// artifacts without a valid signature of one of them are refused.
+	Trusted map[string]ed25519.PublicKey
+}
+
+var provenance atomic.Pointer[ArtifactProvenance]
+
+// SetArtifactProvenance sets the provenance checks of the artifacts saved and
+// loaded from now on
+func SetArtifactProvenance(p ArtifactProvenance) {
+	provenance.Store(&p)
+}
+
+// currentProvenance returns the provenance checks, none by default
+func currentProvenance() ArtifactProvenance {
+	if p := provenance.Load(); p != nil {
+		return *p
+	}
+	return ArtifactProvenance{}
+}
+
+func artifactMessage(kind string, digest []byte) []byte {
+	return append([]byte(artifactSignatureContext+kind+"\x00"), digest...)
+}
+
+// SignArtifact returns the .sig file of an artifact of the given kind, from
+// its SHA-256 digest
+func SignArtifact(signer ArtifactSigner, kind string, digest []byte) ([]byte, error) {
+	if len(signer.Key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid artifact signing key %q", signer.KeyID)
+	}
+	return json.Marshal(ArtifactSignature{
+		Signer:    signer.KeyID,
+		Kind:      kind,
+		SHA256:    hex.EncodeToString(digest),
+		Signature: ed25519.Sign(signer.Key, artifactMessage(kind, digest)),
+	})
+}
+
+// VerifyArtifact verifies the .sig file of an artifact of the given kind,
+// from its SHA-256 digest, and returns the key id of the signer
+func VerifyArtifact(trusted map[string]ed25519.PublicKey, kind string, digest, sig []byte) (string, error) {
+	var s ArtifactSignature
+	if err := json.Unmarshal(sig, &s); err != nil {
+		return "", fmt.Errorf("%w: invalid signature file: %v", ErrUntrustedArtifact, err)
+	}
+	key, ok := trusted[s.Signer]
+	if !ok {
+		return "", fmt.Errorf("%w: %s signed by the untrusted key %q", ErrUntrustedArtifact, kind, s.Signer)
+	}
+	if s.Kind != kind {
+		return "", fmt.Errorf("%w: signature of a %s, not of a %s", ErrUntrustedArtifact, s.Kind, kind)
+	}
+	if s.SHA256 != hex.EncodeToString(digest) {
+		return "", fmt.Errorf("%w: %s does not match its signature", ErrUntrustedArtifact, kind)
+	}
+	if !ed25519.Verify(key, artifactMessage(kind, digest), s.Signature) {
+		return "", fmt.Errorf("%w: invalid signature of %s by %q", ErrUntrustedArtifact, kind, s.Signer)
+	}
+	return s.Signer, nil
+}
+
+// fileDigest returns the SHA-256 of the file at path
+func fileDigest(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// signArtifactFile writes the .sig file of the artifact at path
+func signArtifactFile(signer ArtifactSigner, kind, path string) error {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	sig, err := SignArtifact(signer, kind, digest)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+ArtifactSignatureSuffix, sig, 0o644)
+}
+
+// verifyArtifactFile verifies the .sig file of the artifact at path
+func verifyArtifactFile(trusted map[string]ed25519.PublicKey, kind, path string) error {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	sig, err := os.ReadFile(path + ArtifactSignatureSuffix)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrUntrustedArtifact, path, err)
+	}
+	if _, err := VerifyArtifact(trusted, kind, digest, sig); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// putSignedArtifact uploads an artifact, preceded by its signature when a
+// signer is set: a reader seeing the artifact sees its signature
+func putSignedArtifact(ctx context.Context, store artifact.Store, signer *ArtifactSigner, key, kind string, data []byte) error {
+	if signer != nil {
+		digest := sha256.Sum256(data)
+		sig, err := SignArtifact(*signer, kind, digest[:])
+		if err != nil {
+			return err
+		}
+		if err := store.Put(ctx, key+ArtifactSignatureSuffix, bytes.NewReader(sig)); err != nil {
+			return err
+		}
+	}
+	return store.Put(ctx, key, bytes.NewReader(data))
+}
+
+// VerifyArtifactFromStore verifies the signature (key + ".sig") of the
+// artifact stored at key and returns the key id of the signer
+func VerifyArtifactFromStore(ctx context.Context, store artifact.Store, key, kind string, trusted map[string]ed25519.PublicKey) (string, error) {
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	sigReader, err := store.Get(ctx, key+ArtifactSignatureSuffix)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrUntrustedArtifact, key, err)
+	}
+	defer sigReader.Close()
+	sig, err := io.ReadAll(sigReader)
+	if err != nil {
+		return "", err
+	}
+	signer, err := VerifyArtifact(trusted, kind, h.Sum(nil), sig)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	return signer, nil
+}
@@ -0,0 +1,88 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+func newArtifactSigner(t *testing.T, keyID string) ArtifactSigner {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ArtifactSigner{KeyID: keyID, Key: key}
+}
+
+func TestArtifactProvenance(t *testing.T) {
+	t.Cleanup(func() { SetArtifactProvenance(ArtifactProvenance{}) })
+	ops := newArtifactSigner(t, "ops")
+	other := newArtifactSigner(t, "other")
+	trusted := map[string]ed25519.PublicKey{"ops": ops.Key.Public().(ed25519.PublicKey)}
+
+	dir := t.TempDir()
+	ccsPath, pkPath, vkPath := filepath.Join(dir, ArtifactCCS), filepath.Join(dir, ArtifactProvingKey), filepath.Join(dir, ArtifactVerifyingKey)
+	SetArtifactProvenance(ArtifactProvenance{Signer: &ops})
+	if err := SetupAndSave(&powerCircuit{N: 4}, ccsPath, pkPath, vkPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{ccsPath, pkPath, vkPath} {
+		if _, err := os.Stat(path + ArtifactSignatureSuffix); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	SetArtifactProvenance(ArtifactProvenance{Trusted: trusted})
+	if _, _, _, err := LoadSetup(ccsPath, pkPath, vkPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// the signature of the proving key does not cover the verifying key
+	pkSig, _ := os.ReadFile(pkPath + ArtifactSignatureSuffix)
+	vkSig, _ := os.ReadFile(vkPath + ArtifactSignatureSuffix)
+	os.WriteFile(vkPath+ArtifactSignatureSuffix, pkSig, 0o644)
+	if _, _, _, err := LoadSetup(ccsPath, pkPath, vkPath); !errors.Is(err, ErrUntrustedArtifact) {
+		t.Fatalf("expected a provenance error for a swapped signature, got %v", err)
+	}
+	os.WriteFile(vkPath+ArtifactSignatureSuffix, vkSig, 0o644)
+
+	// tampered artifact
+	vk, _ := os.ReadFile(vkPath)
+	vk[len(vk)-1] ^= 1
+	os.WriteFile(vkPath, vk, 0o644)
+	if _, _, _, err := LoadSetup(ccsPath, pkPath, vkPath); !errors.Is(err, ErrUntrustedArtifact) {
+		t.Fatalf("expected a provenance error for a tampered artifact, got %v", err)
+	}
+
+	// artifacts signed by an untrusted key, or not signed, in a store
+	ctx := t.Context()
+	storeDir := t.TempDir()
+	store := artifact.NewFSStore(storeDir)
+	SetArtifactProvenance(ArtifactProvenance{Signer: &other})
+	if _, _, _, err := InitCircuitFromStore(ctx, store, "power/", false, &powerCircuit{N: 4}, KeyEncodingRaw); err != nil {
+		t.Fatal(err)
+	}
+	SetArtifactProvenance(ArtifactProvenance{Trusted: trusted})
+	_, _, _, err := LoadSetupFromStore(ctx, store, "power/", KeyEncodingRaw)
+	if !errors.Is(err, ErrUntrustedArtifact) || !strings.Contains(err.Error(), `"other"`) {
+		t.Fatalf("expected a provenance error for an untrusted signer, got %v", err)
+	}
+	if err := os.Remove(filepath.Join(storeDir, "power", ArtifactVerifyingKey+ArtifactSignatureSuffix)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := LoadSetupFromStore(ctx, store, "power/", KeyEncodingRaw); !errors.Is(err, ErrUntrustedArtifact) {
+		t.Fatalf("expected a provenance error for a missing signature, got %v", err)
+	}
+
+	signer, err := VerifyArtifactFromStore(ctx, store, "power/"+ArtifactCCS, ArtifactCCS, map[string]ed25519.PublicKey{"other": other.Key.Public().(ed25519.PublicKey)})
+	if err != nil || signer != "other" {
+		t.Fatalf("expected the signer other, got %q (%v)", signer, err)
+	}
+}
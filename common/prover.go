@@ -0,0 +1,238 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fp"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	csbn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+)
+
+// AllocStats are the heap allocations and GC cycles of a span of work, the
+// difference of two ReadAllocStats
+type AllocStats struct {
+	Bytes   uint64        `json:"bytes"`   // bytes allocated
+	Mallocs uint64        `json:"mallocs"` // heap objects allocated
+	NumGC   uint32        `json:"num_gc"`  // completed GC cycles
+	GCPause time.Duration `json:"gc_pause"`
+}
+
+// ReadAllocStats returns the cumulative allocation counters of the process
+func ReadAllocStats() AllocStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return AllocStats{Bytes: m.TotalAlloc, Mallocs: m.Mallocs, NumGC: m.NumGC, GCPause: time.Duration(m.PauseTotalNs)}
+}
+
+// Sub returns the allocations between the counters before and s
+func (s AllocStats) Sub(before AllocStats) AllocStats {
+	return AllocStats{
+		Bytes:   s.Bytes - before.Bytes,
+		Mallocs: s.Mallocs - before.Mallocs,
+		NumGC:   s.NumGC - before.NumGC,
+		GCPause: s.GCPause - before.GCPause,
+	}
+}
+
+// Prover proves assignments of a compiled circuit, one job after the other or
+// concurrently. The gnark prover allocates the witness vector and its FFT
+// scratch space per proof and offers no way to reuse them; the Prover passes
+// its options to every proof (e.g. backend.WithSolverOptions(
+// solver.WithNbTasks(n)) to bound the concurrent solver buffers) and
+// serializes the outputs through the pooled buffers (GetBuffer).
+type Prover struct {
+	// mu guards ccs and pk, released by Close
+	mu   sync.RWMutex
+	ccs  constraint.ConstraintSystem
+	pk   groth16.ProvingKey
+	opts []backend.ProverOption
+}
+
+// ProveResult is a serialized proof with its public witness (gnark binary
+// encoding) and the cost of the proof
+type ProveResult struct {
+	Proof         []byte
+	PublicWitness []byte
+	ProveTime     time.Duration
+	// Allocs are the allocations of the whole job, witness creation to
+	// serialization; they include the allocations of concurrent jobs
+	Allocs AllocStats
+}
+
+// ErrProverClosed is returned by the proofs of a closed Prover
+var ErrProverClosed = errors.New("prover closed")
+
+// NewProver returns a prover for the compiled circuit
+func NewProver(ccs constraint.ConstraintSystem, pk groth16.ProvingKey, opts ...backend.ProverOption) *Prover {
+	return &Prover{ccs: ccs, pk: pk, opts: opts}
+}
+
+// Close releases the constraint system and the proving key of the prover, for
+// an embedder compiling circuits on the fly to reclaim their memory; the
+// proofs started after it fail with ErrProverClosed, the proofs in flight
+// complete. prover.Farm closes its provers once unregistered and their proofs
+// done.
+func (p *Prover) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ccs, p.pk = nil, nil
+}
+
+// compiled returns the constraint system and the proving key of the prover,
+// ErrProverClosed once closed
+func (p *Prover) compiled() (constraint.ConstraintSystem, groth16.ProvingKey, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.ccs == nil {
+		return nil, nil, ErrProverClosed
+	}
+	return p.ccs, p.pk, nil
+}
+
+// NbConstraints returns the number of constraints of the circuit, 0 once
+// closed
+func (p *Prover) NbConstraints() int {
+	ccs, _, err := p.compiled()
+	if err != nil {
+		return 0
+	}
+	return ccs.GetNbConstraints()
+}
+
+// MemoryEstimate returns an estimate of the memory retained by the
+// constraint system and the proving key, in bytes, 0 once closed: the curve
+// points of the key, the coefficients and the constraint data of the system.
+// It does not account for the memory of the proofs in flight.
+func (p *Prover) MemoryEstimate() uint64 {
+	ccs, pk, err := p.compiled()
+	if err != nil {
+		return 0
+	}
+	var size uint64
+	if pk != nil {
+		size += uint64(pk.NbG1())*g1AffineSize + uint64(pk.NbG2())*g2AffineSize
+	}
+	if r1cs, ok := ccs.(*csbn254.R1CS); ok {
+		size += uint64(len(r1cs.Coefficients))*fr.Bytes + uint64(len(r1cs.CallData))*4 +
+			uint64(len(r1cs.Instructions))*uint64(unsafe.Sizeof(constraint.PackedInstruction{}))
+	}
+	return size
+}
+
+// sizes of the affine BN254 points of a proving key in memory
+const (
+	g1AffineSize = 2 * fp.Bytes
+	g2AffineSize = 4 * fp.Bytes
+)
+
+// Prove creates the witness of the assignment, proves it and serializes the
+// proof and the public witness
+func (p *Prover) Prove(assignment frontend.Circuit) (*ProveResult, error) {
+	before := ReadAllocStats()
+
+	witness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, fmt.Errorf("witness creation failed: %w", err)
+	}
+	return p.prove(witness, before)
+}
+
+// ProveWitness proves a full witness in gnark binary encoding
+// (witness.MarshalBinary), e.g. precompiled by the issuer of a batch, and
+// serializes the proof and the public witness
+func (p *Prover) ProveWitness(fullWitness []byte) (*ProveResult, error) {
+	before := ReadAllocStats()
+
+	ccs, _, err := p.compiled()
+	if err != nil {
+		return nil, err
+	}
+	// the vector length prefix is trusted by the decoder, check the size
+	// first: nbPublic, nbSecret and the vector length, then the values
+	nbValues := ccs.GetNbPublicVariables() - 1 + ccs.GetNbSecretVariables()
+	if size := 12 + fr.Bytes*nbValues; len(fullWitness) != size {
+		return nil, fmt.Errorf("witness decoding failed: %d bytes, expected %d", len(fullWitness), size)
+	}
+
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.UnmarshalBinary(fullWitness); err != nil {
+		return nil, fmt.Errorf("witness decoding failed: %w", err)
+	}
+	return p.prove(w, before)
+}
+
+// ProveDecoded proves a full witness decoded by the caller, e.g. filled from
+// the inputs of a request without the binary encoding, and serializes the
+// proof and the public witness
+func (p *Prover) ProveDecoded(w witness.Witness) (*ProveResult, error) {
+	before := ReadAllocStats()
+
+	ccs, _, err := p.compiled()
+	if err != nil {
+		return nil, err
+	}
+	values, ok := w.Vector().(fr.Vector)
+	if !ok {
+		return nil, fmt.Errorf("witness decoding failed: not a BN254 witness")
+	}
+	publicWitness, err := w.Public()
+	if err != nil {
+		return nil, err
+	}
+	nbPublic := len(publicWitness.Vector().(fr.Vector))
+	if nbPublic != ccs.GetNbPublicVariables()-1 || len(values)-nbPublic != ccs.GetNbSecretVariables() {
+		return nil, fmt.Errorf("witness decoding failed: %d public and %d secret values, expected %d and %d",
+			nbPublic, len(values)-nbPublic, ccs.GetNbPublicVariables()-1, ccs.GetNbSecretVariables())
+	}
+	return p.prove(w, before)
+}
+
+// prove proves the witness, before are the allocation counters at the start
+// of the job
+func (p *Prover) prove(witness witness.Witness, before AllocStats) (*ProveResult, error) {
+	ccs, pk, err := p.compiled()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	proof, err := groth16.Prove(ccs, pk, witness, p.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("proof generation failed: %w", err)
+	}
+	res := &ProveResult{ProveTime: time.Since(start)}
+
+	publicWitness, err := witness.Public()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	if _, err := proof.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	res.Proof = append([]byte(nil), buf.Bytes()...)
+
+	buf.Reset()
+	if _, err := publicWitness.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	res.PublicWitness = append([]byte(nil), buf.Bytes()...)
+
+	res.Allocs = ReadAllocStats().Sub(before)
+	return res, nil
+}
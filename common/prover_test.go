@@ -0,0 +1,133 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+func TestProver(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prover := NewProver(ccs, pk, backend.WithSolverOptions(solver.WithNbTasks(1)))
+	before := ReadBufferPoolStats()
+	res, err := prover.Prove(&squareCircuit{X: 3, Y: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ProveTime <= 0 || res.Allocs.Bytes == 0 || res.Allocs.Mallocs == 0 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if stats := ReadBufferPoolStats(); stats.Gets != before.Gets+1 {
+		t.Fatalf("expected one pooled buffer, got %+v (before %+v)", stats, before)
+	}
+
+	// the outputs are copies, not views of the pooled buffer
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(res.Proof)); err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publicWitness.UnmarshalBinary(res.PublicWitness); err != nil {
+		t.Fatal(err)
+	}
+	if err := groth16.Verify(proof, vk, publicWitness); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := prover.Prove(&squareCircuit{X: 3, Y: 10}); err == nil {
+		t.Fatal("expected an error for an unsatisfied assignment")
+	}
+}
+
+func TestPutBufferDropsLargeBuffers(t *testing.T) {
+	buf := GetBuffer()
+	buf.Grow(maxPooledBufferSize + 1)
+	PutBuffer(buf)
+
+	// the pool may drop buffers at any GC, only the oversized one must never
+	// come back
+	for range 4 {
+		if b := GetBuffer(); b == buf {
+			t.Fatal("oversized buffer returned to the pool")
+		} else if b.Len() != 0 {
+			t.Fatal("pooled buffer not reset")
+		}
+	}
+}
+
+// goldenSquareProof is the SHA-256 of the proof of squareCircuit{X: 3, Y: 9}
+// with the keys and the proof of the deterministic sources of
+// TestDeterministicProof
+const goldenSquareProof = "c11f2c492df9d57b01eeb40cbcf6a335383a511a1c1483d4882ce2d72efc1a3e"
+
+func TestDeterministicProof(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pk groth16.ProvingKey
+	var vk groth16.VerifyingKey
+	if err := withRandom(DeterministicRandom("setup"), func() (err error) {
+		pk, vk, err = groth16.Setup(ccs)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	prove := func(seed string) *ProveResult {
+		t.Helper()
+		var res *ProveResult
+		if err := withRandom(DeterministicRandom(seed), func() (err error) {
+			res, err = NewProver(ccs, pk).Prove(&squareCircuit{X: 3, Y: 9})
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	res := prove("proof")
+	if again := prove("proof"); !bytes.Equal(res.Proof, again.Proof) {
+		t.Fatal("proofs of the same seed differ")
+	}
+	if other := prove("other"); bytes.Equal(res.Proof, other.Proof) {
+		t.Fatal("proofs of different seeds are equal")
+	}
+	if digest := sha256.Sum256(res.Proof); hex.EncodeToString(digest[:]) != goldenSquareProof {
+		t.Fatalf("proof %x differs from the golden proof", digest)
+	}
+
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(res.Proof)); err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publicWitness.UnmarshalBinary(res.PublicWitness); err != nil {
+		t.Fatal(err)
+	}
+	if err := groth16.Verify(proof, vk, publicWitness); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"time"
+)
+
+// DeterministicRandom returns a random source producing the same stream for
+// the same seed (ChaCha8 keyed with the SHA-256 of the seed), for golden
+// proofs in tests and for the functions taking a random source (RandomBytes,
+// NewUUIDv7). It is not a secure source: a proof made with it leaks the
+// witness to anyone knowing the seed.
+func DeterministicRandom(seed string) io.Reader {
+	return mathrand.NewChaCha8(sha256.Sum256([]byte(seed)))
+}
+
+// RandomBytes returns size bytes read from r, crypto/rand when nil. A short
+// read is an error, never a partially random value.
+func RandomBytes(r io.Reader, size int) ([]byte, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("negative random size %d", size)
+	}
+	if r == nil {
+		r = rand.Reader
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("reading random bytes: %w", err)
+	}
+	return b, nil
+}
+
+// NewUUIDv7 returns a UUID version 7 (RFC 9562) in its canonical form: the
+// unix time of now in milliseconds, then 74 bits read from r (crypto/rand when
+// nil). The ids sort by creation time and do not collide within a
+// millisecond.
+func NewUUIDv7(r io.Reader, now time.Time) (string, error) {
+	b, err := RandomBytes(r, 16)
+	if err != nil {
+		return "", err
+	}
+	ms := uint64(now.UnixMilli())
+	for i := range 6 {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	b[6] = 0x70 | b[6]&0x0f // version 7
+	b[8] = 0x80 | b[8]&0x3f // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// randomMu serializes the work run by withRandom
+var randomMu sync.Mutex
+
+// withRandom runs fn with r as the random source of crypto/rand, so that the
+// Groth16 setup and proofs run by fn, which sample the global
+// crypto/rand.Reader, are reproducible. Code running concurrently with fn
+// reads r too.
+func withRandom(r io.Reader, fn func() error) error {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+
+	reader := rand.Reader
+	rand.Reader = r
+	defer func() { rand.Reader = reader }()
+	return fn()
+}
+
+func TestRandomBytes(t *testing.T) {
+	b, err := RandomBytes(DeterministicRandom("seed"), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := RandomBytes(DeterministicRandom("seed"), 32)
+	if !bytes.Equal(b, again) {
+		t.Fatal("expected the injected source to be read")
+	}
+	if _, err := RandomBytes(bytes.NewReader(make([]byte, 8)), 16); err == nil {
+		t.Fatal("expected a short read to fail")
+	}
+	if _, err := RandomBytes(nil, -1); err == nil {
+		t.Fatal("expected a negative size to fail")
+	}
+}
+
+func TestNewUUIDv7(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	now := time.UnixMilli(1700000000123)
+	first, err := NewUUIDv7(nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := NewUUIDv7(nil, now)
+	later, _ := NewUUIDv7(nil, now.Add(time.Millisecond))
+	if !uuid.MatchString(first) || first == second {
+		t.Fatalf("unexpected ids %s %s", first, second)
+	}
+	if first[:13] != "018bcfe5-687b" || later <= first {
+		t.Fatalf("expected ids sorted by time, got %s then %s", first, later)
+	}
+}
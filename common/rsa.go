@@ -0,0 +1,95 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/emulated/emparams"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// RSAModulus parametrizes the emulated arithmetic for RSA keys of up to 4096
+// bits. The modulus of the key is passed as a variable.
+type RSAModulus = emparams.Mod1e4096
+
+// RSAExponentBits bounds the public exponent accepted by VerifyRS256 (covers
+// the usual 3, 17 and 65537)
+const RSAExponentBits = 17
+
+// sha256DigestInfo is the DER encoded DigestInfo prefix for SHA-256 (RFC 8017)
+var sha256DigestInfo = []byte{
+	0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01,
+	0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20,
+}
+
+// VerifyRS256 verifies an RSASSA-PKCS1-v1_5 signature with SHA-256 of the
+// message. The modulus is given as big-endian bytes (its length is the key
+// size in bytes), the exponent must fit in RSAExponentBits bits.
+func VerifyRS256(api frontend.API, message, modulus []uints.U8, exponent frontend.Variable, signature *emulated.Element[RSAModulus]) error {
+	emLen := len(modulus)
+	if emLen < len(sha256DigestInfo)+32+11 {
+		return fmt.Errorf("RSA modulus too short: %d bytes", emLen)
+	}
+
+	field, err := emulated.NewField[RSAModulus](api)
+	if err != nil {
+		return err
+	}
+
+	n := BytesToRSAElement(api, field, modulus)
+
+	// EM = 0x00 || 0x01 || PS (0xff...) || 0x00 || DigestInfo || H
+	digest, err := SHA256(api, message)
+	if err != nil {
+		return err
+	}
+
+	em := make([]uints.U8, 0, emLen)
+	em = append(em, uints.NewU8(0x00), uints.NewU8(0x01))
+	for range emLen - len(sha256DigestInfo) - len(digest) - 3 {
+		em = append(em, uints.NewU8(0xff))
+	}
+	em = append(em, uints.NewU8(0x00))
+	for _, b := range sha256DigestInfo {
+		em = append(em, uints.NewU8(b))
+	}
+	em = append(em, digest...)
+
+	// signature^exponent mod n, square-and-multiply from the most significant bit
+	expBits := api.ToBinary(exponent, RSAExponentBits)
+	res := field.Select(expBits[RSAExponentBits-1], signature, field.One())
+	for i := RSAExponentBits - 2; i >= 0; i-- {
+		res = field.ModMul(res, res, n)
+		res = field.Select(expBits[i], field.ModMul(res, signature, n), res)
+	}
+
+	field.ModAssertIsEqual(res, BytesToRSAElement(api, field, em), n)
+
+	return nil
+}
+
+// BytesToRSAElement packs big-endian bytes into an RSAModulus element (64-bit
+// little-endian limbs)
+func BytesToRSAElement(api frontend.API, field *emulated.Field[RSAModulus], data []uints.U8) *emulated.Element[RSAModulus] {
+	const bytesPerLimb = 8
+
+	var params RSAModulus
+	if len(data) > int(params.NbLimbs())*bytesPerLimb {
+		panic(fmt.Sprintf("%d bytes do not fit in an RSA element", len(data)))
+	}
+
+	limbs := make([]frontend.Variable, params.NbLimbs())
+	for i := range limbs {
+		limbs[i] = 0
+	}
+
+	// data[len-1] is the least significant byte of limb 0
+	for i := range data {
+		pos := len(data) - 1 - i
+		shift := uint(pos%bytesPerLimb) * 8
+		limbs[pos/bytesPerLimb] = api.Add(limbs[pos/bytesPerLimb], api.Mul(data[i].Val, uint64(1)<<shift))
+	}
+
+	return field.NewElement(limbs)
+}
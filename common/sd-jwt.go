@@ -0,0 +1,326 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// sdAlg is the only digest algorithm of the disclosures the circuits hash
+const sdAlg = "sha-256"
+
+// SDJWT is an SD-JWT VC as wallets store it: the issuer-signed JWT, the
+// disclosures of its selectively disclosable claims and, for a presentation,
+// the key binding JWT. The serialization is
+//
+//	<issuer-signed JWT>~<disclosure>~...~<disclosure>~[<KB-JWT>]
+type SDJWT struct {
+	// JWS is the issuer-signed JWT (protected.payload.signature)
+	JWS         string
+	Disclosures []*Disclosure
+	// KeyBinding is the KB-JWT, empty when the SD-JWT is not presented
+	KeyBinding string
+
+	// payload is the decoded payload of the JWS
+	payload []byte
+	// sd are the digests of the top-level _sd array of the payload
+	sd []string
+}
+
+// Disclosure is a disclosure of an SD-JWT, the base64url encoding of
+// ["salt", "name", value], or of ["salt", value] for an array element
+type Disclosure struct {
+	// Encoded is the base64url disclosure, as hashed for the digest
+	Encoded string
+	// Decoded is the JSON array
+	Decoded []byte
+	Salt    string
+	// Name is the claim name, empty for an array element
+	Name  string
+	Value json.RawMessage
+	// Digest is the base64url SHA-256 of Encoded, as listed by the issuer
+	Digest string
+}
+
+// SDJWTBundle is the CBOR encoding of an SD-JWT stored by a wallet:
+//
+//	{"jwt": text, "disclosures": [* text], ? "kb_jwt": text}
+type SDJWTBundle struct {
+	JWT         string   `cbor:"jwt"`
+	Disclosures []string `cbor:"disclosures"`
+	KeyBinding  string   `cbor:"kb_jwt,omitempty"`
+}
+
+// ParseSDJWT parses the serialization of an SD-JWT, recomputes the digests of
+// the disclosures and checks every disclosure is referenced by the issuer (in
+// the payload or in another disclosure). The JWS signature is not verified.
+func ParseSDJWT(serialization string) (*SDJWT, error) {
+	parts := strings.Split(strings.TrimSpace(serialization), "~")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("sd-jwt: no disclosure separator")
+	}
+	return newSDJWT(parts[0], parts[1:len(parts)-1], parts[len(parts)-1])
+}
+
+// ParseSDJWTCBOR parses an SD-JWT stored as SDJWTBundle, see ParseSDJWT
+func ParseSDJWTCBOR(data []byte) (*SDJWT, error) {
+	var bundle SDJWTBundle
+	if err := cbor.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("sd-jwt: %w", err)
+	}
+	return newSDJWT(bundle.JWT, bundle.Disclosures, bundle.KeyBinding)
+}
+
+func newSDJWT(jws string, disclosures []string, keyBinding string) (*SDJWT, error) {
+	s := &SDJWT{JWS: jws, KeyBinding: keyBinding}
+
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("sd-jwt: expected 3 JWS parts, got %d", len(parts))
+	}
+	var err error
+	if s.payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, fmt.Errorf("sd-jwt: payload: %w", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(s.payload, &payload); err != nil {
+		return nil, fmt.Errorf("sd-jwt: payload: %w", err)
+	}
+	if alg, ok := payload["_sd_alg"]; ok && alg != sdAlg {
+		return nil, fmt.Errorf("sd-jwt: unsupported _sd_alg %v", alg)
+	}
+	s.sd = sdDigests(payload["_sd"])
+
+	// digests listed by the issuer, in the payload and in the disclosed values
+	referenced := map[string]bool{}
+	collectDigests(payload, referenced)
+	for i, encoded := range disclosures {
+		d, err := ParseDisclosure(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("sd-jwt: disclosure %d: %w", i, err)
+		}
+		if slices.ContainsFunc(s.Disclosures, func(other *Disclosure) bool { return other.Digest == d.Digest }) {
+			return nil, fmt.Errorf("sd-jwt: disclosure %d is repeated", i)
+		}
+		var value any
+		json.Unmarshal(d.Value, &value)
+		collectDigests(value, referenced)
+		s.Disclosures = append(s.Disclosures, d)
+	}
+	for i, d := range s.Disclosures {
+		if !referenced[d.Digest] {
+			return nil, fmt.Errorf("sd-jwt: disclosure %d (digest %s) is not referenced by the issuer", i, d.Digest)
+		}
+	}
+	return s, nil
+}
+
+// ParseDisclosure decodes a base64url disclosure and computes its digest
+func ParseDisclosure(encoded string) (*Disclosure, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var elements []json.RawMessage
+	if err := json.Unmarshal(decoded, &elements); err != nil {
+		return nil, fmt.Errorf("not a JSON array: %w", err)
+	}
+
+	digest := sha256.Sum256([]byte(encoded))
+	d := &Disclosure{
+		Encoded: encoded,
+		Decoded: decoded,
+		Digest:  base64.RawURLEncoding.EncodeToString(digest[:]),
+	}
+	switch len(elements) {
+	case 2:
+		d.Value = elements[1]
+	case 3:
+		if err := json.Unmarshal(elements[1], &d.Name); err != nil {
+			return nil, fmt.Errorf("claim name: %w", err)
+		}
+		if d.Name == "_sd" || d.Name == "..." {
+			return nil, fmt.Errorf("reserved claim name %q", d.Name)
+		}
+		d.Value = elements[2]
+	default:
+		return nil, fmt.Errorf("expected 2 or 3 elements, got %d", len(elements))
+	}
+	if err := json.Unmarshal(elements[0], &d.Salt); err != nil {
+		return nil, fmt.Errorf("salt: %w", err)
+	}
+	return d, nil
+}
+
+// sdDigests returns the digests of an _sd array
+func sdDigests(sd any) []string {
+	list, _ := sd.([]any)
+	digests := make([]string, 0, len(list))
+	for _, digest := range list {
+		if digest, ok := digest.(string); ok {
+			digests = append(digests, digest)
+		}
+	}
+	return digests
+}
+
+// collectDigests adds the digests of the _sd arrays and of the array
+// elements ({"...": digest}) of a decoded JSON value
+func collectDigests(v any, digests map[string]bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, digest := range sdDigests(v["_sd"]) {
+			digests[digest] = true
+		}
+		if digest, ok := v["..."].(string); ok && len(v) == 1 {
+			digests[digest] = true
+		}
+		for name, member := range v {
+			if name != "_sd" {
+				collectDigests(member, digests)
+			}
+		}
+	case []any:
+		for _, element := range v {
+			collectDigests(element, digests)
+		}
+	}
+}
+
+// String returns the serialization of the SD-JWT
+func (s *SDJWT) String() string {
+	var b strings.Builder
+	b.WriteString(s.JWS)
+	b.WriteByte('~')
+	for _, d := range s.Disclosures {
+		b.WriteString(d.Encoded)
+		b.WriteByte('~')
+	}
+	b.WriteString(s.KeyBinding)
+	return b.String()
+}
+
+// EncodeCBOR returns the SD-JWT as SDJWTBundle
+func (s *SDJWT) EncodeCBOR() ([]byte, error) {
+	bundle := SDJWTBundle{JWT: s.JWS, Disclosures: make([]string, len(s.Disclosures)), KeyBinding: s.KeyBinding}
+	for i, d := range s.Disclosures {
+		bundle.Disclosures[i] = d.Encoded
+	}
+	return cbor.Marshal(bundle)
+}
+
+// Select returns the disclosures a proof on the top-level claims needs, by
+// claim name: none for the claims signed in clear in the payload, the
+// disclosure listed in the top-level _sd array for the others. It fails when
+// a claim is neither in the payload nor disclosed.
+func (s *SDJWT) Select(claims []string) (map[string]*Disclosure, error) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(s.payload, &payload); err != nil {
+		return nil, fmt.Errorf("sd-jwt: payload: %w", err)
+	}
+
+	selected := map[string]*Disclosure{}
+	for _, name := range claims {
+		if _, ok := payload[name]; ok {
+			continue
+		}
+		i := slices.IndexFunc(s.Disclosures, func(d *Disclosure) bool {
+			return d.Name == name && slices.Contains(s.sd, d.Digest)
+		})
+		if i == -1 {
+			return nil, fmt.Errorf("sd-jwt: claim %q is neither in the payload nor disclosed", name)
+		}
+		selected[name] = s.Disclosures[i]
+	}
+	return selected, nil
+}
+
+// DisclosurePosition locates a selectively disclosed claim for the circuits:
+// the digest of its disclosure in the signed payload, and the claim in the
+// decoded disclosure
+type DisclosurePosition struct {
+	Disclosure *Disclosure
+	// Digest is the quoted digest in the payload (Value), aligned to
+	// base64url groups; ValuePosition is the digest past the opening quote
+	Digest *ClaimPosition
+	// NamePosition is the offset of the quoted name in Disclosure.Decoded,
+	// ValuePosition of the value, past the opening quote for string values
+	// (both of the value for an array element)
+	NamePosition  int
+	ValuePosition int
+}
+
+// findDisclosure locates the disclosure d of the payload, given as decoded
+// JSON and its base64url encoding b64
+func findDisclosure(payload []byte, b64 string, d *Disclosure) (*DisclosurePosition, error) {
+	quoted := []byte(`"` + d.Digest + `"`)
+	start := bytes.Index(payload, quoted)
+	if start == -1 {
+		return nil, fmt.Errorf("digest %s not found", d.Digest)
+	}
+	a, err := AlignClaim(len(payload), start, start+len(quoted))
+	if err != nil {
+		return nil, err
+	}
+	if a.B64End > len(b64) {
+		return nil, fmt.Errorf("digest %s: base64url encoding too short", d.Digest)
+	}
+
+	// ["salt", "name", value]: the name and the value follow the salt
+	dec := json.NewDecoder(bytes.NewReader(d.Decoded))
+	dec.Token()
+	var salt, name json.RawMessage
+	if err := dec.Decode(&salt); err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(&name); err != nil {
+		return nil, err
+	}
+	namePosition := int(dec.InputOffset()) - len(name)
+	valuePosition := namePosition
+	if d.Name != "" {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		valuePosition = int(dec.InputOffset()) - len(value)
+	}
+	if d.Decoded[valuePosition] == '"' {
+		valuePosition++
+	}
+
+	return &DisclosurePosition{
+		Disclosure: d,
+		Digest: &ClaimPosition{
+			B64Alignment:  *a,
+			B64:           b64[a.B64Start:a.B64End],
+			Segment:       payload[a.Start:a.End],
+			ValuePosition: a.Offset + 1,
+			Value:         quoted,
+		},
+		NamePosition:  namePosition,
+		ValuePosition: valuePosition,
+	}, nil
+}
+
+// validate checks the disclosure position against the encoded payload b64
+func (p *DisclosurePosition) validate(b64 string) error {
+	if err := p.Digest.validate(b64); err != nil {
+		return fmt.Errorf("digest: %w", err)
+	}
+	d, err := ParseDisclosure(p.Disclosure.Encoded)
+	if err != nil || d.Digest != p.Disclosure.Digest {
+		return fmt.Errorf("digest does not match the disclosure")
+	}
+	value := bytes.Trim(d.Value, `"`)
+	if p.ValuePosition < 0 || p.ValuePosition > len(d.Decoded) || !bytes.HasPrefix(d.Decoded[p.ValuePosition:], value) {
+		return fmt.Errorf("value not found at %d", p.ValuePosition)
+	}
+	return nil
+}
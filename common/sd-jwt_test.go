@@ -0,0 +1,175 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func mockDisclosure(t *testing.T, elements ...any) string {
+	t.Helper()
+	data, err := json.Marshal(elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// mockSDJWT returns an SD-JWT with birthdate and given_name selectively
+// disclosable, age_over_18 in clear and a disclosed nationality array element
+func mockSDJWT(t *testing.T) (string, []string) {
+	t.Helper()
+	disclosures := []string{
+		mockDisclosure(t, "2GLC42sKQveCfGfryNRN9w", "birthdate", "2000-01-31"),
+		mockDisclosure(t, "eluV5Og3gSNII8EYnsxA_A", "given_name", "Alice"),
+		mockDisclosure(t, "6Ij7tM-a5iVPGboS5tmvVA", "DE"),
+	}
+	digests := make([]string, len(disclosures))
+	for i, encoded := range disclosures {
+		d, err := ParseDisclosure(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests[i] = d.Digest
+	}
+
+	payload, _ := json.Marshal(map[string]any{
+		"_sd":           digests[:2],
+		"_sd_alg":       "sha-256",
+		"age_over_18":   true,
+		"iss":           "https://issuer.example",
+		"nationalities": []any{map[string]string{"...": digests[2]}},
+	})
+	jws := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"dc+sd-jwt"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte("signature"))
+	return jws + "~" + strings.Join(disclosures, "~") + "~", disclosures
+}
+
+func TestParseDisclosure(t *testing.T) {
+	// example of the SD-JWT specification
+	d, err := ParseDisclosure("WyI2cU1RdlJMNWhhaiIsICJmYW1pbHlfbmFtZSIsICJNw7ZiaXVzIl0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Salt != "6qMQvRL5haj" || d.Name != "family_name" || string(d.Value) != `"Möbius"` {
+		t.Fatalf("unexpected disclosure %+v", d)
+	}
+	if d.Digest != "uutlBuYeMDyjLLTpf6Jxi7yNkEF35jdyWMn9U7b_RYY" {
+		t.Fatalf("unexpected digest %s", d.Digest)
+	}
+
+	for _, encoded := range []string{
+		mockDisclosure(t, "salt"),
+		mockDisclosure(t, "salt", "_sd", "x"),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"salt":"x"}`)),
+	} {
+		if _, err := ParseDisclosure(encoded); err == nil {
+			t.Errorf("expected an error for %s", encoded)
+		}
+	}
+}
+
+func TestParseSDJWT(t *testing.T) {
+	serialization, disclosures := mockSDJWT(t)
+
+	sd, err := ParseSDJWT(serialization)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sd.Disclosures) != 3 || sd.KeyBinding != "" || sd.String() != serialization {
+		t.Fatalf("unexpected SD-JWT %+v", sd)
+	}
+
+	// the wallet storage format
+	data, err := sd.EncodeCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := ParseSDJWTCBOR(data)
+	if err != nil || stored.String() != serialization {
+		t.Fatalf("unexpected SD-JWT from CBOR %v: %v", stored, err)
+	}
+
+	// presented with a key binding JWT
+	if sd, err := ParseSDJWT(serialization + "kb.jwt.sig"); err != nil || sd.KeyBinding != "kb.jwt.sig" {
+		t.Fatalf("unexpected KB-JWT: %v", err)
+	}
+
+	jws := serialization[:strings.Index(serialization, "~")]
+	for name, invalid := range map[string]string{
+		"no separator":   jws,
+		"unreferenced":   serialization + mockDisclosure(t, "salt", "family_name", "Doe") + "~",
+		"repeated":       serialization + disclosures[0] + "~",
+		"empty":          jws + "~~",
+		"not a JWS":      "header.payload~",
+		"_sd_alg":        strings.Replace(serialization, jws, jws[:strings.Index(jws, ".")]+"."+base64.RawURLEncoding.EncodeToString([]byte(`{"_sd_alg":"sha-512"}`))+".sig", 1),
+		"disclosure b64": jws + "~!!~",
+	} {
+		if _, err := ParseSDJWT(invalid); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSDJWTSelect(t *testing.T) {
+	serialization, _ := mockSDJWT(t)
+	sd, err := ParseSDJWT(serialization)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selected, err := sd.Select([]string{"birthdate", "age_over_18"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 1 || selected["birthdate"] == nil || string(selected["birthdate"].Value) != `"2000-01-31"` {
+		t.Fatalf("expected the birthdate disclosure only, got %v", selected)
+	}
+	if _, err := sd.Select([]string{"family_name"}); err == nil {
+		t.Fatal("expected an error for a claim neither in the payload nor disclosed")
+	}
+}
+
+func TestPreprocessorSDJWT(t *testing.T) {
+	serialization, _ := mockSDJWT(t)
+	artifacts := CredentialArtifacts{SDJWT: serialization}
+	p := &Preprocessor{Claims: []string{"birthdate", "given_name", "age_over_18"}}
+
+	pos, err := p.Process(artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pos.Claims) != 1 || string(pos.Claims["age_over_18"].Value) != "true" || len(pos.Disclosures) != 2 {
+		t.Fatalf("unexpected positions %+v", pos)
+	}
+
+	// the digest is found in the aligned payload segment, the claim in the
+	// decoded disclosure
+	birthdate := pos.Disclosures["birthdate"]
+	digest := birthdate.Digest
+	if !strings.HasPrefix(pos.PayloadB64[digest.B64Start:], digest.B64) || digest.B64Start%4 != 0 {
+		t.Fatal("digest substring not at its position")
+	}
+	if got := string(digest.Segment[digest.ValuePosition:]); !strings.HasPrefix(got, birthdate.Disclosure.Digest+`"`) {
+		t.Fatalf("unexpected digest position: %q", got)
+	}
+	decoded := string(birthdate.Disclosure.Decoded)
+	if !strings.HasPrefix(decoded[birthdate.NamePosition:], `"birthdate",`) || !strings.HasPrefix(decoded[birthdate.ValuePosition:], `2000-01-31"`) {
+		t.Fatalf("unexpected disclosure positions %d %d in %s", birthdate.NamePosition, birthdate.ValuePosition, decoded)
+	}
+
+	birthdate.ValuePosition++
+	if err := pos.Validate(artifacts); err == nil {
+		t.Fatal("expected an error for a wrong value position")
+	}
+
+	p.Claims = []string{"family_name"}
+	if _, err := p.Process(artifacts); err == nil {
+		t.Fatal("expected an error for a missing claim")
+	}
+	if _, err := p.Process(CredentialArtifacts{SDJWT: serialization, JWS: "a.b.c"}); err == nil {
+		t.Fatal("expected an error for both a JWS and an SD-JWT")
+	}
+}
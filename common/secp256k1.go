@@ -0,0 +1,129 @@
+package common
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_emulated"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common/curves"
+	"github.com/mynextid/eudi-zk/x509pos"
+)
+
+// VerifyES256K verifies an ES256K (ECDSA secp256k1 with SHA-256, RFC 8812)
+// signature of the message. Like VerifyES256 it computes the digest of the
+// message.
+func VerifyES256K(api frontend.API, message []uints.U8, publicKey curves.Secp256k1PublicKey, signature curves.Secp256k1Signature) error {
+	messageHash, err := SHA256(api, message)
+	if err != nil {
+		return err
+	}
+
+	mHash, err := sha256ToScalar[curves.Secp256k1Fr](api, messageHash)
+	if err != nil {
+		return err
+	}
+
+	// signature verification assertion is done in-circuit
+	publicKey.Verify(api, sw_emulated.GetCurveParams[curves.Secp256k1Fp](), mHash, &signature)
+	return nil
+}
+
+// ComparePublicKeysSecp256k1 is ComparePublicKeys for a secp256k1 key: it
+// compares the coordinates with an uncompressed key (0x04 || X || Y)
+func ComparePublicKeysSecp256k1(api frontend.API, PubKeyX, PubKeyY emulated.Element[curves.Secp256k1Fp], PubKeyBytes []uints.U8) {
+	AssertBytesEqual(api, secp256k1PublicKeyBytes(api, PubKeyX, PubKeyY), PubKeyBytes, "secp256k1 public key bytes")
+}
+
+// PublicKeyDigestSecp256k1 is PublicKeyDigest for a secp256k1 key: SHA-256
+// of the uncompressed key
+func PublicKeyDigestSecp256k1(api frontend.API, PubKeyX, PubKeyY emulated.Element[curves.Secp256k1Fp]) ([]uints.U8, error) {
+	return SHA256(api, secp256k1PublicKeyBytes(api, PubKeyX, PubKeyY))
+}
+
+// secp256k1PublicKeyBytes returns the uncompressed key, 0x04 || X || Y
+func secp256k1PublicKeyBytes(api frontend.API, x, y emulated.Element[curves.Secp256k1Fp]) []uints.U8 {
+	pubKeyBytes := make([]uints.U8, 0, 65)
+	pubKeyBytes = append(pubKeyBytes, uints.NewU8(4))
+	pubKeyBytes = append(pubKeyBytes, ElementToBytes32(api, x)...)
+	return append(pubKeyBytes, ElementToBytes32(api, y)...)
+}
+
+// ============================================================================
+// OFF-CIRCUIT KEY CONVERSION
+// ============================================================================
+
+// ParseSecp256k1PublicKey returns the coordinates of a SEC1 encoded secp256k1
+// public key, uncompressed (65 bytes, 0x04 prefix) or compressed (33 bytes,
+// 0x02 or 0x03 prefix) as wallets export them. The point must be on the curve.
+func ParseSecp256k1PublicKey(key []byte) (x, y *big.Int, err error) {
+	p := ecc.SECP256K1.BaseField()
+	switch {
+	case len(key) == 65 && key[0] == 0x04:
+		x, y = new(big.Int).SetBytes(key[1:33]), new(big.Int).SetBytes(key[33:])
+	case len(key) == 33 && (key[0] == 0x02 || key[0] == 0x03):
+		x = new(big.Int).SetBytes(key[1:])
+		if x.Cmp(p) >= 0 {
+			return nil, nil, fmt.Errorf("secp256k1: invalid x coordinate")
+		}
+		y = new(big.Int).ModSqrt(secp256k1Rhs(x), p)
+		if y == nil {
+			return nil, nil, fmt.Errorf("secp256k1: point not on the curve")
+		}
+		if y.Bit(0) != uint(key[0]&1) {
+			y.Sub(p, y)
+		}
+	default:
+		return nil, nil, fmt.Errorf("secp256k1: invalid SEC1 public key of %d bytes", len(key))
+	}
+
+	if x.Cmp(p) >= 0 || y.Cmp(p) >= 0 || new(big.Int).Exp(y, big.NewInt(2), p).Cmp(secp256k1Rhs(x)) != 0 {
+		return nil, nil, fmt.Errorf("secp256k1: point not on the curve")
+	}
+	return x, y, nil
+}
+
+// secp256k1Rhs returns x^3 + 7 mod p
+func secp256k1Rhs(x *big.Int) *big.Int {
+	p := ecc.SECP256K1.BaseField()
+	rhs := new(big.Int).Exp(x, big.NewInt(3), p)
+	rhs.Add(rhs, big.NewInt(7))
+	return rhs.Mod(rhs, p)
+}
+
+// MarshalSecp256k1PublicKey returns the uncompressed SEC1 encoding of a
+// secp256k1 public key, the bytes ComparePublicKeysSecp256k1 compares and
+// PublicKeyDigestSecp256k1 hashes
+func MarshalSecp256k1PublicKey(x, y *big.Int) []byte {
+	key := make([]byte, 65)
+	key[0] = 0x04
+	x.FillBytes(key[1:33])
+	y.FillBytes(key[33:])
+	return key
+}
+
+// Secp256k1SubjectPublicKey returns the secp256k1 subject public key of a DER
+// certificate. crypto/x509 does not parse certificates with secp256k1 keys,
+// the key is located with x509pos.
+func Secp256k1SubjectPublicKey(certDER []byte) (x, y *big.Int, err error) {
+	cert, err := x509pos.Parse(certDER)
+	if err != nil {
+		return nil, nil, err
+	}
+	curve, err := cert.PublicKeyCurve(certDER)
+	if err != nil {
+		return nil, nil, err
+	}
+	if curve != x509pos.CurveSecp256k1 {
+		return nil, nil, fmt.Errorf("subject public key is %s, not secp256k1", curve)
+	}
+	// BIT STRING content: unused bits, then the SEC1 key
+	bitString := cert.PublicKey.Contents(certDER)
+	if len(bitString) < 2 || bitString[0] != 0 {
+		return nil, nil, fmt.Errorf("subject public key: invalid BIT STRING")
+	}
+	return ParseSecp256k1PublicKey(bitString[1:])
+}
@@ -0,0 +1,101 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	secp256k1ecdsa "github.com/consensys/gnark-crypto/ecc/secp256k1/ecdsa"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common/curves"
+)
+
+func TestParseSecp256k1PublicKey(t *testing.T) {
+	key, err := secp256k1ecdsa.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := key.PublicKey.A.X.BigInt(new(big.Int)), key.PublicKey.A.Y.BigInt(new(big.Int))
+
+	uncompressed := MarshalSecp256k1PublicKey(x, y)
+	compressed := append([]byte{0x02 | byte(y.Bit(0))}, uncompressed[1:33]...)
+	for _, encoded := range [][]byte{uncompressed, compressed} {
+		px, py, err := ParseSecp256k1PublicKey(encoded)
+		if err != nil {
+			t.Fatalf("%d bytes key: %v", len(encoded), err)
+		}
+		if px.Cmp(x) != 0 || py.Cmp(y) != 0 {
+			t.Errorf("%d bytes key: coordinates do not match", len(encoded))
+		}
+	}
+
+	// a point off the curve and a wrong prefix
+	offCurve := MarshalSecp256k1PublicKey(x, new(big.Int).Add(y, big.NewInt(1)))
+	wrongPrefix := append([]byte{0x04}, compressed[1:]...)
+	for _, encoded := range [][]byte{offCurve, wrongPrefix, uncompressed[:64]} {
+		if _, _, err := ParseSecp256k1PublicKey(encoded); err == nil {
+			t.Errorf("%x: expected an error", encoded)
+		}
+	}
+}
+
+// es256kCircuit verifies an ES256K signature of a message
+type es256kCircuit struct {
+	Message []uints.U8
+	X, Y    emulated.Element[curves.Secp256k1Fp]
+	R, S    emulated.Element[curves.Secp256k1Fr]
+	Digest  []uints.U8
+}
+
+func (c *es256kCircuit) Define(api frontend.API) error {
+	digest, err := PublicKeyDigestSecp256k1(api, c.X, c.Y)
+	if err != nil {
+		return err
+	}
+	AssertBytesEqual(api, digest, c.Digest, "public key digest")
+
+	publicKey := curves.NewSecp256k1PublicKey(c.X, c.Y)
+	signature := curves.NewSecp256k1Signature(c.R, c.S)
+	return VerifyES256K(api, c.Message, publicKey, signature)
+}
+
+func TestVerifyES256K(t *testing.T) {
+	key, err := secp256k1ecdsa.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := key.PublicKey.A.X.BigInt(new(big.Int)), key.PublicKey.A.Y.BigInt(new(big.Int))
+	digest := sha256.Sum256(MarshalSecp256k1PublicKey(x, y))
+
+	message := []byte("verifier challenge")
+	sig, err := key.Sign(message, sha256.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		message []byte
+		valid   bool
+	}{
+		{"signed message", message, true},
+		{"other message", []byte("verifier challengf"), false},
+	} {
+		circuit := &es256kCircuit{Message: make([]uints.U8, len(tt.message)), Digest: make([]uints.U8, 32)}
+		assignment := &es256kCircuit{
+			Message: BytesToU8Array(tt.message),
+			X:       emulated.ValueOf[curves.Secp256k1Fp](x),
+			Y:       emulated.ValueOf[curves.Secp256k1Fp](y),
+			R:       emulated.ValueOf[curves.Secp256k1Fr](new(big.Int).SetBytes(sig[:32])),
+			S:       emulated.ValueOf[curves.Secp256k1Fr](new(big.Int).SetBytes(sig[32:])),
+			Digest:  BytesToU8Array(digest[:]),
+		}
+		err := CheckWitness(circuit, assignment)
+		if tt.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
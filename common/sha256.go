@@ -2,6 +2,7 @@ package common
 
 import (
 	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
 	"github.com/consensys/gnark/std/hash/sha2"
 	"github.com/consensys/gnark/std/math/uints"
 )
@@ -9,11 +10,12 @@ import (
 // Computes SHA256 digest of the payload
 func SHA256(api frontend.API, payload []uints.U8) ([]uints.U8, error) {
 
-	// Instantiate SHA256
-	hash, err := sha2.New(api)
+	// Take a SHA256 hasher of the circuit
+	hash, release, err := NewSHA256(api)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
 	// Compute hash of private payload
 	hash.Write(payload)
@@ -21,3 +23,90 @@ func SHA256(api frontend.API, payload []uints.U8) ([]uints.U8, error) {
 
 	return digest, nil
 }
+
+// SHA256Prefix computes the SHA-256 digest of the first length bytes of a
+// zero padded buffer. The padding is asserted to be zero, so the bytes past
+// length cannot be read by other constraints without being digested.
+func SHA256Prefix(api frontend.API, data []uints.U8, length frontend.Variable) ([]uints.U8, error) {
+	return NewLengthedBytes(api, data, length).SHA256(api)
+}
+
+// keyValueStore is the key-value store of the gnark builders, where the std
+// gadgets cache their state per circuit
+type keyValueStore interface {
+	SetKeyValue(key, value any)
+	GetKeyValue(key any) any
+}
+
+// hasherPoolKey is the key of the hasherPool of a circuit
+type hasherPoolKey struct{}
+
+// hasherPool is the pool of the SHA-256 hashers of a circuit, in the
+// key-value store of its builder
+type hasherPool struct {
+	free []hash.BinaryFixedLengthHasher
+	// disabled makes every NewSHA256 instantiate a hasher, to measure the
+	// reuse (ProfileConstraints)
+	disabled bool
+	stats    HasherStats
+}
+
+// HasherStats are the statistics of the SHA-256 hashers of a circuit
+type HasherStats struct {
+	// Digests is the number of hashers taken with NewSHA256
+	Digests int
+	// Instances is the number of sha2 instances the digests were computed on
+	Instances int
+	// Saved is the number of constraints saved by the reuse of the instances,
+	// set by ProfileConstraints
+	Saved int
+}
+
+// circuitHashers returns the hasher pool of the circuit of api, nil when the
+// builder has no key-value store
+func circuitHashers(api frontend.API) *hasherPool {
+	kv, ok := api.(keyValueStore)
+	if !ok {
+		return nil
+	}
+	if pool, ok := kv.GetKeyValue(hasherPoolKey{}).(*hasherPool); ok {
+		return pool
+	}
+	pool := &hasherPool{}
+	kv.SetKeyValue(hasherPoolKey{}, pool)
+	return pool
+}
+
+// NewSHA256 returns a SHA-256 hasher of the circuit and the function that
+// returns it to the circuit once the digest is computed. The hashers are
+// reset and reused instead of instantiating sha2 for every digest of the
+// circuit; a hasher must not be used after its release.
+func NewSHA256(api frontend.API) (h hash.BinaryFixedLengthHasher, release func(), err error) {
+	pool := circuitHashers(api)
+	if pool == nil {
+		h, err := sha2.New(api)
+		return h, func() {}, err
+	}
+	pool.stats.Digests++
+	if n := len(pool.free); n > 0 && !pool.disabled {
+		h = pool.free[n-1]
+		pool.free = pool.free[:n-1]
+	} else {
+		if h, err = sha2.New(api); err != nil {
+			return nil, nil, err
+		}
+		pool.stats.Instances++
+	}
+	released := false
+	return h, func() {
+		if released {
+			return
+		}
+		released = true
+		// gnark's sha2 hasher resets, though not part of its interface
+		if r, ok := h.(interface{ Reset() }); ok {
+			r.Reset()
+			pool.free = append(pool.free, h)
+		}
+	}, nil
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// digestsCircuit hashes each message, the last one with a variable length
+type digestsCircuit struct {
+	Messages [][]uints.U8
+	Len      frontend.Variable
+	Digests  [][]uints.U8 `gnark:",public"`
+}
+
+func (c *digestsCircuit) Define(api frontend.API) error {
+	for i, m := range c.Messages {
+		var digest []uints.U8
+		if i == len(c.Messages)-1 {
+			h, release, err := NewSHA256(api)
+			if err != nil {
+				return err
+			}
+			h.Write(m)
+			digest = h.FixedLengthSum(c.Len)
+			release()
+		} else {
+			var err error
+			if digest, err = SHA256(api, m); err != nil {
+				return err
+			}
+		}
+		AssertBytesEqual(api, digest, c.Digests[i], "digest %d", i)
+	}
+	return nil
+}
+
+func newDigestsCircuit(sizes ...int) *digestsCircuit {
+	c := &digestsCircuit{}
+	for _, size := range sizes {
+		c.Messages = append(c.Messages, make([]uints.U8, size))
+		c.Digests = append(c.Digests, make([]uints.U8, 32))
+	}
+	return c
+}
+
+func TestSHA256Reuse(t *testing.T) {
+	messages := [][]byte{[]byte("first message"), []byte("second"), []byte("third, zero padded\x00\x00\x00")}
+	assignment := &digestsCircuit{Len: len(messages[2]) - 3}
+	for i, m := range messages {
+		digest := sha256.Sum256(m)
+		if i == len(messages)-1 {
+			digest = sha256.Sum256(m[:len(m)-3])
+		}
+		assignment.Messages = append(assignment.Messages, BytesToU8Array(m))
+		assignment.Digests = append(assignment.Digests, BytesToU8Array(digest[:]))
+	}
+	circuit := newDigestsCircuit(len(messages[0]), len(messages[1]), len(messages[2]))
+
+	// a reused hasher starts from an empty message
+	if err := CheckWitness(circuit, assignment); err != nil {
+		t.Fatalf("expected the witness to satisfy the circuit: %v", err)
+	}
+	assignment.Digests[1] = assignment.Digests[0]
+	if err := CheckWitness(circuit, assignment); err == nil {
+		t.Fatal("expected an error for the digest of another message")
+	}
+
+	p, err := ProfileConstraints(circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SHA256.Digests != 3 || p.SHA256.Instances != 1 {
+		t.Fatalf("expected 3 digests on 1 instance, got %+v", p.SHA256)
+	}
+	if p.SHA256.Saved < 0 {
+		t.Fatalf("the reuse added %d constraints", -p.SHA256.Saved)
+	}
+	t.Logf("sha256 hashers: %+v", p.SHA256)
+}
@@ -0,0 +1,117 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/solidity"
+)
+
+// SolidityOptions configures ExportSolidity
+type SolidityOptions struct {
+	// CircuitID identifies the circuit the verifier is generated for,
+	// e.g. "eudi-vc/pop-batch/v1"
+	CircuitID string
+
+	// BindMetadata appends a BoundVerifier contract to the generated verifier.
+	// BoundVerifier holds the verifying key hash and the circuit id as
+	// constants and rejects proofs submitted with other metadata, so a proof
+	// cannot be sent to the verifier contract of another circuit.
+	BindMetadata bool
+}
+
+// VerifyingKeyHash returns the SHA-256 of the serialized verifying key
+func VerifyingKeyHash(vk groth16.VerifyingKey) ([32]byte, error) {
+	h := sha256.New()
+	if _, err := vk.WriteTo(h); err != nil {
+		return [32]byte{}, fmt.Errorf("failed to serialize the verifying key: %w", err)
+	}
+	return [32]byte(h.Sum(nil)), nil
+}
+
+// CircuitIDHash returns the SHA-256 of the circuit id, as stored in the
+// BoundVerifier contract
+func CircuitIDHash(circuitID string) [32]byte {
+	return sha256.Sum256([]byte(circuitID))
+}
+
+// ExportSolidity writes the Solidity verifier of vk to w. With
+// opts.BindMetadata the verifier is followed by a BoundVerifier contract, see
+// SolidityOptions.
+func ExportSolidity(vk groth16.VerifyingKey, w io.Writer, opts SolidityOptions, exportOpts ...solidity.ExportOption) error {
+	if opts.BindMetadata && (opts.CircuitID == "" || strings.ContainsAny(opts.CircuitID, "\r\n")) {
+		return fmt.Errorf("invalid circuit id %q", opts.CircuitID)
+	}
+
+	if err := vk.ExportSolidity(w, exportOpts...); err != nil {
+		return fmt.Errorf("failed to export the verifier: %w", err)
+	}
+	if !opts.BindMetadata {
+		return nil
+	}
+
+	vkHash, err := VerifyingKeyHash(vk)
+	if err != nil {
+		return err
+	}
+	circuitIDHash := CircuitIDHash(opts.CircuitID)
+
+	return boundVerifierTemplate.Execute(w, struct {
+		CircuitID     string
+		VKHash        string
+		CircuitIDHash string
+	}{
+		CircuitID:     opts.CircuitID,
+		VKHash:        hex.EncodeToString(vkHash[:]),
+		CircuitIDHash: hex.EncodeToString(circuitIDHash[:]),
+	})
+}
+
+var boundVerifierTemplate = template.Must(template.New("bound-verifier").Parse(`
+/// @title Verifier bound to a verifying key and a circuit
+/// @notice Checks the verifying key hash and the circuit id provided with the
+/// proof before verifying it, preventing proof/circuit mix-ups when several
+/// verifier contracts are deployed.
+contract BoundVerifier is Verifier {
+    /// SHA-256 of the serialized verifying key
+    bytes32 public constant VK_HASH = 0x{{ .VKHash }};
+    /// SHA-256 of the circuit id "{{ .CircuitID }}"
+    bytes32 public constant CIRCUIT_ID = 0x{{ .CircuitIDHash }};
+
+    /// The verifying key hash does not match VK_HASH.
+    error VerifyingKeyMismatch();
+    /// The circuit id does not match CIRCUIT_ID.
+    error CircuitMismatch();
+
+    /// Verify a proof together with its metadata.
+    /// @notice There is no return value. If the function does not revert, the
+    /// proof was successfully verified.
+    /// @param vkHash the verifying key hash the proof was generated for.
+    /// @param circuitId the circuit id the proof was generated for.
+    /// @param proofCalldata the ABI encoded call to verifyProof.
+    function verifyProofWithMetadata(
+        bytes32 vkHash,
+        bytes32 circuitId,
+        bytes calldata proofCalldata
+    ) external view {
+        if (vkHash != VK_HASH) {
+            revert VerifyingKeyMismatch();
+        }
+        if (circuitId != CIRCUIT_ID) {
+            revert CircuitMismatch();
+        }
+        if (proofCalldata.length < 4 || bytes4(proofCalldata[:4]) != this.verifyProof.selector) {
+            revert ProofInvalid();
+        }
+        (bool success, ) = address(this).staticcall(proofCalldata);
+        if (!success) {
+            revert ProofInvalid();
+        }
+    }
+}
+`))
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+type squareCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *squareCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	return nil
+}
+
+func TestExportSolidity(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plain bytes.Buffer
+	if err := ExportSolidity(vk, &plain, SolidityOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain.String(), "BoundVerifier") {
+		t.Fatal("BoundVerifier exported without BindMetadata")
+	}
+
+	var bound bytes.Buffer
+	opts := SolidityOptions{CircuitID: "test/square/v1", BindMetadata: true}
+	if err := ExportSolidity(vk, &bound, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	vkHash, err := VerifyingKeyHash(vk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	circuitIDHash := CircuitIDHash(opts.CircuitID)
+	for _, s := range []string{
+		"contract BoundVerifier is Verifier",
+		"VK_HASH = 0x" + hex.EncodeToString(vkHash[:]),
+		"CIRCUIT_ID = 0x" + hex.EncodeToString(circuitIDHash[:]),
+	} {
+		if !strings.Contains(bound.String(), s) {
+			t.Errorf("exported verifier does not contain %q", s)
+		}
+	}
+
+	opts.CircuitID = "multi\nline"
+	if err := ExportSolidity(vk, &bound, opts); err == nil {
+		t.Error("expected an error for an invalid circuit id")
+	}
+}
@@ -0,0 +1,246 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+// CircuitStats are the sizes of a compiled circuit, checked in CI against a
+// StatsBaseline so a refactor multiplying the constraints fails loudly
+type CircuitStats struct {
+	Circuit     string `json:"circuit,omitempty"`
+	Constraints int    `json:"constraints"`
+	// PublicVariables are the public inputs, without the constant wire
+	PublicVariables   int `json:"public_variables"`
+	SecretVariables   int `json:"secret_variables"`
+	InternalVariables int `json:"internal_variables"`
+	// Commitments are the BSB22 commitments of the circuit (api.Commit)
+	Commitments int `json:"commitments"`
+	// VKSize is the size of the verifying key in bytes (compressed), 0 when
+	// the stats were collected without setup
+	VKSize int64 `json:"vk_size"`
+}
+
+// StatsMetrics are the metrics of CircuitStats compared by StatsBaseline, by
+// their JSON name
+var StatsMetrics = []string{"constraints", "public_variables", "secret_variables", "internal_variables", "commitments", "vk_size"}
+
+// metric returns the value of a metric of StatsMetrics
+func (s *CircuitStats) metric(name string) int64 {
+	switch name {
+	case "constraints":
+		return int64(s.Constraints)
+	case "public_variables":
+		return int64(s.PublicVariables)
+	case "secret_variables":
+		return int64(s.SecretVariables)
+	case "internal_variables":
+		return int64(s.InternalVariables)
+	case "commitments":
+		return int64(s.Commitments)
+	case "vk_size":
+		return s.VKSize
+	}
+	panic("unknown circuit metric " + name)
+}
+
+// StatsOf returns the stats of a compiled circuit and of its verifying key,
+// optional
+func StatsOf(circuit string, ccs constraint.ConstraintSystem, vk groth16.VerifyingKey) (*CircuitStats, error) {
+	s := &CircuitStats{
+		Circuit:           circuit,
+		Constraints:       ccs.GetNbConstraints(),
+		PublicVariables:   ccs.GetNbPublicVariables() - 1,
+		SecretVariables:   ccs.GetNbSecretVariables(),
+		InternalVariables: ccs.GetNbInternalVariables(),
+	}
+	if commitments := ccs.GetCommitments(); commitments != nil {
+		s.Commitments = len(commitments.CommitmentIndexes())
+	}
+	if vk != nil {
+		n, err := vk.WriteTo(io.Discard)
+		if err != nil {
+			return nil, err
+		}
+		s.VKSize = n
+	}
+	return s, nil
+}
+
+// CompileStats compiles the circuit (R1CS, BN254) and returns its stats. The
+// verifying key size needs the groth16 setup, run when setup is set
+// (ErrSetupDisabled outside of ModeFull).
+func CompileStats(name string, circuit frontend.Circuit, setup bool) (*CircuitStats, error) {
+	if setup {
+		if err := checkSetup(); err != nil {
+			return nil, err
+		}
+	}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
+	if err != nil {
+		return nil, err
+	}
+	var vk groth16.VerifyingKey
+	if setup {
+		if _, vk, err = groth16.Setup(ccs); err != nil {
+			return nil, err
+		}
+	}
+	return StatsOf(name, ccs, vk)
+}
+
+// String returns the one line summary of the compilation logs
+func (s *CircuitStats) String() string {
+	return fmt.Sprintf("%d constraints, %d public and %d secret variables", s.Constraints, s.PublicVariables, s.SecretVariables)
+}
+
+// WriteTo writes the stats as a table
+func (s *CircuitStats) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	if s.Circuit != "" {
+		fmt.Fprintf(&sb, "circuit %s\n", s.Circuit)
+	}
+	tw := tabwriter.NewWriter(&sb, 0, 8, 2, ' ', tabwriter.AlignRight)
+	for _, name := range StatsMetrics {
+		fmt.Fprintf(tw, "%d\t %s\n", s.metric(name), name)
+	}
+	tw.Flush()
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// ErrStatsRegression is the failure class of a StatsRegressionError
+var ErrStatsRegression = errors.New("circuit stats regression")
+
+// StatsRegression is a metric of a circuit above its allowed value
+type StatsRegression struct {
+	Circuit  string `json:"circuit"`
+	Metric   string `json:"metric"`
+	Baseline int64  `json:"baseline"`
+	Current  int64  `json:"current"`
+	// Allowed is the maximum value the tolerance of the metric allows
+	Allowed int64 `json:"allowed"`
+}
+
+func (r StatsRegression) String() string {
+	return fmt.Sprintf("%s %s: %d, baseline %d (+%.1f%%, at most %d allowed)",
+		r.Circuit, r.Metric, r.Current, r.Baseline, 100*float64(r.Current-r.Baseline)/float64(max(r.Baseline, 1)), r.Allowed)
+}
+
+// StatsRegressionError lists the metrics of a circuit above their baseline
+// with its tolerance
+type StatsRegressionError struct {
+	Regressions []StatsRegression
+}
+
+func (e *StatsRegressionError) Error() string {
+	lines := make([]string, len(e.Regressions))
+	for i, r := range e.Regressions {
+		lines[i] = r.String()
+	}
+	return fmt.Sprintf("%s: %s", ErrStatsRegression, strings.Join(lines, "; "))
+}
+
+// Is matches ErrStatsRegression
+func (e *StatsRegressionError) Is(target error) bool {
+	return target == ErrStatsRegression
+}
+
+// StatsBaseline are the reference stats of the circuits with the allowed
+// growth of their metrics, a JSON file kept in the repository:
+//
+//	{"tolerance": 0.02, "tolerances": {"public_variables": 0},
+//	 "circuits": {"eudi-vc/eudi": {"constraints": 1234567, ...}}}
+//
+// A metric decreasing is not a regression; the baseline is updated
+// (StatsBaseline.Update) to lock the improvement in.
+type StatsBaseline struct {
+	// Tolerance is the allowed relative growth of the metrics, 0.02 for 2%
+	Tolerance float64 `json:"tolerance"`
+	// Tolerances override Tolerance by metric (StatsMetrics)
+	Tolerances map[string]float64       `json:"tolerances,omitempty"`
+	Circuits   map[string]*CircuitStats `json:"circuits"`
+}
+
+// ReadStatsBaseline reads a baseline file
+func ReadStatsBaseline(path string) (*StatsBaseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &StatsBaseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("baseline %s: %w", path, err)
+	}
+	for metric, tolerance := range b.Tolerances {
+		if !slices.Contains(StatsMetrics, metric) || tolerance < 0 {
+			return nil, fmt.Errorf("baseline %s: invalid tolerance %v of metric %q", path, tolerance, metric)
+		}
+	}
+	if b.Tolerance < 0 {
+		return nil, fmt.Errorf("baseline %s: negative tolerance %v", path, b.Tolerance)
+	}
+	return b, nil
+}
+
+// WriteFile writes the baseline, indented for the diffs of the reviews
+func (b *StatsBaseline) WriteFile(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Check compares the stats of a circuit with its baseline. A metric above
+// the baseline and its tolerance is a regression, returned in a
+// *StatsRegressionError; a circuit without baseline is an error too, the
+// baseline is updated when the circuit is added.
+func (b *StatsBaseline) Check(s *CircuitStats) error {
+	baseline, ok := b.Circuits[s.Circuit]
+	if !ok {
+		return fmt.Errorf("no baseline for circuit %q, update the baseline", s.Circuit)
+	}
+	var regressions []StatsRegression
+	for _, metric := range StatsMetrics {
+		tolerance := b.Tolerance
+		if t, ok := b.Tolerances[metric]; ok {
+			tolerance = t
+		}
+		reference, current := baseline.metric(metric), s.metric(metric)
+		if metric == "vk_size" && (reference == 0 || current == 0) {
+			// collected without setup
+			continue
+		}
+		allowed := reference + int64(float64(reference)*tolerance)
+		if current > allowed {
+			regressions = append(regressions, StatsRegression{Circuit: s.Circuit, Metric: metric, Baseline: reference, Current: current, Allowed: allowed})
+		}
+	}
+	if len(regressions) > 0 {
+		return &StatsRegressionError{Regressions: regressions}
+	}
+	return nil
+}
+
+// Update sets the baseline of the circuit to its stats
+func (b *StatsBaseline) Update(s *CircuitStats) {
+	if b.Circuits == nil {
+		b.Circuits = map[string]*CircuitStats{}
+	}
+	updated := *s
+	updated.Circuit = ""
+	b.Circuits[s.Circuit] = &updated
+}
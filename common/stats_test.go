@@ -0,0 +1,52 @@
+package common
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatsBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	b := &StatsBaseline{Tolerance: 0.1, Tolerances: map[string]float64{"public_variables": 0}}
+	b.Update(&CircuitStats{Circuit: "cube", Constraints: 100, PublicVariables: 2, SecretVariables: 10, VKSize: 500})
+	if err := b.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadStatsBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		stats   CircuitStats
+		metrics []string
+	}{
+		{"within tolerance", CircuitStats{Circuit: "cube", Constraints: 110, PublicVariables: 2, SecretVariables: 8, VKSize: 500}, nil},
+		{"without setup", CircuitStats{Circuit: "cube", Constraints: 100, PublicVariables: 2, SecretVariables: 10}, nil},
+		{"constraints", CircuitStats{Circuit: "cube", Constraints: 111, PublicVariables: 2, SecretVariables: 10, VKSize: 500}, []string{"constraints"}},
+		{"public input", CircuitStats{Circuit: "cube", Constraints: 100, PublicVariables: 3, SecretVariables: 10, VKSize: 600}, []string{"public_variables", "vk_size"}},
+	} {
+		err := b.Check(&tc.stats)
+		var regression *StatsRegressionError
+		if tc.metrics == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+			}
+			continue
+		}
+		if !errors.As(err, &regression) || !errors.Is(err, ErrStatsRegression) || len(regression.Regressions) != len(tc.metrics) {
+			t.Errorf("%s: expected regressions of %v, got %v", tc.name, tc.metrics, err)
+			continue
+		}
+		for i, r := range regression.Regressions {
+			if r.Metric != tc.metrics[i] {
+				t.Errorf("%s: expected regressions of %v, got %v", tc.name, tc.metrics, err)
+			}
+		}
+	}
+	if err := b.Check(&CircuitStats{Circuit: "square"}); err == nil || errors.Is(err, ErrStatsRegression) {
+		t.Fatalf("expected an error for a circuit without baseline, got %v", err)
+	}
+}
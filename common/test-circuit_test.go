@@ -0,0 +1,37 @@
+package common
+
+import "testing"
+
+func TestCircuitV2TestEngine(t *testing.T) {
+	t.Setenv(TestEngineEnv, "1")
+
+	t.Chdir(t.TempDir())
+	ccsPath, pkPath, vkPath := "compiled/circuit.ccs", "compiled/proving.key", "compiled/verifying.key"
+	ccs, pk, vk, err := InitCircuit(ccsPath, pkPath, vkPath, true, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ccs != nil || pk != nil || vk != nil || fileExists(pkPath) {
+		t.Fatal("expected no setup with the test engine")
+	}
+
+	opts := &CircuitTestOptions{FailOnError: false}
+	if res := TestCircuitV2(&squareCircuit{X: 3, Y: 9}, nil, nil, nil, opts); !res.Success || res.ProofSize != 0 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if res := TestCircuitV2(&squareCircuit{X: 3, Y: 10}, nil, nil, nil, opts); res.Success || res.Error == nil {
+		t.Fatal("expected an error for an unsatisfied assignment")
+	}
+
+	// FullProve keeps the real proof
+	t.Setenv(TestEngineEnv, "false")
+	ccs, pk, vk, err = InitCircuit(ccsPath, pkPath, vkPath, true, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(TestEngineEnv, "1")
+	opts.FullProve = true
+	if res := TestCircuitV2(&squareCircuit{X: 3, Y: 9}, ccs, pk, vk, opts); !res.Success || res.ProofSize == 0 {
+		t.Fatalf("expected a proof, got %+v", res)
+	}
+}
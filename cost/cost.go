@@ -0,0 +1,161 @@
+// Package cost estimates the cost of a proof before proving. The bench command
+// (cmd/zk-bench) profiles the circuits on reference hardware and stores the
+// samples (constraints, prover time, peak memory at given input sizes) in a
+// manifest; EstimateProve interpolates the samples for other input sizes.
+package cost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+// ErrUnknownCircuit is returned for a circuit without profile
+var ErrUnknownCircuit = errors.New("circuit not profiled")
+
+// Sample is the measured cost of one proof
+type Sample struct {
+	// InputSizes are the sizes of the variable-size inputs (e.g. CertBytes),
+	// in bytes
+	InputSizes  map[string]int `json:"input_sizes"`
+	Constraints int            `json:"constraints"`
+	ProveTime   time.Duration  `json:"prove_time"`
+	// Memory is the peak heap in use while proving, in bytes
+	Memory uint64 `json:"memory"`
+	// Allocated are the bytes allocated by the proof (witness to serialized
+	// proof) and GCCycles the GC cycles it triggered, the GC pressure
+	Allocated uint64 `json:"allocated,omitempty"`
+	GCCycles  uint32 `json:"gc_cycles,omitempty"`
+}
+
+func (s *Sample) size() int {
+	total := 0
+	for _, size := range s.InputSizes {
+		total += size
+	}
+	return total
+}
+
+// Profile is the cost profile of a circuit
+type Profile struct {
+	Circuit string   `json:"circuit"`
+	Samples []Sample `json:"samples"`
+}
+
+// Manifest holds the cost profiles measured on reference hardware
+type Manifest struct {
+	Hardware    string              `json:"hardware"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Circuits    map[string]*Profile `json:"circuits"`
+}
+
+// ReadManifest reads a JSON manifest
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid cost manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// WriteFile writes the manifest as indented JSON
+func (m *Manifest) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Add adds a sample to the profile of a circuit, replacing a sample with the
+// same input sizes
+func (m *Manifest) Add(circuit string, sample Sample) {
+	if m.Circuits == nil {
+		m.Circuits = map[string]*Profile{}
+	}
+	p, ok := m.Circuits[circuit]
+	if !ok {
+		p = &Profile{Circuit: circuit}
+		m.Circuits[circuit] = p
+	}
+	p.Samples = slices.DeleteFunc(p.Samples, func(s Sample) bool {
+		return maps.Equal(s.InputSizes, sample.InputSizes)
+	})
+	p.Samples = append(p.Samples, sample)
+	slices.SortFunc(p.Samples, func(a, b Sample) int { return a.size() - b.size() })
+}
+
+// Profile returns the profile of a circuit
+func (m *Manifest) Profile(circuit string) (*Profile, error) {
+	p, ok := m.Circuits[circuit]
+	if !ok || len(p.Samples) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCircuit, circuit)
+	}
+	return p, nil
+}
+
+// Estimate is the expected cost of a proof
+type Estimate struct {
+	Circuit     string        `json:"circuit"`
+	Hardware    string        `json:"hardware"`
+	Constraints int           `json:"constraints"`
+	ProveTime   time.Duration `json:"prove_time"`
+	Memory      uint64        `json:"memory"`
+	// Measured is true when the input sizes match a sample, the estimate is
+	// interpolated otherwise
+	Measured bool `json:"measured"`
+}
+
+// EstimateProve estimates the cost of proving circuit with the given input
+// sizes. The samples are interpolated linearly in the total input size
+// between the two nearest samples (extrapolated beyond the measured range); a
+// single sample is scaled proportionally. Circuits with a fixed size have a
+// single sample and no input sizes.
+func (m *Manifest) EstimateProve(circuit string, inputSizes map[string]int) (*Estimate, error) {
+	p, err := m.Profile(circuit)
+	if err != nil {
+		return nil, err
+	}
+	e := &Estimate{Circuit: circuit, Hardware: m.Hardware}
+
+	for _, s := range p.Samples {
+		if maps.Equal(s.InputSizes, inputSizes) || (len(s.InputSizes) == 0 && len(inputSizes) == 0) {
+			e.Constraints, e.ProveTime, e.Memory, e.Measured = s.Constraints, s.ProveTime, s.Memory, true
+			return e, nil
+		}
+	}
+
+	// one sample per total input size
+	points := slices.CompactFunc(slices.Clone(p.Samples), func(a, b Sample) bool { return a.size() == b.size() })
+
+	target := (&Sample{InputSizes: inputSizes}).size()
+	var ratio func(a, b float64) float64
+	lo, hi := points[0], points[0]
+	if len(points) == 1 {
+		if lo.size() == 0 {
+			return nil, fmt.Errorf("circuit %q: sample without input sizes", circuit)
+		}
+		scale := float64(target) / float64(lo.size())
+		ratio = func(a, _ float64) float64 { return a * scale }
+	} else {
+		// nearest two samples
+		i, _ := slices.BinarySearchFunc(points, target, func(s Sample, t int) int { return s.size() - t })
+		i = max(1, min(i, len(points)-1))
+		lo, hi = points[i-1], points[i]
+		t := float64(target-lo.size()) / float64(hi.size()-lo.size())
+		ratio = func(a, b float64) float64 { return a + t*(b-a) }
+	}
+
+	e.Constraints = int(max(0, ratio(float64(lo.Constraints), float64(hi.Constraints))))
+	e.ProveTime = time.Duration(max(0, ratio(float64(lo.ProveTime), float64(hi.ProveTime))))
+	e.Memory = uint64(max(0, ratio(float64(lo.Memory), float64(hi.Memory))))
+	return e, nil
+}
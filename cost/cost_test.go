@@ -0,0 +1,111 @@
+package cost
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+func testManifest() *Manifest {
+	m := &Manifest{Hardware: "reference"}
+	m.Add("over18", Sample{InputSizes: map[string]int{"Payload": 2000}, Constraints: 500_000, ProveTime: 6 * time.Second, Memory: 2 << 30})
+	m.Add("over18", Sample{InputSizes: map[string]int{"Payload": 1000}, Constraints: 300_000, ProveTime: 4 * time.Second, Memory: 1 << 30})
+	m.Add("pop", Sample{InputSizes: map[string]int{"CertBytes": 400, "Challenge": 32}, Constraints: 200_000, ProveTime: 3 * time.Second, Memory: 1 << 30})
+	m.Add("fixed", Sample{Constraints: 1000, ProveTime: time.Second})
+	return m
+}
+
+func TestEstimateProve(t *testing.T) {
+	m := testManifest()
+
+	tests := []struct {
+		circuit     string
+		inputSizes  map[string]int
+		constraints int
+		proveTime   time.Duration
+		measured    bool
+	}{
+		{"over18", map[string]int{"Payload": 1000}, 300_000, 4 * time.Second, true},
+		// interpolated
+		{"over18", map[string]int{"Payload": 1500}, 400_000, 5 * time.Second, false},
+		// extrapolated
+		{"over18", map[string]int{"Payload": 3000}, 700_000, 8 * time.Second, false},
+		// single sample, scaled
+		{"pop", map[string]int{"CertBytes": 832, "Challenge": 32}, 400_000, 6 * time.Second, false},
+		{"fixed", nil, 1000, time.Second, true},
+	}
+	for _, tt := range tests {
+		e, err := m.EstimateProve(tt.circuit, tt.inputSizes)
+		if err != nil {
+			t.Fatalf("%s %v: %v", tt.circuit, tt.inputSizes, err)
+		}
+		if e.Constraints != tt.constraints || e.ProveTime != tt.proveTime || e.Measured != tt.measured || e.Hardware != "reference" {
+			t.Errorf("%s %v: unexpected estimate %+v", tt.circuit, tt.inputSizes, e)
+		}
+	}
+
+	if _, err := m.EstimateProve("unknown", nil); !errors.Is(err, ErrUnknownCircuit) {
+		t.Fatalf("expected ErrUnknownCircuit, got %v", err)
+	}
+}
+
+func TestManifestFile(t *testing.T) {
+	m := testManifest()
+	// replaces the sample with the same input sizes
+	m.Add("over18", Sample{InputSizes: map[string]int{"Payload": 1000}, Constraints: 310_000})
+	if n := len(m.Circuits["over18"].Samples); n != 2 {
+		t.Fatalf("expected 2 samples, got %d", n)
+	}
+
+	path := filepath.Join(t.TempDir(), "cost-manifest.json")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := read.EstimateProve("over18", map[string]int{"Payload": 1000})
+	if err != nil || e.Constraints != 310_000 {
+		t.Fatalf("unexpected estimate %+v: %v", e, err)
+	}
+}
+
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+func TestMeasure(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, _, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sample, err := Measure(ccs, pk, &cubeCircuit{X: 3, Y: 27}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sample.Constraints != ccs.GetNbConstraints() || sample.ProveTime <= 0 || sample.Memory == 0 || sample.Allocated == 0 {
+		t.Fatalf("unexpected sample %+v", sample)
+	}
+
+	if _, err := Measure(ccs, pk, &cubeCircuit{X: 3, Y: 28}, nil); err == nil {
+		t.Fatal("expected an error for an unsatisfied assignment")
+	}
+}
@@ -0,0 +1,60 @@
+package cost
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// memorySampling is the interval of the heap sampling while proving
+const memorySampling = 20 * time.Millisecond
+
+// Measure proves the assignment once and returns the measured cost. The
+// memory is the peak heap in use sampled while proving, so run one Measure at
+// a time; opts are passed to the prover.
+func Measure(ccs constraint.ConstraintSystem, pk groth16.ProvingKey, assignment frontend.Circuit, inputSizes map[string]int, opts ...backend.ProverOption) (Sample, error) {
+	runtime.GC()
+	var (
+		peak uint64
+		stop = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(memorySampling)
+		defer ticker.Stop()
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapInuse)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	res, err := common.NewProver(ccs, pk, opts...).Prove(assignment)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		return Sample{}, err
+	}
+
+	return Sample{
+		InputSizes:  inputSizes,
+		Constraints: ccs.GetNbConstraints(),
+		ProveTime:   res.ProveTime,
+		Memory:      peak,
+		Allocated:   res.Allocs.Bytes,
+		GCCycles:    res.Allocs.NumGC,
+	}, nil
+}
@@ -0,0 +1,233 @@
+package datagen
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Profile is the shape of a generated certificate
+type Profile int
+
+const (
+	// ProfileMinimal is a certificate with a common name and the key usage,
+	// as the certificates of the unit tests
+	ProfileMinimal Profile = iota
+	// ProfileQTSP is a qualified certificate as issued by a QTSP (ETSI EN
+	// 319 412): a long subject DN with an organizationIdentifier, the
+	// certificate policies, CRL distribution points, authority information
+	// access and qcStatements extensions, a 16 byte serial
+	ProfileQTSP
+)
+
+// CertOptions configure a generated certificate
+type CertOptions struct {
+	Profile Profile
+	// CA issues a CA certificate, signing certificates and CRLs
+	CA bool
+	// CommonName is the subject CN, derived from the label when empty
+	CommonName string
+	// SerialLen is the length of the serial in bytes, its first bit set so
+	// that its DER INTEGER is one byte longer; 1 byte for ProfileMinimal
+	// and 16 bytes for ProfileQTSP when 0
+	SerialLen int
+	// MinSize pads the certificate with an opaque extension up to at least
+	// MinSize bytes, to size the circuits
+	MinSize int
+	// Validity is the validity from Epoch, 3 years when 0
+	Validity time.Duration
+}
+
+// Certificate is a generated certificate and its key
+type Certificate struct {
+	DER  []byte
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// OIDs of the qualified certificates (ETSI EN 319 412)
+var (
+	oidOrganizationIdentifier = asn1.ObjectIdentifier{2, 5, 4, 97}
+	oidGivenName              = asn1.ObjectIdentifier{2, 5, 4, 42}
+	oidSurname                = asn1.ObjectIdentifier{2, 5, 4, 4}
+	oidQCStatements           = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+	oidQcCompliance           = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 1}
+	oidQcSSCD                 = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 4}
+	oidQcPDS                  = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 5}
+	oidQcType                 = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6}
+	oidQcTypeESign            = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 1}
+	oidPolicyQCPnQSCD         = asn1.ObjectIdentifier{0, 4, 0, 194112, 1, 2}
+	// oidPadding is the opaque extension of MinSize, in the example arc
+	oidPadding = asn1.ObjectIdentifier{2, 999, 1}
+)
+
+// Certificate returns the certificate of a label issued by issuer,
+// self-signed when issuer is nil
+func (g *Generator) Certificate(label string, issuer *Certificate, opts CertOptions) (*Certificate, error) {
+	key := g.Key("cert/" + label)
+	template, err := g.template(label, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	parent, signingKey := template, key
+	if issuer != nil {
+		parent, signingKey = issuer.Cert, issuer.Key
+	}
+
+	der, err := x509.CreateCertificate(nil, template, parent, &key.PublicKey, Signer(signingKey))
+	if err != nil {
+		return nil, fmt.Errorf("datagen: certificate %q: %w", label, err)
+	}
+	// the padding extension is sized on the certificate without it, the
+	// length octets of the enclosing elements may grow by a few bytes
+	for missing := opts.MinSize - len(der); missing > 0; missing = opts.MinSize - len(der) {
+		padding := 0
+		for _, ext := range template.ExtraExtensions {
+			if ext.Id.Equal(oidPadding) {
+				padding = len(ext.Value)
+			}
+		}
+		template.ExtraExtensions = withPadding(template.ExtraExtensions, padding+max(missing-16, 1))
+		if der, err = x509.CreateCertificate(nil, template, parent, &key.PublicKey, Signer(signingKey)); err != nil {
+			return nil, fmt.Errorf("datagen: certificate %q: %w", label, err)
+		}
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{DER: der, Cert: cert, Key: key}, nil
+}
+
+// withPadding returns the extensions with a padding extension of n bytes
+func withPadding(extensions []pkix.Extension, n int) []pkix.Extension {
+	out := make([]pkix.Extension, 0, len(extensions)+1)
+	for _, ext := range extensions {
+		if !ext.Id.Equal(oidPadding) {
+			out = append(out, ext)
+		}
+	}
+	return append(out, pkix.Extension{Id: oidPadding, Value: make([]byte, n)})
+}
+
+// template returns the certificate template of a label
+func (g *Generator) template(label string, key *ecdsa.PrivateKey, opts CertOptions) (*x509.Certificate, error) {
+	serialLen := opts.SerialLen
+	if serialLen == 0 {
+		serialLen = 1
+		if opts.Profile == ProfileQTSP {
+			serialLen = 16
+		}
+	}
+	if serialLen > 20 {
+		return nil, fmt.Errorf("datagen: serial of %d bytes, at most 20", serialLen)
+	}
+	serial := g.Bytes("serial/"+label, serialLen)
+	serial[0] |= 0x80
+	validity := opts.Validity
+	if validity == 0 {
+		validity = 3 * 365 * 24 * time.Hour
+	}
+	commonName := opts.CommonName
+	if commonName == "" {
+		commonName = label
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(publicKey, &spki); err != nil {
+		return nil, err
+	}
+	keyID := sha1.Sum(spki.PublicKey.Bytes)
+
+	template := &x509.Certificate{
+		SerialNumber:          new(big.Int).SetBytes(serial),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             Epoch,
+		NotAfter:              Epoch.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		SubjectKeyId:          keyID[:],
+		BasicConstraintsValid: opts.CA,
+		IsCA:                  opts.CA,
+	}
+	if opts.CA {
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	if opts.Profile != ProfileQTSP {
+		return template, nil
+	}
+
+	host := strings.ToLower(strings.NewReplacer(" ", "-", "/", "-").Replace(label)) + ".example"
+	number := new(big.Int).SetBytes(g.Bytes("number/"+label, 4)).String()
+	template.Subject = pkix.Name{
+		Country:            []string{"SI"},
+		Organization:       []string{"Example Qualified Trust Services d.o.o."},
+		OrganizationalUnit: []string{"Qualified Certificates for Electronic Signatures"},
+		Locality:           []string{"Ljubljana"},
+		Province:           []string{"Osrednjeslovenska"},
+		CommonName:         commonName,
+		SerialNumber:       "PNOSI-" + number,
+		ExtraNames:         []pkix.AttributeTypeAndValue{{Type: oidOrganizationIdentifier, Value: "VATSI-" + number}},
+	}
+	if !opts.CA {
+		template.Subject.ExtraNames = append(template.Subject.ExtraNames,
+			pkix.AttributeTypeAndValue{Type: oidGivenName, Value: "Erika"},
+			pkix.AttributeTypeAndValue{Type: oidSurname, Value: "Mustermann"},
+		)
+		template.KeyUsage |= x509.KeyUsageContentCommitment
+		template.EmailAddresses = []string{"holder@" + host}
+	}
+	template.CRLDistributionPoints = []string{"http://crl." + host + "/qca.crl"}
+	template.OCSPServer = []string{"http://ocsp." + host}
+	template.IssuingCertificateURL = []string{"http://ca." + host + "/qca.cer"}
+	template.PolicyIdentifiers = []asn1.ObjectIdentifier{oidPolicyQCPnQSCD}
+
+	statements, err := qcStatements("https://" + host + "/pds_en.pdf")
+	if err != nil {
+		return nil, err
+	}
+	template.ExtraExtensions = []pkix.Extension{{Id: oidQCStatements, Value: statements}}
+	return template, nil
+}
+
+// qcStatements returns the qcStatements extension of a qualified
+// certificate for electronic signatures on a QSCD
+func qcStatements(pds string) ([]byte, error) {
+	type statement struct {
+		ID   asn1.ObjectIdentifier
+		Info asn1.RawValue `asn1:"optional"`
+	}
+	raw := func(v any) (asn1.RawValue, error) {
+		der, err := asn1.Marshal(v)
+		return asn1.RawValue{FullBytes: der}, err
+	}
+	qcType, err := raw([]asn1.ObjectIdentifier{oidQcTypeESign})
+	if err != nil {
+		return nil, err
+	}
+	qcPDS, err := raw([]struct {
+		URL      string `asn1:"ia5"`
+		Language string `asn1:"printable"`
+	}{{pds, "en"}})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal([]statement{
+		{ID: oidQcCompliance},
+		{ID: oidQcSSCD},
+		{ID: oidQcType, Info: qcType},
+		{ID: oidQcPDS, Info: qcPDS},
+	})
+}
@@ -0,0 +1,124 @@
+// Package datagen generates realistic test data deterministically: keys,
+// certificates of configurable profiles and sizes, CRLs and JWS credentials,
+// the same bytes for the same seed. Tests, benchmarks and mock issuers use
+// it instead of minimal self-signed certificates, so the DER navigation and
+// the circuit sizes are exercised with the shapes of real QTSP data: long
+// distinguished names, many extensions, long serials.
+//
+//	gen := datagen.New("my-test")
+//	ca, err := gen.Certificate("ca", nil, datagen.CertOptions{Profile: datagen.ProfileQTSP, CA: true})
+//	leaf, err := gen.Certificate("holder", ca, datagen.CertOptions{Profile: datagen.ProfileQTSP, MinSize: 1500})
+//
+// The keys and the signatures are derived from the seed: test data only.
+package datagen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	mathrand "math/rand/v2"
+	"time"
+)
+
+// Epoch is the reference time of the generated data: the certificates are
+// valid from Epoch, the CRLs are issued at Epoch
+var Epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Generator derives the test data from a seed, every value from a label:
+// the same seed and label give the same value
+type Generator struct {
+	seed string
+}
+
+// New returns the generator of a seed
+func New(seed string) *Generator {
+	return &Generator{seed: seed}
+}
+
+// Reader returns the deterministic random stream of a label
+func (g *Generator) Reader(label string) io.Reader {
+	return mathrand.NewChaCha8(sha256.Sum256([]byte(g.seed + "\x00" + label)))
+}
+
+// Bytes returns n deterministic random bytes of a label
+func (g *Generator) Bytes(label string, n int) []byte {
+	b := make([]byte, n)
+	io.ReadFull(g.Reader(label), b)
+	return b
+}
+
+// Key returns the P-256 key of a label
+func (g *Generator) Key(label string) *ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	n := curve.Params().N
+	// 48 bytes reduced modulo n-1, with a negligible bias
+	d := new(big.Int).SetBytes(g.Bytes("key/"+label, 48))
+	d.Mod(d, new(big.Int).Sub(n, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+	x, y := curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	return &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}
+}
+
+// Sign returns the deterministic ECDSA signature of a digest: the nonce is
+// derived from the key and the digest, as in RFC 6979 but simplified
+func Sign(key *ecdsa.PrivateKey, digest []byte) (r, s *big.Int) {
+	curve := key.Curve
+	n := curve.Params().N
+	e := new(big.Int).SetBytes(digest)
+	if excess := len(digest)*8 - n.BitLen(); excess > 0 {
+		e.Rsh(e, uint(excess))
+	}
+
+	mac := hmac.New(sha256.New, key.D.Bytes())
+	for counter := byte(0); ; counter++ {
+		mac.Reset()
+		mac.Write(digest)
+		mac.Write([]byte{counter})
+		k := new(big.Int).SetBytes(mac.Sum(nil))
+		k.Mod(k, n)
+		if k.Sign() == 0 {
+			continue
+		}
+		x, _ := curve.ScalarBaseMult(k.FillBytes(make([]byte, (n.BitLen()+7)/8)))
+		r = x.Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+		// s = k^-1 (e + r d) mod n
+		s = new(big.Int).Mul(r, key.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() != 0 {
+			return r, s
+		}
+	}
+}
+
+// Signer returns a crypto.Signer signing deterministically with key (Sign),
+// for the x509 functions
+func Signer(key *ecdsa.PrivateKey) crypto.Signer {
+	return signer{key}
+}
+
+type signer struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s signer) Public() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts != nil && opts.HashFunc() != 0 && opts.HashFunc().Size() != len(digest) {
+		return nil, fmt.Errorf("datagen: digest of %d bytes for %s", len(digest), opts.HashFunc())
+	}
+	r, sig := Sign(s.key, digest)
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sig})
+}
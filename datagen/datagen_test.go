@@ -0,0 +1,146 @@
+package datagen
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/mynextid/eudi-zk/x509pos"
+)
+
+func TestCertificate(t *testing.T) {
+	gen := New("datagen-test")
+	ca, err := gen.Certificate("Example QCA", nil, CertOptions{Profile: ProfileQTSP, CA: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := gen.Certificate("holder", ca, CertOptions{Profile: ProfileQTSP, MinSize: 1500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.Cert.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DER) < 1500 || len(leaf.DER) > 1520 {
+		t.Fatalf("expected a certificate of about 1500 bytes, got %d", len(leaf.DER))
+	}
+	// a 16 byte serial with its first bit set, 17 bytes of DER INTEGER
+	if serial := leaf.Cert.SerialNumber.Bytes(); len(serial) != 16 || serial[0]&0x80 == 0 {
+		t.Fatalf("unexpected serial %x", serial)
+	}
+	if len(leaf.Cert.Subject.Names) < 10 || len(leaf.Cert.Extensions) < 8 {
+		t.Fatalf("expected a QTSP profile, got %d names and %d extensions", len(leaf.Cert.Subject.Names), len(leaf.Cert.Extensions))
+	}
+
+	// the DER navigation of the circuits finds the subject key
+	c, err := x509pos.Parse(leaf.DER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := c.PublicKey.Raw(leaf.DER)[:4]; string(header) != "\x03\x42\x00\x04" {
+		t.Fatalf("unexpected subject public key header %x", header)
+	}
+
+	// deterministic
+	again, err := New("datagen-test").Certificate("holder", ca, CertOptions{Profile: ProfileQTSP, MinSize: 1500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.DER, leaf.DER) {
+		t.Fatal("expected the same certificate for the same seed")
+	}
+	other, err := New("other-seed").Certificate("holder", ca, CertOptions{Profile: ProfileQTSP, MinSize: 1500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other.DER, leaf.DER) {
+		t.Fatal("expected another certificate for another seed")
+	}
+
+	minimal, err := gen.Certificate("minimal", nil, CertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minimal.Cert.Subject.CommonName != "minimal" || len(minimal.Cert.SerialNumber.Bytes()) != 1 {
+		t.Fatal("unexpected minimal certificate")
+	}
+}
+
+func TestCRL(t *testing.T) {
+	gen := New("datagen-test")
+	ca, err := gen.Certificate("Example QCA", nil, CertOptions{Profile: ProfileQTSP, CA: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := gen.CRL("base", ca, CRLOptions{Number: 7, Revoked: 50, Serials: []*big.Int{big.NewInt(42)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.RevokedCertificateEntries) != 51 || crl.Number.Int64() != 7 {
+		t.Fatalf("unexpected CRL of %d entries, number %s", len(crl.RevokedCertificateEntries), crl.Number)
+	}
+	again, err := gen.CRL("base", ca, CRLOptions{Number: 7, Revoked: 50, Serials: []*big.Int{big.NewInt(42)}})
+	if err != nil || !bytes.Equal(again, der) {
+		t.Fatal("expected the same CRL for the same seed")
+	}
+
+	delta, err := gen.CRL("delta", ca, CRLOptions{Number: 8, BaseNumber: 7, Revoked: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crl, err = x509.ParseRevocationList(delta); err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.Extensions) == 0 || !crl.Extensions[len(crl.Extensions)-1].Id.Equal(oidDeltaCRLIndicator) {
+		t.Fatal("expected a deltaCRLIndicator")
+	}
+}
+
+func TestJWS(t *testing.T) {
+	gen := New("datagen-test")
+	key := gen.Key("issuer")
+	jws, err := gen.JWS(key, gen.PID("holder"), JWSOptions{MinPayloadSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected a compact JWS, got %d parts", len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != 1024 || claims["family_name"] != "Mustermann" {
+		t.Fatalf("unexpected payload of %d bytes", len(payload))
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(&key.PublicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		t.Fatal("invalid signature")
+	}
+	if again, err := gen.JWS(gen.Key("issuer"), gen.PID("holder"), JWSOptions{MinPayloadSize: 1024}); err != nil || again != jws {
+		t.Fatal("expected the same JWS for the same seed")
+	}
+}
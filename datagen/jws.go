@@ -0,0 +1,82 @@
+package datagen
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// JWSOptions configure a generated JWS
+type JWSOptions struct {
+	// Header is the protected header, {"alg":"ES256","typ":"JOSE+JSON"}
+	// when nil; alg is always ES256
+	Header map[string]any
+	// MinPayloadSize pads the payload JSON with a "padding" claim up to at
+	// least MinPayloadSize bytes, to size the circuits
+	MinPayloadSize int
+}
+
+// PID returns the PID claims of a label (names, birth date, address,
+// nationality, contact), as issued in a PID credential
+func (g *Generator) PID(label string) map[string]any {
+	b := g.Bytes("pid/"+label, 8)
+	day, month, year := 1+int(b[0])%28, 1+int(b[1])%12, 1950+int(b[2])%55
+	return map[string]any{
+		"family_name":       "Mustermann",
+		"given_name":        "Erika",
+		"birthdate":         fmt.Sprintf("%04d-%02d-%02d", year, month, day),
+		"age_over_18":       year <= 2007,
+		"birth_place":       "Berlin",
+		"nationality":       "DE",
+		"issuing_country":   "DE",
+		"issuing_authority": "DE",
+		"document_number":   strings.ToUpper(hex.EncodeToString(b[3:8])),
+		"address": map[string]any{
+			"street_address": "Heidestraße 17",
+			"locality":       "Köln",
+			"postal_code":    "51147",
+			"country":        "DE",
+		},
+		"email":        "erika." + strings.ToLower(hex.EncodeToString(b[3:5])) + "@example.com",
+		"phone_number": "+49-89-" + fmt.Sprintf("%08d", int(b[5])<<8|int(b[6])),
+	}
+}
+
+// JWS returns the ES256 JWS (compact serialization) of the claims signed
+// deterministically with key (Sign)
+func (g *Generator) JWS(key *ecdsa.PrivateKey, claims map[string]any, opts JWSOptions) (string, error) {
+	header := map[string]any{"typ": "JOSE+JSON"}
+	if opts.Header != nil {
+		header = maps.Clone(opts.Header)
+	}
+	header["alg"] = "ES256"
+	protected, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	if missing := opts.MinPayloadSize - len(payload); missing > 0 {
+		padded := maps.Clone(claims)
+		// ,"padding":"..."
+		padded["padding"] = strings.Repeat("x", max(missing-len(`,"padding":""`), 0))
+		if payload, err = json.Marshal(padded); err != nil {
+			return "", err
+		}
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(protected) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s := Sign(key, digest[:])
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/openid4vp"
+	"github.com/mynextid/eudi-zk/server"
+)
+
+// maxRequests bounds the pending authorization requests
+const maxRequests = 1000
+
+// credentialID is the id of the DCQL credential query of the requests
+const credentialID = "pid"
+
+// demo is a verifier web application: it issues OpenID4VP authorization
+// requests (request_uri in a QR code), accepts the presentations posted by a
+// wallet (direct_post) or uploaded in the page, and verifies them with the
+// verify endpoint of the server
+type demo struct {
+	// api is the server the presentations are verified with, in process
+	api http.Handler
+	// apiKey is sent to the api when not empty
+	apiKey string
+	// clientID is the client_id and the audience of the requests, the public
+	// base URL of the demo
+	clientID string
+	ttl      time.Duration
+	now      func() time.Time
+
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	requests map[string]*request
+}
+
+// request is a pending authorization request, state is its id (short, it is
+// in the QR code; the nonce binds the presentation)
+type request struct {
+	state     string
+	nonce     string
+	expiresAt time.Time
+	result    *result
+}
+
+// result is the outcome of the verification of a presentation
+type result struct {
+	Error      string
+	Circuit    string
+	Claims     map[string]any
+	Attributes map[string]models.AttributeDigest
+}
+
+func newDemo(api http.Handler, clientID string, ttl time.Duration) *demo {
+	d := &demo{
+		api:      api,
+		clientID: strings.TrimSuffix(clientID, "/"),
+		ttl:      ttl,
+		now:      time.Now,
+		mux:      http.NewServeMux(),
+		requests: map[string]*request{},
+	}
+	d.mux.HandleFunc("GET /{$}", d.handleIndex)
+	d.mux.HandleFunc("GET /requests/{state}", d.handleRequestObject)
+	d.mux.HandleFunc("POST /response", d.handleResponse)
+	d.mux.HandleFunc("POST /present", d.handlePresent)
+	d.mux.HandleFunc("GET /result/{state}", d.handleResult)
+	d.mux.Handle("/api/", http.StripPrefix("/api", api))
+	return d
+}
+
+// ServeHTTP implements http.Handler
+func (d *demo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.ServeHTTP(w, r)
+}
+
+// newRequest registers a new authorization request
+func (d *demo) newRequest() (*request, error) {
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for state, req := range d.requests {
+		if now.After(req.expiresAt) {
+			delete(d.requests, state)
+		}
+	}
+	if len(d.requests) >= maxRequests {
+		return nil, fmt.Errorf("too many pending requests")
+	}
+	req := &request{state: randomHex(8), nonce: randomHex(16), expiresAt: now.Add(d.ttl)}
+	d.requests[req.state] = req
+	return req, nil
+}
+
+// request returns the pending request of state, nil when unknown or expired
+func (d *demo) request(state string) *request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	req := d.requests[state]
+	if req == nil || d.now().After(req.expiresAt) {
+		return nil
+	}
+	return req
+}
+
+// requestURI is the authorization request of the QR code, by reference
+func (d *demo) requestURI(req *request) string {
+	query := url.Values{"client_id": {d.clientID}, "request_uri": {d.clientID + "/requests/" + req.state}}
+	return "openid4vp://?" + query.Encode()
+}
+
+func (d *demo) handleIndex(w http.ResponseWriter, r *http.Request) {
+	req, err := d.newRequest()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	requestURI := d.requestURI(req)
+	qr, err := encodeQR([]byte(requestURI))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render(w, "index", map[string]any{
+		"State":      req.state,
+		"Nonce":      req.nonce,
+		"ClientID":   d.clientID,
+		"RequestURI": requestURI,
+		"QR":         template.HTML(qr.SVG(6)),
+	})
+}
+
+// handleRequestObject serves the request object of request_uri, unsigned:
+// the demo wallet accepts it as is (openid4vp.Holder.VerifyRequestObject)
+func (d *demo) handleRequestObject(w http.ResponseWriter, r *http.Request) {
+	req := d.request(r.PathValue("state"))
+	if req == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openid4vp.AuthorizationRequest{
+		ClientID:     d.clientID,
+		ResponseType: "vp_token",
+		ResponseMode: "direct_post",
+		ResponseURI:  d.clientID + "/response",
+		Nonce:        req.nonce,
+		State:        req.state,
+		DCQLQuery: &openid4vp.DCQLQuery{Credentials: []openid4vp.CredentialQuery{
+			{ID: credentialID, Format: models.PresentationType},
+		}},
+	})
+}
+
+// handleResponse accepts the direct_post authorization response of a wallet
+// and answers with the redirect_uri of the result page
+func (d *demo) handleResponse(w http.ResponseWriter, r *http.Request) {
+	req := d.request(r.PostFormValue("state"))
+	if req == nil {
+		http.Error(w, "unknown or expired state", http.StatusBadRequest)
+		return
+	}
+	presentation, err := presentationOf(r.PostFormValue("vp_token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d.verify(r, req, presentation)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"redirect_uri": d.clientID + "/result/" + req.state})
+}
+
+// handlePresent accepts a presentation pasted or uploaded in the page
+func (d *demo) handlePresent(w http.ResponseWriter, r *http.Request) {
+	req := d.request(r.FormValue("state"))
+	if req == nil {
+		http.Error(w, "unknown or expired request", http.StatusBadRequest)
+		return
+	}
+	presentation := r.FormValue("presentation")
+	if file, _, err := r.FormFile("file"); err == nil {
+		data, err := io.ReadAll(io.LimitReader(file, 1<<20))
+		file.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		presentation = string(data)
+	}
+	d.verify(r, req, strings.TrimSpace(presentation))
+	http.Redirect(w, r, "/result/"+req.state, http.StatusSeeOther)
+}
+
+func (d *demo) handleResult(w http.ResponseWriter, r *http.Request) {
+	req := d.request(r.PathValue("state"))
+	if req == nil {
+		http.NotFound(w, r)
+		return
+	}
+	d.mu.Lock()
+	res := req.result
+	d.mu.Unlock()
+	render(w, "result", map[string]any{"State": req.state, "Result": res})
+}
+
+// verify verifies the presentation with POST /presentations/verify of the
+// server, then checks it answers the request: nonce and audience
+func (d *demo) verify(r *http.Request, req *request, presentation string) {
+	res := &result{}
+	if verified, err := d.verifyPresentation(r, presentation); err != nil {
+		res.Error = err.Error()
+	} else if verified.Payload.Nonce != req.nonce {
+		res.Error = fmt.Sprintf("nonce %q does not match the request", verified.Payload.Nonce)
+	} else if verified.Payload.Audience != d.clientID {
+		res.Error = fmt.Sprintf("audience %q does not match %q", verified.Payload.Audience, d.clientID)
+	} else {
+		res.Circuit, res.Claims, res.Attributes = verified.Circuit, verified.Payload.Claims, verified.Attributes
+	}
+
+	d.mu.Lock()
+	req.result = res
+	d.mu.Unlock()
+}
+
+func (d *demo) verifyPresentation(r *http.Request, presentation string) (*server.VerifyResponse, error) {
+	body, err := json.Marshal(server.PresentationVerifyRequest{Presentation: presentation})
+	if err != nil {
+		return nil, err
+	}
+	apiReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost, "/presentations/verify", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	apiReq.Header.Set("Content-Type", "application/json")
+	if d.apiKey != "" {
+		apiReq.Header.Set("Authorization", "Bearer "+d.apiKey)
+	}
+	rec := httptest.NewRecorder()
+	d.api.ServeHTTP(rec, apiReq)
+
+	if rec.Code != http.StatusOK {
+		var problem server.Problem
+		if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+			return nil, fmt.Errorf("invalid response of the server (%d): %w", rec.Code, err)
+		}
+		return nil, &problem
+	}
+	var res server.VerifyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("invalid response of the server (%d): %w", rec.Code, err)
+	}
+	if !res.Valid || res.Payload == nil {
+		return nil, fmt.Errorf("invalid presentation")
+	}
+	return &res, nil
+}
+
+// presentationOf returns the presentation of a vp_token: the presentation
+// itself, or a DCQL response {"pid": ["..."]}
+func presentationOf(vpToken string) (string, error) {
+	vpToken = strings.TrimSpace(vpToken)
+	if !strings.HasPrefix(vpToken, "{") {
+		return vpToken, nil
+	}
+	var presentations map[string][]string
+	if err := json.Unmarshal([]byte(vpToken), &presentations); err != nil {
+		return "", fmt.Errorf("invalid vp_token: %w", err)
+	}
+	if len(presentations[credentialID]) != 1 {
+		return "", fmt.Errorf("vp_token has no single %q presentation", credentialID)
+	}
+	return presentations[credentialID][0], nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pages.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var pages = template.Must(template.New("").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>eudi-zk verifier demo</title>
+<style>body{font-family:sans-serif;max-width:48em;margin:2em auto}code{word-break:break-all}textarea{width:100%}</style>
+{{end}}
+
+{{define "index"}}{{template "head"}}</head><body>
+<h1>Zero-knowledge verifier demo</h1>
+<p>Scan the authorization request with a wallet, or paste a presentation
+with audience <code>{{.ClientID}}</code> and nonce <code>{{.Nonce}}</code>.</p>
+{{.QR}}
+<p><code>{{.RequestURI}}</code></p>
+<form method="post" action="/present" enctype="multipart/form-data">
+<input type="hidden" name="state" value="{{.State}}">
+<p><textarea name="presentation" rows="6" placeholder="protected.payload.proof.signature"></textarea></p>
+<p><input type="file" name="file"> <button type="submit">Verify</button></p>
+</form>
+<p><a href="/result/{{.State}}">Result of the wallet response</a></p>
+</body></html>
+{{end}}
+
+{{define "result"}}{{template "head"}}{{if not .Result}}<meta http-equiv="refresh" content="2">{{end}}</head><body>
+<h1>Verification</h1>
+{{with .Result}}{{if .Error}}<p><strong>Rejected:</strong> {{.Error}}</p>{{else}}
+<p><strong>Verified</strong> with circuit <code>{{.Circuit}}</code></p>
+{{if .Claims}}<h2>Disclosed claims</h2><ul>{{range $name, $value := .Claims}}<li>{{$name}}: {{$value}}</li>{{end}}</ul>{{end}}
+{{if .Attributes}}<h2>Proven attributes</h2><ul>{{range $name, $digest := .Attributes}}<li>{{$name}}: <code>{{printf "%x" $digest}}</code></li>{{end}}</ul>{{end}}
+{{end}}{{else}}<p>Waiting for the wallet response...</p>{{end}}
+<p><a href="/">New request</a></p>
+</body></html>
+{{end}}
+`))
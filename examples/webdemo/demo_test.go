@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/openid4vp"
+	"github.com/mynextid/eudi-zk/server"
+)
+
+// cubeCircuit proves knowledge of X with X^3 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+// wallet builds cube presentations for the demo audience, with the nonce of
+// the requests or a fixed one
+type wallet struct {
+	key           *ecdsa.PrivateKey
+	proof         []byte
+	publicWitness []byte
+	vkHash        string
+	audience      string
+	nonce         string // overrides the nonce of the request when set
+
+	request *openid4vp.AuthorizationRequest
+}
+
+func (wl *wallet) BuildPresentation(ctx context.Context, query openid4vp.Query, challenge []byte) (*openid4vp.Presentation, error) {
+	nonce := wl.request.Nonce
+	if wl.nonce != "" {
+		nonce = wl.nonce
+	}
+	compact, err := models.SignPresentation(
+		models.PresentationHeader{Alg: "ES256", Typ: models.PresentationType, Circuit: "cube/v1", VKHash: wl.vkHash},
+		models.PresentationPayload{Audience: wl.audience, Nonce: nonce, IssuedAt: time.Now().Unix(), PublicWitness: wl.publicWitness,
+			Claims: map[string]any{"level": "demo"}},
+		wl.proof, wl.key)
+	if err != nil {
+		return nil, err
+	}
+	return &openid4vp.Presentation{Format: models.PresentationType, Value: compact}, nil
+}
+
+func newWallet(t *testing.T) (*wallet, *models.PresentationVerifier) {
+	t.Helper()
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := frontend.NewWitness(&cubeCircuit{X: 3, Y: 27}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, err := w.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wl := &wallet{}
+	var buf bytes.Buffer
+	proof.WriteTo(&buf)
+	wl.proof = buf.Bytes()
+	if wl.publicWitness, err = publicWitness.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	if wl.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	vkHash, err := common.VerifyingKeyHash(vk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wl.vkHash = hex.EncodeToString(vkHash[:])
+
+	verifier := models.NewPresentationVerifier(func(header models.PresentationHeader) (*ecdsa.PublicKey, error) {
+		return &wl.key.PublicKey, nil
+	})
+	if err := verifier.AddCircuit("cube/v1", vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	return wl, verifier
+}
+
+func TestDemo(t *testing.T) {
+	wl, verifier := newWallet(t)
+	var d *demo
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { d.ServeHTTP(w, r) }))
+	defer ts.Close()
+	d = newDemo(server.New(verifier), ts.URL, time.Minute)
+	wl.audience = ts.URL
+
+	holder := &openid4vp.Holder{
+		HTTPClient: ts.Client(),
+		Builder:    wl,
+		VerifyRequestObject: func(ctx context.Context, clientID, requestObject string) ([]byte, error) {
+			return []byte(requestObject), nil
+		},
+	}
+	// scans the QR code of the index page and answers the request
+	respond := func() string {
+		res, err := ts.Client().Get(ts.URL + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if !strings.Contains(string(page), "<svg") {
+			t.Fatalf("no QR code in the index page %s", page)
+		}
+		requestURI := regexp.MustCompile(`openid4vp://\?[^<]*`).Find(page)
+		if requestURI == nil {
+			t.Fatalf("no request URI in %s", page)
+		}
+
+		ctx := context.Background()
+		if wl.request, err = holder.ParseRequest(ctx, strings.ReplaceAll(string(requestURI), "&amp;", "&")); err != nil {
+			t.Fatal(err)
+		}
+		response, err := holder.BuildResponse(ctx, wl.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		redirect, err := holder.PostResponse(ctx, wl.request, response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, err = ts.Client().Get(redirect); err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		result, _ := io.ReadAll(res.Body)
+		return string(result)
+	}
+
+	if result := respond(); !strings.Contains(result, "Verified") || !strings.Contains(result, "level: demo") {
+		t.Fatalf("unexpected result page %s", result)
+	}
+
+	// a presentation for another request
+	wl.nonce = "replayed"
+	if result := respond(); !strings.Contains(result, "Rejected") || !strings.Contains(result, "nonce") {
+		t.Fatalf("unexpected result page %s", result)
+	}
+}
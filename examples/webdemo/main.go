@@ -0,0 +1,102 @@
+// Command webdemo is a minimal web verifier built on package server, an
+// integration reference and a smoke test of the API:
+//
+//	go run ./examples/webdemo -config server.json -keys holder-keys -url http://localhost:8080
+//
+// The index page issues an OpenID4VP authorization request (request_uri in a
+// QR code, with a fresh nonce); the wallet posts its response to /response
+// (direct_post), or the presentation is pasted or uploaded in the page. The
+// presentation is verified with POST /presentations/verify of the server,
+// also served under /api, then its nonce and audience are checked against the
+// request and the disclosed claims and proven attributes are displayed.
+//
+// The holder keys are read from the -keys directory, <kid>.pem (PKIX public
+// keys). The configuration reloads on SIGHUP.
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	config := flag.String("config", "server.json", "server configuration (server.Config)")
+	keys := flag.String("keys", "holder-keys", "directory of the holder public keys, <kid>.pem")
+	baseURL := flag.String("url", "", "public base URL of the demo, client_id and audience of the requests (default http://localhost<addr>)")
+	apiKey := flag.String("api-key", "", "API key of the server, when its configuration has api_keys")
+	ttl := flag.Duration("ttl", 5*time.Minute, "validity of the authorization requests")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("webdemo: ")
+
+	if *baseURL == "" {
+		*baseURL = "http://localhost" + *addr
+		if !strings.HasPrefix(*addr, ":") {
+			*baseURL = "http://" + *addr
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	srv, err := server.NewFromConfig(ctx, *config, server.Options{ResolveKey: keyDir(*keys)})
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv.ReloadOnSignal(ctx, func(err error) { log.Printf("reload: %v", err) })
+
+	d := newDemo(srv, *baseURL, *ttl)
+	d.apiKey = *apiKey
+
+	httpServer := &http.Server{Addr: *addr, Handler: d, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+	log.Printf("serving %s on %s", *baseURL, *addr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// keyDir resolves the holder keys from the PEM files of dir, named after the
+// kid of the presentation header
+func keyDir(dir string) func(header models.PresentationHeader) (*ecdsa.PublicKey, error) {
+	return func(header models.PresentationHeader) (*ecdsa.PublicKey, error) {
+		if header.Kid == "" || header.Kid != filepath.Base(header.Kid) || strings.HasPrefix(header.Kid, ".") {
+			return nil, fmt.Errorf("invalid kid %q", header.Kid)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, header.Kid+".pem"))
+		if err != nil {
+			return nil, fmt.Errorf("unknown holder key %q", header.Kid)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("holder key %q: no PEM block", header.Kid)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("holder key %q: %w", header.Kid, err)
+		}
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("holder key %q is not an ECDSA key", header.Kid)
+		}
+		return ecKey, nil
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// qrMaxVersion is the largest QR code version the demo encodes: versions 1 to
+// 6 at level L have one alignment pattern, no version information and blocks
+// of equal size, enough for a request URI (134 bytes)
+const qrMaxVersion = 6
+
+// qrBlocks are the error correction codewords per block and the number of
+// blocks of the versions 1 to 6 at level L (ISO/IEC 18004, table 9)
+var qrBlocks = [qrMaxVersion][2]int{{7, 1}, {10, 1}, {15, 1}, {20, 1}, {26, 1}, {18, 2}}
+
+// qrCode is a QR code in byte mode at level L, modules[y][x] is true for the
+// dark modules
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// encodeQR returns the QR code of data, with mask 0 (any mask is valid, the
+// mask penalty only improves the readability)
+func encodeQR(data []byte) (*qrCode, error) {
+	estimate, err := models.EstimateQR(len(data), models.QRLevelL)
+	if err != nil {
+		return nil, err
+	}
+	if estimate.Version > qrMaxVersion {
+		return nil, fmt.Errorf("%d bytes exceed the demo QR code capacity", len(data))
+	}
+	version := estimate.Version
+
+	size := estimate.Modules
+	q := &qrCode{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for y := range size {
+		q.modules[y], q.function[y] = make([]bool, size), make([]bool, size)
+	}
+	q.drawFunctionPatterns(version)
+	q.drawCodewords(qrCodewords(data, version))
+	q.applyMask()
+	q.drawFormat(0)
+	return q, nil
+}
+
+// qrCodewords returns the codewords of data in byte mode, the data codewords
+// then the error correction codewords, interleaved by block
+func qrCodewords(data []byte, version int) []byte {
+	ecLen, blocks := qrBlocks[version-1][0], qrBlocks[version-1][1]
+	total := qrRawCodewords(version)
+	dataLen := total - ecLen*blocks
+
+	// mode 0100, 8 bit count, data, terminator and padding
+	var bits []bool
+	appendBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1 == 1)
+		}
+	}
+	appendBits(0b0100, 4)
+	appendBits(len(data), 8)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	appendBits(0, min(4, dataLen*8-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+	codewords := make([]byte, 0, total)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for _, bit := range bits[i : i+8] {
+			b <<= 1
+			if bit {
+				b |= 1
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xec); len(codewords) < dataLen; pad ^= 0xec ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	// blocks of equal size, data then error correction codewords interleaved
+	blockLen := dataLen / blocks
+	divisor := rsDivisor(ecLen)
+	result := make([]byte, 0, total)
+	for i := range blockLen {
+		for b := range blocks {
+			result = append(result, codewords[b*blockLen+i])
+		}
+	}
+	ec := make([][]byte, blocks)
+	for b := range blocks {
+		ec[b] = rsRemainder(codewords[b*blockLen:(b+1)*blockLen], divisor)
+	}
+	for i := range ecLen {
+		for b := range blocks {
+			result = append(result, ec[b][i])
+		}
+	}
+	return result
+}
+
+// qrRawCodewords is the number of codewords of a version, without the
+// remainder bits
+func qrRawCodewords(version int) int {
+	bits := (16*version+128)*version + 64
+	if version >= 2 {
+		// one alignment pattern in the versions 2 to 6, it overlaps neither
+		// timing pattern
+		bits -= 25
+	}
+	return bits / 8
+}
+
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x], q.function[y][x] = dark, true
+}
+
+func (q *qrCode) drawFunctionPatterns(version int) {
+	// timing patterns
+	for i := range q.size {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	// finder patterns and separators
+	for _, c := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || x >= q.size || y < 0 || y >= q.size {
+					continue
+				}
+				dist := max(abs(dx), abs(dy))
+				q.set(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+	// alignment pattern, bottom right
+	if version >= 2 {
+		c := q.size - 7
+		for dy := -2; dy <= 2; dy++ {
+			for dx := -2; dx <= 2; dx++ {
+				q.set(c+dx, c+dy, max(abs(dx), abs(dy)) != 1)
+			}
+		}
+	}
+	// reserve the format information
+	q.drawFormat(0)
+}
+
+// drawFormat draws the format information of level L and the mask
+func (q *qrCode) drawFormat(mask int) {
+	data := 0b01<<3 | mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := range 8 {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// drawCodewords places the codewords in the zigzag of two module columns,
+// from the bottom right corner
+func (q *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range q.size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if q.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				q.modules[y][x] = codewords[i>>3]>>(7-i&7)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask applies mask 0, (x+y) mod 2 == 0
+func (q *qrCode) applyMask() {
+	for y := range q.size {
+		for x := range q.size {
+			if !q.function[y][x] && (x+y)%2 == 0 {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// SVG renders the QR code with a quiet zone of 4 modules
+func (q *qrCode) SVG(moduleSize int) string {
+	const border = 4
+	side := (q.size + 2*border) * moduleSize
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		side, side, q.size+2*border, q.size+2*border)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="`)
+	for y := range q.size {
+		for x := range q.size {
+			if q.modules[y][x] {
+				fmt.Fprintf(&b, "M%d,%dh1v1h-1z", x+border, y+border)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String()
+}
+
+// rsDivisor returns the generator polynomial of degree n over GF(256),
+// coefficients from the highest degree, without the leading 1
+func rsDivisor(n int) []byte {
+	result := make([]byte, n)
+	result[n-1] = 1
+	root := byte(1)
+	for range n {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords of data
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMul multiplies in GF(256) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
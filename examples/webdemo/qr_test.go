@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// HELLO WORLD, version 1-Q (ISO/IEC 18004, annex I)
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236}
+	expected := []byte{168, 72, 22, 82, 217, 54, 156, 0, 46, 15, 180, 122, 16}
+	if ec := rsRemainder(data, rsDivisor(13)); !bytes.Equal(ec, expected) {
+		t.Fatalf("error correction codewords %v, expected %v", ec, expected)
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	q, err := encodeQR([]byte("openid4vp://?client_id=https%3A%2F%2Fverifier.example&request_uri=https%3A%2F%2Fverifier.example%2Frequests%2F0123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.size != 41 {
+		t.Fatalf("size %d, expected 41 (version 6)", q.size)
+	}
+	// format information of level L, mask 0: 111011111000100, top left row 8
+	format := []bool{true, true, true, false, true, true}
+	for x, dark := range format {
+		if q.modules[8][x] != dark {
+			t.Fatalf("format module %d is %v", x, q.modules[8][x])
+		}
+	}
+
+	if _, err := encodeQR(make([]byte, 135)); err == nil {
+		t.Fatal("expected an error beyond version 6")
+	}
+}
@@ -0,0 +1,156 @@
+// Package extension registers circuits of external packages with the
+// verification server and the prover farm, so proprietary circuits are served
+// without forking. A package registers its circuits in its init function:
+//
+//	func init() {
+//		extension.Register(myCircuit{})
+//	}
+//
+// and is linked in with a blank import, or built as a Go plugin loaded with
+// Open (build tag plugins). The server configuration still lists the circuit
+// and its verifying key: the registration contributes the template, the
+// payload schema and the decoders of the circuit.
+package extension
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/prover"
+)
+
+// ErrPluginsDisabled is returned by Open in a build without the build tag
+// plugins
+var ErrPluginsDisabled = errors.New("extension: built without plugin support (build tag plugins)")
+
+// Circuit is a circuit contributed by an external package
+type Circuit interface {
+	// ID is the circuit id, the key of the circuit in the server
+	// configuration and the circuit of the prove requests
+	ID() string
+	// Template returns the template the circuit was compiled with, its slices
+	// sized: the server labels the public inputs of the responses with it and
+	// locates the trust anchors of the policy in it
+	Template() frontend.Circuit
+}
+
+// Schemed is a Circuit with a payload schema, used when the server
+// configuration of the circuit has none
+type Schemed interface {
+	PayloadSchema() *models.PayloadSchema
+}
+
+// VerifierConfigurer is a Circuit adding decoders of its public inputs to the
+// verifier once its verifying key is loaded, e.g. with
+// PresentationVerifier.AddAttributes or AddRevocation
+type VerifierConfigurer interface {
+	ConfigureVerifier(v *models.PresentationVerifier) error
+}
+
+// WitnessMapper is a Circuit mapping the inputs of the prove requests to its
+// witness, e.g. with validators of its untrusted DER inputs; the input schema
+// of its template is used otherwise
+type WitnessMapper interface {
+	InputSchema() (*prover.InputSchema, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Circuit{}
+)
+
+// Register makes an external circuit available by id (Lookup). Register
+// panics if the id is registered twice, as database/sql.Register.
+func Register(c Circuit) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if c == nil || c.ID() == "" || strings.ContainsAny(c.ID(), " \t\n") || c.Template() == nil {
+		panic("extension: Register of an invalid circuit")
+	}
+	if _, dup := registry[c.ID()]; dup {
+		panic(fmt.Sprintf("extension: Register called twice for circuit %q", c.ID()))
+	}
+	registry[c.ID()] = c
+}
+
+// Lookup returns the registered circuit of the id
+func Lookup(id string) (Circuit, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := registry[id]
+	return c, ok
+}
+
+// Registered returns the sorted ids of the registered circuits
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	ids := make([]string, 0, len(registry))
+	for id := range registry {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// PayloadSchema returns the payload schema of the registered circuit of the
+// id, nil without one
+func PayloadSchema(id string) *models.PayloadSchema {
+	if c, ok := Lookup(id); ok {
+		if s, ok := c.(Schemed); ok {
+			return s.PayloadSchema()
+		}
+	}
+	return nil
+}
+
+// ConfigureVerifier adds the decoders of the registered circuit of the id to
+// the verifier, the circuit being added to it (AddCircuit). It does nothing
+// for an unregistered id or a circuit without decoders.
+func ConfigureVerifier(id string, v *models.PresentationVerifier) error {
+	c, ok := Lookup(id)
+	if !ok {
+		return nil
+	}
+	if vc, ok := c.(VerifierConfigurer); ok {
+		if err := vc.ConfigureVerifier(v); err != nil {
+			return fmt.Errorf("circuit %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// InputSchema returns the input schema of the registered circuit of the id
+func InputSchema(id string) (*prover.InputSchema, error) {
+	c, ok := Lookup(id)
+	if !ok {
+		return nil, fmt.Errorf("no circuit %q registered", id)
+	}
+	return inputSchema(c)
+}
+
+// RegisterInputs accepts the multipart prove requests of every registered
+// circuit served by the farm (Farm.Register)
+func RegisterInputs(f *prover.Farm) error {
+	for _, id := range Registered() {
+		c, _ := Lookup(id)
+		s, err := inputSchema(c)
+		if err != nil {
+			return fmt.Errorf("circuit %q: %w", id, err)
+		}
+		f.RegisterInputSchema(id, s)
+	}
+	return nil
+}
+
+func inputSchema(c Circuit) (*prover.InputSchema, error) {
+	if m, ok := c.(WitnessMapper); ok {
+		return m.InputSchema()
+	}
+	return prover.NewInputSchema(c.Template())
+}
@@ -0,0 +1,76 @@
+package extension
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/prover"
+)
+
+type sumCircuit struct {
+	A, B frontend.Variable
+	Sum  frontend.Variable `gnark:",public"`
+}
+
+func (c *sumCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Add(c.A, c.B), c.Sum)
+	return nil
+}
+
+type testCircuit struct {
+	id     string
+	schema *models.PayloadSchema
+}
+
+func (c testCircuit) ID() string                 { return c.id }
+func (c testCircuit) Template() frontend.Circuit { return &sumCircuit{} }
+
+// schemedCircuit is a testCircuit with a payload schema
+type schemedCircuit struct{ testCircuit }
+
+func (c schemedCircuit) PayloadSchema() *models.PayloadSchema { return c.schema }
+
+func TestRegister(t *testing.T) {
+	schema := &models.PayloadSchema{Required: []string{"nonce"}}
+	Register(testCircuit{id: "test/plain/v1"})
+	Register(schemedCircuit{testCircuit{id: "test/schemed/v1", schema: schema}})
+
+	if ids := Registered(); !slices.Contains(ids, "test/plain/v1") || !slices.Contains(ids, "test/schemed/v1") || !slices.IsSorted(ids) {
+		t.Fatalf("unexpected registered circuits %v", ids)
+	}
+	if _, ok := Lookup("test/unknown/v1"); ok {
+		t.Fatal("expected an unknown circuit")
+	}
+	if PayloadSchema("test/plain/v1") != nil || !reflect.DeepEqual(PayloadSchema("test/schemed/v1"), schema) {
+		t.Fatal("unexpected payload schemas")
+	}
+
+	for _, c := range []Circuit{testCircuit{id: "test/plain/v1"}, testCircuit{id: ""}, testCircuit{id: "test plain"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected Register of %q to panic", c.ID())
+				}
+			}()
+			Register(c)
+		}()
+	}
+
+	// the farm accepts the multipart prove requests of the registered
+	// circuits, with the inputs of their templates
+	if err := RegisterInputs(prover.NewFarm(nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if err := Open("missing.so"); err == nil {
+		t.Fatal("expected an error for a missing plugin")
+	} else if testing.Verbose() && errors.Is(err, ErrPluginsDisabled) {
+		t.Log("built without plugin support")
+	}
+}
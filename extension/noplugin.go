@@ -0,0 +1,19 @@
+//go:build !plugins
+
+package extension
+
+// PluginsEnabled reports whether Open loads plugins, in the builds with the
+// tag plugins
+const PluginsEnabled = false
+
+// Open loads the Go plugin at path, its init functions registering its
+// circuits. It needs the build tag plugins.
+func Open(path string) error {
+	return ErrPluginsDisabled
+}
+
+// OpenDir loads the Go plugins (*.so) of the directory. It needs the build
+// tag plugins.
+func OpenDir(dir string) error {
+	return ErrPluginsDisabled
+}
@@ -0,0 +1,41 @@
+//go:build plugins
+
+package extension
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+)
+
+// PluginsEnabled reports whether Open loads plugins, in the builds with the
+// tag plugins
+const PluginsEnabled = true
+
+// Open loads the Go plugin at path, its init functions registering its
+// circuits. The plugin must be built with the same toolchain and versions of
+// the shared packages (go build -buildmode=plugin).
+func Open(path string) error {
+	if _, err := plugin.Open(path); err != nil {
+		return fmt.Errorf("extension: %w", err)
+	}
+	return nil
+}
+
+// OpenDir loads the Go plugins (*.so) of the directory, in name order
+func OpenDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("extension: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".so" {
+			continue
+		}
+		if err := Open(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
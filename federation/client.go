@@ -0,0 +1,344 @@
+package federation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxPathLength bounds the superiors between an entity and its
+	// trust anchor when Client.MaxPathLength is 0
+	defaultMaxPathLength = 4
+	// defaultCacheTTL bounds the caching of a resolved entity when
+	// Client.CacheTTL is 0
+	defaultCacheTTL = time.Hour
+	// maxStatementSize bounds the fetched statements
+	maxStatementSize = 1 << 20
+	// maxClockSkew tolerates statements issued ahead of the clock
+	maxClockSkew = time.Minute
+)
+
+// Client resolves the trust chains of entities to its trust anchors. It is
+// safe for concurrent use.
+type Client struct {
+	// TrustAnchors are the federation keys of the trust anchors, by entity id
+	TrustAnchors map[string]JWKS
+	// HTTPClient fetches the statements, http.DefaultClient when nil
+	HTTPClient *http.Client
+	// MaxPathLength bounds the number of superiors between an entity and
+	// its trust anchor, 4 when 0
+	MaxPathLength int
+	// CacheTTL bounds the caching of a resolved entity, which is cached at
+	// most until its chain expires; an hour when 0
+	CacheTTL time.Duration
+	// Now is the clock the statements are checked against, time.Now when nil
+	Now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*Entity
+}
+
+// Entity is an entity with a valid trust chain
+type Entity struct {
+	// ID is the entity id
+	ID string
+	// TrustAnchor is the entity id of the trust anchor of the chain
+	TrustAnchor string
+	// Chain is the trust chain: the entity configuration of the entity, then
+	// the subordinate statements of its superiors up to the trust anchor
+	Chain []*EntityStatement
+	// TrustMarks are the types of the valid trust marks of the entity
+	TrustMarks []string
+	// ExpiresAt is the earliest exp of the chain
+	ExpiresAt time.Time
+
+	cachedUntil time.Time
+}
+
+// Configuration returns the entity configuration of the entity
+func (e *Entity) Configuration() *EntityStatement {
+	return e.Chain[0]
+}
+
+// HasTrustMark reports whether the entity has a valid trust mark of the type
+func (e *Entity) HasTrustMark(trustMarkType string) bool {
+	return slices.Contains(e.TrustMarks, trustMarkType)
+}
+
+// Keys returns the P-256 keys of the jwks of the metadata of the entity type,
+// e.g. the keys a credential issuer signs with (EntityTypeCredentialIssuer)
+func (e *Entity) Keys(entityType string) ([]*ecdsa.PublicKey, error) {
+	var metadata struct {
+		JWKS *JWKS `json:"jwks"`
+	}
+	ok, err := e.Configuration().metadata(entityType, &metadata)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || metadata.JWKS == nil {
+		return nil, fmt.Errorf("entity %q has no %s jwks", e.ID, entityType)
+	}
+	keys := make([]*ecdsa.PublicKey, 0, len(metadata.JWKS.Keys))
+	for _, k := range metadata.JWKS.Keys {
+		key, err := k.ECDSAPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("entity %q: %s jwks: %w", e.ID, entityType, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Resolve returns the entity with a valid trust chain to a trust anchor of
+// the client, ErrUntrusted without one. Trust marks that do not validate are
+// left out of Entity.TrustMarks. The entity is cached until its chain
+// expires, at most CacheTTL.
+func (c *Client) Resolve(ctx context.Context, entityID string) (*Entity, error) {
+	now := c.now()
+	c.mu.Lock()
+	cached, ok := c.cache[entityID]
+	c.mu.Unlock()
+	if ok && now.Before(cached.cachedUntil) {
+		return cached, nil
+	}
+
+	e, anchor, err := c.resolveChain(ctx, entityID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range e.Configuration().TrustMarks {
+		if err := c.verifyTrustMark(ctx, e, anchor, ref); err == nil && !e.HasTrustMark(ref.Type) {
+			e.TrustMarks = append(e.TrustMarks, ref.Type)
+		}
+	}
+	slices.Sort(e.TrustMarks)
+
+	ttl := c.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	e.cachedUntil = now.Add(ttl)
+	if e.ExpiresAt.Before(e.cachedUntil) {
+		e.cachedUntil = e.ExpiresAt
+	}
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = map[string]*Entity{}
+	}
+	c.cache[entityID] = e
+	c.mu.Unlock()
+	return e, nil
+}
+
+// resolveChain returns the entity with its trust chain, without its trust
+// marks, and the entity configuration of the trust anchor
+func (c *Client) resolveChain(ctx context.Context, entityID string) (*Entity, *EntityStatement, error) {
+	config, err := c.fetchConfiguration(ctx, entityID)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxPathLength := c.MaxPathLength
+	if maxPathLength <= 0 {
+		maxPathLength = defaultMaxPathLength
+	}
+	subordinates, anchor, err := c.chain(ctx, config, maxPathLength, map[string]bool{entityID: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("entity %q: %w", entityID, err)
+	}
+	e := &Entity{ID: entityID, TrustAnchor: anchor.Subject, Chain: append([]*EntityStatement{config}, subordinates...)}
+	for _, s := range e.Chain {
+		if exp := time.Unix(s.ExpiresAt, 0); e.ExpiresAt.IsZero() || exp.Before(e.ExpiresAt) {
+			e.ExpiresAt = exp
+		}
+	}
+	return e, anchor, nil
+}
+
+// chain returns the subordinate statements from the superior of the entity
+// of config up to a trust anchor, and the entity configuration of the trust
+// anchor. The superiors are tried in the order of the authority hints.
+func (c *Client) chain(ctx context.Context, config *EntityStatement, depth int, visited map[string]bool) ([]*EntityStatement, *EntityStatement, error) {
+	if keys, ok := c.TrustAnchors[config.Subject]; ok {
+		if err := config.verify(keys); err != nil {
+			return nil, nil, err
+		}
+		return nil, config, nil
+	}
+	if depth == 0 || len(config.AuthorityHints) == 0 {
+		return nil, nil, ErrUntrusted
+	}
+
+	var errs []error
+	for _, hint := range config.AuthorityHints {
+		if visited[hint] {
+			continue
+		}
+		visited[hint] = true
+		subordinates, anchor, err := c.superior(ctx, config, hint, depth, visited)
+		if err == nil {
+			return subordinates, anchor, nil
+		}
+		errs = append(errs, fmt.Errorf("superior %q: %w", hint, err))
+	}
+	if len(errs) == 0 {
+		return nil, nil, ErrUntrusted
+	}
+	return nil, nil, fmt.Errorf("%w: %w", ErrUntrusted, errors.Join(errs...))
+}
+
+// superior returns the chain of config through the superior hint
+func (c *Client) superior(ctx context.Context, config *EntityStatement, hint string, depth int, visited map[string]bool) ([]*EntityStatement, *EntityStatement, error) {
+	superior, err := c.fetchConfiguration(ctx, hint)
+	if err != nil {
+		return nil, nil, err
+	}
+	var metadata FederationMetadata
+	if ok, err := superior.metadata(EntityTypeFederation, &metadata); err != nil {
+		return nil, nil, err
+	} else if !ok || metadata.FetchEndpoint == "" {
+		return nil, nil, fmt.Errorf("no federation_fetch_endpoint")
+	}
+	subordinate, err := c.fetchSubordinate(ctx, metadata.FetchEndpoint, config.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subordinate.Issuer != hint || subordinate.Subject != config.Subject {
+		return nil, nil, fmt.Errorf("subordinate statement of %q about %q", subordinate.Issuer, subordinate.Subject)
+	}
+	if err := subordinate.verify(superior.JWKS); err != nil {
+		return nil, nil, err
+	}
+	// the superior vouches for the keys of the entity configuration
+	if err := config.verify(subordinate.JWKS); err != nil {
+		return nil, nil, err
+	}
+	subordinates, anchor, err := c.chain(ctx, superior, depth-1, visited)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append([]*EntityStatement{subordinate}, subordinates...), anchor, nil
+}
+
+// verifyTrustMark verifies a trust mark of the entity: issued to it by an
+// issuer the trust anchor allows for the type, which resolves to the same
+// trust anchor, and not expired
+func (c *Client) verifyTrustMark(ctx context.Context, e *Entity, anchor *EntityStatement, ref TrustMarkRef) error {
+	var mark TrustMark
+	signed, err := decodeJWS(ref.TrustMark, TrustMarkType, &mark)
+	if err != nil {
+		return fmt.Errorf("invalid trust mark: %w", err)
+	}
+	if mark.Subject != e.ID || mark.Type != ref.Type {
+		return fmt.Errorf("trust mark %q of %q for %q", mark.Type, mark.Issuer, mark.Subject)
+	}
+	if !slices.Contains(anchor.TrustMarkIssuers[mark.Type], mark.Issuer) {
+		return fmt.Errorf("%q may not issue trust marks %q", mark.Issuer, mark.Type)
+	}
+	if mark.ExpiresAt != 0 && !c.now().Before(time.Unix(mark.ExpiresAt, 0)) {
+		return fmt.Errorf("trust mark %q: %w", mark.Type, ErrExpired)
+	}
+	keys := e.Configuration().JWKS
+	if mark.Issuer != e.ID {
+		issuer, issuerAnchor, err := c.resolveChain(ctx, mark.Issuer)
+		if err != nil {
+			return err
+		}
+		if issuerAnchor.Subject != anchor.Subject {
+			return fmt.Errorf("trust mark issuer %q under trust anchor %q", mark.Issuer, issuerAnchor.Subject)
+		}
+		keys = issuer.Configuration().JWKS
+	}
+	return signed.verify(keys)
+}
+
+// fetchConfiguration fetches the entity configuration of the entity and
+// verifies it is self-signed and current
+func (c *Client) fetchConfiguration(ctx context.Context, entityID string) (*EntityStatement, error) {
+	u, err := url.Parse(entityID)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("invalid entity id %q", entityID)
+	}
+	s, err := c.fetch(ctx, strings.TrimSuffix(entityID, "/")+WellKnownPath)
+	if err != nil {
+		return nil, fmt.Errorf("entity configuration of %q: %w", entityID, err)
+	}
+	if s.Issuer != entityID || s.Subject != entityID {
+		return nil, fmt.Errorf("entity configuration of %q: iss %q, sub %q", entityID, s.Issuer, s.Subject)
+	}
+	if err := s.verify(s.JWKS); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// fetchSubordinate fetches the subordinate statement about sub from the
+// fetch endpoint of a superior
+func (c *Client) fetchSubordinate(ctx context.Context, endpoint, sub string) (*EntityStatement, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fetch endpoint %q", endpoint)
+	}
+	query := u.Query()
+	query.Set("sub", sub)
+	u.RawQuery = query.Encode()
+	s, err := c.fetch(ctx, u.String())
+	if err != nil {
+		return nil, fmt.Errorf("subordinate statement about %q: %w", sub, err)
+	}
+	return s, nil
+}
+
+// fetch fetches a signed statement and checks it is current, its signature
+// is not verified
+func (c *Client) fetch(ctx context.Context, rawURL string) (*EntityStatement, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/"+EntityStatementType)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxStatementSize))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	s, err := parseEntityStatement(string(body))
+	if err != nil {
+		return nil, err
+	}
+	now := c.now()
+	if time.Unix(s.IssuedAt, 0).After(now.Add(maxClockSkew)) {
+		return nil, fmt.Errorf("entity statement of %q issued in the future", s.Issuer)
+	}
+	if now.Unix() >= s.ExpiresAt {
+		return nil, fmt.Errorf("entity statement of %q about %q: %w", s.Issuer, s.Subject, ErrExpired)
+	}
+	return s, nil
+}
+
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,238 @@
+// Package federation resolves and validates OpenID Federation 1.0 trust
+// chains: the entity configuration an entity (issuer, verifier) publishes at
+// /.well-known/openid-federation, the subordinate statements its superiors
+// serve from their fetch endpoint about it, up to a trust anchor whose keys
+// are configured out of band, and the trust marks of the entity.
+//
+// Only ES256 statements are supported. The metadata policies of the
+// superiors are not applied: the metadata of a resolved entity is the one of
+// its entity configuration.
+package federation
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// Media types of the signed statements, the typ of their header
+const (
+	EntityStatementType = "entity-statement+jwt"
+	TrustMarkType       = "trust-mark+jwt"
+)
+
+// WellKnownPath is the path of the entity configurations
+const WellKnownPath = "/.well-known/openid-federation"
+
+// Entity types of the metadata
+const (
+	EntityTypeFederation       = "federation_entity"
+	EntityTypeCredentialIssuer = "openid_credential_issuer"
+	EntityTypeVerifier         = "openid_credential_verifier"
+)
+
+var (
+	// ErrUntrusted is returned for an entity without trust chain to a trust
+	// anchor of the client
+	ErrUntrusted = errors.New("no trust chain to a trust anchor")
+	// ErrExpired is returned for a statement or a trust mark past its exp
+	ErrExpired = errors.New("statement expired")
+)
+
+// JWKS is a JSON Web Key Set of P-256 keys
+type JWKS struct {
+	Keys []models.JWK `json:"keys"`
+}
+
+// key returns the key of the kid, the only key without kid
+func (s JWKS) key(kid string) (*ecdsa.PublicKey, error) {
+	for _, k := range s.Keys {
+		if k.Kid == kid || kid == "" && len(s.Keys) == 1 {
+			return k.ECDSAPublicKey()
+		}
+	}
+	return nil, fmt.Errorf("no key %q", kid)
+}
+
+// EntityStatement is a signed statement of an issuer about a subject: an
+// entity configuration when both are the entity, a subordinate statement of
+// a superior otherwise
+type EntityStatement struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// JWKS are the federation keys of the subject
+	JWKS JWKS `json:"jwks"`
+	// AuthorityHints are the superiors of the entity, in its entity
+	// configuration
+	AuthorityHints []string `json:"authority_hints,omitempty"`
+	// Metadata is the metadata of the entity by entity type
+	Metadata map[string]json.RawMessage `json:"metadata,omitempty"`
+	// TrustMarks are the trust marks of the entity, in its entity
+	// configuration
+	TrustMarks []TrustMarkRef `json:"trust_marks,omitempty"`
+	// TrustMarkIssuers are the entities allowed to issue the trust marks of
+	// a type, in the entity configuration of a trust anchor
+	TrustMarkIssuers map[string][]string `json:"trust_mark_issuers,omitempty"`
+
+	// signed is the signed statement, the entity configurations are
+	// verified with the keys of the subordinate statement of their superior
+	signed *jws
+}
+
+// TrustMarkRef is a trust mark of an entity configuration
+type TrustMarkRef struct {
+	Type      string `json:"trust_mark_type"`
+	TrustMark string `json:"trust_mark"`
+}
+
+// TrustMark is the payload of a signed trust mark
+type TrustMark struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Type      string `json:"trust_mark_type"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// FederationMetadata is the federation_entity metadata of the superiors
+type FederationMetadata struct {
+	FetchEndpoint string `json:"federation_fetch_endpoint,omitempty"`
+}
+
+// jwsHeader is the protected header of the statements and the trust marks
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// SignEntityStatement signs the statement (JWS ES256, compact serialization)
+// with the federation key kid of its issuer
+func SignEntityStatement(s EntityStatement, key *ecdsa.PrivateKey, kid string) (string, error) {
+	return signJWS(EntityStatementType, kid, s, key)
+}
+
+// SignTrustMark signs the trust mark with the federation key kid of its
+// issuer
+func SignTrustMark(m TrustMark, key *ecdsa.PrivateKey, kid string) (string, error) {
+	return signJWS(TrustMarkType, kid, m, key)
+}
+
+// parseEntityStatement decodes a signed statement, its signature is not
+// verified
+func parseEntityStatement(compact string) (*EntityStatement, error) {
+	var s EntityStatement
+	signed, err := decodeJWS(compact, EntityStatementType, &s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid entity statement: %w", err)
+	}
+	if s.Issuer == "" || s.Subject == "" {
+		return nil, fmt.Errorf("invalid entity statement: no iss or sub")
+	}
+	s.signed = signed
+	return &s, nil
+}
+
+// verify verifies the signature of the statement with a key of keys
+func (s *EntityStatement) verify(keys JWKS) error {
+	if err := s.signed.verify(keys); err != nil {
+		return fmt.Errorf("entity statement of %q about %q: %w", s.Issuer, s.Subject, err)
+	}
+	return nil
+}
+
+// metadata decodes the metadata of an entity type, false without it
+func (s *EntityStatement) metadata(entityType string, v any) (bool, error) {
+	raw, ok := s.Metadata[entityType]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, fmt.Errorf("invalid %s metadata of %q: %w", entityType, s.Subject, err)
+	}
+	return true, nil
+}
+
+func signJWS(typ, kid string, payload any, key *ecdsa.PrivateKey) (string, error) {
+	headerJSON, err := json.Marshal(jwsHeader{Alg: "ES256", Typ: typ, Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64(headerJSON) + "." + b64(payloadJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("ES256 signature failed: %w", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signingInput + "." + b64(signature), nil
+}
+
+// jws is a decoded compact JWS
+type jws struct {
+	header       jwsHeader
+	signingInput string
+	signature    []byte
+}
+
+// decodeJWS decodes a JWS of type typ and its payload, its signature is not
+// verified
+func decodeJWS(compact, typ string, payload any) (*jws, error) {
+	parts := strings.Split(strings.TrimSpace(compact), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected 3 parts, got %d", len(parts))
+	}
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, fmt.Errorf("part %d: %w", i, err)
+		}
+	}
+	j := &jws{signingInput: parts[0] + "." + parts[1], signature: decoded[2]}
+	if err := json.Unmarshal(decoded[0], &j.header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	if j.header.Alg != "ES256" || j.header.Typ != typ {
+		return nil, fmt.Errorf("header: alg %q, typ %q", j.header.Alg, j.header.Typ)
+	}
+	if err := json.Unmarshal(decoded[1], payload); err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	return j, nil
+}
+
+// verify verifies the ES256 signature of the JWS with the key of its kid
+func (j *jws) verify(keys JWKS) error {
+	key, err := keys.key(j.header.Kid)
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	if len(j.signature) != 64 {
+		return fmt.Errorf("signature: invalid ES256 signature")
+	}
+	digest := sha256.Sum256([]byte(j.signingInput))
+	r, s := new(big.Int).SetBytes(j.signature[:32]), new(big.Int).SetBytes(j.signature[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return fmt.Errorf("signature: verification failed")
+	}
+	return nil
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
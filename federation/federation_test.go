@@ -0,0 +1,179 @@
+package federation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// testEntity is an entity of the test federation, its id a path of the
+// federation server
+type testEntity struct {
+	path string
+	key  *ecdsa.PrivateKey
+	// superior is the path of the superior, empty for the trust anchor
+	superior string
+	// config completes the entity configuration
+	config func(s *EntityStatement)
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func jwks(t *testing.T, key *ecdsa.PrivateKey, kid string) JWKS {
+	t.Helper()
+	public, err := key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := models.NewJWK(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk.Kid = kid
+	return JWKS{Keys: []models.JWK{jwk}}
+}
+
+// newFederation serves the entity configurations and the fetch endpoints of
+// the entities, it returns the base URL and the request counter
+func newFederation(t *testing.T, now time.Time, entities ...*testEntity) (string, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	var base string
+	byPath := map[string]*testEntity{}
+	for _, e := range entities {
+		byPath[e.path] = e
+	}
+	sign := func(w http.ResponseWriter, s EntityStatement, key *ecdsa.PrivateKey, kid string) {
+		compact, err := SignEntityStatement(s, key, kid)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/"+EntityStatementType)
+		w.Write([]byte(compact))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		path, ok := strings.CutSuffix(r.URL.Path, WellKnownPath)
+		if e := byPath[path]; ok && e != nil {
+			s := EntityStatement{Issuer: base + path, Subject: base + path, IssuedAt: now.Unix(), ExpiresAt: now.Add(24 * time.Hour).Unix(), JWKS: jwks(t, e.key, path)}
+			if e.superior != "" {
+				s.AuthorityHints = []string{base + e.superior}
+			}
+			s.Metadata = map[string]json.RawMessage{EntityTypeFederation: json.RawMessage(`{"federation_fetch_endpoint": "` + base + path + `/fetch"}`)}
+			if e.config != nil {
+				e.config(&s)
+			}
+			sign(w, s, e.key, path)
+			return
+		}
+		path, ok = strings.CutSuffix(r.URL.Path, "/fetch")
+		sub := byPath[strings.TrimPrefix(r.URL.Query().Get("sub"), base)]
+		if e := byPath[path]; ok && e != nil && sub != nil && sub.superior == path {
+			s := EntityStatement{Issuer: base + path, Subject: base + sub.path, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix(), JWKS: jwks(t, sub.key, sub.path)}
+			sign(w, s, e.key, path)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	base = srv.URL
+	return base, &requests
+}
+
+func TestResolve(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	anchor := &testEntity{path: "/ta", key: newKey(t)}
+	intermediate := &testEntity{path: "/intermediate", key: newKey(t), superior: "/ta"}
+	markIssuer := &testEntity{path: "/marks", key: newKey(t), superior: "/ta"}
+	issuer := &testEntity{path: "/issuer", key: newKey(t), superior: "/intermediate"}
+	issuerKey := newKey(t)
+
+	var base string
+	anchor.config = func(s *EntityStatement) {
+		s.TrustMarkIssuers = map[string][]string{"https://marks.example/pid-provider": {base + "/marks"}}
+	}
+	issuer.config = func(s *EntityStatement) {
+		issuerJWKS, _ := json.Marshal(map[string]JWKS{"jwks": jwks(t, issuerKey, "")})
+		s.Metadata[EntityTypeCredentialIssuer] = issuerJWKS
+		mark := func(typ string, key *ecdsa.PrivateKey, by string) TrustMarkRef {
+			compact, err := SignTrustMark(TrustMark{Issuer: base + by, Subject: base + "/issuer", Type: typ, IssuedAt: now.Unix()}, key, by)
+			if err != nil {
+				t.Error(err)
+			}
+			return TrustMarkRef{Type: typ, TrustMark: compact}
+		}
+		s.TrustMarks = []TrustMarkRef{
+			mark("https://marks.example/pid-provider", markIssuer.key, "/marks"),
+			// not an issuer of the type for the trust anchor
+			mark("https://marks.example/qeaa-provider", markIssuer.key, "/marks"),
+		}
+	}
+	base, requests := newFederation(t, now, anchor, intermediate, markIssuer, issuer)
+
+	client := &Client{TrustAnchors: map[string]JWKS{base + "/ta": jwks(t, anchor.key, "/ta")}, Now: func() time.Time { return now }}
+	e, err := client.Resolve(t.Context(), base+"/issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.TrustAnchor != base+"/ta" || len(e.Chain) != 3 || e.Chain[1].Issuer != base+"/intermediate" || e.Chain[2].Issuer != base+"/ta" {
+		t.Fatalf("unexpected chain to %s of %d statements", e.TrustAnchor, len(e.Chain))
+	}
+	if !reflect.DeepEqual(e.TrustMarks, []string{"https://marks.example/pid-provider"}) {
+		t.Fatalf("unexpected trust marks %v", e.TrustMarks)
+	}
+	if !e.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected expiry %v", e.ExpiresAt)
+	}
+	keys, err := e.Keys(EntityTypeCredentialIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || !keys[0].Equal(&issuerKey.PublicKey) {
+		t.Fatal("unexpected credential issuer keys")
+	}
+
+	// cached until the chain expires
+	n := requests.Load()
+	if _, err := client.Resolve(t.Context(), base+"/issuer"); err != nil || requests.Load() != n {
+		t.Fatalf("expected a cached entity, %d requests more: %v", requests.Load()-n, err)
+	}
+
+	// another trust anchor, or the same with other keys
+	for _, anchors := range []map[string]JWKS{
+		{base + "/intermediate-2": jwks(t, intermediate.key, "/intermediate")},
+		{base + "/ta": jwks(t, newKey(t), "/ta")},
+	} {
+		other := &Client{TrustAnchors: anchors, Now: func() time.Time { return now }}
+		if _, err := other.Resolve(t.Context(), base+"/issuer"); err == nil {
+			t.Fatal("expected an untrusted entity")
+		}
+	}
+	other := &Client{TrustAnchors: map[string]JWKS{base + "/ta": jwks(t, anchor.key, "/ta")}, MaxPathLength: 1, Now: func() time.Time { return now }}
+	if _, err := other.Resolve(t.Context(), base+"/issuer"); !errors.Is(err, ErrUntrusted) {
+		t.Fatalf("expected ErrUntrusted beyond the path length, got %v", err)
+	}
+
+	// expired subordinate statements
+	later := &Client{TrustAnchors: client.TrustAnchors, Now: func() time.Time { return now.Add(2 * time.Hour) }}
+	if _, err := later.Resolve(t.Context(), base+"/issuer"); err == nil {
+		t.Fatal("expected an expired chain")
+	}
+}
@@ -0,0 +1,526 @@
+// Package loadtest simulates the holders of a relying party to plan the
+// capacity of a deployment: N concurrent holders send the prove requests of
+// their credentials to a prover farm (package prover) and verify the
+// resulting proofs on a verification server (package server), at the
+// arrival rates of successive stages:
+//
+//	holders   ──prove──▶  POST {prover}/circuits/{circuit}/prove
+//	          ──verify─▶  POST {verifier}/verify
+//
+// The prove requests are the named inputs of a Workload, e.g. PoPWorkload
+// generating certificates and challenge signatures with package datagen. The
+// verify requests verify a proof obtained by an earlier prove request. The
+// report gives the latency percentiles, the error rates and the first stage
+// where the deployment saturates. Latencies are measured from the scheduled
+// arrival, so the time a request waits for a free holder counts: a saturated
+// deployment is not hidden by the holders slowing down.
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mynextid/eudi-zk/prover"
+	"github.com/mynextid/eudi-zk/server"
+)
+
+// Op is an operation of a holder
+type Op string
+
+const (
+	OpProve  Op = "prove"
+	OpVerify Op = "verify"
+)
+
+// Error classes of the report besides the HTTP status codes
+const (
+	// ErrorDropped is an arrival without a free holder
+	ErrorDropped = "dropped"
+	// ErrorInvalid is a proof the verifier found invalid
+	ErrorInvalid = "invalid"
+	// ErrorTransport is a request without response: timeout, connection
+	// refused or reset
+	ErrorTransport = "transport"
+)
+
+// Workload generates the prove requests of the holders
+type Workload interface {
+	// Inputs returns the named inputs of the seq-th prove request of the
+	// holder (prover.ProveRequest.Inputs)
+	Inputs(holder, seq int) (map[string]json.RawMessage, error)
+}
+
+// Stage is a period of the load test at an arrival rate
+type Stage struct {
+	// Rate is the arrival rate in requests per second, the arrivals are
+	// Poisson distributed; 0 runs the holders back-to-back (closed loop)
+	Rate     float64
+	Duration time.Duration
+}
+
+// Config configures a load test
+type Config struct {
+	// ProverURL is the base URL of the prover farm
+	ProverURL string
+	// VerifierURL is the base URL of the verification server, required with
+	// a VerifyRatio
+	VerifierURL string
+	// Circuit is the circuit of the prover farm
+	Circuit string
+	// VerifierCircuit is the circuit id of the verification server, Circuit
+	// when empty
+	VerifierCircuit string
+	// APIKey is the bearer token of the verification server, optional
+	APIKey string
+	// Holders is the number of concurrent holders
+	Holders int
+	Stages  []Stage
+	// VerifyRatio is the share of verify requests, from 0 to 1. A verify
+	// request before the first proof is a prove request.
+	VerifyRatio float64
+	Workload    Workload
+	// Client sends the requests, http.DefaultClient when nil
+	Client *http.Client
+	// Timeout bounds a request, 2 minutes when 0
+	Timeout time.Duration
+	// MaxErrorRate is the error rate of a saturated stage, 1% when 0
+	MaxErrorRate float64
+	// MaxP99 is the 99th percentile latency of a saturated stage, unbounded
+	// when 0
+	MaxP99 time.Duration
+	// Seed seeds the arrivals and the request mix
+	Seed uint64
+}
+
+// Percentiles are latency percentiles
+type Percentiles struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// OpStats are the results of the requests of an operation in a stage
+type OpStats struct {
+	Requests int `json:"requests"`
+	Errors   int `json:"errors"`
+	// ErrorRate is Errors over Requests
+	ErrorRate float64 `json:"error_rate"`
+	// Throughput is the successful requests per second
+	Throughput float64 `json:"throughput"`
+	// Latency is the latency of the successful requests
+	Latency Percentiles `json:"latency"`
+	// ErrorClasses count the errors by HTTP status code or class
+	// (ErrorInvalid, ErrorTransport)
+	ErrorClasses map[string]int `json:"error_classes,omitempty"`
+
+	latencies []time.Duration
+}
+
+// StageReport are the results of a stage
+type StageReport struct {
+	Rate     float64       `json:"rate"`
+	Duration time.Duration `json:"duration"`
+	// Offered are the arrivals of the stage, Dropped those without a free
+	// holder
+	Offered int             `json:"offered"`
+	Dropped int             `json:"dropped"`
+	Ops     map[Op]*OpStats `json:"ops"`
+	// Saturated is set when the stage exceeds the error rate or latency
+	// bound, or its throughput is below 90% of its open-loop arrivals
+	Saturated bool   `json:"saturated"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Report are the results of a load test
+type Report struct {
+	Circuit string        `json:"circuit"`
+	Holders int           `json:"holders"`
+	Stages  []StageReport `json:"stages"`
+	// SaturationRate is the rate of the first saturated stage, 0 when none
+	// saturated
+	SaturationRate float64 `json:"saturation_rate,omitempty"`
+	// Saturated is set when a stage saturated, closed-loop stages included
+	Saturated bool `json:"saturated"`
+}
+
+// proof is a proof obtained by a prove request, for the verify requests
+type proof struct {
+	proof, publicWitness []byte
+}
+
+// maxProofs bounds the proofs kept for the verify requests
+const maxProofs = 256
+
+// runner runs a load test
+type runner struct {
+	cfg Config
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	proofs []proof
+	next   int
+	seq    []int
+	stage  *StageReport
+}
+
+// Run runs the stages of the load test in turn and reports their results.
+// Canceling ctx stops the test, the stages run so far are reported.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.ProverURL == "" || cfg.Circuit == "" {
+		return nil, errors.New("a prover URL and a circuit are required")
+	}
+	if cfg.Workload == nil {
+		return nil, errors.New("a workload is required")
+	}
+	if cfg.Holders <= 0 {
+		return nil, fmt.Errorf("invalid number of holders %d", cfg.Holders)
+	}
+	if cfg.VerifyRatio < 0 || cfg.VerifyRatio > 1 {
+		return nil, fmt.Errorf("invalid verify ratio %v", cfg.VerifyRatio)
+	}
+	if cfg.VerifyRatio > 0 && cfg.VerifierURL == "" {
+		return nil, errors.New("verify requests need a verifier URL")
+	}
+	if len(cfg.Stages) == 0 {
+		return nil, errors.New("no stages")
+	}
+	for _, s := range cfg.Stages {
+		if s.Rate < 0 || s.Duration <= 0 {
+			return nil, fmt.Errorf("invalid stage of %v requests/s for %v", s.Rate, s.Duration)
+		}
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 2 * time.Minute
+	}
+	if cfg.MaxErrorRate == 0 {
+		cfg.MaxErrorRate = 0.01
+	}
+	if cfg.VerifierCircuit == "" {
+		cfg.VerifierCircuit = cfg.Circuit
+	}
+
+	r := &runner{cfg: cfg, rng: rand.New(rand.NewPCG(cfg.Seed, cfg.Seed^0x9e3779b97f4a7c15)), seq: make([]int, cfg.Holders)}
+	report := &Report{Circuit: cfg.Circuit, Holders: cfg.Holders}
+	for _, s := range cfg.Stages {
+		if ctx.Err() != nil {
+			break
+		}
+		stage := r.runStage(ctx, s)
+		report.Stages = append(report.Stages, *stage)
+		if stage.Saturated {
+			if !report.Saturated && s.Rate > 0 {
+				report.SaturationRate = s.Rate
+			}
+			report.Saturated = true
+		}
+	}
+	return report, nil
+}
+
+// arrival is a request scheduled for a holder
+type arrival struct {
+	at time.Time
+}
+
+// runStage runs a stage: the arrivals of an open-loop stage are queued to
+// the holders, at most one waiting per holder; the holders of a closed-loop
+// stage send their requests back-to-back
+func (r *runner) runStage(ctx context.Context, s Stage) *StageReport {
+	stage := &StageReport{Rate: s.Rate, Duration: s.Duration, Ops: map[Op]*OpStats{}}
+	r.mu.Lock()
+	r.stage = stage
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, s.Duration)
+	defer cancel()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	if s.Rate == 0 {
+		for holder := range r.cfg.Holders {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					r.mu.Lock()
+					stage.Offered++
+					r.mu.Unlock()
+					r.request(ctx, holder, time.Now())
+				}
+			}()
+		}
+		wg.Wait()
+	} else {
+		arrivals := make(chan arrival, r.cfg.Holders)
+		for holder := range r.cfg.Holders {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for a := range arrivals {
+					r.request(ctx, holder, a.at)
+				}
+			}()
+		}
+		at := start
+		for {
+			r.mu.Lock()
+			at = at.Add(time.Duration(r.rng.ExpFloat64() / s.Rate * float64(time.Second)))
+			r.mu.Unlock()
+			if at.Sub(start) >= s.Duration {
+				break
+			}
+			timer := time.NewTimer(time.Until(at))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			r.mu.Lock()
+			stage.Offered++
+			r.mu.Unlock()
+			select {
+			case arrivals <- arrival{at: at}:
+			default:
+				r.mu.Lock()
+				stage.Dropped++
+				r.mu.Unlock()
+			}
+		}
+		close(arrivals)
+		wg.Wait()
+	}
+
+	r.summarize(stage, time.Since(start))
+	return stage
+}
+
+// request sends a request of the holder scheduled at at
+func (r *runner) request(ctx context.Context, holder int, at time.Time) {
+	r.mu.Lock()
+	op := OpProve
+	var p proof
+	if len(r.proofs) > 0 && r.rng.Float64() < r.cfg.VerifyRatio {
+		op, p = OpVerify, r.proofs[r.rng.IntN(len(r.proofs))]
+	}
+	seq := r.seq[holder]
+	r.seq[holder]++
+	r.mu.Unlock()
+
+	// a request cut by the end of the stage is not counted
+	reqCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.Timeout)
+	defer cancel()
+	var class string
+	var err error
+	switch op {
+	case OpProve:
+		var res *prover.Result
+		res, class, err = r.prove(reqCtx, holder, seq)
+		if err == nil {
+			r.keep(proof{proof: res.Proof, publicWitness: res.PublicWitness})
+		}
+	case OpVerify:
+		class, err = r.verify(reqCtx, p)
+	}
+	latency := time.Since(at)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stage.Ops[op]
+	if stats == nil {
+		stats = &OpStats{ErrorClasses: map[string]int{}}
+		r.stage.Ops[op] = stats
+	}
+	stats.Requests++
+	if err != nil {
+		stats.Errors++
+		stats.ErrorClasses[class]++
+		return
+	}
+	stats.latencies = append(stats.latencies, latency)
+}
+
+// keep keeps a proof for the verify requests, replacing the oldest one past
+// maxProofs
+func (r *runner) keep(p proof) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.proofs) < maxProofs {
+		r.proofs = append(r.proofs, p)
+		return
+	}
+	r.proofs[r.next] = p
+	r.next = (r.next + 1) % maxProofs
+}
+
+// prove sends a prove request of the holder and returns its result, or the
+// error and its class
+func (r *runner) prove(ctx context.Context, holder, seq int) (*prover.Result, string, error) {
+	inputs, err := r.cfg.Workload.Inputs(holder, seq)
+	if err != nil {
+		return nil, "workload", err
+	}
+	body, err := json.Marshal(prover.ProveRequest{Inputs: inputs})
+	if err != nil {
+		return nil, "workload", err
+	}
+	var res prover.Result
+	endpoint := strings.TrimSuffix(r.cfg.ProverURL, "/") + "/circuits/" + url.PathEscape(r.cfg.Circuit) + "/prove"
+	if class, err := r.post(ctx, endpoint, "", body, &res); err != nil {
+		return nil, class, err
+	}
+	return &res, "", nil
+}
+
+// verify sends a verify request of the proof
+func (r *runner) verify(ctx context.Context, p proof) (string, error) {
+	body, err := json.Marshal(server.VerifyRequest{Circuit: r.cfg.VerifierCircuit, Proof: p.proof, PublicWitness: p.publicWitness})
+	if err != nil {
+		return "workload", err
+	}
+	var res server.VerifyResponse
+	if class, err := r.post(ctx, strings.TrimSuffix(r.cfg.VerifierURL, "/")+"/verify", r.cfg.APIKey, body, &res); err != nil {
+		return class, err
+	}
+	if !res.Valid {
+		return ErrorInvalid, errors.New("invalid proof")
+	}
+	return "", nil
+}
+
+// post sends a JSON request and decodes the response, the error class being
+// the status code of an error response
+func (r *runner) post(ctx context.Context, endpoint, bearer string, body []byte, res any) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return ErrorTransport, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := r.cfg.Client.Do(req)
+	if err != nil {
+		return ErrorTransport, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return strconv.Itoa(resp.StatusCode), fmt.Errorf("%s: %s", endpoint, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return ErrorTransport, err
+	}
+	return "", nil
+}
+
+// summarize computes the rates and percentiles of the stage and whether it
+// saturated
+func (r *runner) summarize(stage *StageReport, elapsed time.Duration) {
+	var requests, errs, succeeded int
+	var p99 time.Duration
+	for _, stats := range stage.Ops {
+		if stats.Requests > 0 {
+			stats.ErrorRate = float64(stats.Errors) / float64(stats.Requests)
+		}
+		stats.Throughput = float64(len(stats.latencies)) / elapsed.Seconds()
+		stats.Latency = percentiles(stats.latencies)
+		requests += stats.Requests
+		errs += stats.Errors
+		succeeded += len(stats.latencies)
+		p99 = max(p99, stats.Latency.P99)
+	}
+
+	var reasons []string
+	if offered := requests + stage.Dropped; offered > 0 {
+		if rate := float64(errs+stage.Dropped) / float64(offered); rate > r.cfg.MaxErrorRate {
+			reasons = append(reasons, fmt.Sprintf("error rate %.1f%% above %.1f%%", 100*rate, 100*r.cfg.MaxErrorRate))
+		}
+	}
+	if r.cfg.MaxP99 > 0 && p99 > r.cfg.MaxP99 {
+		reasons = append(reasons, fmt.Sprintf("p99 latency %v above %v", p99.Round(time.Millisecond), r.cfg.MaxP99))
+	}
+	// the requests still queued at the end of the stage delay its end: the
+	// throughput falls behind the arrival rate
+	if stage.Rate > 0 {
+		offered := float64(stage.Offered) / stage.Duration.Seconds()
+		if throughput := float64(succeeded) / elapsed.Seconds(); throughput < 0.9*offered {
+			reasons = append(reasons, fmt.Sprintf("throughput %.2f/s below the arrival rate %.2f/s", throughput, offered))
+		}
+	}
+	stage.Saturated = len(reasons) > 0
+	stage.Reason = strings.Join(reasons, ", ")
+}
+
+// percentiles returns the nearest-rank percentiles of the latencies
+func percentiles(latencies []time.Duration) Percentiles {
+	if len(latencies) == 0 {
+		return Percentiles{}
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	rank := func(p float64) time.Duration {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[max(i, 0)]
+	}
+	return Percentiles{P50: rank(0.50), P90: rank(0.90), P95: rank(0.95), P99: rank(0.99), Max: sorted[len(sorted)-1]}
+}
+
+// WriteTo writes the report as a table, a line per stage and operation
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "circuit %s, %d holders\n", r.Circuit, r.Holders)
+	tw := tabwriter.NewWriter(&sb, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "rate/s\top\trequests\terrors\tthroughput/s\tp50\tp90\tp95\tp99\tmax\t")
+	for _, stage := range r.Stages {
+		rate := "closed"
+		if stage.Rate > 0 {
+			rate = strconv.FormatFloat(stage.Rate, 'f', -1, 64)
+		}
+		for _, op := range []Op{OpProve, OpVerify} {
+			stats, ok := stage.Ops[op]
+			if !ok {
+				continue
+			}
+			l := stats.Latency
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d (%.1f%%)\t%.2f\t%v\t%v\t%v\t%v\t%v\t\n", rate, op, stats.Requests, stats.Errors, 100*stats.ErrorRate, stats.Throughput,
+				l.P50.Round(time.Millisecond), l.P90.Round(time.Millisecond), l.P95.Round(time.Millisecond), l.P99.Round(time.Millisecond), l.Max.Round(time.Millisecond))
+		}
+		if stage.Dropped > 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t\t\t\t\t\t\t\t\n", rate, ErrorDropped, stage.Dropped)
+		}
+	}
+	tw.Flush()
+	for _, stage := range r.Stages {
+		if stage.Saturated {
+			fmt.Fprintf(&sb, "saturated at %v requests/s: %s\n", stage.Rate, stage.Reason)
+			break
+		}
+	}
+	if !r.Saturated {
+		sb.WriteString("not saturated\n")
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
@@ -0,0 +1,234 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/prover"
+	"github.com/mynextid/eudi-zk/server"
+)
+
+// staticWorkload returns the same inputs to every holder
+type staticWorkload struct{}
+
+func (staticWorkload) Inputs(holder, seq int) (map[string]json.RawMessage, error) {
+	return map[string]json.RawMessage{"X": json.RawMessage("1")}, nil
+}
+
+// stubs returns a prover farm and a verification server answering after
+// delay, the prover failing with status when not 0
+func stubs(t *testing.T, delay time.Duration, status int, verified *atomic.Int64) (string, string) {
+	t.Helper()
+	farm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/circuits/pop/prove" {
+			http.NotFound(w, r)
+			return
+		}
+		var req prover.ProveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || string(req.Inputs["X"]) != "1" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		time.Sleep(delay)
+		if status != 0 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "busy", status)
+			return
+		}
+		json.NewEncoder(w).Encode(prover.Result{Proof: []byte("proof"), PublicWitness: []byte("witness")})
+	}))
+	t.Cleanup(farm.Close)
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req server.VerifyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		verified.Add(1)
+		json.NewEncoder(w).Encode(server.VerifyResponse{Valid: req.Circuit == "pop-v1" && string(req.Proof) == "proof"})
+	}))
+	t.Cleanup(verifier.Close)
+	return farm.URL, verifier.URL
+}
+
+func TestRun(t *testing.T) {
+	var verified atomic.Int64
+	farm, verifier := stubs(t, time.Millisecond, 0, &verified)
+	report, err := Run(context.Background(), Config{
+		ProverURL:       farm,
+		VerifierURL:     verifier,
+		Circuit:         "pop",
+		VerifierCircuit: "pop-v1",
+		APIKey:          "key",
+		Holders:         4,
+		Stages:          []Stage{{Rate: 0, Duration: 200 * time.Millisecond}, {Rate: 100, Duration: 300 * time.Millisecond}},
+		VerifyRatio:     0.5,
+		Workload:        staticWorkload{},
+		Seed:            1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Stages) != 2 || report.Saturated {
+		t.Fatalf("report %+v", report)
+	}
+	for _, stage := range report.Stages {
+		prove, verify := stage.Ops[OpProve], stage.Ops[OpVerify]
+		if prove == nil || verify == nil || prove.Errors != 0 || verify.Errors != 0 {
+			t.Fatalf("stage %+v", stage)
+		}
+		if prove.Latency.P50 < time.Millisecond || prove.Latency.P99 < prove.Latency.P50 || prove.Latency.Max < prove.Latency.P99 {
+			t.Errorf("prove latency %+v", prove.Latency)
+		}
+	}
+	if verified.Load() == 0 {
+		t.Error("no verify requests")
+	}
+
+	var buf bytes.Buffer
+	if _, err := report.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "closed") || !strings.Contains(out, "verify") || !strings.Contains(out, "not saturated") {
+		t.Errorf("report:\n%s", out)
+	}
+}
+
+func TestRunSaturation(t *testing.T) {
+	var verified atomic.Int64
+
+	// one holder and 20ms per proof complete 50 proofs/s at most
+	farm, _ := stubs(t, 20*time.Millisecond, 0, &verified)
+	report, err := Run(context.Background(), Config{
+		ProverURL: farm,
+		Circuit:   "pop",
+		Holders:   1,
+		Stages:    []Stage{{Rate: 10, Duration: 500 * time.Millisecond}, {Rate: 400, Duration: 500 * time.Millisecond}},
+		Workload:  staticWorkload{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Stages[0].Saturated || !report.Stages[1].Saturated || report.SaturationRate != 400 {
+		t.Fatalf("report %+v", report)
+	}
+	if report.Stages[1].Dropped == 0 {
+		t.Errorf("no arrival dropped at 400/s: %+v", report.Stages[1])
+	}
+
+	// errors above the error rate saturate
+	farm, _ = stubs(t, 0, http.StatusServiceUnavailable, &verified)
+	report, err = Run(context.Background(), Config{
+		ProverURL: farm,
+		Circuit:   "pop",
+		Holders:   2,
+		Stages:    []Stage{{Duration: 100 * time.Millisecond}},
+		Workload:  staticWorkload{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prove := report.Stages[0].Ops[OpProve]
+	if !report.Saturated || report.SaturationRate != 0 || prove.ErrorRate != 1 || prove.ErrorClasses["503"] != prove.Errors {
+		t.Fatalf("report %+v, prove %+v", report, prove)
+	}
+	if !strings.Contains(report.Stages[0].Reason, "error rate") {
+		t.Errorf("reason %q", report.Stages[0].Reason)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	valid := Config{ProverURL: "http://prover", Circuit: "pop", Holders: 1, Stages: []Stage{{Duration: time.Second}}, Workload: staticWorkload{}}
+	for name, mutate := range map[string]func(*Config){
+		"no prover":   func(c *Config) { c.ProverURL = "" },
+		"no workload": func(c *Config) { c.Workload = nil },
+		"no holders":  func(c *Config) { c.Holders = 0 },
+		"no stages":   func(c *Config) { c.Stages = nil },
+		"no verifier": func(c *Config) { c.VerifyRatio = 0.5 },
+		"ratio":       func(c *Config) { c.VerifyRatio = 2 },
+		"rate":        func(c *Config) { c.Stages = []Stage{{Rate: -1, Duration: time.Second}} },
+	} {
+		cfg := valid
+		mutate(&cfg)
+		if _, err := Run(context.Background(), cfg); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	p := percentiles(latencies)
+	if p.P50 != 50*time.Millisecond || p.P90 != 90*time.Millisecond || p.P99 != 99*time.Millisecond || p.Max != 100*time.Millisecond {
+		t.Errorf("percentiles %+v", p)
+	}
+	if percentiles(nil) != (Percentiles{}) {
+		t.Error("percentiles of no latencies")
+	}
+}
+
+func TestPoPWorkload(t *testing.T) {
+	w, err := NewPoPWorkload("loadtest", 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := w.Inputs(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := w.Inputs(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a["CertBytes"]) != string(b["CertBytes"]) || string(a["Challenge"]) == string(b["Challenge"]) {
+		t.Error("a holder has a certificate and a challenge per request")
+	}
+	if c, err := w.Inputs(1, 0); err != nil || string(c["CertBytes"]) == string(a["CertBytes"]) {
+		t.Errorf("holders share a certificate: %v", err)
+	}
+
+	var der, challenge []byte
+	var x, y, r, s string
+	for name, v := range map[string]any{"CertBytes": &der, "Challenge": &challenge, "SignerPubKeyX": &x, "SignerPubKeyY": &y, "ChallengeSignatureR": &r, "ChallengeSignatureS": &s} {
+		if err := json.Unmarshal(a[name], v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if len(der) > 2048 || len(der) < 2048-certSizeMargin {
+		t.Errorf("certificate of %d bytes", len(der))
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := cert.PublicKey.(*ecdsa.PublicKey)
+	if prover.FormatElement(pub.X) != x || prover.FormatElement(pub.Y) != y {
+		t.Error("signer key is not the certificate key")
+	}
+	rv, err := prover.ParseElement(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := prover.ParseElement(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
+	if !ecdsa.Verify(pub, digest[:], rv, sv) {
+		t.Error("challenge signature does not verify")
+	}
+}
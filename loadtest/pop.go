@@ -0,0 +1,94 @@
+package loadtest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	cdl "github.com/mynextid/eudi-zk/circuits/eudi-vc"
+	"github.com/mynextid/eudi-zk/datagen"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/prover"
+)
+
+// certSizeMargin is the room left by the certificates of PoPWorkload below
+// its certificate size
+const certSizeMargin = 32
+
+// PoPWorkload generates the inputs of the proof-of-possession circuit
+// (cdl.CircuitPoP) of the holders: a certificate and key per holder and a
+// fresh challenge per request, signed in the presentation signing context
+type PoPWorkload struct {
+	gen      *datagen.Generator
+	ca       *datagen.Certificate
+	certSize int
+
+	mu      sync.Mutex
+	holders map[int]*datagen.Certificate
+}
+
+// NewPoPWorkload returns the workload of a seed; certSize is the size the
+// certificates are padded to, the CertBytes size of the compiled circuit
+func NewPoPWorkload(seed string, certSize int) (*PoPWorkload, error) {
+	gen := datagen.New(seed)
+	ca, err := gen.Certificate("Load test QCA", nil, datagen.CertOptions{Profile: datagen.ProfileQTSP, CA: true})
+	if err != nil {
+		return nil, err
+	}
+	return &PoPWorkload{gen: gen, ca: ca, certSize: certSize, holders: map[int]*datagen.Certificate{}}, nil
+}
+
+// certificate returns the certificate of a holder, generated on first use
+func (w *PoPWorkload) certificate(holder int) (*datagen.Certificate, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if cert, ok := w.holders[holder]; ok {
+		return cert, nil
+	}
+	// the padding of MinSize may overshoot by a few bytes, the certificate
+	// is padded short of the size and then to it by the prover
+	cert, err := w.gen.Certificate("holder "+strconv.Itoa(holder), w.ca, datagen.CertOptions{Profile: datagen.ProfileQTSP, MinSize: max(w.certSize-certSizeMargin, 0)})
+	if err != nil {
+		return nil, err
+	}
+	if w.certSize > 0 && len(cert.DER) > w.certSize {
+		return nil, fmt.Errorf("certificate of %d bytes above the size %d", len(cert.DER), w.certSize)
+	}
+	w.holders[holder] = cert
+	return cert, nil
+}
+
+// Inputs returns the inputs of the seq-th presentation of the holder
+func (w *PoPWorkload) Inputs(holder, seq int) (map[string]json.RawMessage, error) {
+	cert, err := w.certificate(holder)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyPos, err := cdl.FindSubjectPublicKeyPosition(cert.DER)
+	if err != nil {
+		return nil, err
+	}
+	challenge := w.gen.Bytes(fmt.Sprintf("challenge %d/%d", holder, seq), 32)
+	digest := sha256.Sum256(models.ContextMessage(models.SigningContextChallenge, challenge))
+	r, s := datagen.Sign(cert.Key, digest[:])
+
+	inputs := map[string]any{
+		"CertBytes":           cert.DER,
+		"CertLength":          len(cert.DER),
+		"SubjectPubKeyPos":    pubKeyPos,
+		"SignerPubKeyX":       prover.FormatElement(cert.Key.X),
+		"SignerPubKeyY":       prover.FormatElement(cert.Key.Y),
+		"ChallengeSignatureR": prover.FormatElement(r),
+		"ChallengeSignatureS": prover.FormatElement(s),
+		"Challenge":           challenge,
+	}
+	raw := make(map[string]json.RawMessage, len(inputs))
+	for name, v := range inputs {
+		if raw[name], err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
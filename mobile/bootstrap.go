@@ -0,0 +1,83 @@
+package mobile
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mynextid/eudi-zk/bootstrap"
+)
+
+// artifactsConfig is the configuration of SyncArtifacts and CheckArtifacts
+type artifactsConfig struct {
+	// BaseURL is the CDN serving the artifacts and the signed manifest
+	BaseURL string `json:"base_url"`
+	// Dir is the app-private directory of the artifacts (filesDir on
+	// Android, Application Support on iOS)
+	Dir      string `json:"dir"`
+	Manifest string `json:"manifest,omitempty"`
+	// Trusted are the Ed25519 public keys signing the manifest (base64), by
+	// key id
+	Trusted map[string]string `json:"trusted"`
+}
+
+// ArtifactProgress receives the progress of SyncArtifacts, implemented by
+// the Kotlin or Swift caller
+type ArtifactProgress interface {
+	OnProgress(key string, done, total int64)
+}
+
+func newBootstrap(config []byte) (*bootstrap.Bootstrap, error) {
+	var cfg artifactsConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid artifacts config: %w", err)
+	}
+	if cfg.BaseURL == "" || cfg.Dir == "" || len(cfg.Trusted) == 0 {
+		return nil, fmt.Errorf("invalid artifacts config: base_url, dir and trusted are required")
+	}
+	trusted := make(map[string]ed25519.PublicKey, len(cfg.Trusted))
+	for kid, encoded := range cfg.Trusted {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid artifacts config: trusted key %q is not an Ed25519 public key", kid)
+		}
+		trusted[kid] = key
+	}
+	b := bootstrap.New(cfg.BaseURL, cfg.Dir, trusted)
+	b.ManifestKey = cfg.Manifest
+	return b, nil
+}
+
+// SyncArtifacts downloads the compiled artifacts of the signed manifest to
+// the app-private directory of the JSON config {"base_url", "dir",
+// "manifest", "trusted": {"<kid>": "<base64 Ed25519 key>"}}, resuming the
+// interrupted downloads (see bootstrap.Bootstrap.Sync), and returns the
+// manifest as JSON. progress is optional.
+func SyncArtifacts(config []byte, progress ArtifactProgress) ([]byte, error) {
+	b, err := newBootstrap(config)
+	if err != nil {
+		return nil, err
+	}
+	if progress != nil {
+		b.Progress = progress.OnProgress
+	}
+	m, err := b.Sync(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// CheckArtifacts verifies the stored manifest and the digests of the stored
+// artifacts under prefix, all of them when empty, e.g. at the start of the
+// app (see bootstrap.Bootstrap.Check)
+func CheckArtifacts(config []byte, prefix string) error {
+	b, err := newBootstrap(config)
+	if err != nil {
+		return err
+	}
+	_, err = b.Check(context.Background(), prefix)
+	return err
+}
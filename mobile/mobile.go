@@ -0,0 +1,219 @@
+// Package mobile is the gomobile binding of the witness preprocessing, for
+// the Kotlin and Swift wallets:
+//
+//	gomobile bind -target android -o eudizk.aar ./mobile
+//	gomobile bind -target ios -o EudiZK.xcframework ./mobile
+//
+// Wallets compute the positions of their credentials as the Go preprocessor
+// does (Preprocess), then build the witness of a circuit from its named inputs
+// (BuildWitness) and send it to the prove API of a prover farm. The API only
+// takes and returns JSON and bytes, the types gomobile binds; the formats are
+// specified in specs/witness-preprocessing.md.
+//
+// BuildWitness builds the witness of the circuits registered with package
+// extension: a binding serving other circuits is built from a main package
+// importing the packages registering them.
+//
+// The wallets proving on the device download the compiled artifacts of a
+// signed manifest with SyncArtifacts and check them with CheckArtifacts, see
+// package bootstrap.
+package mobile
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/extension"
+	"github.com/mynextid/eudi-zk/prover"
+)
+
+// preprocessRequest is the request of Preprocess
+type preprocessRequest struct {
+	// Certificate is the DER certificate of the holder, base64
+	Certificate []byte   `json:"certificate,omitempty"`
+	JWS         string   `json:"jws,omitempty"`
+	SDJWT       string   `json:"sd_jwt,omitempty"`
+	Claims      []string `json:"claims,omitempty"`
+}
+
+// positions are the positions returned by Preprocess
+type positions struct {
+	Certificate *certificatePositions `json:"certificate,omitempty"`
+	Cnf         *cnfPosition          `json:"cnf,omitempty"`
+	Claims      map[string]claim      `json:"claims,omitempty"`
+	Disclosures map[string]disclosure `json:"disclosures,omitempty"`
+}
+
+// certificatePositions are the positions of the certificate
+type certificatePositions struct {
+	TBSStart              int `json:"tbs_start"`
+	TBSLength             int `json:"tbs_length"`
+	SubjectPubKeyPos      int `json:"subject_pub_key_pos"`
+	SubjectPubKeyPosInTBS int `json:"subject_pub_key_pos_in_tbs"`
+}
+
+// claim is a claim aligned to base64url groups (common.ClaimPosition)
+type claim struct {
+	ClaimStart    int    `json:"claim_start"`
+	ClaimEnd      int    `json:"claim_end"`
+	Start         int    `json:"start"`
+	End           int    `json:"end"`
+	B64Start      int    `json:"b64_start"`
+	B64End        int    `json:"b64_end"`
+	Offset        int    `json:"offset"`
+	ValuePosition int    `json:"value_position"`
+	B64           string `json:"b64"`
+}
+
+// cnfPosition is the cnf claim of the protected header and the position of
+// its kid in the decoded segment
+type cnfPosition struct {
+	claim
+	KeyHexPosition int `json:"key_hex_position"`
+}
+
+// disclosure is a selectively disclosed claim (common.DisclosurePosition)
+type disclosure struct {
+	Encoded       string `json:"encoded"`
+	DecodedLen    int    `json:"decoded_len"`
+	Digest        claim  `json:"digest"`
+	NamePosition  int    `json:"name_position"`
+	ValuePosition int    `json:"value_position"`
+}
+
+func newClaim(c *common.ClaimPosition) claim {
+	return claim{
+		ClaimStart:    c.ClaimStart,
+		ClaimEnd:      c.ClaimEnd,
+		Start:         c.Start,
+		End:           c.End,
+		B64Start:      c.B64Start,
+		B64End:        c.B64End,
+		Offset:        c.Offset,
+		ValuePosition: c.ValuePosition,
+		B64:           c.B64,
+	}
+}
+
+// Preprocess computes the positions of the credential artifacts of the JSON
+// request {"certificate", "jws" or "sd_jwt", "claims"} and returns them as
+// JSON, see the specification
+func Preprocess(request []byte) ([]byte, error) {
+	var req preprocessRequest
+	if err := json.Unmarshal(request, &req); err != nil {
+		return nil, fmt.Errorf("invalid preprocess request: %w", err)
+	}
+	p := &common.Preprocessor{Claims: req.Claims}
+	pos, err := p.Process(common.CredentialArtifacts{Certificate: req.Certificate, JWS: req.JWS, SDJWT: req.SDJWT})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(newPositions(pos))
+}
+
+func newPositions(pos *common.Positions) *positions {
+	out := &positions{}
+	if pos.Certificate != nil {
+		out.Certificate = &certificatePositions{
+			TBSStart:              pos.TBSStart,
+			TBSLength:             len(pos.TBS),
+			SubjectPubKeyPos:      pos.SubjectPubKeyPos,
+			SubjectPubKeyPosInTBS: pos.SubjectPubKeyPosInTBS,
+		}
+	}
+	if pos.Cnf != nil {
+		out.Cnf = &cnfPosition{claim: newClaim(pos.Cnf), KeyHexPosition: pos.CnfKeyHexPosition}
+	}
+	if len(pos.Claims) > 0 {
+		out.Claims = map[string]claim{}
+		for name, c := range pos.Claims {
+			out.Claims[name] = newClaim(c)
+		}
+	}
+	if len(pos.Disclosures) > 0 {
+		out.Disclosures = map[string]disclosure{}
+		for name, d := range pos.Disclosures {
+			out.Disclosures[name] = disclosure{
+				Encoded:       d.Disclosure.Encoded,
+				DecodedLen:    len(d.Disclosure.Decoded),
+				Digest:        newClaim(d.Digest),
+				NamePosition:  d.NamePosition,
+				ValuePosition: d.ValuePosition,
+			}
+		}
+	}
+	return out
+}
+
+// witnessRequest is the request of BuildWitness
+type witnessRequest struct {
+	// Inputs are the values of the inputs by name (prover.InputSchema): the
+	// binary inputs base64, the other inputs integers, decimal or 0x
+	// hexadecimal
+	Inputs map[string]string `json:"inputs"`
+	// Consent is the consent token of the holder, if any
+	Consent string `json:"consent,omitempty"`
+}
+
+// Inputs returns the inputs of the registered circuit as JSON, the size of
+// the binary inputs by name, 0 for the integer inputs
+func Inputs(circuit string) ([]byte, error) {
+	s, err := extension.InputSchema(circuit)
+	if err != nil {
+		return nil, err
+	}
+	inputs := map[string]int{}
+	for _, name := range s.Inputs() {
+		inputs[name], _ = s.Binary(name)
+	}
+	return json.Marshal(inputs)
+}
+
+// InputJSONSchema returns the JSON Schema (draft 2020-12) of the JSON prove
+// request of the named inputs of the registered circuit
+// (prover.InputSchema.JSONSchema), for the wallets validating the inputs
+// before upload
+func InputJSONSchema(circuit string) ([]byte, error) {
+	s, err := extension.InputSchema(circuit)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s.JSONSchema(circuit))
+}
+
+// BuildWitness builds the full witness of the registered circuit from the
+// JSON request {"inputs", "consent"} and returns the body of its prove
+// request (prover.ProveRequest): {"witness": base64 gnark binary full
+// witness, "consent"}
+func BuildWitness(circuit string, request []byte) ([]byte, error) {
+	var req witnessRequest
+	if err := json.Unmarshal(request, &req); err != nil {
+		return nil, fmt.Errorf("invalid witness request: %w", err)
+	}
+	s, err := extension.InputSchema(circuit)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(req.Inputs))
+	for name, value := range req.Inputs {
+		if _, ok := s.Binary(name); !ok {
+			values[name] = []byte(value)
+			continue
+		}
+		if values[name], err = base64.StdEncoding.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", prover.ErrInvalidInput, name, err)
+		}
+	}
+	decoded, err := s.DecodeValues(values)
+	if err != nil {
+		return nil, err
+	}
+	witness, err := decoded.Witness.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(prover.ProveRequest{Witness: witness, Consent: req.Consent})
+}
@@ -0,0 +1,223 @@
+package mobile
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/artifact"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/extension"
+	"github.com/mynextid/eudi-zk/prover"
+)
+
+var update = flag.Bool("update", false, "regenerate the vectors of the specification")
+
+// vectorsPath are the test vectors of specs/witness-preprocessing.md
+const vectorsPath = "../specs/testdata/witness-preprocessing.json"
+
+// vector is a test vector of the specification: the positions of a
+// preprocess request
+type vector struct {
+	Name      string          `json:"name"`
+	Request   json.RawMessage `json:"request"`
+	Positions json.RawMessage `json:"positions"`
+}
+
+// b64 encodes a JWS part
+func b64(data string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(data))
+}
+
+// vectorRequests are the preprocess requests of the vectors
+func vectorRequests(t *testing.T) map[string]preprocessRequest {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Holder"},
+		NotBefore:    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2036, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jws := b64(`{"alg":"ES256","cnf":{"kid":"5f0c7e3b"},"typ":"JOSE+JSON"}`) + "." +
+		b64(`{"name":"Alice","birthdate":"2000-01-31","age_over_18":true}`) + "." + b64("signature")
+
+	disclosure := b64(`["2GLC42sKQveCfGfryNRN9w","birthdate","2000-01-31"]`)
+	digest := sha256.Sum256([]byte(disclosure))
+	sdjwt := b64(`{"alg":"ES256","typ":"dc+sd-jwt"}`) + "." +
+		b64(`{"_sd":["`+base64.RawURLEncoding.EncodeToString(digest[:])+`"],"_sd_alg":"sha-256","age_over_18":true}`) + "." +
+		b64("signature") + "~" + disclosure + "~"
+
+	return map[string]preprocessRequest{
+		"certificate and jws":  {Certificate: cert, JWS: jws, Claims: []string{"birthdate", "age_over_18"}},
+		"sd-jwt":               {SDJWT: sdjwt, Claims: []string{"birthdate", "age_over_18"}},
+		"jws claim at the end": {JWS: jws, Claims: []string{"age_over_18"}},
+	}
+}
+
+func TestSpecVectors(t *testing.T) {
+	if *update {
+		var vectors []vector
+		for name, req := range vectorRequests(t) {
+			request, err := json.Marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			positions, err := Preprocess(request)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			vectors = append(vectors, vector{Name: name, Request: request, Positions: positions})
+		}
+		slices.SortFunc(vectors, func(a, b vector) int { return strings.Compare(a.Name, b.Name) })
+		data, err := json.MarshalIndent(vectors, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(vectorsPath, append(data, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("no vector")
+	}
+	for _, v := range vectors {
+		positions, err := Preprocess(v.Request)
+		if err != nil {
+			t.Fatalf("%s: %v", v.Name, err)
+		}
+		var got, expected bytes.Buffer
+		json.Compact(&got, positions)
+		json.Compact(&expected, v.Positions)
+		if got.String() != expected.String() {
+			t.Errorf("%s: positions differ from the specification\n got: %s\nwant: %s", v.Name, got.String(), expected.String())
+		}
+	}
+
+	if _, err := Preprocess([]byte(`{"jws":"a.b.c","claims":["birthdate"]}`)); err == nil {
+		t.Fatal("expected an invalid JWS")
+	}
+}
+
+// sumCircuit proves the sum of the bytes of Data
+type sumCircuit struct {
+	Data []uints.U8
+	Sum  frontend.Variable `gnark:",public"`
+}
+
+func (c *sumCircuit) Define(api frontend.API) error {
+	var sum frontend.Variable = 0
+	for i := range c.Data {
+		sum = api.Add(sum, c.Data[i].Val)
+	}
+	api.AssertIsEqual(sum, c.Sum)
+	return nil
+}
+
+type sum struct{}
+
+func (sum) ID() string                 { return "mobile-test/sum/v1" }
+func (sum) Template() frontend.Circuit { return &sumCircuit{Data: make([]uints.U8, 4)} }
+
+func TestBuildWitness(t *testing.T) {
+	extension.Register(sum{})
+
+	inputs, err := Inputs("mobile-test/sum/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(inputs) != `{"Data":4,"Sum":0}` {
+		t.Fatalf("unexpected inputs %s", inputs)
+	}
+	schema, err := InputJSONSchema("mobile-test/sum/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(schema, []byte(`"$schema":"`+prover.JSONSchemaDialect+`"`)) {
+		t.Fatalf("unexpected schema %s", schema)
+	}
+
+	body, err := BuildWitness("mobile-test/sum/v1", []byte(`{"inputs":{"Data":"AQID","Sum":"6"},"consent":"token"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req prover.ProveRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	w, err := frontend.NewWitness(&sumCircuit{Data: common.BytesToU8Array([]byte{1, 2, 3, 0}), Sum: 6}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := w.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(req.Witness, expected) || req.Consent != "token" {
+		t.Fatal("unexpected prove request")
+	}
+
+	for _, request := range []string{
+		`{"inputs":{"Data":"not base64","Sum":"6"}}`,
+		`{"inputs":{"Data":"AQIDBAU=","Sum":"6"}}`,
+		`{"inputs":{"Data":"AQID"}}`,
+	} {
+		if _, err := BuildWitness("mobile-test/sum/v1", []byte(request)); !errors.Is(err, prover.ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", request, err)
+		}
+	}
+	if _, err := BuildWitness("mobile-test/unknown/v1", []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "no circuit") {
+		t.Fatalf("expected an unknown circuit, got %v", err)
+	}
+}
+
+func TestCheckArtifacts(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	for name, config := range map[string]string{
+		"json":        `{`,
+		"no base url": `{"dir": "/tmp", "trusted": {"ops": "` + key + `"}}`,
+		"key":         `{"base_url": "https://cdn.example", "dir": "/tmp", "trusted": {"ops": "AAAA"}}`,
+	} {
+		if err := CheckArtifacts([]byte(config), ""); err == nil {
+			t.Errorf("%s: expected an invalid config", name)
+		}
+	}
+	config := `{"base_url": "https://cdn.example", "dir": "` + t.TempDir() + `", "trusted": {"ops": "` + key + `"}}`
+	if err := CheckArtifacts([]byte(config), ""); !errors.Is(err, artifact.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound before the first sync, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// AttributeDigest is the digest of a proven claim value, see
+// common.AssertAttributes
+type AttributeDigest []byte
+
+// NewAttributeDigest returns the digest of a claim value
+func NewAttributeDigest(value string) AttributeDigest {
+	digest := sha256.Sum256([]byte(value))
+	return digest[:common.AttributeDigestSize]
+}
+
+// Matches reports whether the digest is the digest of value
+func (d AttributeDigest) Matches(value string) bool {
+	return bytes.Equal(d, NewAttributeDigest(value))
+}
+
+// MarshalText encodes the digest in hex
+func (d AttributeDigest) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(d)), nil
+}
+
+// UnmarshalText decodes a hex digest
+func (d *AttributeDigest) UnmarshalText(text []byte) error {
+	decoded, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*d = decoded
+	return nil
+}
+
+// PublicInputs are the structured public outputs of a verified proof
+type PublicInputs struct {
+	// Attributes are the proven claims by name
+	Attributes map[string]AttributeDigest `json:"attributes,omitempty"`
+	// ChallengeTimestamp is the timestamp of the holder signature, set when
+	// the circuit is registered with AddTimestamp
+	ChallengeTimestamp time.Time `json:"challenge_timestamp,omitzero"`
+	// CRLTime is the time the CRL was proven fresh at, set when the circuit is
+	// registered with AddCRLTime
+	CRLTime time.Time `json:"crl_time,omitzero"`
+	// RevocationStatus is the proven revocation status, set when the circuit
+	// is registered with AddRevocationStatus
+	RevocationStatus *RevocationStatus `json:"revocation_status,omitempty"`
+	// Transcript is the session transcript the holder signed, set when the
+	// circuit is registered with AddTranscript
+	Transcript *SessionTranscript `json:"transcript,omitempty"`
+	// Claims are the claims opened by the presentation, set when the circuit
+	// is registered with AddCommitments
+	Claims map[string]string `json:"claims,omitempty"`
+	// PairwiseID is the pseudonym of the holder for the verifier, set when
+	// the circuit is registered with AddPairwiseID
+	PairwiseID *PairwiseID `json:"pairwise_id,omitempty"`
+}
+
+// AttributeDecoder reads the attribute slots of a circuit from its public
+// witness
+type AttributeDecoder struct {
+	nbPublic int
+	// tags and digests are the indexes of the slots in the public witness
+	tags, digests []int
+}
+
+// NewAttributeDecoder locates the attribute slots (common.AttributesField)
+// among the public inputs of the circuit. The circuit is the template the
+// circuit was compiled with, its slices sized.
+func NewAttributeDecoder(circuit frontend.Circuit) (*AttributeDecoder, error) {
+	d := &AttributeDecoder{}
+	prefix := common.AttributesField + "_"
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		name := leaf.FullName()
+		switch {
+		case strings.HasPrefix(name, prefix) && strings.HasSuffix(name, "_Tag"):
+			d.tags = append(d.tags, d.nbPublic)
+		case strings.HasPrefix(name, prefix) && strings.HasSuffix(name, "_Digest"):
+			d.digests = append(d.digests, d.nbPublic)
+		}
+		d.nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(d.tags) == 0 || len(d.tags) != len(d.digests) {
+		return nil, fmt.Errorf("circuit has no public %s slots", common.AttributesField)
+	}
+	return d, nil
+}
+
+// Decode returns the attributes of the public witness (gnark binary encoding)
+func (d *AttributeDecoder) Decode(publicWitness []byte) (map[string]AttributeDigest, error) {
+	values, err := publicValues(publicWitness, d.nbPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]AttributeDigest{}
+	for i := range d.tags {
+		var tag, digest big.Int
+		values[d.tags[i]].BigInt(&tag)
+		values[d.digests[i]].BigInt(&digest)
+		if tag.Sign() == 0 {
+			continue
+		}
+		if tag.BitLen() > 8*common.AttributeDigestSize || digest.BitLen() > 8*common.AttributeDigestSize {
+			return nil, fmt.Errorf("invalid attribute slot %d", i)
+		}
+		name := string(tag.Bytes())
+		if _, ok := attributes[name]; ok {
+			return nil, fmt.Errorf("duplicate attribute %q", name)
+		}
+		attributes[name] = digest.FillBytes(make([]byte, common.AttributeDigestSize))
+	}
+	return attributes, nil
+}
+
+// PublicValues decodes the public witness (gnark binary encoding) of a
+// circuit with nbPublic public inputs, in the order of the public inputs
+func PublicValues(publicWitness []byte, nbPublic int) ([]*big.Int, error) {
+	values, err := publicValues(publicWitness, nbPublic)
+	if err != nil {
+		return nil, err
+	}
+	ints := make([]*big.Int, len(values))
+	for i := range values {
+		ints[i] = values[i].BigInt(new(big.Int))
+	}
+	return ints, nil
+}
+
+// publicValues decodes the public witness (gnark binary encoding) of a circuit
+// with nbPublic public inputs
+func publicValues(publicWitness []byte, nbPublic int) (fr.Vector, error) {
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.UnmarshalBinary(publicWitness); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWitness, err)
+	}
+	values, ok := w.Vector().(fr.Vector)
+	if !ok || len(values) != nbPublic {
+		return nil, fmt.Errorf("%w: %d public inputs, expected %d", ErrInvalidWitness, len(values), nbPublic)
+	}
+	return values, nil
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CatalogType is the typ of the protected header of a signed catalog
+const CatalogType = "zk-catalog+jwt"
+
+// ErrCatalogExpired is returned for a catalog past its expiry
+var ErrCatalogExpired = errors.New("catalog expired")
+
+// Catalog lists the circuits a verifier accepts, for wallets to discover
+// what they can present. It is served signed (SignCatalog) with an expiry,
+// wallets cache it until then.
+//
+// Deprecations are the minimum versions of the circuit families: wallets
+// upgrade the deprecated circuits, and the verifiers of a fleet apply them
+// (VersionPolicy.Set) from the catalog of their operator. Algs are the
+// presentation algs the verifier accepts in preference order, the input of
+// NegotiateAlg.
+type Catalog struct {
+	Issuer       string           `json:"iss,omitempty"`
+	IssuedAt     int64            `json:"iat"`
+	ExpiresAt    int64            `json:"exp"`
+	Circuits     []CatalogCircuit `json:"circuits"`
+	Deprecations []Deprecation    `json:"deprecations,omitempty"`
+	Algs         []string         `json:"algs,omitempty"`
+}
+
+// CatalogCircuit is a circuit of the catalog with the policy the verifier
+// applies to its presentations
+type CatalogCircuit struct {
+	ID     string `json:"id"`
+	VKHash string `json:"vk_hash"` // hex SHA-256 of the verifying key (common.VerifyingKeyHash)
+	// Schema is the payload schema of the presentations, if any
+	Schema *PayloadSchema `json:"schema,omitempty"`
+	// AttributeSlots is the number of attribute slots of the public inputs
+	// (AddAttributes), 0 when the attributes are not decoded
+	AttributeSlots int `json:"attribute_slots,omitempty"`
+	// MaxTimestampSkew is the accepted distance (seconds) of the challenge
+	// timestamp to the verifier clock (AddTimestamp), 0 when the challenge is
+	// not timestamped
+	MaxTimestampSkew int64 `json:"max_timestamp_skew,omitempty"`
+}
+
+// Catalog returns the registered circuits, sorted by id
+func (v *PresentationVerifier) Catalog() []CatalogCircuit {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	circuits := make([]CatalogCircuit, 0, len(v.circuits))
+	for id, c := range v.circuits {
+		entry := CatalogCircuit{ID: id, VKHash: c.vkHash, Schema: c.schema}
+		if c.attributes != nil {
+			entry.AttributeSlots = len(c.attributes.tags)
+		}
+		if c.timestamp != nil {
+			entry.MaxTimestampSkew = int64(c.timestamp.policy.MaxSkew / time.Second)
+		}
+		circuits = append(circuits, entry)
+	}
+	slices.SortFunc(circuits, func(a, b CatalogCircuit) int { return strings.Compare(a.ID, b.ID) })
+	return circuits
+}
+
+// SignCatalog signs the catalog (JWS ES256, compact serialization) with the
+// key of the verifier, kid identifies the key for the wallets
+func SignCatalog(catalog Catalog, key *ecdsa.PrivateKey, kid string) (string, error) {
+	return signJWS(CatalogType, kid, catalog, key)
+}
+
+// ParseCatalog verifies the signature of a signed catalog with the key of
+// the verifier and returns the catalog; ErrCatalogExpired when it expired at
+// now
+func ParseCatalog(compact string, key *ecdsa.PublicKey, now time.Time) (*Catalog, error) {
+	var catalog Catalog
+	resolveKey := func(string) (*ecdsa.PublicKey, error) { return key, nil }
+	if err := parseJWS(compact, CatalogType, resolveKey, &catalog); err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+	if now.Unix() >= catalog.ExpiresAt {
+		return nil, fmt.Errorf("%w at %s", ErrCatalogExpired, time.Unix(catalog.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	return &catalog, nil
+}
+
+// ECDSAPrivateKey returns the P-256 private key of the JWK as an ECDSA
+// signing key
+func (k JWK) ECDSAPrivateKey() (*ecdsa.PrivateKey, error) {
+	key, err := k.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	public, err := k.ECDSAPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PrivateKey{PublicKey: *public, D: new(big.Int).SetBytes(key.Bytes())}, nil
+}
+
+// ECDSAPublicKey returns the P-256 public key of the JWK as an ECDSA
+// verification key
+func (k JWK) ECDSAPublicKey() (*ecdsa.PublicKey, error) {
+	key, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	// uncompressed point 0x04 || x || y
+	point := key.Bytes()
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(point[1:33]),
+		Y:     new(big.Int).SetBytes(point[33:]),
+	}, nil
+}
@@ -0,0 +1,418 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+	"github.com/mynextid/eudi-zk/common"
+	"golang.org/x/crypto/argon2"
+)
+
+// ChallengeContext is the context a non-interactive challenge is derived from,
+// when no verifier issues a nonce
+type ChallengeContext struct {
+	Audience    string        // verifier identifier
+	Window      uint64        // time window index: unix time / granularity
+	Granularity time.Duration // time window size, whole seconds
+}
+
+// NewChallengeContext returns the context of the time window containing t
+func NewChallengeContext(audience string, t time.Time, granularity time.Duration) (ChallengeContext, error) {
+	if granularity < time.Second || granularity%time.Second != 0 {
+		return ChallengeContext{}, fmt.Errorf("invalid challenge granularity %v: must be whole seconds", granularity)
+	}
+	return ChallengeContext{
+		Audience:    audience,
+		Window:      uint64(t.Unix()) / uint64(granularity/time.Second),
+		Granularity: granularity,
+	}, nil
+}
+
+// AudienceDigest returns the SHA-256 digest of the audience, a public input of
+// the circuit
+func (c ChallengeContext) AudienceDigest() []byte {
+	digest := sha256.Sum256([]byte(c.Audience))
+	return digest[:]
+}
+
+// WindowBytes returns the big-endian window index, a public input of the
+// circuit
+func (c ChallengeContext) WindowBytes() []byte {
+	return binary.BigEndian.AppendUint64(nil, c.Window)
+}
+
+// GranularityBytes returns the big-endian granularity in seconds, a public
+// input of the circuit
+func (c ChallengeContext) GranularityBytes() []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(c.Granularity/time.Second))
+}
+
+// DeriveChallenge derives the challenge the holder signs from the JWS payload
+// (base64url, as in the JWS) and the context. It matches common.DeriveChallenge:
+//
+//	SHA-256(SHA-256(payload) || SHA-256(audience) || window (8 bytes) || granularity (8 bytes))
+func DeriveChallenge(payload []byte, c ChallengeContext) []byte {
+	payloadDigest := sha256.Sum256(payload)
+
+	preimage := make([]byte, 0, 32+32+8+8)
+	preimage = append(preimage, payloadDigest[:]...)
+	preimage = append(preimage, c.AudienceDigest()...)
+	preimage = append(preimage, c.WindowBytes()...)
+	preimage = append(preimage, c.GranularityBytes()...)
+
+	challenge := sha256.Sum256(preimage)
+	return challenge[:]
+}
+
+// ChallengeWindowPolicy bounds the replay risk a verifier accepts for derived
+// challenges: a proof can be replayed to the same audience within its window
+type ChallengeWindowPolicy struct {
+	MaxGranularity time.Duration // largest accepted window size
+	MaxSkew        uint64        // accepted windows before and after the current one
+}
+
+// Verify checks the context is addressed to audience, its granularity is
+// within the policy and its window matches now
+func (p ChallengeWindowPolicy) Verify(c ChallengeContext, audience string, now time.Time) error {
+	if c.Audience != audience {
+		return fmt.Errorf("challenge audience %q, expected %q", c.Audience, audience)
+	}
+	if c.Granularity < time.Second || c.Granularity%time.Second != 0 {
+		return fmt.Errorf("invalid challenge granularity %v", c.Granularity)
+	}
+	if c.Granularity > p.MaxGranularity {
+		return fmt.Errorf("challenge granularity %v exceeds %v", c.Granularity, p.MaxGranularity)
+	}
+
+	current := uint64(now.Unix()) / uint64(c.Granularity/time.Second)
+	if c.Window+p.MaxSkew < current || c.Window > current+p.MaxSkew {
+		return fmt.Errorf("challenge window %d is not current (%d)", c.Window, current)
+	}
+	return nil
+}
+
+// ErrStaleTimestamp is returned for a challenge timestamp outside the skew of
+// a TimestampPolicy
+var ErrStaleTimestamp = errors.New("challenge timestamp is not current")
+
+// TimestampedChallenge returns the message the holder signs for a verifier
+// supplied nonce and timestamp. It matches common.TimestampedChallenge:
+//
+//	challenge || timestamp (8 bytes, big-endian unix seconds)
+func TimestampedChallenge(challenge []byte, timestamp time.Time) []byte {
+	return binary.BigEndian.AppendUint64(slices.Clone(challenge), uint64(timestamp.Unix()))
+}
+
+// Signing contexts of the holder key, see common.SigningContextChallenge
+const (
+	SigningContextChallenge = common.SigningContextChallenge
+	SigningContextIssuance  = common.SigningContextIssuance
+)
+
+// ContextMessage returns the message the holder key signs in a signing
+// context. It matches common.ContextMessage:
+//
+//	SHA-256(SHA-256(context) || message)
+//
+// The presentation circuits verify the signature of the challenge in
+// SigningContextChallenge, unless compiled for the legacy unprefixed flows
+// (LegacyChallenge).
+func ContextMessage(context string, message []byte) []byte {
+	contextDigest := sha256.Sum256([]byte(context))
+	h := sha256.New()
+	h.Write(contextDigest[:])
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// Argon2id parameters of PINDigest: each guess of an attacker brute-forcing
+// a PIN from its commitment costs one derivation with them
+const (
+	PINKDFTime    = 3         // passes
+	PINKDFMemory  = 64 * 1024 // KiB
+	PINKDFThreads = 4
+)
+
+// PINDigest returns the digest of a holder PIN, the private input of the
+// circuits co-binding the PIN to the holder key (cdl.CircuitPoP BindPIN):
+//
+//	Argon2id(pin, salt)
+//
+// with the parameters PINKDF*, salt being the salt of PINCommitment. The
+// circuits only hash the digest, the slow derivation runs on the device.
+func PINDigest(pin string, salt []byte) ([]byte, error) {
+	if len(salt) < 16 {
+		return nil, fmt.Errorf("PIN salt must be at least 16 bytes, got %d", len(salt))
+	}
+	return argon2.IDKey([]byte(pin), salt, PINKDFTime, PINKDFMemory, PINKDFThreads, common.PINDigestSize), nil
+}
+
+// PINChallenge returns the message the holder signs with a PIN co-bound to
+// its key. It matches common.PINChallenge:
+//
+//	SHA-256(challenge || pinDigest)
+func PINChallenge(challenge, pinDigest []byte) []byte {
+	h := sha256.New()
+	h.Write(challenge)
+	h.Write(pinDigest)
+	return h.Sum(nil)
+}
+
+// PINCommitment returns the commitment to the PIN the holder enrolls with the
+// verifier, the public input the circuits co-binding the PIN prove:
+//
+//	SHA-256(salt || pinDigest)
+//
+// salt is a random secret of at least 16 bytes and pinDigest the PINDigest of
+// the PIN with it. The commitment is public, so whoever also obtains the salt
+// can brute-force a low-entropy PIN offline, at one PINDigest per guess: keep
+// the salt off the device, e.g. returned by the wallet backend on unlock, or
+// sealed by a non-exportable hardware key, and have the verifier limit the
+// failed attempts of the holder.
+func PINCommitment(salt, pinDigest []byte) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write(pinDigest)
+	return h.Sum(nil)
+}
+
+// TimestampPolicy bounds the age of the holder signature in the circuits with
+// timestamped challenges: the public timestamp must be within MaxSkew of the
+// clock of the verifier
+type TimestampPolicy struct {
+	MaxSkew time.Duration
+}
+
+// Verify checks the timestamp is within the skew of now
+func (p TimestampPolicy) Verify(timestamp, now time.Time) error {
+	if d := now.Sub(timestamp).Abs(); d > p.MaxSkew {
+		return fmt.Errorf("%w: %s is %v from %s, beyond %v", ErrStaleTimestamp, timestamp.UTC().Format(time.RFC3339), d, now.UTC().Format(time.RFC3339), p.MaxSkew)
+	}
+	return nil
+}
+
+// timestampDecoder reads the challenge timestamp (common.ChallengeTimestampField)
+// of a circuit from its public witness and checks it against a policy
+type timestampDecoder struct {
+	nbPublic int
+	// index is the index of the timestamp in the public witness
+	index  int
+	policy TimestampPolicy
+}
+
+// newTimestampDecoder locates the challenge timestamp among the public inputs
+// of the circuit, the template the circuit was compiled with
+func newTimestampDecoder(circuit frontend.Circuit, policy TimestampPolicy) (*timestampDecoder, error) {
+	d := &timestampDecoder{index: -1, policy: policy}
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		if name := leaf.FullName(); name == common.ChallengeTimestampField || name == common.ChallengeTimestampField+"_0" {
+			d.index = d.nbPublic
+		}
+		d.nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.index < 0 {
+		return nil, fmt.Errorf("circuit has no public %s", common.ChallengeTimestampField)
+	}
+	return d, nil
+}
+
+// Decode returns the timestamp of the public witness (gnark binary encoding),
+// after checking it is current at now
+func (d *timestampDecoder) Decode(publicWitness []byte, now time.Time) (time.Time, error) {
+	values, err := publicValues(publicWitness, d.nbPublic)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var v big.Int
+	values[d.index].BigInt(&v)
+	if !v.IsInt64() {
+		return time.Time{}, fmt.Errorf("%w: invalid challenge timestamp", ErrInvalidWitness)
+	}
+	timestamp := time.Unix(v.Int64(), 0)
+	if err := d.policy.Verify(timestamp, now); err != nil {
+		return time.Time{}, err
+	}
+	return timestamp, nil
+}
+
+// ErrTranscriptMismatch is returned for a proof whose session transcript is
+// not the one of the request of the verifier
+var ErrTranscriptMismatch = errors.New("session transcript mismatch")
+
+// SessionTranscript is the presentation context the holder signs in the
+// circuits with transcript challenges, instead of an opaque nonce: both the
+// verifier and the holder compute the challenge from the request
+type SessionTranscript struct {
+	Nonce       []byte `json:"nonce"`
+	VerifierID  string `json:"verifier_id"`  // client_id of the verifier
+	ResponseURI string `json:"response_uri"` // where the presentation is sent
+	VPFormats   string `json:"vp_formats"`   // vp_formats of the request, as sent
+}
+
+// TranscriptLayout is the size of each transcript component in a circuit, set
+// at compile time
+type TranscriptLayout struct {
+	Nonce, VerifierID, ResponseURI, VPFormats int
+}
+
+// Components returns the components of the transcript, the public inputs of
+// the circuit: the nonce of exactly its size, the others zero padded to
+// theirs. The padded components must not contain a zero byte, which would
+// make the padding ambiguous.
+func (t SessionTranscript) Components(layout TranscriptLayout) (nonce, verifierID, responseURI, vpFormats []byte, err error) {
+	if len(t.Nonce) != layout.Nonce {
+		return nil, nil, nil, nil, fmt.Errorf("transcript nonce of %d bytes, the circuit takes %d", len(t.Nonce), layout.Nonce)
+	}
+	pad := func(name, value string, size int) ([]byte, error) {
+		if len(value) > size {
+			return nil, fmt.Errorf("transcript %s of %d bytes exceeds %d", name, len(value), size)
+		}
+		if strings.IndexByte(value, 0) >= 0 {
+			return nil, fmt.Errorf("transcript %s contains a zero byte", name)
+		}
+		padded := make([]byte, size)
+		copy(padded, value)
+		return padded, nil
+	}
+	if verifierID, err = pad("verifier id", t.VerifierID, layout.VerifierID); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if responseURI, err = pad("response uri", t.ResponseURI, layout.ResponseURI); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if vpFormats, err = pad("vp formats", t.VPFormats, layout.VPFormats); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return slices.Clone(t.Nonce), verifierID, responseURI, vpFormats, nil
+}
+
+// Challenge returns the challenge the holder signs for the transcript. It
+// matches common.TranscriptChallenge:
+//
+//	SHA-256(nonce || verifier_id || response_uri || vp_formats)
+//
+// over the components padded to the layout.
+func (t SessionTranscript) Challenge(layout TranscriptLayout) ([]byte, error) {
+	nonce, verifierID, responseURI, vpFormats, err := t.Components(layout)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(nonce)
+	h.Write(verifierID)
+	h.Write(responseURI)
+	h.Write(vpFormats)
+	return h.Sum(nil), nil
+}
+
+// Equal reports whether the transcripts are the same
+func (t SessionTranscript) Equal(other SessionTranscript) bool {
+	return bytes.Equal(t.Nonce, other.Nonce) && t.VerifierID == other.VerifierID &&
+		t.ResponseURI == other.ResponseURI && t.VPFormats == other.VPFormats
+}
+
+// transcriptDecoder reads the session transcript (common.TranscriptNonceField
+// and the other transcript fields) of a circuit from its public witness
+type transcriptDecoder struct {
+	nbPublic int
+	// nonce, verifierID, responseURI and vpFormats are the indexes of the
+	// component bytes in the public witness
+	nonce, verifierID, responseURI, vpFormats []int
+}
+
+// newTranscriptDecoder locates the transcript components among the public
+// inputs of the circuit, the template the circuit was compiled with
+func newTranscriptDecoder(circuit frontend.Circuit) (*transcriptDecoder, error) {
+	d := &transcriptDecoder{}
+	components := map[string]*[]int{
+		common.TranscriptNonceField:       &d.nonce,
+		common.TranscriptVerifierIDField:  &d.verifierID,
+		common.TranscriptResponseURIField: &d.responseURI,
+		common.TranscriptVPFormatsField:   &d.vpFormats,
+	}
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		if m := transcriptByte.FindStringSubmatch(leaf.FullName()); m != nil {
+			if indexes, ok := components[m[1]]; ok {
+				*indexes = append(*indexes, d.nbPublic)
+			}
+		}
+		d.nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(d.nonce) == 0 {
+		return nil, fmt.Errorf("circuit has no public %s", common.TranscriptNonceField)
+	}
+	return d, nil
+}
+
+// transcriptByte matches the byte leaves of the transcript components
+var transcriptByte = regexp.MustCompile(`^([A-Za-z]+)_[0-9]+_Val$`)
+
+// NewTranscriptLayout returns the transcript layout of the circuit, the
+// template it was compiled with, for the holder computing the challenge
+func NewTranscriptLayout(circuit frontend.Circuit) (TranscriptLayout, error) {
+	d, err := newTranscriptDecoder(circuit)
+	if err != nil {
+		return TranscriptLayout{}, err
+	}
+	return TranscriptLayout{Nonce: len(d.nonce), VerifierID: len(d.verifierID), ResponseURI: len(d.responseURI), VPFormats: len(d.vpFormats)}, nil
+}
+
+// Decode returns the session transcript of the public witness (gnark binary
+// encoding), the padding removed
+func (d *transcriptDecoder) Decode(publicWitness []byte) (*SessionTranscript, error) {
+	values, err := publicValues(publicWitness, d.nbPublic)
+	if err != nil {
+		return nil, err
+	}
+	component := func(indexes []int) ([]byte, error) {
+		data := make([]byte, len(indexes))
+		for i, index := range indexes {
+			if !values[index].IsUint64() || values[index].Uint64() > 0xFF {
+				return nil, fmt.Errorf("%w: invalid session transcript", ErrInvalidWitness)
+			}
+			data[i] = byte(values[index].Uint64())
+		}
+		return data, nil
+	}
+	t := &SessionTranscript{}
+	if t.Nonce, err = component(d.nonce); err != nil {
+		return nil, err
+	}
+	for _, c := range []struct {
+		indexes []int
+		value   *string
+	}{{d.verifierID, &t.VerifierID}, {d.responseURI, &t.ResponseURI}, {d.vpFormats, &t.VPFormats}} {
+		data, err := component(c.indexes)
+		if err != nil {
+			return nil, err
+		}
+		*c.value = string(bytes.TrimRight(data, "\x00"))
+	}
+	return t, nil
+}
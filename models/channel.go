@@ -0,0 +1,141 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrChannelMismatch is returned for a presentation whose nonce was not
+// issued for the channel it arrived on, e.g. a proof relayed from another
+// TLS connection
+var ErrChannelMismatch = errors.New("channel binding mismatch")
+
+// Channel bindings of the verifier nonces (NewChannelNonce)
+const (
+	// ChannelBindingTLSExporter binds the nonces to the TLS 1.3 connection
+	// (TLSExporterBinding)
+	ChannelBindingTLSExporter = "tls-exporter"
+	// ChannelBindingSession binds the nonces to a session identifier
+	// (SessionBinding), for verifiers behind a TLS terminating proxy
+	ChannelBindingSession = "session"
+)
+
+// TLSExporterLabel is the exporter label of the tls-exporter channel binding
+// (RFC 9266)
+const TLSExporterLabel = "EXPORTER-Channel-Binding"
+
+// ChannelNonceSize is the size of a nonce bound to a channel: a random salt
+// and the tag binding it
+const ChannelNonceSize = channelSaltSize + channelTagSize
+
+const (
+	channelSaltSize = 16
+	channelTagSize  = 16
+)
+
+// channelContext separates the tags of the channel nonces from the other
+// digests of the binding material
+const channelContext = "eudi-zk/v1/channel-binding"
+
+// TLSExporterBinding returns the tls-exporter channel binding of a TLS 1.3
+// connection (RFC 9266): 32 bytes exported with TLSExporterLabel and no
+// context. Both ends of the connection export the same bytes, the client and
+// the server of a relayed proof do not.
+func TLSExporterBinding(cs *tls.ConnectionState) ([]byte, error) {
+	if cs == nil {
+		return nil, fmt.Errorf("tls-exporter channel binding without TLS")
+	}
+	if cs.Version < tls.VersionTLS13 {
+		return nil, fmt.Errorf("tls-exporter channel binding requires TLS 1.3")
+	}
+	return cs.ExportKeyingMaterial(TLSExporterLabel, nil, 32)
+}
+
+// SessionBinding returns the channel binding of a session identifier:
+//
+//	SHA-256(session id)
+func SessionBinding(sessionID string) []byte {
+	digest := sha256.Sum256([]byte(sessionID))
+	return digest[:]
+}
+
+// NewChannelNonce returns a nonce bound to the channel binding, of
+// ChannelNonceSize bytes:
+//
+//	salt (16 random bytes) || SHA-256(SHA-256(context) || binding || salt)[:16]
+//
+// The verifier recomputes the tag with the binding of the channel the
+// presentation arrives on (CheckChannelNonce); the holder checks the nonce it
+// signs was issued for the channel it is connected on the same way. The
+// nonce is the nonce of the session transcript of the circuits with
+// transcript challenges, and the nonce of the presentation (ChannelNonce). r
+// is crypto/rand when nil.
+func NewChannelNonce(r io.Reader, binding []byte) ([]byte, error) {
+	if len(binding) == 0 {
+		return nil, fmt.Errorf("empty channel binding")
+	}
+	if r == nil {
+		r = rand.Reader
+	}
+	salt := make([]byte, channelSaltSize, ChannelNonceSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, err
+	}
+	return append(salt, channelTag(binding, salt)...), nil
+}
+
+// CheckChannelNonce checks the nonce was issued for the channel binding, else
+// ErrChannelMismatch
+func CheckChannelNonce(nonce, binding []byte) error {
+	if len(nonce) != ChannelNonceSize {
+		return fmt.Errorf("%w: nonce of %d bytes, expected %d", ErrChannelMismatch, len(nonce), ChannelNonceSize)
+	}
+	salt, tag := nonce[:channelSaltSize], nonce[channelSaltSize:]
+	if subtle.ConstantTimeCompare(tag, channelTag(binding, salt)) != 1 {
+		return fmt.Errorf("%w: nonce issued for another channel", ErrChannelMismatch)
+	}
+	return nil
+}
+
+// ChannelNonce returns the encoding of a channel nonce in the presentation
+// payload (PresentationPayload.Nonce), base64url without padding
+func ChannelNonce(nonce []byte) string {
+	return base64.RawURLEncoding.EncodeToString(nonce)
+}
+
+func channelTag(binding, salt []byte) []byte {
+	contextDigest := sha256.Sum256([]byte(channelContext))
+	h := sha256.New()
+	h.Write(contextDigest[:])
+	h.Write(binding)
+	h.Write(salt)
+	return h.Sum(nil)[:channelTagSize]
+}
+
+// checkChannel checks the nonce of the presentation, and the nonce of its
+// session transcript when decoded, were issued for the channel binding; not
+// checked when binding is nil
+func checkChannel(p *ZkPresentation, res *VerificationResult, binding []byte) error {
+	if binding == nil {
+		return nil
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(p.Payload.Nonce)
+	if err != nil {
+		return fmt.Errorf("%w: invalid presentation nonce", ErrChannelMismatch)
+	}
+	if err := CheckChannelNonce(nonce, binding); err != nil {
+		return err
+	}
+	if res != nil && res.PublicInputs.Transcript != nil {
+		if err := CheckChannelNonce(res.PublicInputs.Transcript.Nonce, binding); err != nil {
+			return fmt.Errorf("session transcript: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Claims hash (claim_hash): commitment to a set of disclosed claims that is
+// exposed as a public input of the circuit (see common.ClaimsHash).
+//
+//	claim_hash = SHA-256(salt || enc(claim_1) || ... || enc(claim_n))
+//	enc(claim) = len(name) (1 byte) || name || len(value) (2 bytes, big-endian) || value
+//
+// Claims are sorted by name (byte order) and names are unique. The salt is
+// random and kept by the holder, it prevents guessing the values of claims with
+// a small domain from the hash.
+
+// ClaimsSaltSize is the size of the claims hash salt in bytes
+const ClaimsSaltSize = 16
+
+// Claim is a disclosed claim, the value is the JSON string value of the claim
+type Claim struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NewClaimsSalt returns a random claims hash salt
+func NewClaimsSalt() ([]byte, error) {
+	salt := make([]byte, ClaimsSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate the claims salt: %w", err)
+	}
+	return salt, nil
+}
+
+// SortClaims returns the claims in canonical order (sorted by name)
+func SortClaims(claims []Claim) []Claim {
+	sorted := slices.Clone(claims)
+	slices.SortFunc(sorted, func(a, b Claim) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return sorted
+}
+
+// EncodeClaims returns the claims hash preimage of the claims
+func EncodeClaims(salt []byte, claims []Claim) ([]byte, error) {
+	if len(salt) != ClaimsSaltSize {
+		return nil, fmt.Errorf("invalid salt size %d, expected %d", len(salt), ClaimsSaltSize)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(salt)
+
+	sorted := SortClaims(claims)
+	for i, claim := range sorted {
+		if claim.Name == "" || len(claim.Name) > 0xff {
+			return nil, fmt.Errorf("invalid claim name %q", claim.Name)
+		}
+		if len(claim.Value) > 0xffff {
+			return nil, fmt.Errorf("claim %q value too long: %d bytes", claim.Name, len(claim.Value))
+		}
+		if i > 0 && sorted[i-1].Name == claim.Name {
+			return nil, fmt.Errorf("duplicate claim %q", claim.Name)
+		}
+
+		buf.WriteByte(byte(len(claim.Name)))
+		buf.WriteString(claim.Name)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(len(claim.Value))))
+		buf.WriteString(claim.Value)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ClaimsHash computes the claims hash of the claims
+func ClaimsHash(salt []byte, claims []Claim) ([]byte, error) {
+	preimage, err := EncodeClaims(salt, claims)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(preimage)
+	return digest[:], nil
+}
+
+// VerifyClaimsHash checks that claimHash is the claims hash of the disclosed
+// claims and salt
+func VerifyClaimsHash(claimHash, salt []byte, claims []Claim) error {
+	expected, err := ClaimsHash(salt, claims)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(expected, claimHash) != 1 {
+		return fmt.Errorf("claims hash mismatch")
+	}
+	return nil
+}
+
+// Claims returns the named top-level string claims of the PID
+func (pid *PersonIdentificationData) Claims(names ...string) ([]Claim, error) {
+	data, err := json.Marshal(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	claims := make([]Claim, 0, len(names))
+	for _, name := range names {
+		value, ok := all[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("claim %q is not a string claim of the PID", name)
+		}
+		claims = append(claims, Claim{Name: name, Value: value})
+	}
+	return SortClaims(claims), nil
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// ErrInvalidOpening is returned for a claim opening of the presentation that
+// opens no claim commitment of the public witness
+var ErrInvalidOpening = errors.New("invalid claim opening")
+
+// ClaimOpening reveals the claim behind a salted claim commitment, see
+// verifier.ClaimOpening
+type ClaimOpening = verifier.ClaimOpening
+
+// NewClaimOpening returns the opening of name = value with a fresh salt of
+// saltSize bytes, the size the circuit commits to
+func NewClaimOpening(name, value string, saltSize int) (ClaimOpening, error) {
+	if saltSize < common.MinClaimSaltSize {
+		return ClaimOpening{}, fmt.Errorf("salt of %d bytes, at least %d", saltSize, common.MinClaimSaltSize)
+	}
+	salt, err := common.GenerateRandomBytes(saltSize)
+	if err != nil {
+		return ClaimOpening{}, err
+	}
+	return ClaimOpening{Name: name, Value: value, Salt: salt}, nil
+}
+
+// commitmentDecoder reads the claim commitments (common.ClaimCommitmentsField)
+// of a circuit from its public witness
+type commitmentDecoder struct {
+	nbPublic int
+	// indexes are the indexes of the commitments in the public witness
+	indexes []int
+}
+
+// newCommitmentDecoder locates the claim commitments among the public inputs
+// of the circuit, the template the circuit was compiled with
+func newCommitmentDecoder(circuit frontend.Circuit) (*commitmentDecoder, error) {
+	slot := regexp.MustCompile(`^` + common.ClaimCommitmentsField + `_[0-9]+$`)
+	d := &commitmentDecoder{}
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		if slot.MatchString(leaf.FullName()) {
+			d.indexes = append(d.indexes, d.nbPublic)
+		}
+		d.nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(d.indexes) == 0 {
+		return nil, fmt.Errorf("circuit has no public %s slots", common.ClaimCommitmentsField)
+	}
+	return d, nil
+}
+
+// Open returns the claims the openings reveal, by name: each opening must
+// open a distinct commitment of the public witness (gnark binary encoding)
+func (d *commitmentDecoder) Open(publicWitness []byte, openings []ClaimOpening) (map[string]string, error) {
+	values, err := publicValues(publicWitness, d.nbPublic)
+	if err != nil {
+		return nil, err
+	}
+	commitments := make([][]byte, len(d.indexes))
+	for i, index := range d.indexes {
+		b := values[index].Bytes()
+		commitments[i] = b[len(b)-common.AttributeDigestSize:]
+	}
+
+	claims := map[string]string{}
+	opened := make([]bool, len(commitments))
+	for _, o := range openings {
+		if _, ok := claims[o.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate claim %q", ErrInvalidOpening, o.Name)
+		}
+		commitment := o.Commitment()
+		i := 0
+		for ; i < len(commitments); i++ {
+			if !opened[i] && bytes.Equal(commitments[i], commitment) {
+				break
+			}
+		}
+		if i == len(commitments) {
+			return nil, fmt.Errorf("%w: claim %q", ErrInvalidOpening, o.Name)
+		}
+		opened[i] = true
+		claims[o.Name] = o.Value
+	}
+	return claims, nil
+}
+
+// NewDecoyCommitment returns a fresh salt of saltSize bytes and the commitment
+// of the decoy slot it fills (common.DecoyCommitment)
+func NewDecoyCommitment(saltSize int) ([]byte, []byte, error) {
+	if saltSize < common.MinClaimSaltSize {
+		return nil, nil, fmt.Errorf("salt of %d bytes, at least %d", saltSize, common.MinClaimSaltSize)
+	}
+	salt, err := common.GenerateRandomBytes(saltSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest := sha256.Sum256(salt)
+	return salt, digest[:common.AttributeDigestSize], nil
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// ErrInconsistentProofs is returned for a composite presentation whose proofs
+// prove different values of a shared public input
+var ErrInconsistentProofs = errors.New("inconsistent proofs")
+
+// DefaultSharedInputs are the shared public inputs of a verifier without
+// SharedInputs: the verifier challenge (the transcript nonce) and the
+// pairwise identifier of the holder
+var DefaultSharedInputs = []string{common.TranscriptNonceField, common.PairwiseIDField}
+
+// verifyComposite verifies a composite presentation (CompositeCircuit) like
+// verify: the signature and the expiry once, then the steps of each proof
+// with the circuit, the key and the public witness of its entry. The payload
+// must match the schema of every circuit. The claim
+// openings open the commitments of the first proof of a circuit added with
+// AddCommitments. Last, the proofs must agree on the shared public inputs
+// (SharedInputs) they label, and on their session transcripts and pairwise
+// identifiers, else ErrInconsistentProofs: the proofs of another session or
+// holder cannot be combined.
+func (v *PresentationVerifier) verifyComposite(p *ZkPresentation, opts VerificationOptions) (*VerificationResult, error) {
+	partial := &VerificationResult{Circuit: CompositeCircuit, Presentation: p}
+	proofs := p.Payload.Proofs
+	if len(proofs) == 0 {
+		return nil, errorf(StageParse, CodeMalformed, partial, "composite presentation without proofs")
+	}
+	if len(p.Proof) > 0 || len(p.Payload.PublicWitness) > 0 {
+		return nil, errorf(StageParse, CodeMalformed, partial, "composite presentation with a proof of its own")
+	}
+
+	// the circuit ids are public, an unknown circuit is refused up front
+	circuits := make([]*verifierCircuit, len(proofs))
+	opening := -1
+	for i, proof := range proofs {
+		c, err := v.circuit(proof.Circuit)
+		if err != nil {
+			return nil, failure(StageCircuit, CodeUnknownCircuit, proofError(i, err), partial)
+		}
+		circuits[i] = c
+		if opening < 0 && c.commitments != nil {
+			opening = i
+		}
+	}
+	opening = max(opening, 0)
+
+	at := opts.at(v)
+	var first firstFailure
+	deprecations := make([]*Deprecation, len(proofs))
+	for i, proof := range proofs {
+		var err error
+		deprecations[i], err = v.MinVersions.Check(proof.Circuit, at)
+		first.add(failure(StageCircuit, CodeCircuitDeprecated, proofError(i, err), partial))
+	}
+
+	first.add(v.verifySignature(p, partial))
+	first.add(v.checkExpiry(p, at, opts, partial))
+
+	vks := make([]groth16.VerifyingKey, len(proofs))
+	for i, proof := range proofs {
+		vk, ok, err := circuits[i].key(proof.Circuit, proof.VKHash, at)
+		if !ok {
+			first.add(failure(StageKey, CodeVersionMismatch, proofError(i, &VersionError{Circuit: proof.Circuit, VKHash: proof.VKHash, Versions: v.Versions(proof.Circuit)}), partial))
+			// the proof is still verified, with the registered key
+			vk = circuits[i].vk
+		}
+		first.add(failure(StageKey, CodeKeyNotValid, proofError(i, err), partial))
+		vks[i] = vk
+	}
+
+	// the payload members are shared, it must match the schema of every circuit
+	for i, c := range circuits {
+		if c.schema != nil {
+			first.add(failure(StageSchema, CodeSchemaMismatch, proofError(i, c.schema.Validate(p.RawPayload)), partial))
+		}
+	}
+
+	for i, proof := range proofs {
+		first.add(failure(StageProof, CodeProofFailed, proofError(i, checkProof(vks[i], proof.Proof, proof.PublicWitness)), partial))
+	}
+
+	res := &VerificationResult{Circuit: CompositeCircuit, Presentation: p}
+	for i, proof := range proofs {
+		entry := p
+		if i != opening {
+			withoutOpenings := *p
+			withoutOpenings.Payload.Openings = nil
+			entry = &withoutOpenings
+		}
+		r, err := circuits[i].result(proof.Circuit, proof.VKHash, entry, proof.PublicWitness, at, opts.Transcript)
+		r.Presentation, r.Deprecation = p, deprecations[i]
+		first.add(failure(StagePublicInputs, CodeInvalidWitness, proofError(i, err), r))
+		first.add(failure(StagePublicInputs, CodeChannelMismatch, proofError(i, checkChannel(p, r, opts.ChannelBinding)), r))
+		res.Entries = append(res.Entries, r)
+		if res.Deprecation == nil {
+			res.Deprecation = deprecations[i]
+		}
+	}
+	first.add(failure(StagePublicInputs, CodeInconsistentProofs, v.checkShared(res.Entries), res))
+	if first.err != nil {
+		return nil, first.err
+	}
+	res.CredentialExpiresIn = res.Entries[0].CredentialExpiresIn
+	return res, nil
+}
+
+// checkShared returns ErrInconsistentProofs when two results of the proofs of
+// a composite presentation differ on a shared public input
+func (v *PresentationVerifier) checkShared(entries []*VerificationResult) error {
+	names := v.SharedInputs
+	if names == nil {
+		names = DefaultSharedInputs
+	}
+	for _, name := range names {
+		labeled := -1
+		for i, e := range entries {
+			value, ok := e.Labels[name]
+			if !ok {
+				continue
+			}
+			if labeled < 0 {
+				labeled = i
+			} else if value != entries[labeled].Labels[name] {
+				return fmt.Errorf("%w: proofs %d and %d prove different %s", ErrInconsistentProofs, labeled, i, name)
+			}
+		}
+	}
+
+	// the decoded transcripts and pairwise identifiers, labeled or not
+	transcript, pairwise := -1, -1
+	for i, e := range entries {
+		if t := e.PublicInputs.Transcript; t != nil {
+			if transcript < 0 {
+				transcript = i
+			} else if !t.Equal(*entries[transcript].PublicInputs.Transcript) {
+				return fmt.Errorf("%w: proofs %d and %d prove different session transcripts", ErrInconsistentProofs, transcript, i)
+			}
+		}
+		if id := e.PublicInputs.PairwiseID; id != nil {
+			if pairwise < 0 {
+				pairwise = i
+			} else if other := entries[pairwise].PublicInputs.PairwiseID; !bytes.Equal(id.ID, other.ID) || id.VerifierID != other.VerifierID {
+				return fmt.Errorf("%w: proofs %d and %d prove different pairwise identifiers", ErrInconsistentProofs, pairwise, i)
+			}
+		}
+	}
+	return nil
+}
+
+// proofError prefixes the error of a proof of a composite presentation with
+// its index, nil when err is nil
+func proofError(i int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("proof %d: %w", i, err)
+}
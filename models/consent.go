@@ -0,0 +1,89 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ConsentType is the typ of the protected header of a consent token
+const ConsentType = "zk-consent+jwt"
+
+var (
+	// ErrConsentExpired is returned for a consent token past its expiry
+	ErrConsentExpired = errors.New("consent expired")
+	// ErrConsentMismatch is returned for a consent token given for another
+	// circuit or other inputs
+	ErrConsentMismatch = errors.New("consent does not match the proof")
+)
+
+// Consent authorizes a server to prove on behalf of the holder (delegated
+// proving): the holder sends its private inputs with a consent token, signed
+// with its key, for one circuit and one witness until the expiry. The server
+// verifies it before proving (ParseConsent, Check) and the presentation
+// carries its hash (PresentationPayload.Consent), so every server-made proof
+// traces back to an authorization of the holder.
+type Consent struct {
+	Circuit     string `json:"circuit"`
+	InputDigest string `json:"input_digest"` // hex SHA-256 of the full witness (InputDigest)
+	IssuedAt    int64  `json:"iat"`
+	ExpiresAt   int64  `json:"exp"`
+	// Nonce makes the tokens of the same inputs distinct, optional
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// InputDigest returns the hex SHA-256 of a full witness (gnark binary
+// encoding), the inputs a Consent is given for
+func InputDigest(fullWitness []byte) string {
+	digest := sha256.Sum256(fullWitness)
+	return hex.EncodeToString(digest[:])
+}
+
+// ConsentHash returns the hex SHA-256 of a consent token, the value of
+// PresentationPayload.Consent
+func ConsentHash(compact string) string {
+	digest := sha256.Sum256([]byte(strings.TrimSpace(compact)))
+	return hex.EncodeToString(digest[:])
+}
+
+// SignConsent signs the consent (JWS ES256, compact serialization) with the
+// holder key, kid identifies the key for the server
+func SignConsent(consent Consent, key *ecdsa.PrivateKey, kid string) (string, error) {
+	return signJWS(ConsentType, kid, consent, key)
+}
+
+// ParseConsent verifies the signature of a consent token with the holder key
+// resolved from its kid and returns the consent; ErrConsentExpired when it
+// expired at now
+func ParseConsent(compact string, resolveKey func(kid string) (*ecdsa.PublicKey, error), now time.Time) (*Consent, error) {
+	var consent Consent
+	if err := parseJWS(compact, ConsentType, resolveKey, &consent); err != nil {
+		return nil, fmt.Errorf("invalid consent: %w", err)
+	}
+	if now.Unix() >= consent.ExpiresAt {
+		return nil, fmt.Errorf("%w at %s", ErrConsentExpired, time.Unix(consent.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	return &consent, nil
+}
+
+// Check returns ErrConsentMismatch when the consent is not given for the
+// full witness of the circuit
+func (c *Consent) Check(circuit string, fullWitness []byte) error {
+	return c.CheckDigest(circuit, InputDigest(fullWitness))
+}
+
+// CheckDigest is Check for the InputDigest of the full witness, hashed by the
+// caller, e.g. from a witness never held encoded
+func (c *Consent) CheckDigest(circuit, inputDigest string) error {
+	if c.Circuit != circuit {
+		return fmt.Errorf("%w: circuit %q, consent for %q", ErrConsentMismatch, circuit, c.Circuit)
+	}
+	if c.InputDigest != inputDigest {
+		return fmt.Errorf("%w: input digest", ErrConsentMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Stage is the step of the verification pipeline an error occurred in, in
+// order
+type Stage string
+
+const (
+	// StageParse: decryption and parsing of the presentation
+	StageParse Stage = "parse"
+	// StageCircuit: lookup of the registered circuit and check of its
+	// minimum version
+	StageCircuit Stage = "circuit"
+	// StageSignature: resolution of the holder keys, alg and holder signature
+	StageSignature Stage = "signature"
+	// StageExpiry: expiry, issuance time and replay of the presentation
+	StageExpiry Stage = "expiry"
+	// StageKey: version and validity of the verifying key
+	StageKey Stage = "key"
+	// StageSchema: payload schema of the circuit
+	StageSchema Stage = "schema"
+	// StageProof: groth16 verification of the proof
+	StageProof Stage = "proof"
+	// StagePublicInputs: decoding and checks of the public inputs
+	// (timestamps, CRL, transcript, channel binding, openings)
+	StagePublicInputs Stage = "public_inputs"
+)
+
+// ErrorCode is the failure class of a VerificationError, stable for
+// programmatic handling
+type ErrorCode string
+
+const (
+	CodeMalformed          ErrorCode = "malformed"
+	CodeMalformedProof     ErrorCode = "malformed_proof"
+	CodePublicInputCount   ErrorCode = "public_input_count"
+	CodeUnknownCircuit     ErrorCode = "unknown_circuit"
+	CodeVersionMismatch    ErrorCode = "version_mismatch"
+	CodeCircuitDeprecated  ErrorCode = "circuit_deprecated"
+	CodeKeyUnresolved      ErrorCode = "holder_key_unresolved"
+	CodeInvalidSignature   ErrorCode = "invalid_signature"
+	CodeUnsupportedAlg     ErrorCode = "unsupported_alg"
+	CodeExpired            ErrorCode = "expired"
+	CodeCredentialExpired  ErrorCode = "credential_expired"
+	CodeIssuedLater        ErrorCode = "issued_later"
+	CodeKeyNotValid        ErrorCode = "key_not_valid"
+	CodeSchemaMismatch     ErrorCode = "schema_mismatch"
+	CodeInvalidWitness     ErrorCode = "invalid_witness"
+	CodeProofFailed        ErrorCode = "proof_failed"
+	CodeStaleTimestamp     ErrorCode = "stale_timestamp"
+	CodeStaleCRLTime       ErrorCode = "stale_crl_time"
+	CodeRevocationStatus   ErrorCode = "revocation_status"
+	CodeTranscriptMismatch ErrorCode = "transcript_mismatch"
+	CodeInvalidOpening     ErrorCode = "invalid_opening"
+	CodeInconsistentProofs ErrorCode = "inconsistent_proofs"
+	CodeReplayed           ErrorCode = "replayed"
+	CodeChannelMismatch    ErrorCode = "channel_mismatch"
+	CodeUnsupportedPayload ErrorCode = "unsupported_payload"
+)
+
+// VerificationError is the error of every failure of the verification
+// pipeline of a PresentationVerifier. It wraps the error of the failing step,
+// so errors.Is matches the failure classes (ErrProofFailed,
+// ErrPresentationExpired, ...) and errors.As the VersionError and FieldError.
+type VerificationError struct {
+	Code  ErrorCode
+	Stage Stage
+	// Retryable is set when the same presentation may verify later, e.g. once
+	// the holder key resolves; other failures need another presentation
+	Retryable bool
+	// Partial is what succeeded before the failure, for diagnostics: the
+	// circuit once known, the presentation once parsed (its signature is only
+	// verified from StageExpiry on) and the public inputs decoded before the
+	// failing check. Nil when the presentation cannot be parsed.
+	Partial *VerificationResult
+
+	Err error
+}
+
+func (e *VerificationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// codes are the failure classes of the checks of the public inputs
+var codes = []struct {
+	target error
+	code   ErrorCode
+}{
+	{ErrStaleTimestamp, CodeStaleTimestamp},
+	{ErrStaleCRLTime, CodeStaleCRLTime},
+	{ErrRevocationStatus, CodeRevocationStatus},
+	{ErrTranscriptMismatch, CodeTranscriptMismatch},
+	{ErrInvalidOpening, CodeInvalidOpening},
+	{ErrInconsistentProofs, CodeInconsistentProofs},
+	{ErrMalformedProof, CodeMalformedProof},
+	{ErrPublicInputCount, CodePublicInputCount},
+	{ErrInvalidWitness, CodeInvalidWitness},
+	{ErrProofFailed, CodeProofFailed},
+	{ErrKeyNotValid, CodeKeyNotValid},
+	{ErrVersionMismatch, CodeVersionMismatch},
+	{ErrCircuitDeprecated, CodeCircuitDeprecated},
+	{ErrUnsupportedAlg, CodeUnsupportedAlg},
+	{ErrUnknownCircuit, CodeUnknownCircuit},
+	{ErrCredentialExpired, CodeCredentialExpired},
+	{ErrPresentationExpired, CodeExpired},
+	{ErrReplayed, CodeReplayed},
+	{ErrChannelMismatch, CodeChannelMismatch},
+	{ErrUnsupportedPayload, CodeUnsupportedPayload},
+}
+
+// codeOf returns the failure class of err, fallback when it wraps none
+func codeOf(err error, fallback ErrorCode) ErrorCode {
+	for _, c := range codes {
+		if errors.Is(err, c.target) {
+			return c.code
+		}
+	}
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		return CodeSchemaMismatch
+	}
+	return fallback
+}
+
+// failure returns the VerificationError of err at stage, classified by the
+// failure class it wraps; nil when err is nil. An err already classified is
+// returned as is.
+func failure(stage Stage, fallback ErrorCode, err error, partial *VerificationResult) error {
+	if err == nil {
+		return nil
+	}
+	var verr *VerificationError
+	if errors.As(err, &verr) {
+		return err
+	}
+	code := codeOf(err, fallback)
+	return &VerificationError{Code: code, Stage: stage, Retryable: code == CodeKeyUnresolved, Partial: partial, Err: err}
+}
+
+// errorf returns the VerificationError of a new error at stage
+func errorf(stage Stage, code ErrorCode, partial *VerificationResult, format string, args ...any) error {
+	return failure(stage, code, fmt.Errorf(format, args...), partial)
+}
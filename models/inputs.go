@@ -0,0 +1,149 @@
+package models
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"slices"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+)
+
+// limbBits is the limb size of the emulated elements (emulated.Element)
+const limbBits = 64
+
+var (
+	bytesLeaf   = regexp.MustCompile(`^(.+)_([0-9]+)_Val$`)
+	elementLeaf = regexp.MustCompile(`^(.+)_Limbs_([0-9]+)$`)
+)
+
+// inputKind is how a public input is labeled
+type inputKind int
+
+const (
+	// labelBytes is a []uints.U8 field, labeled in hex
+	labelBytes inputKind = iota
+	// labelElement is an emulated.Element field, labeled in decimal
+	labelElement
+	// labelVariable is a frontend.Variable leaf, labeled in decimal
+	labelVariable
+)
+
+// labeledInput is a public input and the indexes of its leaves in the public
+// witness
+type labeledInput struct {
+	name    string
+	kind    inputKind
+	indexes []int
+}
+
+// InputLabeler decodes the public witness of a circuit into its named public
+// inputs, for logging and audit: a proof and its public witness are all the
+// caller keeps after proving.
+//
+//   - a []uints.U8 field is named after the field, its bytes in hex
+//   - an emulated.Element field is named after the field, its integer in
+//     decimal
+//   - any other leaf is named after its full name (e.g. ChallengeTimestamp_0),
+//     its field element in decimal
+//
+// Nested fields are named by their path joined with "_", as gnark names the
+// leaves.
+type InputLabeler struct {
+	nbPublic int
+	inputs   []*labeledInput
+}
+
+// NewInputLabeler returns the labeler of the public inputs of the circuit, the
+// template it was compiled with (its slices sized)
+func NewInputLabeler(circuit frontend.Circuit) (*InputLabeler, error) {
+	l := &InputLabeler{}
+	byName := map[string]*labeledInput{}
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		name, kind := leaf.FullName(), labelVariable
+		if m := bytesLeaf.FindStringSubmatch(name); m != nil {
+			name, kind = m[1], labelBytes
+		} else if m := elementLeaf.FindStringSubmatch(name); m != nil {
+			name, kind = m[1], labelElement
+		}
+		in, ok := byName[name]
+		if !ok {
+			in = &labeledInput{name: name, kind: kind}
+			byName[name] = in
+			l.inputs = append(l.inputs, in)
+		}
+		if in.kind != kind || kind == labelVariable && ok {
+			return fmt.Errorf("ambiguous public input %q", name)
+		}
+		in.indexes = append(in.indexes, l.nbPublic)
+		l.nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Names returns the names of the public inputs, in public witness order
+func (l *InputLabeler) Names() []string {
+	names := make([]string, len(l.inputs))
+	for i, in := range l.inputs {
+		names[i] = in.name
+	}
+	return names
+}
+
+// Label returns the public inputs of the public witness (gnark binary
+// encoding) by name
+func (l *InputLabeler) Label(publicWitness []byte) (map[string]string, error) {
+	values, err := publicValues(publicWitness, l.nbPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(l.inputs))
+	for _, in := range l.inputs {
+		switch in.kind {
+		case labelBytes:
+			b := make([]byte, len(in.indexes))
+			for i, index := range in.indexes {
+				var v big.Int
+				if values[index].BigInt(&v).BitLen() > 8 {
+					return nil, fmt.Errorf("%w: input %q: byte %d out of range", ErrInvalidWitness, in.name, i)
+				}
+				b[i] = byte(v.Uint64())
+			}
+			labels[in.name] = hex.EncodeToString(b)
+		case labelElement:
+			// the limbs are least significant first
+			element := new(big.Int)
+			for _, index := range slices.Backward(in.indexes) {
+				var limb big.Int
+				values[index].BigInt(&limb)
+				element.Lsh(element, limbBits).Add(element, &limb)
+			}
+			labels[in.name] = element.String()
+		default:
+			labels[in.name] = values[in.indexes[0]].BigInt(new(big.Int)).String()
+		}
+	}
+	return labels, nil
+}
+
+// LabelPublicInputs returns the public inputs of the public witness (gnark
+// binary encoding) of a proof of the circuit by name, see InputLabeler
+func LabelPublicInputs(circuit frontend.Circuit, publicWitness []byte) (map[string]string, error) {
+	l, err := NewInputLabeler(circuit)
+	if err != nil {
+		return nil, err
+	}
+	return l.Label(publicWitness)
+}
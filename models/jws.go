@@ -0,0 +1,72 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jwsHeader is the protected header of the JWS signed by the verifier and
+// the holders (catalog, consent)
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// signJWS signs the JSON of payload (JWS ES256, compact serialization)
+func signJWS(typ, kid string, payload any, key *ecdsa.PrivateKey) (string, error) {
+	protectedJSON, err := json.Marshal(jwsHeader{Alg: "ES256", Typ: typ, Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64(protectedJSON) + "." + b64(payloadJSON)
+	signature, err := signES256([]byte(signingInput), key)
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64(signature), nil
+}
+
+// parseJWS verifies a JWS of signJWS of type typ with the key resolved from
+// its kid and decodes its payload
+func parseJWS(compact, typ string, resolveKey func(kid string) (*ecdsa.PublicKey, error), payload any) error {
+	parts := strings.Split(strings.TrimSpace(compact), ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("expected 3 parts, got %d", len(parts))
+	}
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return fmt.Errorf("part %d: %w", i, err)
+		}
+	}
+
+	var header jwsHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	if header.Alg != "ES256" || header.Typ != typ {
+		return fmt.Errorf("header: alg %q, typ %q", header.Alg, header.Typ)
+	}
+	key, err := resolveKey(header.Kid)
+	if err != nil {
+		return fmt.Errorf("failed to resolve key %q: %w", header.Kid, err)
+	}
+	if err := verifyES256([]byte(parts[0]+"."+parts[1]), decoded[2], key); err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+
+	if err := json.Unmarshal(decoded[1], payload); err != nil {
+		return fmt.Errorf("payload: %w", err)
+	}
+	return nil
+}
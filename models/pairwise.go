@@ -0,0 +1,202 @@
+package models
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// HolderSecret is the secret the pairwise identifiers of a holder derive from
+// (common.PairwiseID). It stays on the holder device: anyone knowing it links
+// the identifiers of the holder across verifiers. A lost secret loses the
+// identifiers, derive it from a backed up wallet key (DeriveHolderSecret) to
+// restore them. The credentials bind it by a salted commitment (Commit).
+type HolderSecret [common.HolderSecretSize]byte
+
+// holderSecretInfo is the HKDF info of DeriveHolderSecret
+const holderSecretInfo = "eudi-zk pairwise holder secret"
+
+// NewHolderSecret returns a random holder secret
+func NewHolderSecret() (HolderSecret, error) {
+	var s HolderSecret
+	if _, err := rand.Read(s[:]); err != nil {
+		return s, fmt.Errorf("failed to generate the holder secret: %w", err)
+	}
+	return s, nil
+}
+
+// DeriveHolderSecret derives the holder secret of a wallet from its master key
+// (HKDF-SHA-256), so the pairwise identifiers survive a restore from backup.
+// wallet separates the secrets of the wallets sharing a master key.
+func DeriveHolderSecret(masterKey []byte, wallet string) (HolderSecret, error) {
+	var s HolderSecret
+	if len(masterKey) < common.HolderSecretSize {
+		return s, fmt.Errorf("master key of %d bytes, at least %d", len(masterKey), common.HolderSecretSize)
+	}
+	key, err := hkdf.Key(sha256.New, masterKey, []byte(wallet), holderSecretInfo, len(s))
+	if err != nil {
+		return s, err
+	}
+	copy(s[:], key)
+	return s, nil
+}
+
+// MarshalText encodes the secret in base64url, for the secure storage of the
+// wallet
+func (s HolderSecret) MarshalText() ([]byte, error) {
+	return []byte(base64.RawURLEncoding.EncodeToString(s[:])), nil
+}
+
+// UnmarshalText decodes a secret encoded by MarshalText
+func (s *HolderSecret) UnmarshalText(text []byte) error {
+	b, err := base64.RawURLEncoding.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid holder secret: %w", err)
+	}
+	if len(b) != len(s) {
+		return fmt.Errorf("invalid holder secret: %d bytes, expected %d", len(b), len(s))
+	}
+	copy(s[:], b)
+	return nil
+}
+
+// PairwiseID returns the pairwise identifier of the holder for the verifier,
+// its client_id zero padded to size, the size of the verifier id in the
+// circuit. It matches common.PairwiseID.
+func (s HolderSecret) PairwiseID(verifierID string, size int) ([]byte, error) {
+	padded, err := padVerifierID(verifierID, size)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(s[:])
+	h.Write(padded)
+	return h.Sum(nil)[:common.AttributeDigestSize], nil
+}
+
+// Commit returns a random salt and the commitment to the secret with it
+// (Commitment). The holder sends the commitment to the issuer, which signs it
+// in the hsc claim of the protected header of the credential, and keeps the
+// salt with the credential to open the commitment in the circuit.
+func (s HolderSecret) Commit() ([]byte, string, error) {
+	salt := make([]byte, common.HolderSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, "", fmt.Errorf("failed to generate the holder salt: %w", err)
+	}
+	commitment, err := s.Commitment(salt)
+	return salt, commitment, err
+}
+
+// Commitment returns the hex encoded commitment to the secret with the salt,
+// the hsc claim of the credential. It matches common.VerifyHolderCommitment.
+func (s HolderSecret) Commitment(salt []byte) (string, error) {
+	if len(salt) != common.HolderSaltSize {
+		return "", fmt.Errorf("holder salt of %d bytes, expected %d", len(salt), common.HolderSaltSize)
+	}
+	h := sha256.New()
+	h.Write(salt)
+	h.Write(s[:])
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// padVerifierID pads the verifier id as SessionTranscript.Components
+func padVerifierID(verifierID string, size int) ([]byte, error) {
+	if verifierID == "" {
+		return nil, fmt.Errorf("empty verifier id")
+	}
+	if len(verifierID) > size {
+		return nil, fmt.Errorf("verifier id of %d bytes exceeds %d", len(verifierID), size)
+	}
+	if strings.IndexByte(verifierID, 0) >= 0 {
+		return nil, fmt.Errorf("verifier id contains a zero byte")
+	}
+	padded := make([]byte, size)
+	copy(padded, verifierID)
+	return padded, nil
+}
+
+// PairwiseID is the pseudonym of the holder proven for a verifier
+type PairwiseID struct {
+	// ID is the pairwise identifier, stable across the presentations of the
+	// holder to the verifier
+	ID []byte `json:"id"`
+	// VerifierID is the client_id the identifier was derived for
+	VerifierID string `json:"verifier_id"`
+}
+
+// pairwiseDecoder reads the pairwise identifier (common.PairwiseIDField) of a
+// circuit and the verifier id it was derived for from its public witness
+type pairwiseDecoder struct {
+	nbPublic int
+	// id is the index of the identifier in the public witness, verifierID the
+	// indexes of the verifier id bytes
+	id         int
+	verifierID []int
+}
+
+// newPairwiseDecoder locates the pairwise identifier and the verifier id
+// (common.TranscriptVerifierIDField) among the public inputs of the circuit,
+// the template the circuit was compiled with
+func newPairwiseDecoder(circuit frontend.Circuit) (*pairwiseDecoder, error) {
+	d := &pairwiseDecoder{id: -1}
+	id := regexp.MustCompile(`^` + common.PairwiseIDField + `_0$`)
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		name := leaf.FullName()
+		if id.MatchString(name) {
+			d.id = d.nbPublic
+		} else if m := transcriptByte.FindStringSubmatch(name); m != nil && m[1] == common.TranscriptVerifierIDField {
+			d.verifierID = append(d.verifierID, d.nbPublic)
+		}
+		d.nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.id < 0 {
+		return nil, fmt.Errorf("circuit has no public %s", common.PairwiseIDField)
+	}
+	if len(d.verifierID) == 0 {
+		return nil, fmt.Errorf("circuit has no public %s", common.TranscriptVerifierIDField)
+	}
+	return d, nil
+}
+
+// Decode returns the pairwise identifier of the public witness (gnark binary
+// encoding)
+func (d *pairwiseDecoder) Decode(publicWitness []byte) (*PairwiseID, error) {
+	values, err := publicValues(publicWitness, d.nbPublic)
+	if err != nil {
+		return nil, err
+	}
+	b := values[d.id].Bytes()
+	if !bytes.Equal(b[:len(b)-common.AttributeDigestSize], make([]byte, len(b)-common.AttributeDigestSize)) {
+		return nil, fmt.Errorf("%w: pairwise identifier out of range", ErrInvalidWitness)
+	}
+	verifierID := make([]byte, len(d.verifierID))
+	for i, index := range d.verifierID {
+		if !values[index].IsUint64() || values[index].Uint64() > 0xFF {
+			return nil, fmt.Errorf("%w: invalid verifier id", ErrInvalidWitness)
+		}
+		verifierID[i] = byte(values[index].Uint64())
+	}
+	return &PairwiseID{
+		ID:         b[len(b)-common.AttributeDigestSize:],
+		VerifierID: string(bytes.TrimRight(verifierID, "\x00")),
+	}, nil
+}
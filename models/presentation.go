@@ -0,0 +1,274 @@
+package models
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// ZkPresentation is a zero-knowledge presentation, see verifier.Presentation
+type ZkPresentation = verifier.Presentation
+
+// PresentationHeader is the protected header of a ZkPresentation
+type PresentationHeader = verifier.PresentationHeader
+
+// PresentationPayload is the payload of a ZkPresentation
+type PresentationPayload = verifier.PresentationPayload
+
+// PresentationProof is a proof of a composite presentation, see
+// verifier.PresentationProof
+type PresentationProof = verifier.PresentationProof
+
+// CompositeCircuit is the circuit of the protected header of the composite
+// presentations
+const CompositeCircuit = verifier.CompositeCircuit
+
+// PresentationType is the typ of the protected header
+const PresentationType = verifier.PresentationType
+
+// PresentationMediaTypeCOSE is the media type of a COSE encoded presentation
+const PresentationMediaTypeCOSE = verifier.PresentationMediaTypeCOSE
+
+// SignPresentation signs and serializes a presentation with the holder key
+func SignPresentation(header PresentationHeader, payload PresentationPayload, proof []byte, key *ecdsa.PrivateKey) (string, error) {
+	return verifier.SignPresentation(header, payload, proof, key)
+}
+
+// SignPresentationES256 signs and serializes a presentation with an ES256
+// signer of the holder key, see verifier.SignPresentationES256
+func SignPresentationES256(header PresentationHeader, payload PresentationPayload, proof []byte, sign func(data []byte) ([]byte, error)) (string, error) {
+	return verifier.SignPresentationES256(header, payload, proof, sign)
+}
+
+// Presentation algs, see verifier.AlgES256MLDSA65
+const (
+	AlgES256        = verifier.AlgES256
+	AlgES256MLDSA65 = verifier.AlgES256MLDSA65
+)
+
+// ErrUnsupportedAlg is returned for a presentation alg the verifier does not
+// accept or the build does not provide
+var ErrUnsupportedAlg = verifier.ErrUnsupportedAlg
+
+// SupportedAlgs returns the presentation algs of this build, in preference
+// order
+func SupportedAlgs() []string {
+	return verifier.SupportedAlgs()
+}
+
+// NegotiateAlg returns the first alg of accepted (Catalog.Algs) the holder
+// supports, ES256 when accepted is empty
+func NegotiateAlg(accepted, supported []string) (string, error) {
+	return verifier.NegotiateAlg(accepted, supported)
+}
+
+// SignPresentationHybrid signs and serializes a presentation with the holder
+// key and its ML-DSA-65 key, alg AlgES256MLDSA65
+func SignPresentationHybrid(header PresentationHeader, payload PresentationPayload, proof []byte, key *ecdsa.PrivateKey, pqKey crypto.Signer) (string, error) {
+	return verifier.SignPresentationHybrid(header, payload, proof, key, pqKey)
+}
+
+// SignPresentationCOSE signs a presentation with the holder key and encodes
+// it as a tagged COSE_Sign1
+func SignPresentationCOSE(header PresentationHeader, payload PresentationPayload, proof []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+	return verifier.SignPresentationCOSE(header, payload, proof, key)
+}
+
+// DefaultPresentationTTL is the lifetime of the presentations of a
+// PresentationBuilder without TTL, and of the presentations without exp
+// (verifier.Presentation.Expiry)
+const DefaultPresentationTTL = verifier.DefaultPresentationTTL
+
+// PresentationBuilder signs the presentations of a holder with a bounded
+// lifetime: the payloads are issued (iat) at the signature time and expire
+// (exp) TTL later, not after the credential (cred_exp). A presentation
+// captured by a relying party cannot be replayed beyond its exp.
+type PresentationBuilder struct {
+	// Key is the holder key
+	Key *ecdsa.PrivateKey
+	// PQKey is the ML-DSA-65 key of the holder (*mldsa.PrivateKey, or a
+	// crypto.Signer of a device holding one), optional
+	PQKey crypto.Signer
+	// Alg is the alg of the compact presentations, negotiated with
+	// NegotiateAlg; AlgES256MLDSA65 when PQKey is set and AlgES256
+	// otherwise when empty
+	Alg string
+	// TTL is the lifetime of the presentations, DefaultPresentationTTL when 0
+	TTL time.Duration
+	// Now is the clock of the holder, time.Now when nil
+	Now func() time.Time
+	// Random is the random source of the presentation ids, crypto/rand when
+	// nil; tests inject a common.DeterministicRandom source
+	Random io.Reader
+	// Receipts saves the consent receipts of SignWithReceipt, optional
+	Receipts ReceiptStore
+}
+
+// Sign signs and serializes a presentation, see SignPresentation. It returns
+// ErrCredentialExpired for a credential expired at the signature time.
+func (b *PresentationBuilder) Sign(header PresentationHeader, payload PresentationPayload, proof []byte) (string, error) {
+	payload, err := b.payload(payload)
+	if err != nil {
+		return "", err
+	}
+	return b.sign(header, payload, proof)
+}
+
+// Algs returns the presentation algs the builder signs, in preference order:
+// the input of NegotiateAlg
+func (b *PresentationBuilder) Algs() []string {
+	if b.PQKey != nil && slices.Contains(SupportedAlgs(), AlgES256MLDSA65) {
+		return []string{AlgES256MLDSA65, AlgES256}
+	}
+	return []string{AlgES256}
+}
+
+// sign signs and serializes a presentation with the alg of the builder
+func (b *PresentationBuilder) sign(header PresentationHeader, payload PresentationPayload, proof []byte) (string, error) {
+	alg := b.Alg
+	if alg == "" {
+		alg = b.Algs()[0]
+	}
+	switch alg {
+	case AlgES256:
+		return SignPresentation(header, payload, proof, b.Key)
+	case AlgES256MLDSA65:
+		if b.PQKey == nil {
+			return "", fmt.Errorf("%w: %s without post-quantum key", ErrUnsupportedAlg, alg)
+		}
+		return SignPresentationHybrid(header, payload, proof, b.Key, b.PQKey)
+	}
+	return "", fmt.Errorf("%w %q", ErrUnsupportedAlg, alg)
+}
+
+// SignCOSE signs a presentation and encodes it as a tagged COSE_Sign1, see
+// SignPresentationCOSE. The COSE presentations are ES256 only.
+func (b *PresentationBuilder) SignCOSE(header PresentationHeader, payload PresentationPayload, proof []byte) ([]byte, error) {
+	if b.Alg != "" && b.Alg != AlgES256 {
+		return nil, fmt.Errorf("%w %q for a COSE presentation", ErrUnsupportedAlg, b.Alg)
+	}
+	payload, err := b.payload(payload)
+	if err != nil {
+		return nil, err
+	}
+	return SignPresentationCOSE(header, payload, proof, b.Key)
+}
+
+// SignWithReceipt signs a presentation, see Sign, and its consent receipt
+// signed with the same key under the kid of the header. The receipt is saved
+// in Receipts when set, a presentation whose receipt is not saved is not
+// returned.
+func (b *PresentationBuilder) SignWithReceipt(header PresentationHeader, payload PresentationPayload, proof []byte, policy string) (string, *ReceiptRecord, error) {
+	payload, err := b.payload(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	compact, err := b.sign(header, payload, proof)
+	if err != nil {
+		return "", nil, err
+	}
+	receipt, err := NewConsentReceipt(header, payload, policy)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := SignReceipt(receipt, b.Key, header.Kid)
+	if err != nil {
+		return "", nil, err
+	}
+	record := &ReceiptRecord{Token: token, Receipt: receipt}
+	if b.Receipts != nil {
+		if err := b.Receipts.SaveReceipt(*record); err != nil {
+			return "", nil, fmt.Errorf("failed to save the receipt: %w", err)
+		}
+	}
+	return compact, record, nil
+}
+
+// payload sets the iat and the exp of the payload, an exp set by the caller
+// is kept when earlier, and its jti when unset: a UUIDv7 (common.NewUUIDv7),
+// unpredictable and unique, for the replay checks of the verifiers
+// (PresentationVerifier.Replay)
+func (b *PresentationBuilder) payload(payload PresentationPayload) (PresentationPayload, error) {
+	now := time.Now()
+	if b.Now != nil {
+		now = b.Now()
+	}
+	if payload.ID == "" {
+		id, err := common.NewUUIDv7(b.Random, now)
+		if err != nil {
+			return payload, fmt.Errorf("presentation id: %w", err)
+		}
+		payload.ID = id
+	}
+	ttl := b.TTL
+	if ttl <= 0 {
+		ttl = DefaultPresentationTTL
+	}
+	payload.IssuedAt = now.Unix()
+	exp := now.Add(ttl).Unix()
+	if c := payload.CredentialExpiresAt; c != 0 {
+		if c <= payload.IssuedAt {
+			return payload, fmt.Errorf("%w at %s", ErrCredentialExpired, time.Unix(c, 0).UTC().Format(time.RFC3339))
+		}
+		exp = min(exp, c)
+	}
+	if payload.ExpiresAt == 0 || exp < payload.ExpiresAt {
+		payload.ExpiresAt = exp
+	}
+	return payload, nil
+}
+
+// ParsePresentation parses the compact serialization of a presentation, the
+// signature is not verified
+func ParsePresentation(compact string) (*ZkPresentation, error) {
+	return verifier.ParsePresentation(compact)
+}
+
+// ParsePresentationCOSE parses a COSE encoded presentation, the signature is
+// not verified
+func ParsePresentationCOSE(data []byte) (*ZkPresentation, error) {
+	return verifier.ParsePresentationCOSE(data)
+}
+
+// signES256 signs data and returns the signature as r || s
+func signES256(data []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("ES256 signature failed: %w", err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature, nil
+}
+
+// verifyES256 verifies an ES256 signature (r || s) of data
+func verifyES256(data, signature []byte, key *ecdsa.PublicKey) error {
+	if len(signature) != 64 {
+		return fmt.Errorf("invalid signature size %d", len(signature))
+	}
+
+	digest := sha256.Sum256(data)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JWE wrapping of a presentation, for verifiers requiring the response to be
+// encrypted to their key in transit (OpenID4VP response encryption). The
+// presentation, compact or COSE, is the plaintext of a compact JWE (RFC 7516):
+//
+//	base64url(protected) ".." base64url(iv) "." base64url(ciphertext) "." base64url(tag)
+//
+// with direct key agreement (alg ECDH-ES, P-256 ephemeral key epk in the
+// protected header) and content encryption A256GCM; the encrypted key part is
+// empty. cty is the media type of the presentation.
+
+// PresentationMediaTypeJWE is the media type of an encrypted presentation
+const PresentationMediaTypeJWE = "application/jose"
+
+const (
+	jweAlgECDHES  = "ECDH-ES"
+	jweEncA256GCM = "A256GCM"
+)
+
+// JWK is an EC P-256 JSON Web Key (RFC 7517), public, or private when D is set
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	D   string `json:"d,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// NewJWK returns the JWK of a P-256 public key
+func NewJWK(key *ecdh.PublicKey) (JWK, error) {
+	if key.Curve() != ecdh.P256() {
+		return JWK{}, fmt.Errorf("jwk: unsupported curve %s", key.Curve())
+	}
+	// uncompressed point 0x04 || x || y
+	point := key.Bytes()
+	return JWK{Kty: "EC", Crv: "P-256", X: b64(point[1:33]), Y: b64(point[33:])}, nil
+}
+
+// PublicKey returns the P-256 public key of the JWK
+func (k JWK) PublicKey() (*ecdh.PublicKey, error) {
+	if k.Kty != "EC" || k.Crv != "P-256" {
+		return nil, fmt.Errorf("jwk: unsupported key %s %s", k.Kty, k.Crv)
+	}
+	x, errX := base64.RawURLEncoding.DecodeString(k.X)
+	y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+	if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("jwk: invalid coordinates")
+	}
+	// NewPublicKey checks that the point is on the curve
+	key, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+	if err != nil {
+		return nil, fmt.Errorf("jwk: %w", err)
+	}
+	return key, nil
+}
+
+// PrivateKey returns the P-256 private key of the JWK, which must match its
+// public key
+func (k JWK) PrivateKey() (*ecdh.PrivateKey, error) {
+	if k.D == "" {
+		return nil, fmt.Errorf("jwk: not a private key")
+	}
+	public, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	d, err := base64.RawURLEncoding.DecodeString(k.D)
+	if err != nil {
+		return nil, fmt.Errorf("jwk: invalid private key: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("jwk: %w", err)
+	}
+	if !key.PublicKey().Equal(public) {
+		return nil, fmt.Errorf("jwk: private key does not match the public key")
+	}
+	return key, nil
+}
+
+// jweHeader is the protected header of an encrypted presentation
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Kid string `json:"kid,omitempty"`
+	Cty string `json:"cty,omitempty"`
+	Epk JWK    `json:"epk"`
+	// Apu and Apv are the PartyUInfo and PartyVInfo of the key derivation,
+	// base64url
+	Apu string `json:"apu,omitempty"`
+	Apv string `json:"apv,omitempty"`
+}
+
+// EncryptPresentation encrypts a presentation to the verifier key recipient.
+// contentType is the media type of the presentation, PresentationMediaTypeCOSE
+// for a COSE presentation, empty for the compact serialization. The kid of
+// recipient is copied to the header, for verifiers with several keys.
+func EncryptPresentation(presentation []byte, contentType string, recipient JWK) (string, error) {
+	recipientKey, err := recipient.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	epk, err := NewJWK(ephemeral.PublicKey())
+	if err != nil {
+		return "", err
+	}
+	z, err := ephemeral.ECDH(recipientKey)
+	if err != nil {
+		return "", fmt.Errorf("jwe: key agreement: %w", err)
+	}
+
+	header := jweHeader{Alg: jweAlgECDHES, Enc: jweEncA256GCM, Kid: recipient.Kid, Cty: contentType, Epk: epk}
+	if header.Cty == "" {
+		header.Cty = PresentationType
+	}
+	protectedJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := b64(protectedJSON)
+
+	gcm, err := jweCipher(z, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	// the protected header is the additional authenticated data
+	sealed := gcm.Seal(nil, iv, presentation, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return protected + ".." + b64(iv) + "." + b64(ciphertext) + "." + b64(tag), nil
+}
+
+// DecryptPresentation decrypts an encrypted presentation with the verifier
+// key, and returns the presentation and its media type (cty)
+func DecryptPresentation(jwe string, key *ecdh.PrivateKey) ([]byte, string, error) {
+	parts := strings.Split(strings.TrimSpace(jwe), ".")
+	if len(parts) != 5 {
+		return nil, "", fmt.Errorf("invalid encrypted presentation: expected 5 parts, got %d", len(parts))
+	}
+	if parts[1] != "" {
+		return nil, "", fmt.Errorf("invalid encrypted presentation: unexpected encrypted key with %s", jweAlgECDHES)
+	}
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, "", fmt.Errorf("invalid encrypted presentation: part %d: %w", i, err)
+		}
+	}
+
+	var header jweHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return nil, "", fmt.Errorf("invalid encrypted presentation header: %w", err)
+	}
+	if header.Alg != jweAlgECDHES || header.Enc != jweEncA256GCM {
+		return nil, "", fmt.Errorf("unsupported encrypted presentation alg %q enc %q", header.Alg, header.Enc)
+	}
+	epk, err := header.Epk.PublicKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid encrypted presentation epk: %w", err)
+	}
+	apu, errU := base64.RawURLEncoding.DecodeString(header.Apu)
+	apv, errV := base64.RawURLEncoding.DecodeString(header.Apv)
+	if errU != nil || errV != nil {
+		return nil, "", fmt.Errorf("invalid encrypted presentation apu or apv")
+	}
+	z, err := key.ECDH(epk)
+	if err != nil {
+		return nil, "", fmt.Errorf("jwe: key agreement: %w", err)
+	}
+
+	gcm, err := jweCipher(z, apu, apv)
+	if err != nil {
+		return nil, "", err
+	}
+	iv, ciphertext, tag := decoded[2], decoded[3], decoded[4]
+	if len(iv) != gcm.NonceSize() || len(tag) != gcm.Overhead() {
+		return nil, "", fmt.Errorf("invalid encrypted presentation: iv or tag size")
+	}
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt the presentation")
+	}
+	return plaintext, header.Cty, nil
+}
+
+// jweCipher returns the A256GCM cipher of the content encryption key derived
+// from the shared secret z with the Concat KDF (NIST SP 800-56A, RFC 7518
+// section 4.6.2); one round of SHA-256 gives the 256-bit key
+func jweCipher(z, apu, apv []byte) (cipher.AEAD, error) {
+	lengthPrefixed := func(b []byte) []byte {
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+	}
+	h := sha256.New()
+	h.Write(binary.BigEndian.AppendUint32(nil, 1))
+	h.Write(z)
+	h.Write(lengthPrefixed([]byte(jweEncA256GCM)))
+	h.Write(lengthPrefixed(apu))
+	h.Write(lengthPrefixed(apv))
+	h.Write(binary.BigEndian.AppendUint32(nil, 256))
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
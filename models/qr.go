@@ -0,0 +1,50 @@
+package models
+
+import "fmt"
+
+// QRLevel is the error correction level of a QR code
+type QRLevel int
+
+const (
+	QRLevelL QRLevel = iota // ~7% recovery
+	QRLevelM                // ~15% recovery
+	QRLevelQ                // ~25% recovery
+	QRLevelH                // ~30% recovery
+)
+
+// qrByteCapacity is the byte mode capacity of the QR code versions 1 to 40,
+// per error correction level (ISO/IEC 18004)
+var qrByteCapacity = [4][40]int{
+	QRLevelL: {17, 32, 53, 78, 106, 134, 154, 192, 230, 271, 321, 367, 425, 458, 520, 586, 644, 718, 792, 858,
+		929, 1003, 1091, 1171, 1273, 1367, 1465, 1528, 1628, 1732, 1840, 1952, 2068, 2188, 2303, 2431, 2563, 2699, 2809, 2953},
+	QRLevelM: {14, 26, 42, 62, 84, 106, 122, 152, 180, 213, 251, 287, 331, 362, 412, 450, 504, 560, 624, 666,
+		711, 779, 857, 911, 997, 1059, 1125, 1190, 1264, 1370, 1452, 1538, 1628, 1722, 1809, 1911, 1989, 2099, 2213, 2331},
+	QRLevelQ: {11, 20, 32, 46, 60, 74, 86, 108, 130, 151, 177, 203, 241, 258, 292, 322, 364, 394, 442, 482,
+		509, 565, 611, 661, 715, 751, 805, 868, 908, 982, 1030, 1112, 1168, 1228, 1283, 1351, 1423, 1499, 1579, 1663},
+	QRLevelH: {7, 14, 24, 34, 44, 58, 64, 84, 98, 119, 137, 155, 177, 194, 220, 250, 280, 310, 338, 382,
+		403, 439, 461, 511, 535, 593, 625, 658, 698, 742, 790, 842, 898, 958, 983, 1051, 1093, 1139, 1219, 1273},
+}
+
+// QREstimate is the smallest QR code holding a presentation in byte mode
+type QREstimate struct {
+	Bytes   int     `json:"bytes"`
+	Level   QRLevel `json:"level"`
+	Version int     `json:"version"` // 1 to 40
+	Modules int     `json:"modules"` // modules per side, without the quiet zone
+}
+
+// EstimateQR returns the smallest QR code version holding size bytes at the
+// error correction level, or an error when the data does not fit in a single
+// QR code (version 40)
+func EstimateQR(size int, level QRLevel) (*QREstimate, error) {
+	if level < QRLevelL || level > QRLevelH {
+		return nil, fmt.Errorf("unknown QR error correction level %d", level)
+	}
+	for i, capacity := range qrByteCapacity[level] {
+		if size <= capacity {
+			version := i + 1
+			return &QREstimate{Bytes: size, Level: level, Version: version, Modules: 17 + 4*version}, nil
+		}
+	}
+	return nil, fmt.Errorf("%d bytes exceed the QR code capacity (%d bytes)", size, qrByteCapacity[level][39])
+}
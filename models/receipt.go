@@ -0,0 +1,187 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// ReceiptType is the typ of the protected header of a consent receipt
+const ReceiptType = "zk-receipt+jwt"
+
+// ErrReceiptMismatch is returned for a consent receipt of another
+// presentation
+var ErrReceiptMismatch = errors.New("receipt does not match the presentation")
+
+// ConsentReceipt records a presentation for the holder (GDPR
+// accountability): what was disclosed, to whom, when and under which
+// policy. The holder signs it with its presentation key; it is bound to the
+// proof by the digest of the public witness, the inputs the proof was
+// verified with.
+type ConsentReceipt struct {
+	ID      string `json:"jti"`
+	Circuit string `json:"circuit"`
+	VKHash  string `json:"vk_hash"`
+	// Audience is the relying party (the aud of the presentation)
+	Audience string `json:"aud,omitempty"`
+	// PresentationID is the jti of the presentation, when set
+	PresentationID string `json:"presentation_jti,omitempty"`
+	// Disclosed are the names of the disclosed claims and predicates (the
+	// payload claims and the opened claim commitments), sorted
+	Disclosed []string `json:"disclosed"`
+	// Policy identifies the policy the holder accepted, e.g. the URL of the
+	// privacy policy of the relying party or a request id
+	Policy string `json:"policy,omitempty"`
+	// PresentedAt is the iat of the presentation
+	PresentedAt int64 `json:"iat"`
+	// PublicInputsDigest is the hex SHA-256 of the public witness
+	// (PublicInputsDigest)
+	PublicInputsDigest string `json:"public_inputs_digest"`
+}
+
+// PublicInputsDigest returns the hex SHA-256 of a public witness (gnark
+// binary encoding), the binding of a ConsentReceipt to its proof
+func PublicInputsDigest(publicWitness []byte) string {
+	digest := sha256.Sum256(publicWitness)
+	return hex.EncodeToString(digest[:])
+}
+
+// NewConsentReceipt returns the receipt of a presentation, policy is
+// optional
+func NewConsentReceipt(header PresentationHeader, payload PresentationPayload, policy string) (ConsentReceipt, error) {
+	id, err := common.GenerateRandomBytes(16)
+	if err != nil {
+		return ConsentReceipt{}, err
+	}
+	disclosed := make([]string, 0, len(payload.Claims)+len(payload.Openings))
+	for name := range payload.Claims {
+		disclosed = append(disclosed, name)
+	}
+	for _, opening := range payload.Openings {
+		disclosed = append(disclosed, opening.Name)
+	}
+	slices.Sort(disclosed)
+	return ConsentReceipt{
+		ID:                 b64(id),
+		Circuit:            header.Circuit,
+		VKHash:             header.VKHash,
+		Audience:           payload.Audience,
+		PresentationID:     payload.ID,
+		Disclosed:          slices.Compact(disclosed),
+		Policy:             policy,
+		PresentedAt:        payload.IssuedAt,
+		PublicInputsDigest: PublicInputsDigest(payload.PublicWitness),
+	}, nil
+}
+
+// SignReceipt signs the receipt (JWS ES256, compact serialization) with the
+// holder key
+func SignReceipt(receipt ConsentReceipt, key *ecdsa.PrivateKey, kid string) (string, error) {
+	return signJWS(ReceiptType, kid, receipt, key)
+}
+
+// ParseReceipt verifies the signature of a receipt with the holder key
+// resolved from its kid and returns the receipt
+func ParseReceipt(compact string, resolveKey func(kid string) (*ecdsa.PublicKey, error)) (*ConsentReceipt, error) {
+	var receipt ConsentReceipt
+	if err := parseJWS(compact, ReceiptType, resolveKey, &receipt); err != nil {
+		return nil, fmt.Errorf("invalid receipt: %w", err)
+	}
+	return &receipt, nil
+}
+
+// Check returns ErrReceiptMismatch when the receipt is not the one of the
+// presentation
+func (r *ConsentReceipt) Check(p *ZkPresentation) error {
+	switch {
+	case r.Circuit != p.Header.Circuit || r.VKHash != p.Header.VKHash:
+		return fmt.Errorf("%w: circuit %q, receipt for %q", ErrReceiptMismatch, p.Header.Circuit, r.Circuit)
+	case r.PublicInputsDigest != PublicInputsDigest(p.Payload.PublicWitness):
+		return fmt.Errorf("%w: public inputs digest", ErrReceiptMismatch)
+	case r.Audience != p.Payload.Audience || r.PresentedAt != p.Payload.IssuedAt:
+		return fmt.Errorf("%w: audience or iat", ErrReceiptMismatch)
+	}
+	return nil
+}
+
+// ReceiptStore keeps the receipts of a holder, e.g. in the wallet storage
+type ReceiptStore interface {
+	// SaveReceipt saves a signed receipt
+	SaveReceipt(record ReceiptRecord) error
+}
+
+// ReceiptRecord is a signed receipt and its content
+type ReceiptRecord struct {
+	Token   string         `json:"token"`
+	Receipt ConsentReceipt `json:"receipt"`
+}
+
+// receiptExport is the export format of the receipts
+type receiptExport struct {
+	Receipts []ReceiptRecord `json:"receipts"`
+}
+
+// ExportReceipts returns the records as JSON, {"receipts": [{"token",
+// "receipt"}]}, the format of the records of the holder
+func ExportReceipts(records []ReceiptRecord) ([]byte, error) {
+	return json.Marshal(receiptExport{Receipts: records})
+}
+
+// ImportReceipts reads exported receipts, the token of every record is
+// verified with the holder key and must carry its receipt
+func ImportReceipts(data []byte, resolveKey func(kid string) (*ecdsa.PublicKey, error)) ([]ReceiptRecord, error) {
+	var export receiptExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid receipts: %w", err)
+	}
+	for i, record := range export.Receipts {
+		receipt, err := ParseReceipt(record.Token, resolveKey)
+		if err != nil {
+			return nil, fmt.Errorf("receipt %d: %w", i, err)
+		}
+		if !receipt.equal(&record.Receipt) {
+			return nil, fmt.Errorf("receipt %d: the token does not carry the receipt", i)
+		}
+	}
+	return export.Receipts, nil
+}
+
+func (r *ConsentReceipt) equal(other *ConsentReceipt) bool {
+	return r.ID == other.ID && r.Circuit == other.Circuit && r.VKHash == other.VKHash &&
+		r.Audience == other.Audience && r.PresentationID == other.PresentationID &&
+		slices.Equal(r.Disclosed, other.Disclosed) && r.Policy == other.Policy &&
+		r.PresentedAt == other.PresentedAt && r.PublicInputsDigest == other.PublicInputsDigest
+}
+
+// MemoryReceiptStore is an in-memory ReceiptStore
+type MemoryReceiptStore struct {
+	mu      sync.Mutex
+	records []ReceiptRecord
+}
+
+// SaveReceipt implements ReceiptStore
+func (s *MemoryReceiptStore) SaveReceipt(record ReceiptRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+// Records returns the saved records, oldest first
+func (s *MemoryReceiptStore) Records() []ReceiptRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.records)
+}
+
+// Export returns the saved records in the format of ExportReceipts
+func (s *MemoryReceiptStore) Export() ([]byte, error) {
+	return ExportReceipts(s.Records())
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrReplayed is returned for a presentation whose jti was verified already
+// while it can be accepted, or without jti or lifetime bound when replays are
+// checked
+var ErrReplayed = errors.New("presentation replayed")
+
+// ReplayCache remembers the jti of the verified presentations
+// (PresentationVerifier.Replay). MemoryReplayCache serves a single process,
+// a fleet of verifiers shares one backed by its store.
+type ReplayCache interface {
+	// Record remembers id until expires and reports whether it was recorded
+	// already and is not expired at now
+	Record(id string, now, expires time.Time) (replayed bool, err error)
+}
+
+// MemoryReplayCache is a ReplayCache in process memory, its expired ids are
+// dropped as new ones are recorded
+type MemoryReplayCache struct {
+	mu  sync.Mutex
+	ids map[string]time.Time
+	// order are the ids in recording order, for the eviction: an id is
+	// dropped once it and the ids recorded before it expired
+	order []string
+}
+
+// NewMemoryReplayCache returns an empty cache
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{ids: map[string]time.Time{}}
+}
+
+// Record implements ReplayCache
+func (c *MemoryReplayCache) Record(id string, now, expires time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.order) > 0 {
+		oldest := c.order[0]
+		if exp, ok := c.ids[oldest]; ok && exp.After(now) {
+			break
+		}
+		delete(c.ids, oldest)
+		c.order = c.order[1:]
+	}
+	if exp, ok := c.ids[id]; ok && exp.After(now) {
+		return true, nil
+	}
+	c.ids[id] = expires
+	c.order = append(c.order, id)
+	return false, nil
+}
+
+// Len returns the number of ids remembered
+func (c *MemoryReplayCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.ids)
+}
+
+// replayExpiry is the time the jti of a verified presentation is remembered
+// until: as long as the presentation can be accepted, max(exp, iat+MaxAge)
+// and the clock skew, and at least ReplayWindow after now
+func (v *PresentationVerifier) replayExpiry(p *ZkPresentation, now time.Time) time.Time {
+	expires := p.Expiry()
+	if v.MaxAge > 0 {
+		if maxAge := time.Unix(p.Payload.IssuedAt, 0).Add(v.MaxAge); maxAge.After(expires) {
+			expires = maxAge
+		}
+	}
+	expires = expires.Add(v.ClockSkew)
+	if window := now.Add(v.ReplayWindow); window.After(expires) {
+		expires = window
+	}
+	return expires
+}
+
+// checkReplay records the jti of a verified presentation with Replay, it
+// fails for a jti recorded while the presentation can be accepted, a
+// presentation without jti, and a presentation without exp when MaxAge does
+// not bound its lifetime. The ids are recorded once every other check
+// passed, a forged presentation cannot burn the jti of another.
+func (v *PresentationVerifier) checkReplay(p *ZkPresentation, partial *VerificationResult) error {
+	if v.Replay == nil {
+		return nil
+	}
+	if p.Payload.ID == "" {
+		return failure(StageExpiry, CodeReplayed, fmt.Errorf("%w: the presentation has no jti", ErrReplayed), partial)
+	}
+	if p.Payload.ExpiresAt == 0 && v.MaxAge <= 0 {
+		return failure(StageExpiry, CodeReplayed, fmt.Errorf("%w: the presentation has no exp", ErrReplayed), partial)
+	}
+	now := v.now()
+	replayed, err := v.Replay.Record(p.Payload.ID, now, v.replayExpiry(p, now))
+	switch {
+	case err != nil:
+		// the cache is unavailable: the same presentation may verify later
+		return &VerificationError{Code: CodeReplayed, Stage: StageExpiry, Retryable: true, Partial: partial, Err: fmt.Errorf("replay cache: %w", err)}
+	case replayed:
+		return failure(StageExpiry, CodeReplayed, fmt.Errorf("%w: jti %q", ErrReplayed, p.Payload.ID), partial)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package models
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+var (
+	// ErrPresentationExpired is returned for a presentation past its exp or
+	// the maximum age of the verifier
+	ErrPresentationExpired = verifier.ErrPresentationExpired
+	// ErrCredentialExpired is returned for a presentation of a credential
+	// past its expiry (cred_exp)
+	ErrCredentialExpired = verifier.ErrCredentialExpired
+	// ErrKeyNotValid is returned for a proof made with a verifying key outside
+	// its validity at the verification time
+	ErrKeyNotValid = errors.New("verifying key is not valid at the verification time")
+	// ErrStaleCRLTime is returned for a CRL check time outside the skew of a
+	// CRLTimePolicy
+	ErrStaleCRLTime = errors.New("CRL check time is not current")
+)
+
+// VerificationOptions are the options of a verification
+type VerificationOptions struct {
+	// AsOf verifies as of a past time instead of the clock of the verifier,
+	// for audits of presentations that were valid when created: the expiry of
+	// the presentation, the challenge timestamp, the CRL check time and the
+	// validity of the verifying key are checked at AsOf, and a presentation
+	// issued after AsOf is rejected. Zero verifies at PresentationVerifier.Now.
+	AsOf time.Time
+	// Transcript is the session of the request the presentation answers, for
+	// circuits added with AddTranscript: the transcript the holder signed must
+	// be this one, else ErrTranscriptMismatch
+	Transcript *SessionTranscript
+	// ChannelBinding is the binding of the channel the presentation arrived
+	// on (TLSExporterBinding, SessionBinding): the nonce of the payload, and
+	// of the session transcript of circuits added with AddTranscript, must
+	// have been issued for it (NewChannelNonce), else ErrChannelMismatch. Not
+	// checked when nil.
+	ChannelBinding []byte
+}
+
+// at returns the verification time of the options
+func (o VerificationOptions) at(v *PresentationVerifier) time.Time {
+	if o.AsOf.IsZero() {
+		return v.now()
+	}
+	return o.AsOf
+}
+
+// KeyValidity is the period a verifying key of a circuit is accepted in, a
+// zero bound leaves it open
+type KeyValidity struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// Contains reports whether t is within the validity
+func (w KeyValidity) Contains(t time.Time) bool {
+	return (w.NotBefore.IsZero() || !t.Before(w.NotBefore)) && (w.NotAfter.IsZero() || t.Before(w.NotAfter))
+}
+
+// verify returns ErrKeyNotValid when t is outside the validity
+func (w KeyValidity) verify(circuitID, vkHash string, t time.Time) error {
+	if !w.Contains(t) {
+		return fmt.Errorf("%w: %q key %s at %s", ErrKeyNotValid, circuitID, vkHash, t.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CRLTimeField is the name of the public CRL check time of the CRL circuits
+// (cdl.CircuitCRL Now: YYYYMMDDHHMMSS, UTC), located in the public witness by
+// PresentationVerifier.AddCRLTime
+const CRLTimeField = "Now"
+
+// CRLBytesField is the name of the public CRL of the CRL circuits
+// (cdl.CircuitCRL CRLBytes, DER zero padded), its nextUpdate is returned by
+// PresentationVerifier.AddCRLTime
+const CRLBytesField = "CRLBytes"
+
+// crlTimeLayout is the layout of the CRL check time
+const crlTimeLayout = "20060102150405"
+
+// CRLTimePolicy bounds the CRL check time the prover chose: the CRL must be
+// fresh at a time within MaxSkew of the verification time, not at any time of
+// its validity
+type CRLTimePolicy struct {
+	MaxSkew time.Duration
+}
+
+// Verify checks the CRL check time is within the skew of now
+func (p CRLTimePolicy) Verify(checked, now time.Time) error {
+	if d := now.Sub(checked).Abs(); d > p.MaxSkew {
+		return fmt.Errorf("%w: %s is %v from %s, beyond %v", ErrStaleCRLTime, checked.UTC().Format(time.RFC3339), d, now.UTC().Format(time.RFC3339), p.MaxSkew)
+	}
+	return nil
+}
+
+// crlTimeDecoder reads the CRL check time (CRLTimeField) of a circuit from its
+// public witness and checks it against a policy
+type crlTimeDecoder struct {
+	nbPublic int
+	// indexes are the indexes of the time digits in the public witness, crl
+	// the ones of the CRL bytes, if public
+	indexes []int
+	crl     []int
+	policy  CRLTimePolicy
+}
+
+// newCRLTimeDecoder locates the CRL check time among the public inputs of the
+// circuit, the template the circuit was compiled with
+func newCRLTimeDecoder(circuit frontend.Circuit, policy CRLTimePolicy) (*crlTimeDecoder, error) {
+	digit := regexp.MustCompile(`^` + CRLTimeField + `_[0-9]+_Val$`)
+	crlByte := regexp.MustCompile(`^` + CRLBytesField + `_[0-9]+_Val$`)
+	d := &crlTimeDecoder{policy: policy}
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		switch name := leaf.FullName(); {
+		case digit.MatchString(name):
+			d.indexes = append(d.indexes, d.nbPublic)
+		case crlByte.MatchString(name):
+			d.crl = append(d.crl, d.nbPublic)
+		}
+		d.nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(d.indexes) != len(crlTimeLayout) {
+		return nil, fmt.Errorf("circuit has no public %s of %d bytes", CRLTimeField, len(crlTimeLayout))
+	}
+	return d, nil
+}
+
+// Decode returns the CRL check time of the public witness (gnark binary
+// encoding), after checking it is current at now, and the nextUpdate of the
+// CRL: zero when the CRL is not public
+func (d *crlTimeDecoder) Decode(publicWitness []byte, now time.Time) (checked, nextUpdate time.Time, err error) {
+	values, err := publicValues(publicWitness, d.nbPublic)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	digits := make([]byte, len(d.indexes))
+	for i, index := range d.indexes {
+		if !values[index].IsUint64() || values[index].Uint64() > 0xFF {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid CRL check time", ErrInvalidWitness)
+		}
+		digits[i] = byte(values[index].Uint64())
+	}
+	checked, err = time.Parse(crlTimeLayout, string(digits))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid CRL check time %q", ErrInvalidWitness, digits)
+	}
+	if err := d.policy.Verify(checked, now); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if len(d.crl) == 0 {
+		return checked, time.Time{}, nil
+	}
+
+	crl := make([]byte, len(d.crl))
+	for i, index := range d.crl {
+		if !values[index].IsUint64() || values[index].Uint64() > 0xFF {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid CRL", ErrInvalidWitness)
+		}
+		crl[i] = byte(values[index].Uint64())
+	}
+	// the CRL is zero padded to the size of the circuit
+	var der asn1.RawValue
+	if _, err := asn1.Unmarshal(crl, &der); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid CRL: %w", ErrInvalidWitness, err)
+	}
+	list, err := x509.ParseRevocationList(der.FullBytes)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid CRL: %w", ErrInvalidWitness, err)
+	}
+	return checked, list.NextUpdate, nil
+}
+
+// CRLStatusField is the name of the public revocation status of the CRL
+// circuits (cdl.CircuitCRL Status), located in the public witness by
+// PresentationVerifier.AddRevocationStatus
+const CRLStatusField = "Status"
+
+// ErrRevocationStatus is returned for a proof of another revocation status
+// than the requested one
+var ErrRevocationStatus = errors.New("revocation status is not the requested one")
+
+// RevocationStatus is the revocation status a verifier requests, the values
+// of cdl.CRLStatusNotRevoked and cdl.CRLStatusRevoked
+type RevocationStatus int
+
+const (
+	// StatusNotRevoked requests a proof the certificate is not in the CRL
+	StatusNotRevoked RevocationStatus = 0
+	// StatusRevoked requests a proof the certificate is in the CRL, e.g. a
+	// card reported lost
+	StatusRevoked RevocationStatus = 1
+)
+
+func (s RevocationStatus) String() string {
+	if s == StatusRevoked {
+		return "revoked"
+	}
+	return "not revoked"
+}
+
+// crlStatusDecoder reads the revocation status (CRLStatusField) of a circuit
+// from its public witness and checks it is the requested one
+type crlStatusDecoder struct {
+	nbPublic int
+	index    int
+	want     RevocationStatus
+}
+
+// newCRLStatusDecoder locates the revocation status among the public inputs
+// of the circuit, the template the circuit was compiled with
+func newCRLStatusDecoder(circuit frontend.Circuit, want RevocationStatus) (*crlStatusDecoder, error) {
+	if want != StatusNotRevoked && want != StatusRevoked {
+		return nil, fmt.Errorf("invalid revocation status %d", want)
+	}
+	d := &crlStatusDecoder{index: -1, want: want}
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		if leaf.FullName() == CRLStatusField {
+			d.index = d.nbPublic
+		}
+		d.nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.index < 0 {
+		return nil, fmt.Errorf("circuit has no public %s", CRLStatusField)
+	}
+	return d, nil
+}
+
+// Decode returns the revocation status of the public witness (gnark binary
+// encoding), after checking it is the requested one
+func (d *crlStatusDecoder) Decode(publicWitness []byte) (RevocationStatus, error) {
+	values, err := publicValues(publicWitness, d.nbPublic)
+	if err != nil {
+		return 0, err
+	}
+	value := values[d.index]
+	if !value.IsUint64() || value.Uint64() > 1 {
+		return 0, fmt.Errorf("%w: invalid revocation status", ErrInvalidWitness)
+	}
+	status := RevocationStatus(value.Uint64())
+	if status != d.want {
+		return 0, fmt.Errorf("%w: proven %s, requested %s", ErrRevocationStatus, status, d.want)
+	}
+	return status, nil
+}
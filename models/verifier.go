@@ -0,0 +1,768 @@
+package models
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// Failure classes of the verification, the returned errors wrap them with
+// the details
+var (
+	ErrUnknownCircuit = verifier.ErrUnknownCircuit
+	ErrInvalidWitness = verifier.ErrInvalidWitness
+	ErrProofFailed    = verifier.ErrProofFailed
+	// ErrMalformedProof and ErrPublicInputCount refine ErrProofFailed and
+	// ErrInvalidWitness, see verifier.ErrMalformedProof
+	ErrMalformedProof   = verifier.ErrMalformedProof
+	ErrPublicInputCount = verifier.ErrPublicInputCount
+)
+
+// FieldError is a payload member that does not match the schema
+type FieldError = verifier.FieldError
+
+// PayloadSchema is the schema of the presentation payload of a circuit, see
+// verifier.PayloadSchema
+type PayloadSchema = verifier.PayloadSchema
+
+// verifierCircuit is a circuit registered with a PresentationVerifier
+type verifierCircuit struct {
+	vk          groth16.VerifyingKey
+	vkHash      string
+	schema      *PayloadSchema
+	attributes  *AttributeDecoder
+	timestamp   *timestampDecoder
+	crlTime     *crlTimeDecoder
+	crlStatus   *crlStatusDecoder
+	transcript  *transcriptDecoder
+	commitments *commitmentDecoder
+	pairwise    *pairwiseDecoder
+	labeler     *InputLabeler
+
+	// validity is the validity of vk, rotated the former keys of the circuit
+	// accepted within their validity
+	validity KeyValidity
+	rotated  []rotatedKey
+}
+
+// rotatedKey is a former verifying key of a circuit
+type rotatedKey struct {
+	vk       groth16.VerifyingKey
+	vkHash   string
+	validity KeyValidity
+}
+
+// VerificationResult is the result of a successful verification
+type VerificationResult struct {
+	Circuit string
+	// Presentation is the verified presentation, nil for a raw proof
+	Presentation *ZkPresentation
+	// PublicInputs are decoded when the circuit is registered with AddAttributes
+	PublicInputs PublicInputs
+	// Labels are the public inputs by name, set when the circuit is
+	// registered with AddInputLabels
+	Labels map[string]string
+
+	// The fields below are derived at the verification time, for the soft
+	// policies of the relying party (e.g. warn when close to expiry)
+
+	// VKVersion is the version of the circuit the proof verified with: the
+	// registered verifying key, or the rotated one of the presentation
+	VKVersion CircuitVersion
+	// CredentialExpiresIn is the time left until the cred_exp of the
+	// presentation, or its exp without cred_exp; zero without either
+	CredentialExpiresIn time.Duration
+	// ChallengeAge is the age of the holder signature, negative for a
+	// timestamp ahead within the skew; set when the circuit is registered
+	// with AddTimestamp
+	ChallengeAge time.Duration
+	// CRLNextUpdate is the nextUpdate of the proven CRL, set when the circuit
+	// is registered with AddCRLTime and its CRL (CRLBytesField) is public
+	CRLNextUpdate time.Time
+	// Deprecation is set for a deprecated version of the circuit accepted by
+	// MinVersions in its grace period or warn-only, to warn the holder
+	Deprecation *Deprecation
+	// Entries are the results of the proofs of a composite presentation, in
+	// presentation order; Circuit is then CompositeCircuit
+	Entries []*VerificationResult
+}
+
+// PresentationVerifier verifies raw groth16 proofs and ZkPresentations of the
+// registered circuits
+type PresentationVerifier struct {
+	// ResolveKey returns the holder key verifying the presentation signature
+	ResolveKey func(header PresentationHeader) (*ecdsa.PublicKey, error)
+	// ResolvePQKey returns the encoded ML-DSA-65 public key of the holder
+	// verifying the post-quantum part of the hybrid signatures
+	// (AlgES256MLDSA65), which are verified on their ES256 part when nil
+	ResolvePQKey func(header PresentationHeader) ([]byte, error)
+	// Algs are the accepted presentation algs in preference order,
+	// SupportedAlgs when empty; [AlgES256MLDSA65] requires post-quantum
+	// envelopes
+	Algs []string
+	// Now is the clock the challenge timestamps are checked against,
+	// time.Now when nil
+	Now func() time.Time
+	// MaxAge bounds the age of the presentations (iat) at the verification
+	// time, whatever their exp; not checked when 0
+	MaxAge time.Duration
+	// ClockSkew tolerates the distance of the clock of the holders to the
+	// verification time in the checks of exp, cred_exp and MaxAge
+	ClockSkew time.Duration
+	// MinVersions rejects, or warns of, the circuit versions below the
+	// minimum version of their family; every version is accepted when nil
+	MinVersions *VersionPolicy
+	// Replay rejects the presentations whose jti was verified already
+	// (ErrReplayed), the presentations without jti, and without exp unless
+	// MaxAge is set; replays are not checked when nil. A jti is remembered
+	// as long as its presentation can be accepted: until max(exp,
+	// iat+MaxAge) and ClockSkew.
+	Replay ReplayCache
+	// ReplayWindow is the minimum time a jti is remembered, from its
+	// verification
+	ReplayWindow time.Duration
+	// SharedInputs are the labeled public inputs (AddInputLabels) the proofs
+	// of a composite presentation must agree on, DefaultSharedInputs when nil
+	SharedInputs []string
+
+	mu       sync.RWMutex
+	circuits map[string]*verifierCircuit
+}
+
+// NewPresentationVerifier returns a verifier without circuits
+func NewPresentationVerifier(resolveKey func(header PresentationHeader) (*ecdsa.PublicKey, error)) *PresentationVerifier {
+	return &PresentationVerifier{ResolveKey: resolveKey, circuits: map[string]*verifierCircuit{}}
+}
+
+// AddCircuit registers the verifying key and the payload schema (optional)
+// of a circuit
+func (v *PresentationVerifier) AddCircuit(circuitID string, vk groth16.VerifyingKey, schema *PayloadSchema) error {
+	vkHash, err := common.VerifyingKeyHash(vk)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.circuits[circuitID] = &verifierCircuit{vk: vk, vkHash: hex.EncodeToString(vkHash[:]), schema: schema}
+	return nil
+}
+
+// AddAttributes decodes the attribute slots (common.AssertAttributes) of the
+// public witness of a registered circuit into VerificationResult.PublicInputs.
+// circuit is the template the circuit was compiled with.
+func (v *PresentationVerifier) AddAttributes(circuitID string, circuit frontend.Circuit) error {
+	decoder, err := NewAttributeDecoder(circuit)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	// copy, verifications in progress hold the registered circuit
+	updated := *c
+	updated.attributes = decoder
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// AddTimestamp checks the challenge timestamp (common.ChallengeTimestampField)
+// of the public witness of a registered circuit against the policy, and
+// returns it in VerificationResult.PublicInputs. circuit is the template the
+// circuit was compiled with.
+func (v *PresentationVerifier) AddTimestamp(circuitID string, circuit frontend.Circuit, policy TimestampPolicy) error {
+	decoder, err := newTimestampDecoder(circuit, policy)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	// copy, verifications in progress hold the registered circuit
+	updated := *c
+	updated.timestamp = decoder
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// AddCRLTime checks the CRL check time (CRLTimeField) of the public witness of
+// a registered circuit against the policy, and returns it in
+// VerificationResult.PublicInputs. circuit is the template the circuit was
+// compiled with.
+func (v *PresentationVerifier) AddCRLTime(circuitID string, circuit frontend.Circuit, policy CRLTimePolicy) error {
+	decoder, err := newCRLTimeDecoder(circuit, policy)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	// copy, verifications in progress hold the registered circuit
+	updated := *c
+	updated.crlTime = decoder
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// AddRevocationStatus requests the revocation status (CRLStatusField) of the
+// public witness of a registered circuit: proofs of the other status are
+// rejected with ErrRevocationStatus, the status is returned in
+// VerificationResult.PublicInputs. circuit is the template the circuit was
+// compiled with.
+func (v *PresentationVerifier) AddRevocationStatus(circuitID string, circuit frontend.Circuit, want RevocationStatus) error {
+	decoder, err := newCRLStatusDecoder(circuit, want)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	// copy, verifications in progress hold the registered circuit
+	updated := *c
+	updated.crlStatus = decoder
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// AddTranscript decodes the session transcript (common.TranscriptChallenge)
+// of the public witness of a registered circuit into
+// VerificationResult.PublicInputs and, when VerificationOptions.Transcript is
+// set, checks it is the transcript of the request. circuit is the template the
+// circuit was compiled with.
+func (v *PresentationVerifier) AddTranscript(circuitID string, circuit frontend.Circuit) error {
+	decoder, err := newTranscriptDecoder(circuit)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	// copy, verifications in progress hold the registered circuit
+	updated := *c
+	updated.transcript = decoder
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// AddCommitments opens the salted claim commitments (common.ClaimCommitment)
+// of the public witness of a registered circuit with the openings of the
+// presentation, the opened claims are returned in
+// VerificationResult.PublicInputs. circuit is the template the circuit was
+// compiled with.
+func (v *PresentationVerifier) AddCommitments(circuitID string, circuit frontend.Circuit) error {
+	decoder, err := newCommitmentDecoder(circuit)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	// copy, verifications in progress hold the registered circuit
+	updated := *c
+	updated.commitments = decoder
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// AddPairwiseID decodes the pairwise identifier of the holder
+// (common.PairwiseID) of the public witness of a registered circuit into
+// VerificationResult.PublicInputs and, when VerificationOptions.Transcript is
+// set, checks it was derived for the verifier of the request. circuit is the
+// template the circuit was compiled with.
+func (v *PresentationVerifier) AddPairwiseID(circuitID string, circuit frontend.Circuit) error {
+	decoder, err := newPairwiseDecoder(circuit)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	// copy, verifications in progress hold the registered circuit
+	updated := *c
+	updated.pairwise = decoder
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// AddInputLabels decodes the public witness of a registered circuit into its
+// named public inputs (InputLabeler), returned in VerificationResult.Labels
+// for logging and audit. circuit is the template the circuit was compiled
+// with.
+func (v *PresentationVerifier) AddInputLabels(circuitID string, circuit frontend.Circuit) error {
+	labeler, err := NewInputLabeler(circuit)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	// copy, verifications in progress hold the registered circuit
+	updated := *c
+	updated.labeler = labeler
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// SetKeyValidity bounds the validity of the verifying key of a registered
+// circuit, e.g. from its rotation on. Proofs made with it are rejected outside
+// the validity with ErrKeyNotValid.
+func (v *PresentationVerifier) SetKeyValidity(circuitID string, validity KeyValidity) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	updated := *c
+	updated.validity = validity
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// AddRotatedKey registers a former verifying key of a registered circuit, the
+// presentations made with it are verified within its validity only: with
+// VerificationOptions.AsOf before its NotAfter once it is retired
+func (v *PresentationVerifier) AddRotatedKey(circuitID string, vk groth16.VerifyingKey, validity KeyValidity) error {
+	vkHash, err := common.VerifyingKeyHash(vk)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return fmt.Errorf("unknown circuit %q", circuitID)
+	}
+	updated := *c
+	updated.rotated = append(slices.Clone(c.rotated), rotatedKey{vk: vk, vkHash: hex.EncodeToString(vkHash[:]), validity: validity})
+	v.circuits[circuitID] = &updated
+	return nil
+}
+
+// AcceptedAlgs returns the accepted presentation algs in preference order,
+// the Algs of the verifier or SupportedAlgs
+func (v *PresentationVerifier) AcceptedAlgs() []string {
+	if len(v.Algs) > 0 {
+		return v.Algs
+	}
+	return SupportedAlgs()
+}
+
+func (v *PresentationVerifier) now() time.Time {
+	if v.Now == nil {
+		return time.Now()
+	}
+	return v.Now()
+}
+
+func (v *PresentationVerifier) circuit(circuitID string) (*verifierCircuit, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		if versions := v.versions(circuitID); len(versions) > 0 {
+			return nil, &VersionError{Circuit: circuitID, Versions: versions, unknown: true}
+		}
+		return nil, fmt.Errorf("%w %q", ErrUnknownCircuit, circuitID)
+	}
+	return c, nil
+}
+
+// VerifyProof verifies a groth16 proof against the public witness (both in
+// gnark binary encoding) with the verifying key of the circuit. Like Verify,
+// the proof is verified whatever fails before.
+func (v *PresentationVerifier) VerifyProof(circuitID string, proof, publicWitness []byte) (*VerificationResult, error) {
+	c, err := v.circuit(circuitID)
+	if err != nil {
+		return nil, failure(StageCircuit, CodeUnknownCircuit, err, nil)
+	}
+	partial := &VerificationResult{Circuit: circuitID}
+	now := v.now()
+	var first firstFailure
+	deprecation, err := v.MinVersions.Check(circuitID, now)
+	first.add(failure(StageCircuit, CodeCircuitDeprecated, err, partial))
+	first.add(failure(StageKey, CodeKeyNotValid, c.validity.verify(circuitID, c.vkHash, now), partial))
+	first.add(failure(StageProof, CodeProofFailed, checkProof(c.vk, proof, publicWitness), partial))
+	res, err := c.result(circuitID, c.vkHash, nil, publicWitness, now, nil)
+	first.add(failure(StagePublicInputs, CodeInvalidWitness, err, res))
+	if first.err != nil {
+		return nil, first.err
+	}
+	res.Deprecation = deprecation
+	return res, nil
+}
+
+// key returns the verifying key of the circuit with the hash, valid at t
+func (c *verifierCircuit) key(circuitID, vkHash string, t time.Time) (groth16.VerifyingKey, bool, error) {
+	if vkHash == c.vkHash {
+		return c.vk, true, c.validity.verify(circuitID, vkHash, t)
+	}
+	for _, rotated := range c.rotated {
+		if rotated.vkHash == vkHash {
+			return rotated.vk, true, rotated.validity.verify(circuitID, vkHash, t)
+		}
+	}
+	return nil, false, nil
+}
+
+// result returns the verification result of a public witness verified with
+// the key vkHash, with the challenge timestamp and the CRL check time checked
+// at now and the session transcript against the expected one, if any. On
+// error the result holds the public inputs decoded before the failing one.
+func (c *verifierCircuit) result(circuitID, vkHash string, p *ZkPresentation, publicWitness []byte, now time.Time, transcript *SessionTranscript) (*VerificationResult, error) {
+	res := &VerificationResult{Circuit: circuitID, Presentation: p, VKVersion: CircuitVersion{ID: circuitID, VKHash: vkHash}}
+	if p != nil && p.Payload.CredentialExpiresAt != 0 {
+		res.CredentialExpiresIn = time.Unix(p.Payload.CredentialExpiresAt, 0).Sub(now)
+	} else if p != nil && p.Payload.ExpiresAt != 0 {
+		res.CredentialExpiresIn = time.Unix(p.Payload.ExpiresAt, 0).Sub(now)
+	}
+	if c.labeler != nil {
+		var err error
+		if res.Labels, err = c.labeler.Label(publicWitness); err != nil {
+			return res, err
+		}
+	}
+	if c.attributes != nil {
+		var err error
+		if res.PublicInputs.Attributes, err = c.attributes.Decode(publicWitness); err != nil {
+			return res, err
+		}
+	}
+	if c.timestamp != nil {
+		var err error
+		if res.PublicInputs.ChallengeTimestamp, err = c.timestamp.Decode(publicWitness, now); err != nil {
+			return res, err
+		}
+		res.ChallengeAge = now.Sub(res.PublicInputs.ChallengeTimestamp)
+	}
+	if c.crlTime != nil {
+		var err error
+		if res.PublicInputs.CRLTime, res.CRLNextUpdate, err = c.crlTime.Decode(publicWitness, now); err != nil {
+			return res, err
+		}
+	}
+	if c.crlStatus != nil {
+		status, err := c.crlStatus.Decode(publicWitness)
+		if err != nil {
+			return res, err
+		}
+		res.PublicInputs.RevocationStatus = &status
+	}
+	if c.transcript != nil {
+		var err error
+		if res.PublicInputs.Transcript, err = c.transcript.Decode(publicWitness); err != nil {
+			return res, err
+		}
+		if transcript != nil && !res.PublicInputs.Transcript.Equal(*transcript) {
+			return res, fmt.Errorf("%w: presentation for %q at %q", ErrTranscriptMismatch, res.PublicInputs.Transcript.VerifierID, res.PublicInputs.Transcript.ResponseURI)
+		}
+	}
+	if c.pairwise != nil {
+		var err error
+		if res.PublicInputs.PairwiseID, err = c.pairwise.Decode(publicWitness); err != nil {
+			return res, err
+		}
+		if transcript != nil && res.PublicInputs.PairwiseID.VerifierID != transcript.VerifierID {
+			return res, fmt.Errorf("%w: pairwise identifier for %q", ErrTranscriptMismatch, res.PublicInputs.PairwiseID.VerifierID)
+		}
+	}
+	if p != nil && len(p.Payload.Openings) > 0 {
+		if c.commitments == nil {
+			return res, fmt.Errorf("%w: circuit %q has no claim commitments", ErrInvalidOpening, circuitID)
+		}
+		var err error
+		if res.PublicInputs.Claims, err = c.commitments.Open(publicWitness, p.Payload.Openings); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// Verify verifies a presentation in compact serialization:
+//  1. the circuit version is not deprecated, for a verifier with MinVersions
+//  2. the alg and the holder signature, with its post-quantum part when
+//     ResolvePQKey is set, the expiry of the presentation and of the
+//     credential, and its age when MaxAge is set
+//  3. the verifying key hash of the header matches the registered circuit, or
+//     one of its rotated keys, valid at the verification time
+//  4. the payload matches the circuit schema
+//  5. the proof against the public witness of the payload
+//  6. the challenge timestamp and the CRL check time are current, for circuits
+//     added with AddTimestamp and AddCRLTime
+//  7. the session transcript is the expected one, for circuits added with
+//     AddTranscript and a VerificationOptions.Transcript
+//  8. the claim openings of the payload open claim commitments of the public
+//     witness, for circuits added with AddCommitments
+//  9. the proven revocation status is the requested one, for circuits added
+//     with AddRevocationStatus
+//  10. the pairwise identifier was derived for the verifier of the
+//     VerificationOptions.Transcript, for circuits added with AddPairwiseID
+//  11. the nonce of the payload, and of the session transcript, was issued
+//     for the channel of the VerificationOptions.ChannelBinding
+//
+// Every failure is a *VerificationError, with the code and the stage of the
+// failing step. The steps run whatever fails before them, a holder key that
+// does not resolve is replaced by a placeholder and an unknown verifying key
+// by the registered one, and the first failure in this order is returned:
+// the verification time does not tell which step failed. Only a presentation
+// that cannot be parsed or names an unknown circuit, both public, is refused
+// up front.
+//
+// A composite presentation (CompositeCircuit) runs the steps for each of its
+// proofs, under its single signature, then checks the proofs agree on the
+// shared public inputs (SharedInputs), else CodeInconsistentProofs. The
+// result has the result of each proof in Entries.
+func (v *PresentationVerifier) Verify(compact string) (*VerificationResult, error) {
+	return v.VerifyWithOptions(compact, VerificationOptions{})
+}
+
+// VerifyWithOptions verifies a presentation in compact serialization like
+// Verify, with the options
+func (v *PresentationVerifier) VerifyWithOptions(compact string, opts VerificationOptions) (*VerificationResult, error) {
+	p, err := ParsePresentation(compact)
+	if err != nil {
+		return nil, failure(StageParse, CodeMalformed, err, nil)
+	}
+	return v.verify(p, opts)
+}
+
+// VerifyCOSE verifies a COSE encoded presentation (see SignPresentationCOSE)
+// like Verify
+func (v *PresentationVerifier) VerifyCOSE(data []byte) (*VerificationResult, error) {
+	return v.VerifyCOSEWithOptions(data, VerificationOptions{})
+}
+
+// VerifyCOSEWithOptions verifies a COSE encoded presentation like Verify, with
+// the options
+func (v *PresentationVerifier) VerifyCOSEWithOptions(data []byte, opts VerificationOptions) (*VerificationResult, error) {
+	p, err := ParsePresentationCOSE(data)
+	if err != nil {
+		return nil, failure(StageParse, CodeMalformed, err, nil)
+	}
+	return v.verify(p, opts)
+}
+
+// VerifyEncrypted decrypts an encrypted presentation (see
+// EncryptPresentation) with the verifier key, then verifies it like Verify or
+// VerifyCOSE according to its cty
+func (v *PresentationVerifier) VerifyEncrypted(jwe string, key *ecdh.PrivateKey) (*VerificationResult, error) {
+	return v.VerifyEncryptedWithOptions(jwe, key, VerificationOptions{})
+}
+
+// VerifyEncryptedWithOptions verifies an encrypted presentation like
+// VerifyEncrypted, with the options
+func (v *PresentationVerifier) VerifyEncryptedWithOptions(jwe string, key *ecdh.PrivateKey, opts VerificationOptions) (*VerificationResult, error) {
+	presentation, contentType, err := DecryptPresentation(jwe, key)
+	if err != nil {
+		return nil, failure(StageParse, CodeMalformed, err, nil)
+	}
+	return v.verifyDecrypted(presentation, contentType, opts)
+}
+
+// verifyDecrypted verifies a decrypted presentation according to its cty
+func (v *PresentationVerifier) verifyDecrypted(presentation []byte, contentType string, opts VerificationOptions) (*VerificationResult, error) {
+	switch contentType {
+	case PresentationMediaTypeCOSE:
+		return v.VerifyCOSEWithOptions(presentation, opts)
+	case PresentationType, "":
+		return v.VerifyWithOptions(string(presentation), opts)
+	}
+	return nil, errorf(StageParse, CodeMalformed, nil, "unsupported encrypted presentation cty %q", contentType)
+}
+
+func (v *PresentationVerifier) verify(p *ZkPresentation, opts VerificationOptions) (*VerificationResult, error) {
+	if p.Header.Typ != PresentationType {
+		return nil, errorf(StageParse, CodeMalformed, nil, "unsupported presentation typ %q", p.Header.Typ)
+	}
+	if p.Composite() {
+		res, err := v.verifyComposite(p, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.checkReplay(p, res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	// the circuit ids are public, an unknown circuit is refused before any
+	// work; every other check runs whatever fails before it
+	partial := &VerificationResult{Circuit: p.Header.Circuit, Presentation: p}
+	c, err := v.circuit(p.Header.Circuit)
+	if err != nil {
+		return nil, failure(StageCircuit, CodeUnknownCircuit, err, partial)
+	}
+	at := opts.at(v)
+	var first firstFailure
+	deprecation, err := v.MinVersions.Check(p.Header.Circuit, at)
+	first.add(failure(StageCircuit, CodeCircuitDeprecated, err, partial))
+
+	first.add(v.verifySignature(p, partial))
+	first.add(v.checkExpiry(p, at, opts, partial))
+
+	vk, ok, err := c.key(p.Header.Circuit, p.Header.VKHash, at)
+	if !ok {
+		first.add(failure(StageKey, CodeVersionMismatch, &VersionError{Circuit: p.Header.Circuit, VKHash: p.Header.VKHash, Versions: v.Versions(p.Header.Circuit)}, partial))
+		// the proof is still verified, with the registered key
+		vk = c.vk
+	}
+	first.add(failure(StageKey, CodeKeyNotValid, err, partial))
+
+	if c.schema != nil {
+		first.add(failure(StageSchema, CodeSchemaMismatch, c.schema.Validate(p.RawPayload), partial))
+	}
+
+	first.add(failure(StageProof, CodeProofFailed, checkProof(vk, p.Proof, p.Payload.PublicWitness), partial))
+	res, err := c.result(p.Header.Circuit, p.Header.VKHash, p, p.Payload.PublicWitness, at, opts.Transcript)
+	first.add(failure(StagePublicInputs, CodeInvalidWitness, err, res))
+	first.add(failure(StagePublicInputs, CodeChannelMismatch, checkChannel(p, res, opts.ChannelBinding), res))
+	if first.err != nil {
+		return nil, first.err
+	}
+	if err := v.checkReplay(p, res); err != nil {
+		return nil, err
+	}
+	res.Deprecation = deprecation
+	return res, nil
+}
+
+// checkExpiry checks the expiry of the presentation and of the credential,
+// its age when MaxAge is set and its issuance before the verification time
+func (v *PresentationVerifier) checkExpiry(p *ZkPresentation, at time.Time, opts VerificationOptions, partial *VerificationResult) error {
+	var first firstFailure
+	if err := p.CheckExpiry(at, v.ClockSkew); err != nil {
+		first.add(failure(StageExpiry, codeOf(err, CodeExpired), err, partial))
+	}
+	if v.MaxAge > 0 {
+		first.add(failure(StageExpiry, CodeExpired, p.CheckAge(at, v.MaxAge, v.ClockSkew), partial))
+	}
+	if issuedAt := time.Unix(p.Payload.IssuedAt, 0); !opts.AsOf.IsZero() && issuedAt.After(at) || v.MaxAge > 0 && issuedAt.After(at.Add(v.ClockSkew)) {
+		first.add(errorf(StageExpiry, CodeIssuedLater, partial, "presentation issued at %s, after %s", issuedAt.UTC().Format(time.RFC3339), at.UTC().Format(time.RFC3339)))
+	}
+	return first.err
+}
+
+// placeholderKey verifies the holder signatures whose key does not resolve,
+// for the same work as with the holder key: the generator of P-256
+var placeholderKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: elliptic.P256().Params().Gx, Y: elliptic.P256().Params().Gy}
+
+// verifySignature resolves the holder keys and verifies the holder signature
+// of the presentation, against placeholderKey when the holder key does not
+// resolve
+func (v *PresentationVerifier) verifySignature(p *ZkPresentation, partial *VerificationResult) error {
+	var keyErr error
+	key := placeholderKey
+	if v.ResolveKey == nil {
+		keyErr = errorf(StageSignature, CodeKeyUnresolved, partial, "no holder key resolver")
+	} else if resolved, err := v.ResolveKey(p.Header); err != nil {
+		keyErr = errorf(StageSignature, CodeKeyUnresolved, partial, "failed to resolve the holder key: %w", err)
+	} else {
+		key = resolved
+	}
+	signatureErr := p.VerifySignature(key)
+	envelopeErr := p.VerifyEnvelope(v.Algs, v.ResolvePQKey)
+	if keyErr != nil {
+		return keyErr
+	}
+	if signatureErr != nil {
+		return failure(StageSignature, CodeInvalidSignature, signatureErr, partial)
+	}
+	return failure(StageSignature, CodeInvalidSignature, envelopeErr, partial)
+}
+
+// firstFailure keeps the first failure of the checks of a verification, in
+// the order of the pipeline
+type firstFailure struct {
+	err error
+}
+
+func (f *firstFailure) add(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+// checkProof verifies the proofs of the verifications, a variable for the
+// tests counting the proofs verified by the failing verifications
+var checkProof = verifyProof
+
+func verifyProof(vk groth16.VerifyingKey, proofBytes, publicWitnessBytes []byte) error {
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(proofBytes)); err != nil {
+		return fmt.Errorf("%w: %w: invalid proof: %w", ErrProofFailed, ErrMalformedProof, err)
+	}
+
+	publicWitness, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return err
+	}
+	if err := publicWitness.UnmarshalBinary(publicWitnessBytes); err != nil {
+		return fmt.Errorf("%w: %w: %w", ErrInvalidWitness, ErrMalformedProof, err)
+	}
+	if values, ok := publicWitness.Vector().(fr.Vector); !ok || len(values) != nbPublicInputs(vk) {
+		return fmt.Errorf("%w: %w: %d public inputs, the verifying key has %d", ErrInvalidWitness, ErrPublicInputCount, len(values), nbPublicInputs(vk))
+	}
+
+	if err := groth16.Verify(proof, vk, publicWitness); err != nil {
+		return fmt.Errorf("%w: %w", ErrProofFailed, err)
+	}
+	return nil
+}
+
+// nbPublicInputs returns the number of public inputs of the verifying key: its
+// public witness without the commitments of the circuit (api.Commit, e.g. of
+// the SHA-256 gadgets), which the prover adds to the proof
+func nbPublicInputs(vk groth16.VerifyingKey) int {
+	if vk, ok := vk.(*groth16bn254.VerifyingKey); ok {
+		return len(vk.G1.K) - len(vk.PublicAndCommitmentCommitted) - 1
+	}
+	return vk.NbPublicWitness()
+}
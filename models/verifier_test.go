@@ -0,0 +1,1337 @@
+package models
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"maps"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// cubeCircuit proves knowledge of X with X^3 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+// crlTimeCircuit exposes the CRL check time, as the CRL circuits
+type crlTimeCircuit struct {
+	Checked []frontend.Variable
+	Now     []uints.U8 `gnark:",public"`
+}
+
+func (c *crlTimeCircuit) Define(api frontend.API) error {
+	for i := range c.Now {
+		api.AssertIsEqual(c.Checked[i], c.Now[i].Val)
+	}
+	return nil
+}
+
+// setup is a circuit with one groth16 setup
+type setup struct {
+	ccs    constraint.ConstraintSystem
+	pk     groth16.ProvingKey
+	vk     groth16.VerifyingKey
+	vkHash string
+}
+
+func newSetup(t *testing.T, circuit frontend.Circuit) *setup {
+	t.Helper()
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &setup{ccs: ccs}
+	if s.pk, s.vk, err = groth16.Setup(ccs); err != nil {
+		t.Fatal(err)
+	}
+	vkHash, err := common.VerifyingKeyHash(s.vk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.vkHash = hex.EncodeToString(vkHash[:])
+	return s
+}
+
+// prove returns the proof and the public witness of the assignment
+func (s *setup) prove(t *testing.T, assignment frontend.Circuit) ([]byte, []byte) {
+	t.Helper()
+	w, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16.Prove(s.ccs, s.pk, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	proof.WriteTo(&buf)
+	publicWitness, err := w.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := publicWitness.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), pw
+}
+
+func newHolder(t *testing.T) (*ecdsa.PrivateKey, *PresentationVerifier) {
+	t.Helper()
+	holderKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return holderKey, NewPresentationVerifier(func(PresentationHeader) (*ecdsa.PublicKey, error) {
+		return &holderKey.PublicKey, nil
+	})
+}
+
+func TestVerifyAsOfRotatedKey(t *testing.T) {
+	retired, current := newSetup(t, &cubeCircuit{}), newSetup(t, &cubeCircuit{})
+	rotation := time.Unix(1700000000, 0)
+	now := rotation.Add(90 * 24 * time.Hour)
+
+	holderKey, verifier := newHolder(t)
+	verifier.Now = func() time.Time { return now }
+	if err := verifier.AddCircuit("cube/v1", current.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.SetKeyValidity("cube/v1", KeyValidity{NotBefore: rotation}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddRotatedKey("cube/v1", retired.vk, KeyValidity{NotAfter: rotation}); err != nil {
+		t.Fatal(err)
+	}
+
+	present := func(s *setup, issued time.Time) string {
+		t.Helper()
+		proof, publicWitness := s.prove(t, &cubeCircuit{X: 3, Y: 27})
+		compact, err := SignPresentation(PresentationHeader{Circuit: "cube/v1", VKHash: s.vkHash},
+			PresentationPayload{IssuedAt: issued.Unix(), ExpiresAt: issued.AddDate(1, 0, 0).Unix(), PublicWitness: publicWitness}, proof, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+
+	// a presentation made before the rotation
+	created := rotation.Add(-time.Hour)
+	old := present(retired, created)
+	if _, err := verifier.Verify(old); !errors.Is(err, ErrKeyNotValid) {
+		t.Fatalf("expected ErrKeyNotValid for the rotated key now, got %v", err)
+	}
+	if _, err := verifier.VerifyWithOptions(old, VerificationOptions{AsOf: created}); err != nil {
+		t.Fatalf("expected the rotated key to verify as of the creation: %v", err)
+	}
+
+	// the current key is not valid before the rotation
+	recent := present(current, now)
+	if _, err := verifier.Verify(recent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyWithOptions(present(current, created), VerificationOptions{AsOf: created}); !errors.Is(err, ErrKeyNotValid) {
+		t.Fatalf("expected ErrKeyNotValid for the current key before the rotation, got %v", err)
+	}
+
+	// a presentation cannot be verified as of a time before its creation
+	if _, err := verifier.VerifyWithOptions(recent, VerificationOptions{AsOf: rotation}); err == nil {
+		t.Fatal("expected a presentation issued after AsOf to fail")
+	}
+
+	// unknown keys remain a version mismatch
+	if _, err := verifier.VerifyWithOptions(present(newSetup(t, &cubeCircuit{}), created), VerificationOptions{AsOf: created}); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expected ErrVersionMismatch for an unknown key, got %v", err)
+	}
+}
+
+func TestVerifyAsOfExpired(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{})
+	issued := time.Unix(1700000000, 0)
+	expiry := issued.Add(24 * time.Hour)
+
+	holderKey, verifier := newHolder(t)
+	verifier.Now = func() time.Time { return expiry.Add(30 * 24 * time.Hour) }
+	if err := verifier.AddCircuit("cube/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	proof, publicWitness := s.prove(t, &cubeCircuit{X: 3, Y: 27})
+	compact, err := SignPresentation(PresentationHeader{Circuit: "cube/v1", VKHash: s.vkHash},
+		PresentationPayload{IssuedAt: issued.Unix(), ExpiresAt: expiry.Unix(), PublicWitness: publicWitness}, proof, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.Verify(compact); !errors.Is(err, ErrPresentationExpired) {
+		t.Fatalf("expected ErrPresentationExpired now, got %v", err)
+	}
+	if _, err := verifier.VerifyWithOptions(compact, VerificationOptions{AsOf: issued}); err != nil {
+		t.Fatalf("expected the presentation to verify as of its creation: %v", err)
+	}
+	if _, err := verifier.VerifyWithOptions(compact, VerificationOptions{AsOf: expiry}); !errors.Is(err, ErrPresentationExpired) {
+		t.Fatalf("expected ErrPresentationExpired at the expiry, got %v", err)
+	}
+}
+
+func TestVerifyAsOfCRLTime(t *testing.T) {
+	template := &crlTimeCircuit{Checked: make([]frontend.Variable, len(crlTimeLayout)), Now: make([]uints.U8, len(crlTimeLayout))}
+	s := newSetup(t, template)
+	checked := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	holderKey, verifier := newHolder(t)
+	verifier.Now = func() time.Time { return checked.Add(365 * 24 * time.Hour) }
+	if err := verifier.AddCircuit("crl/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddCRLTime("crl/v1", template, CRLTimePolicy{MaxSkew: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddCRLTime("crl/v1", &cubeCircuit{}, CRLTimePolicy{}); err == nil {
+		t.Fatal("expected a circuit without a CRL check time to be rejected")
+	}
+
+	digits := checked.Format(crlTimeLayout)
+	assignment := &crlTimeCircuit{Checked: make([]frontend.Variable, len(digits)), Now: make([]uints.U8, len(digits))}
+	for i := range digits {
+		assignment.Checked[i] = digits[i]
+		assignment.Now[i] = uints.NewU8(digits[i])
+	}
+	proof, publicWitness := s.prove(t, assignment)
+	compact, err := SignPresentation(PresentationHeader{Circuit: "crl/v1", VKHash: s.vkHash},
+		PresentationPayload{IssuedAt: checked.Unix(), ExpiresAt: checked.AddDate(10, 0, 0).Unix(), PublicWitness: publicWitness}, proof, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.Verify(compact); !errors.Is(err, ErrStaleCRLTime) {
+		t.Fatalf("expected ErrStaleCRLTime now, got %v", err)
+	}
+	res, err := verifier.VerifyWithOptions(compact, VerificationOptions{AsOf: checked.Add(10 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.PublicInputs.CRLTime.Equal(checked) {
+		t.Fatalf("unexpected CRL time %v", res.PublicInputs.CRLTime)
+	}
+}
+
+// crlStatusCircuit exposes a revocation status, as the CRL circuits
+type crlStatusCircuit struct {
+	Revoked frontend.Variable
+	Status  frontend.Variable `gnark:",public"`
+}
+
+func (c *crlStatusCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(c.Revoked, c.Status)
+	return nil
+}
+
+func TestVerifyRevocationStatus(t *testing.T) {
+	s := newSetup(t, &crlStatusCircuit{})
+	holderKey, verifier := newHolder(t)
+	for _, id := range []string{"crl-valid/v1", "crl-revoked/v1"} {
+		if err := verifier.AddCircuit(id, s.vk, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := verifier.AddRevocationStatus("crl-valid/v1", &crlStatusCircuit{}, StatusNotRevoked); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddRevocationStatus("crl-revoked/v1", &crlStatusCircuit{}, StatusRevoked); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddRevocationStatus("crl-valid/v1", &cubeCircuit{}, StatusNotRevoked); err == nil {
+		t.Fatal("expected a circuit without a revocation status to be rejected")
+	}
+
+	// a proof the certificate is revoked
+	proof, publicWitness := s.prove(t, &crlStatusCircuit{Revoked: 1, Status: 1})
+	present := func(circuit string) string {
+		t.Helper()
+		compact, err := SignPresentation(PresentationHeader{Circuit: circuit, VKHash: s.vkHash},
+			PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: publicWitness}, proof, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+	res, err := verifier.Verify(present("crl-revoked/v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PublicInputs.RevocationStatus == nil || *res.PublicInputs.RevocationStatus != StatusRevoked {
+		t.Fatalf("unexpected revocation status %v", res.PublicInputs.RevocationStatus)
+	}
+	if _, err := verifier.Verify(present("crl-valid/v1")); !errors.Is(err, ErrRevocationStatus) {
+		t.Fatalf("expected ErrRevocationStatus, got %v", err)
+	}
+}
+
+// transcriptCircuit binds the holder signature to a session transcript, as
+// the circuits with transcript challenges
+type transcriptCircuit struct {
+	Signed                []uints.U8
+	Challenge             []uints.U8 `gnark:",public"`
+	TranscriptVerifierID  []uints.U8 `gnark:",public"`
+	TranscriptResponseURI []uints.U8 `gnark:",public"`
+	TranscriptVPFormats   []uints.U8 `gnark:",public"`
+}
+
+func (c *transcriptCircuit) Define(api frontend.API) error {
+	challenge, err := common.TranscriptChallenge(api, c.Challenge, c.TranscriptVerifierID, c.TranscriptResponseURI, c.TranscriptVPFormats)
+	if err != nil {
+		return err
+	}
+	common.AssertBytesEqual(api, challenge, c.Signed, "transcript challenge")
+	return nil
+}
+
+func TestVerifyTranscript(t *testing.T) {
+	layout := TranscriptLayout{Nonce: 8, VerifierID: 32, ResponseURI: 40, VPFormats: 16}
+	template := &transcriptCircuit{
+		Signed:                make([]uints.U8, 32),
+		Challenge:             make([]uints.U8, layout.Nonce),
+		TranscriptVerifierID:  make([]uints.U8, layout.VerifierID),
+		TranscriptResponseURI: make([]uints.U8, layout.ResponseURI),
+		TranscriptVPFormats:   make([]uints.U8, layout.VPFormats),
+	}
+	s := newSetup(t, template)
+
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("transcript/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddTranscript("transcript/v1", template); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddTranscript("transcript/v1", &cubeCircuit{}); err == nil {
+		t.Fatal("expected a circuit without a transcript to be rejected")
+	}
+
+	transcript := SessionTranscript{
+		Nonce:       []byte("n-0x2a01"),
+		VerifierID:  "verifier.example",
+		ResponseURI: "https://verifier.example/response",
+		VPFormats:   `{"zk+jwt":{}}`,
+	}
+	nonce, verifierID, responseURI, vpFormats, err := transcript.Components(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := transcript.Challenge(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, publicWitness := s.prove(t, &transcriptCircuit{
+		Signed:                common.BytesToU8Array(challenge),
+		Challenge:             common.BytesToU8Array(nonce),
+		TranscriptVerifierID:  common.BytesToU8Array(verifierID),
+		TranscriptResponseURI: common.BytesToU8Array(responseURI),
+		TranscriptVPFormats:   common.BytesToU8Array(vpFormats),
+	})
+	compact, err := SignPresentation(PresentationHeader{Circuit: "transcript/v1", VKHash: s.vkHash},
+		PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: publicWitness}, proof, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := verifier.VerifyWithOptions(compact, VerificationOptions{Transcript: &transcript})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PublicInputs.Transcript == nil || !res.PublicInputs.Transcript.Equal(transcript) {
+		t.Fatalf("unexpected transcript %+v", res.PublicInputs.Transcript)
+	}
+
+	// the same proof presented to another verifier
+	replayed := transcript
+	replayed.VerifierID = "other.example"
+	if _, err := verifier.VerifyWithOptions(compact, VerificationOptions{Transcript: &replayed}); !errors.Is(err, ErrTranscriptMismatch) {
+		t.Fatalf("expected ErrTranscriptMismatch, got %v", err)
+	}
+}
+
+// pairwiseCircuit exposes a pairwise identifier and the verifier id it is
+// derived for, as the circuits with pairwise identifiers
+type pairwiseCircuit struct {
+	ID                   []frontend.Variable
+	TranscriptVerifierID []uints.U8          `gnark:",public"`
+	PairwiseID           []frontend.Variable `gnark:",public"`
+}
+
+func (c *pairwiseCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(c.PairwiseID[0], c.ID[0])
+	return nil
+}
+
+func TestVerifyPairwiseID(t *testing.T) {
+	const size = 32
+	template := &pairwiseCircuit{
+		ID:                   make([]frontend.Variable, 1),
+		TranscriptVerifierID: make([]uints.U8, size),
+		PairwiseID:           make([]frontend.Variable, 1),
+	}
+	s := newSetup(t, template)
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("pairwise/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddPairwiseID("pairwise/v1", template); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddPairwiseID("pairwise/v1", &cubeCircuit{}); err == nil {
+		t.Fatal("expected a circuit without a pairwise identifier to be rejected")
+	}
+
+	secret, err := NewHolderSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	present := func(verifierID string) (string, []byte) {
+		t.Helper()
+		pid, err := secret.PairwiseID(verifierID, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		padded := make([]byte, size)
+		copy(padded, verifierID)
+		id := new(big.Int).SetBytes(pid)
+		proof, publicWitness := s.prove(t, &pairwiseCircuit{
+			ID:                   []frontend.Variable{id},
+			TranscriptVerifierID: common.BytesToU8Array(padded),
+			PairwiseID:           []frontend.Variable{id},
+		})
+		compact, err := SignPresentation(PresentationHeader{Circuit: "pairwise/v1", VKHash: s.vkHash},
+			PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: publicWitness}, proof, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact, pid
+	}
+
+	compact, pid := present("verifier.example")
+	res, err := verifier.VerifyWithOptions(compact, VerificationOptions{Transcript: &SessionTranscript{VerifierID: "verifier.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := res.PublicInputs.PairwiseID; id == nil || !bytes.Equal(id.ID, pid) || id.VerifierID != "verifier.example" {
+		t.Fatalf("unexpected pairwise identifier %+v", id)
+	}
+
+	// an identifier derived for another verifier
+	other, _ := present("other.example")
+	if _, err := verifier.VerifyWithOptions(other, VerificationOptions{Transcript: &SessionTranscript{VerifierID: "verifier.example"}}); !errors.Is(err, ErrTranscriptMismatch) {
+		t.Fatalf("expected ErrTranscriptMismatch, got %v", err)
+	}
+}
+
+// commitmentCircuit commits to a claim and fills a decoy slot, as the
+// circuits with claim commitments
+type commitmentCircuit struct {
+	Salt        []uints.U8
+	Value       []uints.U8
+	DecoySalt   []uints.U8
+	Commitments []frontend.Variable `gnark:",public"`
+}
+
+func (c *commitmentCircuit) Define(api frontend.API) error {
+	commitment, err := common.ClaimCommitment(api, c.Salt, "nationality", c.Value, nil)
+	if err != nil {
+		return err
+	}
+	decoy, err := common.DecoyCommitment(api, c.DecoySalt)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(commitment, c.Commitments[0])
+	api.AssertIsEqual(decoy, c.Commitments[1])
+	return nil
+}
+
+func TestVerifyOpenings(t *testing.T) {
+	saltSize := common.MinClaimSaltSize
+	template := &commitmentCircuit{
+		Salt:        make([]uints.U8, saltSize),
+		Value:       make([]uints.U8, 2),
+		DecoySalt:   make([]uints.U8, saltSize),
+		Commitments: make([]frontend.Variable, 2),
+	}
+	s := newSetup(t, template)
+
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("commit/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddCommitments("commit/v1", template); err != nil {
+		t.Fatal(err)
+	}
+
+	opening, err := NewClaimOpening("nationality", "DE", saltSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoySalt, decoy, err := NewDecoyCommitment(saltSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, publicWitness := s.prove(t, &commitmentCircuit{
+		Salt:        common.BytesToU8Array(opening.Salt),
+		Value:       common.BytesToU8Array([]byte(opening.Value)),
+		DecoySalt:   common.BytesToU8Array(decoySalt),
+		Commitments: []frontend.Variable{opening.Commitment(), decoy},
+	})
+	present := func(openings ...ClaimOpening) string {
+		t.Helper()
+		compact, err := SignPresentation(PresentationHeader{Circuit: "commit/v1", VKHash: s.vkHash},
+			PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: publicWitness, Openings: openings}, proof, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+
+	res, err := verifier.Verify(present(opening))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PublicInputs.Claims["nationality"] != "DE" {
+		t.Fatalf("unexpected claims %v", res.PublicInputs.Claims)
+	}
+
+	// not opened: the claim stays hidden
+	if res, err = verifier.Verify(present()); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.PublicInputs.Claims) != 0 {
+		t.Fatalf("unexpected claims %v", res.PublicInputs.Claims)
+	}
+
+	// an opening to another value
+	forged := opening
+	forged.Value = "FR"
+	if _, err := verifier.Verify(present(forged)); !errors.Is(err, ErrInvalidOpening) {
+		t.Fatalf("expected ErrInvalidOpening, got %v", err)
+	}
+}
+
+func TestVerificationError(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{})
+	template := &crlTimeCircuit{Checked: make([]frontend.Variable, len(crlTimeLayout)), Now: make([]uints.U8, len(crlTimeLayout))}
+	crl := newSetup(t, template)
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("cube/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddCircuit("crl/v1", crl.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddCRLTime("crl/v1", template, CRLTimePolicy{MaxSkew: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	proof, publicWitness := s.prove(t, &cubeCircuit{X: 3, Y: 27})
+	_, otherWitness := s.prove(t, &cubeCircuit{X: 2, Y: 8})
+	digits := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Format(crlTimeLayout)
+	crlAssignment := &crlTimeCircuit{Checked: make([]frontend.Variable, len(digits)), Now: make([]uints.U8, len(digits))}
+	for i := range digits {
+		crlAssignment.Checked[i] = digits[i]
+		crlAssignment.Now[i] = uints.NewU8(digits[i])
+	}
+	crlProof, crlWitness := crl.prove(t, crlAssignment)
+
+	present := func(circuit, vkHash string, payload PresentationPayload, proof []byte) string {
+		t.Helper()
+		compact, err := SignPresentation(PresentationHeader{Circuit: circuit, VKHash: vkHash}, payload, proof, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+	now := time.Now().Unix()
+	tests := []struct {
+		name    string
+		compact string
+		code    ErrorCode
+		stage   Stage
+		class   error
+	}{
+		{"malformed", "not.a.presentation", CodeMalformed, StageParse, nil},
+		{"unknown circuit", present("square/v1", s.vkHash, PresentationPayload{IssuedAt: now, PublicWitness: publicWitness}, proof), CodeUnknownCircuit, StageCircuit, ErrUnknownCircuit},
+		{"expired", present("cube/v1", s.vkHash, PresentationPayload{IssuedAt: now - 60, ExpiresAt: now - 1, PublicWitness: publicWitness}, proof), CodeExpired, StageExpiry, ErrPresentationExpired},
+		{"other key", present("cube/v1", crl.vkHash, PresentationPayload{IssuedAt: now, PublicWitness: publicWitness}, proof), CodeVersionMismatch, StageKey, ErrVersionMismatch},
+		{"proof", present("cube/v1", s.vkHash, PresentationPayload{IssuedAt: now, PublicWitness: otherWitness}, proof), CodeProofFailed, StageProof, ErrProofFailed},
+		{"malformed proof", present("cube/v1", s.vkHash, PresentationPayload{IssuedAt: now, PublicWitness: publicWitness}, proof[:len(proof)-1]), CodeMalformedProof, StageProof, ErrProofFailed},
+		{"public input count", present("cube/v1", s.vkHash, PresentationPayload{IssuedAt: now, PublicWitness: crlWitness}, proof), CodePublicInputCount, StageProof, ErrInvalidWitness},
+		{"stale CRL", present("crl/v1", crl.vkHash, PresentationPayload{IssuedAt: now, PublicWitness: crlWitness}, crlProof), CodeStaleCRLTime, StagePublicInputs, ErrStaleCRLTime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(tt.compact)
+			var verr *VerificationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a VerificationError, got %v", err)
+			}
+			if verr.Code != tt.code || verr.Stage != tt.stage || verr.Retryable {
+				t.Fatalf("unexpected error %s at %s (retryable %v): %v", verr.Code, verr.Stage, verr.Retryable, err)
+			}
+			if tt.class != nil && !errors.Is(err, tt.class) {
+				t.Fatalf("expected the error to wrap %v", tt.class)
+			}
+			if tt.stage != StageParse && (verr.Partial == nil || verr.Partial.Presentation == nil) {
+				t.Fatal("expected the parsed presentation in the partial result")
+			}
+		})
+	}
+
+	// a holder key that does not resolve yet
+	unresolved := NewPresentationVerifier(func(PresentationHeader) (*ecdsa.PublicKey, error) {
+		return nil, errors.New("key directory unavailable")
+	})
+	if err := unresolved.AddCircuit("cube/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := unresolved.Verify(present("cube/v1", s.vkHash, PresentationPayload{IssuedAt: now, PublicWitness: publicWitness}, proof))
+	var verr *VerificationError
+	if !errors.As(err, &verr) || verr.Code != CodeKeyUnresolved || !verr.Retryable {
+		t.Fatalf("expected a retryable holder_key_unresolved error, got %v", err)
+	}
+}
+
+// TestConstantWork measures the verification time of each failure class: the
+// early failures verify the proof too, so none is much faster than a valid
+// presentation
+func TestConstantWork(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{})
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("cube/v1", s.vk, &PayloadSchema{Required: []string{"nonce"}}); err != nil {
+		t.Fatal(err)
+	}
+	proof, publicWitness := s.prove(t, &cubeCircuit{X: 3, Y: 27})
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	now := time.Now().Unix()
+	valid := PresentationPayload{Nonce: "n-1", IssuedAt: now, PublicWitness: publicWitness}
+	present := func(vkHash string, payload PresentationPayload, key *ecdsa.PrivateKey) string {
+		t.Helper()
+		compact, err := SignPresentation(PresentationHeader{Circuit: "cube/v1", VKHash: vkHash}, payload, proof, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+	expired := valid
+	expired.IssuedAt, expired.ExpiresAt = now-60, now-1
+	classes := []struct {
+		name    string
+		compact string
+		code    ErrorCode
+	}{
+		{"valid", present(s.vkHash, valid, holderKey), ""},
+		{"signature", present(s.vkHash, valid, otherKey), CodeInvalidSignature},
+		{"expired", present(s.vkHash, expired, holderKey), CodeExpired},
+		{"vk hash", present(strings.Repeat("00", 32), valid, holderKey), CodeVersionMismatch},
+		{"schema", present(s.vkHash, PresentationPayload{IssuedAt: now, PublicWitness: publicWitness}, holderKey), CodeSchemaMismatch},
+	}
+
+	// every failing verification still verifies the proof
+	proofs := 0
+	defer func(check func(groth16.VerifyingKey, []byte, []byte) error) { checkProof = check }(checkProof)
+	verify := checkProof
+	checkProof = func(vk groth16.VerifyingKey, proof, publicWitness []byte) error {
+		proofs++
+		return verify(vk, proof, publicWitness)
+	}
+	for _, class := range classes {
+		proofs = 0
+		_, err := verifier.Verify(class.compact)
+		var verr *VerificationError
+		if class.code == "" && err != nil || class.code != "" && (!errors.As(err, &verr) || verr.Code != class.code) {
+			t.Fatalf("%s: expected %q, got %v", class.name, class.code, err)
+		}
+		if proofs != 1 {
+			t.Errorf("%s: %d proofs verified, expected 1", class.name, proofs)
+		}
+	}
+	if testing.Short() {
+		t.Skip("timing measurement")
+	}
+
+	const runs = 25
+	medians := make([]time.Duration, len(classes))
+	for i, class := range classes {
+		durations := make([]time.Duration, runs)
+		for j := range durations {
+			start := time.Now()
+			_, err := verifier.Verify(class.compact)
+			durations[j] = time.Since(start)
+			var verr *VerificationError
+			if class.code == "" && err != nil || class.code != "" && (!errors.As(err, &verr) || verr.Code != class.code) {
+				t.Fatalf("%s: expected %q, got %v", class.name, class.code, err)
+			}
+		}
+		slices.Sort(durations)
+		medians[i] = durations[runs/2]
+	}
+	// the bound tolerates the noise of shared runners, a failure returned
+	// before the proof verification is an order of magnitude faster
+	for i, class := range classes[1:] {
+		if ratio := float64(medians[i+1]) / float64(medians[0]); ratio < 0.4 {
+			t.Errorf("%s: median %s, %.2f of the valid presentation (%s)", class.name, medians[i+1], ratio, medians[0])
+		}
+	}
+}
+
+func TestPresentationExpiry(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{})
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("cube/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	proof, publicWitness := s.prove(t, &cubeCircuit{X: 3, Y: 27})
+
+	signedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	builder := &PresentationBuilder{Key: holderKey, TTL: time.Minute, Now: func() time.Time { return signedAt }}
+	header := PresentationHeader{Circuit: "cube/v1", VKHash: s.vkHash}
+	present := func(credentialExpiresAt time.Time) string {
+		t.Helper()
+		payload := PresentationPayload{PublicWitness: publicWitness}
+		if !credentialExpiresAt.IsZero() {
+			payload.CredentialExpiresAt = credentialExpiresAt.Unix()
+		}
+		compact, err := builder.Sign(header, payload, proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+	verifier.ClockSkew = 10 * time.Second
+
+	tests := []struct {
+		name    string
+		compact string
+		at      time.Time
+		maxAge  time.Duration
+		code    ErrorCode
+	}{
+		{"fresh", present(time.Time{}), signedAt.Add(30 * time.Second), 0, ""},
+		{"within skew", present(time.Time{}), signedAt.Add(65 * time.Second), 0, ""},
+		{"expired", present(time.Time{}), signedAt.Add(2 * time.Minute), 0, CodeExpired},
+		{"credential expiring", present(signedAt.Add(20 * time.Second)), signedAt.Add(25 * time.Second), 0, ""},
+		{"credential expired", present(signedAt.Add(20 * time.Second)), signedAt.Add(40 * time.Second), 0, CodeCredentialExpired},
+		{"max age", present(time.Time{}), signedAt.Add(50 * time.Second), 30 * time.Second, CodeExpired},
+		{"issued ahead", present(time.Time{}), signedAt.Add(-time.Minute), 30 * time.Second, CodeIssuedLater},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier.Now = func() time.Time { return tt.at }
+			verifier.MaxAge = tt.maxAge
+			_, err := verifier.Verify(tt.compact)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var verr *VerificationError
+			if !errors.As(err, &verr) || verr.Code != tt.code || verr.Stage != StageExpiry {
+				t.Fatalf("expected %s, got %v", tt.code, err)
+			}
+		})
+	}
+
+	// the exp of a presentation is at most the expiry of the credential, and
+	// an expired credential is not presented
+	p, err := ParsePresentation(present(signedAt.Add(20 * time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Payload.IssuedAt != signedAt.Unix() || p.Payload.ExpiresAt != signedAt.Add(20*time.Second).Unix() {
+		t.Fatalf("unexpected iat %d and exp %d", p.Payload.IssuedAt, p.Payload.ExpiresAt)
+	}
+	if _, err := builder.Sign(header, PresentationPayload{CredentialExpiresAt: signedAt.Unix()}, proof); !errors.Is(err, ErrCredentialExpired) {
+		t.Fatalf("expected ErrCredentialExpired, got %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{})
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("cube/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	proof, publicWitness := s.prove(t, &cubeCircuit{X: 3, Y: 27})
+
+	now := time.Now()
+	builder := &PresentationBuilder{Key: holderKey, Random: common.DeterministicRandom("replay"), Now: func() time.Time { return now }}
+	header := PresentationHeader{Circuit: "cube/v1", VKHash: s.vkHash}
+	sign := func(payload PresentationPayload) string {
+		t.Helper()
+		payload.PublicWitness = publicWitness
+		compact, err := builder.Sign(header, payload, proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+	first, second := sign(PresentationPayload{}), sign(PresentationPayload{})
+	p1, _ := ParsePresentation(first)
+	p2, _ := ParsePresentation(second)
+	if p1.Payload.ID == "" || p1.Payload.ID == p2.Payload.ID {
+		t.Fatalf("expected distinct jti, got %q and %q", p1.Payload.ID, p2.Payload.ID)
+	}
+
+	cache := NewMemoryReplayCache()
+	verifier.Replay = cache
+	verifier.ReplayWindow = time.Minute
+	verifier.Now = func() time.Time { return now }
+	for _, compact := range []string{first, second} {
+		if _, err := verifier.Verify(compact); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var verr *VerificationError
+	if _, err := verifier.Verify(first); !errors.Is(err, ErrReplayed) || !errors.As(err, &verr) || verr.Code != CodeReplayed {
+		t.Fatalf("expected a replay, got %v", err)
+	}
+
+	// a presentation failing another check does not burn its jti
+	forged := sign(PresentationPayload{ID: "forged"})
+	parts := strings.Split(forged, ".")
+	parts[3] = parts[3][:len(parts[3])-4] + "AAAA"
+	if _, err := verifier.Verify(strings.Join(parts, ".")); err == nil || errors.Is(err, ErrReplayed) {
+		t.Fatalf("expected the forged presentation to fail, got %v", err)
+	}
+	if _, err := verifier.Verify(forged); err != nil {
+		t.Fatal(err)
+	}
+
+	// the ids are remembered past the window while the presentations can be
+	// accepted: a long-lived presentation is still refused after the
+	// default lifetime
+	builder.TTL = time.Hour
+	long := sign(PresentationPayload{})
+	builder.TTL = 0
+	if _, err := verifier.Verify(long); err != nil {
+		t.Fatal(err)
+	}
+	verifier.Now = func() time.Time { return now.Add(DefaultPresentationTTL + 5*time.Minute) }
+	if _, err := verifier.Verify(long); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("expected the long-lived presentation to be refused as a replay, got %v", err)
+	}
+
+	// the ids are forgotten once their presentations expired
+	verifier.Now = func() time.Time { return now.Add(2 * time.Hour) }
+	builder.Now = verifier.Now
+	if _, err := verifier.Verify(sign(PresentationPayload{})); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("expected the expired ids to be dropped, %d left", cache.Len())
+	}
+
+	// a presentation without jti, or without exp, is refused
+	later := verifier.Now()
+	for name, payload := range map[string]PresentationPayload{
+		"jti": {IssuedAt: later.Unix(), ExpiresAt: later.Add(time.Minute).Unix()},
+		"exp": {ID: "no-exp", IssuedAt: later.Unix()},
+	} {
+		payload.PublicWitness = publicWitness
+		compact, err := SignPresentation(header, payload, proof, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.Verify(compact); !errors.Is(err, ErrReplayed) {
+			t.Fatalf("expected a presentation without %s to be refused, got %v", name, err)
+		}
+	}
+	// unless MaxAge bounds its lifetime
+	verifier.MaxAge = time.Minute
+	compact, err := SignPresentation(header, PresentationPayload{ID: "no-exp", IssuedAt: later.Unix(), PublicWitness: publicWitness}, proof, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(compact); err != nil {
+		t.Fatalf("expected a presentation without exp to verify with MaxAge, got %v", err)
+	}
+}
+
+// labeledCircuit has public inputs of every kind
+type labeledCircuit struct {
+	X     frontend.Variable
+	Y     frontend.Variable                 `gnark:",public"`
+	Nonce []uints.U8                        `gnark:",public"`
+	Key   emulated.Element[emulated.P256Fp] `gnark:",public"`
+}
+
+func (c *labeledCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+func TestVerifyInputLabels(t *testing.T) {
+	template := &labeledCircuit{Nonce: make([]uints.U8, 4)}
+	s := newSetup(t, template)
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("labeled/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddInputLabels("labeled/v1", template); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := new(big.Int).SetString("115792089210356248762697446949407573530086143415290314195533631308867097853951", 10)
+	proof, publicWitness := s.prove(t, &labeledCircuit{
+		X:     3,
+		Y:     27,
+		Nonce: uints.NewU8Array([]byte{0xde, 0xad, 0xbe, 0xef}),
+		Key:   emulated.ValueOf[emulated.P256Fp](key),
+	})
+	compact, err := SignPresentation(PresentationHeader{Circuit: "labeled/v1", VKHash: s.vkHash},
+		PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: publicWitness}, proof, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := verifier.Verify(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Y": "27", "Nonce": "deadbeef", "Key": key.String()}
+	if !maps.Equal(res.Labels, want) {
+		t.Fatalf("unexpected labels %v, expected %v", res.Labels, want)
+	}
+
+	labeler, err := NewInputLabeler(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := labeler.Names(); !slices.Equal(names, []string{"Y", "Nonce", "Key"}) {
+		t.Fatalf("unexpected names %v", names)
+	}
+	if _, err := LabelPublicInputs(&labeledCircuit{Nonce: make([]uints.U8, 5)}, publicWitness); !errors.Is(err, ErrInvalidWitness) {
+		t.Fatalf("expected ErrInvalidWitness for another template, got %v", err)
+	}
+}
+
+// freshnessCircuit exposes a timestamped challenge and a CRL with its check
+// time, as the EUDI circuits
+type freshnessCircuit struct {
+	Checked            []frontend.Variable
+	Now                []uints.U8        `gnark:",public"`
+	CRLBytes           []uints.U8        `gnark:",public"`
+	ChallengeTimestamp frontend.Variable `gnark:",public"`
+}
+
+func (c *freshnessCircuit) Define(api frontend.API) error {
+	for i := range c.Now {
+		api.AssertIsEqual(c.Checked[i], c.Now[i].Val)
+	}
+	return nil
+}
+
+func TestVerifyDerivedFields(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	nextUpdate := now.Add(7 * 24 * time.Hour)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "test CA"},
+		KeyUsage:     x509.KeyUsageCRLSign,
+		SubjectKeyId: []byte{1, 2, 3, 4},
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: now.Add(-time.Hour),
+		NextUpdate: nextUpdate,
+	}, issuer, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// zero padded as in the CRL circuits
+	crlSize := len(crl) + 32
+
+	template := &freshnessCircuit{
+		Checked:  make([]frontend.Variable, len(crlTimeLayout)),
+		Now:      make([]uints.U8, len(crlTimeLayout)),
+		CRLBytes: make([]uints.U8, crlSize),
+	}
+	s := newSetup(t, template)
+	holderKey, verifier := newHolder(t)
+	verifier.Now = func() time.Time { return now }
+	if err := verifier.AddCircuit("fresh/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddTimestamp("fresh/v1", template, TimestampPolicy{MaxSkew: 5 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddCRLTime("fresh/v1", template, CRLTimePolicy{MaxSkew: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	digits := now.Format(crlTimeLayout)
+	assignment := &freshnessCircuit{
+		Checked:            make([]frontend.Variable, len(digits)),
+		Now:                make([]uints.U8, len(digits)),
+		CRLBytes:           uints.NewU8Array(append(crl, make([]byte, crlSize-len(crl))...)),
+		ChallengeTimestamp: now.Add(-2 * time.Minute).Unix(),
+	}
+	for i := range digits {
+		assignment.Checked[i] = digits[i]
+		assignment.Now[i] = uints.NewU8(digits[i])
+	}
+	proof, publicWitness := s.prove(t, assignment)
+	compact, err := SignPresentation(PresentationHeader{Circuit: "fresh/v1", VKHash: s.vkHash},
+		PresentationPayload{IssuedAt: now.Unix(), ExpiresAt: now.Add(48 * time.Hour).Unix(), PublicWitness: publicWitness}, proof, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := verifier.Verify(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.VKVersion != (CircuitVersion{ID: "fresh/v1", VKHash: s.vkHash}) {
+		t.Fatalf("unexpected verifying key version %+v", res.VKVersion)
+	}
+	if res.CredentialExpiresIn != 48*time.Hour {
+		t.Fatalf("unexpected credential expiry %v", res.CredentialExpiresIn)
+	}
+	if res.ChallengeAge != 2*time.Minute {
+		t.Fatalf("unexpected challenge age %v", res.ChallengeAge)
+	}
+	if !res.CRLNextUpdate.Equal(nextUpdate) {
+		t.Fatalf("unexpected CRL nextUpdate %v", res.CRLNextUpdate)
+	}
+
+	// as of a past time the fields are relative to it
+	res, err = verifier.VerifyWithOptions(compact, VerificationOptions{AsOf: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ChallengeAge != 3*time.Minute || res.CredentialExpiresIn != 48*time.Hour-time.Minute {
+		t.Fatalf("unexpected derived fields as of a past time: %v, %v", res.ChallengeAge, res.CredentialExpiresIn)
+	}
+
+	// a raw proof has no expiry
+	res, err = verifier.VerifyProof("fresh/v1", proof, publicWitness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.CredentialExpiresIn != 0 || res.VKVersion.VKHash != s.vkHash {
+		t.Fatalf("unexpected derived fields of a raw proof: %v, %+v", res.CredentialExpiresIn, res.VKVersion)
+	}
+}
+
+func TestConsentReceipt(t *testing.T) {
+	holderKey, _ := newHolder(t)
+	resolve := func(kid string) (*ecdsa.PublicKey, error) {
+		if kid != "holder-1" {
+			return nil, errors.New("unknown holder")
+		}
+		return &holderKey.PublicKey, nil
+	}
+	store := &MemoryReceiptStore{}
+	builder := &PresentationBuilder{Key: holderKey, Receipts: store}
+	header := PresentationHeader{Kid: "holder-1", Circuit: "cube/v1", VKHash: "00"}
+	payload := PresentationPayload{
+		ID:            "presentation-1",
+		Audience:      "https://rp.example",
+		PublicWitness: []byte{1, 2, 3},
+		Claims:        map[string]any{"age_over_18": true},
+		Openings:      []ClaimOpening{{Name: "birthdate", Value: "2000-01-31"}, {Name: "age_over_18"}},
+	}
+	compact, record, err := builder.SignWithReceipt(header, payload, []byte("proof"), "https://rp.example/privacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ParsePresentation(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := ParseReceipt(record.Token, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receipt.Check(p); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(receipt.Disclosed, []string{"age_over_18", "birthdate"}) || receipt.Audience != "https://rp.example" ||
+		receipt.Policy != "https://rp.example/privacy" || receipt.PresentationID != "presentation-1" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+
+	// bound to the public inputs of the proof
+	other := *p
+	other.Payload.PublicWitness = []byte{1, 2, 4}
+	if err := receipt.Check(&other); !errors.Is(err, ErrReceiptMismatch) {
+		t.Fatalf("expected ErrReceiptMismatch, got %v", err)
+	}
+
+	// the export of the holder records
+	if records := store.Records(); len(records) != 1 || records[0].Token != record.Token {
+		t.Fatal("expected the receipt in the store")
+	}
+	export, err := store.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := ImportReceipts(export, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Receipt.ID != receipt.ID {
+		t.Fatal("unexpected imported receipts")
+	}
+	tampered := bytes.Replace(export, []byte("https://rp.example/privacy"), []byte("https://rp.example/other"), 1)
+	if _, err := ImportReceipts(tampered, resolve); err == nil {
+		t.Fatal("expected a record not matching its token to fail")
+	}
+}
+
+func TestVerifyComposite(t *testing.T) {
+	cube := newSetup(t, &cubeCircuit{})
+	template := &labeledCircuit{Nonce: make([]uints.U8, 4)}
+	labeled := newSetup(t, template)
+	holderKey, verifier := newHolder(t)
+	verifier.SharedInputs = []string{"Y"}
+	if err := verifier.AddCircuit("cube/v1", cube.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddInputLabels("cube/v1", &cubeCircuit{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddCircuit("labeled/v1", labeled.vk, &PayloadSchema{Required: []string{"nonce"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddInputLabels("labeled/v1", template); err != nil {
+		t.Fatal(err)
+	}
+
+	cubeProof, cubeWitness := cube.prove(t, &cubeCircuit{X: 3, Y: 27})
+	_, otherWitness := cube.prove(t, &cubeCircuit{X: 2, Y: 8})
+	otherProof, _ := cube.prove(t, &cubeCircuit{X: 2, Y: 8})
+	labeledProof, labeledWitness := labeled.prove(t, &labeledCircuit{
+		X:     3,
+		Y:     27,
+		Nonce: uints.NewU8Array([]byte{0xde, 0xad, 0xbe, 0xef}),
+		Key:   emulated.ValueOf[emulated.P256Fp](1),
+	})
+	present := func(nonce string, proofs ...PresentationProof) string {
+		t.Helper()
+		compact, err := SignPresentation(PresentationHeader{Circuit: CompositeCircuit},
+			PresentationPayload{Nonce: nonce, IssuedAt: time.Now().Unix(), Proofs: proofs}, nil, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+	cubeEntry := PresentationProof{Circuit: "cube/v1", VKHash: cube.vkHash, Proof: cubeProof, PublicWitness: cubeWitness}
+	labeledEntry := PresentationProof{Circuit: "labeled/v1", VKHash: labeled.vkHash, Proof: labeledProof, PublicWitness: labeledWitness}
+
+	res, err := verifier.Verify(present("n-1", cubeEntry, labeledEntry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Circuit != CompositeCircuit || len(res.Entries) != 2 {
+		t.Fatalf("unexpected result %s with %d entries", res.Circuit, len(res.Entries))
+	}
+	if e := res.Entries[1]; e.Circuit != "labeled/v1" || e.VKVersion.VKHash != labeled.vkHash || e.Labels["Nonce"] != "deadbeef" {
+		t.Fatalf("unexpected entry %s %s %v", e.Circuit, e.VKVersion.VKHash, e.Labels)
+	}
+
+	tests := []struct {
+		name    string
+		compact string
+		code    ErrorCode
+		class   error
+	}{
+		{"inconsistent", present("n-1", PresentationProof{Circuit: "cube/v1", VKHash: cube.vkHash, Proof: otherProof, PublicWitness: otherWitness}, labeledEntry), CodeInconsistentProofs, ErrInconsistentProofs},
+		{"no proofs", present("n-1"), CodeMalformed, nil},
+		{"unknown circuit", present("n-1", cubeEntry, PresentationProof{Circuit: "square/v1", VKHash: cube.vkHash, Proof: cubeProof, PublicWitness: cubeWitness}), CodeUnknownCircuit, ErrUnknownCircuit},
+		{"proof", present("n-1", cubeEntry, PresentationProof{Circuit: "cube/v1", VKHash: cube.vkHash, Proof: cubeProof, PublicWitness: otherWitness}), CodeProofFailed, ErrProofFailed},
+		{"schema", present("", cubeEntry, labeledEntry), CodeSchemaMismatch, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(tt.compact)
+			var verr *VerificationError
+			if !errors.As(err, &verr) || verr.Code != tt.code {
+				t.Fatalf("expected a %s error, got %v", tt.code, err)
+			}
+			if tt.class != nil && !errors.Is(err, tt.class) {
+				t.Fatalf("expected the error to wrap %v", tt.class)
+			}
+		})
+	}
+}
+
+func TestChannelBinding(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{})
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("cube/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	proof, publicWitness := s.prove(t, &cubeCircuit{X: 3, Y: 27})
+
+	binding, other := SessionBinding("session-1"), SessionBinding("session-2")
+	nonce, err := NewChannelNonce(common.DeterministicRandom("channel"), binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckChannelNonce(nonce, binding); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckChannelNonce(nonce, other); !errors.Is(err, ErrChannelMismatch) {
+		t.Fatalf("expected a channel mismatch, got %v", err)
+	}
+
+	builder := &PresentationBuilder{Key: holderKey}
+	compact, err := builder.Sign(PresentationHeader{Circuit: "cube/v1", VKHash: s.vkHash}, PresentationPayload{Nonce: ChannelNonce(nonce), PublicWitness: publicWitness}, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyWithOptions(compact, VerificationOptions{ChannelBinding: binding}); err != nil {
+		t.Fatal(err)
+	}
+	// relayed to the verifier over another channel
+	var verr *VerificationError
+	if _, err := verifier.VerifyWithOptions(compact, VerificationOptions{ChannelBinding: other}); !errors.As(err, &verr) || verr.Code != CodeChannelMismatch || verr.Stage != StagePublicInputs {
+		t.Fatalf("expected a channel mismatch, got %v", err)
+	}
+	// not checked without binding
+	if _, err := verifier.Verify(compact); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWalletPayload(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{})
+	holderKey, verifier := newHolder(t)
+	if err := verifier.AddCircuit("cube/v1", s.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	proof, publicWitness := s.prove(t, &cubeCircuit{X: 3, Y: 27})
+	header := PresentationHeader{Circuit: "cube/v1", VKHash: s.vkHash}
+	payload := PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: publicWitness}
+	compact, err := SignPresentation(header, payload, proof, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cose, err := SignPresentationCOSE(header, payload, proof, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifierKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := NewJWK(verifierKey.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := json.Marshal(map[string]any{"vp_token": map[string][]string{"pid": {compact}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := EncryptPresentation(response, "application/json", jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vpToken := `{"pid":["` + compact + `"],"pid_cose":"` + base64.RawURLEncoding.EncodeToString(cose) + `"}`
+	for name, payload := range map[string]string{
+		"presentation":      compact,
+		"vp_token":          vpToken,
+		"fragment":          "https://verifier.example/cb#vp_token=" + url.QueryEscape(vpToken),
+		"deep link":         "eudi-openid4vp://cb?vp_token=" + url.QueryEscape(vpToken),
+		"encrypted":         "https://verifier.example/cb#response=" + encrypted,
+		"encrypted padding": base64.URLEncoding.EncodeToString(cose),
+	} {
+		results, err := verifier.VerifyWalletPayload(payload, verifierKey, VerificationOptions{})
+		if err != nil || len(results) == 0 {
+			t.Fatalf("%s: %d results, %v", name, len(results), err)
+		}
+	}
+
+	sdJWT := compactJWS(t, `{"alg":"ES256","typ":"dc+sd-jwt"}`) + "~WyJzYWx0IiwiZ2l2ZW5fbmFtZSIsIkVyaWthIl0~"
+	cborLD := base64.RawURLEncoding.EncodeToString([]byte{0xD9, 0x06, 0x01, 0xA0})
+	unsupported := []struct {
+		name    string
+		payload string
+		format  PayloadFormat
+	}{
+		{"dc+sd-jwt", `{"pid":["` + sdJWT + `"]}`, PayloadSDJWT},
+		{"jwt_vc_json", compactJWS(t, `{"alg":"ES256","typ":"JWT"}`), PayloadJWT},
+		{"cbor-ld", cborLD, PayloadCBORLD},
+		{"cbor-ld barcode", "VC1-ABCDEFGH", PayloadCBORLD},
+		{"device engagement", "mdoc:owBjMS4wAYIB2BhYS6QBAiABIVgg", PayloadMdoc},
+		{"request", "eudi-openid4vp://?client_id=verifier.example&request_uri=https%3A%2F%2Fverifier.example%2Frequest", PayloadRequest},
+		{"encrypted without key", encrypted, PayloadPresentationJWE},
+	}
+	for _, tt := range unsupported {
+		_, err := verifier.VerifyWalletPayload(tt.payload, nil, VerificationOptions{})
+		var verr *VerificationError
+		var unsupportedErr *UnsupportedPayloadError
+		if !errors.Is(err, ErrUnsupportedPayload) || !errors.As(err, &verr) || verr.Code != CodeUnsupportedPayload || !errors.As(err, &unsupportedErr) {
+			t.Fatalf("%s: expected an unsupported payload error, got %v", tt.name, err)
+		}
+		if unsupportedErr.Format != tt.format || unsupportedErr.Hint == "" {
+			t.Fatalf("%s: unexpected error %+v", tt.name, unsupportedErr)
+		}
+	}
+
+	// the DC+SD-JWT maps onto the JWS circuits, by credential query
+	_, err = verifier.VerifyWalletPayload(`{"pid":["`+sdJWT+`"]}`, nil, VerificationOptions{})
+	var unsupportedErr *UnsupportedPayloadError
+	if !errors.As(err, &unsupportedErr) || unsupportedErr.QueryID != "pid" || !slices.Contains(unsupportedErr.Circuits, "predicates") {
+		t.Fatalf("unexpected DC+SD-JWT error %+v", unsupportedErr)
+	}
+
+	// a presentation failing verification keeps its failure class
+	_, err = verifier.VerifyWalletPayload(compact[:len(compact)-4]+"AAAA", nil, VerificationOptions{})
+	var verr *VerificationError
+	if !errors.As(err, &verr) || verr.Code != CodeInvalidSignature {
+		t.Fatalf("expected an invalid signature, got %v", err)
+	}
+	if _, err := DecodeWalletPayload("https://verifier.example/cb?state=1"); err == nil {
+		t.Fatal("expected an error for a URI without vp_token")
+	}
+}
+
+// compactJWS returns a JWS of the header, with an empty payload and signature
+func compactJWS(t *testing.T, header string) string {
+	t.Helper()
+	return base64.RawURLEncoding.EncodeToString([]byte(header)) + ".e30.c2ln"
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// ErrVersionMismatch is the failure class of a VersionError
+var ErrVersionMismatch = verifier.ErrVersionMismatch
+
+// CircuitVersion is a registered version of a circuit
+type CircuitVersion struct {
+	ID     string `json:"id"`
+	VKHash string `json:"vk_hash"` // hex SHA-256 of the verifying key (common.VerifyingKeyHash)
+}
+
+// VersionError is returned for a proof made for a version of the circuit the
+// verifier does not accept: a circuit id whose version is not registered, or
+// a verifying key hash other than the registered one. Versions are the
+// registered versions of the circuit, the ones the prover can switch to.
+type VersionError struct {
+	Circuit string
+	// VKHash is the verifying key hash of the proof, for a registered circuit
+	VKHash   string
+	Versions []CircuitVersion
+
+	// unknown is set when the circuit id is not registered
+	unknown bool
+}
+
+func (e *VersionError) Error() string {
+	ids := make([]string, len(e.Versions))
+	for i, version := range e.Versions {
+		ids[i] = version.ID
+	}
+	if e.unknown {
+		return fmt.Sprintf("%s: %q is not registered, available %s", ErrVersionMismatch, e.Circuit, strings.Join(ids, ", "))
+	}
+	return fmt.Sprintf("%s: verifying key hash %q does not match circuit %q, available %s", ErrVersionMismatch, e.VKHash, e.Circuit, strings.Join(ids, ", "))
+}
+
+// Is matches ErrVersionMismatch, and ErrUnknownCircuit for an unknown version
+func (e *VersionError) Is(target error) bool {
+	return target == ErrVersionMismatch || (target == ErrUnknownCircuit && e.unknown)
+}
+
+// CircuitFamily returns the circuit id without its version segment, the
+// versions of a circuit share the family
+func CircuitFamily(circuitID string) string {
+	return verifier.CircuitFamily(circuitID)
+}
+
+// ErrCircuitDeprecated is the failure class of a DeprecationError
+var ErrCircuitDeprecated = verifier.ErrCircuitDeprecated
+
+// Deprecation is the minimum version of a circuit family, see
+// verifier.Deprecation
+type Deprecation = verifier.Deprecation
+
+// DeprecationError is returned for a proof of a circuit version below the
+// minimum version of its family
+type DeprecationError = verifier.DeprecationError
+
+// VersionPolicy holds the minimum versions of the circuit families, see
+// verifier.VersionPolicy
+type VersionPolicy = verifier.VersionPolicy
+
+// NewVersionPolicy returns the policy of the deprecations
+func NewVersionPolicy(deprecations ...Deprecation) (*VersionPolicy, error) {
+	return verifier.NewVersionPolicy(deprecations...)
+}
+
+// Versions returns the registered versions of the circuit (the circuits of
+// its family), sorted by id
+func (v *PresentationVerifier) Versions(circuitID string) []CircuitVersion {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.versions(circuitID)
+}
+
+func (v *PresentationVerifier) versions(circuitID string) []CircuitVersion {
+	family := CircuitFamily(circuitID)
+	var versions []CircuitVersion
+	for id, c := range v.circuits {
+		if CircuitFamily(id) == family {
+			versions = append(versions, CircuitVersion{ID: id, VKHash: c.vkHash})
+		}
+	}
+	slices.SortFunc(versions, func(a, b CircuitVersion) int { return strings.Compare(a.ID, b.ID) })
+	return versions
+}
+
+// CheckVersion checks that the circuit is registered with the verifying key
+// hash vkHash (any when empty): a *VersionError when another version of the
+// circuit is registered, ErrUnknownCircuit when none is
+func (v *PresentationVerifier) CheckVersion(circuitID, vkHash string) error {
+	c, err := v.circuit(circuitID)
+	if err != nil {
+		return err
+	}
+	if vkHash != "" && vkHash != c.vkHash {
+		return &VersionError{Circuit: circuitID, VKHash: vkHash, Versions: v.Versions(circuitID)}
+	}
+	return nil
+}
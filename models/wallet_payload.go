@@ -0,0 +1,391 @@
+package models
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// ErrUnsupportedPayload is returned for a wallet payload, or an artifact of
+// it, this package does not verify; errors.As gives its
+// UnsupportedPayloadError
+var ErrUnsupportedPayload = errors.New("unsupported wallet payload")
+
+// PayloadFormat is the format of an artifact of a wallet payload, see
+// DecodeWalletPayload
+type PayloadFormat string
+
+const (
+	// PayloadPresentation is a compact presentation of this package (Verify)
+	PayloadPresentation PayloadFormat = PresentationType
+	// PayloadPresentationCOSE is a COSE presentation (VerifyCOSE)
+	PayloadPresentationCOSE PayloadFormat = "zkp+cose"
+	// PayloadPresentationJWE is an encrypted presentation (VerifyEncrypted)
+	PayloadPresentationJWE PayloadFormat = "zkp+jwe"
+	// PayloadSDJWT is a DC+SD-JWT presentation: the issuer-signed JWT, its
+	// disclosures and the key binding JWT
+	PayloadSDJWT PayloadFormat = "dc+sd-jwt"
+	// PayloadJWT is a JWS of another type, e.g. a jwt_vc_json presentation
+	PayloadJWT PayloadFormat = "jwt"
+	// PayloadCBORLD is a CBOR-LD compressed JSON-LD credential or
+	// presentation, e.g. a VC1- barcode
+	PayloadCBORLD PayloadFormat = "cbor-ld"
+	// PayloadMdoc is an ISO/IEC 18013-5 mdoc DeviceResponse or device
+	// engagement
+	PayloadMdoc PayloadFormat = "mso_mdoc"
+	// PayloadRequest is an OpenID4VP authorization request of a verifier
+	PayloadRequest PayloadFormat = "openid4vp-request"
+)
+
+// sdJWTCircuits are the circuits taking the issuer-signed JWT of a DC+SD-JWT
+// (an ES256 JWS) as their input
+var sdJWTCircuits = []string{"predicates", "temporal/over18", "eudi-vc/eudi"}
+
+// UnsupportedPayloadError describes an artifact this package does not verify
+// and the interop path, e.g. the circuits proving the claims of a DC+SD-JWT
+// in zero knowledge
+type UnsupportedPayloadError struct {
+	Format PayloadFormat
+	// QueryID is the credential query id of the artifact in the vp_token
+	QueryID string
+	// Feature is the unsupported feature, e.g. "claims disclosed in clear"
+	Feature string
+	// Hint is what the integrator can do instead
+	Hint string
+	// Circuits are the circuit families taking the artifact, or part of it,
+	// as their input
+	Circuits []string
+}
+
+func (e *UnsupportedPayloadError) Error() string {
+	msg := fmt.Sprintf("%s: %s is not supported", e.Format, e.Feature)
+	if e.QueryID != "" {
+		msg = fmt.Sprintf("vp_token %q: %s", e.QueryID, msg)
+	}
+	if e.Hint != "" {
+		msg += ": " + e.Hint
+	}
+	return msg
+}
+
+func (e *UnsupportedPayloadError) Is(target error) bool {
+	return target == ErrUnsupportedPayload
+}
+
+// WalletArtifact is an artifact of a wallet payload
+type WalletArtifact struct {
+	Format PayloadFormat `json:"format"`
+	// QueryID is the credential query id (DCQL) of the artifact in a vp_token
+	// object, empty otherwise
+	QueryID string `json:"query_id,omitempty"`
+	// Compact is the serialization of a JWS, JWE or SD-JWT artifact
+	Compact string `json:"compact,omitempty"`
+	// Raw are the bytes of a binary artifact (COSE, mdoc, CBOR-LD)
+	Raw []byte `json:"raw,omitempty"`
+}
+
+// DecodeWalletPayload decodes the presentation payload of a QR code or deep
+// link of the EUDI reference wallets into its artifacts:
+//
+//   - a deep link or redirect URI (openid4vp://, eudi-openid4vp://, https://)
+//     carrying the vp_token of an OpenID4VP response, in its query or
+//     fragment
+//   - a vp_token: a JSON object of credential query ids to presentations
+//     (DCQL), a JSON array of presentations or a single presentation
+//   - a presentation: compact presentation of this package, JWT, JWE,
+//     DC+SD-JWT, or a binary COSE presentation, mdoc DeviceResponse or
+//     CBOR-LD credential, base64url or base64
+//
+// A payload that is not a presentation, an OpenID4VP request or an mdoc device
+// engagement, returns an UnsupportedPayloadError. The artifacts are verified
+// with PresentationVerifier.VerifyWalletPayload.
+func DecodeWalletPayload(payload string) ([]WalletArtifact, error) {
+	payload = strings.TrimSpace(payload)
+	switch {
+	case payload == "":
+		return nil, fmt.Errorf("empty wallet payload")
+	case hasPrefixFold(payload, "mdoc:"):
+		return nil, &UnsupportedPayloadError{
+			Format:  PayloadMdoc,
+			Feature: "ISO/IEC 18013-5 device engagement",
+			Hint:    "a proximity presentation needs a BLE, NFC or Wi-Fi Aware session with the wallet; request the credential over OpenID4VP and have the wallet present a zkp presentation",
+		}
+	case hasPrefixFold(payload, "VC1-"), hasPrefixFold(payload, "VP1-"):
+		return []WalletArtifact{{Format: PayloadCBORLD, Raw: []byte(payload)}}, nil
+	}
+
+	if u, err := url.Parse(payload); err == nil && u.Scheme != "" && (u.RawQuery != "" || u.Fragment != "") {
+		return decodeWalletURI(u)
+	}
+	return decodeVPToken(payload)
+}
+
+// decodeWalletURI decodes the vp_token of a deep link or redirect URI
+func decodeWalletURI(u *url.URL) ([]WalletArtifact, error) {
+	params := u.Query()
+	if fragment, err := url.ParseQuery(u.Fragment); err == nil {
+		for k, v := range fragment {
+			params[k] = append(params[k], v...)
+		}
+	}
+
+	switch {
+	case params.Has("vp_token"):
+		return decodeVPToken(params.Get("vp_token"))
+	case params.Has("response"):
+		// JARM response mode, the JWE of the authorization response
+		return []WalletArtifact{{Format: PayloadPresentationJWE, Compact: params.Get("response")}}, nil
+	case params.Has("request_uri"), params.Has("request"), params.Has("dcql_query"), params.Has("presentation_definition"), params.Has("client_id"):
+		return nil, &UnsupportedPayloadError{
+			Format:  PayloadRequest,
+			Feature: "OpenID4VP authorization request",
+			Hint:    "the QR code is the request of a verifier for a wallet, not a presentation; open it with a wallet and verify the vp_token of its response",
+		}
+	}
+	return nil, fmt.Errorf("wallet payload URI %s://... has no vp_token", u.Scheme)
+}
+
+// decodeVPToken decodes a vp_token: a JSON object by credential query id, a
+// JSON array or a single presentation
+func decodeVPToken(token string) ([]WalletArtifact, error) {
+	token = strings.TrimSpace(token)
+	switch {
+	case strings.HasPrefix(token, "{"):
+		var byQuery map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(token), &byQuery); err != nil {
+			return nil, fmt.Errorf("invalid vp_token: %w", err)
+		}
+		var artifacts []WalletArtifact
+		for _, id := range slices.Sorted(maps.Keys(byQuery)) {
+			presentations, err := vpTokenPresentations(byQuery[id])
+			if err != nil {
+				return nil, fmt.Errorf("invalid vp_token %q: %w", id, err)
+			}
+			for _, p := range presentations {
+				a, err := decodeArtifact(p)
+				if err != nil {
+					return nil, withQueryID(err, id)
+				}
+				a.QueryID = id
+				artifacts = append(artifacts, a)
+			}
+		}
+		return artifacts, nil
+	case strings.HasPrefix(token, "["):
+		presentations, err := vpTokenPresentations(json.RawMessage(token))
+		if err != nil {
+			return nil, fmt.Errorf("invalid vp_token: %w", err)
+		}
+		artifacts := make([]WalletArtifact, 0, len(presentations))
+		for _, p := range presentations {
+			a, err := decodeArtifact(p)
+			if err != nil {
+				return nil, err
+			}
+			artifacts = append(artifacts, a)
+		}
+		return artifacts, nil
+	}
+	a, err := decodeArtifact(token)
+	if err != nil {
+		return nil, err
+	}
+	return []WalletArtifact{a}, nil
+}
+
+// vpTokenPresentations returns the presentations of a vp_token entry, a
+// string or an array of strings
+func vpTokenPresentations(raw json.RawMessage) ([]string, error) {
+	var presentation string
+	if err := json.Unmarshal(raw, &presentation); err == nil {
+		return []string{presentation}, nil
+	}
+	var presentations []string
+	if err := json.Unmarshal(raw, &presentations); err != nil {
+		return nil, fmt.Errorf("presentations are not strings")
+	}
+	return presentations, nil
+}
+
+// decodeArtifact identifies a single presentation
+func decodeArtifact(p string) (WalletArtifact, error) {
+	p = strings.TrimSpace(p)
+	if strings.Contains(p, "~") {
+		return WalletArtifact{Format: PayloadSDJWT, Compact: p}, nil
+	}
+	switch parts := strings.Split(p, "."); len(parts) {
+	case 3, 4:
+		// a JWT, or a presentation: header.payload.proof.signature
+		var header struct {
+			Typ string `json:"typ"`
+		}
+		data, err := base64.RawURLEncoding.DecodeString(parts[0])
+		if err != nil || json.Unmarshal(data, &header) != nil {
+			return WalletArtifact{}, fmt.Errorf("invalid JWS presentation header")
+		}
+		switch {
+		case header.Typ == PresentationType && len(parts) == 4:
+			return WalletArtifact{Format: PayloadPresentation, Compact: p}, nil
+		case header.Typ == "dc+sd-jwt" || header.Typ == "vc+sd-jwt":
+			return WalletArtifact{Format: PayloadSDJWT, Compact: p}, nil
+		}
+		return WalletArtifact{Format: PayloadJWT, Compact: p}, nil
+	case 5:
+		return WalletArtifact{Format: PayloadPresentationJWE, Compact: p}, nil
+	}
+
+	data, err := decodeBinary(p)
+	if err != nil {
+		return WalletArtifact{}, fmt.Errorf("wallet presentation is neither a JWS, a JWE nor base64url CBOR")
+	}
+	switch {
+	case len(data) > 0 && data[0] == 0xD2:
+		// tag 18, COSE_Sign1
+		return WalletArtifact{Format: PayloadPresentationCOSE, Raw: data}, nil
+	case len(data) > 2 && data[0] == 0xD9 && (data[1] == 0x05 || data[1] == 0x06):
+		// tags 0x0500 to 0x06FF of the CBOR-LD registry
+		return WalletArtifact{Format: PayloadCBORLD, Raw: data}, nil
+	}
+	var deviceResponse struct {
+		Version   string `cbor:"version"`
+		Documents []any  `cbor:"documents"`
+	}
+	if cbor.Unmarshal(data, &deviceResponse) == nil && deviceResponse.Version != "" {
+		return WalletArtifact{Format: PayloadMdoc, Raw: data}, nil
+	}
+	return WalletArtifact{}, fmt.Errorf("unknown binary wallet presentation")
+}
+
+// decodeBinary decodes base64url or base64, padded or not
+func decodeBinary(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if data, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return data, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// VerifyWalletPayload verifies the artifacts of a wallet payload
+// (DecodeWalletPayload) with the options: the presentations of this package
+// with Verify, VerifyCOSE or, with the verifier key, VerifyEncrypted, in
+// order. An artifact of another format fails with a StageParse
+// VerificationError of CodeUnsupportedPayload wrapping the
+// UnsupportedPayloadError describing its interop path. It returns the results
+// of the artifacts verified before the first failure.
+func (v *PresentationVerifier) VerifyWalletPayload(payload string, key *ecdh.PrivateKey, opts VerificationOptions) ([]*VerificationResult, error) {
+	artifacts, err := DecodeWalletPayload(payload)
+	if err != nil {
+		return nil, failure(StageParse, CodeMalformed, err, nil)
+	}
+	results := make([]*VerificationResult, 0, len(artifacts))
+	for _, a := range artifacts {
+		res, err := v.verifyArtifact(a, key, opts)
+		if err != nil {
+			return results, failure(StageParse, CodeMalformed, withQueryID(err, a.QueryID), nil)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// verifyArtifact maps an artifact onto the verifier of its format
+func (v *PresentationVerifier) verifyArtifact(a WalletArtifact, key *ecdh.PrivateKey, opts VerificationOptions) (*VerificationResult, error) {
+	switch a.Format {
+	case PayloadPresentation:
+		return v.VerifyWithOptions(a.Compact, opts)
+	case PayloadPresentationCOSE:
+		return v.VerifyCOSEWithOptions(a.Raw, opts)
+	case PayloadPresentationJWE:
+		if key == nil {
+			return nil, &UnsupportedPayloadError{
+				Format:  a.Format,
+				Feature: "encrypted presentation without a verifier key",
+				Hint:    "pass the private key of the JWK the wallet encrypted the response to",
+			}
+		}
+		presentation, contentType, err := DecryptPresentation(a.Compact, key)
+		if err != nil {
+			return nil, err
+		}
+		if contentType == "application/json" || bytes.HasPrefix(bytes.TrimSpace(presentation), []byte("{")) {
+			return v.verifyResponse(presentation, opts)
+		}
+		return v.verifyDecrypted(presentation, contentType, opts)
+	case PayloadSDJWT:
+		return nil, &UnsupportedPayloadError{
+			Format:   a.Format,
+			Feature:  "claims disclosed in clear",
+			Hint:     "a DC+SD-JWT presentation is not a zero-knowledge proof; its issuer-signed JWT is the input of the listed circuits, have the wallet prove the requested claims with them and present the zkp presentation",
+			Circuits: slices.Clone(sdJWTCircuits),
+		}
+	case PayloadJWT:
+		return nil, &UnsupportedPayloadError{
+			Format:  a.Format,
+			Feature: "JWS presentation of another typ than " + PresentationType,
+			Hint:    "request a presentation of this package, typ " + PresentationType,
+		}
+	case PayloadCBORLD:
+		return nil, &UnsupportedPayloadError{
+			Format:  a.Format,
+			Feature: "CBOR-LD semantic compression and Data Integrity proofs",
+			Hint:    "the JSON-LD contexts and the Data Integrity cryptosuites have no circuit in this package; request the credential as a DC+SD-JWT proven in a zkp presentation",
+		}
+	case PayloadMdoc:
+		return nil, &UnsupportedPayloadError{
+			Format:  a.Format,
+			Feature: "mdoc DeviceResponse (MSO and COSE_Sign1 of the issuer)",
+			Hint:    "the mobile security object is not an input of the circuits; request the PID as a DC+SD-JWT proven in a zkp presentation",
+		}
+	}
+	return nil, fmt.Errorf("unknown wallet artifact format %q", a.Format)
+}
+
+// verifyResponse verifies the vp_token of a decrypted OpenID4VP authorization
+// response (direct_post.jwt), one presentation expected
+func (v *PresentationVerifier) verifyResponse(response []byte, opts VerificationOptions) (*VerificationResult, error) {
+	var body struct {
+		VPToken json.RawMessage `json:"vp_token"`
+	}
+	if err := json.Unmarshal(response, &body); err != nil || body.VPToken == nil {
+		return nil, fmt.Errorf("encrypted response has no vp_token")
+	}
+	token := string(body.VPToken)
+	var s string
+	if json.Unmarshal(body.VPToken, &s) == nil {
+		token = s
+	}
+	artifacts, err := decodeVPToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if len(artifacts) != 1 {
+		return nil, fmt.Errorf("encrypted response has %d presentations, expected 1", len(artifacts))
+	}
+	if artifacts[0].Format == PayloadPresentationJWE {
+		return nil, fmt.Errorf("nested encrypted presentation")
+	}
+	res, err := v.verifyArtifact(artifacts[0], nil, opts)
+	return res, withQueryID(err, artifacts[0].QueryID)
+}
+
+// withQueryID sets the query id of an UnsupportedPayloadError
+func withQueryID(err error, id string) error {
+	var unsupported *UnsupportedPayloadError
+	if id != "" && errors.As(err, &unsupported) && unsupported.QueryID == "" {
+		unsupported.QueryID = id
+	}
+	return err
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
@@ -0,0 +1,400 @@
+// Package openid4vci is a holder-side client for OpenID for Verifiable
+// Credential Issuance: it resolves credential offers, obtains an access token
+// (pre-authorized code or authorization code flow) and requests credentials
+// with a key proof built by a ProofBuilder.
+package openid4vci
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GrantPreAuthorizedCode is the grant type of the pre-authorized code flow
+const GrantPreAuthorizedCode = "urn:ietf:params:oauth:grant-type:pre-authorized_code"
+
+// CredentialOffer is the credential offer of an issuer
+type CredentialOffer struct {
+	CredentialIssuer           string   `json:"credential_issuer"`
+	CredentialConfigurationIDs []string `json:"credential_configuration_ids"`
+	Grants                     Grants   `json:"grants,omitempty"`
+}
+
+// Grants of a credential offer
+type Grants struct {
+	AuthorizationCode *AuthorizationCodeGrant `json:"authorization_code,omitempty"`
+	PreAuthorizedCode *PreAuthorizedCodeGrant `json:"urn:ietf:params:oauth:grant-type:pre-authorized_code,omitempty"`
+}
+
+// AuthorizationCodeGrant of a credential offer
+type AuthorizationCodeGrant struct {
+	IssuerState         string `json:"issuer_state,omitempty"`
+	AuthorizationServer string `json:"authorization_server,omitempty"`
+}
+
+// PreAuthorizedCodeGrant of a credential offer
+type PreAuthorizedCodeGrant struct {
+	PreAuthorizedCode   string  `json:"pre-authorized_code"`
+	TxCode              *TxCode `json:"tx_code,omitempty"`
+	AuthorizationServer string  `json:"authorization_server,omitempty"`
+}
+
+// TxCode describes the transaction code the user has to enter
+type TxCode struct {
+	InputMode   string `json:"input_mode,omitempty"`
+	Length      int    `json:"length,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// IssuerMetadata is the subset of the credential issuer metadata used by the
+// client
+type IssuerMetadata struct {
+	CredentialIssuer                  string                     `json:"credential_issuer"`
+	AuthorizationServers              []string                   `json:"authorization_servers,omitempty"`
+	CredentialEndpoint                string                     `json:"credential_endpoint"`
+	NonceEndpoint                     string                     `json:"nonce_endpoint,omitempty"`
+	CredentialConfigurationsSupported map[string]json.RawMessage `json:"credential_configurations_supported"`
+}
+
+// AuthorizationServerMetadata is the subset of the OAuth authorization server
+// metadata used by the client
+type AuthorizationServerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// Token is the token response of the authorization server
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+}
+
+// Credential is one issued credential
+type Credential struct {
+	Credential json.RawMessage `json:"credential"`
+}
+
+// CredentialResponse is the response of the credential endpoint.
+// TransactionID is set when the issuance is deferred.
+type CredentialResponse struct {
+	Credentials   []Credential `json:"credentials,omitempty"`
+	TransactionID string       `json:"transaction_id,omitempty"`
+}
+
+// Client is an OpenID4VCI holder client
+type Client struct {
+	HTTPClient  *http.Client
+	ClientID    string
+	RedirectURI string
+}
+
+// Session holds the state of one issuance: the offer, the metadata of the
+// issuer and of its authorization server, and the access token
+type Session struct {
+	Offer      *CredentialOffer
+	Issuer     *IssuerMetadata
+	AuthServer *AuthorizationServerMetadata
+	Token      *Token
+
+	// PKCE verifier of the authorization code flow
+	codeVerifier string
+}
+
+// ResolveOffer parses a credential offer URI (openid-credential-offer://?...
+// with credential_offer or credential_offer_uri) and fetches the metadata of
+// the issuer and of its authorization server
+func (c *Client) ResolveOffer(ctx context.Context, offerURI string) (*Session, error) {
+	u, err := url.Parse(offerURI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential offer: %w", err)
+	}
+
+	offer := &CredentialOffer{}
+	query := u.Query()
+	switch {
+	case query.Get("credential_offer") != "":
+		if err := json.Unmarshal([]byte(query.Get("credential_offer")), offer); err != nil {
+			return nil, fmt.Errorf("invalid credential offer: %w", err)
+		}
+	case query.Get("credential_offer_uri") != "":
+		if err := c.getJSON(ctx, query.Get("credential_offer_uri"), offer); err != nil {
+			return nil, fmt.Errorf("failed to fetch the credential offer: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("no credential_offer or credential_offer_uri in %q", offerURI)
+	}
+
+	if offer.CredentialIssuer == "" || len(offer.CredentialConfigurationIDs) == 0 {
+		return nil, fmt.Errorf("incomplete credential offer")
+	}
+
+	session := &Session{Offer: offer, Issuer: &IssuerMetadata{}, AuthServer: &AuthorizationServerMetadata{}}
+
+	issuerMetadataURL, err := wellKnownURL(offer.CredentialIssuer, "openid-credential-issuer")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.getJSON(ctx, issuerMetadataURL, session.Issuer); err != nil {
+		return nil, fmt.Errorf("failed to fetch the issuer metadata: %w", err)
+	}
+	if session.Issuer.CredentialIssuer != offer.CredentialIssuer {
+		return nil, fmt.Errorf("issuer metadata of %q served for %q", session.Issuer.CredentialIssuer, offer.CredentialIssuer)
+	}
+
+	authServer := offer.CredentialIssuer
+	if len(session.Issuer.AuthorizationServers) > 0 {
+		authServer = session.Issuer.AuthorizationServers[0]
+	}
+	if g := offer.Grants.PreAuthorizedCode; g != nil && g.AuthorizationServer != "" {
+		authServer = g.AuthorizationServer
+	} else if g := offer.Grants.AuthorizationCode; g != nil && g.AuthorizationServer != "" {
+		authServer = g.AuthorizationServer
+	}
+
+	authServerMetadataURL, err := wellKnownURL(authServer, "oauth-authorization-server")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.getJSON(ctx, authServerMetadataURL, session.AuthServer); err != nil {
+		return nil, fmt.Errorf("failed to fetch the authorization server metadata: %w", err)
+	}
+
+	return session, nil
+}
+
+// PreAuthorizedToken obtains the access token of the pre-authorized code
+// flow. txCode is the transaction code entered by the user (empty when the
+// offer does not require one).
+func (c *Client) PreAuthorizedToken(ctx context.Context, session *Session, txCode string) error {
+	grant := session.Offer.Grants.PreAuthorizedCode
+	if grant == nil {
+		return fmt.Errorf("the offer has no pre-authorized code grant")
+	}
+	if grant.TxCode != nil && txCode == "" {
+		return fmt.Errorf("the offer requires a transaction code")
+	}
+
+	form := url.Values{
+		"grant_type":          {GrantPreAuthorizedCode},
+		"pre-authorized_code": {grant.PreAuthorizedCode},
+	}
+	if txCode != "" {
+		form.Set("tx_code", txCode)
+	}
+	if c.ClientID != "" {
+		form.Set("client_id", c.ClientID)
+	}
+
+	return c.requestToken(ctx, session, form)
+}
+
+// AuthorizationURL returns the URL the user is redirected to in the
+// authorization code flow (PKCE S256) and the state to check on the redirect
+func (c *Client) AuthorizationURL(session *Session) (string, string, error) {
+	if session.AuthServer.AuthorizationEndpoint == "" {
+		return "", "", fmt.Errorf("the authorization server has no authorization endpoint")
+	}
+
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return "", "", err
+	}
+	session.codeVerifier = verifier
+
+	details := make([]map[string]string, len(session.Offer.CredentialConfigurationIDs))
+	for i, id := range session.Offer.CredentialConfigurationIDs {
+		details[i] = map[string]string{
+			"type":                        "openid_credential",
+			"credential_configuration_id": id,
+		}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {c.RedirectURI},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+		"authorization_details": {string(detailsJSON)},
+	}
+	if g := session.Offer.Grants.AuthorizationCode; g != nil && g.IssuerState != "" {
+		query.Set("issuer_state", g.IssuerState)
+	}
+
+	u, err := url.Parse(session.AuthServer.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), state, nil
+}
+
+// ExchangeCode obtains the access token of the authorization code flow for
+// the code returned on the redirect URI
+func (c *Client) ExchangeCode(ctx context.Context, session *Session, code string) error {
+	if session.codeVerifier == "" {
+		return fmt.Errorf("no authorization request for this session")
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURI},
+		"client_id":     {c.ClientID},
+		"code_verifier": {session.codeVerifier},
+	}
+
+	return c.requestToken(ctx, session, form)
+}
+
+// RequestCredential requests the credential of the configuration id with a key
+// proof of the proof builder
+func (c *Client) RequestCredential(ctx context.Context, session *Session, configurationID string, proofBuilder ProofBuilder) (*CredentialResponse, error) {
+	if session.Token == nil {
+		return nil, fmt.Errorf("no access token for this session")
+	}
+
+	nonce, err := c.nonce(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	proof, err := proofBuilder.BuildProof(ctx, session.Offer.CredentialIssuer, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the key proof: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"credential_configuration_id": configurationID,
+		"proofs": map[string][]string{
+			proofBuilder.ProofType(): {proof},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, session.Issuer.CredentialEndpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+session.Token.AccessToken)
+
+	res := &CredentialResponse{}
+	if err := c.doJSON(req, res); err != nil {
+		return nil, fmt.Errorf("credential request failed: %w", err)
+	}
+	return res, nil
+}
+
+// nonce fetches a c_nonce from the nonce endpoint of the issuer (if any)
+func (c *Client) nonce(ctx context.Context, session *Session) (string, error) {
+	if session.Issuer.NonceEndpoint == "" {
+		return "", nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, session.Issuer.NonceEndpoint, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var res struct {
+		CNonce string `json:"c_nonce"`
+	}
+	if err := c.doJSON(req, &res); err != nil {
+		return "", fmt.Errorf("nonce request failed: %w", err)
+	}
+	return res.CNonce, nil
+}
+
+func (c *Client) requestToken(ctx context.Context, session *Session, form url.Values) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, session.AuthServer.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	token := &Token{}
+	if err := c.doJSON(req, token); err != nil {
+		return fmt.Errorf("token request failed: %w", err)
+	}
+	if token.AccessToken == "" {
+		return fmt.Errorf("token request failed: no access token")
+	}
+
+	session.Token = token
+	return nil
+}
+
+func (c *Client) getJSON(ctx context.Context, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, v)
+}
+
+// doJSON sends the request and decodes the JSON response into v
+func (c *Client) doJSON(req *http.Request, v any) error {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// wellKnownURL inserts the well-known path between the host and the path of
+// the identifier (RFC 8414)
+func wellKnownURL(identifier, name string) (string, error) {
+	u, err := url.Parse(identifier)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid identifier %q", identifier)
+	}
+	u.Path = "/.well-known/" + name + strings.TrimSuffix(u.Path, "/")
+	return u.String(), nil
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
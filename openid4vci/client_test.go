@@ -0,0 +1,242 @@
+package openid4vci
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mynextid/eudi-zk/datagen"
+)
+
+// mockIssuer serves the issuer, authorization server, nonce and credential
+// endpoints and checks the key proof of the credential request
+func mockIssuer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	const nonce = "c-nonce-1"
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux.HandleFunc("/.well-known/openid-credential-issuer", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"credential_issuer":   server.URL,
+			"credential_endpoint": server.URL + "/credential",
+			"nonce_endpoint":      server.URL + "/nonce",
+			"credential_configurations_supported": map[string]any{
+				"pid": map[string]string{"format": "dc+sd-jwt"},
+			},
+		})
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.PostForm.Get("grant_type") {
+		case GrantPreAuthorizedCode:
+			if r.PostForm.Get("pre-authorized_code") != "code-1" || r.PostForm.Get("tx_code") != "1234" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+		case "authorization_code":
+			if r.PostForm.Get("code") != "auth-code" || r.PostForm.Get("code_verifier") == "" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]any{"access_token": "token-1", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"c_nonce": nonce})
+	})
+	mux.HandleFunc("/credential", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			http.Error(w, `{"error":"invalid_token"}`, http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			CredentialConfigurationID string              `json:"credential_configuration_id"`
+			Proofs                    map[string][]string `json:"proofs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Proofs[ProofTypeJWT]) != 1 {
+			http.Error(w, `{"error":"invalid_proof"}`, http.StatusBadRequest)
+			return
+		}
+		if err := verifyProof(req.Proofs[ProofTypeJWT][0], server.URL, nonce); err != nil {
+			t.Errorf("invalid proof: %v", err)
+			http.Error(w, `{"error":"invalid_proof"}`, http.StatusBadRequest)
+			return
+		}
+		gen := datagen.New("openid4vci")
+		credential, err := gen.JWS(gen.Key("issuer"), gen.PID("holder"), datagen.JWSOptions{})
+		if err != nil {
+			t.Error(err)
+			http.Error(w, `{"error":"server_error"}`, http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"credentials": []map[string]string{{"credential": credential}}})
+	})
+
+	return server
+}
+
+// verifyProof verifies the ES256 signature and the aud and nonce claims of a
+// key proof
+func verifyProof(proof, audience, nonce string) error {
+	parts := strings.Split(proof, ".")
+	if len(parts) != 3 {
+		return errors.New("not a compact JWS")
+	}
+
+	var header struct {
+		Typ string            `json:"typ"`
+		JWK map[string]string `json:"jwk"`
+	}
+	var claims struct {
+		Aud   string `json:"aud"`
+		Nonce string `json:"nonce"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return err
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return err
+	}
+	if header.Typ != "openid4vci-proof+jwt" || claims.Aud != audience || claims.Nonce != nonce {
+		return errors.New("unexpected header or claims")
+	}
+
+	x, _ := base64.RawURLEncoding.DecodeString(header.JWK["x"])
+	y, _ := base64.RawURLEncoding.DecodeString(header.JWK["y"])
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if len(sig) != 64 || !ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func offerURI(t *testing.T, offer *CredentialOffer) string {
+	t.Helper()
+	offerJSON, err := json.Marshal(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "openid-credential-offer://?credential_offer=" + url.QueryEscape(string(offerJSON))
+}
+
+func TestPreAuthorizedCodeFlow(t *testing.T) {
+	server := mockIssuer(t)
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{HTTPClient: server.Client()}
+	ctx := context.Background()
+
+	session, err := client.ResolveOffer(ctx, offerURI(t, &CredentialOffer{
+		CredentialIssuer:           server.URL,
+		CredentialConfigurationIDs: []string{"pid"},
+		Grants: Grants{PreAuthorizedCode: &PreAuthorizedCodeGrant{
+			PreAuthorizedCode: "code-1",
+			TxCode:            &TxCode{InputMode: "numeric", Length: 4},
+		}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.PreAuthorizedToken(ctx, session, ""); err == nil {
+		t.Fatal("expected an error without the transaction code")
+	}
+	if err := client.PreAuthorizedToken(ctx, session, "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.RequestCredential(ctx, session, "pid", &JWTProofBuilder{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Credentials) != 1 {
+		t.Fatalf("expected one credential, got %d", len(res.Credentials))
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	server := mockIssuer(t)
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{HTTPClient: server.Client(), ClientID: "wallet", RedirectURI: "https://wallet.example/cb"}
+	ctx := context.Background()
+
+	session, err := client.ResolveOffer(ctx, offerURI(t, &CredentialOffer{
+		CredentialIssuer:           server.URL,
+		CredentialConfigurationIDs: []string{"pid"},
+		Grants:                     Grants{AuthorizationCode: &AuthorizationCodeGrant{IssuerState: "state-1"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, state, err := client.AuthorizationURL(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("state") != state || query.Get("issuer_state") != "state-1" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	if err := client.ExchangeCode(ctx, session, "auth-code"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.RequestCredential(ctx, session, "pid", &JWTProofBuilder{Key: key, ClientID: "wallet"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,112 @@
+package openid4vci
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mynextid/eudi-zk/wallet"
+)
+
+// ProofTypeJWT is the proof type of JWT key proofs
+const ProofTypeJWT = "jwt"
+
+// ProofBuilder builds the key proof sent with a credential request. The proof
+// binds the credential to the holder key: audience is the credential issuer
+// and nonce the c_nonce of the issuer (empty when the issuer has no nonce
+// endpoint).
+//
+// JWTProofBuilder implements the jwt proof type; a zk proof of possession of
+// the certificate key (e.g. cdl.CircuitPoP) can be sent by implementing
+// ProofBuilder with the proof type accepted by the issuer. The zk proof signs
+// the nonce in the issuance signing context (CircuitPoP SigningContext
+// common.SigningContextIssuance, wallet.ContextSigner), never in the context
+// of the presentation challenges.
+type ProofBuilder interface {
+	ProofType() string
+	BuildProof(ctx context.Context, audience, nonce string) (string, error)
+}
+
+// JWTProofBuilder signs openid4vci-proof+jwt key proofs with an ES256 key
+type JWTProofBuilder struct {
+	// Handle is the holder key, e.g. a wallet.SoftwareKey or a
+	// wallet.DeviceKey; Key is used when nil
+	Handle wallet.KeyHandle
+	Key    *ecdsa.PrivateKey
+	// ClientID is set as iss of the proof (omitted when empty, e.g. for
+	// anonymous pre-authorized code flows)
+	ClientID string
+}
+
+// ProofType implements ProofBuilder
+func (b *JWTProofBuilder) ProofType() string {
+	return ProofTypeJWT
+}
+
+// BuildProof implements ProofBuilder
+func (b *JWTProofBuilder) BuildProof(ctx context.Context, audience, nonce string) (string, error) {
+	var signer wallet.ChallengeSigner
+	var public *ecdsa.PublicKey
+	switch {
+	case b.Handle != nil:
+		signer, public = b.Handle, b.Handle.Public()
+	case b.Key != nil:
+		signer, public = wallet.KeySigner{Key: b.Key}, &b.Key.PublicKey
+	}
+	if public == nil || public.Curve != elliptic.P256() {
+		return "", fmt.Errorf("an ES256 (P-256) key is required")
+	}
+
+	header := map[string]any{
+		"typ": "openid4vci-proof+jwt",
+		"alg": "ES256",
+		"jwk": publicJWK(public),
+	}
+
+	claims := map[string]any{
+		"aud": audience,
+		"iat": time.Now().Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if b.ClientID != "" {
+		claims["iss"] = b.ClientID
+	}
+
+	return signES256(ctx, signer, header, claims)
+}
+
+// publicJWK returns the JWK of a P-256 public key
+func publicJWK(key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// signES256 creates a compact JWS of the claims
+func signES256(ctx context.Context, key wallet.ChallengeSigner, header, claims map[string]any) (string, error) {
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	// the ES256 signature of the signing input, as of a challenge
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	signature, err := key.SignChallenge(ctx, []byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign the proof: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature.Bytes()), nil
+}
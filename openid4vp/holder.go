@@ -0,0 +1,336 @@
+// Package openid4vp is a holder-side component for OpenID for Verifiable
+// Presentations: it parses authorization requests, derives the in-circuit
+// challenge from the nonce and the client_id, builds the vp_token with the
+// zk presentations of a PresentationBuilder and posts the response.
+package openid4vp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AuthorizationRequest is the subset of an OpenID4VP authorization request
+// used by the holder. Exactly one of DCQLQuery and PresentationDefinition is
+// set.
+type AuthorizationRequest struct {
+	ClientID               string                  `json:"client_id"`
+	ResponseType           string                  `json:"response_type"`
+	ResponseMode           string                  `json:"response_mode,omitempty"`
+	ResponseURI            string                  `json:"response_uri,omitempty"`
+	Nonce                  string                  `json:"nonce"`
+	State                  string                  `json:"state,omitempty"`
+	DCQLQuery              *DCQLQuery              `json:"dcql_query,omitempty"`
+	PresentationDefinition *PresentationDefinition `json:"presentation_definition,omitempty"`
+}
+
+// DCQLQuery is a Digital Credentials Query Language query
+type DCQLQuery struct {
+	Credentials []CredentialQuery `json:"credentials"`
+}
+
+// CredentialQuery is one credential requested by a DCQL query
+type CredentialQuery struct {
+	ID     string          `json:"id"`
+	Format string          `json:"format"`
+	Meta   json.RawMessage `json:"meta,omitempty"`
+	Claims json.RawMessage `json:"claims,omitempty"`
+}
+
+// PresentationDefinition is a DIF Presentation Exchange definition
+type PresentationDefinition struct {
+	ID               string            `json:"id"`
+	InputDescriptors []InputDescriptor `json:"input_descriptors"`
+}
+
+// InputDescriptor is one credential requested by a presentation definition
+type InputDescriptor struct {
+	ID          string          `json:"id"`
+	Format      json.RawMessage `json:"format,omitempty"`
+	Constraints json.RawMessage `json:"constraints,omitempty"`
+}
+
+// Query is the credential query a presentation is built for: ID is the DCQL
+// credential query id or the input descriptor id, Query the raw query
+type Query struct {
+	ID    string
+	Query json.RawMessage
+}
+
+// Presentation is a presentation built for a query, Format is its format
+// identifier (e.g. the format of the zk presentation) and Value the
+// presentation as sent in the vp_token
+type Presentation struct {
+	Format string
+	Value  string
+}
+
+// PresentationBuilder builds the presentation for a query. challenge is the
+// value to prove in-circuit (see Challenge).
+type PresentationBuilder interface {
+	BuildPresentation(ctx context.Context, query Query, challenge []byte) (*Presentation, error)
+}
+
+// Challenge derives the in-circuit challenge from the nonce and the client_id
+// of the authorization request:
+//
+//	SHA-256(len(client_id) (2 bytes, big-endian) || client_id || nonce)
+//
+// so a presentation can neither be replayed (nonce) nor forwarded to another
+// verifier (client_id). The 32 bytes match the challenge of the PoP circuits.
+func Challenge(clientID, nonce string) []byte {
+	h := sha256.New()
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(clientID))))
+	h.Write([]byte(clientID))
+	h.Write([]byte(nonce))
+	return h.Sum(nil)
+}
+
+// Holder answers OpenID4VP authorization requests
+type Holder struct {
+	HTTPClient *http.Client
+	Builder    PresentationBuilder
+
+	// VerifyRequestObject verifies a signed request object (request_uri) and
+	// returns its JSON payload. Requests by reference are rejected when nil.
+	VerifyRequestObject func(ctx context.Context, clientID, requestObject string) ([]byte, error)
+}
+
+// Response is the authorization response of the holder
+type Response struct {
+	VPToken                string
+	PresentationSubmission string
+	State                  string
+}
+
+// ParseRequest parses an authorization request URI (openid4vp://?... with the
+// parameters by value, or with request_uri)
+func (h *Holder) ParseRequest(ctx context.Context, requestURI string) (*AuthorizationRequest, error) {
+	u, err := url.Parse(requestURI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization request: %w", err)
+	}
+	query := u.Query()
+
+	req := &AuthorizationRequest{}
+	if requestObjectURI := query.Get("request_uri"); requestObjectURI != "" {
+		if h.VerifyRequestObject == nil {
+			return nil, fmt.Errorf("request_uri is not supported without request object verification")
+		}
+
+		requestObject, err := h.get(ctx, requestObjectURI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the request object: %w", err)
+		}
+		payload, err := h.VerifyRequestObject(ctx, query.Get("client_id"), strings.TrimSpace(string(requestObject)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid request object: %w", err)
+		}
+		if err := json.Unmarshal(payload, req); err != nil {
+			return nil, fmt.Errorf("invalid request object: %w", err)
+		}
+		if req.ClientID != query.Get("client_id") {
+			return nil, fmt.Errorf("request object client_id %q does not match %q", req.ClientID, query.Get("client_id"))
+		}
+	} else {
+		req.ClientID = query.Get("client_id")
+		req.ResponseType = query.Get("response_type")
+		req.ResponseMode = query.Get("response_mode")
+		req.ResponseURI = query.Get("response_uri")
+		req.Nonce = query.Get("nonce")
+		req.State = query.Get("state")
+		if dcql := query.Get("dcql_query"); dcql != "" {
+			req.DCQLQuery = &DCQLQuery{}
+			if err := json.Unmarshal([]byte(dcql), req.DCQLQuery); err != nil {
+				return nil, fmt.Errorf("invalid dcql_query: %w", err)
+			}
+		}
+		if pd := query.Get("presentation_definition"); pd != "" {
+			req.PresentationDefinition = &PresentationDefinition{}
+			if err := json.Unmarshal([]byte(pd), req.PresentationDefinition); err != nil {
+				return nil, fmt.Errorf("invalid presentation_definition: %w", err)
+			}
+		}
+	}
+
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (req *AuthorizationRequest) validate() error {
+	switch {
+	case req.ClientID == "":
+		return fmt.Errorf("missing client_id")
+	case req.ResponseType != "vp_token":
+		return fmt.Errorf("unsupported response_type %q", req.ResponseType)
+	case req.Nonce == "":
+		return fmt.Errorf("missing nonce")
+	case (req.DCQLQuery == nil) == (req.PresentationDefinition == nil):
+		return fmt.Errorf("exactly one of dcql_query and presentation_definition is required")
+	case req.ResponseMode == "direct_post" && req.ResponseURI == "":
+		return fmt.Errorf("missing response_uri")
+	}
+	return nil
+}
+
+// BuildResponse builds the presentations for every requested credential and
+// the vp_token. With DCQL the vp_token is a JSON object mapping the credential
+// query ids to their presentations; with Presentation Exchange it is the
+// presentation (or an array of them) with a presentation_submission.
+func (h *Holder) BuildResponse(ctx context.Context, req *AuthorizationRequest) (*Response, error) {
+	challenge := Challenge(req.ClientID, req.Nonce)
+	res := &Response{State: req.State}
+
+	if req.DCQLQuery != nil {
+		vpToken := make(map[string][]string, len(req.DCQLQuery.Credentials))
+		for _, cq := range req.DCQLQuery.Credentials {
+			raw, err := json.Marshal(cq)
+			if err != nil {
+				return nil, err
+			}
+			p, err := h.Builder.BuildPresentation(ctx, Query{ID: cq.ID, Query: raw}, challenge)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build the presentation of %q: %w", cq.ID, err)
+			}
+			vpToken[cq.ID] = append(vpToken[cq.ID], p.Value)
+		}
+
+		vpTokenJSON, err := json.Marshal(vpToken)
+		if err != nil {
+			return nil, err
+		}
+		res.VPToken = string(vpTokenJSON)
+		return res, nil
+	}
+
+	pd := req.PresentationDefinition
+	presentations := make([]string, len(pd.InputDescriptors))
+	descriptors := make([]map[string]string, len(pd.InputDescriptors))
+	for i, d := range pd.InputDescriptors {
+		raw, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		p, err := h.Builder.BuildPresentation(ctx, Query{ID: d.ID, Query: raw}, challenge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build the presentation of %q: %w", d.ID, err)
+		}
+
+		path := "$"
+		if len(pd.InputDescriptors) > 1 {
+			path = fmt.Sprintf("$[%d]", i)
+		}
+		presentations[i] = p.Value
+		descriptors[i] = map[string]string{"id": d.ID, "format": p.Format, "path": path}
+	}
+
+	if len(presentations) == 1 {
+		res.VPToken = presentations[0]
+	} else {
+		vpTokenJSON, err := json.Marshal(presentations)
+		if err != nil {
+			return nil, err
+		}
+		res.VPToken = string(vpTokenJSON)
+	}
+
+	submission, err := json.Marshal(map[string]any{
+		"id":             "submission-" + pd.ID,
+		"definition_id":  pd.ID,
+		"descriptor_map": descriptors,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.PresentationSubmission = string(submission)
+
+	return res, nil
+}
+
+// PostResponse posts the response to the response_uri (response mode
+// direct_post) and returns the redirect_uri of the verifier, if any
+func (h *Holder) PostResponse(ctx context.Context, req *AuthorizationRequest, res *Response) (string, error) {
+	if req.ResponseMode != "direct_post" {
+		return "", fmt.Errorf("unsupported response_mode %q", req.ResponseMode)
+	}
+
+	form := url.Values{"vp_token": {res.VPToken}}
+	if res.PresentationSubmission != "" {
+		form.Set("presentation_submission", res.PresentationSubmission)
+	}
+	if res.State != "" {
+		form.Set("state", res.State)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.ResponseURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := h.do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("authorization response failed: %w", err)
+	}
+
+	var redirect struct {
+		RedirectURI string `json:"redirect_uri"`
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &redirect); err != nil {
+			return "", fmt.Errorf("invalid response of the verifier: %w", err)
+		}
+	}
+	return redirect.RedirectURI, nil
+}
+
+// Respond parses the request, builds the response and posts it
+func (h *Holder) Respond(ctx context.Context, requestURI string) (string, error) {
+	req, err := h.ParseRequest(ctx, requestURI)
+	if err != nil {
+		return "", err
+	}
+	res, err := h.BuildResponse(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return h.PostResponse(ctx, req, res)
+}
+
+func (h *Holder) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return h.do(req)
+}
+
+func (h *Holder) do(req *http.Request) ([]byte, error) {
+	httpClient := h.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
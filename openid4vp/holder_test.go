@@ -0,0 +1,126 @@
+package openid4vp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// mockBuilder returns the hex encoded challenge as presentation
+type mockBuilder struct{}
+
+func (mockBuilder) BuildPresentation(ctx context.Context, query Query, challenge []byte) (*Presentation, error) {
+	return &Presentation{Format: "zkp", Value: query.ID + "." + hex.EncodeToString(challenge)}, nil
+}
+
+func TestChallenge(t *testing.T) {
+	c := Challenge("verifier.example", "n-0S6_WzA2Mj")
+	if len(c) != 32 {
+		t.Fatalf("expected 32 bytes, got %d", len(c))
+	}
+	if !bytes.Equal(c, Challenge("verifier.example", "n-0S6_WzA2Mj")) {
+		t.Fatal("challenge is not deterministic")
+	}
+	// the client_id length prefix separates client_id and nonce
+	if bytes.Equal(Challenge("ab", "c"), Challenge("a", "bc")) {
+		t.Fatal("ambiguous challenge encoding")
+	}
+}
+
+func TestRespondDCQL(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"redirect_uri":"https://verifier.example/done"}`))
+	}))
+	defer server.Close()
+
+	dcql := `{"credentials":[{"id":"pid","format":"dc+sd-jwt"}]}`
+	requestURI := "openid4vp://?" + url.Values{
+		"client_id":     {"verifier.example"},
+		"response_type": {"vp_token"},
+		"response_mode": {"direct_post"},
+		"response_uri":  {server.URL},
+		"nonce":         {"nonce-1"},
+		"state":         {"state-1"},
+		"dcql_query":    {dcql},
+	}.Encode()
+
+	holder := &Holder{HTTPClient: server.Client(), Builder: mockBuilder{}}
+	redirectURI, err := holder.Respond(context.Background(), requestURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirectURI != "https://verifier.example/done" {
+		t.Fatalf("unexpected redirect_uri %q", redirectURI)
+	}
+
+	var vpToken map[string][]string
+	if err := json.Unmarshal([]byte(form.Get("vp_token")), &vpToken); err != nil {
+		t.Fatal(err)
+	}
+	expected := "pid." + hex.EncodeToString(Challenge("verifier.example", "nonce-1"))
+	if len(vpToken["pid"]) != 1 || vpToken["pid"][0] != expected {
+		t.Fatalf("unexpected vp_token %v", vpToken)
+	}
+	if form.Get("state") != "state-1" {
+		t.Fatalf("unexpected state %q", form.Get("state"))
+	}
+}
+
+func TestBuildResponsePresentationExchange(t *testing.T) {
+	req := &AuthorizationRequest{
+		ClientID:     "verifier.example",
+		ResponseType: "vp_token",
+		Nonce:        "nonce-1",
+		PresentationDefinition: &PresentationDefinition{
+			ID:               "pd-1",
+			InputDescriptors: []InputDescriptor{{ID: "pid"}, {ID: "mdl"}},
+		},
+	}
+
+	holder := &Holder{Builder: mockBuilder{}}
+	res, err := holder.BuildResponse(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vpToken []string
+	if err := json.Unmarshal([]byte(res.VPToken), &vpToken); err != nil || len(vpToken) != 2 {
+		t.Fatalf("unexpected vp_token %q", res.VPToken)
+	}
+
+	var submission struct {
+		DefinitionID  string              `json:"definition_id"`
+		DescriptorMap []map[string]string `json:"descriptor_map"`
+	}
+	if err := json.Unmarshal([]byte(res.PresentationSubmission), &submission); err != nil {
+		t.Fatal(err)
+	}
+	if submission.DefinitionID != "pd-1" || submission.DescriptorMap[1]["path"] != "$[1]" {
+		t.Fatalf("unexpected presentation_submission %s", res.PresentationSubmission)
+	}
+}
+
+func TestParseRequestInvalid(t *testing.T) {
+	holder := &Holder{Builder: mockBuilder{}}
+	for _, requestURI := range []string{
+		// no nonce
+		"openid4vp://?client_id=v&response_type=vp_token&dcql_query=%7B%7D",
+		// no query
+		"openid4vp://?client_id=v&response_type=vp_token&nonce=n",
+		// request by reference without request object verification
+		"openid4vp://?client_id=v&request_uri=https%3A%2F%2Fv.example%2Frequest",
+	} {
+		if _, err := holder.ParseRequest(context.Background(), requestURI); err == nil {
+			t.Errorf("expected an error for %s", requestURI)
+		}
+	}
+}
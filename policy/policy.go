@@ -0,0 +1,489 @@
+// Package policy evaluates declarative verification policies: the circuits a
+// verifier accepts, the predicates (attributes) a presentation must prove,
+// the trust anchors its public inputs must name, its maximum age and the
+// nonce rules. A policy is a YAML or JSON document:
+//
+//	version: "2026-10"
+//	circuits: [eudi-vc/eudi/v1, eudi-vc/pop/v1]
+//	predicates:
+//	  - name: age_over_18
+//	    value: "true"
+//	trust_anchors:
+//	  - input: CAPubKey
+//	    keys: [anchors/qtsp.pem]
+//	    federation:
+//	      entities: [https://pid-provider.example]
+//	      trust_marks: [https://trust.example/pid-provider]
+//	max_proof_age: 5m
+//	nonce:
+//	  required: true
+//	  audience: https://verifier.example
+//
+// It is loaded by zkpi (presentation verify --policy, policy test) and by the
+// server (Config.Policy), and evaluated on the result of a successful
+// verification (models.VerificationResult).
+package policy
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/mynextid/eudi-zk/federation"
+	"github.com/mynextid/eudi-zk/models"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrViolation is wrapped by the errors of Evaluate
+var ErrViolation = errors.New("policy violation")
+
+// Rules of the policy, the Rule of a Violation
+const (
+	RuleCircuits     = "circuits"
+	RulePredicates   = "predicates"
+	RuleTrustAnchors = "trust_anchors"
+	RuleMaxProofAge  = "max_proof_age"
+	RuleNonce        = "nonce"
+)
+
+// Violation is a presentation that does not satisfy a rule of the policy
+type Violation struct {
+	Rule   string
+	Detail string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrViolation, v.Rule, v.Detail)
+}
+
+func (v *Violation) Unwrap() error {
+	return ErrViolation
+}
+
+func violation(rule, format string, args ...any) *Violation {
+	return &Violation{Rule: rule, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Policy is a verification policy document. A zero rule does not restrict
+// the presentations.
+type Policy struct {
+	// Version identifies the policy, e.g. in the audit logs
+	Version string `yaml:"version" json:"version"`
+	// Circuits are the accepted circuit ids, any registered circuit when empty
+	Circuits []string `yaml:"circuits,omitempty" json:"circuits,omitempty"`
+	// Predicates are the attributes the presentation must prove
+	// (models.PublicInputs.Attributes)
+	Predicates []Predicate `yaml:"predicates,omitempty" json:"predicates,omitempty"`
+	// TrustAnchors are the accepted keys of public key inputs of the circuits
+	TrustAnchors []TrustAnchor `yaml:"trust_anchors,omitempty" json:"trust_anchors,omitempty"`
+	// MaxProofAge bounds the age of the presentation (its iat)
+	MaxProofAge Duration `yaml:"max_proof_age,omitempty" json:"max_proof_age,omitempty"`
+	// Nonce are the nonce rules, optional
+	Nonce *NonceRule `yaml:"nonce,omitempty" json:"nonce,omitempty"`
+
+	// dir resolves the key files of the trust anchors
+	dir string
+	// anchors are the keys of TrustAnchors, by input
+	anchors map[string][]*ecdsa.PublicKey
+}
+
+// Predicate is an attribute the presentation must prove, with the given
+// value when set
+type Predicate struct {
+	Name  string `yaml:"name" json:"name"`
+	Value string `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+// TrustAnchor lists the accepted P-256 keys of a public key input of the
+// circuits (the emulated coordinates <Input>X and <Input>Y, e.g. CAPubKey)
+type TrustAnchor struct {
+	Input string `yaml:"input" json:"input"`
+	// Keys are PEM files (public key or certificate), relative to the policy
+	Keys []string `yaml:"keys,omitempty" json:"keys,omitempty"`
+	// Federation accepts the keys of OpenID Federation entities as well,
+	// resolved by Evaluator.Federation
+	Federation *FederationAnchor `yaml:"federation,omitempty" json:"federation,omitempty"`
+}
+
+// FederationAnchor accepts the keys of OpenID Federation entities with a
+// valid trust chain
+type FederationAnchor struct {
+	// Entities are the entity ids of the accepted entities
+	Entities []string `yaml:"entities" json:"entities"`
+	// EntityType is the metadata of the entities the keys are read from,
+	// openid_credential_issuer when empty
+	EntityType string `yaml:"entity_type,omitempty" json:"entity_type,omitempty"`
+	// TrustMarks are the trust mark types the entities must have
+	TrustMarks []string `yaml:"trust_marks,omitempty" json:"trust_marks,omitempty"`
+}
+
+// NonceRule are the nonce rules of a policy
+type NonceRule struct {
+	// Required rejects presentations without nonce
+	Required bool `yaml:"required,omitempty" json:"required,omitempty"`
+	// Audience is the expected aud of the presentations, any when empty
+	Audience string `yaml:"audience,omitempty" json:"audience,omitempty"`
+}
+
+// Duration is a duration of a policy, a Go duration string ("5m", "24h")
+type Duration time.Duration
+
+// UnmarshalYAML decodes a duration string, numbers are rejected as their
+// unit would be ambiguous
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+		return fmt.Errorf("line %d: duration must be a string such as \"5m\"", node.Line)
+	}
+	v, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText encodes the duration string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Load reads the policy file at path, see Parse
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes a YAML or JSON policy, validates it and reads the keys of the
+// trust anchors relative to dir. Unknown members are rejected.
+func Parse(data []byte, dir string) (*Policy, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	p := &Policy{dir: dir}
+	if err := dec.Decode(p); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks the policy against its schema and reads the keys of the
+// trust anchors
+func (p *Policy) Validate() error {
+	if p.Version == "" {
+		return fmt.Errorf("version is required")
+	}
+	for i, c := range p.Circuits {
+		if c == "" || slices.Contains(p.Circuits[:i], c) {
+			return fmt.Errorf("circuits: invalid or duplicate circuit %q", c)
+		}
+	}
+	for i, pred := range p.Predicates {
+		if pred.Name == "" {
+			return fmt.Errorf("predicates[%d]: name is required", i)
+		}
+	}
+	if p.MaxProofAge < 0 {
+		return fmt.Errorf("max_proof_age: negative duration")
+	}
+
+	p.anchors = map[string][]*ecdsa.PublicKey{}
+	for i, a := range p.TrustAnchors {
+		if a.Input == "" || len(a.Keys) == 0 && a.Federation == nil {
+			return fmt.Errorf("trust_anchors[%d]: input and keys or federation are required", i)
+		}
+		if a.Federation != nil && len(a.Federation.Entities) == 0 {
+			return fmt.Errorf("trust_anchors[%d]: federation: entities are required", i)
+		}
+		if _, ok := p.anchors[a.Input]; ok {
+			return fmt.Errorf("trust_anchors[%d]: duplicate input %q", i, a.Input)
+		}
+		for _, file := range a.Keys {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(p.dir, file)
+			}
+			key, err := readP256Key(file)
+			if err != nil {
+				return fmt.Errorf("trust_anchors[%d]: %w", i, err)
+			}
+			p.anchors[a.Input] = append(p.anchors[a.Input], key)
+		}
+	}
+	return nil
+}
+
+// readP256Key reads a PEM public key or certificate with a P-256 key
+func readP256Key(path string) (*ecdsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	var key any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		key = cert.PublicKey
+	default:
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: not a P-256 key", path)
+	}
+	return ecKey, nil
+}
+
+// Options are the request context of an evaluation
+type Options struct {
+	// Context bounds the resolution of the federation trust anchors,
+	// context.Background when nil
+	Context context.Context
+	// Now is the time the proof age is checked at, time.Now when zero
+	Now time.Time
+	// Nonce is the nonce the verifier issued for the request, not checked
+	// when empty
+	Nonce string
+}
+
+// Evaluator evaluates a policy on the presentations of a set of circuits
+type Evaluator struct {
+	Policy *Policy
+	// Federation resolves the entities of the federation trust anchors, which
+	// fail without it
+	Federation *federation.Client
+	// inputs are the indexes of the limbs of the trust anchor inputs in the
+	// public witness, by circuit and input
+	inputs map[string]map[string]anchorInput
+}
+
+// anchorInput are the indexes of the limbs of the coordinates of a public
+// key input
+type anchorInput struct {
+	nbPublic int
+	x, y     []int
+}
+
+// NewEvaluator returns the evaluator of the policy. The templates are the
+// circuits the verifier registered, by circuit id, the sized templates they
+// were compiled with; they are only needed by the trust anchors, a circuit
+// without template or without the anchor input fails them.
+func NewEvaluator(p *Policy, templates map[string]frontend.Circuit) (*Evaluator, error) {
+	e := &Evaluator{Policy: p, inputs: map[string]map[string]anchorInput{}}
+	if len(p.TrustAnchors) == 0 {
+		return e, nil
+	}
+	for id, circuit := range templates {
+		inputs, err := locateInputs(circuit, p.TrustAnchors)
+		if err != nil {
+			return nil, fmt.Errorf("circuit %q: %w", id, err)
+		}
+		e.inputs[id] = inputs
+	}
+	return e, nil
+}
+
+// locateInputs finds the limbs of the trust anchor inputs among the public
+// inputs of the circuit
+func locateInputs(circuit frontend.Circuit, anchors []TrustAnchor) (map[string]anchorInput, error) {
+	inputs := map[string]anchorInput{}
+	nbPublic := 0
+	_, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		if leaf.Visibility != schema.Public {
+			return nil
+		}
+		name := leaf.FullName()
+		for _, a := range anchors {
+			in := inputs[a.Input]
+			switch {
+			case strings.HasPrefix(name, a.Input+"X_Limbs_"):
+				in.x = append(in.x, nbPublic)
+			case strings.HasPrefix(name, a.Input+"Y_Limbs_"):
+				in.y = append(in.y, nbPublic)
+			default:
+				continue
+			}
+			inputs[a.Input] = in
+		}
+		nbPublic++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, in := range inputs {
+		in.nbPublic = nbPublic
+		inputs[name] = in
+	}
+	return inputs, nil
+}
+
+// Evaluate checks a verified presentation against the policy; the first
+// failing rule is returned as a *Violation
+func (e *Evaluator) Evaluate(res *models.VerificationResult, opts Options) error {
+	p := e.Policy
+	if len(p.Circuits) > 0 && !slices.Contains(p.Circuits, res.Circuit) {
+		return violation(RuleCircuits, "circuit %q is not accepted", res.Circuit)
+	}
+
+	for _, pred := range p.Predicates {
+		digest, ok := res.PublicInputs.Attributes[pred.Name]
+		if !ok {
+			return violation(RulePredicates, "%q is not proven", pred.Name)
+		}
+		if pred.Value != "" && !digest.Matches(pred.Value) {
+			return violation(RulePredicates, "%q is not %q", pred.Name, pred.Value)
+		}
+	}
+
+	if len(p.TrustAnchors) > 0 {
+		if res.Presentation == nil {
+			return violation(RuleTrustAnchors, "no public witness")
+		}
+		ctx := opts.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		for _, a := range p.TrustAnchors {
+			if err := e.checkAnchor(ctx, res.Circuit, a, res.Presentation.Payload.PublicWitness); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.MaxProofAge > 0 {
+		if res.Presentation == nil {
+			return violation(RuleMaxProofAge, "raw proofs have no issuance time")
+		}
+		now := opts.Now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		age := now.Sub(time.Unix(res.Presentation.Payload.IssuedAt, 0))
+		if age > time.Duration(p.MaxProofAge) {
+			return violation(RuleMaxProofAge, "presentation issued %s ago, more than %s", age.Round(time.Second), time.Duration(p.MaxProofAge))
+		}
+	}
+
+	if p.Nonce != nil {
+		if res.Presentation == nil {
+			return violation(RuleNonce, "raw proofs have no nonce")
+		}
+		payload := res.Presentation.Payload
+		switch {
+		case p.Nonce.Required && payload.Nonce == "":
+			return violation(RuleNonce, "presentation without nonce")
+		case opts.Nonce != "" && payload.Nonce != opts.Nonce:
+			return violation(RuleNonce, "nonce does not match the request")
+		case p.Nonce.Audience != "" && payload.Audience != p.Nonce.Audience:
+			return violation(RuleNonce, "audience %q, expected %q", payload.Audience, p.Nonce.Audience)
+		}
+	}
+	return nil
+}
+
+// checkAnchor checks that the public key input of the public witness is one
+// of the anchor keys
+func (e *Evaluator) checkAnchor(ctx context.Context, circuit string, a TrustAnchor, publicWitness []byte) error {
+	input := a.Input
+	in, ok := e.inputs[circuit][input]
+	if !ok || len(in.x) == 0 || len(in.x) != len(in.y) {
+		return violation(RuleTrustAnchors, "circuit %q has no public %s", circuit, input)
+	}
+	values, err := models.PublicValues(publicWitness, in.nbPublic)
+	if err != nil {
+		return violation(RuleTrustAnchors, "%v", err)
+	}
+	x, y := limbsValue(values, in.x), limbsValue(values, in.y)
+	for _, key := range e.Policy.anchors[input] {
+		if key.X.Cmp(x) == 0 && key.Y.Cmp(y) == 0 {
+			return nil
+		}
+	}
+	if a.Federation != nil {
+		return e.checkFederation(ctx, a, x, y)
+	}
+	return violation(RuleTrustAnchors, "%s is not a trust anchor", input)
+}
+
+// checkFederation checks that the key is a key of an entity of the
+// federation anchor with a valid trust chain and the trust marks
+func (e *Evaluator) checkFederation(ctx context.Context, a TrustAnchor, x, y *big.Int) error {
+	if e.Federation == nil {
+		return violation(RuleTrustAnchors, "no federation client for %s", a.Input)
+	}
+	entityType := a.Federation.EntityType
+	if entityType == "" {
+		entityType = federation.EntityTypeCredentialIssuer
+	}
+	var errs []error
+	for _, id := range a.Federation.Entities {
+		entity, err := e.Federation.Resolve(ctx, id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		keys, err := entity.Keys(entityType)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !slices.ContainsFunc(keys, func(key *ecdsa.PublicKey) bool { return key.X.Cmp(x) == 0 && key.Y.Cmp(y) == 0 }) {
+			continue
+		}
+		for _, mark := range a.Federation.TrustMarks {
+			if !entity.HasTrustMark(mark) {
+				return violation(RuleTrustAnchors, "entity %q of %s has no trust mark %q", id, a.Input, mark)
+			}
+		}
+		return nil
+	}
+	if len(errs) > 0 {
+		return violation(RuleTrustAnchors, "%s is not a trust anchor: %v", a.Input, errors.Join(errs...))
+	}
+	return violation(RuleTrustAnchors, "%s is not a trust anchor", a.Input)
+}
+
+// limbsValue returns the value of the emulated element of the limbs at
+// indexes, least significant first
+func limbsValue(values []*big.Int, indexes []int) *big.Int {
+	bits := emulated.P256Fp{}.BitsPerLimb()
+	v := new(big.Int)
+	for i := len(indexes) - 1; i >= 0; i-- {
+		v.Lsh(v, bits)
+		v.Add(v, values[indexes[i]])
+	}
+	return v
+}
@@ -0,0 +1,205 @@
+package policy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/mynextid/eudi-zk/federation"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// anchoredCircuit has a public CA key
+type anchoredCircuit struct {
+	X         frontend.Variable
+	CAPubKeyX emulated.Element[emulated.P256Fp] `gnark:",public"`
+	CAPubKeyY emulated.Element[emulated.P256Fp] `gnark:",public"`
+}
+
+func (c *anchoredCircuit) Define(api frontend.API) error {
+	return nil
+}
+
+const testPolicy = `
+version: "2026-10"
+circuits: [anchored/v1]
+predicates:
+  - name: age_over_18
+    value: "true"
+trust_anchors:
+  - input: CAPubKey
+    keys: [qtsp.pem]
+max_proof_age: 5m
+nonce:
+  required: true
+  audience: https://verifier.example
+`
+
+func TestPolicy(t *testing.T) {
+	dir := t.TempDir()
+	anchor, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&anchor.PublicKey)
+	os.WriteFile(filepath.Join(dir, "qtsp.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644)
+
+	p, err := Parse([]byte(testPolicy), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(p.MaxProofAge) != 5*time.Minute || !p.Nonce.Required {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+	e, err := NewEvaluator(p, map[string]frontend.Circuit{"anchored/v1": &anchoredCircuit{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	witnessOf := func(key *ecdsa.PublicKey) []byte {
+		w, err := frontend.NewWitness(&anchoredCircuit{
+			X:         1,
+			CAPubKeyX: emulated.ValueOf[emulated.P256Fp](key.X),
+			CAPubKeyY: emulated.ValueOf[emulated.P256Fp](key.Y),
+		}, ecc.BN254.ScalarField(), frontend.PublicOnly())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := w.MarshalBinary()
+		return data
+	}
+	now := time.Now()
+	result := func() *models.VerificationResult {
+		return &models.VerificationResult{
+			Circuit: "anchored/v1",
+			Presentation: &models.ZkPresentation{Payload: models.PresentationPayload{
+				Audience:      "https://verifier.example",
+				Nonce:         "n-1",
+				IssuedAt:      now.Add(-time.Minute).Unix(),
+				PublicWitness: witnessOf(&anchor.PublicKey),
+			}},
+			PublicInputs: models.PublicInputs{Attributes: map[string]models.AttributeDigest{"age_over_18": models.NewAttributeDigest("true")}},
+		}
+	}
+	if err := e.Evaluate(result(), Options{Now: now, Nonce: "n-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	violations := map[string]func(r *models.VerificationResult) Options{
+		RuleCircuits: func(r *models.VerificationResult) Options {
+			r.Circuit = "other/v1"
+			return Options{Now: now}
+		},
+		RulePredicates: func(r *models.VerificationResult) Options {
+			r.PublicInputs.Attributes["age_over_18"] = models.NewAttributeDigest("false")
+			return Options{Now: now}
+		},
+		RuleTrustAnchors: func(r *models.VerificationResult) Options {
+			r.Presentation.Payload.PublicWitness = witnessOf(&other.PublicKey)
+			return Options{Now: now}
+		},
+		RuleMaxProofAge: func(r *models.VerificationResult) Options {
+			return Options{Now: now.Add(10 * time.Minute)}
+		},
+		RuleNonce: func(r *models.VerificationResult) Options {
+			return Options{Now: now, Nonce: "n-2"}
+		},
+	}
+	for rule, modify := range violations {
+		r := result()
+		err := e.Evaluate(r, modify(r))
+		var v *Violation
+		if !errors.As(err, &v) || v.Rule != rule || !errors.Is(err, ErrViolation) {
+			t.Errorf("%s: expected a violation, got %v", rule, err)
+		}
+	}
+
+	// schema validation
+	invalid := map[string]string{
+		"unknown member":   "version: v1\nmax_age: 5m\n",
+		"no version":       "circuits: [a]\n",
+		"numeric duration": "version: v1\nmax_proof_age: 300\n",
+		"missing key file": "version: v1\ntrust_anchors:\n  - input: CAPubKey\n    keys: [missing.pem]\n",
+	}
+	for name, doc := range invalid {
+		if _, err := Parse([]byte(doc), dir); err == nil {
+			t.Errorf("%s: expected an invalid policy", name)
+		}
+	}
+
+	// JSON documents
+	if _, err := Parse([]byte(`{"version": "v1", "circuits": ["anchored/v1"], "max_proof_age": "1h"}`), dir); err != nil {
+		t.Fatalf("JSON policy: %v", err)
+	}
+}
+
+func TestFederationAnchor(t *testing.T) {
+	// the credential issuer is itself the trust anchor of the federation
+	federationKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	issuerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks := func(key *ecdsa.PrivateKey) federation.JWKS {
+		public, _ := key.PublicKey.ECDH()
+		jwk, _ := models.NewJWK(public)
+		return federation.JWKS{Keys: []models.JWK{jwk}}
+	}
+	now := time.Now()
+	var entityID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metadata, _ := json.Marshal(map[string]federation.JWKS{"jwks": jwks(issuerKey)})
+		compact, _ := federation.SignEntityStatement(federation.EntityStatement{
+			Issuer: entityID, Subject: entityID, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix(),
+			JWKS:     jwks(federationKey),
+			Metadata: map[string]json.RawMessage{federation.EntityTypeCredentialIssuer: metadata},
+		}, federationKey, "")
+		w.Write([]byte(compact))
+	}))
+	defer srv.Close()
+	entityID = srv.URL
+
+	doc := "version: v1\ntrust_anchors:\n  - input: CAPubKey\n    federation:\n      entities: [" + entityID + "]\n"
+	p, err := Parse([]byte(doc), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEvaluator(p, map[string]frontend.Circuit{"anchored/v1": &anchoredCircuit{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := frontend.NewWitness(&anchoredCircuit{
+		X:         1,
+		CAPubKeyX: emulated.ValueOf[emulated.P256Fp](issuerKey.X),
+		CAPubKeyY: emulated.ValueOf[emulated.P256Fp](issuerKey.Y),
+	}, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	publicWitness, _ := w.MarshalBinary()
+	res := &models.VerificationResult{Circuit: "anchored/v1", Presentation: &models.ZkPresentation{Payload: models.PresentationPayload{PublicWitness: publicWitness}}}
+
+	// without federation client, then with a client trusting the entity
+	if err := e.Evaluate(res, Options{}); !errors.Is(err, ErrViolation) {
+		t.Fatalf("expected a violation without federation client, got %v", err)
+	}
+	e.Federation = &federation.Client{TrustAnchors: map[string]federation.JWKS{entityID: jwks(federationKey)}}
+	if err := e.Evaluate(res, Options{Context: t.Context()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a required trust mark the entity does not have
+	p.TrustAnchors[0].Federation.TrustMarks = []string{"https://trust.example/pid-provider"}
+	if err := e.Evaluate(res, Options{Context: t.Context()}); !errors.Is(err, ErrViolation) {
+		t.Fatalf("expected a violation without trust mark, got %v", err)
+	}
+
+	if _, err := Parse([]byte("version: v1\ntrust_anchors:\n  - input: CAPubKey\n    federation: {}\n"), t.TempDir()); err == nil {
+		t.Fatal("expected a federation anchor without entities to be invalid")
+	}
+}
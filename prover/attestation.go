@@ -0,0 +1,139 @@
+package prover
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidAttestation is returned for a proof whose attestation is
+// missing, does not verify or does not chain to the trusted roots
+var ErrInvalidAttestation = errors.New("invalid proof attestation")
+
+// Attester signs the proofs of a farm with the key of the deployment, for
+// relying parties to know which hosted service produced a proof. The service
+// certificate (Chain[0]) names the deployment.
+type Attester struct {
+	Key *ecdsa.PrivateKey
+	// Chain is the certificate chain of Key, leaf first, without the root
+	Chain []*x509.Certificate
+	// Now is the clock of the attestation timestamps, time.Now when nil
+	Now func() time.Time
+}
+
+// Attestation is the signature of the proving service over the digest of a
+// proof, the circuit and the time it was proven (Result.Attestation)
+type Attestation struct {
+	Circuit string `json:"circuit"`
+	// ProofDigest is the SHA-256 of the proof, in hex
+	ProofDigest string `json:"proof_digest"`
+	// Timestamp is the time of the attestation, in Unix seconds
+	Timestamp int64 `json:"timestamp"`
+	// Signature is the ASN.1 ECDSA signature of SHA-256 of the signed
+	// message (circuit, proof digest and timestamp)
+	Signature []byte `json:"signature"`
+	// Chain is the DER certificate chain of the service key, leaf first
+	Chain [][]byte `json:"chain"`
+}
+
+// attestedMessage is the message an Attestation signs
+type attestedMessage struct {
+	Circuit     string `json:"circuit"`
+	ProofDigest string `json:"proof_digest"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// digest returns the SHA-256 of the signed message
+func (a *Attestation) digest() ([]byte, error) {
+	message, err := json.Marshal(attestedMessage{Circuit: a.Circuit, ProofDigest: a.ProofDigest, Timestamp: a.Timestamp})
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(message)
+	return digest[:], nil
+}
+
+// proofDigest returns the ProofDigest of a proof
+func proofDigest(proof []byte) string {
+	digest := sha256.Sum256(proof)
+	return hex.EncodeToString(digest[:])
+}
+
+// Attest signs the proof of the circuit
+func (a *Attester) Attest(circuit string, proof []byte) (*Attestation, error) {
+	now := time.Now()
+	if a.Now != nil {
+		now = a.Now()
+	}
+	att := &Attestation{Circuit: circuit, ProofDigest: proofDigest(proof), Timestamp: now.Unix()}
+	digest, err := att.digest()
+	if err != nil {
+		return nil, err
+	}
+	if att.Signature, err = ecdsa.SignASN1(rand.Reader, a.Key, digest); err != nil {
+		return nil, fmt.Errorf("attest proof: %w", err)
+	}
+	for _, cert := range a.Chain {
+		att.Chain = append(att.Chain, cert.Raw)
+	}
+	return att, nil
+}
+
+// VerifyAttestation verifies the attestation of the proof of the circuit:
+// the proof digest, the chain to opts.Roots at the attestation time (unless
+// opts.CurrentTime is set) and the signature with the key of the leaf. It
+// returns the leaf certificate, the identity of the deployment.
+func VerifyAttestation(att *Attestation, circuit string, proof []byte, opts x509.VerifyOptions) (*x509.Certificate, error) {
+	if att == nil {
+		return nil, fmt.Errorf("%w: no attestation", ErrInvalidAttestation)
+	}
+	if att.Circuit != circuit {
+		return nil, fmt.Errorf("%w: attested circuit %q, expected %q", ErrInvalidAttestation, att.Circuit, circuit)
+	}
+	if att.ProofDigest != proofDigest(proof) {
+		return nil, fmt.Errorf("%w: attested for another proof", ErrInvalidAttestation)
+	}
+	if len(att.Chain) == 0 {
+		return nil, fmt.Errorf("%w: empty certificate chain", ErrInvalidAttestation)
+	}
+
+	certs := make([]*x509.Certificate, len(att.Chain))
+	for i, der := range att.Chain {
+		var err error
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("%w: certificate %d: %w", ErrInvalidAttestation, i, err)
+		}
+	}
+	opts.Intermediates = x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if opts.CurrentTime.IsZero() {
+		opts.CurrentTime = time.Unix(att.Timestamp, 0)
+	}
+	if len(opts.KeyUsages) == 0 {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+
+	key, ok := certs[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: service key is not an ECDSA key", ErrInvalidAttestation)
+	}
+	digest, err := att.digest()
+	if err != nil {
+		return nil, err
+	}
+	if !ecdsa.VerifyASN1(key, digest, att.Signature) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidAttestation)
+	}
+	return certs[0], nil
+}
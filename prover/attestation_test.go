@@ -0,0 +1,109 @@
+package prover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newAttester returns an attester certified by a new root, and the root
+func newAttester(t *testing.T) (*Attester, *x509.CertPool) {
+	t.Helper()
+	issue := func(template, parent *x509.Certificate, key *ecdsa.PublicKey, signer *ecdsa.PrivateKey) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, key, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serviceKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Now()
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Prover Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	root := issue(rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	service := issue(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "prover.eu-west.example"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, root, &serviceKey.PublicKey, rootKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &Attester{Key: serviceKey, Chain: []*x509.Certificate{service}}, roots
+}
+
+func TestAttestation(t *testing.T) {
+	f, vk := newTestFarm(t, nil)
+	attester, roots := newAttester(t)
+	f.Attester = attester
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	body, _ := json.Marshal(ProveRequest{Witness: cubeWitness(t, 3, 27)})
+	res, err := http.Post(server.URL+"/circuits/cube%2Fv1/prove", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proved Result
+	if err := json.NewDecoder(res.Body).Decode(&proved); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	verify(t, vk, proved)
+
+	leaf, err := VerifyAttestation(proved.Attestation, "cube/v1", proved.Proof, x509.VerifyOptions{Roots: roots})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "prover.eu-west.example" {
+		t.Fatalf("unexpected deployment %s", leaf.Subject)
+	}
+
+	_, otherRoots := newAttester(t)
+	forged := *proved.Attestation
+	forged.Timestamp++
+	tests := []struct {
+		name    string
+		att     *Attestation
+		circuit string
+		proof   []byte
+		roots   *x509.CertPool
+	}{
+		{"missing", nil, "cube/v1", proved.Proof, roots},
+		{"other circuit", proved.Attestation, "cube/v2", proved.Proof, roots},
+		{"other proof", proved.Attestation, "cube/v1", append([]byte{0}, proved.Proof...), roots},
+		{"untrusted", proved.Attestation, "cube/v1", proved.Proof, otherRoots},
+		{"signature", &forged, "cube/v1", proved.Proof, roots},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyAttestation(tt.att, tt.circuit, tt.proof, x509.VerifyOptions{Roots: tt.roots}); !errors.Is(err, ErrInvalidAttestation) {
+				t.Fatalf("expected ErrInvalidAttestation, got %v", err)
+			}
+		})
+	}
+}
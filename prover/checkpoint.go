@@ -0,0 +1,169 @@
+package prover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mynextid/eudi-zk/artifact"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+var (
+	// ErrInvalidJob is returned for a job id that cannot be checkpointed
+	ErrInvalidJob = errors.New("invalid job")
+	// ErrUnknownJob is returned when resuming a job without checkpoints
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobMismatch is returned for a job resubmitted with other witnesses
+	// than the checkpointed ones
+	ErrJobMismatch = errors.New("job checkpointed with other witnesses")
+)
+
+// jobID matches the job ids chosen by the clients, one segment of the
+// checkpoint keys
+var jobID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Checkpoints persist the completed phases of the batch jobs in an artifact
+// store, so a job rescheduled after its worker crashed resumes past them
+// instead of proving the whole batch again:
+//
+//	<prefix><circuit>/<job>/<index>.witness  the witnesses (gnark binary encoding)
+//	<prefix><circuit>/<job>/job.json         their input digests, saved last
+//	<prefix><circuit>/<job>/<index>.proof    the completed proofs
+//
+// The witnesses are checkpointed before proving, a job is then resumed by its
+// id alone. A checkpoint that cannot be written does not fail the job: its
+// proof is proven again on resume. The store keeps the checkpoints of
+// completed jobs, expire them with the lifecycle rules of the bucket.
+type Checkpoints struct {
+	Store  artifact.Store
+	Prefix string // optional key prefix, e.g. "jobs/"
+}
+
+// NewCheckpoints returns checkpoints in the store
+func NewCheckpoints(store artifact.Store) *Checkpoints {
+	return &Checkpoints{Store: store}
+}
+
+// jobManifest lists the witnesses of a checkpointed job
+type jobManifest struct {
+	Circuit      string   `json:"circuit"`
+	InputDigests []string `json:"input_digests"` // models.InputDigest of the witnesses
+}
+
+// proofCheckpoint is a completed proof of a job
+type proofCheckpoint struct {
+	InputDigest   string        `json:"input_digest"`
+	Proof         []byte        `json:"proof"`
+	PublicWitness []byte        `json:"public_witness"`
+	ProveTime     time.Duration `json:"prove_time"`
+}
+
+func (c *Checkpoints) key(circuit, job, name string) string {
+	return c.Prefix + circuit + "/" + job + "/" + name
+}
+
+func (c *Checkpoints) get(ctx context.Context, key string) ([]byte, error) {
+	r, err := c.Store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (c *Checkpoints) put(ctx context.Context, key string, data []byte) error {
+	return c.Store.Put(ctx, key, bytes.NewReader(data))
+}
+
+// open returns the witnesses of the job. Given witnesses are checkpointed
+// when the job is new, and must be the checkpointed ones otherwise; without
+// witnesses the checkpointed ones are loaded.
+func (c *Checkpoints) open(ctx context.Context, circuit, job string, witnesses [][]byte) ([][]byte, error) {
+	if !jobID.MatchString(job) {
+		return nil, fmt.Errorf("%w: job id %q", ErrInvalidJob, job)
+	}
+	digests := make([]string, len(witnesses))
+	for i, w := range witnesses {
+		digests[i] = models.InputDigest(w)
+	}
+
+	data, err := c.get(ctx, c.key(circuit, job, "job.json"))
+	if errors.Is(err, artifact.ErrNotFound) {
+		if len(witnesses) == 0 {
+			return nil, fmt.Errorf("%w %q", ErrUnknownJob, job)
+		}
+		for i, w := range witnesses {
+			if err := c.put(ctx, c.key(circuit, job, strconv.Itoa(i)+".witness"), w); err != nil {
+				// proven without resume
+				return witnesses, nil
+			}
+		}
+		manifest, err := json.Marshal(jobManifest{Circuit: circuit, InputDigests: digests})
+		if err != nil {
+			return nil, err
+		}
+		c.put(ctx, c.key(circuit, job, "job.json"), manifest)
+		return witnesses, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job %q: %w", job, err)
+	}
+	var manifest jobManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to load job %q: %w", job, err)
+	}
+
+	if len(witnesses) > 0 {
+		if !slices.Equal(digests, manifest.InputDigests) {
+			return nil, fmt.Errorf("%w: %q", ErrJobMismatch, job)
+		}
+		return witnesses, nil
+	}
+	witnesses = make([][]byte, len(manifest.InputDigests))
+	for i, digest := range manifest.InputDigests {
+		if witnesses[i], err = c.get(ctx, c.key(circuit, job, strconv.Itoa(i)+".witness")); err != nil {
+			return nil, fmt.Errorf("failed to load witness %d of job %q: %w", i, job, err)
+		}
+		if models.InputDigest(witnesses[i]) != digest {
+			return nil, fmt.Errorf("failed to load witness %d of job %q: digest mismatch", i, job)
+		}
+	}
+	return witnesses, nil
+}
+
+// proof returns the checkpointed proof of the witness at index i of the job,
+// if any
+func (c *Checkpoints) proof(ctx context.Context, circuit, job string, i int, fullWitness []byte) (*proofCheckpoint, bool) {
+	data, err := c.get(ctx, c.key(circuit, job, strconv.Itoa(i)+".proof"))
+	if err != nil {
+		return nil, false
+	}
+	var p proofCheckpoint
+	if err := json.Unmarshal(data, &p); err != nil || p.InputDigest != models.InputDigest(fullWitness) {
+		return nil, false
+	}
+	return &p, true
+}
+
+// saveProof checkpoints the proof of the witness at index i of the job
+func (c *Checkpoints) saveProof(ctx context.Context, circuit, job string, i int, fullWitness []byte, res *common.ProveResult) {
+	data, err := json.Marshal(proofCheckpoint{
+		InputDigest:   models.InputDigest(fullWitness),
+		Proof:         res.Proof,
+		PublicWitness: res.PublicWitness,
+		ProveTime:     res.ProveTime,
+	})
+	if err != nil {
+		return
+	}
+	c.put(ctx, c.key(circuit, job, strconv.Itoa(i)+".proof"), data)
+}
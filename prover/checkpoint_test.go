@@ -0,0 +1,95 @@
+package prover
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+func TestResumeBatch(t *testing.T) {
+	f, vk := newTestFarm(t, nil)
+	f.Workers = 2
+	dir := t.TempDir()
+	f.Checkpoints = NewCheckpoints(artifact.NewFSStore(dir))
+	f.Checkpoints.Prefix = "jobs/"
+
+	witnesses := [][]byte{cubeWitness(t, 2, 8), cubeWitness(t, 3, 27), cubeWitness(t, 3, 28), cubeWitness(t, 4, 64)}
+	ctx := context.Background()
+	if _, err := f.ResumeBatch(ctx, "cube/v1", "job-1", nil, func(Result) {}); !errors.Is(err, ErrUnknownJob) {
+		t.Fatalf("expected ErrUnknownJob before the first run, got %v", err)
+	}
+	summary, err := f.ResumeBatch(ctx, "cube/v1", "job-1", witnesses, func(Result) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Succeeded != 3 || summary.Failed != 1 || summary.Resumed != 0 {
+		t.Fatalf("unexpected summary of the first run %+v", summary)
+	}
+
+	// the worker crashed before completing the proof of witness 3
+	if err := os.Remove(filepath.Join(dir, "jobs", "cube", "v1", "job-1", "3.proof")); err != nil {
+		t.Fatal(err)
+	}
+	resumed := map[int]bool{}
+	summary, err = f.ResumeBatch(ctx, "cube/v1", "job-1", nil, func(res Result) {
+		if res.Error != "" {
+			return
+		}
+		resumed[res.Index] = res.Resumed
+		verify(t, vk, res)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 4 || summary.Succeeded != 3 || summary.Failed != 1 || summary.Resumed != 2 {
+		t.Fatalf("unexpected summary of the resumed run %+v", summary)
+	}
+	if !resumed[0] || !resumed[1] || resumed[3] {
+		t.Fatalf("unexpected resumed proofs %v", resumed)
+	}
+
+	if _, err := f.ResumeBatch(ctx, "cube/v1", "job-1", witnesses[:2], func(Result) {}); !errors.Is(err, ErrJobMismatch) {
+		t.Fatalf("expected ErrJobMismatch for other witnesses, got %v", err)
+	}
+	if _, err := f.ResumeBatch(ctx, "cube/v1", "../job-1", witnesses, func(Result) {}); !errors.Is(err, ErrInvalidJob) {
+		t.Fatalf("expected ErrInvalidJob for a path, got %v", err)
+	}
+
+	// resumed over HTTP by the job id alone
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	body, _ := json.Marshal(BatchRequest{Job: "job-1"})
+	res, err := http.Post(server.URL+"/circuits/cube%2Fv1/prove/batch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var last BatchEvent
+	for scanner := bufio.NewScanner(res.Body); scanner.Scan(); {
+		if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if last.Summary == nil || last.Summary.Resumed != 3 {
+		t.Fatalf("unexpected summary %+v", last.Summary)
+	}
+
+	body, _ = json.Marshal(BatchRequest{Job: "job-2"})
+	unknown, err := http.Post(server.URL+"/circuits/cube%2Fv1/prove/batch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown.Body.Close()
+	if unknown.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown job, got %d", unknown.StatusCode)
+	}
+}
@@ -0,0 +1,208 @@
+package prover
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/consensys/gnark/std/math/emulated"
+)
+
+// fieldModuli are the moduli of the emulated fields, by emulated.Element type
+var fieldModuli sync.Map
+
+func init() {
+	RegisterField[emulated.P256Fp]()
+	RegisterField[emulated.P256Fr]()
+	RegisterField[emulated.P384Fp]()
+	RegisterField[emulated.P384Fr]()
+	RegisterField[emulated.Secp256k1Fp]()
+	RegisterField[emulated.Secp256k1Fr]()
+	RegisterField[emulated.BN254Fp]()
+	RegisterField[emulated.BN254Fr]()
+}
+
+// RegisterField registers the emulated field T: the inputs of type
+// emulated.Element[T] of the schemas created afterwards are checked against
+// its modulus and described with it (InputField.Modulus). The fields of the
+// NIST, secp256k1 and BN254 curves are registered; the elements of other
+// fields, e.g. an RSA modulus, are only bounded by their limbs.
+func RegisterField[T emulated.FieldParams]() {
+	var params T
+	fieldModuli.Store(reflect.TypeFor[emulated.Element[T]](), params.Modulus())
+}
+
+// FormatElement returns the canonical JSON encoding of an emulated field
+// element: big-endian lowercase hexadecimal with the 0x prefix and without
+// leading zeros ("0x0" for zero)
+func FormatElement(v *big.Int) string {
+	return "0x" + v.Text(16)
+}
+
+// ParseElement parses the canonical encoding of an emulated field element
+// (FormatElement), any other encoding of the value is rejected
+func ParseElement(s string) (*big.Int, error) {
+	digits, ok := strings.CutPrefix(s, "0x")
+	if !ok || digits == "" || len(digits) > 1 && digits[0] == '0' {
+		return nil, fmt.Errorf("element %q is not canonical 0x hexadecimal", s)
+	}
+	for _, c := range digits {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return nil, fmt.Errorf("element %q is not canonical 0x hexadecimal", s)
+		}
+	}
+	v, _ := new(big.Int).SetString(digits, 16)
+	return v, nil
+}
+
+// ElementValue parses the canonical encoding of an element of the emulated
+// field T into its assignment, rejecting the values not below the modulus
+func ElementValue[T emulated.FieldParams](s string) (emulated.Element[T], error) {
+	v, err := ParseElement(s)
+	if err != nil {
+		return emulated.Element[T]{}, err
+	}
+	var params T
+	if v.Cmp(params.Modulus()) >= 0 {
+		return emulated.Element[T]{}, fmt.Errorf("element %s is not below the modulus", s)
+	}
+	return emulated.ValueOf[T](v), nil
+}
+
+// elementModuli records the moduli of the emulated.Element fields of the
+// circuit of a registered field by input name, named as gnark names the
+// leaves
+func elementModuli(v reflect.Value, name string, moduli map[string]*big.Int) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			elementModuli(v.Elem(), name, moduli)
+		}
+	case reflect.Struct:
+		if modulus, ok := fieldModuli.Load(v.Type()); ok {
+			moduli[name] = modulus.(*big.Int)
+			return
+		}
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldName := field.Name
+			if tag, ok := field.Tag.Lookup("gnark"); ok {
+				tagName, _, _ := strings.Cut(tag, ",")
+				if tagName == "-" {
+					continue
+				}
+				if tagName != "" {
+					fieldName = tagName
+				}
+			}
+			elementModuli(v.Field(i), leafName(name, fieldName), moduli)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			elementModuli(v.Index(i), leafName(name, strconv.Itoa(i)), moduli)
+		}
+	}
+}
+
+func leafName(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "_" + name
+}
+
+// Input types of InputField
+const (
+	InputTypeBytes   = "bytes"
+	InputTypeElement = "element"
+	InputTypeInteger = "integer"
+)
+
+// InputField describes an input of an InputSchema and the JSON encoding of
+// its value (InputSchema.DecodeJSON)
+type InputField struct {
+	Name string `json:"name"`
+	// Type is InputTypeBytes, a base64 string of at most Size bytes,
+	// InputTypeElement, an emulated field element in canonical encoding
+	// (FormatElement) below Modulus, or InputTypeInteger, a JSON number or
+	// a decimal or 0x hexadecimal string below the scalar field
+	Type string `json:"type"`
+	Size int    `json:"size,omitempty"`
+	// Limbs is the number of 64-bit limbs of an element
+	Limbs int `json:"limbs,omitempty"`
+	// Modulus is the modulus of an element of a registered field
+	// (RegisterField), canonically encoded
+	Modulus string `json:"modulus,omitempty"`
+}
+
+// Fields describes the inputs, sorted by name
+func (s *InputSchema) Fields() []InputField {
+	fields := make([]InputField, 0, len(s.inputs))
+	for _, name := range s.Inputs() {
+		in := s.inputs[name]
+		field := InputField{Name: name}
+		switch in.kind {
+		case inputBytes:
+			field.Type, field.Size = InputTypeBytes, len(in.indexes)
+		case inputElement:
+			field.Type, field.Limbs = InputTypeElement, len(in.indexes)
+			if in.modulus != nil {
+				field.Modulus = FormatElement(in.modulus)
+			}
+		default:
+			field.Type = InputTypeInteger
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// DecodeJSON decodes the JSON inputs of a prove request (ProveRequest.Inputs)
+// into a full witness, the values encoded as described by Fields
+func (s *InputSchema) DecodeJSON(inputs map[string]json.RawMessage) (*DecodedInputs, error) {
+	values := make(map[string][]byte, len(inputs))
+	for name, raw := range inputs {
+		in, ok := s.inputs[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown input %q", ErrInvalidInput, name)
+		}
+		value, err := in.decodeJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidInput, name, err)
+		}
+		values[name] = value
+	}
+	return s.DecodeValues(values)
+}
+
+// decodeJSON returns the value of a JSON input as DecodeValues takes it
+func (in *input) decodeJSON(raw json.RawMessage) ([]byte, error) {
+	var text string
+	if in.kind == inputVariable && len(raw) > 0 && raw[0] != '"' {
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, err
+		}
+		text = n.String()
+	} else if err := json.Unmarshal(raw, &text); err != nil {
+		return nil, err
+	}
+
+	switch in.kind {
+	case inputBytes:
+		return base64.StdEncoding.DecodeString(text)
+	case inputElement:
+		if _, err := ParseElement(text); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(text), nil
+}
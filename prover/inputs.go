@@ -0,0 +1,386 @@
+package prover
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime/multipart"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+	"github.com/mynextid/eudi-zk/x509pos"
+)
+
+// ErrInvalidInput is returned for a multipart input that does not match the
+// input schema of the circuit
+var ErrInvalidInput = errors.New("invalid input")
+
+// consentPart is the name of the part holding the consent token
+const consentPart = "consent"
+
+// maxValueSize bounds the text parts: the consent token and the values
+const maxValueSize = 64 << 10
+
+// limbBits is the limb size of the emulated elements (emulated.Element), the
+// limb size of the gnark emulated fields
+const limbBits = 64
+
+// inputKind is how an input of the circuit is sent
+type inputKind int
+
+const (
+	// inputBytes is a []uints.U8 field, sent as a binary part of at most its
+	// length, zero padded
+	inputBytes inputKind = iota
+	// inputElement is an emulated.Element field, sent as an integer split
+	// into its limbs
+	inputElement
+	// inputVariable is a frontend.Variable leaf, sent as an integer
+	inputVariable
+)
+
+// input is an input of the circuit and the indexes of its leaves in the full
+// witness vector
+type input struct {
+	kind    inputKind
+	indexes []int
+	// public is set for an input of public leaves
+	public bool
+	// validate checks a binary input before it is assigned, see
+	// InputSchema.Validate
+	validate func(data []byte) error
+	// modulus bounds an element of a registered field (RegisterField)
+	modulus *big.Int
+}
+
+var (
+	bytesLeaf   = regexp.MustCompile(`^(.+)_([0-9]+)_Val$`)
+	elementLeaf = regexp.MustCompile(`^(.+)_Limbs_([0-9]+)$`)
+)
+
+// InputSchema maps the named inputs of a circuit to its full witness, so the
+// inputs can be sent as multipart parts instead of a full witness:
+//
+//   - a []uints.U8 field is a binary part named after the field, of at most
+//     its length; the bytes past the part are zero
+//   - an emulated.Element field is a part named after the field holding the
+//     integer, decimal or 0x hexadecimal, below the modulus of its field
+//     when registered (RegisterField)
+//   - any other leaf is a part named after its full name (e.g. ExtensionPos,
+//     ChallengeTimestamp_0) holding the integer
+//
+// Nested fields are named by their path joined with "_", as gnark names the
+// leaves. The same inputs are taken as JSON (DecodeJSON), the elements in
+// their canonical encoding (FormatElement).
+type InputSchema struct {
+	nbPublic, nbSecret int
+	inputs             map[string]*input
+}
+
+// NewInputSchema returns the input schema of the circuit, the template it was
+// compiled with (its slices sized)
+func NewInputSchema(circuit frontend.Circuit) (*InputSchema, error) {
+	count, err := schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &InputSchema{nbPublic: count.Public, nbSecret: count.Secret, inputs: map[string]*input{}}
+
+	// the full witness holds the public values first, then the secret ones,
+	// each in the order of the leaves
+	var public, secret int
+	_, err = schema.Walk(ecc.BN254.ScalarField(), circuit, reflect.TypeOf((*frontend.Variable)(nil)).Elem(), func(leaf schema.LeafInfo, _ reflect.Value) error {
+		var index int
+		switch leaf.Visibility {
+		case schema.Public:
+			index, public = public, public+1
+		case schema.Secret:
+			index, secret = s.nbPublic+secret, secret+1
+		default:
+			return nil
+		}
+
+		name, kind := leaf.FullName(), inputVariable
+		if m := bytesLeaf.FindStringSubmatch(name); m != nil {
+			name, kind = m[1], inputBytes
+		} else if m := elementLeaf.FindStringSubmatch(name); m != nil {
+			name, kind = m[1], inputElement
+		}
+		in, ok := s.inputs[name]
+		if !ok {
+			in = &input{kind: kind, public: leaf.Visibility == schema.Public}
+			s.inputs[name] = in
+		}
+		if in.kind != kind || kind == inputVariable && ok {
+			return fmt.Errorf("ambiguous input %q", name)
+		}
+		in.indexes = append(in.indexes, index)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.inputs[consentPart]; ok {
+		return nil, fmt.Errorf("input %q is reserved for the consent token", consentPart)
+	}
+
+	moduli := map[string]*big.Int{}
+	elementModuli(reflect.ValueOf(circuit), "", moduli)
+	for name, modulus := range moduli {
+		if in, ok := s.inputs[name]; ok && in.kind == inputElement {
+			in.modulus = modulus
+		}
+	}
+	return s, nil
+}
+
+// Inputs returns the names of the inputs, sorted
+func (s *InputSchema) Inputs() []string {
+	names := make([]string, 0, len(s.inputs))
+	for name := range s.inputs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Binary returns the size of the binary input ([]uints.U8 field) name, false
+// for another input
+func (s *InputSchema) Binary(name string) (int, bool) {
+	in, ok := s.inputs[name]
+	if !ok || in.kind != inputBytes {
+		return 0, false
+	}
+	return len(in.indexes), true
+}
+
+// Validate checks the binary input with validate before it is assigned to
+// the witness, e.g. ValidateCertificate for a DER certificate: the part is
+// buffered, at most the length of the input, and the sent bytes (the padding
+// excluded) are validated. Set the validators before registering the schema
+// (Farm.RegisterInputSchema).
+func (s *InputSchema) Validate(name string, validate func(data []byte) error) error {
+	in, ok := s.inputs[name]
+	if !ok || in.kind != inputBytes {
+		return fmt.Errorf("circuit has no binary input %q", name)
+	}
+	in.validate = validate
+	return nil
+}
+
+// ValidateCertificate checks an untrusted DER X.509 certificate input with the
+// bounds checked parser of the witness builders (x509pos.Parse), so a
+// malformed certificate is refused before any witness is built
+func ValidateCertificate(der []byte) error {
+	_, err := x509pos.Parse(der)
+	return err
+}
+
+// ValidateTBSCertificate checks an untrusted DER TBSCertificate input like
+// ValidateCertificate (x509pos.ParseTBS)
+func ValidateTBSCertificate(der []byte) error {
+	_, err := x509pos.ParseTBS(der)
+	return err
+}
+
+// DecodedInputs is a full witness decoded from multipart parts
+type DecodedInputs struct {
+	Witness witness.Witness
+	// InputDigest is the models.InputDigest of the full witness
+	InputDigest string
+	// Consent is the consent token part, if any
+	Consent string
+}
+
+// ReadMultipart decodes the parts of a multipart/form-data body into a full
+// witness. The binary parts are streamed into the witness vector, not held
+// whole; every input must be sent once.
+func (s *InputSchema) ReadMultipart(r *multipart.Reader) (*DecodedInputs, error) {
+	return s.decode(func() (string, io.Reader, error) {
+		part, err := r.NextPart()
+		if err != nil {
+			return "", nil, err
+		}
+		return part.FormName(), part, nil
+	})
+}
+
+// DecodeValues decodes the values of the inputs, by name as the parts of
+// ReadMultipart (the raw bytes of a binary input, the integer text of the
+// others, the consent token), into a full witness
+func (s *InputSchema) DecodeValues(values map[string][]byte) (*DecodedInputs, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return s.decode(func() (string, io.Reader, error) {
+		if len(names) == 0 {
+			return "", nil, io.EOF
+		}
+		name := names[0]
+		names = names[1:]
+		return name, bytes.NewReader(values[name]), nil
+	})
+}
+
+// decode decodes the inputs returned by next, until io.EOF, into a full
+// witness
+func (s *InputSchema) decode(next func() (string, io.Reader, error)) (*DecodedInputs, error) {
+	values := make(fr.Vector, s.nbPublic+s.nbSecret)
+	decoded := &DecodedInputs{}
+	seen := map[string]bool{}
+	for {
+		name, part, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate part %q", ErrInvalidInput, name)
+		}
+		seen[name] = true
+
+		if name == consentPart {
+			token, err := readValue(part)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrInvalidInput, name, err)
+			}
+			decoded.Consent = token
+			continue
+		}
+		in, ok := s.inputs[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown input %q", ErrInvalidInput, name)
+		}
+		if err := in.read(part, values); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidInput, name, err)
+		}
+	}
+
+	var missing []string
+	for _, name := range s.Inputs() {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing inputs %s", ErrInvalidInput, strings.Join(missing, ", "))
+	}
+
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+		for i := range values {
+			ch <- values[i]
+		}
+	}()
+	if err := w.Fill(s.nbPublic, s.nbSecret, ch); err != nil {
+		return nil, err
+	}
+	decoded.Witness = w
+
+	h := sha256.New()
+	if _, err := w.WriteTo(h); err != nil {
+		return nil, err
+	}
+	decoded.InputDigest = hex.EncodeToString(h.Sum(nil))
+	return decoded, nil
+}
+
+// read decodes the part into the leaves of the input
+func (in *input) read(part io.Reader, values fr.Vector) error {
+	switch {
+	case in.kind == inputBytes && in.validate != nil:
+		data, err := io.ReadAll(io.LimitReader(part, int64(len(in.indexes))+1))
+		if err != nil {
+			return err
+		}
+		if len(data) > len(in.indexes) {
+			return fmt.Errorf("more than %d bytes", len(in.indexes))
+		}
+		if err := in.validate(data); err != nil {
+			return err
+		}
+		for i, b := range data {
+			values[in.indexes[i]].SetUint64(uint64(b))
+		}
+		return nil
+	case in.kind == inputBytes:
+		br := bufio.NewReader(part)
+		for i := 0; ; i++ {
+			b, err := br.ReadByte()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if i == len(in.indexes) {
+				return fmt.Errorf("more than %d bytes", len(in.indexes))
+			}
+			values[in.indexes[i]].SetUint64(uint64(b))
+		}
+	}
+
+	text, err := readValue(part)
+	if err != nil {
+		return err
+	}
+	v, ok := new(big.Int).SetString(text, 0)
+	if !ok || v.Sign() < 0 {
+		return fmt.Errorf("invalid integer %q", text)
+	}
+	if in.kind == inputVariable {
+		if v.Cmp(fr.Modulus()) >= 0 {
+			return fmt.Errorf("%q exceeds the scalar field", text)
+		}
+		values[in.indexes[0]].SetBigInt(v)
+		return nil
+	}
+
+	// emulated element, little-endian limbs
+	if in.modulus != nil && v.Cmp(in.modulus) >= 0 {
+		return fmt.Errorf("%q is not below the modulus of the field", text)
+	}
+	if v.BitLen() > limbBits*len(in.indexes) {
+		return fmt.Errorf("%q exceeds %d limbs", text, len(in.indexes))
+	}
+	mask := new(big.Int).Lsh(big.NewInt(1), limbBits)
+	mask.Sub(mask, big.NewInt(1))
+	for _, index := range in.indexes {
+		values[index].SetBigInt(new(big.Int).And(v, mask))
+		v.Rsh(v, limbBits)
+	}
+	return nil
+}
+
+// readValue reads a text part
+func readValue(part io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(part, maxValueSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxValueSize {
+		return "", fmt.Errorf("value exceeds %d bytes", maxValueSize)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,364 @@
+package prover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// sumCircuit proves the sum of the bytes of Data
+type sumCircuit struct {
+	Data []uints.U8
+	Sum  frontend.Variable `gnark:",public"`
+}
+
+func (c *sumCircuit) Define(api frontend.API) error {
+	var sum frontend.Variable = 0
+	for i := range c.Data {
+		sum = api.Add(sum, c.Data[i].Val)
+	}
+	api.AssertIsEqual(sum, c.Sum)
+	return nil
+}
+
+// inputsCircuit has an input of each kind, public and secret
+type inputsCircuit struct {
+	Data  []uints.U8
+	Key   emulated.Element[emulated.P256Fp] `gnark:",public"`
+	Pos   frontend.Variable
+	Times []frontend.Variable `gnark:",public"`
+}
+
+func (c *inputsCircuit) Define(api frontend.API) error { return nil }
+
+// multipartBody encodes the parts, in order
+func multipartBody(t *testing.T, parts ...[2]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range parts {
+		w, err := mw.CreateFormFile(part[0], part[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(part[1]))
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, mw.FormDataContentType()
+}
+
+func readMultipart(t *testing.T, s *InputSchema, parts ...[2]string) (*DecodedInputs, error) {
+	t.Helper()
+	body, contentType := multipartBody(t, parts...)
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", contentType)
+	mr, err := req.MultipartReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.ReadMultipart(mr)
+}
+
+func TestInputSchema(t *testing.T) {
+	s, err := NewInputSchema(&inputsCircuit{Data: make([]uints.U8, 8), Times: make([]frontend.Variable, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(s.Inputs(), ","); got != "Data,Key,Pos,Times_0,Times_1" {
+		t.Fatalf("unexpected inputs %s", got)
+	}
+
+	key, _ := new(big.Int).SetString("fedcba9876543210fedcba9876543210fedcba9876543210fedcba98765432", 16)
+	decoded, err := readMultipart(t, s,
+		[2]string{"Times_1", "20240301"},
+		[2]string{"Data", "abc"},
+		[2]string{"Key", "0x" + key.Text(16)},
+		[2]string{"Pos", "7"},
+		[2]string{"Times_0", "20240229"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the decoded witness is the witness of the assignment, zero padded
+	assignment := &inputsCircuit{
+		Data:  append(common.BytesToU8Array([]byte("abc")), common.BytesToU8Array(make([]byte, 5))...),
+		Key:   emulated.ValueOf[emulated.P256Fp](key),
+		Pos:   7,
+		Times: []frontend.Variable{20240229, 20240301},
+	}
+	w, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := w.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.InputDigest != models.InputDigest(expected) {
+		t.Fatal("decoded witness differs from the witness of the assignment")
+	}
+	decoded, err = s.DecodeValues(map[string][]byte{
+		"Data": []byte("abc"), "Key": []byte("0x" + key.Text(16)), "Pos": []byte("7"), "Times_0": []byte("20240229"), "Times_1": []byte("20240301"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.InputDigest != models.InputDigest(expected) {
+		t.Fatal("decoded values differ from the witness of the assignment")
+	}
+	decoded, err = s.DecodeJSON(map[string]json.RawMessage{
+		"Data": json.RawMessage(`"YWJj"`), "Key": json.RawMessage(`"` + FormatElement(key) + `"`), "Pos": json.RawMessage(`7`), "Times_0": json.RawMessage(`"20240229"`), "Times_1": json.RawMessage(`20240301`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.InputDigest != models.InputDigest(expected) {
+		t.Fatal("decoded JSON differs from the witness of the assignment")
+	}
+	fields := s.Fields()
+	if len(fields) != 5 || fields[0] != (InputField{Name: "Data", Type: InputTypeBytes, Size: 8}) || fields[2].Type != InputTypeInteger ||
+		fields[1] != (InputField{Name: "Key", Type: InputTypeElement, Limbs: 4, Modulus: FormatElement(emulated.P256Fp{}.Modulus())}) {
+		t.Fatalf("unexpected fields %+v", fields)
+	}
+	if size, ok := s.Binary("Data"); !ok || size != 8 {
+		t.Fatalf("unexpected binary input of %d bytes", size)
+	}
+	if _, ok := s.Binary("Pos"); ok {
+		t.Fatal("unexpected binary input Pos")
+	}
+
+	for name, parts := range map[string][][2]string{
+		"missing":   {{"Data", "abc"}, {"Key", "1"}, {"Pos", "7"}, {"Times_0", "1"}},
+		"unknown":   {{"Data", "abc"}, {"Key", "1"}, {"Pos", "7"}, {"Times_0", "1"}, {"Times_1", "2"}, {"Other", "1"}},
+		"duplicate": {{"Data", "abc"}, {"Data", "abc"}, {"Key", "1"}, {"Pos", "7"}, {"Times_0", "1"}, {"Times_1", "2"}},
+		"too long":  {{"Data", "abcdefghi"}, {"Key", "1"}, {"Pos", "7"}, {"Times_0", "1"}, {"Times_1", "2"}},
+		"negative":  {{"Data", "abc"}, {"Key", "1"}, {"Pos", "-7"}, {"Times_0", "1"}, {"Times_1", "2"}},
+		"not int":   {{"Data", "abc"}, {"Key", "1"}, {"Pos", "seven"}, {"Times_0", "1"}, {"Times_1", "2"}},
+		"modulus":   {{"Data", "abc"}, {"Key", "1"}, {"Pos", "0x" + strings.Repeat("f", 64)}, {"Times_0", "1"}, {"Times_1", "2"}},
+		"limbs":     {{"Data", "abc"}, {"Key", "0x1" + strings.Repeat("0", 64)}, {"Pos", "7"}, {"Times_0", "1"}, {"Times_1", "2"}},
+		"field":     {{"Data", "abc"}, {"Key", FormatElement(emulated.P256Fp{}.Modulus())}, {"Pos", "7"}, {"Times_0", "1"}, {"Times_1", "2"}},
+	} {
+		if _, err := readMultipart(t, s, parts...); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+
+	// elements are only taken in their canonical encoding in JSON
+	for _, key := range []string{`"1"`, `"0x01"`, `"0xAB"`, `"0x"`, `1`} {
+		_, err := s.DecodeJSON(map[string]json.RawMessage{
+			"Data": json.RawMessage(`""`), "Key": json.RawMessage(key), "Pos": json.RawMessage(`7`), "Times_0": json.RawMessage(`1`), "Times_1": json.RawMessage(`2`),
+		})
+		if !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("key %s: expected ErrInvalidInput, got %v", key, err)
+		}
+	}
+	if _, err := s.DecodeJSON(map[string]json.RawMessage{"Pos": json.RawMessage(`7.5`)}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput for a decimal number, got %v", err)
+	}
+}
+
+func TestElementValue(t *testing.T) {
+	modulus := emulated.P256Fr{}.Modulus()
+	for _, v := range []*big.Int{big.NewInt(0), big.NewInt(0xab), new(big.Int).Sub(modulus, big.NewInt(1))} {
+		element, err := ElementValue[emulated.P256Fr](FormatElement(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(element, emulated.ValueOf[emulated.P256Fr](v)) {
+			t.Fatalf("unexpected element of %s", FormatElement(v))
+		}
+	}
+	if FormatElement(big.NewInt(0)) != "0x0" || FormatElement(big.NewInt(0xab)) != "0xab" {
+		t.Fatal("unexpected canonical encoding")
+	}
+	if _, err := ElementValue[emulated.P256Fr](FormatElement(modulus)); err == nil {
+		t.Fatal("expected an element not below the modulus")
+	}
+}
+
+func TestValidateCertificateInput(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "holder"}, NotAfter: time.Now().Add(time.Hour)}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewInputSchema(&inputsCircuit{Data: make([]uints.U8, 2048), Times: make([]frontend.Variable, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate("Pos", ValidateCertificate); err == nil {
+		t.Fatal("expected a validator of a non binary input to be rejected")
+	}
+	if err := s.Validate("Data", ValidateCertificate); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(data []byte) error {
+		t.Helper()
+		_, err := readMultipart(t, s, [2]string{"Data", string(data)}, [2]string{"Key", "1"}, [2]string{"Pos", "7"}, [2]string{"Times_0", "1"}, [2]string{"Times_1", "2"})
+		return err
+	}
+	if err := read(certDER); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"truncated": certDER[:len(certDER)/2],
+		"length":    append([]byte{0x30, 0x84, 0xFF, 0xFF, 0xFF, 0xFF}, certDER[2:]...),
+		"too long":  append(bytes.Clone(certDER), make([]byte, 2048)...),
+	} {
+		if err := read(data); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
+
+func TestHandlerMultipart(t *testing.T) {
+	template := &sumCircuit{Data: make([]uints.U8, 1024)}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFarm(nil)
+	f.Register("sum/v1", common.NewProver(ccs, pk))
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	post := func(parts ...[2]string) *http.Response {
+		t.Helper()
+		body, contentType := multipartBody(t, parts...)
+		res, err := http.Post(server.URL+"/circuits/sum%2Fv1/prove", contentType, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// a circuit registered without its inputs takes no multipart requests
+	res := post([2]string{"Sum", "0"})
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", res.StatusCode)
+	}
+
+	if err := f.RegisterInputs("sum/v1", template); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte{0xff, 0x01}, 300)
+	res = post([2]string{"Data", string(data)}, [2]string{"Sum", "76800"})
+	var proved Result
+	if err := json.NewDecoder(res.Body).Decode(&proved); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.StatusCode)
+	}
+	verify(t, vk, proved)
+
+	res = post([2]string{"Data", string(data)})
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a missing input, got %d", res.StatusCode)
+	}
+
+	// the same inputs in JSON
+	body, _ := json.Marshal(ProveRequest{Inputs: map[string]json.RawMessage{
+		"Data": json.RawMessage(`"` + base64.StdEncoding.EncodeToString(data) + `"`), "Sum": json.RawMessage(`76800`),
+	}})
+	res, err = http.Post(server.URL+"/circuits/sum%2Fv1/prove", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proved = Result{}
+	json.NewDecoder(res.Body).Decode(&proved)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for JSON inputs, got %d", res.StatusCode)
+	}
+	verify(t, vk, proved)
+	res, err = http.Get(server.URL + "/circuits/sum%2Fv1/inputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []InputField
+	json.NewDecoder(res.Body).Decode(&fields)
+	res.Body.Close()
+	if len(fields) != 2 || fields[0] != (InputField{Name: "Data", Type: InputTypeBytes, Size: 1024}) || fields[1] != (InputField{Name: "Sum", Type: InputTypeInteger}) {
+		t.Fatalf("unexpected fields %+v", fields)
+	}
+	res = post([2]string{"Data", string(data)}, [2]string{"Sum", "1"})
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an unsatisfied witness, got %d", res.StatusCode)
+	}
+
+	// the consent is given for the witness of the inputs
+	holder, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ResolveConsentKey = func(string) (*ecdsa.PublicKey, error) { return &holder.PublicKey, nil }
+	w, err := frontend.NewWitness(&sumCircuit{Data: common.BytesToU8Array(append(data, make([]byte, 1024-len(data))...)), Sum: 76800}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fullWitness, err := w.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := models.SignConsent(models.Consent{
+		Circuit:     "sum/v1",
+		InputDigest: models.InputDigest(fullWitness),
+		IssuedAt:    time.Now().Unix(),
+		ExpiresAt:   time.Now().Add(time.Minute).Unix(),
+	}, holder, "holder-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = post([2]string{"Data", string(data)}, [2]string{"Sum", "76800"}, [2]string{"consent", token})
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 with the consent, got %d", res.StatusCode)
+	}
+	res = post([2]string{"Data", string(data[1:])}, [2]string{"Sum", "76800"}, [2]string{"consent", token})
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for other inputs, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,366 @@
+package prover
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// JSONSchemaDialect is the JSON Schema draft of the input schema documents
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Patterns of the JSON inputs
+const (
+	// base64Pattern is the standard padded base64 of the binary inputs
+	base64Pattern = `^(?:[A-Za-z0-9+/]{4})*(?:[A-Za-z0-9+/]{2}==|[A-Za-z0-9+/]{3}=)?$`
+	// elementPattern is the canonical encoding of the elements (FormatElement)
+	elementPattern = `^0x(?:0|[1-9a-f][0-9a-f]*)$`
+	// integerPattern is a decimal or 0x hexadecimal integer string
+	integerPattern = `^(?:0|[1-9][0-9]*|0x[0-9a-fA-F]+)$`
+)
+
+// JSONSchema is a JSON Schema (draft 2020-12) document or subschema, of the
+// keywords describing the inputs of a circuit
+type JSONSchema struct {
+	Schema           string                 `json:"$schema,omitempty"`
+	ID               string                 `json:"$id,omitempty"`
+	Ref              string                 `json:"$ref,omitempty"`
+	Title            string                 `json:"title,omitempty"`
+	Description      string                 `json:"description,omitempty"`
+	Type             string                 `json:"type,omitempty"`
+	Properties       map[string]*JSONSchema `json:"properties,omitempty"`
+	Required         []string               `json:"required,omitempty"`
+	PropertyNames    *JSONSchema            `json:"propertyNames,omitempty"`
+	Enum             []string               `json:"enum,omitempty"`
+	AllOf            []*JSONSchema          `json:"allOf,omitempty"`
+	OneOf            []*JSONSchema          `json:"oneOf,omitempty"`
+	Pattern          string                 `json:"pattern,omitempty"`
+	MaxLength        int                    `json:"maxLength,omitempty"`
+	Minimum          json.Number            `json:"minimum,omitempty"`
+	ExclusiveMaximum json.Number            `json:"exclusiveMaximum,omitempty"`
+	ContentEncoding  string                 `json:"contentEncoding,omitempty"`
+	ContentMedia     string                 `json:"contentMediaType,omitempty"`
+	Defs             map[string]*JSONSchema `json:"$defs,omitempty"`
+}
+
+// JSONSchema returns the standalone JSON Schema document of the JSON prove
+// request of the circuit ({"inputs", "consent"}, ProveRequest), identified
+// by its path on the farm (GET /circuits/{circuit}/schema.json). The inputs
+// are described by their visibility, #/$defs/public and #/$defs/secret, and
+// together by #/$defs/inputs, the object wallets validate before upload.
+//
+// The schema bounds the encodings; the values are checked further when
+// decoded (DecodeJSON): a binary input against its exact size, an element
+// below the modulus of its field.
+func (s *InputSchema) JSONSchema(circuit string) *JSONSchema {
+	doc := &JSONSchema{
+		Schema: JSONSchemaDialect,
+		ID:     "/circuits/" + url.PathEscape(circuit) + "/schema.json",
+		Title:  fmt.Sprintf("Prove request of circuit %s", circuit),
+		Type:   "object",
+		Properties: map[string]*JSONSchema{
+			"inputs":  {Ref: "#/$defs/inputs"},
+			"consent": {Type: "string", Description: "consent token of the holder (models.SignConsent)"},
+		},
+		Required:      []string{"inputs"},
+		PropertyNames: &JSONSchema{Enum: []string{"consent", "inputs"}},
+		Defs: map[string]*JSONSchema{
+			"public": {Title: "Public inputs", Type: "object", Properties: map[string]*JSONSchema{}},
+			"secret": {Title: "Secret inputs", Type: "object", Properties: map[string]*JSONSchema{}},
+			"inputs": {
+				Title:         "Inputs",
+				Type:          "object",
+				AllOf:         []*JSONSchema{{Ref: "#/$defs/public"}, {Ref: "#/$defs/secret"}},
+				PropertyNames: &JSONSchema{Enum: s.Inputs()},
+			},
+		},
+	}
+	for _, name := range s.Inputs() {
+		in := s.inputs[name]
+		def := doc.Defs["secret"]
+		if in.public {
+			def = doc.Defs["public"]
+		}
+		def.Properties[name] = in.jsonSchema()
+		def.Required = append(def.Required, name)
+	}
+	return doc
+}
+
+// jsonSchema describes the JSON encoding of the input (decodeJSON)
+func (in *input) jsonSchema() *JSONSchema {
+	switch in.kind {
+	case inputBytes:
+		return &JSONSchema{
+			Type:            "string",
+			Description:     fmt.Sprintf("at most %d bytes, zero padded", len(in.indexes)),
+			ContentEncoding: "base64",
+			ContentMedia:    "application/octet-stream",
+			Pattern:         base64Pattern,
+			MaxLength:       4 * ((len(in.indexes) + 2) / 3),
+		}
+	case inputElement:
+		bits := limbBits * len(in.indexes)
+		description := fmt.Sprintf("emulated field element of %d limbs, canonical 0x hexadecimal", len(in.indexes))
+		if in.modulus != nil {
+			bits = in.modulus.BitLen()
+			description += " below " + FormatElement(in.modulus)
+		}
+		return &JSONSchema{
+			Type:        "string",
+			Description: description,
+			Pattern:     elementPattern,
+			MaxLength:   2 + (bits+3)/4,
+		}
+	}
+	return &JSONSchema{
+		Description: "element of the scalar field, a number or a decimal or 0x hexadecimal string",
+		OneOf: []*JSONSchema{
+			{Type: "integer", Minimum: "0", ExclusiveMaximum: json.Number(fr.Modulus().String())},
+			{Type: "string", Pattern: integerPattern, MaxLength: len(fr.Modulus().String())},
+		},
+	}
+}
+
+// SchemaError is a value of a prove request failing a keyword of the input
+// schema
+type SchemaError struct {
+	// Path is the JSON pointer of the value in the request, e.g.
+	// /inputs/CertBytes
+	Path string `json:"path"`
+	// Keyword is the JSON pointer of the failing keyword in the schema
+	// document
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+func (e SchemaError) String() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + e.Message
+}
+
+// SchemaErrors are the failures of a prove request validated against the
+// input schema, matching ErrInvalidInput
+type SchemaErrors []SchemaError
+
+func (e SchemaErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.String()
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidInput, strings.Join(messages, "; "))
+}
+
+// Is matches ErrInvalidInput
+func (e SchemaErrors) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+// ValidateJSON validates the JSON inputs of a prove request
+// (ProveRequest.Inputs) against #/$defs/inputs of the JSON schema, all the
+// failures returned in SchemaErrors
+func (s *InputSchema) ValidateJSON(inputs map[string]json.RawMessage) error {
+	instance := make(map[string]any, len(inputs))
+	for name, raw := range inputs {
+		var value any
+		dec := json.NewDecoder(strings.NewReader(string(raw)))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return SchemaErrors{{Path: "/inputs/" + escapePointer(name), Message: err.Error()}}
+		}
+		instance[name] = value
+	}
+	doc := s.JSONSchema("")
+	v := &schemaValidator{root: doc}
+	v.validate(doc.Defs["inputs"], instance, "/inputs", "/$defs/inputs")
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// Validate validates a JSON value, decoded with json.Decoder.UseNumber,
+// against the document, all the failures returned in SchemaErrors
+func (s *JSONSchema) Validate(instance any) error {
+	v := &schemaValidator{root: s}
+	v.validate(s, instance, "", "")
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// schemaValidator validates an instance against the keywords of JSONSchema,
+// the references resolved in the $defs of its root
+type schemaValidator struct {
+	root   *JSONSchema
+	errors SchemaErrors
+}
+
+func (v *schemaValidator) fail(path, keyword, format string, args ...any) {
+	v.errors = append(v.errors, SchemaError{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate records the failures of the instance at path against the schema
+// at keyword
+func (v *schemaValidator) validate(s *JSONSchema, instance any, path, keyword string) {
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		def, found := v.root.Defs[name]
+		if !ok || !found {
+			v.fail(path, keyword+"/$ref", "unresolved reference %s", s.Ref)
+			return
+		}
+		v.validate(def, instance, path, keyword+"/$ref")
+	}
+	if s.Type != "" && !hasType(instance, s.Type) {
+		v.fail(path, keyword+"/type", "expected %s, got %s", s.Type, typeOf(instance))
+		return
+	}
+	if len(s.Enum) > 0 {
+		if str, ok := instance.(string); !ok || !slices.Contains(s.Enum, str) {
+			v.fail(path, keyword+"/enum", "not one of %s", strings.Join(s.Enum, ", "))
+		}
+	}
+	for i, sub := range s.AllOf {
+		v.validate(sub, instance, path, keyword+"/allOf/"+strconv.Itoa(i))
+	}
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, sub := range s.OneOf {
+			sv := &schemaValidator{root: v.root}
+			if sv.validate(sub, instance, path, keyword); len(sv.errors) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(path, keyword+"/oneOf", "matches %d of the oneOf schemas, expected 1", matched)
+		}
+	}
+
+	switch instance := instance.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := instance[name]; !ok {
+				v.fail(path+"/"+escapePointer(name), keyword+"/required", "missing")
+			}
+		}
+		names := make([]string, 0, len(instance))
+		for name := range instance {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if s.PropertyNames != nil && len(s.PropertyNames.Enum) > 0 && !slices.Contains(s.PropertyNames.Enum, name) {
+				v.fail(path+"/"+escapePointer(name), keyword+"/propertyNames", "unknown property")
+				continue
+			}
+			if sub, ok := s.Properties[name]; ok {
+				v.validate(sub, instance[name], path+"/"+escapePointer(name), keyword+"/properties/"+escapePointer(name))
+			}
+		}
+	case string:
+		if s.MaxLength > 0 && utf8.RuneCountInString(instance) > s.MaxLength {
+			v.fail(path, keyword+"/maxLength", "longer than %d characters", s.MaxLength)
+		}
+		if s.Pattern != "" && !compilePattern(s.Pattern).MatchString(instance) {
+			v.fail(path, keyword+"/pattern", "does not match %s", s.Pattern)
+		}
+	case json.Number:
+		n, _ := parseNumber(instance)
+		if s.Minimum != "" {
+			if minimum, _ := parseNumber(s.Minimum); n.Cmp(minimum) < 0 {
+				v.fail(path, keyword+"/minimum", "below %s", s.Minimum)
+			}
+		}
+		if s.ExclusiveMaximum != "" {
+			if maximum, _ := parseNumber(s.ExclusiveMaximum); n.Cmp(maximum) >= 0 {
+				v.fail(path, keyword+"/exclusiveMaximum", "not below %s", s.ExclusiveMaximum)
+			}
+		}
+	}
+}
+
+// hasType reports whether the instance is of the JSON Schema type
+func hasType(instance any, t string) bool {
+	switch instance := instance.(type) {
+	case map[string]any:
+		return t == "object"
+	case []any:
+		return t == "array"
+	case string:
+		return t == "string"
+	case bool:
+		return t == "boolean"
+	case nil:
+		return t == "null"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		n, err := parseNumber(instance)
+		return t == "integer" && err == nil && n.IsInt()
+	}
+	return false
+}
+
+// typeOf is the JSON Schema type of the instance, for the messages
+func typeOf(instance any) string {
+	for _, t := range []string{"object", "array", "string", "boolean", "null", "integer", "number"} {
+		if hasType(instance, t) {
+			return t
+		}
+	}
+	return fmt.Sprintf("%T", instance)
+}
+
+// parseNumber parses a JSON number exactly enough to compare it with the
+// scalar field modulus
+func parseNumber(n json.Number) (*big.Float, error) {
+	f, _, err := big.ParseFloat(string(n), 10, 512, big.ToNearestEven)
+	return f, err
+}
+
+var patterns sync.Map
+
+// compilePattern compiles the patterns of the input schemas, valid in both
+// ECMA-262 and RE2
+func compilePattern(pattern string) *regexp.Regexp {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(pattern)
+	patterns.Store(pattern, re)
+	return re
+}
+
+// escapePointer escapes a property name as a JSON pointer token (RFC 6901)
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+// errSchemaResponse is the body of a prove request failing the input schema
+type errSchemaResponse struct {
+	Error  string       `json:"error"`
+	Errors SchemaErrors `json:"errors"`
+}
+
+// schemaErrors returns the SchemaErrors of err, if any
+func schemaErrors(err error) (SchemaErrors, bool) {
+	var errs SchemaErrors
+	ok := errors.As(err, &errs)
+	return errs, ok
+}
@@ -0,0 +1,143 @@
+package prover
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/mynextid/eudi-zk/common"
+)
+
+func TestJSONSchema(t *testing.T) {
+	s, err := NewInputSchema(&inputsCircuit{Data: make([]uints.U8, 8), Times: make([]frontend.Variable, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := s.JSONSchema("test/v1")
+	if doc.Schema != JSONSchemaDialect || doc.ID != "/circuits/test%2Fv1/schema.json" {
+		t.Fatalf("unexpected document %s %s", doc.Schema, doc.ID)
+	}
+	if public := doc.Defs["public"].Required; !slices.Equal(public, []string{"Key", "Times_0", "Times_1"}) {
+		t.Fatalf("unexpected public inputs %v", public)
+	}
+	if secret := doc.Defs["secret"].Required; !slices.Equal(secret, []string{"Data", "Pos"}) {
+		t.Fatalf("unexpected secret inputs %v", secret)
+	}
+	if data := doc.Defs["secret"].Properties["Data"]; data.MaxLength != 12 || data.ContentEncoding != "base64" {
+		t.Fatalf("unexpected Data schema %+v", data)
+	}
+
+	valid := map[string]json.RawMessage{
+		"Data": json.RawMessage(`"YWJj"`), "Key": json.RawMessage(`"` + FormatElement(emulated.P256Fp{}.Modulus()) + `"`),
+		"Pos": json.RawMessage(`7`), "Times_0": json.RawMessage(`"0x1f"`), "Times_1": json.RawMessage(`20240301`),
+	}
+	if err := s.ValidateJSON(valid); err != nil {
+		t.Fatal(err)
+	}
+	// the schema does not bound the elements by their modulus, the decoding does
+	if _, err := s.DecodeJSON(valid); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput for the modulus, got %v", err)
+	}
+
+	for value, expected := range map[string]SchemaError{
+		`{"Data":"YWJjZGVmZ2hpams=","Key":"0x1","Pos":7,"Times_0":1,"Times_1":2}`: {Path: "/inputs/Data", Keyword: "/$defs/inputs/allOf/1/$ref/properties/Data/maxLength"},
+		`{"Data":"not base64","Key":"0x1","Pos":7,"Times_0":1,"Times_1":2}`:       {Path: "/inputs/Data", Keyword: "/$defs/inputs/allOf/1/$ref/properties/Data/pattern"},
+		`{"Data":"","Key":"0x01","Pos":7,"Times_0":1,"Times_1":2}`:                {Path: "/inputs/Key", Keyword: "/$defs/inputs/allOf/0/$ref/properties/Key/pattern"},
+		`{"Data":"","Key":1,"Pos":7,"Times_0":1,"Times_1":2}`:                     {Path: "/inputs/Key", Keyword: "/$defs/inputs/allOf/0/$ref/properties/Key/type"},
+		`{"Data":"","Key":"0x1","Pos":-7,"Times_0":1,"Times_1":2}`:                {Path: "/inputs/Pos", Keyword: "/$defs/inputs/allOf/1/$ref/properties/Pos/oneOf"},
+		`{"Data":"","Key":"0x1","Pos":7.5,"Times_0":1,"Times_1":2}`:               {Path: "/inputs/Pos", Keyword: "/$defs/inputs/allOf/1/$ref/properties/Pos/oneOf"},
+		`{"Data":"","Key":"0x1","Pos":"007","Times_0":1,"Times_1":2}`:             {Path: "/inputs/Pos", Keyword: "/$defs/inputs/allOf/1/$ref/properties/Pos/oneOf"},
+		`{"Data":"","Key":"0x1","Pos":7,"Times_0":1}`:                             {Path: "/inputs/Times_1", Keyword: "/$defs/inputs/allOf/0/$ref/required"},
+		`{"Data":"","Key":"0x1","Pos":7,"Times_0":1,"Times_1":2,"Other":1}`:       {Path: "/inputs/Other", Keyword: "/$defs/inputs/propertyNames"},
+		`{"Data":"","Key":"0x1","Pos":7,"Times_0":1,"Times_1":2,"Times/2":1}`:     {Path: "/inputs/Times~12", Keyword: "/$defs/inputs/propertyNames"},
+	} {
+		var inputs map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(value), &inputs); err != nil {
+			t.Fatal(err)
+		}
+		err := s.ValidateJSON(inputs)
+		var errs SchemaErrors
+		if !errors.As(err, &errs) || !errors.Is(err, ErrInvalidInput) || len(errs) != 1 {
+			t.Errorf("%s: expected one schema error, got %v", value, err)
+			continue
+		}
+		if errs[0].Path != expected.Path || errs[0].Keyword != expected.Keyword {
+			t.Errorf("%s: expected %s at %s, got %s at %s", value, expected.Path, expected.Keyword, errs[0].Path, errs[0].Keyword)
+		}
+	}
+
+	// the document validates whole prove requests too
+	var request any
+	dec := json.NewDecoder(strings.NewReader(`{"inputs":{"Data":"","Key":"0x1","Pos":7,"Times_0":1,"Times_1":2},"witness":"AA=="}`))
+	dec.UseNumber()
+	if err := dec.Decode(&request); err != nil {
+		t.Fatal(err)
+	}
+	var errs SchemaErrors
+	if err := doc.Validate(request); !errors.As(err, &errs) || len(errs) != 1 || errs[0].Path != "/witness" {
+		t.Fatalf("expected a schema error at /witness, got %v", err)
+	}
+}
+
+func TestHandlerJSONSchema(t *testing.T) {
+	template := &sumCircuit{Data: make([]uints.U8, 16)}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, _, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFarm(nil)
+	f.Register("sum/v1", common.NewProver(ccs, pk))
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	res, err := http.Get(server.URL + "/circuits/sum%2Fv1/schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a circuit without inputs, got %d", res.StatusCode)
+	}
+	if err := f.RegisterInputs("sum/v1", template); err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.Get(server.URL + "/circuits/sum%2Fv1/schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc JSONSchema
+	json.NewDecoder(res.Body).Decode(&doc)
+	res.Body.Close()
+	if res.Header.Get("Content-Type") != mediaTypeSchemaJSON || doc.Defs["public"].Properties["Sum"] == nil {
+		t.Fatalf("unexpected schema %s %+v", res.Header.Get("Content-Type"), doc)
+	}
+
+	body, _ := json.Marshal(ProveRequest{Inputs: map[string]json.RawMessage{
+		"Data": json.RawMessage(`"AQID"`), "Sum": json.RawMessage(`"six"`),
+	}})
+	res, err = http.Post(server.URL+"/circuits/sum%2Fv1/prove", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failed errSchemaResponse
+	json.NewDecoder(res.Body).Decode(&failed)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest || len(failed.Errors) != 1 || failed.Errors[0].Path != "/inputs/Sum" {
+		t.Fatalf("expected a 400 at /inputs/Sum, got %d %+v", res.StatusCode, failed)
+	}
+}
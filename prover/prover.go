@@ -0,0 +1,667 @@
+// Package prover serves proofs of registered circuits over HTTP, to users
+// waiting for a proof and to issuers pre-generating proofs for many users
+// (batch issuance):
+//
+//	POST /circuits/{circuit}/prove        one witness, interactive
+//	POST /circuits/{circuit}/prove/batch  witnesses of the circuit, the results
+//	                                      are streamed as they complete (NDJSON)
+//	GET  /circuits/{circuit}/inputs       named inputs of the circuit (InputField)
+//	GET  /circuits/{circuit}/schema.json  JSON Schema of the JSON prove requests
+//	                                      of the named inputs (InputSchema.JSONSchema)
+//	GET  /debug/circuits                  retained provers and their memory
+//	                                      estimate, with Farm.Debug (RetainedResponse)
+//
+// Witnesses are full witnesses in gnark binary encoding (witness.MarshalBinary),
+// base64 in JSON. A circuit registered with its inputs (Farm.RegisterInputs)
+// also accepts a multipart/form-data prove request of one part per input
+// (InputSchema), so the large binary inputs, e.g. a certificate, are streamed
+// into the witness instead of encoded whole in JSON, or a JSON prove request
+// of its named inputs (ProveRequest.Inputs), the emulated field elements,
+// e.g. signature R and S, in canonical 0x hexadecimal, validated against the
+// JSON Schema of the circuit with the JSON pointers of the failing values in
+// the 400 response. A holder sending its private inputs authorizes the proof
+// with a consent token (models.Consent), required when the farm has a
+// ResolveConsentKey; the result carries the token hash for the presentation
+// payload. The proofs of both endpoints are admitted by the same
+// admission.Controller: batch proofs run behind the interactive ones, within
+// the batch memory budget, so a batch does not starve the interactive
+// requests. A batch named by a job id is checkpointed (Farm.Checkpoints):
+// resubmitted after a crash of its worker, with or without its witnesses, it
+// resumes past the proofs already completed. A farm with an Attester signs
+// every proof with the key of its deployment (Result.Attestation), for the
+// relying parties to know which hosted service produced it. An unregistered
+// circuit (Farm.Unregister) releases its prover once the proofs in flight
+// are done, so a long-running farm rotating circuit versions does not retain
+// every proving key it served.
+package prover
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/admission"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// mediaTypeNDJSON is the media type of the streamed batch results, one JSON
+// object per line
+const mediaTypeNDJSON = "application/x-ndjson"
+
+// mediaTypeSchemaJSON is the media type of the input schema documents
+const mediaTypeSchemaJSON = "application/schema+json"
+
+// maxBodySize bounds the request bodies when Farm.MaxBodySize is 0 (a full
+// eudi-vc witness is a few hundred KB)
+const maxBodySize = 64 << 20
+
+var (
+	// ErrUnknownCircuit is returned for a circuit that is not registered
+	ErrUnknownCircuit = errors.New("unknown circuit")
+	// ErrInvalidConsent is returned for a missing or invalid consent token
+	ErrInvalidConsent = errors.New("invalid consent")
+)
+
+// ProveRequest is the body of POST /circuits/{circuit}/prove
+type ProveRequest struct {
+	Witness []byte `json:"witness,omitempty"`
+	// Inputs are the named inputs of a circuit registered with its inputs,
+	// in place of Witness, encoded as described by InputSchema.Fields
+	Inputs map[string]json.RawMessage `json:"inputs,omitempty"`
+	// Consent is the consent token of the holder (models.SignConsent) for
+	// the circuit and the witness
+	Consent string `json:"consent,omitempty"`
+}
+
+// BatchRequest is the body of POST /circuits/{circuit}/prove/batch
+type BatchRequest struct {
+	Witnesses [][]byte `json:"witnesses"`
+	// Job names the batch for its checkpoints, see Farm.ResumeBatch. A job
+	// already checkpointed is resumed without its witnesses.
+	Job string `json:"job,omitempty"`
+}
+
+// Result is the proof of a witness, or the error proving it. Index is the
+// position of the witness in the batch.
+type Result struct {
+	Index         int           `json:"index"`
+	Proof         []byte        `json:"proof,omitempty"`
+	PublicWitness []byte        `json:"public_witness,omitempty"`
+	ProveTime     time.Duration `json:"prove_time,omitempty"`
+	// Consent is the hash of the verified consent token
+	// (models.ConsentHash), for PresentationPayload.Consent
+	Consent string `json:"consent,omitempty"`
+	// Resumed is set for a proof of a former run of the job, loaded from its
+	// checkpoint
+	Resumed bool `json:"resumed,omitempty"`
+	// Attestation is the signature of the deployment over the proof, for a
+	// farm with an Attester (VerifyAttestation)
+	Attestation *Attestation `json:"attestation,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// Summary is the aggregate throughput of a batch
+type Summary struct {
+	Circuit   string `json:"circuit"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	// Resumed are the succeeded proofs loaded from the checkpoints of the job
+	Resumed int `json:"resumed,omitempty"`
+	// Elapsed is the wall time of the batch, ProveTime the sum of the prove
+	// times of its proofs proven in this run
+	Elapsed   time.Duration `json:"elapsed"`
+	ProveTime time.Duration `json:"prove_time"`
+	// ProofsPerSecond is the proofs proven in this run over Elapsed
+	ProofsPerSecond float64 `json:"proofs_per_second"`
+}
+
+// BatchEvent is a line of the batch response: a result as it completes, the
+// summary last
+type BatchEvent struct {
+	Result  *Result  `json:"result,omitempty"`
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+// Farm proves the witnesses of the registered circuits
+type Farm struct {
+	// Admission admits the proofs, unlimited when nil. The circuits must
+	// have a limit.
+	Admission *admission.Controller
+	// Workers is the number of concurrent proofs of a batch, 1 when 0
+	Workers int
+	// MaxBodySize bounds the request bodies, 64MB when 0
+	MaxBodySize int64
+	// ResolveConsentKey returns the holder key verifying a consent token.
+	// When set, the interactive proofs of the handler require the consent of
+	// the holder; batches are proven for an issuer, without consent.
+	ResolveConsentKey func(kid string) (*ecdsa.PublicKey, error)
+	// Now is the clock the consent expiries are checked against, time.Now
+	// when nil
+	Now func() time.Time
+	// Checkpoints persist the batch jobs for ResumeBatch, none when nil
+	Checkpoints *Checkpoints
+	// Attester signs the proofs of both endpoints (Result.Attestation), none
+	// are signed when nil
+	Attester *Attester
+	// Debug serves the retained provers and their memory estimates on
+	// GET /debug/circuits (Retained), which answers 404 when unset
+	Debug bool
+
+	mu      sync.RWMutex
+	provers map[string]*registered
+	inputs  map[string]*InputSchema
+	// retired are the unregistered provers with proofs in flight
+	retired []*registered
+
+	mux *http.ServeMux
+}
+
+// NewFarm returns a farm admitting its proofs with ctrl, nil for unlimited
+func NewFarm(ctrl *admission.Controller) *Farm {
+	f := &Farm{Admission: ctrl, provers: map[string]*registered{}, inputs: map[string]*InputSchema{}, mux: http.NewServeMux()}
+	f.mux.HandleFunc("POST /circuits/{circuit}/prove", f.handleProve)
+	f.mux.HandleFunc("POST /circuits/{circuit}/prove/batch", f.handleBatch)
+	f.mux.HandleFunc("GET /circuits/{circuit}/inputs", f.handleInputs)
+	f.mux.HandleFunc("GET /circuits/{circuit}/schema.json", f.handleJSONSchema)
+	f.mux.HandleFunc("GET /debug/circuits", f.handleRetained)
+	return f
+}
+
+// Register serves the circuit with the prover. The prover of a circuit
+// registered already is replaced, and released like with Unregister.
+func (f *Farm) Register(circuit string, p *common.Prover) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if e, ok := f.provers[circuit]; ok && e.prover != p {
+		f.retire(e)
+	}
+	f.provers[circuit] = &registered{circuit: circuit, prover: p, registeredAt: time.Now()}
+}
+
+// RegisterInputs accepts multipart and JSON input prove requests for the
+// circuit, circuit being the template it was compiled with
+func (f *Farm) RegisterInputs(name string, circuit frontend.Circuit) error {
+	s, err := NewInputSchema(circuit)
+	if err != nil {
+		return err
+	}
+	f.RegisterInputSchema(name, s)
+	return nil
+}
+
+// RegisterInputSchema accepts input prove requests for the circuit with
+// the input schema, e.g. with validators of its untrusted DER inputs
+// (InputSchema.Validate)
+func (f *Farm) RegisterInputSchema(name string, s *InputSchema) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inputs[name] = s
+}
+
+func (f *Farm) inputSchema(circuit string) (*InputSchema, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	s, ok := f.inputs[circuit]
+	return s, ok
+}
+
+func (f *Farm) prover(circuit string) (*common.Prover, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	e, ok := f.provers[circuit]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCircuit, circuit)
+	}
+	return e.prover, nil
+}
+
+// acquire admits a proof of the circuit
+func (f *Farm) acquire(ctx context.Context, circuit string, priority admission.Priority) (func(), error) {
+	if f.Admission == nil {
+		return func() {}, nil
+	}
+	return f.Admission.AcquirePriority(ctx, circuit, priority)
+}
+
+// VerifyConsent verifies the consent token of the holder for the witness of
+// the circuit and returns its hash; ErrInvalidConsent when it is missing,
+// invalid, expired or given for other inputs
+func (f *Farm) VerifyConsent(circuit string, fullWitness []byte, token string) (string, error) {
+	return f.verifyConsent(circuit, models.InputDigest(fullWitness), token)
+}
+
+// verifyConsent is VerifyConsent for the InputDigest of the full witness
+func (f *Farm) verifyConsent(circuit, inputDigest, token string) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("%w: no consent token", ErrInvalidConsent)
+	}
+	if f.ResolveConsentKey == nil {
+		return "", fmt.Errorf("%w: no holder key resolver", ErrInvalidConsent)
+	}
+	now := time.Now()
+	if f.Now != nil {
+		now = f.Now()
+	}
+	consent, err := models.ParseConsent(token, f.ResolveConsentKey, now)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidConsent, err)
+	}
+	if err := consent.CheckDigest(circuit, inputDigest); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidConsent, err)
+	}
+	return models.ConsentHash(token), nil
+}
+
+// Prove proves a witness of the circuit as an interactive request
+func (f *Farm) Prove(ctx context.Context, circuit string, fullWitness []byte) (*common.ProveResult, error) {
+	e, done, err := f.use(circuit)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	release, err := f.acquire(ctx, circuit, admission.Interactive)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if err := f.canceled(e); err != nil {
+		return nil, err
+	}
+	return e.prover.ProveWitness(fullWitness)
+}
+
+// ProveInputs proves a witness decoded from the inputs of the circuit as an
+// interactive request
+func (f *Farm) ProveInputs(ctx context.Context, circuit string, inputs *DecodedInputs) (*common.ProveResult, error) {
+	e, done, err := f.use(circuit)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	release, err := f.acquire(ctx, circuit, admission.Interactive)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if err := f.canceled(e); err != nil {
+		return nil, err
+	}
+	return e.prover.ProveDecoded(inputs.Witness)
+}
+
+// ProveBatch proves the witnesses of the circuit on Workers concurrent
+// proofs, admitted as batch proofs, and passes each result to yield as it
+// completes (one call at a time, in completion order). When ctx is done the
+// witnesses not started are not proven and ctx.Err() is returned with the
+// summary of the proven ones.
+func (f *Farm) ProveBatch(ctx context.Context, circuit string, witnesses [][]byte, yield func(Result)) (Summary, error) {
+	return f.proveBatch(ctx, circuit, "", witnesses, yield)
+}
+
+// ResumeBatch proves the witnesses of the circuit like ProveBatch, as the job
+// checkpointed in Farm.Checkpoints: the witnesses are checkpointed first, then
+// every completed proof. The job rescheduled after a crash of its worker, with
+// its witnesses or without (nil), resumes past its completed proofs, yielded
+// as Resumed results; the failed ones are proven again. ErrUnknownJob is
+// returned for a job without checkpoints and no witnesses, ErrJobMismatch for
+// other witnesses than the checkpointed ones.
+func (f *Farm) ResumeBatch(ctx context.Context, circuit, job string, witnesses [][]byte, yield func(Result)) (Summary, error) {
+	opened, err := f.openJob(ctx, circuit, job, witnesses)
+	if err != nil {
+		return Summary{Circuit: circuit, Total: len(witnesses)}, err
+	}
+	return f.proveBatch(ctx, circuit, job, opened, yield)
+}
+
+// openJob returns the witnesses of the job, see Checkpoints.open
+func (f *Farm) openJob(ctx context.Context, circuit, job string, witnesses [][]byte) ([][]byte, error) {
+	if _, err := f.prover(circuit); err != nil {
+		return nil, err
+	}
+	if f.Checkpoints == nil {
+		return nil, fmt.Errorf("%w: the farm has no checkpoints", ErrInvalidJob)
+	}
+	return f.Checkpoints.open(ctx, circuit, job, witnesses)
+}
+
+// proveBatch proves the witnesses of the job, not checkpointed when job is
+// empty
+func (f *Farm) proveBatch(ctx context.Context, circuit, job string, witnesses [][]byte, yield func(Result)) (Summary, error) {
+	summary := Summary{Circuit: circuit, Total: len(witnesses)}
+	e, done, err := f.use(circuit)
+	if err != nil {
+		return summary, err
+	}
+	defer done()
+	start := time.Now()
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range witnesses {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results := make(chan Result)
+	var wg sync.WaitGroup
+	for range max(f.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results <- f.proveBatched(ctx, job, e, i, witnesses[i])
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		switch {
+		case res.Error != "":
+			summary.Failed++
+		case res.Resumed:
+			summary.Succeeded++
+			summary.Resumed++
+		default:
+			summary.Succeeded++
+			summary.ProveTime += res.ProveTime
+		}
+		yield(res)
+	}
+
+	summary.Elapsed = time.Since(start)
+	if seconds := summary.Elapsed.Seconds(); seconds > 0 {
+		summary.ProofsPerSecond = float64(summary.Succeeded-summary.Resumed) / seconds
+	}
+	return summary, ctx.Err()
+}
+
+// proveBatched proves the witness at index i of a batch, or loads its proof
+// from the checkpoints of the job
+func (f *Farm) proveBatched(ctx context.Context, job string, e *registered, i int, fullWitness []byte) Result {
+	circuit := e.circuit
+	if job != "" {
+		if checkpoint, ok := f.Checkpoints.proof(ctx, circuit, job, i, fullWitness); ok {
+			return f.attest(circuit, Result{Index: i, Proof: checkpoint.Proof, PublicWitness: checkpoint.PublicWitness, ProveTime: checkpoint.ProveTime, Resumed: true})
+		}
+	}
+
+	release, err := f.acquire(ctx, circuit, admission.Batch)
+	if err != nil {
+		return Result{Index: i, Error: err.Error()}
+	}
+	defer release()
+	if err := f.canceled(e); err != nil {
+		return Result{Index: i, Error: err.Error()}
+	}
+
+	res, err := e.prover.ProveWitness(fullWitness)
+	if err != nil {
+		return Result{Index: i, Error: err.Error()}
+	}
+	if job != "" {
+		// kept when the batch is canceled
+		f.Checkpoints.saveProof(context.WithoutCancel(ctx), circuit, job, i, fullWitness, res)
+	}
+	return f.attest(circuit, Result{Index: i, Proof: res.Proof, PublicWitness: res.PublicWitness, ProveTime: res.ProveTime})
+}
+
+// attest signs the proof of the result with the Attester, the result fails
+// when it cannot be signed
+func (f *Farm) attest(circuit string, res Result) Result {
+	if f.Attester == nil {
+		return res
+	}
+	att, err := f.Attester.Attest(circuit, res.Proof)
+	if err != nil {
+		return Result{Index: res.Index, Error: err.Error()}
+	}
+	res.Attestation = att
+	return res
+}
+
+// ServeHTTP implements http.Handler
+func (f *Farm) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.ServeHTTP(w, r)
+}
+
+func (f *Farm) bodySize() int64 {
+	if f.MaxBodySize > 0 {
+		return f.MaxBodySize
+	}
+	return maxBodySize
+}
+
+func (f *Farm) handleProve(w http.ResponseWriter, r *http.Request) {
+	circuit := r.PathValue("circuit")
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		f.handleProveInputs(w, r)
+		return
+	}
+	var req ProveRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, f.bodySize())).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Inputs != nil {
+		f.handleProveJSONInputs(w, r, req)
+		return
+	}
+
+	var consent string
+	if f.ResolveConsentKey != nil {
+		if _, err := f.prover(circuit); err != nil {
+			f.writeError(w, err)
+			return
+		}
+		var err error
+		if consent, err = f.VerifyConsent(circuit, req.Witness, req.Consent); err != nil {
+			f.writeError(w, err)
+			return
+		}
+	}
+
+	res, err := f.Prove(r.Context(), circuit, req.Witness)
+	if err != nil {
+		f.writeError(w, err)
+		return
+	}
+	f.writeResult(w, circuit, Result{Proof: res.Proof, PublicWitness: res.PublicWitness, ProveTime: res.ProveTime, Consent: consent})
+}
+
+// writeResult answers an interactive proof, signed by the Attester
+func (f *Farm) writeResult(w http.ResponseWriter, circuit string, res Result) {
+	if res = f.attest(circuit, res); res.Error != "" {
+		http.Error(w, res.Error, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleProveInputs proves a multipart request of the inputs of the circuit
+func (f *Farm) handleProveInputs(w http.ResponseWriter, r *http.Request) {
+	circuit := r.PathValue("circuit")
+	s, ok := f.servedInputSchema(w, circuit)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, f.bodySize())
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	inputs, err := s.ReadMultipart(mr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.proveInputs(w, r, circuit, inputs)
+}
+
+// handleProveJSONInputs proves a JSON request of the inputs of the circuit
+func (f *Farm) handleProveJSONInputs(w http.ResponseWriter, r *http.Request, req ProveRequest) {
+	circuit := r.PathValue("circuit")
+	s, ok := f.servedInputSchema(w, circuit)
+	if !ok {
+		return
+	}
+	if len(req.Witness) > 0 {
+		http.Error(w, "both witness and inputs", http.StatusBadRequest)
+		return
+	}
+	if err := s.ValidateJSON(req.Inputs); err != nil {
+		writeSchemaErrors(w, err)
+		return
+	}
+	inputs, err := s.DecodeJSON(req.Inputs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	inputs.Consent = req.Consent
+	f.proveInputs(w, r, circuit, inputs)
+}
+
+// servedInputSchema returns the input schema of a served circuit, or writes
+// the error
+func (f *Farm) servedInputSchema(w http.ResponseWriter, circuit string) (*InputSchema, bool) {
+	if _, err := f.prover(circuit); err != nil {
+		f.writeError(w, err)
+		return nil, false
+	}
+	s, ok := f.inputSchema(circuit)
+	if !ok {
+		http.Error(w, fmt.Sprintf("circuit %q takes no named inputs", circuit), http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+	return s, true
+}
+
+// proveInputs proves the decoded inputs, with the consent of the holder
+func (f *Farm) proveInputs(w http.ResponseWriter, r *http.Request, circuit string, inputs *DecodedInputs) {
+	var consent string
+	if f.ResolveConsentKey != nil {
+		var err error
+		if consent, err = f.verifyConsent(circuit, inputs.InputDigest, inputs.Consent); err != nil {
+			f.writeError(w, err)
+			return
+		}
+	}
+
+	res, err := f.ProveInputs(r.Context(), circuit, inputs)
+	if err != nil {
+		f.writeError(w, err)
+		return
+	}
+	f.writeResult(w, circuit, Result{Proof: res.Proof, PublicWitness: res.PublicWitness, ProveTime: res.ProveTime, Consent: consent})
+}
+
+// handleInputs describes the named inputs of the circuit
+func (f *Farm) handleInputs(w http.ResponseWriter, r *http.Request) {
+	s, ok := f.inputSchema(r.PathValue("circuit"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("circuit %q takes no named inputs", r.PathValue("circuit")), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Fields())
+}
+
+// handleJSONSchema serves the JSON Schema of the JSON prove requests of the
+// circuit (InputSchema.JSONSchema)
+func (f *Farm) handleJSONSchema(w http.ResponseWriter, r *http.Request) {
+	circuit := r.PathValue("circuit")
+	s, ok := f.inputSchema(circuit)
+	if !ok {
+		http.Error(w, fmt.Sprintf("circuit %q takes no named inputs", circuit), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", mediaTypeSchemaJSON)
+	json.NewEncoder(w).Encode(s.JSONSchema(circuit))
+}
+
+// writeSchemaErrors answers a prove request failing the input schema with
+// the JSON pointers of the failing values
+func writeSchemaErrors(w http.ResponseWriter, err error) {
+	errs, ok := schemaErrors(err)
+	if !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(errSchemaResponse{Error: err.Error(), Errors: errs})
+}
+
+func (f *Farm) handleBatch(w http.ResponseWriter, r *http.Request) {
+	circuit := r.PathValue("circuit")
+	var req BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, f.bodySize())).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	witnesses := req.Witnesses
+	if req.Job != "" {
+		var err error
+		if witnesses, err = f.openJob(r.Context(), circuit, req.Job, witnesses); err != nil {
+			f.writeError(w, err)
+			return
+		}
+	} else if _, err := f.prover(circuit); err != nil {
+		f.writeError(w, err)
+		return
+	}
+
+	// the results are streamed: errors past this point are reported in the
+	// results
+	w.Header().Set("Content-Type", mediaTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	summary, _ := f.proveBatch(r.Context(), circuit, req.Job, witnesses, func(res Result) {
+		enc.Encode(BatchEvent{Result: &res})
+		rc.Flush()
+	})
+	enc.Encode(BatchEvent{Summary: &summary})
+}
+
+// writeError answers a proof that could not be admitted or failed
+func (f *Farm) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownCircuit), errors.Is(err, ErrUnknownJob):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidJob):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrJobMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrInvalidConsent):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, admission.ErrSaturated):
+		w.Header().Set("Retry-After", strconv.Itoa(f.Admission.RetryAfterSeconds()))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	}
+}
@@ -0,0 +1,355 @@
+package prover
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/mynextid/eudi-zk/admission"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// cubeCircuit proves knowledge of X with X^3 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+func newTestFarm(t *testing.T, ctrl *admission.Controller) (*Farm, groth16.VerifyingKey) {
+	t.Helper()
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFarm(ctrl)
+	f.Register("cube/v1", common.NewProver(ccs, pk))
+	return f, vk
+}
+
+func cubeWitness(t *testing.T, x, y int) []byte {
+	t.Helper()
+	w, err := frontend.NewWitness(&cubeCircuit{X: x, Y: y}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := w.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func verify(t *testing.T, vk groth16.VerifyingKey, res Result) {
+	t.Helper()
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(res.Proof)); err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publicWitness.UnmarshalBinary(res.PublicWitness); err != nil {
+		t.Fatal(err)
+	}
+	if err := groth16.Verify(proof, vk, publicWitness); err != nil {
+		t.Errorf("proof %d: %v", res.Index, err)
+	}
+}
+
+func TestProveBatch(t *testing.T) {
+	f, vk := newTestFarm(t, nil)
+	f.Workers = 3
+
+	witnesses := [][]byte{cubeWitness(t, 2, 8), cubeWitness(t, 3, 27), cubeWitness(t, 3, 28), cubeWitness(t, 4, 64), []byte("not a witness")}
+	seen := map[int]bool{}
+	summary, err := f.ProveBatch(context.Background(), "cube/v1", witnesses, func(res Result) {
+		if seen[res.Index] {
+			t.Errorf("result %d reported twice", res.Index)
+		}
+		seen[res.Index] = true
+		switch res.Index {
+		case 2, 4:
+			if res.Error == "" {
+				t.Errorf("witness %d: expected an error", res.Index)
+			}
+		default:
+			if res.Error != "" {
+				t.Fatalf("witness %d: %s", res.Index, res.Error)
+			}
+			verify(t, vk, res)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(witnesses) || summary.Total != 5 || summary.Succeeded != 3 || summary.Failed != 2 || summary.ProofsPerSecond <= 0 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	if _, err := f.ProveBatch(context.Background(), "cube/v2", witnesses, func(Result) {}); !errors.Is(err, ErrUnknownCircuit) {
+		t.Fatalf("expected ErrUnknownCircuit, got %v", err)
+	}
+}
+
+// TestBatchBehindInteractive checks that the batch proofs wait while the
+// admission budget is held by interactive proofs
+func TestBatchBehindInteractive(t *testing.T) {
+	ctrl, err := admission.NewController(admission.Config{
+		MemoryBudget: 1,
+		Limits:       map[string]admission.Limit{"cube/v1": {Memory: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _ := newTestFarm(t, ctrl)
+
+	release, err := ctrl.Acquire(context.Background(), "cube/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan Summary)
+	go func() {
+		summary, _ := f.ProveBatch(context.Background(), "cube/v1", [][]byte{cubeWitness(t, 2, 8)}, func(Result) {})
+		done <- summary
+	}()
+	for ctrl.Stats().BatchQueued != 1 {
+		select {
+		case <-done:
+			t.Fatal("batch proof admitted while the budget is in use")
+		default:
+		}
+	}
+	release()
+	if summary := <-done; summary.Succeeded != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+// TestUnregister checks that an unregistered prover is released once its
+// proofs in flight are done, and the proofs waiting for admission canceled
+func TestUnregister(t *testing.T) {
+	ctrl, err := admission.NewController(admission.Config{
+		MemoryBudget: 1,
+		MaxQueue:     1,
+		Limits:       map[string]admission.Limit{"cube/v1": {Memory: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _ := newTestFarm(t, ctrl)
+	p, _ := f.prover("cube/v1")
+
+	release, err := ctrl.Acquire(context.Background(), "cube/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := f.Prove(context.Background(), "cube/v1", cubeWitness(t, 2, 8))
+		done <- err
+	}()
+	// wait for the proof to be queued
+	for ctrl.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	retained := f.Retained()
+	if len(retained) != 1 || retained[0].InFlight != 1 || retained[0].Memory == 0 || retained[0].Constraints == 0 {
+		t.Fatalf("unexpected retained circuits %+v", retained)
+	}
+
+	if !f.Unregister("cube/v1") || f.Unregister("cube/v1") {
+		t.Fatal("expected the circuit to be unregistered once")
+	}
+	if retained := f.Retained(); len(retained) != 1 || !retained[0].Unregistered || p.MemoryEstimate() == 0 {
+		t.Fatalf("expected the prover to be retained until its proof is done, got %+v", retained)
+	}
+	release()
+	if err := <-done; !errors.Is(err, ErrUnknownCircuit) {
+		t.Fatalf("expected the waiting proof to be canceled, got %v", err)
+	}
+	if retained := f.Retained(); len(retained) != 0 || p.MemoryEstimate() != 0 {
+		t.Fatalf("expected the prover to be released, got %+v", retained)
+	}
+	if _, err := p.ProveWitness(cubeWitness(t, 2, 8)); !errors.Is(err, common.ErrProverClosed) {
+		t.Fatalf("expected ErrProverClosed, got %v", err)
+	}
+}
+
+func TestRetainedHandler(t *testing.T) {
+	f, _ := newTestFarm(t, nil)
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/debug/circuits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 without Debug, got %d", res.StatusCode)
+	}
+
+	f.Debug = true
+	res, err = http.Get(srv.URL + "/debug/circuits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body RetainedResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Circuits) != 1 || body.Circuits[0].Circuit != "cube/v1" || body.Memory != body.Circuits[0].Memory || body.Memory == 0 {
+		t.Fatalf("unexpected retained circuits %+v", body)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	f, vk := newTestFarm(t, nil)
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	body, _ := json.Marshal(ProveRequest{Witness: cubeWitness(t, 3, 27)})
+	res, err := http.Post(server.URL+"/circuits/cube%2Fv1/prove", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proved Result
+	if err := json.NewDecoder(res.Body).Decode(&proved); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.StatusCode)
+	}
+	verify(t, vk, proved)
+
+	body, _ = json.Marshal(BatchRequest{Witnesses: [][]byte{cubeWitness(t, 2, 8), cubeWitness(t, 2, 9)}})
+	res, err = http.Post(server.URL+"/circuits/cube%2Fv1/prove/batch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Type") != mediaTypeNDJSON {
+		t.Fatalf("unexpected content type %q", res.Header.Get("Content-Type"))
+	}
+	var events []BatchEvent
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var event BatchEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 3 || events[2].Summary == nil || events[2].Summary.Succeeded != 1 || events[2].Summary.Failed != 1 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	res, err = http.Post(server.URL+"/circuits/unknown/prove/batch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.StatusCode)
+	}
+}
+
+func TestConsent(t *testing.T) {
+	f, vk := newTestFarm(t, nil)
+	holder, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	f.Now = func() time.Time { return now }
+	f.ResolveConsentKey = func(kid string) (*ecdsa.PublicKey, error) {
+		if kid != "holder-1" {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return &holder.PublicKey, nil
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	witness := cubeWitness(t, 3, 27)
+	consentFor := func(circuit string, witness []byte, exp time.Time, kid string) string {
+		t.Helper()
+		token, err := models.SignConsent(models.Consent{
+			Circuit:     circuit,
+			InputDigest: models.InputDigest(witness),
+			IssuedAt:    now.Unix(),
+			ExpiresAt:   exp.Unix(),
+		}, holder, kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	prove := func(consent string) (*http.Response, Result) {
+		t.Helper()
+		body, _ := json.Marshal(ProveRequest{Witness: witness, Consent: consent})
+		res, err := http.Post(server.URL+"/circuits/cube%2Fv1/prove", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var result Result
+		if res.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res, result
+	}
+
+	token := consentFor("cube/v1", witness, now.Add(time.Minute), "holder-1")
+	res, result := prove(token)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.StatusCode)
+	}
+	if result.Consent != models.ConsentHash(token) {
+		t.Fatalf("unexpected consent hash %q", result.Consent)
+	}
+	verify(t, vk, result)
+
+	for name, consent := range map[string]string{
+		"no consent":    "",
+		"expired":       consentFor("cube/v1", witness, now, "holder-1"),
+		"other circuit": consentFor("cube/v2", witness, now.Add(time.Minute), "holder-1"),
+		"other inputs":  consentFor("cube/v1", cubeWitness(t, 2, 8), now.Add(time.Minute), "holder-1"),
+		"unknown key":   consentFor("cube/v1", witness, now.Add(time.Minute), "holder-2"),
+		"tampered":      token[:len(token)-4] + "AAAA",
+	} {
+		if res, _ := prove(consent); res.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", name, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package prover
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mynextid/eudi-zk/common"
+)
+
+// registered is a prover of the farm and the proofs it has in flight. An
+// unregistered prover is closed once its last proof is done.
+type registered struct {
+	circuit      string
+	prover       *common.Prover
+	registeredAt time.Time
+	// inFlight are the proofs and batches using the prover, guarded by
+	// Farm.mu like unregistered
+	inFlight     int
+	unregistered bool
+}
+
+// RetainedCircuit is a prover retained by a farm, registered or unregistered
+// with proofs in flight, see Farm.Retained
+type RetainedCircuit struct {
+	Circuit     string `json:"circuit"`
+	Constraints int    `json:"constraints"`
+	// Memory is the estimate of the memory retained by the constraint system
+	// and the proving key, in bytes (common.Prover.MemoryEstimate)
+	Memory uint64 `json:"memory"`
+	// InFlight are the proofs and batches in flight
+	InFlight     int       `json:"in_flight"`
+	RegisteredAt time.Time `json:"registered_at"`
+	// Unregistered is set for a prover released once its proofs in flight
+	// are done
+	Unregistered bool `json:"unregistered,omitempty"`
+}
+
+// RetainedResponse is the response of GET /debug/circuits
+type RetainedResponse struct {
+	Circuits []RetainedCircuit `json:"circuits"`
+	// Memory is the estimate of the memory retained by all the circuits, in
+	// bytes
+	Memory uint64 `json:"memory"`
+}
+
+// Unregister stops serving the circuit and releases its prover
+// (common.Prover.Close) once the proofs in flight are done; the proofs and
+// batch witnesses of the circuit waiting for admission are canceled. It
+// reports whether the circuit was registered.
+func (f *Farm) Unregister(circuit string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.provers[circuit]
+	if !ok {
+		return false
+	}
+	delete(f.provers, circuit)
+	delete(f.inputs, circuit)
+	f.retire(e)
+	return true
+}
+
+// Close unregisters every circuit of the farm, for an embedder shutting it
+// down; the provers are released as their proofs in flight are done
+func (f *Farm) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for circuit, e := range f.provers {
+		delete(f.provers, circuit)
+		f.retire(e)
+	}
+	clear(f.inputs)
+}
+
+// retire closes the prover of an unregistered entry, or keeps it until its
+// proofs in flight are done; f.mu is held
+func (f *Farm) retire(e *registered) {
+	e.unregistered = true
+	if e.inFlight == 0 {
+		e.prover.Close()
+		return
+	}
+	f.retired = append(f.retired, e)
+}
+
+// use returns the registered prover of the circuit, counted in flight until
+// done is called
+func (f *Farm) use(circuit string) (e *registered, done func(), err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.provers[circuit]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownCircuit, circuit)
+	}
+	e.inFlight++
+	return e, func() { f.release(e) }, nil
+}
+
+// release ends a use of the entry, closing an unregistered prover with its
+// last proof
+func (f *Farm) release(e *registered) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.inFlight--
+	if e.inFlight > 0 || !e.unregistered {
+		return
+	}
+	e.prover.Close()
+	f.retired = slices.DeleteFunc(f.retired, func(r *registered) bool { return r == e })
+}
+
+// canceled returns ErrUnknownCircuit once the circuit of the entry is
+// unregistered, for the proofs admitted after it
+func (f *Farm) canceled(e *registered) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if e.unregistered {
+		return fmt.Errorf("%w %q: unregistered", ErrUnknownCircuit, e.circuit)
+	}
+	return nil
+}
+
+// Retained returns the provers retained by the farm, by circuit: the
+// registered ones and the unregistered ones with proofs in flight
+func (f *Farm) Retained() []RetainedCircuit {
+	f.mu.RLock()
+	entries := slices.Concat(slices.Collect(maps.Values(f.provers)), f.retired)
+	retained := make([]RetainedCircuit, 0, len(entries))
+	for _, e := range entries {
+		retained = append(retained, RetainedCircuit{
+			Circuit:      e.circuit,
+			InFlight:     e.inFlight,
+			RegisteredAt: e.registeredAt,
+			Unregistered: e.unregistered,
+		})
+	}
+	f.mu.RUnlock()
+
+	// the estimates lock each prover, outside the lock of the farm
+	for i, e := range entries {
+		retained[i].Constraints = e.prover.NbConstraints()
+		retained[i].Memory = e.prover.MemoryEstimate()
+	}
+	slices.SortFunc(retained, func(a, b RetainedCircuit) int { return strings.Compare(a.Circuit, b.Circuit) })
+	return retained
+}
+
+// handleRetained serves the retained provers with Farm.Debug
+func (f *Farm) handleRetained(w http.ResponseWriter, r *http.Request) {
+	if !f.Debug {
+		http.NotFound(w, r)
+		return
+	}
+	res := RetainedResponse{Circuits: f.Retained()}
+	for _, c := range res.Circuits {
+		res.Memory += c.Memory
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultFailureWindow is the window of the client failure rates when
+// AnomalyConfig.Window is 0
+const defaultFailureWindow = time.Minute
+
+// defaultBlockDuration is the block of a client when
+// AnomalyConfig.BlockDuration is 0
+const defaultBlockDuration = 15 * time.Minute
+
+// maxTrackedClients bounds the clients tracked in a window, the clients past
+// it share the otherClients counters and are not throttled
+const maxTrackedClients = 10000
+
+const otherClients = "other"
+
+// invalidProofClasses are the failure classes counted in the invalid proof
+// ratio of the clients: the proof or its witness is wrong, what a prober
+// forging inputs gets. Unknown circuits, version mismatches and policy
+// violations are recorded but do not count.
+var invalidProofClasses = map[ProblemType]bool{
+	ProblemProofFailed:           true,
+	ProblemWitnessInvalid:        true,
+	ProblemMalformedProof:        true,
+	ProblemPublicInputCount:      true,
+	ProblemUnsatisfiedConstraint: true,
+	ProblemPresentationInvalid:   true,
+}
+
+// AnomalyConfig throttles and blocks the clients of the verify endpoints
+// with an anomalous ratio of invalid proofs, repeated invalid proofs being
+// the mark of a client probing the circuits. Clients are identified by their
+// API key, or their address without API keys.
+type AnomalyConfig struct {
+	// Window is the window of the failure rates in seconds, a minute when 0
+	Window int64 `json:"window,omitempty"`
+	// MinRequests is the number of verifications of a client in a window
+	// before its ratio is judged
+	MinRequests int64 `json:"min_requests,omitempty"`
+	// ThrottleRatio is the invalid proof ratio (0 to 1) over which a client
+	// is held to one verification per ThrottleInterval seconds for a window;
+	// no throttling when 0
+	ThrottleRatio    float64 `json:"throttle_ratio,omitempty"`
+	ThrottleInterval int64   `json:"throttle_interval,omitempty"`
+	// BlockRatio is the invalid proof ratio over which a client is rejected
+	// for BlockDuration seconds, 15 minutes when 0; no blocking when 0
+	BlockRatio    float64 `json:"block_ratio,omitempty"`
+	BlockDuration int64   `json:"block_duration,omitempty"`
+}
+
+// validate checks the ratios and durations
+func (c *AnomalyConfig) validate() error {
+	if c.Window < 0 || c.MinRequests < 0 || c.ThrottleInterval < 0 || c.BlockDuration < 0 {
+		return fmt.Errorf("anomaly: negative window, min_requests, throttle_interval or block_duration")
+	}
+	if c.ThrottleRatio < 0 || c.ThrottleRatio > 1 || c.BlockRatio < 0 || c.BlockRatio > 1 {
+		return fmt.Errorf("anomaly: ratios must be within [0, 1]")
+	}
+	if c.ThrottleRatio > 0 && c.ThrottleInterval == 0 {
+		return fmt.Errorf("anomaly: throttle_ratio without throttle_interval")
+	}
+	return nil
+}
+
+func (c *AnomalyConfig) window() time.Duration {
+	if c == nil || c.Window == 0 {
+		return defaultFailureWindow
+	}
+	return time.Duration(c.Window) * time.Second
+}
+
+// ClientFailures are the verifications of a client in the current window
+type ClientFailures struct {
+	Requests int64 `json:"requests"`
+	// Invalid are the failures of the invalid proof classes
+	Invalid int64 `json:"invalid"`
+	// Classes are the failures by problem type (its last path segment)
+	Classes map[string]int64 `json:"classes,omitempty"`
+	// ThrottledUntil and BlockedUntil are set for a throttled or blocked
+	// client
+	ThrottledUntil time.Time `json:"throttled_until,omitzero"`
+	BlockedUntil   time.Time `json:"blocked_until,omitzero"`
+}
+
+// FailureStats are the verification failures of the server
+type FailureStats struct {
+	// Verifications and Classes count the verifications and their failures
+	// by class since the start of the server
+	Verifications int64            `json:"verifications"`
+	Classes       map[string]int64 `json:"classes"`
+	// Throttled and Blocked count the requests rejected by AnomalyConfig
+	Throttled int64 `json:"throttled"`
+	Blocked   int64 `json:"blocked"`
+	// Clients are the clients of the current window, and the throttled and
+	// blocked ones, by client id
+	Clients map[string]ClientFailures `json:"clients"`
+}
+
+// penalty is the throttling or block of a client, kept across windows
+type penalty struct {
+	throttledUntil time.Time
+	lastAllowed    time.Time
+	blockedUntil   time.Time
+}
+
+// failureMonitor tracks the verification failures of the clients, it
+// outlives the reloads of the configuration
+type failureMonitor struct {
+	mu            sync.Mutex
+	verifications int64
+	classes       map[string]int64
+	throttled     int64
+	blocked       int64
+	windowStart   time.Time
+	clients       map[string]*ClientFailures
+	penalties     map[string]*penalty
+}
+
+func newFailureMonitor() *failureMonitor {
+	return &failureMonitor{classes: map[string]int64{}, clients: map[string]*ClientFailures{}, penalties: map[string]*penalty{}}
+}
+
+// clientID identifies the client of a request: a digest of its API key, or
+// its address
+func clientID(r *http.Request) string {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && key != "" {
+		digest := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(digest[:8])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// roll starts a new window when the current one is over, the expired
+// penalties are dropped
+func (m *failureMonitor) roll(cfg *AnomalyConfig, now time.Time) {
+	if now.Sub(m.windowStart) < cfg.window() {
+		return
+	}
+	m.windowStart = now
+	clear(m.clients)
+	for id, p := range m.penalties {
+		if now.After(p.throttledUntil) && now.After(p.blockedUntil) {
+			delete(m.penalties, id)
+		}
+	}
+}
+
+// admit checks the penalty of the client before a verification, it returns
+// the problem of a rejected request
+func (m *failureMonitor) admit(client string, cfg *AnomalyConfig, now time.Time) *Problem {
+	if cfg == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roll(cfg, now)
+
+	p := m.penalties[client]
+	switch {
+	case p == nil:
+		return nil
+	case now.Before(p.blockedUntil):
+		m.blocked++
+		return newProblem(ProblemClientBlocked, http.StatusForbidden, "too many invalid proofs, blocked until "+p.blockedUntil.UTC().Format(time.RFC3339))
+	case now.Before(p.throttledUntil):
+		interval := time.Duration(cfg.ThrottleInterval) * time.Second
+		if wait := p.lastAllowed.Add(interval).Sub(now); wait > 0 {
+			m.throttled++
+			problem := newProblem(ProblemTooManyRequests, http.StatusTooManyRequests, "too many invalid proofs, throttled")
+			problem.retryAfter = int((wait + time.Second - 1) / time.Second)
+			return problem
+		}
+		p.lastAllowed = now
+	}
+	return nil
+}
+
+// record records the outcome of a verification, class is the type of its
+// problem or empty for a verified proof, and penalizes the client past the
+// ratios
+func (m *failureMonitor) record(client string, class ProblemType, cfg *AnomalyConfig, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roll(cfg, now)
+
+	m.verifications++
+	name := strings.TrimPrefix(string(class), problemBaseURI)
+	if class != "" {
+		m.classes[name]++
+	}
+
+	c, ok := m.clients[client]
+	if !ok {
+		if len(m.clients) >= maxTrackedClients {
+			client = otherClients
+		}
+		if c, ok = m.clients[client]; !ok {
+			c = &ClientFailures{}
+			m.clients[client] = c
+		}
+	}
+	c.Requests++
+	if class != "" {
+		if c.Classes == nil {
+			c.Classes = map[string]int64{}
+		}
+		c.Classes[name]++
+	}
+	if invalidProofClasses[class] {
+		c.Invalid++
+	}
+
+	if cfg == nil || client == otherClients || c.Requests < max(cfg.MinRequests, 1) {
+		return
+	}
+	ratio := float64(c.Invalid) / float64(c.Requests)
+	p := m.penalties[client]
+	if p == nil {
+		p = &penalty{}
+	}
+	switch {
+	case cfg.BlockRatio > 0 && ratio >= cfg.BlockRatio:
+		duration := time.Duration(cfg.BlockDuration) * time.Second
+		if duration == 0 {
+			duration = defaultBlockDuration
+		}
+		p.blockedUntil = now.Add(duration)
+	case cfg.ThrottleRatio > 0 && ratio >= cfg.ThrottleRatio:
+		if !now.Before(p.throttledUntil) {
+			p.lastAllowed = now
+		}
+		p.throttledUntil = now.Add(cfg.window())
+	default:
+		return
+	}
+	m.penalties[client] = p
+}
+
+// stats returns the failures and the clients of the current window
+func (m *failureMonitor) stats() FailureStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := FailureStats{
+		Verifications: m.verifications,
+		Classes:       make(map[string]int64, len(m.classes)),
+		Throttled:     m.throttled,
+		Blocked:       m.blocked,
+		Clients:       make(map[string]ClientFailures, len(m.clients)),
+	}
+	for name, n := range m.classes {
+		stats.Classes[name] = n
+	}
+	for id, c := range m.clients {
+		client := *c
+		client.Classes = make(map[string]int64, len(c.Classes))
+		for name, n := range c.Classes {
+			client.Classes[name] = n
+		}
+		stats.Clients[id] = client
+	}
+	for id, p := range m.penalties {
+		client := stats.Clients[id]
+		client.ThrottledUntil, client.BlockedUntil = p.throttledUntil, p.blockedUntil
+		stats.Clients[id] = client
+	}
+	return stats
+}
+
+// FailureStats returns the verification failures by class and by client
+func (s *Server) FailureStats() FailureStats {
+	return s.failures.stats()
+}
+
+// PublishFailures exposes the verification failures as the expvar variable
+// name (served on /debug/vars)
+func (s *Server) PublishFailures(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return s.FailureStats() }))
+}
+
+// checkClient rejects the requests of a throttled or blocked client, it
+// reports whether the request may go on
+func (s *Server) checkClient(w http.ResponseWriter, r *http.Request, st *state, client string) bool {
+	p := s.failures.admit(client, st.anomaly, time.Now())
+	if p == nil {
+		return true
+	}
+	if p.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(p.retryAfter))
+	}
+	writeProblem(w, r, p)
+	return false
+}
+
+// recordVerification records the outcome of a verification of the client,
+// p is nil for a verified proof
+func (s *Server) recordVerification(st *state, client string, p *Problem) {
+	var class ProblemType
+	if p != nil {
+		class = p.Type
+	}
+	s.failures.record(client, class, st.anomaly, time.Now())
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/extension"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// CapabilitiesResponse is the response of GET /capabilities: the features of
+// the build (its build tags) and of the served configuration, for the
+// clients to adapt to a deployment instead of probing it
+type CapabilitiesResponse struct {
+	ProtocolVersion int `json:"protocol_version"`
+	// Mode is the artifact mode of the process (common.Mode)
+	Mode common.Mode `json:"mode"`
+	// Backends are the proof systems verified, Curves their curves
+	Backends []string `json:"backends"`
+	Curves   []string `json:"curves"`
+	// HashGadgets are the hash functions of the in-circuit gadgets
+	HashGadgets []string `json:"hash_gadgets"`
+	// Algs are the presentation algs the build supports (models.SupportedAlgs),
+	// AcceptedAlgs the ones the verifier accepts in preference order
+	Algs         []string `json:"algs"`
+	AcceptedAlgs []string `json:"accepted_algs"`
+	// Async reports whether verifications can be submitted and polled, the
+	// verify endpoints answer synchronously
+	Async    bool                    `json:"async"`
+	Features Features                `json:"features"`
+	Limits   Limits                  `json:"limits"`
+	Circuits []models.CatalogCircuit `json:"circuits"`
+}
+
+// Features are the optional features of CapabilitiesResponse
+type Features struct {
+	// PostQuantum is the hybrid ES256 + ML-DSA-65 presentation alg, in the
+	// builds with Go 1.27
+	PostQuantum bool `json:"post_quantum"`
+	// Plugins are the circuits loaded from Go plugins (extension.Open), in
+	// the builds with the tag plugins
+	Plugins bool `json:"plugins"`
+	// FaultInjection is FaultHeader, in the builds with the tag chaos
+	FaultInjection bool `json:"fault_injection"`
+	// EncryptedPresentations are the presentations encrypted to the verifier
+	EncryptedPresentations bool `json:"encrypted_presentations"`
+	// Catalog, Registry and Costs are GET /catalog, /vks and
+	// /circuits/{circuit}/cost
+	Catalog  bool `json:"catalog"`
+	Registry bool `json:"registry"`
+	Costs    bool `json:"costs"`
+	// Policy is the verification policy checked on the presentations
+	Policy bool `json:"policy"`
+	// ChannelBinding is the binding of the nonces of GET /challenge
+	// (ChannelBindingConfig.Type), none when empty
+	ChannelBinding string `json:"channel_binding,omitempty"`
+}
+
+// handleCapabilities serves the capabilities of the build and of the
+// configuration of the request
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request, st *state) {
+	limits := Limits{MaxBodySize: st.maxBodySize, MaxConcurrent: cap(st.sem)}
+	writeResponse(w, r, http.StatusOK, CapabilitiesResponse{
+		ProtocolVersion: ProtocolVersion,
+		Mode:            common.CurrentMode(),
+		Backends:        []string{"groth16"},
+		Curves:          []string{"bn254"},
+		HashGadgets:     []string{"sha256"},
+		Algs:            models.SupportedAlgs(),
+		AcceptedAlgs:    st.verifier.AcceptedAlgs(),
+		Features: Features{
+			PostQuantum:            slices.Contains(models.SupportedAlgs(), models.AlgES256MLDSA65),
+			Plugins:                extension.PluginsEnabled,
+			FaultInjection:         faultInjection,
+			EncryptedPresentations: st.decryption != nil,
+			Catalog:                st.catalog != nil,
+			Registry:               st.registry != nil,
+			Costs:                  st.costs != nil,
+			Policy:                 st.policy != nil,
+			ChannelBinding:         st.channelBinding(),
+		},
+		Limits:   limits,
+		Circuits: st.verifier.Catalog(),
+	})
+}
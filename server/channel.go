@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// defaultSessionCookie is the cookie of the session identifier of the
+// session channel binding
+const defaultSessionCookie = "session"
+
+// ChannelBindingConfig binds the nonces of GET /challenge to the channel of
+// the request: POST /presentations/verify rejects the presentations whose
+// nonce, and session transcript nonce, were issued for another channel, so a
+// proof cannot be relayed from the connection of another verifier
+type ChannelBindingConfig struct {
+	// Type is models.ChannelBindingTLSExporter, the TLS 1.3 connection served
+	// by the server, or models.ChannelBindingSession, the session cookie of
+	// a server behind a TLS terminating proxy
+	Type string `json:"type"`
+	// SessionCookie is the cookie of the session identifier, "session" when
+	// empty
+	SessionCookie string `json:"session_cookie,omitempty"`
+}
+
+func (c *ChannelBindingConfig) validate() error {
+	switch c.Type {
+	case models.ChannelBindingTLSExporter, models.ChannelBindingSession:
+		return nil
+	}
+	return fmt.Errorf("channel_binding: unknown type %q", c.Type)
+}
+
+func (c *ChannelBindingConfig) sessionCookie() string {
+	if c.SessionCookie == "" {
+		return defaultSessionCookie
+	}
+	return c.SessionCookie
+}
+
+// binding returns the channel binding of the request
+func (c *ChannelBindingConfig) binding(r *http.Request) ([]byte, error) {
+	if c.Type == models.ChannelBindingTLSExporter {
+		return models.TLSExporterBinding(r.TLS)
+	}
+	cookie, err := r.Cookie(c.sessionCookie())
+	if err != nil || cookie.Value == "" {
+		return nil, fmt.Errorf("session channel binding without %s cookie", c.sessionCookie())
+	}
+	return models.SessionBinding(cookie.Value), nil
+}
+
+// ChallengeResponse is the response of GET /challenge
+type ChallengeResponse struct {
+	// Nonce is the nonce of the presentation (PresentationPayload.Nonce) and
+	// of its session transcript, base64url (models.ChannelNonce)
+	Nonce string `json:"nonce"`
+	// ChannelBinding is the binding the nonce was issued for
+	// (ChannelBindingConfig.Type), the nonce is not bound when empty
+	ChannelBinding string `json:"channel_binding,omitempty"`
+	// SessionCookie is the cookie of the session identifier of the session
+	// channel binding
+	SessionCookie string `json:"session_cookie,omitempty"`
+}
+
+// handleChallenge issues a nonce, bound to the channel of the request with a
+// channel binding and random otherwise
+func (s *Server) handleChallenge(w http.ResponseWriter, r *http.Request, st *state) {
+	if st.channel == nil {
+		nonce, err := common.RandomBytes(nil, models.ChannelNonceSize)
+		if err != nil {
+			writeProblem(w, r, newProblem(ProblemInternal, http.StatusInternalServerError, err.Error()))
+			return
+		}
+		writeResponse(w, r, http.StatusOK, ChallengeResponse{Nonce: models.ChannelNonce(nonce)})
+		return
+	}
+
+	binding, err := st.channel.binding(r)
+	if err != nil {
+		writeProblem(w, r, newProblem(ProblemInvalidRequest, http.StatusBadRequest, err.Error()))
+		return
+	}
+	nonce, err := models.NewChannelNonce(nil, binding)
+	if err != nil {
+		writeProblem(w, r, newProblem(ProblemInternal, http.StatusInternalServerError, err.Error()))
+		return
+	}
+	res := ChallengeResponse{Nonce: models.ChannelNonce(nonce), ChannelBinding: st.channel.Type}
+	if st.channel.Type == models.ChannelBindingSession {
+		res.SessionCookie = st.channel.sessionCookie()
+	}
+	writeResponse(w, r, http.StatusOK, res)
+}
+
+// channelBinding returns the type of the channel binding of the nonces, empty
+// when off
+func (st *state) channelBinding() string {
+	if st.channel == nil {
+		return ""
+	}
+	return st.channel.Type
+}
@@ -0,0 +1,703 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/mynextid/eudi-zk/artifact"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/cost"
+	"github.com/mynextid/eudi-zk/extension"
+	"github.com/mynextid/eudi-zk/federation"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/policy"
+)
+
+// Config is the reloadable configuration of the server, a JSON file:
+//
+//	{
+//	  "version": "2024-06-01",
+//	  "circuits": {"eudi-vc/pop/v1": {"verifying_key": "eudi-vc/pop/v1/vk.bin", "signer": "ops-2026", "schema": {"required": ["nonce"]}, "max_timestamp_skew": 60}},
+//	  "trusted_signers": {"ops-2026": "base64 Ed25519 public key"},
+//	  "costs": "costs.json",
+//	  "decryption_key": "verifier.jwk",
+//	  "catalog": {"signing_key": "catalog.jwk", "issuer": "https://verifier.example", "ttl": 86400},
+//	  "min_versions": {"warn_only": false, "deprecations": [{"circuit": "eudi-vc/pop", "min_version": 2, "enforce_at": 1767225600}]},
+//	  "vk_registry": true,
+//	  "mode": "verify-only",
+//	  "replication": {"manifest": "manifest.json", "serve": true},
+//	  "policy": "policy.yaml",
+//	  "diagnostics": true,
+//	  "anomaly": {"min_requests": 20, "throttle_ratio": 0.5, "throttle_interval": 5, "block_ratio": 0.9},
+//	  "api_keys": ["..."],
+//	  "admin_keys": ["..."],
+//	  "limits": {"max_body_size": 1048576, "max_concurrent": 16}
+//	}
+type Config struct {
+	// Version identifies the configuration on /healthz, the digest of the
+	// file when empty
+	Version string `json:"version,omitempty"`
+	// Circuits are the registered circuits by circuit id
+	Circuits map[string]CircuitConfig `json:"circuits"`
+	// Costs is the path of the cost manifest (cost.ReadManifest), relative to
+	// the configuration file; the cost endpoint answers 404 when empty
+	Costs string `json:"costs,omitempty"`
+	// TrustedSigners are the Ed25519 public keys (base64) signing the
+	// verifying keys, by key id. When set, a circuit is refused unless its
+	// verifying key has a valid signature (common.VerifyArtifactFromStore)
+	// of one of them.
+	TrustedSigners map[string]string `json:"trusted_signers,omitempty"`
+	// DecryptionKey is the path of the private JWK (P-256) of the verifier,
+	// relative to the configuration file; encrypted presentations are
+	// rejected when empty
+	DecryptionKey string `json:"decryption_key,omitempty"`
+	// Catalog signs the circuit catalog of GET /catalog, which answers 404
+	// when nil
+	Catalog *CatalogConfig `json:"catalog,omitempty"`
+	// MinVersions are the minimum versions of the circuit families, served
+	// in the catalog; every version is accepted when nil
+	MinVersions *MinVersionsConfig `json:"min_versions,omitempty"`
+	// PresentationAlgs are the accepted presentation algs in preference
+	// order, served in the catalog; every alg of the build when empty.
+	// ["ES256+ML-DSA-65"] requires post-quantum envelopes, verified with
+	// Options.ResolvePQKey.
+	PresentationAlgs []string `json:"presentation_algs,omitempty"`
+	// VKRegistry serves the verifying key registry (GET /vks/{hash}, POST
+	// /vks with an admin key) from the artifact store, under vks/
+	VKRegistry bool `json:"vk_registry,omitempty"`
+	// Mode is the mode of the process applied on load (common.SetMode), e.g.
+	// "verify-only" so that no circuit of the process is ever set up with
+	// local randomness; the mode is left unchanged when empty
+	Mode common.Mode `json:"mode,omitempty"`
+	// Replication checks the artifacts against the cluster manifest before
+	// serving them, and serves them to the replicas on GET /artifacts/{key}
+	// when Serve is set. Replicas (Options.Leader) replicate the manifest
+	// whether or not it is set.
+	Replication *ReplicationConfig `json:"replication,omitempty"`
+	// Policy is the path of the verification policy (policy.Load), relative
+	// to the configuration file, evaluated on the verified presentations of
+	// POST /presentations/verify; none when empty
+	Policy string `json:"policy,omitempty"`
+	// Diagnostics locates the verification failures in the problems of the
+	// verify endpoints: failure code and stage, and distinct problem types
+	// for malformed proofs and public input count mismatches. Opt-in: it
+	// tells a prober which check its input failed.
+	Diagnostics bool `json:"diagnostics,omitempty"`
+	// Anomaly throttles and blocks the clients with anomalous invalid proof
+	// ratios on the verify endpoints; the failures are counted whether or
+	// not it is set
+	Anomaly *AnomalyConfig `json:"anomaly,omitempty"`
+	// MaxPresentationAge bounds, in seconds, the age (iat) of the verified
+	// presentations whatever their exp; not checked when 0
+	MaxPresentationAge int64 `json:"max_presentation_age,omitempty"`
+	// ClockSkew tolerates, in seconds, the distance of the clocks of the
+	// holders in the checks of exp, cred_exp and MaxPresentationAge
+	ClockSkew int64 `json:"clock_skew,omitempty"`
+	// ReplayWindow rejects the presentations whose jti was verified already,
+	// remembered at least the window (seconds) and as long as the
+	// presentation can be accepted, and the presentations without jti or
+	// exp; replays are not checked when 0 (models.PresentationVerifier.Replay)
+	ReplayWindow int64 `json:"replay_window,omitempty"`
+	// ChannelBinding binds the nonces of GET /challenge to the channel of
+	// the request, checked on the presentations; the nonces are not bound
+	// when nil
+	ChannelBinding *ChannelBindingConfig `json:"channel_binding,omitempty"`
+	// APIKeys are accepted as Authorization: Bearer <key> by the verify and
+	// cost endpoints, which are not authenticated when empty
+	APIKeys []string `json:"api_keys,omitempty"`
+	// AdminKeys are accepted by POST /admin/reload and POST /vks, which are
+	// disabled when empty
+	AdminKeys []string `json:"admin_keys,omitempty"`
+	Limits    Limits   `json:"limits"`
+}
+
+// CircuitConfig is a circuit of Config
+type CircuitConfig struct {
+	// VerifyingKey is the key of the verifying key in the artifact store
+	VerifyingKey string `json:"verifying_key"`
+	// Signer is the key id of TrustedSigners expected to sign the verifying
+	// key, any of them when empty
+	Signer string `json:"signer,omitempty"`
+	// Schema is the payload schema of the presentations, optional; the schema
+	// of the circuit registered by an external package when empty
+	Schema *models.PayloadSchema `json:"schema,omitempty"`
+	// MaxTimestampSkew bounds, in seconds, the distance of the challenge
+	// timestamp of a circuit of Options.Timestamped to the server clock
+	MaxTimestampSkew int64 `json:"max_timestamp_skew,omitempty"`
+}
+
+// CatalogConfig is the catalog signer of Config
+type CatalogConfig struct {
+	// SigningKey is the path of the private JWK (P-256) signing the catalog,
+	// relative to the configuration file; its kid is the kid of the signature
+	SigningKey string `json:"signing_key"`
+	// Issuer is the iss of the catalog, optional
+	Issuer string `json:"issuer,omitempty"`
+	// TTL is the validity of a served catalog in seconds, a day when 0
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// MinVersionsConfig is the version policy of Config (models.VersionPolicy)
+type MinVersionsConfig struct {
+	// WarnOnly verifies the deprecated versions with a warning
+	// (VerifyResponse.Deprecation) instead of rejecting them
+	WarnOnly     bool                 `json:"warn_only,omitempty"`
+	Deprecations []models.Deprecation `json:"deprecations"`
+}
+
+// ReplicationConfig is the replication of the artifacts of Config
+type ReplicationConfig struct {
+	// Manifest is the key of the cluster manifest (artifact.Manifest) in the
+	// artifact store, artifact.ManifestKey when empty
+	Manifest string `json:"manifest,omitempty"`
+	// Serve serves the manifest and its artifacts on GET /artifacts/{key},
+	// for the replicas of a leader
+	Serve bool `json:"serve,omitempty"`
+}
+
+// Limits are the request limits of Config
+type Limits struct {
+	// MaxBodySize bounds the request bodies, 1MB when 0
+	MaxBodySize int64 `json:"max_body_size,omitempty"`
+	// MaxConcurrent is the maximum number of concurrent requests, further
+	// requests get 503; unlimited when 0
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+}
+
+// Options are the settings of NewFromConfig that are not read from the
+// configuration file
+type Options struct {
+	// ResolveKey resolves the holder keys of the presentations
+	ResolveKey func(header models.PresentationHeader) (*ecdsa.PublicKey, error)
+	// ResolvePQKey resolves the ML-DSA-65 holder keys of the hybrid
+	// presentations (models.PresentationVerifier.ResolvePQKey), optional
+	ResolvePQKey func(header models.PresentationHeader) ([]byte, error)
+	// Store holds the verifying keys, the directory of the configuration
+	// file when nil
+	Store artifact.Store
+	// Attributes are the circuit templates of the circuits with attribute
+	// slots (models.PresentationVerifier.AddAttributes), by circuit id
+	Attributes map[string]frontend.Circuit
+	// Timestamped are the circuit templates of the circuits with timestamped
+	// challenges (models.PresentationVerifier.AddTimestamp), by circuit id;
+	// their CircuitConfig sets the accepted skew
+	Timestamped map[string]frontend.Circuit
+	// Templates are the circuit templates the trust anchors of the policy are
+	// located in and the public inputs of the responses are labeled with
+	// (VerifyResponse.PublicInputs), by circuit id; the templates of
+	// Attributes and Timestamped, then of the circuits registered by
+	// external packages (extension.Register), are used for the circuits
+	// missing
+	Templates map[string]frontend.Circuit
+	// Leader is the store the replicas copy the artifacts of the cluster
+	// manifest from into Store on every load, e.g. an artifact.HTTPStore of
+	// the /artifacts of the leader or the object store the artifacts are
+	// published to
+	Leader artifact.Store
+	// RetryInterval is the delay between the replication attempts of
+	// NewReplica, 5 seconds when 0
+	RetryInterval time.Duration
+	// Federation resolves the OpenID Federation entities of the trust
+	// anchors of the policy, shared across reloads for its cache
+	Federation *federation.Client
+}
+
+// template returns the circuit template of a circuit id, from Templates,
+// Attributes or Timestamped, or of the circuit registered by an external
+// package (extension.Register)
+func (o *Options) template(id string) (frontend.Circuit, bool) {
+	for _, m := range []map[string]frontend.Circuit{o.Templates, o.Attributes, o.Timestamped} {
+		if template, ok := m[id]; ok {
+			return template, true
+		}
+	}
+	if c, ok := extension.Lookup(id); ok {
+		return c.Template(), true
+	}
+	return nil, false
+}
+
+// defaultRetryInterval is the delay between replication attempts when
+// Options.RetryInterval is 0
+const defaultRetryInterval = 5 * time.Second
+
+// HealthResponse is the response of GET /healthz and POST /admin/reload
+type HealthResponse struct {
+	Status string `json:"status"`
+	// ConfigVersion is the version of the applied configuration, empty for
+	// a server built with New
+	ConfigVersion string    `json:"config_version,omitempty"`
+	LoadedAt      time.Time `json:"loaded_at,omitzero"`
+	Circuits      []string  `json:"circuits,omitempty"`
+	// ManifestVersion is the version of the cluster manifest the artifacts
+	// match, when replicated
+	ManifestVersion string `json:"manifest_version,omitempty"`
+}
+
+// ReadConfig reads a configuration file, unknown members are rejected
+func ReadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if cfg.Version == "" {
+		digest := sha256.Sum256(data)
+		cfg.Version = "sha256:" + hex.EncodeToString(digest[:6])
+	}
+	if cfg.Limits.MaxBodySize < 0 || cfg.Limits.MaxConcurrent < 0 {
+		return nil, fmt.Errorf("config %s: invalid limits %+v", path, cfg.Limits)
+	}
+	if _, err := common.ParseMode(string(cfg.Mode)); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// NewFromConfig returns a server configured by the file at path. Reload
+// (POST /admin/reload, ReloadOnSignal) applies the changes of the file
+// without restart.
+func NewFromConfig(ctx context.Context, path string, opts Options) (*Server, error) {
+	if opts.Store == nil {
+		opts.Store = artifact.NewFSStore(filepath.Dir(path))
+	}
+	s := newServer()
+	s.configPath, s.opts = path, opts
+	if err := s.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewReplica returns a replica server of the configuration file at path, that
+// copies the artifacts of the cluster manifest from opts.Leader. The server
+// is returned at once and answers 503 (ProblemNotReady, GET /readyz) until
+// the artifacts are replicated, checked and loaded; failed attempts are
+// passed to onError and retried every opts.RetryInterval until ctx is done.
+func NewReplica(ctx context.Context, path string, opts Options, onError func(error)) (*Server, error) {
+	if opts.Leader == nil {
+		return nil, fmt.Errorf("replica without leader")
+	}
+	if opts.Store == nil {
+		opts.Store = artifact.NewFSStore(filepath.Dir(path))
+	}
+	retry := opts.RetryInterval
+	if retry <= 0 {
+		retry = defaultRetryInterval
+	}
+	s := newServer()
+	s.configPath, s.opts = path, opts
+	go func() {
+		for {
+			err := s.Reload(ctx)
+			if err == nil {
+				return
+			}
+			if onError != nil {
+				onError(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Reload reads the configuration file again and applies it atomically: the
+// verifying keys, the cost manifest, the API keys and the limits are all
+// resolved before any request uses them. The running configuration stays in
+// use when the new one fails to load.
+func (s *Server) Reload(ctx context.Context) error {
+	if s.configPath == "" {
+		return fmt.Errorf("server has no configuration file")
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+	if f := faultsOf(ctx); f.storage || f.artifactLoad {
+		if err := f.storageError(); err != nil {
+			return err
+		}
+		return f.loadError()
+	}
+
+	cfg, err := ReadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	// the mode applies before the artifacts are loaded
+	if cfg.Mode != "" {
+		if err := common.SetMode(cfg.Mode); err != nil {
+			return err
+		}
+	}
+	manifest, err := s.replicate(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("config %s: %w", cfg.Version, err)
+	}
+	st, err := s.loadState(ctx, cfg, manifest)
+	if err != nil {
+		return fmt.Errorf("config %s: %w", cfg.Version, err)
+	}
+	s.state.Store(st)
+	return nil
+}
+
+// replicate copies the artifacts of the cluster manifest from the leader, or
+// checks the artifacts of the store against it when the configuration
+// replicates without leader. It returns nil without replication.
+func (s *Server) replicate(ctx context.Context, cfg *Config) (*artifact.Manifest, error) {
+	key := artifact.ManifestKey
+	if cfg.Replication != nil && cfg.Replication.Manifest != "" {
+		key = cfg.Replication.Manifest
+	}
+	switch {
+	case s.opts.Leader != nil:
+		manifest, err := artifact.Replicate(ctx, s.opts.Leader, s.opts.Store, key)
+		if err != nil {
+			return nil, fmt.Errorf("replication: %w", err)
+		}
+		return manifest, nil
+	case cfg.Replication != nil:
+		manifest, err := artifact.GetManifest(ctx, s.opts.Store, key)
+		if err != nil {
+			return nil, fmt.Errorf("replication: %w", err)
+		}
+		if err := manifest.Check(ctx, s.opts.Store); err != nil {
+			return nil, fmt.Errorf("replication: %w", err)
+		}
+		return manifest, nil
+	}
+	return nil, nil
+}
+
+// loadState resolves the configuration, the circuits of a replicated
+// configuration must be in the manifest
+func (s *Server) loadState(ctx context.Context, cfg *Config, manifest *artifact.Manifest) (*state, error) {
+	st := &state{
+		version:     cfg.Version,
+		loadedAt:    time.Now(),
+		verifier:    models.NewPresentationVerifier(s.opts.ResolveKey),
+		apiKeys:     cfg.APIKeys,
+		adminKeys:   cfg.AdminKeys,
+		maxBodySize: cfg.Limits.MaxBodySize,
+		diagnostics: cfg.Diagnostics,
+		anomaly:     cfg.Anomaly,
+		channel:     cfg.ChannelBinding,
+	}
+	if st.maxBodySize == 0 {
+		st.maxBodySize = maxBodySize
+	}
+	if cfg.Anomaly != nil {
+		if err := cfg.Anomaly.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ChannelBinding != nil {
+		if err := cfg.ChannelBinding.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MaxPresentationAge < 0 || cfg.ClockSkew < 0 || cfg.ReplayWindow < 0 {
+		return nil, fmt.Errorf("negative max_presentation_age, clock_skew or replay_window")
+	}
+	st.verifier.MaxAge = time.Duration(cfg.MaxPresentationAge) * time.Second
+	st.verifier.ClockSkew = time.Duration(cfg.ClockSkew) * time.Second
+	if cfg.ReplayWindow > 0 {
+		// the verified ids are kept across the reloads
+		st.verifier.Replay = s.replay
+		st.verifier.ReplayWindow = time.Duration(cfg.ReplayWindow) * time.Second
+	}
+	st.verifier.ResolvePQKey = s.opts.ResolvePQKey
+	for _, alg := range cfg.PresentationAlgs {
+		if !slices.Contains(models.SupportedAlgs(), alg) {
+			return nil, fmt.Errorf("presentation_algs: %w %q", models.ErrUnsupportedAlg, alg)
+		}
+	}
+	st.verifier.Algs = cfg.PresentationAlgs
+	if cfg.MinVersions != nil {
+		var err error
+		if st.verifier.MinVersions, err = models.NewVersionPolicy(cfg.MinVersions.Deprecations...); err != nil {
+			return nil, fmt.Errorf("min_versions: %w", err)
+		}
+		st.verifier.MinVersions.WarnOnly = cfg.MinVersions.WarnOnly
+	}
+	if cfg.Limits.MaxConcurrent > 0 {
+		st.sem = make(chan struct{}, cfg.Limits.MaxConcurrent)
+	}
+	if cfg.VKRegistry {
+		st.registry = artifact.NewVKRegistry(s.opts.Store)
+	}
+	if manifest != nil {
+		st.manifest, st.manifestKey = manifest, artifact.ManifestKey
+		if cfg.Replication != nil {
+			st.serveArtifacts = cfg.Replication.Serve
+			if cfg.Replication.Manifest != "" {
+				st.manifestKey = cfg.Replication.Manifest
+			}
+		}
+	}
+
+	trusted, err := trustedSigners(cfg.TrustedSigners)
+	if err != nil {
+		return nil, err
+	}
+	for id, c := range cfg.Circuits {
+		if manifest != nil && !manifest.Has(c.VerifyingKey) {
+			return nil, fmt.Errorf("circuit %q: verifying key %s not in the cluster manifest", id, c.VerifyingKey)
+		}
+		if c.Signer != "" || trusted != nil {
+			signer, err := common.VerifyArtifactFromStore(ctx, s.opts.Store, c.VerifyingKey, common.ArtifactVerifyingKey, trusted)
+			if err != nil {
+				return nil, fmt.Errorf("circuit %q: %w", id, err)
+			}
+			if c.Signer != "" && signer != c.Signer {
+				return nil, fmt.Errorf("circuit %q: %w: verifying key signed by %q, not by %q", id, common.ErrUntrustedArtifact, signer, c.Signer)
+			}
+		}
+		vk, err := common.LoadVerifyingKeyFromStore(ctx, s.opts.Store, c.VerifyingKey)
+		if err != nil {
+			return nil, fmt.Errorf("circuit %q: %w", id, err)
+		}
+		payloadSchema := c.Schema
+		if payloadSchema == nil {
+			payloadSchema = extension.PayloadSchema(id)
+		}
+		if err := st.verifier.AddCircuit(id, vk, payloadSchema); err != nil {
+			return nil, fmt.Errorf("circuit %q: %w", id, err)
+		}
+		if template, ok := s.opts.Attributes[id]; ok {
+			if err := st.verifier.AddAttributes(id, template); err != nil {
+				return nil, fmt.Errorf("circuit %q: %w", id, err)
+			}
+		}
+		if template, ok := s.opts.Timestamped[id]; ok {
+			if c.MaxTimestampSkew <= 0 {
+				return nil, fmt.Errorf("circuit %q: timestamped challenges without max_timestamp_skew", id)
+			}
+			policy := models.TimestampPolicy{MaxSkew: time.Duration(c.MaxTimestampSkew) * time.Second}
+			if err := st.verifier.AddTimestamp(id, template, policy); err != nil {
+				return nil, fmt.Errorf("circuit %q: %w", id, err)
+			}
+		}
+		if template, ok := s.opts.template(id); ok {
+			if err := st.verifier.AddInputLabels(id, template); err != nil {
+				return nil, fmt.Errorf("circuit %q: %w", id, err)
+			}
+		}
+		if err := extension.ConfigureVerifier(id, st.verifier); err != nil {
+			return nil, err
+		}
+		st.circuits = append(st.circuits, id)
+	}
+	slices.Sort(st.circuits)
+
+	if cfg.Costs != "" {
+		var err error
+		if st.costs, err = cost.ReadManifest(s.configRelative(cfg.Costs)); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Policy != "" {
+		p, err := policy.Load(s.configRelative(cfg.Policy))
+		if err != nil {
+			return nil, err
+		}
+		templates := map[string]frontend.Circuit{}
+		for _, id := range extension.Registered() {
+			c, _ := extension.Lookup(id)
+			templates[id] = c.Template()
+		}
+		for _, m := range []map[string]frontend.Circuit{s.opts.Attributes, s.opts.Timestamped, s.opts.Templates} {
+			for id, template := range m {
+				templates[id] = template
+			}
+		}
+		if st.policy, err = policy.NewEvaluator(p, templates); err != nil {
+			return nil, err
+		}
+		st.policy.Federation = s.opts.Federation
+	}
+	if cfg.DecryptionKey != "" {
+		var err error
+		if st.decryption, err = readDecryptionKey(s.configRelative(cfg.DecryptionKey)); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Catalog != nil {
+		var err error
+		if st.catalog, err = readCatalogSigner(s.configRelative(cfg.Catalog.SigningKey), cfg.Catalog); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// configRelative resolves a path of the configuration file
+func (s *Server) configRelative(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(s.configPath), path)
+}
+
+// trustedSigners decodes the public keys of Config.TrustedSigners, nil when
+// there are none
+func trustedSigners(keys map[string]string) (map[string]ed25519.PublicKey, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	trusted := make(map[string]ed25519.PublicKey, len(keys))
+	for id, encoded := range keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("trusted signer %q: invalid Ed25519 public key", id)
+		}
+		trusted[id] = key
+	}
+	return trusted, nil
+}
+
+// readDecryptionKey reads the private JWK of the verifier
+func readDecryptionKey(path string) (*ecdh.PrivateKey, error) {
+	jwk, err := readJWK(path)
+	if err != nil {
+		return nil, fmt.Errorf("decryption key %s: %w", path, err)
+	}
+	key, err := jwk.PrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("decryption key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// readCatalogSigner reads the private JWK signing the catalog
+func readCatalogSigner(path string, cfg *CatalogConfig) (*CatalogSigner, error) {
+	if cfg.TTL < 0 {
+		return nil, fmt.Errorf("catalog: invalid ttl %d", cfg.TTL)
+	}
+	jwk, err := readJWK(path)
+	if err != nil {
+		return nil, fmt.Errorf("catalog signing key %s: %w", path, err)
+	}
+	key, err := jwk.ECDSAPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("catalog signing key %s: %w", path, err)
+	}
+	return &CatalogSigner{Key: key, KeyID: jwk.Kid, Issuer: cfg.Issuer, TTL: time.Duration(cfg.TTL) * time.Second}, nil
+}
+
+func readJWK(path string) (models.JWK, error) {
+	var jwk models.JWK
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return jwk, err
+	}
+	err = json.Unmarshal(data, &jwk)
+	return jwk, err
+}
+
+// ReloadOnSignal reloads the configuration on SIGHUP until ctx is done.
+// Reload errors are passed to onError, the running configuration stays in use.
+func (s *Server) ReloadOnSignal(ctx context.Context, onError func(error)) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if err := s.Reload(ctx); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.current().health())
+}
+
+// handleReady answers 200 once the server serves a configuration, after the
+// replication of the cluster manifest for replicas
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !s.ready() {
+		writeProblem(w, r, newProblem(ProblemNotReady, http.StatusServiceUnavailable, "artifacts not replicated"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.current().health())
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	st := s.current()
+	if s.configPath == "" || len(st.adminKeys) == 0 {
+		writeProblem(w, r, newProblem(ProblemReloadFailed, http.StatusNotFound, "reload disabled"))
+		return
+	}
+	if !authorized(r, st.adminKeys) {
+		writeProblem(w, r, newProblem(ProblemUnauthorized, http.StatusUnauthorized, ""))
+		return
+	}
+	if err := s.Reload(r.Context()); err != nil {
+		// the serving configuration is kept
+		if r.Context().Err() != nil {
+			writeProblem(w, r, unavailable(err))
+			return
+		}
+		writeProblem(w, r, newProblem(ProblemReloadFailed, http.StatusUnprocessableEntity, err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.current().health())
+}
+
+func (st *state) health() HealthResponse {
+	res := HealthResponse{Status: "ok", ConfigVersion: st.version, LoadedAt: st.loadedAt, Circuits: st.circuits}
+	if st.manifest != nil {
+		res.ManifestVersion = st.manifest.Version
+	}
+	return res
+}
+
+// authorized reports whether the bearer token of the request is one of keys
+func authorized(r *http.Request, keys []string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	match := 0
+	for _, key := range keys {
+		match |= subtle.ConstantTimeCompare([]byte(token), []byte(key))
+	}
+	return match == 1
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FaultHeader injects faults into a request of a server built with the tag
+// chaos, for resilience tests of the deployments; production builds ignore
+// it. The faults are comma separated:
+//
+//	X-Fault: slow=2s, cancel
+//
+// FaultSlow delays the request, FaultCancel cancels its context as the OOM
+// guard of a prover would, FaultStorage fails the artifact store and the
+// verifying key registry, and FaultArtifactLoad fails the loading of the
+// artifacts: the endpoints answer not ready and a reload keeps the serving
+// configuration.
+const FaultHeader = "X-Fault"
+
+// Faults of FaultHeader
+const (
+	FaultArtifactLoad = "artifact-load"
+	FaultSlow         = "slow"
+	FaultCancel       = "cancel"
+	FaultStorage      = "storage"
+)
+
+// ErrInjectedFault is the error of an injected fault
+var ErrInjectedFault = errors.New("injected fault")
+
+// faults are the faults injected into a request
+type faults struct {
+	delay        time.Duration
+	cancel       bool
+	storage      bool
+	artifactLoad bool
+}
+
+// parseFaults parses the value of FaultHeader
+func parseFaults(header string) (faults, error) {
+	var f faults
+	for fault := range strings.SplitSeq(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(fault), "=")
+		switch name {
+		case FaultSlow:
+			delay, err := time.ParseDuration(value)
+			if err != nil || delay <= 0 {
+				return faults{}, fmt.Errorf("invalid %s delay %q", FaultSlow, value)
+			}
+			f.delay = delay
+		case FaultCancel:
+			f.cancel = true
+		case FaultStorage:
+			f.storage = true
+		case FaultArtifactLoad:
+			f.artifactLoad = true
+		case "":
+		default:
+			return faults{}, fmt.Errorf("unknown fault %q", name)
+		}
+	}
+	return f, nil
+}
+
+type faultsKey struct{}
+
+// faultsOf returns the faults injected into the request of ctx
+func faultsOf(ctx context.Context) faults {
+	f, _ := ctx.Value(faultsKey{}).(faults)
+	return f
+}
+
+// storageError returns the error of an injected storage outage
+func (f faults) storageError() error {
+	if !f.storage {
+		return nil
+	}
+	return fmt.Errorf("%w: storage unavailable", ErrInjectedFault)
+}
+
+// loadError returns the error of an injected artifact load failure
+func (f faults) loadError() error {
+	if !f.artifactLoad {
+		return nil
+	}
+	return fmt.Errorf("%w: artifacts failed to load", ErrInjectedFault)
+}
+
+// injectFaults applies the faults of the request, a no-op unless the server
+// is built with fault injection. It returns the request carrying its faults,
+// or false when the request was answered.
+func injectFaults(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	header := r.Header.Get(FaultHeader)
+	if !faultInjection || header == "" {
+		return r, true
+	}
+	f, err := parseFaults(header)
+	if err != nil {
+		p := newProblem(ProblemInvalidRequest, http.StatusBadRequest, err.Error())
+		p.Field = FaultHeader
+		writeProblem(w, r, p)
+		return nil, false
+	}
+
+	ctx := context.WithValue(r.Context(), faultsKey{}, f)
+	if f.delay > 0 {
+		timer := time.NewTimer(f.delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			// the client is gone, nothing to answer
+			timer.Stop()
+			return nil, false
+		}
+	}
+	if f.cancel {
+		canceled, cancel := context.WithCancelCause(ctx)
+		cancel(fmt.Errorf("%w: request canceled", ErrInjectedFault))
+		ctx = canceled
+	}
+	return r.WithContext(ctx), true
+}
@@ -0,0 +1,6 @@
+//go:build !chaos
+
+package server
+
+// faultInjection enables FaultHeader, in the builds with the tag chaos only
+const faultInjection = false
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mynextid/eudi-zk/artifact"
+)
+
+func TestParseFaults(t *testing.T) {
+	f, err := parseFaults("slow=20ms, cancel,storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.delay != 20*time.Millisecond || !f.cancel || !f.storage || f.artifactLoad {
+		t.Fatalf("unexpected faults %+v", f)
+	}
+	for _, invalid := range []string{"slow", "slow=-1s", "oom"} {
+		if _, err := parseFaults(invalid); err == nil {
+			t.Fatalf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestFaults checks the API degrades gracefully under the injected faults,
+// in a build with the tag chaos: go test -tags chaos ./server
+func TestFaults(t *testing.T) {
+	f := newFixture(t)
+	f.api.Registry = artifact.NewVKRegistry(artifact.NewFSStore(t.TempDir()))
+	verify, _ := json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness})
+	do := func(ctx context.Context, method, path, fault string, body []byte) (*http.Response, error) {
+		req, _ := http.NewRequestWithContext(ctx, method, f.server.URL+path, bytes.NewReader(body))
+		req.Header.Set(FaultHeader, fault)
+		return http.DefaultClient.Do(req)
+	}
+
+	if !faultInjection {
+		// production builds ignore the header
+		res, err := do(t.Context(), http.MethodPost, "/verify", FaultStorage+","+FaultCancel, verify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected the faults to be ignored, got %d", res.StatusCode)
+		}
+		return
+	}
+
+	goroutines := runtime.NumGoroutine()
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		fault   string
+		status  int
+		problem ProblemType
+	}{
+		{"slow", http.MethodPost, "/verify", "slow=20ms", http.StatusOK, ""},
+		{"canceled verification", http.MethodPost, "/verify", "slow=10ms,cancel", http.StatusServiceUnavailable, ProblemUnavailable},
+		{"artifacts not loaded", http.MethodPost, "/verify", FaultArtifactLoad, http.StatusServiceUnavailable, ProblemNotReady},
+		{"registry outage", http.MethodGet, "/vks/" + f.vkHash, FaultStorage, http.StatusServiceUnavailable, ProblemUnavailable},
+		{"invalid fault", http.MethodPost, "/verify", "oom", http.StatusBadRequest, ProblemInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			if tt.method == http.MethodPost {
+				body = verify
+			}
+			start := time.Now()
+			res, err := do(t.Context(), tt.method, tt.path, tt.fault, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, res.StatusCode)
+			}
+			if tt.problem != "" {
+				if p := problemFrom(t, res); p.Type != tt.problem {
+					t.Fatalf("expected %s, got %+v", tt.problem, p)
+				}
+			}
+			if tt.name == "slow" && time.Since(start) < 20*time.Millisecond {
+				t.Fatal("expected a delayed response")
+			}
+		})
+	}
+
+	// a client giving up on a slow request, the server notices once the
+	// request body is read: a request without body
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := do(ctx, http.MethodGet, "/claims", "slow=1h", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the client to time out, got %v", err)
+	}
+
+	// no goroutine is left behind once the connections are closed
+	f.server.CloseClientConnections()
+	http.DefaultClient.CloseIdleConnections()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Fatalf("%d goroutines left, expected at most %d", n, goroutines)
+	}
+}
+
+// TestFaultsReload checks a reload failing to load its artifacts keeps the
+// serving configuration
+func TestFaultsReload(t *testing.T) {
+	if !faultInjection {
+		t.Skip("fault injection needs the build tag chaos")
+	}
+	f := newFixture(t)
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	f.vk.WriteTo(&buf)
+	if err := os.WriteFile(filepath.Join(dir, "cube.vk"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"version": "v1", "circuits": {"cube/v1": {"verifying_key": "cube.vk"}}, "admin_keys": ["admin"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFromConfig(t.Context(), path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for fault, problem := range map[string]ProblemType{FaultArtifactLoad: ProblemReloadFailed, FaultStorage: ProblemReloadFailed, FaultCancel: ProblemUnavailable} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/reload", nil)
+		req.Header.Set("Authorization", "Bearer admin")
+		req.Header.Set(FaultHeader, fault)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := problemFrom(t, res); p.Type != problem {
+			t.Fatalf("%s: expected %s, got %+v", fault, problem, p)
+		}
+		res.Body.Close()
+	}
+
+	verify, _ := json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness})
+	if status, res := post(t, srv.URL+"/verify", "application/json", string(verify)); status != http.StatusOK || !res.Valid {
+		t.Fatalf("expected the configuration to keep serving, got %d %+v", status, res)
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/cost"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/policy"
+)
+
+// mediaTypeProblem is the media type of the error responses (RFC 7807), in
+// JSON whatever the Accept header
+const mediaTypeProblem = "application/problem+json"
+
+// problemBaseURI prefixes the problem types
+const problemBaseURI = "https://github.com/mynextid/eudi-zk/problems/"
+
+// ProblemType is the type URI of a problem, one per failure class: clients
+// switch on the type, the detail is for humans
+type ProblemType string
+
+const (
+	// ProblemCircuitNotFound: the circuit is not registered
+	ProblemCircuitNotFound ProblemType = problemBaseURI + "circuit_not_found"
+	// ProblemVKNotFound: the registry does not hold the verifying key, or is
+	// disabled
+	ProblemVKNotFound ProblemType = problemBaseURI + "vk_not_found"
+	// ProblemWitnessInvalid: the public witness cannot be decoded or does not
+	// match the circuit, or a payload member (Field) does not match the schema
+	ProblemWitnessInvalid ProblemType = problemBaseURI + "witness_invalid"
+	// ProblemProofFailed: the proof does not verify against the public witness
+	ProblemProofFailed ProblemType = problemBaseURI + "proof_failed"
+	// ProblemMalformedProof: the proof or the public witness cannot be
+	// decoded (diagnostics only, ProblemProofFailed or ProblemWitnessInvalid
+	// otherwise)
+	ProblemMalformedProof ProblemType = problemBaseURI + "malformed_proof"
+	// ProblemPublicInputCount: the public witness has another number of
+	// public inputs than the verifying key (diagnostics only,
+	// ProblemWitnessInvalid otherwise)
+	ProblemPublicInputCount ProblemType = problemBaseURI + "public_input_count"
+	// ProblemUnsatisfiedConstraint: an assignment does not satisfy the
+	// circuit, Constraint is the label of the failing assertion
+	ProblemUnsatisfiedConstraint ProblemType = problemBaseURI + "unsatisfied_constraint"
+	// ProblemVersionMismatch: the circuit version or verifying key hash of the
+	// proof, or the protocol version of the client, is not served; Versions
+	// and ProtocolVersions list the served ones. A rotated verifying key past
+	// its validity (models.ErrKeyNotValid) is not served either.
+	ProblemVersionMismatch ProblemType = problemBaseURI + "version_mismatch"
+	// ProblemCircuitDeprecated: the circuit version of the proof is below the
+	// minimum version of its family (models.VersionPolicy), the prover must
+	// upgrade
+	ProblemCircuitDeprecated ProblemType = problemBaseURI + "circuit_deprecated"
+	// ProblemStaleTimestamp: the challenge timestamp or the CRL check time is
+	// outside the accepted skew (models.TimestampPolicy, models.CRLTimePolicy)
+	ProblemStaleTimestamp ProblemType = problemBaseURI + "stale_timestamp"
+	// ProblemPresentationInvalid: the presentation cannot be parsed or its
+	// signature does not verify
+	ProblemPresentationInvalid ProblemType = problemBaseURI + "presentation_invalid"
+	// ProblemReplayed: the jti of the presentation was verified already, or
+	// its jti or exp is missing, with a replay window (Config.ReplayWindow)
+	ProblemReplayed ProblemType = problemBaseURI + "replayed"
+	// ProblemChannelMismatch: the nonce of the presentation was not issued
+	// for the channel of the request, or the request has no channel binding
+	// (Config.ChannelBinding)
+	ProblemChannelMismatch ProblemType = problemBaseURI + "channel_mismatch"
+	// ProblemPolicyViolation: the presentation verifies but does not satisfy
+	// the verification policy, Rule is the failing rule (policy.Violation)
+	ProblemPolicyViolation ProblemType = problemBaseURI + "policy_violation"
+	// ProblemInvalidRequest: the request body or a parameter (Field) is invalid
+	ProblemInvalidRequest ProblemType = problemBaseURI + "invalid_request"
+	// ProblemUnauthorized: missing or unknown API key
+	ProblemUnauthorized ProblemType = problemBaseURI + "unauthorized"
+	// ProblemTooManyRequests: the concurrency limit is reached (503), or the
+	// client is throttled for its invalid proofs (429, AnomalyConfig)
+	ProblemTooManyRequests ProblemType = problemBaseURI + "too_many_requests"
+	// ProblemClientBlocked: the client is blocked for its invalid proofs
+	// (AnomalyConfig)
+	ProblemClientBlocked ProblemType = problemBaseURI + "client_blocked"
+	// ProblemReloadFailed: the configuration is disabled or failed to load
+	ProblemReloadFailed ProblemType = problemBaseURI + "reload_failed"
+	// ProblemNotReady: the replica has not replicated the cluster manifest
+	// yet (NewReplica), or the artifact is not in the manifest
+	ProblemNotReady ProblemType = problemBaseURI + "not_ready"
+	// ProblemUnavailable: the artifact store or the verifying key registry
+	// is unavailable, or the request was canceled; retry later (503)
+	ProblemUnavailable ProblemType = problemBaseURI + "unavailable"
+	// ProblemInternal: unexpected server error
+	ProblemInternal ProblemType = problemBaseURI + "internal"
+)
+
+var problemTitles = map[ProblemType]string{
+	ProblemCircuitNotFound:       "Circuit not found",
+	ProblemVKNotFound:            "Verifying key not found",
+	ProblemWitnessInvalid:        "Invalid public witness",
+	ProblemProofFailed:           "Proof verification failed",
+	ProblemMalformedProof:        "Malformed proof encoding",
+	ProblemPublicInputCount:      "Public input count mismatch",
+	ProblemUnsatisfiedConstraint: "Unsatisfied constraint",
+	ProblemVersionMismatch:       "Version mismatch",
+	ProblemCircuitDeprecated:     "Circuit deprecated",
+	ProblemStaleTimestamp:        "Stale challenge timestamp",
+	ProblemPresentationInvalid:   "Invalid presentation",
+	ProblemReplayed:              "Presentation replayed",
+	ProblemChannelMismatch:       "Channel binding mismatch",
+	ProblemPolicyViolation:       "Policy violation",
+	ProblemInvalidRequest:        "Invalid request",
+	ProblemUnauthorized:          "Unauthorized",
+	ProblemTooManyRequests:       "Too many requests",
+	ProblemClientBlocked:         "Client blocked",
+	ProblemReloadFailed:          "Reload failed",
+	ProblemNotReady:              "Not ready",
+	ProblemUnavailable:           "Service unavailable",
+	ProblemInternal:              "Internal error",
+}
+
+// Problem is the error response of every endpoint (RFC 7807 problem details),
+// with the offending field or constraint label as extension members
+type Problem struct {
+	Type   ProblemType `json:"type"`
+	Title  string      `json:"title"`
+	Status int         `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	// Instance is the request path
+	Instance string `json:"instance,omitempty"`
+
+	// Circuit is the circuit of the request, when known
+	Circuit string `json:"circuit,omitempty"`
+	// Field is the request parameter or payload member at fault
+	Field string `json:"field,omitempty"`
+	// Constraint is the label of the failing assertion (common.Assert)
+	Constraint string `json:"constraint,omitempty"`
+	// Rule is the failing rule of the verification policy
+	Rule string `json:"rule,omitempty"`
+	// Versions are the registered versions of the circuit, on a version
+	// mismatch
+	Versions []models.CircuitVersion `json:"versions,omitempty"`
+	// ProtocolVersions are the protocol versions of the server, on a
+	// protocol version mismatch
+	ProtocolVersions []int `json:"protocol_versions,omitempty"`
+	// Code and Stage locate a verification failure (models.VerificationError),
+	// with diagnostics only
+	Code  models.ErrorCode `json:"code,omitempty"`
+	Stage models.Stage     `json:"stage,omitempty"`
+
+	// retryAfter is the Retry-After of a throttled client, in seconds
+	retryAfter int
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// newProblem returns the problem of type typ with the detail
+func newProblem(typ ProblemType, status int, detail string) *Problem {
+	return &Problem{Type: typ, Title: problemTitles[typ], Status: status, Detail: detail}
+}
+
+// problemOf classifies a verification or cost estimate error, errors of no
+// known class are of type fallback
+func problemOf(err error, fallback ProblemType) *Problem {
+	p := newProblem(fallback, http.StatusUnprocessableEntity, err.Error())
+
+	var witnessErr *common.WitnessError
+	var fieldErr *models.FieldError
+	var versionErr *models.VersionError
+	var deprecationErr *models.DeprecationError
+	var violation *policy.Violation
+	switch {
+	case errors.As(err, &violation):
+		p.Type, p.Status, p.Rule = ProblemPolicyViolation, http.StatusForbidden, violation.Rule
+	case errors.As(err, &versionErr):
+		p.Type, p.Status = ProblemVersionMismatch, http.StatusConflict
+		p.Circuit, p.Versions = versionErr.Circuit, versionErr.Versions
+	case errors.As(err, &deprecationErr):
+		p.Type, p.Status, p.Circuit = ProblemCircuitDeprecated, http.StatusConflict, deprecationErr.Circuit
+	case errors.Is(err, models.ErrUnknownCircuit), errors.Is(err, cost.ErrUnknownCircuit):
+		p.Type = ProblemCircuitNotFound
+	case errors.As(err, &witnessErr):
+		p.Type, p.Constraint = ProblemUnsatisfiedConstraint, witnessErr.Label
+	case errors.As(err, &fieldErr):
+		p.Type, p.Field = ProblemWitnessInvalid, fieldErr.Field
+	case errors.Is(err, models.ErrInvalidWitness):
+		p.Type = ProblemWitnessInvalid
+	case errors.Is(err, models.ErrProofFailed):
+		p.Type = ProblemProofFailed
+	case errors.Is(err, models.ErrKeyNotValid):
+		p.Type, p.Status = ProblemVersionMismatch, http.StatusConflict
+	case errors.Is(err, models.ErrStaleTimestamp), errors.Is(err, models.ErrStaleCRLTime):
+		p.Type = ProblemStaleTimestamp
+	case errors.Is(err, models.ErrReplayed):
+		p.Type = ProblemReplayed
+	case errors.Is(err, models.ErrChannelMismatch):
+		p.Type = ProblemChannelMismatch
+	}
+	p.Title = problemTitles[p.Type]
+	return p
+}
+
+// diagnose locates the verification failure of the problem, for servers
+// with diagnostics: the code and stage of the failure are set, and malformed
+// encodings and public input count mismatches, integration bugs of the
+// prover, get problem types of their own instead of failing like a forged
+// proof. Only the failure class is disclosed, not the partial result.
+func diagnose(p *Problem, err error) {
+	var verr *models.VerificationError
+	if !errors.As(err, &verr) {
+		return
+	}
+	p.Code, p.Stage = verr.Code, verr.Stage
+	switch verr.Code {
+	case models.CodeMalformedProof:
+		p.Type, p.Status = ProblemMalformedProof, http.StatusBadRequest
+	case models.CodePublicInputCount:
+		p.Type, p.Status = ProblemPublicInputCount, http.StatusUnprocessableEntity
+	}
+	p.Title = problemTitles[p.Type]
+}
+
+// writeProblem writes the problem for the request
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.Instance = r.URL.Path
+	w.Header().Set("Content-Type", mediaTypeProblem)
+	w.Header().Set("Content-Language", "en")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,726 @@
+// Package server exposes the verification of proofs over HTTP:
+//
+//	POST /verify                   raw groth16 proof and public witness
+//	POST /presentations/verify     ZkPresentation (protected.payload.proof.signature,
+//	                               or COSE_Sign1 with Content-Type application/cose),
+//	                               optionally encrypted to the verifier (compact JWE)
+//	GET  /circuits/{circuit}/cost  expected cost of a proof (cost.Manifest)
+//	GET  /catalog                  signed catalog of the accepted circuits (models.Catalog)
+//	GET  /claims                   attributes provable with the accepted circuits (package claims)
+//	GET  /capabilities             features of the build and the configuration (CapabilitiesResponse)
+//	GET  /challenge                nonce of a presentation, bound to the channel (ChannelBindingConfig)
+//	GET  /vks/{hash}               verifying key by hash (artifact.VKRegistry)
+//	POST /vks                      register a verifying key (admin)
+//	GET  /artifacts/{key}          replicated artifacts of the cluster manifest (leader)
+//	GET  /healthz                  status and applied configuration version
+//	GET  /readyz                   200 once the artifacts match the cluster manifest
+//	POST /admin/reload             reload the configuration file (NewFromConfig)
+//
+// Both verify endpoints verify with the same models.PresentationVerifier and
+// the same registered verifying keys, and answer in CBOR when the client
+// accepts application/cbor. Errors are answered with an
+// application/problem+json Problem on every endpoint.
+//
+// With a verification policy (Config.Policy, package policy) the verified
+// presentations must also satisfy its rules, violations are answered 403.
+//
+// With a channel binding (Config.ChannelBinding) the nonces of GET /challenge
+// are bound to the TLS connection (RFC 9266 tls-exporter) or the session of
+// the request, and a presentation whose nonce was issued for another channel,
+// a proof relayed from another verifier, is answered channel_mismatch.
+//
+// With diagnostics (Config.Diagnostics) the problems of the verify endpoints
+// carry the code and stage of the failure, and a malformed proof encoding
+// (400) or a public input count mismatch (422) is told apart from a proof
+// that does not verify, so integration bugs are not mistaken for attacks.
+//
+// The failures of the verify endpoints are counted by class and by client
+// (FailureStats, PublishFailures); with Config.Anomaly the clients with an
+// anomalous ratio of invalid proofs, probing the circuits, are throttled
+// (429) then blocked (403).
+//
+// Clients state the protocol version they speak in the ZK-Protocol-Version
+// header and the verifying key hash they proved with (VerifyRequest.VKHash,
+// the vk_hash of a presentation). A proof for a version of a circuit the
+// server does not serve is answered 409 with the served versions, instead of
+// failing to verify against the layout of another version.
+//
+// Circuit versions below the minimum version of their family
+// (Config.MinVersions, distributed in the catalog) are answered 409
+// circuit_deprecated, or verified with a deprecation warning
+// (VerifyResponse.Deprecation) in their grace period or warn-only.
+//
+// Verifying keys are addressed by that hash in the registry: verifiers
+// resolve the vk_hash of a presentation with GET /vks/{hash}, and check the
+// served key hashes to it.
+//
+// In multi-replica deployments the replicas (NewReplica) copy the artifacts
+// listed in the cluster manifest (artifact.Manifest) from a leader or an
+// object store at startup, check their digests, and report ready only once
+// their store matches the manifest.
+package server
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mynextid/eudi-zk/artifact"
+	"github.com/mynextid/eudi-zk/claims"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/cost"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/policy"
+)
+
+// mediaTypeCBOR is accepted for COSE encoded presentations and negotiated
+// for the verify responses
+const mediaTypeCBOR = "application/cbor"
+
+// maxBodySize bounds the request bodies (proofs are a few hundred bytes, the
+// public witness grows with the public inputs)
+const maxBodySize = 1 << 20
+
+// ProtocolVersion is the version of the API, sent by the server and the
+// clients in the ProtocolHeader
+const ProtocolVersion = 1
+
+// ProtocolHeader is the header carrying the protocol version, requests
+// without it are served as the current version
+const ProtocolHeader = "ZK-Protocol-Version"
+
+// VerifyRequest is the body of POST /verify, proof and public witness in
+// gnark binary encoding
+type VerifyRequest struct {
+	Circuit       string `json:"circuit"`
+	Proof         []byte `json:"proof"`
+	PublicWitness []byte `json:"public_witness"`
+	// VKHash is the hash of the verifying key the proof was made for
+	// (common.VerifyingKeyHash, hex), optional: the proof is rejected with a
+	// version mismatch when the circuit is registered with another key
+	VKHash string `json:"vk_hash,omitempty"`
+}
+
+// PresentationVerifyRequest is the JSON body of POST /presentations/verify,
+// the presentation can also be posted as text
+type PresentationVerifyRequest struct {
+	Presentation string `json:"presentation"`
+	// Nonce is the nonce issued for the request, checked against the
+	// presentation by the nonce rules of the policy (Config.Policy)
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// VerifyResponse is the response of both verify endpoints
+type VerifyResponse struct {
+	Valid   bool                        `json:"valid"`
+	Circuit string                      `json:"circuit,omitempty"`
+	Payload *models.PresentationPayload `json:"payload,omitempty"`
+	// Attributes are the proven claims of circuits with attribute slots
+	Attributes map[string]models.AttributeDigest `json:"attributes,omitempty"`
+	// ChallengeTimestamp is the checked timestamp of circuits with
+	// timestamped challenges
+	ChallengeTimestamp time.Time `json:"challenge_timestamp,omitzero"`
+	// PublicInputs are the public inputs by name of circuits with input
+	// labels (models.PresentationVerifier.AddInputLabels): bytes in hex,
+	// integers in decimal
+	PublicInputs map[string]string `json:"public_inputs,omitempty"`
+	// VKHash is the verifying key hash the proof verified with
+	VKHash string `json:"vk_hash,omitempty"`
+	// CredentialExpiresIn is the time left until the expiry of the
+	// credential (cred_exp), or the exp of the presentation without it, in
+	// seconds
+	CredentialExpiresIn int64 `json:"credential_expires_in,omitempty"`
+	// ChallengeAge is the age of the holder signature of circuits with
+	// timestamped challenges, in seconds
+	ChallengeAge int64 `json:"challenge_age,omitempty"`
+	// CRLNextUpdate is the nextUpdate of the proven CRL of circuits with a
+	// CRL check time
+	CRLNextUpdate time.Time `json:"crl_next_update,omitzero"`
+	// PairwiseID is the pseudonym of the holder for this verifier of
+	// circuits with pairwise identifiers, in hex
+	PairwiseID string `json:"pairwise_id,omitempty"`
+	// Deprecation warns that the circuit version is deprecated, accepted in
+	// its grace period or warn-only
+	Deprecation *models.Deprecation `json:"deprecation,omitempty"`
+	// Entries are the responses of the proofs of a composite presentation,
+	// without the shared payload
+	Entries []VerifyResponse `json:"entries,omitempty"`
+}
+
+// newVerifyResponse returns the response of a successful verification
+func newVerifyResponse(res *models.VerificationResult) VerifyResponse {
+	response := VerifyResponse{
+		Valid:               true,
+		Circuit:             res.Circuit,
+		Attributes:          res.PublicInputs.Attributes,
+		ChallengeTimestamp:  res.PublicInputs.ChallengeTimestamp,
+		PublicInputs:        res.Labels,
+		VKHash:              res.VKVersion.VKHash,
+		CredentialExpiresIn: int64(res.CredentialExpiresIn / time.Second),
+		ChallengeAge:        int64(res.ChallengeAge / time.Second),
+		CRLNextUpdate:       res.CRLNextUpdate,
+		Deprecation:         res.Deprecation,
+	}
+	if res.Presentation != nil {
+		response.Payload = &res.Presentation.Payload
+	}
+	if res.PublicInputs.PairwiseID != nil {
+		response.PairwiseID = hex.EncodeToString(res.PublicInputs.PairwiseID.ID)
+	}
+	for _, entry := range res.Entries {
+		e := newVerifyResponse(entry)
+		e.Payload = nil
+		response.Entries = append(response.Entries, e)
+	}
+	return response
+}
+
+// mediaTypeJWT is the media type of the signed catalog
+const mediaTypeJWT = "application/jwt"
+
+// defaultCatalogTTL is the validity of a catalog when CatalogSigner.TTL is 0
+const defaultCatalogTTL = 24 * time.Hour
+
+// CatalogSigner signs the catalog of the registered circuits served on GET
+// /catalog, a JWS (models.SignCatalog) wallets cache until it expires
+type CatalogSigner struct {
+	Key *ecdsa.PrivateKey
+	// KeyID is the kid of the signature, optional
+	KeyID string
+	// Issuer is the iss of the catalog, optional
+	Issuer string
+	// TTL is the validity of a served catalog, a day when 0
+	TTL time.Duration
+}
+
+// mediaTypeBinary is the media type of the verifying keys of the registry
+const mediaTypeBinary = "application/octet-stream"
+
+// VKResponse is the response of POST /vks
+type VKResponse struct {
+	// VKHash is the hash of the registered key, its path is /vks/{vk_hash}
+	VKHash string `json:"vk_hash"`
+}
+
+// CostResponse is the response of GET /circuits/{circuit}/cost
+type CostResponse struct {
+	Profile  *cost.Profile  `json:"profile,omitempty"`
+	Estimate *cost.Estimate `json:"estimate,omitempty"`
+}
+
+// ClaimsResponse is the response of GET /claims: the claims of the taxonomy
+// with the proofs of the accepted circuits (claims.Taxonomy)
+type ClaimsResponse struct {
+	Claims []claims.Claim `json:"claims"`
+}
+
+// Server serves the verification endpoints
+type Server struct {
+	// Verifier and Costs serve a server built with New, a server built with
+	// NewFromConfig uses the ones of its configuration
+	Verifier *models.PresentationVerifier
+	// Costs are the circuit cost profiles, the cost endpoint answers 404
+	// when nil
+	Costs *cost.Manifest
+	// DecryptionKey decrypts the encrypted presentations (JWE ECDH-ES), which
+	// are rejected when nil
+	DecryptionKey *ecdh.PrivateKey
+	// Catalog signs the catalog, GET /catalog answers 404 when nil
+	Catalog *CatalogSigner
+	// Registry serves the verifying keys on /vks, which answers 404 when nil
+	Registry *artifact.VKRegistry
+	// AdminKeys are accepted by POST /vks, which is disabled when empty
+	AdminKeys []string
+	// Diagnostics locates the verification failures in the problems of the
+	// verify endpoints (Problem.Code and Stage), see Config.Diagnostics
+	Diagnostics bool
+	// Anomaly throttles and blocks the clients with anomalous invalid proof
+	// ratios, see Config.Anomaly
+	Anomaly *AnomalyConfig
+	// ChannelBinding binds the nonces of GET /challenge to the channel of the
+	// request, see Config.ChannelBinding
+	ChannelBinding *ChannelBindingConfig
+	// Log records the verified proofs and their labeled public inputs
+	// (VerifyResponse.PublicInputs) for audit, nothing is logged when nil
+	Log *slog.Logger
+
+	mux *http.ServeMux
+	// failures tracks the verification failures of the clients across the
+	// reloads
+	failures *failureMonitor
+	// replay remembers the jti of the verified presentations across the
+	// reloads, with Config.ReplayWindow
+	replay *models.MemoryReplayCache
+
+	// configPath is the configuration file of NewFromConfig, state the
+	// configuration applied by the last successful Reload
+	configPath string
+	opts       Options
+	reloadMu   sync.Mutex
+	state      atomic.Pointer[state]
+}
+
+// state is the configuration a request is served with, replaced as a whole
+// on reload
+type state struct {
+	version    string
+	loadedAt   time.Time
+	circuits   []string
+	verifier   *models.PresentationVerifier
+	costs      *cost.Manifest
+	decryption *ecdh.PrivateKey
+	catalog    *CatalogSigner
+	registry   *artifact.VKRegistry
+	// policy is evaluated on the verified presentations, nil without policy
+	policy      *policy.Evaluator
+	apiKeys     []string
+	adminKeys   []string
+	maxBodySize int64
+	// diagnostics locates the verification failures in the problems
+	diagnostics bool
+	// anomaly throttles the clients with anomalous failures, nil when off
+	anomaly *AnomalyConfig
+	// channel binds the nonces to the channel of the request, nil when off
+	channel *ChannelBindingConfig
+	// manifest is the cluster manifest (under manifestKey) the artifacts
+	// match, serveArtifacts serves them on /artifacts
+	manifest       *artifact.Manifest
+	manifestKey    string
+	serveArtifacts bool
+	// sem bounds the concurrent requests, nil when unlimited
+	sem chan struct{}
+}
+
+// New returns a server verifying with verifier
+func New(verifier *models.PresentationVerifier) *Server {
+	s := newServer()
+	s.Verifier = verifier
+	return s
+}
+
+func newServer() *Server {
+	s := &Server{mux: http.NewServeMux(), failures: newFailureMonitor(), replay: models.NewMemoryReplayCache()}
+	s.handle("POST /verify", s.handleVerify)
+	s.handle("POST /presentations/verify", s.handleVerifyPresentation)
+	s.handle("GET /circuits/{circuit}/cost", s.handleCost)
+	s.handle("GET /claims", s.handleClaims)
+	s.handle("GET /capabilities", s.handleCapabilities)
+	s.handle("GET /challenge", s.handleChallenge)
+	// wallets fetch the catalog without API key
+	s.mux.HandleFunc("GET /catalog", s.handleCatalog)
+	// verifiers resolve the verifying keys without API key, the keys are
+	// public and checked against their hash
+	s.mux.HandleFunc("GET /vks/{hash}", s.handleGetVK)
+	s.mux.HandleFunc("POST /vks", s.handlePutVK)
+	s.mux.HandleFunc("GET /artifacts/{key...}", s.handleGetArtifact)
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.HandleFunc("GET /readyz", s.handleReady)
+	s.mux.HandleFunc("POST /admin/reload", s.handleReload)
+	return s
+}
+
+// ready reports whether the server has a configuration to serve requests
+// with: a replica has none until its first replication
+func (s *Server) ready() bool {
+	return s.configPath == "" || s.state.Load() != nil
+}
+
+// current returns the configuration of a new request
+func (s *Server) current() *state {
+	if st := s.state.Load(); st != nil {
+		return st
+	}
+	return &state{verifier: s.Verifier, costs: s.Costs, decryption: s.DecryptionKey, catalog: s.Catalog, registry: s.Registry, adminKeys: s.AdminKeys, maxBodySize: maxBodySize, diagnostics: s.Diagnostics, anomaly: s.Anomaly, channel: s.ChannelBinding}
+}
+
+// handle registers a handler served with one configuration for the whole
+// request, after the API key, protocol version and concurrency checks
+func (s *Server) handle(pattern string, h func(w http.ResponseWriter, r *http.Request, st *state)) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready() {
+			writeProblem(w, r, newProblem(ProblemNotReady, http.StatusServiceUnavailable, "artifacts not replicated"))
+			return
+		}
+		if err := faultsOf(r.Context()).loadError(); err != nil {
+			writeProblem(w, r, newProblem(ProblemNotReady, http.StatusServiceUnavailable, err.Error()))
+			return
+		}
+		st := s.current()
+		if len(st.apiKeys) > 0 && !authorized(r, st.apiKeys) {
+			writeProblem(w, r, newProblem(ProblemUnauthorized, http.StatusUnauthorized, ""))
+			return
+		}
+		if version := r.Header.Get(ProtocolHeader); version != "" && version != strconv.Itoa(ProtocolVersion) {
+			p := newProblem(ProblemVersionMismatch, http.StatusConflict, "unsupported protocol version "+strconv.Quote(version))
+			p.ProtocolVersions = []int{ProtocolVersion}
+			writeProblem(w, r, p)
+			return
+		}
+		if st.sem != nil {
+			select {
+			case st.sem <- struct{}{}:
+				defer func() { <-st.sem }()
+			default:
+				writeProblem(w, r, newProblem(ProblemTooManyRequests, http.StatusServiceUnavailable, ""))
+				return
+			}
+		}
+		// a request canceled while it waited is not served
+		if r.Context().Err() != nil {
+			writeProblem(w, r, unavailable(context.Cause(r.Context())))
+			return
+		}
+		h(w, r, st)
+	})
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(ProtocolHeader, strconv.Itoa(ProtocolVersion))
+	r, ok := injectFaults(w, r)
+	if !ok {
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// verificationProblem returns the problem of a failed verification, located
+// with diagnostics
+func (st *state) verificationProblem(err error) *Problem {
+	p := problemOf(err, ProblemPresentationInvalid)
+	if st.diagnostics {
+		diagnose(p, err)
+	}
+	return p
+}
+
+// logVerified records a successful verification with Log
+func (s *Server) logVerified(r *http.Request, res *models.VerificationResult) {
+	if s.Log == nil {
+		return
+	}
+	if d := res.Deprecation; d != nil {
+		s.Log.WarnContext(r.Context(), "deprecated circuit version", "path", r.URL.Path, "circuit", res.Circuit, "min_version", d.MinVersion, "enforce_at", d.EnforceAt)
+	}
+	s.Log.InfoContext(r.Context(), "proof verified", "path", r.URL.Path, "circuit", res.Circuit, "public_inputs", res.Labels)
+}
+
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request, st *state) {
+	client := clientID(r)
+	if !s.checkClient(w, r, st, client) {
+		return
+	}
+	var req VerifyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, st.maxBodySize)).Decode(&req); err != nil {
+		writeProblem(w, r, newProblem(ProblemInvalidRequest, http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	err := st.verifier.CheckVersion(req.Circuit, req.VKHash)
+	var res *models.VerificationResult
+	if err == nil {
+		res, err = st.verifier.VerifyProof(req.Circuit, req.Proof, req.PublicWitness)
+	}
+	if err != nil {
+		p := st.verificationProblem(err)
+		p.Circuit = req.Circuit
+		s.recordVerification(st, client, p)
+		writeProblem(w, r, p)
+		return
+	}
+	s.recordVerification(st, client, nil)
+	s.logVerified(r, res)
+	writeResponse(w, r, http.StatusOK, newVerifyResponse(res))
+}
+
+func (s *Server) handleVerifyPresentation(w http.ResponseWriter, r *http.Request, st *state) {
+	client := clientID(r)
+	if !s.checkClient(w, r, st, client) {
+		return
+	}
+	buf := common.GetBuffer()
+	defer common.PutBuffer(buf)
+	if _, err := buf.ReadFrom(http.MaxBytesReader(w, r.Body, st.maxBodySize)); err != nil {
+		writeProblem(w, r, newProblem(ProblemInvalidRequest, http.StatusBadRequest, err.Error()))
+		return
+	}
+	body := buf.Bytes()
+
+	var opts models.VerificationOptions
+	if st.channel != nil {
+		binding, err := st.channel.binding(r)
+		if err != nil {
+			writeProblem(w, r, newProblem(ProblemChannelMismatch, http.StatusBadRequest, err.Error()))
+			return
+		}
+		opts.ChannelBinding = binding
+	}
+
+	var (
+		res   *models.VerificationResult
+		err   error
+		nonce string
+	)
+	switch contentType := r.Header.Get("Content-Type"); {
+	case strings.HasPrefix(contentType, models.PresentationMediaTypeCOSE), strings.HasPrefix(contentType, mediaTypeCBOR):
+		res, err = st.verifier.VerifyCOSEWithOptions(body, opts)
+	default:
+		// compact serialization, or compact JWE of five parts
+		compact := string(body)
+		if strings.HasPrefix(contentType, "application/json") {
+			var req PresentationVerifyRequest
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeProblem(w, r, newProblem(ProblemInvalidRequest, http.StatusBadRequest, err.Error()))
+				return
+			}
+			compact, nonce = req.Presentation, req.Nonce
+		}
+		switch {
+		case strings.HasPrefix(contentType, models.PresentationMediaTypeJWE), strings.Count(compact, ".") == 4:
+			if st.decryption == nil {
+				writeProblem(w, r, newProblem(ProblemInvalidRequest, http.StatusUnsupportedMediaType, "encrypted presentations are not accepted"))
+				return
+			}
+			res, err = st.verifier.VerifyEncryptedWithOptions(compact, st.decryption, opts)
+		default:
+			res, err = st.verifier.VerifyWithOptions(compact, opts)
+		}
+	}
+	if err == nil && st.policy != nil {
+		err = st.policy.Evaluate(res, policy.Options{Context: r.Context(), Nonce: nonce})
+	}
+	if err != nil {
+		p := st.verificationProblem(err)
+		s.recordVerification(st, client, p)
+		writeProblem(w, r, p)
+		return
+	}
+	s.recordVerification(st, client, nil)
+	s.logVerified(r, res)
+	writeResponse(w, r, http.StatusOK, newVerifyResponse(res))
+}
+
+// handleCost returns the profile of the circuit and, when input sizes are
+// given as query parameters (e.g. ?CertBytes=1024), the estimate for these
+// sizes. Circuit ids containing "/" are path-escaped (eudi-vc%2Fpop).
+func (s *Server) handleCost(w http.ResponseWriter, r *http.Request, st *state) {
+	circuit := r.PathValue("circuit")
+	if st.costs == nil {
+		p := newProblem(ProblemCircuitNotFound, http.StatusNotFound, "no cost profiles")
+		p.Circuit = circuit
+		writeProblem(w, r, p)
+		return
+	}
+	profile, err := st.costs.Profile(circuit)
+	if err != nil {
+		p := problemOf(err, ProblemCircuitNotFound)
+		p.Status, p.Circuit = http.StatusNotFound, circuit
+		writeProblem(w, r, p)
+		return
+	}
+
+	res := CostResponse{Profile: profile}
+	query := r.URL.Query()
+	if len(query) > 0 {
+		inputSizes := make(map[string]int, len(query))
+		for name := range query {
+			size, err := strconv.Atoi(query.Get(name))
+			if err != nil || size < 0 {
+				p := newProblem(ProblemInvalidRequest, http.StatusBadRequest, "invalid input size")
+				p.Field = name
+				writeProblem(w, r, p)
+				return
+			}
+			inputSizes[name] = size
+		}
+		if res.Estimate, err = st.costs.EstimateProve(circuit, inputSizes); err != nil {
+			p := problemOf(err, ProblemInvalidRequest)
+			p.Circuit = circuit
+			writeProblem(w, r, p)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleCatalog signs the catalog of the registered circuits, cacheable
+// until it expires
+func (s *Server) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	st := s.current()
+	if st.catalog == nil {
+		writeProblem(w, r, newProblem(ProblemCircuitNotFound, http.StatusNotFound, "no catalog"))
+		return
+	}
+	ttl := st.catalog.TTL
+	if ttl == 0 {
+		ttl = defaultCatalogTTL
+	}
+	now := time.Now()
+	catalog := models.Catalog{
+		Issuer:       st.catalog.Issuer,
+		IssuedAt:     now.Unix(),
+		ExpiresAt:    now.Add(ttl).Unix(),
+		Circuits:     st.verifier.Catalog(),
+		Deprecations: st.verifier.MinVersions.Deprecations(),
+		Algs:         st.verifier.AcceptedAlgs(),
+	}
+	signed, err := models.SignCatalog(catalog, st.catalog.Key, st.catalog.KeyID)
+	if err != nil {
+		writeProblem(w, r, newProblem(ProblemInternal, http.StatusInternalServerError, err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", mediaTypeJWT)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.FormatInt(int64(ttl/time.Second), 10))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(signed))
+}
+
+// handleClaims serves the claims the accepted circuits prove, for the
+// verifiers to plan their requests (claims.NewPlan)
+func (s *Server) handleClaims(w http.ResponseWriter, r *http.Request, st *state) {
+	served := []string{}
+	for _, c := range st.verifier.Catalog() {
+		served = append(served, c.ID)
+	}
+	writeResponse(w, r, http.StatusOK, ClaimsResponse{Claims: claims.Taxonomy(served)})
+}
+
+// handleGetVK serves a verifying key of the registry, immutable: a hash
+// always names the same key
+func (s *Server) handleGetVK(w http.ResponseWriter, r *http.Request) {
+	st := s.current()
+	if st.registry == nil {
+		writeProblem(w, r, newProblem(ProblemVKNotFound, http.StatusNotFound, "no registry"))
+		return
+	}
+	hash := r.PathValue("hash")
+	var vk []byte
+	err := faultsOf(r.Context()).storageError()
+	if err == nil {
+		vk, err = st.registry.Get(r.Context(), hash)
+	}
+	switch {
+	case errors.Is(err, artifact.ErrNotFound):
+		writeProblem(w, r, newProblem(ProblemVKNotFound, http.StatusNotFound, hash))
+		return
+	case errors.Is(err, artifact.ErrInvalidVK):
+		p := newProblem(ProblemInvalidRequest, http.StatusBadRequest, err.Error())
+		p.Field = "hash"
+		writeProblem(w, r, p)
+		return
+	case err != nil:
+		writeProblem(w, r, unavailable(err))
+		return
+	}
+	w.Header().Set("Content-Type", mediaTypeBinary)
+	w.Header().Set("ETag", strconv.Quote(hash))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(vk)
+}
+
+// handlePutVK registers the verifying key of the body (gnark binary
+// encoding), 201 when added and 200 when the registry already holds it
+func (s *Server) handlePutVK(w http.ResponseWriter, r *http.Request) {
+	st := s.current()
+	if st.registry == nil || len(st.adminKeys) == 0 {
+		writeProblem(w, r, newProblem(ProblemVKNotFound, http.StatusNotFound, "registration disabled"))
+		return
+	}
+	if !authorized(r, st.adminKeys) {
+		writeProblem(w, r, newProblem(ProblemUnauthorized, http.StatusUnauthorized, ""))
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, st.maxBodySize))
+	if err != nil {
+		writeProblem(w, r, newProblem(ProblemInvalidRequest, http.StatusBadRequest, err.Error()))
+		return
+	}
+	var hash string
+	var created bool
+	err = faultsOf(r.Context()).storageError()
+	if err == nil {
+		hash, created, err = st.registry.Put(r.Context(), body)
+	}
+	switch {
+	case errors.Is(err, artifact.ErrInvalidVK):
+		writeProblem(w, r, newProblem(ProblemInvalidRequest, http.StatusBadRequest, err.Error()))
+		return
+	case err != nil:
+		writeProblem(w, r, unavailable(err))
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Location", "/vks/"+hash)
+	writeJSON(w, status, VKResponse{VKHash: hash})
+}
+
+// handleGetArtifact serves an artifact of the cluster manifest, or the
+// manifest itself, to the replicas. Only the artifacts the manifest lists are
+// served; they are public (keys and constraint systems) and checked against
+// the manifest by the replicas.
+func (s *Server) handleGetArtifact(w http.ResponseWriter, r *http.Request) {
+	st := s.current()
+	key := r.PathValue("key")
+	if !st.serveArtifacts || st.manifest == nil || (key != st.manifestKey && !st.manifest.Has(key)) {
+		writeProblem(w, r, newProblem(ProblemNotReady, http.StatusNotFound, key))
+		return
+	}
+	err := faultsOf(r.Context()).storageError()
+	var rc io.ReadCloser
+	if err == nil {
+		rc, err = s.opts.Store.Get(r.Context(), key)
+	}
+	if err != nil {
+		writeProblem(w, r, unavailable(err))
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", mediaTypeBinary)
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, rc)
+}
+
+// unavailable returns the problem of a failed dependency (the artifact store,
+// the registry) or a canceled request: 503, the client retries later
+func unavailable(err error) *Problem {
+	return newProblem(ProblemUnavailable, http.StatusServiceUnavailable, err.Error())
+}
+
+// writeResponse writes v as CBOR when the client accepts application/cbor,
+// as JSON otherwise
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, v any) {
+	if !strings.Contains(r.Header.Get("Accept"), mediaTypeCBOR) {
+		writeJSON(w, status, v)
+		return
+	}
+	data, err := cbor.Marshal(v)
+	if err != nil {
+		writeProblem(w, r, newProblem(ProblemInternal, http.StatusInternalServerError, err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", mediaTypeCBOR)
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
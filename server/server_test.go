@@ -0,0 +1,1389 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mynextid/eudi-zk/artifact"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/cost"
+	"github.com/mynextid/eudi-zk/extension"
+	"github.com/mynextid/eudi-zk/models"
+	"github.com/mynextid/eudi-zk/policy"
+	"github.com/mynextid/eudi-zk/verifier"
+)
+
+// cubeCircuit proves knowledge of X with X^3 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+type fixture struct {
+	server        *httptest.Server
+	api           *Server
+	holderKey     *ecdsa.PrivateKey
+	vk            groth16.VerifyingKey
+	vkHash        string
+	proof         []byte
+	publicWitness []byte
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := frontend.NewWitness(&cubeCircuit{X: 3, Y: 27}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, err := w.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{vk: vk}
+	var buf bytes.Buffer
+	proof.WriteTo(&buf)
+	f.proof = buf.Bytes()
+	if f.publicWitness, err = publicWitness.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+
+	vkHash, err := common.VerifyingKeyHash(vk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.vkHash = hex.EncodeToString(vkHash[:])
+
+	if f.holderKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := models.NewPresentationVerifier(func(header models.PresentationHeader) (*ecdsa.PublicKey, error) {
+		return &f.holderKey.PublicKey, nil
+	})
+	schema := &models.PayloadSchema{Required: []string{"nonce"}, Properties: map[string]string{"nonce": "string"}}
+	if err := verifier.AddCircuit("cube/v1", vk, schema); err != nil {
+		t.Fatal(err)
+	}
+
+	f.api = New(verifier)
+	f.server = httptest.NewServer(f.api)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// presentation signs a presentation of the payload, issued now unless its iat
+// is set
+func (f *fixture) presentation(t *testing.T, header models.PresentationHeader, payload models.PresentationPayload) string {
+	t.Helper()
+	if payload.IssuedAt == 0 {
+		payload.IssuedAt = time.Now().Unix()
+	}
+	compact, err := models.SignPresentation(header, payload, f.proof, f.holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compact
+}
+
+func post(t *testing.T, url, contentType, body string) (int, VerifyResponse) {
+	t.Helper()
+	res, err := http.Post(url, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var vr VerifyResponse
+	if err := json.NewDecoder(res.Body).Decode(&vr); err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, vr
+}
+
+// postProblem posts the body and decodes the problem of the error response
+func postProblem(t *testing.T, url, contentType, body string) Problem {
+	t.Helper()
+	res, err := http.Post(url, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	return problemFrom(t, res)
+}
+
+// problemFrom decodes the problem of an error response
+func problemFrom(t *testing.T, res *http.Response) Problem {
+	t.Helper()
+	if mediaType := res.Header.Get("Content-Type"); mediaType != mediaTypeProblem {
+		t.Fatalf("expected a problem, got %d %s", res.StatusCode, mediaType)
+	}
+	var p Problem
+	if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != res.StatusCode {
+		t.Errorf("problem status %d, response status %d", p.Status, res.StatusCode)
+	}
+	return p
+}
+
+func TestVerify(t *testing.T) {
+	f := newFixture(t)
+
+	body, _ := json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness})
+	if status, res := post(t, f.server.URL+"/verify", "application/json", string(body)); status != http.StatusOK || !res.Valid {
+		t.Fatalf("expected a valid proof, got %d %+v", status, res)
+	}
+
+	body, _ = json.Marshal(VerifyRequest{Circuit: "other/v1", Proof: f.proof, PublicWitness: f.publicWitness})
+	if p := postProblem(t, f.server.URL+"/verify", "application/json", string(body)); p.Status != http.StatusUnprocessableEntity || p.Type != ProblemCircuitNotFound || p.Circuit != "other/v1" {
+		t.Fatalf("expected circuit_not_found for an unknown circuit, got %+v", p)
+	}
+
+	body, _ = json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness[:8]})
+	if p := postProblem(t, f.server.URL+"/verify", "application/json", string(body)); p.Type != ProblemWitnessInvalid {
+		t.Fatalf("expected witness_invalid for a truncated public witness, got %+v", p)
+	}
+
+	if p := postProblem(t, f.server.URL+"/verify", "application/json", "{"); p.Status != http.StatusBadRequest || p.Type != ProblemInvalidRequest || p.Instance != "/verify" {
+		t.Fatalf("expected invalid_request for an invalid body, got %+v", p)
+	}
+}
+
+func TestVerifyInputLabels(t *testing.T) {
+	f := newFixture(t)
+	if err := f.api.Verifier.AddInputLabels("cube/v1", &cubeCircuit{}); err != nil {
+		t.Fatal(err)
+	}
+	var logged bytes.Buffer
+	f.api.Log = slog.New(slog.NewJSONHandler(&logged, nil))
+
+	body, _ := json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness})
+	status, res := post(t, f.server.URL+"/verify", "application/json", string(body))
+	if status != http.StatusOK || !reflect.DeepEqual(res.PublicInputs, map[string]string{"Y": "27"}) {
+		t.Fatalf("expected the labeled public inputs, got %d %+v", status, res)
+	}
+	var entry struct {
+		Circuit      string            `json:"circuit"`
+		PublicInputs map[string]string `json:"public_inputs"`
+	}
+	if err := json.Unmarshal(logged.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Circuit != "cube/v1" || entry.PublicInputs["Y"] != "27" {
+		t.Fatalf("unexpected log entry %s", logged.Bytes())
+	}
+}
+
+// pairCircuit has one public input more than cubeCircuit
+type pairCircuit struct {
+	X, Y frontend.Variable `gnark:",public"`
+}
+
+func (c *pairCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(c.X, c.Y)
+	return nil
+}
+
+func TestVerifyDiagnostics(t *testing.T) {
+	f := newFixture(t)
+
+	w, err := frontend.NewWitness(&pairCircuit{X: 27, Y: 27}, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairWitness, err := w.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherWitness := bytes.Clone(f.publicWitness)
+	otherWitness[len(otherWitness)-1]++
+
+	cases := map[string]struct {
+		proof, publicWitness []byte
+		// without and with diagnostics
+		problem, diagnosed ProblemType
+		code               models.ErrorCode
+	}{
+		"malformed proof":    {f.proof[:len(f.proof)-1], f.publicWitness, ProblemProofFailed, ProblemMalformedProof, models.CodeMalformedProof},
+		"malformed witness":  {f.proof, f.publicWitness[:8], ProblemWitnessInvalid, ProblemMalformedProof, models.CodeMalformedProof},
+		"public input count": {f.proof, pairWitness, ProblemWitnessInvalid, ProblemPublicInputCount, models.CodePublicInputCount},
+		"invalid proof":      {f.proof, otherWitness, ProblemProofFailed, ProblemProofFailed, models.CodeProofFailed},
+	}
+	for name, c := range cases {
+		body, _ := json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: c.proof, PublicWitness: c.publicWitness})
+
+		f.api.Diagnostics = false
+		p := postProblem(t, f.server.URL+"/verify", "application/json", string(body))
+		if p.Type != c.problem || p.Code != "" || p.Stage != "" {
+			t.Errorf("%s: expected %s without diagnostics, got %+v", name, c.problem, p)
+		}
+
+		f.api.Diagnostics = true
+		p = postProblem(t, f.server.URL+"/verify", "application/json", string(body))
+		if p.Type != c.diagnosed || p.Code != c.code || p.Stage != models.StageProof {
+			t.Errorf("%s: expected %s (%s) with diagnostics, got %+v", name, c.diagnosed, c.code, p)
+		}
+	}
+}
+
+func TestAnomaly(t *testing.T) {
+	f := newFixture(t)
+	f.api.Anomaly = &AnomalyConfig{MinRequests: 4, ThrottleRatio: 0.5, ThrottleInterval: 60, BlockRatio: 0.9}
+
+	valid, _ := json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness})
+	invalid, _ := json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness[:8]})
+	verify := func(key string, body []byte) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, f.server.URL+"/verify", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	// half of the proofs of the prober are invalid: throttled
+	for _, body := range [][]byte{valid, invalid, valid, invalid} {
+		verify("prober", body)
+	}
+	res := verify("prober", valid)
+	if p := problemFrom(t, res); p.Status != http.StatusTooManyRequests || p.Type != ProblemTooManyRequests || res.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected a throttled client, got %+v", p)
+	}
+	// the other clients are not
+	for range 5 {
+		if res := verify("wallet", valid); res.StatusCode != http.StatusOK {
+			t.Fatalf("expected a verified proof, got %d", res.StatusCode)
+		}
+	}
+	// nothing but invalid proofs: blocked
+	for range 4 {
+		verify("attacker", invalid)
+	}
+	if p := problemFrom(t, verify("attacker", valid)); p.Status != http.StatusForbidden || p.Type != ProblemClientBlocked {
+		t.Fatalf("expected a blocked client, got %+v", p)
+	}
+
+	stats := f.api.FailureStats()
+	prober := stats.Clients[clientID(&http.Request{Header: http.Header{"Authorization": {"Bearer prober"}}})]
+	if stats.Verifications != 13 || stats.Classes["witness_invalid"] != 6 || stats.Throttled != 1 || stats.Blocked != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if prober.Requests != 4 || prober.Invalid != 2 || prober.Classes["witness_invalid"] != 2 || prober.ThrottledUntil.IsZero() || !prober.BlockedUntil.IsZero() {
+		t.Fatalf("unexpected prober stats %+v", prober)
+	}
+	if _, err := json.Marshal(stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&AnomalyConfig{ThrottleRatio: 2}).validate(); err == nil {
+		t.Fatal("expected an invalid ratio")
+	}
+}
+
+// timestampCircuit exposes the timestamp the holder signed, as the circuits
+// with timestamped challenges
+type timestampCircuit struct {
+	Signed             frontend.Variable
+	ChallengeTimestamp []frontend.Variable `gnark:",public"`
+}
+
+func (c *timestampCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(c.Signed, c.ChallengeTimestamp[0])
+	return nil
+}
+
+func TestVerifyTimestamp(t *testing.T) {
+	template := &timestampCircuit{ChallengeTimestamp: make([]frontend.Variable, 1)}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	verifier := models.NewPresentationVerifier(nil)
+	verifier.Now = func() time.Time { return now }
+	if err := verifier.AddCircuit("timestamp/v1", vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.AddTimestamp("timestamp/v1", template, models.TimestampPolicy{MaxSkew: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(New(verifier))
+	defer srv.Close()
+
+	request := func(timestamp time.Time) string {
+		t.Helper()
+		assignment := &timestampCircuit{Signed: timestamp.Unix(), ChallengeTimestamp: []frontend.Variable{timestamp.Unix()}}
+		w, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := groth16.Prove(ccs, pk, w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicWitness, _ := w.Public()
+		var buf bytes.Buffer
+		proof.WriteTo(&buf)
+		pw, err := publicWitness.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := json.Marshal(VerifyRequest{Circuit: "timestamp/v1", Proof: buf.Bytes(), PublicWitness: pw})
+		return string(body)
+	}
+
+	signed := now.Add(-30 * time.Second)
+	if status, res := post(t, srv.URL+"/verify", "application/json", request(signed)); status != http.StatusOK || !res.ChallengeTimestamp.Equal(signed) || res.ChallengeAge != 30 {
+		t.Fatalf("expected a current timestamp to be accepted, got %d %+v", status, res)
+	}
+	if p := postProblem(t, srv.URL+"/verify", "application/json", request(now.Add(-2*time.Minute))); p.Type != ProblemStaleTimestamp {
+		t.Fatalf("expected stale_timestamp for a replayed signature, got %+v", p)
+	}
+	if p := postProblem(t, srv.URL+"/verify", "application/json", request(now.Add(2*time.Minute))); p.Type != ProblemStaleTimestamp {
+		t.Fatalf("expected stale_timestamp for a future timestamp, got %+v", p)
+	}
+}
+
+func TestVerifyPresentation(t *testing.T) {
+	f := newFixture(t)
+
+	header := models.PresentationHeader{Circuit: "cube/v1", VKHash: f.vkHash}
+	payload := models.PresentationPayload{Nonce: "n-1", IssuedAt: time.Now().Unix(), PublicWitness: f.publicWitness}
+	compact := f.presentation(t, header, payload)
+
+	status, res := post(t, f.server.URL+"/presentations/verify", "text/plain", compact)
+	if status != http.StatusOK || !res.Valid || res.Payload.Nonce != "n-1" {
+		t.Fatalf("expected a valid presentation, got %d %+v", status, res)
+	}
+
+	body, _ := json.Marshal(PresentationVerifyRequest{Presentation: compact})
+	if status, res := post(t, f.server.URL+"/presentations/verify", "application/json", string(body)); status != http.StatusOK || !res.Valid {
+		t.Fatalf("expected a valid presentation, got %d %+v", status, res)
+	}
+}
+
+func TestVerifyPresentationCOSE(t *testing.T) {
+	f := newFixture(t)
+
+	header := models.PresentationHeader{Circuit: "cube/v1", VKHash: f.vkHash}
+	payload := models.PresentationPayload{Nonce: "n-1", IssuedAt: time.Now().Unix(), PublicWitness: f.publicWitness, Claims: map[string]any{"age_over_18": true}}
+	data, err := models.SignPresentationCOSE(header, payload, f.proof, f.holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compact := f.presentation(t, header, payload); len(data) >= len(compact) {
+		t.Errorf("COSE presentation (%d bytes) is not smaller than the compact one (%d bytes)", len(data), len(compact))
+	}
+	if qr, err := models.EstimateQR(len(data), models.QRLevelM); err != nil || qr.Modules != 17+4*qr.Version {
+		t.Errorf("unexpected QR estimate %+v: %v", qr, err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, f.server.URL+"/presentations/verify", bytes.NewReader(data))
+	req.Header.Set("Content-Type", models.PresentationMediaTypeCOSE)
+	req.Header.Set("Accept", "application/cbor")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var vr VerifyResponse
+	if err := cbor.NewDecoder(res.Body).Decode(&vr); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || !vr.Valid || vr.Payload.Nonce != "n-1" || vr.Payload.Claims["age_over_18"] != true {
+		t.Fatalf("expected a valid presentation, got %d %+v", res.StatusCode, vr)
+	}
+
+	// the COSE signature does not cover a modified payload
+	data[len(data)-70] ^= 1
+	if status, res := post(t, f.server.URL+"/presentations/verify", models.PresentationMediaTypeCOSE, string(data)); status != http.StatusUnprocessableEntity || res.Valid {
+		t.Fatalf("expected an invalid presentation, got %d %+v", status, res)
+	}
+}
+
+func TestVerifyPresentationEncrypted(t *testing.T) {
+	f := newFixture(t)
+
+	header := models.PresentationHeader{Circuit: "cube/v1", VKHash: f.vkHash}
+	payload := models.PresentationPayload{Nonce: "n-1", IssuedAt: time.Now().Unix(), PublicWitness: f.publicWitness}
+	compact := f.presentation(t, header, payload)
+
+	verifierKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := models.NewJWK(verifierKey.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient.Kid = "verifier-1"
+	jwe, err := models.EncryptPresentation([]byte(compact), "", recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rejected without decryption key
+	if p := postProblem(t, f.server.URL+"/presentations/verify", models.PresentationMediaTypeJWE, jwe); p.Status != http.StatusUnsupportedMediaType || p.Type != ProblemInvalidRequest {
+		t.Fatalf("expected an unsupported encrypted presentation, got %+v", p)
+	}
+
+	f.api.DecryptionKey = verifierKey
+	status, res := post(t, f.server.URL+"/presentations/verify", models.PresentationMediaTypeJWE, jwe)
+	if status != http.StatusOK || !res.Valid || res.Payload.Nonce != "n-1" {
+		t.Fatalf("expected a valid presentation, got %d %+v", status, res)
+	}
+	body, _ := json.Marshal(PresentationVerifyRequest{Presentation: jwe})
+	if status, res := post(t, f.server.URL+"/presentations/verify", "application/json", string(body)); status != http.StatusOK || !res.Valid {
+		t.Fatalf("expected a valid presentation, got %d %+v", status, res)
+	}
+
+	// encrypted COSE presentation
+	data, err := models.SignPresentationCOSE(header, payload, f.proof, f.holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jweCOSE, err := models.EncryptPresentation(data, models.PresentationMediaTypeCOSE, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, res := post(t, f.server.URL+"/presentations/verify", "text/plain", jweCOSE); status != http.StatusOK || !res.Valid {
+		t.Fatalf("expected a valid COSE presentation, got %d %+v", status, res)
+	}
+
+	// encrypted to another key, or tampered
+	otherKey, _ := ecdh.P256().GenerateKey(rand.Reader)
+	other, _ := models.NewJWK(otherKey.PublicKey())
+	jweOther, err := models.EncryptPresentation([]byte(compact), "", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(jwe, ".")
+	tampered := "A"
+	if parts[3][0] == 'A' {
+		tampered = "B"
+	}
+	parts[3] = tampered + parts[3][1:]
+	for _, body := range []string{jweOther, strings.Join(parts, ".")} {
+		if p := postProblem(t, f.server.URL+"/presentations/verify", models.PresentationMediaTypeJWE, body); p.Type != ProblemPresentationInvalid {
+			t.Errorf("expected presentation_invalid, got %+v", p)
+		}
+	}
+}
+
+func TestVerifyPresentationInvalid(t *testing.T) {
+	f := newFixture(t)
+
+	header := models.PresentationHeader{Circuit: "cube/v1", VKHash: f.vkHash}
+	payload := models.PresentationPayload{Nonce: "n-1", PublicWitness: f.publicWitness}
+	compact := f.presentation(t, header, payload)
+	parts := strings.Split(compact, ".")
+
+	// public witness of another statement: Y = 28
+	w, _ := frontend.NewWitness(&cubeCircuit{Y: 28}, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	otherWitness, _ := w.MarshalBinary()
+
+	tests := map[string]struct {
+		compact string
+		typ     ProblemType
+		field   string
+	}{
+		"schema":         {f.presentation(t, header, models.PresentationPayload{PublicWitness: f.publicWitness}), ProblemWitnessInvalid, "nonce"},
+		"public witness": {f.presentation(t, header, models.PresentationPayload{Nonce: "n-1", PublicWitness: otherWitness}), ProblemProofFailed, ""},
+		"signature":      {strings.Join(append(parts[:3:3], parts[3][:len(parts[3])-4]+"AAAA"), "."), ProblemPresentationInvalid, ""},
+		"format":         {strings.Join(parts[:3], "."), ProblemPresentationInvalid, ""},
+		"circuit":        {f.presentation(t, models.PresentationHeader{Circuit: "other/v1", VKHash: f.vkHash}, payload), ProblemCircuitNotFound, ""},
+	}
+	for name, tt := range tests {
+		p := postProblem(t, f.server.URL+"/presentations/verify", "text/plain", tt.compact)
+		if p.Status != http.StatusUnprocessableEntity || p.Type != tt.typ || p.Field != tt.field || p.Title == "" || p.Detail == "" {
+			t.Errorf("%s: expected a %s problem, got %+v", name, tt.typ, p)
+		}
+	}
+}
+
+func TestVersionMismatch(t *testing.T) {
+	f := newFixture(t)
+	payload := models.PresentationPayload{Nonce: "n-1", PublicWitness: f.publicWitness}
+	served := []models.CircuitVersion{{ID: "cube/v1", VKHash: f.vkHash}}
+
+	check := func(name string, p Problem, circuit string) {
+		t.Helper()
+		if p.Status != http.StatusConflict || p.Type != ProblemVersionMismatch || p.Circuit != circuit || !reflect.DeepEqual(p.Versions, served) {
+			t.Errorf("%s: expected a version mismatch listing %+v, got %+v", name, served, p)
+		}
+	}
+
+	// another version of a registered circuit, or another verifying key
+	body, _ := json.Marshal(VerifyRequest{Circuit: "cube/v2", Proof: f.proof, PublicWitness: f.publicWitness})
+	check("version", postProblem(t, f.server.URL+"/verify", "application/json", string(body)), "cube/v2")
+	body, _ = json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness, VKHash: strings.Repeat("00", 32)})
+	check("vk hash", postProblem(t, f.server.URL+"/verify", "application/json", string(body)), "cube/v1")
+	compact := f.presentation(t, models.PresentationHeader{Circuit: "cube/v1", VKHash: strings.Repeat("00", 32)}, payload)
+	check("presentation vk hash", postProblem(t, f.server.URL+"/presentations/verify", "text/plain", compact), "cube/v1")
+	compact = f.presentation(t, models.PresentationHeader{Circuit: "cube/v2", VKHash: f.vkHash}, payload)
+	check("presentation version", postProblem(t, f.server.URL+"/presentations/verify", "text/plain", compact), "cube/v2")
+
+	// the expected verifying key hash is accepted
+	body, _ = json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness, VKHash: f.vkHash})
+	if status, res := post(t, f.server.URL+"/verify", "application/json", string(body)); status != http.StatusOK || !res.Valid {
+		t.Fatalf("expected a valid proof, got %d %+v", status, res)
+	}
+
+	// protocol version
+	req, _ := http.NewRequest(http.MethodPost, f.server.URL+"/verify", strings.NewReader(string(body)))
+	req.Header.Set(ProtocolHeader, "2")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var p Problem
+	json.NewDecoder(res.Body).Decode(&p)
+	if res.StatusCode != http.StatusConflict || p.Type != ProblemVersionMismatch || !reflect.DeepEqual(p.ProtocolVersions, []int{ProtocolVersion}) {
+		t.Fatalf("expected a protocol version mismatch, got %d %+v", res.StatusCode, p)
+	}
+	if version := res.Header.Get(ProtocolHeader); version != strconv.Itoa(ProtocolVersion) {
+		t.Fatalf("expected the protocol version header, got %q", version)
+	}
+}
+
+func TestMinVersions(t *testing.T) {
+	f := newFixture(t)
+	payload := models.PresentationPayload{Nonce: "n-1", PublicWitness: f.publicWitness}
+	compact := f.presentation(t, models.PresentationHeader{Circuit: "cube/v1", VKHash: f.vkHash}, payload)
+	deprecation := models.Deprecation{Circuit: "cube", MinVersion: 2, Reason: "advisory-1"}
+	var err error
+	if f.api.Verifier.MinVersions, err = models.NewVersionPolicy(deprecation); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := postProblem(t, f.server.URL+"/presentations/verify", "text/plain", compact); p.Status != http.StatusConflict || p.Type != ProblemCircuitDeprecated || p.Circuit != "cube/v1" {
+		t.Fatalf("expected circuit_deprecated, got %+v", p)
+	}
+	body, _ := json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness})
+	if p := postProblem(t, f.server.URL+"/verify", "application/json", string(body)); p.Type != ProblemCircuitDeprecated {
+		t.Fatalf("expected circuit_deprecated for a raw proof, got %+v", p)
+	}
+
+	f.api.Verifier.MinVersions.WarnOnly = true
+	if status, res := post(t, f.server.URL+"/presentations/verify", "text/plain", compact); status != http.StatusOK || !reflect.DeepEqual(res.Deprecation, &deprecation) {
+		t.Fatalf("expected a deprecation warning, got %d %+v", status, res)
+	}
+
+	// distributed in the catalog
+	catalogKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.api.Catalog = &CatalogSigner{Key: catalogKey}
+	res, err := http.Get(f.server.URL + "/catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	signed, _ := io.ReadAll(res.Body)
+	catalog, err := models.ParseCatalog(string(signed), &catalogKey.PublicKey, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(catalog.Deprecations, []models.Deprecation{deprecation}) {
+		t.Fatalf("expected the deprecations in the catalog, got %+v", catalog.Deprecations)
+	}
+}
+
+func TestCircuitCost(t *testing.T) {
+	costs := &cost.Manifest{Hardware: "reference"}
+	costs.Add("eudi-vc/pop", cost.Sample{InputSizes: map[string]int{"CertBytes": 400}, Constraints: 200_000, ProveTime: 3 * time.Second})
+	s := New(models.NewPresentationVerifier(nil))
+	s.Costs = costs
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	get := func(path string) (int, CostResponse) {
+		res, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var cr CostResponse
+		if err := json.NewDecoder(res.Body).Decode(&cr); err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, cr
+	}
+
+	status, res := get("/circuits/eudi-vc%2Fpop/cost")
+	if status != http.StatusOK || res.Profile == nil || res.Estimate != nil {
+		t.Fatalf("expected the profile, got %d %+v", status, res)
+	}
+
+	status, res = get("/circuits/eudi-vc%2Fpop/cost?CertBytes=800")
+	if status != http.StatusOK || res.Estimate == nil || res.Estimate.Constraints != 400_000 || res.Estimate.ProveTime != 6*time.Second {
+		t.Fatalf("expected an estimate, got %d %+v", status, res)
+	}
+
+	if status, _ := get("/circuits/eudi-vc%2Fpop/cost?CertBytes=abc"); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid size, got %d", status)
+	}
+	if status, _ := get("/circuits/unknown/cost"); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown circuit, got %d", status)
+	}
+}
+
+func TestClaims(t *testing.T) {
+	f := newFixture(t)
+
+	get := func() ClaimsResponse {
+		t.Helper()
+		res, err := http.Get(f.server.URL + "/claims")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", res.StatusCode)
+		}
+		var body ClaimsResponse
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+	if body := get(); len(body.Claims) != 0 {
+		t.Fatalf("expected no claims proven by the cube circuit, got %+v", body.Claims)
+	}
+
+	if err := f.api.Verifier.AddCircuit("temporal/over18/v1", f.vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	body := get()
+	if len(body.Claims) != 1 || body.Claims[0].Name != "age_over_18" || len(body.Claims[0].Proofs) != 1 || body.Claims[0].Proofs[0].Circuit != "temporal/over18" {
+		t.Fatalf("unexpected claims %+v", body.Claims)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	f := newFixture(t)
+	res, err := http.Get(f.server.URL + "/capabilities")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body CapabilitiesResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || body.ProtocolVersion != ProtocolVersion || !slices.Contains(body.Backends, "groth16") {
+		t.Fatalf("unexpected capabilities %d %+v", res.StatusCode, body)
+	}
+	if body.Features.FaultInjection != faultInjection || body.Features.Plugins != extension.PluginsEnabled || body.Features.Catalog {
+		t.Fatalf("unexpected features %+v", body.Features)
+	}
+	if len(body.Circuits) != 1 || body.Circuits[0].ID != "cube/v1" || body.Limits.MaxBodySize != maxBodySize {
+		t.Fatalf("unexpected circuits or limits %+v", body)
+	}
+	if !slices.Equal(body.AcceptedAlgs, f.api.Verifier.AcceptedAlgs()) {
+		t.Fatalf("unexpected accepted algs %q", body.AcceptedAlgs)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	f := newFixture(t)
+
+	res, err := http.Get(f.server.URL + "/catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 without catalog signer, got %d", res.StatusCode)
+	}
+
+	// the signing key is read from a private JWK
+	signingKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := models.NewJWK(signingKey.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk.D, jwk.Kid = base64.RawURLEncoding.EncodeToString(signingKey.Bytes()), "catalog-1"
+	data, _ := json.Marshal(jwk)
+	path := filepath.Join(t.TempDir(), "catalog.jwk")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f.api.Catalog, err = readCatalogSigner(path, &CatalogConfig{Issuer: "https://verifier.example", TTL: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = http.Get(f.server.URL + "/catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var signed bytes.Buffer
+	if _, err := signed.ReadFrom(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != mediaTypeJWT || res.Header.Get("Cache-Control") != "public, max-age=3600" {
+		t.Fatalf("unexpected response %d %v", res.StatusCode, res.Header)
+	}
+
+	verificationKey, err := jwk.ECDSAPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := models.ParseCatalog(signed.String(), verificationKey, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalog.Issuer != "https://verifier.example" || catalog.ExpiresAt-catalog.IssuedAt != 3600 || len(catalog.Circuits) != 1 {
+		t.Fatalf("unexpected catalog %+v", catalog)
+	}
+	if c := catalog.Circuits[0]; c.ID != "cube/v1" || c.VKHash != f.vkHash || c.Schema == nil || c.Schema.Required[0] != "nonce" {
+		t.Fatalf("unexpected circuit %+v", c)
+	}
+
+	// expired, or signed by another key
+	if _, err := models.ParseCatalog(signed.String(), verificationKey, time.Now().Add(2*time.Hour)); !errors.Is(err, models.ErrCatalogExpired) {
+		t.Fatalf("expected ErrCatalogExpired, got %v", err)
+	}
+	if _, err := models.ParseCatalog(signed.String(), &f.holderKey.PublicKey, time.Now()); err == nil {
+		t.Fatal("expected an invalid signature")
+	}
+}
+
+func TestVKRegistry(t *testing.T) {
+	f := newFixture(t)
+	do := func(method, path, key string, body []byte) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, f.server.URL+path, bytes.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	if res := do(http.MethodGet, "/vks/"+f.vkHash, "", nil); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 without registry, got %d", res.StatusCode)
+	}
+	f.api.Registry = artifact.NewVKRegistry(artifact.NewFSStore(t.TempDir()))
+	f.api.AdminKeys = []string{"admin"}
+
+	// registered in raw encoding, stored under the hash of the compressed one
+	var raw bytes.Buffer
+	f.vk.WriteRawTo(&raw)
+	if res := do(http.MethodPost, "/vks", "", raw.Bytes()); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without admin key, got %d", res.StatusCode)
+	}
+	for _, status := range []int{http.StatusCreated, http.StatusOK} {
+		res := do(http.MethodPost, "/vks", "admin", raw.Bytes())
+		var vr VKResponse
+		json.NewDecoder(res.Body).Decode(&vr)
+		if res.StatusCode != status || vr.VKHash != f.vkHash || res.Header.Get("Location") != "/vks/"+f.vkHash {
+			t.Fatalf("unexpected registration %d %+v, expected %d", res.StatusCode, vr, status)
+		}
+	}
+	if p := problemFrom(t, do(http.MethodPost, "/vks", "admin", []byte("not a key"))); p.Type != ProblemInvalidRequest {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+
+	res := do(http.MethodGet, "/vks/"+f.vkHash, "", nil)
+	data, _ := io.ReadAll(res.Body)
+	digest := sha256.Sum256(data)
+	if res.StatusCode != http.StatusOK || hex.EncodeToString(digest[:]) != f.vkHash || res.Header.Get("ETag") != strconv.Quote(f.vkHash) {
+		t.Fatalf("unexpected verifying key %d %v", res.StatusCode, res.Header)
+	}
+	if p := problemFrom(t, do(http.MethodGet, "/vks/"+strings.Repeat("00", 32), "", nil)); p.Type != ProblemVKNotFound || p.Status != http.StatusNotFound {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+	if p := problemFrom(t, do(http.MethodGet, "/vks/"+strings.ToUpper(f.vkHash), "", nil)); p.Type != ProblemInvalidRequest || p.Field != "hash" {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+
+	// the verifier SDK fetches the key of a circuit pinned by hash
+	v := verifier.New(nil)
+	v.Registry = verifier.NewRegistry(f.server.URL)
+	v.AddCircuitHash("cube/v1", f.vkHash, nil)
+	if _, err := v.VerifyProof("cube/v1", f.proof, f.publicWitness); err != nil {
+		t.Fatal(err)
+	}
+	v.AddCircuitHash("cube/v2", strings.Repeat("00", 32), nil)
+	if _, err := v.VerifyProof("cube/v2", f.proof, f.publicWitness); err == nil {
+		t.Fatal("expected an error for a key missing from the registry")
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	f := newFixture(t)
+
+	// the verifying key of the fixture circuit in the configuration directory
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	vk.WriteTo(&buf)
+	if err := os.WriteFile(filepath.Join(dir, "cube.vk"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	writeConfig := func(cfg string) {
+		if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(`{"version": "v1", "circuits": {"cube/v1": {"verifying_key": "cube.vk"}},
+		"api_keys": ["key-1"], "admin_keys": ["admin"]}`)
+	s, err := NewFromConfig(t.Context(), path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	do := func(method, path, key string, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	health := func() HealthResponse {
+		t.Helper()
+		res, err := http.Get(srv.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var hr HealthResponse
+		if err := json.NewDecoder(res.Body).Decode(&hr); err != nil {
+			t.Fatal(err)
+		}
+		return hr
+	}
+
+	// the fixture proof does not verify with the key of another setup, the
+	// request is authorized and routed to the circuit
+	body, _ := json.Marshal(VerifyRequest{Circuit: "cube/v1", Proof: f.proof, PublicWitness: f.publicWitness})
+	if status := do(http.MethodPost, "/verify", "", string(body)); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without API key, got %d", status)
+	}
+	if status := do(http.MethodPost, "/verify", "key-1", string(body)); status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", status)
+	}
+	if hr := health(); hr.ConfigVersion != "v1" || len(hr.Circuits) != 1 {
+		t.Fatalf("unexpected health %+v", hr)
+	}
+
+	// rotate the API key, add a circuit and a body limit
+	writeConfig(`{"version": "v2", "circuits": {"cube/v1": {"verifying_key": "cube.vk"}, "cube/v2": {"verifying_key": "cube.vk"}},
+		"api_keys": ["key-2"], "admin_keys": ["admin"], "limits": {"max_body_size": 64}}`)
+	if status := do(http.MethodPost, "/admin/reload", "key-2", ""); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without admin key, got %d", status)
+	}
+	if status := do(http.MethodPost, "/admin/reload", "admin", ""); status != http.StatusOK {
+		t.Fatalf("reload failed: %d", status)
+	}
+	if hr := health(); hr.ConfigVersion != "v2" || len(hr.Circuits) != 2 {
+		t.Fatalf("unexpected health %+v", hr)
+	}
+	if status := do(http.MethodPost, "/verify", "key-1", string(body)); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with the rotated key, got %d", status)
+	}
+	if status := do(http.MethodPost, "/verify", "key-2", string(body)); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 beyond the body limit, got %d", status)
+	}
+
+	// a configuration failing to load keeps the running one
+	writeConfig(`{"version": "v3", "circuits": {"cube/v1": {"verifying_key": "missing.vk"}}, "admin_keys": ["admin"]}`)
+	if status := do(http.MethodPost, "/admin/reload", "admin", ""); status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a broken configuration, got %d", status)
+	}
+	writeConfig(`{"version": "v3", "unknown": true}`)
+	if err := s.Reload(t.Context()); err == nil {
+		t.Fatal("expected an error for an unknown member")
+	}
+	if hr := health(); hr.ConfigVersion != "v2" {
+		t.Fatalf("unexpected health %+v", hr)
+	}
+
+	// servers built with New cannot reload
+	res, err := http.Post(f.server.URL+"/admin/reload", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.StatusCode)
+	}
+}
+
+// extensionCube is the cube circuit registered by an external package
+type extensionCube struct {
+	configured *bool
+}
+
+func (extensionCube) ID() string                 { return "ext/cube/v1" }
+func (extensionCube) Template() frontend.Circuit { return &cubeCircuit{} }
+
+func (c extensionCube) ConfigureVerifier(v *models.PresentationVerifier) error {
+	*c.configured = true
+	return nil
+}
+
+func TestConfigExtension(t *testing.T) {
+	f := newFixture(t)
+	var configured bool
+	extension.Register(extensionCube{configured: &configured})
+
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	f.vk.WriteTo(&buf)
+	if err := os.WriteFile(filepath.Join(dir, "cube.vk"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"version": "v1", "circuits": {"ext/cube/v1": {"verifying_key": "cube.vk"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFromConfig(t.Context(), path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !configured {
+		t.Fatal("expected the extension to configure the verifier")
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// the public inputs are labeled with the template of the extension
+	body, _ := json.Marshal(VerifyRequest{Circuit: "ext/cube/v1", Proof: f.proof, PublicWitness: f.publicWitness})
+	status, res := post(t, srv.URL+"/verify", "application/json", string(body))
+	if status != http.StatusOK || !reflect.DeepEqual(res.PublicInputs, map[string]string{"Y": "27"}) {
+		t.Fatalf("expected the labeled public inputs, got %d %+v", status, res)
+	}
+}
+
+func TestConfigPresentationAge(t *testing.T) {
+	f := newFixture(t)
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	f.vk.WriteTo(&buf)
+	if err := os.WriteFile(filepath.Join(dir, "cube.vk"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"version": "v1", "circuits": {"cube/v1": {"verifying_key": "cube.vk"}},
+		"max_presentation_age": 300, "clock_skew": 30, "replay_window": 600, "diagnostics": true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFromConfig(t.Context(), path, Options{ResolveKey: func(models.PresentationHeader) (*ecdsa.PublicKey, error) {
+		return &f.holderKey.PublicKey, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// a presentation older than the maximum age, whatever its exp
+	issuedAt := time.Now().Add(-time.Hour)
+	compact := f.presentation(t, models.PresentationHeader{Circuit: "cube/v1", VKHash: f.vkHash}, models.PresentationPayload{
+		IssuedAt: issuedAt.Unix(), ExpiresAt: issuedAt.Add(24 * time.Hour).Unix(), PublicWitness: f.publicWitness,
+	})
+	problem := postProblem(t, srv.URL+"/presentations/verify", "application/jwt", compact)
+	if problem.Code != models.CodeExpired {
+		t.Fatalf("expected an expired presentation, got %+v", problem)
+	}
+
+	// a presentation is verified once within the replay window
+	compact = f.presentation(t, models.PresentationHeader{Circuit: "cube/v1", VKHash: f.vkHash}, models.PresentationPayload{
+		ID: "c1b2", IssuedAt: time.Now().Unix(), PublicWitness: f.publicWitness,
+	})
+	if status, res := post(t, srv.URL+"/presentations/verify", "application/jwt", compact); status != http.StatusOK || !res.Valid {
+		t.Fatalf("expected a valid presentation, got %d %+v", status, res)
+	}
+	if problem := postProblem(t, srv.URL+"/presentations/verify", "application/jwt", compact); problem.Type != ProblemReplayed || problem.Code != models.CodeReplayed {
+		t.Fatalf("expected a replayed presentation, got %+v", problem)
+	}
+}
+
+func TestChannelBinding(t *testing.T) {
+	f := newFixture(t)
+	f.api.ChannelBinding = &ChannelBindingConfig{Type: models.ChannelBindingSession}
+	send := func(method, path, session, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, f.server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/jwt")
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: defaultSessionCookie, Value: session})
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	res := send(http.MethodGet, "/challenge", "s-1", "")
+	var challenge ChallengeResponse
+	if err := json.NewDecoder(res.Body).Decode(&challenge); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || challenge.ChannelBinding != models.ChannelBindingSession || challenge.SessionCookie != defaultSessionCookie {
+		t.Fatalf("unexpected challenge %d %+v", res.StatusCode, challenge)
+	}
+	if problem := problemFrom(t, send(http.MethodGet, "/challenge", "", "")); problem.Type != ProblemInvalidRequest {
+		t.Fatalf("expected a challenge without session to be refused, got %+v", problem)
+	}
+
+	compact := f.presentation(t, models.PresentationHeader{Circuit: "cube/v1", VKHash: f.vkHash}, models.PresentationPayload{
+		Nonce: challenge.Nonce, IssuedAt: time.Now().Unix(), PublicWitness: f.publicWitness,
+	})
+	if res := send(http.MethodPost, "/presentations/verify", "s-1", compact); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the presentation to verify in its session, got %+v", problemFrom(t, res))
+	}
+	// relayed from another session, or without session
+	for _, session := range []string{"s-2", ""} {
+		if problem := problemFrom(t, send(http.MethodPost, "/presentations/verify", session, compact)); problem.Type != ProblemChannelMismatch {
+			t.Fatalf("session %q: expected a channel mismatch, got %+v", session, problem)
+		}
+	}
+}
+
+func TestConfigMode(t *testing.T) {
+	t.Cleanup(func() { common.SetMode(common.ModeFull) })
+	f := newFixture(t)
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	f.vk.WriteTo(&buf)
+	if err := os.WriteFile(filepath.Join(dir, "cube.vk"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"circuits": {"cube/v1": {"verifying_key": "cube.vk"}}, "mode": "verify-only"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFromConfig(t.Context(), path, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if m := common.CurrentMode(); m != common.ModeVerifyOnly {
+		t.Fatalf("mode %s, expected %s", m, common.ModeVerifyOnly)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"circuits": {}, "mode": "production"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFromConfig(t.Context(), path, Options{}); err == nil {
+		t.Fatal("expected an unknown mode to be refused")
+	}
+}
+
+func TestConfigProvenance(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	vk.WriteTo(&buf)
+	if err := os.WriteFile(filepath.Join(dir, "cube.vk"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(buf.Bytes())
+	sig, err := common.SignArtifact(common.ArtifactSigner{KeyID: "ops", Key: private}, common.ArtifactVerifyingKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cube.vk.sig"), sig, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the same key, unsigned
+	if err := os.WriteFile(filepath.Join(dir, "unsigned.vk"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	load := func(cfg string) error {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := NewFromConfig(t.Context(), path, Options{})
+		return err
+	}
+	trusted := `"trusted_signers": {"ops": "` + base64.StdEncoding.EncodeToString(public) + `"}`
+
+	if err := load(`{"circuits": {"cube/v1": {"verifying_key": "cube.vk", "signer": "ops"}}, ` + trusted + `}`); err != nil {
+		t.Fatal(err)
+	}
+	for name, cfg := range map[string]string{
+		"unsigned":        `{"circuits": {"cube/v1": {"verifying_key": "unsigned.vk"}}, ` + trusted + `}`,
+		"other signer":    `{"circuits": {"cube/v1": {"verifying_key": "cube.vk", "signer": "ci"}}, ` + trusted + `}`,
+		"untrusted":       `{"circuits": {"cube/v1": {"verifying_key": "cube.vk", "signer": "ops"}}}`,
+		"invalid trusted": `{"circuits": {}, "trusted_signers": {"ops": "AAAA"}}`,
+	} {
+		if err := load(cfg); err == nil {
+			t.Errorf("%s: expected the configuration to be refused", name)
+		}
+	}
+}
+
+func TestReplica(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderDir, replicaDir := t.TempDir(), t.TempDir()
+	var buf bytes.Buffer
+	vk.WriteTo(&buf)
+	if err := os.WriteFile(filepath.Join(leaderDir, "cube.vk"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := `{"version": "v1", "circuits": {"cube/v1": {"verifying_key": "cube.vk"}}, "replication": {"serve": true}}`
+	for _, dir := range []string{leaderDir, replicaDir} {
+		if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(cfg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the leader refuses to serve without a manifest
+	if _, err := NewFromConfig(t.Context(), filepath.Join(leaderDir, "config.json"), Options{}); !errors.Is(err, artifact.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound without manifest, got %v", err)
+	}
+	var leader atomic.Pointer[Server]
+	leaderSrv := httptest.NewServer(http.StripPrefix("/leader", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s := leader.Load(); s != nil {
+			s.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})))
+	defer leaderSrv.Close()
+
+	errs := make(chan error, 16)
+	replica, err := NewReplica(t.Context(), filepath.Join(replicaDir, "config.json"), Options{
+		Leader:        artifact.NewHTTPStore(leaderSrv.URL + "/leader/artifacts"),
+		RetryInterval: 10 * time.Millisecond,
+	}, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicaSrv := httptest.NewServer(replica)
+	defer replicaSrv.Close()
+	status := func(srv *httptest.Server, method, path string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader("{}"))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// not ready until the leader publishes its manifest
+	if err := <-errs; !errors.Is(err, artifact.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if code := status(replicaSrv, http.MethodGet, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before replication, got %d", code)
+	}
+	if code := status(replicaSrv, http.MethodPost, "/verify"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before replication, got %d", code)
+	}
+
+	store := artifact.NewFSStore(leaderDir)
+	m, err := artifact.BuildManifest(t.Context(), store, "cube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := artifact.PutManifest(t.Context(), store, artifact.ManifestKey, m); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFromConfig(t.Context(), filepath.Join(leaderDir, "config.json"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader.Store(s)
+	if code := status(leaderSrv, http.MethodGet, "/leader/artifacts/config.json"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an artifact out of the manifest, got %d", code)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for status(replicaSrv, http.MethodGet, "/readyz") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("replica not ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	res, err := http.Get(replicaSrv.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var hr HealthResponse
+	if err := json.NewDecoder(res.Body).Decode(&hr); err != nil {
+		t.Fatal(err)
+	}
+	if hr.ManifestVersion != m.Version || len(hr.Circuits) != 1 {
+		t.Fatalf("unexpected readiness %+v", hr)
+	}
+	replicated, err := os.ReadFile(filepath.Join(replicaDir, "cube.vk"))
+	if err != nil || !bytes.Equal(replicated, buf.Bytes()) {
+		t.Fatalf("unexpected replicated verifying key (%v)", err)
+	}
+}
+
+func TestConfigPolicy(t *testing.T) {
+	f := newFixture(t)
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	f.vk.WriteTo(&buf)
+	os.WriteFile(filepath.Join(dir, "cube.vk"), buf.Bytes(), 0o644)
+	os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte(`
+version: p1
+circuits: [cube/v1]
+max_proof_age: 1h
+nonce:
+  required: true
+  audience: https://verifier.example
+`), 0o644)
+	path := filepath.Join(dir, "config.json")
+	os.WriteFile(path, []byte(`{"circuits": {"cube/v1": {"verifying_key": "cube.vk"}}, "policy": "policy.yaml"}`), 0o644)
+
+	s, err := NewFromConfig(t.Context(), path, Options{ResolveKey: func(models.PresentationHeader) (*ecdsa.PublicKey, error) {
+		return &f.holderKey.PublicKey, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	header := models.PresentationHeader{Kid: "holder-1", Circuit: "cube/v1", VKHash: f.vkHash}
+	payload := models.PresentationPayload{Audience: "https://verifier.example", Nonce: "n-1", IssuedAt: time.Now().Unix(), PublicWitness: f.publicWitness}
+	request := func(payload models.PresentationPayload, nonce string) string {
+		body, _ := json.Marshal(PresentationVerifyRequest{Presentation: f.presentation(t, header, payload), Nonce: nonce})
+		return string(body)
+	}
+
+	if status, vr := post(t, srv.URL+"/presentations/verify", "application/json", request(payload, "n-1")); status != http.StatusOK || !vr.Valid {
+		t.Fatalf("expected a valid presentation, got %d", status)
+	}
+
+	// a verified presentation for another request
+	p := postProblem(t, srv.URL+"/presentations/verify", "application/json", request(payload, "n-2"))
+	if p.Type != ProblemPolicyViolation || p.Status != http.StatusForbidden || p.Rule != policy.RuleNonce {
+		t.Fatalf("expected a nonce violation, got %+v", p)
+	}
+	old := payload
+	old.IssuedAt, old.ExpiresAt = time.Now().Add(-2*time.Hour).Unix(), time.Now().Add(time.Hour).Unix()
+	if p := postProblem(t, srv.URL+"/presentations/verify", "application/json", request(old, "n-1")); p.Rule != policy.RuleMaxProofAge {
+		t.Fatalf("expected a proof age violation, got %+v", p)
+	}
+
+	// an invalid policy is not applied
+	os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte("version: p2\nmax_proof_age: 3600\n"), 0o644)
+	if err := s.Reload(t.Context()); err == nil {
+		t.Fatal("expected the invalid policy to be rejected")
+	}
+}
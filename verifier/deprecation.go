@@ -0,0 +1,159 @@
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitDeprecated is the failure class of a DeprecationError
+var ErrCircuitDeprecated = errors.New("circuit version deprecated")
+
+// versionSuffix is the version segment ending the circuit ids (eudi-vc/pop/v1)
+var versionSuffix = regexp.MustCompile(`/v([0-9]+)$`)
+
+// CircuitFamily returns the circuit id without its version segment, the
+// versions of a circuit share the family
+func CircuitFamily(circuitID string) string {
+	return versionSuffix.ReplaceAllString(circuitID, "")
+}
+
+// CircuitVersionNumber returns the version of the version segment of the
+// circuit id, 1 for an id without version segment (the circuits were
+// versioned from their second version on)
+func CircuitVersionNumber(circuitID string) int {
+	m := versionSuffix.FindStringSubmatch(circuitID)
+	if m == nil {
+		return 1
+	}
+	version, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 1
+	}
+	return version
+}
+
+// Deprecation is the minimum version of a circuit family accepted by the
+// verifiers, raised when a vulnerability is found in the former versions.
+// Deprecations are distributed in the signed catalog (models.Catalog).
+type Deprecation struct {
+	// Circuit is the circuit family (CircuitFamily), e.g. eudi-vc/pop
+	Circuit    string `json:"circuit"`
+	MinVersion int    `json:"min_version"`
+	// Reason is for humans, e.g. the advisory of the vulnerability
+	Reason string `json:"reason,omitempty"`
+	// EnforceAt (seconds since the epoch) is the end of the grace period:
+	// proofs of the former versions are only warned of until then, rejected
+	// from then on. Enforced at once when 0.
+	EnforceAt int64 `json:"enforce_at,omitempty"`
+}
+
+// DeprecationError is returned for a proof of a circuit version below the
+// minimum version of its family
+type DeprecationError struct {
+	Circuit     string
+	Version     int
+	Deprecation Deprecation
+}
+
+func (e *DeprecationError) Error() string {
+	msg := fmt.Sprintf("%s: %q is version %d, %s requires version %d", ErrCircuitDeprecated, e.Circuit, e.Version, e.Deprecation.Circuit, e.Deprecation.MinVersion)
+	if e.Deprecation.Reason != "" {
+		msg += " (" + e.Deprecation.Reason + ")"
+	}
+	return msg
+}
+
+// Is matches ErrCircuitDeprecated
+func (e *DeprecationError) Is(target error) bool {
+	return target == ErrCircuitDeprecated
+}
+
+// VersionPolicy holds the minimum versions of the circuit families. A proof
+// of a version below the minimum is rejected with a *DeprecationError, or
+// only warned of (VerificationResult.Deprecation) in its grace period or when
+// WarnOnly is set. A nil policy accepts every version.
+//
+// The deprecations are replaced as a whole (Set), e.g. by the ones of each
+// fetched catalog, while verifications are in progress.
+type VersionPolicy struct {
+	// WarnOnly warns of the deprecated versions instead of rejecting them,
+	// e.g. while the wallets upgrade
+	WarnOnly bool
+
+	mu           sync.RWMutex
+	deprecations map[string]Deprecation
+}
+
+// NewVersionPolicy returns the policy of the deprecations
+func NewVersionPolicy(deprecations ...Deprecation) (*VersionPolicy, error) {
+	p := &VersionPolicy{}
+	if err := p.Set(deprecations); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Set replaces the deprecations of the policy, one per circuit family
+func (p *VersionPolicy) Set(deprecations []Deprecation) error {
+	m := make(map[string]Deprecation, len(deprecations))
+	for _, d := range deprecations {
+		if d.Circuit == "" || d.Circuit != CircuitFamily(d.Circuit) {
+			return fmt.Errorf("deprecation of %q: not a circuit family", d.Circuit)
+		}
+		if d.MinVersion < 1 {
+			return fmt.Errorf("deprecation of %q: invalid min_version %d", d.Circuit, d.MinVersion)
+		}
+		if _, ok := m[d.Circuit]; ok {
+			return fmt.Errorf("deprecation of %q: duplicate", d.Circuit)
+		}
+		m[d.Circuit] = d
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deprecations = m
+	return nil
+}
+
+// Deprecations returns the deprecations of the policy, sorted by circuit
+// family; nil for a nil policy
+func (p *VersionPolicy) Deprecations() []Deprecation {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	deprecations := make([]Deprecation, 0, len(p.deprecations))
+	for _, d := range p.deprecations {
+		deprecations = append(deprecations, d)
+	}
+	slices.SortFunc(deprecations, func(a, b Deprecation) int { return strings.Compare(a.Circuit, b.Circuit) })
+	return deprecations
+}
+
+// Check checks the version of the circuit id against the minimum version of
+// its family at t: nil for an accepted version, the deprecation for a
+// deprecated version in its grace period or with WarnOnly, a
+// *DeprecationError otherwise
+func (p *VersionPolicy) Check(circuitID string, t time.Time) (*Deprecation, error) {
+	if p == nil {
+		return nil, nil
+	}
+	p.mu.RLock()
+	d, ok := p.deprecations[CircuitFamily(circuitID)]
+	p.mu.RUnlock()
+	version := CircuitVersionNumber(circuitID)
+	if !ok || version >= d.MinVersion {
+		return nil, nil
+	}
+	if p.WarnOnly || d.EnforceAt != 0 && t.Unix() < d.EnforceAt {
+		return &d, nil
+	}
+	return nil, &DeprecationError{Circuit: circuitID, Version: version, Deprecation: d}
+}
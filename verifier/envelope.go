@@ -0,0 +1,137 @@
+package verifier
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Signature algs of the presentation envelope (the alg of the protected
+// header). The proofs are not post-quantum, but a presentation archived for
+// decades should not rest on ECDSA alone: the hybrid alg adds an ML-DSA
+// (FIPS 204) signature of the holder to the ES256 one, which keeps binding the
+// holder key of the credential.
+const (
+	AlgES256 = "ES256"
+	// AlgES256MLDSA65 is the hybrid envelope: the ES256 signature (r || s)
+	// of the holder key followed by the ML-DSA-65 signature of the same
+	// signing input with the post-quantum key of the holder
+	AlgES256MLDSA65 = "ES256+ML-DSA-65"
+)
+
+// ErrUnsupportedAlg is returned for a presentation signed with an alg the
+// verifier does not accept, or the build does not provide (ML-DSA needs Go
+// 1.27)
+var ErrUnsupportedAlg = errors.New("unsupported presentation alg")
+
+// mldsaContext is the FIPS 204 context string of the ML-DSA signatures of the
+// presentations, separating them from other signatures of the holder keys
+const mldsaContext = "eudi-zk presentation v1"
+
+// es256SignatureSize is the size of an ES256 signature, r || s
+const es256SignatureSize = 64
+
+// SupportedAlgs returns the algs of this build, in preference order
+func SupportedAlgs() []string {
+	if mldsaSupported {
+		return []string{AlgES256MLDSA65, AlgES256}
+	}
+	return []string{AlgES256}
+}
+
+// NegotiateAlg returns the first alg of accepted, the preference order of the
+// verifier (Catalog.Algs), that the holder supports; ES256 when accepted is
+// empty, for the verifiers predating the negotiation
+func NegotiateAlg(accepted, supported []string) (string, error) {
+	if len(accepted) == 0 {
+		accepted = []string{AlgES256}
+	}
+	for _, alg := range accepted {
+		if slices.Contains(supported, alg) {
+			return alg, nil
+		}
+	}
+	return "", fmt.Errorf("%w: the verifier accepts %q, the holder supports %q", ErrUnsupportedAlg, accepted, supported)
+}
+
+// SignPresentationHybrid signs and serializes a presentation with the hybrid
+// alg AlgES256MLDSA65: key is the holder key, pqKey its ML-DSA-65 key
+// (*mldsa.PrivateKey, or a crypto.Signer of a device holding one)
+func SignPresentationHybrid(header PresentationHeader, payload PresentationPayload, proof []byte, key *ecdsa.PrivateKey, pqKey crypto.Signer) (string, error) {
+	header.Alg = AlgES256MLDSA65
+	return signPresentation(header, payload, proof, func(data []byte) ([]byte, error) {
+		signature, err := signES256(data, key)
+		if err != nil {
+			return nil, err
+		}
+		pqSignature, err := signMLDSA65(pqKey, data)
+		if err != nil {
+			return nil, err
+		}
+		return append(signature, pqSignature...), nil
+	})
+}
+
+// signPresentation serializes a presentation signed by sign, the alg of the
+// header is the one of sign
+func signPresentation(header PresentationHeader, payload PresentationPayload, proof []byte, sign func(data []byte) ([]byte, error)) (string, error) {
+	if header.Typ == "" {
+		header.Typ = PresentationType
+	}
+
+	protectedJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64(protectedJSON) + "." + b64(payloadJSON) + "." + b64(proof)
+	signature, err := sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64(signature), nil
+}
+
+// VerifyPQSignature verifies the ML-DSA-65 part of the hybrid signature of
+// the presentation with the encoded ML-DSA-65 public key of the holder
+func (p *Presentation) VerifyPQSignature(pqKey []byte) error {
+	if p.Header.Alg != AlgES256MLDSA65 {
+		return fmt.Errorf("%w: %q has no post-quantum signature", ErrUnsupportedAlg, p.Header.Alg)
+	}
+	if len(p.Signature) <= es256SignatureSize {
+		return fmt.Errorf("invalid presentation signature: no ML-DSA-65 signature")
+	}
+	if err := verifyMLDSA65(pqKey, p.signed, p.Signature[es256SignatureSize:]); err != nil {
+		return fmt.Errorf("invalid presentation signature: %w", err)
+	}
+	return nil
+}
+
+// VerifyEnvelope checks that the alg of the presentation is one of accepted
+// (SupportedAlgs when empty) and verifies the ML-DSA-65 part of a hybrid
+// signature with the post-quantum key of the holder resolved by
+// resolvePQKey. Without resolver a hybrid signature is only verified on its
+// ES256 part (VerifySignature).
+func (p *Presentation) VerifyEnvelope(accepted []string, resolvePQKey func(header PresentationHeader) ([]byte, error)) error {
+	if len(accepted) == 0 {
+		accepted = SupportedAlgs()
+	}
+	if !slices.Contains(accepted, p.Header.Alg) {
+		return fmt.Errorf("%w %q, accepted %q", ErrUnsupportedAlg, p.Header.Alg, accepted)
+	}
+	if p.Header.Alg != AlgES256MLDSA65 || resolvePQKey == nil {
+		return nil
+	}
+	pqKey, err := resolvePQKey(p.Header)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the post-quantum holder key: %w", err)
+	}
+	return p.VerifyPQSignature(pqKey)
+}
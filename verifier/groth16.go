@@ -0,0 +1,228 @@
+package verifier
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	curve "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/hash_to_field"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/pedersen"
+)
+
+// commitmentDst is the domain separation tag of the hash of the commitments
+// to the field (gnark constraint.CommitmentDst)
+const commitmentDst = "bsb22-commitment"
+
+var errPairingCheckFailed = errors.New("pairing doesn't match")
+
+// VerifyingKey is a BN254 groth16 verifying key, read from the gnark binary
+// encoding (groth16.VerifyingKey.WriteTo or WriteRawTo)
+type VerifyingKey struct {
+	alpha, betaG1, deltaG1 curve.G1Affine
+	beta, gamma, delta     curve.G2Affine
+	k                      []curve.G1Affine
+	// publicCommitted are the public inputs committed to by each commitment
+	publicCommitted [][]uint64
+	commitmentKeys  []pedersen.VerifyingKey
+
+	// precomputed e(α, β), -[γ]2 and -[δ]2
+	e                  curve.GT
+	gammaNeg, deltaNeg curve.G2Affine
+}
+
+// ReadVerifyingKey decodes a verifying key, its points are checked to be on
+// the curve and in the subgroup
+func ReadVerifyingKey(data []byte) (*VerifyingKey, error) {
+	r := bytes.NewReader(data)
+	dec := curve.NewDecoder(r)
+
+	vk := &VerifyingKey{}
+	var nbCommitments uint32
+	for i, v := range []any{&vk.alpha, &vk.betaG1, &vk.beta, &vk.gamma, &vk.deltaG1, &vk.delta, &vk.k, &vk.publicCommitted, &nbCommitments} {
+		if err := dec.Decode(v); err != nil {
+			return nil, fmt.Errorf("invalid verifying key: field %d: %w", i, err)
+		}
+	}
+	for i := range nbCommitments {
+		var key pedersen.VerifyingKey
+		if _, err := key.ReadFrom(r); err != nil {
+			return nil, fmt.Errorf("invalid verifying key: commitment key %d: %w", i, err)
+		}
+		vk.commitmentKeys = append(vk.commitmentKeys, key)
+	}
+	if len(vk.k) <= len(vk.publicCommitted) {
+		return nil, fmt.Errorf("invalid verifying key: %d public keys for %d commitments", len(vk.k), len(vk.publicCommitted))
+	}
+
+	if err := vk.precompute(); err != nil {
+		return nil, err
+	}
+	return vk, nil
+}
+
+// precompute sets e(α, β), -[γ]2 and -[δ]2
+func (vk *VerifyingKey) precompute() error {
+	var err error
+	if vk.e, err = curve.Pair([]curve.G1Affine{vk.alpha}, []curve.G2Affine{vk.beta}); err != nil {
+		return err
+	}
+	vk.gammaNeg.Neg(&vk.gamma)
+	vk.deltaNeg.Neg(&vk.delta)
+	return nil
+}
+
+// NbPublic returns the number of public inputs of the circuit
+func (vk *VerifyingKey) NbPublic() int {
+	return len(vk.k) - len(vk.publicCommitted) - 1
+}
+
+// MarshalBinary returns the compressed encoding of the key, the encoding of
+// groth16.VerifyingKey.WriteTo
+func (vk *VerifyingKey) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := curve.NewEncoder(&buf)
+	for _, v := range []any{&vk.alpha, &vk.betaG1, &vk.beta, &vk.gamma, &vk.deltaG1, &vk.delta, vk.k, vk.publicCommitted, uint32(len(vk.commitmentKeys))} {
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+	}
+	for i := range vk.commitmentKeys {
+		if _, err := vk.commitmentKeys[i].WriteTo(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Hash returns the SHA-256 of the compressed encoding of the key, the hash
+// of common.VerifyingKeyHash and of the vk_hash of the presentations
+func (vk *VerifyingKey) Hash() ([32]byte, error) {
+	data, err := vk.MarshalBinary()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// PublicInput is an element of a public witness
+type PublicInput = fr.Element
+
+// Proof is a BN254 groth16 proof
+type Proof struct {
+	ar, krs       curve.G1Affine
+	bs            curve.G2Affine
+	commitments   []curve.G1Affine
+	commitmentPok curve.G1Affine
+}
+
+// ReadProof decodes a proof from the gnark binary encoding
+// (groth16.Proof.WriteTo or WriteRawTo)
+func ReadProof(data []byte) (*Proof, error) {
+	dec := curve.NewDecoder(bytes.NewReader(data))
+	proof := &Proof{}
+	for i, v := range []any{&proof.ar, &proof.bs, &proof.krs, &proof.commitments, &proof.commitmentPok} {
+		if err := dec.Decode(v); err != nil {
+			return nil, fmt.Errorf("invalid proof: field %d: %w", i, err)
+		}
+	}
+	return proof, nil
+}
+
+// ReadPublicWitness decodes a public witness from the gnark binary encoding
+// (witness.Witness.MarshalBinary of the public part)
+func ReadPublicWitness(data []byte) ([]PublicInput, error) {
+	r := bytes.NewReader(data)
+	var header struct{ NbPublic, NbSecret uint32 }
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("invalid public witness: %w", err)
+	}
+	if header.NbSecret != 0 {
+		return nil, fmt.Errorf("invalid public witness: %d secret inputs", header.NbSecret)
+	}
+	var vector fr.Vector
+	if _, err := vector.ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("invalid public witness: %w", err)
+	}
+	if len(vector) != int(header.NbPublic) {
+		return nil, fmt.Errorf("invalid public witness: %d elements, header %d", len(vector), header.NbPublic)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("invalid public witness: trailing bytes")
+	}
+	return vector, nil
+}
+
+// Verify verifies a groth16 proof against the public inputs, as
+// groth16.Verify with the default options of gnark
+func Verify(vk *VerifyingKey, proof *Proof, publicWitness []PublicInput) error {
+	if len(publicWitness) != vk.NbPublic() {
+		return fmt.Errorf("invalid witness size, got %d, expected %d", len(publicWitness), vk.NbPublic())
+	}
+	if len(proof.commitments) != len(vk.publicCommitted) {
+		return fmt.Errorf("invalid proof: %d commitments, expected %d", len(proof.commitments), len(vk.publicCommitted))
+	}
+	if !proof.ar.IsInSubGroup() || !proof.krs.IsInSubGroup() || !proof.bs.IsInSubGroup() {
+		return fmt.Errorf("points in the proof are not in the correct subgroup")
+	}
+
+	// the commitments are public inputs: the hash of each commitment and of
+	// the public inputs it commits to
+	inputs := append(make([]fr.Element, 0, len(publicWitness)+len(proof.commitments)), publicWitness...)
+	commitmentsSerialized := make([]byte, 0, len(vk.publicCommitted)*fr.Bytes)
+	h := hash_to_field.New([]byte(commitmentDst))
+	for i, committed := range vk.publicCommitted {
+		h.Reset()
+		h.Write(proof.commitments[i].Marshal())
+		for _, j := range committed {
+			if j == 0 || int(j) > len(publicWitness) {
+				return fmt.Errorf("invalid verifying key: committed input %d", j)
+			}
+			b := publicWitness[j-1].Bytes()
+			h.Write(b[:])
+		}
+		var res fr.Element
+		res.SetBytes(h.Sum(nil)[:min(fr.Bytes, h.Size())])
+		inputs = append(inputs, res)
+		b := res.Bytes()
+		commitmentsSerialized = append(commitmentsSerialized, b[:]...)
+	}
+	if len(vk.commitmentKeys) > 0 {
+		challenge, err := fr.Hash(commitmentsSerialized, []byte("G16-BSB22"), 1)
+		if err != nil {
+			return err
+		}
+		if err := pedersen.BatchVerifyMultiVk(vk.commitmentKeys, proof.commitments, []curve.G1Affine{proof.commitmentPok}, challenge[0]); err != nil {
+			return err
+		}
+	}
+
+	// e(Ar, Bs) = e(α, β) e(Σx.[K]1 + commitments, [γ]2) e(Krs, [δ]2)
+	var kSum curve.G1Jac
+	if _, err := kSum.MultiExp(vk.k[1:], inputs, ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	kSum.AddMixed(&vk.k[0])
+	for i := range proof.commitments {
+		kSum.AddMixed(&proof.commitments[i])
+	}
+	var kSumAff curve.G1Affine
+	kSumAff.FromJacobian(&kSum)
+
+	ml, err := curve.MillerLoop(
+		[]curve.G1Affine{proof.krs, proof.ar, kSumAff},
+		[]curve.G2Affine{vk.deltaNeg, proof.bs, vk.gammaNeg},
+	)
+	if err != nil {
+		return err
+	}
+	if e := curve.FinalExponentiation(&ml); !vk.e.Equal(&e) {
+		return errPairingCheckFailed
+	}
+	return nil
+}
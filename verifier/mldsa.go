@@ -0,0 +1,39 @@
+//go:build go1.27
+
+package verifier
+
+import (
+	"crypto"
+	"crypto/mldsa"
+	"crypto/rand"
+	"fmt"
+)
+
+// mldsaSupported reports whether the build signs and verifies ML-DSA, with
+// crypto/mldsa of Go 1.27
+const mldsaSupported = true
+
+// signMLDSA65 signs data with an ML-DSA-65 key
+func signMLDSA65(key crypto.Signer, data []byte) ([]byte, error) {
+	if public, ok := key.Public().(*mldsa.PublicKey); !ok || public.Parameters() != mldsa.MLDSA65() {
+		return nil, fmt.Errorf("%w: the post-quantum key is not an ML-DSA-65 key", ErrUnsupportedAlg)
+	}
+	signature, err := key.Sign(rand.Reader, data, &mldsa.Options{Context: mldsaContext})
+	if err != nil {
+		return nil, fmt.Errorf("ML-DSA-65 signature failed: %w", err)
+	}
+	return signature, nil
+}
+
+// verifyMLDSA65 verifies an ML-DSA-65 signature of data with the encoded
+// public key
+func verifyMLDSA65(publicKey, data, signature []byte) error {
+	key, err := mldsa.NewPublicKey(mldsa.MLDSA65(), publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid ML-DSA-65 public key: %w", err)
+	}
+	if err := mldsa.Verify(key, data, signature, &mldsa.Options{Context: mldsaContext}); err != nil {
+		return fmt.Errorf("ML-DSA-65 signature mismatch")
+	}
+	return nil
+}
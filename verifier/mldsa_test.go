@@ -0,0 +1,98 @@
+//go:build go1.27
+
+package verifier
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/mldsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHybridPresentation(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{}, &cubeCircuit{X: 3, Y: 27})
+	holderKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pqKey, err := mldsa.GenerateKey(mldsa.MLDSA65())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPQKey, _ := mldsa.GenerateKey(mldsa.MLDSA65())
+	resolvedPQKey := pqKey.PublicKey().Bytes()
+
+	v := New(func(header PresentationHeader) (*ecdsa.PublicKey, error) {
+		return &holderKey.PublicKey, nil
+	})
+	v.ResolvePQKey = func(header PresentationHeader) ([]byte, error) {
+		return resolvedPQKey, nil
+	}
+	if err := v.AddCircuit("cube/v1", s.vkBytes, nil); err != nil {
+		t.Fatal(err)
+	}
+	vkHash := sha256.Sum256(s.vkBytes)
+	header := PresentationHeader{Circuit: "cube/v1", VKHash: hex.EncodeToString(vkHash[:])}
+	payload := PresentationPayload{Nonce: "n-1", IssuedAt: time.Now().Unix(), PublicWitness: s.publicWitness}
+
+	hybrid, err := SignPresentationHybrid(header, payload, s.proofBytes, holderKey, pqKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := v.Verify(hybrid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Presentation.Header.Alg != AlgES256MLDSA65 {
+		t.Fatalf("expected the hybrid alg, got %q", res.Presentation.Header.Alg)
+	}
+
+	// the ML-DSA part is verified against the resolved key
+	resolvedPQKey = otherPQKey.PublicKey().Bytes()
+	if _, err := v.Verify(hybrid); err == nil {
+		t.Fatal("expected an error for another post-quantum key")
+	}
+	resolvedPQKey = pqKey.PublicKey().Bytes()
+
+	// a verifier requiring post-quantum envelopes refuses ES256
+	v.Algs = []string{AlgES256MLDSA65}
+	classic, err := SignPresentation(header, payload, s.proofBytes, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(classic); !errors.Is(err, ErrUnsupportedAlg) {
+		t.Fatalf("expected ErrUnsupportedAlg for ES256, got %v", err)
+	}
+	if _, err := v.Verify(hybrid); err != nil {
+		t.Fatal(err)
+	}
+
+	// the ES256 key is not accepted as post-quantum key
+	if _, err := SignPresentationHybrid(header, payload, s.proofBytes, holderKey, holderKey); !errors.Is(err, ErrUnsupportedAlg) {
+		t.Fatalf("expected ErrUnsupportedAlg for an ECDSA post-quantum key, got %v", err)
+	}
+}
+
+func TestNegotiateAlg(t *testing.T) {
+	for _, tc := range []struct {
+		accepted, supported []string
+		want                string
+	}{
+		{nil, SupportedAlgs(), AlgES256},
+		{[]string{AlgES256MLDSA65, AlgES256}, SupportedAlgs(), AlgES256MLDSA65},
+		{[]string{AlgES256MLDSA65, AlgES256}, []string{AlgES256}, AlgES256},
+	} {
+		alg, err := NegotiateAlg(tc.accepted, tc.supported)
+		if err != nil || alg != tc.want {
+			t.Errorf("NegotiateAlg(%q, %q) = %q, %v, expected %q", tc.accepted, tc.supported, alg, err, tc.want)
+		}
+	}
+	if _, err := NegotiateAlg([]string{AlgES256MLDSA65}, []string{AlgES256}); !errors.Is(err, ErrUnsupportedAlg) {
+		t.Fatalf("expected ErrUnsupportedAlg, got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !go1.27
+
+package verifier
+
+import (
+	"crypto"
+	"fmt"
+)
+
+// mldsaSupported reports whether the build signs and verifies ML-DSA, with
+// crypto/mldsa of Go 1.27
+const mldsaSupported = false
+
+func signMLDSA65(crypto.Signer, []byte) ([]byte, error) {
+	return nil, fmt.Errorf("%w: ML-DSA-65 needs Go 1.27", ErrUnsupportedAlg)
+}
+
+func verifyMLDSA65(publicKey, data, signature []byte) error {
+	return fmt.Errorf("%w: ML-DSA-65 needs Go 1.27", ErrUnsupportedAlg)
+}
@@ -0,0 +1,182 @@
+package verifier
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPinMismatch is returned, wrapped with ErrVersionMismatch, for a
+// presentation proven with another verifying key than the one pinned for its
+// circuit, until the change is approved
+var ErrPinMismatch = errors.New("verifying key pin mismatch")
+
+// Pin is the verifying key hash pinned for a circuit
+type Pin struct {
+	Circuit  string    `json:"circuit"`
+	VKHash   string    `json:"vk_hash"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// PinChange is a verifying key of a pinned circuit waiting for approval
+type PinChange struct {
+	Circuit string `json:"circuit"`
+	// Pinned is the pinned hash, Presented the hash of the presentations
+	Pinned    string    `json:"pinned"`
+	Presented string    `json:"presented"`
+	SeenAt    time.Time `json:"seen_at"`
+}
+
+// pinSet is the export format of a PinStore
+type pinSet struct {
+	Pins []Pin `json:"pins"`
+}
+
+// PinStore pins the verifying key hashes of the circuits a Verifier does not
+// register, trust on first use: the first verified presentation of a circuit
+// pins the hash of its header, the next ones must match it. A changed hash is a new
+// setup of the circuit, or a prover serving forged keys: it is reported to
+// OnChange once and rejected until an operator approves it.
+//
+// Fleets of verifiers share their decisions by exporting the pins of one
+// instance and importing them in the others; Strict instances only verify
+// the imported circuits.
+type PinStore struct {
+	// OnChange alerts of a changed verifying key, called once per change
+	// outside of the store lock
+	OnChange func(change PinChange)
+	// Strict rejects the circuits without pin instead of pinning them, the
+	// pins are imported or approved
+	Strict bool
+
+	mu      sync.Mutex
+	pins    map[string]Pin
+	pending map[string]PinChange
+}
+
+// NewPinStore returns an empty pin store
+func NewPinStore() *PinStore {
+	return &PinStore{pins: map[string]Pin{}, pending: map[string]PinChange{}}
+}
+
+// Check checks the verifying key hash of a presentation of the circuit
+// against its pin; a circuit without pin passes unless the store is Strict
+func (s *PinStore) Check(circuitID, vkHash string) error {
+	if !isHash(vkHash) {
+		return fmt.Errorf("%w: invalid verifying key hash %q", ErrVersionMismatch, vkHash)
+	}
+
+	s.mu.Lock()
+	pin, ok := s.pins[circuitID]
+	if !ok {
+		s.mu.Unlock()
+		if s.Strict {
+			return fmt.Errorf("%w %q: not pinned", ErrUnknownCircuit, circuitID)
+		}
+		return nil
+	}
+	if pin.VKHash == vkHash {
+		s.mu.Unlock()
+		return nil
+	}
+	change, seen := s.pending[circuitID]
+	alert := !seen || change.Presented != vkHash
+	if alert {
+		change = PinChange{Circuit: circuitID, Pinned: pin.VKHash, Presented: vkHash, SeenAt: time.Now().UTC()}
+		s.pending[circuitID] = change
+	}
+	s.mu.Unlock()
+
+	if alert && s.OnChange != nil {
+		s.OnChange(change)
+	}
+	return fmt.Errorf("%w: %w: %q is pinned to %s, presented %s", ErrVersionMismatch, ErrPinMismatch, circuitID, pin.VKHash, vkHash)
+}
+
+// trust pins the verifying key hash of a verified presentation of a circuit
+// without pin
+func (s *PinStore) trust(circuitID, vkHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pins[circuitID]; !ok && !s.Strict {
+		s.pins[circuitID] = Pin{Circuit: circuitID, VKHash: vkHash, PinnedAt: time.Now().UTC()}
+	}
+}
+
+// Approve pins the verifying key hash of the circuit, the approval of a
+// pending change or a manual pin, and clears the pending change
+func (s *PinStore) Approve(circuitID, vkHash string) error {
+	if !isHash(vkHash) {
+		return fmt.Errorf("invalid verifying key hash %q", vkHash)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pins[circuitID] = Pin{Circuit: circuitID, VKHash: vkHash, PinnedAt: time.Now().UTC()}
+	delete(s.pending, circuitID)
+	return nil
+}
+
+// Pins returns the pins sorted by circuit
+func (s *PinStore) Pins() []Pin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pins := make([]Pin, 0, len(s.pins))
+	for _, pin := range s.pins {
+		pins = append(pins, pin)
+	}
+	slices.SortFunc(pins, func(a, b Pin) int { return strings.Compare(a.Circuit, b.Circuit) })
+	return pins
+}
+
+// Pending returns the changes waiting for approval sorted by circuit
+func (s *PinStore) Pending() []PinChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes := make([]PinChange, 0, len(s.pending))
+	for _, change := range s.pending {
+		changes = append(changes, change)
+	}
+	slices.SortFunc(changes, func(a, b PinChange) int { return strings.Compare(a.Circuit, b.Circuit) })
+	return changes
+}
+
+// Export returns the pins as JSON, {"pins": [{"circuit", "vk_hash",
+// "pinned_at"}]}
+func (s *PinStore) Export() ([]byte, error) {
+	return json.Marshal(pinSet{Pins: s.Pins()})
+}
+
+// Import pins the circuits of an exported pin set: the set is the decision
+// of the fleet, it replaces the pins of its circuits and clears their
+// pending changes. The set is rejected as a whole when a pin is invalid.
+func (s *PinStore) Import(data []byte) error {
+	var set pinSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("invalid pin set: %w", err)
+	}
+	for _, pin := range set.Pins {
+		if pin.Circuit == "" || !isHash(pin.VKHash) {
+			return fmt.Errorf("invalid pin set: pin %q: invalid verifying key hash %q", pin.Circuit, pin.VKHash)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pin := range set.Pins {
+		s.pins[pin.Circuit] = pin
+		delete(s.pending, pin.Circuit)
+	}
+	return nil
+}
+
+// isHash reports whether hash is a lowercase hex SHA-256 hash, the vk_hash of
+// the presentations
+func isHash(hash string) bool {
+	decoded, err := hex.DecodeString(hash)
+	return err == nil && len(decoded) == 32 && hash == strings.ToLower(hash)
+}
@@ -0,0 +1,268 @@
+package verifier
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Presentation is a zero-knowledge presentation in compact serialization:
+//
+//	base64url(protected) "." base64url(payload) "." base64url(proof) "." base64url(signature)
+//
+// The protected header names the circuit and the hash of its verifying key,
+// the payload carries the public witness of the proof and the disclosed
+// claims. The holder signs (ES256, or the hybrid AlgES256MLDSA65) the first
+// three parts, so the proof cannot be detached from the header and the
+// payload.
+//
+// A composite presentation (header circuit CompositeCircuit) carries the
+// proofs of several circuits under the one header and signature, e.g. age,
+// revocation and proof of possession: the proof part is empty and the
+// payload lists the proofs with their public witnesses (Payload.Proofs).
+type Presentation struct {
+	Header  PresentationHeader
+	Payload PresentationPayload
+	Proof   []byte // groth16 proof (gnark binary encoding)
+
+	// Signature is the ES256 signature r || s, followed by the ML-DSA-65
+	// signature for AlgES256MLDSA65
+	Signature []byte
+
+	// RawPayload is the decoded payload JSON, validated against the circuit
+	// schema
+	RawPayload []byte
+
+	// signed are the bytes covered by the signature
+	signed []byte
+}
+
+// PresentationHeader is the protected header of a Presentation
+type PresentationHeader struct {
+	Alg     string `json:"alg"`
+	Typ     string `json:"typ"`
+	Kid     string `json:"kid,omitempty"`
+	Circuit string `json:"circuit"`
+	VKHash  string `json:"vk_hash"` // hex SHA-256 of the verifying key (VerifyingKey.Hash)
+}
+
+// PresentationPayload is the payload of a Presentation
+type PresentationPayload struct {
+	ID            string         `json:"jti,omitempty"`
+	Audience      string         `json:"aud,omitempty"`
+	Nonce         string         `json:"nonce,omitempty"`
+	IssuedAt      int64          `json:"iat"`
+	PublicWitness []byte         `json:"public_witness"` // gnark binary encoding, base64, empty for a composite presentation
+	Claims        map[string]any `json:"claims,omitempty"`
+	// Consent is the hash of the holder consent token (ConsentHash) when the
+	// proof was made by a server on behalf of the holder
+	Consent string `json:"consent,omitempty"`
+	// ExpiresAt is the expiry of the presentation (unix seconds), shortly
+	// after IssuedAt and at most CredentialExpiresAt; DefaultPresentationTTL
+	// after IssuedAt when 0 (Presentation.Expiry)
+	ExpiresAt int64 `json:"exp,omitempty"`
+	// CredentialExpiresAt is the expiry of the proven credential (unix
+	// seconds); unknown when 0
+	CredentialExpiresAt int64 `json:"cred_exp,omitempty"`
+	// Openings open the salted claim commitments of the public witness the
+	// holder reveals, see ClaimOpening
+	Openings []ClaimOpening `json:"openings,omitempty"`
+	// Proofs are the proofs of a composite presentation (CompositeCircuit),
+	// whose PublicWitness is empty
+	Proofs []PresentationProof `json:"proofs,omitempty"`
+}
+
+// CompositeCircuit is the circuit of the protected header of the composite
+// presentations, see Presentation
+const CompositeCircuit = "composite"
+
+// PresentationProof is a proof of a composite presentation: the circuit and
+// the hash of its verifying key, as in the header of a presentation of one
+// proof, the proof and its public witness
+type PresentationProof struct {
+	Circuit       string `json:"circuit"`
+	VKHash        string `json:"vk_hash"`
+	Proof         []byte `json:"proof"`          // gnark binary encoding, base64
+	PublicWitness []byte `json:"public_witness"` // gnark binary encoding, base64
+}
+
+// Composite reports whether the presentation is a composite presentation
+func (p *Presentation) Composite() bool {
+	return p.Header.Circuit == CompositeCircuit
+}
+
+// claimCommitmentSize is the size of a claim commitment, the truncated SHA-256
+// of common.ClaimCommitment fits in one field element
+const claimCommitmentSize = 31
+
+// ClaimOpening reveals the claim behind a salted claim commitment of the
+// public witness (common.ClaimCommitment):
+//
+//	SHA-256(salt || name || value)[:31]
+//
+// The salt is fresh for every presentation, the commitments of two
+// presentations of the same claim cannot be linked.
+type ClaimOpening struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Salt  []byte `json:"salt"` // base64
+}
+
+// Commitment returns the commitment the opening opens, big-endian
+func (o ClaimOpening) Commitment() []byte {
+	h := sha256.New()
+	h.Write(o.Salt)
+	h.Write([]byte(o.Name))
+	h.Write([]byte(o.Value))
+	return h.Sum(nil)[:claimCommitmentSize]
+}
+
+// PresentationType is the typ of the protected header
+const PresentationType = "zkp"
+
+// SignPresentation signs and serializes a presentation with the holder key.
+// A composite presentation is signed without proof, header circuit
+// CompositeCircuit.
+func SignPresentation(header PresentationHeader, payload PresentationPayload, proof []byte, key *ecdsa.PrivateKey) (string, error) {
+	header.Alg = AlgES256
+	return signPresentation(header, payload, proof, func(data []byte) ([]byte, error) {
+		return signES256(data, key)
+	})
+}
+
+// SignPresentationES256 signs and serializes a presentation with an ES256
+// signer returning r || s, for a holder key held by reference (e.g. a
+// wallet.KeyHandle) instead of an *ecdsa.PrivateKey
+func SignPresentationES256(header PresentationHeader, payload PresentationPayload, proof []byte, sign func(data []byte) ([]byte, error)) (string, error) {
+	header.Alg = AlgES256
+	return signPresentation(header, payload, proof, sign)
+}
+
+// signES256 signs data and returns the signature as r || s
+func signES256(data []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("ES256 signature failed: %w", err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature, nil
+}
+
+// ParsePresentation parses the compact serialization of a presentation, the
+// signature is not verified
+func ParsePresentation(compact string) (*Presentation, error) {
+	parts := strings.Split(strings.TrimSpace(compact), ".")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid presentation: expected 4 parts, got %d", len(parts))
+	}
+
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, fmt.Errorf("invalid presentation: part %d: %w", i, err)
+		}
+	}
+
+	p := &Presentation{
+		Proof:      decoded[2],
+		Signature:  decoded[3],
+		RawPayload: decoded[1],
+		signed:     []byte(strings.Join(parts[:3], ".")),
+	}
+	if err := json.Unmarshal(decoded[0], &p.Header); err != nil {
+		return nil, fmt.Errorf("invalid presentation header: %w", err)
+	}
+	if err := json.Unmarshal(decoded[1], &p.Payload); err != nil {
+		return nil, fmt.Errorf("invalid presentation payload: %w", err)
+	}
+	return p, nil
+}
+
+// DefaultPresentationTTL is the lifetime of the presentations without exp,
+// from their iat
+const DefaultPresentationTTL = 5 * time.Minute
+
+// Expiry returns the expiry of the presentation: its exp, or
+// DefaultPresentationTTL after its iat when it has none, a presentation does
+// not live forever
+func (p *Presentation) Expiry() time.Time {
+	if p.Payload.ExpiresAt != 0 {
+		return time.Unix(p.Payload.ExpiresAt, 0)
+	}
+	return time.Unix(p.Payload.IssuedAt, 0).Add(DefaultPresentationTTL)
+}
+
+// CheckExpiry returns ErrCredentialExpired when the proven credential expired
+// at t, ErrPresentationExpired when the presentation did (Expiry); skew
+// tolerates the clock of the holder running ahead of t
+func (p *Presentation) CheckExpiry(t time.Time, skew time.Duration) error {
+	t = t.Add(-skew)
+	if p.Payload.CredentialExpiresAt != 0 && t.Unix() >= p.Payload.CredentialExpiresAt {
+		return fmt.Errorf("%w at %s", ErrCredentialExpired, time.Unix(p.Payload.CredentialExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	if exp := p.Expiry(); t.Unix() >= exp.Unix() {
+		return fmt.Errorf("%w at %s", ErrPresentationExpired, exp.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckAge returns ErrPresentationExpired when the presentation was issued
+// more than maxAge before t, skew tolerating the clock of the holder running
+// behind t
+func (p *Presentation) CheckAge(t time.Time, maxAge, skew time.Duration) error {
+	issuedAt := time.Unix(p.Payload.IssuedAt, 0)
+	if age := t.Sub(issuedAt); age > maxAge+skew {
+		return fmt.Errorf("%w: issued at %s, %v old, maximum age %v", ErrPresentationExpired, issuedAt.UTC().Format(time.RFC3339), age.Truncate(time.Second), maxAge)
+	}
+	return nil
+}
+
+// VerifySignature verifies the ES256 signature of the presentation, the
+// ES256 part of a hybrid signature (see VerifyPQSignature)
+func (p *Presentation) VerifySignature(key *ecdsa.PublicKey) error {
+	signature := p.Signature
+	switch p.Header.Alg {
+	case AlgES256:
+	case AlgES256MLDSA65:
+		if len(signature) <= es256SignatureSize {
+			return fmt.Errorf("invalid presentation signature: no ML-DSA-65 signature")
+		}
+		signature = signature[:es256SignatureSize]
+	default:
+		return fmt.Errorf("%w %q", ErrUnsupportedAlg, p.Header.Alg)
+	}
+	if err := verifyES256(p.signed, signature, key); err != nil {
+		return fmt.Errorf("invalid presentation signature: %w", err)
+	}
+	return nil
+}
+
+// verifyES256 verifies an ES256 signature (r || s) of data
+func verifyES256(data, signature []byte, key *ecdsa.PublicKey) error {
+	if len(signature) != 64 {
+		return fmt.Errorf("invalid signature size %d", len(signature))
+	}
+
+	digest := sha256.Sum256(data)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
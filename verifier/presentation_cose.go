@@ -0,0 +1,187 @@
+package verifier
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE encoding of a Presentation, for transports where the compact
+// serialization is too large (e.g. QR codes). The presentation is a tagged
+// COSE_Sign1 (RFC 9052):
+//
+//	18([protected, {}, payload, signature])
+//
+// protected is the CBOR header {1: -7 (ES256), 4: kid, 16: typ, "circuit",
+// "vk_hash"}, payload the CBOR payload with the proof and the public witness
+// as byte strings, signature the ES256 signature (r || s) of the
+// Sig_structure ["Signature1", protected, h'', payload].
+
+// PresentationMediaTypeCOSE is the media type of a COSE encoded presentation
+const PresentationMediaTypeCOSE = "application/cose"
+
+// coseSign1Tag is the CBOR tag of a COSE_Sign1 message
+const coseSign1Tag = 18
+
+// coseAlgES256 is the COSE algorithm identifier of ES256
+const coseAlgES256 = -7
+
+type coseSign1 struct {
+	_           struct{} `cbor:",toarray"`
+	Protected   []byte
+	Unprotected map[int]any
+	Payload     []byte
+	Signature   []byte
+}
+
+type coseHeader struct {
+	Alg     int    `cbor:"1,keyasint"`
+	Kid     []byte `cbor:"4,keyasint,omitempty"`
+	Typ     string `cbor:"16,keyasint,omitempty"`
+	Circuit string `cbor:"circuit"`
+	VKHash  []byte `cbor:"vk_hash"`
+}
+
+type cosePayload struct {
+	ID                  string         `cbor:"jti,omitempty"`
+	Audience            string         `cbor:"aud,omitempty"`
+	Nonce               string         `cbor:"nonce,omitempty"`
+	IssuedAt            int64          `cbor:"iat"`
+	PublicWitness       []byte         `cbor:"public_witness"`
+	Proof               []byte         `cbor:"proof"`
+	Claims              map[string]any `cbor:"claims,omitempty"`
+	Consent             string         `cbor:"consent,omitempty"`
+	ExpiresAt           int64          `cbor:"exp,omitempty"`
+	Openings            []ClaimOpening `cbor:"openings,omitempty"`
+	CredentialExpiresAt int64          `cbor:"cred_exp,omitempty"`
+}
+
+var (
+	coseEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+	coseDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+)
+
+// SignPresentationCOSE signs a presentation with the holder key and encodes
+// it as a tagged COSE_Sign1
+func SignPresentationCOSE(header PresentationHeader, payload PresentationPayload, proof []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+	if header.Typ == "" {
+		header.Typ = PresentationType
+	}
+	vkHash, err := hex.DecodeString(header.VKHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vk_hash: %w", err)
+	}
+
+	protected, err := coseEncMode.Marshal(coseHeader{
+		Alg:     coseAlgES256,
+		Kid:     []byte(header.Kid),
+		Typ:     header.Typ,
+		Circuit: header.Circuit,
+		VKHash:  vkHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+	payloadCBOR, err := coseEncMode.Marshal(cosePayload{
+		ID:                  payload.ID,
+		Audience:            payload.Audience,
+		Nonce:               payload.Nonce,
+		IssuedAt:            payload.IssuedAt,
+		PublicWitness:       payload.PublicWitness,
+		Proof:               proof,
+		Claims:              payload.Claims,
+		Consent:             payload.Consent,
+		ExpiresAt:           payload.ExpiresAt,
+		Openings:            payload.Openings,
+		CredentialExpiresAt: payload.CredentialExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	toBeSigned, err := coseSigStructure(protected, payloadCBOR)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signES256(toBeSigned, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return coseEncMode.Marshal(cbor.Tag{
+		Number:  coseSign1Tag,
+		Content: coseSign1{Protected: protected, Unprotected: map[int]any{}, Payload: payloadCBOR, Signature: signature},
+	})
+}
+
+// ParsePresentationCOSE parses a COSE encoded presentation, the signature is
+// not verified. RawPayload is the JSON encoding of the payload, so the same
+// PayloadSchema validates both encodings.
+func ParsePresentationCOSE(data []byte) (*Presentation, error) {
+	var tag cbor.RawTag
+	if err := coseDecMode.Unmarshal(data, &tag); err != nil {
+		return nil, fmt.Errorf("invalid presentation: %w", err)
+	}
+	if tag.Number != coseSign1Tag {
+		return nil, fmt.Errorf("invalid presentation: expected COSE_Sign1 tag, got %d", tag.Number)
+	}
+	var msg coseSign1
+	if err := coseDecMode.Unmarshal(tag.Content, &msg); err != nil {
+		return nil, fmt.Errorf("invalid presentation: %w", err)
+	}
+
+	var header coseHeader
+	if err := coseDecMode.Unmarshal(msg.Protected, &header); err != nil {
+		return nil, fmt.Errorf("invalid presentation header: %w", err)
+	}
+	if header.Alg != coseAlgES256 {
+		return nil, fmt.Errorf("unsupported presentation alg %d", header.Alg)
+	}
+	var payload cosePayload
+	if err := coseDecMode.Unmarshal(msg.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid presentation payload: %w", err)
+	}
+
+	signed, err := coseSigStructure(msg.Protected, msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	p := &Presentation{
+		Header: PresentationHeader{
+			Alg:     "ES256",
+			Typ:     header.Typ,
+			Kid:     string(header.Kid),
+			Circuit: header.Circuit,
+			VKHash:  hex.EncodeToString(header.VKHash),
+		},
+		Payload: PresentationPayload{
+			ID:                  payload.ID,
+			Audience:            payload.Audience,
+			Nonce:               payload.Nonce,
+			IssuedAt:            payload.IssuedAt,
+			PublicWitness:       payload.PublicWitness,
+			Claims:              payload.Claims,
+			Consent:             payload.Consent,
+			ExpiresAt:           payload.ExpiresAt,
+			Openings:            payload.Openings,
+			CredentialExpiresAt: payload.CredentialExpiresAt,
+		},
+		Proof:     payload.Proof,
+		Signature: msg.Signature,
+		signed:    signed,
+	}
+	if p.RawPayload, err = json.Marshal(p.Payload); err != nil {
+		return nil, fmt.Errorf("invalid presentation payload: %w", err)
+	}
+	return p, nil
+}
+
+// coseSigStructure returns the bytes signed by a COSE_Sign1 without external
+// additional data
+func coseSigStructure(protected, payload []byte) ([]byte, error) {
+	return coseEncMode.Marshal([]any{"Signature1", protected, []byte{}, payload})
+}
@@ -0,0 +1,61 @@
+package verifier
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxVerifyingKeySize bounds the verifying keys fetched from a registry, a key
+// grows with the public inputs by a G1 point each
+const maxVerifyingKeySize = 1 << 20
+
+// defaultRegistryTimeout bounds a fetch when Registry.HTTPClient is nil
+const defaultRegistryTimeout = 10 * time.Second
+
+// Registry fetches verifying keys by hash from a registry service
+// (GET {URL}/vks/{hash}). The fetched keys are checked against the hash, so
+// the registry does not need to be trusted.
+type Registry struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewRegistry returns the registry served at url
+func NewRegistry(url string) *Registry {
+	return &Registry{URL: strings.TrimSuffix(url, "/")}
+}
+
+// VerifyingKey fetches the verifying key with the hex hash
+func (r *Registry) VerifyingKey(ctx context.Context, hash string) (*VerifyingKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL+"/vks/"+hash, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := r.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: defaultRegistryTimeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry: verifying key %s: %s", hash, res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxVerifyingKeySize))
+	if err != nil {
+		return nil, err
+	}
+
+	if digest := sha256.Sum256(data); hex.EncodeToString(digest[:]) != hash {
+		return nil, fmt.Errorf("registry: verifying key %s: hash mismatch", hash)
+	}
+	return ReadVerifyingKey(data)
+}
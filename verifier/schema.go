@@ -0,0 +1,64 @@
+package verifier
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// FieldError is a payload member that does not match the schema
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("payload: %q %s", e.Field, e.Reason)
+}
+
+// PayloadSchema is the schema of the presentation payload of a circuit:
+// required members and JSON types ("string", "number", "boolean", "object",
+// "array") of the payload members
+type PayloadSchema struct {
+	Required   []string
+	Properties map[string]string
+}
+
+// Validate validates the payload JSON against the schema
+func (s *PayloadSchema) Validate(payload []byte) error {
+	var members map[string]any
+	if err := json.Unmarshal(payload, &members); err != nil {
+		return fmt.Errorf("payload is not a JSON object: %w", err)
+	}
+
+	for _, name := range s.Required {
+		if _, ok := members[name]; !ok {
+			return &FieldError{Field: name, Reason: "is missing"}
+		}
+	}
+	for name, expected := range s.Properties {
+		value, ok := members[name]
+		if !ok {
+			continue
+		}
+		if actual := jsonType(value); actual != expected {
+			return &FieldError{Field: name, Reason: fmt.Sprintf("is a %s, expected a %s", actual, expected)}
+		}
+	}
+	return nil
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return "null"
+}
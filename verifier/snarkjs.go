@@ -0,0 +1,267 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	curve "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fp"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// ErrSnarkJSIncompatible is returned for a key or a proof with BSB22
+// commitments (gnark api.Commit, e.g. of the SHA-256 gadgets), which snarkjs
+// does not verify
+var ErrSnarkJSIncompatible = errors.New("not expressible in snarkjs")
+
+// snarkjs identifiers of the proving system and of BN254
+const (
+	snarkJSProtocol = "groth16"
+	snarkJSCurve    = "bn128"
+)
+
+// SnarkJSVerifyingKey is a verifying key in the verification_key.json format
+// of snarkjs (circom). Points are projective coordinates in decimal, G2
+// coordinates [c0, c1]. The keys of both stacks verify the same equation:
+// IC is the K of gnark, one point per public input after the constant one.
+type SnarkJSVerifyingKey struct {
+	Protocol string     `json:"protocol"`
+	Curve    string     `json:"curve"`
+	NPublic  int        `json:"nPublic"`
+	Alpha1   []string   `json:"vk_alpha_1"`
+	Beta2    [][]string `json:"vk_beta_2"`
+	Gamma2   [][]string `json:"vk_gamma_2"`
+	Delta2   [][]string `json:"vk_delta_2"`
+	IC       [][]string `json:"IC"`
+}
+
+// SnarkJSProof is a proof in the proof.json format of snarkjs: pi_a, pi_b and
+// pi_c are the Ar, Bs and Krs of gnark
+type SnarkJSProof struct {
+	A        []string   `json:"pi_a"`
+	B        [][]string `json:"pi_b"`
+	C        []string   `json:"pi_c"`
+	Protocol string     `json:"protocol"`
+	Curve    string     `json:"curve"`
+}
+
+// SnarkJS returns the key in the snarkjs format, ErrSnarkJSIncompatible for a
+// key with commitments
+func (vk *VerifyingKey) SnarkJS() (*SnarkJSVerifyingKey, error) {
+	if len(vk.publicCommitted) > 0 {
+		return nil, fmt.Errorf("verifying key with %d commitments: %w", len(vk.publicCommitted), ErrSnarkJSIncompatible)
+	}
+	k := &SnarkJSVerifyingKey{
+		Protocol: snarkJSProtocol,
+		Curve:    snarkJSCurve,
+		NPublic:  vk.NbPublic(),
+		Alpha1:   g1ToSnarkJS(&vk.alpha),
+		Beta2:    g2ToSnarkJS(&vk.beta),
+		Gamma2:   g2ToSnarkJS(&vk.gamma),
+		Delta2:   g2ToSnarkJS(&vk.delta),
+	}
+	for i := range vk.k {
+		k.IC = append(k.IC, g1ToSnarkJS(&vk.k[i]))
+	}
+	return k, nil
+}
+
+// VerifyingKey returns the verifying key of a snarkjs key, its points checked
+// to be on the curve and in the subgroup. The G1 images of β and δ, which the
+// snarkjs format does not carry, are left to zero: they are not used to
+// verify, but change the hash of the key (vk_hash).
+func (k *SnarkJSVerifyingKey) VerifyingKey() (*VerifyingKey, error) {
+	if k.Protocol != snarkJSProtocol || k.Curve != snarkJSCurve {
+		return nil, fmt.Errorf("unsupported snarkjs key: %s on %s", k.Protocol, k.Curve)
+	}
+	if len(k.IC) != k.NPublic+1 {
+		return nil, fmt.Errorf("invalid snarkjs key: %d IC points for %d public inputs", len(k.IC), k.NPublic)
+	}
+	vk := &VerifyingKey{k: make([]curve.G1Affine, len(k.IC))}
+	var err error
+	if vk.alpha, err = g1FromSnarkJS(k.Alpha1, "vk_alpha_1"); err != nil {
+		return nil, err
+	}
+	if vk.beta, err = g2FromSnarkJS(k.Beta2, "vk_beta_2"); err != nil {
+		return nil, err
+	}
+	if vk.gamma, err = g2FromSnarkJS(k.Gamma2, "vk_gamma_2"); err != nil {
+		return nil, err
+	}
+	if vk.delta, err = g2FromSnarkJS(k.Delta2, "vk_delta_2"); err != nil {
+		return nil, err
+	}
+	for i, p := range k.IC {
+		if vk.k[i], err = g1FromSnarkJS(p, fmt.Sprintf("IC[%d]", i)); err != nil {
+			return nil, err
+		}
+	}
+	if err := vk.precompute(); err != nil {
+		return nil, err
+	}
+	return vk, nil
+}
+
+// SnarkJS returns the proof in the snarkjs format, ErrSnarkJSIncompatible for
+// a proof with commitments
+func (proof *Proof) SnarkJS() (*SnarkJSProof, error) {
+	if len(proof.commitments) > 0 {
+		return nil, fmt.Errorf("proof with %d commitments: %w", len(proof.commitments), ErrSnarkJSIncompatible)
+	}
+	return &SnarkJSProof{
+		A:        g1ToSnarkJS(&proof.ar),
+		B:        g2ToSnarkJS(&proof.bs),
+		C:        g1ToSnarkJS(&proof.krs),
+		Protocol: snarkJSProtocol,
+		Curve:    snarkJSCurve,
+	}, nil
+}
+
+// Proof returns the proof of a snarkjs proof, its points checked to be on the
+// curve
+func (p *SnarkJSProof) Proof() (*Proof, error) {
+	if p.Protocol != snarkJSProtocol || p.Curve != snarkJSCurve {
+		return nil, fmt.Errorf("unsupported snarkjs proof: %s on %s", p.Protocol, p.Curve)
+	}
+	proof := &Proof{}
+	var err error
+	if proof.ar, err = g1FromSnarkJS(p.A, "pi_a"); err != nil {
+		return nil, err
+	}
+	if proof.bs, err = g2FromSnarkJS(p.B, "pi_b"); err != nil {
+		return nil, err
+	}
+	if proof.krs, err = g1FromSnarkJS(p.C, "pi_c"); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// MarshalBinary returns the compressed encoding of the proof, the encoding
+// of groth16.Proof.WriteTo
+func (proof *Proof) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := curve.NewEncoder(&buf)
+	for _, v := range []any{&proof.ar, &proof.bs, &proof.krs, proof.commitments, &proof.commitmentPok} {
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// SnarkJSPublicSignals returns the public inputs in the public.json format of
+// snarkjs, decimal strings
+func SnarkJSPublicSignals(publicWitness []PublicInput) []string {
+	signals := make([]string, len(publicWitness))
+	for i := range publicWitness {
+		signals[i] = publicWitness[i].String()
+	}
+	return signals
+}
+
+// ParseSnarkJSPublicSignals returns the public inputs of snarkjs public
+// signals, each below the scalar field modulus
+func ParseSnarkJSPublicSignals(signals []string) ([]PublicInput, error) {
+	publicWitness := make([]PublicInput, len(signals))
+	for i, signal := range signals {
+		v, ok := new(big.Int).SetString(signal, 10)
+		if !ok || v.Sign() < 0 || v.Cmp(fr.Modulus()) >= 0 {
+			return nil, fmt.Errorf("invalid public signal %d %q", i, signal)
+		}
+		publicWitness[i].SetBigInt(v)
+	}
+	return publicWitness, nil
+}
+
+// MarshalPublicWitness returns the gnark binary encoding of a public witness
+// (witness.Witness.MarshalBinary of the public part), read by
+// ReadPublicWitness
+func MarshalPublicWitness(publicWitness []PublicInput) ([]byte, error) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, struct{ NbPublic, NbSecret uint32 }{uint32(len(publicWitness)), 0})
+	v := fr.Vector(publicWitness)
+	if _, err := v.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// g1ToSnarkJS returns the projective coordinates of p, [0, 1, 0] at infinity
+func g1ToSnarkJS(p *curve.G1Affine) []string {
+	if p.IsInfinity() {
+		return []string{"0", "1", "0"}
+	}
+	return []string{p.X.String(), p.Y.String(), "1"}
+}
+
+// g2ToSnarkJS returns the projective coordinates of p, [c0, c1] each
+func g2ToSnarkJS(p *curve.G2Affine) [][]string {
+	if p.IsInfinity() {
+		return [][]string{{"0", "0"}, {"1", "0"}, {"0", "0"}}
+	}
+	return [][]string{{p.X.A0.String(), p.X.A1.String()}, {p.Y.A0.String(), p.Y.A1.String()}, {"1", "0"}}
+}
+
+func g1FromSnarkJS(coordinates []string, name string) (curve.G1Affine, error) {
+	var p curve.G1Affine
+	if len(coordinates) != 3 {
+		return p, fmt.Errorf("invalid snarkjs point %s: %d coordinates", name, len(coordinates))
+	}
+	switch coordinates[2] {
+	case "0":
+		return p, nil
+	case "1":
+	default:
+		return p, fmt.Errorf("invalid snarkjs point %s: not normalized", name)
+	}
+	if err := setFp(&p.X, coordinates[0]); err != nil {
+		return p, fmt.Errorf("invalid snarkjs point %s: %w", name, err)
+	}
+	if err := setFp(&p.Y, coordinates[1]); err != nil {
+		return p, fmt.Errorf("invalid snarkjs point %s: %w", name, err)
+	}
+	if !p.IsOnCurve() || !p.IsInSubGroup() {
+		return p, fmt.Errorf("invalid snarkjs point %s: not on the curve", name)
+	}
+	return p, nil
+}
+
+func g2FromSnarkJS(coordinates [][]string, name string) (curve.G2Affine, error) {
+	var p curve.G2Affine
+	if len(coordinates) != 3 || len(coordinates[0]) != 2 || len(coordinates[1]) != 2 || len(coordinates[2]) != 2 {
+		return p, fmt.Errorf("invalid snarkjs point %s: expected 3 coordinates of 2 elements", name)
+	}
+	switch {
+	case coordinates[2][0] == "0" && coordinates[2][1] == "0":
+		return p, nil
+	case coordinates[2][0] == "1" && coordinates[2][1] == "0":
+	default:
+		return p, fmt.Errorf("invalid snarkjs point %s: not normalized", name)
+	}
+	for _, c := range []struct {
+		e     *fp.Element
+		value string
+	}{{&p.X.A0, coordinates[0][0]}, {&p.X.A1, coordinates[0][1]}, {&p.Y.A0, coordinates[1][0]}, {&p.Y.A1, coordinates[1][1]}} {
+		if err := setFp(c.e, c.value); err != nil {
+			return p, fmt.Errorf("invalid snarkjs point %s: %w", name, err)
+		}
+	}
+	if !p.IsOnCurve() || !p.IsInSubGroup() {
+		return p, fmt.Errorf("invalid snarkjs point %s: not on the curve", name)
+	}
+	return p, nil
+}
+
+// setFp sets e to the decimal coordinate, below the base field modulus
+func setFp(e *fp.Element, value string) error {
+	v, ok := new(big.Int).SetString(value, 10)
+	if !ok || v.Sign() < 0 || v.Cmp(fp.Modulus()) >= 0 {
+		return fmt.Errorf("invalid coordinate %q", value)
+	}
+	e.SetBigInt(v)
+	return nil
+}
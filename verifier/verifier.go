@@ -0,0 +1,380 @@
+// Package verifier verifies zero-knowledge presentations for relying parties.
+//
+// It holds the presentation formats (compact and COSE), the payload schemas
+// and a groth16 verifier of BN254 proofs built on gnark-crypto alone: it does
+// not import gnark, so a verifier service embedding it does not link the
+// constraint system, the solver or the prover. The verifying keys, proofs and
+// public witnesses are read from the gnark binary encodings the provers of
+// this module write.
+//
+// The models package re-exports the presentation types, and adds to its
+// PresentationVerifier the decoding of the public inputs, which needs the
+// circuit definitions.
+package verifier
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Failure classes of the verification, the returned errors wrap them with
+// the details
+var (
+	ErrUnknownCircuit  = errors.New("unknown circuit")
+	ErrInvalidWitness  = errors.New("invalid public witness")
+	ErrProofFailed     = errors.New("proof verification failed")
+	ErrVersionMismatch = errors.New("circuit version mismatch")
+	// ErrMalformedProof is wrapped with ErrProofFailed or ErrInvalidWitness
+	// when the proof or the public witness cannot be decoded, an encoding
+	// bug of the prover rather than a forged proof
+	ErrMalformedProof = errors.New("malformed proof encoding")
+	// ErrPublicInputCount is wrapped with ErrInvalidWitness when the public
+	// witness decodes but has another number of public inputs than the
+	// verifying key, a witness of another circuit or version
+	ErrPublicInputCount = errors.New("public input count mismatch")
+	// ErrPresentationExpired is returned for a presentation past its exp or
+	// its maximum age
+	ErrPresentationExpired = errors.New("presentation expired")
+	// ErrCredentialExpired is returned for a presentation of a credential
+	// past its expiry (cred_exp), whatever the exp of the presentation
+	ErrCredentialExpired = errors.New("credential expired")
+)
+
+// circuit is a circuit registered with a Verifier
+type circuit struct {
+	vkHash string
+	schema *PayloadSchema
+
+	// vk is nil until fetched from the registry for a circuit added with
+	// AddCircuitHash
+	mu sync.Mutex
+	vk *VerifyingKey
+}
+
+// VerificationResult is the result of a successful verification
+type VerificationResult struct {
+	Circuit string
+	// Presentation is the verified presentation, nil for a raw proof
+	Presentation *Presentation
+	// PublicInputs is the public witness of the proof
+	PublicInputs []PublicInput
+	// Deprecation is set for a deprecated version of the circuit accepted by
+	// MinVersions in its grace period or warn-only, to warn the holder
+	Deprecation *Deprecation
+}
+
+// Verifier verifies raw groth16 proofs and presentations of the registered
+// circuits
+type Verifier struct {
+	// ResolveKey returns the holder key verifying the presentation signature
+	ResolveKey func(header PresentationHeader) (*ecdsa.PublicKey, error)
+	// ResolvePQKey returns the encoded ML-DSA-65 public key of the holder
+	// verifying the post-quantum part of the hybrid signatures
+	// (AlgES256MLDSA65), which are verified on their ES256 part when nil
+	ResolvePQKey func(header PresentationHeader) ([]byte, error)
+	// Algs are the accepted presentation algs in preference order,
+	// SupportedAlgs when empty; [AlgES256MLDSA65] requires post-quantum
+	// envelopes
+	Algs []string
+	// Registry resolves the verifying keys of the circuits added with
+	// AddCircuitHash
+	Registry *Registry
+	// Pins, when set, verifies the presentations of the circuits which are
+	// not registered with the verifying key of their header, fetched from
+	// the Registry, as long as it matches the pin of the circuit; the first
+	// verified presentation pins it (see PinStore)
+	Pins *PinStore
+	// MinVersions rejects, or warns of, the circuit versions below the
+	// minimum version of their family; every version is accepted when nil
+	MinVersions *VersionPolicy
+	// Now is the clock the presentations and the circuit versions are
+	// checked against, time.Now when nil
+	Now func() time.Time
+	// ClockSkew tolerates the distance of the clock of the holders to the
+	// verification time in the checks of exp and cred_exp
+	ClockSkew time.Duration
+
+	mu       sync.RWMutex
+	circuits map[string]*circuit
+	// pinned are the circuits of Pins by verifying key hash, cached once a
+	// presentation of theirs verified
+	pinned map[string]*circuit
+}
+
+// New returns a verifier without circuits
+func New(resolveKey func(header PresentationHeader) (*ecdsa.PublicKey, error)) *Verifier {
+	return &Verifier{ResolveKey: resolveKey, circuits: map[string]*circuit{}}
+}
+
+// AddCircuit registers the verifying key (gnark binary encoding) and the
+// payload schema (optional) of a circuit
+func (v *Verifier) AddCircuit(circuitID string, vkBytes []byte, schema *PayloadSchema) error {
+	vk, err := ReadVerifyingKey(vkBytes)
+	if err != nil {
+		return err
+	}
+	vkHash, err := vk.Hash()
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.circuits[circuitID] = &circuit{vk: vk, vkHash: hex.EncodeToString(vkHash[:]), schema: schema}
+	return nil
+}
+
+// AddCircuitHash registers a circuit by the hex hash of its verifying key
+// (the vk_hash of the presentations), the key is fetched from the Registry
+// on the first verification
+func (v *Verifier) AddCircuitHash(circuitID, vkHash string, schema *PayloadSchema) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.circuits[circuitID] = &circuit{vkHash: vkHash, schema: schema}
+}
+
+// AcceptedAlgs returns the accepted presentation algs in preference order,
+// the Algs of the verifier or SupportedAlgs
+func (v *Verifier) AcceptedAlgs() []string {
+	if len(v.Algs) > 0 {
+		return v.Algs
+	}
+	return SupportedAlgs()
+}
+
+func (v *Verifier) now() time.Time {
+	if v.Now == nil {
+		return time.Now()
+	}
+	return v.Now()
+}
+
+func (v *Verifier) circuit(circuitID string) (*circuit, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	c, ok := v.circuits[circuitID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCircuit, circuitID)
+	}
+	return c, nil
+}
+
+// presentedCircuit returns the circuit of a presentation header: the
+// registered circuit, else with Pins the circuit of its verifying key hash,
+// once the hash is checked against the pin of the circuit. Its key is fetched
+// from the Registry until a presentation of the circuit verifies (cachePinned).
+func (v *Verifier) presentedCircuit(header PresentationHeader) (c *circuit, pinned bool, err error) {
+	c, err = v.circuit(header.Circuit)
+	if !errors.Is(err, ErrUnknownCircuit) || v.Pins == nil {
+		return c, false, err
+	}
+	// Check rejects a malformed hash before it is looked up or fetched
+	if err := v.Pins.Check(header.Circuit, header.VKHash); err != nil {
+		return nil, false, err
+	}
+	v.mu.RLock()
+	c, ok := v.pinned[header.VKHash]
+	v.mu.RUnlock()
+	if !ok {
+		c = &circuit{vkHash: header.VKHash}
+	}
+	return c, true, nil
+}
+
+// cachePinned caches the circuit of Pins of a verified presentation
+func (v *Verifier) cachePinned(c *circuit) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.pinned == nil {
+		v.pinned = map[string]*circuit{}
+	}
+	if _, ok := v.pinned[c.vkHash]; !ok {
+		v.pinned[c.vkHash] = c
+	}
+}
+
+// verifyingKey returns the verifying key of the circuit, fetched from the
+// registry when the circuit was added by hash
+func (v *Verifier) verifyingKey(c *circuit) (*VerifyingKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.vk != nil {
+		return c.vk, nil
+	}
+	if v.Registry == nil {
+		return nil, fmt.Errorf("no registry to fetch the verifying key %s", c.vkHash)
+	}
+	vk, err := v.Registry.VerifyingKey(context.Background(), c.vkHash)
+	if err != nil {
+		return nil, err
+	}
+	c.vk = vk
+	return vk, nil
+}
+
+// VerifyProof verifies a groth16 proof against the public witness (both in
+// gnark binary encoding) with the verifying key of the circuit
+func (v *Verifier) VerifyProof(circuitID string, proof, publicWitness []byte) (*VerificationResult, error) {
+	c, err := v.circuit(circuitID)
+	if err != nil {
+		return nil, err
+	}
+	deprecation, err := v.MinVersions.Check(circuitID, v.now())
+	if err != nil {
+		return nil, err
+	}
+	vk, err := v.verifyingKey(c)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := checkProof(vk, proof, publicWitness)
+	if err != nil {
+		return nil, err
+	}
+	return &VerificationResult{Circuit: circuitID, PublicInputs: inputs, Deprecation: deprecation}, nil
+}
+
+// Verify verifies a presentation in compact serialization:
+//  1. the circuit version is not deprecated (MinVersions)
+//  2. the holder signature, its post-quantum part (Algs, ResolvePQKey) and
+//     the expiry of the presentation, within ClockSkew
+//  3. the verifying key hash of the header matches the registered circuit
+//  4. the payload matches the circuit schema
+//  5. the proof against the public witness of the payload
+//
+// The steps run whatever fails before them, a holder key that does not
+// resolve is replaced by a placeholder and the proof of a mismatching
+// verifying key hash is verified with the registered key, and the first
+// failure in this order is returned: the verification time does not tell
+// which step failed. Only a presentation that cannot be parsed, names an
+// unknown circuit or a verifying key failing its pin, all public, is refused
+// up front.
+func (v *Verifier) Verify(compact string) (*VerificationResult, error) {
+	p, err := ParsePresentation(compact)
+	if err != nil {
+		return nil, err
+	}
+	return v.verify(p)
+}
+
+// VerifyCOSE verifies a COSE encoded presentation (see SignPresentationCOSE)
+// like Verify
+func (v *Verifier) VerifyCOSE(data []byte) (*VerificationResult, error) {
+	p, err := ParsePresentationCOSE(data)
+	if err != nil {
+		return nil, err
+	}
+	return v.verify(p)
+}
+
+func (v *Verifier) verify(p *Presentation) (*VerificationResult, error) {
+	if p.Header.Typ != PresentationType {
+		return nil, fmt.Errorf("unsupported presentation typ %q", p.Header.Typ)
+	}
+
+	// the circuit, its pin and its key only depend on the public header, they
+	// are refused before any work; every other check runs whatever fails
+	// before it
+	c, pinned, err := v.presentedCircuit(p.Header)
+	if err != nil {
+		return nil, err
+	}
+	vk, err := v.verifyingKey(c)
+	if err != nil {
+		return nil, err
+	}
+	at := v.now()
+	var first firstFailure
+	deprecation, err := v.MinVersions.Check(p.Header.Circuit, at)
+	first.add(err)
+
+	first.add(v.verifySignature(p))
+	first.add(p.CheckExpiry(at, v.ClockSkew))
+
+	if p.Header.VKHash != c.vkHash {
+		// the proof is still verified, with the registered key
+		first.add(fmt.Errorf("%w: %q was proven with verifying key %s, registered %s", ErrVersionMismatch, p.Header.Circuit, p.Header.VKHash, c.vkHash))
+	}
+	if c.schema != nil {
+		first.add(c.schema.Validate(p.RawPayload))
+	}
+
+	inputs, err := checkProof(vk, p.Proof, p.Payload.PublicWitness)
+	first.add(err)
+	if first.err != nil {
+		return nil, first.err
+	}
+	if pinned {
+		v.cachePinned(c)
+		v.Pins.trust(p.Header.Circuit, p.Header.VKHash)
+	}
+	return &VerificationResult{Circuit: p.Header.Circuit, Presentation: p, PublicInputs: inputs, Deprecation: deprecation}, nil
+}
+
+// placeholderKey verifies the holder signatures whose key does not resolve,
+// for the same work as with the holder key: the generator of P-256
+var placeholderKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: elliptic.P256().Params().Gx, Y: elliptic.P256().Params().Gy}
+
+// verifySignature resolves the holder key and verifies the holder signature
+// and the envelope of the presentation, against placeholderKey when the
+// holder key does not resolve
+func (v *Verifier) verifySignature(p *Presentation) error {
+	var keyErr error
+	key := placeholderKey
+	if v.ResolveKey == nil {
+		keyErr = fmt.Errorf("no holder key resolver")
+	} else if resolved, err := v.ResolveKey(p.Header); err != nil {
+		keyErr = fmt.Errorf("failed to resolve the holder key: %w", err)
+	} else {
+		key = resolved
+	}
+	signatureErr := p.VerifySignature(key)
+	envelopeErr := p.VerifyEnvelope(v.Algs, v.ResolvePQKey)
+	if keyErr != nil {
+		return keyErr
+	}
+	if signatureErr != nil {
+		return signatureErr
+	}
+	return envelopeErr
+}
+
+// firstFailure keeps the first failure of the checks of a verification, in
+// the order of the pipeline
+type firstFailure struct {
+	err error
+}
+
+func (f *firstFailure) add(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+// checkProof verifies the proofs of the verifications, a variable for the
+// tests counting the proofs verified by the failing verifications
+var checkProof = verifyProof
+
+func verifyProof(vk *VerifyingKey, proofBytes, publicWitnessBytes []byte) ([]PublicInput, error) {
+	proof, err := ReadProof(proofBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w: %w", ErrProofFailed, ErrMalformedProof, err)
+	}
+	publicWitness, err := ReadPublicWitness(publicWitnessBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w: %w", ErrInvalidWitness, ErrMalformedProof, err)
+	}
+	if len(publicWitness) != vk.NbPublic() {
+		return nil, fmt.Errorf("%w: %w: %d public inputs, the verifying key has %d", ErrInvalidWitness, ErrPublicInputCount, len(publicWitness), vk.NbPublic())
+	}
+	if err := Verify(vk, proof, publicWitness); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProofFailed, err)
+	}
+	return publicWitness, nil
+}
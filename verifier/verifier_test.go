@@ -0,0 +1,659 @@
+package verifier
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/rangecheck"
+)
+
+// cubeCircuit proves knowledge of X with X^3 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+// rangeCircuit proves X + Y fits in 16 bits, the range check commits to the
+// witness (BSB22 commitment)
+type rangeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *rangeCircuit) Define(api frontend.API) error {
+	rangecheck.New(api).Check(api.Add(c.X, c.Y), 16)
+	return nil
+}
+
+type setup struct {
+	vk            groth16.VerifyingKey
+	vkBytes       []byte
+	proof         groth16.Proof
+	proofBytes    []byte
+	publicWitness []byte
+}
+
+func newSetup(t *testing.T, template, assignment frontend.Circuit) *setup {
+	t.Helper()
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := w.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &setup{vk: vk, proof: proof}
+	var buf bytes.Buffer
+	vk.WriteTo(&buf)
+	s.vkBytes = bytes.Clone(buf.Bytes())
+	buf.Reset()
+	proof.WriteTo(&buf)
+	s.proofBytes = bytes.Clone(buf.Bytes())
+	if s.publicWitness, err = public.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// verify verifies with the package and checks gnark agrees
+func (s *setup) verify(t *testing.T, proofBytes, publicWitness []byte) error {
+	t.Helper()
+	vk, err := ReadVerifyingKey(s.vkBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifyProof(vk, proofBytes, publicWitness)
+
+	proof := groth16.NewProof(ecc.BN254)
+	if _, readErr := proof.ReadFrom(bytes.NewReader(proofBytes)); readErr == nil {
+		if expected := s.gnarkVerify(t, proof, publicWitness); (err == nil) != (expected == nil) {
+			t.Fatalf("verification %v, gnark %v", err, expected)
+		}
+	}
+	return err
+}
+
+func (s *setup) gnarkVerify(t *testing.T, proof groth16.Proof, publicWitness []byte) error {
+	t.Helper()
+	w, err := frontend.NewWitness(nil, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.UnmarshalBinary(publicWitness); err != nil {
+		return err
+	}
+	return groth16.Verify(proof, s.vk, w)
+}
+
+func TestVerify(t *testing.T) {
+	for name, s := range map[string]*setup{
+		"cube":       newSetup(t, &cubeCircuit{}, &cubeCircuit{X: 3, Y: 27}),
+		"commitment": newSetup(t, &rangeCircuit{}, &rangeCircuit{X: 1000, Y: 24}),
+	} {
+		if err := s.verify(t, s.proofBytes, s.publicWitness); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// raw (uncompressed) encodings
+		var raw bytes.Buffer
+		s.proof.WriteRawTo(&raw)
+		if err := s.verify(t, raw.Bytes(), s.publicWitness); err != nil {
+			t.Fatalf("%s: raw proof: %v", name, err)
+		}
+		raw.Reset()
+		s.vk.WriteRawTo(&raw)
+		vk, err := ReadVerifyingKey(raw.Bytes())
+		if err != nil {
+			t.Fatalf("%s: raw verifying key: %v", name, err)
+		}
+
+		// the hash of the presentations (common.VerifyingKeyHash)
+		hash, err := vk.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := sha256.Sum256(s.vkBytes); hash != expected {
+			t.Fatalf("%s: verifying key hash %x, expected %x", name, hash, expected)
+		}
+
+		// another statement
+		other := bytes.Clone(s.publicWitness)
+		other[len(other)-1]++
+		if err := s.verify(t, s.proofBytes, other); !errors.Is(err, ErrProofFailed) {
+			t.Fatalf("%s: expected the proof to fail for another witness, got %v", name, err)
+		}
+		if err := s.verify(t, s.proofBytes, s.publicWitness[:len(s.publicWitness)-1]); !errors.Is(err, ErrInvalidWitness) {
+			t.Fatalf("%s: expected an invalid witness, got %v", name, err)
+		}
+		if err := s.verify(t, s.proofBytes[:len(s.proofBytes)-1], s.publicWitness); !errors.Is(err, ErrProofFailed) {
+			t.Fatalf("%s: expected an invalid proof, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{}, &cubeCircuit{X: 3, Y: 27})
+	holderKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := New(func(header PresentationHeader) (*ecdsa.PublicKey, error) {
+		return &holderKey.PublicKey, nil
+	})
+	schema := &PayloadSchema{Required: []string{"nonce"}, Properties: map[string]string{"nonce": "string"}}
+	if err := v.AddCircuit("cube/v1", s.vkBytes, schema); err != nil {
+		t.Fatal(err)
+	}
+	vkHash := sha256.Sum256(s.vkBytes)
+	header := PresentationHeader{Circuit: "cube/v1", VKHash: hex.EncodeToString(vkHash[:])}
+	payload := PresentationPayload{Nonce: "n-1", IssuedAt: time.Now().Unix(), PublicWitness: s.publicWitness}
+
+	compact, err := SignPresentation(header, payload, s.proofBytes, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := v.Verify(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Circuit != "cube/v1" || res.Presentation.Payload.Nonce != "n-1" || len(res.PublicInputs) != 1 || res.PublicInputs[0].Uint64() != 27 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	cose, err := SignPresentationCOSE(header, payload, s.proofBytes, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerifyCOSE(cose); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerifyProof("cube/v1", s.proofBytes, s.publicWitness); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := map[string]struct {
+		header  PresentationHeader
+		payload PresentationPayload
+		err     error
+	}{
+		"unknown circuit": {PresentationHeader{Circuit: "cube/v2", VKHash: header.VKHash}, payload, ErrUnknownCircuit},
+		"vk hash":         {PresentationHeader{Circuit: "cube/v1", VKHash: strings.Repeat("00", 32)}, payload, ErrVersionMismatch},
+	}
+	for name, tc := range invalid {
+		compact, err := SignPresentation(tc.header, tc.payload, s.proofBytes, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = v.Verify(compact)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+	var fieldErr *FieldError
+	schemaCompact, _ := SignPresentation(header, PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: s.publicWitness}, s.proofBytes, holderKey)
+	if _, err := v.Verify(schemaCompact); !errors.As(err, &fieldErr) || fieldErr.Field != "nonce" {
+		t.Fatalf("expected a field error on the nonce, got %v", err)
+	}
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged, _ := SignPresentation(header, payload, s.proofBytes, otherKey)
+	if _, err := v.Verify(forged); err == nil {
+		t.Fatal("expected an error for a presentation signed by another key")
+	}
+}
+
+func TestConstantWork(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{}, &cubeCircuit{X: 3, Y: 27})
+	holderKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := New(func(header PresentationHeader) (*ecdsa.PublicKey, error) {
+		if header.Kid == "unknown" {
+			return nil, errors.New("unknown holder")
+		}
+		return &holderKey.PublicKey, nil
+	})
+	if err := v.AddCircuit("cube/v1", s.vkBytes, &PayloadSchema{Required: []string{"nonce"}}); err != nil {
+		t.Fatal(err)
+	}
+	// every failing verification still verifies the proof
+	proofs := 0
+	defer func(check func(*VerifyingKey, []byte, []byte) ([]PublicInput, error)) { checkProof = check }(checkProof)
+	verify := checkProof
+	checkProof = func(vk *VerifyingKey, proof, publicWitness []byte) ([]PublicInput, error) {
+		proofs++
+		return verify(vk, proof, publicWitness)
+	}
+
+	vkHash := sha256.Sum256(s.vkBytes)
+	header := PresentationHeader{Circuit: "cube/v1", VKHash: hex.EncodeToString(vkHash[:])}
+	now := time.Now().Unix()
+	valid := PresentationPayload{Nonce: "n-1", IssuedAt: now, PublicWitness: s.publicWitness}
+	expired := valid
+	expired.IssuedAt, expired.ExpiresAt = now-60, now-1
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	unknown := header
+	unknown.Kid = "unknown"
+	otherHash := header
+	otherHash.VKHash = strings.Repeat("00", 32)
+
+	for _, tc := range []struct {
+		name    string
+		header  PresentationHeader
+		payload PresentationPayload
+		key     *ecdsa.PrivateKey
+		err     error
+	}{
+		{"valid", header, valid, holderKey, nil},
+		{"signature", header, valid, otherKey, nil},
+		{"unresolved key", unknown, valid, holderKey, nil},
+		{"expired", header, expired, holderKey, ErrPresentationExpired},
+		{"vk hash", otherHash, valid, holderKey, ErrVersionMismatch},
+		{"schema", header, PresentationPayload{IssuedAt: now, PublicWitness: s.publicWitness}, holderKey, nil},
+	} {
+		compact, err := SignPresentation(tc.header, tc.payload, s.proofBytes, tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proofs = 0
+		_, err = v.Verify(compact)
+		if (err == nil) != (tc.name == "valid") || tc.err != nil && !errors.Is(err, tc.err) {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if proofs != 1 {
+			t.Errorf("%s: %d proofs verified, expected 1", tc.name, proofs)
+		}
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{}, &cubeCircuit{X: 3, Y: 27})
+	holderKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := New(func(PresentationHeader) (*ecdsa.PublicKey, error) { return &holderKey.PublicKey, nil })
+	if err := v.AddCircuit("cube/v1", s.vkBytes, nil); err != nil {
+		t.Fatal(err)
+	}
+	vkHash := sha256.Sum256(s.vkBytes)
+	header := PresentationHeader{Circuit: "cube/v1", VKHash: hex.EncodeToString(vkHash[:])}
+	signedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	present := func(credentialExpiresAt time.Time) string {
+		t.Helper()
+		payload := PresentationPayload{IssuedAt: signedAt.Unix(), ExpiresAt: signedAt.Add(time.Minute).Unix(), PublicWitness: s.publicWitness}
+		if !credentialExpiresAt.IsZero() {
+			payload.CredentialExpiresAt = credentialExpiresAt.Unix()
+		}
+		compact, err := SignPresentation(header, payload, s.proofBytes, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compact
+	}
+	v.ClockSkew = 10 * time.Second
+
+	for _, tc := range []struct {
+		name    string
+		compact string
+		at      time.Time
+		err     error
+	}{
+		{"fresh", present(time.Time{}), signedAt.Add(30 * time.Second), nil},
+		{"within skew", present(time.Time{}), signedAt.Add(69 * time.Second), nil},
+		{"at the skew", present(time.Time{}), signedAt.Add(70 * time.Second), ErrPresentationExpired},
+		{"credential within skew", present(signedAt.Add(20 * time.Second)), signedAt.Add(29 * time.Second), nil},
+		{"credential at the skew", present(signedAt.Add(20 * time.Second)), signedAt.Add(30 * time.Second), ErrCredentialExpired},
+	} {
+		v.Now = func() time.Time { return tc.at }
+		if _, err := v.Verify(tc.compact); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+	v.ClockSkew = 0
+	v.Now = func() time.Time { return signedAt.Add(65 * time.Second) }
+	if _, err := v.Verify(present(time.Time{})); !errors.Is(err, ErrPresentationExpired) {
+		t.Fatalf("expected an expired presentation without skew, got %v", err)
+	}
+
+	// a presentation without exp expires DefaultPresentationTTL after its iat
+	noExp, err := SignPresentation(header, PresentationPayload{IssuedAt: signedAt.Unix(), PublicWitness: s.publicWitness}, s.proofBytes, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Now = func() time.Time { return signedAt.Add(DefaultPresentationTTL - time.Second) }
+	if _, err := v.Verify(noExp); err != nil {
+		t.Fatalf("expected a presentation without exp to verify within its default lifetime, got %v", err)
+	}
+	v.Now = func() time.Time { return signedAt.Add(DefaultPresentationTTL) }
+	if _, err := v.Verify(noExp); !errors.Is(err, ErrPresentationExpired) {
+		t.Fatalf("expected a presentation without exp to expire after DefaultPresentationTTL, got %v", err)
+	}
+}
+
+func TestVersionPolicy(t *testing.T) {
+	now := time.Unix(1767225600, 0)
+	policy, err := NewVersionPolicy(
+		Deprecation{Circuit: "cube", MinVersion: 2, Reason: "advisory-1"},
+		Deprecation{Circuit: "square", MinVersion: 3, EnforceAt: now.Add(time.Hour).Unix()},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(circuitID string, at time.Time, warned bool, rejected bool) {
+		t.Helper()
+		d, err := policy.Check(circuitID, at)
+		if (d != nil) != warned || errors.Is(err, ErrCircuitDeprecated) != rejected {
+			t.Errorf("%s at %s: unexpected deprecation %+v, error %v", circuitID, at, d, err)
+		}
+	}
+	check("cube/v2", now, false, false)
+	check("cube/v1", now, false, true)
+	// an id without version segment is the first version
+	check("cube", now, false, true)
+	check("other/v1", now, false, false)
+	// grace period
+	check("square/v2", now, true, false)
+	check("square/v2", now.Add(time.Hour), false, true)
+	policy.WarnOnly = true
+	check("cube/v1", now, true, false)
+	var nilPolicy *VersionPolicy
+	if d, err := nilPolicy.Check("cube/v1", now); d != nil || err != nil {
+		t.Fatalf("expected a nil policy to accept every version, got %+v %v", d, err)
+	}
+
+	for name, d := range map[string]Deprecation{
+		"versioned id":  {Circuit: "cube/v1", MinVersion: 2},
+		"no version":    {Circuit: "cube"},
+		"empty circuit": {MinVersion: 2},
+	} {
+		if _, err := NewVersionPolicy(d); err == nil {
+			t.Errorf("%s: expected an invalid deprecation", name)
+		}
+	}
+
+	// enforced by the verifier, warned in the result
+	s := newSetup(t, &cubeCircuit{}, &cubeCircuit{X: 3, Y: 27})
+	v := New(nil)
+	if err := v.AddCircuit("cube/v1", s.vkBytes, nil); err != nil {
+		t.Fatal(err)
+	}
+	v.MinVersions, _ = NewVersionPolicy(Deprecation{Circuit: "cube", MinVersion: 2})
+	var deprecationErr *DeprecationError
+	if _, err := v.VerifyProof("cube/v1", s.proofBytes, s.publicWitness); !errors.As(err, &deprecationErr) || deprecationErr.Version != 1 {
+		t.Fatalf("expected a deprecation error, got %v", err)
+	}
+	v.MinVersions.WarnOnly = true
+	res, err := v.VerifyProof("cube/v1", s.proofBytes, s.publicWitness)
+	if err != nil || res.Deprecation == nil || res.Deprecation.MinVersion != 2 {
+		t.Fatalf("expected a deprecation warning, got %+v %v", res, err)
+	}
+}
+
+func TestPinStore(t *testing.T) {
+	setups := []*setup{
+		newSetup(t, &cubeCircuit{}, &cubeCircuit{X: 3, Y: 27}),
+		newSetup(t, &cubeCircuit{}, &cubeCircuit{X: 3, Y: 27}),
+	}
+	keys := map[string][]byte{}
+	hashes := make([]string, len(setups))
+	for i, s := range setups {
+		digest := sha256.Sum256(s.vkBytes)
+		hashes[i] = hex.EncodeToString(digest[:])
+		keys[hashes[i]] = s.vkBytes
+	}
+	fetches := 0
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if vk, ok := keys[strings.TrimPrefix(r.URL.Path, "/vks/")]; ok {
+			w.Write(vk)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer registry.Close()
+
+	holderKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alerts []PinChange
+	pins := NewPinStore()
+	pins.OnChange = func(change PinChange) { alerts = append(alerts, change) }
+	v := New(func(PresentationHeader) (*ecdsa.PublicKey, error) { return &holderKey.PublicKey, nil })
+	v.Registry = NewRegistry(registry.URL)
+	v.Pins = pins
+
+	present := func(i int, publicWitness []byte) error {
+		header := PresentationHeader{Circuit: "cube/v1", VKHash: hashes[i]}
+		payload := PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: publicWitness}
+		compact, err := SignPresentation(header, payload, setups[i].proofBytes, holderKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = v.Verify(compact)
+		return err
+	}
+
+	// a failed verification does not pin, nor caches the circuit
+	if err := present(1, []byte("invalid")); !errors.Is(err, ErrInvalidWitness) || len(pins.Pins()) != 0 || len(v.pinned) != 0 {
+		t.Fatalf("unexpected first use %v %v", err, pins.Pins())
+	}
+	// a malformed hash is refused before the registry, made up circuits of
+	// unauthenticated presentations are not cached
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fetched := fetches
+	for i, header := range []PresentationHeader{
+		{Circuit: "cube/v1", VKHash: "../" + hashes[0]},
+		{Circuit: "made-up/v1", VKHash: strings.Repeat("ab", 32)},
+		{Circuit: "made-up/v2", VKHash: hashes[0]},
+	} {
+		compact, err := SignPresentation(header, PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: setups[0].publicWitness}, setups[0].proofBytes, otherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.Verify(compact); err == nil {
+			t.Fatalf("%s: expected an error", header.Circuit)
+		}
+		if i == 0 && fetches != fetched {
+			t.Fatalf("expected a malformed hash refused before the registry, %d fetches", fetches-fetched)
+		}
+	}
+	if len(v.pinned) != 0 || len(pins.Pins()) != 0 {
+		t.Fatalf("unexpected cached circuits %v, pins %v", v.pinned, pins.Pins())
+	}
+	if err := present(0, setups[0].publicWitness); err != nil {
+		t.Fatal(err)
+	}
+	if p := pins.Pins(); len(p) != 1 || p[0].Circuit != "cube/v1" || p[0].VKHash != hashes[0] || len(v.pinned) != 1 {
+		t.Fatalf("expected cube/v1 pinned on first use, got %v", p)
+	}
+
+	// a new key is rejected and alerted once until approved
+	for range 2 {
+		if err := present(1, setups[1].publicWitness); !errors.Is(err, ErrPinMismatch) || !errors.Is(err, ErrVersionMismatch) {
+			t.Fatalf("expected a pin mismatch, got %v", err)
+		}
+	}
+	if len(alerts) != 1 || alerts[0].Pinned != hashes[0] || alerts[0].Presented != hashes[1] || len(pins.Pending()) != 1 {
+		t.Fatalf("unexpected alerts %v, pending %v", alerts, pins.Pending())
+	}
+	if err := pins.Approve("cube/v1", hashes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := present(1, setups[1].publicWitness); err != nil || len(pins.Pending()) != 0 {
+		t.Fatalf("expected the approved key, got %v", err)
+	}
+	if err := present(0, setups[0].publicWitness); !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("expected a pin mismatch for the previous key, got %v", err)
+	}
+
+	// a strict instance of the fleet only verifies the imported pins
+	exported, err := pins.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fleet := NewPinStore()
+	fleet.Strict = true
+	if err := fleet.Import(exported); err != nil {
+		t.Fatal(err)
+	}
+	if p := fleet.Pins(); len(p) != 1 || p[0].VKHash != hashes[1] {
+		t.Fatalf("unexpected imported pins %v", p)
+	}
+	v.Pins = fleet
+	if err := present(1, setups[1].publicWitness); err != nil {
+		t.Fatal(err)
+	}
+	if err := fleet.Check("cube/v2", hashes[1]); !errors.Is(err, ErrUnknownCircuit) {
+		t.Fatalf("expected an unpinned circuit, got %v", err)
+	}
+	for _, invalid := range []string{`{"pins":[{"circuit":"cube/v2","vk_hash":"00"}]}`, `{"pins":[{"vk_hash":"` + hashes[0] + `"}]}`, `[`} {
+		if err := fleet.Import([]byte(invalid)); err == nil {
+			t.Fatalf("expected an invalid pin set %s", invalid)
+		}
+	}
+}
+
+func TestSnarkJS(t *testing.T) {
+	s := newSetup(t, &cubeCircuit{}, &cubeCircuit{X: 3, Y: 27})
+	vk, err := ReadVerifyingKey(s.vkBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := ReadProof(s.proofBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, err := ReadPublicWitness(s.publicWitness)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// through the JSON files of snarkjs and back
+	exportedVK, err := vk.SnarkJS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportedProof, err := proof.SnarkJS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals := SnarkJSPublicSignals(publicWitness)
+	if exportedVK.NPublic != 1 || len(exportedVK.IC) != 2 || len(signals) != 1 || signals[0] != "27" {
+		t.Fatalf("unexpected snarkjs key %+v, public signals %v", exportedVK, signals)
+	}
+	var importedVK SnarkJSVerifyingKey
+	var importedProof SnarkJSProof
+	for v, imported := range map[any]any{exportedVK: &importedVK, exportedProof: &importedProof} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, imported); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vk2, err := importedVK.VerifyingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof2, err := importedProof.Proof()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicWitness2, err := ParseSnarkJSPublicSignals(signals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(vk2, proof2, publicWitness2); err != nil {
+		t.Fatal(err)
+	}
+
+	// the imported proof in the gnark encoding
+	proofBytes, err := proof2.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicBytes, err := MarshalPublicWitness(publicWitness2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(proofBytes, s.proofBytes) || !bytes.Equal(publicBytes, s.publicWitness) {
+		t.Fatal("the imported proof does not encode as the gnark proof")
+	}
+	if err := s.verify(t, proofBytes, publicBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	other := *exportedProof
+	other.A = []string{"1", "3", "1"}
+	if _, err := other.Proof(); err == nil {
+		t.Fatal("expected an error for a point off the curve")
+	}
+	if _, err := ParseSnarkJSPublicSignals([]string{fr.Modulus().String()}); err == nil {
+		t.Fatal("expected an error for a public signal out of the field")
+	}
+
+	commitment := newSetup(t, &rangeCircuit{}, &rangeCircuit{X: 1000, Y: 24})
+	if vk, err = ReadVerifyingKey(commitment.vkBytes); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vk.SnarkJS(); !errors.Is(err, ErrSnarkJSIncompatible) {
+		t.Fatalf("expected ErrSnarkJSIncompatible for a key with commitments, got %v", err)
+	}
+}
+
+// TestDependencies checks the package does not link gnark
+func TestDependencies(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	out, err := exec.Command("go", "list", "-deps", ".").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dep := range strings.Fields(string(out)) {
+		if strings.HasPrefix(dep, "github.com/consensys/gnark/") || dep == "github.com/consensys/gnark" {
+			t.Errorf("verifier depends on %s", dep)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package wallet
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// ErrKeyDestroyed is returned by a key handle used after Destroy
+var ErrKeyDestroyed = errors.New("key destroyed")
+
+// KeyHandle is a P-256 holder key the SDK signs with by reference, without
+// passing the private key around: a SoftwareKey in process memory, wiped on
+// Destroy, or a DeviceKey whose private key never leaves the device. The
+// handles never format their private key, in logs or errors.
+type KeyHandle interface {
+	ChallengeSigner
+	// Public returns the public key
+	Public() *ecdsa.PublicKey
+	// Exportable reports whether the private key is in process memory
+	Exportable() bool
+	// Destroy wipes the private key from memory, the signatures fail with
+	// ErrKeyDestroyed afterwards
+	Destroy()
+}
+
+// SoftwareKey is a key handle of a private key in process memory. It owns
+// the key: Destroy zeroes the private scalar, as far as Go allows (the
+// copies made by the garbage collector and crypto/ecdsa are out of reach).
+type SoftwareKey struct {
+	mu     sync.RWMutex
+	key    *ecdsa.PrivateKey
+	public ecdsa.PublicKey
+}
+
+// GenerateSoftwareKey generates a P-256 software key
+func GenerateSoftwareKey() (*SoftwareKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewSoftwareKey(key)
+}
+
+// NewSoftwareKey returns the handle of a P-256 private key. The handle takes
+// ownership of key: the caller drops its reference, Destroy wipes it.
+func NewSoftwareKey(key *ecdsa.PrivateKey) (*SoftwareKey, error) {
+	if key == nil || key.Curve != elliptic.P256() {
+		return nil, errors.New("a P-256 private key is required")
+	}
+	return &SoftwareKey{key: key, public: key.PublicKey}, nil
+}
+
+// ParseSoftwareKeyPEM parses a PEM EC private key, SEC 1 or PKCS #8. The
+// decoded DER is wiped; the caller wipes data (clear) when done with it.
+func ParseSoftwareKeyPEM(data []byte) (*SoftwareKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+	defer clear(block.Bytes)
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return NewSoftwareKey(key)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		// the parse errors do not quote the key
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA key")
+	}
+	return NewSoftwareKey(ecKey)
+}
+
+// SignChallenge implements ChallengeSigner
+func (k *SoftwareKey) SignChallenge(ctx context.Context, challenge []byte) (*Signature, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.key == nil {
+		return nil, ErrKeyDestroyed
+	}
+	digest := sha256.Sum256(challenge)
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("ES256 signature failed: %w", err)
+	}
+	return &Signature{R: r, S: s}, nil
+}
+
+// Public implements KeyHandle
+func (k *SoftwareKey) Public() *ecdsa.PublicKey {
+	public := k.public
+	return &public
+}
+
+// Exportable implements KeyHandle
+func (k *SoftwareKey) Exportable() bool {
+	return true
+}
+
+// Destroy implements KeyHandle, zeroing the private scalar
+func (k *SoftwareKey) Destroy() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.key == nil {
+		return
+	}
+	wipeInt(k.key.D)
+	k.key = nil
+}
+
+// String returns the public part of the key, the private key is never
+// formatted
+func (k *SoftwareKey) String() string {
+	return "SoftwareKey(P-256 " + fingerprint(&k.public) + ")"
+}
+
+// GoString returns String, for %#v
+func (k *SoftwareKey) GoString() string {
+	return k.String()
+}
+
+// LogValue implements slog.LogValuer, logging the public part only
+func (k *SoftwareKey) LogValue() slog.Value {
+	return slog.StringValue(k.String())
+}
+
+// DeviceKey is the key handle of a non-exportable key, e.g. of a PKCS11Signer,
+// a CardSigner or a platform keystore (CryptoSigner): it signs with Signer
+// and holds the public key only
+type DeviceKey struct {
+	Signer ChallengeSigner
+	Key    *ecdsa.PublicKey
+}
+
+// SignChallenge implements ChallengeSigner
+func (d *DeviceKey) SignChallenge(ctx context.Context, challenge []byte) (*Signature, error) {
+	if d.Signer == nil {
+		return nil, ErrKeyDestroyed
+	}
+	return d.Signer.SignChallenge(ctx, challenge)
+}
+
+// Public implements KeyHandle
+func (d *DeviceKey) Public() *ecdsa.PublicKey {
+	return d.Key
+}
+
+// Exportable implements KeyHandle, a device key never is
+func (d *DeviceKey) Exportable() bool {
+	return false
+}
+
+// Destroy implements KeyHandle, releasing the signer; the key stays on the
+// device
+func (d *DeviceKey) Destroy() {
+	d.Signer = nil
+}
+
+// String returns the public key fingerprint
+func (d *DeviceKey) String() string {
+	return "DeviceKey(P-256 " + fingerprint(d.Key) + ")"
+}
+
+// fingerprint returns the first bytes of SHA-256 of the public key, in hex
+func fingerprint(key *ecdsa.PublicKey) string {
+	if key == nil || key.X == nil {
+		return "none"
+	}
+	digest := sha256.Sum256(append(key.X.FillBytes(make([]byte, 32)), key.Y.FillBytes(make([]byte, 32))...))
+	return fmt.Sprintf("%x", digest[:8])
+}
+
+// wipeInt zeroes the words of x, then x
+func wipeInt(x *big.Int) {
+	if x == nil {
+		return
+	}
+	clear(x.Bits())
+	x.SetInt64(0)
+}
+
+// SignPresentation signs and serializes a presentation with the holder key
+// handle (models.SignPresentationES256)
+func SignPresentation(ctx context.Context, header models.PresentationHeader, payload models.PresentationPayload, proof []byte, key KeyHandle) (string, error) {
+	return models.SignPresentationES256(header, payload, proof, func(data []byte) ([]byte, error) {
+		signature, err := key.SignChallenge(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		return signature.Bytes(), nil
+	})
+}
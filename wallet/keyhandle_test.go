@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mynextid/eudi-zk/models"
+)
+
+func TestSoftwareKey(t *testing.T) {
+	key := newKey(t)
+	secret := fmt.Sprintf("%x", key.D)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	handle, err := ParseSoftwareKeyPEM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !handle.Public().Equal(&key.PublicKey) || !handle.Exportable() {
+		t.Fatal("expected the exportable handle of the key")
+	}
+
+	challenge := []byte("challenge")
+	sig, err := NewChallengeSigner(handle).SignChallenge(t.Context(), challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(&key.PublicKey, models.ContextMessage(models.SigningContextChallenge, challenge)) {
+		t.Fatal("expected a signature of the key")
+	}
+
+	// the key is never formatted
+	var logged bytes.Buffer
+	slog.New(slog.NewTextHandler(&logged, nil)).Info("signed", "key", handle)
+	for _, formatted := range []string{fmt.Sprint(handle), fmt.Sprintf("%+v", handle), fmt.Sprintf("%#v", handle), logged.String()} {
+		if strings.Contains(formatted, secret) || !strings.Contains(formatted, "SoftwareKey(P-256 ") {
+			t.Fatalf("unexpected formatted key %q", formatted)
+		}
+	}
+
+	// Destroy zeroes the private scalar of the parsed key
+	parsed := handle.key
+	handle.Destroy()
+	if parsed.D.Sign() != 0 {
+		t.Fatal("expected the private scalar to be wiped")
+	}
+	if _, err := handle.SignChallenge(t.Context(), challenge); !errors.Is(err, ErrKeyDestroyed) {
+		t.Fatalf("expected ErrKeyDestroyed, got %v", err)
+	}
+	handle.Destroy()
+}
+
+func TestDeviceKey(t *testing.T) {
+	key := newKey(t)
+	card := &fakeCard{key: key, pin: "123456", retries: 3}
+	handle := &DeviceKey{
+		Signer: &CardSigner{Card: card, PIN: func(context.Context, int) (string, error) { return "123456", nil }},
+		Key:    &key.PublicKey,
+	}
+	if handle.Exportable() {
+		t.Fatal("expected a non-exportable key")
+	}
+
+	compact, err := SignPresentation(t.Context(), models.PresentationHeader{Circuit: "cube/v1"}, models.PresentationPayload{IssuedAt: 1700000000}, []byte{1}, handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := models.ParsePresentation(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.VerifySignature(handle.Public()); err != nil {
+		t.Fatal(err)
+	}
+
+	handle.Destroy()
+	if _, err := handle.SignChallenge(t.Context(), []byte("challenge")); !errors.Is(err, ErrKeyDestroyed) {
+		t.Fatalf("expected ErrKeyDestroyed, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package wallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// CardTransport transmits command APDUs to a smartcard and returns the
+// response APDU (data || SW1 SW2), implemented by an adapter of the PC/SC
+// binding of the application (e.g. Card.Transmit of github.com/ebfe/scard)
+type CardTransport interface {
+	Transmit(apdu []byte) ([]byte, error)
+}
+
+// Status words of the card responses (ISO/IEC 7816-4)
+const (
+	swOK                   = 0x9000
+	swSecurityNotSatisfied = 0x6982
+	swPINBlocked           = 0x6983
+)
+
+// DefaultPINReference is the reference of the signature PIN of CardSigner
+// (VERIFY P2), a specific reference of the selected application
+const DefaultPINReference = 0x81
+
+// CardError is a card response with an error status word
+type CardError struct {
+	// Command names the command
+	Command string
+	SW      uint16
+}
+
+func (e *CardError) Error() string {
+	return fmt.Sprintf("card: %s failed with SW %04X", e.Command, e.SW)
+}
+
+// CardSigner signs with the signature key of an ISO/IEC 7816-8 smartcard:
+// SELECT the signature application, MANAGE SECURITY ENVIRONMENT to select
+// the key, VERIFY the PIN and PERFORM SECURITY OPERATION: COMPUTE DIGITAL
+// SIGNATURE of the SHA-256 digest. The PIN is verified when the card
+// requires it, every signature for a QSCD key.
+type CardSigner struct {
+	Card CardTransport
+	// Application is the AID of the signature application, selected first
+	// when set
+	Application []byte
+	// KeyReference is the reference of the private key (MSE SET, tag 84),
+	// the key of the security environment of the card when 0
+	KeyReference byte
+	// Algorithm is the algorithm reference of the MSE SET (tag 80), card
+	// specific, omitted when 0
+	Algorithm byte
+	// PINReference is the reference of the signature PIN, DefaultPINReference
+	// when 0
+	PINReference byte
+	// PIN prompts for the PIN when the card requires it, the signature fails
+	// with ErrPINRequired when nil
+	PIN PINPrompt
+}
+
+// SignChallenge implements ChallengeSigner
+func (c *CardSigner) SignChallenge(ctx context.Context, challenge []byte) (*Signature, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.Application) > 0 {
+		if _, err := c.transmit("SELECT", apdu(0x00, 0xA4, 0x04, 0x0C, c.Application, false)); err != nil {
+			return nil, err
+		}
+	}
+	if c.KeyReference != 0 {
+		crt := []byte{0x84, 0x01, c.KeyReference}
+		if c.Algorithm != 0 {
+			crt = append(crt, 0x80, 0x01, c.Algorithm)
+		}
+		if _, err := c.transmit("MANAGE SECURITY ENVIRONMENT", apdu(0x00, 0x22, 0x41, 0xB6, crt, false)); err != nil {
+			return nil, err
+		}
+	}
+
+	digest := sha256.Sum256(challenge)
+	sign := apdu(0x00, 0x2A, 0x9E, 0x9A, digest[:], true)
+	signature, err := c.transmit("COMPUTE DIGITAL SIGNATURE", sign)
+	if errors.Is(err, ErrPINRequired) && c.PIN != nil {
+		if err := c.verifyPIN(ctx); err != nil {
+			return nil, err
+		}
+		signature, err = c.transmit("COMPUTE DIGITAL SIGNATURE", sign)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseSignature(signature)
+}
+
+// verifyPIN prompts for the PIN with the retries left and verifies it
+func (c *CardSigner) verifyPIN(ctx context.Context) error {
+	reference := c.PINReference
+	if reference == 0 {
+		reference = DefaultPINReference
+	}
+	// VERIFY without data returns the retries left
+	retries := -1
+	var cardErr *CardError
+	if _, err := c.transmit("VERIFY", apdu(0x00, 0x20, 0x00, reference, nil, false)); errors.As(err, &cardErr) && cardErr.SW&0xFFF0 == 0x63C0 {
+		retries = int(cardErr.SW & 0x0F)
+	} else if errors.Is(err, ErrPINBlocked) {
+		return err
+	}
+	if retries == 0 {
+		return fmt.Errorf("%w: no retries left", ErrPINBlocked)
+	}
+
+	pin, err := c.PIN(ctx, retries)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// the PIN copies of the command are wiped, the string is immutable
+	pinBytes := []byte(pin)
+	verify := apdu(0x00, 0x20, 0x00, reference, pinBytes, false)
+	defer clear(verify)
+	clear(pinBytes)
+	_, err = c.transmit("VERIFY", verify)
+	return err
+}
+
+// transmit sends a command, fetches the remaining response bytes (61xx) and
+// maps the error status words
+func (c *CardSigner) transmit(command string, cmd []byte) ([]byte, error) {
+	var data []byte
+	for {
+		response, err := c.Card.Transmit(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("card: %s: %w", command, err)
+		}
+		if len(response) < 2 {
+			return nil, fmt.Errorf("card: %s: response of %d bytes", command, len(response))
+		}
+		n := len(response) - 2
+		data = append(data, response[:n]...)
+		sw := uint16(response[n])<<8 | uint16(response[n+1])
+		switch {
+		case sw == swOK:
+			return data, nil
+		case sw&0xFF00 == 0x6100:
+			// GET RESPONSE of the remaining bytes
+			cmd = []byte{0x00, 0xC0, 0x00, 0x00, byte(sw)}
+		case sw == swSecurityNotSatisfied:
+			return nil, fmt.Errorf("%w: %w", ErrPINRequired, &CardError{Command: command, SW: sw})
+		case sw == swPINBlocked:
+			return nil, fmt.Errorf("%w: %w", ErrPINBlocked, &CardError{Command: command, SW: sw})
+		case sw&0xFFF0 == 0x63C0 && len(cmd) > 5:
+			// a VERIFY with a PIN
+			return nil, fmt.Errorf("%w, %d retries left: %w", ErrWrongPIN, sw&0x0F, &CardError{Command: command, SW: sw})
+		default:
+			return nil, &CardError{Command: command, SW: sw}
+		}
+	}
+}
+
+// apdu encodes a short command APDU, with Le = 00 (256 bytes) when le is set
+func apdu(cla, ins, p1, p2 byte, data []byte, le bool) []byte {
+	cmd := []byte{cla, ins, p1, p2}
+	if len(data) > 0 {
+		cmd = append(cmd, byte(len(data)))
+		cmd = append(cmd, data...)
+	}
+	if le {
+		cmd = append(cmd, 0x00)
+	}
+	return cmd
+}
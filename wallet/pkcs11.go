@@ -0,0 +1,63 @@
+package wallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// PKCS11Session is the part of a PKCS#11 session the PKCS11Signer uses,
+// implemented by an adapter of the PKCS#11 binding of the application (e.g.
+// github.com/miekg/pkcs11) on an open session of the token
+type PKCS11Session interface {
+	// Login logs the user in (C_Login, CKU_USER). A rejected PIN is
+	// ErrWrongPIN (CKR_PIN_INCORRECT), a blocked one ErrPINBlocked
+	// (CKR_PIN_LOCKED).
+	Login(pin string) error
+	// SignECDSA signs digest with CKM_ECDSA and the private key of the label
+	// (C_FindObjects, C_SignInit, C_Sign) and returns r || s. Without a
+	// logged in user it returns ErrPINRequired (CKR_USER_NOT_LOGGED_IN).
+	SignECDSA(label string, digest []byte) ([]byte, error)
+}
+
+// PKCS11Signer signs with a private key of a PKCS#11 token
+type PKCS11Signer struct {
+	Session PKCS11Session
+	// KeyLabel is the CKA_LABEL of the private key
+	KeyLabel string
+	// PIN prompts for the user PIN when the token requires it, the signature
+	// fails with ErrPINRequired when nil
+	PIN PINPrompt
+}
+
+// SignChallenge implements ChallengeSigner
+func (p *PKCS11Signer) SignChallenge(ctx context.Context, challenge []byte) (*Signature, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(challenge)
+	signature, err := p.Session.SignECDSA(p.KeyLabel, digest[:])
+	if errors.Is(err, ErrPINRequired) && p.PIN != nil {
+		if err := p.login(ctx); err != nil {
+			return nil, err
+		}
+		signature, err = p.Session.SignECDSA(p.KeyLabel, digest[:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: signature with %q failed: %w", p.KeyLabel, err)
+	}
+	return ParseSignature(signature)
+}
+
+// login prompts for the PIN and logs the user in
+func (p *PKCS11Signer) login(ctx context.Context) error {
+	pin, err := p.PIN(ctx, -1)
+	if err != nil {
+		return err
+	}
+	if err := p.Session.Login(pin); err != nil {
+		return fmt.Errorf("pkcs11: login failed: %w", err)
+	}
+	return ctx.Err()
+}
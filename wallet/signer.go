@@ -0,0 +1,218 @@
+// Package wallet is the holder side of the presentations. It signs the
+// challenges of the PoP circuits with a software key or a hardware signature
+// device, such as an eIDAS QSCD reached through PKCS#11 or PC/SC, and converts
+// the signatures to the R/S witness of the circuits.
+//
+// The holder keys are passed as key handles (KeyHandle): a SoftwareKey wiped
+// on Destroy, or a DeviceKey over a device signer, whose private key never
+// leaves the device.
+//
+// The device signers do not link a PKCS#11 or PC/SC library: they drive a
+// PKCS11Session or a CardTransport, small adapters over the binding of the
+// application.
+package wallet
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+var (
+	// ErrPINRequired is returned by a device requiring the PIN of the user,
+	// the signers prompt for it and retry
+	ErrPINRequired = errors.New("PIN required")
+	// ErrWrongPIN is returned for a PIN rejected by the device
+	ErrWrongPIN = errors.New("wrong PIN")
+	// ErrPINBlocked is returned by a device whose PIN is blocked
+	ErrPINBlocked = errors.New("PIN blocked")
+)
+
+// ChallengeSigner signs the challenge of a presentation with the holder key:
+// the ES256 signature of SHA-256(challenge), as the circuits verify it
+// (common.VerifyES256). The signers sign the bytes they are given; the
+// presentation circuits verify the challenge in its signing context, see
+// ContextSigner. A device signer may block on the user, for a PIN or a
+// confirmation on the device, until ctx is done; see SignAsync.
+type ChallengeSigner interface {
+	SignChallenge(ctx context.Context, challenge []byte) (*Signature, error)
+}
+
+// PINPrompt asks the user for the PIN of a device. retries is the number of
+// attempts left, -1 when the device does not tell.
+type PINPrompt func(ctx context.Context, retries int) (string, error)
+
+// Signature is a P-256 ECDSA signature
+type Signature struct {
+	R, S *big.Int
+}
+
+// ecdsaSignature is the DER encoding of an ECDSA signature (RFC 3279)
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// ParseSignature parses a P-256 signature as returned by the devices: raw
+// r || s (64 bytes, PKCS#11 CKM_ECDSA and most cards) or DER
+// (crypto.Signer, some cards)
+func ParseSignature(signature []byte) (*Signature, error) {
+	var sig Signature
+	if len(signature) == 64 {
+		sig.R = new(big.Int).SetBytes(signature[:32])
+		sig.S = new(big.Int).SetBytes(signature[32:])
+	} else {
+		var der ecdsaSignature
+		rest, err := asn1.Unmarshal(signature, &der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature of %d bytes: neither r || s nor DER: %w", len(signature), err)
+		}
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("invalid DER signature: %d trailing bytes", len(rest))
+		}
+		sig.R, sig.S = der.R, der.S
+	}
+	n := elliptic.P256().Params().N
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.Cmp(n) >= 0 || sig.S.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("invalid signature: r or s out of range")
+	}
+	return &sig, nil
+}
+
+// Bytes returns the signature as r || s (64 bytes), the encoding of
+// attestation.AttestedKey.VerifyChallenge
+func (s *Signature) Bytes() []byte {
+	return append(s.R.FillBytes(make([]byte, 32)), s.S.FillBytes(make([]byte, 32))...)
+}
+
+// Verify reports whether the signature of the challenge verifies with key.
+// Check the signature of a device before proving: a signature of another key
+// of the device makes an unsatisfiable witness.
+func (s *Signature) Verify(key *ecdsa.PublicKey, challenge []byte) bool {
+	digest := sha256.Sum256(challenge)
+	return ecdsa.Verify(key, digest[:], s.R, s.S)
+}
+
+// Witness returns the R and S inputs of the circuits
+// (ChallengeSignatureR/S)
+func (s *Signature) Witness() (r, sig emulated.Element[emulated.P256Fr]) {
+	return emulated.ValueOf[emulated.P256Fr](s.R), emulated.ValueOf[emulated.P256Fr](s.S)
+}
+
+// KeySigner signs with a software key the caller keeps and wipes; the SDK
+// holds the keys in a SoftwareKey instead
+type KeySigner struct {
+	Key *ecdsa.PrivateKey
+}
+
+// SignChallenge implements ChallengeSigner
+func (k KeySigner) SignChallenge(_ context.Context, challenge []byte) (*Signature, error) {
+	digest := sha256.Sum256(challenge)
+	r, s, err := ecdsa.Sign(rand.Reader, k.Key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("ES256 signature failed: %w", err)
+	}
+	return &Signature{R: r, S: s}, nil
+}
+
+// CryptoSigner signs with the crypto.Signer of a P-256 key: a key of a
+// platform keystore, or of a PKCS#11 library exposing crypto.Signer
+type CryptoSigner struct {
+	Signer crypto.Signer
+}
+
+// SignChallenge implements ChallengeSigner
+func (c CryptoSigner) SignChallenge(ctx context.Context, challenge []byte) (*Signature, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(challenge)
+	signature, err := c.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("ES256 signature failed: %w", err)
+	}
+	return ParseSignature(signature)
+}
+
+// ContextSigner signs the challenges of a signing context of the holder key
+// (models.ContextMessage): the device signs the context message, the message
+// the circuits verify, so a signature obtained for a verifier challenge is
+// not a signature of an issuer protocol message, and the reverse. Wrap the
+// signers of the holder key in it:
+//
+//	key, err := wallet.GenerateSoftwareKey()
+//	defer key.Destroy()
+//	signer := wallet.NewChallengeSigner(key)
+type ContextSigner struct {
+	Signer ChallengeSigner
+	// Context is models.SigningContextChallenge for the presentations,
+	// models.SigningContextIssuance for the key proofs of an issuer
+	Context string
+	// Legacy signs the bare challenge, for the circuits compiled with
+	// LegacyChallenge during the migration of the verifiers
+	Legacy bool
+}
+
+// NewChallengeSigner returns the signer of the presentation challenges
+func NewChallengeSigner(signer ChallengeSigner) ContextSigner {
+	return ContextSigner{Signer: signer, Context: models.SigningContextChallenge}
+}
+
+// Message returns the message signed for the challenge
+func (c ContextSigner) Message(challenge []byte) ([]byte, error) {
+	if c.Legacy {
+		return challenge, nil
+	}
+	if c.Context == "" {
+		return nil, errors.New("empty signing context")
+	}
+	return models.ContextMessage(c.Context, challenge), nil
+}
+
+// SignChallenge implements ChallengeSigner, signing the context message of
+// the challenge. Verify the signature against Message(challenge).
+func (c ContextSigner) SignChallenge(ctx context.Context, challenge []byte) (*Signature, error) {
+	message, err := c.Message(challenge)
+	if err != nil {
+		return nil, err
+	}
+	return c.Signer.SignChallenge(ctx, message)
+}
+
+// SignResult is the result of SignAsync
+type SignResult struct {
+	Signature *Signature
+	Err       error
+}
+
+// SignAsync signs the challenge in a goroutine, for the user interfaces
+// waiting on a device (PIN prompt, confirmation): the result is sent on the
+// returned channel, then the channel is closed. Canceling ctx abandons the
+// signature, the channel receives ctx.Err() without waiting for the device.
+func SignAsync(ctx context.Context, signer ChallengeSigner, challenge []byte) <-chan SignResult {
+	results := make(chan SignResult, 1)
+	done := make(chan SignResult, 1)
+	go func() {
+		signature, err := signer.SignChallenge(ctx, challenge)
+		done <- SignResult{Signature: signature, Err: err}
+	}()
+	go func() {
+		defer close(results)
+		select {
+		case result := <-done:
+			results <- result
+		case <-ctx.Done():
+			results <- SignResult{Err: ctx.Err()}
+		}
+	}()
+	return results
+}
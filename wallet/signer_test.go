@@ -0,0 +1,262 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestParseSignature(t *testing.T) {
+	key := newKey(t)
+	challenge := []byte("challenge")
+	digest := sha256.Sum256(challenge)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	der, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, encoded := range [][]byte{raw, der} {
+		sig, err := ParseSignature(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sig.Verify(&key.PublicKey, challenge) || !bytes.Equal(sig.Bytes(), raw) {
+			t.Fatalf("unexpected signature of %d bytes", len(encoded))
+		}
+	}
+	sig, _ := ParseSignature(raw)
+	if witnessR, witnessS := sig.Witness(); !reflect.DeepEqual(witnessR, emulated.ValueOf[emulated.P256Fr](r)) || !reflect.DeepEqual(witnessS, emulated.ValueOf[emulated.P256Fr](s)) {
+		t.Fatal("expected the R and S witness")
+	}
+
+	zero, _ := asn1.Marshal(ecdsaSignature{R: big.NewInt(0), S: s})
+	for _, invalid := range [][]byte{raw[:63], append(der, 0), zero, make([]byte, 64)} {
+		if _, err := ParseSignature(invalid); err == nil {
+			t.Fatalf("expected an invalid signature of %d bytes", len(invalid))
+		}
+	}
+}
+
+// fakeSession is a PKCS#11 token requiring a login
+type fakeSession struct {
+	key      *ecdsa.PrivateKey
+	pin      string
+	loggedIn bool
+}
+
+func (f *fakeSession) Login(pin string) error {
+	if pin != f.pin {
+		return ErrWrongPIN
+	}
+	f.loggedIn = true
+	return nil
+}
+
+func (f *fakeSession) SignECDSA(label string, digest []byte) ([]byte, error) {
+	if !f.loggedIn {
+		return nil, ErrPINRequired
+	}
+	if label != "holder" {
+		return nil, errors.New("no key")
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, f.key, digest)
+	if err != nil {
+		return nil, err
+	}
+	return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), nil
+}
+
+func TestPKCS11Signer(t *testing.T) {
+	key := newKey(t)
+	challenge := []byte("challenge")
+	session := &fakeSession{key: key, pin: "1234"}
+
+	signer := &PKCS11Signer{Session: session, KeyLabel: "holder"}
+	if _, err := signer.SignChallenge(t.Context(), challenge); !errors.Is(err, ErrPINRequired) {
+		t.Fatalf("expected ErrPINRequired without prompt, got %v", err)
+	}
+	signer.PIN = func(context.Context, int) (string, error) { return "0000", nil }
+	if _, err := signer.SignChallenge(t.Context(), challenge); !errors.Is(err, ErrWrongPIN) {
+		t.Fatalf("expected ErrWrongPIN, got %v", err)
+	}
+	signer.PIN = func(context.Context, int) (string, error) { return "1234", nil }
+	sig, err := signer.SignChallenge(t.Context(), challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(&key.PublicKey, challenge) {
+		t.Fatal("invalid signature")
+	}
+}
+
+// fakeCard is a signature card requiring the PIN for every signature, its
+// signatures are DER and returned in two parts (61xx)
+type fakeCard struct {
+	key      *ecdsa.PrivateKey
+	pin      string
+	retries  int
+	verified bool
+	pending  []byte
+}
+
+func (c *fakeCard) Transmit(cmd []byte) ([]byte, error) {
+	sw := func(data []byte, sw uint16) []byte { return append(data, byte(sw>>8), byte(sw)) }
+	switch cmd[1] {
+	case 0xA4, 0x22:
+		return sw(nil, 0x9000), nil
+	case 0x20:
+		if len(cmd) == 4 {
+			return sw(nil, 0x63C0|uint16(c.retries)), nil
+		}
+		if c.retries == 0 {
+			return sw(nil, 0x6983), nil
+		}
+		if string(cmd[5:]) != c.pin {
+			c.retries--
+			return sw(nil, 0x63C0|uint16(c.retries)), nil
+		}
+		c.verified = true
+		return sw(nil, 0x9000), nil
+	case 0x2A:
+		if !c.verified {
+			return sw(nil, 0x6982), nil
+		}
+		c.verified = false
+		r, s, err := ecdsa.Sign(rand.Reader, c.key, cmd[5:5+32])
+		if err != nil {
+			return nil, err
+		}
+		der, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+		if err != nil {
+			return nil, err
+		}
+		c.pending = der[16:]
+		return sw(slices.Clone(der[:16]), 0x6100|uint16(len(c.pending))), nil
+	case 0xC0:
+		pending := c.pending
+		c.pending = nil
+		return sw(pending, 0x9000), nil
+	}
+	return sw(nil, 0x6D00), nil
+}
+
+func TestCardSigner(t *testing.T) {
+	key := newKey(t)
+	challenge := []byte("challenge")
+	card := &fakeCard{key: key, pin: "123456", retries: 3}
+
+	var prompted []int
+	pins := []string{"000000", "123456"}
+	signer := &CardSigner{
+		Card:         card,
+		Application:  []byte{0xE8, 0x28, 0xBD, 0x08, 0x0F},
+		KeyReference: 0x84,
+		PIN: func(_ context.Context, retries int) (string, error) {
+			prompted = append(prompted, retries)
+			pin := pins[0]
+			pins = pins[1:]
+			return pin, nil
+		},
+	}
+	if _, err := signer.SignChallenge(t.Context(), challenge); !errors.Is(err, ErrWrongPIN) {
+		t.Fatalf("expected ErrWrongPIN, got %v", err)
+	}
+	sig, err := signer.SignChallenge(t.Context(), challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(&key.PublicKey, challenge) {
+		t.Fatal("invalid signature")
+	}
+	if len(prompted) != 2 || prompted[0] != 3 || prompted[1] != 2 {
+		t.Fatalf("unexpected retries prompted %v", prompted)
+	}
+
+	card.retries = 0
+	if _, err := signer.SignChallenge(t.Context(), challenge); !errors.Is(err, ErrPINBlocked) {
+		t.Fatalf("expected a blocked PIN, got %v", err)
+	}
+}
+
+// blockingSigner waits for the user until its context is done
+type blockingSigner struct{}
+
+func (blockingSigner) SignChallenge(ctx context.Context, _ []byte) (*Signature, error) {
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+	return nil, errors.New("device canceled")
+}
+
+func TestSignAsync(t *testing.T) {
+	key := newKey(t)
+	result := <-SignAsync(t.Context(), KeySigner{Key: key}, []byte("challenge"))
+	if result.Err != nil || !result.Signature.Verify(&key.PublicKey, []byte("challenge")) {
+		t.Fatalf("unexpected result %v", result.Err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	results := SignAsync(ctx, blockingSigner{}, []byte("challenge"))
+	cancel()
+	if result := <-results; !errors.Is(result.Err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", result.Err)
+	}
+	if _, ok := <-results; ok {
+		t.Fatal("expected a closed channel")
+	}
+
+	signer := CryptoSigner{Signer: key}
+	sig, err := signer.SignChallenge(t.Context(), []byte("challenge"))
+	if err != nil || !sig.Verify(&key.PublicKey, []byte("challenge")) {
+		t.Fatalf("unexpected crypto.Signer signature: %v", err)
+	}
+}
+
+func TestContextSigner(t *testing.T) {
+	key := newKey(t)
+	challenge := []byte("challenge")
+	signer := NewChallengeSigner(KeySigner{Key: key})
+	sig, err := signer.SignChallenge(t.Context(), challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(&key.PublicKey, models.ContextMessage(models.SigningContextChallenge, challenge)) || sig.Verify(&key.PublicKey, challenge) {
+		t.Fatal("expected a signature of the context message only")
+	}
+	if sig.Verify(&key.PublicKey, models.ContextMessage(models.SigningContextIssuance, challenge)) {
+		t.Fatal("expected the presentation signature not to verify in the issuance context")
+	}
+
+	signer.Legacy = true
+	if sig, err = signer.SignChallenge(t.Context(), challenge); err != nil || !sig.Verify(&key.PublicKey, challenge) {
+		t.Fatalf("expected a legacy signature of the bare challenge: %v", err)
+	}
+	if _, err := (ContextSigner{Signer: KeySigner{Key: key}}).SignChallenge(t.Context(), challenge); err == nil {
+		t.Fatal("expected an error for an empty signing context")
+	}
+}
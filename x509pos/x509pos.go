@@ -0,0 +1,472 @@
+// Package x509pos parses a DER X.509 certificate off-circuit and returns the
+// byte positions of its fields (RFC 5280, section 4.1). The certificate
+// circuits navigate the DER bytes in-circuit and take these positions as
+// hints; the witness builders and the tests compute them here, once per
+// certificate.
+//
+//	cert, err := x509pos.Parse(certDER)
+//	pubKeyPos := cert.PublicKey.Start                  // in the certificate
+//	pubKeyPosInTBS := cert.InTBS(cert.PublicKey).Start // in the TBSCertificate
+package x509pos
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mynextid/eudi-zk/common/dertags"
+)
+
+// MaxSize bounds the DER certificates Parse and ParseTBS accept: the
+// certificates the circuits take are a few KB, untrusted input past the limit
+// is refused before parsing
+const MaxSize = 64 << 10
+
+// ErrTooLarge is returned for a certificate of more than MaxSize bytes
+var ErrTooLarge = errors.New("certificate exceeds the size limit")
+
+// DER identifier octets of the certificate fields
+const (
+	tagBoolean         = dertags.Boolean
+	tagInteger         = dertags.Integer
+	tagBitString       = dertags.BitString
+	tagOctetString     = dertags.OctetString
+	tagOID             = dertags.ObjectID
+	tagUTCTime         = dertags.UTCTime
+	tagGeneralizedTime = dertags.GeneralizedTime
+	tagSequence        = dertags.Sequence
+	tagVersion         = dertags.Explicit0 // [0] EXPLICIT
+	tagIssuerUniqueID  = dertags.Implicit1 // [1] IMPLICIT
+	tagSubjectUniqueID = dertags.Implicit2 // [2] IMPLICIT
+	tagExtensions      = dertags.Explicit3 // [3] EXPLICIT
+)
+
+// GeneralName tags of the SubjectAlternativeName values (context-specific,
+// IMPLICIT)
+const (
+	GeneralNameEmail = dertags.Implicit1 // rfc822Name [1]
+	GeneralNameDNS   = dertags.Implicit2 // dNSName [2]
+	GeneralNameURI   = dertags.Implicit6 // uniformResourceIdentifier [6]
+	GeneralNameIP    = dertags.Implicit7 // iPAddress [7]
+)
+
+// Curve is the named curve of an EC subject public key (RFC 5480)
+type Curve string
+
+const (
+	CurveP256      Curve = "P-256"
+	CurveSecp256k1 Curve = "secp256k1"
+)
+
+// AlgorithmIdentifiers are the DER encoded subjectPublicKeyInfo
+// AlgorithmIdentifiers of the EC public keys by curve: id-ecPublicKey
+// (1.2.840.10045.2.1) with the namedCurve parameter, prime256v1
+// (1.2.840.10045.3.1.7) or secp256k1 (1.3.132.0.10). The certificate circuits
+// check the bytes preceding the subject public key against them.
+var AlgorithmIdentifiers = map[Curve][]byte{
+	CurveP256:      algorithmIdentifier(dertags.OIDECPublicKey, dertags.OIDPrime256v1),
+	CurveSecp256k1: algorithmIdentifier(dertags.OIDECPublicKey, dertags.OIDSecp256k1),
+}
+
+// algorithmIdentifier returns the AlgorithmIdentifier SEQUENCE of an
+// algorithm and its OID parameter
+func algorithmIdentifier(algorithm, parameter dertags.OID) []byte {
+	content := append(slices.Clone(algorithm), parameter...)
+	return append([]byte{dertags.Sequence, byte(len(content))}, content...)
+}
+
+// Element is a DER element: Start is the position of its tag, Content the
+// position of its content and End the position following it. The zero
+// Element is an absent optional field.
+type Element struct {
+	Start   int
+	Content int
+	End     int
+}
+
+// Present reports whether the element is in the certificate
+func (e Element) Present() bool {
+	return e.End > 0
+}
+
+// Len returns the length of the element, tag and length included
+func (e Element) Len() int {
+	return e.End - e.Start
+}
+
+// Raw returns the element (tag, length and content) in der
+func (e Element) Raw(der []byte) []byte {
+	return der[e.Start:e.End]
+}
+
+// Contents returns the content of the element in der
+func (e Element) Contents(der []byte) []byte {
+	return der[e.Content:e.End]
+}
+
+// Shift returns the element moved by delta bytes, an absent element is
+// returned as is
+func (e Element) Shift(delta int) Element {
+	if !e.Present() {
+		return e
+	}
+	return Element{Start: e.Start + delta, Content: e.Content + delta, End: e.End + delta}
+}
+
+// Extension is an Extension SEQUENCE
+type Extension struct {
+	Element
+	// ID is the extnID OBJECT IDENTIFIER
+	ID Element
+	// Critical is the critical BOOLEAN (FALSE when absent)
+	Critical bool
+	// Value is the extnValue OCTET STRING
+	Value Element
+}
+
+// GeneralName is a GeneralName of the SubjectAlternativeName extension, its
+// content is the value (e.g. the email address)
+type GeneralName struct {
+	Element
+	Tag byte
+}
+
+// Certificate holds the positions of the fields of a certificate. The
+// positions are in the bytes passed to Parse, or to ParseTBS for a bare
+// TBSCertificate (the Certificate, SignatureAlgorithm and SignatureValue are
+// then absent).
+type Certificate struct {
+	// Certificate is the outer Certificate SEQUENCE
+	Certificate Element
+	// TBS is the TBSCertificate SEQUENCE, the signed bytes
+	TBS Element
+
+	Version   Element // [0] EXPLICIT, absent for v1 certificates
+	Serial    Element // serialNumber INTEGER
+	Signature Element // signature AlgorithmIdentifier
+	Issuer    Element // issuer Name
+	Validity  Element
+	NotBefore Element // UTCTime or GeneralizedTime
+	NotAfter  Element
+	Subject   Element // subject Name
+	// SPKI is the SubjectPublicKeyInfo SEQUENCE, PublicKeyAlgorithm its
+	// AlgorithmIdentifier and PublicKey its subjectPublicKey BIT STRING
+	SPKI               Element
+	PublicKeyAlgorithm Element
+	PublicKey          Element
+
+	IssuerUniqueID  Element
+	SubjectUniqueID Element
+	// Extensions is the Extensions SEQUENCE within [3], absent without
+	// extensions; ExtensionList are its elements
+	Extensions    Element
+	ExtensionList []Extension
+	// SAN is the SubjectAlternativeName extension (nil if absent) and
+	// SANNames its GeneralNames
+	SAN      *Extension
+	SANNames []GeneralName
+
+	SignatureAlgorithm Element
+	SignatureValue     Element
+}
+
+// Parse parses a DER certificate. Every element is bounds checked against its
+// enclosing one: truncated or malformed input returns an error, never panics.
+func Parse(der []byte) (*Certificate, error) {
+	if len(der) > MaxSize {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrTooLarge, len(der), MaxSize)
+	}
+	p := parser{der: der}
+	c := &Certificate{}
+	var err error
+
+	if c.Certificate, err = p.expect(0, len(der), tagSequence, "Certificate"); err != nil {
+		return nil, err
+	}
+	if c.Certificate.End != len(der) {
+		return nil, fmt.Errorf("trailing data after the certificate")
+	}
+	if c.TBS, err = p.expect(c.Certificate.Content, c.Certificate.End, tagSequence, "tbsCertificate"); err != nil {
+		return nil, err
+	}
+	if err := p.parseTBS(c); err != nil {
+		return nil, err
+	}
+	if c.SignatureAlgorithm, err = p.expect(c.TBS.End, c.Certificate.End, tagSequence, "signatureAlgorithm"); err != nil {
+		return nil, err
+	}
+	if c.SignatureValue, err = p.expect(c.SignatureAlgorithm.End, c.Certificate.End, tagBitString, "signatureValue"); err != nil {
+		return nil, err
+	}
+	if c.SignatureValue.End != c.Certificate.End {
+		return nil, fmt.Errorf("trailing data in the Certificate SEQUENCE")
+	}
+	return c, nil
+}
+
+// ParseTBS parses a DER TBSCertificate, the positions are relative to tbs
+func ParseTBS(tbs []byte) (*Certificate, error) {
+	if len(tbs) > MaxSize {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrTooLarge, len(tbs), MaxSize)
+	}
+	p := parser{der: tbs}
+	c := &Certificate{}
+	var err error
+
+	if c.TBS, err = p.expect(0, len(tbs), tagSequence, "tbsCertificate"); err != nil {
+		return nil, err
+	}
+	if c.TBS.End != len(tbs) {
+		return nil, fmt.Errorf("trailing data after the TBSCertificate")
+	}
+	if err := p.parseTBS(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// InTBS returns the element relative to the TBSCertificate, as the circuits
+// taking the TBS bytes expect it
+func (c *Certificate) InTBS(e Element) Element {
+	return e.Shift(-c.TBS.Start)
+}
+
+// Extension returns the extension with the DER encoded extnID (e.g.
+// dertags.OIDSubjectAltName), nil if absent
+func (c *Certificate) Extension(der, id []byte) *Extension {
+	for i := range c.ExtensionList {
+		if bytes.Equal(c.ExtensionList[i].ID.Raw(der), id) {
+			return &c.ExtensionList[i]
+		}
+	}
+	return nil
+}
+
+// PublicKeyCurve returns the named curve of the EC subject public key, see
+// AlgorithmIdentifiers
+func (c *Certificate) PublicKeyCurve(der []byte) (Curve, error) {
+	algorithm := c.PublicKeyAlgorithm.Raw(der)
+	for curve, id := range AlgorithmIdentifiers {
+		if bytes.Equal(algorithm, id) {
+			return curve, nil
+		}
+	}
+	return "", fmt.Errorf("subject public key: unsupported algorithm % x", algorithm)
+}
+
+// SANName returns the first GeneralName with the given tag of the
+// SubjectAlternativeName extension
+func (c *Certificate) SANName(tag byte) (*GeneralName, error) {
+	if c.SAN == nil {
+		return nil, fmt.Errorf("certificate has no SubjectAlternativeName extension")
+	}
+	for i := range c.SANNames {
+		if c.SANNames[i].Tag == tag {
+			return &c.SANNames[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no GeneralName with tag 0x%02x", tag)
+}
+
+// parser reads the DER elements of a certificate
+type parser struct {
+	der []byte
+}
+
+// next returns the DER element at idx, which must end before limit
+func (p *parser) next(idx, limit int, name string) (Element, error) {
+	if idx >= limit {
+		return Element{}, fmt.Errorf("%s: missing at %d", name, idx)
+	}
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(p.der[idx:limit], &raw)
+	if err != nil {
+		return Element{}, fmt.Errorf("%s at %d: %w", name, idx, err)
+	}
+	end := limit - len(rest)
+	return Element{Start: idx, Content: end - len(raw.Bytes), End: end}, nil
+}
+
+// expect returns the DER element at idx and checks its tag
+func (p *parser) expect(idx, limit int, tag byte, name string) (Element, error) {
+	if idx < limit && p.der[idx] != tag {
+		return Element{}, fmt.Errorf("%s: expected tag 0x%02x at %d, got 0x%02x", name, tag, idx, p.der[idx])
+	}
+	return p.next(idx, limit, name)
+}
+
+// optional returns the DER element at idx if it has the tag, the zero
+// Element otherwise
+func (p *parser) optional(idx, limit int, tag byte, name string) (Element, error) {
+	if idx >= limit || p.der[idx] != tag {
+		return Element{}, nil
+	}
+	return p.next(idx, limit, name)
+}
+
+// end returns the position following the element, or idx if it is absent
+func end(e Element, idx int) int {
+	if !e.Present() {
+		return idx
+	}
+	return e.End
+}
+
+func (p *parser) parseTBS(c *Certificate) error {
+	idx, limit := c.TBS.Content, c.TBS.End
+	var err error
+
+	if c.Version, err = p.optional(idx, limit, tagVersion, "version"); err != nil {
+		return err
+	}
+	idx = end(c.Version, idx)
+
+	if c.Serial, err = p.expect(idx, limit, tagInteger, "serialNumber"); err != nil {
+		return err
+	}
+	if c.Signature, err = p.expect(c.Serial.End, limit, tagSequence, "signature"); err != nil {
+		return err
+	}
+	if c.Issuer, err = p.expect(c.Signature.End, limit, tagSequence, "issuer"); err != nil {
+		return err
+	}
+
+	if c.Validity, err = p.expect(c.Issuer.End, limit, tagSequence, "validity"); err != nil {
+		return err
+	}
+	if c.NotBefore, err = p.time(c.Validity.Content, c.Validity.End, "notBefore"); err != nil {
+		return err
+	}
+	if c.NotAfter, err = p.time(c.NotBefore.End, c.Validity.End, "notAfter"); err != nil {
+		return err
+	}
+	if c.NotAfter.End != c.Validity.End {
+		return fmt.Errorf("validity: trailing data")
+	}
+
+	if c.Subject, err = p.expect(c.Validity.End, limit, tagSequence, "subject"); err != nil {
+		return err
+	}
+
+	if c.SPKI, err = p.expect(c.Subject.End, limit, tagSequence, "subjectPublicKeyInfo"); err != nil {
+		return err
+	}
+	if c.PublicKeyAlgorithm, err = p.expect(c.SPKI.Content, c.SPKI.End, tagSequence, "subjectPublicKeyInfo algorithm"); err != nil {
+		return err
+	}
+	if c.PublicKey, err = p.expect(c.PublicKeyAlgorithm.End, c.SPKI.End, tagBitString, "subjectPublicKey"); err != nil {
+		return err
+	}
+	if c.PublicKey.End != c.SPKI.End {
+		return fmt.Errorf("subjectPublicKeyInfo: trailing data")
+	}
+	idx = c.SPKI.End
+
+	if c.IssuerUniqueID, err = p.optional(idx, limit, tagIssuerUniqueID, "issuerUniqueID"); err != nil {
+		return err
+	}
+	idx = end(c.IssuerUniqueID, idx)
+	if c.SubjectUniqueID, err = p.optional(idx, limit, tagSubjectUniqueID, "subjectUniqueID"); err != nil {
+		return err
+	}
+	idx = end(c.SubjectUniqueID, idx)
+
+	extensions, err := p.optional(idx, limit, tagExtensions, "extensions")
+	if err != nil {
+		return err
+	}
+	if extensions.Present() {
+		if c.Extensions, err = p.expect(extensions.Content, extensions.End, tagSequence, "extensions"); err != nil {
+			return err
+		}
+		if c.Extensions.End != extensions.End {
+			return fmt.Errorf("extensions: trailing data")
+		}
+		if err := p.parseExtensions(c); err != nil {
+			return err
+		}
+		idx = extensions.End
+	}
+
+	if idx != limit {
+		return fmt.Errorf("tbsCertificate: unexpected tag 0x%02x at %d", p.der[idx], idx)
+	}
+	return nil
+}
+
+// time returns the UTCTime or GeneralizedTime at idx
+func (p *parser) time(idx, limit int, name string) (Element, error) {
+	if idx < limit && p.der[idx] != tagUTCTime && p.der[idx] != tagGeneralizedTime {
+		return Element{}, fmt.Errorf("%s: expected a time at %d, got tag 0x%02x", name, idx, p.der[idx])
+	}
+	return p.next(idx, limit, name)
+}
+
+func (p *parser) parseExtensions(c *Certificate) error {
+	for idx := c.Extensions.Content; idx < c.Extensions.End; {
+		name := fmt.Sprintf("extension %d", len(c.ExtensionList))
+		ext, err := p.parseExtension(idx, c.Extensions.End, name)
+		if err != nil {
+			return err
+		}
+		c.ExtensionList = append(c.ExtensionList, ext)
+		idx = ext.End
+	}
+
+	c.SAN = c.Extension(p.der, dertags.OIDSubjectAltName)
+	if c.SAN == nil {
+		return nil
+	}
+
+	// GeneralNames SEQUENCE
+	names, err := p.expect(c.SAN.Value.Content, c.SAN.Value.End, tagSequence, "subjectAltName")
+	if err != nil {
+		return err
+	}
+	if names.End != c.SAN.Value.End {
+		return fmt.Errorf("subjectAltName: trailing data")
+	}
+	for idx := names.Content; idx < names.End; {
+		name, err := p.next(idx, names.End, "subjectAltName GeneralName")
+		if err != nil {
+			return err
+		}
+		c.SANNames = append(c.SANNames, GeneralName{Element: name, Tag: p.der[idx]})
+		idx = name.End
+	}
+	return nil
+}
+
+func (p *parser) parseExtension(idx, limit int, name string) (Extension, error) {
+	var (
+		ext Extension
+		err error
+	)
+	if ext.Element, err = p.expect(idx, limit, tagSequence, name); err != nil {
+		return ext, err
+	}
+	if ext.ID, err = p.expect(ext.Content, ext.End, tagOID, name+" extnID"); err != nil {
+		return ext, err
+	}
+
+	critical, err := p.optional(ext.ID.End, ext.End, tagBoolean, name+" critical")
+	if err != nil {
+		return ext, err
+	}
+	if critical.Present() {
+		if critical.Len() != 3 {
+			return ext, fmt.Errorf("%s critical: invalid BOOLEAN", name)
+		}
+		ext.Critical = p.der[critical.Content] != 0
+	}
+
+	if ext.Value, err = p.expect(end(critical, ext.ID.End), ext.End, tagOctetString, name+" extnValue"); err != nil {
+		return ext, err
+	}
+	if ext.Value.End != ext.End {
+		return ext, fmt.Errorf("%s: trailing data", name)
+	}
+	return ext, nil
+}
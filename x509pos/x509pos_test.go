@@ -0,0 +1,309 @@
+package x509pos
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mynextid/eudi-zk/datagen"
+)
+
+func mockCertificate(t testing.TB, template *x509.Certificate) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certDER
+}
+
+func mockTemplates() []*x509.Certificate {
+	uri, _ := url.Parse("https://issuer.example/holder")
+	return []*x509.Certificate{
+		{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "Test Signer"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		},
+		{
+			SerialNumber:          new(big.Int).Lsh(big.NewInt(1), 150),
+			Subject:               pkix.Name{Organization: []string{"Test Org"}, CommonName: "Test Holder"},
+			NotBefore:             time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:              time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC), // GeneralizedTime
+			KeyUsage:              x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			EmailAddresses:        []string{"holder@example.com"},
+			DNSNames:              []string{"holder.example"},
+			URIs:                  []*url.URL{uri},
+			IPAddresses:           []net.IP{net.IPv4(192, 0, 2, 1)},
+		},
+	}
+}
+
+// qtspCertificates are certificates of the QTSP profile: long DNs, many
+// extensions, long serials and long form lengths
+func qtspCertificates(t testing.TB) [][]byte {
+	t.Helper()
+	gen := datagen.New("x509pos")
+	ca, err := gen.Certificate("Example QCA", nil, datagen.CertOptions{Profile: datagen.ProfileQTSP, CA: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := [][]byte{ca.DER}
+	for _, size := range []int{0, 2048} {
+		leaf, err := gen.Certificate("holder", ca, datagen.CertOptions{Profile: datagen.ProfileQTSP, SerialLen: 20, MinSize: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, leaf.DER)
+	}
+	return certs
+}
+
+func TestParseQTSP(t *testing.T) {
+	for _, der := range qtspCertificates(t) {
+		checkAgreement(t, der)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, template := range mockTemplates() {
+		certDER := mockCertificate(t, template)
+		checkAgreement(t, certDER)
+
+		c, err := Parse(certDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the subject public key: BIT STRING, 66 bytes, uncompressed point
+		if header := c.PublicKey.Raw(certDER)[:4]; string(header) != "\x03\x42\x00\x04" {
+			t.Fatalf("unexpected subject public key header %x", header)
+		}
+		if curve, err := c.PublicKeyCurve(certDER); err != nil || curve != CurveP256 {
+			t.Fatalf("expected a P-256 subject public key, got %q %v", curve, err)
+		}
+
+		// positions in the bare TBSCertificate
+		tbs := c.TBS.Raw(certDER)
+		inTBS, err := ParseTBS(tbs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inTBS.PublicKey != c.InTBS(c.PublicKey) || inTBS.Serial != c.InTBS(c.Serial) {
+			t.Fatalf("TBS positions %+v do not match %+v", inTBS.PublicKey, c.InTBS(c.PublicKey))
+		}
+		if inTBS.Certificate.Present() || inTBS.SignatureValue.Present() {
+			t.Fatal("ParseTBS returned certificate fields")
+		}
+	}
+}
+
+func TestSANName(t *testing.T) {
+	templates := mockTemplates()
+
+	c, err := Parse(mockCertificate(t, templates[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SANName(GeneralNameEmail); err == nil {
+		t.Fatal("expected an error without SubjectAlternativeName")
+	}
+
+	certDER := mockCertificate(t, templates[1])
+	if c, err = Parse(certDER); err != nil {
+		t.Fatal(err)
+	}
+	for tag, want := range map[byte]string{
+		GeneralNameEmail: "holder@example.com",
+		GeneralNameDNS:   "holder.example",
+		GeneralNameURI:   "https://issuer.example/holder",
+		GeneralNameIP:    "\xc0\x00\x02\x01",
+	} {
+		name, err := c.SANName(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(name.Contents(certDER)); got != want {
+			t.Errorf("GeneralName 0x%02x: got %q, want %q", tag, got, want)
+		}
+	}
+	if _, err := c.SANName(0x88); err == nil {
+		t.Fatal("expected an error for a missing GeneralName")
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	certDER := mockCertificate(t, mockTemplates()[1])
+	c, err := Parse(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"empty":         nil,
+		"truncated":     certDER[:len(certDER)-1],
+		"trailing data": append(bytes.Clone(certDER), 0),
+		"serial tag":    replaceAt(certDER, c.Serial.Start, 0x04),
+		"validity tag":  replaceAt(certDER, c.NotBefore.Start, 0x02),
+		"public key":    replaceAt(certDER, c.PublicKey.Start, 0x04),
+		"length":        replaceAt(certDER, c.TBS.Start+1, 0xFF),
+	}
+	for name, der := range tests {
+		if _, err := Parse(der); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// a SEQUENCE announcing more than the limit
+	large := append([]byte{0x30, 0x83, 0x01, 0x00, 0x00}, make([]byte, 1<<16)...)
+	if _, err := Parse(large); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+	if _, err := ParseTBS(large); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge for a TBSCertificate, got %v", err)
+	}
+}
+
+func replaceAt(data []byte, idx int, b byte) []byte {
+	data = bytes.Clone(data)
+	data[idx] = b
+	return data
+}
+
+// FuzzParse checks Parse agrees with x509.ParseCertificate on every
+// certificate the standard library accepts, and never panics
+func FuzzParse(f *testing.F) {
+	for _, template := range mockTemplates() {
+		f.Add(mockCertificate(f, template))
+	}
+	for _, der := range qtspCertificates(f) {
+		f.Add(der)
+	}
+	f.Fuzz(func(t *testing.T, der []byte) {
+		if _, err := x509.ParseCertificate(der); err != nil {
+			Parse(der)
+			return
+		}
+		checkAgreement(t, der)
+	})
+}
+
+// FuzzParseTBS checks ParseTBS never panics, and agrees with Parse on the
+// TBSCertificate of a valid certificate
+func FuzzParseTBS(f *testing.F) {
+	for _, template := range mockTemplates() {
+		der := mockCertificate(f, template)
+		c, err := Parse(der)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(c.TBS.Raw(der))
+	}
+	f.Fuzz(func(t *testing.T, tbs []byte) {
+		c, err := ParseTBS(tbs)
+		if err != nil {
+			return
+		}
+		if c.TBS.Start != 0 || c.TBS.End != len(tbs) || c.PublicKey.End > len(tbs) || c.PublicKey.Start >= c.PublicKey.End {
+			t.Fatalf("inconsistent positions %+v", c)
+		}
+	})
+}
+
+// checkAgreement checks the positions against the fields parsed by the
+// standard library
+func checkAgreement(t *testing.T, der []byte) {
+	t.Helper()
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Parse(der)
+	if err != nil {
+		t.Fatalf("rejected a valid certificate: %v", err)
+	}
+
+	for _, field := range []struct {
+		name string
+		e    Element
+		raw  []byte
+	}{
+		{"tbsCertificate", c.TBS, cert.RawTBSCertificate},
+		{"issuer", c.Issuer, cert.RawIssuer},
+		{"subject", c.Subject, cert.RawSubject},
+		{"subjectPublicKeyInfo", c.SPKI, cert.RawSubjectPublicKeyInfo},
+	} {
+		if !bytes.Equal(field.e.Raw(der), field.raw) {
+			t.Fatalf("%s at %d does not match", field.name, field.e.Start)
+		}
+	}
+
+	var serial *big.Int
+	if _, err := asn1.Unmarshal(c.Serial.Raw(der), &serial); err != nil || serial.Cmp(cert.SerialNumber) != 0 {
+		t.Fatalf("serialNumber at %d does not match: %v", c.Serial.Start, err)
+	}
+	var spki struct {
+		Algorithm asn1.RawValue
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(c.PublicKey.Contents(der), spki.PublicKey.Bytes) {
+		t.Fatalf("subjectPublicKey at %d does not match", c.PublicKey.Start)
+	}
+	if sig := c.SignatureValue.Contents(der); len(sig) == 0 || !bytes.Equal(sig[1:], cert.Signature) {
+		t.Fatalf("signatureValue at %d does not match", c.SignatureValue.Start)
+	}
+	if c.Version.Present() != (cert.Version > 1) {
+		t.Fatalf("version present %v for v%d", c.Version.Present(), cert.Version)
+	}
+
+	if len(c.ExtensionList) != len(cert.Extensions) {
+		t.Fatalf("%d extensions, want %d", len(c.ExtensionList), len(cert.Extensions))
+	}
+	for i, ext := range cert.Extensions {
+		id, err := asn1.Marshal(ext.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := c.ExtensionList[i]
+		if !bytes.Equal(got.ID.Raw(der), id) || got.Critical != ext.Critical || !bytes.Equal(got.Value.Contents(der), ext.Value) {
+			t.Fatalf("extension %d (%v) at %d does not match", i, ext.Id, got.Start)
+		}
+	}
+
+	names := map[byte]int{}
+	for _, name := range c.SANNames {
+		names[name.Tag]++
+	}
+	if names[GeneralNameEmail] != len(cert.EmailAddresses) || names[GeneralNameDNS] != len(cert.DNSNames) ||
+		names[GeneralNameURI] != len(cert.URIs) || names[GeneralNameIP] != len(cert.IPAddresses) {
+		t.Fatalf("SubjectAlternativeName names %v do not match", names)
+	}
+
+	for _, e := range []Element{c.Certificate, c.TBS, c.Version, c.Serial, c.Signature, c.Issuer, c.Validity, c.NotBefore,
+		c.NotAfter, c.Subject, c.SPKI, c.PublicKeyAlgorithm, c.PublicKey, c.Extensions, c.SignatureAlgorithm, c.SignatureValue} {
+		if e.Present() && (e.Start < 0 || e.Start >= e.Content || e.Content > e.End || e.End > len(der)) {
+			t.Fatalf("invalid element %+v", e)
+		}
+	}
+}
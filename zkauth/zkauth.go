@@ -0,0 +1,284 @@
+// Package zkauth protects the routes of a relying-party backend with
+// zero-knowledge presentations ("must present a valid over-18 proof"). The
+// Guard middleware extracts a ZkPresentation from a header or a cookie,
+// verifies it with a models.PresentationVerifier and the configured Policy,
+// and injects the verified claims in the request context (FromContext).
+// Positive results are cached per session, so the presentation is verified
+// once per session instead of once per request.
+//
+// Middleware has the func(http.Handler) http.Handler signature of the
+// standard library and chi middlewares:
+//
+//	guard, err := zkauth.NewGuard(zkauth.Config{
+//	    Verifier: verifier,
+//	    Policy:   zkauth.Policy{Circuits: []string{"temporal/over18"}, Audience: "https://rp.example", MaxAge: 5 * time.Minute},
+//	    Session:  zkauth.CookieSession("session_id"),
+//	    CacheTTL: time.Hour,
+//	})
+//	router.With(guard.Middleware).Get("/wine", handler)
+package zkauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// DefaultHeader is the request header carrying the presentation (compact
+// serialization) when Config.Header is empty
+const DefaultHeader = "X-ZK-Presentation"
+
+// defaultMaxSessions bounds the cached sessions when Config.MaxSessions is 0
+const defaultMaxSessions = 10_000
+
+// maxClockSkew is the accepted issued-at time in the future
+const maxClockSkew = time.Minute
+
+var (
+	// ErrNoPresentation is returned when the request carries no presentation
+	ErrNoPresentation = errors.New("no presentation")
+	// ErrPolicy wraps the presentations that verify but do not satisfy the
+	// policy
+	ErrPolicy = errors.New("presentation rejected by policy")
+)
+
+// Policy is what a relying party accepts on top of a valid proof
+type Policy struct {
+	// Circuits are the accepted circuits, every circuit registered with the
+	// verifier when empty
+	Circuits []string
+	// Audience is the expected aud of the payload, not checked when empty
+	Audience string
+	// MaxAge bounds the age of the presentation (iat), not checked when 0
+	MaxAge time.Duration
+	// Check is called with the verified presentation for the relying party
+	// checks (e.g. the proven attributes), optional
+	Check func(res *models.VerificationResult) error
+}
+
+// Verify checks a verification result against the policy
+func (p *Policy) Verify(res *models.VerificationResult, now time.Time) error {
+	if len(p.Circuits) > 0 && !slices.Contains(p.Circuits, res.Circuit) {
+		return fmt.Errorf("%w: circuit %q not accepted", ErrPolicy, res.Circuit)
+	}
+	if res.Presentation == nil {
+		return fmt.Errorf("%w: not a presentation", ErrPolicy)
+	}
+	payload := res.Presentation.Payload
+	if p.Audience != "" && payload.Audience != p.Audience {
+		return fmt.Errorf("%w: audience %q, expected %q", ErrPolicy, payload.Audience, p.Audience)
+	}
+	if p.MaxAge > 0 {
+		issuedAt := time.Unix(payload.IssuedAt, 0)
+		if now.Sub(issuedAt) > p.MaxAge || issuedAt.Sub(now) > maxClockSkew {
+			return fmt.Errorf("%w: issued at %v, maximum age %v", ErrPolicy, issuedAt, p.MaxAge)
+		}
+	}
+	if p.Check != nil {
+		if err := p.Check(res); err != nil {
+			return fmt.Errorf("%w: %w", ErrPolicy, err)
+		}
+	}
+	return nil
+}
+
+// Config configures a Guard
+type Config struct {
+	Verifier *models.PresentationVerifier
+	Policy   Policy
+	// Header is the request header carrying the presentation, DefaultHeader
+	// when empty
+	Header string
+	// Cookie is the cookie carrying the presentation when the header is
+	// absent, not read when empty
+	Cookie string
+	// Session returns the session of a request (e.g. CookieSession), results
+	// are not cached when nil or when it returns ""
+	Session func(r *http.Request) string
+	// CacheTTL is how long a positive result is cached per session, not
+	// cached when 0. The policy MaxAge applies to the presentation when it is
+	// verified, not to the cached result.
+	CacheTTL time.Duration
+	// MaxSessions bounds the cached sessions, 10000 when 0
+	MaxSessions int
+	// OnError writes the response of rejected requests: 401 Unauthorized by
+	// default, 403 Forbidden for policy errors
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Verified are the verified claims of a request
+type Verified struct {
+	Circuit string
+	// Claims are the disclosed claims of the presentation payload
+	Claims map[string]any
+	// Attributes are the proven attributes of circuits with attribute slots
+	Attributes map[string]models.AttributeDigest
+	// ExpiresAt is the end of the cached result of the session (zero when
+	// not cached)
+	ExpiresAt time.Time
+}
+
+// Guard verifies the presentations of the requests
+type Guard struct {
+	cfg Config
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*Verified
+}
+
+// NewGuard returns a guard verifying with cfg.Verifier
+func NewGuard(cfg Config) (*Guard, error) {
+	if cfg.Verifier == nil {
+		return nil, fmt.Errorf("no verifier")
+	}
+	if cfg.Header == "" {
+		cfg.Header = DefaultHeader
+	}
+	if cfg.MaxSessions == 0 {
+		cfg.MaxSessions = defaultMaxSessions
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = writeError
+	}
+	return &Guard{cfg: cfg, now: time.Now, sessions: map[string]*Verified{}}, nil
+}
+
+// CookieSession returns the value of the session cookie name
+func CookieSession(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+type contextKey struct{}
+
+// FromContext returns the verified claims injected by Guard.Middleware
+func FromContext(ctx context.Context) (*Verified, bool) {
+	v, ok := ctx.Value(contextKey{}).(*Verified)
+	return v, ok
+}
+
+// Middleware serves next only for requests with a valid presentation, or a
+// session with a cached positive result
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, err := g.Verify(r)
+		if err != nil {
+			g.cfg.OnError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, v)))
+	})
+}
+
+// Verify returns the cached result of the session of r, or verifies the
+// presentation of r and caches the result
+func (g *Guard) Verify(r *http.Request) (*Verified, error) {
+	now := g.now()
+	session := ""
+	if g.cfg.Session != nil && g.cfg.CacheTTL > 0 {
+		session = g.cfg.Session(r)
+	}
+	if v := g.cached(session, now); v != nil {
+		return v, nil
+	}
+
+	presentation := g.presentation(r)
+	if presentation == "" {
+		return nil, ErrNoPresentation
+	}
+	res, err := g.cfg.Verifier.Verify(presentation)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.cfg.Policy.Verify(res, now); err != nil {
+		return nil, err
+	}
+
+	v := &Verified{
+		Circuit:    res.Circuit,
+		Claims:     res.Presentation.Payload.Claims,
+		Attributes: res.PublicInputs.Attributes,
+	}
+	if session != "" {
+		v.ExpiresAt = now.Add(g.cfg.CacheTTL)
+		g.store(session, v, now)
+	}
+	return v, nil
+}
+
+// Forget drops the cached result of a session, e.g. on logout
+func (g *Guard) Forget(session string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.sessions, session)
+}
+
+func (g *Guard) presentation(r *http.Request) string {
+	if p := strings.TrimSpace(r.Header.Get(g.cfg.Header)); p != "" {
+		return p
+	}
+	if g.cfg.Cookie != "" {
+		if cookie, err := r.Cookie(g.cfg.Cookie); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func (g *Guard) cached(session string, now time.Time) *Verified {
+	if session == "" {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v, ok := g.sessions[session]
+	if !ok {
+		return nil
+	}
+	if !now.Before(v.ExpiresAt) {
+		delete(g.sessions, session)
+		return nil
+	}
+	return v
+}
+
+func (g *Guard) store(session string, v *Verified, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.sessions) >= g.cfg.MaxSessions {
+		for s, cached := range g.sessions {
+			if !now.Before(cached.ExpiresAt) {
+				delete(g.sessions, s)
+			}
+		}
+	}
+	if len(g.sessions) >= g.cfg.MaxSessions {
+		// still full, drop an arbitrary session
+		for s := range g.sessions {
+			delete(g.sessions, s)
+			break
+		}
+	}
+	g.sessions[session] = v
+}
+
+func writeError(w http.ResponseWriter, _ *http.Request, err error) {
+	status := http.StatusUnauthorized
+	if errors.Is(err, ErrPolicy) {
+		status = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), status)
+}
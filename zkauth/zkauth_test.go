@@ -0,0 +1,224 @@
+package zkauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/mynextid/eudi-zk/common"
+	"github.com/mynextid/eudi-zk/models"
+)
+
+// cubeCircuit proves knowledge of X with X^3 = Y
+type cubeCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *cubeCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X, c.X), c.Y)
+	return nil
+}
+
+type fixture struct {
+	verifier  *models.PresentationVerifier
+	holderKey *ecdsa.PrivateKey
+	header    models.PresentationHeader
+	proof     []byte
+	witness   []byte
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cubeCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := common.NewProver(ccs, pk).Prove(&cubeCircuit{X: 3, Y: 27})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkHash, err := common.VerifyingKeyHash(vk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{
+		proof:   res.Proof,
+		witness: res.PublicWitness,
+		header:  models.PresentationHeader{Circuit: "cube/v1", VKHash: hex.EncodeToString(vkHash[:])},
+	}
+	if f.holderKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	f.verifier = models.NewPresentationVerifier(func(models.PresentationHeader) (*ecdsa.PublicKey, error) {
+		return &f.holderKey.PublicKey, nil
+	})
+	if err := f.verifier.AddCircuit("cube/v1", vk, nil); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f *fixture) presentation(t *testing.T, audience string, issuedAt time.Time) string {
+	t.Helper()
+	payload := models.PresentationPayload{
+		Audience:      audience,
+		IssuedAt:      issuedAt.Unix(),
+		ExpiresAt:     issuedAt.Add(24 * time.Hour).Unix(),
+		PublicWitness: f.witness,
+		Claims:        map[string]any{"age_over_18": true},
+	}
+	compact, err := models.SignPresentation(f.header, payload, f.proof, f.holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compact
+}
+
+// protected answers with the verified claims of the request
+var protected = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	v, ok := FromContext(r.Context())
+	if !ok || v.Claims["age_over_18"] != true {
+		http.Error(w, "no verified claims", http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(v.Circuit))
+})
+
+func serve(t *testing.T, h http.Handler, presentation, session string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/wine", nil)
+	if presentation != "" {
+		r.Header.Set(DefaultHeader, presentation)
+	}
+	if session != "" {
+		r.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	f := newFixture(t)
+	now := time.Now()
+
+	guard, err := NewGuard(Config{
+		Verifier: f.verifier,
+		Policy:   Policy{Circuits: []string{"cube/v1"}, Audience: "https://rp.example", MaxAge: 5 * time.Minute},
+		Session:  CookieSession("session_id"),
+		CacheTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard.now = func() time.Time { return now }
+	h := guard.Middleware(protected)
+
+	valid := f.presentation(t, "https://rp.example", now)
+	if w := serve(t, h, valid, ""); w.Code != http.StatusOK || w.Body.String() != "cube/v1" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body)
+	}
+
+	tests := map[string]struct {
+		presentation string
+		status       int
+	}{
+		"missing":      {"", http.StatusUnauthorized},
+		"malformed":    {"a.b.c.d", http.StatusUnauthorized},
+		"audience":     {f.presentation(t, "https://other.example", now), http.StatusForbidden},
+		"expired":      {f.presentation(t, "https://rp.example", now.Add(-time.Hour)), http.StatusForbidden},
+		"future":       {f.presentation(t, "https://rp.example", now.Add(time.Hour)), http.StatusForbidden},
+		"tampered sig": {valid[:len(valid)-4] + "AAAA", http.StatusUnauthorized},
+	}
+	for name, tt := range tests {
+		if w := serve(t, h, tt.presentation, ""); w.Code != tt.status {
+			t.Errorf("%s: got %d %q, expected %d", name, w.Code, w.Body, tt.status)
+		}
+	}
+
+	// the session is verified once, then served from the cache
+	if w := serve(t, h, valid, "s1"); w.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body)
+	}
+	if w := serve(t, h, "", "s1"); w.Code != http.StatusOK {
+		t.Fatalf("cached session rejected: %d %q", w.Code, w.Body)
+	}
+	if w := serve(t, h, "", "s2"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown session accepted: %d", w.Code)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if w := serve(t, h, "", "s1"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expired session accepted: %d", w.Code)
+	}
+
+	guard.now = time.Now
+	if w := serve(t, h, f.presentation(t, "https://rp.example", time.Now()), "s3"); w.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body)
+	}
+	guard.Forget("s3")
+	if w := serve(t, h, "", "s3"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("forgotten session accepted: %d", w.Code)
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	f := newFixture(t)
+	errMinor := errors.New("minor")
+	guard, err := NewGuard(Config{
+		Verifier: f.verifier,
+		Cookie:   "zkp",
+		Policy: Policy{Check: func(res *models.VerificationResult) error {
+			if res.Presentation.Payload.Claims["age_over_18"] != true {
+				return errMinor
+			}
+			return nil
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// presentation in a cookie
+	r := httptest.NewRequest(http.MethodGet, "/wine", nil)
+	r.AddCookie(&http.Cookie{Name: "zkp", Value: f.presentation(t, "", time.Now())})
+	v, err := guard.Verify(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.ExpiresAt.IsZero() {
+		t.Fatal("result cached without session")
+	}
+
+	payload := models.PresentationPayload{IssuedAt: time.Now().Unix(), PublicWitness: f.witness}
+	minor, err := models.SignPresentation(f.header, payload, f.proof, f.holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/wine", nil)
+	r.Header.Set(DefaultHeader, minor)
+	if _, err := guard.Verify(r); !errors.Is(err, ErrPolicy) || !errors.Is(err, errMinor) {
+		t.Fatalf("expected the policy check error, got %v", err)
+	}
+
+	if _, err := NewGuard(Config{}); err == nil {
+		t.Fatal("expected an error without verifier")
+	}
+}